@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // Config represents the API configuration
@@ -30,6 +31,17 @@ type ServerConfig struct {
 	EnableHTTPS  bool   `json:"enable_https"`
 	CertFile     string `json:"cert_file,omitempty"`
 	KeyFile      string `json:"key_file,omitempty"`
+	// EnableHTTP2 offers HTTP/2 on the TLS listener
+	EnableHTTP2 bool `json:"enable_http2"`
+	// EnableH2C accepts cleartext HTTP/2 with prior knowledge on the HTTP
+	// port, for reverse proxies that speak h2c to the backend
+	EnableH2C bool `json:"enable_h2c"`
+	// EnableHTTP3 serves experimental HTTP/3 (QUIC) over UDP on the TLS
+	// port and advertises it with Alt-Svc
+	EnableHTTP3 bool `json:"enable_http3"`
+	// TrustedProxies lists the reverse proxies, as IP addresses or CIDR
+	// ranges, whose X-Forwarded-* and X-Real-IP headers are believed
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
 }
 
 // DatabaseConfig contains database connection configuration.
@@ -48,6 +60,7 @@ type DatabaseConfig struct {
 	EnableWAL          bool   `json:"enable_wal"`
 	CacheSize          int    `json:"cache_size"`
 	BusyTimeout        int    `json:"busy_timeout"`
+	Encryption         DatabaseEncryptionConfig `json:"encryption"`
 	// Common
 	MaxOpenConnections int    `json:"max_open_connections"`
 	MaxIdleConnections int    `json:"max_idle_connections"`
@@ -55,6 +68,21 @@ type DatabaseConfig struct {
 	ConnMaxIdleTime    int    `json:"conn_max_idle_time"`
 }
 
+// DatabaseEncryptionConfig enables SQLCipher encryption of the SQLite
+// database. The key is taken from the first source that yields one: the
+// KeyEnv environment variable, KeyFile, then a passphrase typed at the
+// terminal when PromptPassphrase is set.
+type DatabaseEncryptionConfig struct {
+	Enabled bool `json:"enabled"`
+	// KeyEnv names the environment variable holding the key; it defaults
+	// to DATABASE_ENCRYPTION_KEY
+	KeyEnv string `json:"key_env,omitempty"`
+	// KeyFile is read with surrounding whitespace trimmed, and must not be
+	// readable by group or others
+	KeyFile          string `json:"key_file,omitempty"`
+	PromptPassphrase bool   `json:"prompt_passphrase,omitempty"`
+}
+
 // AuthConfig contains authentication configuration
 type AuthConfig struct {
 	JWTSecret          string `json:"jwt_secret"`
@@ -62,6 +90,70 @@ type AuthConfig struct {
 	EnableAuth         bool   `json:"enable_auth"`
 	AdminUsername      string `json:"admin_username"`
 	AdminPassword      string `json:"admin_password"`
+	// External auth webhook: logins that fail locally are verified against
+	// this HMAC-signed endpoint when a URL is set
+	WebhookURL           string `json:"webhook_url,omitempty"`
+	WebhookSecret        string `json:"webhook_secret,omitempty"`
+	WebhookTimeoutMs     int    `json:"webhook_timeout_ms,omitempty"`
+	WebhookCacheSeconds  int    `json:"webhook_cache_seconds,omitempty"`
+	WebhookAutoProvision bool   `json:"webhook_auto_provision,omitempty"`
+	// Account lockout after failed logins; zero values keep the defaults
+	// (5 attempts, 15 minutes doubling up to 24 hours), and a negative
+	// LockoutAttempts disables lockout
+	LockoutAttempts   int `json:"lockout_attempts,omitempty"`
+	LockoutMinutes    int `json:"lockout_minutes,omitempty"`
+	LockoutMaxMinutes int `json:"lockout_max_minutes,omitempty"`
+	// Sign-in through Google, GitHub or OpenID Connect providers
+	OIDCProviders []OIDCProviderConfig `json:"oidc_providers,omitempty"`
+	// Sign-in with LDAP or Active Directory credentials, checked before
+	// local passwords
+	LDAP *LDAPConfig `json:"ldap,omitempty"`
+}
+
+// LDAPConfig configures directory sign-in. The bind password can also be
+// set with LDAP_BIND_PASSWORD. Group roles are tried in order and the
+// first group the user is in gives their role.
+type LDAPConfig struct {
+	URL                 string                `json:"url"`
+	StartTLS            bool                  `json:"start_tls,omitempty"`
+	CACertFile          string                `json:"ca_cert_file,omitempty"`
+	BindDN              string                `json:"bind_dn,omitempty"`
+	BindPassword        string                `json:"bind_password,omitempty"`
+	BaseDN              string                `json:"base_dn"`
+	UserFilter          string                `json:"user_filter,omitempty"`
+	UsernameAttributes  []string              `json:"username_attributes,omitempty"`
+	EmailAttribute      string                `json:"email_attribute,omitempty"`
+	FirstNameAttribute  string                `json:"first_name_attribute,omitempty"`
+	LastNameAttribute   string                `json:"last_name_attribute,omitempty"`
+	GroupBaseDN         string                `json:"group_base_dn,omitempty"`
+	GroupFilter         string                `json:"group_filter,omitempty"`
+	GroupRoles          []LDAPGroupRoleConfig `json:"group_roles,omitempty"`
+	DefaultRoleID       int                   `json:"default_role_id,omitempty"`
+	RequireGroup        bool                  `json:"require_group,omitempty"`
+	AutoProvision       bool                  `json:"auto_provision,omitempty"`
+	TimeoutSeconds      int                   `json:"timeout_seconds,omitempty"`
+	SyncIntervalMinutes int                   `json:"sync_interval_minutes,omitempty"`
+}
+
+// LDAPGroupRoleConfig gives members of a directory group, named by DN or
+// by name, a role
+type LDAPGroupRoleConfig struct {
+	Group  string `json:"group"`
+	RoleID int    `json:"role_id"`
+}
+
+// OIDCProviderConfig configures one external identity provider. The
+// client secret can also be set with OIDC_<NAME>_CLIENT_SECRET.
+type OIDCProviderConfig struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type,omitempty"`
+	IssuerURL     string   `json:"issuer_url,omitempty"`
+	ClientID      string   `json:"client_id"`
+	ClientSecret  string   `json:"client_secret,omitempty"`
+	RedirectURL   string   `json:"redirect_url"`
+	Scopes        []string `json:"scopes,omitempty"`
+	AutoProvision bool     `json:"auto_provision,omitempty"`
+	DefaultRoleID int      `json:"default_role_id,omitempty"`
 }
 
 // CatalogConfig contains catalog-specific configuration
@@ -74,8 +166,21 @@ type CatalogConfig struct {
 	ScannerConcurrency   int      `json:"scanner_concurrency"`
 	DownloadChunkSize    int      `json:"download_chunk_size"`
 	MaxArchiveSize       int64    `json:"max_archive_size"`
+	MaxUploadSize        int64    `json:"max_upload_size"` // 0 means unlimited
 	AllowedDownloadTypes []string `json:"allowed_download_types"`
 	TempDir              string   `json:"temp_dir"`
+
+	// Upload limits of roles by role ID, overriding max_upload_size for
+	// resumable uploads
+	MaxUploadSizeByRole map[int]int64 `json:"max_upload_size_by_role,omitempty"`
+	// Uploads a user may have in progress at once; 0 means the default
+	// of 20
+	MaxOpenUploads int `json:"max_open_uploads,omitempty"`
+
+	// Storage protocols whose files directory archives stage under
+	// temp_dir instead of streaming, for protocols that cannot stream.
+	// Archives that stage are limited to max_archive_size.
+	StagedArchiveProtocols []string `json:"staged_archive_protocols,omitempty"`
 }
 
 // LoggingConfig contains logging configuration
@@ -150,6 +255,8 @@ func getDefaultConfig() *Config {
 			IdleTimeout:  120,
 			EnableCORS:   true,
 			EnableHTTPS:  true, // Enable HTTPS by default for security
+			EnableHTTP2:  true,
+			EnableHTTP3:  true,
 		},
 		Database: DatabaseConfig{
 			Type:               "postgres",
@@ -245,6 +352,14 @@ func validateConfig(config *Config) error {
 	if dbSSL := os.Getenv("DATABASE_SSL_MODE"); dbSSL != "" {
 		config.Database.SSLMode = dbSSL
 	}
+	if encrypt := os.Getenv("DATABASE_ENCRYPTION_ENABLED"); encrypt != "" {
+		if enabled, err := strconv.ParseBool(encrypt); err == nil {
+			config.Database.Encryption.Enabled = enabled
+		}
+	}
+	if keyFile := os.Getenv("DATABASE_ENCRYPTION_KEY_FILE"); keyFile != "" {
+		config.Database.Encryption.KeyFile = keyFile
+	}
 
 	// Validate database config based on type
 	dbType := config.Database.Type
@@ -259,6 +374,9 @@ func validateConfig(config *Config) error {
 		if config.Database.Name == "" {
 			return fmt.Errorf("database name cannot be empty for postgres")
 		}
+		if config.Database.Encryption.Enabled {
+			return fmt.Errorf("database encryption is only supported for sqlite")
+		}
 	case "sqlite":
 		if config.Database.Path == "" {
 			return fmt.Errorf("database path cannot be empty for sqlite")
@@ -291,6 +409,33 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	if envURL := os.Getenv("AUTH_WEBHOOK_URL"); envURL != "" {
+		config.Auth.WebhookURL = envURL
+	}
+	if envSecret := os.Getenv("AUTH_WEBHOOK_SECRET"); envSecret != "" {
+		config.Auth.WebhookSecret = envSecret
+	}
+	if config.Auth.WebhookURL != "" && len(config.Auth.WebhookSecret) < 16 {
+		return fmt.Errorf("auth webhook secret must be at least 16 characters long")
+	}
+
+	if config.Auth.LockoutMinutes < 0 || config.Auth.LockoutMaxMinutes < 0 {
+		return fmt.Errorf("lockout durations must not be negative")
+	}
+
+	for i, provider := range config.Auth.OIDCProviders {
+		envName := "OIDC_" + strings.ToUpper(strings.ReplaceAll(provider.Name, "-", "_")) + "_CLIENT_SECRET"
+		if envSecret := os.Getenv(envName); envSecret != "" {
+			config.Auth.OIDCProviders[i].ClientSecret = envSecret
+		}
+	}
+
+	if config.Auth.LDAP != nil {
+		if envPassword := os.Getenv("LDAP_BIND_PASSWORD"); envPassword != "" {
+			config.Auth.LDAP.BindPassword = envPassword
+		}
+	}
+
 	if config.Catalog.DefaultPageSize <= 0 {
 		return fmt.Errorf("default page size must be positive")
 	}
@@ -19,6 +19,9 @@ func TestGetDefaultConfig(t *testing.T) {
 	assert.Equal(t, 8080, config.Server.Port)
 	assert.True(t, config.Server.EnableCORS)
 	assert.True(t, config.Server.EnableHTTPS)
+	assert.True(t, config.Server.EnableHTTP2)
+	assert.False(t, config.Server.EnableH2C)
+	assert.True(t, config.Server.EnableHTTP3)
 
 	// Database defaults
 	assert.Equal(t, "./catalog.db", config.Database.Path)
@@ -363,6 +366,22 @@ func TestValidateConfig_PostgresMissingName(t *testing.T) {
 	assert.Contains(t, err.Error(), "database name cannot be empty")
 }
 
+func TestValidateConfig_DatabaseEncryption(t *testing.T) {
+	t.Setenv("DATABASE_ENCRYPTION_ENABLED", "true")
+	t.Setenv("DATABASE_ENCRYPTION_KEY_FILE", "/etc/catalogizer/db.key")
+
+	config := getDefaultConfig()
+	config.Database.Type = "sqlite"
+	config.Auth.EnableAuth = false
+	require.NoError(t, validateConfig(config))
+	assert.True(t, config.Database.Encryption.Enabled)
+	assert.Equal(t, "/etc/catalogizer/db.key", config.Database.Encryption.KeyFile)
+
+	config.Database.Type = "postgres"
+	err := validateConfig(config)
+	assert.ErrorContains(t, err, "only supported for sqlite")
+}
+
 func TestValidateConfig_DatabaseEnvOverrides(t *testing.T) {
 	os.Setenv("DATABASE_TYPE", "sqlite")
 	os.Setenv("DATABASE_HOST", "override-host")
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// StagedRestoreSuffix marks a database copy waiting to replace the
+// database at the next start. Open connections keep reading the file
+// they opened, so a restore cannot swap it under a running server.
+const StagedRestoreSuffix = ".restore"
+
+// OpenSQLiteFile opens the SQLite database at path on a single
+// connection, keyed with key when it is not empty, and checks that it can
+// be read. It is for copies of the catalog such as backups, not the
+// catalog itself.
+func OpenSQLiteFile(path, key string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	dsn := path + "?_busy_timeout=30000"
+	if key != "" {
+		dsn += keyParam(key)
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := verifyKey(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// applyStagedRestore moves a staged restore of the database at path into
+// place, reporting whether there was one. What is left of the old write-
+// ahead log goes first, or SQLite would replay it into the restored file.
+func applyStagedRestore(path string) (bool, error) {
+	staged := path + StagedRestoreSuffix
+	if _, err := os.Stat(staged); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	if err := os.Rename(staged, path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
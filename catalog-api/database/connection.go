@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"time"
 
 	"catalogizer/config"
@@ -17,6 +18,9 @@ type DB struct {
 	*sql.DB
 	config  *config.DatabaseConfig
 	dialect Dialect
+	// encryptionKey is the SQLCipher key, empty when the database is
+	// not encrypted
+	encryptionKey string
 }
 
 // NewConnection creates a new database connection.
@@ -31,6 +35,7 @@ func NewConnection(cfg *config.DatabaseConfig) (*DB, error) {
 	var dialect Dialect
 	var sqlDB *sql.DB
 	var err error
+	var encryptionKey string
 
 	switch dbType {
 	case "postgres":
@@ -51,6 +56,21 @@ func NewConnection(cfg *config.DatabaseConfig) (*DB, error) {
 		if cfg.CacheSize != 0 {
 			connStr += fmt.Sprintf("&_cache_size=%d", cfg.CacheSize)
 		}
+		restored, err := applyStagedRestore(cfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply staged database restore: %w", err)
+		}
+		if restored {
+			log.Printf("Restored database %s from the backup staged before the last shutdown", cfg.Path)
+		}
+		if cfg.Encryption.Enabled {
+			encryptionKey, err = openEncryption(cfg)
+			if err != nil {
+				return nil, err
+			}
+			// Keyed in the DSN so that every pooled connection is
+			connStr += keyParam(encryptionKey)
+		}
 		sqlDB, err = sql.Open("sqlite3", connStr)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open sqlite database: %w", err)
@@ -88,6 +108,13 @@ func NewConnection(cfg *config.DatabaseConfig) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	if encryptionKey != "" {
+		if err := verifyKey(context.Background(), sqlDB); err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+
 	// Ensure WAL mode is active for SQLite (connection string
 	// pragma may not be applied by go-sqlcipher).
 	if dbType != "postgres" {
@@ -101,11 +128,41 @@ func NewConnection(cfg *config.DatabaseConfig) (*DB, error) {
 		DB:      sqlDB,
 		config:  cfg,
 		dialect: dialect,
+
+		encryptionKey: encryptionKey,
 	}
 
 	return db, nil
 }
 
+// openEncryption resolves the key for an encrypted SQLite database, and
+// encrypts the database first when it is still plaintext.
+func openEncryption(cfg *config.DatabaseConfig) (string, error) {
+	key, err := ResolveEncryptionKey(&cfg.Encryption)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := isPlaintextDatabase(cfg.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect sqlite database: %w", err)
+	}
+	if plaintext {
+		backupPath, err := EncryptExisting(cfg.Path, key)
+		if err != nil {
+			return "", err
+		}
+		log.Printf("Encrypted existing database %s; the unencrypted original was kept at %s and should be removed once the encrypted database is verified", cfg.Path, backupPath)
+	}
+	return key, nil
+}
+
+// EncryptionKey returns the SQLCipher key the database was opened with,
+// or "" when it is not encrypted. Copies of the database made with
+// sqlcipher_export attach with it so they are encrypted too.
+func (db *DB) EncryptionKey() string {
+	return db.encryptionKey
+}
+
 // Dialect returns the database dialect.
 func (db *DB) Dialect() *Dialect {
 	return &db.dialect
@@ -1698,9 +1698,9 @@ func TestRunMigrations_WrapsRunMigrationError(t *testing.T) {
 	err := db.createMigrationsTable(ctx)
 	require.NoError(t, err)
 
-	// Mark all 10 migrations as done except one that we'll sabotage
-	for v := 1; v <= 10; v++ {
-		_, err := db.ExecContext(ctx, "INSERT INTO migrations (version, name) VALUES (?, ?)", v, fmt.Sprintf("migration_%d", v))
+	// Mark every migration as done
+	for _, migration := range db.migrations() {
+		_, err := db.ExecContext(ctx, "INSERT INTO migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
 		require.NoError(t, err)
 	}
 
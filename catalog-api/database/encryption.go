@@ -0,0 +1,235 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"catalogizer/config"
+
+	sqlcipher "github.com/mutecomm/go-sqlcipher"
+)
+
+// DefaultEncryptionKeyEnv is read for the key when the encryption config
+// does not name another variable.
+const DefaultEncryptionKeyEnv = "DATABASE_ENCRYPTION_KEY"
+
+// ResolveEncryptionKey returns the SQLCipher key for the database, taken
+// from the configured environment variable, the key file, or a passphrase
+// prompt, in that order.
+func ResolveEncryptionKey(cfg *config.DatabaseEncryptionConfig) (string, error) {
+	envName := cfg.KeyEnv
+	if envName == "" {
+		envName = DefaultEncryptionKeyEnv
+	}
+	if key := os.Getenv(envName); key != "" {
+		return key, nil
+	}
+
+	if cfg.KeyFile != "" {
+		info, err := os.Stat(cfg.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read database key file: %w", err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			return "", fmt.Errorf("database key file %s must not be accessible by group or others (mode %04o)", cfg.KeyFile, info.Mode().Perm())
+		}
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read database key file: %w", err)
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("database key file %s is empty", cfg.KeyFile)
+		}
+		return key, nil
+	}
+
+	if cfg.PromptPassphrase {
+		return promptPassphrase("Database passphrase: ")
+	}
+	return "", fmt.Errorf("database encryption is enabled but no key was found in %s, a key file or a passphrase prompt", envName)
+}
+
+// promptPassphrase reads a passphrase from the terminal with echo turned
+// off. It refuses to read from anything but a terminal, so a service
+// started without one fails instead of hanging.
+func promptPassphrase(prompt string) (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("cannot prompt for the database passphrase: standard input is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	if setTerminalEcho(false) == nil {
+		defer func() {
+			setTerminalEcho(true)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read database passphrase: %w", err)
+	}
+	key := strings.TrimRight(line, "\r\n")
+	if key == "" {
+		return "", fmt.Errorf("database passphrase cannot be empty")
+	}
+	return key, nil
+}
+
+func setTerminalEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// keyParam encodes key as the go-sqlcipher _pragma_key connection
+// parameter. The driver places the value inside double quotes, so quotes
+// in the key are doubled.
+func keyParam(key string) string {
+	return "&_pragma_key=" + url.QueryEscape(strings.ReplaceAll(key, `"`, `""`))
+}
+
+// isPlaintextDatabase reports whether the file at path is an existing,
+// unencrypted SQLite database. Missing and empty files are not, as
+// SQLCipher creates them encrypted.
+func isPlaintextDatabase(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == 0 {
+		return false, nil
+	}
+	encrypted, err := sqlcipher.IsEncrypted(path)
+	if err != nil {
+		return false, err
+	}
+	return !encrypted, nil
+}
+
+// EncryptExisting converts the unencrypted database at path into one
+// encrypted with key. The data is exported into a new file which then
+// replaces the original; the original is kept next to it with a
+// ".unencrypted" suffix so it can be checked and deleted by hand. The
+// database must not be open elsewhere while this runs.
+func EncryptExisting(path, key string) (backupPath string, err error) {
+	if key == "" {
+		return "", fmt.Errorf("encryption key cannot be empty")
+	}
+	plaintext, err := isPlaintextDatabase(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if !plaintext {
+		return "", fmt.Errorf("%s is not an unencrypted database", path)
+	}
+
+	backupPath = path + ".unencrypted"
+	if _, err := os.Stat(backupPath); err == nil {
+		return "", fmt.Errorf("%s already exists; move it away before encrypting again", backupPath)
+	}
+	encryptedPath := path + ".encrypting"
+	os.Remove(encryptedPath)
+
+	if err := exportEncrypted(path, encryptedPath, key); err != nil {
+		os.Remove(encryptedPath)
+		return "", fmt.Errorf("failed to encrypt database: %w", err)
+	}
+	if err := os.Rename(path, backupPath); err != nil {
+		os.Remove(encryptedPath)
+		return "", fmt.Errorf("failed to move unencrypted database aside: %w", err)
+	}
+	if err := os.Rename(encryptedPath, path); err != nil {
+		os.Rename(backupPath, path)
+		return "", fmt.Errorf("failed to replace database with encrypted copy: %w", err)
+	}
+	// The export checkpointed the WAL, so what is left of it belongs to
+	// the unencrypted file
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	return backupPath, nil
+}
+
+// exportEncrypted copies the database at src into a new file at dst keyed
+// with key. The WAL is folded into src first so the copy is complete.
+func exportEncrypted(src, dst, key string) error {
+	db, err := sql.Open("sqlite3", src+"?_busy_timeout=30000")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return err
+	}
+	var userVersion int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&userVersion); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `ATTACH DATABASE ? AS encrypted KEY ?`, dst, key); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `SELECT sqlcipher_export('encrypted')`); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(`PRAGMA encrypted.user_version = %d`, userVersion)); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `DETACH DATABASE encrypted`)
+	return err
+}
+
+// Rekey changes the key of the encrypted database at path from oldKey to
+// newKey. Every connection holds the key it was opened with, so this
+// runs on its own connection while the service is stopped rather than
+// through the pool.
+func Rekey(path, oldKey, newKey string) error {
+	if newKey == "" {
+		return fmt.Errorf("new encryption key cannot be empty")
+	}
+	if newKey == oldKey {
+		return fmt.Errorf("new encryption key must differ from the current one")
+	}
+	db, err := OpenSQLiteFile(path, oldKey)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	// Re-keying rewrites every page, which SQLCipher only does outside
+	// WAL mode; WAL is switched back on by the next NewConnection
+	if _, err := db.ExecContext(ctx, `PRAGMA journal_mode=DELETE`); err != nil {
+		return fmt.Errorf("failed to leave WAL mode: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(`PRAGMA rekey = "%s"`, strings.ReplaceAll(newKey, `"`, `""`))); err != nil {
+		return fmt.Errorf("failed to re-key database: %w", err)
+	}
+	return nil
+}
+
+// verifyKey reads the schema, which is the first thing to fail when the
+// key is wrong: SQLCipher accepts any key and only notices on first read.
+func verifyKey(ctx context.Context, db *sql.DB) error {
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master`).Scan(&tables); err != nil {
+		return fmt.Errorf("failed to unlock database, the encryption key is probably wrong: %w", err)
+	}
+	return nil
+}
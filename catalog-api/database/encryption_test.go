@@ -0,0 +1,125 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"catalogizer/config"
+
+	sqlcipher "github.com/mutecomm/go-sqlcipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptedConfig(path string) *config.DatabaseConfig {
+	return &config.DatabaseConfig{
+		Type:       "sqlite",
+		Path:       path,
+		EnableWAL:  true,
+		Encryption: config.DatabaseEncryptionConfig{Enabled: true, KeyEnv: "TEST_DATABASE_KEY"},
+	}
+}
+
+func TestResolveEncryptionKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "db.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("  from-file\n"), 0600))
+	cfg := &config.DatabaseEncryptionConfig{KeyEnv: "TEST_DATABASE_KEY", KeyFile: keyFile}
+
+	t.Setenv("TEST_DATABASE_KEY", "from-env")
+	key, err := ResolveEncryptionKey(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", key)
+
+	t.Setenv("TEST_DATABASE_KEY", "")
+	key, err = ResolveEncryptionKey(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", key)
+
+	require.NoError(t, os.Chmod(keyFile, 0644))
+	_, err = ResolveEncryptionKey(cfg)
+	assert.ErrorContains(t, err, "group or others")
+
+	_, err = ResolveEncryptionKey(&config.DatabaseEncryptionConfig{})
+	assert.ErrorContains(t, err, DefaultEncryptionKeyEnv)
+}
+
+func TestNewConnection_Encrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	t.Setenv("TEST_DATABASE_KEY", `pass"word`)
+
+	db, err := NewConnection(encryptedConfig(path))
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE notes (body TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO notes (body) VALUES ('secret')`)
+	require.NoError(t, err)
+	assert.Equal(t, `pass"word`, db.EncryptionKey())
+	require.NoError(t, db.Close())
+
+	encrypted, err := sqlcipher.IsEncrypted(path)
+	require.NoError(t, err)
+	assert.True(t, encrypted)
+
+	t.Setenv("TEST_DATABASE_KEY", "wrong")
+	_, err = NewConnection(encryptedConfig(path))
+	assert.ErrorContains(t, err, "encryption key is probably wrong")
+}
+
+func TestNewConnection_EncryptsExistingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	plain, err := NewConnection(&config.DatabaseConfig{Type: "sqlite", Path: path})
+	require.NoError(t, err)
+	_, err = plain.Exec(`CREATE TABLE notes (body TEXT)`)
+	require.NoError(t, err)
+	_, err = plain.Exec(`INSERT INTO notes (body) VALUES ('kept')`)
+	require.NoError(t, err)
+	_, err = plain.Exec(`PRAGMA user_version = 7`)
+	require.NoError(t, err)
+	require.NoError(t, plain.Close())
+
+	t.Setenv("TEST_DATABASE_KEY", "first")
+	db, err := NewConnection(encryptedConfig(path))
+	require.NoError(t, err)
+	var body string
+	require.NoError(t, db.QueryRow(`SELECT body FROM notes`).Scan(&body))
+	assert.Equal(t, "kept", body)
+	var version int
+	require.NoError(t, db.QueryRow(`PRAGMA user_version`).Scan(&version))
+	assert.Equal(t, 7, version)
+	require.NoError(t, db.Close())
+
+	encrypted, err := sqlcipher.IsEncrypted(path)
+	require.NoError(t, err)
+	assert.True(t, encrypted)
+	encrypted, err = sqlcipher.IsEncrypted(path + ".unencrypted")
+	require.NoError(t, err)
+	assert.False(t, encrypted, "the original is kept")
+
+	_, err = EncryptExisting(path, "first")
+	assert.ErrorContains(t, err, "not an unencrypted database")
+}
+
+func TestRekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	t.Setenv("TEST_DATABASE_KEY", "old")
+	db, err := NewConnection(encryptedConfig(path))
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE notes (body TEXT)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	assert.ErrorContains(t, Rekey(path, "wrong", "new"), "encryption key is probably wrong")
+	assert.Error(t, Rekey(path, "old", ""))
+	require.NoError(t, Rekey(path, "old", "new"))
+
+	_, err = NewConnection(encryptedConfig(path))
+	assert.Error(t, err, "the old key no longer opens it")
+	t.Setenv("TEST_DATABASE_KEY", "new")
+	db, err = NewConnection(encryptedConfig(path))
+	require.NoError(t, err)
+	exists, err := db.TableExists(t.Context(), "notes")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	require.NoError(t, db.Close())
+}
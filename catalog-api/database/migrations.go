@@ -11,7 +11,19 @@ func (db *DB) RunMigrations(ctx context.Context) error {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
-	migrations := []Migration{
+	for _, migration := range db.migrations() {
+		if err := db.runMigration(ctx, migration); err != nil {
+			return fmt.Errorf("failed to run migration %s: %w", migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// migrations lists every migration in the order RunMigrations applies
+// them.
+func (db *DB) migrations() []Migration {
+	return []Migration{
 		{Version: 1, Name: "create_initial_tables", Up: db.createInitialTables},
 		{Version: 2, Name: "migrate_smb_to_storage_roots", Up: db.migrateSMBToStorageRoots},
 		{Version: 3, Name: "create_auth_tables", Up: db.createAuthTables},
@@ -22,15 +34,68 @@ func (db *DB) RunMigrations(ctx context.Context) error {
 		{Version: 8, Name: "create_media_entity_tables", Up: db.createMediaEntityTables},
 		{Version: 9, Name: "create_performance_indexes", Up: db.createPerformanceIndexes},
 		{Version: 10, Name: "create_sync_tables", Up: db.createSyncTables},
+		{Version: 11, Name: "create_share_lockdown_tables", Up: db.createShareLockdownTables},
+		{Version: 12, Name: "create_file_version_tables", Up: db.createFileVersionTables},
+		{Version: 13, Name: "add_sync_session_skip_reasons", Up: db.addSyncSessionSkipReasons},
+		{Version: 14, Name: "create_sync_cloud_credentials", Up: db.createSyncCloudCredentialsTable},
+		{Version: 15, Name: "create_cold_storage_tables", Up: db.createColdStorageTables},
+		{Version: 16, Name: "create_tiering_tables", Up: db.createTieringTables},
+		{Version: 17, Name: "create_prefetch_cache_tables", Up: db.createPrefetchCacheTables},
+		{Version: 18, Name: "create_user_encryption_keys_table", Up: db.createUserEncryptionKeysTable},
+		{Version: 19, Name: "create_share_links_table", Up: db.createShareLinksTable},
+		{Version: 20, Name: "create_screener_tables", Up: db.createScreenerTables},
+		{Version: 21, Name: "add_share_link_recipients", Up: db.addShareLinkRecipients},
+		{Version: 22, Name: "create_scan_schedule_tables", Up: db.createScanScheduleTables},
+		{Version: 23, Name: "create_file_search_index", Up: db.createFileSearchIndex},
+		{Version: 24, Name: "create_telemetry_tables", Up: db.createTelemetryTables},
+		{Version: 25, Name: "create_feature_flag_tables", Up: db.createFeatureFlagTables},
+		{Version: 26, Name: "add_conversion_job_progress", Up: db.addConversionJobProgress},
+		{Version: 27, Name: "add_conversion_job_transfer_rate", Up: db.addConversionJobTransferRate},
+		{Version: 28, Name: "create_duplicate_resolution_tables", Up: db.createDuplicateResolutionTables},
+		{Version: 29, Name: "create_playlist_tables", Up: db.createPlaylistTables},
+		{Version: 30, Name: "create_favorites_tables", Up: db.createFavoritesTables},
+		{Version: 31, Name: "add_soft_delete_columns", Up: db.addSoftDeleteColumns},
+		{Version: 32, Name: "create_lyrics_tables", Up: db.createLyricsTables},
+		{Version: 33, Name: "create_federation_tables", Up: db.createFederationTables},
+		{Version: 34, Name: "create_media_access_logs_table", Up: db.createMediaAccessLogsTable},
+		{Version: 35, Name: "create_replication_tables", Up: db.createReplicationTables},
+		{Version: 36, Name: "create_catalog_changes_table", Up: db.createCatalogChangesTable},
+		{Version: 37, Name: "create_analytics_retention_tables", Up: db.createAnalyticsRetentionTables},
+		{Version: 38, Name: "create_dashboard_rollup_tables", Up: db.createDashboardRollupTables},
+		{Version: 39, Name: "create_setup_tables", Up: db.createSetupTables},
+		{Version: 40, Name: "create_anomaly_tables", Up: db.createAnomalyTables},
+		{Version: 41, Name: "create_configuration_backup_tables", Up: db.createConfigurationBackupTables},
+		{Version: 42, Name: "create_onboarding_tables", Up: db.createOnboardingTables},
+		{Version: 43, Name: "create_link_event_tables", Up: db.createLinkEventTables},
+		{Version: 44, Name: "create_undo_tables", Up: db.createUndoTables},
+		{Version: 45, Name: "create_sync_session_failures_table", Up: db.createSyncSessionFailuresTable},
+		{Version: 46, Name: "create_security_incidents_table", Up: db.createSecurityIncidentsTable},
+		{Version: 47, Name: "create_api_keys_table", Up: db.createAPIKeysTable},
+		{Version: 48, Name: "create_hash_checkpoint_tables", Up: db.createHashCheckpointTables},
+		{Version: 49, Name: "create_oidc_identities_table", Up: db.createOIDCIdentitiesTable},
+		{Version: 50, Name: "create_maintenance_tables", Up: db.createMaintenanceTables},
+		{Version: 51, Name: "create_ldap_accounts_table", Up: db.createLDAPAccountsTable},
+		{Version: 52, Name: "create_upload_sessions_table", Up: db.createUploadSessionsTable},
+		{Version: 53, Name: "add_detected_media_types", Up: db.addDetectedMediaTypes},
+		{Version: 54, Name: "create_scan_traversal_policies", Up: db.createScanTraversalPolicies},
+		{Version: 55, Name: "create_trash_items_table", Up: db.createTrashItemsTable},
+		{Version: 56, Name: "create_runbook_tables", Up: db.createRunbookTables},
+		{Version: 57, Name: "add_schedule_time_zones", Up: db.addScheduleTimeZones},
+		{Version: 58, Name: "create_user_settings_revisions", Up: db.createUserSettingsRevisions},
+		{Version: 59, Name: "create_password_hashing_table", Up: db.createPasswordHashingTable},
+		{Version: 60, Name: "make_audit_log_append_only", Up: db.makeAuditLogAppendOnly},
+		{Version: 61, Name: "create_error_reports_table", Up: db.createErrorReportsTable},
+		{Version: 62, Name: "add_share_link_passwords", Up: db.addShareLinkPasswords},
+		{Version: 63, Name: "add_media_file_layout", Up: db.addMediaFileLayout},
+		{Version: 64, Name: "add_media_file_editions", Up: db.addMediaFileEditions},
+		{Version: 65, Name: "create_library_health_snapshots", Up: db.createLibraryHealthSnapshots},
+		{Version: 66, Name: "create_metadata_refresh_tables", Up: db.createMetadataRefreshTables},
+		{Version: 67, Name: "create_metadata_source_tables", Up: db.createMetadataSourceTables},
+		{Version: 68, Name: "create_file_listing_indexes", Up: db.createFileListingIndexes},
+		{Version: 69, Name: "create_provider_key_usage_table", Up: db.createProviderKeyUsageTable},
+		{Version: 70, Name: "create_offline_metadata_tables", Up: db.createOfflineMetadataTables},
+		{Version: 71, Name: "add_collection_owners", Up: db.addCollectionOwners},
 	}
-
-	for _, migration := range migrations {
-		if err := db.runMigration(ctx, migration); err != nil {
-			return fmt.Errorf("failed to run migration %s: %w", migration.Name, err)
-		}
-	}
-
-	return nil
 }
 
 // Migration represents a database migration.
@@ -259,6 +259,28 @@ func TestCreateAuthTables(t *testing.T) {
 	assert.Equal(t, 2, roleCount)
 }
 
+func TestMakeAuditLogAppendOnly(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, db.createAuthTables(ctx))
+	require.NoError(t, db.makeAuditLogAppendOnly(ctx))
+	require.NoError(t, db.makeAuditLogAppendOnly(ctx), "the migration is idempotent")
+
+	_, err := db.ExecContext(ctx, "INSERT INTO auth_audit_log (event_type, details) VALUES ('login_success', '{}')")
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, "UPDATE auth_audit_log SET event_type = 'logout'")
+	assert.ErrorContains(t, err, "append-only")
+	_, err = db.ExecContext(ctx, "DELETE FROM auth_audit_log")
+	assert.ErrorContains(t, err, "append-only")
+
+	var count int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM auth_audit_log WHERE event_type = 'login_success'").Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
 // ---------------------------------------------------------------------------
 // MigrationSequence
 // ---------------------------------------------------------------------------
@@ -271,14 +293,15 @@ func TestMigrationSequence_AllVersionsApplied(t *testing.T) {
 	err := db.RunMigrations(ctx)
 	require.NoError(t, err)
 
-	// Verify all 10 migrations were recorded
+	// Verify every migration was recorded
+	total := len(db.migrations())
 	var count int
 	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM migrations").Scan(&count)
 	assert.NoError(t, err)
-	assert.Equal(t, 10, count)
+	assert.Equal(t, total, count)
 
-	// Verify each version exists
-	for v := 1; v <= 10; v++ {
+	// Verify the versions run from 1 without gaps
+	for v := 1; v <= total; v++ {
 		var exists int
 		err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM migrations WHERE version = ?", v).Scan(&exists)
 		assert.NoError(t, err)
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createShareLockdownTables creates the share_lockdowns table used by the
+// ransomware detector to persist automatic read-only lockdowns of storage
+// roots. A lockdown stays active until an administrator releases it, so the
+// state must survive restarts.
+//
+// Tables:
+//   - share_lockdowns: one row per lockdown with the triggering heuristic,
+//     evidence details (JSON) and release bookkeeping
+func (db *DB) createShareLockdownTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createShareLockdownTablesPostgres(ctx)
+	}
+	return db.createShareLockdownTablesSQLite(ctx)
+}
+
+func (db *DB) createShareLockdownTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS share_lockdowns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		storage_root TEXT NOT NULL,
+		trigger_type TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		details TEXT,
+		status TEXT NOT NULL DEFAULT 'active',
+		triggered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		released_at DATETIME,
+		released_by INTEGER,
+		release_note TEXT,
+		FOREIGN KEY (released_by) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_share_lockdowns_storage_root ON share_lockdowns(storage_root);
+	CREATE INDEX IF NOT EXISTS idx_share_lockdowns_status ON share_lockdowns(status);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create share lockdown tables: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createShareLockdownTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS share_lockdowns (
+			id SERIAL PRIMARY KEY,
+			storage_root TEXT NOT NULL,
+			trigger_type TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			details TEXT,
+			status TEXT NOT NULL DEFAULT 'active',
+			triggered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			released_at TIMESTAMP,
+			released_by INTEGER,
+			release_note TEXT,
+			FOREIGN KEY (released_by) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_lockdowns_storage_root ON share_lockdowns(storage_root)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_lockdowns_status ON share_lockdowns(status)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create share lockdown tables: %w", err)
+		}
+	}
+
+	return nil
+}
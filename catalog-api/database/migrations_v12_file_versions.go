@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createFileVersionTables creates the tables backing file version history.
+// When an upload or sync overwrites an existing file, the previous content
+// is copied into the versions area and recorded here so it can be listed and
+// restored later.
+//
+// Tables:
+//   - file_versions: one row per preserved version with its location in the
+//     versions area and where it came from
+//   - file_version_policies: per-share retention (max versions / max age);
+//     shares without a row fall back to the server default
+func (db *DB) createFileVersionTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createFileVersionTablesPostgres(ctx)
+	}
+	return db.createFileVersionTablesSQLite(ctx)
+}
+
+func (db *DB) createFileVersionTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS file_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		storage_root TEXT NOT NULL,
+		path TEXT NOT NULL,
+		file_id INTEGER,
+		version_number INTEGER NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		sha256 TEXT,
+		stored_path TEXT NOT NULL,
+		origin TEXT NOT NULL,
+		local_path TEXT,
+		created_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(storage_root, path, version_number),
+		FOREIGN KEY (created_by) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_file_versions_file_id ON file_versions(file_id);
+	CREATE INDEX IF NOT EXISTS idx_file_versions_root_path ON file_versions(storage_root, path);
+
+	CREATE TABLE IF NOT EXISTS file_version_policies (
+		storage_root TEXT PRIMARY KEY,
+		max_versions INTEGER NOT NULL DEFAULT 0,
+		max_age_days INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create file version tables: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createFileVersionTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS file_versions (
+			id SERIAL PRIMARY KEY,
+			storage_root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			file_id INTEGER,
+			version_number INTEGER NOT NULL,
+			size BIGINT NOT NULL DEFAULT 0,
+			sha256 TEXT,
+			stored_path TEXT NOT NULL,
+			origin TEXT NOT NULL,
+			local_path TEXT,
+			created_by INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(storage_root, path, version_number),
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_versions_file_id ON file_versions(file_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_versions_root_path ON file_versions(storage_root, path)`,
+		`CREATE TABLE IF NOT EXISTS file_version_policies (
+			storage_root TEXT PRIMARY KEY,
+			max_versions INTEGER NOT NULL DEFAULT 0,
+			max_age_days INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create file version tables: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addSyncSessionSkipReasons adds the skip_reasons column to sync_sessions.
+// It stores a JSON object mapping skip reason (excluded, too_large,
+// outside_window, ...) to the number of files skipped for that reason during
+// the session. The statement is identical for SQLite and PostgreSQL.
+func (db *DB) addSyncSessionSkipReasons(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `ALTER TABLE sync_sessions ADD COLUMN skip_reasons TEXT`); err != nil {
+		return fmt.Errorf("failed to add sync session skip reasons: %w", err)
+	}
+	return nil
+}
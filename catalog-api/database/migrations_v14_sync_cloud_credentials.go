@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createSyncCloudCredentialsTable stores the OAuth tokens that link a cloud
+// storage sync endpoint (Dropbox, Google Drive, OneDrive) to a provider
+// account, together with the provider's change cursor so incremental syncs
+// only fetch what changed since the previous run.
+func (db *DB) createSyncCloudCredentialsTable(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS sync_cloud_credentials (
+		endpoint_id INTEGER PRIMARY KEY,
+		provider TEXT NOT NULL,
+		access_token TEXT NOT NULL,
+		refresh_token TEXT,
+		token_expiry DATETIME,
+		change_cursor TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (endpoint_id) REFERENCES sync_endpoints(id) ON DELETE CASCADE
+	)`
+	if db.dialect.IsPostgres() {
+		schema = `
+		CREATE TABLE IF NOT EXISTS sync_cloud_credentials (
+			endpoint_id INTEGER PRIMARY KEY,
+			provider TEXT NOT NULL,
+			access_token TEXT NOT NULL,
+			refresh_token TEXT,
+			token_expiry TIMESTAMP,
+			change_cursor TEXT,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (endpoint_id) REFERENCES sync_endpoints(id) ON DELETE CASCADE
+		)`
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create sync_cloud_credentials table: %w", err)
+	}
+
+	return nil
+}
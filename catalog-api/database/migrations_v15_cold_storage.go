@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createColdStorageTables creates the tables behind the cold storage tier.
+// Files on a cold storage root stay in the catalog but must be recalled
+// from their backend (tape, archive object storage) before they can be read.
+//
+// Tables:
+//   - cold_storage_tiers: storage roots served by a cold backend, with the
+//     backend's JSON configuration and how long recalled copies are kept
+//   - recall_jobs: one row per recall request, tracking it from request to
+//     the staged copy becoming available and later expiring
+func (db *DB) createColdStorageTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createColdStorageTablesPostgres(ctx)
+	}
+	return db.createColdStorageTablesSQLite(ctx)
+}
+
+func (db *DB) createColdStorageTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS cold_storage_tiers (
+		storage_root TEXT PRIMARY KEY,
+		backend TEXT NOT NULL,
+		config TEXT NOT NULL DEFAULT '{}',
+		retention_hours INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS recall_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_id INTEGER NOT NULL,
+		storage_root TEXT NOT NULL,
+		path TEXT NOT NULL,
+		backend TEXT NOT NULL,
+		status TEXT NOT NULL,
+		requested_by INTEGER,
+		staged_path TEXT,
+		error_message TEXT,
+		requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		available_at DATETIME,
+		expires_at DATETIME,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (requested_by) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_recall_jobs_file_status ON recall_jobs(file_id, status);
+	CREATE INDEX IF NOT EXISTS idx_recall_jobs_status ON recall_jobs(status);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create cold storage tables: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createColdStorageTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS cold_storage_tiers (
+			storage_root TEXT PRIMARY KEY,
+			backend TEXT NOT NULL,
+			config TEXT NOT NULL DEFAULT '{}',
+			retention_hours INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS recall_jobs (
+			id SERIAL PRIMARY KEY,
+			file_id BIGINT NOT NULL,
+			storage_root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			backend TEXT NOT NULL,
+			status TEXT NOT NULL,
+			requested_by INTEGER,
+			staged_path TEXT,
+			error_message TEXT,
+			requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			available_at TIMESTAMP,
+			expires_at TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (requested_by) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_recall_jobs_file_status ON recall_jobs(file_id, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_recall_jobs_status ON recall_jobs(status)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create cold storage tables: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createTieringTables creates the tables behind storage tiering policies,
+// which move files between storage roots (e.g. from a fast NAS to an archive
+// NAS) once they are old or rarely accessed.
+//
+// Tables:
+//   - tiering_policies: the rules, each moving matching files from a source
+//     root to a target root
+//   - tiering_runs: one row per execution of a policy
+//   - tiering_moves: every file moved by a run, kept so the run can be undone
+//
+// It also adds files.access_count, incremented alongside accessed_at
+// whenever a file is downloaded.
+func (db *DB) createTieringTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createTieringTablesPostgres(ctx)
+	}
+	return db.createTieringTablesSQLite(ctx)
+}
+
+func (db *DB) createTieringTablesSQLite(ctx context.Context) error {
+	schema := `
+	ALTER TABLE files ADD COLUMN access_count INTEGER NOT NULL DEFAULT 0;
+
+	CREATE TABLE IF NOT EXISTS tiering_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		tier TEXT NOT NULL,
+		source_root TEXT NOT NULL,
+		target_root TEXT NOT NULL,
+		target_path TEXT NOT NULL DEFAULT '',
+		min_age_days INTEGER NOT NULL DEFAULT 0,
+		unaccessed_days INTEGER NOT NULL DEFAULT 0,
+		max_access_count INTEGER,
+		min_size INTEGER NOT NULL DEFAULT 0,
+		file_types TEXT,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tiering_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		policy_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		files_moved INTEGER NOT NULL DEFAULT 0,
+		bytes_moved INTEGER NOT NULL DEFAULT 0,
+		files_failed INTEGER NOT NULL DEFAULT 0,
+		started_by INTEGER,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME,
+		undone_at DATETIME,
+		FOREIGN KEY (policy_id) REFERENCES tiering_policies(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS tiering_moves (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id INTEGER NOT NULL,
+		file_id INTEGER NOT NULL,
+		source_root TEXT NOT NULL,
+		source_path TEXT NOT NULL,
+		target_root TEXT NOT NULL,
+		target_path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		error_message TEXT,
+		moved_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (run_id) REFERENCES tiering_runs(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_tiering_runs_policy ON tiering_runs(policy_id);
+	CREATE INDEX IF NOT EXISTS idx_tiering_moves_run ON tiering_moves(run_id);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create tiering tables: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createTieringTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE files ADD COLUMN access_count INTEGER NOT NULL DEFAULT 0`,
+		`CREATE TABLE IF NOT EXISTS tiering_policies (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			tier TEXT NOT NULL,
+			source_root TEXT NOT NULL,
+			target_root TEXT NOT NULL,
+			target_path TEXT NOT NULL DEFAULT '',
+			min_age_days INTEGER NOT NULL DEFAULT 0,
+			unaccessed_days INTEGER NOT NULL DEFAULT 0,
+			max_access_count INTEGER,
+			min_size BIGINT NOT NULL DEFAULT 0,
+			file_types TEXT,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS tiering_runs (
+			id SERIAL PRIMARY KEY,
+			policy_id INTEGER NOT NULL REFERENCES tiering_policies(id) ON DELETE CASCADE,
+			status TEXT NOT NULL,
+			files_moved INTEGER NOT NULL DEFAULT 0,
+			bytes_moved BIGINT NOT NULL DEFAULT 0,
+			files_failed INTEGER NOT NULL DEFAULT 0,
+			started_by INTEGER,
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP,
+			undone_at TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS tiering_moves (
+			id SERIAL PRIMARY KEY,
+			run_id INTEGER NOT NULL REFERENCES tiering_runs(id) ON DELETE CASCADE,
+			file_id BIGINT NOT NULL,
+			source_root TEXT NOT NULL,
+			source_path TEXT NOT NULL,
+			target_root TEXT NOT NULL,
+			target_path TEXT NOT NULL,
+			size BIGINT NOT NULL DEFAULT 0,
+			status TEXT NOT NULL,
+			error_message TEXT,
+			moved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_tiering_runs_policy ON tiering_runs(policy_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_tiering_moves_run ON tiering_moves(run_id)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create tiering tables: %w", err)
+		}
+	}
+
+	return nil
+}
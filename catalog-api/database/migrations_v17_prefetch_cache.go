@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createPrefetchCacheTables creates prefetch_cache_entries, which tracks the
+// files copied ahead of time from remote storage roots into the local cache
+// directory. source_size and source_modified_at record the catalog state at
+// copy time so a stale copy is never served after the original changes.
+func (db *DB) createPrefetchCacheTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createPrefetchCacheTablesPostgres(ctx)
+	}
+	return db.createPrefetchCacheTablesSQLite(ctx)
+}
+
+func (db *DB) createPrefetchCacheTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS prefetch_cache_entries (
+		file_id INTEGER PRIMARY KEY,
+		cached_path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		source_size INTEGER NOT NULL DEFAULT 0,
+		source_modified_at DATETIME,
+		reason TEXT NOT NULL DEFAULT '',
+		hits INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_accessed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_prefetch_cache_lru ON prefetch_cache_entries(last_accessed_at);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create prefetch cache tables: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createPrefetchCacheTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS prefetch_cache_entries (
+			file_id BIGINT PRIMARY KEY,
+			cached_path TEXT NOT NULL,
+			size BIGINT NOT NULL DEFAULT 0,
+			source_size BIGINT NOT NULL DEFAULT 0,
+			source_modified_at TIMESTAMP,
+			reason TEXT NOT NULL DEFAULT '',
+			hits INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_prefetch_cache_lru ON prefetch_cache_entries(last_accessed_at)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create prefetch cache tables: %w", err)
+		}
+	}
+
+	return nil
+}
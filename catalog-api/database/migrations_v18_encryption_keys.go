@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createUserEncryptionKeysTable creates user_encryption_keys, holding the
+// age recipients and GPG public keys users register so downloads and
+// exports can be encrypted to them server-side. Each user may mark one key
+// as the default.
+func (db *DB) createUserEncryptionKeysTable(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createUserEncryptionKeysTablePostgres(ctx)
+	}
+	return db.createUserEncryptionKeysTableSQLite(ctx)
+}
+
+func (db *DB) createUserEncryptionKeysTableSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS user_encryption_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		key_type TEXT NOT NULL,
+		public_key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		is_default BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE(user_id, fingerprint)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_user_encryption_keys_user ON user_encryption_keys(user_id);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create user encryption keys table: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createUserEncryptionKeysTablePostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS user_encryption_keys (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			key_type TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			is_default BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, fingerprint)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_encryption_keys_user ON user_encryption_keys(user_id)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create user encryption keys table: %w", err)
+		}
+	}
+
+	return nil
+}
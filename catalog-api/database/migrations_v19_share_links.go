@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createShareLinksTable creates share_links, the public tokenised links
+// users hand out for single files. A link can expire, cap its downloads
+// and carry a visible watermark; watermark_status tracks the cached
+// watermarked copy for links that render one up front.
+func (db *DB) createShareLinksTable(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createShareLinksTablePostgres(ctx)
+	}
+	return db.createShareLinksTableSQLite(ctx)
+}
+
+func (db *DB) createShareLinksTableSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token TEXT NOT NULL UNIQUE,
+		file_id INTEGER NOT NULL,
+		created_by INTEGER NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME,
+		max_downloads INTEGER NOT NULL DEFAULT 0,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		watermark_enabled BOOLEAN NOT NULL DEFAULT 0,
+		watermark_text TEXT NOT NULL DEFAULT '',
+		watermark_position TEXT NOT NULL DEFAULT 'bottom-right',
+		watermark_mode TEXT NOT NULL DEFAULT 'cached',
+		watermark_status TEXT NOT NULL DEFAULT '',
+		watermark_error TEXT NOT NULL DEFAULT '',
+		watermark_path TEXT NOT NULL DEFAULT '',
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_accessed_at DATETIME,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+		FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_share_links_created_by ON share_links(created_by);
+	CREATE INDEX IF NOT EXISTS idx_share_links_file ON share_links(file_id);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create share links table: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createShareLinksTablePostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS share_links (
+			id SERIAL PRIMARY KEY,
+			token TEXT NOT NULL UNIQUE,
+			file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+			created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			label TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP,
+			max_downloads INTEGER NOT NULL DEFAULT 0,
+			download_count INTEGER NOT NULL DEFAULT 0,
+			watermark_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			watermark_text TEXT NOT NULL DEFAULT '',
+			watermark_position TEXT NOT NULL DEFAULT 'bottom-right',
+			watermark_mode TEXT NOT NULL DEFAULT 'cached',
+			watermark_status TEXT NOT NULL DEFAULT '',
+			watermark_error TEXT NOT NULL DEFAULT '',
+			watermark_path TEXT NOT NULL DEFAULT '',
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_accessed_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_created_by ON share_links(created_by)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_file ON share_links(file_id)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create share links table: %w", err)
+		}
+	}
+
+	return nil
+}
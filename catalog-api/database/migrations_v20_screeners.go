@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createScreenerTables creates the screener campaign tables and
+// share_link_access_log, which records every play and download through a
+// share link with the caller's IP so screener copies can be traced back
+// to the recipient they were issued to.
+func (db *DB) createScreenerTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createScreenerTablesPostgres(ctx)
+	}
+	return db.createScreenerTablesSQLite(ctx)
+}
+
+func (db *DB) createScreenerTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS share_link_access_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		share_link_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		ip_address TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL DEFAULT '',
+		accessed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (share_link_id) REFERENCES share_links(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_share_link_access_log_link ON share_link_access_log(share_link_id, accessed_at);
+
+	CREATE TABLE IF NOT EXISTS screener_campaigns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_by INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		watermark BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		closed_at DATETIME,
+		FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_screener_campaigns_created_by ON screener_campaigns(created_by);
+
+	CREATE TABLE IF NOT EXISTS screener_recipients (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (campaign_id) REFERENCES screener_campaigns(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_screener_recipients_campaign ON screener_recipients(campaign_id);
+
+	CREATE TABLE IF NOT EXISTS screener_links (
+		recipient_id INTEGER NOT NULL,
+		share_link_id INTEGER NOT NULL,
+		PRIMARY KEY (recipient_id, share_link_id),
+		FOREIGN KEY (recipient_id) REFERENCES screener_recipients(id) ON DELETE CASCADE,
+		FOREIGN KEY (share_link_id) REFERENCES share_links(id) ON DELETE CASCADE
+	);
+	`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create screener tables: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) createScreenerTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS share_link_access_log (
+			id SERIAL PRIMARY KEY,
+			share_link_id INTEGER NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+			action TEXT NOT NULL,
+			ip_address TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			result TEXT NOT NULL DEFAULT '',
+			accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_link_access_log_link ON share_link_access_log(share_link_id, accessed_at)`,
+		`CREATE TABLE IF NOT EXISTS screener_campaigns (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			watermark BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			closed_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_screener_campaigns_created_by ON screener_campaigns(created_by)`,
+		`CREATE TABLE IF NOT EXISTS screener_recipients (
+			id SERIAL PRIMARY KEY,
+			campaign_id INTEGER NOT NULL REFERENCES screener_campaigns(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			email TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_screener_recipients_campaign ON screener_recipients(campaign_id)`,
+		`CREATE TABLE IF NOT EXISTS screener_links (
+			recipient_id INTEGER NOT NULL REFERENCES screener_recipients(id) ON DELETE CASCADE,
+			share_link_id INTEGER NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+			PRIMARY KEY (recipient_id, share_link_id)
+		)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create screener tables: %w", err)
+		}
+	}
+
+	return nil
+}
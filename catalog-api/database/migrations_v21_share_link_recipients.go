@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addShareLinkRecipients adds the columns for share links issued to a
+// single email recipient: the address the link was sent to, when the
+// email went out and why it last failed.
+func (db *DB) addShareLinkRecipients(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`ALTER TABLE share_links ADD COLUMN recipient_email TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE share_links ADD COLUMN email_sent_at ` + timestamp,
+		`ALTER TABLE share_links ADD COLUMN email_error TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_recipient ON share_links(recipient_email)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to add share link recipients: %w", err)
+		}
+	}
+	return nil
+}
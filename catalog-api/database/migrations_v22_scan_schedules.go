@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createScanScheduleTables creates scan_schedules, one cron schedule per
+// storage root for the background scanner, and extends scan_history so
+// each scan job records what started it and how many files it found
+// renamed or moved.
+func (db *DB) createScanScheduleTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createScanScheduleTablesPostgres(ctx)
+	}
+	return db.createScanScheduleTablesSQLite(ctx)
+}
+
+func (db *DB) createScanScheduleTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS scan_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		storage_root_id INTEGER NOT NULL UNIQUE,
+		cron TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		last_run_at DATETIME,
+		next_run_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (storage_root_id) REFERENCES storage_roots(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_scan_schedules_next_run ON scan_schedules(enabled, next_run_at);
+
+	ALTER TABLE scan_history ADD COLUMN files_renamed INTEGER DEFAULT 0;
+	ALTER TABLE scan_history ADD COLUMN triggered_by TEXT NOT NULL DEFAULT 'manual';
+	`
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create scan schedule tables: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) createScanScheduleTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS scan_schedules (
+			id SERIAL PRIMARY KEY,
+			storage_root_id INTEGER NOT NULL UNIQUE REFERENCES storage_roots(id) ON DELETE CASCADE,
+			cron TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			last_run_at TIMESTAMP,
+			next_run_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_scan_schedules_next_run ON scan_schedules(enabled, next_run_at)`,
+		`ALTER TABLE scan_history ADD COLUMN IF NOT EXISTS files_renamed INTEGER DEFAULT 0`,
+		`ALTER TABLE scan_history ADD COLUMN IF NOT EXISTS triggered_by TEXT NOT NULL DEFAULT 'manual'`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create scan schedule tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// createFileSearchIndex creates the full-text search index used by
+// /api/v1/search/v2.
+//
+//   - file_search_documents: a view assembling the searchable text of every
+//     file: its name and path, the titles, descriptions and genres of the
+//     media items it belongs to, user tags on those items and title-like
+//     file_metadata keys.
+//   - file_search (SQLite only): an FTS5 table with one row per file, keyed
+//     by file ID and kept current by triggers on files and the metadata
+//     tables. SQLite builds without the FTS5 module skip it; search then
+//     falls back to matching the view directly, as it does on PostgreSQL.
+func (db *DB) createFileSearchIndex(ctx context.Context) error {
+	aggregate := "group_concat"
+	if db.dialect.IsPostgres() {
+		aggregate = "string_agg"
+	}
+	if _, err := db.ExecContext(ctx, `DROP VIEW IF EXISTS file_search_documents`); err != nil {
+		return fmt.Errorf("failed to create file search view: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, fileSearchDocumentsView(aggregate)); err != nil {
+		return fmt.Errorf("failed to create file search view: %w", err)
+	}
+
+	if db.dialect.IsPostgres() {
+		return nil
+	}
+	return db.createFileSearchIndexSQLite(ctx)
+}
+
+// fileSearchDocumentsView returns the view definition using the dialect's
+// string aggregate function.
+func fileSearchDocumentsView(aggregate string) string {
+	agg := func(expr, from string) string {
+		return fmt.Sprintf("COALESCE((SELECT %s(%s, ' ') %s), '')", aggregate, expr, from)
+	}
+	const mediaItems = "FROM media_files mf JOIN media_items mi ON mi.id = mf.media_item_id WHERE mf.file_id = f.id"
+	metadata := func(keys string) string {
+		return "FROM file_metadata fm WHERE fm.file_id = f.id AND fm.key IN (" + keys + ")"
+	}
+
+	return `CREATE VIEW file_search_documents AS
+	SELECT f.id AS file_id, f.name AS name, f.path AS path,
+		TRIM(` + agg("mi.title || COALESCE(' ' || mi.original_title, '')", mediaItems) + ` || ' ' ||
+			` + agg("fm.value", metadata("'title', 'album', 'artist'")) + `) AS title,
+		TRIM(` + agg("mi.description", mediaItems) + ` || ' ' ||
+			` + agg("fm.value", metadata("'description', 'comment', 'summary'")) + `) AS description,
+		TRIM(` + agg("mi.genre", mediaItems) + ` || ' ' ||
+			` + agg("um.tags", "FROM media_files mf JOIN user_metadata um ON um.media_item_id = mf.media_item_id WHERE mf.file_id = f.id") + ` || ' ' ||
+			` + agg("fm.value", metadata("'tags', 'genre', 'keywords'")) + `) AS tags
+	FROM files f`
+}
+
+// reindexFileSearch returns statements that replace the index rows of the
+// files selected by fileIDs, an SQL expression usable after "IN".
+func reindexFileSearch(fileIDs string) string {
+	return `DELETE FROM file_search WHERE rowid IN (` + fileIDs + `);
+		INSERT INTO file_search (rowid, name, path, title, description, tags)
+			SELECT file_id, name, path, title, description, tags FROM file_search_documents
+			WHERE file_id IN (` + fileIDs + `);`
+}
+
+func (db *DB) createFileSearchIndexSQLite(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, `CREATE VIRTUAL TABLE IF NOT EXISTS file_search USING fts5(
+		name, path, title, description, tags,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return nil
+		}
+		return fmt.Errorf("failed to create file search index: %w", err)
+	}
+
+	const mediaItemFiles = "SELECT file_id FROM media_files WHERE media_item_id = "
+	triggers := []struct {
+		name, event, body string
+	}{
+		{"file_search_files_insert", "AFTER INSERT ON files", reindexFileSearch("NEW.id")},
+		{"file_search_files_update", "AFTER UPDATE OF name, path ON files", reindexFileSearch("NEW.id")},
+		{"file_search_files_delete", "AFTER DELETE ON files", `DELETE FROM file_search WHERE rowid = OLD.id;`},
+		{"file_search_metadata_insert", "AFTER INSERT ON file_metadata", reindexFileSearch("NEW.file_id")},
+		{"file_search_metadata_update", "AFTER UPDATE ON file_metadata", reindexFileSearch("OLD.file_id, NEW.file_id")},
+		{"file_search_metadata_delete", "AFTER DELETE ON file_metadata", reindexFileSearch("OLD.file_id")},
+		{"file_search_media_files_insert", "AFTER INSERT ON media_files", reindexFileSearch("NEW.file_id")},
+		{"file_search_media_files_delete", "AFTER DELETE ON media_files", reindexFileSearch("OLD.file_id")},
+		{"file_search_media_items_update", "AFTER UPDATE OF title, original_title, description, genre ON media_items",
+			reindexFileSearch(mediaItemFiles + "NEW.id")},
+		{"file_search_user_metadata_insert", "AFTER INSERT ON user_metadata", reindexFileSearch(mediaItemFiles + "NEW.media_item_id")},
+		{"file_search_user_metadata_update", "AFTER UPDATE OF tags ON user_metadata", reindexFileSearch(mediaItemFiles + "NEW.media_item_id")},
+		{"file_search_user_metadata_delete", "AFTER DELETE ON user_metadata", reindexFileSearch(mediaItemFiles + "OLD.media_item_id")},
+	}
+	for _, trigger := range triggers {
+		stmt := fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s %s BEGIN %s END", trigger.name, trigger.event, trigger.body)
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create file search trigger %s: %w", trigger.name, err)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM file_search;
+		INSERT INTO file_search (rowid, name, path, title, description, tags)
+			SELECT file_id, name, path, title, description, tags FROM file_search_documents`); err != nil {
+		return fmt.Errorf("failed to populate file search index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createTelemetryTables creates the tables for opt-in usage telemetry:
+// telemetry_settings, a single row holding the server-wide opt-in, the
+// random installation ID and the last day reported upstream;
+// telemetry_usage, anonymous per-day feature counters; and
+// telemetry_reports, a log of every payload sent upstream.
+func (db *DB) createTelemetryTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createTelemetryTablesPostgres(ctx)
+	}
+	return db.createTelemetryTablesSQLite(ctx)
+}
+
+func (db *DB) createTelemetryTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS telemetry_settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		enabled BOOLEAN NOT NULL DEFAULT 0,
+		upstream_enabled BOOLEAN NOT NULL DEFAULT 0,
+		installation_id TEXT NOT NULL,
+		reported_through TEXT,
+		last_reported_at DATETIME,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS telemetry_usage (
+		day TEXT NOT NULL,
+		feature TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (day, feature)
+	);
+
+	CREATE TABLE IF NOT EXISTS telemetry_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		endpoint TEXT NOT NULL,
+		period_start TEXT NOT NULL,
+		period_end TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_telemetry_reports_created ON telemetry_reports(created_at);
+	`
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create telemetry tables: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) createTelemetryTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS telemetry_settings (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			upstream_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			installation_id TEXT NOT NULL,
+			reported_through TEXT,
+			last_reported_at TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS telemetry_usage (
+			day TEXT NOT NULL,
+			feature TEXT NOT NULL,
+			count BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (day, feature)
+		)`,
+		`CREATE TABLE IF NOT EXISTS telemetry_reports (
+			id SERIAL PRIMARY KEY,
+			endpoint TEXT NOT NULL,
+			period_start TEXT NOT NULL,
+			period_end TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_telemetry_reports_created ON telemetry_reports(created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create telemetry tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createFeatureFlagTables creates feature_flags, the flags and A/B
+// experiments clients evaluate, and analytics_events, where experiment
+// exposures are logged next to the client events used as conversions.
+// analytics_events was previously only created by test fixtures.
+func (db *DB) createFeatureFlagTables(ctx context.Context) error {
+	if db.dialect.IsPostgres() {
+		return db.createFeatureFlagTablesPostgres(ctx)
+	}
+	return db.createFeatureFlagTablesSQLite(ctx)
+}
+
+func (db *DB) createFeatureFlagTablesSQLite(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL UNIQUE,
+		description TEXT,
+		enabled BOOLEAN NOT NULL DEFAULT 0,
+		allocation INTEGER NOT NULL DEFAULT 100,
+		variants TEXT NOT NULL DEFAULT '[]',
+		salt TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS analytics_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		event_type TEXT NOT NULL,
+		event_category TEXT,
+		entity_type TEXT,
+		entity_id INTEGER,
+		data TEXT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		session_id TEXT,
+		ip_address TEXT,
+		user_agent TEXT,
+		device_info TEXT,
+		location TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_analytics_events_type_time ON analytics_events(event_type, timestamp);
+	CREATE INDEX IF NOT EXISTS idx_analytics_events_user ON analytics_events(user_id, timestamp);
+	`
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create feature flag tables: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) createFeatureFlagTablesPostgres(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS feature_flags (
+			id SERIAL PRIMARY KEY,
+			key TEXT NOT NULL UNIQUE,
+			description TEXT,
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			allocation INTEGER NOT NULL DEFAULT 100,
+			variants TEXT NOT NULL DEFAULT '[]',
+			salt TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS analytics_events (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER,
+			event_type TEXT NOT NULL,
+			event_category TEXT,
+			entity_type TEXT,
+			entity_id INTEGER,
+			data TEXT,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			session_id TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			device_info TEXT,
+			location TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_analytics_events_type_time ON analytics_events(event_type, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_analytics_events_user ON analytics_events(user_id, timestamp)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create feature flag tables: %w", err)
+		}
+	}
+	return nil
+}
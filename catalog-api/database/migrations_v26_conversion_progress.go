@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addConversionJobProgress adds the progress column to conversion_jobs,
+// the fraction (0 to 1) of a running job the worker has completed, and an
+// index for dequeuing pending jobs by priority.
+func (db *DB) addConversionJobProgress(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE conversion_jobs ADD COLUMN progress REAL NOT NULL DEFAULT 0`,
+		`CREATE INDEX IF NOT EXISTS idx_conversion_jobs_queue ON conversion_jobs(status, priority, created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to add conversion job progress: %w", err)
+		}
+	}
+	return nil
+}
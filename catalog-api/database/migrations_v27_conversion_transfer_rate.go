@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addConversionJobTransferRate adds the transfer_rate column to
+// conversion_jobs, the bytes per second a running job writes its output at.
+func (db *DB) addConversionJobTransferRate(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `ALTER TABLE conversion_jobs ADD COLUMN transfer_rate REAL NOT NULL DEFAULT 0`); err != nil {
+		return fmt.Errorf("failed to add conversion job transfer rate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createDuplicateResolutionTables indexes the content hashes duplicate
+// detection groups files by and creates duplicate_resolutions, which
+// records how each file of a resolved duplicate group was dealt with.
+// A resolution only applies while the file keeps the content it was
+// resolved with.
+func (db *DB) createDuplicateResolutionTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE INDEX IF NOT EXISTS idx_files_quick_hash ON files(quick_hash, size)`,
+		`CREATE INDEX IF NOT EXISTS idx_files_sha256 ON files(sha256)`,
+		`CREATE TABLE IF NOT EXISTS duplicate_resolutions (
+			id ` + id + `,
+			file_id INTEGER NOT NULL,
+			sha256 TEXT NOT NULL,
+			action TEXT NOT NULL,
+			kept_file_id INTEGER,
+			resolved_by INTEGER,
+			resolved_at ` + timestamp + ` NOT NULL,
+			UNIQUE(file_id, sha256)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create duplicate resolution tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createPlaylistTables creates playlists and their items. Regular
+// playlists hold an ordered list of media items; smart playlists keep a
+// rule in smart_criteria and are evaluated against catalog metadata when
+// read, so they have no rows in playlist_items. smart_rule_key marks the
+// smart playlists created from a user's playlist settings; deleting one
+// sets dismissed so it is not created again.
+func (db *DB) createPlaylistTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS playlists (
+			id ` + id + `,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			is_public BOOLEAN NOT NULL DEFAULT FALSE,
+			is_smart_playlist BOOLEAN NOT NULL DEFAULT FALSE,
+			smart_criteria TEXT NOT NULL DEFAULT '',
+			smart_rule_key TEXT NOT NULL DEFAULT '',
+			dismissed BOOLEAN NOT NULL DEFAULT FALSE,
+			cover_art_url TEXT NOT NULL DEFAULT '',
+			track_count INTEGER NOT NULL DEFAULT 0,
+			total_duration INTEGER NOT NULL DEFAULT 0,
+			play_count INTEGER NOT NULL DEFAULT 0,
+			last_played ` + timestamp + `,
+			created_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP,
+			updated_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlists_user ON playlists(user_id)`,
+		`CREATE TABLE IF NOT EXISTS playlist_items (
+			id ` + id + `,
+			playlist_id INTEGER NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+			media_item_id INTEGER NOT NULL REFERENCES media_items(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			added_by INTEGER,
+			added_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP,
+			custom_title TEXT NOT NULL DEFAULT '',
+			start_time INTEGER,
+			end_time INTEGER
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlist_items_playlist ON playlist_items(playlist_id, position)`,
+		`CREATE TABLE IF NOT EXISTS playlist_tags (
+			playlist_id INTEGER NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (playlist_id, tag)
+		)`,
+		`CREATE TABLE IF NOT EXISTS playlist_collaborators (
+			playlist_id INTEGER NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			added_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (playlist_id, user_id)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create playlist tables: %w", err)
+		}
+	}
+	return nil
+}
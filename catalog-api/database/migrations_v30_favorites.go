@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createFavoritesTables creates favorites with their categories and
+// shares. A favorite names its category; tags and the user ids a share
+// goes to are JSON arrays.
+func (db *DB) createFavoritesTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS favorites (
+			id ` + id + `,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			entity_type TEXT NOT NULL,
+			entity_id INTEGER NOT NULL,
+			category TEXT,
+			notes TEXT,
+			tags TEXT,
+			is_public BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + `,
+			UNIQUE (user_id, entity_type, entity_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_favorites_user_created ON favorites(user_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS favorite_categories (
+			id ` + id + `,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			description TEXT,
+			color TEXT,
+			icon TEXT,
+			entity_type TEXT,
+			is_public BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + `,
+			UNIQUE (user_id, name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS favorite_shares (
+			id ` + id + `,
+			favorite_id INTEGER NOT NULL REFERENCES favorites(id) ON DELETE CASCADE,
+			shared_by_user INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			shared_with TEXT NOT NULL,
+			permissions TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_favorite_shares_favorite ON favorite_shares(favorite_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create favorites tables: %w", err)
+		}
+	}
+	return nil
+}
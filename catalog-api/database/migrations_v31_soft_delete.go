@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// softDeleteTables are the tables whose rows are soft-deleted.
+var softDeleteTables = []string{"media_collections", "playlists", "users", "media_items"}
+
+// addSoftDeleteColumns adds deleted_at to the soft-deleted tables, with an
+// index for the recycle bin and its purge job.
+func (db *DB) addSoftDeleteColumns(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	for _, table := range softDeleteTables {
+		if _, err := db.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN deleted_at `+timestamp); err != nil {
+			return fmt.Errorf("failed to add deleted_at to %s: %w", table, err)
+		}
+		if _, err := db.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS idx_`+table+`_deleted_at ON `+table+`(deleted_at)`); err != nil {
+			return fmt.Errorf("failed to index deleted_at on %s: %w", table, err)
+		}
+	}
+	return nil
+}
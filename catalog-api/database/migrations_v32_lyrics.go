@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createLyricsTables creates the per-track lyrics cache and the user
+// localization settings that hold each user's lyrics language priority.
+// Lyrics are cached once per media item and language; sync_data holds the
+// timed lines of synced lyrics as JSON. The language lists in
+// user_localization are JSON arrays.
+func (db *DB) createLyricsTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS lyrics_data (
+			id TEXT PRIMARY KEY,
+			media_item_id INTEGER NOT NULL REFERENCES media_items(id) ON DELETE CASCADE,
+			source TEXT NOT NULL,
+			language TEXT NOT NULL,
+			content TEXT NOT NULL,
+			is_synced BOOLEAN NOT NULL DEFAULT FALSE,
+			sync_data TEXT,
+			translations TEXT,
+			created_at ` + timestamp + ` NOT NULL,
+			cached_at ` + timestamp + `,
+			UNIQUE (media_item_id, language)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_localization (
+			id ` + id + `,
+			user_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+			primary_language TEXT NOT NULL DEFAULT 'en',
+			secondary_languages TEXT NOT NULL DEFAULT '[]',
+			subtitle_languages TEXT NOT NULL DEFAULT '[]',
+			lyrics_languages TEXT NOT NULL DEFAULT '[]',
+			metadata_languages TEXT NOT NULL DEFAULT '[]',
+			auto_translate BOOLEAN NOT NULL DEFAULT FALSE,
+			auto_download_subtitles BOOLEAN NOT NULL DEFAULT TRUE,
+			auto_download_lyrics BOOLEAN NOT NULL DEFAULT TRUE,
+			preferred_region TEXT NOT NULL DEFAULT '',
+			date_format TEXT NOT NULL DEFAULT '',
+			time_format TEXT NOT NULL DEFAULT '',
+			number_format TEXT NOT NULL DEFAULT '',
+			currency_code TEXT NOT NULL DEFAULT '',
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create lyrics tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createFederationTables creates the registry of remote Catalogizer
+// instances and the local mirror of their catalogs. Remotes sign in with
+// the stored account; mode is "mirror" (catalog copied on a schedule) or
+// "proxy" (every request forwarded). Mirrored items keep the remote's
+// entity JSON in details.
+func (db *DB) createFederationTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS federation_remotes (
+			id ` + id + `,
+			name TEXT NOT NULL UNIQUE,
+			base_url TEXT NOT NULL,
+			username TEXT NOT NULL,
+			password TEXT NOT NULL,
+			mode TEXT NOT NULL DEFAULT 'mirror',
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			item_count INTEGER NOT NULL DEFAULT 0,
+			last_synced_at ` + timestamp + `,
+			last_sync_error TEXT,
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS federation_items (
+			id ` + id + `,
+			remote_id INTEGER NOT NULL REFERENCES federation_remotes(id) ON DELETE CASCADE,
+			remote_item_id INTEGER NOT NULL,
+			media_type TEXT NOT NULL,
+			title TEXT NOT NULL,
+			year INTEGER,
+			details TEXT NOT NULL,
+			synced_at ` + timestamp + ` NOT NULL,
+			UNIQUE (remote_id, remote_item_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_federation_items_title ON federation_items(title)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create federation tables: %w", err)
+		}
+	}
+	return nil
+}
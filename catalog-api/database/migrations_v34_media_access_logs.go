@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createMediaAccessLogsTable creates media_access_logs, one row per play,
+// download or view a client reports. The analytics repository has always
+// read from it but only test fixtures created it. device_info and location
+// hold JSON; playback_duration is in seconds.
+func (db *DB) createMediaAccessLogsTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS media_access_logs (
+			id ` + id + `,
+			user_id INTEGER NOT NULL,
+			media_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			device_info TEXT,
+			location TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			playback_duration INTEGER,
+			access_time ` + timestamp + ` NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_access_logs_time ON media_access_logs(access_time)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_access_logs_user ON media_access_logs(user_id, access_time)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_access_logs_media ON media_access_logs(media_id, access_time)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create media access logs table: %w", err)
+		}
+	}
+	return nil
+}
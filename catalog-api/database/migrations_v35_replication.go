@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createReplicationTables creates the replication rules that copy a
+// collection or media type section of a federated remote into local
+// storage, and the per-file record of what each rule has copied.
+// bandwidth_schedule holds the rule's time windows as JSON.
+func (db *DB) createReplicationTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS replication_rules (
+			id ` + id + `,
+			remote_id INTEGER NOT NULL REFERENCES federation_remotes(id) ON DELETE CASCADE,
+			name TEXT NOT NULL UNIQUE,
+			source_type TEXT NOT NULL,
+			source TEXT NOT NULL,
+			storage_root TEXT NOT NULL,
+			target_path TEXT NOT NULL DEFAULT '',
+			bandwidth_limit_kbps INTEGER NOT NULL DEFAULT 0,
+			bandwidth_schedule TEXT NOT NULL DEFAULT '[]',
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			last_run_at ` + timestamp + `,
+			last_run_status TEXT,
+			last_run_error TEXT,
+			last_run_files INTEGER NOT NULL DEFAULT 0,
+			last_run_bytes INTEGER NOT NULL DEFAULT 0,
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS replication_items (
+			id ` + id + `,
+			rule_id INTEGER NOT NULL REFERENCES replication_rules(id) ON DELETE CASCADE,
+			remote_item_id INTEGER NOT NULL,
+			remote_file_id INTEGER NOT NULL,
+			local_path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			remote_hash TEXT,
+			status TEXT NOT NULL,
+			error TEXT,
+			replicated_at ` + timestamp + ` NOT NULL,
+			UNIQUE (rule_id, remote_file_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_replication_items_rule ON replication_items(rule_id, status)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create replication tables: %w", err)
+		}
+	}
+	return nil
+}
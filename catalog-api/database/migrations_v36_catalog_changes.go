@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createCatalogChangesTable creates the journal of catalog changes the
+// scanner finds: files added, removed, modified or moved, with their
+// sizes before and after, so the catalog can be compared between two
+// points in time.
+func (db *DB) createCatalogChangesTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS catalog_changes (
+			id ` + id + `,
+			scan_id INTEGER,
+			storage_root_id INTEGER NOT NULL,
+			file_id INTEGER NOT NULL,
+			change_type TEXT NOT NULL,
+			path TEXT NOT NULL,
+			old_path TEXT,
+			is_directory BOOLEAN NOT NULL DEFAULT FALSE,
+			old_size BIGINT,
+			new_size BIGINT,
+			changed_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_catalog_changes_changed_at ON catalog_changes(changed_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_catalog_changes_file ON catalog_changes(file_id, changed_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create catalog changes table: %w", err)
+		}
+	}
+	return nil
+}
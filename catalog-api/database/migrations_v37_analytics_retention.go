@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createAnalyticsRetentionTables creates analytics_retention_policies, how
+// long raw rows and hourly rollups of each analytics table are kept and
+// how far they have been rolled up, and analytics_hourly_rollups, the
+// per-hour counts that outlive the raw rows. dimension is the event type
+// or access action; total_duration is playback seconds.
+func (db *DB) createAnalyticsRetentionTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS analytics_retention_policies (
+			table_name TEXT PRIMARY KEY,
+			raw_retention_days INTEGER NOT NULL DEFAULT 0,
+			rollup_retention_months INTEGER NOT NULL DEFAULT 0,
+			rolled_up_until ` + timestamp + `,
+			last_run_at ` + timestamp + `,
+			last_run_error TEXT,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS analytics_hourly_rollups (
+			id ` + id + `,
+			source_table TEXT NOT NULL,
+			bucket_start ` + timestamp + ` NOT NULL,
+			dimension TEXT NOT NULL,
+			event_count INTEGER NOT NULL DEFAULT 0,
+			user_count INTEGER NOT NULL DEFAULT 0,
+			total_duration BIGINT NOT NULL DEFAULT 0,
+			UNIQUE(source_table, bucket_start, dimension)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_analytics_hourly_rollups_bucket ON analytics_hourly_rollups(source_table, bucket_start)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create analytics retention tables: %w", err)
+		}
+	}
+	return nil
+}
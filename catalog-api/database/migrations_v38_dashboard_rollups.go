@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createDashboardRollupTables creates the rollups the analytics dashboard
+// reads instead of raw rows: analytics_hourly_users, who was active each
+// hour per table and event type or action; analytics_hourly_media, plays
+// per media item each hour; and storage_daily_usage, a daily snapshot of
+// each storage root's file count and size. Existing hourly rollups are
+// rebuilt from the raw rows still kept, so the new tables cover the same
+// hours.
+func (db *DB) createDashboardRollupTables(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS analytics_hourly_users (
+			bucket_start ` + timestamp + ` NOT NULL,
+			source_table TEXT NOT NULL,
+			dimension TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			PRIMARY KEY (bucket_start, source_table, dimension, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS analytics_hourly_media (
+			bucket_start ` + timestamp + ` NOT NULL,
+			media_id INTEGER NOT NULL,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			total_duration BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (bucket_start, media_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS storage_daily_usage (
+			day ` + timestamp + ` NOT NULL,
+			storage_root_id INTEGER NOT NULL,
+			file_count BIGINT NOT NULL DEFAULT 0,
+			total_bytes BIGINT NOT NULL DEFAULT 0,
+			captured_at ` + timestamp + ` NOT NULL,
+			PRIMARY KEY (day, storage_root_id)
+		)`,
+		`UPDATE analytics_retention_policies SET rolled_up_until = NULL`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create dashboard rollup tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createSetupTables creates the tables behind the first-run setup wizard:
+// system_configuration, the saved configuration; wizard_progress, the
+// answers given so far; wizard_completion, who finished the wizard; and
+// setup_state, a single row recording when setup completed. Installations
+// that already have users were set up before the wizard existed, so they
+// are marked as set up.
+func (db *DB) createSetupTables(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS system_configuration (
+			id INTEGER PRIMARY KEY DEFAULT 1,
+			version TEXT NOT NULL,
+			configuration TEXT NOT NULL,
+			created_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP,
+			updated_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS wizard_progress (
+			user_id INTEGER PRIMARY KEY,
+			current_step TEXT NOT NULL,
+			step_data TEXT,
+			all_data TEXT,
+			updated_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS wizard_completion (
+			user_id INTEGER PRIMARY KEY,
+			completed_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS setup_state (
+			id INTEGER PRIMARY KEY,
+			completed_at ` + timestamp + ` NOT NULL,
+			completed_by INTEGER NOT NULL DEFAULT 0
+		)`,
+		`INSERT INTO setup_state (id, completed_at, completed_by)
+			SELECT 1, CURRENT_TIMESTAMP, 0 WHERE EXISTS (SELECT 1 FROM users)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create setup tables: %w", err)
+		}
+	}
+	return nil
+}
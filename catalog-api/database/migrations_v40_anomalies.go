@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createAnomalyTables creates anomaly_metrics, the sensitivity settings
+// and rolling baseline of each metric watched for anomalies, and
+// anomaly_alerts, the anomalies detected.
+func (db *DB) createAnomalyTables(ctx context.Context) error {
+	id, timestamp, double := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME", "REAL"
+	if db.dialect.IsPostgres() {
+		id, timestamp, double = "SERIAL PRIMARY KEY", "TIMESTAMP", "DOUBLE PRECISION"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS anomaly_metrics (
+			metric TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			sensitivity ` + double + ` NOT NULL,
+			smoothing ` + double + ` NOT NULL,
+			min_value ` + double + ` NOT NULL DEFAULT 0,
+			warmup_samples INTEGER NOT NULL,
+			cooldown_minutes INTEGER NOT NULL,
+			mean ` + double + ` NOT NULL DEFAULT 0,
+			variance ` + double + ` NOT NULL DEFAULT 0,
+			samples INTEGER NOT NULL DEFAULT 0,
+			last_value ` + double + `,
+			last_evaluated_at ` + timestamp + `,
+			last_alert_at ` + timestamp + `,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS anomaly_alerts (
+			id ` + id + `,
+			metric TEXT NOT NULL,
+			value ` + double + ` NOT NULL,
+			expected ` + double + ` NOT NULL,
+			std_dev ` + double + ` NOT NULL,
+			z_score ` + double + ` NOT NULL,
+			window_start ` + timestamp + ` NOT NULL,
+			window_end ` + timestamp + ` NOT NULL,
+			created_at ` + timestamp + ` NOT NULL,
+			acknowledged_at ` + timestamp + `,
+			acknowledged_by INTEGER
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_anomaly_alerts_metric ON anomaly_alerts(metric, created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create anomaly tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createConfigurationBackupTables creates configuration_backups, named
+// copies of the system configuration that can be restored, and
+// configuration_templates, partial configurations applied over the live
+// one.
+func (db *DB) createConfigurationBackupTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS configuration_backups (
+			id ` + id + `,
+			name TEXT NOT NULL,
+			version TEXT NOT NULL,
+			configuration TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_configuration_backups_created_at ON configuration_backups(created_at)`,
+		`CREATE TABLE IF NOT EXISTS configuration_templates (
+			id ` + id + `,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			category TEXT NOT NULL DEFAULT '',
+			configuration TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create configuration backup tables: %w", err)
+		}
+	}
+	return nil
+}
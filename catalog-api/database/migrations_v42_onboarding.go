@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createOnboardingTables creates onboarding_tasks, the state of each
+// guided task shown to administrators of a new installation.
+func (db *DB) createOnboardingTables(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS onboarding_tasks (
+			task TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			completed_at ` + timestamp + `,
+			updated_by INTEGER NOT NULL DEFAULT 0,
+			updated_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create onboarding tables: %w", err)
+		}
+	}
+	return nil
+}
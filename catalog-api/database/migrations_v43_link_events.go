@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createLinkEventTables creates link_events, the clicks on universal
+// links and the app opens, store fallbacks and errors apps report for
+// them, grouped by the tracking ID of the link. Raw events are kept for
+// 90 days under the analytics retention policy unless changed.
+func (db *DB) createLinkEventTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS link_events (
+			id ` + id + `,
+			tracking_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			platform TEXT NOT NULL DEFAULT '',
+			user_id INTEGER,
+			user_agent TEXT,
+			ip_address TEXT,
+			success BOOLEAN NOT NULL DEFAULT FALSE,
+			app_opened BOOLEAN NOT NULL DEFAULT FALSE,
+			fallback_used BOOLEAN NOT NULL DEFAULT FALSE,
+			error_message TEXT,
+			metadata TEXT,
+			occurred_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_link_events_tracking ON link_events(tracking_id, occurred_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_link_events_occurred ON link_events(occurred_at)`,
+		`INSERT OR IGNORE INTO analytics_retention_policies (table_name, raw_retention_days, updated_at)
+		 VALUES ('link_events', 90, CURRENT_TIMESTAMP)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create link event tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createUndoTables creates undo_operations, the journal of destructive
+// actions users can still reverse. The payload holds what the reversal
+// needs, such as the tags a change removed.
+func (db *DB) createUndoTables(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS undo_operations (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			resource_id INTEGER NOT NULL DEFAULT 0,
+			summary TEXT NOT NULL DEFAULT '',
+			payload TEXT,
+			last_error TEXT,
+			created_at ` + timestamp + ` NOT NULL,
+			expires_at ` + timestamp + ` NOT NULL,
+			undone_at ` + timestamp + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_undo_operations_user ON undo_operations(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_undo_operations_expires ON undo_operations(expires_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create undo tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createSyncSessionFailuresTable creates sync_session_failures, the files a
+// sync session failed to transfer and why. Failures that concern the run
+// rather than one file have an empty path.
+func (db *DB) createSyncSessionFailuresTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS sync_session_failures (
+			id ` + id + `,
+			session_id INTEGER NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL,
+			occurred_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_session_failures_session ON sync_session_failures(session_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create sync session failures table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createSecurityIncidentsTable creates security_incidents, the events listed
+// as suspicious activity in the security audit report, such as accounts
+// locked after repeated failed logins.
+func (db *DB) createSecurityIncidentsTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS security_incidents (
+			id ` + id + `,
+			type TEXT NOT NULL,
+			description TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			user_id INTEGER,
+			ip_address TEXT,
+			occurred_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_security_incidents_occurred ON security_incidents(occurred_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create security incidents table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createAPIKeysTable creates api_keys, the scoped credentials that scripts
+// and integrations send in the X-API-Key header. Keys are stored as
+// SHA-256 hashes.
+func (db *DB) createAPIKeysTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id ` + id + `,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			expires_at ` + timestamp + `,
+			last_used_at ` + timestamp + `,
+			created_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create api keys table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createHashCheckpointTables creates hash_checkpoints, the saved state of
+// content hashes interrupted part way through a file, and
+// hash_rate_limits, the per-root caps on the bytes a scan reads to hash.
+func (db *DB) createHashCheckpointTables(ctx context.Context) error {
+	blob, timestamp := "BLOB", "DATETIME"
+	if db.dialect.IsPostgres() {
+		blob, timestamp = "BYTEA", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS hash_checkpoints (
+			file_id INTEGER PRIMARY KEY REFERENCES files(id) ON DELETE CASCADE,
+			bytes_hashed INTEGER NOT NULL,
+			state ` + blob + ` NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS hash_rate_limits (
+			storage_root_id INTEGER PRIMARY KEY REFERENCES storage_roots(id) ON DELETE CASCADE,
+			bytes_per_second INTEGER NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create hash checkpoint tables: %w", err)
+		}
+	}
+	return nil
+}
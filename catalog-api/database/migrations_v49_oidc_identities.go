@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createOIDCIdentitiesTable creates oidc_identities, which links users to
+// their accounts at external identity providers by the provider's stable
+// subject identifier.
+func (db *DB) createOIDCIdentitiesTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS oidc_identities (
+			id ` + id + `,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT,
+			created_at ` + timestamp + ` NOT NULL,
+			last_login_at ` + timestamp + `,
+			UNIQUE(provider, subject)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_oidc_identities_user ON oidc_identities(user_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create oidc identities table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createMaintenanceTables creates maintenance_schedule, when the catalog
+// maintenance job runs and for how long, and maintenance_runs, the steps
+// and database sizes before and after each run.
+func (db *DB) createMaintenanceTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS maintenance_schedule (
+			id INTEGER PRIMARY KEY,
+			cron TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL,
+			window_minutes INTEGER NOT NULL,
+			next_run_at ` + timestamp + `,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS maintenance_runs (
+			id ` + id + `,
+			triggered_by TEXT NOT NULL,
+			status TEXT NOT NULL,
+			full_vacuum BOOLEAN NOT NULL,
+			started_at ` + timestamp + ` NOT NULL,
+			finished_at ` + timestamp + `,
+			size_before BIGINT,
+			free_before BIGINT,
+			wal_before BIGINT,
+			size_after BIGINT,
+			free_after BIGINT,
+			wal_after BIGINT,
+			steps TEXT NOT NULL DEFAULT '[]',
+			error TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_maintenance_runs_started ON maintenance_runs(started_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create maintenance tables: %w", err)
+		}
+	}
+	return nil
+}
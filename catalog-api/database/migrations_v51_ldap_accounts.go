@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createLDAPAccountsTable creates ldap_accounts, which links users to
+// their directory entries so the directory sync can find the accounts it
+// manages and re-enable only those it disabled itself.
+func (db *DB) createLDAPAccountsTable(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ldap_accounts (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			dn TEXT NOT NULL,
+			username TEXT NOT NULL UNIQUE,
+			disabled_by_sync BOOLEAN NOT NULL,
+			created_at ` + timestamp + ` NOT NULL,
+			last_login_at ` + timestamp + `,
+			last_synced_at ` + timestamp + `
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create ldap accounts table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createUploadSessionsTable creates upload_sessions, the resumable uploads
+// in progress: where the assembled file goes, its size and SHA-256, and
+// how many bytes have been received.
+func (db *DB) createUploadSessionsTable(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS upload_sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			storage_root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			received BIGINT NOT NULL,
+			sha256 TEXT NOT NULL,
+			overwrite BOOLEAN NOT NULL,
+			status TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL,
+			expires_at ` + timestamp + ` NOT NULL,
+			completed_at ` + timestamp + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_upload_sessions_user ON upload_sessions(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires ON upload_sessions(expires_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create upload_sessions table: %w", err)
+		}
+	}
+	return nil
+}
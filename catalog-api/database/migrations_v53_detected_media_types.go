@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addDetectedMediaTypes adds the media type scans detect from file
+// content beside the one declared by the extension (files.mime_type):
+//   - files.detected_mime_type: the MIME type sniffed from the first bytes
+//   - files.type_mismatch: set when the content is not what the extension
+//     says, for the review report
+func (db *DB) addDetectedMediaTypes(ctx context.Context) error {
+	falseValue := "0"
+	if db.dialect.IsPostgres() {
+		falseValue = "FALSE"
+	}
+	statements := []string{
+		`ALTER TABLE files ADD COLUMN detected_mime_type TEXT`,
+		`ALTER TABLE files ADD COLUMN type_mismatch BOOLEAN NOT NULL DEFAULT ` + falseValue,
+		`CREATE INDEX IF NOT EXISTS idx_files_type_mismatch ON files(type_mismatch, storage_root_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to add detected media types: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createScanTraversalPolicies creates scan_traversal_policies, the
+// per-root rules for following symlinks, the depth limit and crossing
+// into other filesystems, and extends scan_history with how many entries
+// each scan skipped under them.
+func (db *DB) createScanTraversalPolicies(ctx context.Context) error {
+	timestamp, ifNotExists := "DATETIME", ""
+	if db.dialect.IsPostgres() {
+		timestamp, ifNotExists = "TIMESTAMP", "IF NOT EXISTS "
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS scan_traversal_policies (
+			storage_root_id INTEGER PRIMARY KEY REFERENCES storage_roots(id) ON DELETE CASCADE,
+			follow_symlinks TEXT NOT NULL,
+			max_depth INTEGER NOT NULL DEFAULT 0,
+			cross_filesystems BOOLEAN NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+	}
+	for _, column := range []string{"skipped_symlinks", "skipped_cycles", "skipped_depth", "skipped_mounts"} {
+		statements = append(statements, `ALTER TABLE scan_history ADD COLUMN `+ifNotExists+column+` INTEGER DEFAULT 0`)
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create scan traversal policies: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createTrashItemsTable creates trash_items, the files and directories
+// users deleted to the trash of a storage root, with where they were
+// deleted from so they can be restored.
+func (db *DB) createTrashItemsTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS trash_items (
+			id ` + id + `,
+			user_id INTEGER NOT NULL,
+			storage_root_id INTEGER NOT NULL REFERENCES storage_roots(id) ON DELETE CASCADE,
+			original_path TEXT NOT NULL,
+			trash_path TEXT NOT NULL,
+			is_directory BOOLEAN NOT NULL,
+			size BIGINT NOT NULL DEFAULT 0,
+			deleted_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_trash_items_user ON trash_items(user_id, deleted_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create trash items table: %w", err)
+		}
+	}
+	return nil
+}
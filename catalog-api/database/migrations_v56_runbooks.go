@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createRunbookTables creates runbooks, saved sequences of maintenance
+// actions with their parameters, and runbook_runs, the status of each
+// step of every execution.
+func (db *DB) createRunbookTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS runbooks (
+			id ` + id + `,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			definition TEXT NOT NULL,
+			created_by INTEGER NOT NULL,
+			created_at ` + timestamp + ` NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS runbook_runs (
+			id ` + id + `,
+			runbook_id INTEGER NOT NULL,
+			runbook_name TEXT NOT NULL,
+			status TEXT NOT NULL,
+			parameters TEXT NOT NULL DEFAULT '{}',
+			steps TEXT NOT NULL DEFAULT '[]',
+			started_by INTEGER NOT NULL,
+			started_at ` + timestamp + ` NOT NULL,
+			finished_at ` + timestamp + `,
+			error TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_runbook_runs_started ON runbook_runs(started_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create runbook tables: %w", err)
+		}
+	}
+	return nil
+}
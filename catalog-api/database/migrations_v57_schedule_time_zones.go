@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addScheduleTimeZones gives scan_schedules, maintenance_schedule and
+// sync_schedules a time_zone column holding the IANA zone their times are
+// read in. Existing schedules keep an empty zone, server local time.
+func (db *DB) addScheduleTimeZones(ctx context.Context) error {
+	ifNotExists := ""
+	if db.dialect.IsPostgres() {
+		ifNotExists = "IF NOT EXISTS "
+	}
+	for _, table := range []string{"scan_schedules", "maintenance_schedule", "sync_schedules"} {
+		stmt := `ALTER TABLE ` + table + ` ADD COLUMN ` + ifNotExists + `time_zone TEXT NOT NULL DEFAULT ''`
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to add time zone to %s: %w", table, err)
+		}
+	}
+	return nil
+}
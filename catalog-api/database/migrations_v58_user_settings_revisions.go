@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createUserSettingsRevisions gives users a settings_revision counter and
+// creates user_settings_revisions, the recent versions of every user's
+// settings with the keys each one changed. Settings updates are checked
+// against them for conflicting keys.
+func (db *DB) createUserSettingsRevisions(ctx context.Context) error {
+	ifNotExists, timestamp := "", "DATETIME"
+	if db.dialect.IsPostgres() {
+		ifNotExists, timestamp = "IF NOT EXISTS ", "TIMESTAMP"
+	}
+	statements := []string{
+		`ALTER TABLE users ADD COLUMN ` + ifNotExists + `settings_revision INTEGER NOT NULL DEFAULT 0`,
+		`CREATE TABLE IF NOT EXISTS user_settings_revisions (
+			user_id INTEGER NOT NULL,
+			revision INTEGER NOT NULL,
+			settings TEXT NOT NULL,
+			changed_keys TEXT NOT NULL DEFAULT '[]',
+			created_at ` + timestamp + ` NOT NULL,
+			PRIMARY KEY (user_id, revision)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create user settings revisions: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createPasswordHashingTable creates password_hashing, a single row
+// holding the algorithm and cost parameters an administrator chose for
+// new password hashes. Without it the built-in argon2id defaults apply.
+func (db *DB) createPasswordHashingTable(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	stmt := `CREATE TABLE IF NOT EXISTS password_hashing (
+		id INTEGER PRIMARY KEY,
+		algorithm TEXT NOT NULL,
+		memory_kib INTEGER NOT NULL DEFAULT 0,
+		iterations INTEGER NOT NULL DEFAULT 0,
+		parallelism INTEGER NOT NULL DEFAULT 0,
+		bcrypt_cost INTEGER NOT NULL DEFAULT 0,
+		updated_at ` + timestamp + ` NOT NULL,
+		updated_by INTEGER
+	)`
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to create password_hashing table: %w", err)
+	}
+	return nil
+}
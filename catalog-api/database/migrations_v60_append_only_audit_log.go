@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// makeAuditLogAppendOnly indexes auth_audit_log for queries by user,
+// event and time, and adds triggers that reject updates and deletes of
+// its rows, so the audit trail can only grow.
+func (db *DB) makeAuditLogAppendOnly(ctx context.Context) error {
+	statements := []string{
+		`CREATE INDEX IF NOT EXISTS idx_auth_audit_user_id ON auth_audit_log(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_auth_audit_event_type ON auth_audit_log(event_type)`,
+		`CREATE INDEX IF NOT EXISTS idx_auth_audit_created_at ON auth_audit_log(created_at)`,
+	}
+	if db.dialect.IsPostgres() {
+		statements = append(statements,
+			`CREATE OR REPLACE FUNCTION reject_auth_audit_log_change()
+			 RETURNS TRIGGER AS $$
+			 BEGIN
+				RAISE EXCEPTION 'auth_audit_log is append-only';
+			 END;
+			 $$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS auth_audit_log_append_only ON auth_audit_log`,
+			`CREATE TRIGGER auth_audit_log_append_only
+				BEFORE UPDATE OR DELETE ON auth_audit_log
+				FOR EACH ROW
+				EXECUTE FUNCTION reject_auth_audit_log_change()`,
+		)
+	} else {
+		statements = append(statements,
+			`CREATE TRIGGER IF NOT EXISTS auth_audit_log_no_update
+				BEFORE UPDATE ON auth_audit_log
+			 BEGIN
+				SELECT RAISE(ABORT, 'auth_audit_log is append-only');
+			 END`,
+			`CREATE TRIGGER IF NOT EXISTS auth_audit_log_no_delete
+				BEFORE DELETE ON auth_audit_log
+			 BEGIN
+				SELECT RAISE(ABORT, 'auth_audit_log is append-only');
+			 END`,
+		)
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to make audit log append-only: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createErrorReportsTable creates error_reports, the errors clients report
+// and the CSP violation reports browsers send. Browser reports carry no
+// user, so user_id is 0 for them and has no foreign key.
+func (db *DB) createErrorReportsTable(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS error_reports (
+			id ` + id + `,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			level TEXT NOT NULL,
+			message TEXT NOT NULL,
+			error_code TEXT NOT NULL DEFAULT '',
+			component TEXT NOT NULL DEFAULT '',
+			stack_trace TEXT NOT NULL DEFAULT '',
+			context TEXT,
+			system_info TEXT,
+			user_agent TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			fingerprint TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'new',
+			reported_at ` + timestamp + ` NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			resolved_at ` + timestamp + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_error_reports_user_reported ON error_reports(user_id, reported_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_error_reports_fingerprint ON error_reports(fingerprint)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create error reports table: %w", err)
+		}
+	}
+	return nil
+}
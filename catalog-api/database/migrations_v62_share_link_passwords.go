@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addShareLinkPasswords adds optional passwords to share links, with the
+// count of wrong passwords in a row, the time the link is locked until
+// after them and why a link was revoked, such as too many wrong passwords.
+func (db *DB) addShareLinkPasswords(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`ALTER TABLE share_links ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE share_links ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE share_links ADD COLUMN locked_until ` + timestamp,
+		`ALTER TABLE share_links ADD COLUMN revoked_reason TEXT NOT NULL DEFAULT ''`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to add share link passwords: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addMediaFileLayout records how a file maps onto its media item, for
+// items split across several files and files holding several episodes:
+//   - media_files.part_number: the file's place among the parts of one
+//     item, such as CD1 and CD2 of a movie; NULL for whole files
+//   - media_files.segment_index, segment_count: which of the episodes a
+//     file holds, in order, the item is (2 of 2 for E02 of S01E01-E02)
+func (db *DB) addMediaFileLayout(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE media_files ADD COLUMN part_number INTEGER`,
+		`ALTER TABLE media_files ADD COLUMN segment_index INTEGER`,
+		`ALTER TABLE media_files ADD COLUMN segment_count INTEGER`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to add media file layout: %w", err)
+		}
+	}
+	return nil
+}
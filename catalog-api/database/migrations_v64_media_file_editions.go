@@ -0,0 +1,17 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addMediaFileEditions records which edition of its title a file is, such
+// as "Extended" or "Director's Cut". With the resolution in
+// media_files.quality_info it tells apart the copies of a movie grouped
+// under one media item.
+func (db *DB) addMediaFileEditions(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `ALTER TABLE media_files ADD COLUMN edition TEXT`); err != nil {
+		return fmt.Errorf("failed to add media file editions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createLibraryHealthSnapshots creates library_health_snapshots, the
+// health score of each library section and the counts behind it, recorded
+// once per interval so the score can be trended.
+func (db *DB) createLibraryHealthSnapshots(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS library_health_snapshots (
+			id ` + id + `,
+			section TEXT NOT NULL,
+			score INTEGER NOT NULL,
+			items INTEGER NOT NULL,
+			files INTEGER NOT NULL,
+			missing_metadata INTEGER NOT NULL,
+			unmatched INTEGER NOT NULL,
+			duplicate_files INTEGER NOT NULL,
+			corrupt_files INTEGER NOT NULL,
+			low_quality INTEGER NOT NULL,
+			recorded_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_library_health_snapshots_section ON library_health_snapshots(section, recorded_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create library health snapshots table: %w", err)
+		}
+	}
+	return nil
+}
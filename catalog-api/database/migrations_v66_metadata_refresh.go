@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createMetadataRefreshTables creates:
+//   - metadata_refresh_jobs: bulk re-enrichment runs over a section or a
+//     provider's records, with their progress.
+//   - metadata_provider_cache: metadata provider responses, kept until
+//     they expire or are invalidated. request_key identifies the search or
+//     record within the provider.
+func (db *DB) createMetadataRefreshTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS metadata_refresh_jobs (
+			id ` + id + `,
+			section TEXT NOT NULL DEFAULT '',
+			provider TEXT NOT NULL DEFAULT '',
+			only_missing BOOLEAN NOT NULL,
+			status TEXT NOT NULL,
+			total INTEGER NOT NULL DEFAULT 0,
+			processed INTEGER NOT NULL DEFAULT 0,
+			updated INTEGER NOT NULL DEFAULT 0,
+			unmatched INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			started_by INTEGER NOT NULL DEFAULT 0,
+			started_at ` + timestamp + ` NOT NULL,
+			finished_at ` + timestamp + `,
+			error TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_metadata_refresh_jobs_started ON metadata_refresh_jobs(started_at)`,
+		`CREATE TABLE IF NOT EXISTS metadata_provider_cache (
+			id ` + id + `,
+			provider TEXT NOT NULL,
+			media_type TEXT NOT NULL,
+			request_key TEXT NOT NULL,
+			response TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL,
+			expires_at ` + timestamp + ` NOT NULL,
+			UNIQUE(provider, request_key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_metadata_provider_cache_type ON metadata_provider_cache(provider, media_type)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create metadata refresh tables: %w", err)
+		}
+	}
+	return nil
+}
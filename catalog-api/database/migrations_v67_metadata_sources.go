@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createMetadataSourceTables creates:
+//   - metadata_source_priorities: the providers to take each metadata
+//     field from, most preferred first, keyed by field. The provider_order
+//     row holds the order providers are tried in to match an item.
+//   - media_item_field_sources: which provider record supplied each field
+//     of a media item. The match row is the record the item was matched to.
+func (db *DB) createMetadataSourceTables(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS metadata_source_priorities (
+			field TEXT PRIMARY KEY,
+			providers TEXT NOT NULL,
+			updated_by INTEGER NOT NULL DEFAULT 0,
+			updated_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS media_item_field_sources (
+			media_item_id INTEGER NOT NULL REFERENCES media_items(id) ON DELETE CASCADE,
+			field TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			external_id TEXT NOT NULL,
+			updated_at ` + timestamp + ` NOT NULL,
+			PRIMARY KEY (media_item_id, field)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_item_field_sources_provider ON media_item_field_sources(provider)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create metadata source tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createFileListingIndexes indexes the children of a directory in each
+// order they can be listed in, ending in the ID that breaks ties. A page
+// of a listing continued from a cursor is then a seek into the index,
+// however many entries the directory has. The indexes are the same for
+// SQLite and PostgreSQL.
+func (db *DB) createFileListingIndexes(ctx context.Context) error {
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_files_parent_dir_name ON files(parent_id, is_directory, name, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_files_parent_name ON files(parent_id, name, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_files_parent_size ON files(parent_id, size, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_files_parent_modified ON files(parent_id, modified_at, id)`,
+	}
+	for _, stmt := range indexes {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create file listing index: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createProviderKeyUsageTable creates provider_key_usage: how many
+// requests each API key of an external provider made on a UTC day, and
+// how many of them the provider refused with 429 Too Many Requests. Keys
+// are identified by a fingerprint; the keys themselves are never stored.
+func (db *DB) createProviderKeyUsageTable(ctx context.Context) error {
+	timestamp := "DATETIME"
+	if db.dialect.IsPostgres() {
+		timestamp = "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS provider_key_usage (
+			provider TEXT NOT NULL,
+			key_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			rate_limited INTEGER NOT NULL DEFAULT 0,
+			last_used_at ` + timestamp + `,
+			PRIMARY KEY (provider, key_id, day)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_provider_key_usage_day ON provider_key_usage(day)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create provider key usage table: %w", err)
+		}
+	}
+	return nil
+}
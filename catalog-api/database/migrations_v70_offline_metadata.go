@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// createOfflineMetadataTables creates the store of offline metadata
+// bundles, for deployments without internet access. A bundle is a named
+// dump of provider records; importing a newer version of it replaces its
+// records. Each record keeps its bundle entry as JSON in data, and its
+// title normalized for search in search_title. Every import attempt is
+// kept in offline_metadata_imports.
+func (db *DB) createOfflineMetadataTables(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "DATETIME"
+	if db.dialect.IsPostgres() {
+		id, timestamp = "SERIAL PRIMARY KEY", "TIMESTAMP"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS offline_metadata_bundles (
+			id ` + id + `,
+			name TEXT NOT NULL UNIQUE,
+			version TEXT NOT NULL,
+			source TEXT,
+			media_types TEXT NOT NULL DEFAULT '',
+			record_count INTEGER NOT NULL DEFAULT 0,
+			checksum TEXT NOT NULL,
+			imported_by INTEGER,
+			imported_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS offline_metadata_records (
+			id ` + id + `,
+			bundle TEXT NOT NULL,
+			media_type TEXT NOT NULL,
+			external_id TEXT NOT NULL,
+			title TEXT NOT NULL,
+			search_title TEXT NOT NULL,
+			year INTEGER,
+			data TEXT NOT NULL,
+			UNIQUE (bundle, media_type, external_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_offline_metadata_records_search ON offline_metadata_records(media_type, search_title)`,
+		`CREATE INDEX IF NOT EXISTS idx_offline_metadata_records_external ON offline_metadata_records(media_type, external_id)`,
+		`CREATE TABLE IF NOT EXISTS offline_metadata_imports (
+			id ` + id + `,
+			bundle TEXT NOT NULL,
+			version TEXT NOT NULL,
+			previous_version TEXT,
+			status TEXT NOT NULL,
+			record_count INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			imported_by INTEGER,
+			imported_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_offline_metadata_imports_bundle ON offline_metadata_imports(bundle, imported_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create offline metadata tables: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// addCollectionOwners records who created each media collection, so only
+// they or an administrator can restore or purge it once deleted.
+// Collections created before have no owner.
+func (db *DB) addCollectionOwners(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx,
+		`ALTER TABLE media_collections ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE SET NULL`); err != nil {
+		return fmt.Errorf("failed to add user_id to media_collections: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Soft-deleted rows keep their data and get a deleted_at timestamp instead
+// of being removed. Queries exclude them with "deleted_at IS NULL" until
+// they are restored, or purged once the recycle bin retention has passed.
+
+// SoftDelete marks the live row with id in table as deleted. It reports
+// false when there is no such row.
+func (db *DB) SoftDelete(ctx context.Context, table string, id int64) (bool, error) {
+	result, err := db.ExecContext(ctx,
+		`UPDATE `+table+` SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RestoreDeleted brings back the soft-deleted row with id in table. It
+// reports false when there is no such row.
+func (db *DB) RestoreDeleted(ctx context.Context, table string, id int64) (bool, error) {
+	result, err := db.ExecContext(ctx,
+		`UPDATE `+table+` SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	id, err := db.InsertReturningID(ctx,
+		`INSERT INTO media_collections (name, collection_type, created_at, updated_at) VALUES ('Noir', 'custom', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+
+	ok, err := db.RestoreDeleted(ctx, "media_collections", id)
+	require.NoError(t, err)
+	assert.False(t, ok, "a live row cannot be restored")
+
+	ok, err = db.SoftDelete(ctx, "media_collections", id)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = db.SoftDelete(ctx, "media_collections", id)
+	require.NoError(t, err)
+	assert.False(t, ok, "a row is only deleted once")
+
+	var live int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM media_collections WHERE deleted_at IS NULL`).Scan(&live))
+	assert.Equal(t, 0, live)
+
+	ok, err = db.RestoreDeleted(ctx, "media_collections", id)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM media_collections WHERE deleted_at IS NULL`).Scan(&live))
+	assert.Equal(t, 1, live)
+}
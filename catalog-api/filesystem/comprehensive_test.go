@@ -312,12 +312,12 @@ func TestDefaultClientFactory_CreateClient_SettingsExtraction(t *testing.T) {
 
 	t.Run("unsupported protocol with empty settings", func(t *testing.T) {
 		config := &StorageConfig{
-			Protocol: "sftp",
+			Protocol: "gopher",
 			Settings: map[string]interface{}{},
 		}
 		_, err := factory.CreateClient(config)
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unsupported protocol: sftp")
+		assert.Contains(t, err.Error(), "unsupported protocol: gopher")
 	})
 }
 
@@ -329,7 +329,7 @@ func TestDefaultClientFactory_SupportedProtocols_Contents(t *testing.T) {
 	factory := NewDefaultClientFactory()
 	protocols := factory.SupportedProtocols()
 
-	expectedProtocols := []string{"smb", "ftp", "nfs", "webdav", "local"}
+	expectedProtocols := []string{"smb", "ftp", "nfs", "webdav", "local", "rclone", "sftp"}
 	assert.Equal(t, expectedProtocols, protocols)
 
 	// Verify each protocol can create a client
@@ -375,6 +375,14 @@ func TestInterfaceCompliance(t *testing.T) {
 	t.Run("NFSClient implements FileSystemClient", func(t *testing.T) {
 		var _ FileSystemClient = (*NFSClient)(nil)
 	})
+
+	t.Run("RcloneClient implements FileSystemClient", func(t *testing.T) {
+		var _ FileSystemClient = (*RcloneClient)(nil)
+	})
+
+	t.Run("SFTPClient implements FileSystemClient", func(t *testing.T) {
+		var _ FileSystemClient = (*SFTPClient)(nil)
+	})
 }
 
 // =============================================================================
@@ -696,6 +704,7 @@ func TestLocalClient_ResolvePath_NormalPaths(t *testing.T) {
 		{"simple file", "file.txt", "/base/file.txt"},
 		{"nested file", "a/b/c.txt", "/base/a/b/c.txt"},
 		{"current dir", ".", "/base"},
+		{"dots in a name", "a..b/c...mkv", "/base/a..b/c...mkv"},
 	}
 
 	for _, tt := range tests {
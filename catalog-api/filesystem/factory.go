@@ -23,6 +23,18 @@ func (f *DefaultClientFactory) CreateClient(config *StorageConfig) (FileSystemCl
 			Username: getStringSetting(config.Settings, "username", ""),
 			Password: getStringSetting(config.Settings, "password", ""),
 			Domain:   getStringSetting(config.Settings, "domain", "WORKGROUP"),
+			SmbProtocolOptions: SmbProtocolOptions{
+				Dialect:           getStringSetting(config.Settings, "dialect", ""),
+				RequireSigning:    getBoolSetting(config.Settings, "require_signing", false),
+				RequireEncryption: getBoolSetting(config.Settings, "require_encryption", false),
+			},
+		}
+		if err := smbConfig.SmbProtocolOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid SMB settings: %w", err)
+		}
+		if smbConfig.Kerberos = kerberosSettings(config.Settings); smbConfig.Kerberos != nil {
+			smbConfig.MountPoint = getStringSetting(config.Settings, "mount_point", "")
+			return NewSmbMountClient(smbConfig)
 		}
 		return NewSmbClient(smbConfig), nil
 
@@ -41,8 +53,14 @@ func (f *DefaultClientFactory) CreateClient(config *StorageConfig) (FileSystemCl
 			Host:       getStringSetting(config.Settings, "host", ""),
 			Path:       getStringSetting(config.Settings, "path", ""),
 			MountPoint: getStringSetting(config.Settings, "mount_point", ""),
-			Options:    getStringSetting(config.Settings, "options", "vers=3"),
+			Kerberos:   kerberosSettings(config.Settings),
 		}
+		// Kerberos mounts default to NFSv4 with sec=krb5
+		defaultOptions := "vers=3"
+		if nfsConfig.Kerberos != nil {
+			defaultOptions = ""
+		}
+		nfsConfig.Options = getStringSetting(config.Settings, "options", defaultOptions)
 		client, err := NewNFSClient(*nfsConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create NFS client: %w", err)
@@ -64,6 +82,29 @@ func (f *DefaultClientFactory) CreateClient(config *StorageConfig) (FileSystemCl
 		}
 		return NewLocalClient(localConfig), nil
 
+	case "sftp":
+		sftpConfig := &SFTPConfig{
+			Host:           getStringSetting(config.Settings, "host", ""),
+			Port:           getIntSetting(config.Settings, "port", 22),
+			Username:       getStringSetting(config.Settings, "username", ""),
+			Password:       getStringSetting(config.Settings, "password", ""),
+			PrivateKey:     getStringSetting(config.Settings, "private_key", ""),
+			PrivateKeyPath: getStringSetting(config.Settings, "private_key_path", ""),
+			Passphrase:     getStringSetting(config.Settings, "passphrase", ""),
+			HostKey:        getStringSetting(config.Settings, "host_key", ""),
+			Path:           getStringSetting(config.Settings, "path", ""),
+		}
+		return NewSFTPClient(sftpConfig), nil
+
+	case "rclone":
+		rcloneConfig := &RcloneConfig{
+			Remote:     getStringSetting(config.Settings, "remote", ""),
+			Path:       getStringSetting(config.Settings, "path", ""),
+			Binary:     getStringSetting(config.Settings, "binary", "rclone"),
+			ConfigFile: getStringSetting(config.Settings, "config_file", ""),
+		}
+		return NewRcloneClient(rcloneConfig), nil
+
 	default:
 		return nil, fmt.Errorf("unsupported protocol: %s", config.Protocol)
 	}
@@ -71,7 +112,7 @@ func (f *DefaultClientFactory) CreateClient(config *StorageConfig) (FileSystemCl
 
 // SupportedProtocols returns the list of supported protocols
 func (f *DefaultClientFactory) SupportedProtocols() []string {
-	return []string{"smb", "ftp", "nfs", "webdav", "local"}
+	return []string{"smb", "ftp", "nfs", "webdav", "local", "rclone", "sftp"}
 }
 
 // Helper functions to extract settings
@@ -95,3 +136,12 @@ func getIntSetting(settings map[string]interface{}, key string, defaultValue int
 	}
 	return defaultValue
 }
+
+func getBoolSetting(settings map[string]interface{}, key string, defaultValue bool) bool {
+	if val, ok := settings[key]; ok {
+		if b, ok := val.(bool); ok {
+			return b
+		}
+	}
+	return defaultValue
+}
@@ -9,7 +9,7 @@ func TestDefaultClientFactory_SupportedProtocols(t *testing.T) {
 
 	protocols := factory.SupportedProtocols()
 
-	expected := []string{"smb", "ftp", "nfs", "webdav", "local"}
+	expected := []string{"smb", "ftp", "nfs", "webdav", "local", "rclone", "sftp"}
 	if len(protocols) != len(expected) {
 		t.Errorf("Expected %d protocols, got %d", len(expected), len(protocols))
 	}
@@ -0,0 +1,206 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrKerberosTicketExpired is returned when a share's Kerberos ticket has
+// expired and cannot be renewed, because no keytab is configured.
+var ErrKerberosTicketExpired = errors.New("Kerberos ticket has expired")
+
+// kerberosCCacheDir is where rpc.gssd and cifs.upcall look for the
+// credential caches of a user (files named krb5cc_<uid>...)
+const kerberosCCacheDir = "/tmp"
+
+// kerberosCheckInterval is how often a ticket that cannot be renewed is
+// checked for expiry, and how often the renewal loop runs
+const kerberosCheckInterval = time.Minute
+
+// KerberosConfig selects the Kerberos credentials a share is mounted with.
+// With a keytab, tickets are obtained and renewed automatically. Without
+// one, tickets must be put in the credential cache with kinit, and
+// operations fail with ErrKerberosTicketExpired once they run out.
+type KerberosConfig struct {
+	Principal string `json:"principal"`        // e.g. catalog@EXAMPLE.COM
+	Keytab    string `json:"keytab,omitempty"` // keytab holding the principal's keys
+	CCache    string `json:"ccache,omitempty"` // credential cache, default /tmp/krb5cc_<uid>_catalogizer_<principal hash>
+	// Lifetime requested for tickets obtained from the keytab (default 10
+	// hours). They are renewed after three quarters of it.
+	Lifetime time.Duration `json:"lifetime,omitempty"`
+}
+
+// KerberosTickets keeps a share's Kerberos ticket valid.
+type KerberosTickets struct {
+	config KerberosConfig
+	run    func(ctx context.Context, env []string, name string, args ...string) error
+
+	mu        sync.Mutex
+	renewAt   time.Time // when a keytab ticket is renewed
+	checkedAt time.Time // when a cache-only ticket was last checked
+	err       error     // outcome of the last renewal or check
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewKerberosTickets validates config and fills in its defaults.
+func NewKerberosTickets(config KerberosConfig) (*KerberosTickets, error) {
+	config.Principal = strings.TrimSpace(config.Principal)
+	if config.Keytab != "" && config.Principal == "" {
+		return nil, fmt.Errorf("a Kerberos principal is required with a keytab")
+	}
+	if config.Keytab == "" && config.CCache == "" && config.Principal == "" {
+		return nil, fmt.Errorf("Kerberos needs a keytab and principal, or a credential cache")
+	}
+	if config.CCache == "" {
+		sum := sha256.Sum256([]byte(config.Principal))
+		config.CCache = filepath.Join(kerberosCCacheDir,
+			fmt.Sprintf("krb5cc_%d_catalogizer_%s", os.Getuid(), hex.EncodeToString(sum[:4])))
+	}
+	config.CCache = strings.TrimPrefix(config.CCache, "FILE:")
+	if config.Lifetime <= 0 {
+		config.Lifetime = 10 * time.Hour
+	}
+	return &KerberosTickets{config: config, run: runKerberosCommand}, nil
+}
+
+// runKerberosCommand runs a Kerberos tool, returning its error output on
+// failure
+func runKerberosCommand(ctx context.Context, env []string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// CCache returns the path of the credential cache.
+func (t *KerberosTickets) CCache() string {
+	return t.config.CCache
+}
+
+// Env returns the environment pointing Kerberos tools at the cache.
+func (t *KerberosTickets) Env() []string {
+	return []string{"KRB5CCNAME=FILE:" + t.config.CCache}
+}
+
+// Ensure makes sure the cache holds a valid ticket, obtaining a new one
+// from the keytab when it is due for renewal.
+func (t *KerberosTickets) Ensure(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+
+	if t.config.Keytab != "" {
+		if t.err == nil && now.Before(t.renewAt) {
+			return nil
+		}
+		err := t.run(ctx, t.Env(), "kinit", "-k", "-t", t.config.Keytab,
+			"-l", fmt.Sprintf("%ds", int64(t.config.Lifetime/time.Second)),
+			"-c", "FILE:"+t.config.CCache, t.config.Principal)
+		if err != nil {
+			t.err = fmt.Errorf("failed to obtain a Kerberos ticket for %s from keytab %s: %w", t.config.Principal, t.config.Keytab, err)
+			return t.err
+		}
+		t.renewAt = now.Add(t.config.Lifetime * 3 / 4)
+		t.err = nil
+		return nil
+	}
+
+	if !t.checkedAt.IsZero() && now.Sub(t.checkedAt) < kerberosCheckInterval {
+		return t.err
+	}
+	t.checkedAt = now
+	if err := t.run(ctx, t.Env(), "klist", "-s", "-c", "FILE:"+t.config.CCache); err != nil {
+		t.err = fmt.Errorf("%w: no valid ticket in %s; without a keytab, renew it with kinit -c FILE:%s %s",
+			ErrKerberosTicketExpired, t.config.CCache, t.config.CCache, t.config.Principal)
+		return t.err
+	}
+	t.err = nil
+	return nil
+}
+
+// Err returns the outcome of the last renewal or check, without running
+// any Kerberos tool.
+func (t *KerberosTickets) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Start renews or checks the ticket in the background, so it stays valid
+// while the share is idle. Stop ends it.
+func (t *KerberosTickets) Start() {
+	t.mu.Lock()
+	if t.stop != nil {
+		t.mu.Unlock()
+		return
+	}
+	t.stop = make(chan struct{})
+	stop := t.stop
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(kerberosCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				t.Ensure(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop ends background renewal.
+func (t *KerberosTickets) Stop() {
+	t.mu.Lock()
+	stop := t.stop
+	t.stop = nil
+	t.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	t.wg.Wait()
+}
+
+// kerberosSettings reads the kerberos_* settings of a storage root, or
+// returns nil when none are set
+func kerberosSettings(settings map[string]interface{}) *KerberosConfig {
+	config := &KerberosConfig{
+		Principal: getStringSetting(settings, "kerberos_principal", ""),
+		Keytab:    getStringSetting(settings, "kerberos_keytab", ""),
+		CCache:    getStringSetting(settings, "kerberos_ccache", ""),
+	}
+	if d, err := time.ParseDuration(getStringSetting(settings, "kerberos_lifetime", "")); err == nil {
+		config.Lifetime = d
+	}
+	if config.Principal == "" && config.Keytab == "" && config.CCache == "" {
+		return nil
+	}
+	return config
+}
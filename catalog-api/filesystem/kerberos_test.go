@@ -0,0 +1,109 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKerberosRun records the Kerberos commands run and fails them while
+// fail is set
+type fakeKerberosRun struct {
+	commands []string
+	fail     bool
+}
+
+func (f *fakeKerberosRun) run(ctx context.Context, env []string, name string, args ...string) error {
+	f.commands = append(f.commands, name+" "+strings.Join(args, " "))
+	if f.fail {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func TestNewKerberosTickets(t *testing.T) {
+	_, err := NewKerberosTickets(KerberosConfig{Keytab: "/etc/catalog.keytab"})
+	assert.ErrorContains(t, err, "principal is required")
+	_, err = NewKerberosTickets(KerberosConfig{})
+	assert.Error(t, err)
+
+	tickets, err := NewKerberosTickets(KerberosConfig{Principal: "catalog@EXAMPLE.COM"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(tickets.CCache(), "/tmp/krb5cc_"))
+	assert.Equal(t, 10*time.Hour, tickets.config.Lifetime)
+
+	tickets, err = NewKerberosTickets(KerberosConfig{CCache: "FILE:/tmp/krb5cc_1000"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"KRB5CCNAME=FILE:/tmp/krb5cc_1000"}, tickets.Env())
+}
+
+func TestKerberosTickets_Keytab(t *testing.T) {
+	tickets, err := NewKerberosTickets(KerberosConfig{
+		Principal: "catalog@EXAMPLE.COM",
+		Keytab:    "/etc/catalog.keytab",
+		CCache:    "/tmp/krb5cc_test",
+		Lifetime:  time.Hour,
+	})
+	require.NoError(t, err)
+	fake := &fakeKerberosRun{}
+	tickets.run = fake.run
+
+	require.NoError(t, tickets.Ensure(context.Background()))
+	require.NoError(t, tickets.Ensure(context.Background()))
+	assert.Equal(t, []string{
+		"kinit -k -t /etc/catalog.keytab -l 3600s -c FILE:/tmp/krb5cc_test catalog@EXAMPLE.COM",
+	}, fake.commands)
+
+	// Renewed once three quarters of the lifetime have passed
+	tickets.renewAt = time.Now().Add(-time.Second)
+	require.NoError(t, tickets.Ensure(context.Background()))
+	assert.Len(t, fake.commands, 2)
+
+	// A failed renewal is retried on the next call
+	tickets.renewAt = time.Now().Add(-time.Second)
+	fake.fail = true
+	assert.ErrorContains(t, tickets.Ensure(context.Background()), "from keytab")
+	assert.Error(t, tickets.Err())
+	fake.fail = false
+	require.NoError(t, tickets.Ensure(context.Background()))
+	assert.NoError(t, tickets.Err())
+}
+
+func TestKerberosTickets_CCacheOnly(t *testing.T) {
+	tickets, err := NewKerberosTickets(KerberosConfig{Principal: "catalog@EXAMPLE.COM", CCache: "/tmp/krb5cc_test"})
+	require.NoError(t, err)
+	fake := &fakeKerberosRun{fail: true}
+	tickets.run = fake.run
+
+	err = tickets.Ensure(context.Background())
+	assert.ErrorIs(t, err, ErrKerberosTicketExpired)
+	assert.ErrorContains(t, err, "kinit -c FILE:/tmp/krb5cc_test")
+	assert.Equal(t, []string{"klist -s -c FILE:/tmp/krb5cc_test"}, fake.commands)
+
+	// Checks are throttled, keeping the last outcome
+	fake.fail = false
+	assert.ErrorIs(t, tickets.Ensure(context.Background()), ErrKerberosTicketExpired)
+	assert.Len(t, fake.commands, 1)
+
+	tickets.checkedAt = time.Now().Add(-kerberosCheckInterval)
+	require.NoError(t, tickets.Ensure(context.Background()))
+	assert.Len(t, fake.commands, 2)
+}
+
+func TestKerberosSettings(t *testing.T) {
+	assert.Nil(t, kerberosSettings(map[string]interface{}{"host": "nas"}))
+
+	config := kerberosSettings(map[string]interface{}{
+		"kerberos_principal": "catalog@EXAMPLE.COM",
+		"kerberos_keytab":    "/etc/catalog.keytab",
+		"kerberos_lifetime":  "4h",
+	})
+	require.NotNil(t, config)
+	assert.Equal(t, "catalog@EXAMPLE.COM", config.Principal)
+	assert.Equal(t, 4*time.Hour, config.Lifetime)
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // LocalConfig contains local filesystem configuration
@@ -25,11 +24,24 @@ type LocalClient struct {
 func NewLocalClient(config *LocalConfig) *LocalClient {
 	return &LocalClient{
 		config:    config,
-		basePath:  config.BasePath,
+		basePath:  absoluteBasePath(config.BasePath),
 		connected: false,
 	}
 }
 
+// absoluteBasePath makes a base directory absolute. Go only gives paths
+// the \\?\ prefix Windows needs past MAX_PATH (260 characters) when they
+// are absolute, so files deep below a relative base could not be opened.
+func absoluteBasePath(basePath string) string {
+	if basePath == "" {
+		return basePath
+	}
+	if abs, err := filepath.Abs(basePath); err == nil {
+		return abs
+	}
+	return basePath
+}
+
 // Connect establishes the connection (for local filesystem, this just validates the path)
 func (c *LocalClient) Connect(ctx context.Context) error {
 	// Validate that the base path exists and is accessible
@@ -66,12 +78,10 @@ func (c *LocalClient) TestConnection(ctx context.Context) error {
 
 // resolvePath resolves a relative path to an absolute path within the base directory
 func (c *LocalClient) resolvePath(path string) string {
-	// Clean the path and prevent directory traversal
-	cleanPath := filepath.Clean(path)
-	if strings.Contains(cleanPath, "..") {
-		// Prevent directory traversal attacks
-		cleanPath = strings.ReplaceAll(cleanPath, "..", "")
-	}
+	// Cleaning the path as if it were absolute drops any ".." that would
+	// climb out of the base directory, and leaves names that merely
+	// contain ".." alone
+	cleanPath := filepath.Clean(string(filepath.Separator) + path)
 	return filepath.Join(c.basePath, cleanPath)
 }
 
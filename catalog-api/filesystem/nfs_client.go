@@ -5,6 +5,7 @@ package filesystem
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -19,6 +20,10 @@ type NFSConfig struct {
 	Path       string `json:"path"`        // Export path on NFS server
 	MountPoint string `json:"mount_point"` // Local mount point
 	Options    string `json:"options"`     // Mount options
+
+	// Kerberos mounts the export with sec=krb5 (unless the options pick
+	// another flavour) using these credentials
+	Kerberos *KerberosConfig `json:"kerberos,omitempty"`
 }
 
 // NFSClient implements FileSystemClient for NFS protocol
@@ -27,6 +32,7 @@ type NFSClient struct {
 	mounted    bool
 	connected  bool
 	mountPoint string
+	tickets    *KerberosTickets
 }
 
 // NewNFSClient creates a new NFS client
@@ -34,12 +40,53 @@ func NewNFSClient(config NFSConfig) (*NFSClient, error) {
 	if config.MountPoint == "" {
 		return nil, fmt.Errorf("mount point is required")
 	}
-	return &NFSClient{
+	client := &NFSClient{
 		config:     config,
 		mounted:    false,
 		connected:  false,
 		mountPoint: config.MountPoint,
-	}, nil
+	}
+	if config.Kerberos != nil {
+		tickets, err := NewKerberosTickets(*config.Kerberos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kerberos settings: %w", err)
+		}
+		client.tickets = tickets
+	}
+	return client, nil
+}
+
+// mountOptions returns the mount options, asking for Kerberos security
+// (over NFSv4 unless a version is given) when credentials are configured
+func (c *NFSClient) mountOptions() string {
+	options := c.config.Options
+	if c.tickets == nil {
+		if options == "" {
+			return "vers=3"
+		}
+		return options
+	}
+	if options == "" {
+		options = "vers=4.2"
+	}
+	if !strings.Contains(options, "sec=") {
+		options += ",sec=krb5"
+	}
+	return options
+}
+
+// ready reports why operations cannot run: the share is not mounted or
+// its Kerberos ticket has expired
+func (c *NFSClient) ready() error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if c.tickets != nil {
+		if err := c.tickets.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Connect establishes the NFS connection by mounting the filesystem
@@ -55,25 +102,36 @@ func (c *NFSClient) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create mount point %s: %w", c.mountPoint, err)
 	}
 
-	// Mount the NFS share
-	source := fmt.Sprintf("%s:%s", c.config.Host, c.config.Path)
-	options := "vers=3"
-	if c.config.Options != "" {
-		options = c.config.Options
+	// Kerberos mounts need a valid ticket in the cache rpc.gssd reads
+	if c.tickets != nil {
+		if err := c.tickets.Ensure(ctx); err != nil {
+			return err
+		}
 	}
 
-	err := syscall.Mount(source, c.mountPoint, "nfs", 0, options)
+	// Mount the NFS share
+	source := fmt.Sprintf("%s:%s", c.config.Host, c.config.Path)
+	err := syscall.Mount(source, c.mountPoint, "nfs", 0, c.mountOptions())
 	if err != nil {
+		if c.tickets != nil && errors.Is(err, syscall.EKEYEXPIRED) {
+			return fmt.Errorf("failed to mount NFS share %s to %s: %w", source, c.mountPoint, ErrKerberosTicketExpired)
+		}
 		return fmt.Errorf("failed to mount NFS share %s to %s: %w", source, c.mountPoint, err)
 	}
 
 	c.mounted = true
 	c.connected = true
+	if c.tickets != nil {
+		c.tickets.Start()
+	}
 	return nil
 }
 
 // Disconnect unmounts the NFS filesystem
 func (c *NFSClient) Disconnect(ctx context.Context) error {
+	if c.tickets != nil {
+		c.tickets.Stop()
+	}
 	if c.mounted {
 		err := syscall.Unmount(c.mountPoint, 0)
 		if err != nil {
@@ -95,6 +153,11 @@ func (c *NFSClient) TestConnection(ctx context.Context) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
+	if c.tickets != nil {
+		if err := c.tickets.Ensure(ctx); err != nil {
+			return err
+		}
+	}
 	_, err := os.Stat(c.mountPoint)
 	return err
 }
@@ -124,8 +187,8 @@ func (c *NFSClient) resolvePath(path string) string {
 
 // ReadFile reads a file from the NFS mount
 func (c *NFSClient) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return nil, err
 	}
 	fullPath := c.resolvePath(path)
 	file, err := os.Open(fullPath)
@@ -137,8 +200,8 @@ func (c *NFSClient) ReadFile(ctx context.Context, path string) (io.ReadCloser, e
 
 // WriteFile writes a file to the NFS mount
 func (c *NFSClient) WriteFile(ctx context.Context, path string, data io.Reader) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return err
 	}
 	fullPath := c.resolvePath(path)
 
@@ -164,8 +227,8 @@ func (c *NFSClient) WriteFile(ctx context.Context, path string, data io.Reader)
 
 // GetFileInfo gets information about a file
 func (c *NFSClient) GetFileInfo(ctx context.Context, path string) (*FileInfo, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return nil, err
 	}
 	fullPath := c.resolvePath(path)
 	stat, err := os.Stat(fullPath)
@@ -185,8 +248,8 @@ func (c *NFSClient) GetFileInfo(ctx context.Context, path string) (*FileInfo, er
 
 // ListDirectory lists files in a directory
 func (c *NFSClient) ListDirectory(ctx context.Context, path string) ([]*FileInfo, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return nil, err
 	}
 	fullPath := c.resolvePath(path)
 	entries, err := os.ReadDir(fullPath)
@@ -215,8 +278,8 @@ func (c *NFSClient) ListDirectory(ctx context.Context, path string) ([]*FileInfo
 
 // FileExists checks if a file exists
 func (c *NFSClient) FileExists(ctx context.Context, path string) (bool, error) {
-	if !c.IsConnected() {
-		return false, fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return false, err
 	}
 	fullPath := c.resolvePath(path)
 	_, err := os.Stat(fullPath)
@@ -231,8 +294,8 @@ func (c *NFSClient) FileExists(ctx context.Context, path string) (bool, error) {
 
 // CreateDirectory creates a directory
 func (c *NFSClient) CreateDirectory(ctx context.Context, path string) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return err
 	}
 	fullPath := c.resolvePath(path)
 	err := os.MkdirAll(fullPath, 0755)
@@ -244,8 +307,8 @@ func (c *NFSClient) CreateDirectory(ctx context.Context, path string) error {
 
 // DeleteDirectory deletes a directory
 func (c *NFSClient) DeleteDirectory(ctx context.Context, path string) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return err
 	}
 	fullPath := c.resolvePath(path)
 	err := os.RemoveAll(fullPath)
@@ -257,8 +320,8 @@ func (c *NFSClient) DeleteDirectory(ctx context.Context, path string) error {
 
 // DeleteFile deletes a file
 func (c *NFSClient) DeleteFile(ctx context.Context, path string) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return err
 	}
 	fullPath := c.resolvePath(path)
 	err := os.Remove(fullPath)
@@ -270,8 +333,8 @@ func (c *NFSClient) DeleteFile(ctx context.Context, path string) error {
 
 // CopyFile copies a file within the NFS mount
 func (c *NFSClient) CopyFile(ctx context.Context, srcPath, dstPath string) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("not connected")
+	if err := c.ready(); err != nil {
+		return err
 	}
 	srcFullPath := c.resolvePath(srcPath)
 	dstFullPath := c.resolvePath(dstPath)
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -19,6 +20,9 @@ type NFSConfig struct {
 	Path       string `json:"path"`        // Export path on NFS server
 	MountPoint string `json:"mount_point"` // Local mount point
 	Options    string `json:"options"`     // Mount options
+
+	// Kerberos mounts the export with sec=krb5 using these credentials
+	Kerberos *KerberosConfig `json:"kerberos,omitempty"`
 }
 
 // NFSClient for macOS using mount command and basic file operations
@@ -27,6 +31,7 @@ type NFSClient struct {
 	mountPoint string
 	connected  bool
 	mounted    bool
+	tickets    *KerberosTickets
 }
 
 func NewNFSClient(config NFSConfig) (*NFSClient, error) {
@@ -39,10 +44,18 @@ func NewNFSClient(config NFSConfig) (*NFSClient, error) {
 		return nil, fmt.Errorf("failed to create mount point: %w", err)
 	}
 
-	return &NFSClient{
+	client := &NFSClient{
 		config:     config,
 		mountPoint: config.MountPoint,
-	}, nil
+	}
+	if config.Kerberos != nil {
+		tickets, err := NewKerberosTickets(*config.Kerberos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kerberos settings: %w", err)
+		}
+		client.tickets = tickets
+	}
+	return client, nil
 }
 
 func (c *NFSClient) Connect(ctx context.Context) error {
@@ -56,6 +69,14 @@ func (c *NFSClient) Connect(ctx context.Context) error {
 	if options == "" {
 		options = "resvport,soft,intr,tcp"
 	}
+	if c.tickets != nil {
+		if err := c.tickets.Ensure(ctx); err != nil {
+			return err
+		}
+		if !strings.Contains(options, "sec=") {
+			options += ",sec=krb5"
+		}
+	}
 
 	// Build mount source path
 	source := fmt.Sprintf("%s:%s", c.config.Host, c.config.Path)
@@ -69,6 +90,9 @@ func (c *NFSClient) Connect(ctx context.Context) error {
 	}
 
 	cmd := exec.CommandContext(ctx, "mount", args...)
+	if c.tickets != nil {
+		cmd.Env = append(os.Environ(), c.tickets.Env()...)
+	}
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("NFS mount failed: %w, output: %s", err, string(output))
@@ -83,11 +107,17 @@ func (c *NFSClient) Connect(ctx context.Context) error {
 
 	c.mounted = true
 	c.connected = true
+	if c.tickets != nil {
+		c.tickets.Start()
+	}
 
 	return nil
 }
 
 func (c *NFSClient) Disconnect(ctx context.Context) error {
+	if c.tickets != nil {
+		c.tickets.Stop()
+	}
 	if !c.mounted {
 		return nil
 	}
@@ -15,6 +15,10 @@ type NFSConfig struct {
 	Path       string `json:"path"`        // Export path on NFS server
 	MountPoint string `json:"mount_point"` // Local mount point
 	Options    string `json:"options"`     // Mount options
+
+	// Kerberos is accepted for configuration parity; NFS is not supported
+	// on Windows
+	Kerberos *KerberosConfig `json:"kerberos,omitempty"`
 }
 
 // NFSClient for Windows (NFS is not natively supported)
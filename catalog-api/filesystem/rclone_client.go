@@ -0,0 +1,322 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// RcloneConfig contains configuration for an rclone remote
+type RcloneConfig struct {
+	Remote     string `json:"remote"`      // Remote name as configured in rclone.conf (e.g. "gdrive")
+	Path       string `json:"path"`        // Base path inside the remote
+	Binary     string `json:"binary"`      // rclone executable, defaults to "rclone"
+	ConfigFile string `json:"config_file"` // Optional rclone.conf location
+}
+
+// RcloneClient implements FileSystemClient on top of any rclone remote by
+// shelling out to the rclone binary. It gives access to every backend rclone
+// supports without linking their SDKs into the catalog.
+type RcloneClient struct {
+	config    *RcloneConfig
+	connected bool
+}
+
+// rclone exit codes for a missing directory or file
+const (
+	rcloneExitDirNotFound  = 3
+	rcloneExitFileNotFound = 4
+)
+
+// rcloneListEntry is one element of `rclone lsjson` output
+type rcloneListEntry struct {
+	Path    string    `json:"Path"`
+	Name    string    `json:"Name"`
+	Size    int64     `json:"Size"`
+	ModTime time.Time `json:"ModTime"`
+	IsDir   bool      `json:"IsDir"`
+}
+
+// NewRcloneClient creates a new rclone client
+func NewRcloneClient(config *RcloneConfig) *RcloneClient {
+	return &RcloneClient{
+		config:    config,
+		connected: false,
+	}
+}
+
+// Connect verifies that the remote is reachable
+func (c *RcloneClient) Connect(ctx context.Context) error {
+	if strings.TrimSuffix(c.config.Remote, ":") == "" {
+		return fmt.Errorf("rclone remote is not configured")
+	}
+	if _, err := c.run(ctx, nil, "lsjson", "--max-depth", "1", "--dirs-only", c.target("")); err != nil {
+		return fmt.Errorf("failed to connect to rclone remote %s: %w", c.config.Remote, err)
+	}
+	c.connected = true
+	return nil
+}
+
+// Disconnect closes the connection (rclone is invoked per operation)
+func (c *RcloneClient) Disconnect(ctx context.Context) error {
+	c.connected = false
+	return nil
+}
+
+// IsConnected returns true if the client is connected
+func (c *RcloneClient) IsConnected() bool {
+	return c.connected
+}
+
+// TestConnection tests the connection
+func (c *RcloneClient) TestConnection(ctx context.Context) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	_, err := c.run(ctx, nil, "lsjson", "--max-depth", "1", "--dirs-only", c.target(""))
+	return err
+}
+
+// target builds the "remote:path" argument for a path relative to the base path
+func (c *RcloneClient) target(p string) string {
+	remote := strings.TrimSuffix(c.config.Remote, ":")
+	cleanPath := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	full := strings.TrimPrefix(path.Join(c.config.Path, cleanPath), "/")
+	if strings.HasPrefix(c.config.Path, "/") {
+		full = "/" + full
+	}
+	return remote + ":" + full
+}
+
+// command prepares an rclone invocation with the configured binary and config file
+func (c *RcloneClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	binary := c.config.Binary
+	if binary == "" {
+		binary = "rclone"
+	}
+	if c.config.ConfigFile != "" {
+		args = append([]string{"--config", c.config.ConfigFile}, args...)
+	}
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// run executes rclone and returns its standard output
+func (c *RcloneClient) run(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := c.command(ctx, args...)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &rcloneError{args: args, err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.Bytes(), nil
+}
+
+// rcloneError wraps a failed rclone invocation with its diagnostics
+type rcloneError struct {
+	args   []string
+	err    error
+	stderr string
+}
+
+func (e *rcloneError) Error() string {
+	if e.stderr != "" {
+		return fmt.Sprintf("rclone %s: %v: %s", e.args[0], e.err, e.stderr)
+	}
+	return fmt.Sprintf("rclone %s: %v", e.args[0], e.err)
+}
+
+func (e *rcloneError) Unwrap() error {
+	return e.err
+}
+
+// isRcloneNotFound reports whether rclone failed because the path does not exist
+func isRcloneNotFound(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	code := exitErr.ExitCode()
+	return code == rcloneExitDirNotFound || code == rcloneExitFileNotFound
+}
+
+// rcloneReadCloser streams `rclone cat` output and reaps the process on Close
+type rcloneReadCloser struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *rcloneReadCloser) Close() error {
+	r.ReadCloser.Close()
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("rclone cat: %w: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// ReadFile streams a file from the remote
+func (c *RcloneClient) ReadFile(ctx context.Context, p string) (io.ReadCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	cmd := c.command(ctx, "cat", c.target(p))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rclone file %s: %w", p, err)
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to read rclone file %s: %w", p, err)
+	}
+	return &rcloneReadCloser{ReadCloser: stdout, cmd: cmd, stderr: stderr}, nil
+}
+
+// WriteFile uploads data to the remote
+func (c *RcloneClient) WriteFile(ctx context.Context, p string, data io.Reader) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if _, err := c.run(ctx, data, "rcat", c.target(p)); err != nil {
+		return fmt.Errorf("failed to write rclone file %s: %w", p, err)
+	}
+	return nil
+}
+
+// GetFileInfo gets information about a file
+func (c *RcloneClient) GetFileInfo(ctx context.Context, p string) (*FileInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	out, err := c.run(ctx, nil, "lsjson", "--stat", c.target(p))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat rclone file %s: %w", p, err)
+	}
+	var entry rcloneListEntry
+	if err := json.Unmarshal(out, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse rclone stat for %s: %w", p, err)
+	}
+	info := entry.toFileInfo("")
+	info.Path = p
+	return info, nil
+}
+
+// ListDirectory lists files in a directory
+func (c *RcloneClient) ListDirectory(ctx context.Context, p string) ([]*FileInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	out, err := c.run(ctx, nil, "lsjson", c.target(p))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rclone directory %s: %w", p, err)
+	}
+	var entries []rcloneListEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse rclone listing for %s: %w", p, err)
+	}
+
+	files := make([]*FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, entry.toFileInfo(p))
+	}
+	return files, nil
+}
+
+func (e rcloneListEntry) toFileInfo(dir string) *FileInfo {
+	mode := os.FileMode(0644)
+	if e.IsDir {
+		mode = os.ModeDir | 0755
+	}
+	size := e.Size
+	if size < 0 {
+		// Some backends report -1 for directories and unknown sizes
+		size = 0
+	}
+	return &FileInfo{
+		Name:    e.Name,
+		Size:    size,
+		ModTime: e.ModTime,
+		IsDir:   e.IsDir,
+		Mode:    mode,
+		Path:    path.Join(dir, e.Name),
+	}
+}
+
+// FileExists checks if a file exists
+func (c *RcloneClient) FileExists(ctx context.Context, p string) (bool, error) {
+	if !c.IsConnected() {
+		return false, fmt.Errorf("not connected")
+	}
+	_, err := c.run(ctx, nil, "lsjson", "--stat", c.target(p))
+	if err != nil {
+		if isRcloneNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check rclone file existence %s: %w", p, err)
+	}
+	return true, nil
+}
+
+// CreateDirectory creates a directory
+func (c *RcloneClient) CreateDirectory(ctx context.Context, p string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if _, err := c.run(ctx, nil, "mkdir", c.target(p)); err != nil {
+		return fmt.Errorf("failed to create rclone directory %s: %w", p, err)
+	}
+	return nil
+}
+
+// DeleteDirectory deletes a directory and its contents
+func (c *RcloneClient) DeleteDirectory(ctx context.Context, p string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if _, err := c.run(ctx, nil, "purge", c.target(p)); err != nil {
+		return fmt.Errorf("failed to delete rclone directory %s: %w", p, err)
+	}
+	return nil
+}
+
+// DeleteFile deletes a file
+func (c *RcloneClient) DeleteFile(ctx context.Context, p string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if _, err := c.run(ctx, nil, "deletefile", c.target(p)); err != nil {
+		return fmt.Errorf("failed to delete rclone file %s: %w", p, err)
+	}
+	return nil
+}
+
+// CopyFile copies a file within the remote, server-side when the backend supports it
+func (c *RcloneClient) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if _, err := c.run(ctx, nil, "copyto", c.target(srcPath), c.target(dstPath)); err != nil {
+		return fmt.Errorf("failed to copy rclone file from %s to %s: %w", srcPath, dstPath, err)
+	}
+	return nil
+}
+
+// GetProtocol returns the protocol name
+func (c *RcloneClient) GetProtocol() string {
+	return "rclone"
+}
+
+// GetConfig returns the rclone configuration
+func (c *RcloneClient) GetConfig() interface{} {
+	return c.config
+}
@@ -0,0 +1,114 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRclone writes a shell script standing in for the rclone binary. It
+// records its arguments and answers the few subcommands the client uses.
+func fakeRclone(t *testing.T) (binary, argsLog string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake rclone script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	argsLog = filepath.Join(dir, "args.log")
+	script := `#!/bin/sh
+echo "$@" >> "` + argsLog + `"
+[ "$1" = "--config" ] && shift 2
+case "$1" in
+lsjson)
+  if [ "$2" = "--stat" ]; then
+    case "$3" in
+    *missing*) echo "object not found" >&2; exit 4 ;;
+    *) echo '{"Path":"a.mkv","Name":"a.mkv","Size":42,"ModTime":"2026-01-02T03:04:05Z","IsDir":false}' ;;
+    esac
+  else
+    echo '[{"Path":"a.mkv","Name":"a.mkv","Size":42,"ModTime":"2026-01-02T03:04:05Z","IsDir":false},{"Path":"sub","Name":"sub","Size":-1,"ModTime":"2026-01-02T03:04:05Z","IsDir":true}]'
+  fi ;;
+cat) printf 'hello' ;;
+rcat) cat > "` + filepath.Join(dir, "rcat.out") + `" ;;
+*) ;;
+esac
+`
+	binary = filepath.Join(dir, "rclone")
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+	return binary, argsLog
+}
+
+func TestRcloneClient_Target(t *testing.T) {
+	c := NewRcloneClient(&RcloneConfig{Remote: "gdrive:", Path: "media"})
+	assert.Equal(t, "gdrive:media", c.target(""))
+	assert.Equal(t, "gdrive:media/movies/a.mkv", c.target("movies/a.mkv"))
+	assert.Equal(t, "gdrive:media/etc/passwd", c.target("../../etc/passwd"))
+
+	abs := NewRcloneClient(&RcloneConfig{Remote: "sftp", Path: "/srv"})
+	assert.Equal(t, "sftp:/srv/x", abs.target("/x"))
+}
+
+func TestRcloneClient_Operations(t *testing.T) {
+	binary, argsLog := fakeRclone(t)
+	ctx := context.Background()
+	c := NewRcloneClient(&RcloneConfig{Remote: "remote", Path: "media", Binary: binary, ConfigFile: "/etc/rclone.conf"})
+
+	_, err := c.ListDirectory(ctx, "")
+	assert.ErrorContains(t, err, "not connected")
+
+	require.NoError(t, c.Connect(ctx))
+	assert.True(t, c.IsConnected())
+	require.NoError(t, c.TestConnection(ctx))
+
+	files, err := c.ListDirectory(ctx, "movies")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "movies/a.mkv", files[0].Path)
+	assert.Equal(t, int64(42), files[0].Size)
+	assert.True(t, files[1].IsDir)
+	assert.Equal(t, int64(0), files[1].Size)
+
+	info, err := c.GetFileInfo(ctx, "movies/a.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, "movies/a.mkv", info.Path)
+
+	exists, err := c.FileExists(ctx, "movies/a.mkv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = c.FileExists(ctx, "movies/missing.mkv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	r, err := c.ReadFile(ctx, "movies/a.mkv")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "hello", string(data))
+
+	require.NoError(t, c.WriteFile(ctx, "new.txt", strings.NewReader("payload")))
+	written, err := os.ReadFile(filepath.Join(filepath.Dir(argsLog), "rcat.out"))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(written))
+
+	require.NoError(t, c.CopyFile(ctx, "a", "b"))
+	require.NoError(t, c.DeleteFile(ctx, "b"))
+
+	log, err := os.ReadFile(argsLog)
+	require.NoError(t, err)
+	assert.Contains(t, string(log), "--config /etc/rclone.conf lsjson remote:media/movies")
+	assert.Contains(t, string(log), "copyto remote:media/a remote:media/b")
+	assert.Contains(t, string(log), "deletefile remote:media/b")
+}
+
+func TestRcloneClient_ConnectRequiresRemote(t *testing.T) {
+	c := NewRcloneClient(&RcloneConfig{})
+	assert.ErrorContains(t, c.Connect(context.Background()), "remote is not configured")
+	assert.Equal(t, "rclone", c.GetProtocol())
+}
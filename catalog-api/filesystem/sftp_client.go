@@ -0,0 +1,552 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPConfig contains SFTP connection configuration
+type SFTPConfig struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	PrivateKey     string `json:"private_key"`      // PEM encoded private key
+	PrivateKeyPath string `json:"private_key_path"` // Alternatively, a key file on this host
+	Passphrase     string `json:"passphrase"`       // Passphrase for an encrypted private key
+	HostKey        string `json:"host_key"`         // Pinned host key: authorized_keys line or SHA256 fingerprint
+	Path           string `json:"path"`             // Base path on the server
+}
+
+// SFTPClient implements FileSystemClient over SSH. Clients for the same
+// server and credentials share one pooled SSH connection.
+type SFTPClient struct {
+	config *SFTPConfig
+	conn   *sftpConn
+}
+
+// partSuffix marks an incomplete transfer that can be resumed
+const partSuffix = ".part"
+
+// NewSFTPClient creates a new SFTP client
+func NewSFTPClient(config *SFTPConfig) *SFTPClient {
+	if config.Port == 0 {
+		config.Port = 22
+	}
+	return &SFTPClient{config: config}
+}
+
+// Connect acquires a pooled SSH connection, dialing the server if needed
+func (c *SFTPClient) Connect(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+	conn, err := sftpConnections.acquire(ctx, c.config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SFTP server: %w", err)
+	}
+	c.conn = conn
+	return nil
+}
+
+// Disconnect releases the pooled connection
+func (c *SFTPClient) Disconnect(ctx context.Context) error {
+	if c.conn == nil {
+		return nil
+	}
+	sftpConnections.release(c.conn)
+	c.conn = nil
+	return nil
+}
+
+// IsConnected returns true if the client holds a live connection
+func (c *SFTPClient) IsConnected() bool {
+	return c.conn != nil && !c.conn.isClosed()
+}
+
+// TestConnection tests the connection
+func (c *SFTPClient) TestConnection(ctx context.Context) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	_, err := c.conn.sftp.Stat(c.resolvePath(""))
+	return err
+}
+
+// resolvePath resolves a relative path within the base path
+func (c *SFTPClient) resolvePath(p string) string {
+	cleanPath := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	if c.config.Path == "" {
+		// Relative to the login directory
+		if cleanPath == "/" {
+			return "."
+		}
+		return strings.TrimPrefix(cleanPath, "/")
+	}
+	return path.Join(c.config.Path, cleanPath)
+}
+
+// ReadFile reads a file from the SFTP server
+func (c *SFTPClient) ReadFile(ctx context.Context, p string) (io.ReadCloser, error) {
+	return c.OpenAt(ctx, p, 0)
+}
+
+// OpenAt opens a file for reading starting at offset, for resuming downloads
+func (c *SFTPClient) OpenAt(ctx context.Context, p string, offset int64) (io.ReadCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	file, err := c.conn.sftp.Open(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SFTP file %s: %w", fullPath, err)
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to seek SFTP file %s: %w", fullPath, err)
+		}
+	}
+	return file, nil
+}
+
+// WriteFile writes a file to the SFTP server. Data goes to a partial file
+// that replaces the target only once complete.
+func (c *SFTPClient) WriteFile(ctx context.Context, p string, data io.Reader) error {
+	if err := c.WritePart(ctx, p, 0, data); err != nil {
+		return err
+	}
+	return c.CommitPart(ctx, p, time.Time{})
+}
+
+// PartSize returns how much of an interrupted upload to p is already on the
+// server, or 0 when there is none.
+func (c *SFTPClient) PartSize(ctx context.Context, p string) (int64, error) {
+	if !c.IsConnected() {
+		return 0, fmt.Errorf("not connected")
+	}
+	info, err := c.conn.sftp.Stat(c.resolvePath(p) + partSuffix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to stat partial upload %s: %w", p, err)
+	}
+	return info.Size(), nil
+}
+
+// WritePart writes data into the partial file for p starting at offset.
+// Anything in the partial file past offset is discarded.
+func (c *SFTPClient) WritePart(ctx context.Context, p string, offset int64, data io.Reader) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	if err := c.conn.sftp.MkdirAll(path.Dir(fullPath)); err != nil {
+		return fmt.Errorf("failed to create SFTP directory %s: %w", path.Dir(fullPath), err)
+	}
+
+	file, err := c.conn.sftp.OpenFile(fullPath+partSuffix, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP file %s: %w", fullPath, err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate SFTP file %s: %w", fullPath, err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek SFTP file %s: %w", fullPath, err)
+	}
+	if _, err := io.Copy(file, &contextReader{ctx: ctx, r: data}); err != nil {
+		return fmt.Errorf("failed to write SFTP file %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// CommitPart moves a completed partial upload into place and, when modTime
+// is set, stamps it so later syncs can tell the file is unchanged.
+func (c *SFTPClient) CommitPart(ctx context.Context, p string, modTime time.Time) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	if err := c.conn.sftp.PosixRename(fullPath+partSuffix, fullPath); err != nil {
+		// Servers without the posix-rename extension refuse to overwrite
+		c.conn.sftp.Remove(fullPath)
+		if err := c.conn.sftp.Rename(fullPath+partSuffix, fullPath); err != nil {
+			return fmt.Errorf("failed to finalize SFTP file %s: %w", fullPath, err)
+		}
+	}
+	if !modTime.IsZero() {
+		if err := c.conn.sftp.Chtimes(fullPath, modTime, modTime); err != nil {
+			return fmt.Errorf("failed to set SFTP file time %s: %w", fullPath, err)
+		}
+	}
+	return nil
+}
+
+// contextReader stops a copy when its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// GetFileInfo gets information about a file
+func (c *SFTPClient) GetFileInfo(ctx context.Context, p string) (*FileInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	stat, err := c.conn.sftp.Stat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat SFTP file %s: %w", fullPath, err)
+	}
+
+	return &FileInfo{
+		Name:    stat.Name(),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		IsDir:   stat.IsDir(),
+		Mode:    stat.Mode(),
+		Path:    p,
+	}, nil
+}
+
+// ListDirectory lists files in a directory. Partial uploads are hidden.
+func (c *SFTPClient) ListDirectory(ctx context.Context, p string) ([]*FileInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	entries, err := c.conn.sftp.ReadDir(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SFTP directory %s: %w", fullPath, err)
+	}
+
+	var files []*FileInfo
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), partSuffix) {
+			continue
+		}
+		files = append(files, &FileInfo{
+			Name:    entry.Name(),
+			Size:    entry.Size(),
+			ModTime: entry.ModTime(),
+			IsDir:   entry.IsDir(),
+			Mode:    entry.Mode(),
+			Path:    path.Join(p, entry.Name()),
+		})
+	}
+
+	return files, nil
+}
+
+// FileExists checks if a file exists
+func (c *SFTPClient) FileExists(ctx context.Context, p string) (bool, error) {
+	if !c.IsConnected() {
+		return false, fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	_, err := c.conn.sftp.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check SFTP file existence %s: %w", fullPath, err)
+	}
+	return true, nil
+}
+
+// CreateDirectory creates a directory
+func (c *SFTPClient) CreateDirectory(ctx context.Context, p string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	if err := c.conn.sftp.MkdirAll(fullPath); err != nil {
+		return fmt.Errorf("failed to create SFTP directory %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// DeleteDirectory deletes a directory and its contents
+func (c *SFTPClient) DeleteDirectory(ctx context.Context, p string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	if err := c.conn.sftp.RemoveAll(fullPath); err != nil {
+		return fmt.Errorf("failed to delete SFTP directory %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// DeleteFile deletes a file
+func (c *SFTPClient) DeleteFile(ctx context.Context, p string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(p)
+	if err := c.conn.sftp.Remove(fullPath); err != nil {
+		return fmt.Errorf("failed to delete SFTP file %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// CopyFile copies a file on the server. SFTP has no server-side copy, so
+// the data round-trips through this host.
+func (c *SFTPClient) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	src, err := c.ReadFile(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := c.WriteFile(ctx, dstPath, src); err != nil {
+		return fmt.Errorf("failed to copy SFTP file from %s to %s: %w", srcPath, dstPath, err)
+	}
+	return nil
+}
+
+// GetProtocol returns the protocol name
+func (c *SFTPClient) GetProtocol() string {
+	return "sftp"
+}
+
+// GetConfig returns the SFTP configuration
+func (c *SFTPClient) GetConfig() interface{} {
+	return c.config
+}
+
+// sftpHostKeyCallback only accepts the pinned host key. Pinning is
+// mandatory: without it a man-in-the-middle could harvest credentials.
+func sftpHostKeyCallback(pinned string) (ssh.HostKeyCallback, error) {
+	pinned = strings.TrimSpace(pinned)
+	if pinned == "" {
+		return nil, fmt.Errorf("host key is required; pin the server's public key or its SHA256 fingerprint")
+	}
+
+	if strings.HasPrefix(pinned, "SHA256:") {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != pinned {
+				return fmt.Errorf("host key mismatch for %s: got %s", hostname, got)
+			}
+			return nil
+		}, nil
+	}
+
+	want, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %w", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if !bytes.Equal(key.Marshal(), want.Marshal()) {
+			return fmt.Errorf("host key mismatch for %s: got %s", hostname, ssh.FingerprintSHA256(key))
+		}
+		return nil
+	}, nil
+}
+
+// sftpAuthMethods builds SSH authentication from a private key and/or password
+func sftpAuthMethods(config *SFTPConfig) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	keyData := []byte(config.PrivateKey)
+	if len(keyData) == 0 && config.PrivateKeyPath != "" {
+		data, err := os.ReadFile(config.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		keyData = data
+	}
+	if len(keyData) > 0 {
+		var signer ssh.Signer
+		var err error
+		if config.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(config.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(keyData)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if config.Password != "" {
+		methods = append(methods, ssh.Password(config.Password))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("a password or private key is required")
+	}
+	return methods, nil
+}
+
+// sftpConn is a pooled SSH connection with its SFTP session
+type sftpConn struct {
+	key  string
+	ssh  *ssh.Client
+	sftp *sftp.Client
+	refs int
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *sftpConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *sftpConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.sftp.Close()
+	c.ssh.Close()
+}
+
+// sftpPool shares SSH connections between clients with identical server
+// and credentials. A connection is closed when its last client disconnects.
+type sftpPool struct {
+	mu    sync.Mutex
+	conns map[string]*sftpConn
+}
+
+var sftpConnections = &sftpPool{conns: make(map[string]*sftpConn)}
+
+// sftpPoolKey identifies a server and credential set without keeping the
+// secrets themselves as map keys
+func sftpPoolKey(config *SFTPConfig) string {
+	h := sha256.New()
+	for _, part := range []string{config.Host, strconv.Itoa(config.Port), config.Username,
+		config.Password, config.PrivateKey, config.PrivateKeyPath, config.Passphrase, config.HostKey} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *sftpPool) acquire(ctx context.Context, config *SFTPConfig) (*sftpConn, error) {
+	key := sftpPoolKey(config)
+
+	p.mu.Lock()
+	if conn, ok := p.conns[key]; ok && !conn.isClosed() {
+		conn.refs++
+		p.mu.Unlock()
+		return conn, nil
+	}
+	p.mu.Unlock()
+
+	conn, err := dialSFTP(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	conn.key = key
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, ok := p.conns[key]; ok && !existing.isClosed() {
+		// Another client dialed concurrently; keep the first connection
+		conn.close()
+		existing.refs++
+		return existing, nil
+	}
+	conn.refs = 1
+	p.conns[key] = conn
+
+	// Forget the connection as soon as the server drops it
+	go func() {
+		conn.ssh.Wait()
+		conn.close()
+		p.mu.Lock()
+		if p.conns[key] == conn {
+			delete(p.conns, key)
+		}
+		p.mu.Unlock()
+	}()
+
+	return conn, nil
+}
+
+func (p *sftpPool) release(conn *sftpConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn.refs--
+	if conn.refs > 0 {
+		return
+	}
+	if p.conns[conn.key] == conn {
+		delete(p.conns, conn.key)
+	}
+	conn.close()
+}
+
+func dialSFTP(ctx context.Context, config *SFTPConfig) (*sftpConn, error) {
+	hostKeyCallback, err := sftpHostKeyCallback(config.HostKey)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := sftpAuthMethods(config)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("failed to start SFTP subsystem: %w", err)
+	}
+	return &sftpConn{ssh: sshClient, sftp: sftpClient}, nil
+}
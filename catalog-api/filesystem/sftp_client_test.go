@@ -0,0 +1,102 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSSHKey(t *testing.T) (ssh.PublicKey, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	return sshPub, pem.EncodeToMemory(block)
+}
+
+func TestSFTPHostKeyCallback(t *testing.T) {
+	hostKey, _ := newTestSSHKey(t)
+	otherKey, _ := newTestSSHKey(t)
+
+	_, err := sftpHostKeyCallback("")
+	assert.ErrorContains(t, err, "host key is required")
+
+	_, err = sftpHostKeyCallback("not a key")
+	assert.ErrorContains(t, err, "invalid host key")
+
+	byLine, err := sftpHostKeyCallback(string(ssh.MarshalAuthorizedKey(hostKey)))
+	require.NoError(t, err)
+	assert.NoError(t, byLine("example.com:22", nil, hostKey))
+	assert.ErrorContains(t, byLine("example.com:22", nil, otherKey), "host key mismatch")
+
+	byFingerprint, err := sftpHostKeyCallback(ssh.FingerprintSHA256(hostKey))
+	require.NoError(t, err)
+	assert.NoError(t, byFingerprint("example.com:22", nil, hostKey))
+	assert.Error(t, byFingerprint("example.com:22", nil, otherKey))
+}
+
+func TestSFTPAuthMethods(t *testing.T) {
+	_, privateKey := newTestSSHKey(t)
+
+	_, err := sftpAuthMethods(&SFTPConfig{})
+	assert.ErrorContains(t, err, "password or private key is required")
+
+	methods, err := sftpAuthMethods(&SFTPConfig{Password: "secret"})
+	require.NoError(t, err)
+	assert.Len(t, methods, 1)
+
+	methods, err = sftpAuthMethods(&SFTPConfig{PrivateKey: string(privateKey), Password: "secret"})
+	require.NoError(t, err)
+	assert.Len(t, methods, 2)
+
+	_, err = sftpAuthMethods(&SFTPConfig{PrivateKey: "garbage"})
+	assert.ErrorContains(t, err, "failed to parse private key")
+
+	_, err = sftpAuthMethods(&SFTPConfig{PrivateKeyPath: "/nonexistent/id_ed25519"})
+	assert.ErrorContains(t, err, "failed to read private key")
+}
+
+func TestSFTPClient_ResolvePath(t *testing.T) {
+	home := NewSFTPClient(&SFTPConfig{})
+	assert.Equal(t, 22, home.config.Port)
+	assert.Equal(t, ".", home.resolvePath(""))
+	assert.Equal(t, "media/a.mkv", home.resolvePath("media/a.mkv"))
+
+	rooted := NewSFTPClient(&SFTPConfig{Path: "/srv/media"})
+	assert.Equal(t, "/srv/media/a.mkv", rooted.resolvePath("a.mkv"))
+	assert.Equal(t, "/srv/media/etc/passwd", rooted.resolvePath("../../etc/passwd"))
+}
+
+func TestSFTPPoolKey(t *testing.T) {
+	a := &SFTPConfig{Host: "h", Port: 22, Username: "u", Password: "p"}
+	b := &SFTPConfig{Host: "h", Port: 22, Username: "u", Password: "p"}
+	c := &SFTPConfig{Host: "h", Port: 22, Username: "u", Password: "q"}
+
+	assert.Equal(t, sftpPoolKey(a), sftpPoolKey(b))
+	assert.NotEqual(t, sftpPoolKey(a), sftpPoolKey(c))
+	assert.Len(t, sftpPoolKey(a), 64)
+}
+
+func TestSFTPClient_RequiresConnection(t *testing.T) {
+	client := NewSFTPClient(&SFTPConfig{Host: "localhost"})
+	ctx := context.Background()
+
+	assert.False(t, client.IsConnected())
+	_, err := client.ListDirectory(ctx, "")
+	assert.ErrorContains(t, err, "not connected")
+	_, err = client.PartSize(ctx, "a")
+	assert.ErrorContains(t, err, "not connected")
+	assert.NoError(t, client.Disconnect(ctx))
+
+	// Connecting without a pinned host key is refused before dialing
+	assert.ErrorContains(t, client.Connect(ctx), "host key is required")
+	assert.Equal(t, "sftp", client.GetProtocol())
+}
@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -17,6 +18,14 @@ type SmbConfig struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Domain   string `json:"domain"`
+
+	SmbProtocolOptions
+
+	// Kerberos signs in with Kerberos instead of NTLM. Such shares are
+	// reached through a kernel CIFS mount at MountPoint; see
+	// NewSmbMountClient.
+	Kerberos   *KerberosConfig `json:"kerberos,omitempty"`
+	MountPoint string          `json:"mount_point,omitempty"`
 }
 
 // SmbClient implements FileSystemClient for SMB protocol
@@ -34,25 +43,67 @@ func NewSmbClient(config *SmbConfig) *SmbClient {
 	}
 }
 
+// statusPathNotCovered is the NTSTATUS servers answer with for paths
+// below a DFS link
+const statusPathNotCovered = 0xC0000257
+
+// NewSmbDialer returns a dialer that signs in with NTLM and negotiates as
+// opts select. Encryption requirements are not checked here; see
+// ProbeSmbServer.
+func NewSmbDialer(username, password, domain string, opts SmbProtocolOptions) (*smb2.Dialer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	revision, _ := SmbDialectRevision(opts.Dialect)
+	return &smb2.Dialer{
+		Negotiator: smb2.Negotiator{
+			RequireMessageSigning: opts.RequireSigning,
+			SpecifiedDialect:      revision,
+		},
+		Initiator: &smb2.NTLMInitiator{
+			User:     username,
+			Password: password,
+			Domain:   domain,
+		},
+	}, nil
+}
+
+// DescribeSmbError explains errors the SMB client library reports only as
+// a status code. Paths below DFS links are not followed, so those get a
+// hint to configure the link's target instead.
+func DescribeSmbError(err error) error {
+	var responseErr *smb2.ResponseError
+	if errors.As(err, &responseErr) && responseErr.Code == statusPathNotCovered {
+		return fmt.Errorf("%w: the path is a DFS link, which is not followed; configure the server and share it points to instead", err)
+	}
+	return err
+}
+
 // Connect establishes the SMB connection
 func (c *SmbClient) Connect(ctx context.Context) error {
-	// Establish TCP connection
+	if c.config.Kerberos != nil {
+		return fmt.Errorf("the built-in SMB client only signs in with NTLM; Kerberos shares need a CIFS mount client (NewSmbMountClient)")
+	}
+	d, err := NewSmbDialer(c.config.Username, c.config.Password, c.config.Domain, c.config.SmbProtocolOptions)
+	if err != nil {
+		return fmt.Errorf("invalid SMB settings: %w", err)
+	}
+
 	addr := net.JoinHostPort(c.config.Host, fmt.Sprintf("%d", c.config.Port))
-	conn, err := net.Dial("tcp", addr)
+	if c.config.RequireEncryption {
+		if _, err := ProbeSmbServer(ctx, addr, c.config.SmbProtocolOptions); err != nil {
+			return err
+		}
+	}
+
+	// Establish TCP connection
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to connect to SMB server: %w", err)
 	}
 
 	// Create SMB session
-	d := &smb2.Dialer{
-		Initiator: &smb2.NTLMInitiator{
-			User:     c.config.Username,
-			Password: c.config.Password,
-			Domain:   c.config.Domain,
-		},
-	}
-
-	session, err := d.Dial(conn)
+	session, err := d.DialContext(ctx, conn)
 	if err != nil {
 		conn.Close()
 		return fmt.Errorf("failed to create SMB session: %w", err)
@@ -63,7 +114,7 @@ func (c *SmbClient) Connect(ctx context.Context) error {
 	if err != nil {
 		session.Logoff()
 		conn.Close()
-		return fmt.Errorf("failed to mount SMB share: %w", err)
+		return fmt.Errorf("failed to mount SMB share: %w", DescribeSmbError(err))
 	}
 
 	c.conn = conn
@@ -113,7 +164,7 @@ func (c *SmbClient) TestConnection(ctx context.Context) error {
 	}
 	// Try to list the root directory
 	_, err := c.share.ReadDir(".")
-	return err
+	return DescribeSmbError(err)
 }
 
 // ReadFile reads a file from the SMB share
@@ -123,7 +174,7 @@ func (c *SmbClient) ReadFile(ctx context.Context, path string) (io.ReadCloser, e
 	}
 	file, err := c.share.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open SMB file %s: %w", path, err)
+		return nil, fmt.Errorf("failed to open SMB file %s: %w", path, DescribeSmbError(err))
 	}
 	return file, nil
 }
@@ -154,7 +205,7 @@ func (c *SmbClient) GetFileInfo(ctx context.Context, path string) (*FileInfo, er
 	}
 	stat, err := c.share.Stat(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat SMB file %s: %w", path, err)
+		return nil, fmt.Errorf("failed to stat SMB file %s: %w", path, DescribeSmbError(err))
 	}
 
 	return &FileInfo{
@@ -174,7 +225,7 @@ func (c *SmbClient) ListDirectory(ctx context.Context, path string) ([]*FileInfo
 	}
 	entries, err := c.share.ReadDir(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list SMB directory %s: %w", path, err)
+		return nil, fmt.Errorf("failed to list SMB directory %s: %w", path, DescribeSmbError(err))
 	}
 
 	var files []*FileInfo
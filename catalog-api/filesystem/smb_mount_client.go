@@ -0,0 +1,123 @@
+//go:build linux
+// +build linux
+
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// cifsDialectVersions maps SMB dialects to the vers= values of CIFS mounts
+var cifsDialectVersions = map[uint16]string{
+	0x0202: "2.0",
+	0x0210: "2.1",
+	0x0300: "3.0",
+	0x0302: "3.02",
+	0x0311: "3.1.1",
+}
+
+// SmbMountClient reaches an SMB share through a kernel CIFS mount, which
+// unlike the built-in client can sign in with Kerberos. The kernel's
+// cifs.upcall helper (cifs-utils) reads the ticket from the credential
+// cache of the mounting user. Files are then accessed like a local
+// directory, as with NFS mounts.
+type SmbMountClient struct {
+	*NFSClient
+	smbConfig *SmbConfig
+}
+
+// NewSmbMountClient creates a client mounting the share at
+// config.MountPoint with the credentials in config.Kerberos.
+func NewSmbMountClient(config *SmbConfig) (FileSystemClient, error) {
+	if config.Kerberos == nil {
+		return nil, fmt.Errorf("Kerberos settings are required for a CIFS mount")
+	}
+	if config.MountPoint == "" {
+		return nil, fmt.Errorf("mount point is required for Kerberos SMB shares")
+	}
+	if err := config.SmbProtocolOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid SMB settings: %w", err)
+	}
+	tickets, err := NewKerberosTickets(*config.Kerberos)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kerberos settings: %w", err)
+	}
+	return &SmbMountClient{
+		NFSClient: &NFSClient{
+			config: NFSConfig{
+				Host:       config.Host,
+				Path:       config.Share,
+				MountPoint: config.MountPoint,
+				Options:    cifsMountOptions(config),
+				Kerberos:   config.Kerberos,
+			},
+			mountPoint: config.MountPoint,
+			tickets:    tickets,
+		},
+		smbConfig: config,
+	}, nil
+}
+
+// cifsMountOptions returns the CIFS mount options for a Kerberos share:
+// krb5i when signing is required, seal when encryption is, and the pinned
+// dialect
+func cifsMountOptions(config *SmbConfig) string {
+	sec := "krb5"
+	if config.RequireSigning {
+		sec = "krb5i"
+	}
+	options := []string{"sec=" + sec, fmt.Sprintf("cruid=%d", os.Getuid())}
+	if config.Port != 0 && config.Port != 445 {
+		options = append(options, fmt.Sprintf("port=%d", config.Port))
+	}
+	if revision, _ := SmbDialectRevision(config.Dialect); revision != 0 {
+		options = append(options, "vers="+cifsDialectVersions[revision])
+	}
+	if config.RequireEncryption {
+		options = append(options, "seal")
+	}
+	return strings.Join(options, ",")
+}
+
+// Connect obtains a Kerberos ticket and mounts the share
+func (c *SmbMountClient) Connect(ctx context.Context) error {
+	if c.mounted && c.connected {
+		return nil
+	}
+	if err := c.tickets.Ensure(ctx); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.mountPoint, 0755); err != nil {
+		return fmt.Errorf("failed to create mount point %s: %w", c.mountPoint, err)
+	}
+
+	source := fmt.Sprintf("//%s/%s", c.smbConfig.Host, strings.Trim(c.smbConfig.Share, "/"))
+	cmd := exec.CommandContext(ctx, "mount", "-t", "cifs", source, c.mountPoint, "-o", c.config.Options)
+	cmd.Env = append(os.Environ(), c.tickets.Env()...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		msg := strings.TrimSpace(string(output))
+		if strings.Contains(msg, "Required key not available") || strings.Contains(msg, "Key has expired") {
+			return fmt.Errorf("failed to mount SMB share %s: %w: %s", source, ErrKerberosTicketExpired, msg)
+		}
+		return fmt.Errorf("failed to mount SMB share %s to %s: %w: %s", source, c.mountPoint, err, msg)
+	}
+
+	c.mounted = true
+	c.connected = true
+	c.tickets.Start()
+	return nil
+}
+
+// GetProtocol returns the protocol name
+func (c *SmbMountClient) GetProtocol() string {
+	return "smb"
+}
+
+// GetConfig returns the SMB configuration
+func (c *SmbMountClient) GetConfig() interface{} {
+	return c.smbConfig
+}
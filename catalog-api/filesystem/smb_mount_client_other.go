@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+import "fmt"
+
+// NewSmbMountClient is only available on Linux, where Kerberos SMB shares
+// are reached through kernel CIFS mounts.
+func NewSmbMountClient(config *SmbConfig) (FileSystemClient, error) {
+	return nil, fmt.Errorf("Kerberos SMB shares are only supported on Linux")
+}
@@ -0,0 +1,350 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// SMB2 dialect revisions, newest first, by the names shares configure
+// them with
+var smbDialects = []struct {
+	name     string
+	revision uint16
+}{
+	{"3.1.1", 0x0311},
+	{"3.0.2", 0x0302},
+	{"3.0", 0x0300},
+	{"2.1", 0x0210},
+	{"2.0.2", 0x0202},
+}
+
+// SMB2 negotiate flags and capabilities (MS-SMB2 2.2.3, 2.2.4)
+const (
+	smbSigningEnabled  = 0x0001
+	smbSigningRequired = 0x0002
+
+	smbCapDFS               = 0x00000001
+	smbCapLeasing           = 0x00000002
+	smbCapLargeMTU          = 0x00000004
+	smbCapMultiChannel      = 0x00000008
+	smbCapPersistentHandles = 0x00000010
+	smbCapDirectoryLeasing  = 0x00000020
+	smbCapEncryption        = 0x00000040
+
+	smbPreauthIntegrityContext = 0x0001
+	smbEncryptionContext       = 0x0002
+
+	smbHeaderSize = 64
+)
+
+var smbCapabilityNames = []struct {
+	flag uint32
+	name string
+}{
+	{smbCapDFS, "dfs"},
+	{smbCapLeasing, "leasing"},
+	{smbCapLargeMTU, "large_mtu"},
+	{smbCapMultiChannel, "multi_channel"},
+	{smbCapPersistentHandles, "persistent_handles"},
+	{smbCapDirectoryLeasing, "directory_leasing"},
+	{smbCapEncryption, "encryption"},
+}
+
+var smbCipherNames = map[uint16]string{
+	0x0001: "AES-128-CCM",
+	0x0002: "AES-128-GCM",
+}
+
+// errSmb1Only is returned for servers that answer in SMB1, which the SMB
+// client library does not speak
+var errSmb1Only = errors.New("the server only speaks SMB1, which is not supported; enable SMB2 or later on the server")
+
+// SmbProtocolOptions select how an SMB connection is negotiated. The zero
+// value lets client and server agree on the newest dialect both speak.
+type SmbProtocolOptions struct {
+	// Dialect pins one dialect: "2.0.2", "2.1", "3.0", "3.0.2" or "3.1.1".
+	// SMB1 is not supported.
+	Dialect string `json:"dialect,omitempty"`
+	// RequireSigning makes the server verify message signatures and the
+	// client reject unsigned replies.
+	RequireSigning bool `json:"require_signing,omitempty"`
+	// RequireEncryption refuses servers that cannot encrypt: those before
+	// SMB 3.0 or without a cipher in common. Whether traffic is encrypted
+	// is up to the share's settings on the server.
+	RequireEncryption bool `json:"require_encryption,omitempty"`
+}
+
+// SmbDialectRevision returns the revision of the named dialect, or 0 for
+// "" (negotiate the newest).
+func SmbDialectRevision(name string) (uint16, error) {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "smb")
+	if name == "" {
+		return 0, nil
+	}
+	for _, d := range smbDialects {
+		if d.name == name {
+			return d.revision, nil
+		}
+	}
+	switch name {
+	case "1", "1.0", "nt1", "cifs":
+		return 0, fmt.Errorf("SMB1 is not supported; use dialect 2.0.2 or later")
+	case "2", "2.0":
+		return 0x0202, nil
+	case "3":
+		return 0x0300, nil
+	}
+	return 0, fmt.Errorf("unknown SMB dialect %q", name)
+}
+
+// smbDialectName returns the configuration name of a dialect revision
+func smbDialectName(revision uint16) string {
+	for _, d := range smbDialects {
+		if d.revision == revision {
+			return d.name
+		}
+	}
+	return fmt.Sprintf("0x%04x", revision)
+}
+
+// Validate checks that the options can be met by some server.
+func (o SmbProtocolOptions) Validate() error {
+	revision, err := SmbDialectRevision(o.Dialect)
+	if err != nil {
+		return err
+	}
+	if o.RequireEncryption && revision != 0 && revision < 0x0300 {
+		return fmt.Errorf("SMB encryption needs dialect 3.0 or later, not %s", smbDialectName(revision))
+	}
+	return nil
+}
+
+// SmbServerInfo is what an SMB server agreed to in protocol negotiation.
+type SmbServerInfo struct {
+	Dialect             string   `json:"dialect"`
+	SigningRequired     bool     `json:"signing_required"`
+	EncryptionSupported bool     `json:"encryption_supported"`
+	Cipher              string   `json:"cipher,omitempty"`
+	DFS                 bool     `json:"dfs"`
+	Capabilities        []string `json:"capabilities"`
+	MaxReadSize         uint32   `json:"max_read_size"`
+	MaxWriteSize        uint32   `json:"max_write_size"`
+}
+
+// ProbeSmbServer negotiates with the SMB server at addr as a connection
+// with opts would, without signing in, and reports what was agreed. It
+// fails when the server cannot meet opts.
+func ProbeSmbServer(ctx context.Context, addr string, opts SmbProtocolOptions) (*SmbServerInfo, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMB server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return negotiateSmb(conn, opts)
+}
+
+// negotiateSmb sends an SMB2 NEGOTIATE request offering the dialects opts
+// allow and decodes the reply
+func negotiateSmb(rw io.ReadWriter, opts SmbProtocolOptions) (*SmbServerInfo, error) {
+	revision, err := SmbDialectRevision(opts.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	var offered []uint16
+	if revision != 0 {
+		offered = []uint16{revision}
+	} else {
+		for _, d := range smbDialects {
+			offered = append(offered, d.revision)
+		}
+	}
+
+	request, err := smbNegotiateRequest(offered, opts.RequireSigning)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, 4, 4+len(request))
+	binary.BigEndian.PutUint32(frame, uint32(len(request)))
+	if _, err := rw.Write(append(frame, request...)); err != nil {
+		return nil, fmt.Errorf("failed to send SMB negotiation: %w", err)
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(rw, length[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("the server closed the connection during SMB negotiation; it may only speak SMB1 or not support the requested dialect")
+		}
+		return nil, fmt.Errorf("failed to read SMB negotiation: %w", err)
+	}
+	size := binary.BigEndian.Uint32(length[:]) & 0x00ffffff
+	if size < 4 || size > 1<<20 {
+		return nil, fmt.Errorf("invalid SMB negotiation reply length %d", size)
+	}
+	reply := make([]byte, size)
+	if _, err := io.ReadFull(rw, reply); err != nil {
+		return nil, fmt.Errorf("failed to read SMB negotiation: %w", err)
+	}
+
+	info, err := parseSmbNegotiateReply(reply, opts)
+	if err != nil {
+		return nil, err
+	}
+	if revision != 0 && info.Dialect != smbDialectName(revision) {
+		return nil, fmt.Errorf("the server chose SMB dialect %s instead of %s", info.Dialect, smbDialectName(revision))
+	}
+	if opts.RequireEncryption && !info.EncryptionSupported {
+		return nil, fmt.Errorf("the server cannot encrypt SMB traffic with dialect %s", info.Dialect)
+	}
+	return info, nil
+}
+
+// smbNegotiateRequest encodes an SMB2 NEGOTIATE request, with the
+// negotiate contexts SMB 3.1.1 requires when it is offered
+func smbNegotiateRequest(dialects []uint16, requireSigning bool) ([]byte, error) {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+
+	header := make([]byte, smbHeaderSize)
+	copy(header, "\xfeSMB")
+	le.PutUint16(header[4:], smbHeaderSize) // StructureSize
+	le.PutUint16(header[14:], 1)            // CreditRequest
+	buf.Write(header)
+
+	securityMode := uint16(smbSigningEnabled)
+	if requireSigning {
+		securityMode = smbSigningRequired
+	}
+	body := make([]byte, 36)
+	le.PutUint16(body[0:], 36)
+	le.PutUint16(body[2:], uint16(len(dialects)))
+	le.PutUint16(body[4:], securityMode)
+	le.PutUint32(body[8:], smbCapLargeMTU|smbCapEncryption)
+	if _, err := rand.Read(body[12:28]); err != nil {
+		return nil, fmt.Errorf("failed to generate SMB client GUID: %w", err)
+	}
+	buf.Write(body)
+	offers311 := false
+	for _, d := range dialects {
+		binary.Write(&buf, le, d)
+		offers311 = offers311 || d == 0x0311
+	}
+	if !offers311 {
+		return buf.Bytes(), nil
+	}
+
+	// Negotiate contexts start 8-byte aligned after the dialects
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	contextOffset := buf.Len()
+
+	preauth := make([]byte, 6+32)
+	le.PutUint16(preauth[0:], 1)      // HashAlgorithmCount
+	le.PutUint16(preauth[2:], 32)     // SaltLength
+	le.PutUint16(preauth[4:], 0x0001) // SHA-512
+	if _, err := rand.Read(preauth[6:]); err != nil {
+		return nil, fmt.Errorf("failed to generate SMB salt: %w", err)
+	}
+	writeSmbNegotiateContext(&buf, smbPreauthIntegrityContext, preauth)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	ciphers := make([]byte, 6)
+	le.PutUint16(ciphers[0:], 2)
+	le.PutUint16(ciphers[2:], 0x0002) // AES-128-GCM
+	le.PutUint16(ciphers[4:], 0x0001) // AES-128-CCM
+	writeSmbNegotiateContext(&buf, smbEncryptionContext, ciphers)
+
+	request := buf.Bytes()
+	le.PutUint32(request[smbHeaderSize+28:], uint32(contextOffset))
+	le.PutUint16(request[smbHeaderSize+32:], 2)
+	return request, nil
+}
+
+func writeSmbNegotiateContext(buf *bytes.Buffer, contextType uint16, data []byte) {
+	head := make([]byte, 8)
+	binary.LittleEndian.PutUint16(head[0:], contextType)
+	binary.LittleEndian.PutUint16(head[2:], uint16(len(data)))
+	buf.Write(head)
+	buf.Write(data)
+}
+
+// parseSmbNegotiateReply decodes an SMB2 NEGOTIATE response
+func parseSmbNegotiateReply(reply []byte, opts SmbProtocolOptions) (*SmbServerInfo, error) {
+	if len(reply) >= 4 && string(reply[:4]) == "\xffSMB" {
+		return nil, errSmb1Only
+	}
+	if len(reply) < smbHeaderSize+64 || string(reply[:4]) != "\xfeSMB" {
+		return nil, fmt.Errorf("invalid SMB negotiation reply")
+	}
+	le := binary.LittleEndian
+	if status := le.Uint32(reply[8:]); status != 0 {
+		return nil, fmt.Errorf("the server refused SMB negotiation (status 0x%08x); it may not support the requested dialect", status)
+	}
+	if command := le.Uint16(reply[12:]); command != 0 {
+		return nil, fmt.Errorf("unexpected SMB command 0x%04x in negotiation reply", command)
+	}
+
+	body := reply[smbHeaderSize:]
+	securityMode := le.Uint16(body[2:])
+	revision := le.Uint16(body[4:])
+	capabilities := le.Uint32(body[24:])
+	if revision == 0x02ff {
+		return nil, fmt.Errorf("the server offered no SMB2 dialect in common")
+	}
+
+	info := &SmbServerInfo{
+		Dialect:         smbDialectName(revision),
+		SigningRequired: opts.RequireSigning || securityMode&smbSigningRequired != 0,
+		DFS:             capabilities&smbCapDFS != 0,
+		Capabilities:    []string{},
+		MaxReadSize:     le.Uint32(body[32:]),
+		MaxWriteSize:    le.Uint32(body[36:]),
+	}
+	for _, c := range smbCapabilityNames {
+		if capabilities&c.flag != 0 {
+			info.Capabilities = append(info.Capabilities, c.name)
+		}
+	}
+
+	switch {
+	case revision == 0x0300 || revision == 0x0302:
+		info.EncryptionSupported = capabilities&smbCapEncryption != 0
+	case revision == 0x0311:
+		// SMB 3.1.1 agrees on a cipher in a negotiate context instead
+		count := int(le.Uint16(body[6:]))
+		offset := int(le.Uint32(body[60:]))
+		for i := 0; i < count && offset+8 <= len(reply); i++ {
+			contextType := le.Uint16(reply[offset:])
+			length := int(le.Uint16(reply[offset+2:]))
+			data := reply[offset+8:]
+			if length > len(data) {
+				break
+			}
+			data = data[:length]
+			if contextType == smbEncryptionContext && len(data) >= 4 && le.Uint16(data) > 0 {
+				if cipher := le.Uint16(data[2:]); cipher != 0 {
+					info.EncryptionSupported = true
+					info.Cipher = smbCipherNames[cipher]
+				}
+			}
+			offset += 8 + length
+			offset += (8 - offset%8) % 8
+		}
+	}
+
+	return info, nil
+}
@@ -0,0 +1,165 @@
+package filesystem
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSmbServer answers one NEGOTIATE request on conn with reply and
+// returns the request it read
+func fakeSmbServer(t *testing.T, conn net.Conn, reply []byte) <-chan []byte {
+	requests := make(chan []byte, 1)
+	go func() {
+		defer conn.Close()
+		var length [4]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			close(requests)
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(length[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			close(requests)
+			return
+		}
+		requests <- request
+		binary.BigEndian.PutUint32(length[:], uint32(len(reply)))
+		conn.Write(append(length[:], reply...))
+	}()
+	return requests
+}
+
+// smbNegotiateReply builds a NEGOTIATE response; a non-zero cipher adds
+// an encryption negotiate context
+func smbNegotiateReply(dialect, securityMode uint16, capabilities uint32, cipher uint16) []byte {
+	le := binary.LittleEndian
+	reply := make([]byte, smbHeaderSize+64)
+	copy(reply, "\xfeSMB")
+	le.PutUint16(reply[4:], smbHeaderSize)
+	body := reply[smbHeaderSize:]
+	le.PutUint16(body[0:], 65)
+	le.PutUint16(body[2:], securityMode)
+	le.PutUint16(body[4:], dialect)
+	le.PutUint32(body[24:], capabilities)
+	le.PutUint32(body[32:], 8<<20)
+	le.PutUint32(body[36:], 8<<20)
+	if cipher != 0 {
+		le.PutUint16(body[6:], 1)
+		le.PutUint32(body[60:], uint32(len(reply)))
+		context := make([]byte, 8+4)
+		le.PutUint16(context[0:], smbEncryptionContext)
+		le.PutUint16(context[2:], 4)
+		le.PutUint16(context[8:], 1)
+		le.PutUint16(context[10:], cipher)
+		reply = append(reply, context...)
+	}
+	return reply
+}
+
+func TestSmbDialectRevision(t *testing.T) {
+	for name, want := range map[string]uint16{"": 0, "3.1.1": 0x0311, "SMB2.1": 0x0210, "2": 0x0202, "3.0.2": 0x0302} {
+		got, err := SmbDialectRevision(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	_, err := SmbDialectRevision("1.0")
+	assert.ErrorContains(t, err, "SMB1 is not supported")
+	_, err = SmbDialectRevision("4.0")
+	assert.ErrorContains(t, err, "unknown SMB dialect")
+
+	assert.ErrorContains(t, SmbProtocolOptions{Dialect: "2.1", RequireEncryption: true}.Validate(), "3.0 or later")
+	assert.NoError(t, SmbProtocolOptions{Dialect: "3.0", RequireEncryption: true}.Validate())
+}
+
+func TestNegotiateSmb_Smb311(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	requests := fakeSmbServer(t, server,
+		smbNegotiateReply(0x0311, smbSigningEnabled|smbSigningRequired, smbCapDFS|smbCapLargeMTU, 0x0002))
+
+	info, err := negotiateSmb(client, SmbProtocolOptions{RequireEncryption: true})
+	require.NoError(t, err)
+	assert.Equal(t, "3.1.1", info.Dialect)
+	assert.True(t, info.SigningRequired)
+	assert.True(t, info.EncryptionSupported)
+	assert.Equal(t, "AES-128-GCM", info.Cipher)
+	assert.True(t, info.DFS)
+	assert.Equal(t, []string{"dfs", "large_mtu"}, info.Capabilities)
+	assert.Equal(t, uint32(8<<20), info.MaxReadSize)
+
+	// All dialects were offered, with the contexts SMB 3.1.1 needs
+	request := <-requests
+	le := binary.LittleEndian
+	body := request[smbHeaderSize:]
+	assert.Equal(t, uint16(5), le.Uint16(body[2:]))
+	assert.Equal(t, uint16(smbSigningEnabled), le.Uint16(body[4:]))
+	assert.Equal(t, uint16(0x0311), le.Uint16(body[36:]))
+	assert.Equal(t, uint16(2), le.Uint16(body[32:]))
+	contextOffset := le.Uint32(body[28:])
+	assert.Zero(t, contextOffset%8)
+	assert.Equal(t, uint16(smbPreauthIntegrityContext), le.Uint16(request[contextOffset:]))
+}
+
+func TestNegotiateSmb_PinnedDialect(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	requests := fakeSmbServer(t, server, smbNegotiateReply(0x0210, smbSigningEnabled, smbCapLargeMTU, 0))
+
+	info, err := negotiateSmb(client, SmbProtocolOptions{Dialect: "2.1", RequireSigning: true})
+	require.NoError(t, err)
+	assert.Equal(t, "2.1", info.Dialect)
+	assert.True(t, info.SigningRequired)
+	assert.False(t, info.EncryptionSupported)
+
+	request := <-requests
+	body := request[smbHeaderSize:]
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(body[2:]))
+	assert.Equal(t, uint16(smbSigningRequired), binary.LittleEndian.Uint16(body[4:]))
+	assert.Len(t, request, smbHeaderSize+36+2)
+}
+
+func TestNegotiateSmb_Failures(t *testing.T) {
+	t.Run("no encryption", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		fakeSmbServer(t, server, smbNegotiateReply(0x0300, smbSigningEnabled, smbCapLargeMTU, 0))
+		_, err := negotiateSmb(client, SmbProtocolOptions{RequireEncryption: true})
+		assert.ErrorContains(t, err, "cannot encrypt")
+	})
+
+	t.Run("smb1 only", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		fakeSmbServer(t, server, append([]byte("\xffSMB"), make([]byte, 60)...))
+		_, err := negotiateSmb(client, SmbProtocolOptions{})
+		assert.ErrorIs(t, err, errSmb1Only)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		reply := smbNegotiateReply(0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(reply[8:], 0xC00000BB) // STATUS_NOT_SUPPORTED
+		fakeSmbServer(t, server, reply)
+		_, err := negotiateSmb(client, SmbProtocolOptions{Dialect: "3.1.1"})
+		assert.ErrorContains(t, err, "refused SMB negotiation")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			var length [4]byte
+			io.ReadFull(server, length[:])
+			io.ReadFull(server, make([]byte, binary.BigEndian.Uint32(length[:])))
+			server.Close()
+		}()
+		_, err := negotiateSmb(client, SmbProtocolOptions{})
+		assert.ErrorContains(t, err, "closed the connection")
+	})
+}
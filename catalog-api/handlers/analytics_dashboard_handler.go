@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// analyticsDashboardService defines the analytics methods used by
+// AnalyticsDashboardHandler.
+type analyticsDashboardService interface {
+	TrackEvents(userID int, requests []models.AnalyticsEventRequest, ipAddress, userAgent string) error
+	GetDashboardMetrics(filters *models.AnalyticsFilters) (*models.DashboardMetrics, error)
+	GetRealtimeMetrics() (*models.RealtimeMetrics, error)
+	GetUserActivity(userID int, filters *models.AnalyticsFilters) (*models.UserAnalytics, error)
+	GetTimeSeries(metric string, filters *models.AnalyticsFilters, maxPoints int) (*models.AnalyticsTimeSeries, error)
+	GetMediaUsageStats(mediaID int, filters *models.AnalyticsFilters) (*models.MediaUsageStats, error)
+}
+
+// AnalyticsDashboardHandler ingests client analytics events and serves
+// the analytics dashboard. Any signed-in user may report events and read
+// their own activity; the dashboard, realtime metrics and other users'
+// activity, as well as per-media stats, require analytics.view.
+type AnalyticsDashboardHandler struct {
+	analytics   analyticsDashboardService
+	authService requestAuthService
+}
+
+// NewAnalyticsDashboardHandler creates a new AnalyticsDashboardHandler.
+func NewAnalyticsDashboardHandler(analytics analyticsDashboardService, authService requestAuthService) *AnalyticsDashboardHandler {
+	return &AnalyticsDashboardHandler{
+		analytics:   analytics,
+		authService: authService,
+	}
+}
+
+// analyticsErrorStatus maps service errors to HTTP status codes.
+func analyticsErrorStatus(err error) int {
+	if strings.Contains(err.Error(), "invalid") {
+		return http.StatusBadRequest
+	}
+	if strings.Contains(err.Error(), "not found") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// analyticsFilters reads start_date, end_date, bucket and event_type from
+// the query string. Dates are RFC 3339 or YYYY-MM-DD; a bare end_date
+// includes that whole day.
+func analyticsFilters(c *gin.Context) (*models.AnalyticsFilters, bool) {
+	return analyticsFiltersFrom(c, "start_date", "end_date", "bucket")
+}
+
+// analyticsFiltersFrom is analyticsFilters with the period and bucket read
+// from the named query parameters.
+func analyticsFiltersFrom(c *gin.Context, startParam, endParam, bucketParam string) (*models.AnalyticsFilters, bool) {
+	filters := &models.AnalyticsFilters{Bucket: c.Query(bucketParam)}
+	for _, param := range []string{startParam, endParam} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			day, dayErr := time.Parse("2006-01-02", value)
+			if dayErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + param, "details": err.Error()})
+				return nil, false
+			}
+			t = day
+			if param == endParam {
+				t = day.Add(24 * time.Hour)
+			}
+		}
+		if param == startParam {
+			filters.StartDate = &t
+		} else {
+			filters.EndDate = &t
+		}
+	}
+	filters.EventTypes = c.QueryArray("event_type")
+	return filters, true
+}
+
+// TrackEvents handles POST /api/v1/analytics/events. The body is a
+// single event, an array of events or {"events": [...]}; a batch is
+// stored whole or not at all.
+func (h *AnalyticsDashboardHandler) TrackEvents(c *gin.Context) {
+	currentUser, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	var events []models.AnalyticsEventRequest
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &events)
+	} else {
+		var batch struct {
+			Events []models.AnalyticsEventRequest `json:"events"`
+		}
+		if err = json.Unmarshal(body, &batch); err == nil {
+			events = batch.Events
+			if events == nil {
+				var event models.AnalyticsEventRequest
+				err = json.Unmarshal(body, &event)
+				events = []models.AnalyticsEventRequest{event}
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if err := h.analytics.TrackEvents(currentUser.ID, events, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"success": false, "error": "Failed to record analytics events", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": gin.H{"accepted": len(events)}})
+}
+
+// GetDashboard handles GET /api/v1/analytics/dashboard. Query
+// parameters: start_date and end_date (default the last 30 days), bucket
+// (hour, day, week or month) and event_type, repeatable, to narrow the
+// event timeline.
+func (h *AnalyticsDashboardHandler) GetDashboard(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionAnalyticsView); !ok {
+		return
+	}
+	filters, ok := analyticsFilters(c)
+	if !ok {
+		return
+	}
+
+	metrics, err := h.analytics.GetDashboardMetrics(filters)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"success": false, "error": "Failed to load analytics dashboard", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": metrics})
+}
+
+// GetTimeSeries handles GET /api/v1/analytics/timeseries, one metric
+// over time for charts. Query parameters: metric (events, active_users,
+// media_accesses, storage_bytes or storage_files), from and to (default
+// the last 30 days), interval (hour, day, week or month), max_points
+// (default 500) and event_type, repeatable. Longer series are downsampled.
+func (h *AnalyticsDashboardHandler) GetTimeSeries(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionAnalyticsView); !ok {
+		return
+	}
+	filters, ok := analyticsFiltersFrom(c, "from", "to", "interval")
+	if !ok {
+		return
+	}
+	maxPoints := 0
+	if value := c.Query("max_points"); value != "" {
+		var err error
+		if maxPoints, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid max_points", "details": err.Error()})
+			return
+		}
+	}
+
+	series, err := h.analytics.GetTimeSeries(c.Query("metric"), filters, maxPoints)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"success": false, "error": "Failed to load analytics time series", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": series})
+}
+
+// GetRealtime handles GET /api/v1/analytics/realtime, the activity of
+// the last five minutes.
+func (h *AnalyticsDashboardHandler) GetRealtime(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionAnalyticsView); !ok {
+		return
+	}
+
+	metrics, err := h.analytics.GetRealtimeMetrics()
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"success": false, "error": "Failed to load realtime metrics", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": metrics})
+}
+
+// GetUserActivity handles GET /api/v1/analytics/user/:user_id. It takes
+// the same date and bucket parameters as GetDashboard. Users may read
+// their own activity; reading anyone else's requires analytics.view.
+func (h *AnalyticsDashboardHandler) GetUserActivity(c *gin.Context) {
+	currentUser, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid user ID"})
+		return
+	}
+	if userID != currentUser.ID {
+		if _, ok := requirePermission(c, h.authService, models.PermissionAnalyticsView); !ok {
+			return
+		}
+	}
+	filters, ok := analyticsFilters(c)
+	if !ok {
+		return
+	}
+
+	analytics, err := h.analytics.GetUserActivity(userID, filters)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"success": false, "error": "Failed to load user analytics", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": analytics})
+}
+
+// GetMediaUsageStats handles GET /api/v1/media/:id/stats, how a media item was
+// played: play counts, unique viewers, completion and breakdowns by
+// country and device. It takes start_date and end_date like GetDashboard.
+func (h *AnalyticsDashboardHandler) GetMediaUsageStats(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionAnalyticsView); !ok {
+		return
+	}
+	mediaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid media ID"})
+		return
+	}
+	filters, ok := analyticsFilters(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.analytics.GetMediaUsageStats(mediaID, filters)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"success": false, "error": "Failed to load media stats", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
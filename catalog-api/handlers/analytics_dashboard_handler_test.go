@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAnalyticsDashboardService struct {
+	userID    int
+	events    []models.AnalyticsEventRequest
+	userAgent string
+	filters   *models.AnalyticsFilters
+	metric    string
+	maxPoints int
+	mediaID   int
+}
+
+func (f *fakeAnalyticsDashboardService) TrackEvents(userID int, requests []models.AnalyticsEventRequest, ipAddress, userAgent string) error {
+	if len(requests) > 2 {
+		return fmt.Errorf("invalid batch: at most 2 events are accepted")
+	}
+	f.userID, f.events, f.userAgent = userID, requests, userAgent
+	return nil
+}
+
+func (f *fakeAnalyticsDashboardService) GetDashboardMetrics(filters *models.AnalyticsFilters) (*models.DashboardMetrics, error) {
+	f.filters = filters
+	if filters.Bucket == "minute" {
+		return nil, fmt.Errorf("invalid bucket %q: use hour, day, week or month", filters.Bucket)
+	}
+	return &models.DashboardMetrics{TotalUsers: 3, Bucket: "day"}, nil
+}
+
+func (f *fakeAnalyticsDashboardService) GetRealtimeMetrics() (*models.RealtimeMetrics, error) {
+	return &models.RealtimeMetrics{ActiveUsers: 2}, nil
+}
+
+func (f *fakeAnalyticsDashboardService) GetUserActivity(userID int, filters *models.AnalyticsFilters) (*models.UserAnalytics, error) {
+	f.userID, f.filters = userID, filters
+	return &models.UserAnalytics{UserID: userID}, nil
+}
+
+func (f *fakeAnalyticsDashboardService) GetTimeSeries(metric string, filters *models.AnalyticsFilters, maxPoints int) (*models.AnalyticsTimeSeries, error) {
+	f.metric, f.filters, f.maxPoints = metric, filters, maxPoints
+	if metric != models.AnalyticsMetricEvents {
+		return nil, fmt.Errorf("invalid metric %q", metric)
+	}
+	return &models.AnalyticsTimeSeries{Metric: metric, RawPoints: 8760, Downsampled: true}, nil
+}
+
+func (f *fakeAnalyticsDashboardService) GetMediaUsageStats(mediaID int, filters *models.AnalyticsFilters) (*models.MediaUsageStats, error) {
+	f.mediaID, f.filters = mediaID, filters
+	if mediaID != 7 {
+		return nil, fmt.Errorf("media item %d not found", mediaID)
+	}
+	return &models.MediaUsageStats{MediaID: mediaID, Plays: 12, UniqueViewers: 6}, nil
+}
+
+func newAnalyticsDashboardTestRouter(svc *fakeAnalyticsDashboardService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewAnalyticsDashboardHandler(svc, auth)
+	r := gin.New()
+	r.POST("/analytics/events", h.TrackEvents)
+	r.GET("/analytics/dashboard", h.GetDashboard)
+	r.GET("/analytics/realtime", h.GetRealtime)
+	r.GET("/analytics/timeseries", h.GetTimeSeries)
+	r.GET("/analytics/user/:user_id", h.GetUserActivity)
+	r.GET("/media/:id/stats", h.GetMediaUsageStats)
+	return r
+}
+
+func analyticsDashboardRequest(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CatalogizerTV/2.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAnalyticsDashboardHandler_TrackEvents(t *testing.T) {
+	svc := &fakeAnalyticsDashboardService{}
+	r := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{}})
+
+	w := analyticsDashboardRequest(r, http.MethodPost, "/analytics/events", `{"event_type":"play","entity_id":7}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, svc.events, 1)
+	assert.Equal(t, 7, svc.events[0].EntityID)
+	assert.Equal(t, 1, svc.userID)
+	assert.Equal(t, "CatalogizerTV/2.1", svc.userAgent)
+
+	w = analyticsDashboardRequest(r, http.MethodPost, "/analytics/events",
+		`[{"event_type":"play","timestamp":"2026-03-04T10:30:00Z"},{"event_type":"pause"}]`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"accepted":2`)
+	require.Len(t, svc.events, 2)
+	require.NotNil(t, svc.events[0].Timestamp)
+	assert.Equal(t, time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC), svc.events[0].Timestamp.UTC())
+
+	w = analyticsDashboardRequest(r, http.MethodPost, "/analytics/events", `{"events":[{"event_type":"search"}]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, svc.events, 1)
+	assert.Equal(t, "search", svc.events[0].EventType)
+
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodPost, "/analytics/events",
+		`[{"event_type":"a"},{"event_type":"b"},{"event_type":"c"}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodPost, "/analytics/events", `{"event_type":`).Code)
+}
+
+func TestAnalyticsDashboardHandler_Dashboard(t *testing.T) {
+	svc := &fakeAnalyticsDashboardService{}
+	user := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{}})
+	assert.Equal(t, http.StatusForbidden, analyticsDashboardRequest(user, http.MethodGet, "/analytics/dashboard", "").Code)
+	assert.Equal(t, http.StatusForbidden, analyticsDashboardRequest(user, http.MethodGet, "/analytics/realtime", "").Code)
+
+	r := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}})
+	w := analyticsDashboardRequest(r, http.MethodGet,
+		"/analytics/dashboard?start_date=2026-03-01&end_date=2026-03-07&bucket=week&event_type=play&event_type=search", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total_users":3`)
+	require.NotNil(t, svc.filters.StartDate)
+	require.NotNil(t, svc.filters.EndDate)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), *svc.filters.StartDate)
+	// A bare end date covers the whole day
+	assert.Equal(t, time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), *svc.filters.EndDate)
+	assert.Equal(t, "week", svc.filters.Bucket)
+	assert.Equal(t, []string{"play", "search"}, svc.filters.EventTypes)
+
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodGet, "/analytics/dashboard?start_date=yesterday", "").Code)
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodGet, "/analytics/dashboard?bucket=minute", "").Code)
+
+	w = analyticsDashboardRequest(r, http.MethodGet, "/analytics/realtime", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active_users":2`)
+}
+
+func TestAnalyticsDashboardHandler_UserActivity(t *testing.T) {
+	svc := &fakeAnalyticsDashboardService{}
+	user := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{}})
+
+	// Users may read their own activity only
+	require.Equal(t, http.StatusOK, analyticsDashboardRequest(user, http.MethodGet, "/analytics/user/1?bucket=hour", "").Code)
+	assert.Equal(t, 1, svc.userID)
+	assert.Equal(t, "hour", svc.filters.Bucket)
+	assert.Equal(t, http.StatusForbidden, analyticsDashboardRequest(user, http.MethodGet, "/analytics/user/2", "").Code)
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(user, http.MethodGet, "/analytics/user/me", "").Code)
+
+	r := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}})
+	require.Equal(t, http.StatusOK, analyticsDashboardRequest(r, http.MethodGet, "/analytics/user/2", "").Code)
+	assert.Equal(t, 2, svc.userID)
+}
+
+func TestAnalyticsDashboardHandler_TimeSeries(t *testing.T) {
+	svc := &fakeAnalyticsDashboardService{}
+	user := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{}})
+	assert.Equal(t, http.StatusForbidden, analyticsDashboardRequest(user, http.MethodGet, "/analytics/timeseries?metric=events", "").Code)
+
+	r := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}})
+	w := analyticsDashboardRequest(r, http.MethodGet,
+		"/analytics/timeseries?metric=events&from=2025-01-01&to=2025-12-31&interval=hour&max_points=300", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"downsampled":true`)
+	assert.Equal(t, "events", svc.metric)
+	assert.Equal(t, 300, svc.maxPoints)
+	assert.Equal(t, "hour", svc.filters.Bucket)
+	require.NotNil(t, svc.filters.StartDate)
+	require.NotNil(t, svc.filters.EndDate)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), *svc.filters.StartDate)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), *svc.filters.EndDate)
+
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodGet, "/analytics/timeseries?metric=bandwidth", "").Code)
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodGet, "/analytics/timeseries?metric=events&max_points=many", "").Code)
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodGet, "/analytics/timeseries?metric=events&from=last-year", "").Code)
+}
+
+func TestAnalyticsDashboardHandler_MediaUsageStats(t *testing.T) {
+	svc := &fakeAnalyticsDashboardService{}
+	user := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{}})
+	assert.Equal(t, http.StatusForbidden, analyticsDashboardRequest(user, http.MethodGet, "/media/7/stats", "").Code)
+
+	r := newAnalyticsDashboardTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}})
+	w := analyticsDashboardRequest(r, http.MethodGet, "/media/7/stats?start_date=2026-03-01&end_date=2026-03-07", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"unique_viewers":6`)
+	assert.Equal(t, 7, svc.mediaID)
+	require.NotNil(t, svc.filters.EndDate)
+	assert.Equal(t, time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), *svc.filters.EndDate)
+
+	assert.Equal(t, http.StatusNotFound, analyticsDashboardRequest(r, http.MethodGet, "/media/8/stats", "").Code)
+	assert.Equal(t, http.StatusBadRequest, analyticsDashboardRequest(r, http.MethodGet, "/media/abc/stats", "").Code)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// analyticsRetentionService defines the retention methods used by
+// AnalyticsRetentionHandler.
+type analyticsRetentionService interface {
+	TableStats(ctx context.Context) ([]services.AnalyticsTableStats, error)
+	UpdatePolicy(ctx context.Context, table string, req services.AnalyticsRetentionPolicyRequest) (*services.AnalyticsRetentionPolicy, error)
+	RunAll(ctx context.Context) []services.AnalyticsRetentionResult
+}
+
+// AnalyticsRetentionHandler shows the size and growth of the analytics
+// tables and manages how long their raw rows and hourly rollups are kept.
+// Every endpoint requires system.admin.
+type AnalyticsRetentionHandler struct {
+	retention   analyticsRetentionService
+	authService requestAuthService
+}
+
+// NewAnalyticsRetentionHandler creates a new AnalyticsRetentionHandler.
+func NewAnalyticsRetentionHandler(retention analyticsRetentionService, authService requestAuthService) *AnalyticsRetentionHandler {
+	return &AnalyticsRetentionHandler{
+		retention:   retention,
+		authService: authService,
+	}
+}
+
+// analyticsRetentionErrorStatus maps service errors to HTTP status codes.
+func analyticsRetentionErrorStatus(err error) int {
+	if strings.Contains(err.Error(), "invalid") {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetRetention handles GET /api/v1/admin/analytics/retention.
+func (h *AnalyticsRetentionHandler) GetRetention(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	stats, err := h.retention.TableStats(c.Request.Context())
+	if err != nil {
+		c.JSON(analyticsRetentionErrorStatus(err), gin.H{"success": false, "error": "Failed to load analytics table stats", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
+
+// UpdatePolicy handles PUT /api/v1/admin/analytics/retention/:table.
+func (h *AnalyticsRetentionHandler) UpdatePolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req services.AnalyticsRetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	policy, err := h.retention.UpdatePolicy(c.Request.Context(), c.Param("table"), req)
+	if err != nil {
+		c.JSON(analyticsRetentionErrorStatus(err), gin.H{"success": false, "error": "Failed to update retention policy", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policy})
+}
+
+// RunRetention handles POST /api/v1/admin/analytics/retention/run. It
+// rolls up and purges every table now instead of waiting for the next
+// scheduled run.
+func (h *AnalyticsRetentionHandler) RunRetention(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": h.retention.RunAll(c.Request.Context())})
+}
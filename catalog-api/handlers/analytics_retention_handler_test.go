@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAnalyticsRetentionService struct {
+	table string
+	req   services.AnalyticsRetentionPolicyRequest
+}
+
+func (f *fakeAnalyticsRetentionService) TableStats(ctx context.Context) ([]services.AnalyticsTableStats, error) {
+	return []services.AnalyticsTableStats{{Table: "analytics_events", Rows: 1200, DailyRows: 40}}, nil
+}
+
+func (f *fakeAnalyticsRetentionService) UpdatePolicy(ctx context.Context, table string, req services.AnalyticsRetentionPolicyRequest) (*services.AnalyticsRetentionPolicy, error) {
+	if table != "analytics_events" {
+		return nil, fmt.Errorf("invalid analytics table: %s", table)
+	}
+	f.table, f.req = table, req
+	return &services.AnalyticsRetentionPolicy{Table: table, RawRetentionDays: *req.RawRetentionDays}, nil
+}
+
+func (f *fakeAnalyticsRetentionService) RunAll(ctx context.Context) []services.AnalyticsRetentionResult {
+	return []services.AnalyticsRetentionResult{{Table: "analytics_events", PurgedRows: 12}}
+}
+
+func analyticsRetentionRequest(auth requestAuthService, svc *fakeAnalyticsRetentionService, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewAnalyticsRetentionHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/analytics/retention", h.GetRetention)
+	r.PUT("/admin/analytics/retention/:table", h.UpdatePolicy)
+	r.POST("/admin/analytics/retention/run", h.RunRetention)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAnalyticsRetentionHandler(t *testing.T) {
+	svc := &fakeAnalyticsRetentionService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, analyticsRetentionRequest(viewer, svc, http.MethodGet, "/admin/analytics/retention", "").Code)
+	assert.Equal(t, http.StatusForbidden, analyticsRetentionRequest(viewer, svc, http.MethodPost, "/admin/analytics/retention/run", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := analyticsRetentionRequest(admin, svc, http.MethodGet, "/admin/analytics/retention", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"rows":1200`)
+
+	w = analyticsRetentionRequest(admin, svc, http.MethodPut, "/admin/analytics/retention/analytics_events", `{"raw_retention_days":90}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "analytics_events", svc.table)
+	require.NotNil(t, svc.req.RawRetentionDays)
+	assert.Equal(t, 90, *svc.req.RawRetentionDays)
+	assert.Nil(t, svc.req.RollupRetentionMonths)
+	assert.Equal(t, http.StatusBadRequest,
+		analyticsRetentionRequest(admin, svc, http.MethodPut, "/admin/analytics/retention/users", `{"raw_retention_days":1}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		analyticsRetentionRequest(admin, svc, http.MethodPut, "/admin/analytics/retention/analytics_events", `{"raw_retention_days":`).Code)
+
+	w = analyticsRetentionRequest(admin, svc, http.MethodPost, "/admin/analytics/retention/run", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"purged_rows":12`)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anomalyService defines the anomaly detection methods used by
+// AnomalyHandler.
+type anomalyService interface {
+	ListSettings(ctx context.Context) ([]services.AnomalyMetricSettings, error)
+	UpdateSettings(ctx context.Context, metric string, req services.AnomalyMetricSettingsRequest) (*services.AnomalyMetricSettings, error)
+	ListAlerts(ctx context.Context, metric string, unacknowledged bool, limit int) ([]services.AnomalyAlert, error)
+	AcknowledgeAlert(ctx context.Context, id int64, userID int) error
+}
+
+// AnomalyHandler manages how sensitive anomaly detection is per metric
+// and lists the anomalies detected. Every endpoint requires system.admin.
+type AnomalyHandler struct {
+	anomalies   anomalyService
+	authService requestAuthService
+}
+
+// NewAnomalyHandler creates a new AnomalyHandler.
+func NewAnomalyHandler(anomalies anomalyService, authService requestAuthService) *AnomalyHandler {
+	return &AnomalyHandler{
+		anomalies:   anomalies,
+		authService: authService,
+	}
+}
+
+// anomalyErrorStatus maps service errors to HTTP status codes.
+func anomalyErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GetSettings handles GET /api/v1/admin/anomalies/settings, the settings
+// and current baseline of every metric.
+func (h *AnomalyHandler) GetSettings(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	settings, err := h.anomalies.ListSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(anomalyErrorStatus(err), gin.H{"success": false, "error": "Failed to load anomaly settings", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// UpdateSettings handles PUT /api/v1/admin/anomalies/settings/:metric.
+func (h *AnomalyHandler) UpdateSettings(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req services.AnomalyMetricSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	settings, err := h.anomalies.UpdateSettings(c.Request.Context(), c.Param("metric"), req)
+	if err != nil {
+		c.JSON(anomalyErrorStatus(err), gin.H{"success": false, "error": "Failed to update anomaly settings", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// ListAlerts handles GET /api/v1/admin/anomalies/alerts. Query
+// parameters: metric, unacknowledged=true and limit (default 100).
+func (h *AnomalyHandler) ListAlerts(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	alerts, err := h.anomalies.ListAlerts(c.Request.Context(), c.Query("metric"), c.Query("unacknowledged") == "true", limit)
+	if err != nil {
+		c.JSON(anomalyErrorStatus(err), gin.H{"success": false, "error": "Failed to list anomaly alerts", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": alerts})
+}
+
+// AcknowledgeAlert handles POST /api/v1/admin/anomalies/alerts/:id/acknowledge.
+func (h *AnomalyHandler) AcknowledgeAlert(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid alert ID"})
+		return
+	}
+
+	if err := h.anomalies.AcknowledgeAlert(c.Request.Context(), id, currentUser.ID); err != nil {
+		c.JSON(anomalyErrorStatus(err), gin.H{"success": false, "error": "Failed to acknowledge anomaly alert", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
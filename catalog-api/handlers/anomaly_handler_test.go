@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAnomalyService struct {
+	req            services.AnomalyMetricSettingsRequest
+	unacknowledged bool
+	acknowledgedBy int
+}
+
+func (f *fakeAnomalyService) ListSettings(ctx context.Context) ([]services.AnomalyMetricSettings, error) {
+	return []services.AnomalyMetricSettings{{Metric: services.AnomalyMetricFailedLogins, Sensitivity: 3}}, nil
+}
+
+func (f *fakeAnomalyService) UpdateSettings(ctx context.Context, metric string, req services.AnomalyMetricSettingsRequest) (*services.AnomalyMetricSettings, error) {
+	if metric != services.AnomalyMetricFailedLogins {
+		return nil, fmt.Errorf("invalid anomaly metric: %s", metric)
+	}
+	f.req = req
+	return &services.AnomalyMetricSettings{Metric: metric, Sensitivity: *req.Sensitivity}, nil
+}
+
+func (f *fakeAnomalyService) ListAlerts(ctx context.Context, metric string, unacknowledged bool, limit int) ([]services.AnomalyAlert, error) {
+	f.unacknowledged = unacknowledged
+	return []services.AnomalyAlert{{ID: 4, Metric: services.AnomalyMetricErrorRate, Value: 30}}, nil
+}
+
+func (f *fakeAnomalyService) AcknowledgeAlert(ctx context.Context, id int64, userID int) error {
+	if id != 4 {
+		return errors.New("anomaly alert not found")
+	}
+	f.acknowledgedBy = userID
+	return nil
+}
+
+func anomalyRequest(auth requestAuthService, svc *fakeAnomalyService, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewAnomalyHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/anomalies/settings", h.GetSettings)
+	r.PUT("/admin/anomalies/settings/:metric", h.UpdateSettings)
+	r.GET("/admin/anomalies/alerts", h.ListAlerts)
+	r.POST("/admin/anomalies/alerts/:id/acknowledge", h.AcknowledgeAlert)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAnomalyHandler(t *testing.T) {
+	svc := &fakeAnomalyService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, anomalyRequest(viewer, svc, http.MethodGet, "/admin/anomalies/alerts", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := anomalyRequest(admin, svc, http.MethodGet, "/admin/anomalies/settings", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"metric":"failed_logins"`)
+
+	w = anomalyRequest(admin, svc, http.MethodPut, "/admin/anomalies/settings/failed_logins", `{"sensitivity":2.5}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, svc.req.Sensitivity)
+	assert.Equal(t, 2.5, *svc.req.Sensitivity)
+	assert.Nil(t, svc.req.Enabled)
+	assert.Equal(t, http.StatusBadRequest,
+		anomalyRequest(admin, svc, http.MethodPut, "/admin/anomalies/settings/cpu", `{"sensitivity":1}`).Code)
+
+	w = anomalyRequest(admin, svc, http.MethodGet, "/admin/anomalies/alerts?unacknowledged=true", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"z_score"`)
+	assert.True(t, svc.unacknowledged)
+
+	require.Equal(t, http.StatusOK, anomalyRequest(admin, svc, http.MethodPost, "/admin/anomalies/alerts/4/acknowledge", "").Code)
+	assert.Equal(t, 1, svc.acknowledgedBy)
+	assert.Equal(t, http.StatusNotFound, anomalyRequest(admin, svc, http.MethodPost, "/admin/anomalies/alerts/5/acknowledge", "").Code)
+	assert.Equal(t, http.StatusBadRequest, anomalyRequest(admin, svc, http.MethodPost, "/admin/anomalies/alerts/x/acknowledge", "").Code)
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 
+	"catalogizer/middleware"
 	"catalogizer/repository"
 
 	"digital.vasic.assets/pkg/asset"
@@ -24,8 +26,17 @@ func NewAssetHandler(mgr *manager.Manager, repo *repository.AssetRepository) *As
 	return &AssetHandler{manager: mgr, repo: repo}
 }
 
+// assetCacheControl lets clients and proxies keep resolved assets, such
+// as thumbnails and cover art, for a day.
+const assetCacheControl = "public, max-age=86400"
+
 // ServeAsset serves asset content by ID.
 // GET /api/v1/assets/:id
+//
+// Resolved assets with a database record carry a weak ETag and
+// Last-Modified from the record, and conditional requests for an unchanged
+// asset get 304 Not Modified. Placeholders served while an asset resolves
+// are never cached.
 func (h *AssetHandler) ServeAsset(c *gin.Context) {
 	id := asset.ID(c.Param("id"))
 
@@ -65,7 +76,13 @@ func (h *AssetHandler) ServeAsset(c *gin.Context) {
 		c.Header("Cache-Control", "no-cache")
 	} else {
 		c.Header("X-Asset-Status", "ready")
-		c.Header("Cache-Control", "public, max-age=86400")
+		c.Header("Cache-Control", assetCacheControl)
+		if dbAsset != nil {
+			etag := middleware.WeakETag(string(id), fmt.Sprint(dbAsset.UpdatedAt.UnixNano()), strconv.FormatInt(size, 10), ct)
+			if middleware.NotModified(c, etag, dbAsset.UpdatedAt, assetCacheControl) {
+				return
+			}
+		}
 	}
 
 	c.Header("Content-Type", ct)
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditRecorder records security-relevant actions in the audit log.
+type auditRecorder interface {
+	Record(ctx context.Context, entry services.AuditEntry)
+}
+
+// auditLog defines the audit log methods used by AuditHandler.
+type auditLog interface {
+	Query(ctx context.Context, filter services.AuditFilter) ([]services.AuditEvent, int, error)
+	Get(ctx context.Context, id int64) (*services.AuditEvent, error)
+	ExportCSV(ctx context.Context, filter services.AuditFilter, w io.Writer) (int, error)
+}
+
+// recordAudit records an action the caller of r performed. Nothing is
+// recorded when no audit log is configured.
+func recordAudit(r *http.Request, audit auditRecorder, userID int, action string, details map[string]interface{}) {
+	if audit == nil {
+		return
+	}
+	audit.Record(r.Context(), services.AuditEntry{
+		UserID:    userID,
+		Action:    action,
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Details:   details,
+	})
+}
+
+// AuditHandler queries and exports the audit log of security-relevant
+// actions. Every endpoint requires system.admin.
+type AuditHandler struct {
+	audit       auditLog
+	authService requestAuthService
+}
+
+// NewAuditHandler creates a new AuditHandler.
+func NewAuditHandler(audit auditLog, authService requestAuthService) *AuditHandler {
+	return &AuditHandler{
+		audit:       audit,
+		authService: authService,
+	}
+}
+
+// auditFilter parses the user_id, action, since, until, limit and offset
+// query parameters, answering 400 when one is malformed. action may list
+// several actions separated by commas; since and until are RFC 3339 times.
+func auditFilter(c *gin.Context) (services.AuditFilter, bool) {
+	var filter services.AuditFilter
+	fail := func(message string) (services.AuditFilter, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": message})
+		return services.AuditFilter{}, false
+	}
+
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			return fail("Invalid user_id")
+		}
+		filter.UserID = id
+	}
+	for _, action := range strings.Split(c.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			filter.Actions = append(filter.Actions, action)
+		}
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return fail("Invalid " + name + ", expected an RFC 3339 time")
+			}
+			*dst = t
+		}
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Until.After(filter.Since) {
+		return fail("until must be after since")
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
+	return filter, true
+}
+
+// ListEvents handles GET /api/v1/admin/audit.
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+
+	events, total, err := h.audit.Query(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to query audit log", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": events, "total": total})
+}
+
+// GetEvent handles GET /api/v1/admin/audit/:id.
+func (h *AuditHandler) GetEvent(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid audit event ID"})
+		return
+	}
+
+	event, err := h.audit.Get(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to get audit event", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": event})
+}
+
+// ExportEvents handles GET /api/v1/admin/audit/export. It takes the
+// filters of ListEvents and answers with every matching event as CSV.
+func (h *AuditHandler) ExportEvents(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := h.audit.ExportCSV(c.Request.Context(), filter, &buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to export audit log", "details": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=audit_log.csv")
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuditLog struct {
+	filter  services.AuditFilter
+	entries []services.AuditEntry
+}
+
+func (f *fakeAuditLog) Record(ctx context.Context, entry services.AuditEntry) {
+	f.entries = append(f.entries, entry)
+}
+
+func (f *fakeAuditLog) Query(ctx context.Context, filter services.AuditFilter) ([]services.AuditEvent, int, error) {
+	f.filter = filter
+	return []services.AuditEvent{{ID: 7, Action: services.AuditEventLogout}}, 12, nil
+}
+
+func (f *fakeAuditLog) Get(ctx context.Context, id int64) (*services.AuditEvent, error) {
+	if id != 7 {
+		return nil, fmt.Errorf("audit event %d not found", id)
+	}
+	return &services.AuditEvent{ID: 7, Action: services.AuditEventLogout}, nil
+}
+
+func (f *fakeAuditLog) ExportCSV(ctx context.Context, filter services.AuditFilter, w io.Writer) (int, error) {
+	f.filter = filter
+	_, err := io.WriteString(w, "id,action\n7,logout\n")
+	return 1, err
+}
+
+func auditRequest(auth requestAuthService, audit *fakeAuditLog, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewAuditHandler(audit, auth)
+	r := gin.New()
+	r.GET("/admin/audit", h.ListEvents)
+	r.GET("/admin/audit/export", h.ExportEvents)
+	r.GET("/admin/audit/:id", h.GetEvent)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuditHandler(t *testing.T) {
+	audit := &fakeAuditLog{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionSystemConfig: true}}
+	assert.Equal(t, http.StatusForbidden, auditRequest(viewer, audit, "/admin/audit").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := auditRequest(admin, audit, "/admin/audit?user_id=3&action=login_success,%20failed_login&since=2024-05-01T00:00:00Z&until=2024-05-02T00:00:00%2B02:00&limit=50&offset=100")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":12`)
+	assert.Equal(t, 3, audit.filter.UserID)
+	assert.Equal(t, []string{services.AuditEventLoginSuccess, services.AuditEventLoginFailed}, audit.filter.Actions)
+	assert.True(t, audit.filter.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, audit.filter.Until.Equal(time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 50, audit.filter.Limit)
+	assert.Equal(t, 100, audit.filter.Offset)
+
+	for _, query := range []string{"user_id=abc", "since=yesterday", "since=2024-05-02T00:00:00Z&until=2024-05-01T00:00:00Z"} {
+		assert.Equal(t, http.StatusBadRequest, auditRequest(admin, audit, "/admin/audit?"+query).Code, query)
+	}
+
+	w = auditRequest(admin, audit, "/admin/audit/7")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"action":"logout"`)
+	assert.Equal(t, http.StatusNotFound, auditRequest(admin, audit, "/admin/audit/8").Code)
+	assert.Equal(t, http.StatusBadRequest, auditRequest(admin, audit, "/admin/audit/x").Code)
+
+	w = auditRequest(admin, audit, "/admin/audit/export?action=logout")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "audit_log.csv")
+	assert.Equal(t, "id,action\n7,logout\n", w.Body.String())
+	assert.Equal(t, []string{services.AuditEventLogout}, audit.filter.Actions)
+}
+
+func TestRoleHandler_RecordsAudit(t *testing.T) {
+	userRepo := &MockRoleUserService{}
+	auth := &MockRoleAuthService{}
+	auth.On("GetCurrentUser", "valid-token").Return(&models.User{ID: 1, Username: "admin"}, nil)
+	auth.On("CheckPermission", 1, models.PermissionSystemAdmin).Return(true, nil)
+	userRepo.On("CreateRole", mock.Anything).Return(5, nil)
+	userRepo.On("DeleteRole", 5).Return(nil)
+
+	audit := &fakeAuditLog{}
+	h := NewRoleHandler(userRepo, auth)
+	h.SetAuditLog(audit)
+
+	body, _ := json.Marshal(models.CreateRoleRequest{Name: "Editors", Permissions: []string{"media.manage"}})
+	req := httptest.NewRequest(http.MethodPost, "/api/roles", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid-token")
+	req.RemoteAddr = "192.0.2.10:51000"
+	w := httptest.NewRecorder()
+	h.CreateRole(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/roles/5", strings.NewReader(""))
+	req.Header.Set("Authorization", "Bearer valid-token")
+	w = httptest.NewRecorder()
+	h.DeleteRole(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	require.Len(t, audit.entries, 2)
+	assert.Equal(t, services.AuditEventRoleCreated, audit.entries[0].Action)
+	assert.Equal(t, 1, audit.entries[0].UserID)
+	assert.Equal(t, "192.0.2.10", audit.entries[0].IPAddress)
+	assert.Equal(t, 5, audit.entries[0].Details["role_id"])
+	assert.Equal(t, services.AuditEventRoleDeleted, audit.entries[1].Action)
+}
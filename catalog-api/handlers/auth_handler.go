@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"catalogizer/middleware"
 	"catalogizer/models"
 	"catalogizer/repository"
 	"catalogizer/services"
@@ -13,6 +18,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// oidcStateCookie holds the state of the identity provider sign-in the
+// browser started, which the callback must bring back
+const oidcStateCookie = "catalogizer_oidc_state"
+
 // Gin handler functions for auth
 
 // LoginGin handles login request with gin
@@ -28,6 +37,10 @@ func (h *AuthHandler) LoginGin(c *gin.Context) {
 	userAgent := c.GetHeader("User-Agent")
 
 	result, err := h.authService.Login(req, ipAddress, userAgent)
+	if errors.Is(err, services.ErrAuthWebhookUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.ErrAuthWebhookUnavailable.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -216,6 +229,340 @@ func (h *AuthHandler) RegisterGin(c *gin.Context, userRepo *repository.UserRepos
 	c.JSON(http.StatusCreated, createdUser)
 }
 
+// activeSession describes a signed-in device, without its tokens
+type activeSession struct {
+	ID             int               `json:"id"`
+	DeviceInfo     models.DeviceInfo `json:"device_info"`
+	IPAddress      *string           `json:"ip_address,omitempty"`
+	UserAgent      *string           `json:"user_agent,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	LastActivityAt time.Time         `json:"last_activity_at"`
+	ExpiresAt      time.Time         `json:"expires_at"`
+	Current        bool              `json:"current"`
+}
+
+// currentSessionGin returns the user and session of the request's token
+func (h *AuthHandler) currentSessionGin(c *gin.Context) (*models.User, int, bool) {
+	token := extractTokenFromGin(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
+		return nil, 0, false
+	}
+
+	user, err := h.authService.GetCurrentUser(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, 0, false
+	}
+	claims, err := h.authService.ValidateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, 0, false
+	}
+	sessionID, _ := strconv.Atoi(claims.SessionID)
+	return user, sessionID, true
+}
+
+// sessionUserIDGin returns the ID of the user signed in with the
+// request's bearer token, or 0 when it has no valid one
+func (h *AuthHandler) sessionUserIDGin(c *gin.Context) int {
+	token := extractTokenFromGin(c)
+	if token == "" {
+		return 0
+	}
+	if _, err := h.authService.ValidateToken(token); err != nil {
+		return 0
+	}
+	user, err := h.authService.GetCurrentUser(token)
+	if err != nil {
+		return 0
+	}
+	return user.ID
+}
+
+// ListSessionsGin lists the current user's active sessions
+func (h *AuthHandler) ListSessionsGin(c *gin.Context) {
+	user, currentID, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.GetActiveSessions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]activeSession, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, activeSession{
+			ID:             session.ID,
+			DeviceInfo:     session.DeviceInfo,
+			IPAddress:      session.IPAddress,
+			UserAgent:      session.UserAgent,
+			CreatedAt:      session.CreatedAt,
+			LastActivityAt: session.LastActivityAt,
+			ExpiresAt:      session.ExpiresAt,
+			Current:        session.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": result})
+}
+
+// RevokeSessionGin signs out one of the current user's sessions
+func (h *AuthHandler) RevokeSessionGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	err = h.authService.RevokeSession(user.ID, sessionID)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessionsGin signs out all of the current user's sessions
+// except the one making the request
+func (h *AuthHandler) RevokeOtherSessionsGin(c *gin.Context) {
+	user, currentID, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.authService.RevokeOtherSessions(user.ID, currentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": revoked})
+}
+
+// ListAPIKeysGin lists the current user's API keys
+func (h *AuthHandler) ListAPIKeysGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.authService.ListAPIKeys(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// CreateAPIKeyGin creates an API key for the current user. API keys cannot
+// create further keys: this requires a signed-in session.
+func (h *AuthHandler) CreateAPIKeyGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	key, err := h.authService.CreateAPIKey(user.ID, req)
+	if errors.Is(err, services.ErrInvalidAPIKeyRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// RevokeAPIKeyGin deletes one of the current user's API keys
+func (h *AuthHandler) RevokeAPIKeyGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	err = h.authService.RevokeAPIKey(user.ID, keyID)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// oidcErrorStatus maps identity provider sign-in errors to HTTP statuses
+func oidcErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOIDCProviderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOIDCInvalidState):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOIDCProviderFailed):
+		return http.StatusBadGateway
+	case errors.Is(err, services.ErrOIDCAccountExists), errors.Is(err, services.ErrOIDCIdentityLinked):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrOIDCAccountNotLinked), errors.Is(err, services.ErrOIDCLinkSession):
+		return http.StatusForbidden
+	case strings.HasPrefix(err.Error(), "account is"):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// ListOIDCProvidersGin lists the identity providers users can sign in with
+func (h *AuthHandler) ListOIDCProvidersGin(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.authService.OIDCProviders()})
+}
+
+// setOIDCStateCookie keeps the state of a sign-in in the browser
+// starting it, for as long as the sign-in is valid. SameSite=Lax lets the
+// provider's redirect back to the site carry it.
+func setOIDCStateCookie(c *gin.Context, state string) {
+	secure := strings.HasPrefix(middleware.RequestBaseURL(c.Request), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(services.OIDCLoginTTL/time.Second), "/", "", secure, true)
+}
+
+// OIDCLoginGin redirects to an identity provider to sign in
+func (h *AuthHandler) OIDCLoginGin(c *gin.Context) {
+	authURL, state, err := h.authService.BeginOIDCLogin(c.Request.Context(), c.Param("provider"), 0)
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	setOIDCStateCookie(c, state)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackGin completes a sign-in or link request with the code and
+// state the identity provider sent back
+func (h *AuthHandler) OIDCCallbackGin(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = providerError
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	// The callback must reach the browser that started the sign-in
+	browserState, err := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/", "", false, true)
+	if err != nil || subtle.ConstantTimeCompare([]byte(browserState), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrOIDCInvalidState.Error()})
+		return
+	}
+
+	result, err := h.authService.CompleteOIDCLogin(c.Request.Context(), c.Param("provider"), state, code,
+		h.sessionUserIDGin(c), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// LinkOIDCGin starts linking an identity provider account to the current
+// user and returns the provider URL to send them to
+func (h *AuthHandler) LinkOIDCGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	authURL, state, err := h.authService.BeginOIDCLogin(c.Request.Context(), c.Param("provider"), user.ID)
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	setOIDCStateCookie(c, state)
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// ListOIDCIdentitiesGin lists the identities linked to the current user
+func (h *AuthHandler) ListOIDCIdentitiesGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	identities, err := h.authService.ListOIDCIdentities(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkOIDCIdentityGin unlinks one of the current user's identities
+func (h *AuthHandler) UnlinkOIDCIdentityGin(c *gin.Context) {
+	user, _, ok := h.currentSessionGin(c)
+	if !ok {
+		return
+	}
+
+	identityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	err = h.authService.UnlinkOIDCIdentity(user.ID, identityID)
+	if errors.Is(err, services.ErrOIDCIdentityNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
+
 // Helper function to extract token from gin context
 func extractTokenFromGin(c *gin.Context) string {
 	authHeader := c.GetHeader("Authorization")
@@ -259,6 +606,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	userAgent := r.Header.Get("User-Agent")
 
 	result, err := h.authService.Login(req, ipAddress, userAgent)
+	if errors.Is(err, services.ErrAuthWebhookUnavailable) {
+		http.Error(w, services.ErrAuthWebhookUnavailable.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -426,7 +777,7 @@ func (h *AuthHandler) DeactivateSession(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err := h.getCurrentUser(r)
+	user, err := h.getCurrentUser(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -444,7 +795,11 @@ func (h *AuthHandler) DeactivateSession(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.authService.DeactivateSession(sessionID)
+	err = h.authService.RevokeSession(user.ID, sessionID)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -506,23 +861,13 @@ func extractToken(r *http.Request) string {
 	return parts[1]
 }
 
+// getClientIP returns the client address of a request. Forwarding headers
+// are not read here: middleware.ForwardedHeaders has already replaced
+// RemoteAddr with the client address reported by a trusted proxy.
 func getClientIP(r *http.Request) string {
-	ip := r.Header.Get("X-Real-IP")
-	if ip == "" {
-		ip = r.Header.Get("X-Forwarded-For")
-		if ip != "" {
-			parts := strings.Split(ip, ",")
-			ip = strings.TrimSpace(parts[0])
-		}
-	}
-	if ip == "" {
-		ip = r.RemoteAddr
-		if strings.Contains(ip, ":") {
-			parts := strings.Split(ip, ":")
-			if len(parts) > 0 {
-				ip = parts[0]
-			}
-		}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	return ip
+	return host
 }
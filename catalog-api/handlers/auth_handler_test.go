@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"catalogizer/repository"
 	"catalogizer/services"
 )
 
@@ -288,22 +292,25 @@ func (suite *AuthHandlerTestSuite) TestExtractTokenNoAuthHeader() {
 	assert.Equal(suite.T(), "", token)
 }
 
-func (suite *AuthHandlerTestSuite) TestGetClientIPWithXRealIP() {
+func (suite *AuthHandlerTestSuite) TestGetClientIPIgnoresForwardingHeaders() {
+	// Trusted forwarding headers are resolved by middleware.ForwardedHeaders
 	req, _ := http.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
 	req.Header.Set("X-Real-IP", "192.168.1.100")
+	req.Header.Set("X-Forwarded-For", "192.168.1.100, 10.0.0.1")
 
 	ip := getClientIP(req)
 
-	assert.Equal(suite.T(), "192.168.1.100", ip)
+	assert.Equal(suite.T(), "203.0.113.7", ip)
 }
 
-func (suite *AuthHandlerTestSuite) TestGetClientIPWithXForwardedFor() {
+func (suite *AuthHandlerTestSuite) TestGetClientIPFromIPv6RemoteAddr() {
 	req, _ := http.NewRequest("GET", "/test", nil)
-	req.Header.Set("X-Forwarded-For", "192.168.1.100, 10.0.0.1")
+	req.RemoteAddr = "[2001:db8::1]:12345"
 
 	ip := getClientIP(req)
 
-	assert.Equal(suite.T(), "192.168.1.100", ip)
+	assert.Equal(suite.T(), "2001:db8::1", ip)
 }
 
 func (suite *AuthHandlerTestSuite) TestGetClientIPFromRemoteAddr() {
@@ -512,3 +519,92 @@ func TestExtractTokenFromGin(t *testing.T) {
 func TestAuthHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthHandlerTestSuite))
 }
+
+func TestSessionsGin_MissingToken(t *testing.T) {
+	authService := services.NewAuthService(nil, "test-secret")
+	handler := NewAuthHandler(authService)
+
+	router := setupGinTestRouter()
+	router.GET("/sessions", handler.ListSessionsGin)
+	router.DELETE("/sessions", handler.RevokeOtherSessionsGin)
+	router.DELETE("/sessions/:id", handler.RevokeSessionGin)
+
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, "/sessions"},
+		{http.MethodDelete, "/sessions"},
+		{http.MethodDelete, "/sessions/3"},
+	} {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, r.method+" "+r.path)
+		assert.Contains(t, w.Body.String(), "Authorization token required")
+	}
+}
+
+func TestAuthHandler_OIDCStateCookie(t *testing.T) {
+	f := newAuthRouterFixture(t)
+	f.authService.SetOIDCIdentities(repository.NewOIDCIdentityRepository(f.db))
+	require.NoError(t, f.authService.AddOIDCProvider(services.OIDCProviderConfig{
+		Name: "github", ClientID: "client-id", RedirectURL: "https://catalogizer.example/auth/callback",
+	}))
+	handler := NewAuthHandler(f.authService)
+	f.router.GET("/auth/oidc/:provider/login", handler.OIDCLoginGin)
+	f.router.GET("/auth/oidc/:provider/callback", handler.OIDCCallbackGin)
+	f.router.POST("/auth/oidc/:provider/link", handler.LinkOIDCGin)
+
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		f.router.ServeHTTP(w, req)
+		return w
+	}
+	stateCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == oidcStateCookie {
+				return cookie
+			}
+		}
+		t.Fatal("no state cookie set")
+		return nil
+	}
+	callback := func(state string, cookie *http.Cookie, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/auth/oidc/github/callback?code=abc&state="+url.QueryEscape(state), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return send(req)
+	}
+
+	// Signing in keeps the state in the browser
+	w := send(httptest.NewRequest("GET", "/auth/oidc/github/login", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	state := location.Query().Get("state")
+	cookie := stateCookie(w)
+	assert.Equal(t, state, cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, int(services.OIDCLoginTTL/time.Second), cookie.MaxAge)
+
+	// A callback reaching another browser is refused
+	w = callback(state, nil, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = callback(state, &http.Cookie{Name: oidcStateCookie, Value: "someone-elses"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A link request is completed only by the user who started it
+	req := httptest.NewRequest("POST", "/auth/oidc/github/link", nil)
+	req.Header.Set("Authorization", "Bearer "+f.adminToken)
+	w = send(req)
+	require.Equal(t, http.StatusOK, w.Code)
+	cookie = stateCookie(w)
+	w = callback(cookie.Value, cookie, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), services.ErrOIDCLinkSession.Error())
+}
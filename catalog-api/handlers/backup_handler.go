@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backupService defines the database backup methods used by
+// BackupHandler.
+type backupService interface {
+	Status(ctx context.Context) (*services.BackupStatus, error)
+	Create(ctx context.Context, trigger string) (*services.DatabaseBackup, error)
+	Restore(ctx context.Context, name string) (*services.DatabaseRestore, error)
+}
+
+// BackupHandler lists, takes and restores backups of the catalog
+// database. Every endpoint requires system.admin.
+type BackupHandler struct {
+	backups     backupService
+	authService requestAuthService
+}
+
+// NewBackupHandler creates a new BackupHandler.
+func NewBackupHandler(backups backupService, authService requestAuthService) *BackupHandler {
+	return &BackupHandler{
+		backups:     backups,
+		authService: authService,
+	}
+}
+
+// backupErrorStatus maps service errors to HTTP status codes.
+func backupErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "already exists"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "invalid"), strings.Contains(err.Error(), "not supported"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ListBackups handles GET /api/v1/admin/backups.
+func (h *BackupHandler) ListBackups(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	status, err := h.backups.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(backupErrorStatus(err), gin.H{"success": false, "error": "Failed to list backups", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// CreateBackup handles POST /api/v1/admin/backups and returns once the
+// backup is written and uploaded.
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	backup, err := h.backups.Create(c.Request.Context(), services.BackupTriggerManual)
+	if err != nil {
+		c.JSON(backupErrorStatus(err), gin.H{"success": false, "error": "Failed to back up database", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": backup})
+}
+
+// RestoreBackup handles POST /api/v1/admin/backups/:name/restore. The
+// backup replaces the database when the server next starts.
+func (h *BackupHandler) RestoreBackup(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	restore, err := h.backups.Restore(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(backupErrorStatus(err), gin.H{"success": false, "error": "Failed to restore backup", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": restore})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackupService struct {
+	created int
+}
+
+func (f *fakeBackupService) Status(ctx context.Context) (*services.BackupStatus, error) {
+	return &services.BackupStatus{Retention: 7, Backups: []services.DatabaseBackup{{Name: "catalog-20261016-120000.db", Encrypted: true}}}, nil
+}
+
+func (f *fakeBackupService) Create(ctx context.Context, trigger string) (*services.DatabaseBackup, error) {
+	f.created++
+	if f.created > 1 {
+		return nil, fmt.Errorf("backup catalog-20261016-120000.db already exists")
+	}
+	return &services.DatabaseBackup{Name: "catalog-20261016-120000.db", Uploaded: true}, nil
+}
+
+func (f *fakeBackupService) Restore(ctx context.Context, name string) (*services.DatabaseRestore, error) {
+	switch name {
+	case "catalog-20261016-120000.db":
+		return &services.DatabaseRestore{Backup: name, RestartRequired: true}, nil
+	case "bad":
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+	return nil, fmt.Errorf("backup %s not found", name)
+}
+
+func backupRequest(auth requestAuthService, svc *fakeBackupService, method, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewBackupHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/backups", h.ListBackups)
+	r.POST("/admin/backups", h.CreateBackup)
+	r.POST("/admin/backups/:name/restore", h.RestoreBackup)
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBackupHandler(t *testing.T) {
+	svc := &fakeBackupService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, backupRequest(viewer, svc, http.MethodGet, "/admin/backups").Code)
+	assert.Equal(t, http.StatusForbidden, backupRequest(viewer, svc, http.MethodPost, "/admin/backups/catalog-20261016-120000.db/restore").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := backupRequest(admin, svc, http.MethodGet, "/admin/backups")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"catalog-20261016-120000.db"`)
+
+	w = backupRequest(admin, svc, http.MethodPost, "/admin/backups")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"uploaded":true`)
+	assert.Equal(t, http.StatusConflict, backupRequest(admin, svc, http.MethodPost, "/admin/backups").Code)
+
+	w = backupRequest(admin, svc, http.MethodPost, "/admin/backups/catalog-20261016-120000.db/restore")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"restart_required":true`)
+	assert.Equal(t, http.StatusBadRequest, backupRequest(admin, svc, http.MethodPost, "/admin/backups/bad/restore").Code)
+	assert.Equal(t, http.StatusNotFound, backupRequest(admin, svc, http.MethodPost, "/admin/backups/missing.db/restore").Code)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// conversionProber defines the conversion methods used by
+// CapabilitiesHandler.
+type conversionProber interface {
+	ProbeTools() []models.ConversionTool
+	AvailableFormats() *models.SupportedFormats
+}
+
+// APIVersion describes one version of the REST API.
+type APIVersion struct {
+	Version string `json:"version"`
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+}
+
+// RateLimitTier describes a rate limit applied to a group of endpoints.
+type RateLimitTier struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	Window   string `json:"window"`
+	Applies  string `json:"applies_to"`
+}
+
+// CapabilityLimits are the limits clients should respect. A zero size
+// means unlimited.
+type CapabilityLimits struct {
+	MaxUploadSize  int64           `json:"max_upload_size"`
+	MaxArchiveSize int64           `json:"max_archive_size"`
+	MaxPageSize    int             `json:"max_page_size"`
+	RateLimits     []RateLimitTier `json:"rate_limits"`
+}
+
+// CapabilityFeature reports whether an optional feature is enabled.
+type CapabilityFeature struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// CapabilitiesConfig holds the static parts of the capabilities document.
+type CapabilitiesConfig struct {
+	Version          string
+	BuildNumber      string
+	APIVersions      []APIVersion
+	StorageProtocols []string
+	SyncProtocols    []string
+	Limits           CapabilityLimits
+}
+
+// CapabilitiesHandler serves a machine-readable description of what this
+// server supports, so clients can adapt their UI instead of probing
+// endpoints. Conversion formats and feature checks are evaluated on each
+// request, so installing a tool or enabling a feature shows up without a
+// restart.
+type CapabilitiesHandler struct {
+	config      CapabilitiesConfig
+	conversions conversionProber
+
+	mu       sync.RWMutex
+	features map[string]func(ctx context.Context) (bool, string)
+}
+
+// NewCapabilitiesHandler creates a new CapabilitiesHandler.
+func NewCapabilitiesHandler(config CapabilitiesConfig, conversions conversionProber) *CapabilitiesHandler {
+	return &CapabilitiesHandler{
+		config:      config,
+		conversions: conversions,
+		features:    make(map[string]func(ctx context.Context) (bool, string)),
+	}
+}
+
+// SetFeature records whether a feature is enabled.
+func (h *CapabilitiesHandler) SetFeature(name string, enabled bool) {
+	h.SetFeatureCheck(name, func(context.Context) (bool, string) { return enabled, "" })
+}
+
+// SetFeatureCheck registers a check evaluated on each request, returning
+// whether the feature is enabled and an optional detail.
+func (h *CapabilitiesHandler) SetFeatureCheck(name string, check func(ctx context.Context) (bool, string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.features[name] = check
+}
+
+// GetCapabilities handles GET /api/v1/capabilities.
+func (h *CapabilitiesHandler) GetCapabilities(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	h.mu.RLock()
+	features := make([]CapabilityFeature, 0, len(h.features))
+	for name, check := range h.features {
+		enabled, detail := check(ctx)
+		features = append(features, CapabilityFeature{Name: name, Enabled: enabled, Detail: detail})
+	}
+	h.mu.RUnlock()
+	sort.Slice(features, func(i, j int) bool { return features[i].Name < features[j].Name })
+
+	conversions := gin.H{"tools": []models.ConversionTool{}, "formats": nil}
+	if h.conversions != nil {
+		conversions = gin.H{
+			"tools":   h.conversions.ProbeTools(),
+			"formats": h.conversions.AvailableFormats(),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"server": gin.H{
+			"version":      h.config.Version,
+			"build_number": h.config.BuildNumber,
+		},
+		"api_versions": h.config.APIVersions,
+		"features":     features,
+		"protocols": gin.H{
+			"storage": h.config.StorageProtocols,
+			"sync":    h.config.SyncProtocols,
+		},
+		"conversion":   conversions,
+		"limits":       h.config.Limits,
+		"generated_at": time.Now().UTC(),
+	}})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// catalogDiffService defines the catalog diff methods used by
+// CatalogChangesHandler.
+type catalogDiffService interface {
+	Compare(ctx context.Context, req services.CatalogDiffRequest) (*services.CatalogDiff, error)
+}
+
+// CatalogChangesHandler reports what changed in the catalog between two
+// scans or dates. It requires media.view.
+type CatalogChangesHandler struct {
+	diff        catalogDiffService
+	authService requestAuthService
+}
+
+// NewCatalogChangesHandler creates a new CatalogChangesHandler.
+func NewCatalogChangesHandler(diff catalogDiffService, authService requestAuthService) *CatalogChangesHandler {
+	return &CatalogChangesHandler{
+		diff:        diff,
+		authService: authService,
+	}
+}
+
+// catalogChangesErrorStatus maps service errors to HTTP status codes.
+func catalogChangesErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GetChanges handles GET /api/v1/catalog-changes. Query parameters: from
+// and to, RFC 3339 or YYYY-MM-DD (a bare to includes that whole day), or
+// from_scan and to_scan, scan job IDs; to defaults to now. storage_root
+// narrows the diff to one root, include_directories=true lists
+// directories too and limit (default 200, max 1000) caps each list.
+func (h *CatalogChangesHandler) GetChanges(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+
+	req := services.CatalogDiffRequest{
+		StorageRoot:        c.Query("storage_root"),
+		IncludeDirectories: c.Query("include_directories") == "true",
+	}
+	for param, dest := range map[string]*int64{"from_scan": &req.FromScan, "to_scan": &req.ToScan} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + param})
+				return
+			}
+			*dest = id
+		}
+	}
+	for param, dest := range map[string]**time.Time{"from": &req.From, "to": &req.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			day, dayErr := time.Parse("2006-01-02", value)
+			if dayErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + param, "details": err.Error()})
+				return
+			}
+			t = day
+			if param == "to" {
+				t = day.Add(24 * time.Hour)
+			}
+		}
+		*dest = &t
+	}
+	req.Limit, _ = strconv.Atoi(c.Query("limit"))
+
+	diff, err := h.diff.Compare(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(catalogChangesErrorStatus(err), gin.H{"success": false, "error": "Failed to compare catalog", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": diff})
+}
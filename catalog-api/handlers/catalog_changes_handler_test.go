@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCatalogDiffService struct {
+	req services.CatalogDiffRequest
+}
+
+func (f *fakeCatalogDiffService) Compare(ctx context.Context, req services.CatalogDiffRequest) (*services.CatalogDiff, error) {
+	f.req = req
+	if req.FromScan == 99 {
+		return nil, fmt.Errorf("scan 99 not found")
+	}
+	if req.From == nil && req.FromScan == 0 {
+		return nil, fmt.Errorf("invalid comparison: from or from_scan is required")
+	}
+	return &services.CatalogDiff{Summary: services.CatalogDiffSummary{Added: 2}}, nil
+}
+
+func catalogChangesRequest(auth requestAuthService, svc *fakeCatalogDiffService, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/catalog-changes", NewCatalogChangesHandler(svc, auth).GetChanges)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCatalogChangesHandler_GetChanges(t *testing.T) {
+	svc := &fakeCatalogDiffService{}
+	assert.Equal(t, http.StatusForbidden,
+		catalogChangesRequest(&permissionAuth{granted: map[string]bool{}}, svc, "/catalog-changes?from=2026-03-01").Code)
+
+	auth := &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}}
+	w := catalogChangesRequest(auth, svc, "/catalog-changes?from=2026-03-01&to=2026-03-07&storage_root=nas&include_directories=true&limit=50")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"added":2`)
+	require.NotNil(t, svc.req.From)
+	require.NotNil(t, svc.req.To)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), *svc.req.From)
+	// A bare to date covers the whole day
+	assert.Equal(t, time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), *svc.req.To)
+	assert.Equal(t, "nas", svc.req.StorageRoot)
+	assert.True(t, svc.req.IncludeDirectories)
+	assert.Equal(t, 50, svc.req.Limit)
+
+	require.Equal(t, http.StatusOK, catalogChangesRequest(auth, svc, "/catalog-changes?from_scan=3&to_scan=7").Code)
+	assert.Equal(t, int64(3), svc.req.FromScan)
+	assert.Equal(t, int64(7), svc.req.ToScan)
+	assert.Nil(t, svc.req.From)
+
+	assert.Equal(t, http.StatusBadRequest, catalogChangesRequest(auth, svc, "/catalog-changes").Code)
+	assert.Equal(t, http.StatusBadRequest, catalogChangesRequest(auth, svc, "/catalog-changes?from=yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, catalogChangesRequest(auth, svc, "/catalog-changes?from_scan=x").Code)
+	assert.Equal(t, http.StatusNotFound, catalogChangesRequest(auth, svc, "/catalog-changes?from_scan=99").Code)
+}
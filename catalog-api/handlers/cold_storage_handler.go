@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coldStorageService defines the cold tier and recall methods used by ColdStorageHandler.
+type coldStorageService interface {
+	RequestRecall(ctx context.Context, fileID int64, userID *int) (*services.RecallJob, error)
+	GetRecall(ctx context.Context, id int64) (*services.RecallJob, error)
+	ListRecalls(ctx context.Context, userID *int) ([]services.RecallJob, error)
+	SetTier(ctx context.Context, tier services.ColdStorageTier) error
+	GetTier(ctx context.Context, storageRoot string) (*services.ColdStorageTier, error)
+	ListTiers(ctx context.Context) ([]services.ColdStorageTier, error)
+	DeleteTier(ctx context.Context, storageRoot string) error
+}
+
+// ColdStorageHandler exposes recall jobs for files on cold storage tiers and
+// the administration of those tiers.
+type ColdStorageHandler struct {
+	coldStorage coldStorageService
+	authService requestAuthService
+}
+
+// NewColdStorageHandler creates a new ColdStorageHandler.
+func NewColdStorageHandler(coldStorage coldStorageService, authService requestAuthService) *ColdStorageHandler {
+	return &ColdStorageHandler{
+		coldStorage: coldStorage,
+		authService: authService,
+	}
+}
+
+// RequestRecall handles POST /api/v1/media/:id/recall.
+func (h *ColdStorageHandler) RequestRecall(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDownload)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid media ID"})
+		return
+	}
+
+	job, err := h.coldStorage.RequestRecall(c.Request.Context(), fileID, &currentUser.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrNotColdStorage):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "failed to request recall"):
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to request recall", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": job})
+}
+
+// ListRecalls handles GET /api/v1/recalls. Administrators may pass
+// all=true to see the recalls of every user.
+func (h *ColdStorageHandler) ListRecalls(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+
+	userID := &currentUser.ID
+	if c.Query("all") == "true" && h.isAdmin(currentUser) {
+		userID = nil
+	}
+
+	jobs, err := h.coldStorage.ListRecalls(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list recalls", "details": err.Error()})
+		return
+	}
+	if jobs == nil {
+		jobs = []services.RecallJob{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": jobs})
+}
+
+// GetRecall handles GET /api/v1/recalls/:id.
+func (h *ColdStorageHandler) GetRecall(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid recall ID"})
+		return
+	}
+
+	job, err := h.coldStorage.GetRecall(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to load recall", "details": err.Error()})
+		return
+	}
+	if (job.RequestedBy == nil || *job.RequestedBy != currentUser.ID) && !h.isAdmin(currentUser) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Failed to load recall", "details": "recall job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
+
+func (h *ColdStorageHandler) isAdmin(user *models.User) bool {
+	allowed, err := checkPermission(h.authService, user, models.PermissionSystemAdmin)
+	return err == nil && allowed
+}
+
+// ListTiers handles GET /api/v1/admin/cold-tiers.
+func (h *ColdStorageHandler) ListTiers(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	tiers, err := h.coldStorage.ListTiers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list cold storage tiers", "details": err.Error()})
+		return
+	}
+	if tiers == nil {
+		tiers = []services.ColdStorageTier{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": tiers})
+}
+
+// GetTier handles GET /api/v1/admin/cold-tiers/:root.
+func (h *ColdStorageHandler) GetTier(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	tier, err := h.coldStorage.GetTier(c.Request.Context(), c.Param("root"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load cold storage tier", "details": err.Error()})
+		return
+	}
+	if tier == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Storage root is not a cold storage tier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": tier})
+}
+
+// SetTier handles PUT /api/v1/admin/cold-tiers/:root.
+func (h *ColdStorageHandler) SetTier(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req struct {
+		Backend        string          `json:"backend" binding:"required"`
+		Config         json.RawMessage `json:"config"`
+		RetentionHours int             `json:"retention_hours"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	tier := services.ColdStorageTier{
+		StorageRoot:    c.Param("root"),
+		Backend:        req.Backend,
+		Config:         req.Config,
+		RetentionHours: req.RetentionHours,
+	}
+	if err := h.coldStorage.SetTier(c.Request.Context(), tier); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid tier") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to save cold storage tier", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": tier})
+}
+
+// DeleteTier handles DELETE /api/v1/admin/cold-tiers/:root.
+func (h *ColdStorageHandler) DeleteTier(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	if err := h.coldStorage.DeleteTier(c.Request.Context(), c.Param("root")); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to delete cold storage tier", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
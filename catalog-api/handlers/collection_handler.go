@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"catalogizer/internal/media/models"
 	"catalogizer/repository"
@@ -70,6 +71,44 @@ func (h *CollectionHandler) GetCollection(c *gin.Context) {
 	c.JSON(http.StatusOK, coll)
 }
 
+// GetCollectionItems handles GET /api/v1/collections/:id/items, listing
+// the media item IDs in a collection.
+func (h *CollectionHandler) GetCollectionItems(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid collection ID", err)
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	ids, total, err := h.repo.ListItemIDs(ctx, id, limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Collection not found", err)
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to list collection items", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media_item_ids": ids,
+		"total":          total,
+		"limit":          limit,
+		"offset":         offset,
+	})
+}
+
 // CreateCollection handles POST /api/v1/collections.
 func (h *CollectionHandler) CreateCollection(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -101,6 +140,7 @@ func (h *CollectionHandler) CreateCollection(c *gin.Context) {
 		ExternalIDs:    req.ExternalIDs,
 		CoverURL:       req.CoverURL,
 		TotalItems:     0,
+		UserID:         collectionOwner(c),
 	}
 	// is_public and is_smart are not stored in current schema; ignore for now
 
@@ -114,6 +154,28 @@ func (h *CollectionHandler) CreateCollection(c *gin.Context) {
 	c.JSON(http.StatusCreated, coll)
 }
 
+// collectionOwner returns the ID of the signed-in user, which the auth
+// middleware stores as a string or an int, or nil when there is none.
+func collectionOwner(c *gin.Context) *int64 {
+	value, _ := c.Get("user_id")
+	var id int64
+	switch uid := value.(type) {
+	case int:
+		id = int64(uid)
+	case int64:
+		id = uid
+	case string:
+		parsed, err := strconv.ParseInt(uid, 10, 64)
+		if err != nil {
+			return nil
+		}
+		id = parsed
+	default:
+		return nil
+	}
+	return &id
+}
+
 // UpdateCollection handles PUT /api/v1/collections/:id.
 func (h *CollectionHandler) UpdateCollection(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -182,6 +244,10 @@ func (h *CollectionHandler) DeleteCollection(c *gin.Context) {
 	}
 
 	if err := h.repo.Delete(ctx, id); err != nil {
+		if err.Error() == "media collection not found" {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Collection not found", err)
+			return
+		}
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete collection", err)
 		return
 	}
@@ -203,6 +269,7 @@ func collectionsToJSON(collections []*models.MediaCollection) []gin.H {
 			"total_items":     coll.TotalItems,
 			"external_ids":    coll.ExternalIDs,
 			"cover_url":       coll.CoverURL,
+			"user_id":         coll.UserID,
 			"created_at":      coll.CreatedAt,
 			"updated_at":      coll.UpdatedAt,
 		})
@@ -30,6 +30,7 @@ func (suite *CollectionHandlerTestSuite) SetupTest() {
 	suite.router = gin.New()
 	suite.router.GET("/api/v1/collections", suite.handler.ListCollections)
 	suite.router.GET("/api/v1/collections/:id", suite.handler.GetCollection)
+	suite.router.GET("/api/v1/collections/:id/items", suite.handler.GetCollectionItems)
 	suite.router.POST("/api/v1/collections", suite.handler.CreateCollection)
 	suite.router.PUT("/api/v1/collections/:id", suite.handler.UpdateCollection)
 	suite.router.DELETE("/api/v1/collections/:id", suite.handler.DeleteCollection)
@@ -90,6 +91,15 @@ func (suite *CollectionHandlerTestSuite) TestGetCollection_OverflowID() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 }
 
+func (suite *CollectionHandlerTestSuite) TestGetCollectionItems_InvalidID() {
+	req := httptest.NewRequest("GET", "/api/v1/collections/abc/items", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Invalid collection ID")
+}
+
 // --- CreateCollection validation tests ---
 
 func (suite *CollectionHandlerTestSuite) TestCreateCollection_InvalidJSON() {
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"catalogizer/internal/services"
 	"catalogizer/models"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/mux"
 )
 
@@ -20,6 +23,8 @@ type ConfigurationServiceInterface interface {
 	GetConfiguration() (*models.Configuration, error)
 	TestConfiguration(config *models.Configuration) (*models.ValidationResult, error)
 	GetConfigurationSchema() (*models.ConfigurationSchema, error)
+	GetCORSConfiguration() (*models.CORSConfig, error)
+	UpdateCORSConfiguration(cors *models.CORSConfig) (*models.CORSConfig, error)
 }
 
 // AuthServiceInterface defines the interface for authentication service operations
@@ -31,12 +36,14 @@ type AuthServiceInterface interface {
 // ConfigurationAuthServiceInterface defines the interface for authentication service operations
 type ConfigurationAuthServiceInterface interface {
 	ValidateToken(tokenString string) (*models.User, error)
+	GetCurrentUser(token string) (*models.User, error)
 	CheckPermission(userID int, permission string) (bool, error)
 }
 
 type ConfigurationHandler struct {
 	configurationService ConfigurationServiceInterface
 	authService          ConfigurationAuthServiceInterface
+	audit                auditRecorder
 }
 
 func NewConfigurationHandler(configurationService ConfigurationServiceInterface, authService ConfigurationAuthServiceInterface) *ConfigurationHandler {
@@ -46,6 +53,11 @@ func NewConfigurationHandler(configurationService ConfigurationServiceInterface,
 	}
 }
 
+// SetAuditLog records CORS configuration changes in the audit log.
+func (h *ConfigurationHandler) SetAuditLog(audit auditRecorder) {
+	h.audit = audit
+}
+
 // Wizard endpoints
 
 func (h *ConfigurationHandler) GetWizardStep(w http.ResponseWriter, r *http.Request) {
@@ -188,6 +200,49 @@ func (h *ConfigurationHandler) TestConfiguration(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(result)
 }
 
+// GetCORSConfiguration returns the CORS policies of network.cors
+func (h *ConfigurationHandler) GetCORSConfiguration(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	cors, err := h.configurationService.GetCORSConfiguration()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to get CORS configuration", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cors)
+}
+
+// UpdateCORSConfiguration replaces the CORS policies of network.cors. The
+// running server applies them immediately
+func (h *ConfigurationHandler) UpdateCORSConfiguration(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var cors models.CORSConfig
+	if err := c.ShouldBindJSON(&cors); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	updated, err := h.configurationService.UpdateCORSConfiguration(&cors)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "validation failed") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to update CORS configuration", "details": err.Error()})
+		return
+	}
+	recordAudit(c.Request, h.audit, currentUser.ID, services.AuditEventConfigChanged, map[string]interface{}{"section": "cors"})
+
+	c.JSON(http.StatusOK, updated)
+}
+
 func (h *ConfigurationHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int)
 	vars := mux.Vars(r)
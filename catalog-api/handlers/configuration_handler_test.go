@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http/httptest"
 	"testing"
 
 	"catalogizer/models"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -80,6 +82,22 @@ func (m *MockConfigurationService) GetConfiguration() (*models.Configuration, er
 	return args.Get(0).(*models.Configuration), args.Error(1)
 }
 
+func (m *MockConfigurationService) GetCORSConfiguration() (*models.CORSConfig, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CORSConfig), args.Error(1)
+}
+
+func (m *MockConfigurationService) UpdateCORSConfiguration(cors *models.CORSConfig) (*models.CORSConfig, error) {
+	args := m.Called(cors)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CORSConfig), args.Error(1)
+}
+
 // MockAuthService for testing
 type MockAuthService struct {
 	mock.Mock
@@ -93,6 +111,14 @@ func (m *MockAuthService) ValidateToken(tokenString string) (*models.User, error
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockAuthService) GetCurrentUser(token string) (*models.User, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *MockAuthService) CheckPermission(userID int, permission string) (bool, error) {
 	args := m.Called(userID, permission)
 	return args.Bool(0), args.Error(1)
@@ -625,6 +651,66 @@ func TestConfigurationHandler_TestConfiguration(t *testing.T) {
 	}
 }
 
+func TestConfigurationHandler_UpdateCORSConfiguration(t *testing.T) {
+	cors := &models.CORSConfig{
+		AllowedOrigins: []string{"https://media.example.com"},
+		Policies: []models.CORSPolicy{{
+			Name:           "public-shares",
+			PathPrefixes:   []string{"/api/v1/shared"},
+			AllowedOrigins: []string{"*"},
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		hasPermission  bool
+		serviceError   error
+		expectedStatus int
+	}{
+		{"Success", true, nil, 200},
+		{"Permission denied", false, nil, 403},
+		{"Invalid policies", true, errors.New("configuration validation failed: cors: the default policy cannot allow any origin"), 400},
+		{"Service error", true, assert.AnError, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfigService := new(MockConfigurationService)
+			mockAuthService := new(MockAuthService)
+			handler := NewConfigurationHandler(mockConfigService, mockAuthService)
+
+			mockAuthService.On("GetCurrentUser", "valid-token").Return(&models.User{ID: 1}, nil)
+			mockAuthService.On("CheckPermission", 1, models.PermissionSystemAdmin).Return(tt.hasPermission, nil)
+			if tt.hasPermission {
+				if tt.serviceError != nil {
+					mockConfigService.On("UpdateCORSConfiguration", cors).Return(nil, tt.serviceError)
+				} else {
+					mockConfigService.On("UpdateCORSConfiguration", cors).Return(cors, nil)
+				}
+			}
+
+			body, _ := json.Marshal(cors)
+			req := httptest.NewRequest("PUT", "/configuration/cors", bytes.NewBuffer(body))
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rr := httptest.NewRecorder()
+			router := gin.New()
+			router.PUT("/configuration/cors", handler.UpdateCORSConfiguration)
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == 200 {
+				var result models.CORSConfig
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+				assert.Equal(t, *cors, result)
+			}
+
+			mockAuthService.AssertExpectations(t)
+			mockConfigService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestConfigurationHandler_NewConfigurationHandler(t *testing.T) {
 	mockConfigService := &MockConfigurationService{}
 	mockAuthService := &MockAuthService{}
@@ -635,3 +721,32 @@ func TestConfigurationHandler_NewConfigurationHandler(t *testing.T) {
 	assert.Equal(t, mockConfigService, handler.configurationService)
 	assert.Equal(t, mockAuthService, handler.authService)
 }
+
+func TestConfigurationHandler_CORSRoutes(t *testing.T) {
+	f := newAuthRouterFixture(t)
+	configService := new(MockConfigurationService)
+	handler := NewConfigurationHandler(configService, &AuthServiceAdapter{Inner: f.authService})
+	f.api.GET("/configuration/cors", handler.GetCORSConfiguration)
+	f.api.PUT("/configuration/cors", handler.UpdateCORSConfiguration)
+
+	cors := &models.CORSConfig{AllowedOrigins: []string{"https://media.example.com"}}
+	configService.On("GetCORSConfiguration").Return(cors, nil)
+	configService.On("UpdateCORSConfiguration", cors).Return(cors, nil)
+	body, _ := json.Marshal(cors)
+
+	w := f.do("GET", "/api/v1/configuration/cors", nil, f.adminToken)
+	assert.Equal(t, 200, w.Code)
+	w = f.do("PUT", "/api/v1/configuration/cors", bytes.NewReader(body), f.adminToken)
+	assert.Equal(t, 200, w.Code)
+
+	// A key scoped to reading the configuration cannot change it
+	key := f.apiKey(t, models.PermissionSystemConfig)
+	w = f.do("GET", "/api/v1/configuration/cors", nil, key)
+	assert.Equal(t, 200, w.Code)
+	w = f.do("PUT", "/api/v1/configuration/cors", bytes.NewReader(body), key)
+	assert.Equal(t, 403, w.Code)
+
+	w = f.do("GET", "/api/v1/configuration/cors", nil, "")
+	assert.Equal(t, 401, w.Code)
+	configService.AssertNumberOfCalls(t, "UpdateCORSConfiguration", 1)
+}
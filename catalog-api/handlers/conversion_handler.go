@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"catalogizer/models"
 	"github.com/gin-gonic/gin"
@@ -13,9 +14,9 @@ import (
 // ConversionServiceInterface defines the interface for conversion service operations
 type ConversionServiceInterface interface {
 	CreateConversionJob(userID int, request *models.ConversionRequest) (*models.ConversionJob, error)
-	GetJob(jobID int, userID int) (*models.ConversionJob, error)
+	GetJob(jobID int, user *models.User) (*models.ConversionJob, error)
 	GetUserJobs(userID int, status *string, limit, offset int) ([]models.ConversionJob, error)
-	CancelJob(jobID int, userID int) error
+	CancelJob(jobID int, user *models.User) error
 	GetSupportedFormats() *models.SupportedFormats
 }
 
@@ -44,7 +45,7 @@ func (h *ConversionHandler) CreateJob(c *gin.Context) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionConversionCreate)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionConversionCreate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 		return
@@ -62,6 +63,11 @@ func (h *ConversionHandler) CreateJob(c *gin.Context) {
 	}
 
 	job, err := h.conversionService.CreateConversionJob(currentUser.ID, &request)
+	if err != nil && strings.Contains(err.Error(), "is unavailable") {
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Conversion temporarily unavailable", "reason": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversion job"})
 		return
@@ -84,12 +90,16 @@ func (h *ConversionHandler) GetJob(c *gin.Context) {
 		return
 	}
 
-	job, err := h.conversionService.GetJob(jobID, currentUser.ID)
+	job, err := h.conversionService.GetJob(jobID, currentUser)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
 			return
 		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
 		return
 	}
@@ -97,6 +107,38 @@ func (h *ConversionHandler) GetJob(c *gin.Context) {
 	c.JSON(http.StatusOK, job)
 }
 
+// GetJobProgress returns a job's progress percentage, transfer rate and
+// ETA, the figures also pushed as conversion_progress events
+func (h *ConversionHandler) GetJobProgress(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	jobID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.conversionService.GetJob(jobID, currentUser)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewConversionProgress(job, time.Now()))
+}
+
 func (h *ConversionHandler) ListJobs(c *gin.Context) {
 	currentUser, err := h.getCurrentUser(c)
 	if err != nil {
@@ -104,7 +146,7 @@ func (h *ConversionHandler) ListJobs(c *gin.Context) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionConversionView)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionConversionView)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 		return
@@ -147,7 +189,7 @@ func (h *ConversionHandler) CancelJob(c *gin.Context) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionConversionManage)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionConversionManage)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 		return
@@ -165,7 +207,11 @@ func (h *ConversionHandler) CancelJob(c *gin.Context) {
 		return
 	}
 
-	err = h.conversionService.CancelJob(jobID, currentUser.ID)
+	err = h.conversionService.CancelJob(jobID, currentUser)
+	if err != nil && strings.Contains(err.Error(), "unauthorized") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
 		return
@@ -181,7 +227,7 @@ func (h *ConversionHandler) GetSupportedFormats(c *gin.Context) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionConversionView)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionConversionView)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 		return
@@ -198,16 +244,11 @@ func (h *ConversionHandler) GetSupportedFormats(c *gin.Context) {
 }
 
 func (h *ConversionHandler) getCurrentUser(c *gin.Context) (*models.User, error) {
-	token := c.GetHeader("Authorization")
+	token := requestCredential(c.Request.Header)
 	if token == "" {
 		return nil, models.ErrUnauthorized
 	}
 
-	// Remove "Bearer " prefix if present
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	}
-
 	// Use auth service to get current user from token
 	user, err := h.authService.GetCurrentUser(token)
 	if err != nil {
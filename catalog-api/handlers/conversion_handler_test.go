@@ -3,14 +3,19 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"catalogizer/models"
+	"catalogizer/repository"
+	"catalogizer/services"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockConversionService for testing
@@ -26,8 +31,8 @@ func (m *MockConversionService) CreateConversionJob(userID int, request *models.
 	return args.Get(0).(*models.ConversionJob), args.Error(1)
 }
 
-func (m *MockConversionService) GetJob(jobID int, userID int) (*models.ConversionJob, error) {
-	args := m.Called(jobID, userID)
+func (m *MockConversionService) GetJob(jobID int, user *models.User) (*models.ConversionJob, error) {
+	args := m.Called(jobID, user.ID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -42,8 +47,8 @@ func (m *MockConversionService) GetUserJobs(userID int, status *string, limit, o
 	return args.Get(0).([]models.ConversionJob), args.Error(1)
 }
 
-func (m *MockConversionService) CancelJob(jobID int, userID int) error {
-	args := m.Called(jobID, userID)
+func (m *MockConversionService) CancelJob(jobID int, user *models.User) error {
+	args := m.Called(jobID, user.ID)
 	return args.Error(0)
 }
 
@@ -219,6 +224,43 @@ func TestGetJob(t *testing.T) {
 	}
 }
 
+func TestGetJobProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	startedAt := time.Now().Add(-time.Minute)
+	mockConversionService := &MockConversionService{}
+	mockAuthService := &MockConversionAuthService{}
+	mockAuthService.On("GetCurrentUser", "test-token").Return(&models.User{ID: 1}, nil)
+	mockConversionService.On("GetJob", 123, 1).Return(&models.ConversionJob{
+		ID:           123,
+		Status:       models.ConversionStatusRunning,
+		Progress:     0.5,
+		TransferRate: 2048,
+		StartedAt:    &startedAt,
+	}, nil)
+
+	handler := NewConversionHandler(mockConversionService, mockAuthService)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/conversion/jobs/123/progress", nil)
+	c.Request.Header.Set("Authorization", "Bearer test-token")
+	c.Params = gin.Params{{Key: "id", Value: "123"}}
+
+	handler.GetJobProgress(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var progress models.ConversionProgress
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &progress))
+	assert.Equal(t, 123, progress.JobID)
+	assert.Equal(t, 50.0, progress.Percent)
+	assert.Equal(t, 2048.0, progress.TransferRate)
+	if assert.NotNil(t, progress.ETASeconds) {
+		assert.InDelta(t, 60.0, *progress.ETASeconds, 5)
+	}
+	mockConversionService.AssertExpectations(t)
+}
+
 func TestListJobs(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -442,3 +484,39 @@ func TestConversionHandler_GetCurrentUser_WithToken(t *testing.T) {
 	assert.Equal(t, 1, user.ID)
 	mockAuthService.AssertExpectations(t)
 }
+
+func TestConversionHandler_APIKeyScopes(t *testing.T) {
+	f := newAuthRouterFixture(t)
+	userRepo := repository.NewUserRepository(f.db)
+	conversionRepo := repository.NewConversionRepository(f.db)
+	handler := NewConversionHandler(services.NewConversionService(conversionRepo, userRepo, f.authService), f.authService)
+	f.api.GET("/conversion/jobs/:id", handler.GetJob)
+	f.api.GET("/conversion/jobs/:id/progress", handler.GetJobProgress)
+	f.api.POST("/conversion/jobs/:id/cancel", handler.CancelJob)
+
+	// Another user's job, which the admin may view and cancel
+	bobID, err := userRepo.Create(&models.User{Username: "bob", Email: "bob@example.com", RoleID: 1, IsActive: true})
+	require.NoError(t, err)
+	jobID, err := conversionRepo.CreateJob(&models.ConversionJob{
+		UserID: bobID, SourcePath: "/media/in.avi", TargetPath: "/media/out.mp4", SourceFormat: "avi", TargetFormat: "mp4",
+		ConversionType: models.ConversionTypeVideo, Quality: "medium", Status: models.ConversionStatusPending, CreatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+	path := fmt.Sprintf("/api/v1/conversion/jobs/%d", jobID)
+
+	w := f.do("GET", path, nil, f.adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A key scoped to the admin's own conversions reaches no one else's
+	key := f.apiKey(t, models.PermissionConversionView, models.PermissionConversionManage)
+	w = f.do("GET", path, nil, key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = f.do("GET", path+"/progress", nil, key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = f.do("POST", path+"/cancel", nil, key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	job, err := conversionRepo.GetJob(jobID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConversionStatusPending, job.Status)
+}
@@ -403,6 +403,10 @@ func (m *mockUserService) Count() (int, error) {
 	return 0, nil
 }
 
+func (m *mockUserService) DeactivateAllUserSessions(userID int) error {
+	return nil
+}
+
 // mockUserAuthService implements UserAuthServiceInterface for testing
 type mockUserAuthService struct {
 	checkPermissionFunc    func(userID int, permission string) (bool, error)
@@ -414,6 +418,7 @@ type mockUserAuthService struct {
 	lockAccountFunc        func(userID int, lockUntil time.Time) error
 	unlockAccountFunc      func(userID int) error
 	hashDataFunc           func(data string) string
+	forgotten              []string
 }
 
 func (m *mockUserAuthService) CheckPermission(userID int, permission string) (bool, error) {
@@ -479,6 +484,10 @@ func (m *mockUserAuthService) HashData(data string) string {
 	return "hashed_data"
 }
 
+func (m *mockUserAuthService) ForgetExternalLogins(username string) {
+	m.forgotten = append(m.forgotten, username)
+}
+
 func newUserHandler() (*UserHandler, *mockUserService, *mockUserAuthService) {
 	userSvc := &mockUserService{}
 	authSvc := &mockUserAuthService{}
@@ -528,12 +537,25 @@ func TestUserHandler_DeleteUser_InvalidID(t *testing.T) {
 }
 
 func TestUserHandler_DeleteUser_Success(t *testing.T) {
-	h, _, _ := newUserHandler()
+	h, _, authSvc := newUserHandler()
 	req := httptest.NewRequest("DELETE", "/api/users/2", nil)
 	req.Header.Set("Authorization", "Bearer valid-token")
 	w := httptest.NewRecorder()
 	h.DeleteUser(w, req)
 	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"testuser"}, authSvc.forgotten, "webhook logins of the deleted user are forgotten")
+}
+
+func TestUserHandler_DeleteUser_NotFound(t *testing.T) {
+	h, userSvc, _ := newUserHandler()
+	userSvc.deleteFunc = func(id int) error {
+		return errors.New("user not found")
+	}
+	req := httptest.NewRequest("DELETE", "/api/users/2", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	w := httptest.NewRecorder()
+	h.DeleteUser(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestUserHandler_DeleteUser_SelfDelete(t *testing.T) {
@@ -1820,6 +1820,12 @@ func (m *mockConfigServiceImpl) GetConfigurationSchema() (*models.ConfigurationS
 	}
 	return &models.ConfigurationSchema{}, nil
 }
+func (m *mockConfigServiceImpl) GetCORSConfiguration() (*models.CORSConfig, error) {
+	return &models.CORSConfig{}, nil
+}
+func (m *mockConfigServiceImpl) UpdateCORSConfiguration(cors *models.CORSConfig) (*models.CORSConfig, error) {
+	return cors, nil
+}
 
 type mockConfigAuthImpl struct {
 	checkPermissionFunc func(userID int, permission string) (bool, error)
@@ -1828,6 +1834,9 @@ type mockConfigAuthImpl struct {
 func (m *mockConfigAuthImpl) ValidateToken(tokenString string) (*models.User, error) {
 	return nil, errors.New("invalid")
 }
+func (m *mockConfigAuthImpl) GetCurrentUser(token string) (*models.User, error) {
+	return nil, errors.New("invalid")
+}
 func (m *mockConfigAuthImpl) CheckPermission(userID int, permission string) (bool, error) {
 	if m.checkPermissionFunc != nil {
 		return m.checkPermissionFunc(userID, permission)
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCSPReportSize caps a violation report body. Reports carry a policy,
+// a few URLs and at most a short sample of the offending code.
+const maxCSPReportSize = 64 * 1024
+
+// anonymousReporter is the user ID of error reports sent by browsers
+// rather than signed-in users.
+const anonymousReporter = 0
+
+// cspReportRecorder defines the error reporting method used by
+// CSPReportHandler.
+type cspReportRecorder interface {
+	ReportError(userID int, request *models.ErrorReportRequest) (*models.ErrorReport, error)
+}
+
+// cspViolation is the body browsers POST to a policy's report-uri.
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	BlockedURI         string `json:"blocked-uri"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	ColumnNumber       int    `json:"column-number"`
+	StatusCode         int    `json:"status-code"`
+	Disposition        string `json:"disposition"`
+	ScriptSample       string `json:"script-sample"`
+}
+
+// CSPReportHandler collects Content-Security-Policy violation reports
+// into the error reporting subsystem, where they show up in error
+// statistics and system health.
+type CSPReportHandler struct {
+	reports cspReportRecorder
+}
+
+// NewCSPReportHandler creates a new CSPReportHandler.
+func NewCSPReportHandler(reports cspReportRecorder) *CSPReportHandler {
+	return &CSPReportHandler{reports: reports}
+}
+
+// Report handles POST /api/v1/csp-report, the report-uri of every policy
+// the server sends. Browsers send reports without credentials, so it is
+// public; reports are recorded as warnings with the csp_violation error
+// code and rate limited like other anonymous error reports.
+func (h *CSPReportHandler) Report(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCSPReportSize+1))
+	if err != nil || len(body) > maxCSPReportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid CSP report"})
+		return
+	}
+	var envelope struct {
+		Report *cspViolation `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Report == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid CSP report"})
+		return
+	}
+	v := envelope.Report
+
+	directive := v.EffectiveDirective
+	if directive == "" {
+		// Older browsers only send the directive as written in the policy
+		directive, _, _ = strings.Cut(v.ViolatedDirective, " ")
+	}
+	blocked := v.BlockedURI
+	if blocked == "" {
+		blocked = "inline"
+	}
+	_, err = h.reports.ReportError(anonymousReporter, &models.ErrorReportRequest{
+		Level:     models.ErrorLevelWarning,
+		Message:   "CSP violation: " + directive + " blocked " + blocked,
+		ErrorCode: "csp_violation",
+		Component: "csp",
+		Context: map[string]interface{}{
+			"violated_directive": v.ViolatedDirective,
+			"blocked_uri":        v.BlockedURI,
+			"referrer":           v.Referrer,
+			"source_file":        v.SourceFile,
+			"line_number":        v.LineNumber,
+			"column_number":      v.ColumnNumber,
+			"status_code":        v.StatusCode,
+			"disposition":        v.Disposition,
+			"script_sample":      v.ScriptSample,
+			"original_policy":    v.OriginalPolicy,
+		},
+		UserAgent: c.Request.UserAgent(),
+		URL:       v.DocumentURI,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "rate limit") {
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to record CSP report", "details": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCSPReports struct {
+	userID  int
+	request *models.ErrorReportRequest
+	err     error
+}
+
+func (f *fakeCSPReports) ReportError(userID int, request *models.ErrorReportRequest) (*models.ErrorReport, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.userID, f.request = userID, request
+	return &models.ErrorReport{ID: 1}, nil
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reports := &fakeCSPReports{userID: -1}
+	r := gin.New()
+	r.POST("/api/v1/csp-report", NewCSPReportHandler(reports).Report)
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/csp-report", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/csp-report")
+		req.Header.Set("User-Agent", "Firefox/128.0")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	code := post(`{"csp-report": {
+		"document-uri": "https://catalog.example/api/v1/stream/7",
+		"violated-directive": "script-src-elem",
+		"effective-directive": "script-src-elem",
+		"original-policy": "default-src 'none'",
+		"blocked-uri": "inline",
+		"line-number": 3,
+		"disposition": "enforce"
+	}}`)
+	require.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, 0, reports.userID)
+	assert.Equal(t, models.ErrorLevelWarning, reports.request.Level)
+	assert.Equal(t, "csp_violation", reports.request.ErrorCode)
+	assert.Equal(t, "CSP violation: script-src-elem blocked inline", reports.request.Message)
+	assert.Equal(t, "https://catalog.example/api/v1/stream/7", reports.request.URL)
+	assert.Equal(t, "Firefox/128.0", reports.request.UserAgent)
+	assert.Equal(t, 3, reports.request.Context["line_number"])
+
+	// Older browsers send the directive as written in the policy
+	require.Equal(t, http.StatusNoContent, post(`{"csp-report": {"violated-directive": "img-src 'self'", "blocked-uri": "https://evil.example/x.png"}}`))
+	assert.Equal(t, "CSP violation: img-src blocked https://evil.example/x.png", reports.request.Message)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"type": "csp-violation"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"csp-report": {"script-sample": "`+strings.Repeat("a", maxCSPReportSize)+`"}}`))
+
+	reports.err = errors.New("error reporting rate limit exceeded")
+	assert.Equal(t, http.StatusTooManyRequests, post(`{"csp-report": {"violated-directive": "img-src"}}`))
+}
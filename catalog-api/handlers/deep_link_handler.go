@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeepLinkBatch is the most links one batch request may generate
+const maxDeepLinkBatch = 100
+
+// deepLinkService defines the deep linking methods used by DeepLinkHandler.
+type deepLinkService interface {
+	GenerateDeepLinks(ctx context.Context, req *services.DeepLinkRequest) (*services.DeepLinkResponse, error)
+	GenerateBatchLinks(ctx context.Context, requests []*services.DeepLinkRequest) ([]*services.DeepLinkResponse, error)
+	GenerateSmartLink(ctx context.Context, req *services.DeepLinkRequest) (*services.SmartLinkResponse, error)
+	ValidateLinks(ctx context.Context, links []*services.DeepLink) (*services.ValidationResult, error)
+	ResolveLink(ctx context.Context, action, mediaID, trackingID, userAgent string) (*services.LinkRedirect, error)
+	TrackLinkEvent(ctx context.Context, event *services.LinkTrackingEvent) error
+	GetLinkAnalytics(ctx context.Context, trackingID string) (*services.LinkAnalytics, error)
+}
+
+// DeepLinkHandler generates links that open media in the native apps and
+// serves the universal links they share: /link/:action/:mediaID sends
+// each visitor to their platform's app, its store or the web app.
+type DeepLinkHandler struct {
+	links       deepLinkService
+	authService requestAuthService
+}
+
+// NewDeepLinkHandler creates a new DeepLinkHandler.
+func NewDeepLinkHandler(links deepLinkService, authService requestAuthService) *DeepLinkHandler {
+	return &DeepLinkHandler{
+		links:       links,
+		authService: authService,
+	}
+}
+
+// deepLinkErrorStatus maps service errors to HTTP status codes.
+func deepLinkErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"), strings.Contains(msg, "required"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GenerateLinks handles POST /api/v1/links/generate, returning the links
+// for every platform, the universal link and its QR code.
+func (h *DeepLinkHandler) GenerateLinks(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	var req services.DeepLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	links, err := h.links.GenerateDeepLinks(linkContext(c), &req)
+	if err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to generate links", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": links})
+}
+
+// GenerateBatch handles POST /api/v1/links/batch. Requests without a media
+// ID are left out of the result.
+func (h *DeepLinkHandler) GenerateBatch(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	var req struct {
+		Requests []*services.DeepLinkRequest `json:"requests" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if len(req.Requests) > maxDeepLinkBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Too many links requested",
+			"details": "at most " + strconv.Itoa(maxDeepLinkBatch) + " links per batch"})
+		return
+	}
+	for i, item := range req.Requests {
+		if item == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body",
+				"details": "request " + strconv.Itoa(i) + " is empty"})
+			return
+		}
+	}
+
+	links, err := h.links.GenerateBatchLinks(linkContext(c), req.Requests)
+	if err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to generate links", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": links})
+}
+
+// GenerateSmartLink handles POST /api/v1/links/smart, picking the best link
+// for the platform given in the request's context.
+func (h *DeepLinkHandler) GenerateSmartLink(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	var req services.DeepLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	link, err := h.links.GenerateSmartLink(linkContext(c), &req)
+	if err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to generate smart link", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": link})
+}
+
+// ValidateLinks handles POST /api/v1/links/validate.
+func (h *DeepLinkHandler) ValidateLinks(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	var req struct {
+		Links []*services.DeepLink `json:"links" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	for i, link := range req.Links {
+		if link == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body",
+				"details": "link " + strconv.Itoa(i) + " is empty"})
+			return
+		}
+	}
+
+	result, err := h.links.ValidateLinks(c.Request.Context(), req.Links)
+	if err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to validate links", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// TrackEvent handles POST /api/v1/links/events, where the apps report
+// whether a link opened them, fell back to the store or failed. Clicks
+// are recorded by the universal link itself.
+func (h *DeepLinkHandler) TrackEvent(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	var event services.LinkTrackingEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if event.EventType == "click" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid link event",
+			"details": "clicks are recorded when the link is opened"})
+		return
+	}
+	event.UserID = currentUser.ID
+	event.UserAgent = c.Request.UserAgent()
+	event.IPAddress = c.ClientIP()
+	if event.Platform == "" {
+		event.Platform = services.DetectPlatform(event.UserAgent)
+	}
+
+	if err := h.links.TrackLinkEvent(c.Request.Context(), &event); err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to track link event", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": event})
+}
+
+// GetAnalytics handles GET /api/v1/links/analytics/:tracking_id.
+func (h *DeepLinkHandler) GetAnalytics(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionAnalyticsView); !ok {
+		return
+	}
+
+	analytics, err := h.links.GetLinkAnalytics(c.Request.Context(), c.Param("tracking_id"))
+	if err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to load link analytics", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": analytics})
+}
+
+// QRCode handles GET /api/v1/links/qr?data=...&size=200, rendering data as
+// a QR code PNG. It is public so the image can be embedded anywhere; size
+// is the width in pixels, between 64 and 1024.
+func (h *DeepLinkHandler) QRCode(c *gin.Context) {
+	data := c.Query("data")
+	if data == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid QR code request", "details": "data is required"})
+		return
+	}
+	size := 200
+	if raw := c.Query("size"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 64 || parsed > 1024 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid QR code request", "details": "size must be between 64 and 1024"})
+			return
+		}
+		size = parsed
+	}
+
+	image, err := services.QRCodePNG(data, size)
+	if err != nil {
+		c.JSON(deepLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to render QR code", "details": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/png", image)
+}
+
+// deepLinkPage tries to open the app on iOS, where browsers cannot tell
+// whether it is installed, and moves on to the App Store when the page is
+// still showing a moment later.
+var deepLinkPage = template.Must(template.New("deep-link").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Open in Catalogizer</title>
+</head>
+<body>
+<p><a href="{{.AppURL}}">Open in the Catalogizer app</a></p>
+<p><a href="{{.StoreURL}}">Get the app</a> or <a href="{{.WebURL}}">continue in the browser</a></p>
+<script>
+window.location.href = {{.AppURL}};
+setTimeout(function () {
+	if (!document.hidden) {
+		window.location.href = {{.StoreURL}};
+	}
+}, 1500);
+</script>
+</body>
+</html>
+`))
+
+// Open handles GET /link/:action/:mediaID, the public universal link.
+// Android visitors go to an intent that opens the app or the Play Store,
+// iOS visitors get a page that does the same with the App Store and
+// everyone else goes to the web app. Every visit is recorded as a click.
+func (h *DeepLinkHandler) Open(c *gin.Context) {
+	userAgent := c.Request.UserAgent()
+	redirect, err := h.links.ResolveLink(linkContext(c), c.Param("action"), c.Param("mediaID"), c.Query("track"), userAgent)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Link not found", "details": err.Error()})
+		return
+	}
+	// Tracking is best effort; a visitor is never kept from the link
+	_ = h.links.TrackLinkEvent(c.Request.Context(), &services.LinkTrackingEvent{
+		TrackingID: redirect.TrackingID,
+		EventType:  "click",
+		Platform:   redirect.Platform,
+		UserAgent:  userAgent,
+		IPAddress:  c.ClientIP(),
+		Success:    true,
+	})
+
+	c.Header("Cache-Control", "no-store")
+	switch {
+	case redirect.Platform == "ios" && redirect.AppURL != "":
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		deepLinkPage.Execute(c.Writer, struct {
+			AppURL   template.URL // a custom scheme html/template would reject
+			StoreURL string
+			WebURL   string
+		}{template.URL(redirect.AppURL), redirect.StoreURL, redirect.WebURL})
+	case redirect.AppURL != "":
+		c.Redirect(http.StatusFound, redirect.AppURL)
+	default:
+		c.Redirect(http.StatusFound, redirect.WebURL)
+	}
+}
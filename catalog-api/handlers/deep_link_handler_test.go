@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deepLinkRequest(auth requestAuthService, method, target, body, userAgent string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewDeepLinkHandler(services.NewDeepLinkingService("https://catalogizer.app", "v1"), auth)
+	r := gin.New()
+	r.POST("/links/generate", h.GenerateLinks)
+	r.POST("/links/batch", h.GenerateBatch)
+	r.POST("/links/smart", h.GenerateSmartLink)
+	r.POST("/links/validate", h.ValidateLinks)
+	r.POST("/links/events", h.TrackEvent)
+	r.GET("/links/analytics/:tracking_id", h.GetAnalytics)
+	r.GET("/links/qr", h.QRCode)
+	r.GET("/link/:action/:mediaID", h.Open)
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeepLinkHandler_Generate(t *testing.T) {
+	denied := &permissionAuth{granted: map[string]bool{}}
+	assert.Equal(t, http.StatusForbidden, deepLinkRequest(denied, http.MethodPost, "/links/generate", `{"media_id":"42","action":"play"}`, "").Code)
+
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}}
+	w := deepLinkRequest(viewer, http.MethodPost, "/links/generate", `{"media_id":"42","action":"play"}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"universal_link":"https://catalogizer.app/link/play/42?track=`)
+	assert.Contains(t, w.Body.String(), `"qr_code":"https://catalogizer.app/api/v1/links/qr?size=200&data=`)
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(viewer, http.MethodPost, "/links/generate", `{"action":"play"}`, "").Code)
+
+	w = deepLinkRequest(viewer, http.MethodPost, "/links/batch", `{"requests":[{"media_id":"1","action":"detail"},{"action":"detail"}]}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), `"universal_link"`))
+	many := strings.Repeat(`{"media_id":"1"},`, maxDeepLinkBatch) + `{"media_id":"1"}`
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(viewer, http.MethodPost, "/links/batch", `{"requests":[`+many+`]}`, "").Code)
+
+	w = deepLinkRequest(viewer, http.MethodPost, "/links/smart", `{"media_id":"42","action":"detail","context":{"platform":"android"}}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"strategy":"native_preferred"`)
+
+	w = deepLinkRequest(viewer, http.MethodPost, "/links/validate", `{"links":[{"url":"catalogizer://detail/42","scheme":"catalogizer"},{"url":""}]}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid_links":1`)
+}
+
+func TestDeepLinkHandler_Events(t *testing.T) {
+	denied := &permissionAuth{granted: map[string]bool{}}
+	assert.Equal(t, http.StatusForbidden, deepLinkRequest(denied, http.MethodPost, "/links/events", `{"tracking_id":"t1","event_type":"open"}`, "").Code)
+	assert.Equal(t, http.StatusForbidden, deepLinkRequest(denied, http.MethodGet, "/links/analytics/t1", "", "").Code)
+
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true, models.PermissionAnalyticsView: true}}
+	w := deepLinkRequest(viewer, http.MethodPost, "/links/events", `{"tracking_id":"t1","event_type":"open","app_opened":true}`, "Mozilla/5.0 (Linux; Android 14; Pixel 8)")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"platform":"android"`)
+	assert.Contains(t, w.Body.String(), `"user_id":1`)
+
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(viewer, http.MethodPost, "/links/events", `{"tracking_id":"t1","event_type":"click"}`, "").Code)
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(viewer, http.MethodPost, "/links/events", `{"tracking_id":"t1","event_type":"install"}`, "").Code)
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(viewer, http.MethodPost, "/links/events", `{"event_type":"open"}`, "").Code)
+
+	w = deepLinkRequest(viewer, http.MethodGet, "/links/analytics/t1", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"tracking_id":"t1"`)
+	assert.Contains(t, w.Body.String(), `"total_clicks":0`)
+}
+
+func TestDeepLinkHandler_QRCode(t *testing.T) {
+	public := &permissionAuth{granted: map[string]bool{}}
+	w := deepLinkRequest(public, http.MethodGet, "/links/qr?data=https%3A%2F%2Fcatalogizer.app%2Flink%2Fdetail%2F42&size=300", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	_, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(public, http.MethodGet, "/links/qr", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, deepLinkRequest(public, http.MethodGet, "/links/qr?data=x&size=5000", "", "").Code)
+}
+
+func TestDeepLinkHandler_Open(t *testing.T) {
+	public := &permissionAuth{granted: map[string]bool{}}
+
+	w := deepLinkRequest(public, http.MethodGet, "/link/play/42?track=t1", "", "Mozilla/5.0 (Linux; Android 14; Pixel 8)")
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "intent://play/42?"))
+
+	w = deepLinkRequest(public, http.MethodGet, "/link/detail/42?track=t1", "", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X)")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="catalogizer://detail/42?`)
+	assert.Contains(t, w.Body.String(), "https://apps.apple.com/")
+
+	w = deepLinkRequest(public, http.MethodGet, "/link/detail/42?track=t1", "", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://catalogizer.app/detail/42?track=t1", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, deepLinkRequest(public, http.MethodGet, "/link/delete/42", "", "").Code)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dependencyMonitor defines the dependency monitor methods used by
+// DependencyHandler and the degraded-mode middleware.
+type dependencyMonitor interface {
+	Statuses() []services.DependencyStatus
+	ProbeAll(ctx context.Context) []services.DependencyStatus
+	Check(name string) error
+	Degraded() bool
+}
+
+// dependencyRetryAfter is the Retry-After sent with 503 responses, in
+// seconds. Dependencies are re-probed about once a minute.
+const dependencyRetryAfter = "60"
+
+// DependencyHandler reports the external dependencies the server probes
+// and lets administrators re-probe them without waiting for the next
+// periodic check.
+type DependencyHandler struct {
+	monitor     dependencyMonitor
+	authService requestAuthService
+}
+
+// NewDependencyHandler creates a new DependencyHandler.
+func NewDependencyHandler(monitor dependencyMonitor, authService requestAuthService) *DependencyHandler {
+	return &DependencyHandler{
+		monitor:     monitor,
+		authService: authService,
+	}
+}
+
+// RequireDependency rejects requests with 503 and the reason while any of
+// the named dependencies is unavailable.
+func RequireDependency(monitor dependencyMonitor, names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range names {
+			if err := monitor.Check(name); err != nil {
+				abortUnavailable(c, err)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireStorageRoot rejects requests with 503 and the reason while the
+// storage root named by the path parameter is unavailable.
+func RequireStorageRoot(monitor dependencyMonitor, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := monitor.Check(services.StorageRootDependency(c.Param(param))); err != nil {
+			abortUnavailable(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortUnavailable(c *gin.Context, err error) {
+	c.Header("Retry-After", dependencyRetryAfter)
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"success": false,
+		"error":   "Service temporarily unavailable",
+		"details": err.Error(),
+	})
+}
+
+// GetDependencies handles GET /api/v1/admin/dependencies. Requires
+// system.admin.
+func (h *DependencyHandler) GetDependencies(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"degraded":     h.monitor.Degraded(),
+		"dependencies": h.monitor.Statuses(),
+	}})
+}
+
+// ProbeDependencies handles POST /api/v1/admin/dependencies/probe,
+// probing every dependency now. Requires system.admin.
+func (h *DependencyHandler) ProbeDependencies(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	statuses := h.monitor.ProbeAll(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"degraded":     h.monitor.Degraded(),
+		"dependencies": statuses,
+	}})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// duplicateResolver defines the duplicate methods used by DuplicateHandler.
+type duplicateResolver interface {
+	ResolveDuplicates(ctx context.Context, req services.DuplicateResolveRequest) (*services.DuplicateResolution, error)
+}
+
+// DuplicateHandler resolves the duplicate groups reported by
+// /search/duplicates.
+type DuplicateHandler struct {
+	resolver    duplicateResolver
+	authService requestAuthService
+}
+
+// NewDuplicateHandler creates a new DuplicateHandler.
+func NewDuplicateHandler(resolver duplicateResolver, authService requestAuthService) *DuplicateHandler {
+	return &DuplicateHandler{
+		resolver:    resolver,
+		authService: authService,
+	}
+}
+
+// ResolveDuplicates handles POST /api/v1/search/duplicates/resolve.
+func (h *DuplicateHandler) ResolveDuplicates(c *gin.Context) {
+	var req struct {
+		Hash       string `json:"hash" binding:"required"`
+		Action     string `json:"action" binding:"required"`
+		KeepFileID int64  `json:"keep_file_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	permission := models.PermissionMediaDelete
+	if req.Action == services.DuplicateActionKeep {
+		permission = models.PermissionMediaEdit
+	}
+	currentUser, ok := requirePermission(c, h.authService, permission)
+	if !ok {
+		return
+	}
+
+	result, err := h.resolver.ResolveDuplicates(c.Request.Context(), services.DuplicateResolveRequest{
+		Hash:       req.Hash,
+		Action:     req.Action,
+		KeepFileID: req.KeepFileID,
+		UserID:     currentUser.ID,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.JSON(duplicateErrorStatus(err), gin.H{"success": false, "error": "Failed to resolve duplicates", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+func duplicateErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "is locked"):
+		return http.StatusLocked
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
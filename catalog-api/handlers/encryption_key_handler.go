@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// encryptionKeyService defines the key management methods used by
+// EncryptionKeyHandler.
+type encryptionKeyService interface {
+	AddKey(ctx context.Context, key *services.EncryptionKey) error
+	ListKeys(ctx context.Context, userID int) ([]services.EncryptionKey, error)
+	GetKey(ctx context.Context, userID int, id int64) (*services.EncryptionKey, error)
+	SetDefaultKey(ctx context.Context, userID int, id int64) error
+	DeleteKey(ctx context.Context, userID int, id int64) error
+}
+
+// EncryptionKeyHandler lets users manage the age and GPG public keys that
+// downloads and exports can be encrypted to. Users only ever see their own
+// keys.
+type EncryptionKeyHandler struct {
+	keys        encryptionKeyService
+	authService requestAuthService
+}
+
+// NewEncryptionKeyHandler creates a new EncryptionKeyHandler.
+func NewEncryptionKeyHandler(keys encryptionKeyService, authService requestAuthService) *EncryptionKeyHandler {
+	return &EncryptionKeyHandler{
+		keys:        keys,
+		authService: authService,
+	}
+}
+
+// encryptionKeyErrorStatus maps service errors to HTTP status codes.
+func encryptionKeyErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid key"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already registered"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// ListKeys handles GET /api/v1/encryption-keys.
+func (h *EncryptionKeyHandler) ListKeys(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDownload)
+	if !ok {
+		return
+	}
+
+	keys, err := h.keys.ListKeys(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list encryption keys", "details": err.Error()})
+		return
+	}
+	if keys == nil {
+		keys = []services.EncryptionKey{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": keys})
+}
+
+// AddKey handles POST /api/v1/encryption-keys.
+func (h *EncryptionKeyHandler) AddKey(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDownload)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name      string `json:"name" binding:"required"`
+		Type      string `json:"type" binding:"required"`
+		PublicKey string `json:"public_key" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	key := services.EncryptionKey{
+		UserID:    currentUser.ID,
+		Name:      req.Name,
+		Type:      req.Type,
+		PublicKey: req.PublicKey,
+	}
+	if err := h.keys.AddKey(c.Request.Context(), &key); err != nil {
+		c.JSON(encryptionKeyErrorStatus(err), gin.H{"success": false, "error": "Failed to add encryption key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": key})
+}
+
+// GetKey handles GET /api/v1/encryption-keys/:id.
+func (h *EncryptionKeyHandler) GetKey(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDownload)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "key")
+	if !ok {
+		return
+	}
+
+	key, err := h.keys.GetKey(c.Request.Context(), currentUser.ID, id)
+	if err != nil {
+		c.JSON(encryptionKeyErrorStatus(err), gin.H{"success": false, "error": "Failed to load encryption key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": key})
+}
+
+// SetDefaultKey handles PUT /api/v1/encryption-keys/:id/default.
+func (h *EncryptionKeyHandler) SetDefaultKey(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDownload)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "key")
+	if !ok {
+		return
+	}
+
+	if err := h.keys.SetDefaultKey(c.Request.Context(), currentUser.ID, id); err != nil {
+		c.JSON(encryptionKeyErrorStatus(err), gin.H{"success": false, "error": "Failed to set default encryption key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// DeleteKey handles DELETE /api/v1/encryption-keys/:id.
+func (h *EncryptionKeyHandler) DeleteKey(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDownload)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "key")
+	if !ok {
+		return
+	}
+
+	if err := h.keys.DeleteKey(c.Request.Context(), currentUser.ID, id); err != nil {
+		c.JSON(encryptionKeyErrorStatus(err), gin.H{"success": false, "error": "Failed to delete encryption key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
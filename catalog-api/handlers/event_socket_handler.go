@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// eventHub defines the hub methods used by EventSocketHandler.
+type eventHub interface {
+	Subscribe(userID int, isAdmin bool, channels ...string) (*services.EventSubscription, error)
+}
+
+// eventSocketMessage is a control message sent by the client.
+type eventSocketMessage struct {
+	Type     string   `json:"type"`
+	Channels []string `json:"channels"`
+}
+
+// EventSocketHandler streams scan progress, conversion job status and new
+// media notifications over a WebSocket. The JWT is checked during the
+// handshake; browsers, which cannot set headers on a WebSocket, pass it
+// as the token query parameter.
+type EventSocketHandler struct {
+	hub         eventHub
+	authService requestAuthService
+	logger      *zap.Logger
+	upgrader    websocket.Upgrader
+	config      WebSocketConfig
+}
+
+// NewEventSocketHandler creates a new EventSocketHandler.
+func NewEventSocketHandler(hub eventHub, authService requestAuthService, logger *zap.Logger) *EventSocketHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	config := DefaultWebSocketConfig()
+	return &EventSocketHandler{
+		hub:         hub,
+		authService: authService,
+		logger:      logger,
+		config:      config,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  config.ReadBufferSize,
+			WriteBufferSize: config.WriteBufferSize,
+			CheckOrigin: func(r *http.Request) bool {
+				return true // The JWT, not the origin, authorizes the connection
+			},
+		},
+	}
+}
+
+// Connect handles GET /api/v1/ws. The optional channels query parameter
+// (comma separated) picks the initial subscriptions; the client can change
+// them later with subscribe and unsubscribe messages.
+func (h *EventSocketHandler) Connect(c *gin.Context) {
+	token := requestCredential(c.Request.Header)
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+	user, err := h.authService.GetCurrentUser(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+	isAdmin, err := checkPermission(h.authService, user, models.PermissionSystemAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check permissions"})
+		return
+	}
+
+	var channels []string
+	if raw := c.Query("channels"); raw != "" {
+		channels = strings.Split(raw, ",")
+	}
+	sub, err := h.hub.Subscribe(user.ID, isAdmin, channels...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		sub.Close()
+		h.logger.Warn("Event socket upgrade failed", zap.Error(err))
+		return
+	}
+	h.logger.Debug("Event socket connected", zap.Int("user_id", user.ID), zap.Strings("channels", sub.Channels()))
+
+	control := make(chan interface{}, 8)
+	go h.writeLoop(conn, sub, control)
+	h.readLoop(conn, sub, control)
+}
+
+// readLoop applies the client's control messages until the connection
+// closes, then ends the subscription.
+func (h *EventSocketHandler) readLoop(conn *websocket.Conn, sub *services.EventSubscription, control chan<- interface{}) {
+	defer sub.Close()
+
+	conn.SetReadLimit(h.config.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(h.config.PongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(h.config.PongWait))
+		return nil
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg eventSocketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			h.sendControl(control, gin.H{"type": "error", "error": "invalid message"})
+			continue
+		}
+
+		switch msg.Type {
+		case "subscribe":
+			if err := sub.Subscribe(msg.Channels...); err != nil {
+				h.sendControl(control, gin.H{"type": "error", "error": err.Error()})
+				continue
+			}
+			h.sendControl(control, gin.H{"type": "subscribed", "channels": sub.Channels()})
+		case "unsubscribe":
+			sub.Unsubscribe(msg.Channels...)
+			h.sendControl(control, gin.H{"type": "unsubscribed", "channels": sub.Channels()})
+		case "ping":
+			h.sendControl(control, gin.H{"type": "pong", "timestamp": time.Now().UTC()})
+		default:
+			h.sendControl(control, gin.H{"type": "error", "error": "unknown message type: " + msg.Type})
+		}
+	}
+}
+
+func (h *EventSocketHandler) sendControl(control chan<- interface{}, msg interface{}) {
+	select {
+	case control <- msg:
+	default:
+	}
+}
+
+// writeLoop is the connection's only writer: it forwards hub events and
+// control replies and keeps the connection alive with pings.
+func (h *EventSocketHandler) writeLoop(conn *websocket.Conn, sub *services.EventSubscription, control <-chan interface{}) {
+	ticker := time.NewTicker(h.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	write := func(msg interface{}) bool {
+		conn.SetWriteDeadline(time.Now().Add(h.config.WriteWait))
+		return conn.WriteJSON(msg) == nil
+	}
+
+	if !write(gin.H{"type": "subscribed", "channels": sub.Channels()}) {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				conn.SetWriteDeadline(time.Now().Add(h.config.WriteWait))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if !write(event) {
+				return
+			}
+		case msg := <-control:
+			if !write(msg) {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(h.config.WriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// featureFlagService defines the feature flag methods used by
+// FeatureFlagHandler.
+type featureFlagService interface {
+	ListFlags(ctx context.Context) ([]services.FeatureFlag, error)
+	SaveFlag(ctx context.Context, flag *services.FeatureFlag) (*services.FeatureFlag, error)
+	DeleteFlag(ctx context.Context, key string) error
+	Evaluate(ctx context.Context, userID int) ([]services.FeatureAssignment, error)
+	LogExposure(ctx context.Context, userID int, key string) (*services.FeatureAssignment, error)
+	Results(ctx context.Context, key, conversionEvent string, since *time.Time) (*services.ExperimentResults, error)
+}
+
+// FeatureFlagHandler serves feature flag and experiment assignments to
+// clients and lets administrators manage flags and read experiment
+// results.
+type FeatureFlagHandler struct {
+	flags       featureFlagService
+	authService requestAuthService
+}
+
+// NewFeatureFlagHandler creates a new FeatureFlagHandler.
+func NewFeatureFlagHandler(flags featureFlagService, authService requestAuthService) *FeatureFlagHandler {
+	return &FeatureFlagHandler{
+		flags:       flags,
+		authService: authService,
+	}
+}
+
+func featureFlagErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetAssignments handles GET /api/v1/features, evaluating every flag for
+// the current user.
+func (h *FeatureFlagHandler) GetAssignments(c *gin.Context) {
+	user, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	assignments, err := h.flags.Evaluate(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to evaluate feature flags", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignments})
+}
+
+// LogExposure handles POST /api/v1/features/:key/exposures. Clients call
+// it when they show the current user their experiment variant.
+func (h *FeatureFlagHandler) LogExposure(c *gin.Context) {
+	user, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	assignment, err := h.flags.LogExposure(c.Request.Context(), user.ID, c.Param("key"))
+	if err != nil {
+		c.JSON(featureFlagErrorStatus(err), gin.H{"success": false, "error": "Failed to log exposure", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignment})
+}
+
+// ListFlags handles GET /api/v1/admin/feature-flags. Requires
+// system.admin.
+func (h *FeatureFlagHandler) ListFlags(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	flags, err := h.flags.ListFlags(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list feature flags", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": flags})
+}
+
+// SaveFlag handles PUT /api/v1/admin/feature-flags/:key, creating or
+// replacing the flag. Requires system.admin.
+func (h *FeatureFlagHandler) SaveFlag(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var flag services.FeatureFlag
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	flag.Key = c.Param("key")
+
+	saved, err := h.flags.SaveFlag(c.Request.Context(), &flag)
+	if err != nil {
+		c.JSON(featureFlagErrorStatus(err), gin.H{"success": false, "error": "Failed to save feature flag", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": saved})
+}
+
+// DeleteFlag handles DELETE /api/v1/admin/feature-flags/:key. Requires
+// system.admin.
+func (h *FeatureFlagHandler) DeleteFlag(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	if err := h.flags.DeleteFlag(c.Request.Context(), c.Param("key")); err != nil {
+		c.JSON(featureFlagErrorStatus(err), gin.H{"success": false, "error": "Failed to delete feature flag", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetResults handles GET /api/v1/admin/feature-flags/:key/results.
+// Query parameters: conversion (required, an analytics event type) and
+// since (RFC 3339). Requires system.admin.
+func (h *FeatureFlagHandler) GetResults(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var since *time.Time
+	if value := c.Query("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid since", "details": err.Error()})
+			return
+		}
+		since = &t
+	}
+
+	results, err := h.flags.Results(c.Request.Context(), c.Param("key"), c.Query("conversion"), since)
+	if err != nil {
+		c.JSON(featureFlagErrorStatus(err), gin.H{"success": false, "error": "Failed to load experiment results", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": results})
+}
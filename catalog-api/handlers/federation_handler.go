@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// federationService defines the federation methods used by
+// FederationHandler.
+type federationService interface {
+	ListRemotes(ctx context.Context, enabledOnly bool) ([]services.FederationRemote, error)
+	CreateRemote(ctx context.Context, req services.FederationRemoteRequest) (*services.FederationRemote, error)
+	UpdateRemote(ctx context.Context, id int64, req services.FederationRemoteRequest) (*services.FederationRemote, error)
+	DeleteRemote(ctx context.Context, id int64) error
+	SyncRemote(ctx context.Context, id int64) (*services.FederationRemote, error)
+	Browse(ctx context.Context, remoteID int64, query, mediaType string, limit, offset int) ([]services.FederatedItem, int, error)
+	Search(ctx context.Context, query, mediaType string, limit int) ([]services.FederatedItem, error)
+	GetItem(ctx context.Context, remoteID, itemID int64) (*services.FederatedItem, error)
+	StreamURL(ctx context.Context, remoteID, itemID int64) (string, time.Time, error)
+	OpenStream(ctx context.Context, remoteID, itemID, expires int64, signature, rangeHeader string) (*services.FederationStream, error)
+}
+
+// FederationHandler exposes remote Catalogizer instances as read-only
+// libraries. Registering remotes requires system.admin; browsing them
+// requires media.view.
+type FederationHandler struct {
+	federation  federationService
+	authService requestAuthService
+}
+
+// NewFederationHandler creates a new FederationHandler.
+func NewFederationHandler(federation federationService, authService requestAuthService) *FederationHandler {
+	return &FederationHandler{
+		federation:  federation,
+		authService: authService,
+	}
+}
+
+// federationErrorStatus maps service errors to HTTP status codes.
+func federationErrorStatus(err error) int {
+	if errors.Is(err, services.ErrRemoteUnavailable) {
+		return http.StatusBadGateway
+	}
+	if errors.Is(err, services.ErrInvalidStreamSignature) {
+		return http.StatusForbidden
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already exists"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// ListRemotes handles GET /api/v1/admin/federation/remotes.
+func (h *FederationHandler) ListRemotes(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	remotes, err := h.federation.ListRemotes(c.Request.Context(), false)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to list remote libraries", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": remotes})
+}
+
+// CreateRemote handles POST /api/v1/admin/federation/remotes.
+func (h *FederationHandler) CreateRemote(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req services.FederationRemoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	remote, err := h.federation.CreateRemote(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to register remote library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": remote})
+}
+
+// UpdateRemote handles PUT /api/v1/admin/federation/remotes/:id.
+func (h *FederationHandler) UpdateRemote(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "remote")
+	if !ok {
+		return
+	}
+
+	var req services.FederationRemoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	remote, err := h.federation.UpdateRemote(c.Request.Context(), id, req)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to update remote library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": remote})
+}
+
+// DeleteRemote handles DELETE /api/v1/admin/federation/remotes/:id.
+func (h *FederationHandler) DeleteRemote(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "remote")
+	if !ok {
+		return
+	}
+
+	if err := h.federation.DeleteRemote(c.Request.Context(), id); err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to remove remote library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// SyncRemote handles POST /api/v1/admin/federation/remotes/:id/sync,
+// copying a mirrored remote's catalog now.
+func (h *FederationHandler) SyncRemote(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "remote")
+	if !ok {
+		return
+	}
+
+	remote, err := h.federation.SyncRemote(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to sync remote library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": remote})
+}
+
+// ListLibraries handles GET /api/v1/federation/remotes, listing the
+// enabled remote libraries.
+func (h *FederationHandler) ListLibraries(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+
+	remotes, err := h.federation.ListRemotes(c.Request.Context(), true)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to list remote libraries", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": remotes})
+}
+
+// BrowseLibrary handles GET /api/v1/federation/remotes/:id/items. The
+// optional query and type parameters filter by title and media type.
+func (h *FederationHandler) BrowseLibrary(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "remote")
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "24"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 24
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items, total, err := h.federation.Browse(c.Request.Context(), id, c.Query("query"), c.Query("type"), limit, offset)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to browse remote library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": items, "total": total, "limit": limit, "offset": offset})
+}
+
+// Search handles GET /api/v1/federation/search, searching every enabled
+// remote library by title. Remotes that cannot be reached are skipped.
+func (h *FederationHandler) Search(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	query := c.Query("query")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "query is required"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "24"))
+	if limit <= 0 || limit > 200 {
+		limit = 24
+	}
+
+	items, err := h.federation.Search(c.Request.Context(), query, c.Query("type"), limit)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to search remote libraries", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": items})
+}
+
+// GetItem handles GET /api/v1/federation/remotes/:id/items/:item_id.
+func (h *FederationHandler) GetItem(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "remote")
+	if !ok {
+		return
+	}
+	itemID, ok := parseIDParam(c, "item_id", "item")
+	if !ok {
+		return
+	}
+
+	item, err := h.federation.GetItem(c.Request.Context(), id, itemID)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to get remote item", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": item})
+}
+
+// GetStreamURL handles GET /api/v1/federation/remotes/:id/items/:item_id/stream,
+// returning a signed URL that plays the item through this server.
+func (h *FederationHandler) GetStreamURL(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "remote")
+	if !ok {
+		return
+	}
+	itemID, ok := parseIDParam(c, "item_id", "item")
+	if !ok {
+		return
+	}
+
+	streamURL, expires, err := h.federation.StreamURL(c.Request.Context(), id, itemID)
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to create stream URL", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"stream_url": streamURL, "expires_at": expires}})
+}
+
+// federationStreamHeaders are the remote response headers passed on to
+// the player.
+var federationStreamHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"Content-Disposition", "Last-Modified", "ETag",
+}
+
+// Stream handles GET /api/v1/federation/stream/:remote_id/:item_id. The
+// signed URL is the credential, so players can open it directly; Range
+// requests are forwarded to the remote.
+func (h *FederationHandler) Stream(c *gin.Context) {
+	remoteID, ok := parseIDParam(c, "remote_id", "remote")
+	if !ok {
+		return
+	}
+	itemID, ok := parseIDParam(c, "item_id", "item")
+	if !ok {
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": services.ErrInvalidStreamSignature.Error()})
+		return
+	}
+
+	stream, err := h.federation.OpenStream(c.Request.Context(), remoteID, itemID, expires,
+		c.Query("signature"), c.GetHeader("Range"))
+	if err != nil {
+		c.JSON(federationErrorStatus(err), gin.H{"success": false, "error": "Failed to open remote stream", "details": err.Error()})
+		return
+	}
+	defer stream.Body.Close()
+
+	for _, name := range federationStreamHeaders {
+		if value := stream.Header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	c.Status(stream.StatusCode)
+	io.Copy(c.Writer, stream.Body)
+}
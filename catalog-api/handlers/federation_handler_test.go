@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFederationService struct {
+	enabledOnly bool
+	query       string
+	limit       int
+	rangeHeader string
+}
+
+func (f *fakeFederationService) ListRemotes(ctx context.Context, enabledOnly bool) ([]services.FederationRemote, error) {
+	f.enabledOnly = enabledOnly
+	return []services.FederationRemote{{ID: 1, Name: "Cabin", Mode: services.FederationModeMirror, Enabled: true}}, nil
+}
+
+func (f *fakeFederationService) CreateRemote(ctx context.Context, req services.FederationRemoteRequest) (*services.FederationRemote, error) {
+	if req.Name == "Cabin" {
+		return nil, fmt.Errorf("remote Cabin already exists")
+	}
+	if req.BaseURL == "" {
+		return nil, fmt.Errorf("invalid remote: base_url must be an http or https URL")
+	}
+	return &services.FederationRemote{ID: 2, Name: req.Name, BaseURL: req.BaseURL, Password: req.Password}, nil
+}
+
+func (f *fakeFederationService) UpdateRemote(ctx context.Context, id int64, req services.FederationRemoteRequest) (*services.FederationRemote, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("remote library not found")
+	}
+	return &services.FederationRemote{ID: id, Name: req.Name}, nil
+}
+
+func (f *fakeFederationService) DeleteRemote(ctx context.Context, id int64) error {
+	if id != 1 {
+		return fmt.Errorf("remote library not found")
+	}
+	return nil
+}
+
+func (f *fakeFederationService) SyncRemote(ctx context.Context, id int64) (*services.FederationRemote, error) {
+	return nil, fmt.Errorf("failed to sync remote Cabin: %w: connection refused", services.ErrRemoteUnavailable)
+}
+
+func (f *fakeFederationService) Browse(ctx context.Context, remoteID int64, query, mediaType string, limit, offset int) ([]services.FederatedItem, int, error) {
+	f.query, f.limit = query, limit
+	return []services.FederatedItem{{RemoteID: remoteID, ID: 2, Title: "Heat"}}, 1, nil
+}
+
+func (f *fakeFederationService) Search(ctx context.Context, query, mediaType string, limit int) ([]services.FederatedItem, error) {
+	f.query, f.limit = query, limit
+	return []services.FederatedItem{{RemoteID: 1, ID: 2, Title: "Heat"}}, nil
+}
+
+func (f *fakeFederationService) GetItem(ctx context.Context, remoteID, itemID int64) (*services.FederatedItem, error) {
+	if itemID != 2 {
+		return nil, fmt.Errorf("remote item not found")
+	}
+	return &services.FederatedItem{RemoteID: remoteID, ID: itemID, Title: "Heat"}, nil
+}
+
+func (f *fakeFederationService) StreamURL(ctx context.Context, remoteID, itemID int64) (string, time.Time, error) {
+	return fmt.Sprintf("/api/v1/federation/stream/%d/%d?expires=100&signature=abc", remoteID, itemID), time.Unix(100, 0), nil
+}
+
+func (f *fakeFederationService) OpenStream(ctx context.Context, remoteID, itemID, expires int64, signature, rangeHeader string) (*services.FederationStream, error) {
+	if signature != "abc" || expires != 100 {
+		return nil, services.ErrInvalidStreamSignature
+	}
+	f.rangeHeader = rangeHeader
+	header := http.Header{}
+	header.Set("Content-Type", "video/x-matroska")
+	header.Set("Content-Range", "bytes 2-5/10")
+	header.Set("Set-Cookie", "remote=1")
+	return &services.FederationStream{StatusCode: http.StatusPartialContent, Header: header,
+		Body: io.NopCloser(strings.NewReader("2345"))}, nil
+}
+
+func newFederationTestRouter(svc *fakeFederationService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewFederationHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/federation/remotes", h.ListRemotes)
+	r.POST("/admin/federation/remotes", h.CreateRemote)
+	r.PUT("/admin/federation/remotes/:id", h.UpdateRemote)
+	r.DELETE("/admin/federation/remotes/:id", h.DeleteRemote)
+	r.POST("/admin/federation/remotes/:id/sync", h.SyncRemote)
+	r.GET("/federation/remotes", h.ListLibraries)
+	r.GET("/federation/search", h.Search)
+	r.GET("/federation/remotes/:id/items", h.BrowseLibrary)
+	r.GET("/federation/remotes/:id/items/:item_id", h.GetItem)
+	r.GET("/federation/remotes/:id/items/:item_id/stream", h.GetStreamURL)
+	r.GET("/federation/stream/:remote_id/:item_id", h.Stream)
+	return r
+}
+
+func federationRequest(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestFederationHandler_AdminRemotes(t *testing.T) {
+	svc := &fakeFederationService{}
+	viewer := newFederationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+	assert.Equal(t, http.StatusForbidden, federationRequest(viewer, http.MethodGet, "/admin/federation/remotes", "").Code)
+	assert.Equal(t, http.StatusForbidden, federationRequest(viewer, http.MethodPost, "/admin/federation/remotes", `{}`).Code)
+
+	r := newFederationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}})
+	require.Equal(t, http.StatusOK, federationRequest(r, http.MethodGet, "/admin/federation/remotes", "").Code)
+	assert.False(t, svc.enabledOnly)
+
+	w := federationRequest(r, http.MethodPost, "/admin/federation/remotes",
+		`{"name":"Lake house","base_url":"https://lake.example","username":"mirror","password":"secret"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.Equal(t, http.StatusConflict, federationRequest(r, http.MethodPost, "/admin/federation/remotes", `{"name":"Cabin"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, federationRequest(r, http.MethodPost, "/admin/federation/remotes", `{"name":"Barn"}`).Code)
+
+	assert.Equal(t, http.StatusOK, federationRequest(r, http.MethodPut, "/admin/federation/remotes/1", `{"name":"Cabin"}`).Code)
+	assert.Equal(t, http.StatusNotFound, federationRequest(r, http.MethodPut, "/admin/federation/remotes/5", `{}`).Code)
+	assert.Equal(t, http.StatusOK, federationRequest(r, http.MethodDelete, "/admin/federation/remotes/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, federationRequest(r, http.MethodDelete, "/admin/federation/remotes/5", "").Code)
+	assert.Equal(t, http.StatusBadGateway, federationRequest(r, http.MethodPost, "/admin/federation/remotes/1/sync", "").Code)
+}
+
+func TestFederationHandler_BrowseAndSearch(t *testing.T) {
+	svc := &fakeFederationService{}
+	r := newFederationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+
+	require.Equal(t, http.StatusOK, federationRequest(r, http.MethodGet, "/federation/remotes", "").Code)
+	assert.True(t, svc.enabledOnly)
+
+	w := federationRequest(r, http.MethodGet, "/federation/remotes/1/items?query=heat&limit=500", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "heat", svc.query)
+	assert.Equal(t, 24, svc.limit)
+	var resp struct {
+		Data  []services.FederatedItem `json:"data"`
+		Total int                      `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Total)
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "Heat", resp.Data[0].Title)
+
+	assert.Equal(t, http.StatusBadRequest, federationRequest(r, http.MethodGet, "/federation/search", "").Code)
+	require.Equal(t, http.StatusOK, federationRequest(r, http.MethodGet, "/federation/search?query=alien&limit=5", "").Code)
+	assert.Equal(t, "alien", svc.query)
+	assert.Equal(t, 5, svc.limit)
+
+	assert.Equal(t, http.StatusOK, federationRequest(r, http.MethodGet, "/federation/remotes/1/items/2", "").Code)
+	assert.Equal(t, http.StatusNotFound, federationRequest(r, http.MethodGet, "/federation/remotes/1/items/3", "").Code)
+	assert.Equal(t, http.StatusBadRequest, federationRequest(r, http.MethodGet, "/federation/remotes/x/items/3", "").Code)
+}
+
+func TestFederationHandler_Stream(t *testing.T) {
+	svc := &fakeFederationService{}
+	r := newFederationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+
+	w := federationRequest(r, http.MethodGet, "/federation/remotes/1/items/2/stream", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			StreamURL string `json:"stream_url"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// The signed URL works without a session
+	req := httptest.NewRequest(http.MethodGet, resp.Data.StreamURL, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "2345", w.Body.String())
+	assert.Equal(t, "bytes=2-5", svc.rangeHeader)
+	assert.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "video/x-matroska", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/federation/stream/1/2?expires=100&signature=forged", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/federation/stream/1/2?signature=abc", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
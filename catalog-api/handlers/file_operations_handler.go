@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileOperator defines the file operation methods used by
+// FileOperationsHandler.
+type fileOperator interface {
+	Move(ctx context.Context, actor services.FileActor, req services.FileMoveRequest) (*services.FileMove, error)
+	Rename(ctx context.Context, actor services.FileActor, storageRoot, filePath, newName string) (*services.FileMove, error)
+	Trash(ctx context.Context, actor services.FileActor, storageRoot, filePath string) (*services.TrashItem, error)
+	ListTrash(ctx context.Context, userID int) ([]services.TrashItem, error)
+	RestoreTrash(ctx context.Context, actor services.FileActor, id int64) (*services.TrashItem, error)
+	PurgeTrash(ctx context.Context, actor services.FileActor, id int64) error
+	EmptyTrash(ctx context.Context, actor services.FileActor) (int, error)
+	ListShareTrash(ctx context.Context, storageRoot string) (*services.ShareTrashListing, error)
+	RestoreShareTrash(ctx context.Context, actor services.FileActor, storageRoot, trashPath string) (*services.ShareTrashItem, error)
+}
+
+// FileOperationsHandler moves, renames and deletes files on storage
+// roots, and manages the trash deleted files go to and the recycle bins
+// of NAS shares. Every operation needs media.delete; the trash endpoints
+// only see the caller's own trash.
+type FileOperationsHandler struct {
+	operations  fileOperator
+	authService requestAuthService
+}
+
+// NewFileOperationsHandler creates a new FileOperationsHandler.
+func NewFileOperationsHandler(operations fileOperator, authService requestAuthService) *FileOperationsHandler {
+	return &FileOperationsHandler{
+		operations:  operations,
+		authService: authService,
+	}
+}
+
+// authorize resolves the caller and the actor their operations are
+// audited as. On failure it writes the error response itself and returns
+// false.
+func (h *FileOperationsHandler) authorize(c *gin.Context) (services.FileActor, bool) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDelete)
+	if !ok {
+		return services.FileActor{}, false
+	}
+	return services.FileActor{
+		UserID:    currentUser.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}, true
+}
+
+// MoveFile handles POST /api/v1/files/move.
+func (h *FileOperationsHandler) MoveFile(c *gin.Context) {
+	var req struct {
+		StorageRoot     string `json:"storage_root" binding:"required"`
+		Path            string `json:"path" binding:"required"`
+		DestStorageRoot string `json:"dest_storage_root"`
+		DestPath        string `json:"dest_path" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.operations.Move(c.Request.Context(), actor, services.FileMoveRequest{
+		StorageRoot:     req.StorageRoot,
+		Path:            req.Path,
+		DestStorageRoot: req.DestStorageRoot,
+		DestPath:        req.DestPath,
+	})
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to move file", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// RenameFile handles POST /api/v1/files/rename.
+func (h *FileOperationsHandler) RenameFile(c *gin.Context) {
+	var req struct {
+		StorageRoot string `json:"storage_root" binding:"required"`
+		Path        string `json:"path" binding:"required"`
+		NewName     string `json:"new_name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.operations.Rename(c.Request.Context(), actor, req.StorageRoot, req.Path, req.NewName)
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to rename file", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// DeleteFile handles POST /api/v1/files/delete. The file goes to the
+// caller's trash.
+func (h *FileOperationsHandler) DeleteFile(c *gin.Context) {
+	var req struct {
+		StorageRoot string `json:"storage_root" binding:"required"`
+		Path        string `json:"path" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	item, err := h.operations.Trash(c.Request.Context(), actor, req.StorageRoot, req.Path)
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to delete file", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": item})
+}
+
+// ListTrash handles GET /api/v1/trash.
+func (h *FileOperationsHandler) ListTrash(c *gin.Context) {
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.operations.ListTrash(c.Request.Context(), actor.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list trash", "details": err.Error()})
+		return
+	}
+	if items == nil {
+		items = []services.TrashItem{}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": items})
+}
+
+// RestoreTrash handles POST /api/v1/trash/:id/restore.
+func (h *FileOperationsHandler) RestoreTrash(c *gin.Context) {
+	id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	item, err := h.operations.RestoreTrash(c.Request.Context(), actor, id)
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to restore file", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": item})
+}
+
+// PurgeTrash handles DELETE /api/v1/trash/:id.
+func (h *FileOperationsHandler) PurgeTrash(c *gin.Context) {
+	id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	if err := h.operations.PurgeTrash(c.Request.Context(), actor, id); err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to purge file", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// EmptyTrash handles DELETE /api/v1/trash.
+func (h *FileOperationsHandler) EmptyTrash(c *gin.Context) {
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	purged, err := h.operations.EmptyTrash(c.Request.Context(), actor)
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to empty trash", "details": err.Error(),
+			"data": gin.H{"purged": purged}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"purged": purged}})
+}
+
+// ListShareTrash handles GET /api/v1/share-trash/:root.
+func (h *FileOperationsHandler) ListShareTrash(c *gin.Context) {
+	if _, ok := h.authorize(c); !ok {
+		return
+	}
+
+	listing, err := h.operations.ListShareTrash(c.Request.Context(), c.Param("root"))
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to list share trash", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": listing})
+}
+
+// RestoreShareTrash handles POST /api/v1/share-trash/:root/restore.
+func (h *FileOperationsHandler) RestoreShareTrash(c *gin.Context) {
+	var req struct {
+		TrashPath string `json:"trash_path" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	actor, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	item, err := h.operations.RestoreShareTrash(c.Request.Context(), actor, c.Param("root"), req.TrashPath)
+	if err != nil {
+		c.JSON(fileOperationErrorStatus(err), gin.H{"success": false, "error": "Failed to restore file", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": item})
+}
+
+func trashItemID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid trash item id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func fileOperationErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already exists"):
+		return http.StatusConflict
+	case strings.Contains(msg, "is locked"):
+		return http.StatusLocked
+	case strings.Contains(msg, "invalid"), strings.Contains(msg, "not supported"), strings.Contains(msg, "cannot be restored"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFileOperator struct {
+	err     error
+	actor   services.FileActor
+	moved   services.FileMoveRequest
+	renamed string
+	trashed string
+	items   []services.TrashItem
+	purged  int64
+	shared  string
+}
+
+func (f *fakeFileOperator) Move(ctx context.Context, actor services.FileActor, req services.FileMoveRequest) (*services.FileMove, error) {
+	f.actor, f.moved = actor, req
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.FileMove{StorageRoot: req.StorageRoot, Path: req.Path, DestStorageRoot: req.DestStorageRoot, DestPath: req.DestPath}, nil
+}
+
+func (f *fakeFileOperator) Rename(ctx context.Context, actor services.FileActor, storageRoot, filePath, newName string) (*services.FileMove, error) {
+	f.actor, f.renamed = actor, newName
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.FileMove{StorageRoot: storageRoot, Path: filePath, DestStorageRoot: storageRoot, DestPath: newName}, nil
+}
+
+func (f *fakeFileOperator) Trash(ctx context.Context, actor services.FileActor, storageRoot, filePath string) (*services.TrashItem, error) {
+	f.actor, f.trashed = actor, filePath
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.TrashItem{ID: 3, UserID: actor.UserID, StorageRoot: storageRoot, OriginalPath: filePath}, nil
+}
+
+func (f *fakeFileOperator) ListTrash(ctx context.Context, userID int) ([]services.TrashItem, error) {
+	return f.items, f.err
+}
+
+func (f *fakeFileOperator) RestoreTrash(ctx context.Context, actor services.FileActor, id int64) (*services.TrashItem, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.TrashItem{ID: id, UserID: actor.UserID}, nil
+}
+
+func (f *fakeFileOperator) PurgeTrash(ctx context.Context, actor services.FileActor, id int64) error {
+	f.purged = id
+	return f.err
+}
+
+func (f *fakeFileOperator) EmptyTrash(ctx context.Context, actor services.FileActor) (int, error) {
+	return len(f.items), f.err
+}
+
+func (f *fakeFileOperator) ListShareTrash(ctx context.Context, storageRoot string) (*services.ShareTrashListing, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.ShareTrashListing{StorageRoot: storageRoot, Items: []services.ShareTrashItem{
+		{StorageRoot: storageRoot, TrashPath: "#recycle/a.mkv", OriginalPath: "a.mkv", Restorable: true},
+	}}, nil
+}
+
+func (f *fakeFileOperator) RestoreShareTrash(ctx context.Context, actor services.FileActor, storageRoot, trashPath string) (*services.ShareTrashItem, error) {
+	f.actor, f.shared = actor, trashPath
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &services.ShareTrashItem{StorageRoot: storageRoot, TrashPath: trashPath, Restorable: true}, nil
+}
+
+func newFileOperationsTestRouter(ops *fakeFileOperator, auth *fakeRequestAuth) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewFileOperationsHandler(ops, auth)
+	r := gin.New()
+	r.POST("/files/move", h.MoveFile)
+	r.POST("/files/rename", h.RenameFile)
+	r.POST("/files/delete", h.DeleteFile)
+	r.GET("/trash", h.ListTrash)
+	r.DELETE("/trash", h.EmptyTrash)
+	r.POST("/trash/:id/restore", h.RestoreTrash)
+	r.DELETE("/trash/:id", h.PurgeTrash)
+	r.GET("/share-trash/:root", h.ListShareTrash)
+	r.POST("/share-trash/:root/restore", h.RestoreShareTrash)
+	return r
+}
+
+func serveFileOperation(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestFileOperationsHandler_Operations(t *testing.T) {
+	ops := &fakeFileOperator{items: []services.TrashItem{{ID: 3, OriginalPath: "films/a.mkv"}}}
+	auth := &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}
+	r := newFileOperationsTestRouter(ops, auth)
+
+	w := serveFileOperation(r, http.MethodPost, "/files/move",
+		`{"storage_root":"media","path":"films/a.mkv","dest_storage_root":"archive","dest_path":"a.mkv"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "archive", ops.moved.DestStorageRoot)
+	assert.Equal(t, 7, ops.actor.UserID)
+
+	w = serveFileOperation(r, http.MethodPost, "/files/rename", `{"storage_root":"media","path":"films/a.mkv","new_name":"b.mkv"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "b.mkv", ops.renamed)
+
+	w = serveFileOperation(r, http.MethodPost, "/files/delete", `{"storage_root":"media","path":"films/a.mkv"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Success bool               `json:"success"`
+		Data    services.TrashItem `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, int64(3), body.Data.ID)
+	assert.Equal(t, "films/a.mkv", ops.trashed)
+
+	w = serveFileOperation(r, http.MethodGet, "/trash", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"original_path":"films/a.mkv"`)
+
+	w = serveFileOperation(r, http.MethodPost, "/trash/3/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveFileOperation(r, http.MethodDelete, "/trash/3", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(3), ops.purged)
+	w = serveFileOperation(r, http.MethodDelete, "/trash", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"purged":1`)
+
+	w = serveFileOperation(r, http.MethodGet, "/share-trash/nas", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"trash_path":"#recycle/a.mkv"`)
+	w = serveFileOperation(r, http.MethodPost, "/share-trash/nas/restore", `{"trash_path":"#recycle/a.mkv"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "#recycle/a.mkv", ops.shared)
+}
+
+func TestFileOperationsHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   *fakeRequestAuth
+		err    error
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"no media.delete", &fakeRequestAuth{user: &models.User{ID: 7}}, nil,
+			http.MethodPost, "/files/delete", `{"storage_root":"media","path":"a.mkv"}`, http.StatusForbidden},
+		{"missing destination", &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}, nil,
+			http.MethodPost, "/files/move", `{"storage_root":"media","path":"a.mkv"}`, http.StatusBadRequest},
+		{"bad trash id", &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}, nil,
+			http.MethodDelete, "/trash/x", "", http.StatusBadRequest},
+		{"destination taken", &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}, fmt.Errorf("b.mkv already exists in media"),
+			http.MethodPost, "/files/rename", `{"storage_root":"media","path":"a.mkv","new_name":"b.mkv"}`, http.StatusConflict},
+		{"locked", &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}, fmt.Errorf("storage root media is locked"),
+			http.MethodPost, "/files/delete", `{"storage_root":"media","path":"a.mkv"}`, http.StatusLocked},
+		{"missing item", &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}, fmt.Errorf("trash item 9 not found"),
+			http.MethodPost, "/trash/9/restore", "", http.StatusNotFound},
+		{"share trash path unknown", &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true},
+			fmt.Errorf(".Trashes/501/a.mkv cannot be restored: the macos recycle bin does not record where it was"),
+			http.MethodPost, "/share-trash/nas/restore", `{"trash_path":".Trashes/501/a.mkv"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFileOperationsTestRouter(&fakeFileOperator{err: tt.err}, tt.auth)
+			w := serveFileOperation(r, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileSearcher defines the search methods used by FileSearchHandler.
+type fileSearcher interface {
+	Search(ctx context.Context, query string, opts services.FileSearchOptions) (*services.FileSearchResult, error)
+	RebuildIndex(ctx context.Context) (int64, error)
+}
+
+// FileSearchHandler serves full-text search with the structured query
+// language (type:video size:>1GB year:2020..2023 sort:-size ...).
+type FileSearchHandler struct {
+	search      fileSearcher
+	authService requestAuthService
+}
+
+// NewFileSearchHandler creates a new FileSearchHandler.
+func NewFileSearchHandler(search fileSearcher, authService requestAuthService) *FileSearchHandler {
+	return &FileSearchHandler{
+		search:      search,
+		authService: authService,
+	}
+}
+
+// Search handles GET /api/v1/search/v2.
+//
+// Query parameters: q (the search query), page, limit (default 50, at most
+// 200), sort (overrides sort: in q, e.g. -size) and include_deleted.
+func (h *FileSearchHandler) Search(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	opts := services.FileSearchOptions{
+		Page:           page,
+		Limit:          limit,
+		Sort:           c.Query("sort"),
+		IncludeDeleted: parseBool(c.Query("include_deleted"), false),
+	}
+
+	result, err := h.search.Search(c.Request.Context(), c.Query("q"), opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid search query") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Search failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// RebuildIndex handles POST /api/v1/search/v2/reindex. Requires
+// system.admin.
+func (h *FileSearchHandler) RebuildIndex(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	indexed, err := h.search.RebuildIndex(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to rebuild search index", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"indexed_files": indexed}})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileVersionService defines the version history methods used by FileVersionHandler.
+type fileVersionService interface {
+	ListVersions(ctx context.Context, fileID int64) ([]services.FileVersion, error)
+	RestoreVersion(ctx context.Context, fileID, versionID int64, userID int) (*services.FileVersion, error)
+	GetPolicy(ctx context.Context, storageRoot string) (*services.VersionRetentionPolicy, error)
+	SetPolicy(ctx context.Context, policy services.VersionRetentionPolicy) error
+}
+
+// FileVersionHandler exposes the version history kept for files overwritten
+// by uploads or sync, and the per-share retention policies.
+type FileVersionHandler struct {
+	versions    fileVersionService
+	authService requestAuthService
+}
+
+// NewFileVersionHandler creates a new FileVersionHandler.
+func NewFileVersionHandler(versions fileVersionService, authService requestAuthService) *FileVersionHandler {
+	return &FileVersionHandler{
+		versions:    versions,
+		authService: authService,
+	}
+}
+
+// ListVersions handles GET /api/v1/media/:id/versions.
+func (h *FileVersionHandler) ListVersions(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+
+	fileID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid media ID"})
+		return
+	}
+
+	versions, err := h.versions.ListVersions(c.Request.Context(), fileID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to list versions", "details": err.Error()})
+		return
+	}
+	if versions == nil {
+		versions = []services.FileVersion{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": versions})
+}
+
+// RestoreVersion handles POST /api/v1/media/:id/versions/:version_id/restore.
+func (h *FileVersionHandler) RestoreVersion(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaEdit)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid media ID"})
+		return
+	}
+	versionID, err := strconv.ParseInt(c.Param("version_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid version ID"})
+		return
+	}
+
+	version, err := h.versions.RestoreVersion(c.Request.Context(), fileID, versionID, currentUser.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to restore version", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": version})
+}
+
+// GetPolicy handles GET /api/v1/admin/version-policies/:root.
+func (h *FileVersionHandler) GetPolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	policy, err := h.versions.GetPolicy(c.Request.Context(), c.Param("root"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load version policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policy})
+}
+
+// SetPolicy handles PUT /api/v1/admin/version-policies/:root.
+func (h *FileVersionHandler) SetPolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req struct {
+		MaxVersions int `json:"max_versions"`
+		MaxAgeDays  int `json:"max_age_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	policy := services.VersionRetentionPolicy{
+		StorageRoot: c.Param("root"),
+		MaxVersions: req.MaxVersions,
+		MaxAgeDays:  req.MaxAgeDays,
+	}
+	if err := h.versions.SetPolicy(c.Request.Context(), policy); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid policy") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to save version policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policy})
+}
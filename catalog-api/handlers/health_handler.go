@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"catalogizer/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessProbeMaxAge is how long /health/ready reuses a probe, so that
+// frequent readiness checks do not hammer storage roots.
+const readinessProbeMaxAge = 5 * time.Second
+
+// readinessMonitor defines the dependency monitor methods used by
+// HealthHandler.
+type readinessMonitor interface {
+	ProbeFresh(ctx context.Context, maxAge time.Duration) []services.DependencyStatus
+	Ready() error
+}
+
+// storageBreakerReporter defines the storage circuit breaker method used
+// by HealthHandler.
+type storageBreakerReporter interface {
+	Statuses() []services.StorageBreakerStatus
+}
+
+// HealthHandler answers the liveness and readiness checks of process
+// supervisors and load balancers. Both are public.
+type HealthHandler struct {
+	monitor  readinessMonitor
+	breakers storageBreakerReporter
+	started  time.Time
+}
+
+// NewHealthHandler creates a new HealthHandler.
+func NewHealthHandler(monitor readinessMonitor) *HealthHandler {
+	return &HealthHandler{
+		monitor: monitor,
+		started: time.Now(),
+	}
+}
+
+// SetStorageBreakers adds the circuit breakers of storage roots to the
+// readiness report. An open breaker marks the server degraded.
+func (h *HealthHandler) SetStorageBreakers(breakers storageBreakerReporter) {
+	h.breakers = breakers
+}
+
+// Live handles GET /health/live. It answers 200 while the process serves
+// requests at all, without checking dependencies: restarting the server
+// does not bring back a database or a share.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "alive",
+		"time":           time.Now().UTC(),
+		"uptime_seconds": int64(time.Since(h.started).Seconds()),
+	})
+}
+
+// Ready handles GET /health/ready. It probes the dependencies and answers
+// 503 while a critical one is unavailable; others only mark the server
+// degraded.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	// A client giving up must not record its dependencies as unavailable;
+	// the monitor's own timeout bounds the probes
+	statuses := h.monitor.ProbeFresh(context.WithoutCancel(c.Request.Context()), readinessProbeMaxAge)
+
+	degraded := false
+	for _, status := range statuses {
+		if !status.Available {
+			degraded = true
+		}
+	}
+	body := gin.H{
+		"status":       "ready",
+		"time":         time.Now().UTC(),
+		"dependencies": statuses,
+	}
+	if h.breakers != nil {
+		breakers := h.breakers.Statuses()
+		for _, breaker := range breakers {
+			if breaker.State != services.StorageBreakerClosed {
+				degraded = true
+			}
+		}
+		body["storage_breakers"] = breakers
+	}
+	body["degraded"] = degraded
+	if err := h.monitor.Ready(); err != nil {
+		body["status"] = "not_ready"
+		body["reason"] = err.Error()
+		c.Header("Retry-After", dependencyRetryAfter)
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestHealthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	monitor := services.NewDependencyMonitor(zap.NewNop(), services.DependencyMonitorConfig{})
+	var dbErr error
+	monitor.RegisterCritical("database", services.DependencyKindService, func(context.Context) error { return dbErr })
+	monitor.Register("ffmpeg", services.DependencyKindBinary, func(context.Context) error { return errors.New("ffmpeg not found in PATH") })
+
+	h := NewHealthHandler(monitor)
+	r := gin.New()
+	r.GET("/health/live", h.Live)
+	r.GET("/health/ready", h.Ready)
+	get := func(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w, body
+	}
+
+	w, body := get("/health/ready")
+	require.Equal(t, http.StatusOK, w.Code, "a missing optional tool only degrades the server")
+	assert.Equal(t, "ready", body["status"])
+	assert.Equal(t, true, body["degraded"])
+	deps := body["dependencies"].([]interface{})
+	require.Len(t, deps, 2)
+	assert.Contains(t, deps[1], "latency_ms")
+
+	// A failed critical dependency answers 503
+	dbErr = errors.New("database is locked")
+	monitor.ProbeAll(context.Background())
+	w, body = get("/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "not_ready", body["status"])
+	assert.Contains(t, body["reason"], "database is locked")
+
+	w, body = get("/health/live")
+	assert.Equal(t, http.StatusOK, w.Code, "liveness ignores dependencies")
+	assert.Equal(t, "alive", body["status"])
+}
+
+func TestHealthHandler_StorageBreakers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	monitor := services.NewDependencyMonitor(zap.NewNop(), services.DependencyMonitorConfig{})
+	breakers := services.NewStorageBreakers(zap.NewNop(), services.StorageBreakerConfig{FailureThreshold: 1, InitialBackoff: time.Hour})
+	t.Cleanup(breakers.Stop)
+
+	h := NewHealthHandler(monitor)
+	h.SetStorageBreakers(breakers)
+	r := gin.New()
+	r.GET("/health/ready", h.Ready)
+
+	breakers.Record("nas", errors.New("connection refused"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	require.Equal(t, http.StatusOK, w.Code, "an unavailable storage root only degrades the server")
+	var body struct {
+		Degraded        bool                            `json:"degraded"`
+		StorageBreakers []services.StorageBreakerStatus `json:"storage_breakers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Degraded)
+	require.Len(t, body.StorageBreakers, 1)
+	assert.Equal(t, "nas", body.StorageBreakers[0].Root)
+	assert.Equal(t, services.StorageBreakerOpen, body.StorageBreakers[0].State)
+	assert.Equal(t, "connection refused", body.StorageBreakers[0].LastError)
+	assert.NotNil(t, body.StorageBreakers[0].NextProbeAt)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"catalogizer/models"
+	"catalogizer/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ldapService defines the directory account methods used by LDAPHandler.
+type ldapService interface {
+	ListLDAPAccounts() ([]models.LDAPAccount, error)
+	SyncLDAP(ctx context.Context) (*services.LDAPSyncResult, error)
+}
+
+// LDAPHandler lists the accounts linked to directory entries and syncs
+// them with the directory on demand. Every endpoint requires system.admin.
+type LDAPHandler struct {
+	ldap        ldapService
+	authService requestAuthService
+}
+
+// NewLDAPHandler creates a new LDAPHandler.
+func NewLDAPHandler(ldap ldapService, authService requestAuthService) *LDAPHandler {
+	return &LDAPHandler{
+		ldap:        ldap,
+		authService: authService,
+	}
+}
+
+// ListAccounts handles GET /api/v1/admin/ldap/accounts.
+func (h *LDAPHandler) ListAccounts(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	accounts, err := h.ldap.ListLDAPAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list directory accounts", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": accounts})
+}
+
+// Sync handles POST /api/v1/admin/ldap/sync. A sync stopped by a
+// directory error still reports what it changed before stopping.
+func (h *LDAPHandler) Sync(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	result, err := h.ldap.SyncLDAP(c.Request.Context())
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrLDAPNotConfigured):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrLDAPUnavailable):
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Directory sync failed", "details": err.Error(), "data": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
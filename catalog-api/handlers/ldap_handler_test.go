@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/models"
+	"catalogizer/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLDAPService struct {
+	syncErr error
+}
+
+func (f *fakeLDAPService) ListLDAPAccounts() ([]models.LDAPAccount, error) {
+	return []models.LDAPAccount{{UserID: 3, DN: "uid=alice,ou=people,dc=example,dc=org", Username: "alice"}}, nil
+}
+
+func (f *fakeLDAPService) SyncLDAP(ctx context.Context) (*services.LDAPSyncResult, error) {
+	if f.syncErr != nil {
+		return &services.LDAPSyncResult{Checked: 1}, f.syncErr
+	}
+	return &services.LDAPSyncResult{Checked: 2, Disabled: 1}, nil
+}
+
+func ldapRequest(auth requestAuthService, svc *fakeLDAPService, method, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewLDAPHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/ldap/accounts", h.ListAccounts)
+	r.POST("/admin/ldap/sync", h.Sync)
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLDAPHandler(t *testing.T) {
+	svc := &fakeLDAPService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, ldapRequest(viewer, svc, http.MethodGet, "/admin/ldap/accounts").Code)
+	assert.Equal(t, http.StatusForbidden, ldapRequest(viewer, svc, http.MethodPost, "/admin/ldap/sync").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := ldapRequest(admin, svc, http.MethodGet, "/admin/ldap/accounts")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"alice"`)
+
+	w = ldapRequest(admin, svc, http.MethodPost, "/admin/ldap/sync")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"disabled":1`)
+
+	svc.syncErr = fmt.Errorf("%w: connection refused", services.ErrLDAPUnavailable)
+	w = ldapRequest(admin, svc, http.MethodPost, "/admin/ldap/sync")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), `"checked":1`)
+
+	svc.syncErr = services.ErrLDAPNotConfigured
+	assert.Equal(t, http.StatusBadRequest, ldapRequest(admin, svc, http.MethodPost, "/admin/ldap/sync").Code)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// libraryHealthService defines the library health methods used by
+// LibraryHealthHandler.
+type libraryHealthService interface {
+	Report(ctx context.Context, trendDays int) (*services.LibraryHealthReport, error)
+	Enrich(ctx context.Context, section string) (int, error)
+}
+
+// LibraryHealthHandler reports how healthy each library section is and
+// runs the fixes the server can run itself. Every endpoint requires
+// system.admin.
+type LibraryHealthHandler struct {
+	health      libraryHealthService
+	authService requestAuthService
+}
+
+// NewLibraryHealthHandler creates a new LibraryHealthHandler.
+func NewLibraryHealthHandler(health libraryHealthService, authService requestAuthService) *LibraryHealthHandler {
+	return &LibraryHealthHandler{
+		health:      health,
+		authService: authService,
+	}
+}
+
+// GetLibraryHealth handles GET /api/v1/admin/library-health. The days
+// query parameter (default 30, 0 for none) sets how far back the trend
+// goes.
+func (h *LibraryHealthHandler) GetLibraryHealth(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	days := 30
+	if raw := c.Query("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "days must be between 0 and 365"})
+			return
+		}
+		days = parsed
+	}
+
+	report, err := h.health.Report(c.Request.Context(), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to compute library health", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// EnrichSection handles POST /api/v1/admin/library-health/:section/enrich.
+// Enrichment runs in the background; the response says how many items it
+// was started on.
+func (h *LibraryHealthHandler) EnrichSection(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	section := c.Param("section")
+	items, err := h.health.Enrich(c.Request.Context(), section)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrLibraryHealthFixRunning):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "not configured"):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to start enrichment", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": gin.H{"section": section, "items": items}})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLibraryHealthService struct {
+	trendDays int
+	running   bool
+}
+
+func (f *fakeLibraryHealthService) Report(ctx context.Context, trendDays int) (*services.LibraryHealthReport, error) {
+	f.trendDays = trendDays
+	return &services.LibraryHealthReport{Score: 83, Sections: []services.LibraryHealthSection{{
+		Section: "movie", Score: 83, Items: 4, MissingMetadata: 1,
+		Actions: []services.LibraryHealthAction{{Kind: services.LibraryHealthActionEnrich, Count: 1}},
+	}}}, nil
+}
+
+func (f *fakeLibraryHealthService) Enrich(ctx context.Context, section string) (int, error) {
+	if f.running {
+		return 0, services.ErrLibraryHealthFixRunning
+	}
+	f.running = true
+	return 1, nil
+}
+
+func libraryHealthRequest(auth requestAuthService, svc *fakeLibraryHealthService, method, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewLibraryHealthHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/library-health", h.GetLibraryHealth)
+	r.POST("/admin/library-health/:section/enrich", h.EnrichSection)
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLibraryHealthHandler(t *testing.T) {
+	svc := &fakeLibraryHealthService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, libraryHealthRequest(viewer, svc, http.MethodGet, "/admin/library-health").Code)
+	assert.Equal(t, http.StatusForbidden, libraryHealthRequest(viewer, svc, http.MethodPost, "/admin/library-health/movie/enrich").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := libraryHealthRequest(admin, svc, http.MethodGet, "/admin/library-health")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"kind":"enrich"`)
+	assert.Equal(t, 30, svc.trendDays)
+	require.Equal(t, http.StatusOK, libraryHealthRequest(admin, svc, http.MethodGet, "/admin/library-health?days=7").Code)
+	assert.Equal(t, 7, svc.trendDays)
+	assert.Equal(t, http.StatusBadRequest, libraryHealthRequest(admin, svc, http.MethodGet, "/admin/library-health?days=-1").Code)
+
+	w = libraryHealthRequest(admin, svc, http.MethodPost, "/admin/library-health/movie/enrich")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"items":1`)
+	assert.Equal(t, http.StatusConflict, libraryHealthRequest(admin, svc, http.MethodPost, "/admin/library-health/movie/enrich").Code)
+}
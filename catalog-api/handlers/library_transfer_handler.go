@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// libraryTransferService defines the export and import methods used by
+// LibraryTransferHandler.
+type libraryTransferService interface {
+	Export(ctx context.Context, userID int, request services.LibraryExportRequest) (*services.LibraryExport, error)
+	Import(ctx context.Context, userID int, export *services.LibraryExport) (*services.LibraryImportReport, error)
+}
+
+// LibraryTransferHandler exports collections and playlists and imports
+// them on another instance.
+type LibraryTransferHandler struct {
+	transfer    libraryTransferService
+	authService requestAuthService
+}
+
+// NewLibraryTransferHandler creates a new LibraryTransferHandler.
+func NewLibraryTransferHandler(transfer libraryTransferService, authService requestAuthService) *LibraryTransferHandler {
+	return &LibraryTransferHandler{
+		transfer:    transfer,
+		authService: authService,
+	}
+}
+
+// libraryTransferErrorStatus maps service errors to HTTP status codes.
+func libraryTransferErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// parseIDList parses a comma-separated list of IDs from a query parameter.
+func parseIDList(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid ID %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ExportLibrary handles GET /api/v1/library/export. The optional
+// collection_ids and playlist_ids query parameters take comma-separated
+// IDs; without them every collection and the caller's own playlists are
+// exported. The response is the export document itself, ready to be
+// posted to the import endpoint.
+func (h *LibraryTransferHandler) ExportLibrary(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+
+	var req services.LibraryExportRequest
+	var err error
+	if req.CollectionIDs, err = parseIDList(c.Query("collection_ids")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid collection_ids", "details": err.Error()})
+		return
+	}
+	if req.PlaylistIDs, err = parseIDList(c.Query("playlist_ids")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid playlist_ids", "details": err.Error()})
+		return
+	}
+
+	export, err := h.transfer.Export(c.Request.Context(), currentUser.ID, req)
+	if err != nil {
+		c.JSON(libraryTransferErrorStatus(err), gin.H{"success": false, "error": "Failed to export library", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="catalogizer-library-%s.json"`,
+		export.ExportedAt.Format("20060102-150405")))
+	c.JSON(http.StatusOK, export)
+}
+
+// ImportLibrary handles POST /api/v1/library/import. The body is an export
+// document. Playlists are created for the caller; importing collections
+// also requires media.manage.
+func (h *LibraryTransferHandler) ImportLibrary(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+
+	var export services.LibraryExport
+	if err := c.ShouldBindJSON(&export); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if len(export.Collections) > 0 {
+		if _, ok := requirePermission(c, h.authService, models.PermissionMediaManage); !ok {
+			return
+		}
+	}
+
+	report, err := h.transfer.Import(c.Request.Context(), currentUser.ID, &export)
+	if err != nil {
+		c.JSON(libraryTransferErrorStatus(err), gin.H{"success": false, "error": "Failed to import library", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLibraryTransferService struct {
+	exportRequest services.LibraryExportRequest
+	imported      *services.LibraryExport
+}
+
+func (f *fakeLibraryTransferService) Export(ctx context.Context, userID int, request services.LibraryExportRequest) (*services.LibraryExport, error) {
+	f.exportRequest = request
+	for _, id := range request.PlaylistIDs {
+		if id == 99 {
+			return nil, fmt.Errorf("playlist not found")
+		}
+	}
+	return &services.LibraryExport{
+		Version:    services.LibraryExportVersion,
+		ExportedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Playlists:  []services.ExportedPlaylist{{Name: "Mix"}},
+	}, nil
+}
+
+func (f *fakeLibraryTransferService) Import(ctx context.Context, userID int, export *services.LibraryExport) (*services.LibraryImportReport, error) {
+	if export.Version != services.LibraryExportVersion {
+		return nil, fmt.Errorf("invalid export: unsupported version")
+	}
+	f.imported = export
+	return &services.LibraryImportReport{
+		Unresolved: []services.UnresolvedLibraryItem{{Kind: "playlist", Container: "Mix", Position: 1}},
+	}, nil
+}
+
+func newLibraryTransferTestRouter(svc *fakeLibraryTransferService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewLibraryTransferHandler(svc, auth)
+	r := gin.New()
+	r.GET("/library/export", h.ExportLibrary)
+	r.POST("/library/import", h.ImportLibrary)
+	return r
+}
+
+func libraryTransferRequest(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLibraryTransferHandler_Export(t *testing.T) {
+	svc := &fakeLibraryTransferService{}
+	r := newLibraryTransferTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+
+	w := libraryTransferRequest(r, http.MethodGet, "/library/export?collection_ids=1,2&playlist_ids=5", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int64{1, 2}, svc.exportRequest.CollectionIDs)
+	assert.Equal(t, []int64{5}, svc.exportRequest.PlaylistIDs)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "catalogizer-library-20260301-120000.json")
+	var export services.LibraryExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, "Mix", export.Playlists[0].Name)
+
+	assert.Equal(t, http.StatusBadRequest, libraryTransferRequest(r, http.MethodGet, "/library/export?playlist_ids=x", "").Code)
+	assert.Equal(t, http.StatusNotFound, libraryTransferRequest(r, http.MethodGet, "/library/export?playlist_ids=99", "").Code)
+}
+
+func TestLibraryTransferHandler_Import(t *testing.T) {
+	svc := &fakeLibraryTransferService{}
+	auth := &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}}
+	r := newLibraryTransferTestRouter(svc, auth)
+
+	w := libraryTransferRequest(r, http.MethodPost, "/library/import", `{"version":1,"playlists":[{"name":"Mix","items":[{"title":"Song","sha256":"abc"}]}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"unresolved":[{"kind":"playlist","container":"Mix","position":1`)
+	require.NotNil(t, svc.imported)
+	assert.Equal(t, "abc", svc.imported.Playlists[0].Items[0].SHA256)
+
+	// Collections are shared, so importing them needs media.manage
+	svc.imported = nil
+	w = libraryTransferRequest(r, http.MethodPost, "/library/import", `{"version":1,"collections":[{"name":"Box set"}]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Nil(t, svc.imported)
+
+	auth.granted[models.PermissionMediaManage] = true
+	w = libraryTransferRequest(r, http.MethodPost, "/library/import", `{"version":1,"collections":[{"name":"Box set"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, libraryTransferRequest(r, http.MethodPost, "/library/import", `{"version":2}`).Code)
+	assert.Equal(t, http.StatusBadRequest, libraryTransferRequest(r, http.MethodPost, "/library/import", `not json`).Code)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lockdownService defines the ransomware detector methods used by LockdownHandler.
+type lockdownService interface {
+	ListLockdowns(ctx context.Context, activeOnly bool) ([]services.ShareLockdown, error)
+	Release(ctx context.Context, lockdownID int64, releasedBy int, note string) error
+}
+
+// LockdownHandler exposes admin endpoints for inspecting and manually
+// releasing ransomware-triggered share lockdowns.
+type LockdownHandler struct {
+	detector    lockdownService
+	authService requestAuthService
+}
+
+// NewLockdownHandler creates a new LockdownHandler.
+func NewLockdownHandler(detector lockdownService, authService requestAuthService) *LockdownHandler {
+	return &LockdownHandler{
+		detector:    detector,
+		authService: authService,
+	}
+}
+
+// ListLockdowns handles GET /api/v1/admin/lockdowns.
+// Pass ?active=true to list only lockdowns that are still in force.
+func (h *LockdownHandler) ListLockdowns(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	activeOnly := c.Query("active") == "true"
+	lockdowns, err := h.detector.ListLockdowns(c.Request.Context(), activeOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list lockdowns", "details": err.Error()})
+		return
+	}
+	if lockdowns == nil {
+		lockdowns = []services.ShareLockdown{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": lockdowns})
+}
+
+// ReleaseLockdown handles POST /api/v1/admin/lockdowns/:id/release.
+func (h *LockdownHandler) ReleaseLockdown(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	lockdownID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid lockdown ID"})
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	if err := h.detector.Release(c.Request.Context(), lockdownID, currentUser.ID, req.Note); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "already released") {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to release lockdown", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": fmt.Sprintf("Lockdown %d released", lockdownID)}})
+}
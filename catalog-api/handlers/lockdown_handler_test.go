@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRequestAuth struct {
+	user    *models.User
+	allowed bool
+}
+
+func (f *fakeRequestAuth) GetCurrentUser(token string) (*models.User, error) {
+	if f.user == nil || token != "valid" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return f.user, nil
+}
+
+func (f *fakeRequestAuth) CheckPermission(userID int, permission string) (bool, error) {
+	return f.allowed, nil
+}
+
+type fakeLockdownService struct {
+	lockdowns  []services.ShareLockdown
+	releaseErr error
+	releasedID int64
+	releasedBy int
+	note       string
+}
+
+func (f *fakeLockdownService) ListLockdowns(ctx context.Context, activeOnly bool) ([]services.ShareLockdown, error) {
+	return f.lockdowns, nil
+}
+
+func (f *fakeLockdownService) Release(ctx context.Context, lockdownID int64, releasedBy int, note string) error {
+	f.releasedID = lockdownID
+	f.releasedBy = releasedBy
+	f.note = note
+	return f.releaseErr
+}
+
+func newLockdownTestRouter(svc *fakeLockdownService, auth *fakeRequestAuth) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewLockdownHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/lockdowns", h.ListLockdowns)
+	r.POST("/admin/lockdowns/:id/release", h.ReleaseLockdown)
+	return r
+}
+
+func TestLockdownHandler_ListLockdowns(t *testing.T) {
+	svc := &fakeLockdownService{lockdowns: []services.ShareLockdown{{ID: 1, StorageRoot: "nas", Status: "active"}}}
+	auth := &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}
+	r := newLockdownTestRouter(svc, auth)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/lockdowns?active=true", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Success bool                     `json:"success"`
+		Data    []services.ShareLockdown `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Success)
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, "nas", body.Data[0].StorageRoot)
+}
+
+func TestLockdownHandler_RequiresAdmin(t *testing.T) {
+	svc := &fakeLockdownService{}
+
+	tests := []struct {
+		name   string
+		auth   *fakeRequestAuth
+		header string
+		code   int
+	}{
+		{"missing token", &fakeRequestAuth{user: &models.User{ID: 1}, allowed: true}, "", http.StatusUnauthorized},
+		{"invalid token", &fakeRequestAuth{user: &models.User{ID: 1}, allowed: true}, "Bearer bogus", http.StatusUnauthorized},
+		{"not admin", &fakeRequestAuth{user: &models.User{ID: 1}, allowed: false}, "Bearer valid", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLockdownTestRouter(svc, tt.auth)
+			req := httptest.NewRequest(http.MethodGet, "/admin/lockdowns", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestLockdownHandler_ReleaseLockdown(t *testing.T) {
+	auth := &fakeRequestAuth{user: &models.User{ID: 7}, allowed: true}
+
+	tests := []struct {
+		name string
+		path string
+		err  error
+		code int
+	}{
+		{"success", "/admin/lockdowns/3/release", nil, http.StatusOK},
+		{"invalid id", "/admin/lockdowns/abc/release", nil, http.StatusBadRequest},
+		{"not found", "/admin/lockdowns/3/release", fmt.Errorf("lockdown not found"), http.StatusNotFound},
+		{"already released", "/admin/lockdowns/3/release", fmt.Errorf("lockdown already released"), http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeLockdownService{releaseErr: tt.err}
+			r := newLockdownTestRouter(svc, auth)
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"note":"checked"}`))
+			req.Header.Set("Authorization", "Bearer valid")
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.name == "success" {
+				assert.Equal(t, int64(3), svc.releasedID)
+				assert.Equal(t, 7, svc.releasedBy)
+				assert.Equal(t, "checked", svc.note)
+			}
+		})
+	}
+}
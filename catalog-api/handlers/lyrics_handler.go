@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lyricsService defines the media lyrics methods used by LyricsHandler.
+type lyricsService interface {
+	GetMediaLyrics(ctx context.Context, userID, mediaItemID int64, language string, refresh bool) (*services.LyricsData, error)
+	SetMediaLyrics(ctx context.Context, mediaItemID int64, language, content string) (*services.LyricsData, error)
+	DeleteMediaLyrics(ctx context.Context, mediaItemID int64, language string) error
+}
+
+// LyricsHandler serves cached and fetched lyrics for media items.
+type LyricsHandler struct {
+	lyrics      lyricsService
+	authService requestAuthService
+}
+
+// NewLyricsHandler creates a new LyricsHandler.
+func NewLyricsHandler(lyrics lyricsService, authService requestAuthService) *LyricsHandler {
+	return &LyricsHandler{
+		lyrics:      lyrics,
+		authService: authService,
+	}
+}
+
+// SetLyricsRequest is the body of PUT /api/v1/media/:id/lyrics. Content
+// may be plain text or LRC timed lyrics.
+type SetLyricsRequest struct {
+	Language string `json:"language" binding:"required"`
+	Content  string `json:"content" binding:"required"`
+}
+
+// lyricsErrorStatus maps service errors to HTTP status codes.
+func lyricsErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GetMediaLyrics handles GET /api/v1/media/:id/lyrics. The optional lang
+// query parameter asks for one language; without it the caller's lyrics
+// language priority list is used. refresh=true searches the providers
+// again instead of using cached lyrics, and format=lrc returns timed
+// lyrics as an LRC file.
+func (h *LyricsHandler) GetMediaLyrics(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "media")
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "lrc" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid format, expected json or lrc"})
+		return
+	}
+
+	lyrics, err := h.lyrics.GetMediaLyrics(c.Request.Context(), int64(currentUser.ID), mediaItemID,
+		c.Query("lang"), c.Query("refresh") == "true")
+	if err != nil {
+		c.JSON(lyricsErrorStatus(err), gin.H{"success": false, "error": "Failed to get lyrics", "details": err.Error()})
+		return
+	}
+
+	if format == "lrc" {
+		if !lyrics.IsSynced || len(lyrics.SyncData) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "No timed lyrics for this media item"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%d.%s.lrc"`, mediaItemID, lyrics.Language))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(services.FormatLRC(lyrics.SyncData, nil)))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": lyrics})
+}
+
+// SetMediaLyrics handles PUT /api/v1/media/:id/lyrics, storing lyrics
+// supplied by the caller in place of cached ones in that language.
+func (h *LyricsHandler) SetMediaLyrics(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaEdit); !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "media")
+	if !ok {
+		return
+	}
+
+	var req SetLyricsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	lyrics, err := h.lyrics.SetMediaLyrics(c.Request.Context(), mediaItemID, req.Language, req.Content)
+	if err != nil {
+		c.JSON(lyricsErrorStatus(err), gin.H{"success": false, "error": "Failed to save lyrics", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": lyrics})
+}
+
+// DeleteMediaLyrics handles DELETE /api/v1/media/:id/lyrics. The optional
+// lang query parameter limits it to one language; the lyrics are fetched
+// again on the next request.
+func (h *LyricsHandler) DeleteMediaLyrics(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaEdit); !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "media")
+	if !ok {
+		return
+	}
+
+	if err := h.lyrics.DeleteMediaLyrics(c.Request.Context(), mediaItemID, c.Query("lang")); err != nil {
+		c.JSON(lyricsErrorStatus(err), gin.H{"success": false, "error": "Failed to delete lyrics", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLyricsService struct {
+	userID   int64
+	language string
+	refresh  bool
+	saved    string
+	deleted  string
+}
+
+func (f *fakeLyricsService) GetMediaLyrics(ctx context.Context, userID, mediaItemID int64, language string, refresh bool) (*services.LyricsData, error) {
+	f.userID, f.language, f.refresh = userID, language, refresh
+	switch mediaItemID {
+	case 1:
+		end := 2.5
+		return &services.LyricsData{MediaItemID: 1, Language: "en", Content: "One\nTwo", IsSynced: true,
+			SyncData: []services.LyricsLine{{StartTime: 1, EndTime: &end, Text: "One"}, {StartTime: 2.5, Text: "Two"}}}, nil
+	case 2:
+		return &services.LyricsData{MediaItemID: 2, Language: "de", Content: "Eins"}, nil
+	}
+	return nil, fmt.Errorf("lyrics not found")
+}
+
+func (f *fakeLyricsService) SetMediaLyrics(ctx context.Context, mediaItemID int64, language, content string) (*services.LyricsData, error) {
+	if language == "x" {
+		return nil, fmt.Errorf("invalid lyrics: language is required")
+	}
+	f.saved = content
+	return &services.LyricsData{MediaItemID: mediaItemID, Language: language, Content: content, Source: "user"}, nil
+}
+
+func (f *fakeLyricsService) DeleteMediaLyrics(ctx context.Context, mediaItemID int64, language string) error {
+	if mediaItemID == 9 {
+		return fmt.Errorf("lyrics not found")
+	}
+	f.deleted = language
+	return nil
+}
+
+func newLyricsTestRouter(svc *fakeLyricsService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewLyricsHandler(svc, auth)
+	r := gin.New()
+	r.GET("/media/:id/lyrics", h.GetMediaLyrics)
+	r.PUT("/media/:id/lyrics", h.SetMediaLyrics)
+	r.DELETE("/media/:id/lyrics", h.DeleteMediaLyrics)
+	return r
+}
+
+func lyricsRequest(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLyricsHandler_GetMediaLyrics(t *testing.T) {
+	svc := &fakeLyricsService{}
+	r := newLyricsTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+
+	w := lyricsRequest(r, http.MethodGet, "/media/1/lyrics?lang=en-US&refresh=true", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), svc.userID)
+	assert.Equal(t, "en-US", svc.language)
+	assert.True(t, svc.refresh)
+	var resp struct {
+		Data services.LyricsData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "One\nTwo", resp.Data.Content)
+	assert.Len(t, resp.Data.SyncData, 2)
+
+	w = lyricsRequest(r, http.MethodGet, "/media/1/lyrics?format=lrc", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[00:01.00]One\n[00:02.50]Two\n", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "1.en.lrc")
+	assert.False(t, svc.refresh)
+
+	assert.Equal(t, http.StatusNotFound, lyricsRequest(r, http.MethodGet, "/media/2/lyrics?format=lrc", "").Code)
+	assert.Equal(t, http.StatusBadRequest, lyricsRequest(r, http.MethodGet, "/media/2/lyrics?format=srt", "").Code)
+	assert.Equal(t, http.StatusNotFound, lyricsRequest(r, http.MethodGet, "/media/3/lyrics", "").Code)
+	assert.Equal(t, http.StatusBadRequest, lyricsRequest(r, http.MethodGet, "/media/abc/lyrics", "").Code)
+}
+
+func TestLyricsHandler_SetAndDeleteMediaLyrics(t *testing.T) {
+	svc := &fakeLyricsService{}
+	viewer := newLyricsTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+	assert.Equal(t, http.StatusForbidden, lyricsRequest(viewer, http.MethodPut, "/media/1/lyrics", `{"language":"en","content":"Words"}`).Code)
+	assert.Equal(t, http.StatusForbidden, lyricsRequest(viewer, http.MethodDelete, "/media/1/lyrics", "").Code)
+
+	r := newLyricsTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaEdit: true}})
+	w := lyricsRequest(r, http.MethodPut, "/media/1/lyrics", `{"language":"en","content":"Words"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Words", svc.saved)
+	assert.Equal(t, http.StatusBadRequest, lyricsRequest(r, http.MethodPut, "/media/1/lyrics", `{"language":"en"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, lyricsRequest(r, http.MethodPut, "/media/1/lyrics", `{"language":"x","content":"Words"}`).Code)
+
+	require.Equal(t, http.StatusOK, lyricsRequest(r, http.MethodDelete, "/media/1/lyrics?lang=en", "").Code)
+	assert.Equal(t, "en", svc.deleted)
+	assert.Equal(t, http.StatusNotFound, lyricsRequest(r, http.MethodDelete, "/media/9/lyrics", "").Code)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceService defines the catalog maintenance methods used by
+// MaintenanceHandler.
+type maintenanceService interface {
+	Status(ctx context.Context) (*services.MaintenanceStatus, error)
+	UpdateSchedule(ctx context.Context, req services.MaintenanceScheduleRequest) (*services.MaintenanceSchedule, error)
+	StartRun(ctx context.Context, fullVacuum bool) (*services.MaintenanceRun, error)
+	ListRuns(ctx context.Context, limit int) ([]services.MaintenanceRun, error)
+	GetRun(ctx context.Context, id int64) (*services.MaintenanceRun, error)
+}
+
+// MaintenanceHandler reports the size of the catalog database and runs
+// and schedules its compaction. Every endpoint requires system.admin.
+type MaintenanceHandler struct {
+	maintenance maintenanceService
+	authService requestAuthService
+}
+
+// NewMaintenanceHandler creates a new MaintenanceHandler.
+func NewMaintenanceHandler(maintenance maintenanceService, authService requestAuthService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		maintenance: maintenance,
+		authService: authService,
+	}
+}
+
+// maintenanceErrorStatus maps service errors to HTTP status codes.
+func maintenanceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMaintenanceRunning):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetStatus handles GET /api/v1/admin/maintenance. The next scheduled run
+// is given in UTC and in the caller's time zone.
+func (h *MaintenanceHandler) GetStatus(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	status, err := h.maintenance.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{"success": false, "error": "Failed to load maintenance status", "details": err.Error()})
+		return
+	}
+	if status.Schedule != nil {
+		status.Schedule.Localize(currentUser.Location())
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// UpdateSchedule handles PUT /api/v1/admin/maintenance/schedule.
+func (h *MaintenanceHandler) UpdateSchedule(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var req services.MaintenanceScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	schedule, err := h.maintenance.UpdateSchedule(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{"success": false, "error": "Failed to update maintenance schedule", "details": err.Error()})
+		return
+	}
+	schedule.Localize(currentUser.Location())
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schedule})
+}
+
+// StartRun handles POST /api/v1/admin/maintenance/run. The run goes on in
+// the background; its progress is read from the runs endpoints.
+func (h *MaintenanceHandler) StartRun(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req struct {
+		FullVacuum bool `json:"full_vacuum"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+
+	run, err := h.maintenance.StartRun(c.Request.Context(), req.FullVacuum)
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{"success": false, "error": "Failed to start maintenance", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": run})
+}
+
+// ListRuns handles GET /api/v1/admin/maintenance/runs.
+func (h *MaintenanceHandler) ListRuns(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	runs, err := h.maintenance.ListRuns(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{"success": false, "error": "Failed to list maintenance runs", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runs})
+}
+
+// GetRun handles GET /api/v1/admin/maintenance/runs/:id.
+func (h *MaintenanceHandler) GetRun(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid maintenance run ID"})
+		return
+	}
+	run, err := h.maintenance.GetRun(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{"success": false, "error": "Failed to load maintenance run", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMaintenanceService struct {
+	running    bool
+	fullVacuum bool
+	schedule   services.MaintenanceScheduleRequest
+}
+
+func (f *fakeMaintenanceService) Status(ctx context.Context) (*services.MaintenanceStatus, error) {
+	return &services.MaintenanceStatus{
+		Size: &services.DatabaseSize{TotalBytes: 4096000, FreeBytes: 1024000},
+		Schedule: &services.MaintenanceSchedule{
+			Cron: "30 3 * * *", TimeZone: "Europe/Belgrade", Enabled: true, WindowMinutes: 60, NextRunAt: &nextMaintenanceRun,
+		},
+	}, nil
+}
+
+var nextMaintenanceRun = time.Date(2026, 10, 17, 3, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+// zonedAuth is permissionAuth for a user who has set a time zone.
+type zonedAuth struct {
+	permissionAuth
+	timeZone string
+}
+
+func (z *zonedAuth) GetCurrentUser(token string) (*models.User, error) {
+	return &models.User{ID: 1, TimeZone: &z.timeZone}, nil
+}
+
+func (f *fakeMaintenanceService) UpdateSchedule(ctx context.Context, req services.MaintenanceScheduleRequest) (*services.MaintenanceSchedule, error) {
+	if req.Cron != nil && *req.Cron == "never" {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", *req.Cron)
+	}
+	f.schedule = req
+	return &services.MaintenanceSchedule{Cron: *req.Cron, Enabled: true, WindowMinutes: 60}, nil
+}
+
+func (f *fakeMaintenanceService) StartRun(ctx context.Context, fullVacuum bool) (*services.MaintenanceRun, error) {
+	if f.running {
+		return nil, services.ErrMaintenanceRunning
+	}
+	f.running, f.fullVacuum = true, fullVacuum
+	return &services.MaintenanceRun{ID: 7, Status: services.MaintenanceRunning, FullVacuum: fullVacuum}, nil
+}
+
+func (f *fakeMaintenanceService) ListRuns(ctx context.Context, limit int) ([]services.MaintenanceRun, error) {
+	return []services.MaintenanceRun{{ID: 7, Status: services.MaintenanceCompleted, ReclaimedBytes: 1024000}}, nil
+}
+
+func (f *fakeMaintenanceService) GetRun(ctx context.Context, id int64) (*services.MaintenanceRun, error) {
+	if id != 7 {
+		return nil, fmt.Errorf("maintenance run %d not found", id)
+	}
+	return &services.MaintenanceRun{ID: 7, Status: services.MaintenanceCompleted}, nil
+}
+
+func maintenanceRequest(auth requestAuthService, svc *fakeMaintenanceService, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewMaintenanceHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/maintenance", h.GetStatus)
+	r.PUT("/admin/maintenance/schedule", h.UpdateSchedule)
+	r.POST("/admin/maintenance/run", h.StartRun)
+	r.GET("/admin/maintenance/runs", h.ListRuns)
+	r.GET("/admin/maintenance/runs/:id", h.GetRun)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	svc := &fakeMaintenanceService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, maintenanceRequest(viewer, svc, http.MethodGet, "/admin/maintenance", "").Code)
+	assert.Equal(t, http.StatusForbidden, maintenanceRequest(viewer, svc, http.MethodPost, "/admin/maintenance/run", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := maintenanceRequest(admin, svc, http.MethodGet, "/admin/maintenance", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"free_bytes":1024000`)
+
+	w = maintenanceRequest(admin, svc, http.MethodPut, "/admin/maintenance/schedule", `{"cron":"0 4 * * 0"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, svc.schedule.WindowMinutes)
+	assert.Equal(t, http.StatusBadRequest,
+		maintenanceRequest(admin, svc, http.MethodPut, "/admin/maintenance/schedule", `{"cron":"never"}`).Code)
+
+	w = maintenanceRequest(admin, svc, http.MethodPost, "/admin/maintenance/run", `{"full_vacuum":true}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.True(t, svc.fullVacuum)
+	assert.Equal(t, http.StatusConflict, maintenanceRequest(admin, svc, http.MethodPost, "/admin/maintenance/run", "").Code)
+
+	w = maintenanceRequest(admin, svc, http.MethodGet, "/admin/maintenance/runs", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"reclaimed_bytes":1024000`)
+	assert.Equal(t, http.StatusOK, maintenanceRequest(admin, svc, http.MethodGet, "/admin/maintenance/runs/7", "").Code)
+	assert.Equal(t, http.StatusNotFound, maintenanceRequest(admin, svc, http.MethodGet, "/admin/maintenance/runs/8", "").Code)
+	assert.Equal(t, http.StatusBadRequest, maintenanceRequest(admin, svc, http.MethodGet, "/admin/maintenance/runs/x", "").Code)
+}
+
+func TestMaintenanceHandler_LocalTimes(t *testing.T) {
+	svc := &fakeMaintenanceService{}
+	tokyo := &zonedAuth{permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}, "Asia/Tokyo"}
+	w := maintenanceRequest(tokyo, svc, http.MethodGet, "/admin/maintenance", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"next_run_at":"2026-10-17T01:30:00Z"`)
+	assert.Contains(t, w.Body.String(), `"next_run_at_local":"2026-10-17T10:30:00+09:00"`)
+	assert.Contains(t, w.Body.String(), `"display_time_zone":"Asia/Tokyo"`)
+
+	// Users without a time zone see UTC
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w = maintenanceRequest(admin, svc, http.MethodGet, "/admin/maintenance", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"next_run_at_local":"2026-10-17T01:30:00Z"`)
+	assert.Contains(t, w.Body.String(), `"display_time_zone":"UTC"`)
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"catalogizer/internal/media/models"
+	"catalogizer/internal/services"
 	"catalogizer/repository"
 	"catalogizer/utils"
 
@@ -18,6 +22,7 @@ type MediaEntityHandler struct {
 	fileRepo     *repository.MediaFileRepository
 	extMetaRepo  *repository.ExternalMetadataRepository
 	userMetaRepo *repository.UserMetadataRepository
+	watch        *services.MediaWatchService
 }
 
 // NewMediaEntityHandler creates a new media entity handler.
@@ -32,6 +37,7 @@ func NewMediaEntityHandler(
 		fileRepo:     fileRepo,
 		extMetaRepo:  extMetaRepo,
 		userMetaRepo: userMetaRepo,
+		watch:        services.NewMediaWatchService(fileRepo, userMetaRepo),
 	}
 }
 
@@ -74,7 +80,7 @@ func (h *MediaEntityHandler) ListEntities(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"items":  itemsToJSON(items),
+		"items":  h.itemsWithEditions(ctx, items),
 		"total":  total,
 		"limit":  limit,
 		"offset": offset,
@@ -118,6 +124,23 @@ func (h *MediaEntityHandler) GetEntity(c *gin.Context) {
 	}
 
 	result := entityDetailJSON(item, typeName, fileCount, int64(childrenCount), extMeta)
+
+	// Describe items split across files and episodes sharing a file
+	files, _ := h.fileRepo.GetFilesByItem(ctx, id)
+	if parts := entityParts(files); len(parts) > 1 {
+		result["part_count"] = len(parts)
+	}
+	for _, f := range files {
+		if f.SegmentIndex != nil && f.SegmentCount != nil {
+			result["segment_index"] = *f.SegmentIndex
+			result["segment_count"] = *f.SegmentCount
+			break
+		}
+	}
+	if editions := entityEditions(id, files); len(editions) > 0 {
+		result["editions"] = editions
+	}
+
 	c.JSON(http.StatusOK, result)
 }
 
@@ -141,7 +164,7 @@ func (h *MediaEntityHandler) GetEntityChildren(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"items":  itemsToJSON(items),
+		"items":  h.itemsWithEditions(ctx, items),
 		"total":  total,
 		"limit":  limit,
 		"offset": offset,
@@ -191,6 +214,24 @@ func (h *MediaEntityHandler) GetEntityMetadata(c *gin.Context) {
 	})
 }
 
+// MetadataVersion validates conditional requests for GetEntityMetadata by
+// the entity's external metadata records.
+func (h *MediaEntityHandler) MetadataVersion(c *gin.Context) (string, time.Time, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	count, maxID, lastFetched, err := h.extMetaRepo.Version(c.Request.Context(), id)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	var modified time.Time
+	if lastFetched > 0 {
+		modified = time.Unix(lastFetched, 0).UTC()
+	}
+	return fmt.Sprintf("metadata:%d:%d-%d-%d", id, count, maxID, lastFetched), modified, true
+}
+
 // GetEntityDuplicates handles GET /api/v1/entities/:id/duplicates.
 func (h *MediaEntityHandler) GetEntityDuplicates(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -286,7 +327,7 @@ func (h *MediaEntityHandler) BrowseByType(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"items":  itemsToJSON(items),
+		"items":  h.itemsWithEditions(ctx, items),
 		"total":  total,
 		"type":   typeName,
 		"limit":  limit,
@@ -331,17 +372,9 @@ func (h *MediaEntityHandler) UpdateUserMetadata(c *gin.Context) {
 		return
 	}
 
-	// Extract user ID from JWT context (default to 1 for now)
-	userID := int64(1)
-	if uid, exists := c.Get("user_id"); exists {
-		if uidInt, ok := uid.(int64); ok {
-			userID = uidInt
-		}
-	}
-
 	um := &models.UserMetadata{
 		MediaItemID:   id,
-		UserID:        userID,
+		UserID:        entityUserID(c),
 		UserRating:    req.UserRating,
 		WatchedStatus: req.WatchedStatus,
 		PersonalNotes: req.PersonalNotes,
@@ -379,6 +412,10 @@ func (h *MediaEntityHandler) GetEntityStats(c *gin.Context) {
 }
 
 // StreamEntity handles GET /api/v1/entities/:id/stream — returns streaming info for primary file.
+// ?edition= limits it to one edition of the title, keyed as in GetEntity.
+// Items split across files, such as CD1 and CD2 of a movie, stream one part
+// at a time: ?part= picks a part, and next_stream_url points at the part to
+// advance to when it ends.
 func (h *MediaEntityHandler) StreamEntity(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -393,6 +430,12 @@ func (h *MediaEntityHandler) StreamEntity(c *gin.Context) {
 		utils.SendErrorResponse(c, http.StatusNotFound, "No files available for streaming", err)
 		return
 	}
+	if key := c.Query("edition"); key != "" {
+		if files = filesOfEdition(files, key); len(files) == 0 {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Edition not found", nil)
+			return
+		}
+	}
 
 	// Find primary file or use first one
 	primary := files[0]
@@ -403,14 +446,105 @@ func (h *MediaEntityHandler) StreamEntity(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	parts := entityParts(files)
+	if len(parts) < 2 {
+		parts = nil
+	}
+	current := 0
+	if partStr := c.Query("part"); partStr != "" {
+		part, err := strconv.Atoi(partStr)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid part number", err)
+			return
+		}
+		current = -1
+		for i, p := range parts {
+			if *p.PartNumber == part {
+				current = i
+				break
+			}
+		}
+		if current < 0 {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Part not found", nil)
+			return
+		}
+	}
+	if parts != nil {
+		primary = parts[current]
+	}
+
+	result := gin.H{
 		"entity_id":  id,
 		"file_id":    primary.FileID,
 		"stream_url": fmt.Sprintf("/api/v1/download/file/%d", primary.FileID),
+	}
+	if parts != nil {
+		partsJSON := make([]gin.H, 0, len(parts))
+		for _, p := range parts {
+			partsJSON = append(partsJSON, gin.H{
+				"part_number": *p.PartNumber,
+				"file_id":     p.FileID,
+				"stream_url":  fmt.Sprintf("/api/v1/download/file/%d", p.FileID),
+			})
+		}
+		result["part_number"] = *primary.PartNumber
+		result["parts"] = partsJSON
+		if current+1 < len(parts) {
+			next := parts[current+1]
+			result["next_part"] = *next.PartNumber
+			result["next_stream_url"] = fmt.Sprintf("/api/v1/download/file/%d", next.FileID)
+		}
+	}
+	// An episode sharing a file with others plays its share of the file
+	if primary.SegmentIndex != nil && primary.SegmentCount != nil {
+		result["segment_index"] = *primary.SegmentIndex
+		result["segment_count"] = *primary.SegmentCount
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RecordProgress handles POST /api/v1/entities/:id/progress — records how far
+// one of the entity's files was played and updates the watch state of the
+// entity, or of each episode the file holds.
+func (h *MediaEntityHandler) RecordProgress(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid entity ID", err)
+		return
+	}
+
+	var req struct {
+		FileID   int64   `json:"file_id" binding:"required"`
+		Position float64 `json:"position"`
+		Duration float64 `json:"duration" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	states, err := h.watch.RecordProgress(c.Request.Context(), entityUserID(c), id, req.FileID, req.Position, req.Duration)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "invalid"):
+			status = http.StatusBadRequest
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		}
+		utils.SendErrorResponse(c, status, "Failed to record progress", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entity_id":    id,
+		"watch_states": states,
 	})
 }
 
 // DownloadEntity handles GET /api/v1/entities/:id/download — returns download info.
+// ?edition= limits it to one edition of the title, keyed as in GetEntity.
 func (h *MediaEntityHandler) DownloadEntity(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -427,6 +561,12 @@ func (h *MediaEntityHandler) DownloadEntity(c *gin.Context) {
 		utils.SendErrorResponse(c, http.StatusNotFound, "No files available for download", err)
 		return
 	}
+	if key := c.Query("edition"); key != "" {
+		if files = filesOfEdition(files, key); len(files) == 0 {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Edition not found", nil)
+			return
+		}
+	}
 
 	target := files[0]
 	if fileIDStr != "" {
@@ -531,6 +671,124 @@ func (h *MediaEntityHandler) ListDuplicateGroups(c *gin.Context) {
 	})
 }
 
+// entityUserID returns the user ID from the JWT context (default to 1 for now).
+func entityUserID(c *gin.Context) int64 {
+	if uid, exists := c.Get("user_id"); exists {
+		if uidInt, ok := uid.(int64); ok {
+			return uidInt
+		}
+	}
+	return 1
+}
+
+// entityParts returns the files of an item that are numbered parts of it,
+// in order.
+func entityParts(files []repository.MediaFileRecord) []repository.MediaFileRecord {
+	var parts []repository.MediaFileRecord
+	for _, f := range files {
+		if f.PartNumber != nil {
+			parts = append(parts, f)
+		}
+	}
+	return parts
+}
+
+// itemsWithEditions renders entities for lists, naming the editions of
+// those with several, such as an extended cut beside the theatrical one.
+func (h *MediaEntityHandler) itemsWithEditions(ctx context.Context, items []*models.MediaItem) []gin.H {
+	result := itemsToJSON(items)
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	editions, err := h.fileRepo.GetEditionsByItems(ctx, ids)
+	if err != nil {
+		return result
+	}
+	for i, item := range items {
+		if len(editions[item.ID]) < 2 {
+			continue
+		}
+		labels := make([]string, 0, len(editions[item.ID]))
+		for _, e := range editions[item.ID] {
+			labels = append(labels, editionLabel(e.Edition, e.Quality))
+		}
+		result[i]["editions"] = labels
+	}
+	return result
+}
+
+// fileEdition returns the edition and resolution of a file, and false for
+// files naming neither.
+func fileEdition(f repository.MediaFileRecord) (edition, quality string, ok bool) {
+	if f.Edition == nil && f.QualityInfo == nil {
+		return "", "", false
+	}
+	if f.Edition != nil {
+		edition = *f.Edition
+	}
+	if f.QualityInfo != nil {
+		quality = *f.QualityInfo
+	}
+	return edition, quality, true
+}
+
+// editionLabel names an edition in one resolution, such as "Extended 2160p".
+func editionLabel(edition, quality string) string {
+	if edition == "" {
+		edition = "Standard"
+	}
+	return strings.TrimSpace(edition + " " + quality)
+}
+
+// editionKey turns an edition label into its key in URLs, such as
+// "directors-cut-2160p".
+func editionKey(label string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(label, "'", ""), " ", "-"))
+}
+
+// entityEditions groups the files of an entity by edition, with the URLs
+// that stream or download each.
+func entityEditions(id int64, files []repository.MediaFileRecord) []gin.H {
+	var editions []gin.H
+	byKey := make(map[string]gin.H)
+	for _, f := range files {
+		edition, quality, ok := fileEdition(f)
+		if !ok {
+			continue
+		}
+		label := editionLabel(edition, quality)
+		key := editionKey(label)
+		e := byKey[key]
+		if e == nil {
+			e = gin.H{
+				"key":          key,
+				"label":        label,
+				"edition":      edition,
+				"quality":      quality,
+				"file_ids":     []int64{},
+				"stream_url":   fmt.Sprintf("/api/v1/entities/%d/stream?edition=%s", id, key),
+				"download_url": fmt.Sprintf("/api/v1/entities/%d/download?edition=%s", id, key),
+			}
+			byKey[key] = e
+			editions = append(editions, e)
+		}
+		e["file_ids"] = append(e["file_ids"].([]int64), f.FileID)
+	}
+	return editions
+}
+
+// filesOfEdition returns the files of one edition, by its key.
+func filesOfEdition(files []repository.MediaFileRecord, key string) []repository.MediaFileRecord {
+	var matched []repository.MediaFileRecord
+	for _, f := range files {
+		if edition, quality, ok := fileEdition(f); ok && editionKey(editionLabel(edition, quality)) == key {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
 // --- JSON helpers ---
 
 func itemsToJSON(items []*models.MediaItem) []gin.H {
@@ -3,9 +3,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"catalogizer/config"
@@ -170,3 +172,147 @@ func TestMediaEntityHandler_GetEntity(t *testing.T) {
 	assert.Equal(t, "The Matrix", resp["title"])
 	assert.Equal(t, "movie", resp["media_type"])
 }
+
+func TestMediaEntityHandler_StreamEntityParts(t *testing.T) {
+	db, cleanup := setupEntityTestDB(t)
+	defer cleanup()
+
+	handler, itemRepo := setupEntityHandler(t, db)
+	fileRepo := repository.NewMediaFileRepository(db)
+	ctx := context.Background()
+
+	_, typeID, _ := itemRepo.GetMediaTypeByName(ctx, "movie")
+	id, err := itemRepo.Create(ctx, &models.MediaItem{MediaTypeID: typeID, Title: "Film", Status: "detected"})
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO roles (id, name, permissions) VALUES (100, 'parts-test', '[]');
+		INSERT INTO users (id, username, email, password_hash, salt, role_id) VALUES
+			(7, 'viewer', 'viewer@example.com', 'x', 'x', 100);`)
+	require.NoError(t, err)
+	rootID, err := db.InsertReturningID(ctx, `INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'local', '/srv')`)
+	require.NoError(t, err)
+	for part := 1; part <= 2; part++ {
+		name := fmt.Sprintf("Film CD%d.avi", part)
+		fileID, err := db.InsertReturningID(ctx,
+			`INSERT INTO files (storage_root_id, path, name, size, modified_at) VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP)`,
+			rootID, "/"+name, name)
+		require.NoError(t, err)
+		_, err = fileRepo.LinkFileToItem(ctx, id, fileID, nil, nil, part == 1)
+		require.NoError(t, err)
+		require.NoError(t, fileRepo.SetLayout(ctx, id, fileID, repository.MediaFileLayout{PartNumber: &part}))
+	}
+
+	stream := func(query string) (int, map[string]interface{}) {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", fmt.Sprintf("/api/v1/entities/%d/stream%s", id, query), nil)
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+		handler.StreamEntity(c)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := stream("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), resp["part_number"])
+	assert.Len(t, resp["parts"], 2)
+	assert.Equal(t, float64(2), resp["next_part"])
+	assert.NotEmpty(t, resp["next_stream_url"])
+
+	code, resp = stream("?part=2")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), resp["part_number"])
+	assert.NotContains(t, resp, "next_part", "the last part does not advance")
+
+	code, _ = stream("?part=3")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Finishing the last part watches the whole film
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/entities/1/progress",
+		strings.NewReader(fmt.Sprintf(`{"file_id":%v,"position":600,"duration":600}`, resp["file_id"])))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+	c.Set("user_id", int64(7))
+	handler.RecordProgress(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"watched_status":"watched"`)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/entities/1/progress",
+		strings.NewReader(`{"file_id":999,"position":1,"duration":600}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+	handler.RecordProgress(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMediaEntityHandler_Editions(t *testing.T) {
+	db, cleanup := setupEntityTestDB(t)
+	defer cleanup()
+
+	handler, itemRepo := setupEntityHandler(t, db)
+	fileRepo := repository.NewMediaFileRepository(db)
+	ctx := context.Background()
+
+	_, typeID, _ := itemRepo.GetMediaTypeByName(ctx, "movie")
+	id, err := itemRepo.Create(ctx, &models.MediaItem{MediaTypeID: typeID, Title: "Film", Status: "detected"})
+	require.NoError(t, err)
+	rootID, err := db.InsertReturningID(ctx, `INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'local', '/srv')`)
+	require.NoError(t, err)
+	link := func(name string, edition, quality *string, primary bool) int64 {
+		fileID, err := db.InsertReturningID(ctx,
+			`INSERT INTO files (storage_root_id, path, name, size, modified_at) VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP)`,
+			rootID, "/"+name, name)
+		require.NoError(t, err)
+		_, err = fileRepo.LinkFileToItem(ctx, id, fileID, nil, nil, primary)
+		require.NoError(t, err)
+		require.NoError(t, fileRepo.SetEdition(ctx, id, fileID, edition, quality))
+		return fileID
+	}
+	extended, hd, uhd := "Extended", "1080p", "2160p"
+	link("Film.1080p.mkv", nil, &hd, true)
+	extendedID := link("Film.Extended.2160p.mkv", &extended, &uhd, false)
+
+	get := func(path string, params gin.Params, handle gin.HandlerFunc) (int, map[string]interface{}) {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", path, nil)
+		c.Params = params
+		handle(c)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	idParam := gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+
+	code, resp := get("/api/v1/entities/1", idParam, handler.GetEntity)
+	require.Equal(t, http.StatusOK, code)
+	editions := resp["editions"].([]interface{})
+	require.Len(t, editions, 2)
+	second := editions[1].(map[string]interface{})
+	assert.Equal(t, "extended-2160p", second["key"])
+	assert.Equal(t, "Extended 2160p", second["label"])
+	assert.Equal(t, fmt.Sprintf("/api/v1/entities/%d/stream?edition=extended-2160p", id), second["stream_url"])
+	assert.Equal(t, "Standard 1080p", editions[0].(map[string]interface{})["label"])
+
+	code, resp = get("/api/v1/entities/1/stream?edition=extended-2160p", idParam, handler.StreamEntity)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(extendedID), resp["file_id"])
+	code, resp = get("/api/v1/entities/1/download?edition=extended-2160p", idParam, handler.DownloadEntity)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(extendedID), resp["file_id"])
+	code, _ = get("/api/v1/entities/1/stream?edition=imax", idParam, handler.StreamEntity)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, resp = get("/api/v1/entities?query=Film", nil, handler.ListEntities)
+	require.Equal(t, http.StatusOK, code)
+	items := resp["items"].([]interface{})
+	require.Len(t, items, 1)
+	assert.Equal(t, []interface{}{"Standard 1080p", "Extended 2160p"}, items[0].(map[string]interface{})["editions"])
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metadataEnrichmentService defines the enrichment methods used by
+// MetadataEnrichmentHandler.
+type metadataEnrichmentService interface {
+	FindMatches(ctx context.Context, mediaItemID int64, request services.RematchRequest) ([]services.MetadataMatch, error)
+	Rematch(ctx context.Context, mediaItemID int64, request services.RematchRequest) (*services.MetadataEnrichmentResult, error)
+	Identify(ctx context.Context, mediaItemID int64, request services.IdentifyRequest) (*services.MetadataEnrichmentResult, error)
+	FieldSources(ctx context.Context, mediaItemID int64) ([]services.MetadataFieldSource, error)
+	GetSourceConfig(ctx context.Context) (*services.MetadataSourceConfig, error)
+	SetSourceConfig(ctx context.Context, cfg services.MetadataSourceConfig, userID int) (*services.MetadataSourceConfig, error)
+	ProviderNames() []string
+}
+
+// MetadataEnrichmentHandler lets users correct the external metadata
+// matched to a media entity, see where its fields came from and, as
+// admins, choose which providers supply each field.
+type MetadataEnrichmentHandler struct {
+	enrichment  metadataEnrichmentService
+	authService requestAuthService
+}
+
+// NewMetadataEnrichmentHandler creates a new MetadataEnrichmentHandler.
+func NewMetadataEnrichmentHandler(enrichment metadataEnrichmentService, authService requestAuthService) *MetadataEnrichmentHandler {
+	return &MetadataEnrichmentHandler{
+		enrichment:  enrichment,
+		authService: authService,
+	}
+}
+
+// metadataEnrichmentErrorStatus maps service errors to HTTP status codes.
+func metadataEnrichmentErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"), strings.Contains(msg, "unsupported"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// FindMatches handles GET /api/v1/entities/:id/metadata/matches, listing
+// provider candidates ranked by score. The optional media_type, title and
+// year query parameters override the values stored on the entity.
+func (h *MetadataEnrichmentHandler) FindMatches(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "entity")
+	if !ok {
+		return
+	}
+
+	request := services.RematchRequest{
+		MediaType: c.Query("media_type"),
+		Title:     c.Query("title"),
+	}
+	if yearStr := c.Query("year"); yearStr != "" {
+		year, err := strconv.Atoi(yearStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid year"})
+			return
+		}
+		request.Year = &year
+	}
+
+	matches, err := h.enrichment.FindMatches(c.Request.Context(), mediaItemID, request)
+	if err != nil {
+		c.JSON(metadataEnrichmentErrorStatus(err), gin.H{"success": false, "error": "Failed to search metadata", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": matches})
+}
+
+// Rematch handles POST /api/v1/entities/:id/metadata/rematch. The body is
+// optional; its media_type, title and year replace the stored values for
+// the search, and the best match replaces the entity's metadata.
+func (h *MetadataEnrichmentHandler) Rematch(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaEdit); !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "entity")
+	if !ok {
+		return
+	}
+
+	var req services.RematchRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	result, err := h.enrichment.Rematch(c.Request.Context(), mediaItemID, req)
+	if err != nil {
+		c.JSON(metadataEnrichmentErrorStatus(err), gin.H{"success": false, "error": "Failed to re-match metadata", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// Identify handles POST /api/v1/entities/:id/metadata/identify, pinning
+// the entity to a provider record chosen by the user.
+func (h *MetadataEnrichmentHandler) Identify(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaEdit); !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "entity")
+	if !ok {
+		return
+	}
+
+	var req services.IdentifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	result, err := h.enrichment.Identify(c.Request.Context(), mediaItemID, req)
+	if err != nil {
+		c.JSON(metadataEnrichmentErrorStatus(err), gin.H{"success": false, "error": "Failed to identify media", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// FieldSources handles GET /api/v1/entities/:id/metadata/sources, listing
+// the provider and record each metadata field of the entity came from.
+func (h *MetadataEnrichmentHandler) FieldSources(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+	mediaItemID, ok := parseIDParam(c, "id", "entity")
+	if !ok {
+		return
+	}
+
+	sources, err := h.enrichment.FieldSources(c.Request.Context(), mediaItemID)
+	if err != nil {
+		c.JSON(metadataEnrichmentErrorStatus(err), gin.H{"success": false, "error": "Failed to load metadata sources", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": sources})
+}
+
+// GetSourceConfig handles GET /api/v1/admin/metadata/sources, with the
+// provider order, the field priorities and what they may name.
+func (h *MetadataEnrichmentHandler) GetSourceConfig(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	cfg, err := h.enrichment.GetSourceConfig(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load metadata sources", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"config":    cfg,
+		"providers": h.enrichment.ProviderNames(),
+		"fields":    services.MetadataSourceFields,
+	}})
+}
+
+// UpdateSourceConfig handles PUT /api/v1/admin/metadata/sources, replacing
+// the provider order and field priorities.
+func (h *MetadataEnrichmentHandler) UpdateSourceConfig(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var req services.MetadataSourceConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	cfg, err := h.enrichment.SetSourceConfig(c.Request.Context(), req, user.ID)
+	if err != nil {
+		c.JSON(metadataEnrichmentErrorStatus(err), gin.H{"success": false, "error": "Failed to update metadata sources", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": cfg})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetadataEnrichmentService struct {
+	rematch  services.RematchRequest
+	identify services.IdentifyRequest
+	sources  services.MetadataSourceConfig
+	editor   int
+}
+
+func (f *fakeMetadataEnrichmentService) FindMatches(ctx context.Context, mediaItemID int64, request services.RematchRequest) ([]services.MetadataMatch, error) {
+	if mediaItemID == 9 {
+		return nil, fmt.Errorf("media item not found")
+	}
+	f.rematch = request
+	return []services.MetadataMatch{{Provider: services.MetadataProviderTMDB, ExternalID: "603", Title: "The Matrix", Score: 1}}, nil
+}
+
+func (f *fakeMetadataEnrichmentService) Rematch(ctx context.Context, mediaItemID int64, request services.RematchRequest) (*services.MetadataEnrichmentResult, error) {
+	if request.MediaType == "song" {
+		return nil, fmt.Errorf("unsupported media type: song")
+	}
+	f.rematch = request
+	return &services.MetadataEnrichmentResult{MediaItemID: mediaItemID, MediaType: "movie", Status: services.MediaStatusMatched}, nil
+}
+
+func (f *fakeMetadataEnrichmentService) Identify(ctx context.Context, mediaItemID int64, request services.IdentifyRequest) (*services.MetadataEnrichmentResult, error) {
+	if request.Provider == "imdb" {
+		return nil, fmt.Errorf("invalid provider: imdb")
+	}
+	f.identify = request
+	return &services.MetadataEnrichmentResult{MediaItemID: mediaItemID, MediaType: "movie", Status: services.MediaStatusIdentified,
+		Match: &services.MetadataMatch{Provider: request.Provider, ExternalID: request.ExternalID, Score: 1}}, nil
+}
+
+func (f *fakeMetadataEnrichmentService) FieldSources(ctx context.Context, mediaItemID int64) ([]services.MetadataFieldSource, error) {
+	if mediaItemID == 9 {
+		return nil, fmt.Errorf("media item not found")
+	}
+	return []services.MetadataFieldSource{
+		{Field: services.MetadataFieldDescription, Provider: services.MetadataProviderTMDB, ExternalID: "603"},
+		{Field: services.MetadataFieldMatch, Provider: services.MetadataProviderTMDB, ExternalID: "603"},
+	}, nil
+}
+
+func (f *fakeMetadataEnrichmentService) GetSourceConfig(ctx context.Context) (*services.MetadataSourceConfig, error) {
+	return &f.sources, nil
+}
+
+func (f *fakeMetadataEnrichmentService) SetSourceConfig(ctx context.Context, cfg services.MetadataSourceConfig, userID int) (*services.MetadataSourceConfig, error) {
+	for _, name := range cfg.ProviderOrder {
+		if name == "imdb" {
+			return nil, fmt.Errorf("invalid provider %q in provider_order", name)
+		}
+	}
+	f.sources, f.editor = cfg, userID
+	return &f.sources, nil
+}
+
+func (f *fakeMetadataEnrichmentService) ProviderNames() []string {
+	return []string{services.MetadataProviderTMDB, services.MetadataProviderMusicBrainz}
+}
+
+func newMetadataEnrichmentTestRouter(svc *fakeMetadataEnrichmentService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewMetadataEnrichmentHandler(svc, auth)
+	r := gin.New()
+	r.GET("/entities/:id/metadata/matches", h.FindMatches)
+	r.POST("/entities/:id/metadata/rematch", h.Rematch)
+	r.POST("/entities/:id/metadata/identify", h.Identify)
+	r.GET("/entities/:id/metadata/sources", h.FieldSources)
+	r.GET("/admin/metadata/sources", h.GetSourceConfig)
+	r.PUT("/admin/metadata/sources", h.UpdateSourceConfig)
+	return r
+}
+
+func metadataEnrichmentRequest(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMetadataEnrichmentHandler_FindMatches(t *testing.T) {
+	svc := &fakeMetadataEnrichmentService{}
+	r := newMetadataEnrichmentTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+
+	w := metadataEnrichmentRequest(r, http.MethodGet, "/entities/1/metadata/matches?title=Matrix&year=1999&media_type=movie", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Matrix", svc.rematch.Title)
+	assert.Equal(t, "movie", svc.rematch.MediaType)
+	require.NotNil(t, svc.rematch.Year)
+	assert.Equal(t, 1999, *svc.rematch.Year)
+	var resp struct {
+		Data []services.MetadataMatch `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "603", resp.Data[0].ExternalID)
+
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(r, http.MethodGet, "/entities/1/metadata/matches?year=soon", "").Code)
+	assert.Equal(t, http.StatusNotFound, metadataEnrichmentRequest(r, http.MethodGet, "/entities/9/metadata/matches", "").Code)
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(r, http.MethodGet, "/entities/abc/metadata/matches", "").Code)
+}
+
+func TestMetadataEnrichmentHandler_RematchAndIdentify(t *testing.T) {
+	svc := &fakeMetadataEnrichmentService{}
+	viewer := newMetadataEnrichmentTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+	assert.Equal(t, http.StatusForbidden, metadataEnrichmentRequest(viewer, http.MethodPost, "/entities/1/metadata/rematch", "").Code)
+	assert.Equal(t, http.StatusForbidden, metadataEnrichmentRequest(viewer, http.MethodPost, "/entities/1/metadata/identify", `{"provider":"tmdb","external_id":"603"}`).Code)
+
+	r := newMetadataEnrichmentTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaEdit: true}})
+	require.Equal(t, http.StatusOK, metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/rematch", "").Code)
+	require.Equal(t, http.StatusOK, metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/rematch", `{"title":"The Matrix"}`).Code)
+	assert.Equal(t, "The Matrix", svc.rematch.Title)
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/rematch", `{"media_type":"song"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/rematch", `{`).Code)
+
+	w := metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/identify", `{"provider":"tmdb","external_id":"603"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "603", svc.identify.ExternalID)
+	var resp struct {
+		Data services.MetadataEnrichmentResult `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, services.MediaStatusIdentified, resp.Data.Status)
+
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/identify", `{"provider":"tmdb"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(r, http.MethodPost, "/entities/1/metadata/identify", `{"provider":"imdb","external_id":"tt0133093"}`).Code)
+}
+
+func TestMetadataEnrichmentHandler_Sources(t *testing.T) {
+	svc := &fakeMetadataEnrichmentService{}
+	viewer := newMetadataEnrichmentTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+	w := metadataEnrichmentRequest(viewer, http.MethodGet, "/entities/1/metadata/sources", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"description","provider":"tmdb"`)
+	assert.Equal(t, http.StatusNotFound, metadataEnrichmentRequest(viewer, http.MethodGet, "/entities/9/metadata/sources", "").Code)
+	assert.Equal(t, http.StatusForbidden, metadataEnrichmentRequest(viewer, http.MethodGet, "/admin/metadata/sources", "").Code)
+	assert.Equal(t, http.StatusForbidden, metadataEnrichmentRequest(viewer, http.MethodPut, "/admin/metadata/sources", `{}`).Code)
+
+	admin := newMetadataEnrichmentTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}})
+	w = metadataEnrichmentRequest(admin, http.MethodPut, "/admin/metadata/sources",
+		`{"provider_order":["musicbrainz","tmdb"],"field_priority":{"rating":["tmdb"]}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, svc.editor)
+	assert.Equal(t, []string{"tmdb"}, svc.sources.FieldPriority[services.MetadataFieldRating])
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(admin, http.MethodPut, "/admin/metadata/sources", `{"provider_order":["imdb"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, metadataEnrichmentRequest(admin, http.MethodPut, "/admin/metadata/sources", `{"provider_order":"tmdb"}`).Code)
+
+	w = metadataEnrichmentRequest(admin, http.MethodGet, "/admin/metadata/sources", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			Config    services.MetadataSourceConfig `json:"config"`
+			Providers []string                      `json:"providers"`
+			Fields    []string                      `json:"fields"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"musicbrainz", "tmdb"}, resp.Data.Config.ProviderOrder)
+	assert.Equal(t, []string{"tmdb", "musicbrainz"}, resp.Data.Providers)
+	assert.Contains(t, resp.Data.Fields, services.MetadataFieldCover)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metadataRefreshService defines the refresh methods used by
+// MetadataRefreshHandler.
+type metadataRefreshService interface {
+	StartJob(ctx context.Context, req services.MetadataRefreshRequest, userID int) (*services.MetadataRefreshJob, error)
+	GetJob(ctx context.Context, id int64) (*services.MetadataRefreshJob, error)
+	ListJobs(ctx context.Context, limit int) ([]services.MetadataRefreshJob, error)
+	CancelJob(ctx context.Context, id int64) error
+}
+
+// metadataProviderCache defines the cache methods used by
+// MetadataRefreshHandler.
+type metadataProviderCache interface {
+	Stats(ctx context.Context) ([]services.MetadataProviderCacheStats, error)
+	Invalidate(ctx context.Context, provider, mediaType string) (int64, error)
+}
+
+// MetadataRefreshHandler runs bulk metadata refreshes and manages the
+// cache of metadata provider responses. Every endpoint requires
+// system.admin.
+type MetadataRefreshHandler struct {
+	refresh     metadataRefreshService
+	cache       metadataProviderCache
+	authService requestAuthService
+}
+
+// NewMetadataRefreshHandler creates a new MetadataRefreshHandler.
+func NewMetadataRefreshHandler(refresh metadataRefreshService, cache metadataProviderCache, authService requestAuthService) *MetadataRefreshHandler {
+	return &MetadataRefreshHandler{
+		refresh:     refresh,
+		cache:       cache,
+		authService: authService,
+	}
+}
+
+// metadataRefreshErrorStatus maps service errors to HTTP status codes.
+func metadataRefreshErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMetadataRefreshRunning), strings.Contains(err.Error(), "is not running"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "not configured"):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// StartRefresh handles POST /api/v1/admin/metadata/refresh. The body is
+// optional; without one every item any provider covers is refreshed.
+func (h *MetadataRefreshHandler) StartRefresh(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var req services.MetadataRefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	job, err := h.refresh.StartJob(c.Request.Context(), req, user.ID)
+	if err != nil {
+		c.JSON(metadataRefreshErrorStatus(err), gin.H{"success": false, "error": "Failed to start metadata refresh", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": job})
+}
+
+// ListRefreshes handles GET /api/v1/admin/metadata/refresh.
+func (h *MetadataRefreshHandler) ListRefreshes(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	jobs, err := h.refresh.ListJobs(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list metadata refreshes", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": jobs})
+}
+
+// GetRefresh handles GET /api/v1/admin/metadata/refresh/:id, with the
+// progress and estimated completion of a running job.
+func (h *MetadataRefreshHandler) GetRefresh(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "refresh")
+	if !ok {
+		return
+	}
+
+	job, err := h.refresh.GetJob(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(metadataRefreshErrorStatus(err), gin.H{"success": false, "error": "Failed to get metadata refresh", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
+
+// CancelRefresh handles POST /api/v1/admin/metadata/refresh/:id/cancel.
+func (h *MetadataRefreshHandler) CancelRefresh(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "refresh")
+	if !ok {
+		return
+	}
+
+	if err := h.refresh.CancelJob(c.Request.Context(), id); err != nil {
+		c.JSON(metadataRefreshErrorStatus(err), gin.H{"success": false, "error": "Failed to cancel metadata refresh", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Metadata refresh cancelling"})
+}
+
+// GetCache handles GET /api/v1/admin/metadata/cache.
+func (h *MetadataRefreshHandler) GetCache(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	stats, err := h.cache.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to read metadata cache", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
+
+// InvalidateCache handles DELETE /api/v1/admin/metadata/cache. The
+// provider and media_type query parameters narrow what is dropped.
+func (h *MetadataRefreshHandler) InvalidateCache(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	deleted, err := h.cache.Invalidate(c.Request.Context(), c.Query("provider"), c.Query("media_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to invalidate metadata cache", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"deleted": deleted}})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetadataRefreshService struct {
+	started []services.MetadataRefreshRequest
+	running bool
+}
+
+func (f *fakeMetadataRefreshService) StartJob(ctx context.Context, req services.MetadataRefreshRequest, userID int) (*services.MetadataRefreshJob, error) {
+	if req.Provider == "imdb" {
+		return nil, fmt.Errorf("invalid provider: %s", req.Provider)
+	}
+	if f.running {
+		return nil, services.ErrMetadataRefreshRunning
+	}
+	f.running = true
+	f.started = append(f.started, req)
+	return &services.MetadataRefreshJob{ID: 1, Section: req.Section, Status: services.MetadataRefreshRunning, Total: 10, StartedBy: userID}, nil
+}
+
+func (f *fakeMetadataRefreshService) GetJob(ctx context.Context, id int64) (*services.MetadataRefreshJob, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("metadata refresh %d not found", id)
+	}
+	eta := int64(90)
+	return &services.MetadataRefreshJob{ID: 1, Status: services.MetadataRefreshRunning, Total: 10, Processed: 4, Percent: 40, ETASeconds: &eta}, nil
+}
+
+func (f *fakeMetadataRefreshService) ListJobs(ctx context.Context, limit int) ([]services.MetadataRefreshJob, error) {
+	return []services.MetadataRefreshJob{{ID: 1}}, nil
+}
+
+func (f *fakeMetadataRefreshService) CancelJob(ctx context.Context, id int64) error {
+	if !f.running {
+		return fmt.Errorf("metadata refresh %d is not running", id)
+	}
+	f.running = false
+	return nil
+}
+
+type fakeMetadataProviderCache struct {
+	invalidated []string
+}
+
+func (f *fakeMetadataProviderCache) Stats(ctx context.Context) ([]services.MetadataProviderCacheStats, error) {
+	return []services.MetadataProviderCacheStats{{Provider: "tmdb", Entries: 12, Hits: 30, Misses: 12}}, nil
+}
+
+func (f *fakeMetadataProviderCache) Invalidate(ctx context.Context, provider, mediaType string) (int64, error) {
+	f.invalidated = append(f.invalidated, provider+"/"+mediaType)
+	return 12, nil
+}
+
+func metadataRefreshRequest(auth requestAuthService, svc *fakeMetadataRefreshService, cache *fakeMetadataProviderCache, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewMetadataRefreshHandler(svc, cache, auth)
+	r := gin.New()
+	r.POST("/admin/metadata/refresh", h.StartRefresh)
+	r.GET("/admin/metadata/refresh", h.ListRefreshes)
+	r.GET("/admin/metadata/refresh/:id", h.GetRefresh)
+	r.POST("/admin/metadata/refresh/:id/cancel", h.CancelRefresh)
+	r.GET("/admin/metadata/cache", h.GetCache)
+	r.DELETE("/admin/metadata/cache", h.InvalidateCache)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMetadataRefreshHandler(t *testing.T) {
+	svc, cache := &fakeMetadataRefreshService{}, &fakeMetadataProviderCache{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionMediaEdit: true}}
+	assert.Equal(t, http.StatusForbidden, metadataRefreshRequest(viewer, svc, cache, http.MethodPost, "/admin/metadata/refresh", "").Code)
+	assert.Equal(t, http.StatusForbidden, metadataRefreshRequest(viewer, svc, cache, http.MethodDelete, "/admin/metadata/cache", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	assert.Equal(t, http.StatusBadRequest, metadataRefreshRequest(admin, svc, cache, http.MethodPost, "/admin/metadata/refresh", `{"provider":"imdb"}`).Code)
+	w := metadataRefreshRequest(admin, svc, cache, http.MethodPost, "/admin/metadata/refresh", "")
+	require.Equal(t, http.StatusAccepted, w.Code, "the body is optional")
+	assert.Contains(t, w.Body.String(), `"started_by":1`)
+	assert.Equal(t, http.StatusConflict, metadataRefreshRequest(admin, svc, cache, http.MethodPost, "/admin/metadata/refresh",
+		`{"section":"movie","only_missing":true}`).Code)
+
+	w = metadataRefreshRequest(admin, svc, cache, http.MethodGet, "/admin/metadata/refresh/1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"eta_seconds":90`)
+	assert.Equal(t, http.StatusNotFound, metadataRefreshRequest(admin, svc, cache, http.MethodGet, "/admin/metadata/refresh/2", "").Code)
+	assert.Equal(t, http.StatusOK, metadataRefreshRequest(admin, svc, cache, http.MethodGet, "/admin/metadata/refresh", "").Code)
+
+	assert.Equal(t, http.StatusAccepted, metadataRefreshRequest(admin, svc, cache, http.MethodPost, "/admin/metadata/refresh/1/cancel", "").Code)
+	assert.Equal(t, http.StatusConflict, metadataRefreshRequest(admin, svc, cache, http.MethodPost, "/admin/metadata/refresh/1/cancel", "").Code)
+
+	w = metadataRefreshRequest(admin, svc, cache, http.MethodGet, "/admin/metadata/cache", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"hits":30`)
+	w = metadataRefreshRequest(admin, svc, cache, http.MethodDelete, "/admin/metadata/cache?provider=tmdb&media_type=movie", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"deleted":12`)
+	assert.Equal(t, []string{"tmdb/movie"}, cache.invalidated)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// offlineMetadataStore defines the bundle methods used by
+// OfflineMetadataHandler.
+type offlineMetadataStore interface {
+	Import(ctx context.Context, r io.Reader, force bool, userID int) (*services.OfflineMetadataBundle, error)
+	ListBundles(ctx context.Context) ([]services.OfflineMetadataBundle, error)
+	GetBundle(ctx context.Context, name string) (*services.OfflineMetadataBundle, error)
+	ListImports(ctx context.Context, bundle string, limit int) ([]services.OfflineMetadataImport, error)
+	DeleteBundle(ctx context.Context, name string) error
+}
+
+// OfflineMetadataHandler imports and manages the offline metadata bundles
+// the offline provider matches media against. Every endpoint requires
+// system.admin.
+type OfflineMetadataHandler struct {
+	store       offlineMetadataStore
+	authService requestAuthService
+}
+
+// NewOfflineMetadataHandler creates a new OfflineMetadataHandler.
+func NewOfflineMetadataHandler(store offlineMetadataStore, authService requestAuthService) *OfflineMetadataHandler {
+	return &OfflineMetadataHandler{
+		store:       store,
+		authService: authService,
+	}
+}
+
+// offlineMetadataErrorStatus maps service errors to HTTP status codes.
+func offlineMetadataErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not newer"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "invalid bundle"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ListBundles handles GET /api/v1/admin/metadata/offline.
+func (h *OfflineMetadataHandler) ListBundles(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	bundles, err := h.store.ListBundles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list offline metadata bundles", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": bundles})
+}
+
+// GetBundle handles GET /api/v1/admin/metadata/offline/:name, with the
+// bundle's recent imports.
+func (h *OfflineMetadataHandler) GetBundle(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	bundle, err := h.store.GetBundle(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(offlineMetadataErrorStatus(err), gin.H{"success": false, "error": "Failed to load offline metadata bundle", "details": err.Error()})
+		return
+	}
+	imports, err := h.store.ListImports(c.Request.Context(), bundle.Name, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list offline metadata imports", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"bundle": bundle, "imports": imports}})
+}
+
+// ListImports handles GET /api/v1/admin/metadata/offline/imports. The
+// bundle query parameter narrows the list to one bundle.
+func (h *OfflineMetadataHandler) ListImports(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	imports, err := h.store.ListImports(c.Request.Context(), c.Query("bundle"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list offline metadata imports", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": imports})
+}
+
+// ImportBundle handles POST /api/v1/admin/metadata/offline. The bundle is
+// the request body, or the file field of a multipart form. Only a version
+// newer than the installed one is imported unless force=true is given.
+func (h *OfflineMetadataHandler) ImportBundle(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Missing bundle file", "details": err.Error()})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Failed to read bundle file", "details": err.Error()})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	force, _ := strconv.ParseBool(c.Query("force"))
+	bundle, err := h.store.Import(c.Request.Context(), body, force, user.ID)
+	if err != nil {
+		c.JSON(offlineMetadataErrorStatus(err), gin.H{"success": false, "error": "Failed to import offline metadata bundle", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": bundle})
+}
+
+// DeleteBundle handles DELETE /api/v1/admin/metadata/offline/:name.
+func (h *OfflineMetadataHandler) DeleteBundle(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	if err := h.store.DeleteBundle(c.Request.Context(), c.Param("name")); err != nil {
+		c.JSON(offlineMetadataErrorStatus(err), gin.H{"success": false, "error": "Failed to delete offline metadata bundle", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOfflineMetadataStore has the films bundle at version 2026.09 and
+// accepts newer versions of it.
+type fakeOfflineMetadataStore struct {
+	imported []string
+}
+
+func (f *fakeOfflineMetadataStore) Import(ctx context.Context, r io.Reader, force bool, userID int) (*services.OfflineMetadataBundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch string(data) {
+	case "2026.10":
+	case "2026.09":
+		if !force {
+			return nil, fmt.Errorf("bundle films version 2026.09 is not newer than the installed version 2026.09")
+		}
+	default:
+		return nil, fmt.Errorf("invalid bundle: header on line 1: unexpected end of JSON input")
+	}
+	f.imported = append(f.imported, string(data))
+	return &services.OfflineMetadataBundle{Name: "films", Version: string(data), ImportedBy: &userID}, nil
+}
+
+func (f *fakeOfflineMetadataStore) ListBundles(ctx context.Context) ([]services.OfflineMetadataBundle, error) {
+	return []services.OfflineMetadataBundle{{Name: "films", Version: "2026.09", Records: 2}}, nil
+}
+
+func (f *fakeOfflineMetadataStore) GetBundle(ctx context.Context, name string) (*services.OfflineMetadataBundle, error) {
+	if name != "films" {
+		return nil, fmt.Errorf("offline metadata bundle %s not found", name)
+	}
+	return &services.OfflineMetadataBundle{Name: "films", Version: "2026.09", Records: 2}, nil
+}
+
+func (f *fakeOfflineMetadataStore) ListImports(ctx context.Context, bundle string, limit int) ([]services.OfflineMetadataImport, error) {
+	return []services.OfflineMetadataImport{{ID: 1, Bundle: "films", Version: "2026.09", Status: services.OfflineImportImported}}, nil
+}
+
+func (f *fakeOfflineMetadataStore) DeleteBundle(ctx context.Context, name string) error {
+	_, err := f.GetBundle(ctx, name)
+	return err
+}
+
+func offlineMetadataRequest(auth requestAuthService, store *fakeOfflineMetadataStore, method, target, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewOfflineMetadataHandler(store, auth)
+	r := gin.New()
+	r.GET("/admin/metadata/offline", h.ListBundles)
+	r.POST("/admin/metadata/offline", h.ImportBundle)
+	r.GET("/admin/metadata/offline/imports", h.ListImports)
+	r.GET("/admin/metadata/offline/:name", h.GetBundle)
+	r.DELETE("/admin/metadata/offline/:name", h.DeleteBundle)
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer valid")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOfflineMetadataHandler(t *testing.T) {
+	store := &fakeOfflineMetadataStore{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionMediaEdit: true}}
+	assert.Equal(t, http.StatusForbidden, offlineMetadataRequest(viewer, store, http.MethodGet, "/admin/metadata/offline", "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, offlineMetadataRequest(viewer, store, http.MethodPost, "/admin/metadata/offline", "", bytes.NewBufferString("2026.10")).Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := offlineMetadataRequest(admin, store, http.MethodPost, "/admin/metadata/offline", "application/x-ndjson", bytes.NewBufferString("2026.10"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"version":"2026.10"`)
+	assert.Equal(t, http.StatusConflict, offlineMetadataRequest(admin, store, http.MethodPost, "/admin/metadata/offline", "", bytes.NewBufferString("2026.09")).Code)
+	assert.Equal(t, http.StatusBadRequest, offlineMetadataRequest(admin, store, http.MethodPost, "/admin/metadata/offline", "", bytes.NewBufferString("")).Code)
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("file", "films.jsonl.gz")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("2026.09"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	w = offlineMetadataRequest(admin, store, http.MethodPost, "/admin/metadata/offline?force=true", writer.FormDataContentType(), &form)
+	require.Equal(t, http.StatusOK, w.Code, "a multipart upload is read from its file field")
+	assert.Equal(t, []string{"2026.10", "2026.09"}, store.imported)
+
+	w = offlineMetadataRequest(admin, store, http.MethodGet, "/admin/metadata/offline", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"records":2`)
+	w = offlineMetadataRequest(admin, store, http.MethodGet, "/admin/metadata/offline/films", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"imports":[{"id":1`)
+	assert.Equal(t, http.StatusOK, offlineMetadataRequest(admin, store, http.MethodGet, "/admin/metadata/offline/imports?bundle=films", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, offlineMetadataRequest(admin, store, http.MethodGet, "/admin/metadata/offline/music", "", nil).Code)
+	assert.Equal(t, http.StatusOK, offlineMetadataRequest(admin, store, http.MethodDelete, "/admin/metadata/offline/films", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, offlineMetadataRequest(admin, store, http.MethodDelete, "/admin/metadata/offline/music", "", nil).Code)
+}
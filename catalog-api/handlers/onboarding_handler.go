@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// onboardingService defines the onboarding methods used by
+// OnboardingHandler.
+type onboardingService interface {
+	Status(ctx context.Context) (*services.OnboardingStatus, error)
+	CompleteTask(ctx context.Context, taskID string, userID int) (*services.OnboardingTask, error)
+	SkipTask(ctx context.Context, taskID string, userID int) (*services.OnboardingTask, error)
+	CreateDemoLibrary(ctx context.Context) (*services.DemoLibrary, error)
+	RemoveDemoLibrary(ctx context.Context) error
+}
+
+// OnboardingHandler serves the guided tasks shown on a new installation's
+// dashboard and the demo library. Every endpoint requires
+// system.configure.
+type OnboardingHandler struct {
+	onboarding  onboardingService
+	authService requestAuthService
+}
+
+// NewOnboardingHandler creates a new OnboardingHandler.
+func NewOnboardingHandler(onboarding onboardingService, authService requestAuthService) *OnboardingHandler {
+	return &OnboardingHandler{
+		onboarding:  onboarding,
+		authService: authService,
+	}
+}
+
+// onboardingErrorStatus maps service errors to HTTP status codes.
+func onboardingErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GetStatus handles GET /api/v1/onboarding.
+func (h *OnboardingHandler) GetStatus(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	status, err := h.onboarding.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(onboardingErrorStatus(err), gin.H{"success": false, "error": "Failed to load onboarding", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// CompleteTask handles POST /api/v1/onboarding/tasks/:task/complete.
+func (h *OnboardingHandler) CompleteTask(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemConfig)
+	if !ok {
+		return
+	}
+
+	task, err := h.onboarding.CompleteTask(c.Request.Context(), c.Param("task"), currentUser.ID)
+	if err != nil {
+		c.JSON(onboardingErrorStatus(err), gin.H{"success": false, "error": "Failed to complete onboarding task", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": task})
+}
+
+// SkipTask handles POST /api/v1/onboarding/tasks/:task/skip.
+func (h *OnboardingHandler) SkipTask(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemConfig)
+	if !ok {
+		return
+	}
+
+	task, err := h.onboarding.SkipTask(c.Request.Context(), c.Param("task"), currentUser.ID)
+	if err != nil {
+		c.JSON(onboardingErrorStatus(err), gin.H{"success": false, "error": "Failed to skip onboarding task", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": task})
+}
+
+// CreateDemoLibrary handles POST /api/v1/onboarding/demo-library. It
+// answers once the files are written; the scan runs in the background.
+func (h *OnboardingHandler) CreateDemoLibrary(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	demo, err := h.onboarding.CreateDemoLibrary(c.Request.Context())
+	if err != nil {
+		c.JSON(onboardingErrorStatus(err), gin.H{"success": false, "error": "Failed to create demo library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": demo})
+}
+
+// RemoveDemoLibrary handles DELETE /api/v1/onboarding/demo-library.
+func (h *OnboardingHandler) RemoveDemoLibrary(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	if err := h.onboarding.RemoveDemoLibrary(c.Request.Context()); err != nil {
+		c.JSON(onboardingErrorStatus(err), gin.H{"success": false, "error": "Failed to remove demo library", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Demo library removed"})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOnboardingService struct {
+	completedBy int
+	demoRemoved bool
+}
+
+func (f *fakeOnboardingService) Status(ctx context.Context) (*services.OnboardingStatus, error) {
+	return &services.OnboardingStatus{
+		Tasks: []services.OnboardingTask{{ID: services.OnboardingTaskAddShare, Status: services.OnboardingStatusPending}},
+		Total: 1,
+	}, nil
+}
+
+func (f *fakeOnboardingService) CompleteTask(ctx context.Context, taskID string, userID int) (*services.OnboardingTask, error) {
+	if taskID != services.OnboardingTaskMobileApp {
+		return nil, errors.New("onboarding task " + taskID + " not found")
+	}
+	f.completedBy = userID
+	return &services.OnboardingTask{ID: taskID, Status: services.OnboardingStatusCompleted}, nil
+}
+
+func (f *fakeOnboardingService) SkipTask(ctx context.Context, taskID string, userID int) (*services.OnboardingTask, error) {
+	return nil, errors.New("invalid onboarding task " + taskID + ": already completed")
+}
+
+func (f *fakeOnboardingService) CreateDemoLibrary(ctx context.Context) (*services.DemoLibrary, error) {
+	return &services.DemoLibrary{StorageRootID: 3, Enabled: true, ScanJobID: "job-1"}, nil
+}
+
+func (f *fakeOnboardingService) RemoveDemoLibrary(ctx context.Context) error {
+	f.demoRemoved = true
+	return nil
+}
+
+func onboardingRequest(auth requestAuthService, svc *fakeOnboardingService, method, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewOnboardingHandler(svc, auth)
+	r := gin.New()
+	r.GET("/onboarding", h.GetStatus)
+	r.POST("/onboarding/tasks/:task/complete", h.CompleteTask)
+	r.POST("/onboarding/tasks/:task/skip", h.SkipTask)
+	r.POST("/onboarding/demo-library", h.CreateDemoLibrary)
+	r.DELETE("/onboarding/demo-library", h.RemoveDemoLibrary)
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOnboardingHandler(t *testing.T) {
+	svc := &fakeOnboardingService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, onboardingRequest(viewer, svc, http.MethodGet, "/onboarding").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemConfig: true}}
+	w := onboardingRequest(admin, svc, http.MethodGet, "/onboarding")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"add_share"`)
+
+	require.Equal(t, http.StatusOK, onboardingRequest(admin, svc, http.MethodPost, "/onboarding/tasks/install_mobile_app/complete").Code)
+	assert.Equal(t, 1, svc.completedBy)
+	assert.Equal(t, http.StatusNotFound, onboardingRequest(admin, svc, http.MethodPost, "/onboarding/tasks/watch_movie/complete").Code)
+	assert.Equal(t, http.StatusBadRequest, onboardingRequest(admin, svc, http.MethodPost, "/onboarding/tasks/add_share/skip").Code)
+
+	w = onboardingRequest(admin, svc, http.MethodPost, "/onboarding/demo-library")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"scan_job_id":"job-1"`)
+	require.Equal(t, http.StatusOK, onboardingRequest(admin, svc, http.MethodDelete, "/onboarding/demo-library").Code)
+	assert.True(t, svc.demoRemoved)
+}
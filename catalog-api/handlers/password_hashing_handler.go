@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBenchmarkTarget is the hashing time a benchmark aims for when the
+// request names none
+const defaultBenchmarkTarget = 500 * time.Millisecond
+
+// passwordHashingService defines the password hashing methods used by
+// PasswordHashingHandler.
+type passwordHashingService interface {
+	PasswordHashStatus() (*models.PasswordHashStatus, error)
+	UpdatePasswordHashParams(params models.PasswordHashParams, userID int) (*models.PasswordHashParams, error)
+}
+
+// PasswordHashingHandler shows and changes the algorithm and cost new
+// password hashes are made with, and benchmarks argon2id on the host.
+// Every endpoint requires system.admin.
+type PasswordHashingHandler struct {
+	passwords   passwordHashingService
+	authService requestAuthService
+	benchmark   func(ctx context.Context, target time.Duration) (*services.PasswordHashBenchmark, error)
+}
+
+// NewPasswordHashingHandler creates a new PasswordHashingHandler.
+func NewPasswordHashingHandler(passwords passwordHashingService, authService requestAuthService) *PasswordHashingHandler {
+	return &PasswordHashingHandler{
+		passwords:   passwords,
+		authService: authService,
+		benchmark:   services.BenchmarkPasswordHashing,
+	}
+}
+
+// GetStatus handles GET /api/v1/admin/password-hashing. Besides the
+// parameters it counts the stored hashes of each algorithm and the ones
+// still to be rehashed at their users' next sign-in.
+func (h *PasswordHashingHandler) GetStatus(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	status, err := h.passwords.PasswordHashStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load password hashing status", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// UpdateParams handles PUT /api/v1/admin/password-hashing.
+func (h *PasswordHashingHandler) UpdateParams(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var params models.PasswordHashParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	saved, err := h.passwords.UpdatePasswordHashParams(params, currentUser.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to update password hashing", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": saved})
+}
+
+// Benchmark handles POST /api/v1/admin/password-hashing/benchmark. It
+// hashes with growing argon2id costs and recommends the costliest one
+// that takes at most target_ms, 500 unless given.
+func (h *PasswordHashingHandler) Benchmark(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req struct {
+		TargetMs int64 `json:"target_ms"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+	target := defaultBenchmarkTarget
+	if req.TargetMs != 0 {
+		if req.TargetMs < 50 || req.TargetMs > 5000 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "target_ms must be between 50 and 5000"})
+			return
+		}
+		target = time.Duration(req.TargetMs) * time.Millisecond
+	}
+
+	result, err := h.benchmark(c.Request.Context(), target)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPasswordBenchmarkRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to benchmark password hashing", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
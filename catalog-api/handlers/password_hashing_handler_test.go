@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePasswordHashing struct {
+	params  models.PasswordHashParams
+	savedBy int
+}
+
+func (f *fakePasswordHashing) PasswordHashStatus() (*models.PasswordHashStatus, error) {
+	return &models.PasswordHashStatus{Params: f.params, Algorithms: map[string]int{"bcrypt": 3}, Outdated: 3}, nil
+}
+
+func (f *fakePasswordHashing) UpdatePasswordHashParams(params models.PasswordHashParams, userID int) (*models.PasswordHashParams, error) {
+	if params.Algorithm != models.PasswordHashArgon2id {
+		return nil, fmt.Errorf("invalid password hash parameters: unknown algorithm %q", params.Algorithm)
+	}
+	f.params, f.savedBy = params, userID
+	return &params, nil
+}
+
+func passwordHashingRequest(auth requestAuthService, h *PasswordHashingHandler, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h.authService = auth
+	r := gin.New()
+	r.GET("/admin/password-hashing", h.GetStatus)
+	r.PUT("/admin/password-hashing", h.UpdateParams)
+	r.POST("/admin/password-hashing/benchmark", h.Benchmark)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordHashingHandler(t *testing.T) {
+	svc := &fakePasswordHashing{params: services.DefaultPasswordHashParams}
+	h := NewPasswordHashingHandler(svc, nil)
+	var benchmarked time.Duration
+	h.benchmark = func(ctx context.Context, target time.Duration) (*services.PasswordHashBenchmark, error) {
+		if benchmarked != 0 {
+			return nil, services.ErrPasswordBenchmarkRunning
+		}
+		benchmarked = target
+		return &services.PasswordHashBenchmark{TargetMs: target.Milliseconds(), Recommended: &services.DefaultPasswordHashParams}, nil
+	}
+
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionUserView: true}}
+	assert.Equal(t, http.StatusForbidden, passwordHashingRequest(viewer, h, http.MethodGet, "/admin/password-hashing", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := passwordHashingRequest(admin, h, http.MethodGet, "/admin/password-hashing", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"outdated":3`)
+
+	w = passwordHashingRequest(admin, h, http.MethodPut, "/admin/password-hashing",
+		`{"algorithm":"argon2id","memory_kib":65536,"iterations":3,"parallelism":2}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, uint32(65536), svc.params.MemoryKiB)
+	assert.Equal(t, 1, svc.savedBy)
+	assert.Equal(t, http.StatusBadRequest, passwordHashingRequest(admin, h, http.MethodPut, "/admin/password-hashing", `{"algorithm":"md5"}`).Code)
+
+	assert.Equal(t, http.StatusBadRequest,
+		passwordHashingRequest(admin, h, http.MethodPost, "/admin/password-hashing/benchmark", `{"target_ms":10}`).Code)
+	w = passwordHashingRequest(admin, h, http.MethodPost, "/admin/password-hashing/benchmark", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 500*time.Millisecond, benchmarked)
+	assert.Contains(t, w.Body.String(), `"recommended":{"algorithm":"argon2id"`)
+	assert.Equal(t, http.StatusConflict,
+		passwordHashingRequest(admin, h, http.MethodPost, "/admin/password-hashing/benchmark", `{"target_ms":250}`).Code)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// permissionSimulator defines the simulator methods used by
+// PermissionSimulatorHandler.
+type permissionSimulator interface {
+	Simulate(ctx context.Context, check *services.PermissionCheck) (*services.PermissionDecision, error)
+}
+
+// PermissionSimulatorHandler lets administrators troubleshoot access by
+// simulating a user's action. All endpoints require system.admin.
+type PermissionSimulatorHandler struct {
+	simulator   permissionSimulator
+	authService requestAuthService
+}
+
+// NewPermissionSimulatorHandler creates a new PermissionSimulatorHandler.
+func NewPermissionSimulatorHandler(simulator permissionSimulator, authService requestAuthService) *PermissionSimulatorHandler {
+	return &PermissionSimulatorHandler{
+		simulator:   simulator,
+		authService: authService,
+	}
+}
+
+// Simulate handles POST /api/v1/admin/permissions/simulate. The decision
+// is returned with 200 whether the action would be allowed or not.
+func (h *PermissionSimulatorHandler) Simulate(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var check services.PermissionCheck
+	if err := c.ShouldBindJSON(&check); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	decision, err := h.simulator.Simulate(c.Request.Context(), &check)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "invalid permission check"):
+			status = http.StatusBadRequest
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to simulate permission check", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": decision})
+}
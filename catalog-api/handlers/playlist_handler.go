@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playlistService defines the playlist methods used by PlaylistHandler.
+type playlistService interface {
+	ListPlaylists(ctx context.Context, userID int) ([]services.CatalogPlaylist, error)
+	CreatePlaylist(ctx context.Context, userID int, input services.CatalogPlaylistInput) (*services.CatalogPlaylist, error)
+	GetPlaylist(ctx context.Context, userID int, id int64) (*services.CatalogPlaylist, error)
+	UpdatePlaylist(ctx context.Context, userID int, id int64, input services.CatalogPlaylistInput) (*services.CatalogPlaylist, error)
+	DeletePlaylist(ctx context.Context, userID int, id int64) error
+	RestorePlaylist(ctx context.Context, userID int, id int64) (*services.CatalogPlaylist, error)
+	AddItems(ctx context.Context, userID int, id int64, mediaItemIDs []int64, position int) (*services.CatalogPlaylist, error)
+	RemoveItem(ctx context.Context, userID int, id, itemID int64) (*services.CatalogPlaylist, error)
+	ReorderItems(ctx context.Context, userID int, id int64, itemIDs []int64) (*services.CatalogPlaylist, error)
+	ExportPlaylist(ctx context.Context, userID int, id int64, format string, w io.Writer) error
+}
+
+// PlaylistHandler manages users' playlists of catalog media items,
+// including smart playlists, and exports them as play queues.
+type PlaylistHandler struct {
+	playlists   playlistService
+	authService requestAuthService
+	undo        undoRecorder
+}
+
+// NewPlaylistHandler creates a new PlaylistHandler.
+func NewPlaylistHandler(playlists playlistService, authService requestAuthService) *PlaylistHandler {
+	return &PlaylistHandler{
+		playlists:   playlists,
+		authService: authService,
+	}
+}
+
+// SetUndoJournal journals playlist deletes so users can undo them.
+func (h *PlaylistHandler) SetUndoJournal(journal undoRecorder) {
+	h.undo = journal
+}
+
+// playlistErrorStatus maps service errors to HTTP status codes.
+func playlistErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// ListPlaylists handles GET /api/v1/playlists.
+func (h *PlaylistHandler) ListPlaylists(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+
+	playlists, err := h.playlists.ListPlaylists(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list playlists", "details": err.Error()})
+		return
+	}
+	if playlists == nil {
+		playlists = []services.CatalogPlaylist{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlists})
+}
+
+// CreatePlaylist handles POST /api/v1/playlists. A playlist with a rule
+// is a smart playlist.
+func (h *PlaylistHandler) CreatePlaylist(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+
+	var req services.CatalogPlaylistInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	playlist, err := h.playlists.CreatePlaylist(c.Request.Context(), currentUser.ID, req)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to create playlist", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": playlist})
+}
+
+// GetPlaylist handles GET /api/v1/playlists/:id.
+func (h *PlaylistHandler) GetPlaylist(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+
+	playlist, err := h.playlists.GetPlaylist(c.Request.Context(), currentUser.ID, id)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to load playlist", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlist})
+}
+
+// UpdatePlaylist handles PUT /api/v1/playlists/:id.
+func (h *PlaylistHandler) UpdatePlaylist(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+
+	var req services.CatalogPlaylistInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	playlist, err := h.playlists.UpdatePlaylist(c.Request.Context(), currentUser.ID, id, req)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to update playlist", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlist})
+}
+
+// DeletePlaylist handles DELETE /api/v1/playlists/:id.
+func (h *PlaylistHandler) DeletePlaylist(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+
+	if err := h.playlists.DeletePlaylist(c.Request.Context(), currentUser.ID, id); err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to delete playlist", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"success": true}
+	if undo := recordUndo(c, h.undo, currentUser.ID, services.UndoKindDelete, "playlists", id,
+		fmt.Sprintf("Deleted playlist %d", id), nil); undo != nil {
+		response["undo"] = undo
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RestorePlaylist handles POST /api/v1/playlists/:id/restore. Owners can
+// bring back their deleted playlists until they are purged.
+func (h *PlaylistHandler) RestorePlaylist(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+
+	playlist, err := h.playlists.RestorePlaylist(c.Request.Context(), currentUser.ID, id)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to restore playlist", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlist})
+}
+
+// AddItems handles POST /api/v1/playlists/:id/items. Items go at position,
+// counted from 1, or at the end when it is omitted.
+func (h *PlaylistHandler) AddItems(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MediaItemIDs []int64 `json:"media_item_ids" binding:"required"`
+		Position     int     `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	playlist, err := h.playlists.AddItems(c.Request.Context(), currentUser.ID, id, req.MediaItemIDs, req.Position)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to add playlist items", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlist})
+}
+
+// RemoveItem handles DELETE /api/v1/playlists/:id/items/:item_id.
+func (h *PlaylistHandler) RemoveItem(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+	itemID, ok := parseIDParam(c, "item_id", "playlist item")
+	if !ok {
+		return
+	}
+
+	playlist, err := h.playlists.RemoveItem(c.Request.Context(), currentUser.ID, id, itemID)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to remove playlist item", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlist})
+}
+
+// ReorderItems handles PUT /api/v1/playlists/:id/items/order with every
+// playlist item id in the new order.
+func (h *PlaylistHandler) ReorderItems(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ItemIDs []int64 `json:"item_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	playlist, err := h.playlists.ReorderItems(c.Request.Context(), currentUser.ID, id, req.ItemIDs)
+	if err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to reorder playlist", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": playlist})
+}
+
+// ExportPlaylist handles GET /api/v1/playlists/:id/export?format=m3u|json,
+// the play queue as an M3U file of stream URLs or as JSON. M3U is the
+// default.
+func (h *PlaylistHandler) ExportPlaylist(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "playlist")
+	if !ok {
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", services.PlaylistExportM3U))
+
+	var body strings.Builder
+	if err := h.playlists.ExportPlaylist(linkContext(c), currentUser.ID, id, format, &body); err != nil {
+		c.JSON(playlistErrorStatus(err), gin.H{"success": false, "error": "Failed to export playlist", "details": err.Error()})
+		return
+	}
+
+	contentType := "audio/x-mpegurl"
+	if format == services.PlaylistExportJSON {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="playlist-%d.%s"`, id, format))
+	c.Data(http.StatusOK, contentType, []byte(body.String()))
+}
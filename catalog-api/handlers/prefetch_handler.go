@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prefetchService defines the prefetch cache methods used by PrefetchHandler.
+type prefetchService interface {
+	Stats(ctx context.Context) (*services.PrefetchStats, error)
+	ListEntries(ctx context.Context) ([]services.PrefetchEntry, error)
+	Evict(ctx context.Context, fileID int64) error
+	Clear(ctx context.Context) (int, error)
+}
+
+// PrefetchHandler exposes the local prefetch cache to administrators: hit
+// rate, contents and manual eviction.
+type PrefetchHandler struct {
+	prefetch    prefetchService
+	authService requestAuthService
+}
+
+// NewPrefetchHandler creates a new PrefetchHandler.
+func NewPrefetchHandler(prefetch prefetchService, authService requestAuthService) *PrefetchHandler {
+	return &PrefetchHandler{
+		prefetch:    prefetch,
+		authService: authService,
+	}
+}
+
+// GetStats handles GET /api/v1/admin/prefetch/stats.
+func (h *PrefetchHandler) GetStats(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	stats, err := h.prefetch.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load prefetch cache stats", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
+
+// ListEntries handles GET /api/v1/admin/prefetch/entries.
+func (h *PrefetchHandler) ListEntries(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	entries, err := h.prefetch.ListEntries(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list prefetch cache entries", "details": err.Error()})
+		return
+	}
+	if entries == nil {
+		entries = []services.PrefetchEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+}
+
+// EvictEntry handles DELETE /api/v1/admin/prefetch/entries/:file_id.
+func (h *PrefetchHandler) EvictEntry(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	fileID, ok := parseIDParam(c, "file_id", "file")
+	if !ok {
+		return
+	}
+
+	if err := h.prefetch.Evict(c.Request.Context(), fileID); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to evict prefetch cache entry", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ClearCache handles DELETE /api/v1/admin/prefetch/entries.
+func (h *PrefetchHandler) ClearCache(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	removed, err := h.prefetch.Clear(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to clear prefetch cache", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"removed": removed}})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// providerKeyPool defines the key pool methods used by ProviderKeysHandler.
+type providerKeyPool interface {
+	Status(ctx context.Context) []services.ProviderKeyStatus
+}
+
+// ProviderKeysHandler reports on the API keys of external metadata and
+// subtitle providers. Every endpoint requires system.admin.
+type ProviderKeysHandler struct {
+	keys        providerKeyPool
+	authService requestAuthService
+}
+
+// NewProviderKeysHandler creates a new ProviderKeysHandler.
+func NewProviderKeysHandler(keys providerKeyPool, authService requestAuthService) *ProviderKeysHandler {
+	return &ProviderKeysHandler{
+		keys:        keys,
+		authService: authService,
+	}
+}
+
+// GetStatus handles GET /api/v1/admin/provider-keys, with each provider's
+// keys, their requests today and the daily quota left. Keys are shown by
+// fingerprint and last characters only.
+func (h *ProviderKeysHandler) GetStatus(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": h.keys.Status(c.Request.Context())})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProviderKeyPool struct{}
+
+func (fakeProviderKeyPool) Status(ctx context.Context) []services.ProviderKeyStatus {
+	remaining := 40
+	return []services.ProviderKeyStatus{{
+		Provider:      "tmdb",
+		DailyQuota:    50,
+		Remaining:     &remaining,
+		Available:     true,
+		QuotaResetsAt: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		Keys:          []services.ProviderKeyUsage{{ID: "a1b2c3d4e5f6", Hint: "…9f3e", Requests: 10, Remaining: &remaining}},
+	}}
+}
+
+func TestProviderKeysHandler_GetStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	request := func(auth requestAuthService) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.GET("/admin/provider-keys", NewProviderKeysHandler(fakeProviderKeyPool{}, auth).GetStatus)
+		req := httptest.NewRequest(http.MethodGet, "/admin/provider-keys", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, request(&permissionAuth{granted: map[string]bool{models.PermissionMediaEdit: true}}).Code)
+
+	w := request(&permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"provider":"tmdb"`)
+	assert.Contains(t, w.Body.String(), `"requests_today":10`)
+	assert.Contains(t, w.Body.String(), `"remaining":40`)
+}
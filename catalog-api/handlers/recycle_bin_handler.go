@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recycleBinService defines the recycle bin methods used by
+// RecycleBinHandler.
+type recycleBinService interface {
+	Retention() time.Duration
+	Summary(ctx context.Context) (map[string]int, error)
+	List(ctx context.Context, resource string, limit, offset int) ([]services.RecycleBinEntry, int, error)
+	Delete(ctx context.Context, resource string, id int64) error
+	Owner(ctx context.Context, resource string, id int64) (*int64, error)
+	Restore(ctx context.Context, resource string, id int64) error
+	Purge(ctx context.Context, resource string, id int64) error
+}
+
+// recycleBinPermissions is the permission needed to see, restore and purge
+// deleted rows of each resource type.
+var recycleBinPermissions = map[string]string{
+	"collections": models.PermissionMediaManage,
+	"playlists":   models.PermissionSystemAdmin,
+	"users":       models.PermissionUserManage,
+	"media":       models.PermissionMediaManage,
+}
+
+// RecycleBinHandler exposes soft-deleted collections, playlists, users and
+// media items for restore and purge, and deletes media items.
+type RecycleBinHandler struct {
+	recycleBin  recycleBinService
+	authService requestAuthService
+	undo        undoRecorder
+}
+
+// NewRecycleBinHandler creates a new RecycleBinHandler.
+func NewRecycleBinHandler(recycleBin recycleBinService, authService requestAuthService) *RecycleBinHandler {
+	return &RecycleBinHandler{
+		recycleBin:  recycleBin,
+		authService: authService,
+	}
+}
+
+// SetUndoJournal journals media deletes so users can undo them.
+func (h *RecycleBinHandler) SetUndoJournal(journal undoRecorder) {
+	h.undo = journal
+}
+
+// recycleBinErrorStatus maps service errors to HTTP status codes.
+func recycleBinErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid resource type"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "FOREIGN KEY"), strings.Contains(msg, "foreign key"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// requireResource checks the resource type and the caller's permission for
+// it. On failure it writes the error response itself and returns false.
+func (h *RecycleBinHandler) requireResource(c *gin.Context, resource string) (*models.User, bool) {
+	permission, ok := recycleBinPermissions[resource]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid resource type", "details": resource})
+		return nil, false
+	}
+	return requirePermission(c, h.authService, permission)
+}
+
+// requireOwner checks that currentUser owns the deleted row or is an
+// administrator before it is restored or purged. Rows without an owner are
+// left to administrators. On failure it writes the error response itself
+// and returns false.
+func (h *RecycleBinHandler) requireOwner(c *gin.Context, currentUser *models.User, resource string, id int64, action string) bool {
+	isAdmin, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check permissions"})
+		return false
+	}
+	if isAdmin {
+		return true
+	}
+
+	owner, err := h.recycleBin.Owner(c.Request.Context(), resource, id)
+	if err != nil {
+		c.JSON(recycleBinErrorStatus(err), gin.H{"success": false, "error": "Failed to " + action + " " + resource, "details": err.Error()})
+		return false
+	}
+	if owner == nil || *owner != int64(currentUser.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Only the owner or an administrator can " + action + " this item"})
+		return false
+	}
+	return true
+}
+
+// GetOverview handles GET /api/v1/admin/recycle-bin.
+func (h *RecycleBinHandler) GetOverview(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	counts, err := h.recycleBin.Summary(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load recycle bin", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"counts":         counts,
+		"retention_days": int(h.recycleBin.Retention() / (24 * time.Hour)),
+	}})
+}
+
+// ListDeleted handles GET /api/v1/admin/recycle-bin/:type.
+func (h *RecycleBinHandler) ListDeleted(c *gin.Context) {
+	resource := c.Param("type")
+	if _, ok := h.requireResource(c, resource); !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, total, err := h.recycleBin.List(c.Request.Context(), resource, limit, offset)
+	if err != nil {
+		c.JSON(recycleBinErrorStatus(err), gin.H{"success": false, "error": "Failed to list deleted " + resource, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries, "total": total, "limit": limit, "offset": offset})
+}
+
+// RestoreDeleted handles POST /api/v1/admin/recycle-bin/:type/:id/restore.
+func (h *RecycleBinHandler) RestoreDeleted(c *gin.Context) {
+	h.restore(c, c.Param("type"))
+}
+
+// RestoreResource returns a handler for POST /api/v1/<resource>/:id/restore
+// that restores rows of one resource type.
+func (h *RecycleBinHandler) RestoreResource(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.restore(c, resource)
+	}
+}
+
+func (h *RecycleBinHandler) restore(c *gin.Context, resource string) {
+	currentUser, ok := h.requireResource(c, resource)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "resource")
+	if !ok {
+		return
+	}
+	if !h.requireOwner(c, currentUser, resource, id, "restore") {
+		return
+	}
+
+	if err := h.recycleBin.Restore(c.Request.Context(), resource, id); err != nil {
+		c.JSON(recycleBinErrorStatus(err), gin.H{"success": false, "error": "Failed to restore " + resource, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"resource": resource, "id": id}})
+}
+
+// PurgeDeleted handles DELETE /api/v1/admin/recycle-bin/:type/:id.
+func (h *RecycleBinHandler) PurgeDeleted(c *gin.Context) {
+	resource := c.Param("type")
+	currentUser, ok := h.requireResource(c, resource)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "resource")
+	if !ok {
+		return
+	}
+	if !h.requireOwner(c, currentUser, resource, id, "purge") {
+		return
+	}
+
+	if err := h.recycleBin.Purge(c.Request.Context(), resource, id); err != nil {
+		c.JSON(recycleBinErrorStatus(err), gin.H{"success": false, "error": "Failed to purge " + resource, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// DeleteMedia handles DELETE /api/v1/entities/:id. The media item moves to
+// the recycle bin.
+func (h *RecycleBinHandler) DeleteMedia(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaDelete)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "entity")
+	if !ok {
+		return
+	}
+
+	if err := h.recycleBin.Delete(c.Request.Context(), "media", id); err != nil {
+		c.JSON(recycleBinErrorStatus(err), gin.H{"success": false, "error": "Failed to delete media item", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"success": true}
+	if undo := recordUndo(c, h.undo, currentUser.ID, services.UndoKindDelete, "media", id,
+		fmt.Sprintf("Deleted media item %d", id), nil); undo != nil {
+		response["undo"] = undo
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRecycleBinService struct {
+	deleted  map[string]map[int64]bool
+	owners   map[string]map[int64]int64
+	restored []string
+}
+
+func (f *fakeRecycleBinService) Retention() time.Duration { return 30 * 24 * time.Hour }
+
+func (f *fakeRecycleBinService) Summary(ctx context.Context) (map[string]int, error) {
+	counts := map[string]int{}
+	for resource, ids := range f.deleted {
+		counts[resource] = len(ids)
+	}
+	return counts, nil
+}
+
+func (f *fakeRecycleBinService) List(ctx context.Context, resource string, limit, offset int) ([]services.RecycleBinEntry, int, error) {
+	var entries []services.RecycleBinEntry
+	for id := range f.deleted[resource] {
+		entries = append(entries, services.RecycleBinEntry{Resource: resource, ID: id})
+	}
+	return entries, len(entries), nil
+}
+
+func (f *fakeRecycleBinService) Delete(ctx context.Context, resource string, id int64) error {
+	if f.deleted[resource][id] {
+		return fmt.Errorf("%s %d not found", resource, id)
+	}
+	if f.deleted[resource] == nil {
+		f.deleted[resource] = map[int64]bool{}
+	}
+	f.deleted[resource][id] = true
+	return nil
+}
+
+func (f *fakeRecycleBinService) Owner(ctx context.Context, resource string, id int64) (*int64, error) {
+	if !f.deleted[resource][id] {
+		return nil, fmt.Errorf("deleted %s %d not found", resource, id)
+	}
+	owner, ok := f.owners[resource][id]
+	if !ok {
+		return nil, nil
+	}
+	return &owner, nil
+}
+
+func (f *fakeRecycleBinService) Restore(ctx context.Context, resource string, id int64) error {
+	if !f.deleted[resource][id] {
+		return fmt.Errorf("deleted %s %d not found", resource, id)
+	}
+	delete(f.deleted[resource], id)
+	f.restored = append(f.restored, fmt.Sprintf("%s/%d", resource, id))
+	return nil
+}
+
+func (f *fakeRecycleBinService) Purge(ctx context.Context, resource string, id int64) error {
+	if !f.deleted[resource][id] {
+		return fmt.Errorf("deleted %s %d not found", resource, id)
+	}
+	delete(f.deleted[resource], id)
+	return nil
+}
+
+// permissionAuth grants only the listed permissions.
+type permissionAuth struct {
+	granted map[string]bool
+}
+
+func (p *permissionAuth) GetCurrentUser(token string) (*models.User, error) {
+	return &models.User{ID: 1}, nil
+}
+
+func (p *permissionAuth) CheckPermission(userID int, permission string) (bool, error) {
+	return p.granted[permission], nil
+}
+
+func newRecycleBinTestRouter(svc *fakeRecycleBinService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewRecycleBinHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/recycle-bin", h.GetOverview)
+	r.GET("/admin/recycle-bin/:type", h.ListDeleted)
+	r.POST("/admin/recycle-bin/:type/:id/restore", h.RestoreDeleted)
+	r.DELETE("/admin/recycle-bin/:type/:id", h.PurgeDeleted)
+	r.POST("/collections/:id/restore", h.RestoreResource("collections"))
+	r.DELETE("/entities/:id", h.DeleteMedia)
+	return r
+}
+
+func recycleBinRequest(r *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRecycleBinHandler_DeleteRestorePurge(t *testing.T) {
+	svc := &fakeRecycleBinService{deleted: map[string]map[int64]bool{"collections": {4: true}}}
+	auth := &permissionAuth{granted: map[string]bool{
+		models.PermissionSystemAdmin: true, models.PermissionMediaManage: true, models.PermissionMediaDelete: true,
+	}}
+	r := newRecycleBinTestRouter(svc, auth)
+
+	w := recycleBinRequest(r, http.MethodDelete, "/entities/9")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = recycleBinRequest(r, http.MethodDelete, "/entities/9")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = recycleBinRequest(r, http.MethodGet, "/admin/recycle-bin")
+	require.Equal(t, http.StatusOK, w.Code)
+	var overview struct {
+		Data struct {
+			Counts        map[string]int `json:"counts"`
+			RetentionDays int            `json:"retention_days"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &overview))
+	assert.Equal(t, map[string]int{"collections": 1, "media": 1}, overview.Data.Counts)
+	assert.Equal(t, 30, overview.Data.RetentionDays)
+
+	w = recycleBinRequest(r, http.MethodGet, "/admin/recycle-bin/media")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+
+	w = recycleBinRequest(r, http.MethodPost, "/collections/4/restore")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = recycleBinRequest(r, http.MethodPost, "/admin/recycle-bin/media/9/restore")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"collections/4", "media/9"}, svc.restored)
+
+	w = recycleBinRequest(r, http.MethodDelete, "/admin/recycle-bin/media/9")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = recycleBinRequest(r, http.MethodGet, "/admin/recycle-bin/files")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRecycleBinHandler_PermissionsPerResource(t *testing.T) {
+	svc := &fakeRecycleBinService{deleted: map[string]map[int64]bool{"users": {2: true}}}
+	auth := &permissionAuth{granted: map[string]bool{models.PermissionMediaManage: true}}
+	r := newRecycleBinTestRouter(svc, auth)
+
+	assert.Equal(t, http.StatusOK, recycleBinRequest(r, http.MethodGet, "/admin/recycle-bin/collections").Code)
+	assert.Equal(t, http.StatusForbidden, recycleBinRequest(r, http.MethodGet, "/admin/recycle-bin/users").Code)
+	assert.Equal(t, http.StatusForbidden, recycleBinRequest(r, http.MethodPost, "/admin/recycle-bin/users/2/restore").Code)
+	assert.Equal(t, http.StatusForbidden, recycleBinRequest(r, http.MethodGet, "/admin/recycle-bin").Code)
+	assert.Equal(t, http.StatusForbidden, recycleBinRequest(r, http.MethodDelete, "/entities/3").Code)
+	assert.Empty(t, svc.restored)
+}
+
+func TestRecycleBinHandler_OnlyOwnerOrAdmin(t *testing.T) {
+	svc := &fakeRecycleBinService{
+		deleted: map[string]map[int64]bool{"collections": {4: true, 5: true, 6: true}},
+		owners:  map[string]map[int64]int64{"collections": {4: 2, 5: 1}},
+	}
+	auth := &permissionAuth{granted: map[string]bool{models.PermissionMediaManage: true}}
+	r := newRecycleBinTestRouter(svc, auth)
+
+	// The caller (user 1) holds the role permission but does not own
+	// collection 4, and collection 6 has no owner
+	w := recycleBinRequest(r, http.MethodPost, "/collections/4/restore")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Only the owner or an administrator")
+	assert.Equal(t, http.StatusForbidden, recycleBinRequest(r, http.MethodDelete, "/admin/recycle-bin/collections/4").Code)
+	assert.Equal(t, http.StatusForbidden, recycleBinRequest(r, http.MethodPost, "/admin/recycle-bin/collections/6/restore").Code)
+	assert.Equal(t, http.StatusNotFound, recycleBinRequest(r, http.MethodPost, "/collections/7/restore").Code)
+	assert.Empty(t, svc.restored)
+	assert.True(t, svc.deleted["collections"][4])
+
+	// The owner may restore their own collection
+	assert.Equal(t, http.StatusOK, recycleBinRequest(r, http.MethodPost, "/collections/5/restore").Code)
+
+	// Administrators may restore and purge anyone's
+	auth.granted[models.PermissionSystemAdmin] = true
+	assert.Equal(t, http.StatusOK, recycleBinRequest(r, http.MethodPost, "/collections/4/restore").Code)
+	assert.Equal(t, http.StatusOK, recycleBinRequest(r, http.MethodDelete, "/admin/recycle-bin/collections/6").Code)
+	assert.Equal(t, []string{"collections/5", "collections/4"}, svc.restored)
+}
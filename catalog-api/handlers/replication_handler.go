@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replicationService defines the replication methods used by
+// ReplicationHandler.
+type replicationService interface {
+	ListRules(ctx context.Context) ([]services.ReplicationRule, error)
+	CreateRule(ctx context.Context, req services.ReplicationRuleRequest) (*services.ReplicationRule, error)
+	UpdateRule(ctx context.Context, id int64, req services.ReplicationRuleRequest) (*services.ReplicationRule, error)
+	DeleteRule(ctx context.Context, id int64) error
+	StartRule(ctx context.Context, id int64) (*services.ReplicationRule, error)
+	ListItems(ctx context.Context, ruleID int64, status string, limit, offset int) ([]services.ReplicationItem, int, error)
+}
+
+// ReplicationHandler manages the rules that copy collections and sections
+// of remote libraries to local storage. Every endpoint requires
+// system.admin.
+type ReplicationHandler struct {
+	replication replicationService
+	authService requestAuthService
+}
+
+// NewReplicationHandler creates a new ReplicationHandler.
+func NewReplicationHandler(replication replicationService, authService requestAuthService) *ReplicationHandler {
+	return &ReplicationHandler{
+		replication: replication,
+		authService: authService,
+	}
+}
+
+// replicationErrorStatus maps service errors to HTTP status codes.
+func replicationErrorStatus(err error) int {
+	if errors.Is(err, services.ErrRemoteUnavailable) {
+		return http.StatusBadGateway
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already exists"), strings.Contains(msg, "already running"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// ListRules handles GET /api/v1/admin/replication/rules.
+func (h *ReplicationHandler) ListRules(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	rules, err := h.replication.ListRules(c.Request.Context())
+	if err != nil {
+		c.JSON(replicationErrorStatus(err), gin.H{"success": false, "error": "Failed to list replication rules", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rules})
+}
+
+// CreateRule handles POST /api/v1/admin/replication/rules.
+func (h *ReplicationHandler) CreateRule(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req services.ReplicationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	rule, err := h.replication.CreateRule(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(replicationErrorStatus(err), gin.H{"success": false, "error": "Failed to create replication rule", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": rule})
+}
+
+// UpdateRule handles PUT /api/v1/admin/replication/rules/:id.
+func (h *ReplicationHandler) UpdateRule(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "rule")
+	if !ok {
+		return
+	}
+
+	var req services.ReplicationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	rule, err := h.replication.UpdateRule(c.Request.Context(), id, req)
+	if err != nil {
+		c.JSON(replicationErrorStatus(err), gin.H{"success": false, "error": "Failed to update replication rule", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rule})
+}
+
+// DeleteRule handles DELETE /api/v1/admin/replication/rules/:id. Files
+// already copied stay in local storage.
+func (h *ReplicationHandler) DeleteRule(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "rule")
+	if !ok {
+		return
+	}
+
+	if err := h.replication.DeleteRule(c.Request.Context(), id); err != nil {
+		c.JSON(replicationErrorStatus(err), gin.H{"success": false, "error": "Failed to delete replication rule", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RunRule handles POST /api/v1/admin/replication/rules/:id/run. The run
+// continues in the background; its outcome is recorded on the rule.
+func (h *ReplicationHandler) RunRule(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "rule")
+	if !ok {
+		return
+	}
+
+	rule, err := h.replication.StartRule(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(replicationErrorStatus(err), gin.H{"success": false, "error": "Failed to start replication", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": rule})
+}
+
+// ListItems handles GET /api/v1/admin/replication/rules/:id/items. The
+// optional status parameter (copied or failed) narrows the list.
+func (h *ReplicationHandler) ListItems(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "rule")
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "24"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 24
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items, total, err := h.replication.ListItems(c.Request.Context(), id, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(replicationErrorStatus(err), gin.H{"success": false, "error": "Failed to list replicated files", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": items, "total": total, "limit": limit, "offset": offset})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReplicationService struct {
+	status string
+	limit  int
+}
+
+func (f *fakeReplicationService) ListRules(ctx context.Context) ([]services.ReplicationRule, error) {
+	return []services.ReplicationRule{{ID: 1, Name: "Laptop"}}, nil
+}
+
+func (f *fakeReplicationService) CreateRule(ctx context.Context, req services.ReplicationRuleRequest) (*services.ReplicationRule, error) {
+	if req.Name == "Laptop" {
+		return nil, fmt.Errorf("replication rule Laptop already exists")
+	}
+	if req.SourceType == "" {
+		return nil, fmt.Errorf("invalid replication rule: source_type must be collection or section")
+	}
+	return &services.ReplicationRule{ID: 2, Name: req.Name, SourceType: req.SourceType}, nil
+}
+
+func (f *fakeReplicationService) UpdateRule(ctx context.Context, id int64, req services.ReplicationRuleRequest) (*services.ReplicationRule, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("replication rule not found")
+	}
+	return &services.ReplicationRule{ID: id, Name: "Laptop"}, nil
+}
+
+func (f *fakeReplicationService) DeleteRule(ctx context.Context, id int64) error {
+	if id != 1 {
+		return fmt.Errorf("replication rule not found")
+	}
+	return nil
+}
+
+func (f *fakeReplicationService) StartRule(ctx context.Context, id int64) (*services.ReplicationRule, error) {
+	if id == 2 {
+		return nil, fmt.Errorf("replication rule Movies is already running")
+	}
+	return &services.ReplicationRule{ID: id, Running: true}, nil
+}
+
+func (f *fakeReplicationService) ListItems(ctx context.Context, ruleID int64, status string, limit, offset int) ([]services.ReplicationItem, int, error) {
+	f.status, f.limit = status, limit
+	return []services.ReplicationItem{{RuleID: ruleID, RemoteFileID: 20, Status: status}}, 1, nil
+}
+
+func newReplicationTestRouter(svc *fakeReplicationService, auth requestAuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewReplicationHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/replication/rules", h.ListRules)
+	r.POST("/admin/replication/rules", h.CreateRule)
+	r.PUT("/admin/replication/rules/:id", h.UpdateRule)
+	r.DELETE("/admin/replication/rules/:id", h.DeleteRule)
+	r.POST("/admin/replication/rules/:id/run", h.RunRule)
+	r.GET("/admin/replication/rules/:id/items", h.ListItems)
+	return r
+}
+
+func replicationRequest(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReplicationHandler_Rules(t *testing.T) {
+	svc := &fakeReplicationService{}
+	viewer := newReplicationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}})
+	assert.Equal(t, http.StatusForbidden, replicationRequest(viewer, http.MethodGet, "/admin/replication/rules", "").Code)
+	assert.Equal(t, http.StatusForbidden, replicationRequest(viewer, http.MethodPost, "/admin/replication/rules/1/run", "").Code)
+
+	r := newReplicationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}})
+	w := replicationRequest(r, http.MethodGet, "/admin/replication/rules", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Laptop"`)
+
+	w = replicationRequest(r, http.MethodPost, "/admin/replication/rules",
+		`{"remote_id":1,"name":"Movies","source_type":"section","source":"movie","storage_root":"travel",
+		  "bandwidth_schedule":[{"start":"09:00","end":"17:00","pause":true}]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"source_type":"section"`)
+	assert.Equal(t, http.StatusConflict, replicationRequest(r, http.MethodPost, "/admin/replication/rules", `{"name":"Laptop"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, replicationRequest(r, http.MethodPost, "/admin/replication/rules", `{"name":"Games"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, replicationRequest(r, http.MethodPost, "/admin/replication/rules", `{"name":`).Code)
+
+	assert.Equal(t, http.StatusOK, replicationRequest(r, http.MethodPut, "/admin/replication/rules/1", `{"enabled":false}`).Code)
+	assert.Equal(t, http.StatusNotFound, replicationRequest(r, http.MethodPut, "/admin/replication/rules/5", `{}`).Code)
+	assert.Equal(t, http.StatusOK, replicationRequest(r, http.MethodDelete, "/admin/replication/rules/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, replicationRequest(r, http.MethodDelete, "/admin/replication/rules/5", "").Code)
+	assert.Equal(t, http.StatusBadRequest, replicationRequest(r, http.MethodDelete, "/admin/replication/rules/x", "").Code)
+}
+
+func TestReplicationHandler_RunAndItems(t *testing.T) {
+	svc := &fakeReplicationService{}
+	r := newReplicationTestRouter(svc, &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}})
+
+	w := replicationRequest(r, http.MethodPost, "/admin/replication/rules/1/run", "")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"running":true`)
+	assert.Equal(t, http.StatusConflict, replicationRequest(r, http.MethodPost, "/admin/replication/rules/2/run", "").Code)
+
+	w = replicationRequest(r, http.MethodGet, "/admin/replication/rules/1/items?status=failed&limit=500", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "failed", svc.status)
+	assert.Equal(t, 24, svc.limit)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"catalogizer/middleware"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestAuthService defines the auth methods needed to resolve and authorize
+// the caller of a gin handler.
+type requestAuthService interface {
+	GetCurrentUser(token string) (*models.User, error)
+	CheckPermission(userID int, permission string) (bool, error)
+}
+
+// requestCredential returns the API key of a request or, when it has none,
+// its bearer token. AuthService.GetCurrentUser accepts either.
+func requestCredential(header http.Header) string {
+	if key := header.Get(middleware.APIKeyHeader); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+}
+
+// permissionChecker checks role permissions by user ID.
+type permissionChecker interface {
+	CheckPermission(userID int, permission string) (bool, error)
+}
+
+// checkPermission reports whether user holds permission. A user signed in
+// with an API key carries a role narrowed to the key's scopes, which must
+// grant the permission too.
+func checkPermission(authService permissionChecker, user *models.User, permission string) (bool, error) {
+	allowed, err := authService.CheckPermission(user.ID, permission)
+	if err != nil || !allowed {
+		return allowed, err
+	}
+	if user.Role != nil && !user.Role.Permissions.HasPermission(permission) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// currentUserFromRequest resolves the user owning the API key or bearer
+// token on the request.
+func currentUserFromRequest(c *gin.Context, authService requestAuthService) (*models.User, error) {
+	token := requestCredential(c.Request.Header)
+	if token == "" {
+		return nil, fmt.Errorf("missing authorization header")
+	}
+
+	user, err := authService.GetCurrentUser(token)
+	if err != nil {
+		return nil, fmt.Errorf("auth error: %w", err)
+	}
+	return user, nil
+}
+
+// requirePermission resolves the current user and verifies they hold the
+// given permission. On failure it writes the error response itself and
+// returns false.
+func requirePermission(c *gin.Context, authService requestAuthService, permission string) (*models.User, bool) {
+	currentUser, err := currentUserFromRequest(c, authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return nil, false
+	}
+
+	allowed, err := checkPermission(authService, currentUser, permission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check permissions"})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Insufficient permissions"})
+		return nil, false
+	}
+
+	return currentUser, true
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseCache defines the cache methods used by CacheResponses and
+// ResponseCacheHandler.
+type responseCache interface {
+	Get(ctx context.Context, namespace, key string) (*services.CachedResponse, bool)
+	Set(ctx context.Context, namespace, key string, response services.CachedResponse)
+	Purge(ctx context.Context, namespace string) (int64, error)
+	InvalidateCatalog(ctx context.Context)
+	Metrics() services.ResponseCacheMetrics
+	MaxBodyBytes() int
+}
+
+// responseCacheHeader tells clients whether a response came from the
+// cache.
+const responseCacheHeader = "X-Cache"
+
+// responseCacheKey identifies a request: the user, since listings and
+// searches are filtered by what the user may see, the path and the query
+// with its parameters sorted.
+func responseCacheKey(c *gin.Context) string {
+	userID, _ := c.Get("user_id")
+	sum := sha256.Sum256([]byte(fmt.Sprint(userID) + "\n" + c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()))
+	return hex.EncodeToString(sum[:])
+}
+
+// teeResponseWriter copies what the handler writes, up to limit bytes, so
+// the response can be cached once it is complete. It records the status
+// itself because writers further out, such as CacheHeaders, may buffer it.
+type teeResponseWriter struct {
+	gin.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *teeResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeResponseWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *teeResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *teeResponseWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// CacheResponses serves GET requests from the response cache namespace,
+// and caches successful responses of requests it could not serve. Every
+// response carries an X-Cache header of HIT or MISS.
+func CacheResponses(cache responseCache, namespace string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		key := responseCacheKey(c)
+		if cached, ok := cache.Get(c.Request.Context(), namespace, key); ok {
+			c.Header(responseCacheHeader, "HIT")
+			c.Data(cached.Status, cached.ContentType, cached.Body)
+			c.Abort()
+			return
+		}
+
+		c.Header(responseCacheHeader, "MISS")
+		writer := &teeResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK, limit: cache.MaxBodyBytes()}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.status != http.StatusOK || writer.overflow || c.IsAborted() {
+			return
+		}
+		cache.Set(c.Request.Context(), namespace, key, services.CachedResponse{
+			Status:      writer.status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		})
+	}
+}
+
+// InvalidateResponses purges every cached response after a request that
+// succeeded, for endpoints that change the catalog outside of a scan.
+func InvalidateResponses(cache responseCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() < http.StatusBadRequest {
+			cache.InvalidateCatalog(c.Request.Context())
+		}
+	}
+}
+
+// ResponseCacheHandler reports on and purges the response cache. Every
+// endpoint requires system.admin.
+type ResponseCacheHandler struct {
+	cache       responseCache
+	authService requestAuthService
+}
+
+// NewResponseCacheHandler creates a new ResponseCacheHandler.
+func NewResponseCacheHandler(cache responseCache, authService requestAuthService) *ResponseCacheHandler {
+	return &ResponseCacheHandler{
+		cache:       cache,
+		authService: authService,
+	}
+}
+
+// GetMetrics handles GET /api/v1/admin/response-cache, with the hits,
+// misses and purges of each namespace.
+func (h *ResponseCacheHandler) GetMetrics(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": h.cache.Metrics()})
+}
+
+// Purge handles DELETE /api/v1/admin/response-cache. The namespace query
+// parameter limits the purge to catalog, search or stats responses.
+func (h *ResponseCacheHandler) Purge(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	deleted, err := h.cache.Purge(c.Request.Context(), c.Query("namespace"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid namespace") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to purge response cache", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"deleted": deleted}})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/middleware"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newResponseCacheRouter serves a listing that counts how often its
+// handler runs, a statistic that fails until fixed, a mutation that
+// invalidates the cache and the admin endpoints.
+func newResponseCacheRouter(auth requestAuthService, calls *int, statsFailing *bool) (*gin.Engine, *services.ResponseCacheService) {
+	gin.SetMode(gin.TestMode)
+	cache := services.NewResponseCacheService(services.NewMemoryResponseCacheBackend(0), nil, services.ResponseCacheConfig{})
+	h := NewResponseCacheHandler(cache, auth)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		c.Next()
+	})
+	r.GET("/catalog/*path", CacheResponses(cache, services.ResponseCacheCatalog), func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusOK, gin.H{"path": c.Param("path"), "calls": *calls})
+	})
+	r.GET("/stats/overall", middleware.CacheHeaders(60), CacheResponses(cache, services.ResponseCacheStats), func(c *gin.Context) {
+		if *statsFailing {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database locked"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"files": 3})
+	})
+	r.POST("/search/duplicates/resolve", InvalidateResponses(cache), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/admin/response-cache", h.GetMetrics)
+	r.DELETE("/admin/response-cache", h.Purge)
+	return r, cache
+}
+
+func responseCacheRequest(r *gin.Engine, method, target, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCacheResponses(t *testing.T) {
+	calls, statsFailing := 0, true
+	r, cache := newResponseCacheRouter(&permissionAuth{}, &calls, &statsFailing)
+
+	w := responseCacheRequest(r, http.MethodGet, "/catalog/movies?sort=name&limit=10", "1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	w = responseCacheRequest(r, http.MethodGet, "/catalog/movies?limit=10&sort=name", "1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"), "query parameter order does not matter")
+	assert.JSONEq(t, `{"path":"/movies","calls":1}`, w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, "MISS", responseCacheRequest(r, http.MethodGet, "/catalog/movies?limit=10&sort=name", "2").Header().Get("X-Cache"),
+		"users do not share responses")
+	assert.Equal(t, "MISS", responseCacheRequest(r, http.MethodGet, "/catalog/movies?limit=20", "1").Header().Get("X-Cache"))
+	assert.Equal(t, 3, calls)
+
+	// Errors are not cached, even when an outer middleware buffers the status
+	assert.Equal(t, http.StatusInternalServerError, responseCacheRequest(r, http.MethodGet, "/stats/overall", "1").Code)
+	statsFailing = false
+	w = responseCacheRequest(r, http.MethodGet, "/stats/overall", "1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	w = responseCacheRequest(r, http.MethodGet, "/stats/overall", "1")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"files":3}`, w.Body.String())
+
+	// A change to the catalog drops every cached response
+	assert.Equal(t, http.StatusNoContent, responseCacheRequest(r, http.MethodPost, "/search/duplicates/resolve", "1").Code)
+	assert.Equal(t, "MISS", responseCacheRequest(r, http.MethodGet, "/catalog/movies?limit=20", "1").Header().Get("X-Cache"))
+
+	stats := cache.Metrics()
+	assert.Equal(t, services.ResponseCacheMetrics{Backend: "memory", Namespaces: []services.ResponseCacheNamespaceMetrics{
+		{Namespace: "catalog", TTLSeconds: 600, Hits: 1, Misses: 4, HitRate: 0.2, Purges: 1},
+		{Namespace: "search", TTLSeconds: 120, Purges: 1},
+		{Namespace: "stats", TTLSeconds: 600, Hits: 1, Misses: 2, HitRate: 1.0 / 3, Purges: 1},
+	}}, stats)
+}
+
+func TestResponseCacheHandler(t *testing.T) {
+	calls, statsFailing := 0, false
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}}
+	r, _ := newResponseCacheRouter(viewer, &calls, &statsFailing)
+	assert.Equal(t, http.StatusForbidden, responseCacheRequest(r, http.MethodGet, "/admin/response-cache", "1").Code)
+	assert.Equal(t, http.StatusForbidden, responseCacheRequest(r, http.MethodDelete, "/admin/response-cache", "1").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	r, _ = newResponseCacheRouter(admin, &calls, &statsFailing)
+	responseCacheRequest(r, http.MethodGet, "/catalog/a", "1")
+	responseCacheRequest(r, http.MethodGet, "/catalog/b", "1")
+	responseCacheRequest(r, http.MethodGet, "/stats/overall", "1")
+
+	w := responseCacheRequest(r, http.MethodGet, "/admin/response-cache", "1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"backend":"memory"`)
+	assert.Contains(t, w.Body.String(), `"namespace":"catalog"`)
+
+	assert.Equal(t, http.StatusBadRequest, responseCacheRequest(r, http.MethodDelete, "/admin/response-cache?namespace=users", "1").Code)
+	w = responseCacheRequest(r, http.MethodDelete, "/admin/response-cache?namespace=catalog", "1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"success":true,"data":{"deleted":2}}`, w.Body.String())
+	assert.Equal(t, "HIT", responseCacheRequest(r, http.MethodGet, "/stats/overall", "1").Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", responseCacheRequest(r, http.MethodGet, "/catalog/a", "1").Header().Get("X-Cache"))
+}
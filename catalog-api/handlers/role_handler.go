@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"catalogizer/internal/services"
 	"catalogizer/models"
 )
 
@@ -27,6 +28,7 @@ type RoleAuthServiceInterface interface {
 type RoleHandler struct {
 	userRepo    RoleUserServiceInterface
 	authService RoleAuthServiceInterface
+	audit       auditRecorder
 }
 
 func NewRoleHandler(userRepo RoleUserServiceInterface, authService RoleAuthServiceInterface) *RoleHandler {
@@ -36,6 +38,11 @@ func NewRoleHandler(userRepo RoleUserServiceInterface, authService RoleAuthServi
 	}
 }
 
+// SetAuditLog records created, changed and deleted roles in the audit log.
+func (h *RoleHandler) SetAuditLog(audit auditRecorder) {
+	h.audit = audit
+}
+
 func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -48,7 +55,7 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionSystemAdmin)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -83,6 +90,11 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	role.ID = id
+	recordAudit(r, h.audit, currentUser.ID, services.AuditEventRoleCreated, map[string]interface{}{
+		"role_id":     id,
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -101,7 +113,7 @@ func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionSystemAdmin)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -145,7 +157,7 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionSystemAdmin)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -190,6 +202,12 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, h.audit, currentUser.ID, services.AuditEventRoleUpdated, map[string]interface{}{
+		"role_id":     roleID,
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	})
+
 	updatedRole, err := h.userRepo.GetRole(roleID)
 	if err != nil {
 		http.Error(w, "Failed to get updated role", http.StatusInternalServerError)
@@ -212,7 +230,7 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionSystemAdmin)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -243,6 +261,7 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to delete role", http.StatusInternalServerError)
 		return
 	}
+	recordAudit(r, h.audit, currentUser.ID, services.AuditEventRoleDeleted, map[string]interface{}{"role_id": roleID})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -259,7 +278,7 @@ func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionSystemAdmin)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -292,7 +311,7 @@ func (h *RoleHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionSystemAdmin)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionSystemAdmin)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -340,7 +359,7 @@ func (h *RoleHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *RoleHandler) getCurrentUser(r *http.Request) (*models.User, error) {
-	token := extractToken(r)
+	token := requestCredential(r.Header)
 	if token == "" {
 		return nil, models.ErrUnauthorized
 	}
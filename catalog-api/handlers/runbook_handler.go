@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runbookService defines the runbook methods used by RunbookHandler.
+type runbookService interface {
+	ListRunbooks(ctx context.Context) ([]services.Runbook, error)
+	GetRunbook(ctx context.Context, id int64) (*services.Runbook, error)
+	CreateRunbook(ctx context.Context, req services.RunbookRequest, userID int) (*services.Runbook, error)
+	UpdateRunbook(ctx context.Context, id int64, req services.RunbookRequest) (*services.Runbook, error)
+	DeleteRunbook(ctx context.Context, id int64) error
+	StartRun(ctx context.Context, runbookID int64, parameters map[string]string, userID int) (*services.RunbookRun, error)
+	ListRuns(ctx context.Context, runbookID int64, limit int) ([]services.RunbookRun, error)
+	GetRun(ctx context.Context, id int64) (*services.RunbookRun, error)
+	AbortRun(ctx context.Context, id int64) error
+}
+
+// RunbookHandler saves maintenance runbooks and runs them. Every endpoint
+// requires system.admin.
+type RunbookHandler struct {
+	runbooks    runbookService
+	authService requestAuthService
+}
+
+// NewRunbookHandler creates a new RunbookHandler.
+func NewRunbookHandler(runbooks runbookService, authService requestAuthService) *RunbookHandler {
+	return &RunbookHandler{
+		runbooks:    runbooks,
+		authService: authService,
+	}
+}
+
+// runbookErrorStatus maps service errors to HTTP status codes.
+func runbookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRunbookRunning),
+		strings.Contains(err.Error(), "already exists"),
+		strings.Contains(err.Error(), "is not running"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// runbookID parses the :id path parameter, answering 400 when it is not
+// a number.
+func runbookID(c *gin.Context, what string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + what + " ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ListRunbooks handles GET /api/v1/admin/runbooks.
+func (h *RunbookHandler) ListRunbooks(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	runbooks, err := h.runbooks.ListRunbooks(c.Request.Context())
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to list runbooks", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runbooks})
+}
+
+// GetRunbook handles GET /api/v1/admin/runbooks/:id.
+func (h *RunbookHandler) GetRunbook(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := runbookID(c, "runbook")
+	if !ok {
+		return
+	}
+
+	runbook, err := h.runbooks.GetRunbook(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to load runbook", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runbook})
+}
+
+// CreateRunbook handles POST /api/v1/admin/runbooks.
+func (h *RunbookHandler) CreateRunbook(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	var req services.RunbookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	runbook, err := h.runbooks.CreateRunbook(c.Request.Context(), req, currentUser.ID)
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to create runbook", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": runbook})
+}
+
+// UpdateRunbook handles PUT /api/v1/admin/runbooks/:id.
+func (h *RunbookHandler) UpdateRunbook(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := runbookID(c, "runbook")
+	if !ok {
+		return
+	}
+
+	var req services.RunbookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	runbook, err := h.runbooks.UpdateRunbook(c.Request.Context(), id, req)
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to update runbook", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runbook})
+}
+
+// DeleteRunbook handles DELETE /api/v1/admin/runbooks/:id.
+func (h *RunbookHandler) DeleteRunbook(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := runbookID(c, "runbook")
+	if !ok {
+		return
+	}
+
+	if err := h.runbooks.DeleteRunbook(c.Request.Context(), id); err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to delete runbook", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Runbook deleted"})
+}
+
+// StartRun handles POST /api/v1/admin/runbooks/:id/run. The run goes on in
+// the background; the status of its steps is read from the runs
+// endpoints.
+func (h *RunbookHandler) StartRun(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	id, ok := runbookID(c, "runbook")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Parameters map[string]string `json:"parameters"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+
+	run, err := h.runbooks.StartRun(c.Request.Context(), id, req.Parameters, currentUser.ID)
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to start runbook", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": run})
+}
+
+// ListRuns handles GET /api/v1/admin/runbooks/runs. Pass ?runbook_id= to
+// list the runs of one runbook.
+func (h *RunbookHandler) ListRuns(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	runbookID, _ := strconv.ParseInt(c.Query("runbook_id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	runs, err := h.runbooks.ListRuns(c.Request.Context(), runbookID, limit)
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to list runbook runs", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runs})
+}
+
+// GetRun handles GET /api/v1/admin/runbooks/runs/:id.
+func (h *RunbookHandler) GetRun(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := runbookID(c, "runbook run")
+	if !ok {
+		return
+	}
+
+	run, err := h.runbooks.GetRun(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to load runbook run", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
+
+// AbortRun handles POST /api/v1/admin/runbooks/runs/:id/abort. The run
+// stops after its always steps, which the response does not wait for.
+func (h *RunbookHandler) AbortRun(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := runbookID(c, "runbook run")
+	if !ok {
+		return
+	}
+
+	if err := h.runbooks.AbortRun(c.Request.Context(), id); err != nil {
+		c.JSON(runbookErrorStatus(err), gin.H{"success": false, "error": "Failed to abort runbook run", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Runbook run aborting"})
+}
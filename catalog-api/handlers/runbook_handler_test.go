@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRunbookService struct {
+	running    bool
+	parameters map[string]string
+	startedBy  int
+}
+
+func (f *fakeRunbookService) ListRunbooks(ctx context.Context) ([]services.Runbook, error) {
+	return []services.Runbook{{ID: 1, Name: "nightly"}}, nil
+}
+
+func (f *fakeRunbookService) GetRunbook(ctx context.Context, id int64) (*services.Runbook, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("runbook %d not found", id)
+	}
+	return &services.Runbook{ID: 1, Name: "nightly"}, nil
+}
+
+func (f *fakeRunbookService) CreateRunbook(ctx context.Context, req services.RunbookRequest, userID int) (*services.Runbook, error) {
+	if len(req.Steps) == 0 {
+		return nil, fmt.Errorf("invalid runbook: at least one step is required")
+	}
+	return &services.Runbook{ID: 2, Name: req.Name, Steps: req.Steps, CreatedBy: userID}, nil
+}
+
+func (f *fakeRunbookService) UpdateRunbook(ctx context.Context, id int64, req services.RunbookRequest) (*services.Runbook, error) {
+	if req.Name == "taken" {
+		return nil, fmt.Errorf("runbook %q already exists", req.Name)
+	}
+	return &services.Runbook{ID: id, Name: req.Name, Steps: req.Steps}, nil
+}
+
+func (f *fakeRunbookService) DeleteRunbook(ctx context.Context, id int64) error {
+	_, err := f.GetRunbook(ctx, id)
+	return err
+}
+
+func (f *fakeRunbookService) StartRun(ctx context.Context, runbookID int64, parameters map[string]string, userID int) (*services.RunbookRun, error) {
+	if f.running {
+		return nil, services.ErrRunbookRunning
+	}
+	if parameters["share"] == "" {
+		return nil, fmt.Errorf("invalid parameters: share is required")
+	}
+	f.running, f.parameters, f.startedBy = true, parameters, userID
+	return &services.RunbookRun{ID: 5, RunbookID: runbookID, Status: services.RunbookRunning}, nil
+}
+
+func (f *fakeRunbookService) ListRuns(ctx context.Context, runbookID int64, limit int) ([]services.RunbookRun, error) {
+	return []services.RunbookRun{{ID: 5, RunbookID: 1, Status: services.RunbookCompleted}}, nil
+}
+
+func (f *fakeRunbookService) GetRun(ctx context.Context, id int64) (*services.RunbookRun, error) {
+	if id != 5 {
+		return nil, fmt.Errorf("runbook run %d not found", id)
+	}
+	return &services.RunbookRun{ID: 5, Status: services.RunbookRunning}, nil
+}
+
+func (f *fakeRunbookService) AbortRun(ctx context.Context, id int64) error {
+	if !f.running {
+		return fmt.Errorf("runbook run %d is not running", id)
+	}
+	f.running = false
+	return nil
+}
+
+func runbookRequest(auth requestAuthService, svc *fakeRunbookService, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewRunbookHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/runbooks", h.ListRunbooks)
+	r.POST("/admin/runbooks", h.CreateRunbook)
+	r.GET("/admin/runbooks/runs", h.ListRuns)
+	r.GET("/admin/runbooks/runs/:id", h.GetRun)
+	r.POST("/admin/runbooks/runs/:id/abort", h.AbortRun)
+	r.GET("/admin/runbooks/:id", h.GetRunbook)
+	r.PUT("/admin/runbooks/:id", h.UpdateRunbook)
+	r.DELETE("/admin/runbooks/:id", h.DeleteRunbook)
+	r.POST("/admin/runbooks/:id/run", h.StartRun)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRunbookHandler(t *testing.T) {
+	svc := &fakeRunbookService{}
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionAnalyticsView: true}}
+	assert.Equal(t, http.StatusForbidden, runbookRequest(viewer, svc, http.MethodGet, "/admin/runbooks", "").Code)
+	assert.Equal(t, http.StatusForbidden, runbookRequest(viewer, svc, http.MethodPost, "/admin/runbooks/1/run", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	w := runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks",
+		`{"name":"nightly","steps":[{"action":"read_only"},{"action":"exit_read_only","always":true}]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"always":true`)
+	assert.Equal(t, http.StatusBadRequest, runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks", `{"name":"empty"}`).Code)
+
+	assert.Equal(t, http.StatusOK, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks", "").Code)
+	assert.Equal(t, http.StatusOK, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks/9", "").Code)
+	assert.Equal(t, http.StatusBadRequest, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks/x", "").Code)
+	assert.Equal(t, http.StatusConflict,
+		runbookRequest(admin, svc, http.MethodPut, "/admin/runbooks/1", `{"name":"taken","steps":[]}`).Code)
+	assert.Equal(t, http.StatusOK, runbookRequest(admin, svc, http.MethodDelete, "/admin/runbooks/1", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks/1/run", "").Code)
+	w = runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks/1/run", `{"parameters":{"share":"films"}}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "films", svc.parameters["share"])
+	assert.Equal(t, 1, svc.startedBy)
+	assert.Equal(t, http.StatusConflict,
+		runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks/1/run", `{"parameters":{"share":"films"}}`).Code)
+
+	assert.Equal(t, http.StatusOK, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks/runs", "").Code)
+	assert.Equal(t, http.StatusOK, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks/runs/5", "").Code)
+	assert.Equal(t, http.StatusNotFound, runbookRequest(admin, svc, http.MethodGet, "/admin/runbooks/runs/6", "").Code)
+	assert.Equal(t, http.StatusAccepted, runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks/runs/5/abort", "").Code)
+	assert.Equal(t, http.StatusConflict, runbookRequest(admin, svc, http.MethodPost, "/admin/runbooks/runs/5/abort", "").Code)
+}
@@ -26,6 +26,7 @@ type scannerInterface interface {
 type ScanHandler struct {
 	scanner scannerInterface
 	db      *database.DB
+	audit   auditRecorder
 }
 
 // NewScanHandler creates a new ScanHandler.
@@ -33,6 +34,11 @@ func NewScanHandler(scanner scannerInterface, db *database.DB) *ScanHandler {
 	return &ScanHandler{scanner: scanner, db: db}
 }
 
+// SetAuditLog records saved storage root credentials in the audit log.
+func (h *ScanHandler) SetAuditLog(audit auditRecorder) {
+	h.audit = audit
+}
+
 // createStorageRootRequest is the JSON body for POST /storage/roots.
 type createStorageRootRequest struct {
 	Name     string  `json:"name" binding:"required"`
@@ -43,6 +49,7 @@ type createStorageRootRequest struct {
 	Username *string `json:"username"`
 	Password *string `json:"password"`
 	Domain   *string `json:"domain"`
+	URL      *string `json:"url"`
 	MaxDepth int     `json:"max_depth"`
 }
 
@@ -69,10 +76,10 @@ func (h *ScanHandler) CreateStorageRoot(c *gin.Context) {
 	if err == nil {
 		// Update existing
 		_, updateErr := h.db.ExecContext(c.Request.Context(),
-			`UPDATE storage_roots SET protocol=?, host=?, port=?, path=?, username=?, password=?, domain=?, max_depth=?, updated_at=CURRENT_TIMESTAMP
+			`UPDATE storage_roots SET protocol=?, host=?, port=?, path=?, username=?, password=?, domain=?, url=?, max_depth=?, updated_at=CURRENT_TIMESTAMP
 			 WHERE id=?`,
 			req.Protocol, req.Host, req.Port, req.Path,
-			req.Username, req.Password, req.Domain, req.MaxDepth, existingID,
+			req.Username, req.Password, req.Domain, req.URL, req.MaxDepth, existingID,
 		)
 		if updateErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to update storage root: %v", updateErr)})
@@ -82,10 +89,10 @@ func (h *ScanHandler) CreateStorageRoot(c *gin.Context) {
 	} else {
 		// Insert new
 		newID, insertErr := h.db.InsertReturningID(c.Request.Context(),
-			`INSERT INTO storage_roots (name, protocol, host, port, path, username, password, domain, enabled, max_depth)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO storage_roots (name, protocol, host, port, path, username, password, domain, url, enabled, max_depth)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			req.Name, req.Protocol, req.Host, req.Port, req.Path,
-			req.Username, req.Password, req.Domain, true, req.MaxDepth,
+			req.Username, req.Password, req.Domain, req.URL, true, req.MaxDepth,
 		)
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create storage root: %v", insertErr)})
@@ -94,6 +101,16 @@ func (h *ScanHandler) CreateStorageRoot(c *gin.Context) {
 		id = newID
 	}
 
+	if req.Username != nil || req.Password != nil {
+		// The password itself is never recorded
+		userID, _ := strconv.Atoi(c.GetString("user_id"))
+		details := map[string]interface{}{"storage_root": req.Name, "protocol": req.Protocol}
+		if req.Username != nil {
+			details["username"] = *req.Username
+		}
+		recordAudit(c.Request, h.audit, userID, services.AuditEventShareCredentialsChanged, details)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"id":       id,
 		"name":     req.Name,
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scannerService defines the scanner methods used by ScanJobHandler.
+type scannerService interface {
+	StartScan(ctx context.Context, storageRootID int64, trigger string) (*services.ScanJobProgress, error)
+	GetJob(ctx context.Context, id int64) (*services.ScanJobProgress, error)
+	ListJobs(ctx context.Context, limit int) ([]services.ScanJobProgress, error)
+	CancelJob(ctx context.Context, id int64) error
+	ListSchedules(ctx context.Context) ([]services.ScanSchedule, error)
+	SetSchedule(ctx context.Context, storageRootID int64, cron, timeZone string, enabled bool) (*services.ScanSchedule, error)
+	DeleteSchedule(ctx context.Context, storageRootID int64) error
+	ListHashRateLimits(ctx context.Context) ([]services.HashRateLimit, error)
+	SetHashRateLimit(ctx context.Context, storageRootID, bytesPerSecond int64) (*services.HashRateLimit, error)
+	DeleteHashRateLimit(ctx context.Context, storageRootID int64) error
+	ListTraversalPolicies(ctx context.Context) ([]services.ScanTraversalPolicy, error)
+	SetTraversalPolicy(ctx context.Context, policy services.ScanTraversalPolicy) (*services.ScanTraversalPolicy, error)
+	DeleteTraversalPolicy(ctx context.Context, storageRootID int64) error
+	ListTypeMismatches(ctx context.Context, storageRootID int64, limit, offset int) ([]services.TypeMismatch, int64, error)
+}
+
+// ScanJobHandler exposes the background scanner: its jobs with live
+// progress, the per-root scan schedules, the per-root caps on hashing
+// I/O, the per-root rules for symlinks, depth and mount points and the
+// files scans found not to be what their extension says.
+// All endpoints require system.admin.
+type ScanJobHandler struct {
+	scanner     scannerService
+	authService requestAuthService
+}
+
+// NewScanJobHandler creates a new ScanJobHandler.
+func NewScanJobHandler(scanner scannerService, authService requestAuthService) *ScanJobHandler {
+	return &ScanJobHandler{
+		scanner:     scanner,
+		authService: authService,
+	}
+}
+
+// scanJobErrorStatus maps service errors to HTTP status codes.
+func scanJobErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid schedule"), strings.Contains(msg, "invalid hash rate limit"),
+		strings.Contains(msg, "invalid traversal policy"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already being scanned"), strings.Contains(msg, "is disabled"),
+		strings.Contains(msg, "not running"):
+		return http.StatusConflict
+	case strings.Contains(msg, "shutting down"), strings.Contains(msg, "is unavailable"):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// ListJobs handles GET /api/v1/scan/jobs.
+func (h *ScanJobHandler) ListJobs(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	jobs, err := h.scanner.ListJobs(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list scan jobs", "details": err.Error()})
+		return
+	}
+	if jobs == nil {
+		jobs = []services.ScanJobProgress{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": jobs})
+}
+
+// StartJob handles POST /api/v1/scan/jobs.
+func (h *ScanJobHandler) StartJob(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req struct {
+		StorageRootID int64 `json:"storage_root_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	job, err := h.scanner.StartScan(c.Request.Context(), req.StorageRootID, services.ScanTriggerManual)
+	if err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to start scan", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": job})
+}
+
+// GetJob handles GET /api/v1/scan/jobs/:id.
+func (h *ScanJobHandler) GetJob(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "scan job")
+	if !ok {
+		return
+	}
+
+	job, err := h.scanner.GetJob(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to load scan job", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
+
+// CancelJob handles POST /api/v1/scan/jobs/:id/cancel.
+func (h *ScanJobHandler) CancelJob(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "scan job")
+	if !ok {
+		return
+	}
+
+	if err := h.scanner.CancelJob(c.Request.Context(), id); err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to cancel scan job", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Scan job cancellation requested"})
+}
+
+// ListSchedules handles GET /api/v1/scan/schedules. Run times are given in
+// UTC and in the caller's time zone.
+func (h *ScanJobHandler) ListSchedules(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.scanner.ListSchedules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list scan schedules", "details": err.Error()})
+		return
+	}
+	if schedules == nil {
+		schedules = []services.ScanSchedule{}
+	}
+	for i := range schedules {
+		schedules[i].Localize(currentUser.Location())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schedules})
+}
+
+// SetSchedule handles PUT /api/v1/scan/schedules/:root_id.
+func (h *ScanJobHandler) SetSchedule(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	rootID, ok := parseIDParam(c, "root_id", "storage root")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Cron     string `json:"cron" binding:"required"`
+		TimeZone string `json:"time_zone"`
+		Enabled  *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	schedule, err := h.scanner.SetSchedule(c.Request.Context(), rootID, req.Cron, req.TimeZone, enabled)
+	if err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to save scan schedule", "details": err.Error()})
+		return
+	}
+	schedule.Localize(currentUser.Location())
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schedule})
+}
+
+// DeleteSchedule handles DELETE /api/v1/scan/schedules/:root_id.
+func (h *ScanJobHandler) DeleteSchedule(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	rootID, ok := parseIDParam(c, "root_id", "storage root")
+	if !ok {
+		return
+	}
+
+	if err := h.scanner.DeleteSchedule(c.Request.Context(), rootID); err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to delete scan schedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Scan schedule deleted"})
+}
+
+// ListHashRateLimits handles GET /api/v1/scan/hash-limits.
+func (h *ScanJobHandler) ListHashRateLimits(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	limits, err := h.scanner.ListHashRateLimits(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list hash rate limits", "details": err.Error()})
+		return
+	}
+	if limits == nil {
+		limits = []services.HashRateLimit{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": limits})
+}
+
+// SetHashRateLimit handles PUT /api/v1/scan/hash-limits/:root_id.
+func (h *ScanJobHandler) SetHashRateLimit(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	rootID, ok := parseIDParam(c, "root_id", "storage root")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		BytesPerSecond int64 `json:"bytes_per_second" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	limit, err := h.scanner.SetHashRateLimit(c.Request.Context(), rootID, req.BytesPerSecond)
+	if err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to save hash rate limit", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": limit})
+}
+
+// DeleteHashRateLimit handles DELETE /api/v1/scan/hash-limits/:root_id.
+func (h *ScanJobHandler) DeleteHashRateLimit(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	rootID, ok := parseIDParam(c, "root_id", "storage root")
+	if !ok {
+		return
+	}
+
+	if err := h.scanner.DeleteHashRateLimit(c.Request.Context(), rootID); err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to delete hash rate limit", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Hash rate limit deleted"})
+}
+
+// ListTraversalPolicies handles GET /api/v1/scan/traversal-policies.
+func (h *ScanJobHandler) ListTraversalPolicies(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	policies, err := h.scanner.ListTraversalPolicies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list traversal policies", "details": err.Error()})
+		return
+	}
+	if policies == nil {
+		policies = []services.ScanTraversalPolicy{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policies})
+}
+
+// SetTraversalPolicy handles PUT /api/v1/scan/traversal-policies/:root_id.
+// follow_symlinks is never, same_device or always; max_depth, when
+// positive, replaces the root's max_depth; cross_filesystems defaults to
+// true.
+func (h *ScanJobHandler) SetTraversalPolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	rootID, ok := parseIDParam(c, "root_id", "storage root")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FollowSymlinks   string `json:"follow_symlinks" binding:"required"`
+		MaxDepth         int    `json:"max_depth"`
+		CrossFilesystems *bool  `json:"cross_filesystems"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	policy := services.ScanTraversalPolicy{
+		StorageRootID:    rootID,
+		FollowSymlinks:   req.FollowSymlinks,
+		MaxDepth:         req.MaxDepth,
+		CrossFilesystems: req.CrossFilesystems == nil || *req.CrossFilesystems,
+	}
+
+	saved, err := h.scanner.SetTraversalPolicy(c.Request.Context(), policy)
+	if err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to save traversal policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": saved})
+}
+
+// DeleteTraversalPolicy handles DELETE /api/v1/scan/traversal-policies/:root_id.
+func (h *ScanJobHandler) DeleteTraversalPolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	rootID, ok := parseIDParam(c, "root_id", "storage root")
+	if !ok {
+		return
+	}
+
+	if err := h.scanner.DeleteTraversalPolicy(c.Request.Context(), rootID); err != nil {
+		c.JSON(scanJobErrorStatus(err), gin.H{"success": false, "error": "Failed to delete traversal policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Traversal policy deleted"})
+}
+
+// ListTypeMismatches handles GET /api/v1/scan/type-mismatches, the review
+// report of files whose content does not match their extension. Query
+// parameters: storage_root_id narrows it to one root, limit (default
+// 200, max 1000) and offset page through it.
+func (h *ScanJobHandler) ListTypeMismatches(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	var rootID int64
+	if value := c.Query("storage_root_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid storage_root_id"})
+			return
+		}
+		rootID = id
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	mismatches, total, err := h.scanner.ListTypeMismatches(c.Request.Context(), rootID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list type mismatches", "details": err.Error()})
+		return
+	}
+	if mismatches == nil {
+		mismatches = []services.TypeMismatch{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": mismatches, "total": total})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// screenerService defines the campaign methods used by ScreenerHandler.
+type screenerService interface {
+	CreateCampaign(ctx context.Context, campaign *services.ScreenerCampaign) error
+	ListCampaigns(ctx context.Context, userID int) ([]services.ScreenerCampaign, error)
+	GetCampaign(ctx context.Context, userID int, id int64) (*services.ScreenerCampaign, error)
+	CloseCampaign(ctx context.Context, userID int, id int64) error
+	Report(ctx context.Context, userID int, id int64) (*services.ScreenerReport, error)
+}
+
+// ScreenerHandler manages screener campaigns: time-limited share links
+// issued per recipient, with every play and download logged.
+type ScreenerHandler struct {
+	screeners   screenerService
+	authService requestAuthService
+}
+
+// NewScreenerHandler creates a new ScreenerHandler.
+func NewScreenerHandler(screeners screenerService, authService requestAuthService) *ScreenerHandler {
+	return &ScreenerHandler{
+		screeners:   screeners,
+		authService: authService,
+	}
+}
+
+// screenerErrorStatus maps service errors to HTTP status codes.
+func screenerErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid screener campaign"), strings.Contains(msg, "invalid share link"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// CreateCampaign handles POST /api/v1/screeners.
+func (h *ScreenerHandler) CreateCampaign(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareCreate)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        string    `json:"name" binding:"required"`
+		Description string    `json:"description"`
+		ExpiresAt   time.Time `json:"expires_at" binding:"required"`
+		Watermark   bool      `json:"watermark"`
+		FileIDs     []int64   `json:"file_ids" binding:"required"`
+		Recipients  []struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"recipients" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	campaign := services.ScreenerCampaign{
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   currentUser.ID,
+		ExpiresAt:   req.ExpiresAt,
+		Watermark:   req.Watermark,
+		FileIDs:     req.FileIDs,
+	}
+	for _, r := range req.Recipients {
+		campaign.Recipients = append(campaign.Recipients, services.ScreenerRecipient{Name: r.Name, Email: r.Email})
+	}
+	if err := h.screeners.CreateCampaign(c.Request.Context(), &campaign); err != nil {
+		c.JSON(screenerErrorStatus(err), gin.H{"success": false, "error": "Failed to create screener campaign", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": campaign})
+}
+
+// ListCampaigns handles GET /api/v1/screeners.
+func (h *ScreenerHandler) ListCampaigns(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareView)
+	if !ok {
+		return
+	}
+
+	campaigns, err := h.screeners.ListCampaigns(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list screener campaigns", "details": err.Error()})
+		return
+	}
+	if campaigns == nil {
+		campaigns = []services.ScreenerCampaign{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": campaigns})
+}
+
+// GetCampaign handles GET /api/v1/screeners/:id.
+func (h *ScreenerHandler) GetCampaign(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "screener campaign")
+	if !ok {
+		return
+	}
+
+	campaign, err := h.screeners.GetCampaign(c.Request.Context(), currentUser.ID, id)
+	if err != nil {
+		c.JSON(screenerErrorStatus(err), gin.H{"success": false, "error": "Failed to load screener campaign", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": campaign})
+}
+
+// CloseCampaign handles POST /api/v1/screeners/:id/close.
+func (h *ScreenerHandler) CloseCampaign(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareDelete)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "screener campaign")
+	if !ok {
+		return
+	}
+
+	if err := h.screeners.CloseCampaign(c.Request.Context(), currentUser.ID, id); err != nil {
+		c.JSON(screenerErrorStatus(err), gin.H{"success": false, "error": "Failed to close screener campaign", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetReport handles GET /api/v1/screeners/:id/report.
+func (h *ScreenerHandler) GetReport(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "screener campaign")
+	if !ok {
+		return
+	}
+
+	report, err := h.screeners.Report(c.Request.Context(), currentUser.ID, id)
+	if err != nil {
+		c.JSON(screenerErrorStatus(err), gin.H{"success": false, "error": "Failed to build screener report", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
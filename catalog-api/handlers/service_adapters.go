@@ -18,7 +18,7 @@ func (a *AuthServiceAdapter) CheckPermission(userID int, permission string) (boo
 	return a.Inner.CheckPermission(userID, permission)
 }
 
-// GetCurrentUser satisfies UserAuthServiceInterface
+// GetCurrentUser satisfies UserAuthServiceInterface and ConfigurationAuthServiceInterface
 func (a *AuthServiceAdapter) GetCurrentUser(token string) (*models.User, error) {
 	return a.Inner.GetCurrentUser(token)
 }
@@ -125,6 +125,18 @@ func (a *ConfigurationServiceAdapter) GetConfigurationSchema() (*models.Configur
 	return &models.ConfigurationSchema{}, nil
 }
 
+func (a *ConfigurationServiceAdapter) GetCORSConfiguration() (*models.CORSConfig, error) {
+	return a.Inner.GetCORSConfiguration()
+}
+
+func (a *ConfigurationServiceAdapter) UpdateCORSConfiguration(cors *models.CORSConfig) (*models.CORSConfig, error) {
+	config, err := a.Inner.UpdateCORSConfiguration(cors)
+	if err != nil {
+		return nil, err
+	}
+	return config.Network.CORS, nil
+}
+
 // ErrorReportingServiceAdapter adapts *services.ErrorReportingService
 type ErrorReportingServiceAdapter struct {
 	Inner *services.ErrorReportingService
@@ -300,3 +312,8 @@ func (a *LogManagementServiceAdapter) UpdateConfiguration(config *services.LogMa
 func (a *LogManagementServiceAdapter) CleanupOldLogs() error {
 	return a.Inner.CleanupOldLogs()
 }
+
+// ForgetExternalLogins satisfies UserAuthServiceInterface
+func (a *AuthServiceAdapter) ForgetExternalLogins(username string) {
+	a.Inner.ForgetExternalLogins(username)
+}
@@ -40,8 +40,8 @@ func (suite *ServiceAdaptersTestSuite) TestAuthServiceAdapter_GetCurrentUser_Nil
 }
 
 func (suite *ServiceAdaptersTestSuite) TestAuthServiceAdapter_HashPassword_NilInner() {
-	// HashPasswordForUser calls generateSalt which creates crypto random bytes
-	// then hashPassword which uses bcrypt - should work on nil receiver
+	// HashPasswordForUser falls back to the default password hasher on a
+	// nil receiver
 	adapter := &AuthServiceAdapter{Inner: nil}
 	hash, err := adapter.HashPassword("password123")
 	// This should succeed since the method doesn't access struct fields for hashing
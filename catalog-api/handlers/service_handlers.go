@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	internalservices "catalogizer/internal/services"
 	"catalogizer/models"
 	"catalogizer/services"
 
@@ -234,6 +237,7 @@ func (h *ReportingHandler) GetPerformanceReport(c *gin.Context) {
 type FavoritesHandler struct {
 	service *services.FavoritesService
 	logger  *zap.Logger
+	undo    undoRecorder
 }
 
 func NewFavoritesHandler(service *services.FavoritesService, logger *zap.Logger) *FavoritesHandler {
@@ -243,16 +247,55 @@ func NewFavoritesHandler(service *services.FavoritesService, logger *zap.Logger)
 	}
 }
 
-func (h *FavoritesHandler) ListFavorites(c *gin.Context) {
+// SetUndoJournal journals removed favorites and tags so users can undo
+// the removal.
+func (h *FavoritesHandler) SetUndoJournal(journal undoRecorder) {
+	h.undo = journal
+}
+
+// favoritesUserID reads the authenticated user id from the context. The JWT
+// middleware stores it as the token subject string, other middleware as an
+// int. On failure it writes the error response itself.
+func favoritesUserID(c *gin.Context) (int, bool) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
+		return 0, false
 	}
 
-	uid, ok := userID.(int)
+	switch id := userID.(type) {
+	case int:
+		return id, true
+	case int64:
+		return int(id), true
+	case string:
+		if uid, err := strconv.Atoi(id); err == nil {
+			return uid, true
+		}
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user ID"})
+	return 0, false
+}
+
+// favoritesErrorStatus maps favorites service errors to HTTP status codes.
+func favoritesErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "unauthorized"):
+		return http.StatusForbidden
+	case strings.Contains(msg, "already"):
+		return http.StatusConflict
+	case strings.Contains(msg, "invalid"), strings.Contains(msg, "cannot"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *FavoritesHandler) ListFavorites(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user ID"})
 		return
 	}
 
@@ -286,21 +329,18 @@ func (h *FavoritesHandler) ListFavorites(c *gin.Context) {
 }
 
 func (h *FavoritesHandler) AddFavorite(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	uid, ok := userID.(int)
+	uid, ok := favoritesUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user ID"})
 		return
 	}
 
 	var req struct {
-		EntityID   int    `json:"entity_id" binding:"required"`
-		EntityType string `json:"entity_type" binding:"required"`
+		EntityID   int       `json:"entity_id" binding:"required"`
+		EntityType string    `json:"entity_type" binding:"required"`
+		Category   *string   `json:"category"`
+		Notes      *string   `json:"notes"`
+		Tags       *[]string `json:"tags"`
+		IsPublic   bool      `json:"is_public"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -312,28 +352,25 @@ func (h *FavoritesHandler) AddFavorite(c *gin.Context) {
 		UserID:     uid,
 		EntityID:   req.EntityID,
 		EntityType: req.EntityType,
+		Category:   req.Category,
+		Notes:      req.Notes,
+		Tags:       req.Tags,
+		IsPublic:   req.IsPublic,
 	}
 
-	_, err := h.service.AddFavorite(uid, favorite)
+	favorite, err := h.service.AddFavorite(uid, favorite)
 	if err != nil {
 		h.logger.Error("Failed to add favorite", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add favorite"})
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to add favorite", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "added"})
+	c.JSON(http.StatusOK, gin.H{"status": "added", "favorite": favorite})
 }
 
 func (h *FavoritesHandler) RemoveFavorite(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	uid, ok := userID.(int)
+	uid, ok := favoritesUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user ID"})
 		return
 	}
 
@@ -348,25 +385,28 @@ func (h *FavoritesHandler) RemoveFavorite(c *gin.Context) {
 		entityType = c.Query("entity_type")
 	}
 
+	// Kept so the removal can be undone
+	removed, _ := h.service.GetFavoritesByEntity(uid, entityType, entityID)
+
 	if err := h.service.RemoveFavorite(uid, entityType, entityID); err != nil {
 		h.logger.Error("Failed to remove favorite", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove favorite"})
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to remove favorite", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "removed"})
+	response := gin.H{"status": "removed"}
+	if removed != nil {
+		if undo := recordUndo(c, h.undo, uid, internalservices.UndoKindDelete, "favorites", int64(removed.ID),
+			fmt.Sprintf("Removed %s %d from favorites", entityType, entityID), []models.Favorite{*removed}); undo != nil {
+			response["undo"] = undo
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *FavoritesHandler) CheckFavorite(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	uid, ok := userID.(int)
+	uid, ok := favoritesUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user ID"})
 		return
 	}
 
@@ -390,3 +430,342 @@ func (h *FavoritesHandler) CheckFavorite(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"is_favorite": isFavorite})
 }
+
+// UpdateFavorite handles PUT /api/v1/favorites/:id.
+func (h *FavoritesHandler) UpdateFavorite(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	favoriteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid favorite ID"})
+		return
+	}
+
+	var req models.UpdateFavoriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	var previousTags []string
+	if req.Tags != nil {
+		if previous, err := h.service.GetFavorite(uid, favoriteID); err == nil && previous.Tags != nil {
+			previousTags = *previous.Tags
+		}
+	}
+
+	favorite, err := h.service.UpdateFavorite(uid, favoriteID, &req)
+	if err != nil {
+		h.logger.Error("Failed to update favorite", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to update favorite", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"favorite": favorite}
+	if removedTags := missingTags(previousTags, req.Tags); len(removedTags) > 0 {
+		if undo := recordUndo(c, h.undo, uid, internalservices.UndoKindTagRemoval, "favorites", int64(favoriteID),
+			fmt.Sprintf("Removed tags %s from favorite %d", strings.Join(removedTags, ", "), favoriteID), removedTags); undo != nil {
+			response["undo"] = undo
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// missingTags returns the tags in previous that tags no longer has.
+func missingTags(previous []string, tags *[]string) []string {
+	kept := make(map[string]bool)
+	if tags != nil {
+		for _, tag := range *tags {
+			kept[tag] = true
+		}
+	}
+	var missing []string
+	for _, tag := range previous {
+		if !kept[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+// BulkAddFavorites handles POST /api/v1/favorites/bulk. It succeeds when at
+// least one favorite was added; items already in favorites are skipped.
+func (h *FavoritesHandler) BulkAddFavorites(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Favorites []models.BulkFavoriteRequest `json:"favorites" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Favorites) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	favorites, err := h.service.BulkAddFavorites(uid, req.Favorites)
+	if err != nil {
+		h.logger.Error("Failed to bulk add favorites", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to add favorites", "details": err.Error()})
+		return
+	}
+	if favorites == nil {
+		favorites = []models.Favorite{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"favorites": favorites,
+		"added":     len(favorites),
+		"skipped":   len(req.Favorites) - len(favorites),
+	})
+}
+
+// BulkRemoveFavorites handles POST /api/v1/favorites/bulk/remove.
+func (h *FavoritesHandler) BulkRemoveFavorites(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Favorites []models.BulkFavoriteRemoveRequest `json:"favorites" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Favorites) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	// Kept so the removal can be undone
+	var removed []models.Favorite
+	for _, item := range req.Favorites {
+		if favorite, err := h.service.GetFavoritesByEntity(uid, item.EntityType, item.EntityID); err == nil && favorite != nil {
+			removed = append(removed, *favorite)
+		}
+	}
+
+	if err := h.service.BulkRemoveFavorites(uid, req.Favorites); err != nil {
+		h.logger.Error("Failed to bulk remove favorites", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to remove favorites", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"status": "removed", "removed": len(req.Favorites)}
+	if len(removed) > 0 {
+		if undo := recordUndo(c, h.undo, uid, internalservices.UndoKindDelete, "favorites", 0,
+			fmt.Sprintf("Removed %d favorites", len(removed)), removed); undo != nil {
+			response["undo"] = undo
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetStatistics handles GET /api/v1/favorites/statistics.
+func (h *FavoritesHandler) GetStatistics(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.service.GetFavoriteStatistics(uid)
+	if err != nil {
+		h.logger.Error("Failed to get favorite statistics", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get favorite statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// ListCategories handles GET /api/v1/favorites/categories.
+func (h *FavoritesHandler) ListCategories(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	var entityType *string
+	if et := c.Query("entity_type"); et != "" {
+		entityType = &et
+	}
+
+	categories, err := h.service.GetFavoriteCategories(uid, entityType)
+	if err != nil {
+		h.logger.Error("Failed to get favorite categories", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get categories"})
+		return
+	}
+	if categories == nil {
+		categories = []models.FavoriteCategory{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories, "count": len(categories)})
+}
+
+// CreateCategory handles POST /api/v1/favorites/categories.
+func (h *FavoritesHandler) CreateCategory(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.FavoriteCategory
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	category, err := h.service.CreateFavoriteCategory(uid, &req)
+	if err != nil {
+		h.logger.Error("Failed to create favorite category", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to create category", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"category": category})
+}
+
+// UpdateCategory handles PUT /api/v1/favorites/categories/:id. Renaming a
+// category moves its favorites to the new name.
+func (h *FavoritesHandler) UpdateCategory(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category ID"})
+		return
+	}
+
+	var req models.UpdateFavoriteCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	category, err := h.service.UpdateFavoriteCategory(uid, categoryID, &req)
+	if err != nil {
+		h.logger.Error("Failed to update favorite category", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to update category", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"category": category})
+}
+
+// DeleteCategory handles DELETE /api/v1/favorites/categories/:id. Categories
+// still holding favorites cannot be deleted.
+func (h *FavoritesHandler) DeleteCategory(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category ID"})
+		return
+	}
+
+	if err := h.service.DeleteFavoriteCategory(uid, categoryID); err != nil {
+		h.logger.Error("Failed to delete favorite category", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to delete category", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// ShareFavorite handles POST /api/v1/favorites/:id/share. Without explicit
+// permissions the recipients may only view the favorite.
+func (h *FavoritesHandler) ShareFavorite(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	favoriteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid favorite ID"})
+		return
+	}
+
+	var req struct {
+		UserIDs     []int                    `json:"user_ids" binding:"required"`
+		Permissions *models.SharePermissions `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	permissions := models.SharePermissions{CanView: true}
+	if req.Permissions != nil {
+		permissions = *req.Permissions
+	}
+
+	share, err := h.service.ShareFavorite(uid, favoriteID, req.UserIDs, permissions)
+	if err != nil {
+		h.logger.Error("Failed to share favorite", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to share favorite", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"share": share})
+}
+
+// GetSharedFavorites handles GET /api/v1/favorites/shared, the favorites
+// other users have shared with the current user.
+func (h *FavoritesHandler) GetSharedFavorites(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	favorites, err := h.service.GetSharedFavorites(uid, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to get shared favorites", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get shared favorites"})
+		return
+	}
+	if favorites == nil {
+		favorites = []models.Favorite{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"favorites": favorites,
+		"count":     len(favorites),
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// RevokeShare handles DELETE /api/v1/favorites/shares/:id.
+func (h *FavoritesHandler) RevokeShare(c *gin.Context) {
+	uid, ok := favoritesUserID(c)
+	if !ok {
+		return
+	}
+
+	shareID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share ID"})
+		return
+	}
+
+	if err := h.service.RevokeFavoriteShare(uid, shareID); err != nil {
+		h.logger.Error("Failed to revoke favorite share", zap.Error(err))
+		c.JSON(favoritesErrorStatus(err), gin.H{"error": "failed to revoke share", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -263,6 +264,81 @@ func TestFavoritesHandler_CheckFavorite_InvalidEntityID(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestFavoritesUserID(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		wantID int
+		wantOK bool
+		status int
+	}{
+		{"int", 7, 7, true, http.StatusOK},
+		{"int64", int64(7), 7, true, http.StatusOK},
+		{"token subject", "7", 7, true, http.StatusOK},
+		{"bad subject", "alice", 0, false, http.StatusInternalServerError},
+		{"missing", nil, 0, false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.value != nil {
+				c.Set("user_id", tt.value)
+			}
+
+			id, ok := favoritesUserID(c)
+			assert.Equal(t, tt.wantID, id)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestFavoritesErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, favoritesErrorStatus(errors.New("favorite not found")))
+	assert.Equal(t, http.StatusForbidden, favoritesErrorStatus(errors.New("unauthorized to share this favorite")))
+	assert.Equal(t, http.StatusConflict, favoritesErrorStatus(errors.New("category already exists")))
+	assert.Equal(t, http.StatusBadRequest, favoritesErrorStatus(errors.New("cannot delete category with existing favorites")))
+	assert.Equal(t, http.StatusInternalServerError, favoritesErrorStatus(errors.New("favorites repository not configured")))
+}
+
+func TestFavoritesHandler_BulkAddFavorites_EmptyList(t *testing.T) {
+	handler := NewFavoritesHandler(&services.FavoritesService{}, zap.NewNop())
+
+	router := setupTestRouter()
+	router.POST("/favorites/bulk", func(c *gin.Context) {
+		c.Set("user_id", 1)
+		handler.BulkAddFavorites(c)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/favorites/bulk", bytes.NewBufferString(`{"favorites": []}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestFavoritesHandler_ShareFavorite_InvalidID(t *testing.T) {
+	handler := NewFavoritesHandler(&services.FavoritesService{}, zap.NewNop())
+
+	router := setupTestRouter()
+	router.POST("/favorites/:id/share", func(c *gin.Context) {
+		c.Set("user_id", 1)
+		handler.ShareFavorite(c)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/favorites/abc/share", bytes.NewBufferString(`{"user_ids": [2]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestParseDate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupService defines the setup wizard methods used by SetupHandler.
+type setupService interface {
+	Status() (*models.SetupStatus, error)
+	Steps() ([]*models.WizardStep, error)
+	Progress() (*models.WizardProgress, error)
+	ValidateStep(stepID string, data map[string]interface{}) (*models.WizardStepValidation, error)
+	SaveStep(stepID string, data map[string]interface{}) (*models.WizardStepValidation, error)
+	Complete(ctx context.Context, userID int) (*models.SystemConfiguration, error)
+}
+
+// SetupHandler serves the first-run setup wizard. The status is public so
+// clients know to start the wizard before signing in; every other endpoint
+// requires system.configure and stops working once setup has completed.
+type SetupHandler struct {
+	setup       setupService
+	authService requestAuthService
+}
+
+// NewSetupHandler creates a new SetupHandler.
+func NewSetupHandler(setup setupService, authService requestAuthService) *SetupHandler {
+	return &SetupHandler{
+		setup:       setup,
+		authService: authService,
+	}
+}
+
+// setupErrorStatus maps service errors to HTTP status codes.
+func setupErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "already completed"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// GetStatus handles GET /api/v1/setup/status.
+func (h *SetupHandler) GetStatus(c *gin.Context) {
+	status, err := h.setup.Status()
+	if err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to load setup status", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// GetSteps handles GET /api/v1/setup/steps, the wizard's step schema.
+func (h *SetupHandler) GetSteps(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	steps, err := h.setup.Steps()
+	if err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to load setup steps", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": steps})
+}
+
+// GetProgress handles GET /api/v1/setup/progress. Passwords are masked.
+func (h *SetupHandler) GetProgress(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	progress, err := h.setup.Progress()
+	if err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to load setup progress", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": progress})
+}
+
+// ValidateStep handles POST /api/v1/setup/steps/:step_id/validate. The
+// body holds the step's answers; the database, SMB and SMTP steps test
+// their connections. Nothing is saved.
+func (h *SetupHandler) ValidateStep(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+	var data map[string]interface{}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	validation, err := h.setup.ValidateStep(c.Param("step_id"), data)
+	if err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to validate setup step", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": validation})
+}
+
+// SaveStep handles PUT /api/v1/setup/steps/:step_id. Answers that fail
+// validation are not saved and answered with 400 and the validation.
+func (h *SetupHandler) SaveStep(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+	var data map[string]interface{}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	validation, err := h.setup.SaveStep(c.Param("step_id"), data)
+	if err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to save setup step", "details": err.Error()})
+		return
+	}
+	if !validation.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Setup step is invalid", "data": validation})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": validation})
+}
+
+// Complete handles POST /api/v1/setup/complete. It validates every step
+// again, saves the system configuration and opens the rest of the API.
+func (h *SetupHandler) Complete(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemConfig)
+	if !ok {
+		return
+	}
+
+	if _, err := h.setup.Complete(c.Request.Context(), currentUser.ID); err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to complete setup", "details": err.Error()})
+		return
+	}
+	status, err := h.setup.Status()
+	if err != nil {
+		c.JSON(setupErrorStatus(err), gin.H{"success": false, "error": "Failed to load setup status", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
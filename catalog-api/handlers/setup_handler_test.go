@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSetupService struct {
+	completed   bool
+	completedBy int
+	saved       map[string]interface{}
+}
+
+func (f *fakeSetupService) Status() (*models.SetupStatus, error) {
+	return &models.SetupStatus{Completed: f.completed, CurrentStep: "database"}, nil
+}
+
+func (f *fakeSetupService) Steps() ([]*models.WizardStep, error) {
+	return []*models.WizardStep{{ID: "database", Name: "Database Configuration"}}, nil
+}
+
+func (f *fakeSetupService) Progress() (*models.WizardProgress, error) {
+	return &models.WizardProgress{CurrentStep: "database"}, nil
+}
+
+func (f *fakeSetupService) ValidateStep(stepID string, data map[string]interface{}) (*models.WizardStepValidation, error) {
+	if stepID != "database" {
+		return nil, fmt.Errorf("step not found: %s", stepID)
+	}
+	validation := &models.WizardStepValidation{StepID: stepID, Valid: true, Errors: map[string]string{}}
+	if data["database_type"] != "sqlite" {
+		validation.Valid = false
+		validation.Errors["database_type"] = "unsupported database type"
+	}
+	return validation, nil
+}
+
+func (f *fakeSetupService) SaveStep(stepID string, data map[string]interface{}) (*models.WizardStepValidation, error) {
+	if f.completed {
+		return nil, errors.New("setup already completed")
+	}
+	validation, err := f.ValidateStep(stepID, data)
+	if err == nil && validation.Valid {
+		f.saved = data
+	}
+	return validation, err
+}
+
+func (f *fakeSetupService) Complete(ctx context.Context, userID int) (*models.SystemConfiguration, error) {
+	if f.completed {
+		return nil, errors.New("setup already completed")
+	}
+	f.completed, f.completedBy = true, userID
+	return &models.SystemConfiguration{}, nil
+}
+
+func setupRequest(auth requestAuthService, svc *fakeSetupService, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewSetupHandler(svc, auth)
+	r := gin.New()
+	r.GET("/setup/status", h.GetStatus)
+	r.GET("/setup/steps", h.GetSteps)
+	r.GET("/setup/progress", h.GetProgress)
+	r.POST("/setup/steps/:step_id/validate", h.ValidateStep)
+	r.PUT("/setup/steps/:step_id", h.SaveStep)
+	r.POST("/setup/complete", h.Complete)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSetupHandler(t *testing.T) {
+	svc := &fakeSetupService{}
+	viewer := &permissionAuth{granted: map[string]bool{}}
+	w := setupRequest(viewer, svc, http.MethodGet, "/setup/status", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"completed":false`)
+	assert.Equal(t, http.StatusForbidden, setupRequest(viewer, svc, http.MethodGet, "/setup/steps", "").Code)
+	assert.Equal(t, http.StatusForbidden, setupRequest(viewer, svc, http.MethodPost, "/setup/complete", "").Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemConfig: true}}
+	w = setupRequest(admin, svc, http.MethodGet, "/setup/steps", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"database"`)
+
+	w = setupRequest(admin, svc, http.MethodPost, "/setup/steps/database/validate", `{"database_type":"mysql"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid":false`)
+	assert.Equal(t, http.StatusNotFound,
+		setupRequest(admin, svc, http.MethodPost, "/setup/steps/unknown/validate", `{}`).Code)
+
+	// Invalid answers are refused with the validation
+	w = setupRequest(admin, svc, http.MethodPut, "/setup/steps/database", `{"database_type":"mysql"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unsupported database type")
+	assert.Nil(t, svc.saved)
+	assert.Equal(t, http.StatusBadRequest,
+		setupRequest(admin, svc, http.MethodPut, "/setup/steps/database", `{"database_type":`).Code)
+
+	w = setupRequest(admin, svc, http.MethodPut, "/setup/steps/database", `{"database_type":"sqlite"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sqlite", svc.saved["database_type"])
+
+	w = setupRequest(admin, svc, http.MethodPost, "/setup/complete", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"completed":true`)
+	assert.Equal(t, 1, svc.completedBy)
+
+	assert.Equal(t, http.StatusConflict, setupRequest(admin, svc, http.MethodPost, "/setup/complete", "").Code)
+	assert.Equal(t, http.StatusConflict,
+		setupRequest(admin, svc, http.MethodPut, "/setup/steps/database", `{"database_type":"sqlite"}`).Code)
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/middleware"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shareLinkService defines the share link methods used by ShareLinkHandler.
+type shareLinkService interface {
+	CreateLink(ctx context.Context, link *services.ShareLink) error
+	ListLinks(ctx context.Context, userID int) ([]services.ShareLink, error)
+	GetLink(ctx context.Context, userID int, id int64) (*services.ShareLink, error)
+	RevokeLink(ctx context.Context, userID int, id int64) error
+	ShareWithRecipients(ctx context.Context, template *services.ShareLink, recipients []string, message string) ([]services.ShareLink, error)
+	ResendLinkEmail(ctx context.Context, userID int, id int64, message string) (*services.ShareLink, error)
+	LinkStats(ctx context.Context, userID int, id int64) (*services.ShareLinkStats, error)
+	Open(ctx context.Context, token string, access services.ShareAccess) (*services.ShareDownload, error)
+}
+
+// shareAccessGuard defines the proof-of-work guard methods used by
+// ShareLinkHandler.
+type shareAccessGuard interface {
+	RecordFailure()
+	UnderAttack() bool
+	Challenge() (*services.ShareChallenge, error)
+	Verify(challenge, solution string) error
+}
+
+// ShareLinkHandler manages public share links for single files and serves
+// them to anonymous recipients, optionally watermarked.
+type ShareLinkHandler struct {
+	links       shareLinkService
+	authService requestAuthService
+	guard       shareAccessGuard
+}
+
+// NewShareLinkHandler creates a new ShareLinkHandler.
+func NewShareLinkHandler(links shareLinkService, authService requestAuthService) *ShareLinkHandler {
+	return &ShareLinkHandler{
+		links:       links,
+		authService: authService,
+	}
+}
+
+// SetAccessGuard makes anonymous share access solve a proof-of-work
+// challenge while the guard detects a guessing attack.
+func (h *ShareLinkHandler) SetAccessGuard(guard shareAccessGuard) {
+	h.guard = guard
+}
+
+// linkContext carries the address the client reached the API at, so link
+// URLs are absolute even when no public URL is configured.
+func linkContext(c *gin.Context) context.Context {
+	return services.WithRequestBaseURL(c.Request.Context(), middleware.RequestBaseURL(c.Request))
+}
+
+// shareLinkErrorStatus maps service errors to HTTP status codes.
+func shareLinkErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid share link"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "expired"), strings.Contains(msg, "download limit reached"):
+		return http.StatusGone
+	case strings.Contains(msg, "not configured"):
+		return http.StatusServiceUnavailable
+	case strings.Contains(msg, "failed to send share link email"):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// CreateLink handles POST /api/v1/share-links. With recipients, each
+// email address gets its own link by email and the created links are
+// returned as a list.
+func (h *ShareLinkHandler) CreateLink(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareCreate)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FileID            int64      `json:"file_id" binding:"required"`
+		Label             string     `json:"label"`
+		ExpiresAt         *time.Time `json:"expires_at"`
+		MaxDownloads      int        `json:"max_downloads"`
+		Watermark         bool       `json:"watermark"`
+		WatermarkText     string     `json:"watermark_text"`
+		WatermarkPosition string     `json:"watermark_position"`
+		WatermarkMode     string     `json:"watermark_mode"`
+		Recipients        []string   `json:"recipients"`
+		Message           string     `json:"message"`
+		Password          string     `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	link := services.ShareLink{
+		FileID:            req.FileID,
+		CreatedBy:         currentUser.ID,
+		Label:             req.Label,
+		ExpiresAt:         req.ExpiresAt,
+		MaxDownloads:      req.MaxDownloads,
+		Watermark:         req.Watermark,
+		WatermarkText:     req.WatermarkText,
+		WatermarkPosition: req.WatermarkPosition,
+		WatermarkMode:     req.WatermarkMode,
+		Password:          req.Password,
+	}
+	if len(req.Recipients) > 0 {
+		links, err := h.links.ShareWithRecipients(linkContext(c), &link, req.Recipients, req.Message)
+		if err != nil {
+			c.JSON(shareLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to create share links", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"success": true, "data": links})
+		return
+	}
+
+	if err := h.links.CreateLink(linkContext(c), &link); err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to create share link", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": link})
+}
+
+// ListLinks handles GET /api/v1/share-links.
+func (h *ShareLinkHandler) ListLinks(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareView)
+	if !ok {
+		return
+	}
+
+	links, err := h.links.ListLinks(linkContext(c), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list share links", "details": err.Error()})
+		return
+	}
+	if links == nil {
+		links = []services.ShareLink{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": links})
+}
+
+// GetLink handles GET /api/v1/share-links/:id.
+func (h *ShareLinkHandler) GetLink(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "share link")
+	if !ok {
+		return
+	}
+
+	link, err := h.links.GetLink(linkContext(c), currentUser.ID, id)
+	if err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to load share link", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": link})
+}
+
+// RevokeLink handles DELETE /api/v1/share-links/:id.
+func (h *ShareLinkHandler) RevokeLink(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareDelete)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "share link")
+	if !ok {
+		return
+	}
+
+	if err := h.links.RevokeLink(c.Request.Context(), currentUser.ID, id); err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to revoke share link", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ResendEmail handles POST /api/v1/share-links/:id/resend.
+func (h *ShareLinkHandler) ResendEmail(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareCreate)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "share link")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+
+	link, err := h.links.ResendLinkEmail(linkContext(c), currentUser.ID, id, req.Message)
+	if err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to resend share link", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": link})
+}
+
+// GetStats handles GET /api/v1/share-links/:id/stats.
+func (h *ShareLinkHandler) GetStats(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionShareView)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "share link")
+	if !ok {
+		return
+	}
+
+	stats, err := h.links.LinkStats(linkContext(c), currentUser.ID, id)
+	if err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"success": false, "error": "Failed to load share link statistics", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
+
+// requireShareChallenge answers 428 with a fresh challenge while the
+// access guard detects an attack and the request carries no solution to
+// an earlier one. The challenge and solution are read from the
+// X-Share-Challenge and X-Share-Solution headers, or the challenge and
+// solution query or form fields.
+func (h *ShareLinkHandler) requireShareChallenge(c *gin.Context) bool {
+	if h.guard == nil || !h.guard.UnderAttack() {
+		return false
+	}
+	challenge, solution := c.GetHeader("X-Share-Challenge"), c.GetHeader("X-Share-Solution")
+	if challenge == "" {
+		challenge, solution = c.Request.FormValue("challenge"), c.Request.FormValue("solution")
+	}
+	var reason string
+	if challenge == "" {
+		reason = "proof of work required"
+	} else if err := h.guard.Verify(challenge, solution); err != nil {
+		reason = err.Error()
+	} else {
+		return false
+	}
+
+	next, err := h.guard.Challenge()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to issue share challenge", "details": err.Error()})
+		return true
+	}
+	c.JSON(http.StatusPreconditionRequired, gin.H{"success": false, "error": "Proof of work required", "details": reason, "challenge": next})
+	return true
+}
+
+// Download handles GET and POST /api/v1/shared/:token. It needs no
+// authentication: the token is the credential. With ?play=true the file
+// is served inline for in-browser playback and logged as a play rather
+// than a download. Password-protected links take the password in the
+// X-Share-Password header or the password form field of a POST; it is
+// never read from the URL.
+func (h *ShareLinkHandler) Download(c *gin.Context) {
+	if h.requireShareChallenge(c) {
+		return
+	}
+	access := services.ShareAccess{
+		Action:    services.ShareAccessDownload,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Password:  c.GetHeader("X-Share-Password"),
+	}
+	if access.Password == "" {
+		access.Password = c.PostForm("password")
+	}
+	disposition := "attachment"
+	if c.Query("play") == "true" {
+		access.Action = services.ShareAccessPlay
+		disposition = "inline"
+	}
+
+	download, err := h.links.Open(c.Request.Context(), c.Param("token"), access)
+	var locked *services.ShareLinkLockedError
+	switch {
+	case errors.Is(err, services.ErrWatermarkPending):
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "The watermarked file is being prepared; try again shortly"})
+		return
+	case errors.Is(err, services.ErrSharePasswordRequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Password required", "password_required": true})
+		return
+	case errors.Is(err, services.ErrSharePasswordWrong):
+		h.recordShareFailure()
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Wrong password", "password_required": true})
+		return
+	case errors.As(err, &locked):
+		retry := int(time.Until(locked.Until).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retry))
+		c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "error": "Too many wrong passwords", "details": err.Error()})
+		return
+	case err != nil:
+		status := shareLinkErrorStatus(err)
+		if status == http.StatusNotFound {
+			h.recordShareFailure()
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to open shared file", "details": err.Error()})
+		return
+	}
+	defer download.Reader.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(download.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, download.Name))
+	c.Header("Content-Type", contentType)
+	if download.Size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(download.Size, 10))
+	}
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, download.Reader)
+}
+
+// recordShareFailure counts an unknown token or wrong password towards
+// the access guard's attack detection.
+func (h *ShareLinkHandler) recordShareFailure() {
+	if h.guard != nil {
+		h.guard.RecordFailure()
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeShareLinks struct {
+	shareLinkService
+	access services.ShareAccess
+}
+
+func (f *fakeShareLinks) Open(ctx context.Context, token string, access services.ShareAccess) (*services.ShareDownload, error) {
+	f.access = access
+	switch {
+	case token != "good":
+		return nil, fmt.Errorf("share link not found")
+	case access.Password == "":
+		return nil, services.ErrSharePasswordRequired
+	case access.Password == "locked":
+		return nil, &services.ShareLinkLockedError{Until: time.Now().Add(30 * time.Second)}
+	case access.Password != "secret":
+		return nil, services.ErrSharePasswordWrong
+	}
+	return &services.ShareDownload{Name: "notes.txt", Size: 5, Reader: io.NopCloser(strings.NewReader("hello"))}, nil
+}
+
+type fakeShareGuard struct {
+	attack   bool
+	failures int
+}
+
+func (g *fakeShareGuard) RecordFailure()    { g.failures++ }
+func (g *fakeShareGuard) UnderAttack() bool { return g.attack }
+
+func (g *fakeShareGuard) Challenge() (*services.ShareChallenge, error) {
+	return &services.ShareChallenge{Challenge: "c1", Difficulty: 8, Algorithm: "sha256"}, nil
+}
+
+func (g *fakeShareGuard) Verify(challenge, solution string) error {
+	if challenge != "c1" || solution != "42" {
+		return fmt.Errorf("share challenge solution is wrong")
+	}
+	return nil
+}
+
+func shareDownloadRequest(h *ShareLinkHandler, req *http.Request) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/shared/:token", h.Download)
+	r.POST("/shared/:token", h.Download)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestShareLinkHandler_DownloadPassword(t *testing.T) {
+	links := &fakeShareLinks{}
+	guard := &fakeShareGuard{}
+	h := NewShareLinkHandler(links, nil)
+	h.SetAccessGuard(guard)
+
+	w := shareDownloadRequest(h, httptest.NewRequest(http.MethodGet, "/shared/good?password=secret", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "passwords are not read from the URL")
+	assert.Contains(t, w.Body.String(), `"password_required":true`)
+	assert.Equal(t, 0, guard.failures)
+
+	req := httptest.NewRequest(http.MethodGet, "/shared/good", nil)
+	req.Header.Set("X-Share-Password", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, shareDownloadRequest(h, req).Code)
+	assert.Equal(t, 1, guard.failures)
+
+	req = httptest.NewRequest(http.MethodGet, "/shared/good", nil)
+	req.Header.Set("X-Share-Password", "locked")
+	w = shareDownloadRequest(h, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	req = httptest.NewRequest(http.MethodPost, "/shared/good", strings.NewReader(url.Values{"password": {"secret"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = shareDownloadRequest(h, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, "secret", links.access.Password)
+
+	assert.Equal(t, http.StatusNotFound, shareDownloadRequest(h, httptest.NewRequest(http.MethodGet, "/shared/bad", nil)).Code)
+	assert.Equal(t, 2, guard.failures)
+}
+
+func TestShareLinkHandler_DownloadChallenge(t *testing.T) {
+	links := &fakeShareLinks{}
+	guard := &fakeShareGuard{attack: true}
+	h := NewShareLinkHandler(links, nil)
+	h.SetAccessGuard(guard)
+
+	w := shareDownloadRequest(h, httptest.NewRequest(http.MethodGet, "/shared/good", nil))
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Contains(t, w.Body.String(), `"challenge":"c1"`)
+
+	w = shareDownloadRequest(h, httptest.NewRequest(http.MethodGet, "/shared/good?challenge=c1&solution=41", nil))
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Contains(t, w.Body.String(), "solution is wrong")
+
+	req := httptest.NewRequest(http.MethodGet, "/shared/good", nil)
+	req.Header.Set("X-Share-Challenge", "c1")
+	req.Header.Set("X-Share-Solution", "42")
+	req.Header.Set("X-Share-Password", "secret")
+	w = shareDownloadRequest(h, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+}
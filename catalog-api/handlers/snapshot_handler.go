@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotService defines the snapshot methods used by SnapshotHandler.
+type snapshotService interface {
+	ListSnapshots(ctx context.Context, storageRoot string) ([]services.FilesystemSnapshot, error)
+	RestoreFromSnapshot(ctx context.Context, req services.SnapshotRestoreRequest) error
+}
+
+// SnapshotHandler exposes ZFS/Btrfs snapshot enumeration and
+// restore-from-snapshot for local storage roots.
+type SnapshotHandler struct {
+	snapshots   snapshotService
+	authService requestAuthService
+}
+
+// NewSnapshotHandler creates a new SnapshotHandler.
+func NewSnapshotHandler(snapshots snapshotService, authService requestAuthService) *SnapshotHandler {
+	return &SnapshotHandler{
+		snapshots:   snapshots,
+		authService: authService,
+	}
+}
+
+// ListSnapshots handles GET /api/v1/snapshots/:root.
+func (h *SnapshotHandler) ListSnapshots(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionMediaView); !ok {
+		return
+	}
+
+	snapshots, err := h.snapshots.ListSnapshots(c.Request.Context(), c.Param("root"))
+	if err != nil {
+		c.JSON(snapshotErrorStatus(err), gin.H{"success": false, "error": "Failed to list snapshots", "details": err.Error()})
+		return
+	}
+	if snapshots == nil {
+		snapshots = []services.FilesystemSnapshot{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": snapshots})
+}
+
+// RestoreFromSnapshot handles POST /api/v1/snapshots/:root/restore.
+func (h *SnapshotHandler) RestoreFromSnapshot(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionMediaEdit)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Snapshot string `json:"snapshot" binding:"required"`
+		Path     string `json:"path" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	err := h.snapshots.RestoreFromSnapshot(c.Request.Context(), services.SnapshotRestoreRequest{
+		StorageRoot: c.Param("root"),
+		SnapshotID:  req.Snapshot,
+		Path:        req.Path,
+		UserID:      currentUser.ID,
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.JSON(snapshotErrorStatus(err), gin.H{"success": false, "error": "Failed to restore from snapshot", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "File restored from snapshot", "path": req.Path, "snapshot": req.Snapshot}})
+}
+
+func snapshotErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "is locked"):
+		return http.StatusLocked
+	case strings.Contains(msg, "invalid path"), strings.Contains(msg, "only supported"), strings.Contains(msg, "only files"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
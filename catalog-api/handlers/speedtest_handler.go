@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// speedTestBlockSize is the size of the random block download tests
+// repeat. It is larger than the deflate window, so compressing proxies
+// cannot shrink the transfer.
+const speedTestBlockSize = 64 << 10
+
+// SpeedTestConfig sets the sizes of speed test transfers. Zero values use
+// the defaults: 10 MiB downloads and at most 100 MiB per test.
+type SpeedTestConfig struct {
+	DefaultSize int64
+	MaxSize     int64
+}
+
+// SpeedTestHandler lets clients measure their bandwidth and round-trip
+// time to the server, for example to pick a streaming quality or warn
+// about a slow link. Clients time the transfers themselves; the server
+// only reports what it received. The endpoints do no work beyond the
+// transfer, not even a user lookup, so they belong behind the JWT
+// middleware.
+type SpeedTestHandler struct {
+	config SpeedTestConfig
+	block  []byte
+}
+
+// NewSpeedTestHandler creates a new SpeedTestHandler.
+func NewSpeedTestHandler(config SpeedTestConfig) *SpeedTestHandler {
+	if config.MaxSize <= 0 {
+		config.MaxSize = 100 << 20
+	}
+	if config.DefaultSize <= 0 {
+		config.DefaultSize = 10 << 20
+	}
+	if config.DefaultSize > config.MaxSize {
+		config.DefaultSize = config.MaxSize
+	}
+	block := make([]byte, speedTestBlockSize)
+	if _, err := rand.Read(block); err != nil {
+		panic("speed test: failed to generate random data: " + err.Error())
+	}
+	return &SpeedTestHandler{
+		config: config,
+		block:  block,
+	}
+}
+
+// speedTestReader yields size bytes of the random block, repeated.
+type speedTestReader struct {
+	block     []byte
+	remaining int64
+	offset    int
+}
+
+func (r *speedTestReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.block[r.offset:])
+	r.offset = (r.offset + n) % len(r.block)
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// GetInfo handles GET /api/v1/diagnostics/speedtest, describing the test
+// endpoints and their size limits.
+func (h *SpeedTestHandler) GetInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"default_size": h.config.DefaultSize,
+		"max_size":     h.config.MaxSize,
+		"download":     "/api/v1/diagnostics/speedtest/download",
+		"upload":       "/api/v1/diagnostics/speedtest/upload",
+		"ping":         "/api/v1/diagnostics/speedtest/ping",
+	}})
+}
+
+// Download handles GET /api/v1/diagnostics/speedtest/download?size=bytes,
+// sending size bytes of incompressible data. The data is never cached.
+func (h *SpeedTestHandler) Download(c *gin.Context) {
+	size := h.config.DefaultSize
+	if raw := c.Query("size"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 || parsed > h.config.MaxSize {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid speed test size",
+				"details": "size must be between 1 and " + strconv.FormatInt(h.config.MaxSize, 10) + " bytes"})
+			return
+		}
+		size = parsed
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream",
+		&speedTestReader{block: h.block, remaining: size}, nil)
+}
+
+// Upload handles POST /api/v1/diagnostics/speedtest/upload. The body is
+// read and discarded; the response reports how many bytes arrived and how
+// long reading them took on the server.
+func (h *SpeedTestHandler) Upload(c *gin.Context) {
+	if c.Request.ContentLength > h.config.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "Speed test upload too large",
+			"details": "at most " + strconv.FormatInt(h.config.MaxSize, 10) + " bytes per test"})
+		return
+	}
+
+	started := time.Now()
+	received, err := io.Copy(io.Discard, http.MaxBytesReader(c.Writer, c.Request.Body, h.config.MaxSize))
+	elapsed := time.Since(started)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "Speed test upload too large",
+				"details": "at most " + strconv.FormatInt(h.config.MaxSize, 10) + " bytes per test"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Failed to read speed test upload", "details": err.Error()})
+		return
+	}
+
+	var bitsPerSecond float64
+	if elapsed > 0 {
+		bitsPerSecond = float64(received*8) / elapsed.Seconds()
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"bytes":           received,
+		"duration_ms":     elapsed.Milliseconds(),
+		"bits_per_second": int64(bitsPerSecond),
+	}})
+}
+
+// Ping handles GET /api/v1/diagnostics/speedtest/ping, answering as
+// quickly as possible so clients can time the round trip. The value of
+// the echo query parameter is returned as is, so clients can match
+// replies to requests.
+func (h *SpeedTestHandler) Ping(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"echo":        c.Query("echo"),
+		"server_time": time.Now().UTC(),
+	}})
+}
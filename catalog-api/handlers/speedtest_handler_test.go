@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSpeedTestRouter(config SpeedTestConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewSpeedTestHandler(config)
+	r := gin.New()
+	r.GET("/speedtest", h.GetInfo)
+	r.GET("/speedtest/download", h.Download)
+	r.POST("/speedtest/upload", h.Upload)
+	r.GET("/speedtest/ping", h.Ping)
+	return r
+}
+
+func TestSpeedTestHandler_Download(t *testing.T) {
+	r := newSpeedTestRouter(SpeedTestConfig{DefaultSize: 100 << 10, MaxSize: 1 << 20})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/speedtest/download", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 100<<10, w.Body.Len())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "102400", w.Header().Get("Content-Length"))
+
+	// The data does not compress
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	assert.Greater(t, compressed.Len(), 100<<10)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/speedtest/download?size=1000", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1000, w.Body.Len())
+
+	for _, size := range []string{"0", "abc", "1048577"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/speedtest/download?size="+size, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, size)
+	}
+}
+
+func TestSpeedTestHandler_UploadAndPing(t *testing.T) {
+	r := newSpeedTestRouter(SpeedTestConfig{MaxSize: 1 << 10})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/speedtest/upload", strings.NewReader(strings.Repeat("x", 1000))))
+	require.Equal(t, http.StatusOK, w.Code)
+	var upload struct {
+		Data struct {
+			Bytes int64 `json:"bytes"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+	assert.Equal(t, int64(1000), upload.Data.Bytes)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/speedtest/upload", strings.NewReader(strings.Repeat("x", 2000))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Without a Content-Length the limit applies while reading
+	req := httptest.NewRequest(http.MethodPost, "/speedtest/upload", strings.NewReader(strings.Repeat("x", 2000)))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/speedtest/ping?echo=42", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"echo":"42"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/speedtest", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"max_size":1024`)
+	assert.Contains(t, w.Body.String(), `"default_size":1024`)
+}
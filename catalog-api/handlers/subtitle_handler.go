@@ -363,6 +363,81 @@ func (h *SubtitleHandler) VerifySubtitleSync(c *gin.Context) {
 	})
 }
 
+// SubtitleResyncResponse represents the response for subtitle re-sync
+type SubtitleResyncResponse struct {
+	Success bool                    `json:"success"`
+	Message string                  `json:"message,omitempty"`
+	Track   *services.SubtitleTrack `json:"track,omitempty"`
+}
+
+// ResyncSubtitle handles subtitle re-sync requests
+// @Summary Re-sync subtitle
+// @Description Shift SRT/VTT timestamps by an offset and/or convert them between frame rates
+// @Tags subtitles
+// @Accept json
+// @Produce json
+// @Param subtitle_id path string true "Subtitle ID"
+// @Param request body services.SubtitleResyncRequest true "Re-sync request"
+// @Success 200 {object} SubtitleResyncResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/subtitles/{subtitle_id}/resync [post]
+func (h *SubtitleHandler) ResyncSubtitle(c *gin.Context) {
+	subtitleID := c.Param("subtitle_id")
+
+	var request services.SubtitleResyncRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+			Code:    "INVALID_REQUEST",
+		})
+		return
+	}
+	if err := request.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+			Code:    "INVALID_RESYNC_REQUEST",
+		})
+		return
+	}
+
+	track, err := h.subtitleService.ResyncSubtitle(c.Request.Context(), subtitleID, &request)
+	if err != nil {
+		h.logger.Error("Failed to re-sync subtitle",
+			zap.String("subtitle_id", subtitleID),
+			zap.Error(err))
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Success: false,
+				Error:   "Subtitle not found: " + err.Error(),
+				Code:    "SUBTITLE_NOT_FOUND",
+			})
+		case strings.Contains(err.Error(), "unsupported format"), strings.Contains(err.Error(), "no content"):
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Success: false,
+				Error:   err.Error(),
+				Code:    "RESYNC_NOT_SUPPORTED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Success: false,
+				Error:   "Failed to re-sync subtitle: " + err.Error(),
+				Code:    "RESYNC_FAILED",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SubtitleResyncResponse{
+		Success: true,
+		Track:   track,
+	})
+}
+
 // TranslateSubtitle handles subtitle translation requests
 // @Summary Translate subtitle
 // @Description Translate a subtitle to another language
@@ -38,6 +38,7 @@ func (suite *SubtitleHandlerTestSuite) SetupTest() {
 	suite.router.GET("/api/v1/subtitles/languages", suite.handler.GetSupportedLanguages)
 	suite.router.GET("/api/v1/subtitles/providers", suite.handler.GetSupportedProviders)
 	suite.router.POST("/api/v1/subtitles/upload", suite.handler.UploadSubtitle)
+	suite.router.POST("/api/v1/subtitles/:subtitle_id/resync", suite.handler.ResyncSubtitle)
 }
 
 // Constructor tests
@@ -202,6 +203,36 @@ func (suite *SubtitleHandlerTestSuite) TestTranslateSubtitle_PartialFields() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 }
 
+// ResyncSubtitle tests
+
+func (suite *SubtitleHandlerTestSuite) TestResyncSubtitle_InvalidJSON() {
+	req := httptest.NewRequest("POST", "/api/v1/subtitles/5/resync", bytes.NewBufferString("not-json"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	var resp ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "INVALID_REQUEST", resp.Code)
+}
+
+func (suite *SubtitleHandlerTestSuite) TestResyncSubtitle_InvalidRequest() {
+	for _, body := range []string{`{}`, `{"source_frame_rate": 25}`, `{"offset_ms": 100, "source_frame_rate": -1, "target_frame_rate": 25}`} {
+		req := httptest.NewRequest("POST", "/api/v1/subtitles/5/resync", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, body)
+		var resp ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "INVALID_RESYNC_REQUEST", resp.Code)
+	}
+}
+
 // GetSupportedLanguages tests
 
 func (suite *SubtitleHandlerTestSuite) TestGetSupportedLanguages_Success() {
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	internal_services "catalogizer/internal/services"
 	"catalogizer/models"
 	"catalogizer/services"
 
@@ -87,7 +90,7 @@ func (h *SyncHandler) GetEndpoint(c *gin.Context) {
 		return
 	}
 
-	endpoint, err := h.syncService.GetEndpoint(endpointID, currentUser.ID)
+	endpoint, err := h.syncService.GetEndpoint(endpointID, currentUser)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "unauthorized") {
@@ -122,7 +125,7 @@ func (h *SyncHandler) UpdateEndpoint(c *gin.Context) {
 		return
 	}
 
-	updated, err := h.syncService.UpdateEndpoint(endpointID, currentUser.ID, &updates)
+	updated, err := h.syncService.UpdateEndpoint(endpointID, currentUser, &updates)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "unauthorized") {
@@ -155,7 +158,7 @@ func (h *SyncHandler) DeleteEndpoint(c *gin.Context) {
 		return
 	}
 
-	err = h.syncService.DeleteEndpoint(endpointID, currentUser.ID)
+	err = h.syncService.DeleteEndpoint(endpointID, currentUser)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "unauthorized") {
@@ -184,14 +187,23 @@ func (h *SyncHandler) StartSync(c *gin.Context) {
 		return
 	}
 
-	session, err := h.syncService.StartSync(endpointID, currentUser.ID)
+	// The body is optional; it carries conflict resolutions approved from a plan.
+	var req models.StartSyncRequest
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+
+	session, err := h.syncService.StartSyncWithResolutions(endpointID, currentUser, req.Resolutions)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "unauthorized") {
 			status = http.StatusForbidden
 		} else if strings.Contains(err.Error(), "not found") {
 			status = http.StatusNotFound
-		} else if strings.Contains(err.Error(), "not active") {
+		} else if strings.Contains(err.Error(), "not active") || strings.Contains(err.Error(), "already running") {
 			status = http.StatusConflict
 		}
 		c.JSON(status, gin.H{"success": false, "error": "Failed to start sync", "details": err.Error()})
@@ -201,6 +213,178 @@ func (h *SyncHandler) StartSync(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": session})
 }
 
+// PlanSync handles POST /sync/endpoints/:id/plan.
+// It returns the actions a bidirectional sync would take without running it.
+func (h *SyncHandler) PlanSync(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid endpoint ID"})
+		return
+	}
+
+	plan, err := h.syncService.PlanSync(endpointID, currentUser)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "not supported") || strings.Contains(err.Error(), "only supported") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to plan sync", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": plan})
+}
+
+// ListFileVersions handles GET /sync/endpoints/:id/versions?path=.
+// It lists the versions sync kept of a file it overwrote, newest first.
+func (h *SyncHandler) ListFileVersions(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid endpoint ID"})
+		return
+	}
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "path is required"})
+		return
+	}
+
+	versions, err := h.syncService.ListFileVersions(endpointID, currentUser, path)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "not configured") {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to list file versions", "details": err.Error()})
+		return
+	}
+	if versions == nil {
+		versions = []internal_services.FileVersion{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": versions})
+}
+
+// RestoreFileVersion handles POST /sync/endpoints/:id/versions/:version_id/restore.
+func (h *SyncHandler) RestoreFileVersion(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid endpoint ID"})
+		return
+	}
+	versionID, err := strconv.ParseInt(c.Param("version_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid version ID"})
+		return
+	}
+
+	version, err := h.syncService.RestoreFileVersion(endpointID, currentUser, versionID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "not configured") {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to restore file version", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": version})
+}
+
+// LinkCloudAccount handles POST /sync/endpoints/:id/cloud/link. It returns
+// the provider consent URL the user must visit to link their account.
+func (h *SyncHandler) LinkCloudAccount(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid endpoint ID"})
+		return
+	}
+
+	authURL, err := h.syncService.BeginCloudLink(endpointID, currentUser)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "only supported") || strings.Contains(err.Error(), "not configured") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to start account linking", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"auth_url": authURL}})
+}
+
+// CompleteCloudLink handles POST /sync/cloud/callback with the code and
+// state the provider redirected back with.
+func (h *SyncHandler) CompleteCloudLink(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	var req models.CompleteCloudLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	creds, err := h.syncService.CompleteCloudLink(currentUser.ID, req.State, req.Code)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "invalid or expired") || strings.Contains(err.Error(), "not configured") {
+			status = http.StatusBadRequest
+		} else if strings.Contains(err.Error(), "authorization code") {
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to link cloud account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": creds})
+}
+
 // GetUserSessions handles GET /sync/sessions.
 func (h *SyncHandler) GetUserSessions(c *gin.Context) {
 	currentUser, err := h.getCurrentUser(c)
@@ -247,7 +431,7 @@ func (h *SyncHandler) GetSession(c *gin.Context) {
 		return
 	}
 
-	session, err := h.syncService.GetSession(sessionID, currentUser.ID)
+	session, err := h.syncService.GetSession(sessionID, currentUser)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "unauthorized") {
@@ -262,6 +446,79 @@ func (h *SyncHandler) GetSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": session})
 }
 
+// GetSessionProgress handles GET /sync/sessions/:id/progress.
+func (h *SyncHandler) GetSessionProgress(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid session ID"})
+		return
+	}
+
+	progress, err := h.syncService.GetSessionProgress(sessionID, currentUser)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to get sync progress", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": progress})
+}
+
+// GetSessionFailures handles GET /sync/sessions/:id/failures, listing the
+// files the session failed to sync and why (limit, default 100, max 1000;
+// offset).
+func (h *SyncHandler) GetSessionFailures(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid session ID"})
+		return
+	}
+
+	limit := 100
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 1000 {
+			limit = parsedLimit
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	failures, err := h.syncService.GetSessionFailures(sessionID, currentUser, limit, offset)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to get sync failures", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": failures})
+}
+
 // ScheduleSync handles POST /sync/schedules.
 func (h *SyncHandler) ScheduleSync(c *gin.Context) {
 	currentUser, err := h.getCurrentUser(c)
@@ -273,31 +530,91 @@ func (h *SyncHandler) ScheduleSync(c *gin.Context) {
 	var req struct {
 		EndpointID int    `json:"endpoint_id" binding:"required"`
 		Frequency  string `json:"frequency" binding:"required"`
+		TimeZone   string `json:"time_zone"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
 		return
 	}
+	// Without a zone of its own the schedule follows the user's
+	if req.TimeZone == "" && currentUser.TimeZone != nil {
+		if _, err := models.LoadTimeZone(*currentUser.TimeZone); err == nil {
+			req.TimeZone = *currentUser.TimeZone
+		}
+	}
 
 	schedule := &models.SyncSchedule{
 		Frequency: req.Frequency,
+		TimeZone:  req.TimeZone,
 	}
 
-	created, err := h.syncService.ScheduleSync(req.EndpointID, currentUser.ID, schedule)
+	created, err := h.syncService.ScheduleSync(req.EndpointID, currentUser, schedule)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if strings.Contains(err.Error(), "unauthorized") {
 			status = http.StatusForbidden
 		} else if strings.Contains(err.Error(), "not found") {
 			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "invalid") {
+			status = http.StatusBadRequest
 		}
 		c.JSON(status, gin.H{"success": false, "error": "Failed to schedule sync", "details": err.Error()})
 		return
 	}
+	created.Localize(currentUser.Location())
 
 	c.JSON(http.StatusCreated, gin.H{"success": true, "data": created})
 }
 
+// GetSchedules handles GET /sync/schedules. Run times are given in UTC and
+// in the user's time zone.
+func (h *SyncHandler) GetSchedules(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	schedules, err := h.syncService.GetUserSchedules(currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to get sync schedules", "details": err.Error()})
+		return
+	}
+	for i := range schedules {
+		schedules[i].Localize(currentUser.Location())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schedules})
+}
+
+// DeleteSchedule handles DELETE /sync/schedules/:id.
+func (h *SyncHandler) DeleteSchedule(c *gin.Context) {
+	currentUser, err := h.getCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid schedule ID"})
+		return
+	}
+
+	if err := h.syncService.DeleteSchedule(scheduleID, currentUser); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unauthorized") {
+			status = http.StatusForbidden
+		} else if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to delete sync schedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 // GetSyncStatistics handles GET /sync/statistics.
 func (h *SyncHandler) GetSyncStatistics(c *gin.Context) {
 	currentUser, err := h.getCurrentUser(c)
@@ -365,18 +682,13 @@ func (h *SyncHandler) CleanupOldSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": fmt.Sprintf("Cleaned up sessions older than %d days", req.OlderThanDays)}})
 }
 
-// getCurrentUser extracts the current user from the Authorization header.
+// getCurrentUser resolves the user owning the request's API key or bearer token.
 func (h *SyncHandler) getCurrentUser(c *gin.Context) (*models.User, error) {
-	token := c.GetHeader("Authorization")
+	token := requestCredential(c.Request.Header)
 	if token == "" {
 		return nil, fmt.Errorf("missing authorization header")
 	}
 
-	// Remove "Bearer " prefix if present
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	}
-
 	user, err := h.authService.GetCurrentUser(token)
 	if err != nil {
 		return nil, fmt.Errorf("auth error: %w", err)
@@ -6,17 +6,21 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"catalogizer/database"
+	internal_services "catalogizer/internal/services"
 	"catalogizer/internal/tests"
+	"catalogizer/models"
 	"catalogizer/repository"
 	"catalogizer/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -72,9 +76,13 @@ func (s *SyncHandlerTestSuite) SetupTest() {
 	s.router.PUT("/sync/endpoints/:id", s.handler.UpdateEndpoint)
 	s.router.DELETE("/sync/endpoints/:id", s.handler.DeleteEndpoint)
 	s.router.POST("/sync/endpoints/:id/sync", s.handler.StartSync)
+	s.router.POST("/sync/endpoints/:id/plan", s.handler.PlanSync)
 	s.router.GET("/sync/sessions", s.handler.GetUserSessions)
 	s.router.GET("/sync/sessions/:id", s.handler.GetSession)
+	s.router.GET("/sync/sessions/:id/failures", s.handler.GetSessionFailures)
 	s.router.POST("/sync/schedules", s.handler.ScheduleSync)
+	s.router.GET("/sync/schedules", s.handler.GetSchedules)
+	s.router.DELETE("/sync/schedules/:id", s.handler.DeleteSchedule)
 	s.router.GET("/sync/statistics", s.handler.GetSyncStatistics)
 	s.router.POST("/sync/cleanup", s.handler.CleanupOldSessions)
 }
@@ -119,15 +127,24 @@ func (s *SyncHandlerTestSuite) createSyncTables() {
 			failed_files INTEGER DEFAULT 0,
 			skipped_files INTEGER DEFAULT 0,
 			error_message TEXT,
+			skip_reasons TEXT,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (endpoint_id) REFERENCES sync_endpoints(id),
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS sync_session_failures (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL,
+			occurred_at DATETIME NOT NULL
+		)`,
 		`CREATE TABLE IF NOT EXISTS sync_schedules (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			endpoint_id INTEGER NOT NULL,
 			user_id INTEGER NOT NULL,
 			frequency TEXT NOT NULL,
+			time_zone TEXT NOT NULL DEFAULT '',
 			last_run DATETIME,
 			next_run DATETIME,
 			is_active BOOLEAN DEFAULT 1,
@@ -706,6 +723,40 @@ func (s *SyncHandlerTestSuite) TestStartSync_ValidActiveEndpoint() {
 	assert.Equal(s.T(), "manual", data["sync_type"])
 }
 
+func (s *SyncHandlerTestSuite) TestStartSync_ChunkedBody() {
+	endpointID := s.createTestEndpointInDB(s.testUserID, "Chunked EP", "local", "active")
+
+	// A chunked body has no Content-Length, and is still read
+	req := httptest.NewRequest("POST", fmt.Sprintf("/sync/endpoints/%d/sync", endpointID), strings.NewReader("not-json"))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	resp := s.parseResponse(w)
+	assert.Contains(s.T(), resp["error"], "Invalid request body")
+}
+
+// --- PlanSync tests ---
+
+func (s *SyncHandlerTestSuite) TestPlanSync_NotFound() {
+	w := s.doRequest("POST", "/sync/endpoints/9999/plan", nil, true)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *SyncHandlerTestSuite) TestPlanSync_NotBidirectional() {
+	endpointID := s.createTestEndpointInDB(s.testUserID, "One-way EP", "local", "active")
+
+	w := s.doRequest("POST", fmt.Sprintf("/sync/endpoints/%d/plan", endpointID), nil, true)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	resp := s.parseResponse(w)
+	assert.Contains(s.T(), resp["details"], "only supported for bidirectional")
+}
+
 // --- GetUserSessions tests ---
 
 func (s *SyncHandlerTestSuite) TestGetUserSessions_Unauthorized() {
@@ -929,6 +980,73 @@ func (s *SyncHandlerTestSuite) TestScheduleSync_MonthlyFrequency() {
 	assert.Equal(s.T(), http.StatusCreated, w.Code)
 }
 
+func (s *SyncHandlerTestSuite) TestScheduleSync_InvalidFrequency() {
+	endpointID := s.createTestEndpointInDB(s.testUserID, "Fortnightly EP", "local", "active")
+
+	body := map[string]interface{}{
+		"endpoint_id": endpointID,
+		"frequency":   "fortnightly",
+	}
+	w := s.doRequest("POST", "/sync/schedules", body, true)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// --- GetSchedules / DeleteSchedule tests ---
+
+func (s *SyncHandlerTestSuite) TestGetSchedules_Unauthorized() {
+	w := s.doRequest("GET", "/sync/schedules", nil, false)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (s *SyncHandlerTestSuite) TestGetAndDeleteSchedules() {
+	endpointID := s.createTestEndpointInDB(s.testUserID, "Listed EP", "local", "active")
+	w := s.doRequest("POST", "/sync/schedules", map[string]interface{}{
+		"endpoint_id": endpointID,
+		"frequency":   "daily",
+	}, true)
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+	scheduleID := int(s.parseResponse(w)["data"].(map[string]interface{})["id"].(float64))
+
+	w = s.doRequest("GET", "/sync/schedules", nil, true)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	data := s.parseResponse(w)["data"].([]interface{})
+	assert.Len(s.T(), data, 1)
+
+	w = s.doRequest("DELETE", fmt.Sprintf("/sync/schedules/%d", scheduleID), nil, true)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.doRequest("DELETE", fmt.Sprintf("/sync/schedules/%d", scheduleID), nil, true)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *SyncHandlerTestSuite) TestDeleteSchedule_InvalidID() {
+	w := s.doRequest("DELETE", "/sync/schedules/abc", nil, true)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// --- GetSessionFailures tests ---
+
+func (s *SyncHandlerTestSuite) TestGetSessionFailures() {
+	endpointID := s.createTestEndpointInDB(s.testUserID, "Failing EP", "local", "active")
+	sessionID := s.createTestSessionInDB(endpointID, s.testUserID, "failed")
+	_, err := s.db.Exec("INSERT INTO sync_session_failures (session_id, path, message, occurred_at) VALUES (?, ?, ?, ?)",
+		sessionID, "docs/a.txt", "permission denied", time.Now())
+	s.Require().NoError(err)
+
+	w := s.doRequest("GET", fmt.Sprintf("/sync/sessions/%d/failures", sessionID), nil, true)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	data := s.parseResponse(w)["data"].([]interface{})
+	if assert.Len(s.T(), data, 1) {
+		failure := data[0].(map[string]interface{})
+		assert.Equal(s.T(), "docs/a.txt", failure["path"])
+		assert.Equal(s.T(), "permission denied", failure["message"])
+	}
+
+	w = s.doRequest("GET", "/sync/sessions/9999/failures", nil, true)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
 // --- GetSyncStatistics tests ---
 
 func (s *SyncHandlerTestSuite) TestGetSyncStatistics_Unauthorized() {
@@ -1256,3 +1374,55 @@ func (s *SyncHandlerTestSuite) TestGetSession_OverflowID() {
 func TestSyncHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(SyncHandlerTestSuite))
 }
+
+func TestSyncHandler_APIKeyScopes(t *testing.T) {
+	f := newAuthRouterFixture(t)
+	userRepo := repository.NewUserRepository(f.db)
+	syncRepo := repository.NewSyncRepository(f.db)
+	syncService := services.NewSyncService(syncRepo, userRepo, f.authService)
+	syncService.SetVersionService(internal_services.NewFileVersionService(f.db, nil,
+		internal_services.FileVersionConfig{Dir: t.TempDir(), DefaultMaxVersions: 5}))
+	handler := NewSyncHandler(syncService, f.authService)
+	f.api.GET("/sync/endpoints/:id", handler.GetEndpoint)
+	f.api.PUT("/sync/endpoints/:id", handler.UpdateEndpoint)
+	f.api.DELETE("/sync/endpoints/:id", handler.DeleteEndpoint)
+	f.api.POST("/sync/endpoints/:id/sync", handler.StartSync)
+	f.api.POST("/sync/endpoints/:id/plan", handler.PlanSync)
+	f.api.POST("/sync/endpoints/:id/versions/:version_id/restore", handler.RestoreFileVersion)
+
+	// Another user's endpoint, which the admin may view and change
+	bobID, err := userRepo.Create(&models.User{Username: "bob", Email: "bob@example.com", RoleID: 1, IsActive: true})
+	require.NoError(t, err)
+	endpointID, err := syncRepo.CreateEndpoint(&models.SyncEndpoint{
+		UserID: bobID, Name: "bob", Type: models.SyncTypeLocal, URL: "file://" + t.TempDir(),
+		SyncDirection: models.SyncDirectionBidirectional, LocalPath: t.TempDir(),
+		Status: models.SyncStatusActive, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+	path := fmt.Sprintf("/api/v1/sync/endpoints/%d", endpointID)
+
+	w := f.do("GET", path, nil, f.adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A key scoped to viewing shares acts for the admin only that far
+	key := f.apiKey(t, models.PermissionViewShares)
+	w = f.do("GET", path, nil, key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, route := range []struct{ method, path, body string }{
+		{"PUT", path, `{"name": "renamed"}`},
+		{"POST", path + "/sync", ""},
+		{"POST", path + "/plan", ""},
+		{"POST", path + "/versions/1/restore", ""},
+		{"DELETE", path, ""},
+	} {
+		w = f.do(route.method, route.path, strings.NewReader(route.body), key)
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", route.method, route.path)
+	}
+
+	endpoint, err := syncRepo.GetEndpoint(endpointID)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", endpoint.Name)
+	sessions, err := syncRepo.GetUserSessions(f.adminID, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
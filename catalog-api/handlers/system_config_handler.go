@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// systemConfigService defines the configuration methods used by
+// SystemConfigHandler.
+type systemConfigService interface {
+	GetMaskedConfiguration() (*models.SystemConfiguration, error)
+	GetConfigurationSection(section string) (interface{}, error)
+	UpdateConfigurationSection(section string, data []byte) (*models.SystemConfiguration, error)
+	TestConfigurationSections(config *models.SystemConfiguration) (*models.ConfigurationTest, error)
+	CreateBackup(name string) (*models.ConfigurationBackup, error)
+	ListBackups() ([]*models.ConfigurationBackup, error)
+	GetBackup(backupID int) (*models.ConfigurationBackup, error)
+	RestoreBackup(backupID int) (*models.SystemConfiguration, error)
+	DeleteBackup(backupID int) error
+	ListTemplates() ([]*models.ConfigurationTemplate, error)
+	CreateTemplate(template *models.ConfigurationTemplate) (*models.ConfigurationTemplate, error)
+	DeleteTemplate(templateID int) error
+	ApplyTemplate(templateID int) (*models.SystemConfiguration, error)
+}
+
+// SystemConfigHandler manages the live system configuration, its backups
+// and templates. Reading requires system.configure; changing the
+// configuration or testing it requires system.admin. Secrets are masked
+// in every response and a masked secret sent back keeps its saved value.
+type SystemConfigHandler struct {
+	config      systemConfigService
+	authService requestAuthService
+	audit       auditRecorder
+}
+
+// NewSystemConfigHandler creates a new SystemConfigHandler.
+func NewSystemConfigHandler(config systemConfigService, authService requestAuthService) *SystemConfigHandler {
+	return &SystemConfigHandler{
+		config:      config,
+		authService: authService,
+	}
+}
+
+// SetAuditLog records configuration changes in the audit log.
+func (h *SystemConfigHandler) SetAuditLog(audit auditRecorder) {
+	h.audit = audit
+}
+
+// systemConfigErrorStatus maps service errors to HTTP status codes.
+func systemConfigErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "invalid"), strings.Contains(err.Error(), "validation failed"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GetConfiguration handles GET /api/v1/admin/config.
+func (h *SystemConfigHandler) GetConfiguration(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	config, err := h.config.GetMaskedConfiguration()
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to load configuration", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": config})
+}
+
+// GetSection handles GET /api/v1/admin/config/:section.
+func (h *SystemConfigHandler) GetSection(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	section, err := h.config.GetConfigurationSection(c.Param("section"))
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to load configuration section", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": section})
+}
+
+// UpdateSection handles PUT /api/v1/admin/config/:section. The body
+// replaces the whole section; the configuration is saved only when it
+// passes validation.
+func (h *SystemConfigHandler) UpdateSection(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil || !json.Valid(body) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	config, err := h.config.UpdateConfigurationSection(c.Param("section"), body)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to update configuration", "details": err.Error()})
+		return
+	}
+	recordAudit(c.Request, h.audit, currentUser.ID, services.AuditEventConfigChanged, map[string]interface{}{"section": c.Param("section")})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": config})
+}
+
+// TestConfiguration handles POST /api/v1/admin/config/test. Without a
+// body it tests the live configuration; a body's sections are tested in
+// place of the live ones without saving them.
+func (h *SystemConfigHandler) TestConfiguration(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	var config *models.SystemConfiguration
+	if len(strings.TrimSpace(string(body))) > 0 {
+		config = &models.SystemConfiguration{}
+		if err := json.Unmarshal(body, config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+
+	test, err := h.config.TestConfigurationSections(config)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to test configuration", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": test})
+}
+
+// ListBackups handles GET /api/v1/admin/config/backups.
+func (h *SystemConfigHandler) ListBackups(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	backups, err := h.config.ListBackups()
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to load configuration backups", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": backups})
+}
+
+// CreateBackup handles POST /api/v1/admin/config/backups.
+func (h *SystemConfigHandler) CreateBackup(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	backup, err := h.config.CreateBackup(req.Name)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to create configuration backup", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": backup})
+}
+
+// GetBackup handles GET /api/v1/admin/config/backups/:id.
+func (h *SystemConfigHandler) GetBackup(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+	id, ok := systemConfigID(c)
+	if !ok {
+		return
+	}
+
+	backup, err := h.config.GetBackup(id)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to load configuration backup", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": backup})
+}
+
+// RestoreBackup handles POST /api/v1/admin/config/backups/:id/restore.
+func (h *SystemConfigHandler) RestoreBackup(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	id, ok := systemConfigID(c)
+	if !ok {
+		return
+	}
+
+	config, err := h.config.RestoreBackup(id)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to restore configuration backup", "details": err.Error()})
+		return
+	}
+	recordAudit(c.Request, h.audit, currentUser.ID, services.AuditEventConfigChanged, map[string]interface{}{"backup_id": id})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": config})
+}
+
+// DeleteBackup handles DELETE /api/v1/admin/config/backups/:id.
+func (h *SystemConfigHandler) DeleteBackup(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := systemConfigID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.config.DeleteBackup(id); err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to delete configuration backup", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Configuration backup deleted"})
+}
+
+// ListTemplates handles GET /api/v1/admin/config/templates.
+func (h *SystemConfigHandler) ListTemplates(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemConfig); !ok {
+		return
+	}
+
+	templates, err := h.config.ListTemplates()
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to load configuration templates", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": templates})
+}
+
+// CreateTemplate handles POST /api/v1/admin/config/templates.
+func (h *SystemConfigHandler) CreateTemplate(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	var template models.ConfigurationTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	created, err := h.config.CreateTemplate(&template)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to create configuration template", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": created})
+}
+
+// DeleteTemplate handles DELETE /api/v1/admin/config/templates/:id.
+func (h *SystemConfigHandler) DeleteTemplate(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := systemConfigID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.config.DeleteTemplate(id); err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to delete configuration template", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Configuration template deleted"})
+}
+
+// ApplyTemplate handles POST /api/v1/admin/config/templates/:id/apply.
+func (h *SystemConfigHandler) ApplyTemplate(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	id, ok := systemConfigID(c)
+	if !ok {
+		return
+	}
+
+	config, err := h.config.ApplyTemplate(id)
+	if err != nil {
+		c.JSON(systemConfigErrorStatus(err), gin.H{"success": false, "error": "Failed to apply configuration template", "details": err.Error()})
+		return
+	}
+	recordAudit(c.Request, h.audit, currentUser.ID, services.AuditEventConfigChanged, map[string]interface{}{"template_id": id})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": config})
+}
+
+// systemConfigID parses the :id parameter, answering 400 when it is not
+// a positive number.
+func systemConfigID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid ID"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSystemConfigService struct {
+	updated  string
+	tested   *models.SystemConfiguration
+	restored int
+	applied  int
+}
+
+func (f *fakeSystemConfigService) GetMaskedConfiguration() (*models.SystemConfiguration, error) {
+	return &models.SystemConfiguration{Version: "3.0.0"}, nil
+}
+
+func (f *fakeSystemConfigService) GetConfigurationSection(section string) (interface{}, error) {
+	if section != "network" {
+		return nil, fmt.Errorf("invalid configuration section %q", section)
+	}
+	return &models.NetworkConfig{Host: "0.0.0.0", Port: 8080}, nil
+}
+
+func (f *fakeSystemConfigService) UpdateConfigurationSection(section string, data []byte) (*models.SystemConfiguration, error) {
+	if strings.Contains(string(data), "70000") {
+		return nil, errors.New("configuration validation failed: invalid network port: 70000")
+	}
+	f.updated = section + " " + string(data)
+	return &models.SystemConfiguration{Version: "3.0.0"}, nil
+}
+
+func (f *fakeSystemConfigService) TestConfigurationSections(config *models.SystemConfiguration) (*models.ConfigurationTest, error) {
+	f.tested = config
+	return &models.ConfigurationTest{
+		OverallStatus: models.TestStatusPassed,
+		Results:       map[string]*models.TestResult{"database": {Status: models.TestStatusPassed}},
+	}, nil
+}
+
+func (f *fakeSystemConfigService) CreateBackup(name string) (*models.ConfigurationBackup, error) {
+	return &models.ConfigurationBackup{ID: 1, Name: name}, nil
+}
+
+func (f *fakeSystemConfigService) ListBackups() ([]*models.ConfigurationBackup, error) {
+	return []*models.ConfigurationBackup{{ID: 1, Name: "nightly"}}, nil
+}
+
+func (f *fakeSystemConfigService) GetBackup(backupID int) (*models.ConfigurationBackup, error) {
+	if backupID != 1 {
+		return nil, fmt.Errorf("configuration backup %d not found", backupID)
+	}
+	return &models.ConfigurationBackup{ID: 1, Name: "nightly"}, nil
+}
+
+func (f *fakeSystemConfigService) RestoreBackup(backupID int) (*models.SystemConfiguration, error) {
+	f.restored = backupID
+	return &models.SystemConfiguration{Version: "3.0.0"}, nil
+}
+
+func (f *fakeSystemConfigService) DeleteBackup(backupID int) error { return nil }
+
+func (f *fakeSystemConfigService) ListTemplates() ([]*models.ConfigurationTemplate, error) {
+	return []*models.ConfigurationTemplate{}, nil
+}
+
+func (f *fakeSystemConfigService) CreateTemplate(template *models.ConfigurationTemplate) (*models.ConfigurationTemplate, error) {
+	template.ID = 2
+	return template, nil
+}
+
+func (f *fakeSystemConfigService) DeleteTemplate(templateID int) error { return nil }
+
+func (f *fakeSystemConfigService) ApplyTemplate(templateID int) (*models.SystemConfiguration, error) {
+	f.applied = templateID
+	return &models.SystemConfiguration{Version: "3.0.0"}, nil
+}
+
+func systemConfigRequest(auth requestAuthService, svc *fakeSystemConfigService, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewSystemConfigHandler(svc, auth)
+	r := gin.New()
+	r.GET("/admin/config", h.GetConfiguration)
+	r.POST("/admin/config/test", h.TestConfiguration)
+	r.GET("/admin/config/backups", h.ListBackups)
+	r.POST("/admin/config/backups", h.CreateBackup)
+	r.GET("/admin/config/backups/:id", h.GetBackup)
+	r.POST("/admin/config/backups/:id/restore", h.RestoreBackup)
+	r.POST("/admin/config/templates", h.CreateTemplate)
+	r.POST("/admin/config/templates/:id/apply", h.ApplyTemplate)
+	r.GET("/admin/config/:section", h.GetSection)
+	r.PUT("/admin/config/:section", h.UpdateSection)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSystemConfigHandler(t *testing.T) {
+	svc := &fakeSystemConfigService{}
+	configurer := &permissionAuth{granted: map[string]bool{models.PermissionSystemConfig: true}}
+	w := systemConfigRequest(configurer, svc, http.MethodGet, "/admin/config/network", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"port":8080`)
+	assert.Equal(t, http.StatusBadRequest, systemConfigRequest(configurer, svc, http.MethodGet, "/admin/config/plugins", "").Code)
+	assert.Equal(t, http.StatusOK, systemConfigRequest(configurer, svc, http.MethodGet, "/admin/config/backups", "").Code)
+	assert.Equal(t, http.StatusForbidden,
+		systemConfigRequest(configurer, svc, http.MethodPut, "/admin/config/network", `{"port":9090}`).Code)
+
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionSystemAdmin: true}}
+	require.Equal(t, http.StatusOK, systemConfigRequest(admin, svc, http.MethodPut, "/admin/config/network", `{"port":9090}`).Code)
+	assert.Equal(t, `network {"port":9090}`, svc.updated)
+	assert.Equal(t, http.StatusBadRequest, systemConfigRequest(admin, svc, http.MethodPut, "/admin/config/network", `{"port":70000}`).Code)
+	assert.Equal(t, http.StatusBadRequest, systemConfigRequest(admin, svc, http.MethodPut, "/admin/config/network", `{"port":`).Code)
+
+	// Without a body the live configuration is tested
+	w = systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/test", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"overall_status":"passed"`)
+	assert.Nil(t, svc.tested)
+	require.Equal(t, http.StatusOK, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/test", `{"network":{"port":9090}}`).Code)
+	require.NotNil(t, svc.tested)
+	assert.Equal(t, 9090, svc.tested.Network.Port)
+
+	assert.Equal(t, http.StatusCreated, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/backups", `{"name":"nightly"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/backups", `{}`).Code)
+	assert.Equal(t, http.StatusNotFound, systemConfigRequest(admin, svc, http.MethodGet, "/admin/config/backups/7", "").Code)
+	require.Equal(t, http.StatusOK, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/backups/1/restore", "").Code)
+	assert.Equal(t, 1, svc.restored)
+	assert.Equal(t, http.StatusBadRequest, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/backups/x/restore", "").Code)
+
+	assert.Equal(t, http.StatusCreated, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/templates",
+		`{"name":"Large files","category":"Performance","configuration":{"storage":{"media_directory":"/srv/media"}}}`).Code)
+	require.Equal(t, http.StatusOK, systemConfigRequest(admin, svc, http.MethodPost, "/admin/config/templates/2/apply", "").Code)
+	assert.Equal(t, 2, svc.applied)
+}
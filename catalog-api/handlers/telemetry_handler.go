@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// telemetryService defines the telemetry methods used by TelemetryHandler.
+type telemetryService interface {
+	GetSettings(ctx context.Context) (*services.TelemetrySettings, error)
+	UpdateSettings(ctx context.Context, enabled, upstreamEnabled *bool) (*services.TelemetrySettings, error)
+	RecordRoute(ctx context.Context, userID int, route string) error
+	Usage(ctx context.Context, days int) (*services.TelemetryUsage, error)
+	PurgeUsage(ctx context.Context) (int64, error)
+	Preview(ctx context.Context) (*services.TelemetryReport, error)
+	Report(ctx context.Context) (*services.TelemetryReportLog, error)
+	ListReports(ctx context.Context, limit int) ([]services.TelemetryReportLog, error)
+}
+
+// TelemetryHandler serves the local telemetry dashboard and records
+// feature usage. All endpoints require system.admin.
+type TelemetryHandler struct {
+	telemetry   telemetryService
+	authService requestAuthService
+}
+
+// NewTelemetryHandler creates a new TelemetryHandler.
+func NewTelemetryHandler(telemetry telemetryService, authService requestAuthService) *TelemetryHandler {
+	return &TelemetryHandler{
+		telemetry:   telemetry,
+		authService: authService,
+	}
+}
+
+// Track returns middleware that counts successful requests by the
+// authenticated user against the telemetry feature their route belongs
+// to. It runs after the JWT middleware, which sets user_id.
+func (h *TelemetryHandler) Track() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest || c.FullPath() == "" {
+			return
+		}
+		userID, err := strconv.Atoi(c.GetString("user_id"))
+		if err != nil {
+			return
+		}
+		// Telemetry must never affect the request it observes
+		_ = h.telemetry.RecordRoute(c.Request.Context(), userID, c.FullPath())
+	}
+}
+
+// GetDashboard handles GET /api/v1/admin/telemetry. It returns the
+// settings, the schema and the counters for the last days days (default
+// 30).
+func (h *TelemetryHandler) GetDashboard(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	settings, err := h.telemetry.GetSettings(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load telemetry settings", "details": err.Error()})
+		return
+	}
+	days, _ := strconv.Atoi(c.Query("days"))
+	usage, err := h.telemetry.Usage(ctx, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to load telemetry usage", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"settings": settings,
+		"schema":   services.TelemetrySchema(),
+		"usage":    usage,
+	}})
+}
+
+// UpdateSettings handles PUT /api/v1/admin/telemetry. The body may set
+// enabled and upstream_enabled.
+func (h *TelemetryHandler) UpdateSettings(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var req struct {
+		Enabled         *bool `json:"enabled"`
+		UpstreamEnabled *bool `json:"upstream_enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	settings, err := h.telemetry.UpdateSettings(c.Request.Context(), req.Enabled, req.UpstreamEnabled)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid telemetry settings") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to update telemetry settings", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PurgeUsage handles DELETE /api/v1/admin/telemetry/usage.
+func (h *TelemetryHandler) PurgeUsage(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	deleted, err := h.telemetry.PurgeUsage(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to purge telemetry usage", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"deleted": deleted}})
+}
+
+// Preview handles GET /api/v1/admin/telemetry/preview. It returns the
+// exact payload the next upstream report would send.
+func (h *TelemetryHandler) Preview(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	report, err := h.telemetry.Preview(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to build telemetry report", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// SendReport handles POST /api/v1/admin/telemetry/report, sending the
+// previewed report upstream now.
+func (h *TelemetryHandler) SendReport(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	entry, err := h.telemetry.Report(c.Request.Context())
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "is disabled"):
+			status = http.StatusConflict
+		case entry != nil:
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"success": false, "error": "Failed to send telemetry report", "details": err.Error(), "data": entry})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entry})
+}
+
+// ListReports handles GET /api/v1/admin/telemetry/reports.
+func (h *TelemetryHandler) ListReports(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	reports, err := h.telemetry.ListReports(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list telemetry reports", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": reports})
+}
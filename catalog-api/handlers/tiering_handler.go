@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tieringService defines the tiering methods used by TieringHandler.
+type tieringService interface {
+	CreatePolicy(ctx context.Context, policy *services.TieringPolicy) error
+	UpdatePolicy(ctx context.Context, policy *services.TieringPolicy) error
+	DeletePolicy(ctx context.Context, id int64) error
+	GetPolicy(ctx context.Context, id int64) (*services.TieringPolicy, error)
+	ListPolicies(ctx context.Context) ([]services.TieringPolicy, error)
+	Candidates(ctx context.Context, policy *services.TieringPolicy, limit int) ([]services.TieringCandidate, error)
+	StartPolicy(ctx context.Context, policyID int64, userID *int) (*services.TieringRun, error)
+	GetRun(ctx context.Context, id int64) (*services.TieringRun, error)
+	ListRuns(ctx context.Context, policyID int64) ([]services.TieringRun, error)
+	UndoRun(ctx context.Context, runID int64) (*services.TieringRun, error)
+}
+
+// TieringHandler exposes administration of storage tiering policies and
+// their runs. All endpoints require system.admin.
+type TieringHandler struct {
+	tiering     tieringService
+	authService requestAuthService
+	undo        undoRecorder
+}
+
+// NewTieringHandler creates a new TieringHandler.
+func NewTieringHandler(tiering tieringService, authService requestAuthService) *TieringHandler {
+	return &TieringHandler{
+		tiering:     tiering,
+		authService: authService,
+	}
+}
+
+// SetUndoJournal journals tiering runs so the admin who started one can
+// move its files back.
+func (h *TieringHandler) SetUndoJournal(journal undoRecorder) {
+	h.undo = journal
+}
+
+// tieringErrorStatus maps service errors to HTTP status codes.
+func tieringErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid policy"):
+		return http.StatusBadRequest
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already running"), strings.Contains(msg, "still running"),
+		strings.Contains(msg, "already been undone"), strings.Contains(msg, "lockdown"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func parseIDParam(c *gin.Context, name, label string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + label + " ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ListPolicies handles GET /api/v1/admin/tiering/policies.
+func (h *TieringHandler) ListPolicies(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	policies, err := h.tiering.ListPolicies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list tiering policies", "details": err.Error()})
+		return
+	}
+	if policies == nil {
+		policies = []services.TieringPolicy{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policies})
+}
+
+// CreatePolicy handles POST /api/v1/admin/tiering/policies.
+func (h *TieringHandler) CreatePolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var policy services.TieringPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if err := h.tiering.CreatePolicy(c.Request.Context(), &policy); err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to create tiering policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": policy})
+}
+
+// GetPolicy handles GET /api/v1/admin/tiering/policies/:id.
+func (h *TieringHandler) GetPolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "policy")
+	if !ok {
+		return
+	}
+
+	policy, err := h.tiering.GetPolicy(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to load tiering policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policy})
+}
+
+// UpdatePolicy handles PUT /api/v1/admin/tiering/policies/:id.
+func (h *TieringHandler) UpdatePolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "policy")
+	if !ok {
+		return
+	}
+
+	var policy services.TieringPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	policy.ID = id
+
+	if err := h.tiering.UpdatePolicy(c.Request.Context(), &policy); err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to update tiering policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policy})
+}
+
+// DeletePolicy handles DELETE /api/v1/admin/tiering/policies/:id.
+func (h *TieringHandler) DeletePolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "policy")
+	if !ok {
+		return
+	}
+
+	if err := h.tiering.DeletePolicy(c.Request.Context(), id); err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to delete tiering policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// PreviewPolicy handles GET /api/v1/admin/tiering/policies/:id/preview,
+// listing the files the next run would move without moving anything.
+func (h *TieringHandler) PreviewPolicy(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "policy")
+	if !ok {
+		return
+	}
+
+	policy, err := h.tiering.GetPolicy(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to load tiering policy", "details": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	candidates, err := h.tiering.Candidates(c.Request.Context(), policy, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to preview tiering policy", "details": err.Error()})
+		return
+	}
+	if candidates == nil {
+		candidates = []services.TieringCandidate{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": candidates})
+}
+
+// RunPolicy handles POST /api/v1/admin/tiering/policies/:id/run. The run
+// continues in the background; poll GET /admin/tiering/runs/:id for progress.
+func (h *TieringHandler) RunPolicy(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "policy")
+	if !ok {
+		return
+	}
+
+	run, err := h.tiering.StartPolicy(c.Request.Context(), id, &currentUser.ID)
+	if err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to start tiering run", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"success": true, "data": run}
+	if undo := recordUndo(c, h.undo, currentUser.ID, services.UndoKindMove, "tiering_runs", run.ID,
+		fmt.Sprintf("Ran tiering policy %d", id), nil); undo != nil {
+		response["undo"] = undo
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// ListRuns handles GET /api/v1/admin/tiering/runs, optionally filtered by
+// the policy_id query parameter.
+func (h *TieringHandler) ListRuns(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+
+	var policyID int64
+	if raw := c.Query("policy_id"); raw != "" {
+		var err error
+		if policyID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid policy ID"})
+			return
+		}
+	}
+
+	runs, err := h.tiering.ListRuns(c.Request.Context(), policyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list tiering runs", "details": err.Error()})
+		return
+	}
+	if runs == nil {
+		runs = []services.TieringRun{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runs})
+}
+
+// GetRun handles GET /api/v1/admin/tiering/runs/:id.
+func (h *TieringHandler) GetRun(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "run")
+	if !ok {
+		return
+	}
+
+	run, err := h.tiering.GetRun(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to load tiering run", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
+
+// UndoRun handles POST /api/v1/admin/tiering/runs/:id/undo.
+func (h *TieringHandler) UndoRun(c *gin.Context) {
+	if _, ok := requirePermission(c, h.authService, models.PermissionSystemAdmin); !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id", "run")
+	if !ok {
+		return
+	}
+
+	run, err := h.tiering.UndoRun(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(tieringErrorStatus(err), gin.H{"success": false, "error": "Failed to undo tiering run", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"catalogizer/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// undoRecorder journals destructive operations so they can be undone.
+type undoRecorder interface {
+	Record(ctx context.Context, userID int, kind, resource string, resourceID int64, summary string, payload interface{}) (*services.UndoOperation, error)
+}
+
+// undoJournal defines the undo journal methods used by UndoHandler.
+type undoJournal interface {
+	undoRecorder
+	List(ctx context.Context, userID int) ([]services.UndoOperation, error)
+	Undo(ctx context.Context, userID int, id string) (*services.UndoOperation, error)
+}
+
+// recordUndo journals an operation the user just performed and returns
+// what the response tells them about undoing it. It returns nil when no
+// journal is configured or recording failed; the operation itself has
+// succeeded either way.
+func recordUndo(c *gin.Context, journal undoRecorder, userID int, kind, resource string, resourceID int64, summary string, payload interface{}) gin.H {
+	if journal == nil {
+		return nil
+	}
+	op, err := journal.Record(c.Request.Context(), userID, kind, resource, resourceID, summary, payload)
+	if err != nil {
+		return nil
+	}
+	return gin.H{"operation_id": op.ID, "expires_at": op.ExpiresAt}
+}
+
+// UndoHandler lists the destructive operations users can still undo and
+// undoes them.
+type UndoHandler struct {
+	journal     undoJournal
+	authService requestAuthService
+}
+
+// NewUndoHandler creates a new UndoHandler.
+func NewUndoHandler(journal undoJournal, authService requestAuthService) *UndoHandler {
+	return &UndoHandler{
+		journal:     journal,
+		authService: authService,
+	}
+}
+
+// undoErrorStatus maps journal errors to HTTP status codes.
+func undoErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "can no longer be undone"), strings.Contains(msg, "already been undone"):
+		return http.StatusConflict
+	case strings.Contains(msg, "expired"):
+		return http.StatusGone
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "invalid"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ListOperations handles GET /api/v1/undo, returning the current user's
+// operations that can still be undone, most recent first.
+func (h *UndoHandler) ListOperations(c *gin.Context) {
+	currentUser, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	operations, err := h.journal.List(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(undoErrorStatus(err), gin.H{"success": false, "error": "Failed to list undo operations", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": operations})
+}
+
+// Undo handles POST /api/v1/undo/:operation_id. Users can only undo their
+// own operations, each once and before it expires.
+func (h *UndoHandler) Undo(c *gin.Context) {
+	currentUser, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	op, err := h.journal.Undo(c.Request.Context(), currentUser.ID, c.Param("operation_id"))
+	if err != nil {
+		c.JSON(undoErrorStatus(err), gin.H{"success": false, "error": "Failed to undo operation", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": op})
+}
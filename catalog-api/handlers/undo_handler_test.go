@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUndoJournal undoes media deletes in a fakeRecycleBinService.
+type fakeUndoJournal struct {
+	recycleBin *fakeRecycleBinService
+	operations map[string]*services.UndoOperation
+}
+
+func (f *fakeUndoJournal) Record(ctx context.Context, userID int, kind, resource string, resourceID int64, summary string, payload interface{}) (*services.UndoOperation, error) {
+	op := &services.UndoOperation{
+		ID: fmt.Sprintf("op-%d", len(f.operations)+1), UserID: userID, Kind: kind, Resource: resource,
+		ResourceID: resourceID, Summary: summary, Status: services.UndoStatusPending, ExpiresAt: time.Now().Add(time.Hour),
+	}
+	f.operations[op.ID] = op
+	return op, nil
+}
+
+func (f *fakeUndoJournal) List(ctx context.Context, userID int) ([]services.UndoOperation, error) {
+	operations := []services.UndoOperation{}
+	for _, op := range f.operations {
+		if op.UserID == userID && op.Status == services.UndoStatusPending {
+			operations = append(operations, *op)
+		}
+	}
+	return operations, nil
+}
+
+func (f *fakeUndoJournal) Undo(ctx context.Context, userID int, id string) (*services.UndoOperation, error) {
+	op, ok := f.operations[id]
+	if !ok || op.UserID != userID {
+		return nil, fmt.Errorf("undo operation %s not found", id)
+	}
+	if op.Status == services.UndoStatusUndone {
+		return nil, fmt.Errorf("undo operation %s has already been undone", id)
+	}
+	if err := f.recycleBin.Restore(ctx, op.Resource, op.ResourceID); err != nil {
+		return nil, fmt.Errorf("undo operation %s can no longer be undone: %w", id, err)
+	}
+	op.Status = services.UndoStatusUndone
+	return op, nil
+}
+
+func TestUndoHandler_UndoMediaDelete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := &fakeRecycleBinService{deleted: map[string]map[int64]bool{}}
+	journal := &fakeUndoJournal{recycleBin: svc, operations: map[string]*services.UndoOperation{}}
+	auth := &permissionAuth{granted: map[string]bool{models.PermissionMediaDelete: true}}
+
+	recycleBinHandler := NewRecycleBinHandler(svc, auth)
+	recycleBinHandler.SetUndoJournal(journal)
+	h := NewUndoHandler(journal, auth)
+	r := gin.New()
+	r.DELETE("/entities/:id", recycleBinHandler.DeleteMedia)
+	r.GET("/undo", h.ListOperations)
+	r.POST("/undo/:operation_id", h.Undo)
+
+	w := recycleBinRequest(r, http.MethodDelete, "/entities/9")
+	require.Equal(t, http.StatusOK, w.Code)
+	var deleted struct {
+		Undo struct {
+			OperationID string `json:"operation_id"`
+		} `json:"undo"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deleted))
+	require.NotEmpty(t, deleted.Undo.OperationID)
+
+	w = recycleBinRequest(r, http.MethodGet, "/undo")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"summary":"Deleted media item 9"`)
+
+	w = recycleBinRequest(r, http.MethodPost, "/undo/"+deleted.Undo.OperationID)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"media/9"}, svc.restored)
+
+	w = recycleBinRequest(r, http.MethodPost, "/undo/"+deleted.Undo.OperationID)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = recycleBinRequest(r, http.MethodPost, "/undo/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Without a bearer token nothing is listed
+	req := httptest.NewRequest(http.MethodGet, "/undo", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUndoErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusGone, undoErrorStatus(fmt.Errorf("undo operation x has expired")))
+	assert.Equal(t, http.StatusConflict, undoErrorStatus(fmt.Errorf("undo operation x can no longer be undone: playlist not found")))
+	assert.Equal(t, http.StatusBadRequest, undoErrorStatus(fmt.Errorf("invalid undo operation: move of files cannot be undone")))
+}
+
+func TestMissingTags(t *testing.T) {
+	assert.Nil(t, missingTags([]string{"a"}, &[]string{"a", "b"}))
+	assert.Equal(t, []string{"b"}, missingTags([]string{"a", "b"}, &[]string{"a", "c"}))
+	assert.Equal(t, []string{"a"}, missingTags([]string{"a"}, &[]string{}))
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadService defines the resumable upload methods used by
+// UploadHandler.
+type uploadService interface {
+	Create(ctx context.Context, userID int, req services.UploadRequest, maxSize int64) (*services.UploadSession, error)
+	Get(ctx context.Context, userID int, id string) (*services.UploadSession, error)
+	WriteChunk(ctx context.Context, userID int, id string, offset int64, data io.Reader, checksum string) (*services.UploadSession, error)
+	Complete(ctx context.Context, userID int, id string) (*services.UploadSession, error)
+	Abort(ctx context.Context, userID int, id string) error
+}
+
+// UploadLimits caps the size of files users may upload. ByRole gives
+// the limit of a role by role ID; other roles get Default. 0 means no
+// limit.
+type UploadLimits struct {
+	Default int64
+	ByRole  map[int]int64
+}
+
+// For returns the upload limit of a role.
+func (l UploadLimits) For(roleID int) int64 {
+	if limit, ok := l.ByRole[roleID]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// UploadHandler serves resumable uploads: a client creates an upload
+// with the file's size and SHA-256, sends it in chunks at the offset the
+// upload stands at, asking for the offset again after a failure, and
+// completes it to have the file verified and written to storage. Every
+// endpoint requires media.upload.
+type UploadHandler struct {
+	uploads     uploadService
+	authService requestAuthService
+	limits      UploadLimits
+}
+
+// NewUploadHandler creates a new UploadHandler.
+func NewUploadHandler(uploads uploadService, authService requestAuthService, limits UploadLimits) *UploadHandler {
+	return &UploadHandler{
+		uploads:     uploads,
+		authService: authService,
+		limits:      limits,
+	}
+}
+
+// uploadErrorResponse writes the response for an upload service error.
+func uploadErrorResponse(c *gin.Context, message string, err error) {
+	var offsetErr *services.UploadOffsetError
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &offsetErr):
+		c.Header("Upload-Offset", strconv.FormatInt(offsetErr.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": message, "details": err.Error(), "offset": offsetErr.Offset})
+		return
+	case errors.Is(err, services.ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrUploadBusy), errors.Is(err, services.ErrUploadExists):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUploadLocked):
+		status = http.StatusLocked
+	case errors.Is(err, services.ErrUploadLimit):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, services.ErrUploadChecksumMismatch), errors.Is(err, services.ErrUploadIncomplete):
+		status = http.StatusUnprocessableEntity
+	case strings.Contains(err.Error(), "invalid"):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"success": false, "error": message, "details": err.Error()})
+}
+
+// CreateUpload handles POST /api/v1/upload.
+func (h *UploadHandler) CreateUpload(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionMediaUpload)
+	if !ok {
+		return
+	}
+
+	var req services.UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	limit := h.limits.For(user.RoleID)
+	session, err := h.uploads.Create(c.Request.Context(), user.ID, req, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrUploadTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "File exceeds the maximum upload size", "max_upload_size": limit})
+			return
+		}
+		uploadErrorResponse(c, "Failed to create upload", err)
+		return
+	}
+	c.Header("Location", "/api/v1/upload/"+session.ID)
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": session})
+}
+
+// GetUpload handles GET /api/v1/upload/:id. Received is the offset to
+// resume from.
+func (h *UploadHandler) GetUpload(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionMediaUpload)
+	if !ok {
+		return
+	}
+
+	session, err := h.uploads.Get(c.Request.Context(), user.ID, c.Param("id"))
+	if err != nil {
+		uploadErrorResponse(c, "Failed to get upload", err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(session.Received, 10))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": session})
+}
+
+// UploadChunk handles PATCH /api/v1/upload/:id. The body is the chunk,
+// the Upload-Offset header where it starts, and the optional
+// Upload-Checksum header its hex SHA-256.
+func (h *UploadHandler) UploadChunk(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionMediaUpload)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Upload-Offset header must be a non-negative byte offset"})
+		return
+	}
+	checksum := strings.TrimPrefix(c.GetHeader("Upload-Checksum"), "sha256 ")
+
+	session, err := h.uploads.WriteChunk(c.Request.Context(), user.ID, c.Param("id"), offset, c.Request.Body, checksum)
+	if err != nil {
+		uploadErrorResponse(c, "Failed to upload chunk", err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(session.Received, 10))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": session})
+}
+
+// CompleteUpload handles POST /api/v1/upload/:id/complete.
+func (h *UploadHandler) CompleteUpload(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionMediaUpload)
+	if !ok {
+		return
+	}
+
+	session, err := h.uploads.Complete(c.Request.Context(), user.ID, c.Param("id"))
+	if err != nil {
+		uploadErrorResponse(c, "Failed to complete upload", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": session})
+}
+
+// AbortUpload handles DELETE /api/v1/upload/:id.
+func (h *UploadHandler) AbortUpload(c *gin.Context) {
+	user, ok := requirePermission(c, h.authService, models.PermissionMediaUpload)
+	if !ok {
+		return
+	}
+
+	if err := h.uploads.Abort(c.Request.Context(), user.ID, c.Param("id")); err != nil {
+		uploadErrorResponse(c, "Failed to abort upload", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Upload aborted"})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUploadService struct {
+	maxSize  int64
+	received int64
+	checksum string
+	atLimit  bool
+}
+
+func (f *fakeUploadService) Create(ctx context.Context, userID int, req services.UploadRequest, maxSize int64) (*services.UploadSession, error) {
+	f.maxSize = maxSize
+	if f.atLimit {
+		return nil, services.ErrUploadLimit
+	}
+	if maxSize > 0 && req.Size > maxSize {
+		return nil, services.ErrUploadTooLarge
+	}
+	return &services.UploadSession{ID: "u1", UserID: userID, Size: req.Size, Status: services.UploadStatusUploading}, nil
+}
+
+func (f *fakeUploadService) Get(ctx context.Context, userID int, id string) (*services.UploadSession, error) {
+	if id != "u1" {
+		return nil, services.ErrUploadNotFound
+	}
+	return &services.UploadSession{ID: id, Size: 10, Received: f.received}, nil
+}
+
+func (f *fakeUploadService) WriteChunk(ctx context.Context, userID int, id string, offset int64, data io.Reader, checksum string) (*services.UploadSession, error) {
+	if offset != f.received {
+		return nil, &services.UploadOffsetError{Offset: f.received}
+	}
+	n, _ := io.Copy(io.Discard, data)
+	f.received += n
+	f.checksum = checksum
+	return &services.UploadSession{ID: id, Size: 10, Received: f.received}, nil
+}
+
+func (f *fakeUploadService) Complete(ctx context.Context, userID int, id string) (*services.UploadSession, error) {
+	if f.received != 10 {
+		return nil, services.ErrUploadIncomplete
+	}
+	return &services.UploadSession{ID: id, Size: 10, Received: 10, Status: services.UploadStatusCompleted}, nil
+}
+
+func (f *fakeUploadService) Abort(ctx context.Context, userID int, id string) error {
+	return nil
+}
+
+// roleAuth signs everyone in with one role
+type roleAuth struct {
+	permissionAuth
+	roleID int
+}
+
+func (a *roleAuth) GetCurrentUser(token string) (*models.User, error) {
+	return &models.User{ID: 1, RoleID: a.roleID}, nil
+}
+
+func uploadRequest(auth requestAuthService, svc *fakeUploadService, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewUploadHandler(svc, auth, UploadLimits{Default: 100, ByRole: map[int]int64{1: 0}})
+	r := gin.New()
+	r.POST("/upload", h.CreateUpload)
+	r.GET("/upload/:id", h.GetUpload)
+	r.PATCH("/upload/:id", h.UploadChunk)
+	r.POST("/upload/:id/complete", h.CompleteUpload)
+	r.DELETE("/upload/:id", h.AbortUpload)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadHandler(t *testing.T) {
+	svc := &fakeUploadService{}
+	viewer := &roleAuth{permissionAuth: permissionAuth{granted: map[string]bool{models.PermissionMediaView: true}}, roleID: 2}
+	assert.Equal(t, http.StatusForbidden, uploadRequest(viewer, svc, http.MethodPost, "/upload", `{}`, nil).Code)
+
+	uploader := &roleAuth{permissionAuth: permissionAuth{granted: map[string]bool{models.PermissionMediaUpload: true}}, roleID: 2}
+	w := uploadRequest(uploader, svc, http.MethodPost, "/upload", `{"destination":"media:a.bin","size":500,"sha256":"x"}`, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"max_upload_size":100`)
+
+	// Roles with their own limit use it instead of the default
+	admin := &roleAuth{permissionAuth: permissionAuth{granted: map[string]bool{models.PermissionMediaUpload: true}}, roleID: 1}
+	w = uploadRequest(admin, svc, http.MethodPost, "/upload", `{"destination":"media:a.bin","size":500,"sha256":"x"}`, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int64(0), svc.maxSize)
+	assert.Equal(t, "/api/v1/upload/u1", w.Header().Get("Location"))
+
+	// Users with too many uploads in progress must finish one first
+	svc.atLimit = true
+	w = uploadRequest(admin, svc, http.MethodPost, "/upload", `{"destination":"media:b.bin","size":5,"sha256":"x"}`, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	svc.atLimit = false
+
+	assert.Equal(t, http.StatusBadRequest, uploadRequest(uploader, svc, http.MethodPatch, "/upload/u1", "01234", nil).Code)
+	w = uploadRequest(uploader, svc, http.MethodPatch, "/upload/u1", "01234",
+		map[string]string{"Upload-Offset": "0", "Upload-Checksum": "sha256 abcd"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "abcd", svc.checksum)
+
+	w = uploadRequest(uploader, svc, http.MethodPatch, "/upload/u1", "01234", map[string]string{"Upload-Offset": "0"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, uploadRequest(uploader, svc, http.MethodPost, "/upload/u1/complete", "", nil).Code)
+	w = uploadRequest(uploader, svc, http.MethodGet, "/upload/u1", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, http.StatusNotFound, uploadRequest(uploader, svc, http.MethodGet, "/upload/u2", "", nil).Code)
+
+	require.Equal(t, http.StatusOK, uploadRequest(uploader, svc, http.MethodPatch, "/upload/u1", "56789", map[string]string{"Upload-Offset": "5"}).Code)
+	w = uploadRequest(uploader, svc, http.MethodPost, "/upload/u1/complete", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"completed"`)
+	assert.Equal(t, http.StatusOK, uploadRequest(uploader, svc, http.MethodDelete, "/upload/u1", "", nil).Code)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"catalogizer/internal/services"
 	"catalogizer/models"
 )
 
@@ -19,6 +20,7 @@ type UserServiceInterface interface {
 	List(limit, offset int) ([]models.User, error)
 	GetRole(roleID int) (*models.Role, error)
 	Count() (int, error)
+	DeactivateAllUserSessions(userID int) error
 }
 
 // UserAuthServiceInterface defines interface for authentication service operations
@@ -32,11 +34,13 @@ type UserAuthServiceInterface interface {
 	LockAccount(userID int, lockUntil time.Time) error
 	UnlockAccount(userID int) error
 	HashData(data string) string
+	ForgetExternalLogins(username string)
 }
 
 type UserHandler struct {
 	userRepo    UserServiceInterface
 	authService UserAuthServiceInterface
+	audit       auditRecorder
 }
 
 func NewUserHandler(userRepo UserServiceInterface, authService UserAuthServiceInterface) *UserHandler {
@@ -46,6 +50,11 @@ func NewUserHandler(userRepo UserServiceInterface, authService UserAuthServiceIn
 	}
 }
 
+// SetAuditLog records changes of users' roles in the audit log.
+func (h *UserHandler) SetAuditLog(audit auditRecorder) {
+	h.audit = audit
+}
+
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -58,7 +67,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserCreate)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserCreate)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -74,19 +83,19 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.TimeZone != nil {
+		if _, err := models.LoadTimeZone(*req.TimeZone); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	if err := h.authService.ValidatePassword(req.Password); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	salt, err := h.authService.GenerateSecureToken(16)
-	if err != nil {
-		http.Error(w, "Failed to generate salt", http.StatusInternalServerError)
-		return
-	}
-
-	passwordHash, err := h.hashPassword(req.Password, salt)
+	passwordHash, err := h.authService.HashPassword(req.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
@@ -101,7 +110,6 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: passwordHash,
-		Salt:         salt,
 		RoleID:       req.RoleID,
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
@@ -142,7 +150,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
@@ -150,7 +158,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if currentUser.ID != userID {
-		hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserView)
+		hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserView)
 		if err != nil {
 			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 			return
@@ -198,7 +206,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
@@ -206,7 +214,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if currentUser.ID != userID {
-		hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserUpdate)
+		hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserUpdate)
 		if err != nil {
 			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 			return
@@ -223,6 +231,12 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.TimeZone != nil {
+		if _, err := models.LoadTimeZone(*req.TimeZone); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
@@ -234,6 +248,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	previousRoleID := user.RoleID
 	if req.Username != nil {
 		user.Username = *req.Username
 	}
@@ -260,7 +275,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if currentUser.ID != userID {
-		hasAdminPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserManage)
+		hasAdminPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserManage)
 		if err != nil {
 			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 			return
@@ -296,6 +311,13 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
+	if user.RoleID != previousRoleID {
+		recordAudit(r, h.audit, currentUser.ID, services.AuditEventUserRoleChanged, map[string]interface{}{
+			"target_user_id":   userID,
+			"previous_role_id": previousRoleID,
+			"role_id":          user.RoleID,
+		})
+	}
 
 	role, err := h.userRepo.GetRole(user.RoleID)
 	if err != nil {
@@ -323,7 +345,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserDelete)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserDelete)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -334,7 +356,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
@@ -346,12 +368,34 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+
 	err = h.userRepo.Delete(userID)
 	if err != nil {
+		if err.Error() == "user not found" {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
 		return
 	}
 
+	// A soft-deleted account must not keep using the tokens it already
+	// has, nor a login the auth webhook accepted before
+	if err := h.userRepo.DeactivateAllUserSessions(userID); err != nil {
+		http.Error(w, "Failed to end user sessions", http.StatusInternalServerError)
+		return
+	}
+	h.authService.ForgetExternalLogins(user.Username)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -367,7 +411,7 @@ func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserView)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserView)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -441,7 +485,7 @@ func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserManage)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserManage)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -452,7 +496,7 @@ func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userIDStr = strings.TrimSuffix(userIDStr, "/reset-password")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
@@ -496,7 +540,7 @@ func (h *UserHandler) LockAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserManage)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserManage)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -507,7 +551,7 @@ func (h *UserHandler) LockAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userIDStr = strings.TrimSuffix(userIDStr, "/lock")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
@@ -557,7 +601,7 @@ func (h *UserHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserManage)
+	hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserManage)
 	if err != nil {
 		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 		return
@@ -568,7 +612,7 @@ func (h *UserHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userIDStr = strings.TrimSuffix(userIDStr, "/unlock")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
@@ -598,7 +642,7 @@ func (h *UserHandler) UpdateUserSettings(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	userIDStr := userPathID(r.URL.Path)
 	userIDStr = strings.TrimSuffix(userIDStr, "/settings")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
@@ -608,7 +652,7 @@ func (h *UserHandler) UpdateUserSettings(w http.ResponseWriter, r *http.Request)
 
 	// Users can only update their own settings, or admins can update any user's settings
 	if currentUser.ID != userID {
-		hasPermission, err := h.authService.CheckPermission(currentUser.ID, models.PermissionUserManage)
+		hasPermission, err := checkPermission(h.authService, currentUser, models.PermissionUserManage)
 		if err != nil {
 			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
 			return
@@ -657,8 +701,17 @@ func (h *UserHandler) UpdateUserSettings(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Settings updated successfully"})
 }
 
+// userPathID returns what follows the users prefix of path: /api/v1/users/
+// as routed by the server, or the older /api/users/
+func userPathID(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/api/v1/users/"); ok {
+		return rest
+	}
+	return strings.TrimPrefix(path, "/api/users/")
+}
+
 func (h *UserHandler) getCurrentUser(r *http.Request) (*models.User, error) {
-	token := extractToken(r)
+	token := requestCredential(r.Header)
 	if token == "" {
 		return nil, models.ErrUnauthorized
 	}
@@ -666,12 +719,6 @@ func (h *UserHandler) getCurrentUser(r *http.Request) (*models.User, error) {
 	return h.authService.GetCurrentUser(token)
 }
 
-func (h *UserHandler) hashPassword(password, salt string) (string, error) {
-	combined := password + salt
-	hash := h.authService.HashData(combined)
-	return hash, nil
-}
-
 func parseTime(timeStr string) (time.Time, error) {
 	return time.Parse(time.RFC3339, timeStr)
 }
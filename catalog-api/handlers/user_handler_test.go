@@ -64,6 +64,11 @@ func (m *MockUserService) Count() (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (m *MockUserService) DeactivateAllUserSessions(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
 // MockUserAuthService for testing
 type MockUserAuthService struct {
 	mock.Mock
@@ -117,6 +122,10 @@ func (m *MockUserAuthService) HashData(data string) string {
 	return args.String(0)
 }
 
+func (m *MockUserAuthService) ForgetExternalLogins(username string) {
+	m.Called(username)
+}
+
 // TestUserHandler_NewUserHandler
 func TestUserHandler_NewUserHandler(t *testing.T) {
 	mockUserService := new(MockUserService)
@@ -153,8 +162,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 				authService.On("GetCurrentUser", "valid-token").Return(authUser, nil)
 				authService.On("CheckPermission", 1, models.PermissionUserCreate).Return(true, nil)
 				authService.On("ValidatePassword", "password123").Return(nil)
-				authService.On("GenerateSecureToken", 16).Return("random-salt-123", nil)
-				authService.On("HashData", mock.AnythingOfType("string")).Return("hashed-combined")
+				authService.On("HashPassword", "password123").Return("$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA", nil)
 
 				userRepo.On("Create", mock.AnythingOfType("*models.User")).Return(1, nil)
 			},
@@ -210,8 +218,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 				authService.On("GetCurrentUser", "valid-token").Return(authUser, nil)
 				authService.On("CheckPermission", 1, models.PermissionUserCreate).Return(true, nil)
 				authService.On("ValidatePassword", "password123").Return(nil)
-				authService.On("GenerateSecureToken", 16).Return("random-salt-123", nil)
-				authService.On("HashData", mock.AnythingOfType("string")).Return("hashed-combined")
+				authService.On("HashPassword", "password123").Return("$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA", nil)
 
 				userRepo.On("Create", mock.AnythingOfType("*models.User")).Return(0, assert.AnError)
 			},
@@ -560,3 +567,23 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		})
 	}
 }
+
+// TestUserHandler_UnlockAccount_APIv1Path checks that the user ID is read
+// from the /api/v1/users/{id}/unlock route the server mounts
+func TestUserHandler_UnlockAccount_APIv1Path(t *testing.T) {
+	mockUserService := new(MockUserService)
+	mockAuthService := new(MockUserAuthService)
+	mockAuthService.On("GetCurrentUser", "valid-token").Return(&models.User{ID: 1}, nil)
+	mockAuthService.On("CheckPermission", 1, models.PermissionUserManage).Return(true, nil)
+	mockAuthService.On("UnlockAccount", 7).Return(nil)
+
+	handler := NewUserHandler(mockUserService, mockAuthService)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/7/unlock", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	rr := httptest.NewRecorder()
+
+	handler.UnlockAccount(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockAuthService.AssertExpectations(t)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSettingsBody bounds the size of a settings document or patch.
+const maxSettingsBody = 64 << 10
+
+// userSettingsService defines the settings methods used by
+// UserSettingsHandler.
+type userSettingsService interface {
+	Get(ctx context.Context, userID int) (*services.UserSettingsDocument, error)
+	Patch(ctx context.Context, userID int, base *int64, patch []byte) (*services.UserSettingsDocument, error)
+	Replace(ctx context.Context, userID int, base *int64, settings []byte) (*services.UserSettingsDocument, error)
+}
+
+// UserSettingsHandler reads and updates the preferences and settings of a
+// user. Responses carry the settings revision as their ETag; a client
+// sends it back as If-Match so that its change is refused only when it
+// touches keys another client changed meanwhile. Users manage their own
+// settings; other users' need user.view to read and user.update to
+// change.
+type UserSettingsHandler struct {
+	settings    userSettingsService
+	authService requestAuthService
+}
+
+// NewUserSettingsHandler creates a new UserSettingsHandler.
+func NewUserSettingsHandler(settings userSettingsService, authService requestAuthService) *UserSettingsHandler {
+	return &UserSettingsHandler{
+		settings:    settings,
+		authService: authService,
+	}
+}
+
+// userSettingsErrorStatus maps service errors to HTTP status codes.
+func userSettingsErrorStatus(err error) int {
+	var conflict *services.SettingsConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrSettingsRevisionExpired):
+		return http.StatusPreconditionFailed
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// authorizeSettings resolves the user whose settings are addressed by the
+// :id path parameter and checks the caller may use them with permission.
+func (h *UserSettingsHandler) authorizeSettings(c *gin.Context, permission string) (int, bool) {
+	currentUser, err := currentUserFromRequest(c, h.authService)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
+		return 0, false
+	}
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid user ID"})
+		return 0, false
+	}
+	if userID == currentUser.ID {
+		return userID, true
+	}
+
+	allowed, err := checkPermission(h.authService, currentUser, permission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to check permissions"})
+		return 0, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Insufficient permissions"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// settingsBase reads the revision a change is based on from If-Match. A
+// missing header or * means the change is unconditional.
+func settingsBase(c *gin.Context) (*int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	revision, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || revision < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid If-Match header", "details": "expected a settings revision ETag"})
+		return nil, false
+	}
+	return &revision, true
+}
+
+// readSettingsBody reads a settings request body.
+func readSettingsBody(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSettingsBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body", "details": err.Error()})
+		return nil, false
+	}
+	if len(body) > maxSettingsBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "Settings too large"})
+		return nil, false
+	}
+	return body, true
+}
+
+// respondSettings writes a settings document with its revision as ETag.
+func respondSettings(c *gin.Context, doc *services.UserSettingsDocument) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, doc.Revision))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": doc})
+}
+
+// respondSettingsError writes a failed settings update. Conflicts list
+// the keys, as JSON pointers, that were changed by another client.
+func respondSettingsError(c *gin.Context, message string, err error) {
+	response := gin.H{"success": false, "error": message, "details": err.Error()}
+	var conflict *services.SettingsConflictError
+	if errors.As(err, &conflict) {
+		c.Header("ETag", fmt.Sprintf(`"%d"`, conflict.Revision))
+		response["conflicts"] = conflict.Keys
+		response["revision"] = conflict.Revision
+	}
+	c.JSON(userSettingsErrorStatus(err), response)
+}
+
+// GetSettings handles GET /api/v1/users/:id/settings.
+func (h *UserSettingsHandler) GetSettings(c *gin.Context) {
+	userID, ok := h.authorizeSettings(c, models.PermissionUserView)
+	if !ok {
+		return
+	}
+
+	doc, err := h.settings.Get(c.Request.Context(), userID)
+	if err != nil {
+		respondSettingsError(c, "Failed to load settings", err)
+		return
+	}
+	respondSettings(c, doc)
+}
+
+// PatchSettings handles PATCH /api/v1/users/:id/settings. The body is a
+// JSON merge patch (RFC 7396): keys it sets are written, keys set to null
+// fall back to their defaults and the rest are left alone.
+func (h *UserSettingsHandler) PatchSettings(c *gin.Context) {
+	userID, ok := h.authorizeSettings(c, models.PermissionUserUpdate)
+	if !ok {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"success": false, "error": "Expected application/merge-patch+json"})
+		return
+	}
+	base, ok := settingsBase(c)
+	if !ok {
+		return
+	}
+	body, ok := readSettingsBody(c)
+	if !ok {
+		return
+	}
+
+	doc, err := h.settings.Patch(c.Request.Context(), userID, base, body)
+	if err != nil {
+		respondSettingsError(c, "Failed to update settings", err)
+		return
+	}
+	respondSettings(c, doc)
+}
+
+// ReplaceSettings handles PUT /api/v1/users/:id/settings. The body is the
+// whole settings object. With If-Match, only the keys that differ from
+// that revision are written.
+func (h *UserSettingsHandler) ReplaceSettings(c *gin.Context) {
+	userID, ok := h.authorizeSettings(c, models.PermissionUserUpdate)
+	if !ok {
+		return
+	}
+	base, ok := settingsBase(c)
+	if !ok {
+		return
+	}
+	body, ok := readSettingsBody(c)
+	if !ok {
+		return
+	}
+
+	doc, err := h.settings.Replace(c.Request.Context(), userID, base, body)
+	if err != nil {
+		respondSettingsError(c, "Failed to update settings", err)
+		return
+	}
+	respondSettings(c, doc)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/services"
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUserSettingsService struct {
+	base *int64
+	body string
+}
+
+func (f *fakeUserSettingsService) Get(ctx context.Context, userID int) (*services.UserSettingsDocument, error) {
+	if userID == 9 {
+		return nil, fmt.Errorf("user %d not found", userID)
+	}
+	return &services.UserSettingsDocument{UserID: userID, Revision: 4, Settings: map[string]interface{}{"theme": "dark"}}, nil
+}
+
+func (f *fakeUserSettingsService) Patch(ctx context.Context, userID int, base *int64, patch []byte) (*services.UserSettingsDocument, error) {
+	f.base, f.body = base, string(patch)
+	switch {
+	case strings.Contains(f.body, "colour"):
+		return nil, fmt.Errorf("invalid settings patch: unknown setting /colour")
+	case base != nil && *base < 2:
+		return nil, services.ErrSettingsRevisionExpired
+	case base != nil && *base < 4:
+		return nil, &services.SettingsConflictError{Revision: 4, Keys: []string{"/theme"}}
+	}
+	return &services.UserSettingsDocument{UserID: userID, Revision: 5}, nil
+}
+
+func (f *fakeUserSettingsService) Replace(ctx context.Context, userID int, base *int64, settings []byte) (*services.UserSettingsDocument, error) {
+	f.base, f.body = base, string(settings)
+	return &services.UserSettingsDocument{UserID: userID, Revision: 6}, nil
+}
+
+func userSettingsRequest(auth requestAuthService, svc *fakeUserSettingsService, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewUserSettingsHandler(svc, auth)
+	r := gin.New()
+	r.GET("/users/:id/settings", h.GetSettings)
+	r.PATCH("/users/:id/settings", h.PatchSettings)
+	r.PUT("/users/:id/settings", h.ReplaceSettings)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUserSettingsHandler_Access(t *testing.T) {
+	svc := &fakeUserSettingsService{}
+	user := &permissionAuth{granted: map[string]bool{}}
+
+	w := userSettingsRequest(user, svc, http.MethodGet, "/users/1/settings", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"theme":"dark"`)
+
+	assert.Equal(t, http.StatusForbidden, userSettingsRequest(user, svc, http.MethodGet, "/users/2/settings", "", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, userSettingsRequest(user, svc, http.MethodGet, "/users/me/settings", "", nil).Code)
+
+	viewer := &permissionAuth{granted: map[string]bool{models.PermissionUserView: true}}
+	assert.Equal(t, http.StatusOK, userSettingsRequest(viewer, svc, http.MethodGet, "/users/2/settings", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, userSettingsRequest(viewer, svc, http.MethodGet, "/users/9/settings", "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, userSettingsRequest(viewer, svc, http.MethodPatch, "/users/2/settings", `{}`, nil).Code)
+}
+
+func TestUserSettingsHandler_Patch(t *testing.T) {
+	svc := &fakeUserSettingsService{}
+	auth := &permissionAuth{granted: map[string]bool{}}
+
+	w := userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{"language":"de"}`, map[string]string{"If-Match": `"4"`})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+	require.NotNil(t, svc.base)
+	assert.Equal(t, int64(4), *svc.base)
+	assert.Equal(t, `{"language":"de"}`, svc.body)
+
+	w = userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{"theme":"light"}`, map[string]string{"If-Match": `W/"3"`})
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"conflicts":["/theme"]`)
+
+	assert.Equal(t, http.StatusPreconditionFailed,
+		userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{}`, map[string]string{"If-Match": `"1"`}).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{}`, map[string]string{"If-Match": `"abc"`}).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{"colour":"red"}`, nil).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType,
+		userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{}`, map[string]string{"Content-Type": "text/plain"}).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge,
+		userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", strings.Repeat(" ", maxSettingsBody+1), nil).Code)
+
+	// Without If-Match, or with *, the patch is unconditional.
+	require.Equal(t, http.StatusOK, userSettingsRequest(auth, svc, http.MethodPatch, "/users/1/settings", `{}`, map[string]string{"If-Match": "*"}).Code)
+	assert.Nil(t, svc.base)
+}
+
+func TestUserSettingsHandler_Replace(t *testing.T) {
+	svc := &fakeUserSettingsService{}
+	admin := &permissionAuth{granted: map[string]bool{models.PermissionUserUpdate: true}}
+
+	w := userSettingsRequest(admin, svc, http.MethodPut, "/users/2/settings", `{"theme":"auto"}`,
+		map[string]string{"Content-Type": "application/json", "If-Match": `"4"`})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"6"`, w.Header().Get("ETag"))
+	assert.Equal(t, int64(4), *svc.base)
+	assert.Equal(t, `{"theme":"auto"}`, svc.body)
+}
@@ -52,6 +52,12 @@ type SMBHost struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Domain   string `json:"domain"`
+
+	// Dialect pins the SMB dialect ("2.0.2" to "3.1.1"); empty negotiates
+	// the newest both sides speak
+	Dialect           string `json:"dialect,omitempty"`
+	RequireSigning    bool   `json:"require_signing,omitempty"`
+	RequireEncryption bool   `json:"require_encryption,omitempty"`
 }
 
 type AuthConfig struct {
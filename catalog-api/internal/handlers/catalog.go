@@ -3,9 +3,11 @@ package handlers
 import (
 	"catalogizer/internal/models"
 	"catalogizer/internal/services"
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,17 +16,168 @@ import (
 type CatalogHandler struct {
 	catalogService services.CatalogServiceInterface
 	smbService     services.SMBServiceInterface
+	snapshots      snapshotBrowser
+	versions       catalogVersions
+	pages          catalogPages
+	exporter       catalogExporter
+	defaultLimit   int
+	maxLimit       int
 	logger         *zap.Logger
 }
 
+// snapshotBrowser lists directories as they existed in a filesystem snapshot.
+type snapshotBrowser interface {
+	ListSnapshotPath(ctx context.Context, storageRoot, snapshotID, relPath string) ([]models.FileInfo, error)
+}
+
+// catalogVersions reports the versions of listings and files, for
+// answering conditional requests.
+type catalogVersions interface {
+	RootsVersion(ctx context.Context) (*services.CatalogVersion, error)
+	ListingVersion(ctx context.Context, path string) (*services.CatalogVersion, error)
+	FileVersion(ctx context.Context, pathOrID string) (*services.CatalogVersion, error)
+}
+
+// catalogPages serves listings, searches and stats a page at a time,
+// each continuing from the cursor the previous page returned.
+type catalogPages interface {
+	ListPathPage(ctx context.Context, path, sortBy, sortOrder, cursor string, limit int) ([]models.FileInfo, string, error)
+	SearchFilesPage(ctx context.Context, req *models.SearchRequest, cursor string) ([]models.FileInfo, string, error)
+	CountSearchResults(ctx context.Context, req *models.SearchRequest) (int64, error)
+	DirectoriesBySizePage(ctx context.Context, smbRoot, cursor string, limit int) ([]models.DirectoryStats, string, error)
+	DuplicateGroupsPage(ctx context.Context, smbRoot string, minCount int, cursor string, limit int) ([]models.DuplicateGroup, string, error)
+}
+
 func NewCatalogHandler(catalogService services.CatalogServiceInterface, smbService services.SMBServiceInterface, logger *zap.Logger) *CatalogHandler {
 	return &CatalogHandler{
 		catalogService: catalogService,
 		smbService:     smbService,
+		defaultLimit:   100,
 		logger:         logger,
 	}
 }
 
+// SetSnapshotService enables ?snapshot= browsing on ListPath.
+func (h *CatalogHandler) SetSnapshotService(snapshots snapshotBrowser) {
+	h.snapshots = snapshots
+}
+
+// SetPageSource enables cursor pagination. Listings and searches from
+// the start, and every page of the stats, are then read by cursor and
+// return a next_cursor while more follow.
+func (h *CatalogHandler) SetPageSource(pages catalogPages) {
+	h.pages = pages
+}
+
+// SetPageLimits sets the page size used when a request gives no limit,
+// and the largest one it may ask for. A maxSize of 0 leaves page sizes
+// uncapped.
+func (h *CatalogHandler) SetPageLimits(defaultSize, maxSize int) {
+	if defaultSize > 0 {
+		h.defaultLimit = defaultSize
+	}
+	h.maxLimit = maxSize
+}
+
+// pageLimit reads the limit query parameter, using fallback when it is
+// missing or not positive and capping it at the maximum page size.
+func (h *CatalogHandler) pageLimit(c *gin.Context, fallback int) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = fallback
+	}
+	if h.maxLimit > 0 && limit > h.maxLimit {
+		limit = h.maxLimit
+	}
+	return limit
+}
+
+// pageCursor reports whether a request should be served by cursor, and
+// from which one. It responds 400 and returns ok false when the request
+// combines a cursor with an offset, and 501 when it asks for a cursor
+// without cursor pagination.
+func (h *CatalogHandler) pageCursor(c *gin.Context, offset int) (cursor string, paged, ok bool) {
+	cursor = c.Query("cursor")
+	switch {
+	case cursor != "" && offset > 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor and offset cannot be combined"})
+		return "", false, false
+	case cursor != "" && h.pages == nil:
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Cursor pagination is not available"})
+		return "", false, false
+	}
+	return cursor, h.pages != nil && offset == 0, true
+}
+
+// respondPageError responds 400 to an invalid cursor, and otherwise logs
+// err and responds 500 with message.
+func (h *CatalogHandler) respondPageError(c *gin.Context, err error, message string) {
+	if strings.Contains(err.Error(), "invalid cursor") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor", "details": err.Error()})
+		return
+	}
+	h.logger.Error(message, zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// withNextCursor adds next_cursor to a page response unless it is the
+// last page.
+func withNextCursor(body gin.H, next string) gin.H {
+	if next != "" {
+		body["next_cursor"] = next
+	}
+	return body
+}
+
+// SetVersionSource enables the RootVersion, ListingVersion and FileVersion
+// validators.
+func (h *CatalogHandler) SetVersionSource(versions catalogVersions) {
+	h.versions = versions
+}
+
+// RootVersion validates conditional requests for ListRoot.
+func (h *CatalogHandler) RootVersion(c *gin.Context) (string, time.Time, bool) {
+	if h.versions == nil {
+		return "", time.Time{}, false
+	}
+	version, err := h.versions.RootsVersion(c.Request.Context())
+	return h.validated("roots", "", version, err)
+}
+
+// ListingVersion validates conditional requests for ListPath. Snapshot
+// listings are served without validators.
+func (h *CatalogHandler) ListingVersion(c *gin.Context) (string, time.Time, bool) {
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	if h.versions == nil || path == "" || c.Query("snapshot") != "" {
+		return "", time.Time{}, false
+	}
+	version, err := h.versions.ListingVersion(c.Request.Context(), path)
+	return h.validated("listing", path, version, err)
+}
+
+// FileVersion validates conditional requests for GetFileInfo.
+func (h *CatalogHandler) FileVersion(c *gin.Context) (string, time.Time, bool) {
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	if h.versions == nil || path == "" {
+		return "", time.Time{}, false
+	}
+	version, err := h.versions.FileVersion(c.Request.Context(), path)
+	return h.validated("file", path, version, err)
+}
+
+// validated turns a version lookup into validator results. A failed
+// lookup is logged, and the request is served without validators.
+func (h *CatalogHandler) validated(kind, path string, version *services.CatalogVersion, err error) (string, time.Time, bool) {
+	if err != nil {
+		h.logger.Warn("Failed to get catalog version", zap.String("kind", kind), zap.String("path", path), zap.Error(err))
+		return "", time.Time{}, false
+	}
+	if version == nil {
+		return "", time.Time{}, false
+	}
+	return kind + ":" + version.Tag, version.Modified, true
+}
+
 // @Summary List root directories
 // @Description Get list of available SMB root directories
 // @Tags catalog
@@ -51,6 +204,8 @@ func (h *CatalogHandler) ListRoot(c *gin.Context) {
 // @Param sort_order query string false "Sort order (asc, desc)" default(asc)
 // @Param limit query int false "Limit number of results" default(100)
 // @Param offset query int false "Offset for pagination" default(0)
+// @Param cursor query string false "Continue after the page that returned this next_cursor"
+// @Param snapshot query string false "Browse a ZFS/Btrfs snapshot; the first path segment is the storage root"
 // @Produce json
 // @Success 200 {array} models.FileInfo
 // @Failure 400 {object} map[string]string
@@ -66,11 +221,35 @@ func (h *CatalogHandler) ListPath(c *gin.Context) {
 	// Clean the path (remove leading slash if present)
 	path = strings.TrimPrefix(path, "/")
 
+	if snapshotID := c.Query("snapshot"); snapshotID != "" {
+		h.listSnapshotPath(c, snapshotID, path)
+		return
+	}
+
 	sortBy := c.DefaultQuery("sort_by", "name")
 	sortOrder := c.DefaultQuery("sort_order", "asc")
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	limit := h.pageLimit(c, h.defaultLimit)
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
+	cursor, paged, ok := h.pageCursor(c, offset)
+	if !ok {
+		return
+	}
+	if paged {
+		files, next, err := h.pages.ListPathPage(c.Request.Context(), path, sortBy, sortOrder, cursor, limit)
+		if err != nil {
+			h.respondPageError(c, err, "Failed to list directory")
+			return
+		}
+		c.JSON(http.StatusOK, withNextCursor(gin.H{
+			"files":  files,
+			"count":  len(files),
+			"limit":  limit,
+			"offset": offset,
+		}, next))
+		return
+	}
+
 	files, err := h.catalogService.ListPath(path, sortBy, sortOrder, limit, offset)
 	if err != nil {
 		h.logger.Error("Failed to list path", zap.String("path", path), zap.Error(err))
@@ -86,6 +265,38 @@ func (h *CatalogHandler) ListPath(c *gin.Context) {
 	})
 }
 
+// listSnapshotPath serves a read-only directory listing from a snapshot.
+// The path is "<storage root>/<path within root>".
+func (h *CatalogHandler) listSnapshotPath(c *gin.Context, snapshotID, path string) {
+	if h.snapshots == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Snapshot browsing is not available"})
+		return
+	}
+
+	storageRoot, relPath, _ := strings.Cut(path, "/")
+	files, err := h.snapshots.ListSnapshotPath(c.Request.Context(), storageRoot, snapshotID, relPath)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "invalid path"), strings.Contains(err.Error(), "only supported"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.logger.Error("Failed to list snapshot path",
+				zap.String("path", path), zap.String("snapshot", snapshotID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list snapshot directory"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":    files,
+		"count":    len(files),
+		"snapshot": snapshotID,
+		"readonly": true,
+	})
+}
+
 // @Summary Get file information
 // @Description Get detailed information about a specific file or directory
 // @Tags catalog
@@ -141,6 +352,7 @@ func (h *CatalogHandler) GetFileInfo(c *gin.Context) {
 // @Param sort_order query string false "Sort order" default(asc)
 // @Param limit query int false "Limit results" default(100)
 // @Param offset query int false "Offset for pagination" default(0)
+// @Param cursor query string false "Continue after the page that returned this next_cursor"
 // @Produce json
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
@@ -160,9 +372,7 @@ func (h *CatalogHandler) Search(c *gin.Context) {
 	}
 
 	// Set defaults
-	if req.Limit == 0 {
-		req.Limit = 100
-	}
+	req.Limit = h.pageLimit(c, h.defaultLimit)
 	if req.SortBy == "" {
 		req.SortBy = "name"
 	}
@@ -176,6 +386,15 @@ func (h *CatalogHandler) Search(c *gin.Context) {
 		req.SmbRoots = strings.Split(smbRootsStr, ",")
 	}
 
+	cursor, paged, ok := h.pageCursor(c, req.Offset)
+	if !ok {
+		return
+	}
+	if paged {
+		h.searchPage(c, &req, cursor)
+		return
+	}
+
 	files, total, err := h.catalogService.SearchFiles(&req)
 	if err != nil {
 		h.logger.Error("Failed to search files", zap.Error(err))
@@ -192,12 +411,41 @@ func (h *CatalogHandler) Search(c *gin.Context) {
 	})
 }
 
+// searchPage serves a page of search results by cursor. Counting every
+// match costs as much as reading them, so only the first page has a
+// total.
+func (h *CatalogHandler) searchPage(c *gin.Context, req *models.SearchRequest, cursor string) {
+	ctx := c.Request.Context()
+	files, next, err := h.pages.SearchFilesPage(ctx, req, cursor)
+	if err != nil {
+		h.respondPageError(c, err, "Search failed")
+		return
+	}
+
+	body := gin.H{
+		"files":  files,
+		"count":  len(files),
+		"limit":  req.Limit,
+		"offset": 0,
+	}
+	if cursor == "" {
+		total, err := h.pages.CountSearchResults(ctx, req)
+		if err != nil {
+			h.respondPageError(c, err, "Search failed")
+			return
+		}
+		body["total"] = total
+	}
+	c.JSON(http.StatusOK, withNextCursor(body, next))
+}
+
 // @Summary Search duplicate files
-// @Description Find groups of duplicate files
+// @Description Find groups of files with identical content (SHA-256) that have not been resolved
 // @Tags search
 // @Param smb_root query string false "SMB root to search in"
 // @Param min_count query int false "Minimum number of duplicates" default(2)
 // @Param limit query int false "Limit number of groups" default(50)
+// @Param cursor query string false "Continue after the page that returned this next_cursor"
 // @Produce json
 // @Success 200 {array} models.DuplicateGroup
 // @Failure 400 {object} map[string]string
@@ -206,13 +454,30 @@ func (h *CatalogHandler) Search(c *gin.Context) {
 func (h *CatalogHandler) SearchDuplicates(c *gin.Context) {
 	smbRoot := c.DefaultQuery("smb_root", "")
 	minCount, _ := strconv.Atoi(c.DefaultQuery("min_count", "2"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	limit := h.pageLimit(c, 50)
 
 	if smbRoot == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "SMB root is required"})
 		return
 	}
 
+	cursor, paged, ok := h.pageCursor(c, 0)
+	if !ok {
+		return
+	}
+	if paged {
+		groups, next, err := h.pages.DuplicateGroupsPage(c.Request.Context(), smbRoot, minCount, cursor, limit)
+		if err != nil {
+			h.respondPageError(c, err, "Failed to find duplicates")
+			return
+		}
+		c.JSON(http.StatusOK, withNextCursor(gin.H{
+			"groups": groups,
+			"count":  len(groups),
+		}, next))
+		return
+	}
+
 	groups, err := h.catalogService.GetDuplicateGroups(smbRoot, minCount, limit)
 	if err != nil {
 		h.logger.Error("Failed to get duplicate groups", zap.Error(err))
@@ -231,6 +496,7 @@ func (h *CatalogHandler) SearchDuplicates(c *gin.Context) {
 // @Tags stats
 // @Param smb_root query string true "SMB root to analyze"
 // @Param limit query int false "Limit number of results" default(50)
+// @Param cursor query string false "Continue after the page that returned this next_cursor"
 // @Produce json
 // @Success 200 {array} models.DirectoryStats
 // @Failure 400 {object} map[string]string
@@ -243,7 +509,24 @@ func (h *CatalogHandler) GetDirectoriesBySize(c *gin.Context) {
 		return
 	}
 
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	limit := h.pageLimit(c, 50)
+
+	cursor, paged, ok := h.pageCursor(c, 0)
+	if !ok {
+		return
+	}
+	if paged {
+		stats, next, err := h.pages.DirectoriesBySizePage(c.Request.Context(), smbRoot, cursor, limit)
+		if err != nil {
+			h.respondPageError(c, err, "Failed to get directory statistics")
+			return
+		}
+		c.JSON(http.StatusOK, withNextCursor(gin.H{
+			"directories": stats,
+			"count":       len(stats),
+		}, next))
+		return
+	}
 
 	stats, err := h.catalogService.GetDirectoriesBySize(smbRoot, limit)
 	if err != nil {
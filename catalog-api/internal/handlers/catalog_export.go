@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"catalogizer/internal/models"
+	"catalogizer/internal/services"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// catalogExportPath is the /catalog/*path value that requests an export
+// rather than a listing. gin cannot register /catalog/export beside the
+// /catalog/*path wildcard, so ServeExport picks it out of that route.
+const catalogExportPath = "/export"
+
+// catalogExportStallTimeout is how long an export waits for a client
+// to take the next part of it before giving up on the connection.
+const catalogExportStallTimeout = 2 * time.Minute
+
+// catalogExporter streams the catalog's files.
+type catalogExporter interface {
+	ExportFiles(ctx context.Context, req *models.SearchRequest, format string, w io.Writer) (int64, error)
+}
+
+// SetExporter enables GET /catalog/export.
+func (h *CatalogHandler) SetExporter(exporter catalogExporter) {
+	h.exporter = exporter
+}
+
+// ServeExport is the first handler of the /catalog/*path route. It serves
+// /catalog/export itself and stops the chain, so an export skips the
+// listing's conditional request and response cache handlers, and passes
+// every other path on to them. A directory whose path is export can
+// therefore not be listed through /catalog/export.
+func (h *CatalogHandler) ServeExport(c *gin.Context) {
+	if c.Param("path") != catalogExportPath || h.exporter == nil {
+		c.Next()
+		return
+	}
+	h.Export(c)
+	c.Abort()
+}
+
+// @Summary Export the catalog
+// @Description Stream every cataloged file matching the filters, in ID order, as NDJSON (one file object per line) or CSV with a header row. The response is chunked and read from the database as it is written, so exports of any size use constant memory. The X-Export-Rows and X-Export-Status trailers report how many files were written and whether the export completed.
+// @Tags catalog
+// @Param format query string false "Export format (ndjson, csv)" default(ndjson)
+// @Param query query string false "File name filter"
+// @Param path query string false "Path prefix filter"
+// @Param extension query string false "File extension filter"
+// @Param mime_type query string false "MIME type filter"
+// @Param min_size query int false "Minimum file size"
+// @Param max_size query int false "Maximum file size"
+// @Param smb_roots query string false "Comma-separated list of SMB roots"
+// @Param is_directory query bool false "Filter by directory status"
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/catalog/export [get]
+func (h *CatalogHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", services.CatalogExportNDJSON)
+	if !services.ValidCatalogExportFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export format", "details": "format must be ndjson or csv"})
+		return
+	}
+
+	var req models.SearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export filters"})
+		return
+	}
+	if smbRoots := c.Query("smb_roots"); smbRoots != "" {
+		req.SmbRoots = strings.Split(smbRoots, ",")
+	}
+
+	contentType := "application/x-ndjson"
+	if format == services.CatalogExportCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", `attachment; filename="catalog-`+time.Now().UTC().Format("20060102")+"."+format+`"`)
+	header.Set("Cache-Control", "no-store")
+	header.Set("Trailer", "X-Export-Rows, X-Export-Status")
+
+	// An export takes as long as the catalog is large, so it is not held
+	// to the request timeout or the server's write timeout. A client that
+	// goes away or stops reading is noticed by the writes failing.
+	w := &exportResponseWriter{ResponseWriter: c.Writer, rc: http.NewResponseController(c.Writer)}
+	w.extendDeadline()
+	written, err := h.exporter.ExportFiles(context.WithoutCancel(c.Request.Context()), &req, format, w)
+	if err != nil && !c.Writer.Written() {
+		// Nothing was sent yet, so the failure can still be the response
+		for _, name := range []string{"Content-Type", "Content-Disposition", "Trailer"} {
+			header.Del(name)
+		}
+		h.logger.Error("Failed to export catalog", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export catalog"})
+		return
+	}
+
+	status := "complete"
+	if err != nil {
+		status = "failed"
+		h.logger.Warn("Catalog export ended early", zap.Int64("rows", written), zap.Error(err))
+	}
+	header.Set("X-Export-Rows", strconv.FormatInt(written, 10))
+	header.Set("X-Export-Status", status)
+}
+
+// exportResponseWriter moves the connection's write deadline forward
+// each time the export is flushed.
+type exportResponseWriter struct {
+	gin.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (w *exportResponseWriter) Flush() {
+	w.extendDeadline()
+	w.ResponseWriter.Flush()
+}
+
+// extendDeadline gives the client catalogExportStallTimeout to take what
+// is written next. Writers without deadlines, as in tests, are left as
+// they are.
+func (w *exportResponseWriter) extendDeadline() {
+	_ = w.rc.SetWriteDeadline(time.Now().Add(catalogExportStallTimeout))
+}
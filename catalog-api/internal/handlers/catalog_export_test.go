@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeCatalogExporter writes rows lines, then fails with err if set.
+type fakeCatalogExporter struct {
+	rows int
+	err  error
+	req  *models.SearchRequest
+}
+
+func (e *fakeCatalogExporter) ExportFiles(ctx context.Context, req *models.SearchRequest, format string, w io.Writer) (int64, error) {
+	e.req = req
+	for i := 0; i < e.rows; i++ {
+		fmt.Fprintf(w, "%s %d\n", format, i)
+	}
+	return int64(e.rows), e.err
+}
+
+func TestCatalogHandler_Export(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := &fakeCatalogExporter{rows: 2}
+	handler := NewCatalogHandler(&mockCatalogService{}, &mockSMBService{}, zap.NewNop())
+	handler.SetExporter(exporter)
+	router := gin.New()
+	listed := 0
+	router.GET("/catalog/*path", handler.ServeExport, func(c *gin.Context) {
+		listed++
+		c.String(http.StatusOK, "listing")
+	})
+
+	get := func(target string) *http.Response {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Result()
+	}
+
+	resp := get("/catalog/export?format=csv&smb_roots=nas,backup&extension=mkv")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "csv 0\ncsv 1\n", string(body))
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), ".csv")
+	assert.Equal(t, "2", resp.Trailer.Get("X-Export-Rows"))
+	assert.Equal(t, "complete", resp.Trailer.Get("X-Export-Status"))
+	assert.Equal(t, []string{"nas", "backup"}, exporter.req.SmbRoots)
+	assert.Equal(t, "mkv", exporter.req.Extension)
+	assert.Zero(t, listed, "exports skip the rest of the listing chain")
+
+	resp = get("/catalog/export")
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, get("/catalog/export?format=xml").StatusCode)
+
+	// A failure part way is reported in the trailer
+	exporter.err = errors.New("disk I/O error")
+	resp = get("/catalog/export")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "failed", resp.Trailer.Get("X-Export-Status"))
+
+	// A failure before anything is written is the response
+	exporter.rows = 0
+	resp = get("/catalog/export")
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(t, `{"error":"Failed to export catalog"}`, string(body))
+	assert.Empty(t, resp.Header.Get("Content-Disposition"))
+
+	// Other paths are listings
+	resp = get("/catalog/movies/export")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, listed)
+	assert.Empty(t, resp.Trailer.Get("X-Export-Status"))
+}
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
 
 	"catalogizer/database"
@@ -14,6 +17,7 @@ import (
 	"github.com/hirochachacha/go-smb2"
 	_ "github.com/mutecomm/go-sqlcipher"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 
@@ -321,3 +325,120 @@ func (suite *CatalogHandlerTestSuite) TestInvalidPath() {
 func TestCatalogHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(CatalogHandlerTestSuite))
 }
+
+// fakeCatalogPages pages through a listing of five files, by cursors that
+// are the index of the next file, and records the limits it was asked
+// for.
+type fakeCatalogPages struct {
+	limits  []int
+	counted int
+}
+
+func (p *fakeCatalogPages) filePage(cursor string, limit int) ([]models.FileInfo, string, error) {
+	p.limits = append(p.limits, limit)
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+	}
+	var files []models.FileInfo
+	for i := start; i < 5 && len(files) < limit; i++ {
+		files = append(files, models.FileInfo{ID: int64(i), Name: fmt.Sprintf("%d.mkv", i)})
+	}
+	next := ""
+	if start+len(files) < 5 {
+		next = strconv.Itoa(start + len(files))
+	}
+	return files, next, nil
+}
+
+func (p *fakeCatalogPages) ListPathPage(ctx context.Context, path, sortBy, sortOrder, cursor string, limit int) ([]models.FileInfo, string, error) {
+	return p.filePage(cursor, limit)
+}
+
+func (p *fakeCatalogPages) SearchFilesPage(ctx context.Context, req *models.SearchRequest, cursor string) ([]models.FileInfo, string, error) {
+	return p.filePage(cursor, req.Limit)
+}
+
+func (p *fakeCatalogPages) CountSearchResults(ctx context.Context, req *models.SearchRequest) (int64, error) {
+	p.counted++
+	return 5, nil
+}
+
+func (p *fakeCatalogPages) DirectoriesBySizePage(ctx context.Context, smbRoot, cursor string, limit int) ([]models.DirectoryStats, string, error) {
+	p.limits = append(p.limits, limit)
+	return []models.DirectoryStats{{Path: "/movies"}}, "", nil
+}
+
+func (p *fakeCatalogPages) DuplicateGroupsPage(ctx context.Context, smbRoot string, minCount int, cursor string, limit int) ([]models.DuplicateGroup, string, error) {
+	p.limits = append(p.limits, limit)
+	return []models.DuplicateGroup{}, "", nil
+}
+
+func TestCatalogHandler_CursorPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pages := &fakeCatalogPages{}
+	handler := NewCatalogHandler(&mockCatalogService{}, &mockSMBService{}, zap.NewNop())
+	handler.SetPageSource(pages)
+	handler.SetPageLimits(2, 3)
+	router := gin.New()
+	router.GET("/catalog/*path", handler.ListPath)
+	router.GET("/search", handler.Search)
+	router.GET("/stats/directories/by-size", handler.GetDirectoriesBySize)
+
+	get := func(target string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	// Listings follow next_cursor to the end, in pages of the default size
+	var names []interface{}
+	target := "/catalog/movies"
+	for i := 0; i < 5; i++ {
+		code, body := get(target)
+		require.Equal(t, http.StatusOK, code)
+		for _, f := range body["files"].([]interface{}) {
+			names = append(names, f.(map[string]interface{})["name"])
+		}
+		next, ok := body["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		target = "/catalog/movies?cursor=" + next
+	}
+	assert.Equal(t, []interface{}{"0.mkv", "1.mkv", "2.mkv", "3.mkv", "4.mkv"}, names)
+	assert.Equal(t, []int{2, 2, 2}, pages.limits)
+
+	// Page sizes are capped
+	code, body := get("/catalog/movies?limit=1000")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), body["limit"])
+	code, _ = get("/stats/directories/by-size?smb_root=nas&limit=1000")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, pages.limits[len(pages.limits)-1])
+
+	// Searches count their matches on the first page only
+	code, body = get("/search?query=mkv")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(5), body["total"])
+	code, body = get("/search?query=mkv&cursor=" + body["next_cursor"].(string))
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "total")
+	assert.Equal(t, 1, pages.counted)
+
+	code, body = get("/catalog/movies?cursor=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "Invalid cursor", body["error"])
+	code, _ = get("/catalog/movies?cursor=2&offset=4")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Offsets are still served by the catalog service
+	code, body = get("/catalog/media?offset=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "next_cursor")
+}
@@ -3,9 +3,13 @@ package handlers
 import (
 	"catalogizer/internal/models"
 	"catalogizer/internal/services"
+	"context"
+	"errors"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -14,22 +18,62 @@ import (
 
 type CopyHandler struct {
 	catalogService *services.CatalogService
-	smbService     *services.SMBService
+	providers      storageProviders
 	tempDir        string
 	logger         *zap.Logger
+	lockdowns      lockdownChecker
+	versions       fileVersioner
+	maxUploadSize  int64
 }
 
-func NewCopyHandler(catalogService *services.CatalogService, smbService *services.SMBService, tempDir string, logger *zap.Logger) *CopyHandler {
+// fileVersioner preserves the current content of a remote file before it is
+// overwritten
+type fileVersioner interface {
+	CaptureRemote(ctx context.Context, storageRoot, path, origin string, userID *int) (*services.FileVersion, error)
+}
+
+// lockdownChecker reports whether a storage root is in read-only lockdown
+type lockdownChecker interface {
+	IsLocked(storageRoot string) bool
+}
+
+func NewCopyHandler(catalogService *services.CatalogService, providers storageProviders, tempDir string, logger *zap.Logger) *CopyHandler {
 	return &CopyHandler{
 		catalogService: catalogService,
-		smbService:     smbService,
+		providers:      providers,
 		tempDir:        tempDir,
 		logger:         logger,
 	}
 }
 
-// @Summary Copy file between SMB shares
-// @Description Copy a file from one SMB location to another
+// SetLockdownChecker makes write operations refuse storage roots that are in
+// read-only lockdown
+func (h *CopyHandler) SetLockdownChecker(checker lockdownChecker) {
+	h.lockdowns = checker
+}
+
+// SetVersionService keeps previous versions of files overwritten by uploads
+func (h *CopyHandler) SetVersionService(versions fileVersioner) {
+	h.versions = versions
+}
+
+// SetMaxUploadSize rejects uploads larger than maxBytes; 0 means unlimited
+func (h *CopyHandler) SetMaxUploadSize(maxBytes int64) {
+	h.maxUploadSize = maxBytes
+}
+
+// rejectIfLocked writes a 423 response and returns true when the target
+// storage root is locked down
+func (h *CopyHandler) rejectIfLocked(c *gin.Context, storageRoot string) bool {
+	if h.lockdowns == nil || !h.lockdowns.IsLocked(storageRoot) {
+		return false
+	}
+	c.JSON(http.StatusLocked, gin.H{"error": "Storage root is in read-only lockdown", "storage_root": storageRoot})
+	return true
+}
+
+// @Summary Copy file between storage roots
+// @Description Copy a file from one storage root to another (or within one), whatever their protocols. Paths are 'storage_root:path'.
 // @Tags copy
 // @Accept json
 // @Param request body models.CopyRequest true "Copy request"
@@ -59,9 +103,25 @@ func (h *CopyHandler) CopyToSMB(c *gin.Context) {
 		return
 	}
 
+	if h.rejectIfLocked(c, destHost) {
+		return
+	}
+
+	ctx := services.WithIOPriority(c.Request.Context(), services.IOPriorityTransfer)
+	dest, err := h.providers.Provider(ctx, destHost)
+	if respondStorageUnavailable(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to connect to destination", zap.String("storage_root", destHost), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to destination"})
+		return
+	}
+	defer dest.Close()
+
 	// Check if destination exists and handle overwrite
 	if !req.Overwrite {
-		exists, err := h.smbService.FileExists(destHost, destPath)
+		exists, err := dest.Exists(ctx, destPath)
 		if err != nil {
 			h.logger.Error("Failed to check destination file", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check destination"})
@@ -73,10 +133,17 @@ func (h *CopyHandler) CopyToSMB(c *gin.Context) {
 		}
 	}
 
-	// Perform copy
-	err := h.smbService.CopyFile(sourceHost, sourcePath, destHost, destPath)
+	// Copy within a root natively; across roots by streaming between providers
+	if sourceHost == destHost {
+		err = dest.Copy(ctx, sourcePath, destPath)
+	} else {
+		err = h.copyBetween(ctx, sourceHost, sourcePath, dest, destPath)
+	}
+	if respondStorageUnavailable(c, err) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to copy file via SMB",
+		h.logger.Error("Failed to copy file",
 			zap.String("source", req.SourcePath),
 			zap.String("destination", req.DestinationPath),
 			zap.Error(err))
@@ -84,7 +151,7 @@ func (h *CopyHandler) CopyToSMB(c *gin.Context) {
 		return
 	}
 
-	h.logger.Info("File copied successfully via SMB",
+	h.logger.Info("File copied successfully",
 		zap.String("source", req.SourcePath),
 		zap.String("destination", req.DestinationPath))
 
@@ -95,8 +162,8 @@ func (h *CopyHandler) CopyToSMB(c *gin.Context) {
 	})
 }
 
-// @Summary Copy file from SMB to local filesystem
-// @Description Copy a file from SMB share to local filesystem
+// @Summary Copy file from a storage root to local filesystem
+// @Description Copy a file from any storage root to the API host's filesystem
 // @Tags copy
 // @Accept json
 // @Param request body models.CopyRequest true "Copy request"
@@ -142,10 +209,13 @@ func (h *CopyHandler) CopyToLocal(c *gin.Context) {
 		return
 	}
 
-	// Download from SMB to local
-	err := h.smbService.DownloadFile(sourceHost, sourcePath, destPath)
+	// Download from the storage root to local
+	err := h.downloadTo(services.WithIOPriority(c.Request.Context(), services.IOPriorityTransfer), sourceHost, sourcePath, destPath)
+	if respondStorageUnavailable(c, err) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to copy file from SMB to local",
+		h.logger.Error("Failed to copy file from storage to local",
 			zap.String("source", req.SourcePath),
 			zap.String("destination", destPath),
 			zap.Error(err))
@@ -153,7 +223,7 @@ func (h *CopyHandler) CopyToLocal(c *gin.Context) {
 		return
 	}
 
-	h.logger.Info("File copied successfully from SMB to local",
+	h.logger.Info("File copied successfully from storage to local",
 		zap.String("source", req.SourcePath),
 		zap.String("destination", destPath))
 
@@ -164,8 +234,8 @@ func (h *CopyHandler) CopyToLocal(c *gin.Context) {
 	})
 }
 
-// @Summary Upload file from local to SMB
-// @Description Upload a file from local filesystem to SMB share
+// @Summary Upload file to a storage root
+// @Description Upload a file to any storage root
 // @Tags copy
 // @Accept multipart/form-data
 // @Param file formData file true "File to upload"
@@ -177,14 +247,29 @@ func (h *CopyHandler) CopyToLocal(c *gin.Context) {
 // @Failure 500 {object} map[string]string
 // @Router /api/v1/copy/upload [post]
 func (h *CopyHandler) CopyFromLocal(c *gin.Context) {
+	if h.maxUploadSize > 0 {
+		// Leave room for the multipart framing and the form fields
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadSize+1<<20)
+	}
+
 	// Get uploaded file
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the maximum upload size", "max_upload_size": h.maxUploadSize})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
 	defer file.Close()
 
+	if h.maxUploadSize > 0 && header.Size > h.maxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the maximum upload size", "max_upload_size": h.maxUploadSize})
+		return
+	}
+
 	destination := c.PostForm("destination")
 	if destination == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Destination path is required"})
@@ -200,9 +285,25 @@ func (h *CopyHandler) CopyFromLocal(c *gin.Context) {
 		return
 	}
 
+	if h.rejectIfLocked(c, destHost) {
+		return
+	}
+
+	ctx := services.WithIOPriority(c.Request.Context(), services.IOPriorityTransfer)
+	dest, err := h.providers.Provider(ctx, destHost)
+	if respondStorageUnavailable(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to connect to destination", zap.String("storage_root", destHost), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to destination"})
+		return
+	}
+	defer dest.Close()
+
 	// Check if destination exists and handle overwrite
 	if !overwrite {
-		exists, err := h.smbService.FileExists(destHost, destPath)
+		exists, err := dest.Exists(ctx, destPath)
 		if err != nil {
 			h.logger.Error("Failed to check destination file", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check destination"})
@@ -212,38 +313,32 @@ func (h *CopyHandler) CopyFromLocal(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Destination file already exists"})
 			return
 		}
+	} else if h.versions != nil {
+		if exists, err := dest.Exists(ctx, destPath); err == nil && exists {
+			var userID *int
+			if uid, err := strconv.Atoi(c.GetString("user_id")); err == nil {
+				userID = &uid
+			}
+			if _, err := h.versions.CaptureRemote(c.Request.Context(), destHost, destPath, services.VersionOriginUpload, userID); err != nil {
+				h.logger.Error("Failed to preserve previous file version", zap.String("destination", destination), zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preserve previous version"})
+				return
+			}
+		}
 	}
 
-	// Save uploaded file to temp location
-	tempFile, err := os.CreateTemp(h.tempDir, "upload_*")
-	if err != nil {
-		h.logger.Error("Failed to create temp file", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process upload"})
-		return
-	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
-
-	// Copy uploaded data to temp file
-	_, err = tempFile.ReadFrom(file)
-	if err != nil {
-		h.logger.Error("Failed to save uploaded file", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save upload"})
-		return
-	}
-
-	// Upload to SMB
-	err = h.smbService.UploadFile(destHost, tempFile.Name(), destPath)
+	// Upload to the storage root
+	err = dest.Write(ctx, destPath, file)
 	if err != nil {
-		h.logger.Error("Failed to upload file to SMB",
+		h.logger.Error("Failed to upload file to storage",
 			zap.String("filename", header.Filename),
 			zap.String("destination", destination),
 			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload to SMB failed"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload to storage failed"})
 		return
 	}
 
-	h.logger.Info("File uploaded successfully to SMB",
+	h.logger.Info("File uploaded successfully to storage",
 		zap.String("filename", header.Filename),
 		zap.String("destination", destination),
 		zap.Int64("size", header.Size))
@@ -256,10 +351,10 @@ func (h *CopyHandler) CopyFromLocal(c *gin.Context) {
 	})
 }
 
-// @Summary List files in SMB directory
-// @Description List files and directories in an SMB share
+// @Summary List files in a storage root directory
+// @Description List files and directories on any storage root, read live from storage
 // @Tags smb
-// @Param host query string true "SMB host name"
+// @Param host query string true "Storage root name"
 // @Param path path string false "Directory path"
 // @Produce json
 // @Success 200 {object} map[string]interface{}
@@ -283,9 +378,12 @@ func (h *CopyHandler) ListSMBPath(c *gin.Context) {
 		path = path[1:]
 	}
 
-	files, err := h.smbService.ListFiles(hostName, path)
+	listing, err := h.catalogService.ListStorageDirectory(c.Request.Context(), hostName, path)
+	if respondStorageUnavailable(c, err) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to list SMB directory",
+		h.logger.Error("Failed to list storage directory",
 			zap.String("host", hostName),
 			zap.String("path", path),
 			zap.Error(err))
@@ -293,24 +391,30 @@ func (h *CopyHandler) ListSMBPath(c *gin.Context) {
 		return
 	}
 
-	// Convert os.FileInfo to a more JSON-friendly format
+	// Convert to a more JSON-friendly format
 	var fileList []map[string]interface{}
-	for _, file := range files {
+	for _, file := range listing.Entries {
 		fileList = append(fileList, map[string]interface{}{
-			"name":          file.Name(),
-			"size":          file.Size(),
-			"is_directory":  file.IsDir(),
-			"last_modified": file.ModTime(),
-			"mode":          file.Mode().String(),
+			"name":          file.Name,
+			"size":          file.Size,
+			"is_directory":  file.IsDir,
+			"last_modified": file.ModTime,
+			"mode":          file.Mode.String(),
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"host":  hostName,
 		"path":  path,
 		"files": fileList,
 		"count": len(fileList),
-	})
+	}
+	if listing.CachedAt != nil {
+		// The root is unavailable; this is the listing as last read
+		response["stale"] = true
+		response["cached_at"] = listing.CachedAt
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // Helper function to parse host:path format
@@ -322,20 +426,75 @@ func (h *CopyHandler) parseHostPath(hostPath string) (string, string) {
 	return parts[0], parts[1]
 }
 
-// @Summary Get available SMB hosts
-// @Description Get list of configured SMB hosts
+// @Summary Get available storage roots
+// @Description Get the names of the configured storage roots usable as 'host' in copy and list requests, with their protocols
 // @Tags smb
 // @Produce json
 // @Success 200 {array} string
 // @Router /api/v1/smb/hosts [get]
 func (h *CopyHandler) GetSMBHosts(c *gin.Context) {
-	hosts := h.smbService.GetHosts()
+	roots, err := h.catalogService.GetStorageRoots(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to list storage roots", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list storage roots"})
+		return
+	}
+
+	hosts := make([]string, 0, len(roots))
+	for _, root := range roots {
+		hosts = append(hosts, root.Name)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"hosts": hosts,
+		"roots": roots,
 		"count": len(hosts),
 	})
 }
 
+// copyBetween streams a file from one storage root to another
+func (h *CopyHandler) copyBetween(ctx context.Context, sourceRoot, sourcePath string, dest services.StorageProvider, destPath string) error {
+	source, err := h.providers.Provider(ctx, sourceRoot)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	reader, err := source.Open(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return dest.Write(ctx, destPath, reader)
+}
+
+// downloadTo copies a file from a storage root to a local path
+func (h *CopyHandler) downloadTo(ctx context.Context, sourceRoot, sourcePath, localPath string) error {
+	source, err := h.providers.Provider(ctx, sourceRoot)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	reader, err := source.Open(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(localPath)
+	}
+	return err
+}
+
 // @Summary Copy file to storage
 // @Description Copy a file to a storage location
 // @Tags copy
@@ -358,6 +517,10 @@ func (h *CopyHandler) CopyToStorage(c *gin.Context) {
 		return
 	}
 
+	if h.rejectIfLocked(c, req.StorageID) {
+		return
+	}
+
 	// Implement storage copy logic
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "File copied to storage successfully",
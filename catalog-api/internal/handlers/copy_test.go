@@ -518,7 +518,7 @@ func TestCopyHandler_GetSMBHosts_NilService(t *testing.T) {
 	logger := zap.NewNop()
 	handler := &CopyHandler{logger: logger}
 
-	// With nil smbService, this will panic
+	// With a nil catalog service, this will panic
 	assert.Panics(t, func() {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
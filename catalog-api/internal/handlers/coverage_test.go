@@ -656,7 +656,7 @@ func TestDownloadHandler_createZipArchive_EmptyFiles(t *testing.T) {
 	handler := NewDownloadHandler(nil, nil, "/tmp", 1024*1024, 32768, logger)
 
 	var buf bytes.Buffer
-	err := handler.createZipArchive(&buf, nil)
+	err := handler.createZipArchive(context.Background(), &buf, nil, nil)
 	assert.NoError(t, err)
 	// The result is a valid (empty) zip archive
 	assert.True(t, buf.Len() > 0)
@@ -667,7 +667,7 @@ func TestDownloadHandler_createTarArchive_EmptyFiles_Uncompressed(t *testing.T)
 	handler := NewDownloadHandler(nil, nil, "/tmp", 1024*1024, 32768, logger)
 
 	var buf bytes.Buffer
-	err := handler.createTarArchive(&buf, nil, false)
+	err := handler.createTarArchive(context.Background(), &buf, nil, nil, false)
 	assert.NoError(t, err)
 }
 
@@ -676,7 +676,7 @@ func TestDownloadHandler_createTarArchive_EmptyFiles_Compressed(t *testing.T) {
 	handler := NewDownloadHandler(nil, nil, "/tmp", 1024*1024, 32768, logger)
 
 	var buf bytes.Buffer
-	err := handler.createTarArchive(&buf, nil, true)
+	err := handler.createTarArchive(context.Background(), &buf, nil, nil, true)
 	assert.NoError(t, err)
 }
 
@@ -830,9 +830,9 @@ func TestCopyHandler_CopyToLocal_EmptyDestination(t *testing.T) {
 func TestCopyHandler_CopyToLocal_ValidSourceAndDest_NilService(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	logger := zap.NewNop()
-	handler := &CopyHandler{logger: logger, smbService: nil}
+	handler := &CopyHandler{logger: logger, providers: nil}
 
-	// Valid source and destination; smbService is nil -> panic when checking file exists
+	// Valid source and destination; providers is nil -> panic when opening the source
 	body := `{"source_path":"server:/source/file.txt","destination_path":"/tmp/test_copy_dest_xxx"}`
 	assert.Panics(t, func() {
 		w := httptest.NewRecorder()
@@ -873,11 +873,11 @@ func TestCopyHandler_CopyFromLocal_MissingDestination(t *testing.T) {
 func TestCopyHandler_ListSMBPath_WithHost_EmptyPath(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	logger := zap.NewNop()
-	handler := &CopyHandler{logger: logger, smbService: nil}
+	handler := &CopyHandler{logger: logger, providers: nil}
 
 	// With host provided but empty path -> path defaults to "/"
 	// Then it strips leading slash -> path becomes ""
-	// Then calls smbService.ListFiles which panics on nil
+	// Then lists through the nil catalog service, which panics
 	assert.Panics(t, func() {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
@@ -891,7 +891,7 @@ func TestCopyHandler_ListSMBPath_WithHost_EmptyPath(t *testing.T) {
 func TestCopyHandler_ListSMBPath_WithHostAndPath_NilService(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	logger := zap.NewNop()
-	handler := &CopyHandler{logger: logger, smbService: nil}
+	handler := &CopyHandler{logger: logger, providers: nil}
 
 	assert.Panics(t, func() {
 		w := httptest.NewRecorder()
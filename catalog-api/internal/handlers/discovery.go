@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"catalogizer/internal/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DiscoveryHandler handles network storage discovery API requests
+type DiscoveryHandler struct {
+	service *services.DiscoveryService
+	logger  *zap.Logger
+}
+
+// NewDiscoveryHandler creates a new discovery handler
+func NewDiscoveryHandler(service *services.DiscoveryService, logger *zap.Logger) *DiscoveryHandler {
+	return &DiscoveryHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Discover finds SMB shares, NFS exports, WebDAV servers and DLNA media
+// servers on the network, or on one host
+// @Summary Discover network storage
+// @Description Browses mDNS and SSDP, lists NFS exports with showmount and SMB shares of a host, and checks every source for reachability
+// @Tags Discovery
+// @Accept json
+// @Produce json
+// @Param request body services.DiscoveryRequest true "Discovery request"
+// @Success 200 {object} services.DiscoveryResult
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/discovery/storage [post]
+func (h *DiscoveryHandler) Discover(c *gin.Context) {
+	var req services.DiscoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error("Invalid request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	h.discover(c, req)
+}
+
+// DiscoverGET discovers network storage using GET parameters, without
+// SMB credentials
+// @Summary Discover network storage (GET)
+// @Description Discovers network storage using GET parameters
+// @Tags Discovery
+// @Produce json
+// @Param host query string false "Host to limit discovery to"
+// @Param protocols query string false "Comma-separated protocols: smb, nfs, webdav, dlna"
+// @Success 200 {object} services.DiscoveryResult
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/discovery/storage [get]
+func (h *DiscoveryHandler) DiscoverGET(c *gin.Context) {
+	req := services.DiscoveryRequest{Host: c.Query("host")}
+	if protocols := c.Query("protocols"); protocols != "" {
+		req.Protocols = strings.Split(protocols, ",")
+	}
+	h.discover(c, req)
+}
+
+func (h *DiscoveryHandler) discover(c *gin.Context, req services.DiscoveryRequest) {
+	result, err := h.service.Discover(c.Request.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid protocol") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to discover network storage", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discover network storage: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
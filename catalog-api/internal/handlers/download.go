@@ -6,6 +6,7 @@ import (
 	"catalogizer/internal/models"
 	"catalogizer/internal/services"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,17 +22,57 @@ import (
 
 type DownloadHandler struct {
 	catalogService *services.CatalogService
-	smbService     *services.SMBService
+	providers      storageProviders
 	tempDir        string
 	maxArchiveSize int64
 	chunkSize      int
 	logger         *zap.Logger
+	coldStorage    coldStorageGate
+	accesses       accessRecorder
+	prefetch       prefetchCache
+	encryptor      downloadEncryptor
+	hls            *hlsTranscodes
+	// stagedProtocols are the storage protocols whose files archives stage
+	// on disk instead of streaming
+	stagedProtocols map[string]bool
 }
 
-func NewDownloadHandler(catalogService *services.CatalogService, smbService *services.SMBService, tempDir string, maxArchiveSize int64, chunkSize int, logger *zap.Logger) *DownloadHandler {
+// storageProviders connects to storage roots through the provider for their
+// protocol
+type storageProviders interface {
+	Provider(ctx context.Context, storageRoot string) (services.StorageProvider, error)
+}
+
+// downloadEncryptor encrypts downloads to public keys registered by the
+// requesting user
+type downloadEncryptor interface {
+	ResolveKey(ctx context.Context, userID int, ref string) (*services.EncryptionKey, error)
+	Encrypt(ctx context.Context, key *services.EncryptionKey, dst io.Writer) (io.WriteCloser, error)
+}
+
+// prefetchCache serves locally prefetched copies of remote files and queues
+// the files likely to be requested next
+type prefetchCache interface {
+	CachedFile(ctx context.Context, fileID int64) (string, bool, error)
+	Prefetch(ctx context.Context, fileID, playlistID int64)
+}
+
+// accessRecorder counts reads of catalogued files for tiering decisions
+type accessRecorder interface {
+	RecordAccess(ctx context.Context, fileID int64) error
+}
+
+// coldStorageGate resolves files on cold storage tiers to their recalled
+// copies and starts recalls for files that are not staged yet
+type coldStorageGate interface {
+	StagedFile(ctx context.Context, fileID int64) (string, bool, error)
+	RequestRecall(ctx context.Context, fileID int64, userID *int) (*services.RecallJob, error)
+}
+
+func NewDownloadHandler(catalogService *services.CatalogService, providers storageProviders, tempDir string, maxArchiveSize int64, chunkSize int, logger *zap.Logger) *DownloadHandler {
 	return &DownloadHandler{
 		catalogService: catalogService,
-		smbService:     smbService,
+		providers:      providers,
 		tempDir:        tempDir,
 		maxArchiveSize: maxArchiveSize,
 		chunkSize:      chunkSize,
@@ -39,12 +80,208 @@ func NewDownloadHandler(catalogService *services.CatalogService, smbService *ser
 	}
 }
 
+// SetColdStorage makes downloads of files on cold storage tiers serve the
+// recalled copy, or start a recall when there is none
+func (h *DownloadHandler) SetColdStorage(gate coldStorageGate) {
+	h.coldStorage = gate
+}
+
+// SetAccessRecorder records every completed single-file download
+func (h *DownloadHandler) SetAccessRecorder(recorder accessRecorder) {
+	h.accesses = recorder
+}
+
+func (h *DownloadHandler) recordAccess(c *gin.Context, id int64) {
+	if h.accesses == nil {
+		return
+	}
+	if err := h.accesses.RecordAccess(c.Request.Context(), id); err != nil {
+		h.logger.Warn("Failed to record file access", zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+// SetPrefetchCache serves single-file downloads from the local prefetch cache
+// when possible and prefetches what is likely to be downloaded next
+func (h *DownloadHandler) SetPrefetchCache(cache prefetchCache) {
+	h.prefetch = cache
+}
+
+// prefetchNext queues the episodes or tracks following a downloaded file.
+// The optional playlist_id query parameter selects playlist order.
+func (h *DownloadHandler) prefetchNext(c *gin.Context, id int64) {
+	if h.prefetch == nil {
+		return
+	}
+	playlistID, _ := strconv.ParseInt(c.Query("playlist_id"), 10, 64)
+	h.prefetch.Prefetch(c.Request.Context(), id, playlistID)
+}
+
+// SetEncryptor enables the encrypt query parameter, which encrypts a
+// download to one of the user's keys ("default" or a key ID)
+func (h *DownloadHandler) SetEncryptor(encryptor downloadEncryptor) {
+	h.encryptor = encryptor
+}
+
+// encryptionKey resolves the key requested by the encrypt query parameter,
+// or nil when the download is not to be encrypted. It returns false after
+// writing an error response.
+func (h *DownloadHandler) encryptionKey(c *gin.Context) (*services.EncryptionKey, bool) {
+	ref := c.Query("encrypt")
+	if ref == "" {
+		return nil, true
+	}
+	if h.encryptor == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Encrypted downloads are not enabled"})
+		return nil, false
+	}
+	userID, err := strconv.Atoi(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required for encrypted downloads"})
+		return nil, false
+	}
+
+	key, err := h.encryptor.ResolveKey(c.Request.Context(), userID, ref)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "invalid key"):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Invalid encryption key", "details": err.Error()})
+		return nil, false
+	}
+	return key, true
+}
+
+// sendStream writes a download body produced by write, encrypted to key
+// when one is given. Encrypted artifacts get the key's file extension and
+// no Content-Length, since the ciphertext size is not known up front.
+func (h *DownloadHandler) sendStream(c *gin.Context, key *services.EncryptionKey, filename, contentType string, size int64, write func(io.Writer) error) error {
+	if key == nil {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sanitizeContentDisposition(filename)))
+		c.Header("Content-Type", contentType)
+		if size >= 0 {
+			c.Header("Content-Length", strconv.FormatInt(size, 10))
+		}
+		return write(c.Writer)
+	}
+
+	enc, err := h.encryptor.Encrypt(c.Request.Context(), key, c.Writer)
+	if err != nil {
+		h.logger.Error("Failed to start encryption", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt download"})
+		return err
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sanitizeContentDisposition(filename+key.Extension())))
+	c.Header("Content-Type", "application/octet-stream")
+	err = write(enc)
+	if closeErr := enc.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sendLocalFile serves a file from local disk, encrypted to key when set
+func (h *DownloadHandler) sendLocalFile(c *gin.Context, key *services.EncryptionKey, path, filename string) error {
+	if key == nil {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sanitizeContentDisposition(filename)))
+		c.Header("Content-Type", "application/octet-stream")
+		c.File(path)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file"})
+		return err
+	}
+	defer f.Close()
+	return h.sendStream(c, key, filename, "application/octet-stream", -1, func(w io.Writer) error {
+		_, err := io.CopyBuffer(w, f, make([]byte, h.chunkSize))
+		return err
+	})
+}
+
+// serveCachedFile streams a prefetched copy and returns false on a cache miss
+func (h *DownloadHandler) serveCachedFile(c *gin.Context, id int64, fileInfo *models.FileInfo, key *services.EncryptionKey) bool {
+	if h.prefetch == nil {
+		return false
+	}
+
+	cached, ok, err := h.prefetch.CachedFile(c.Request.Context(), id)
+	if err != nil {
+		h.logger.Warn("Failed to check prefetch cache", zap.Int64("id", id), zap.Error(err))
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	if err := h.sendLocalFile(c, key, cached, fileInfo.Name); err != nil {
+		h.logger.Error("Failed to stream cached file", zap.Int64("id", id), zap.Error(err))
+		return true
+	}
+	h.recordAccess(c, id)
+	h.prefetchNext(c, id)
+	h.logger.Info("File downloaded from prefetch cache", zap.String("file", fileInfo.Name), zap.Int64("id", id))
+	return true
+}
+
+// serveColdFile handles downloads of files on cold tiers and returns false
+// for files that can be read directly
+func (h *DownloadHandler) serveColdFile(c *gin.Context, id int64, fileInfo *models.FileInfo, key *services.EncryptionKey) bool {
+	if h.coldStorage == nil {
+		return false
+	}
+
+	staged, cold, err := h.coldStorage.StagedFile(c.Request.Context(), id)
+	if err != nil {
+		h.logger.Error("Failed to check cold storage", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file information"})
+		return true
+	}
+	if !cold {
+		return false
+	}
+
+	if staged != "" {
+		if err := h.sendLocalFile(c, key, staged, fileInfo.Name); err != nil {
+			h.logger.Error("Failed to stream recalled file", zap.Int64("id", id), zap.Error(err))
+			return true
+		}
+		h.recordAccess(c, id)
+		h.logger.Info("Recalled file downloaded", zap.String("file", fileInfo.Name), zap.Int64("id", id))
+		return true
+	}
+
+	var userID *int
+	if uid, err := strconv.Atoi(c.GetString("user_id")); err == nil {
+		userID = &uid
+	}
+	job, err := h.coldStorage.RequestRecall(c.Request.Context(), id, userID)
+	if err != nil {
+		h.logger.Error("Failed to request recall", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to recall file from cold storage"})
+		return true
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "File is in cold storage; a recall has been requested",
+		"recall":  job,
+	})
+	return true
+}
+
 // @Summary Download a single file
 // @Description Download a file from the catalog
 // @Tags download
 // @Param id path int true "File ID"
+// @Param playlist_id query int false "Playlist being played, used to prefetch its next tracks"
+// @Param encrypt query string false "Encrypt to one of your keys: \"default\" or a key ID"
 // @Produce application/octet-stream
 // @Success 200 {file} binary
+// @Success 202 {object} map[string]interface{} "File is in cold storage and is being recalled"
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
@@ -74,6 +311,18 @@ func (h *DownloadHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
+	key, ok := h.encryptionKey(c)
+	if !ok {
+		return
+	}
+
+	if h.serveColdFile(c, id, fileInfo, key) {
+		return
+	}
+	if h.serveCachedFile(c, id, fileInfo, key) {
+		return
+	}
+
 	// Create temporary file for download
 	tempFile, err := os.CreateTemp(h.tempDir, "download_*")
 	if err != nil {
@@ -84,26 +333,30 @@ func (h *DownloadHandler) DownloadFile(c *gin.Context) {
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
-	// Download from SMB to temp file
-	err = h.smbService.DownloadFile(fileInfo.SmbRoot, fileInfo.Path, tempFile.Name())
+	// Download from the storage root to temp file
+	err = h.fetchFile(c.Request.Context(), fileInfo.SmbRoot, fileInfo.Path, tempFile)
+	if respondStorageUnavailable(c, err) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to download from SMB", zap.Error(err))
+		h.logger.Error("Failed to download from storage", zap.String("storage_root", fileInfo.SmbRoot), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file"})
 		return
 	}
 
 	// Stream file to client
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sanitizeContentDisposition(fileInfo.Name)))
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
-
 	tempFile.Seek(0, 0)
-	_, err = io.CopyBuffer(c.Writer, tempFile, make([]byte, h.chunkSize))
+	err = h.sendStream(c, key, fileInfo.Name, "application/octet-stream", fileInfo.Size, func(w io.Writer) error {
+		_, err := io.CopyBuffer(w, tempFile, make([]byte, h.chunkSize))
+		return err
+	})
 	if err != nil {
 		h.logger.Error("Failed to stream file", zap.Error(err))
 		return
 	}
 
+	h.recordAccess(c, id)
+	h.prefetchNext(c, id)
 	h.logger.Info("File downloaded successfully", zap.String("file", fileInfo.Name), zap.Int64("id", id))
 }
 
@@ -112,6 +365,7 @@ func (h *DownloadHandler) DownloadFile(c *gin.Context) {
 // @Tags download
 // @Param path path string true "Directory path"
 // @Param format query string false "Archive format (zip, tar, tar.gz)" default(zip)
+// @Param encrypt query string false "Encrypt to one of your keys: \"default\" or a key ID"
 // @Produce application/octet-stream
 // @Success 200 {file} binary
 // @Failure 400 {object} map[string]string
@@ -138,6 +392,11 @@ func (h *DownloadHandler) DownloadDirectory(c *gin.Context) {
 		return
 	}
 
+	key, ok := h.encryptionKey(c)
+	if !ok {
+		return
+	}
+
 	// Get directory listing recursively
 	files, err := h.getDirectoryContentsRecursive(path)
 	if err != nil {
@@ -151,35 +410,39 @@ func (h *DownloadHandler) DownloadDirectory(c *gin.Context) {
 		return
 	}
 
-	// Check total size
-	var totalSize int64
-	for _, file := range files {
-		totalSize += file.Size
+	sources, err := h.openArchiveSources(c.Request.Context(), files)
+	if respondStorageUnavailable(c, err) {
+		return
 	}
-
-	if totalSize > h.maxArchiveSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":      "Directory too large for download",
-			"total_size": totalSize,
-			"max_size":   h.maxArchiveSize,
-		})
+	if err != nil {
+		h.logger.Error("Failed to open directory for archive", zap.String("path", path), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect to storage"})
 		return
 	}
+	defer sources.Close()
+
+	// Only archives staged on disk are limited in size
+	if sources.Staging() {
+		var totalSize int64
+		for _, file := range files {
+			totalSize += file.Size
+		}
+
+		if totalSize > h.maxArchiveSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Directory too large for download",
+				"total_size": totalSize,
+				"max_size":   h.maxArchiveSize,
+			})
+			return
+		}
+	}
 
 	// Create archive
 	filename := filepath.Base(path) + "." + format
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-
-	switch format {
-	case "zip":
-		c.Header("Content-Type", "application/zip")
-		h.createZipArchive(c.Writer, files)
-	case "tar":
-		c.Header("Content-Type", "application/x-tar")
-		h.createTarArchive(c.Writer, files, false)
-	case "tar.gz":
-		c.Header("Content-Type", "application/gzip")
-		h.createTarArchive(c.Writer, files, true)
+	if err := h.sendArchive(c, key, filename, format, files, sources); err != nil {
+		h.logger.Error("Failed to stream archive", zap.String("path", path), zap.Error(err))
+		return
 	}
 
 	h.logger.Info("Directory downloaded successfully", zap.String("path", path), zap.String("format", format))
@@ -190,6 +453,7 @@ func (h *DownloadHandler) DownloadDirectory(c *gin.Context) {
 // @Tags download
 // @Accept json
 // @Param request body models.DownloadRequest true "Download request"
+// @Param encrypt query string false "Encrypt to one of your keys: \"default\" or a key ID"
 // @Produce application/octet-stream
 // @Success 200 {file} binary
 // @Failure 400 {object} map[string]string
@@ -216,6 +480,11 @@ func (h *DownloadHandler) DownloadArchive(c *gin.Context) {
 		return
 	}
 
+	key, ok := h.encryptionKey(c)
+	if !ok {
+		return
+	}
+
 	// Get file information for all paths
 	var files []models.FileInfo
 	var totalSize int64
@@ -235,7 +504,19 @@ func (h *DownloadHandler) DownloadArchive(c *gin.Context) {
 		}
 	}
 
-	if totalSize > h.maxArchiveSize {
+	sources, err := h.openArchiveSources(c.Request.Context(), files)
+	if respondStorageUnavailable(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to open files for archive", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect to storage"})
+		return
+	}
+	defer sources.Close()
+
+	// Only archives staged on disk are limited in size
+	if sources.Staging() && totalSize > h.maxArchiveSize {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":      "Total size too large for download",
 			"total_size": totalSize,
@@ -246,129 +527,266 @@ func (h *DownloadHandler) DownloadArchive(c *gin.Context) {
 
 	// Create archive
 	filename := fmt.Sprintf("archive_%d.%s", time.Now().Unix(), req.Format)
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-
-	switch req.Format {
-	case "zip":
-		c.Header("Content-Type", "application/zip")
-		h.createZipArchive(c.Writer, files)
-	case "tar":
-		c.Header("Content-Type", "application/x-tar")
-		h.createTarArchive(c.Writer, files, false)
-	case "tar.gz":
-		c.Header("Content-Type", "application/gzip")
-		h.createTarArchive(c.Writer, files, true)
+	if err := h.sendArchive(c, key, filename, req.Format, files, sources); err != nil {
+		h.logger.Error("Failed to stream archive", zap.Error(err))
+		return
 	}
 
 	h.logger.Info("Archive downloaded successfully", zap.Int("file_count", len(files)), zap.String("format", req.Format))
 }
 
-func (h *DownloadHandler) createZipArchive(w io.Writer, files []models.FileInfo) error {
-	zipWriter := zip.NewWriter(w)
-	defer zipWriter.Close()
+// sendArchive streams files as a zip, tar or tar.gz archive
+func (h *DownloadHandler) sendArchive(c *gin.Context, key *services.EncryptionKey, filename, format string, files []models.FileInfo, sources *archiveSources) error {
+	contentType := map[string]string{
+		"zip":    "application/zip",
+		"tar":    "application/x-tar",
+		"tar.gz": "application/gzip",
+	}[format]
+	ctx := c.Request.Context()
+	return h.sendStream(c, key, filename, contentType, -1, func(w io.Writer) error {
+		if format == "zip" {
+			return h.createZipArchive(ctx, w, files, sources)
+		}
+		return h.createTarArchive(ctx, w, files, sources, format == "tar.gz")
+	})
+}
+
+// fetchFile copies a file from its storage root into dst
+func (h *DownloadHandler) fetchFile(ctx context.Context, storageRoot, path string, dst io.Writer) error {
+	provider, err := h.providers.Provider(ctx, storageRoot)
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+
+	src, err := provider.Open(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
 
+// SetStagedArchiveProtocols makes archives stage the files of storage roots
+// with these protocols under the temp dir before adding them, for protocols
+// that cannot stream. Archives that stage files are limited to the maximum archive size; all others stream
+// straight from storage and have no size limit.
+func (h *DownloadHandler) SetStagedArchiveProtocols(protocols []string) {
+	h.stagedProtocols = make(map[string]bool, len(protocols))
+	for _, protocol := range protocols {
+		h.stagedProtocols[strings.ToLower(protocol)] = true
+	}
+}
+
+// archiveSources opens the files of one archive, connecting to each of
+// their storage roots once
+type archiveSources struct {
+	handler   *DownloadHandler
+	providers map[string]services.StorageProvider
+	// staged lists the storage roots whose files are staged on disk
+	staged map[string]bool
+}
+
+// openArchiveSources connects to the storage roots of files
+func (h *DownloadHandler) openArchiveSources(ctx context.Context, files []models.FileInfo) (*archiveSources, error) {
+	sources := &archiveSources{
+		handler:   h,
+		providers: make(map[string]services.StorageProvider),
+		staged:    make(map[string]bool),
+	}
 	for _, file := range files {
 		if file.IsDirectory {
-			continue // Skip directories for now
+			continue
 		}
-
-		// Download file to temp location
-		tempFile, err := os.CreateTemp(h.tempDir, "zip_*")
-		if err != nil {
-			h.logger.Error("Failed to create temp file for zip", zap.Error(err))
+		if _, ok := sources.providers[file.SmbRoot]; ok {
 			continue
 		}
-
-		err = h.smbService.DownloadFile(file.SmbRoot, file.Path, tempFile.Name())
+		provider, err := h.providers.Provider(ctx, file.SmbRoot)
 		if err != nil {
-			h.logger.Error("Failed to download file for zip", zap.String("path", file.Path), zap.Error(err))
-			tempFile.Close()
-			os.Remove(tempFile.Name())
-			continue
+			sources.Close()
+			return nil, fmt.Errorf("failed to connect to storage root %s: %w", file.SmbRoot, err)
 		}
+		sources.providers[file.SmbRoot] = provider
+		sources.staged[file.SmbRoot] = h.stagedProtocols[strings.ToLower(provider.Protocol())]
+	}
+	return sources, nil
+}
 
-		// Add to zip (sanitize path to prevent Zip Slip)
-		zipFile, err := zipWriter.Create(sanitizeArchivePath(file.Path))
-		if err != nil {
-			h.logger.Error("Failed to create zip entry", zap.String("path", file.Path), zap.Error(err))
-			tempFile.Close()
-			os.Remove(tempFile.Name())
-			continue
+// Staging reports whether any file of the archive is staged on disk
+func (s *archiveSources) Staging() bool {
+	for _, staged := range s.staged {
+		if staged {
+			return true
 		}
+	}
+	return false
+}
 
-		tempFile.Seek(0, 0)
-		_, err = io.Copy(zipFile, tempFile)
-		tempFile.Close()
-		os.Remove(tempFile.Name())
+func (s *archiveSources) Close() {
+	for _, provider := range s.providers {
+		provider.Close()
+	}
+}
 
-		if err != nil {
-			h.logger.Error("Failed to write zip entry", zap.String("path", file.Path), zap.Error(err))
-			continue
-		}
+// archiveFile is the content of a file being added to an archive
+type archiveFile struct {
+	io.ReadCloser
+	// size is the current size of the file, when it was asked for
+	size int64
+}
+
+// open opens a file for an archive, streaming it from storage or staging it
+// on disk first. With sized set it also looks up the file's current size,
+// falling back to the catalogued size.
+func (s *archiveSources) open(ctx context.Context, file models.FileInfo, sized bool) (*archiveFile, error) {
+	provider, ok := s.providers[file.SmbRoot]
+	if !ok {
+		return nil, fmt.Errorf("storage root %s is not connected", file.SmbRoot)
+	}
+	if s.staged[file.SmbRoot] {
+		return s.stage(ctx, provider, file)
 	}
 
-	return nil
+	size := file.Size
+	if sized {
+		if info, err := provider.Stat(ctx, file.Path); err == nil && info != nil {
+			size = info.Size
+		}
+	}
+	src, err := provider.Open(ctx, file.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{ReadCloser: src, size: size}, nil
 }
 
-func (h *DownloadHandler) createTarArchive(w io.Writer, files []models.FileInfo, compress bool) error {
-	var tarWriter *tar.Writer
+// stage copies a file to the temp dir and opens the copy, which is removed
+// on Close
+func (s *archiveSources) stage(ctx context.Context, provider services.StorageProvider, file models.FileInfo) (*archiveFile, error) {
+	tempFile, err := os.CreateTemp(s.handler.tempDir, "archive_*")
+	if err != nil {
+		return nil, err
+	}
+	staged := &stagedFile{tempFile}
 
-	if compress {
-		gzWriter := gzip.NewWriter(w)
-		defer gzWriter.Close()
-		tarWriter = tar.NewWriter(gzWriter)
-	} else {
-		tarWriter = tar.NewWriter(w)
+	src, err := provider.Open(ctx, file.Path)
+	if err == nil {
+		_, err = io.Copy(tempFile, src)
+		src.Close()
+	}
+	var size int64
+	if err == nil {
+		size, err = tempFile.Seek(0, io.SeekEnd)
+	}
+	if err == nil {
+		_, err = tempFile.Seek(0, io.SeekStart)
 	}
-	defer tarWriter.Close()
+	if err != nil {
+		staged.Close()
+		return nil, err
+	}
+	return &archiveFile{ReadCloser: staged, size: size}, nil
+}
+
+// stagedFile is a temp file removed when closed
+type stagedFile struct {
+	*os.File
+}
+
+func (f *stagedFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// createZipArchive writes files to w as a zip archive. A file that cannot
+// be opened is left out; a failure while a file is being written aborts
+// the archive without its central directory, so the truncated download
+// does not pass for a complete one.
+func (h *DownloadHandler) createZipArchive(ctx context.Context, w io.Writer, files []models.FileInfo, sources *archiveSources) error {
+	zipWriter := zip.NewWriter(w)
+	buf := make([]byte, max(h.chunkSize, 32*1024))
 
 	for _, file := range files {
 		if file.IsDirectory {
 			continue // Skip directories for now
 		}
 
-		// Download file to temp location
-		tempFile, err := os.CreateTemp(h.tempDir, "tar_*")
+		src, err := sources.open(ctx, file, false)
 		if err != nil {
-			h.logger.Error("Failed to create temp file for tar", zap.Error(err))
+			h.logger.Error("Failed to open file for zip", zap.String("path", file.Path), zap.Error(err))
 			continue
 		}
 
-		err = h.smbService.DownloadFile(file.SmbRoot, file.Path, tempFile.Name())
+		// Add to zip (sanitize path to prevent Zip Slip)
+		zipFile, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     sanitizeArchivePath(file.Path),
+			Method:   zip.Deflate,
+			Modified: file.LastModified,
+		})
+		if err == nil {
+			_, err = io.CopyBuffer(zipFile, src, buf)
+		}
+		src.Close()
 		if err != nil {
-			h.logger.Error("Failed to download file for tar", zap.String("path", file.Path), zap.Error(err))
-			tempFile.Close()
-			os.Remove(tempFile.Name())
-			continue
+			return fmt.Errorf("failed to write zip entry %s: %w", file.Path, err)
 		}
+	}
 
-		// Create tar header (sanitize path to prevent Tar Slip)
-		header := &tar.Header{
-			Name:    sanitizeArchivePath(file.Path),
-			Size:    file.Size,
-			Mode:    0644,
-			ModTime: file.LastModified,
+	return zipWriter.Close()
+}
+
+// createTarArchive writes files to w as a tar archive, gzipped when
+// compress is set. Entries have the size of the file when it is opened; a
+// file that changes size while being written aborts the archive, as does
+// any other failure once its header is written.
+func (h *DownloadHandler) createTarArchive(ctx context.Context, w io.Writer, files []models.FileInfo, sources *archiveSources, compress bool) error {
+	var gzWriter *gzip.Writer
+	if compress {
+		gzWriter = gzip.NewWriter(w)
+		w = gzWriter
+	}
+	tarWriter := tar.NewWriter(w)
+	buf := make([]byte, max(h.chunkSize, 32*1024))
+
+	for _, file := range files {
+		if file.IsDirectory {
+			continue // Skip directories for now
 		}
 
-		err = tarWriter.WriteHeader(header)
+		src, err := sources.open(ctx, file, true)
 		if err != nil {
-			h.logger.Error("Failed to write tar header", zap.String("path", file.Path), zap.Error(err))
-			tempFile.Close()
-			os.Remove(tempFile.Name())
+			h.logger.Error("Failed to open file for tar", zap.String("path", file.Path), zap.Error(err))
 			continue
 		}
 
-		tempFile.Seek(0, 0)
-		_, err = io.Copy(tarWriter, tempFile)
-		tempFile.Close()
-		os.Remove(tempFile.Name())
-
+		// Create tar header (sanitize path to prevent Tar Slip)
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:    sanitizeArchivePath(file.Path),
+			Size:    src.size,
+			Mode:    0644,
+			ModTime: file.LastModified,
+		})
+		if err == nil {
+			var n int64
+			n, err = io.CopyBuffer(tarWriter, io.LimitReader(src, src.size), buf)
+			if err == nil && n < src.size {
+				err = fmt.Errorf("file shrank from %d to %d bytes while being archived", src.size, n)
+			}
+		}
+		src.Close()
 		if err != nil {
-			h.logger.Error("Failed to write tar entry", zap.String("path", file.Path), zap.Error(err))
-			continue
+			return fmt.Errorf("failed to write tar entry %s: %w", file.Path, err)
 		}
 	}
 
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if gzWriter != nil {
+		return gzWriter.Close()
+	}
 	return nil
 }
 
@@ -1,14 +1,27 @@
 package handlers
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"catalogizer/filesystem"
+	"catalogizer/internal/models"
+	"catalogizer/internal/services"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 )
@@ -41,7 +54,7 @@ func (suite *DownloadHandlerTestSuite) TestNewDownloadHandler() {
 	handler := NewDownloadHandler(nil, nil, "/tmp", 1024, 4096, suite.logger)
 	assert.NotNil(suite.T(), handler)
 	assert.Nil(suite.T(), handler.catalogService)
-	assert.Nil(suite.T(), handler.smbService)
+	assert.Nil(suite.T(), handler.providers)
 	assert.Equal(suite.T(), "/tmp", handler.tempDir)
 	assert.Equal(suite.T(), int64(1024), handler.maxArchiveSize)
 	assert.Equal(suite.T(), 4096, handler.chunkSize)
@@ -183,6 +196,222 @@ func (suite *DownloadHandlerTestSuite) TestDownloadArchive_EmptyBody() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 }
 
+// Encryption tests
+
+type fakeDownloadEncryptor struct {
+	keys map[string]*services.EncryptionKey
+}
+
+func (f *fakeDownloadEncryptor) ResolveKey(_ context.Context, userID int, ref string) (*services.EncryptionKey, error) {
+	if key, ok := f.keys[ref]; ok && key.UserID == userID {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key %s not found", ref)
+}
+
+func (f *fakeDownloadEncryptor) Encrypt(_ context.Context, _ *services.EncryptionKey, dst io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{dst}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (suite *DownloadHandlerTestSuite) TestDownloadDirectory_EncryptNotEnabled() {
+	req := httptest.NewRequest("GET", "/api/v1/download/directory/testpath?encrypt=default", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Encrypted downloads are not enabled")
+}
+
+func (suite *DownloadHandlerTestSuite) TestDownloadArchive_EncryptUnknownKey() {
+	suite.handler.SetEncryptor(&fakeDownloadEncryptor{keys: map[string]*services.EncryptionKey{
+		"default": {ID: 1, UserID: 7, Type: services.EncryptionKeyAge},
+	}})
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "8") })
+	router.POST("/api/v1/download/archive", suite.handler.DownloadArchive)
+
+	body := `{"paths": ["/test/path"], "format": "zip"}`
+	req := httptest.NewRequest("POST", "/api/v1/download/archive?encrypt=default", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code, "another user's key must not be usable")
+	assert.Contains(suite.T(), w.Body.String(), "Invalid encryption key")
+}
+
+func (suite *DownloadHandlerTestSuite) TestSendStream_EncryptedFilename() {
+	key := &services.EncryptionKey{ID: 1, UserID: 7, Type: services.EncryptionKeyGPG}
+	suite.handler.SetEncryptor(&fakeDownloadEncryptor{})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+
+	err := suite.handler.sendStream(c, key, "film.mkv", "application/octet-stream", 42, func(out io.Writer) error {
+		_, err := io.WriteString(out, "payload")
+		return err
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "payload", w.Body.String())
+	assert.Contains(suite.T(), w.Header().Get("Content-Disposition"), "film.mkv.gpg")
+	assert.Empty(suite.T(), w.Header().Get("Content-Length"), "ciphertext length is unknown")
+}
+
+// Archive tests
+
+type fakeArchiveProvider struct {
+	services.StorageProvider
+	protocol string
+	files    map[string]string
+	// sizes overrides the size Stat reports
+	sizes map[string]int64
+}
+
+func (p *fakeArchiveProvider) Protocol() string { return p.protocol }
+
+func (p *fakeArchiveProvider) Stat(_ context.Context, path string) (*filesystem.FileInfo, error) {
+	size, ok := p.sizes[path]
+	if !ok {
+		size = int64(len(p.files[path]))
+	}
+	return &filesystem.FileInfo{Name: path, Size: size}, nil
+}
+
+func (p *fakeArchiveProvider) Open(_ context.Context, path string) (io.ReadCloser, error) {
+	content, ok := p.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (p *fakeArchiveProvider) Close() error { return nil }
+
+type fakeArchiveProviders struct {
+	provider *fakeArchiveProvider
+}
+
+func (f fakeArchiveProviders) Provider(_ context.Context, storageRoot string) (services.StorageProvider, error) {
+	return f.provider, nil
+}
+
+func archiveTestFiles() []models.FileInfo {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []models.FileInfo{
+		{Path: "album", IsDirectory: true, SmbRoot: "nas"},
+		// Catalogued sizes may be stale; archives use the current size
+		{Path: "album/01.flac", Size: 1, SmbRoot: "nas", LastModified: modified},
+		{Path: "album/missing.flac", Size: 5, SmbRoot: "nas", LastModified: modified},
+		{Path: "album/cover.jpg", Size: 5, SmbRoot: "nas", LastModified: modified},
+	}
+}
+
+func readTarEntries(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[header.Name] = string(content)
+	}
+}
+
+func (suite *DownloadHandlerTestSuite) TestArchive_StreamsFromStorage() {
+	t := suite.T()
+	tempDir := t.TempDir()
+	handler := NewDownloadHandler(nil, fakeArchiveProviders{&fakeArchiveProvider{
+		protocol: "smb",
+		files:    map[string]string{"album/01.flac": "track one", "album/cover.jpg": "cover"},
+	}}, tempDir, 1, 4096, suite.logger)
+	ctx := context.Background()
+	want := map[string]string{"album/01.flac": "track one", "album/cover.jpg": "cover"}
+
+	sources, err := handler.openArchiveSources(ctx, archiveTestFiles())
+	require.NoError(t, err)
+	defer sources.Close()
+	assert.False(t, sources.Staging(), "archives stream unless the protocol is staged")
+
+	var zipped bytes.Buffer
+	require.NoError(t, handler.createZipArchive(ctx, &zipped, archiveTestFiles(), sources))
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Bytes()), int64(zipped.Len()))
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		got[f.Name] = string(content)
+	}
+	assert.Equal(t, want, got)
+
+	var tarred bytes.Buffer
+	require.NoError(t, handler.createTarArchive(ctx, &tarred, archiveTestFiles(), sources, true))
+	gz, err := gzip.NewReader(&tarred)
+	require.NoError(t, err)
+	assert.Equal(t, want, readTarEntries(t, gz))
+
+	staged, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, staged, "streamed archives must not use the temp dir")
+}
+
+func (suite *DownloadHandlerTestSuite) TestArchive_StagesConfiguredProtocols() {
+	t := suite.T()
+	tempDir := t.TempDir()
+	handler := NewDownloadHandler(nil, fakeArchiveProviders{&fakeArchiveProvider{
+		protocol: "ftp",
+		files:    map[string]string{"album/01.flac": "track one", "album/cover.jpg": "cover"},
+		// Stat is not consulted for staged files
+		sizes: map[string]int64{"album/01.flac": 100},
+	}}, tempDir, 1, 4096, suite.logger)
+	handler.SetStagedArchiveProtocols([]string{"FTP"})
+	ctx := context.Background()
+
+	sources, err := handler.openArchiveSources(ctx, archiveTestFiles())
+	require.NoError(t, err)
+	defer sources.Close()
+	assert.True(t, sources.Staging())
+
+	var tarred bytes.Buffer
+	require.NoError(t, handler.createTarArchive(ctx, &tarred, archiveTestFiles(), sources, false))
+	assert.Equal(t, map[string]string{"album/01.flac": "track one", "album/cover.jpg": "cover"}, readTarEntries(t, &tarred))
+
+	staged, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, staged, "staged copies are removed once archived")
+}
+
+func (suite *DownloadHandlerTestSuite) TestArchive_TarAbortsWhenFileShrinks() {
+	t := suite.T()
+	handler := NewDownloadHandler(nil, fakeArchiveProviders{&fakeArchiveProvider{
+		protocol: "smb",
+		files:    map[string]string{"album/01.flac": "track one"},
+		sizes:    map[string]int64{"album/01.flac": 100},
+	}}, t.TempDir(), 1, 4096, suite.logger)
+	ctx := context.Background()
+	files := archiveTestFiles()[:2]
+
+	sources, err := handler.openArchiveSources(ctx, files)
+	require.NoError(t, err)
+	defer sources.Close()
+
+	var tarred bytes.Buffer
+	err = handler.createTarArchive(ctx, &tarred, files, sources, false)
+	assert.ErrorContains(t, err, "shrank")
+}
+
 func TestDownloadHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(DownloadHandlerTestSuite))
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"catalogizer/filesystem"
 	"catalogizer/internal/services"
 	"net/http"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 type SMBDiscoveryHandler struct {
 	service *services.SMBDiscoveryService
 	logger  *zap.Logger
+	audit   services.AuditRecorder
 }
 
 // NewSMBDiscoveryHandler creates a new SMB discovery handler
@@ -23,6 +25,32 @@ func NewSMBDiscoveryHandler(service *services.SMBDiscoveryService, logger *zap.L
 	}
 }
 
+// SetAuditRecorder records every use of share credentials in the audit
+// log.
+func (h *SMBDiscoveryHandler) SetAuditRecorder(audit services.AuditRecorder) {
+	h.audit = audit
+}
+
+// recordCredentialUse records that the caller used credentials for an
+// SMB operation. The password is never recorded.
+func (h *SMBDiscoveryHandler) recordCredentialUse(c *gin.Context, operation, host, share, username string) {
+	if h.audit == nil {
+		return
+	}
+	userID, _ := strconv.Atoi(c.GetString("user_id"))
+	details := map[string]interface{}{"operation": operation, "host": host, "username": username}
+	if share != "" {
+		details["share"] = share
+	}
+	h.audit.Record(c.Request.Context(), services.AuditEntry{
+		UserID:    userID,
+		Action:    services.AuditEventShareCredentialsUsed,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
+
 // DiscoverSharesRequest represents the request to discover SMB shares
 type DiscoverSharesRequest struct {
 	Host     string  `json:"host" binding:"required"`
@@ -39,6 +67,10 @@ type TestConnectionRequest struct {
 	Username string  `json:"username" binding:"required"`
 	Password string  `json:"password" binding:"required"`
 	Domain   *string `json:"domain"`
+
+	// Dialect, require_signing and require_encryption, as configured on
+	// the share
+	filesystem.SmbProtocolOptions
 }
 
 // BrowseShareRequest represents the request to browse SMB share
@@ -50,6 +82,8 @@ type BrowseShareRequest struct {
 	Password string  `json:"password" binding:"required"`
 	Domain   *string `json:"domain"`
 	Path     string  `json:"path"`
+
+	filesystem.SmbProtocolOptions
 }
 
 // DiscoverShares discovers available SMB shares on a host
@@ -73,6 +107,7 @@ func (h *SMBDiscoveryHandler) DiscoverShares(c *gin.Context) {
 
 	h.logger.Info("Discovering SMB shares", zap.String("host", req.Host), zap.String("username", req.Username))
 
+	h.recordCredentialUse(c, "discover", req.Host, "", req.Username)
 	shares, err := h.service.DiscoverShares(c.Request.Context(), req.Host, req.Username, req.Password, req.Domain)
 	if err != nil {
 		h.logger.Error("Failed to discover SMB shares", zap.Error(err))
@@ -110,23 +145,42 @@ func (h *SMBDiscoveryHandler) TestConnection(c *gin.Context) {
 	h.logger.Info("Testing SMB connection", zap.String("host", req.Host), zap.String("share", req.Share))
 
 	config := services.SMBConnectionConfig{
-		Host:     req.Host,
-		Port:     req.Port,
-		Share:    req.Share,
-		Username: req.Username,
-		Password: req.Password,
-		Domain:   req.Domain,
+		Host:               req.Host,
+		Port:               req.Port,
+		Share:              req.Share,
+		Username:           req.Username,
+		Password:           req.Password,
+		Domain:             req.Domain,
+		SmbProtocolOptions: req.SmbProtocolOptions,
 	}
 
-	success := h.service.TestConnection(c.Request.Context(), config)
+	c.JSON(http.StatusOK, h.testConnectionResult(c, config))
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success":    success,
-		"host":       req.Host,
-		"share":      req.Share,
-		"username":   req.Username,
-		"connection": success,
-	})
+// testConnectionResult tests a connection and describes the outcome: the
+// negotiated dialect and server capabilities on success, the reason
+// otherwise
+func (h *SMBDiscoveryHandler) testConnectionResult(c *gin.Context, config services.SMBConnectionConfig) gin.H {
+	h.recordCredentialUse(c, "test", config.Host, config.Share, config.Username)
+	info, err := h.service.ProbeConnection(c.Request.Context(), config)
+	result := gin.H{
+		"success":    err == nil,
+		"host":       config.Host,
+		"share":      config.Share,
+		"username":   config.Username,
+		"connection": err == nil,
+	}
+	if err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+	result["dialect"] = info.Dialect
+	result["signing_required"] = info.SigningRequired
+	result["encryption_supported"] = info.EncryptionSupported
+	result["cipher"] = info.Cipher
+	result["dfs"] = info.DFS
+	result["capabilities"] = info.Capabilities
+	return result
 }
 
 // BrowseShare browses files and directories in an SMB share
@@ -161,14 +215,16 @@ func (h *SMBDiscoveryHandler) BrowseShare(c *gin.Context) {
 	h.logger.Info("Browsing SMB share", zap.String("host", req.Host), zap.String("share", req.Share), zap.String("path", req.Path))
 
 	config := services.SMBConnectionConfig{
-		Host:     req.Host,
-		Port:     req.Port,
-		Share:    req.Share,
-		Username: req.Username,
-		Password: req.Password,
-		Domain:   req.Domain,
+		Host:               req.Host,
+		Port:               req.Port,
+		Share:              req.Share,
+		Username:           req.Username,
+		Password:           req.Password,
+		Domain:             req.Domain,
+		SmbProtocolOptions: req.SmbProtocolOptions,
 	}
 
+	h.recordCredentialUse(c, "browse", req.Host, req.Share, req.Username)
 	entries, err := h.service.BrowseShare(c.Request.Context(), config, req.Path)
 	if err != nil {
 		h.logger.Error("Failed to browse SMB share", zap.Error(err))
@@ -208,6 +264,7 @@ func (h *SMBDiscoveryHandler) DiscoverSharesGET(c *gin.Context) {
 		domainPtr = &domain
 	}
 
+	h.recordCredentialUse(c, "discover", host, "", username)
 	shares, err := h.service.DiscoverShares(c.Request.Context(), host, username, password, domainPtr)
 	if err != nil {
 		h.logger.Error("Failed to discover SMB shares", zap.Error(err))
@@ -229,6 +286,9 @@ func (h *SMBDiscoveryHandler) DiscoverSharesGET(c *gin.Context) {
 // @Param password query string true "Password"
 // @Param domain query string false "Domain"
 // @Param port query int false "Port (default 445)"
+// @Param dialect query string false "SMB dialect to pin (2.0.2, 2.1, 3.0, 3.0.2, 3.1.1)"
+// @Param require_signing query bool false "Require message signing"
+// @Param require_encryption query bool false "Require a server that can encrypt"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
 // @Router /api/v1/smb/test [get]
@@ -264,15 +324,12 @@ func (h *SMBDiscoveryHandler) TestConnectionGET(c *gin.Context) {
 		Username: username,
 		Password: password,
 		Domain:   domainPtr,
+		SmbProtocolOptions: filesystem.SmbProtocolOptions{
+			Dialect:           c.Query("dialect"),
+			RequireSigning:    c.Query("require_signing") == "true",
+			RequireEncryption: c.Query("require_encryption") == "true",
+		},
 	}
 
-	success := h.service.TestConnection(c.Request.Context(), config)
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":    success,
-		"host":       host,
-		"share":      share,
-		"username":   username,
-		"connection": success,
-	})
+	c.JSON(http.StatusOK, h.testConnectionResult(c, config))
 }
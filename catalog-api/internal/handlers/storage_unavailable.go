@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"catalogizer/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondStorageUnavailable answers 503 when err comes from the open
+// circuit breaker of a storage root, with Retry-After set to the root's
+// next re-probe, and reports whether it did.
+func respondStorageUnavailable(c *gin.Context, err error) bool {
+	var unavailable *services.StorageUnavailableError
+	if !errors.As(err, &unavailable) {
+		return false
+	}
+	retry := int(time.Until(unavailable.RetryAt).Seconds()) + 1
+	if retry < 1 {
+		retry = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retry))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage temporarily unavailable", "details": err.Error()})
+	return true
+}
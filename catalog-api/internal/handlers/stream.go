@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"catalogizer/internal/models"
+	"catalogizer/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// hlsTranscoder transcodes a local media file into an HLS playlist and
+// segments in an output directory
+type hlsTranscoder interface {
+	TranscodeHLS(ctx context.Context, sourcePath, outputDir, baseURL string) error
+}
+
+// hlsPlaylistName matches the playlist written by the transcoder
+const hlsPlaylistName = "index.m3u8"
+
+// hlsSegmentPattern matches the segment names the transcoder writes, so
+// segment requests cannot reach other files in the cache
+var hlsSegmentPattern = regexp.MustCompile(`^segment_\d{5}\.ts$`)
+
+// streamContentTypes covers media types mime.TypeByExtension often lacks
+var streamContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".flv":  "video/x-flv",
+	".ts":   "video/mp2t",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/opus",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".wma":  "audio/x-ms-wma",
+}
+
+// streamContentType returns the Content-Type to stream a file with
+func streamContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ct, ok := streamContentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// hlsTranscodes tracks background HLS transcodes by file ID
+type hlsTranscodes struct {
+	transcoder hlsTranscoder
+	cacheDir   string
+
+	mu      sync.Mutex
+	running map[int64]bool
+	failed  map[int64]error
+}
+
+// SetHLSTranscoder enables the HLS endpoints, which transcode media into
+// cacheDir on first request
+func (h *DownloadHandler) SetHLSTranscoder(transcoder hlsTranscoder, cacheDir string) {
+	h.hls = &hlsTranscodes{
+		transcoder: transcoder,
+		cacheDir:   cacheDir,
+		running:    make(map[int64]bool),
+		failed:     make(map[int64]error),
+	}
+}
+
+// streamFileInfo resolves the :id parameter to a catalogued file. It
+// returns false after writing an error response.
+func (h *DownloadHandler) streamFileInfo(c *gin.Context) (int64, *models.FileInfo, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return 0, nil, false
+	}
+
+	fileInfo, err := h.catalogService.GetFileInfo(strconv.FormatInt(id, 10))
+	if err != nil {
+		h.logger.Error("Failed to get file info", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file information"})
+		return 0, nil, false
+	}
+	if fileInfo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return 0, nil, false
+	}
+	if fileInfo.IsDirectory {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot stream a directory"})
+		return 0, nil, false
+	}
+	return id, fileInfo, true
+}
+
+// localCopy returns a recalled or prefetched local copy of a file. It
+// returns handled=true when it wrote a response itself, such as starting
+// a recall for a cold file.
+func (h *DownloadHandler) localCopy(c *gin.Context, id int64, fileInfo *models.FileInfo) (path string, handled bool) {
+	if h.coldStorage != nil {
+		staged, cold, err := h.coldStorage.StagedFile(c.Request.Context(), id)
+		if err != nil {
+			h.logger.Error("Failed to check cold storage", zap.Int64("id", id), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file information"})
+			return "", true
+		}
+		if cold {
+			if staged == "" {
+				return "", h.serveColdFile(c, id, fileInfo, nil)
+			}
+			return staged, false
+		}
+	}
+	if h.prefetch != nil {
+		cached, ok, err := h.prefetch.CachedFile(c.Request.Context(), id)
+		if err != nil {
+			h.logger.Warn("Failed to check prefetch cache", zap.Int64("id", id), zap.Error(err))
+		} else if ok {
+			return cached, false
+		}
+	}
+	return "", false
+}
+
+// @Summary Stream a media file
+// @Description Stream a file for direct playback, honouring HTTP Range requests
+// @Tags stream
+// @Param id path int true "File ID"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Produce application/octet-stream
+// @Success 200 {file} binary
+// @Success 206 {file} binary "Requested byte range"
+// @Success 202 {object} map[string]interface{} "File is in cold storage and is being recalled"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 416 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/stream/{id} [get]
+func (h *DownloadHandler) StreamFile(c *gin.Context) {
+	id, fileInfo, ok := h.streamFileInfo(c)
+	if !ok {
+		return
+	}
+
+	local, handled := h.localCopy(c, id, fileInfo)
+	if handled {
+		return
+	}
+
+	var content io.ReadSeeker
+	if local != "" {
+		f, err := os.Open(local)
+		if err != nil {
+			h.logger.Error("Failed to open local copy", zap.Int64("id", id), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stream file"})
+			return
+		}
+		defer f.Close()
+		content = f
+	} else {
+		provider, err := h.providers.Provider(c.Request.Context(), fileInfo.SmbRoot)
+		if respondStorageUnavailable(c, err) {
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to connect to storage", zap.String("storage_root", fileInfo.SmbRoot), zap.Error(err))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect to storage"})
+			return
+		}
+		defer provider.Close()
+		reader := &providerReadSeeker{ctx: c.Request.Context(), provider: provider, path: fileInfo.Path, size: fileInfo.Size}
+		defer reader.Close()
+		content = reader
+	}
+
+	c.Header("Content-Type", streamContentType(fileInfo.Name))
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", sanitizeContentDisposition(fileInfo.Name)))
+	h.serveStream(c, fileInfo.Name, fileInfo.LastModified, content)
+
+	// Count a playback once, not once per range request
+	if rng := c.GetHeader("Range"); rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+		h.recordAccess(c, id)
+	}
+}
+
+// serveStream answers a possibly ranged request for content. A stream
+// can outlast the server's WriteTimeout, so the write deadline is lifted
+// for this response on transports that support it: HTTP/1.1 and HTTP/2
+// connections and HTTP/3 streams.
+func (h *DownloadHandler) serveStream(c *gin.Context, name string, modTime time.Time, content io.ReadSeeker) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.Debug("Failed to lift write deadline for stream", zap.String("proto", c.Request.Proto), zap.Error(err))
+	}
+	http.ServeContent(c.Writer, c.Request, name, modTime, content)
+}
+
+// @Summary HLS playlist for a media file
+// @Description Transcode a file the browser cannot play natively into HLS. The first request starts transcoding and answers 202 until the first segment is ready.
+// @Tags stream
+// @Param id path int true "File ID"
+// @Produce application/vnd.apple.mpegurl
+// @Success 200 {file} binary
+// @Success 202 {object} map[string]interface{} "Transcoding has started"
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 501 {object} map[string]string
+// @Router /api/v1/stream/{id}/hls [get]
+func (h *DownloadHandler) StreamHLSPlaylist(c *gin.Context) {
+	if h.hls == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "HLS streaming is not enabled"})
+		return
+	}
+	id, fileInfo, ok := h.streamFileInfo(c)
+	if !ok {
+		return
+	}
+
+	dir := h.hls.dir(id)
+	playlist := filepath.Join(dir, hlsPlaylistName)
+	if _, err := os.Stat(playlist); err == nil {
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Content-Type", "application/vnd.apple.mpegurl")
+		c.File(playlist)
+		return
+	}
+
+	h.hls.mu.Lock()
+	if err, failed := h.hls.failed[id]; failed {
+		// Report the failure once; the next request tries again
+		delete(h.hls.failed, id)
+		h.hls.mu.Unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transcode file", "details": err.Error()})
+		return
+	}
+	start := !h.hls.running[id]
+	h.hls.running[id] = true
+	h.hls.mu.Unlock()
+
+	if start {
+		local, handled := h.localCopy(c, id, fileInfo)
+		if handled {
+			h.hls.mu.Lock()
+			delete(h.hls.running, id)
+			h.hls.mu.Unlock()
+			return
+		}
+		go h.transcodeHLS(id, fileInfo, local, dir)
+	}
+
+	c.Header("Retry-After", "2")
+	c.JSON(http.StatusAccepted, gin.H{"status": "transcoding", "file_id": id})
+}
+
+// @Summary HLS segment for a media file
+// @Tags stream
+// @Param id path int true "File ID"
+// @Param segment path string true "Segment name from the playlist"
+// @Produce video/mp2t
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/stream/{id}/hls/{segment} [get]
+func (h *DownloadHandler) StreamHLSSegment(c *gin.Context) {
+	if h.hls == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "HLS streaming is not enabled"})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return
+	}
+	segment := c.Param("segment")
+	if !hlsSegmentPattern.MatchString(segment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment name"})
+		return
+	}
+
+	path := filepath.Join(h.hls.dir(id), segment)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Segment not found"})
+		return
+	}
+	c.Header("Content-Type", "video/mp2t")
+	c.Header("Cache-Control", "max-age=86400")
+	c.File(path)
+}
+
+func (t *hlsTranscodes) dir(id int64) string {
+	return filepath.Join(t.cacheDir, strconv.FormatInt(id, 10))
+}
+
+// transcodeHLS fetches a file into the cache unless a local copy exists
+// and transcodes it. Output of a failed transcode is removed.
+func (h *DownloadHandler) transcodeHLS(id int64, fileInfo *models.FileInfo, local, dir string) {
+	err := func() error {
+		ctx := context.Background()
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if local == "" {
+			source := filepath.Join(dir, "source"+filepath.Ext(fileInfo.Name))
+			f, err := os.Create(source)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(source)
+			err = h.fetchFile(ctx, fileInfo.SmbRoot, fileInfo.Path, f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("failed to fetch source: %w", err)
+			}
+			local = source
+		}
+		return h.hls.transcoder.TranscodeHLS(ctx, local, dir, "hls/")
+	}()
+
+	h.hls.mu.Lock()
+	defer h.hls.mu.Unlock()
+	delete(h.hls.running, id)
+	if err != nil {
+		h.logger.Error("HLS transcoding failed", zap.Int64("id", id), zap.Error(err))
+		os.RemoveAll(dir)
+		h.hls.failed[id] = err
+		return
+	}
+	h.logger.Info("HLS transcoding finished", zap.Int64("id", id), zap.String("file", fileInfo.Name))
+}
+
+// providerReadSeeker reads a storage file from any offset so range
+// requests work on every protocol. Providers only offer sequential
+// reads, so moving backwards reopens the file and moving forwards skips
+// ahead, unless the opened stream can seek itself.
+type providerReadSeeker struct {
+	ctx      context.Context
+	provider services.StorageProvider
+	path     string
+	size     int64
+
+	offset int64
+	rc     io.ReadCloser
+	pos    int64
+}
+
+func (r *providerReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *providerReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil || r.pos != r.offset {
+		if err := r.reposition(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	r.offset = r.pos
+	return n, err
+}
+
+// reposition moves the underlying stream to the read offset.
+func (r *providerReadSeeker) reposition() error {
+	if r.rc != nil {
+		if seeker, ok := r.rc.(io.Seeker); ok {
+			if _, err := seeker.Seek(r.offset, io.SeekStart); err == nil {
+				r.pos = r.offset
+				return nil
+			}
+		}
+		if r.offset < r.pos {
+			r.rc.Close()
+			r.rc = nil
+		}
+	}
+	if r.rc == nil {
+		rc, err := r.provider.Open(r.ctx, r.path)
+		if err != nil {
+			return err
+		}
+		r.rc, r.pos = rc, 0
+		if seeker, ok := rc.(io.Seeker); ok {
+			if _, err := seeker.Seek(r.offset, io.SeekStart); err == nil {
+				r.pos = r.offset
+				return nil
+			}
+		}
+	}
+	skipped, err := io.CopyN(io.Discard, r.rc, r.offset-r.pos)
+	r.pos += skipped
+	return err
+}
+
+// Close closes the open stream, if any.
+func (r *providerReadSeeker) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
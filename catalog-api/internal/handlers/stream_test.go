@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// sequentialProvider serves a file that can only be read from the start.
+type sequentialProvider struct {
+	services.StorageProvider
+	content string
+	opens   int
+}
+
+func (p *sequentialProvider) Open(_ context.Context, _ string) (io.ReadCloser, error) {
+	p.opens++
+	return io.NopCloser(strings.NewReader(p.content)), nil
+}
+
+func TestProviderReadSeeker_Ranges(t *testing.T) {
+	provider := &sequentialProvider{content: "0123456789abcdef"}
+	rs := &providerReadSeeker{ctx: context.Background(), provider: provider, path: "/f", size: 16}
+	defer rs.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Range", "bytes=10-13")
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeContent(w, req, "f.mp4", time.Time{}, rs)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "abcd", w.Body.String())
+	assert.Equal(t, "bytes 10-13/16", w.Header().Get("Content-Range"))
+
+	// Moving backwards reopens the file
+	_, err := rs.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(rs, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "234", string(buf))
+	assert.Equal(t, 2, provider.opens)
+
+	// Moving forwards skips ahead on the open stream
+	_, err = rs.Seek(-2, io.SeekEnd)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(rs)
+	require.NoError(t, err)
+	assert.Equal(t, "ef", string(rest))
+	assert.Equal(t, 2, provider.opens)
+}
+
+func TestStreamHLSSegment_RejectsBadNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewDownloadHandler(nil, nil, "/tmp", 0, 0, nil)
+	handler.SetHLSTranscoder(nil, t.TempDir())
+	router := gin.New()
+	router.GET("/stream/:id/hls/:segment", handler.StreamHLSSegment)
+
+	for path, code := range map[string]int{
+		"/stream/1/hls/segment_1.ts":     http.StatusBadRequest,
+		"/stream/1/hls/index.m3u8":       http.StatusBadRequest,
+		"/stream/x/hls/segment_00000.ts": http.StatusBadRequest,
+		"/stream/1/hls/segment_00000.ts": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, code, w.Code, path)
+	}
+}
+
+func TestStreamContentType(t *testing.T) {
+	assert.Equal(t, "video/mp4", streamContentType("movie.MP4"))
+	assert.Equal(t, "application/octet-stream", streamContentType("notes.unknown"))
+}
+
+// slowReadSeeker delivers content a couple of bytes at a time.
+type slowReadSeeker struct {
+	*strings.Reader
+	delay time.Duration
+}
+
+func (r *slowReadSeeker) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) > 2 {
+		p = p[:2]
+	}
+	return r.Reader.Read(p)
+}
+
+func TestServeStream_OutlivesWriteTimeoutOnEveryTransport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewDownloadHandler(nil, nil, "/tmp", 0, 0, zap.NewNop())
+	router := gin.New()
+	router.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "video/mp4")
+		content := &slowReadSeeker{Reader: strings.NewReader("0123456789abcdef"), delay: 40 * time.Millisecond}
+		handler.serveStream(c, "f.mp4", time.Time{}, content)
+	})
+
+	h2c := new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+
+	tests := []struct {
+		name  string
+		tls   bool
+		proto string
+	}{
+		{"http/1.1", false, "HTTP/1.1"},
+		{"h2", true, "HTTP/2.0"},
+		{"h2c", false, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(router)
+			server.Config.WriteTimeout = 50 * time.Millisecond
+			client := &http.Client{}
+			if tt.tls {
+				server.EnableHTTP2 = true
+				server.StartTLS()
+				client = server.Client()
+			} else {
+				if tt.name == "h2c" {
+					server.Config.Protocols = new(http.Protocols)
+					server.Config.Protocols.SetHTTP1(true)
+					server.Config.Protocols.SetUnencryptedHTTP2(true)
+					client.Transport = &http.Transport{Protocols: h2c}
+				}
+				server.Start()
+			}
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+			require.NoError(t, err)
+			req.Header.Set("Range", "bytes=4-11")
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.proto, resp.Proto)
+			assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+			assert.Equal(t, "bytes 4-11/16", resp.Header.Get("Content-Range"))
+			assert.Equal(t, "456789ab", string(body))
+		})
+	}
+}
@@ -192,6 +192,7 @@ type MediaCollection struct {
 	TotalItems     int                   `json:"total_items" db:"total_items"`
 	ExternalIDs    map[string]string     `json:"external_ids,omitempty" db:"external_ids"`
 	CoverURL       *string               `json:"cover_url,omitempty" db:"cover_url"`
+	UserID         *int64                `json:"user_id,omitempty" db:"user_id"` // creator, nil for collections made before owners were kept
 	CreatedAt      time.Time             `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time             `json:"updated_at" db:"updated_at"`
 	Items          []MediaCollectionItem `json:"items,omitempty"`
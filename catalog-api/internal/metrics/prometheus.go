@@ -157,6 +157,55 @@ var (
 		[]string{"root_id"},
 	)
 
+	StorageIOWaiting = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "catalogizer_storage_io_waiting",
+			Help: "Storage operations waiting for a slot by root and priority lane",
+		},
+		[]string{"root", "lane"}, // lane: "interactive", "transfer" or "background"
+	)
+
+	StorageIOLaneLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "catalogizer_storage_io_lane_limit",
+			Help: "Storage operations a priority lane may run at once by root",
+		},
+		[]string{"root", "lane"},
+	)
+
+	StorageIOInteractiveLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "catalogizer_storage_io_interactive_latency_seconds",
+			Help: "Moving average of interactive storage operation time by root",
+		},
+		[]string{"root"},
+	)
+
+	// Scan Metrics
+	ScanRowsWritten = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "catalogizer_scan_rows_written_total",
+			Help: "Catalog rows committed by scans by root",
+		},
+		[]string{"root"},
+	)
+
+	ScanWriteBatchDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "catalogizer_scan_write_batch_duration_seconds",
+			Help:    "Time to commit one batch of scan catalog writes in seconds",
+			Buckets: []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		},
+	)
+
+	ScanRowsPerSecond = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "catalogizer_scan_write_rows_per_second",
+			Help: "Rows per second of the latest scan catalog write batch by root",
+		},
+		[]string{"root"},
+	)
+
 	// Authentication Metrics
 	AuthAttemptsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -251,6 +300,29 @@ func UpdateStorageRoots(protocol, status string, count float64) {
 	StorageRootsTotal.WithLabelValues(protocol, status).Set(count)
 }
 
+// UpdateStorageIOLane updates the waiting operations and limit of a
+// storage IO priority lane
+func UpdateStorageIOLane(root, lane string, waiting, limit int) {
+	StorageIOWaiting.WithLabelValues(root, lane).Set(float64(waiting))
+	StorageIOLaneLimit.WithLabelValues(root, lane).Set(float64(limit))
+}
+
+// SetStorageIOLatency updates the interactive storage operation time of a
+// root
+func SetStorageIOLatency(root string, latency time.Duration) {
+	StorageIOInteractiveLatency.WithLabelValues(root).Set(latency.Seconds())
+}
+
+// RecordScanWriteBatch records a batch of catalog rows committed by a
+// scan of a root
+func RecordScanWriteBatch(root string, rows int, duration time.Duration) {
+	ScanRowsWritten.WithLabelValues(root).Add(float64(rows))
+	ScanWriteBatchDuration.Observe(duration.Seconds())
+	if duration > 0 {
+		ScanRowsPerSecond.WithLabelValues(root).Set(float64(rows) / duration.Seconds())
+	}
+}
+
 // UpdateActiveSessions updates the active sessions count
 func UpdateActiveSessions(count float64) {
 	ActiveSessions.Set(count)
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Protocol labels for the per-protocol HTTP metrics.
+const (
+	ProtocolHTTP1 = "http/1.1"
+	ProtocolHTTP2 = "h2"
+	ProtocolH2C   = "h2c"
+	ProtocolHTTP3 = "h3"
+)
+
+var (
+	// HTTPProtocolConnections tracks open HTTP connections by protocol.
+	HTTPProtocolConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "catalogizer",
+		Subsystem: "http",
+		Name:      "protocol_connections",
+		Help:      "Number of open HTTP connections by protocol.",
+	}, []string{"protocol"})
+
+	// HTTPProtocolConnectionsTotal counts accepted HTTP connections by protocol.
+	HTTPProtocolConnectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "catalogizer",
+		Subsystem: "http",
+		Name:      "protocol_connections_total",
+		Help:      "Total number of HTTP connections by protocol.",
+	}, []string{"protocol"})
+
+	// HTTPProtocolRequestsTotal counts HTTP requests by protocol.
+	HTTPProtocolRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "catalogizer",
+		Subsystem: "http",
+		Name:      "protocol_requests_total",
+		Help:      "Total number of HTTP requests by protocol.",
+	}, []string{"protocol"})
+)
+
+// RequestProtocol returns the protocol label for the transport a request
+// arrived over.
+func RequestProtocol(r *http.Request) string {
+	switch r.ProtoMajor {
+	case 3:
+		return ProtocolHTTP3
+	case 2:
+		if r.TLS == nil {
+			return ProtocolH2C
+		}
+		return ProtocolHTTP2
+	default:
+		return ProtocolHTTP1
+	}
+}
+
+type connContextKey struct{}
+
+// ConnectionTracker counts HTTP connections by protocol. A TCP connection
+// is labelled by the protocol of its first request, since ALPN and h2c
+// prior knowledge are only settled once a request arrives. Install
+// ConnContext and ConnState on each http.Server and wrap its handler with
+// Handler; QUIC connections are counted with TrackConnection.
+type ConnectionTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]string
+}
+
+// NewConnectionTracker creates a ConnectionTracker.
+func NewConnectionTracker() *ConnectionTracker {
+	return &ConnectionTracker{conns: make(map[net.Conn]string)}
+}
+
+// ConnContext is an http.Server ConnContext hook that lets Handler find
+// the connection a request belongs to.
+func (t *ConnectionTracker) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// ConnState is an http.Server ConnState hook.
+func (t *ConnectionTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		t.conns[c] = ""
+	case http.StateHijacked, http.StateClosed:
+		if protocol := t.conns[c]; protocol != "" {
+			HTTPProtocolConnections.WithLabelValues(protocol).Dec()
+		}
+		delete(t.conns, c)
+	}
+}
+
+// Handler counts each request by protocol and labels its connection on
+// the first request.
+func (t *ConnectionTracker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocol := RequestProtocol(r)
+		HTTPProtocolRequestsTotal.WithLabelValues(protocol).Inc()
+
+		if c, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+			t.mu.Lock()
+			if labelled, open := t.conns[c]; open && labelled == "" {
+				t.conns[c] = protocol
+				HTTPProtocolConnections.WithLabelValues(protocol).Inc()
+				HTTPProtocolConnectionsTotal.WithLabelValues(protocol).Inc()
+			}
+			t.mu.Unlock()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TrackConnection counts a connection that stays open until ctx is done,
+// for transports without ConnState such as HTTP/3 over QUIC.
+func (t *ConnectionTracker) TrackConnection(ctx context.Context, protocol string) {
+	HTTPProtocolConnections.WithLabelValues(protocol).Inc()
+	HTTPProtocolConnectionsTotal.WithLabelValues(protocol).Inc()
+	context.AfterFunc(ctx, func() {
+		HTTPProtocolConnections.WithLabelValues(protocol).Dec()
+	})
+}
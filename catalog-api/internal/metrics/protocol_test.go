@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestProtocol(t *testing.T) {
+	tests := []struct {
+		major int
+		tls   bool
+		want  string
+	}{
+		{1, false, ProtocolHTTP1},
+		{1, true, ProtocolHTTP1},
+		{2, true, ProtocolHTTP2},
+		{2, false, ProtocolH2C},
+		{3, true, ProtocolHTTP3},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.ProtoMajor = tt.major
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		assert.Equal(t, tt.want, RequestProtocol(r))
+	}
+}
+
+func TestConnectionTracker_CountsByProtocol(t *testing.T) {
+	tracker := NewConnectionTracker()
+	server := httptest.NewUnstartedServer(tracker.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})))
+	server.Config.ConnContext = tracker.ConnContext
+	server.Config.ConnState = tracker.ConnState
+	server.EnableHTTP2 = true
+	server.StartTLS()
+
+	open := HTTPProtocolConnections.WithLabelValues(ProtocolHTTP2)
+	total := HTTPProtocolConnectionsTotal.WithLabelValues(ProtocolHTTP2)
+	requests := HTTPProtocolRequestsTotal.WithLabelValues(ProtocolHTTP2)
+	openBefore, totalBefore, requestsBefore := getGaugeValue(open), getCounterValue(total), getCounterValue(requests)
+
+	client := server.Client()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+
+	// Requests multiplexed over one connection count it once
+	assert.Equal(t, openBefore+1, getGaugeValue(open))
+	assert.Equal(t, totalBefore+1, getCounterValue(total))
+	assert.Equal(t, requestsBefore+3, getCounterValue(requests))
+
+	server.Close()
+	assert.Eventually(t, func() bool { return getGaugeValue(open) == openBefore }, time.Second, 10*time.Millisecond)
+}
+
+func TestConnectionTracker_TrackConnection(t *testing.T) {
+	tracker := NewConnectionTracker()
+	open := HTTPProtocolConnections.WithLabelValues(ProtocolHTTP3)
+	before := getGaugeValue(open)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.TrackConnection(ctx, ProtocolHTTP3)
+	assert.Equal(t, before+1, getGaugeValue(open))
+
+	cancel()
+	assert.Eventually(t, func() bool { return getGaugeValue(open) == before }, time.Second, 10*time.Millisecond)
+}
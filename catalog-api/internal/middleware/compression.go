@@ -43,7 +43,9 @@ func DefaultCompressionConfig() CompressionConfig {
 		BrotliLevel:          CompressionLevelDefault,
 		GzipLevel:            CompressionLevelDefault,
 		ExcludedContentTypes: []string{"image/", "video/", "audio/", "application/octet-stream"},
-		ExcludedPaths:        []string{"/metrics"},
+		// Catalog exports are streamed, and buffering them here would
+		// hold the whole export in memory
+		ExcludedPaths: []string{"/metrics", "/api/v1/catalog/export"},
 	}
 }
 
@@ -643,13 +643,11 @@ func TestLyrics_GetLyricsDownloadInfo(t *testing.T) {
 	svc := newTestLyricsServiceUtil()
 	ctx := context.Background()
 
-	result, err := svc.getLyricsDownloadInfo(ctx, "test-result-id")
-	require.NoError(t, err)
-	require.NotNil(t, result)
-	assert.Equal(t, "test-result-id", result.ID)
-	assert.Equal(t, LyricsProviderGenius, result.Provider)
-	assert.Equal(t, "en", result.LanguageCode)
-	assert.InDelta(t, 0.85, result.MatchScore, 0.001)
+	// Result IDs name their provider; unknown providers are rejected
+	_, err := svc.getLyricsDownloadInfo(ctx, "genius_1")
+	assert.ErrorContains(t, err, "unsupported provider")
+	_, err = svc.getLyricsDownloadInfo(ctx, "lrclib_abc")
+	assert.ErrorContains(t, err, "invalid lrclib result ID")
 }
 
 func TestLyrics_PreserveLyricsTiming_EqualLines(t *testing.T) {
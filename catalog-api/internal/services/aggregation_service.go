@@ -28,6 +28,13 @@ type AggregationService struct {
 	fileRepo        *repository.MediaFileRepository
 	dirAnalysisRepo *repository.DirectoryAnalysisRepository
 	extMetaRepo     *repository.ExternalMetadataRepository
+	enricher        MediaEnricher
+}
+
+// MediaEnricher fills in metadata for media items created by a scan.
+// MetadataEnrichmentService implements it.
+type MediaEnricher interface {
+	EnrichItems(ctx context.Context, mediaItemIDs []int64)
 }
 
 // NewAggregationService creates a new aggregation service.
@@ -49,6 +56,11 @@ func NewAggregationService(
 	}
 }
 
+// SetEnricher sets the enricher run for the media items each scan creates.
+func (s *AggregationService) SetEnricher(enricher MediaEnricher) {
+	s.enricher = enricher
+}
+
 // AggregateAfterScan runs after a scan completes to create entities from files.
 func (s *AggregationService) AggregateAfterScan(ctx context.Context, storageRootID int64) error {
 	s.logger.Info("Starting post-scan aggregation", zap.Int64("storage_root_id", storageRootID))
@@ -64,8 +76,9 @@ func (s *AggregationService) AggregateAfterScan(ctx context.Context, storageRoot
 		zap.Int64("storage_root_id", storageRootID))
 
 	created, updated := 0, 0
+	var createdIDs []int64
 	for _, dir := range dirs {
-		isNew, err := s.processDirectory(ctx, dir, storageRootID)
+		itemID, isNew, err := s.processDirectory(ctx, dir, storageRootID)
 		if err != nil {
 			s.logger.Warn("Failed to process directory",
 				zap.String("path", dir.path),
@@ -74,6 +87,7 @@ func (s *AggregationService) AggregateAfterScan(ctx context.Context, storageRoot
 		}
 		if isNew {
 			created++
+			createdIDs = append(createdIDs, itemID)
 		} else {
 			updated++
 		}
@@ -84,6 +98,10 @@ func (s *AggregationService) AggregateAfterScan(ctx context.Context, storageRoot
 		zap.Int("entities_created", created),
 		zap.Int("entities_updated", updated))
 
+	if s.enricher != nil && len(createdIDs) > 0 {
+		s.enricher.EnrichItems(ctx, createdIDs)
+	}
+
 	return nil
 }
 
@@ -93,6 +111,7 @@ type directoryInfo struct {
 	fileCount  int
 	totalSize  int64
 	fileIDs    []int64
+	fileNames  []string
 	fileTypes  map[string]int
 	extensions []string
 }
@@ -119,8 +138,9 @@ func (s *AggregationService) getTopLevelDirectories(ctx context.Context, storage
 		}
 
 		// Get child files for this directory
-		childQuery := `SELECT id, extension, size FROM files
-			WHERE storage_root_id = ? AND parent_id = ? AND is_directory = 0 AND deleted = 0`
+		childQuery := `SELECT id, name, extension, size FROM files
+			WHERE storage_root_id = ? AND parent_id = ? AND is_directory = 0 AND deleted = 0
+			ORDER BY name`
 
 		childRows, err := s.db.QueryContext(ctx, childQuery, storageRootID, id)
 		if err != nil {
@@ -132,11 +152,13 @@ func (s *AggregationService) getTopLevelDirectories(ctx context.Context, storage
 			defer childRows.Close()
 			for childRows.Next() {
 				var fileID, size int64
+				var name string
 				var ext *string
-				if err := childRows.Scan(&fileID, &ext, &size); err != nil {
+				if err := childRows.Scan(&fileID, &name, &ext, &size); err != nil {
 					continue
 				}
 				dir.fileIDs = append(dir.fileIDs, fileID)
+				dir.fileNames = append(dir.fileNames, name)
 				dir.totalSize += size
 				dir.fileCount++
 				if ext != nil {
@@ -155,24 +177,32 @@ func (s *AggregationService) getTopLevelDirectories(ctx context.Context, storage
 }
 
 // processDirectory analyzes a directory and creates/updates a media entity.
-// Returns true if a new entity was created.
-func (s *AggregationService) processDirectory(ctx context.Context, dir directoryInfo, storageRootID int64) (bool, error) {
+// Returns the entity's ID and true if a new entity was created.
+func (s *AggregationService) processDirectory(ctx context.Context, dir directoryInfo, storageRootID int64) (int64, bool, error) {
 	// Detect media type from directory name and file types
 	mediaTypeName, parsed := s.detectMediaType(dir)
 	if mediaTypeName == "" {
-		return false, nil // Couldn't determine type
+		return 0, false, nil // Couldn't determine type
 	}
 
 	// Get media type ID
 	_, typeID, err := s.itemRepo.GetMediaTypeByName(ctx, mediaTypeName)
 	if err != nil {
-		return false, fmt.Errorf("get media type %q: %w", mediaTypeName, err)
+		return 0, false, fmt.Errorf("get media type %q: %w", mediaTypeName, err)
+	}
+
+	// Copies of a movie in other editions or resolutions, such as
+	// "Movie (1999) Extended 2160p", group under the movie itself
+	if mediaTypeName == "movie" {
+		if base := StripEdition(dir.name); base != dir.name {
+			parsed.Title = ParseMovieTitle(base).Title
+		}
 	}
 
 	// Check if entity already exists
 	existing, err := s.itemRepo.GetByTitle(ctx, parsed.Title, typeID)
 	if err != nil {
-		return false, err
+		return 0, false, err
 	}
 
 	var itemID int64
@@ -195,14 +225,21 @@ func (s *AggregationService) processDirectory(ctx context.Context, dir directory
 		}
 		itemID, err = s.itemRepo.Create(ctx, item)
 		if err != nil {
-			return false, fmt.Errorf("create media item: %w", err)
+			return 0, false, fmt.Errorf("create media item: %w", err)
 		}
 		isNew = true
 	}
 
-	// Link files to entity
+	// Link files to entity. Files split into parts, such as CD1 and CD2,
+	// are numbered so playback and watch state follow them in order.
+	var parts map[int]int
+	if mediaTypeName != "tv_show" {
+		parts = partNumbers(dir.fileNames)
+	}
 	for i, fileID := range dir.fileIDs {
-		isPrimary := i == 0 // First file is primary
+		// First file is primary, unless the entity already has files
+		// from another copy
+		isPrimary := i == 0 && existing == nil
 		_, err := s.fileRepo.LinkFileToItem(ctx, itemID, fileID, nil, nil, isPrimary)
 		if err != nil {
 			s.logger.Warn("Failed to link file to entity",
@@ -210,6 +247,12 @@ func (s *AggregationService) processDirectory(ctx context.Context, dir directory
 				zap.Int64("media_item_id", itemID),
 				zap.Error(err))
 		}
+		if part, ok := parts[i]; ok {
+			s.setLayout(ctx, itemID, fileID, repository.MediaFileLayout{PartNumber: &part})
+		}
+		if mediaTypeName == "movie" && i < len(dir.fileNames) {
+			s.setEdition(ctx, itemID, fileID, dir.name, dir.fileNames[i])
+		}
 	}
 
 	// Store directory analysis
@@ -239,11 +282,14 @@ func (s *AggregationService) processDirectory(ctx context.Context, dir directory
 	}
 
 	// Build hierarchy for TV shows
-	if mediaTypeName == "tv_show" && parsed.Season != nil {
-		s.buildTVHierarchy(ctx, itemID, typeID, parsed)
+	if mediaTypeName == "tv_show" {
+		if parsed.Season != nil {
+			s.buildTVHierarchy(ctx, itemID, typeID, parsed)
+		}
+		s.linkEpisodeFiles(ctx, itemID, dir)
 	}
 
-	return isNew, nil
+	return itemID, isNew, nil
 }
 
 // detectMediaType determines the media type from directory info and filename.
@@ -342,54 +388,186 @@ func (s *AggregationService) detectMediaType(dir directoryInfo) (string, ParsedT
 
 // buildTVHierarchy creates season and episode entities under a TV show.
 func (s *AggregationService) buildTVHierarchy(ctx context.Context, showID, showTypeID int64, parsed ParsedTitle) {
-	// Get season type
-	_, seasonTypeID, err := s.itemRepo.GetMediaTypeByName(ctx, "tv_season")
+	if parsed.Season == nil {
+		return
+	}
+	seasonID, err := s.ensureSeason(ctx, showID, *parsed.Season)
 	if err != nil {
 		return
 	}
 
-	if parsed.Season != nil {
-		seasonTitle := fmt.Sprintf("Season %d", *parsed.Season)
-		existingSeason, _ := s.itemRepo.GetByTitle(ctx, seasonTitle, seasonTypeID)
+	// Create episode if we have one
+	if parsed.Episode != nil {
+		_, _ = s.ensureEpisode(ctx, seasonID, *parsed.Season, *parsed.Episode)
+	}
+}
+
+// linkEpisodeFiles links each video file of a TV show directory to the
+// episodes its name holds, creating them as needed. A file holding
+// several episodes is linked to each of them as one of its segments, and
+// files that are parts of one episode are numbered in order.
+func (s *AggregationService) linkEpisodeFiles(ctx context.Context, showID int64, dir directoryInfo) {
+	type episodeFiles struct {
+		season   int
+		episodes []int
+		indexes  []int
+	}
+	var groups []*episodeFiles
+	byKey := make(map[string]*episodeFiles)
+	for i, name := range dir.fileNames {
+		if DetectMediaTypeFromPath(name) != "video" {
+			continue
+		}
+		season, episodes, ok := ParseEpisodeSpan(name)
+		if !ok {
+			continue
+		}
+		key := fmt.Sprint(season, episodes)
+		group := byKey[key]
+		if group == nil {
+			group = &episodeFiles{season: season, episodes: episodes}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.indexes = append(group.indexes, i)
+	}
 
-		var seasonID int64
-		if existingSeason != nil && existingSeason.ParentID != nil && *existingSeason.ParentID == showID {
-			seasonID = existingSeason.ID
-		} else {
-			season := &models.MediaItem{
-				MediaTypeID:  seasonTypeID,
-				Title:        seasonTitle,
-				Status:       "detected",
-				ParentID:     &showID,
-				SeasonNumber: parsed.Season,
-			}
-			seasonID, err = s.itemRepo.Create(ctx, season)
-			if err != nil {
-				return
-			}
+	for _, group := range groups {
+		seasonID, err := s.ensureSeason(ctx, showID, group.season)
+		if err != nil {
+			s.logger.Warn("Failed to create season",
+				zap.Int64("media_item_id", showID), zap.Int("season", group.season), zap.Error(err))
+			continue
 		}
+		names := make([]string, len(group.indexes))
+		for j, i := range group.indexes {
+			names[j] = dir.fileNames[i]
+		}
+		parts := partNumbers(names)
 
-		// Create episode if we have one
-		if parsed.Episode != nil {
-			_, epTypeID, err := s.itemRepo.GetMediaTypeByName(ctx, "tv_episode")
+		for k, episode := range group.episodes {
+			episodeID, err := s.ensureEpisode(ctx, seasonID, group.season, episode)
 			if err != nil {
-				return
+				s.logger.Warn("Failed to create episode",
+					zap.Int64("media_item_id", seasonID), zap.Int("episode", episode), zap.Error(err))
+				continue
 			}
+			for j, i := range group.indexes {
+				fileID := dir.fileIDs[i]
+				if _, err := s.fileRepo.LinkFileToItem(ctx, episodeID, fileID, nil, nil, j == 0); err != nil {
+					s.logger.Warn("Failed to link file to episode",
+						zap.Int64("file_id", fileID),
+						zap.Int64("media_item_id", episodeID),
+						zap.Error(err))
+				}
 
-			epTitle := fmt.Sprintf("Episode %d", *parsed.Episode)
-			ep := &models.MediaItem{
-				MediaTypeID:   epTypeID,
-				Title:         epTitle,
-				Status:        "detected",
-				ParentID:      &seasonID,
-				SeasonNumber:  parsed.Season,
-				EpisodeNumber: parsed.Episode,
+				var layout repository.MediaFileLayout
+				if part, ok := parts[j]; ok {
+					layout.PartNumber = &part
+				}
+				if len(group.episodes) > 1 {
+					index, count := k+1, len(group.episodes)
+					layout.SegmentIndex, layout.SegmentCount = &index, &count
+				}
+				if layout != (repository.MediaFileLayout{}) {
+					s.setLayout(ctx, episodeID, fileID, layout)
+				}
 			}
-			_, _ = s.itemRepo.Create(ctx, ep)
 		}
 	}
 }
 
+// ensureSeason returns the season entity of a TV show, creating it if needed.
+func (s *AggregationService) ensureSeason(ctx context.Context, showID int64, season int) (int64, error) {
+	_, seasonTypeID, err := s.itemRepo.GetMediaTypeByName(ctx, "tv_season")
+	if err != nil {
+		return 0, err
+	}
+	children, err := s.itemRepo.GetChildren(ctx, showID)
+	if err != nil {
+		return 0, err
+	}
+	for _, child := range children {
+		if child.MediaTypeID == seasonTypeID && child.SeasonNumber != nil && *child.SeasonNumber == season {
+			return child.ID, nil
+		}
+	}
+	return s.itemRepo.Create(ctx, &models.MediaItem{
+		MediaTypeID:  seasonTypeID,
+		Title:        fmt.Sprintf("Season %d", season),
+		Status:       "detected",
+		ParentID:     &showID,
+		SeasonNumber: &season,
+	})
+}
+
+// ensureEpisode returns the episode entity of a season, creating it if needed.
+func (s *AggregationService) ensureEpisode(ctx context.Context, seasonID int64, season, episode int) (int64, error) {
+	_, epTypeID, err := s.itemRepo.GetMediaTypeByName(ctx, "tv_episode")
+	if err != nil {
+		return 0, err
+	}
+	children, err := s.itemRepo.GetChildren(ctx, seasonID)
+	if err != nil {
+		return 0, err
+	}
+	for _, child := range children {
+		if child.MediaTypeID == epTypeID && child.EpisodeNumber != nil && *child.EpisodeNumber == episode {
+			return child.ID, nil
+		}
+	}
+	return s.itemRepo.Create(ctx, &models.MediaItem{
+		MediaTypeID:   epTypeID,
+		Title:         fmt.Sprintf("Episode %d", episode),
+		Status:        "detected",
+		ParentID:      &seasonID,
+		SeasonNumber:  &season,
+		EpisodeNumber: &episode,
+	})
+}
+
+// setEdition records the edition and resolution of a movie's video file,
+// read from its name or else its directory's, logging failures.
+func (s *AggregationService) setEdition(ctx context.Context, itemID, fileID int64, dirName, fileName string) {
+	if DetectMediaTypeFromPath(fileName) != "video" {
+		return
+	}
+	edition, quality := ParseEdition(fileName)
+	dirEdition, dirQuality := ParseEdition(dirName)
+	if edition == "" {
+		edition = dirEdition
+	}
+	if quality == "" {
+		quality = dirQuality
+	}
+	if edition == "" && quality == "" {
+		return
+	}
+	var editionPtr, qualityPtr *string
+	if edition != "" {
+		editionPtr = &edition
+	}
+	if quality != "" {
+		qualityPtr = &quality
+	}
+	if err := s.fileRepo.SetEdition(ctx, itemID, fileID, editionPtr, qualityPtr); err != nil {
+		s.logger.Warn("Failed to set file edition",
+			zap.Int64("file_id", fileID),
+			zap.Int64("media_item_id", itemID),
+			zap.Error(err))
+	}
+}
+
+// setLayout records how a file maps onto an entity, logging failures.
+func (s *AggregationService) setLayout(ctx context.Context, itemID, fileID int64, layout repository.MediaFileLayout) {
+	if err := s.fileRepo.SetLayout(ctx, itemID, fileID, layout); err != nil {
+		s.logger.Warn("Failed to set file layout",
+			zap.Int64("file_id", fileID),
+			zap.Int64("media_item_id", itemID),
+			zap.Error(err))
+	}
+}
+
 // GetStorageRootName returns the storage root name for display.
 func (s *AggregationService) getStorageRootName(ctx context.Context, storageRootID int64) string {
 	var name string
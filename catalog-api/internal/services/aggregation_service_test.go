@@ -217,18 +217,20 @@ func TestAggregationService_GetTopLevelDirectories(t *testing.T) {
 			WillReturnRows(rows)
 
 		// Mock child files for first directory
-		childRows1 := sqlmock.NewRows([]string{"id", "extension", "size"}).
-			AddRow(101, ".mp4", 1024*1024).
-			AddRow(102, ".srt", 5000)
-		mock.ExpectQuery(`SELECT id, extension, size FROM files
-			WHERE storage_root_id = ? AND parent_id = ? AND is_directory = 0 AND deleted = 0`).
+		childRows1 := sqlmock.NewRows([]string{"id", "name", "extension", "size"}).
+			AddRow(101, "movie.mp4", ".mp4", 1024*1024).
+			AddRow(102, "movie.srt", ".srt", 5000)
+		mock.ExpectQuery(`SELECT id, name, extension, size FROM files
+			WHERE storage_root_id = ? AND parent_id = ? AND is_directory = 0 AND deleted = 0
+			ORDER BY name`).
 			WithArgs(storageRootID, 1).
 			WillReturnRows(childRows1)
 
 		// Mock child files for second directory (empty)
-		childRows2 := sqlmock.NewRows([]string{"id", "extension", "size"})
-		mock.ExpectQuery(`SELECT id, extension, size FROM files
-			WHERE storage_root_id = ? AND parent_id = ? AND is_directory = 0 AND deleted = 0`).
+		childRows2 := sqlmock.NewRows([]string{"id", "name", "extension", "size"})
+		mock.ExpectQuery(`SELECT id, name, extension, size FROM files
+			WHERE storage_root_id = ? AND parent_id = ? AND is_directory = 0 AND deleted = 0
+			ORDER BY name`).
 			WithArgs(storageRootID, 2).
 			WillReturnRows(childRows2)
 
@@ -243,6 +245,7 @@ func TestAggregationService_GetTopLevelDirectories(t *testing.T) {
 		assert.Equal(t, 2, dirs[0].fileCount)
 		assert.Equal(t, int64(1024*1024+5000), dirs[0].totalSize)
 		assert.Len(t, dirs[0].fileIDs, 2)
+		assert.Equal(t, []string{"movie.mp4", "movie.srt"}, dirs[0].fileNames)
 		assert.Equal(t, map[string]int{".mp4": 1, ".srt": 1}, dirs[0].fileTypes)
 		assert.ElementsMatch(t, []string{".mp4", ".srt"}, dirs[0].extensions)
 	})
@@ -351,9 +354,10 @@ func TestAggregationService_ProcessDirectory(t *testing.T) {
 			WithArgs("/movies/The Matrix (1999)", "", 100, 0.8, "title_parser", "null", sqlmock.AnyArg(), 2, int64(1500000000)).
 			WillReturnResult(sqlmock.NewResult(200, 1))
 
-		isNew, err := service.processDirectory(ctx, dir, storageRootID)
+		itemID, isNew, err := service.processDirectory(ctx, dir, storageRootID)
 		require.NoError(t, err)
 		assert.True(t, isNew)
+		assert.Equal(t, int64(100), itemID)
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
 }
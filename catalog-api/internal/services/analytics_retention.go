@@ -0,0 +1,621 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// analyticsRetentionTable describes an analytics table that is rolled up
+// by hour: the column holding the row's time, the column rollups are
+// grouped by, and the columns of playback seconds and media item, if any.
+type analyticsRetentionTable struct {
+	timeColumn      string
+	dimensionColumn string
+	durationColumn  string
+	mediaColumn     string
+}
+
+// analyticsRetentionTables maps the tables retention policies apply to.
+var analyticsRetentionTables = map[string]analyticsRetentionTable{
+	"analytics_events": {timeColumn: "timestamp", dimensionColumn: "event_type"},
+	"link_events":      {timeColumn: "occurred_at", dimensionColumn: "event_type"},
+	"media_access_logs": {timeColumn: "access_time", dimensionColumn: "action", durationColumn: "playback_duration",
+		mediaColumn: "media_id"},
+}
+
+// analyticsRollupChunk is how much raw history one rollup query reads, so
+// the first run over a large table does not load it whole.
+const analyticsRollupChunk = 7 * 24 * time.Hour
+
+// analyticsRollupLookback is how far before the last rollup each run
+// looks again, so events reported late still reach their hour.
+const analyticsRollupLookback = 24 * time.Hour
+
+// AnalyticsRetentionTables returns the tables retention policies apply
+// to, sorted.
+func AnalyticsRetentionTables() []string {
+	tables := make([]string, 0, len(analyticsRetentionTables))
+	for table := range analyticsRetentionTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// AnalyticsRetentionPolicy says how long the raw rows and hourly rollups
+// of one table are kept; zero keeps them forever. RolledUpUntil is the
+// end of the last hour aggregated.
+type AnalyticsRetentionPolicy struct {
+	Table                 string     `json:"table"`
+	RawRetentionDays      int        `json:"raw_retention_days"`
+	RollupRetentionMonths int        `json:"rollup_retention_months"`
+	RolledUpUntil         *time.Time `json:"rolled_up_until,omitempty"`
+	LastRunAt             *time.Time `json:"last_run_at,omitempty"`
+	LastRunError          string     `json:"last_run_error,omitempty"`
+}
+
+// AnalyticsRetentionPolicyRequest changes a policy; nil fields are kept.
+type AnalyticsRetentionPolicyRequest struct {
+	RawRetentionDays      *int `json:"raw_retention_days"`
+	RollupRetentionMonths *int `json:"rollup_retention_months"`
+}
+
+// AnalyticsTableStats describes the size and growth of one table.
+// DailyRows averages the last seven days. ProjectedRows30d is the row
+// count expected in 30 days, once the retention policy has trimmed the
+// table. Sizes are reported when the database can measure them.
+type AnalyticsTableStats struct {
+	Table             string                   `json:"table"`
+	Rows              int64                    `json:"rows"`
+	RollupRows        int64                    `json:"rollup_rows"`
+	SizeBytes         *int64                   `json:"size_bytes,omitempty"`
+	OldestAt          *time.Time               `json:"oldest_at,omitempty"`
+	NewestAt          *time.Time               `json:"newest_at,omitempty"`
+	DailyRows         float64                  `json:"daily_rows"`
+	ProjectedRows30d  int64                    `json:"projected_rows_30d"`
+	ProjectedBytes30d *int64                   `json:"projected_bytes_30d,omitempty"`
+	Policy            AnalyticsRetentionPolicy `json:"policy"`
+}
+
+// AnalyticsRetentionResult reports one run over one table.
+type AnalyticsRetentionResult struct {
+	Table         string `json:"table"`
+	RolledUpHours int    `json:"rolled_up_hours"`
+	PurgedRows    int64  `json:"purged_rows"`
+	PurgedRollups int64  `json:"purged_rollups"`
+	Error         string `json:"error,omitempty"`
+}
+
+// AnalyticsRetentionConfig controls how often rollups and purges run.
+type AnalyticsRetentionConfig struct {
+	Interval time.Duration
+}
+
+// AnalyticsRetentionService rolls analytics events, deep link events and
+// media access logs up into hourly counts, active users and plays per media item, which the
+// analytics dashboard reads instead of raw rows, and snapshots storage
+// usage daily. It purges raw rows and rollups past the retention period
+// of their table. Raw rows are only purged once their hour has been
+// rolled up.
+type AnalyticsRetentionService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config AnalyticsRetentionConfig
+	mu     sync.Mutex
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	now    func() time.Time
+}
+
+// NewAnalyticsRetentionService creates an AnalyticsRetentionService that
+// runs hourly unless cfg says otherwise.
+func NewAnalyticsRetentionService(db *database.DB, logger *zap.Logger, cfg AnalyticsRetentionConfig) *AnalyticsRetentionService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	return &AnalyticsRetentionService{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+func lookupAnalyticsRetentionTable(table string) (analyticsRetentionTable, error) {
+	t, ok := analyticsRetentionTables[table]
+	if !ok {
+		return t, fmt.Errorf("invalid analytics table: %s", table)
+	}
+	return t, nil
+}
+
+// policy returns the policy of a table, creating the default one, which
+// keeps everything, on first use.
+func (s *AnalyticsRetentionService) policy(ctx context.Context, table string) (*AnalyticsRetentionPolicy, error) {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO analytics_retention_policies (table_name, updated_at) VALUES (?, ?)`,
+		table, s.now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to create retention policy for %s: %w", table, err)
+	}
+
+	policy := AnalyticsRetentionPolicy{Table: table}
+	var rolledUp, lastRun sql.NullTime
+	var lastError sql.NullString
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT raw_retention_days, rollup_retention_months, rolled_up_until, last_run_at, last_run_error
+		 FROM analytics_retention_policies WHERE table_name = ?`, table).Scan(
+		&policy.RawRetentionDays, &policy.RollupRetentionMonths, &rolledUp, &lastRun, &lastError); err != nil {
+		return nil, fmt.Errorf("failed to load retention policy for %s: %w", table, err)
+	}
+	if rolledUp.Valid {
+		policy.RolledUpUntil = &rolledUp.Time
+	}
+	if lastRun.Valid {
+		policy.LastRunAt = &lastRun.Time
+	}
+	policy.LastRunError = lastError.String
+	return &policy, nil
+}
+
+// ListPolicies returns the policy of every table.
+func (s *AnalyticsRetentionService) ListPolicies(ctx context.Context) ([]AnalyticsRetentionPolicy, error) {
+	policies := make([]AnalyticsRetentionPolicy, 0, len(analyticsRetentionTables))
+	for _, table := range AnalyticsRetentionTables() {
+		policy, err := s.policy(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *policy)
+	}
+	return policies, nil
+}
+
+// UpdatePolicy changes how long a table's raw rows and rollups are kept.
+// The new policy applies from the next run.
+func (s *AnalyticsRetentionService) UpdatePolicy(ctx context.Context, table string, req AnalyticsRetentionPolicyRequest) (*AnalyticsRetentionPolicy, error) {
+	if _, err := lookupAnalyticsRetentionTable(table); err != nil {
+		return nil, err
+	}
+	policy, err := s.policy(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if req.RawRetentionDays != nil {
+		policy.RawRetentionDays = *req.RawRetentionDays
+	}
+	if req.RollupRetentionMonths != nil {
+		policy.RollupRetentionMonths = *req.RollupRetentionMonths
+	}
+	if policy.RawRetentionDays < 0 || policy.RollupRetentionMonths < 0 {
+		return nil, fmt.Errorf("invalid retention policy: periods cannot be negative")
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE analytics_retention_policies SET raw_retention_days = ?, rollup_retention_months = ?, updated_at = ?
+		 WHERE table_name = ?`,
+		policy.RawRetentionDays, policy.RollupRetentionMonths, s.now().UTC(), table); err != nil {
+		return nil, fmt.Errorf("failed to update retention policy for %s: %w", table, err)
+	}
+	return policy, nil
+}
+
+// TableStats returns the size, growth and policy of every table.
+func (s *AnalyticsRetentionService) TableStats(ctx context.Context) ([]AnalyticsTableStats, error) {
+	now := s.now().UTC()
+	stats := make([]AnalyticsTableStats, 0, len(analyticsRetentionTables))
+	for _, table := range AnalyticsRetentionTables() {
+		t := analyticsRetentionTables[table]
+		policy, err := s.policy(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		st := AnalyticsTableStats{Table: table, Policy: *policy}
+
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&st.Rows); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		if st.OldestAt, err = s.edgeTime(ctx, table, t, "ASC"); err != nil {
+			return nil, err
+		}
+		if st.NewestAt, err = s.edgeTime(ctx, table, t, "DESC"); err != nil {
+			return nil, err
+		}
+		var recent int64
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM `+table+` WHERE `+t.timeColumn+` >= ?`, now.AddDate(0, 0, -7)).Scan(&recent); err != nil {
+			return nil, fmt.Errorf("failed to count recent %s: %w", table, err)
+		}
+		st.DailyRows = float64(recent) / 7
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM analytics_hourly_rollups WHERE source_table = ?`, table).Scan(&st.RollupRows); err != nil {
+			return nil, fmt.Errorf("failed to count rollups of %s: %w", table, err)
+		}
+
+		st.ProjectedRows30d = st.Rows + int64(st.DailyRows*30)
+		if policy.RawRetentionDays > 0 {
+			if steady := int64(st.DailyRows * float64(policy.RawRetentionDays)); steady < st.ProjectedRows30d {
+				st.ProjectedRows30d = steady
+			}
+		}
+		st.SizeBytes = s.tableSize(ctx, table)
+		if st.SizeBytes != nil && st.Rows > 0 {
+			projected := *st.SizeBytes * st.ProjectedRows30d / st.Rows
+			st.ProjectedBytes30d = &projected
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+// edgeTime returns the time of the oldest or newest row of a table.
+func (s *AnalyticsRetentionService) edgeTime(ctx context.Context, table string, t analyticsRetentionTable, order string) (*time.Time, error) {
+	var at time.Time
+	err := s.db.QueryRowContext(ctx,
+		`SELECT `+t.timeColumn+` FROM `+table+` WHERE `+t.timeColumn+` IS NOT NULL ORDER BY `+t.timeColumn+` `+order+` LIMIT 1`).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read time range of %s: %w", table, err)
+	}
+	return &at, nil
+}
+
+// tableSize returns the bytes a table takes on disk, or nil when the
+// database cannot tell: SQLite needs the dbstat virtual table.
+func (s *AnalyticsRetentionService) tableSize(ctx context.Context, table string) *int64 {
+	query := `SELECT SUM(pgsize) FROM dbstat WHERE name = '` + table + `'`
+	if s.db.Dialect().IsPostgres() {
+		query = `SELECT pg_total_relation_size('` + table + `')`
+	}
+	var size sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, query).Scan(&size); err != nil || !size.Valid {
+		return nil
+	}
+	return &size.Int64
+}
+
+// RunAll rolls up and purges every table and returns what was done. A
+// failure on one table is recorded on its policy and does not stop the
+// others.
+func (s *AnalyticsRetentionService) RunAll(ctx context.Context) []AnalyticsRetentionResult {
+	results := make([]AnalyticsRetentionResult, 0, len(analyticsRetentionTables))
+	for _, table := range AnalyticsRetentionTables() {
+		result := AnalyticsRetentionResult{Table: table}
+		err := s.run(ctx, table, &result)
+		var lastError *string
+		if err != nil {
+			result.Error = err.Error()
+			lastError = &result.Error
+			s.logger.Error("Analytics retention run failed", zap.String("table", table), zap.Error(err))
+		} else if result.PurgedRows > 0 || result.PurgedRollups > 0 {
+			s.logger.Info("Purged expired analytics data", zap.String("table", table),
+				zap.Int64("rows", result.PurgedRows), zap.Int64("rollups", result.PurgedRollups))
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE analytics_retention_policies SET last_run_at = ?, last_run_error = ? WHERE table_name = ?`,
+			s.now().UTC(), lastError, table); err != nil {
+			s.logger.Warn("Failed to record analytics retention run", zap.String("table", table), zap.Error(err))
+		}
+		results = append(results, result)
+	}
+	if err := s.snapshotStorage(ctx); err != nil {
+		s.logger.Warn("Failed to snapshot storage usage", zap.Error(err))
+	}
+	return results
+}
+
+// snapshotStorage records today's file count and size of every storage
+// root, replacing the snapshot of an earlier run the same day.
+func (s *AnalyticsRetentionService) snapshotStorage(ctx context.Context) error {
+	now := s.now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT storage_root_id, SUM(CASE WHEN is_directory THEN 0 ELSE 1 END), COALESCE(SUM(size), 0)
+		 FROM files WHERE deleted = ? GROUP BY storage_root_id`, false)
+	if err != nil {
+		return fmt.Errorf("failed to measure storage usage: %w", err)
+	}
+	type rootUsage struct {
+		rootID, files, bytes int64
+	}
+	var usage []rootUsage
+	for rows.Next() {
+		var u rootUsage
+		if err := rows.Scan(&u.rootID, &u.files, &u.bytes); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan storage usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to measure storage usage: %w", err)
+	}
+
+	for _, u := range usage {
+		// A snapshot taken again the same day replaces the earlier one
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE storage_daily_usage SET file_count = ?, total_bytes = ?, captured_at = ?
+			 WHERE day = ? AND storage_root_id = ?`,
+			u.files, u.bytes, now, day, u.rootID)
+		if err != nil {
+			return fmt.Errorf("failed to record storage usage: %w", err)
+		}
+		if updated, _ := result.RowsAffected(); updated > 0 {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO storage_daily_usage (day, storage_root_id, file_count, total_bytes, captured_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			day, u.rootID, u.files, u.bytes, now); err != nil {
+			return fmt.Errorf("failed to record storage usage: %w", err)
+		}
+	}
+	return nil
+}
+
+// run rolls up the complete hours of a table not yet aggregated, then
+// purges raw rows and rollups past their retention period.
+func (s *AnalyticsRetentionService) run(ctx context.Context, table string, result *AnalyticsRetentionResult) error {
+	t := analyticsRetentionTables[table]
+	policy, err := s.policy(ctx, table)
+	if err != nil {
+		return err
+	}
+	now := s.now().UTC()
+	end := now.Truncate(time.Hour)
+
+	// Raw rows older than this are purged, so hours before it cannot be
+	// aggregated again
+	var rawCutoff time.Time
+	if policy.RawRetentionDays > 0 {
+		rawCutoff = now.AddDate(0, 0, -policy.RawRetentionDays)
+	}
+
+	var start time.Time
+	if policy.RolledUpUntil != nil {
+		start = policy.RolledUpUntil.UTC().Add(-analyticsRollupLookback)
+		if floor := rawCutoff.Truncate(time.Hour).Add(time.Hour); !rawCutoff.IsZero() && start.Before(floor) {
+			start = floor
+		}
+	} else {
+		oldest, err := s.edgeTime(ctx, table, t, "ASC")
+		if err != nil {
+			return err
+		}
+		start = end
+		if oldest != nil {
+			start = oldest.UTC().Truncate(time.Hour)
+		}
+	}
+
+	for from := start; from.Before(end); from = from.Add(analyticsRollupChunk) {
+		to := from.Add(analyticsRollupChunk)
+		if to.After(end) {
+			to = end
+		}
+		hours, err := s.rollup(ctx, table, t, from, to)
+		if err != nil {
+			return err
+		}
+		result.RolledUpHours += hours
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE analytics_retention_policies SET rolled_up_until = ? WHERE table_name = ?`, to, table); err != nil {
+			return fmt.Errorf("failed to record rollup progress of %s: %w", table, err)
+		}
+	}
+	if policy.RolledUpUntil == nil || policy.RolledUpUntil.Before(end) {
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE analytics_retention_policies SET rolled_up_until = ? WHERE table_name = ?`, end, table); err != nil {
+			return fmt.Errorf("failed to record rollup progress of %s: %w", table, err)
+		}
+	}
+
+	if !rawCutoff.IsZero() {
+		if rawCutoff.After(end) {
+			rawCutoff = end
+		}
+		res, err := s.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+t.timeColumn+` < ?`, rawCutoff)
+		if err != nil {
+			return fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+		result.PurgedRows, _ = res.RowsAffected()
+	}
+	if policy.RollupRetentionMonths > 0 {
+		cutoff := now.AddDate(0, -policy.RollupRetentionMonths, 0)
+		res, err := s.db.ExecContext(ctx,
+			`DELETE FROM analytics_hourly_rollups WHERE source_table = ? AND bucket_start < ?`, table, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to purge rollups of %s: %w", table, err)
+		}
+		result.PurgedRollups, _ = res.RowsAffected()
+		if _, err := s.db.ExecContext(ctx,
+			`DELETE FROM analytics_hourly_users WHERE source_table = ? AND bucket_start < ?`, table, cutoff); err != nil {
+			return fmt.Errorf("failed to purge active users of %s: %w", table, err)
+		}
+		if t.mediaColumn != "" {
+			if _, err := s.db.ExecContext(ctx,
+				`DELETE FROM analytics_hourly_media WHERE bucket_start < ?`, cutoff); err != nil {
+				return fmt.Errorf("failed to purge media plays of %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// analyticsRollupKey identifies one rollup row.
+type analyticsRollupKey struct {
+	hour      time.Time
+	dimension string
+}
+
+// analyticsMediaKey identifies one row of plays per media item.
+type analyticsMediaKey struct {
+	hour    time.Time
+	mediaID int64
+}
+
+// analyticsRollup accumulates one rollup row.
+type analyticsRollup struct {
+	count    int64
+	users    map[int64]bool
+	duration int64
+}
+
+// rollup aggregates the raw rows of [from, to) by hour and dimension and
+// writes the counts, active users and plays per media item, replacing
+// earlier counts of the same hours. It returns the number of hours that
+// had rows.
+func (s *AnalyticsRetentionService) rollup(ctx context.Context, table string, t analyticsRetentionTable,
+	from, to time.Time) (int, error) {
+	duration, media := "0", "0"
+	if t.durationColumn != "" {
+		duration = "COALESCE(" + t.durationColumn + ", 0)"
+	}
+	if t.mediaColumn != "" {
+		media = t.mediaColumn
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+t.timeColumn+`, COALESCE(`+t.dimensionColumn+`, ''), user_id, `+duration+`, `+media+`
+		 FROM `+table+` WHERE `+t.timeColumn+` >= ? AND `+t.timeColumn+` < ?`, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s for rollup: %w", table, err)
+	}
+	buckets := make(map[analyticsRollupKey]*analyticsRollup)
+	plays := make(map[analyticsMediaKey]*analyticsRollup)
+	for rows.Next() {
+		var at time.Time
+		var dimension string
+		var userID sql.NullInt64
+		var seconds, mediaID int64
+		if err := rows.Scan(&at, &dimension, &userID, &seconds, &mediaID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan %s for rollup: %w", table, err)
+		}
+		key := analyticsRollupKey{hour: at.UTC().Truncate(time.Hour), dimension: dimension}
+		bucket := buckets[key]
+		if bucket == nil {
+			bucket = &analyticsRollup{users: make(map[int64]bool)}
+			buckets[key] = bucket
+		}
+		bucket.count++
+		bucket.duration += seconds
+		if userID.Valid && userID.Int64 > 0 {
+			bucket.users[userID.Int64] = true
+		}
+		if t.mediaColumn != "" {
+			mediaKey := analyticsMediaKey{hour: key.hour, mediaID: mediaID}
+			play := plays[mediaKey]
+			if play == nil {
+				play = &analyticsRollup{}
+				plays[mediaKey] = play
+			}
+			play.count++
+			play.duration += seconds
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s for rollup: %w", table, err)
+	}
+
+	hours := make(map[time.Time]bool)
+	for key, bucket := range buckets {
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE analytics_hourly_rollups SET event_count = ?, user_count = ?, total_duration = ?
+			 WHERE source_table = ? AND bucket_start = ? AND dimension = ?`,
+			bucket.count, len(bucket.users), bucket.duration, table, key.hour, key.dimension)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write rollup of %s: %w", table, err)
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			if _, err := s.db.ExecContext(ctx,
+				`INSERT INTO analytics_hourly_rollups (source_table, bucket_start, dimension, event_count, user_count, total_duration)
+				 VALUES (?, ?, ?, ?, ?, ?)`,
+				table, key.hour, key.dimension, bucket.count, len(bucket.users), bucket.duration); err != nil {
+				return 0, fmt.Errorf("failed to write rollup of %s: %w", table, err)
+			}
+		}
+		for userID := range bucket.users {
+			if _, err := s.db.ExecContext(ctx,
+				`INSERT OR IGNORE INTO analytics_hourly_users (bucket_start, source_table, dimension, user_id)
+				 VALUES (?, ?, ?, ?)`,
+				key.hour, table, key.dimension, userID); err != nil {
+				return 0, fmt.Errorf("failed to write active users of %s: %w", table, err)
+			}
+		}
+		hours[key.hour] = true
+	}
+	for key, play := range plays {
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE analytics_hourly_media SET access_count = ?, total_duration = ?
+			 WHERE bucket_start = ? AND media_id = ?`,
+			play.count, play.duration, key.hour, key.mediaID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write media plays of %s: %w", table, err)
+		}
+		if updated, _ := result.RowsAffected(); updated > 0 {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO analytics_hourly_media (bucket_start, media_id, access_count, total_duration)
+			 VALUES (?, ?, ?, ?)`,
+			key.hour, key.mediaID, play.count, play.duration); err != nil {
+			return 0, fmt.Errorf("failed to write media plays of %s: %w", table, err)
+		}
+	}
+	return len(hours), nil
+}
+
+// Start rolls up and purges on the configured interval until Stop is
+// called.
+func (s *AnalyticsRetentionService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunAll(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for a run in progress to finish.
+func (s *AnalyticsRetentionService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAnalyticsRetentionTestService(t *testing.T) (*AnalyticsRetentionService, *database.DB, *time.Time) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE analytics_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			event_type TEXT NOT NULL,
+			timestamp DATETIME
+		);
+		CREATE TABLE link_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tracking_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			user_id INTEGER,
+			occurred_at DATETIME NOT NULL
+		);
+		CREATE TABLE media_access_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			media_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			playback_duration INTEGER,
+			access_time DATETIME NOT NULL
+		);
+		CREATE TABLE analytics_retention_policies (
+			table_name TEXT PRIMARY KEY,
+			raw_retention_days INTEGER NOT NULL DEFAULT 0,
+			rollup_retention_months INTEGER NOT NULL DEFAULT 0,
+			rolled_up_until DATETIME,
+			last_run_at DATETIME,
+			last_run_error TEXT,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE analytics_hourly_rollups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source_table TEXT NOT NULL,
+			bucket_start DATETIME NOT NULL,
+			dimension TEXT NOT NULL,
+			event_count INTEGER NOT NULL DEFAULT 0,
+			user_count INTEGER NOT NULL DEFAULT 0,
+			total_duration BIGINT NOT NULL DEFAULT 0,
+			UNIQUE(source_table, bucket_start, dimension)
+		);
+		CREATE TABLE analytics_hourly_users (
+			bucket_start DATETIME NOT NULL,
+			source_table TEXT NOT NULL,
+			dimension TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			PRIMARY KEY (bucket_start, source_table, dimension, user_id)
+		);
+		CREATE TABLE analytics_hourly_media (
+			bucket_start DATETIME NOT NULL,
+			media_id INTEGER NOT NULL,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			total_duration BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (bucket_start, media_id)
+		);
+		CREATE TABLE storage_daily_usage (
+			day DATETIME NOT NULL,
+			storage_root_id INTEGER NOT NULL,
+			file_count BIGINT NOT NULL DEFAULT 0,
+			total_bytes BIGINT NOT NULL DEFAULT 0,
+			captured_at DATETIME NOT NULL,
+			PRIMARY KEY (day, storage_root_id)
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			size INTEGER NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			deleted BOOLEAN DEFAULT 0
+		);
+		INSERT INTO files (storage_root_id, size, is_directory, deleted) VALUES
+			(1, 100, 0, 0), (1, 4096, 1, 0), (1, 999, 0, 1), (2, 50, 0, 0);`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+	svc := NewAnalyticsRetentionService(db, nil, AnalyticsRetentionConfig{})
+	svc.now = func() time.Time { return now }
+	return svc, db, &now
+}
+
+func TestAnalyticsRetention_RollsUpAndPurges(t *testing.T) {
+	svc, db, now := newAnalyticsRetentionTestService(t)
+	ctx := context.Background()
+
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC) }
+	for _, e := range []struct {
+		user  int
+		event string
+		at    time.Time
+	}{
+		{1, "play", at(1, 10, 5)},
+		{2, "play", at(1, 10, 40)},
+		{1, "search", at(1, 11, 0)},
+		{1, "play", at(10, 12, 10)}, // the current hour is not rolled up yet
+	} {
+		_, err := db.ExecContext(ctx, `INSERT INTO analytics_events (user_id, event_type, timestamp) VALUES (?, ?, ?)`,
+			e.user, e.event, e.at)
+		require.NoError(t, err)
+	}
+	for _, seconds := range []int{100, 50} {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO media_access_logs (user_id, media_id, action, playback_duration, access_time) VALUES (1, 7, 'play', ?, ?)`,
+			seconds, at(2, 8, seconds/10))
+		require.NoError(t, err)
+	}
+
+	_, err := db.ExecContext(ctx, `INSERT INTO link_events (tracking_id, event_type, occurred_at) VALUES ('t1', 'click', ?)`,
+		at(3, 9, 0))
+	require.NoError(t, err)
+
+	results := svc.RunAll(ctx)
+	require.Len(t, results, 3)
+	assert.Equal(t, AnalyticsRetentionResult{Table: "analytics_events", RolledUpHours: 2}, results[0])
+	assert.Equal(t, AnalyticsRetentionResult{Table: "link_events", RolledUpHours: 1}, results[1])
+	assert.Equal(t, AnalyticsRetentionResult{Table: "media_access_logs", RolledUpHours: 1}, results[2])
+
+	var count, users, duration int64
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT event_count, user_count FROM analytics_hourly_rollups
+		 WHERE source_table = 'analytics_events' AND bucket_start = ? AND dimension = 'play'`, at(1, 10, 0)).Scan(&count, &users))
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), users)
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT event_count, user_count, total_duration FROM analytics_hourly_rollups
+		 WHERE source_table = 'media_access_logs'`).Scan(&count, &users, &duration))
+	assert.Equal(t, []int64{2, 1, 150}, []int64{count, users, duration})
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM analytics_hourly_users WHERE source_table = 'analytics_events'`).Scan(&count))
+	assert.Equal(t, int64(3), count)
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT access_count, total_duration FROM analytics_hourly_media WHERE media_id = 7 AND bucket_start = ?`,
+		at(2, 8, 0)).Scan(&count, &duration))
+	assert.Equal(t, []int64{2, 150}, []int64{count, duration})
+
+	// Storage usage is snapshotted per root, directories are not files
+	var files, bytes int64
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT file_count, total_bytes FROM storage_daily_usage WHERE storage_root_id = 1 AND day = ?`,
+		at(10, 0, 0)).Scan(&files, &bytes))
+	assert.Equal(t, []int64{1, 4196}, []int64{files, bytes})
+
+	// Raw events older than five days go once rolled up; rollups stay
+	days, months := 5, 1
+	policy, err := svc.UpdatePolicy(ctx, "analytics_events", AnalyticsRetentionPolicyRequest{RawRetentionDays: &days, RollupRetentionMonths: &months})
+	require.NoError(t, err)
+	assert.Equal(t, 5, policy.RawRetentionDays)
+	*now = now.Add(time.Hour)
+	results = svc.RunAll(ctx)
+	assert.Equal(t, AnalyticsRetentionResult{Table: "analytics_events", RolledUpHours: 1, PurgedRows: 3}, results[0])
+	assert.Equal(t, int64(0), results[2].PurgedRows)
+
+	stats, err := svc.TableStats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+	assert.Equal(t, int64(1), stats[0].Rows)
+	assert.Equal(t, int64(3), stats[0].RollupRows)
+	require.NotNil(t, stats[0].OldestAt)
+	assert.Equal(t, at(10, 12, 10), stats[0].OldestAt.UTC())
+	require.NotNil(t, stats[0].Policy.RolledUpUntil)
+	assert.Equal(t, at(10, 13, 0), stats[0].Policy.RolledUpUntil.UTC())
+	assert.Equal(t, int64(1), stats[1].Rows)
+	assert.Equal(t, int64(2), stats[2].Rows)
+	assert.Equal(t, int64(2), stats[2].ProjectedRows30d)
+
+	// A month later the March 1 rollups expire
+	*now = time.Date(2026, 4, 5, 0, 0, 0, 0, time.UTC)
+	results = svc.RunAll(ctx)
+	assert.Equal(t, int64(2), results[0].PurgedRollups)
+	assert.Empty(t, results[0].Error)
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM analytics_hourly_users WHERE source_table = 'analytics_events'`).Scan(&count))
+	assert.Equal(t, int64(1), count)
+}
+
+func TestAnalyticsRetention_UpdatePolicyValidation(t *testing.T) {
+	svc, _, _ := newAnalyticsRetentionTestService(t)
+	ctx := context.Background()
+
+	negative := -1
+	_, err := svc.UpdatePolicy(ctx, "analytics_events", AnalyticsRetentionPolicyRequest{RawRetentionDays: &negative})
+	assert.ErrorContains(t, err, "invalid")
+	_, err = svc.UpdatePolicy(ctx, "users", AnalyticsRetentionPolicyRequest{})
+	assert.ErrorContains(t, err, "invalid analytics table")
+
+	policies, err := svc.ListPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	assert.Equal(t, AnalyticsRetentionPolicy{Table: "analytics_events"}, policies[0])
+}
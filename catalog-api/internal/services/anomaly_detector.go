@@ -0,0 +1,574 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Metrics watched for anomalies. error_rate is the percentage of API
+// requests answered with a server error; the others are totals per window.
+const (
+	AnomalyMetricFailedLogins       = "failed_logins"
+	AnomalyMetricErrorRate          = "error_rate"
+	AnomalyMetricBytesDownloaded    = "bytes_downloaded"
+	AnomalyMetricConversionFailures = "conversion_failures"
+)
+
+// AnomalyMetrics lists the metrics watched for anomalies, in the order
+// they are evaluated.
+var AnomalyMetrics = []string{
+	AnomalyMetricFailedLogins,
+	AnomalyMetricErrorRate,
+	AnomalyMetricBytesDownloaded,
+	AnomalyMetricConversionFailures,
+}
+
+// anomalyErrorRateMinRequests is the fewest API requests a window needs
+// for its error rate to count; quieter windows are skipped.
+const anomalyErrorRateMinRequests = 20
+
+// defaultAnomalyMetricSettings are the settings a metric starts with.
+// MinValue keeps small absolute numbers from alerting however unusual
+// they are.
+var defaultAnomalyMetricSettings = map[string]AnomalyMetricSettings{
+	AnomalyMetricFailedLogins:       {Sensitivity: 3, Smoothing: 0.1, MinValue: 10, WarmupSamples: 12, CooldownMinutes: 60},
+	AnomalyMetricErrorRate:          {Sensitivity: 3, Smoothing: 0.1, MinValue: 5, WarmupSamples: 12, CooldownMinutes: 60},
+	AnomalyMetricBytesDownloaded:    {Sensitivity: 4, Smoothing: 0.1, MinValue: 1 << 30, WarmupSamples: 12, CooldownMinutes: 60},
+	AnomalyMetricConversionFailures: {Sensitivity: 3, Smoothing: 0.1, MinValue: 3, WarmupSamples: 12, CooldownMinutes: 60},
+}
+
+// MetricRecorder accepts observations of the metrics watched for
+// anomalies.
+type MetricRecorder interface {
+	Record(metric string, value float64)
+}
+
+// AnomalyMetricSettings is how sensitive detection is for one metric,
+// together with the metric's rolling baseline. A window alerts when its
+// value lies Sensitivity standard deviations or more above the baseline
+// mean and is at least MinValue, once WarmupSamples windows have built
+// the baseline and no alert for the metric was raised in the last
+// CooldownMinutes. Smoothing is the weight of each new window in the
+// exponentially weighted mean and variance.
+type AnomalyMetricSettings struct {
+	Metric          string     `json:"metric"`
+	Enabled         bool       `json:"enabled"`
+	Sensitivity     float64    `json:"sensitivity"`
+	Smoothing       float64    `json:"smoothing"`
+	MinValue        float64    `json:"min_value"`
+	WarmupSamples   int        `json:"warmup_samples"`
+	CooldownMinutes int        `json:"cooldown_minutes"`
+	Mean            float64    `json:"mean"`
+	StdDev          float64    `json:"std_dev"`
+	Samples         int        `json:"samples"`
+	LastValue       *float64   `json:"last_value,omitempty"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	LastAlertAt     *time.Time `json:"last_alert_at,omitempty"`
+
+	variance float64
+}
+
+// AnomalyMetricSettingsRequest changes a metric's settings; nil fields
+// are kept.
+type AnomalyMetricSettingsRequest struct {
+	Enabled         *bool    `json:"enabled"`
+	Sensitivity     *float64 `json:"sensitivity"`
+	Smoothing       *float64 `json:"smoothing"`
+	MinValue        *float64 `json:"min_value"`
+	WarmupSamples   *int     `json:"warmup_samples"`
+	CooldownMinutes *int     `json:"cooldown_minutes"`
+	// ResetBaseline forgets the baseline, starting a new warm-up
+	ResetBaseline bool `json:"reset_baseline"`
+}
+
+// AnomalyAlert is one window whose value was anomalous. Expected and
+// StdDev describe the baseline before the window.
+type AnomalyAlert struct {
+	ID             int64      `json:"id"`
+	Metric         string     `json:"metric"`
+	Value          float64    `json:"value"`
+	Expected       float64    `json:"expected"`
+	StdDev         float64    `json:"std_dev"`
+	ZScore         float64    `json:"z_score"`
+	WindowStart    time.Time  `json:"window_start"`
+	WindowEnd      time.Time  `json:"window_end"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy *int       `json:"acknowledged_by,omitempty"`
+}
+
+// AnomalyNotifier delivers anomaly alerts to administrators over a single
+// notification channel. The detector fans out to every registered notifier.
+type AnomalyNotifier interface {
+	NotifyAnomaly(ctx context.Context, alert *AnomalyAlert) error
+}
+
+// AnomalyNotifierFunc adapts a plain function to the AnomalyNotifier interface.
+type AnomalyNotifierFunc func(ctx context.Context, alert *AnomalyAlert) error
+
+// NotifyAnomaly calls f(ctx, alert).
+func (f AnomalyNotifierFunc) NotifyAnomaly(ctx context.Context, alert *AnomalyAlert) error {
+	return f(ctx, alert)
+}
+
+// AnomalyDetectorConfig controls the length of the windows metrics are
+// totalled over.
+type AnomalyDetectorConfig struct {
+	Interval time.Duration
+}
+
+// AnomalyDetector totals failed logins, API server errors, bytes
+// downloaded and conversion failures over fixed windows and compares each
+// window with the metric's exponentially weighted mean and standard
+// deviation (a rolling z-score). Anomalous windows are stored as alerts
+// and sent to the registered notifiers. Only rises are anomalies. The
+// baseline keeps learning from anomalous windows, so a lasting change
+// stops alerting once it becomes normal.
+type AnomalyDetector struct {
+	db           *database.DB
+	logger       *zap.Logger
+	config       AnomalyDetectorConfig
+	mu           sync.Mutex
+	totals       map[string]float64
+	requests     float64
+	serverErrors float64
+	since        time.Time
+	notifiers    []AnomalyNotifier
+	stop         chan struct{}
+	wg           sync.WaitGroup
+	now          func() time.Time
+}
+
+// NewAnomalyDetector creates an AnomalyDetector evaluating five-minute
+// windows unless cfg says otherwise.
+func NewAnomalyDetector(db *database.DB, logger *zap.Logger, cfg AnomalyDetectorConfig) *AnomalyDetector {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+	d := &AnomalyDetector{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		totals: make(map[string]float64),
+		now:    time.Now,
+	}
+	d.since = d.now()
+	return d
+}
+
+// AddNotifier registers a notifier that receives every new alert.
+func (d *AnomalyDetector) AddNotifier(notifier AnomalyNotifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append(d.notifiers, notifier)
+}
+
+// Record adds value to the current window's total of metric.
+func (d *AnomalyDetector) Record(metric string, value float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.totals[metric] += value
+}
+
+// RecordRequest counts an API request towards the current window's error
+// rate; statuses of 500 and above are errors.
+func (d *AnomalyDetector) RecordRequest(status int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests++
+	if status >= http.StatusInternalServerError {
+		d.serverErrors++
+	}
+}
+
+func lookupAnomalyMetric(metric string) error {
+	if _, ok := defaultAnomalyMetricSettings[metric]; !ok {
+		return fmt.Errorf("invalid anomaly metric: %s", metric)
+	}
+	return nil
+}
+
+// settings returns the settings of a metric, creating the defaults on
+// first use.
+func (d *AnomalyDetector) settings(ctx context.Context, metric string) (*AnomalyMetricSettings, error) {
+	defaults := defaultAnomalyMetricSettings[metric]
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO anomaly_metrics (metric, enabled, sensitivity, smoothing, min_value, warmup_samples, cooldown_minutes, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		metric, true, defaults.Sensitivity, defaults.Smoothing, defaults.MinValue, defaults.WarmupSamples,
+		defaults.CooldownMinutes, d.now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to create anomaly settings for %s: %w", metric, err)
+	}
+
+	s := AnomalyMetricSettings{Metric: metric}
+	var lastValue sql.NullFloat64
+	var lastEvaluated, lastAlert sql.NullTime
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT enabled, sensitivity, smoothing, min_value, warmup_samples, cooldown_minutes, mean, variance, samples,
+		        last_value, last_evaluated_at, last_alert_at
+		 FROM anomaly_metrics WHERE metric = ?`, metric).Scan(
+		&s.Enabled, &s.Sensitivity, &s.Smoothing, &s.MinValue, &s.WarmupSamples, &s.CooldownMinutes,
+		&s.Mean, &s.variance, &s.Samples, &lastValue, &lastEvaluated, &lastAlert); err != nil {
+		return nil, fmt.Errorf("failed to load anomaly settings for %s: %w", metric, err)
+	}
+	s.StdDev = math.Sqrt(s.variance)
+	if lastValue.Valid {
+		s.LastValue = &lastValue.Float64
+	}
+	if lastEvaluated.Valid {
+		s.LastEvaluatedAt = &lastEvaluated.Time
+	}
+	if lastAlert.Valid {
+		s.LastAlertAt = &lastAlert.Time
+	}
+	return &s, nil
+}
+
+// ListSettings returns the settings and baseline of every metric.
+func (d *AnomalyDetector) ListSettings(ctx context.Context) ([]AnomalyMetricSettings, error) {
+	settings := make([]AnomalyMetricSettings, 0, len(AnomalyMetrics))
+	for _, metric := range AnomalyMetrics {
+		s, err := d.settings(ctx, metric)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, *s)
+	}
+	return settings, nil
+}
+
+// UpdateSettings changes how sensitive detection is for a metric. The new
+// settings apply from the next window.
+func (d *AnomalyDetector) UpdateSettings(ctx context.Context, metric string, req AnomalyMetricSettingsRequest) (*AnomalyMetricSettings, error) {
+	if err := lookupAnomalyMetric(metric); err != nil {
+		return nil, err
+	}
+	s, err := d.settings(ctx, metric)
+	if err != nil {
+		return nil, err
+	}
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	if req.Sensitivity != nil {
+		s.Sensitivity = *req.Sensitivity
+	}
+	if req.Smoothing != nil {
+		s.Smoothing = *req.Smoothing
+	}
+	if req.MinValue != nil {
+		s.MinValue = *req.MinValue
+	}
+	if req.WarmupSamples != nil {
+		s.WarmupSamples = *req.WarmupSamples
+	}
+	if req.CooldownMinutes != nil {
+		s.CooldownMinutes = *req.CooldownMinutes
+	}
+	switch {
+	case s.Sensitivity <= 0:
+		return nil, fmt.Errorf("invalid anomaly settings: sensitivity must be positive")
+	case s.Smoothing <= 0 || s.Smoothing >= 1:
+		return nil, fmt.Errorf("invalid anomaly settings: smoothing must be between 0 and 1")
+	case s.MinValue < 0 || s.WarmupSamples < 1 || s.CooldownMinutes < 0:
+		return nil, fmt.Errorf("invalid anomaly settings: min_value and cooldown_minutes cannot be negative and warmup_samples must be at least 1")
+	}
+	if req.ResetBaseline {
+		s.Mean, s.variance, s.StdDev, s.Samples = 0, 0, 0, 0
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE anomaly_metrics SET enabled = ?, sensitivity = ?, smoothing = ?, min_value = ?, warmup_samples = ?,
+		        cooldown_minutes = ?, mean = ?, variance = ?, samples = ?, updated_at = ?
+		 WHERE metric = ?`,
+		s.Enabled, s.Sensitivity, s.Smoothing, s.MinValue, s.WarmupSamples, s.CooldownMinutes,
+		s.Mean, s.variance, s.Samples, d.now().UTC(), metric); err != nil {
+		return nil, fmt.Errorf("failed to update anomaly settings for %s: %w", metric, err)
+	}
+	return s, nil
+}
+
+// observe scores value against the baseline and then folds it in. It
+// reports the z-score and whether the value is an anomaly. A flat
+// baseline is given a standard deviation of one unit so that a first rise
+// still scores.
+func (s *AnomalyMetricSettings) observe(value float64, at time.Time) (float64, bool) {
+	var z float64
+	anomalous := false
+	if s.Samples >= s.WarmupSamples {
+		z = (value - s.Mean) / math.Max(math.Sqrt(s.variance), 1)
+		anomalous = z >= s.Sensitivity && value >= s.MinValue &&
+			(s.LastAlertAt == nil || at.Sub(*s.LastAlertAt) >= time.Duration(s.CooldownMinutes)*time.Minute)
+	}
+
+	if s.Samples == 0 {
+		s.Mean, s.variance = value, 0
+	} else {
+		diff := value - s.Mean
+		s.Mean += s.Smoothing * diff
+		s.variance = (1 - s.Smoothing) * (s.variance + s.Smoothing*diff*diff)
+	}
+	s.Samples++
+	s.StdDev = math.Sqrt(s.variance)
+	return z, anomalous
+}
+
+// Evaluate closes the current window, scores each enabled metric against
+// its baseline and raises an alert for every anomaly. It returns the new
+// alerts. A failure on one metric is logged and does not stop the others.
+func (d *AnomalyDetector) Evaluate(ctx context.Context) []*AnomalyAlert {
+	d.mu.Lock()
+	windowStart, windowEnd := d.since, d.now()
+	totals, requests, serverErrors := d.totals, d.requests, d.serverErrors
+	d.totals, d.requests, d.serverErrors, d.since = make(map[string]float64), 0, 0, windowEnd
+	notifiers := make([]AnomalyNotifier, len(d.notifiers))
+	copy(notifiers, d.notifiers)
+	d.mu.Unlock()
+
+	var alerts []*AnomalyAlert
+	for _, metric := range AnomalyMetrics {
+		value := totals[metric]
+		if metric == AnomalyMetricErrorRate {
+			if requests < anomalyErrorRateMinRequests {
+				continue
+			}
+			value = serverErrors / requests * 100
+		}
+		alert, err := d.evaluate(ctx, metric, value, windowStart, windowEnd)
+		if err != nil {
+			d.logger.Error("Anomaly evaluation failed", zap.String("metric", metric), zap.Error(err))
+			continue
+		}
+		if alert == nil {
+			continue
+		}
+
+		d.logger.Warn("Anomaly detected",
+			zap.String("metric", metric),
+			zap.Float64("value", alert.Value),
+			zap.Float64("expected", alert.Expected),
+			zap.Float64("z_score", alert.ZScore))
+		for _, notifier := range notifiers {
+			if err := notifier.NotifyAnomaly(ctx, alert); err != nil {
+				d.logger.Error("Failed to deliver anomaly notification",
+					zap.String("metric", metric),
+					zap.Error(err))
+			}
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// evaluate scores one metric's window value, saves the updated baseline
+// and stores the alert when the value is anomalous.
+func (d *AnomalyDetector) evaluate(ctx context.Context, metric string, value float64, windowStart, windowEnd time.Time) (*AnomalyAlert, error) {
+	s, err := d.settings(ctx, metric)
+	if err != nil || !s.Enabled {
+		return nil, err
+	}
+	expected, stdDev := s.Mean, s.StdDev
+	z, anomalous := s.observe(value, windowEnd)
+
+	var alert *AnomalyAlert
+	if anomalous {
+		alert = &AnomalyAlert{
+			Metric:      metric,
+			Value:       value,
+			Expected:    expected,
+			StdDev:      stdDev,
+			ZScore:      z,
+			WindowStart: windowStart.UTC(),
+			WindowEnd:   windowEnd.UTC(),
+			CreatedAt:   d.now().UTC(),
+		}
+		if alert.ID, err = d.db.InsertReturningID(ctx,
+			`INSERT INTO anomaly_alerts (metric, value, expected, std_dev, z_score, window_start, window_end, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			alert.Metric, alert.Value, alert.Expected, alert.StdDev, alert.ZScore,
+			alert.WindowStart, alert.WindowEnd, alert.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to store anomaly alert: %w", err)
+		}
+		s.LastAlertAt = &alert.CreatedAt
+	}
+
+	evaluatedAt := windowEnd.UTC()
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE anomaly_metrics SET mean = ?, variance = ?, samples = ?, last_value = ?, last_evaluated_at = ?, last_alert_at = ?
+		 WHERE metric = ?`,
+		s.Mean, s.variance, s.Samples, value, evaluatedAt, s.LastAlertAt, metric); err != nil {
+		return nil, fmt.Errorf("failed to save anomaly baseline: %w", err)
+	}
+	return alert, nil
+}
+
+// ListAlerts returns the newest alerts first, optionally only those of one
+// metric or those not yet acknowledged.
+func (d *AnomalyDetector) ListAlerts(ctx context.Context, metric string, unacknowledged bool, limit int) ([]AnomalyAlert, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := `SELECT id, metric, value, expected, std_dev, z_score, window_start, window_end, created_at,
+	                 acknowledged_at, acknowledged_by
+	          FROM anomaly_alerts WHERE 1 = 1`
+	var args []interface{}
+	if metric != "" {
+		if err := lookupAnomalyMetric(metric); err != nil {
+			return nil, err
+		}
+		query += ` AND metric = ?`
+		args = append(args, metric)
+	}
+	if unacknowledged {
+		query += ` AND acknowledged_at IS NULL`
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomaly alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []AnomalyAlert{}
+	for rows.Next() {
+		var alert AnomalyAlert
+		var acknowledgedAt sql.NullTime
+		var acknowledgedBy sql.NullInt64
+		if err := rows.Scan(&alert.ID, &alert.Metric, &alert.Value, &alert.Expected, &alert.StdDev, &alert.ZScore,
+			&alert.WindowStart, &alert.WindowEnd, &alert.CreatedAt, &acknowledgedAt, &acknowledgedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly alert: %w", err)
+		}
+		if acknowledgedAt.Valid {
+			alert.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		if acknowledgedBy.Valid {
+			by := int(acknowledgedBy.Int64)
+			alert.AcknowledgedBy = &by
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// AcknowledgeAlert records that an administrator has seen an alert.
+func (d *AnomalyDetector) AcknowledgeAlert(ctx context.Context, id int64, userID int) error {
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE anomaly_alerts SET acknowledged_at = ?, acknowledged_by = ? WHERE id = ? AND acknowledged_at IS NULL`,
+		d.now().UTC(), userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge anomaly alert: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	var exists int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM anomaly_alerts WHERE id = ?`, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to acknowledge anomaly alert: %w", err)
+	}
+	if exists == 0 {
+		return errors.New("anomaly alert not found")
+	}
+	return nil
+}
+
+// Start evaluates a window every configured interval until Stop is called.
+func (d *AnomalyDetector) Start() {
+	d.mu.Lock()
+	if d.stop != nil {
+		d.mu.Unlock()
+		return
+	}
+	d.stop = make(chan struct{})
+	d.since = d.now()
+	stop := d.stop
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				d.Evaluate(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for an evaluation in progress to finish.
+func (d *AnomalyDetector) Stop() {
+	d.mu.Lock()
+	stop := d.stop
+	d.stop = nil
+	d.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	d.wg.Wait()
+}
+
+// WebhookAnomalyNotifier posts anomaly alerts to a Slack-compatible
+// incoming webhook.
+type WebhookAnomalyNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAnomalyNotifier creates a notifier posting to url.
+func NewWebhookAnomalyNotifier(url string) *WebhookAnomalyNotifier {
+	return &WebhookAnomalyNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NotifyAnomaly posts a JSON payload describing the alert.
+func (n *WebhookAnomalyNotifier) NotifyAnomaly(ctx context.Context, alert *AnomalyAlert) error {
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf(":warning: Unusual %s: %.4g in the window ending %s, expected about %.4g (z-score %.1f)",
+			alert.Metric, alert.Value, alert.WindowEnd.Format(time.RFC3339), alert.Expected, alert.ZScore),
+		"alert": alert,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
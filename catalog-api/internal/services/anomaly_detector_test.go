@@ -0,0 +1,172 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAnomalyTestDetector(t *testing.T) (*AnomalyDetector, *time.Time) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE anomaly_metrics (
+			metric TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			sensitivity REAL NOT NULL,
+			smoothing REAL NOT NULL,
+			min_value REAL NOT NULL DEFAULT 0,
+			warmup_samples INTEGER NOT NULL,
+			cooldown_minutes INTEGER NOT NULL,
+			mean REAL NOT NULL DEFAULT 0,
+			variance REAL NOT NULL DEFAULT 0,
+			samples INTEGER NOT NULL DEFAULT 0,
+			last_value REAL,
+			last_evaluated_at DATETIME,
+			last_alert_at DATETIME,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE anomaly_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			metric TEXT NOT NULL,
+			value REAL NOT NULL,
+			expected REAL NOT NULL,
+			std_dev REAL NOT NULL,
+			z_score REAL NOT NULL,
+			window_start DATETIME NOT NULL,
+			window_end DATETIME NOT NULL,
+			created_at DATETIME NOT NULL,
+			acknowledged_at DATETIME,
+			acknowledged_by INTEGER
+		);
+	`)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := NewAnomalyDetector(database.WrapDB(sqlDB, database.DialectSQLite), nil, AnomalyDetectorConfig{})
+	d.now = func() time.Time { return now }
+	d.since = now
+	return d, &now
+}
+
+func TestAnomalyDetector_FailedLoginSpike(t *testing.T) {
+	d, now := newAnomalyTestDetector(t)
+	ctx := context.Background()
+	var notified []*AnomalyAlert
+	d.AddNotifier(AnomalyNotifierFunc(func(ctx context.Context, alert *AnomalyAlert) error {
+		notified = append(notified, alert)
+		return nil
+	}))
+
+	window := func(failedLogins float64) []*AnomalyAlert {
+		d.Record(AnomalyMetricFailedLogins, failedLogins)
+		*now = now.Add(5 * time.Minute)
+		return d.Evaluate(ctx)
+	}
+
+	// The warm-up builds the baseline without alerting, however unusual
+	for i := 0; i < 12; i++ {
+		require.Empty(t, window(float64(2+i%3)))
+	}
+
+	alerts := window(40)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, AnomalyMetricFailedLogins, alerts[0].Metric)
+	assert.Equal(t, 40.0, alerts[0].Value)
+	assert.InDelta(t, 3, alerts[0].Expected, 1)
+	assert.Greater(t, alerts[0].ZScore, 3.0)
+	assert.Equal(t, now.Add(-5*time.Minute), alerts[0].WindowStart)
+	require.Len(t, notified, 1)
+
+	// The cooldown holds back a second alert for the same metric
+	assert.Empty(t, window(60))
+
+	listed, err := d.ListAlerts(ctx, "", true, 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.NoError(t, d.AcknowledgeAlert(ctx, listed[0].ID, 7))
+	listed, err = d.ListAlerts(ctx, AnomalyMetricFailedLogins, false, 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.NotNil(t, listed[0].AcknowledgedBy)
+	assert.Equal(t, 7, *listed[0].AcknowledgedBy)
+	listed, err = d.ListAlerts(ctx, "", true, 0)
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+	assert.ErrorContains(t, d.AcknowledgeAlert(ctx, 999, 7), "not found")
+}
+
+func TestAnomalyDetector_ErrorRate(t *testing.T) {
+	d, now := newAnomalyTestDetector(t)
+	ctx := context.Background()
+	one := 1
+	_, err := d.UpdateSettings(ctx, AnomalyMetricErrorRate, AnomalyMetricSettingsRequest{WarmupSamples: &one})
+	require.NoError(t, err)
+
+	// Too few requests to count
+	for i := 0; i < 5; i++ {
+		d.RecordRequest(500)
+	}
+	*now = now.Add(5 * time.Minute)
+	assert.Empty(t, d.Evaluate(ctx))
+	settings, err := d.ListSettings(ctx)
+	require.NoError(t, err)
+	require.Len(t, settings, len(AnomalyMetrics))
+	assert.Equal(t, AnomalyMetricErrorRate, settings[1].Metric)
+	assert.Zero(t, settings[1].Samples)
+
+	for i := 0; i < 100; i++ {
+		d.RecordRequest(200)
+	}
+	*now = now.Add(5 * time.Minute)
+	assert.Empty(t, d.Evaluate(ctx))
+
+	for i := 0; i < 100; i++ {
+		status := 200
+		if i < 30 {
+			status = 503
+		}
+		d.RecordRequest(status)
+	}
+	*now = now.Add(5 * time.Minute)
+	alerts := d.Evaluate(ctx)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, 30.0, alerts[0].Value)
+}
+
+func TestAnomalyDetector_UpdateSettings(t *testing.T) {
+	d, _ := newAnomalyTestDetector(t)
+	ctx := context.Background()
+
+	sensitivity, disabled := 2.5, false
+	s, err := d.UpdateSettings(ctx, AnomalyMetricBytesDownloaded, AnomalyMetricSettingsRequest{Sensitivity: &sensitivity, Enabled: &disabled})
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, s.Sensitivity)
+	assert.False(t, s.Enabled)
+	assert.Equal(t, float64(1<<30), s.MinValue, "unchanged fields keep their defaults")
+
+	zero, tooSmooth := 0.0, 1.0
+	_, err = d.UpdateSettings(ctx, AnomalyMetricBytesDownloaded, AnomalyMetricSettingsRequest{Sensitivity: &zero})
+	assert.ErrorContains(t, err, "invalid anomaly settings")
+	_, err = d.UpdateSettings(ctx, AnomalyMetricBytesDownloaded, AnomalyMetricSettingsRequest{Smoothing: &tooSmooth})
+	assert.ErrorContains(t, err, "invalid anomaly settings")
+	_, err = d.UpdateSettings(ctx, "cpu", AnomalyMetricSettingsRequest{})
+	assert.ErrorContains(t, err, "invalid anomaly metric")
+
+	// Disabled metrics are not evaluated
+	d.Record(AnomalyMetricBytesDownloaded, 1<<40)
+	d.Evaluate(ctx)
+	settings, err := d.ListSettings(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, settings[2].Samples)
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Security-relevant events recorded in auth_audit_log, besides the file
+// operation, snapshot and duplicate resolution events
+const (
+	// AuditEventLoginSuccess is recorded when a user signs in.
+	AuditEventLoginSuccess = "login_success"
+	// AuditEventLoginFailed is recorded when a sign-in is rejected.
+	AuditEventLoginFailed = "failed_login"
+	// AuditEventLogout is recorded when a user signs out.
+	AuditEventLogout = "logout"
+	// AuditEventUserRoleChanged is recorded when a user is given another
+	// role, and with it other permissions.
+	AuditEventUserRoleChanged = "user_role_changed"
+	// AuditEventRoleCreated is recorded when a role is created.
+	AuditEventRoleCreated = "role_created"
+	// AuditEventRoleUpdated is recorded when a role's name, description
+	// or permissions are changed.
+	AuditEventRoleUpdated = "role_updated"
+	// AuditEventRoleDeleted is recorded when a role is deleted.
+	AuditEventRoleDeleted = "role_deleted"
+	// AuditEventConfigChanged is recorded when the system configuration
+	// is changed, restored from a backup or replaced by a template.
+	AuditEventConfigChanged = "config_changed"
+	// AuditEventShareCredentialsChanged is recorded when the credentials
+	// of a storage root are saved.
+	AuditEventShareCredentialsChanged = "share_credentials_changed"
+	// AuditEventShareCredentialsUsed is recorded when credentials are
+	// used to discover, test or browse an SMB share.
+	AuditEventShareCredentialsUsed = "share_credentials_used"
+)
+
+// maxAuditPageSize caps the events one query returns
+const maxAuditPageSize = 1000
+
+// AuditEntry is an event to record. UserID is 0 when no user is known,
+// such as for a failed sign-in with an unknown username.
+type AuditEntry struct {
+	UserID    int
+	Action    string
+	IPAddress string
+	UserAgent string
+	Details   map[string]interface{}
+}
+
+// AuditRecorder records security-relevant events.
+type AuditRecorder interface {
+	Record(ctx context.Context, entry AuditEntry)
+}
+
+// AuditEvent is a recorded event. Username is the current name of the
+// user, when the event has one.
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	UserID    *int            `json:"user_id,omitempty"`
+	Username  *string         `json:"username,omitempty"`
+	Action    string          `json:"action"`
+	IPAddress string          `json:"ip_address,omitempty"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects recorded events. Zero fields do not filter; Since
+// is inclusive and Until exclusive.
+type AuditFilter struct {
+	UserID  int
+	Actions []string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+// AuditService records security-relevant actions in the append-only
+// auth_audit_log table and queries and exports them. Recording never
+// fails the action itself: errors are logged.
+type AuditService struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+// NewAuditService creates a new AuditService.
+func NewAuditService(db *database.DB, logger *zap.Logger) *AuditService {
+	return &AuditService{db: db, logger: logger}
+}
+
+// Record appends an event to the audit log.
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) {
+	var userID interface{}
+	if entry.UserID > 0 {
+		userID = entry.UserID
+	}
+	var details interface{}
+	if len(entry.Details) > 0 {
+		encoded, err := json.Marshal(entry.Details)
+		if err != nil {
+			s.logger.Error("Failed to encode audit event details", zap.String("action", entry.Action), zap.Error(err))
+		} else {
+			details = string(encoded)
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO auth_audit_log (user_id, event_type, ip_address, user_agent, details) VALUES (?, ?, ?, ?, ?)`,
+		userID, entry.Action, entry.IPAddress, entry.UserAgent, details)
+	if err != nil {
+		s.logger.Error("Failed to record audit event", zap.String("action", entry.Action), zap.Error(err))
+	}
+}
+
+// auditWhere builds the WHERE clause and arguments of a filter. Times are
+// compared in the UTC "YYYY-MM-DD HH:MM:SS" form CURRENT_TIMESTAMP stores.
+func auditWhere(filter AuditFilter) (string, []interface{}) {
+	where := ` WHERE 1 = 1`
+	var args []interface{}
+	if filter.UserID > 0 {
+		where += ` AND a.user_id = ?`
+		args = append(args, filter.UserID)
+	}
+	if len(filter.Actions) > 0 {
+		where += ` AND a.event_type IN (?` + strings.Repeat(`, ?`, len(filter.Actions)-1) + `)`
+		for _, action := range filter.Actions {
+			args = append(args, action)
+		}
+	}
+	if !filter.Since.IsZero() {
+		where += ` AND a.created_at >= ?`
+		args = append(args, filter.Since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !filter.Until.IsZero() {
+		where += ` AND a.created_at < ?`
+		args = append(args, filter.Until.UTC().Format("2006-01-02 15:04:05"))
+	}
+	return where, args
+}
+
+const auditSelect = `SELECT a.id, a.user_id, u.username, a.event_type, a.ip_address, a.user_agent, a.details, a.created_at
+	FROM auth_audit_log a LEFT JOIN users u ON u.id = a.user_id`
+
+// Query returns a page of the events matching the filter, newest first,
+// and how many match in all.
+func (s *AuditService) Query(ctx context.Context, filter AuditFilter) ([]AuditEvent, int, error) {
+	if filter.Limit <= 0 || filter.Limit > maxAuditPageSize {
+		filter.Limit = 100
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	where, args := auditWhere(filter)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM auth_audit_log a`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	events := []AuditEvent{}
+	err := s.each(ctx, auditSelect+where+` ORDER BY a.created_at DESC, a.id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.Limit, filter.Offset), func(event AuditEvent) error {
+			events = append(events, event)
+			return nil
+		})
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Get returns one recorded event.
+func (s *AuditService) Get(ctx context.Context, id int64) (*AuditEvent, error) {
+	var found *AuditEvent
+	err := s.each(ctx, auditSelect+` WHERE a.id = ?`, []interface{}{id}, func(event AuditEvent) error {
+		found = &event
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("audit event %d not found", id)
+	}
+	return found, nil
+}
+
+// ExportCSV writes every event matching the filter as CSV, oldest first,
+// ignoring its limit and offset, and returns how many it wrote.
+func (s *AuditService) ExportCSV(ctx context.Context, filter AuditFilter, w io.Writer) (int, error) {
+	where, args := auditWhere(filter)
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"id", "created_at", "user_id", "username", "action", "ip_address", "user_agent", "details"}); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := s.each(ctx, auditSelect+where+` ORDER BY a.created_at, a.id`, args, func(event AuditEvent) error {
+		var userID, username string
+		if event.UserID != nil {
+			userID = strconv.Itoa(*event.UserID)
+		}
+		if event.Username != nil {
+			username = *event.Username
+		}
+		count++
+		return out.Write([]string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			userID,
+			csvSafe(username),
+			event.Action,
+			csvSafe(event.IPAddress),
+			csvSafe(event.UserAgent),
+			csvSafe(string(event.Details)),
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	out.Flush()
+	return count, out.Error()
+}
+
+// csvSafe keeps spreadsheets from running a value as a formula. Usernames
+// of failed sign-ins and user agents are whatever the client sent.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// each runs an audit event query and calls fn for every event.
+func (s *AuditService) each(ctx context.Context, query string, args []interface{}, fn func(AuditEvent) error) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event AuditEvent
+		var userID sql.NullInt64
+		var username, ipAddress, userAgent, details sql.NullString
+		if err := rows.Scan(&event.ID, &userID, &username, &event.Action, &ipAddress, &userAgent, &details, &event.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			event.UserID = &id
+		}
+		if username.Valid {
+			event.Username = &username.String
+		}
+		event.IPAddress, event.UserAgent = ipAddress.String, userAgent.String
+		if details.String != "" {
+			// Older events may hold plain text
+			if json.Valid([]byte(details.String)) {
+				event.Details = json.RawMessage(details.String)
+			} else {
+				event.Details, _ = json.Marshal(details.String)
+			}
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupAuditTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL
+		);
+		CREATE TABLE auth_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			event_type TEXT NOT NULL,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO users (username) VALUES ('admin'), ('alice')`)
+	require.NoError(t, err)
+
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+func TestAuditService_RecordAndQuery(t *testing.T) {
+	db := setupAuditTestDB(t)
+	svc := NewAuditService(db, zap.NewNop())
+	ctx := context.Background()
+
+	svc.Record(ctx, AuditEntry{UserID: 2, Action: AuditEventLoginSuccess, IPAddress: "10.0.0.5", UserAgent: "Firefox"})
+	svc.Record(ctx, AuditEntry{Action: AuditEventLoginFailed, IPAddress: "10.0.0.9",
+		Details: map[string]interface{}{"username": "mallory", "reason": "invalid credentials"}})
+	svc.Record(ctx, AuditEntry{UserID: 1, Action: AuditEventRoleUpdated, Details: map[string]interface{}{"role_id": 3}})
+	// Events older services recorded, with plain text details
+	_, err := db.Exec(`INSERT INTO auth_audit_log (user_id, event_type, details, created_at) VALUES (2, 'logout', 'signed out', '2024-01-10 08:00:00')`)
+	require.NoError(t, err)
+
+	events, total, err := svc.Query(ctx, AuditFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+	require.Len(t, events, 4)
+	assert.Equal(t, AuditEventRoleUpdated, events[0].Action, "newest first")
+	assert.Equal(t, AuditEventLogout, events[3].Action)
+	assert.JSONEq(t, `"signed out"`, string(events[3].Details))
+	assert.Equal(t, time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC), events[3].CreatedAt.UTC())
+
+	failed := events[1]
+	assert.Nil(t, failed.UserID)
+	assert.Nil(t, failed.Username)
+	assert.JSONEq(t, `{"username":"mallory","reason":"invalid credentials"}`, string(failed.Details))
+
+	events, total, err = svc.Query(ctx, AuditFilter{UserID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.NotNil(t, events[0].Username)
+	assert.Equal(t, "alice", *events[0].Username)
+	assert.Equal(t, "10.0.0.5", events[0].IPAddress)
+
+	_, total, err = svc.Query(ctx, AuditFilter{Actions: []string{AuditEventLoginSuccess, AuditEventLoginFailed}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	// Times are compared in UTC, whatever zone the filter is in
+	berlin := time.FixedZone("CET", 3600)
+	events, total, err = svc.Query(ctx, AuditFilter{
+		Since: time.Date(2024, 1, 10, 9, 0, 0, 0, berlin),
+		Until: time.Date(2024, 1, 10, 9, 0, 1, 0, berlin),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, AuditEventLogout, events[0].Action)
+	_, total, err = svc.Query(ctx, AuditFilter{Since: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+
+	events, total, err = svc.Query(ctx, AuditFilter{Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Len(t, events, 2)
+
+	event, err := svc.Get(ctx, failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, AuditEventLoginFailed, event.Action)
+	_, err = svc.Get(ctx, 999)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestAuditService_ExportCSV(t *testing.T) {
+	db := setupAuditTestDB(t)
+	svc := NewAuditService(db, zap.NewNop())
+	ctx := context.Background()
+
+	svc.Record(ctx, AuditEntry{UserID: 1, Action: AuditEventConfigChanged, IPAddress: "10.0.0.5",
+		Details: map[string]interface{}{"section": "smtp"}})
+	svc.Record(ctx, AuditEntry{Action: AuditEventLoginFailed, UserAgent: "=HYPERLINK(\"http://evil\")",
+		Details: map[string]interface{}{"username": "@admin"}})
+
+	var buf bytes.Buffer
+	count, err := svc.ExportCSV(ctx, AuditFilter{Limit: 1}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "exports ignore paging")
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "created_at", "user_id", "username", "action", "ip_address", "user_agent", "details"}, records[0])
+	assert.Equal(t, "1", records[1][2])
+	assert.Equal(t, "admin", records[1][3])
+	assert.Equal(t, AuditEventConfigChanged, records[1][4])
+	assert.Equal(t, `{"section":"smtp"}`, records[1][7])
+	_, err = time.Parse(time.RFC3339, records[1][1])
+	assert.NoError(t, err)
+
+	// Values a spreadsheet would run as formulas are defused
+	assert.Equal(t, "", records[2][2])
+	assert.Equal(t, `'=HYPERLINK("http://evil")`, records[2][6])
+
+	buf.Reset()
+	count, err = svc.ExportCSV(ctx, AuditFilter{UserID: 2}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "id,created_at,user_id,username,action,ip_address,user_agent,details\n", buf.String())
+}
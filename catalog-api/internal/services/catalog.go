@@ -4,12 +4,14 @@ import (
 	"catalogizer/database"
 	"catalogizer/internal/config"
 	"catalogizer/internal/models"
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"go.uber.org/zap"
+	"golang.org/x/text/unicode/norm"
 )
 
 // CatalogServiceInterface defines the interface for catalog operations
@@ -30,9 +32,10 @@ type CatalogServiceInterface interface {
 }
 
 type CatalogService struct {
-	db     *database.DB
-	config *config.Config
-	logger *zap.Logger
+	db        *database.DB
+	config    *config.Config
+	logger    *zap.Logger
+	providers *StorageProviderFactory
 }
 
 func NewCatalogService(cfg *config.Config, logger *zap.Logger) *CatalogService {
@@ -46,15 +49,27 @@ func (s *CatalogService) SetDB(db *database.DB) {
 	s.db = db
 }
 
+// SetStorageProviders sets the factory used to read storage roots live,
+// through the provider for each root's protocol.
+func (s *CatalogService) SetStorageProviders(providers *StorageProviderFactory) {
+	s.providers = providers
+}
+
 func (s *CatalogService) ListPath(path string, sortBy string, sortOrder string, limit, offset int) ([]models.FileInfo, error) {
+	files, _, err := s.listPath(context.Background(), path, sortBy, sortOrder, "", limit, offset)
+	return files, err
+}
+
+// listPath lists a directory, by offset or continuing after cursor.
+func (s *CatalogService) listPath(ctx context.Context, path, sortBy, sortOrder, cursor string, limit, offset int) ([]models.FileInfo, string, error) {
 	var query string
 	var args []interface{}
 
 	// Check if path exists in database
 	var parentID sql.NullInt64
-	err := s.db.QueryRow(`SELECT id FROM files WHERE path = ? LIMIT 1`, path).Scan(&parentID)
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM files WHERE path = ? LIMIT 1`, path).Scan(&parentID)
 	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to check path: %w", err)
+		return nil, "", fmt.Errorf("failed to check path: %w", err)
 	}
 
 	if err == sql.ErrNoRows {
@@ -68,7 +83,7 @@ func (s *CatalogService) ListPath(path string, sortBy string, sortOrder string,
 				WHERE f.parent_id IS NULL
 			`
 		} else {
-			return nil, fmt.Errorf("path not found: %s", path)
+			return nil, "", fmt.Errorf("path not found: %s", path)
 		}
 	} else {
 		// Path exists, list its children
@@ -81,72 +96,11 @@ func (s *CatalogService) ListPath(path string, sortBy string, sortOrder string,
 		args = []interface{}{parentID.Int64}
 	}
 
-	// Add sorting
-	switch sortBy {
-	case "name":
-		query += " ORDER BY f.name"
-	case "size":
-		query += " ORDER BY f.size"
-	case "modified":
-		query += " ORDER BY f.modified_at"
-	default:
-		query += " ORDER BY f.is_directory DESC, f.name"
-	}
-
-	if sortOrder == "desc" {
-		query += " DESC"
-	} else {
-		query += " ASC"
-	}
-
-	// Add pagination
-	if limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, limit)
-	}
-	if offset > 0 {
-		query += " OFFSET ?"
-		args = append(args, offset)
-	}
-
-	rows, err := s.db.Query(query, args...)
+	files, next, err := s.queryFilePage(ctx, query, args, fileKeyset(sortBy, sortOrder), cursor, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query files: %w", err)
-	}
-	defer rows.Close()
-
-	var files []models.FileInfo
-	for rows.Next() {
-		var file models.FileInfo
-		var lastModified sql.NullTime
-		var createdAt sql.NullTime
-		var updatedAt sql.NullTime
-		err := rows.Scan(
-			&file.ID, &file.Name, &file.Path, &file.IsDirectory, &file.Size,
-			&lastModified, &file.Hash, &file.Extension, &file.MimeType,
-			&file.ParentID, &file.SmbRoot, &createdAt, &updatedAt,
-		)
-		if lastModified.Valid {
-			file.LastModified = lastModified.Time
-		}
-		if createdAt.Valid {
-			file.CreatedAt = createdAt.Time
-		}
-		if updatedAt.Valid {
-			file.UpdatedAt = updatedAt.Time
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan file: %w", err)
-		}
-		if file.IsDirectory {
-			file.Type = "directory"
-		} else {
-			file.Type = "file"
-		}
-		files = append(files, file)
+		return nil, "", fmt.Errorf("failed to query files: %w", err)
 	}
-
-	return files, nil
+	return files, next, nil
 }
 
 func (s *CatalogService) GetFileInfo(pathOrID string) (*models.FileInfo, error) {
@@ -209,32 +163,67 @@ func (s *CatalogService) GetFileInfo(pathOrID string) (*models.FileInfo, error)
 }
 
 func (s *CatalogService) SearchFiles(req *models.SearchRequest) ([]models.FileInfo, int64, error) {
-	baseQuery := `
-		SELECT f.id, f.name, f.path, f.is_directory, f.size, f.modified_at, f.quick_hash, f.extension, f.mime_type, f.parent_id, sr.name as smb_root, f.created_at, f.last_scan_at
+	ctx := context.Background()
+	total, err := s.CountSearchResults(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	files, _, err := s.searchFiles(ctx, req, "", req.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// CountSearchResults returns how many files match a search.
+func (s *CatalogService) CountSearchResults(ctx context.Context, req *models.SearchRequest) (int64, error) {
+	whereClause, args := searchConditions(req)
+	var total int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
 		FROM files f
 		JOIN storage_roots sr ON f.storage_root_id = sr.id
 		WHERE 1=1
-	`
+	`+whereClause, args...).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count results: %w", err)
+	}
+	return total, nil
+}
 
-	countQuery := `
-		SELECT COUNT(*)
+// searchFiles returns a page of search results, by offset or continuing
+// after cursor.
+func (s *CatalogService) searchFiles(ctx context.Context, req *models.SearchRequest, cursor string, offset int) ([]models.FileInfo, string, error) {
+	whereClause, args := searchConditions(req)
+	query := `
+		SELECT f.id, f.name, f.path, f.is_directory, f.size, f.modified_at, f.quick_hash, f.extension, f.mime_type, f.parent_id, sr.name as smb_root, f.created_at, f.last_scan_at
 		FROM files f
 		JOIN storage_roots sr ON f.storage_root_id = sr.id
 		WHERE 1=1
-	`
+	` + whereClause
+
+	files, next, err := s.queryFilePage(ctx, query, args, fileKeyset(req.SortBy, req.SortOrder), cursor, req.Limit, offset)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search files: %w", err)
+	}
+	return files, next, nil
+}
 
+// searchConditions returns the conditions of a search, to append to a
+// WHERE clause, and their arguments.
+func searchConditions(req *models.SearchRequest) (string, []interface{}) {
 	var conditions []string
 	var args []interface{}
 
-	// Add search conditions
+	// Add search conditions, in NFC as names are cataloged
 	if req.Query != "" {
 		conditions = append(conditions, "f.name LIKE ?")
-		args = append(args, "%"+req.Query+"%")
+		args = append(args, "%"+norm.NFC.String(req.Query)+"%")
 	}
 
 	if req.Path != "" {
 		conditions = append(conditions, "f.path LIKE ?")
-		args = append(args, req.Path+"%")
+		args = append(args, norm.NFC.String(req.Path)+"%")
 	}
 
 	if req.Extension != "" {
@@ -271,92 +260,20 @@ func (s *CatalogService) SearchFiles(req *models.SearchRequest) ([]models.FileIn
 		args = append(args, *req.IsDirectory)
 	}
 
-	// Build final queries
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " AND " + strings.Join(conditions, " AND ")
-	}
-
-	// Get total count
-	var total int64
-	err := s.db.QueryRow(countQuery+whereClause, args...).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count results: %w", err)
-	}
-
-	// Add sorting and pagination to main query
-	query := baseQuery + whereClause
-
-	// Add sorting
-	switch req.SortBy {
-	case "name":
-		query += " ORDER BY f.name"
-	case "size":
-		query += " ORDER BY f.size"
-	case "modified":
-		query += " ORDER BY f.modified_at"
-	default:
-		query += " ORDER BY f.is_directory DESC, f.name"
-	}
-
-	if req.SortOrder == "desc" {
-		query += " DESC"
-	} else {
-		query += " ASC"
-	}
-
-	// Add pagination
-	if req.Limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, req.Limit)
-	}
-	if req.Offset > 0 {
-		query += " OFFSET ?"
-		args = append(args, req.Offset)
-	}
-
-	// Execute main query
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to search files: %w", err)
-	}
-	defer rows.Close()
-
-	var files []models.FileInfo
-	for rows.Next() {
-		var file models.FileInfo
-		var lastModified sql.NullTime
-		var createdAt sql.NullTime
-		var updatedAt sql.NullTime
-		err := rows.Scan(
-			&file.ID, &file.Name, &file.Path, &file.IsDirectory, &file.Size,
-			&lastModified, &file.Hash, &file.Extension, &file.MimeType,
-			&file.ParentID, &file.SmbRoot, &createdAt, &updatedAt,
-		)
-		if lastModified.Valid {
-			file.LastModified = lastModified.Time
-		}
-		if createdAt.Valid {
-			file.CreatedAt = createdAt.Time
-		}
-		if updatedAt.Valid {
-			file.UpdatedAt = updatedAt.Time
-		}
-		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan file: %w", err)
-		}
-		if file.IsDirectory {
-			file.Type = "directory"
-		} else {
-			file.Type = "file"
-		}
-		files = append(files, file)
+	if len(conditions) == 0 {
+		return "", nil
 	}
-
-	return files, total, nil
+	return " AND " + strings.Join(conditions, " AND "), args
 }
 
 func (s *CatalogService) GetDirectoriesBySize(smbRoot string, limit int) ([]models.DirectoryStats, error) {
+	stats, _, err := s.directoriesBySize(context.Background(), smbRoot, "", limit)
+	return stats, err
+}
+
+// directoriesBySize returns directories largest first, continuing after
+// cursor. Directories of the same size are ordered by path.
+func (s *CatalogService) directoriesBySize(ctx context.Context, smbRoot, cursor string, limit int) ([]models.DirectoryStats, string, error) {
 	query := `
 		WITH RECURSIVE dir_sizes AS (
 			SELECT
@@ -375,21 +292,30 @@ func (s *CatalogService) GetDirectoriesBySize(smbRoot string, limit int) ([]mode
 			FROM files f2
 			JOIN dir_sizes ds ON f2.parent_id = ds.id
 		)
-		SELECT
-			path,
-			SUM(file_size) as total_size,
-			SUM(file_count) as file_count,
-			COUNT(CASE WHEN is_directory THEN 1 END) as directory_count
-		FROM dir_sizes
-		WHERE is_directory = 1
-		GROUP BY path
-		ORDER BY total_size DESC
-		LIMIT ?
+		SELECT path, total_size, file_count, directory_count
+		FROM (
+			SELECT
+				path,
+				SUM(file_size) as total_size,
+				SUM(file_count) as file_count,
+				COUNT(CASE WHEN is_directory THEN 1 END) as directory_count
+			FROM dir_sizes
+			WHERE is_directory = 1
+			GROUP BY path
+		) d
+		WHERE 1=1
 	`
+	args := []interface{}{smbRoot}
 
-	rows, err := s.db.Query(query, smbRoot, limit)
+	keys := directorySizeKeyset()
+	query, args, err := keys.apply(query, args, cursor, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get directories by size: %w", err)
+		return nil, "", err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get directories by size: %w", err)
 	}
 	defer rows.Close()
 
@@ -398,21 +324,39 @@ func (s *CatalogService) GetDirectoriesBySize(smbRoot string, limit int) ([]mode
 		var stat models.DirectoryStats
 		err := rows.Scan(&stat.Path, &stat.TotalSize, &stat.FileCount, &stat.DirectoryCount)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan directory stats: %w", err)
+			return nil, "", fmt.Errorf("failed to scan directory stats: %w", err)
 		}
 		stats = append(stats, stat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to get directories by size: %w", err)
+	}
 
-	return stats, nil
+	return keys.page(stats, limit)
 }
 
+// GetDuplicateGroups returns groups of files with the same content, as
+// confirmed by the SHA-256 the scanner computes for files whose quick
+// hashes collide. Deleted files are left out, as are groups whose every
+// file was resolved with its current content.
 func (s *CatalogService) GetDuplicateGroups(smbRoot string, minCount int, limit int) ([]models.DuplicateGroup, error) {
+	groups, _, err := s.duplicateGroups(context.Background(), smbRoot, minCount, "", limit)
+	return groups, err
+}
+
+// duplicateGroups returns duplicate groups, those with the most files
+// first, continuing after cursor. Ties are broken by size, then hash.
+func (s *CatalogService) duplicateGroups(ctx context.Context, smbRoot string, minCount int, cursor string, limit int) ([]models.DuplicateGroup, string, error) {
 	query := `
-		SELECT
-			f.quick_hash, f.size, COUNT(*) as count
-		FROM files f
-		WHERE f.quick_hash IS NOT NULL
-			AND f.is_directory = 0
+		SELECT sha256, size, group_count
+		FROM (
+			SELECT
+				f.sha256, f.size, COUNT(*) as group_count
+			FROM files f
+			LEFT JOIN duplicate_resolutions r ON r.file_id = f.id AND r.sha256 = f.sha256
+			WHERE f.sha256 IS NOT NULL
+				AND f.is_directory = 0
+				AND f.deleted = 0
 	`
 	args := []interface{}{}
 
@@ -422,85 +366,85 @@ func (s *CatalogService) GetDuplicateGroups(smbRoot string, minCount int, limit
 	}
 
 	query += `
-		GROUP BY f.quick_hash, f.size
-		HAVING COUNT(*) >= ?
-		ORDER BY COUNT(*) DESC, f.size DESC
+			GROUP BY f.sha256, f.size
+			HAVING COUNT(*) >= ? AND COUNT(*) > COUNT(r.id)
+		) g
+		WHERE 1=1
 	`
 	args = append(args, minCount)
 
-	if limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, limit)
+	keys := duplicateGroupKeyset()
+	query, args, err := keys.apply(query, args, cursor, limit)
+	if err != nil {
+		return nil, "", err
 	}
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get duplicate groups: %w", err)
+		return nil, "", fmt.Errorf("failed to get duplicate groups: %w", err)
 	}
-	defer rows.Close()
 
 	var groups []models.DuplicateGroup
 	for rows.Next() {
 		var group models.DuplicateGroup
-		err := rows.Scan(&group.Hash, &group.Size, &group.Count)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan duplicate group: %w", err)
+		if err := rows.Scan(&group.Hash, &group.Size, &group.Count); err != nil {
+			rows.Close()
+			return nil, "", fmt.Errorf("failed to scan duplicate group: %w", err)
 		}
+		groups = append(groups, group)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get duplicate groups: %w", err)
+	}
 
-		// Get files in this duplicate group
-		filesQuery := `
-			SELECT f.id, f.name, f.path, f.is_directory, f.size, f.modified_at, f.quick_hash, f.extension, f.mime_type, f.parent_id, sr.name as smb_root, f.created_at, f.last_scan_at
-			FROM files f
-			JOIN storage_roots sr ON f.storage_root_id = sr.id
-			WHERE f.quick_hash = ? AND f.size = ?
-		`
-		args2 := []interface{}{group.Hash, group.Size}
+	groups, next, err := keys.page(groups, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range groups {
+		groups[i].Files = s.duplicateGroupFiles(ctx, groups[i], smbRoot)
+		groups[i].TotalSize = groups[i].Size * int64(groups[i].Count)
+	}
+	return groups, next, nil
+}
 
-		if smbRoot != "" {
-			filesQuery += " AND f.storage_root_id = (SELECT id FROM storage_roots WHERE name = ? LIMIT 1)"
-			args2 = append(args2, smbRoot)
-		}
+// duplicateGroupFiles returns the files in a duplicate group, by path.
+// Failures are logged and leave the group without files.
+func (s *CatalogService) duplicateGroupFiles(ctx context.Context, group models.DuplicateGroup, smbRoot string) []models.FileInfo {
+	filesQuery := `
+		SELECT f.id, f.name, f.path, f.is_directory, f.size, f.modified_at, f.quick_hash, f.extension, f.mime_type, f.parent_id, sr.name as smb_root, f.created_at, f.last_scan_at
+		FROM files f
+		JOIN storage_roots sr ON f.storage_root_id = sr.id
+		WHERE f.sha256 = ? AND f.size = ? AND f.deleted = 0
+	`
+	args := []interface{}{group.Hash, group.Size}
+
+	if smbRoot != "" {
+		filesQuery += " AND f.storage_root_id = (SELECT id FROM storage_roots WHERE name = ? LIMIT 1)"
+		args = append(args, smbRoot)
+	}
 
-		filesQuery += " ORDER BY f.path"
+	filesQuery += " ORDER BY f.path"
 
-		fileRows, err := s.db.Query(filesQuery, args2...)
+	fileRows, err := s.db.QueryContext(ctx, filesQuery, args...)
+	if err != nil {
+		s.logger.Error("Failed to get files for duplicate group", zap.Error(err))
+		return nil
+	}
+	defer fileRows.Close()
+
+	var files []models.FileInfo
+	for fileRows.Next() {
+		file, err := scanFileInfo(fileRows)
 		if err != nil {
-			s.logger.Error("Failed to get files for duplicate group", zap.Error(err))
+			s.logger.Error("Failed to scan duplicate file", zap.Error(err))
 			continue
 		}
-
-		for fileRows.Next() {
-			var file models.FileInfo
-			var lastModified sql.NullTime
-			var createdAt sql.NullTime
-			var updatedAt sql.NullTime
-			err := fileRows.Scan(
-				&file.ID, &file.Name, &file.Path, &file.IsDirectory, &file.Size,
-				&lastModified, &file.Hash, &file.Extension, &file.MimeType,
-				&file.ParentID, &file.SmbRoot, &createdAt, &updatedAt,
-			)
-			if lastModified.Valid {
-				file.LastModified = lastModified.Time
-			}
-			if createdAt.Valid {
-				file.CreatedAt = createdAt.Time
-			}
-			if updatedAt.Valid {
-				file.UpdatedAt = updatedAt.Time
-			}
-			if err != nil {
-				s.logger.Error("Failed to scan duplicate file", zap.Error(err))
-				continue
-			}
-			group.Files = append(group.Files, file)
-		}
-		fileRows.Close()
-
-		group.TotalSize = group.Size * int64(group.Count)
-		groups = append(groups, group)
+		files = append(files, file)
 	}
-
-	return groups, nil
+	return files
 }
 
 func (s *CatalogService) GetSMBRoots() ([]string, error) {
@@ -524,6 +468,25 @@ func (s *CatalogService) GetSMBRoots() ([]string, error) {
 	return roots, nil
 }
 
+// GetStorageRoots lists every configured storage root with its protocol,
+// including roots that have not been scanned yet.
+func (s *CatalogService) GetStorageRoots(ctx context.Context) ([]StorageRootInfo, error) {
+	if s.providers == nil {
+		return nil, fmt.Errorf("storage providers not configured")
+	}
+	return s.providers.Roots(ctx)
+}
+
+// ListStorageDirectory lists a directory straight from a storage root
+// rather than from the catalog, or from the listing cache while the root
+// is unavailable.
+func (s *CatalogService) ListStorageDirectory(ctx context.Context, storageRoot, dir string) (*StorageListing, error) {
+	if s.providers == nil {
+		return nil, fmt.Errorf("storage providers not configured")
+	}
+	return s.providers.List(ctx, storageRoot, dir)
+}
+
 // ListDirectory lists files in a directory (alias for ListPath)
 func (s *CatalogService) ListDirectory(path string) ([]models.FileInfo, error) {
 	return s.ListPath(path, "name", "asc", 0, 0)
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Catalog change kinds recorded by the scanner in catalog_changes.
+const (
+	CatalogChangeAdded    = "added"
+	CatalogChangeRemoved  = "removed"
+	CatalogChangeModified = "modified"
+	CatalogChangeMoved    = "moved"
+)
+
+// CatalogDiffRequest selects the two points in time to compare. Each end
+// is a time or a scan, which stands for the moment that scan finished;
+// To defaults to now. Comparing scans limits the diff to their storage
+// root unless StorageRoot says otherwise.
+type CatalogDiffRequest struct {
+	From               *time.Time
+	To                 *time.Time
+	FromScan           int64
+	ToScan             int64
+	StorageRoot        string
+	IncludeDirectories bool
+	Limit              int
+}
+
+// CatalogDiffEntry is one file that differs between the two points.
+// Size is the current size, or the last known size of a removed file;
+// OldSize and OldPath are set for modified files whose size or path
+// changed.
+type CatalogDiffEntry struct {
+	FileID      int64     `json:"file_id"`
+	StorageRoot string    `json:"storage_root"`
+	Path        string    `json:"path"`
+	OldPath     string    `json:"old_path,omitempty"`
+	IsDirectory bool      `json:"is_directory"`
+	Size        int64     `json:"size"`
+	OldSize     *int64    `json:"old_size,omitempty"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// CatalogDiffSummary counts the differences. ModifiedBytes is the net
+// growth of modified files and may be negative.
+type CatalogDiffSummary struct {
+	Added         int   `json:"added"`
+	Removed       int   `json:"removed"`
+	Modified      int   `json:"modified"`
+	AddedBytes    int64 `json:"added_bytes"`
+	RemovedBytes  int64 `json:"removed_bytes"`
+	ModifiedBytes int64 `json:"modified_bytes"`
+}
+
+// CatalogDiff is the difference between the catalog at From and at To.
+// The lists hold at most the requested limit each; Summary always
+// counts everything and Truncated reports a cut.
+type CatalogDiff struct {
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	StorageRoot string             `json:"storage_root,omitempty"`
+	Added       []CatalogDiffEntry `json:"added"`
+	Removed     []CatalogDiffEntry `json:"removed"`
+	Modified    []CatalogDiffEntry `json:"modified"`
+	Summary     CatalogDiffSummary `json:"summary"`
+	Truncated   bool               `json:"truncated"`
+}
+
+// CatalogDiffService compares the catalog between two points in time
+// from the change journal the scanner keeps.
+type CatalogDiffService struct {
+	db     *database.DB
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewCatalogDiffService creates a new CatalogDiffService.
+func NewCatalogDiffService(db *database.DB, logger *zap.Logger) *CatalogDiffService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &CatalogDiffService{db: db, logger: logger, now: time.Now}
+}
+
+// catalogChangeRow is a journal row as read back for a diff.
+type catalogChangeRow struct {
+	fileID     int64
+	root       string
+	changeType string
+	path       string
+	oldPath    string
+	isDir      bool
+	oldSize    sql.NullInt64
+	newSize    sql.NullInt64
+	changedAt  time.Time
+}
+
+// Compare returns the files added, removed and modified between the two
+// points of req. Changes that cancel out, such as a file added and
+// removed again, are left out; a file changed several times appears once
+// with its sizes at both ends.
+func (s *CatalogDiffService) Compare(ctx context.Context, req CatalogDiffRequest) (*CatalogDiff, error) {
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 200
+	}
+	diff := &CatalogDiff{StorageRoot: req.StorageRoot, To: s.now()}
+
+	switch {
+	case req.FromScan > 0:
+		end, root, err := s.scanEnd(ctx, req.FromScan)
+		if err != nil {
+			return nil, err
+		}
+		diff.From = end
+		if diff.StorageRoot == "" {
+			diff.StorageRoot = root
+		}
+	case req.From != nil:
+		diff.From = *req.From
+	default:
+		return nil, fmt.Errorf("invalid comparison: from or from_scan is required")
+	}
+	switch {
+	case req.ToScan > 0:
+		end, root, err := s.scanEnd(ctx, req.ToScan)
+		if err != nil {
+			return nil, err
+		}
+		if req.FromScan > 0 && req.StorageRoot == "" && root != diff.StorageRoot {
+			return nil, fmt.Errorf("invalid comparison: scans %d and %d are of different storage roots", req.FromScan, req.ToScan)
+		}
+		diff.To = end
+		if diff.StorageRoot == "" {
+			diff.StorageRoot = root
+		}
+	case req.To != nil:
+		diff.To = *req.To
+	}
+	if !diff.From.Before(diff.To) {
+		return nil, fmt.Errorf("invalid comparison: from must be before to")
+	}
+
+	query := `SELECT c.file_id, r.name, c.change_type, c.path, COALESCE(c.old_path, ''), c.is_directory,
+	                 c.old_size, c.new_size, c.changed_at
+	          FROM catalog_changes c
+	          JOIN storage_roots r ON r.id = c.storage_root_id
+	          WHERE c.changed_at > ? AND c.changed_at <= ?`
+	args := []interface{}{diff.From, diff.To}
+	if diff.StorageRoot != "" {
+		query += ` AND r.name = ?`
+		args = append(args, diff.StorageRoot)
+	}
+	if !req.IncludeDirectories {
+		query += ` AND c.is_directory = ?`
+		args = append(args, false)
+	}
+	query += ` ORDER BY c.file_id, c.changed_at, c.id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalog changes: %w", err)
+	}
+	defer rows.Close()
+
+	var history []catalogChangeRow
+	flush := func() {
+		if len(history) > 0 {
+			diff.add(history)
+			history = history[:0]
+		}
+	}
+	for rows.Next() {
+		var row catalogChangeRow
+		if err := rows.Scan(&row.fileID, &row.root, &row.changeType, &row.path, &row.oldPath, &row.isDir,
+			&row.oldSize, &row.newSize, &row.changedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan catalog change: %w", err)
+		}
+		if len(history) > 0 && history[0].fileID != row.fileID {
+			flush()
+		}
+		history = append(history, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load catalog changes: %w", err)
+	}
+	flush()
+
+	for _, list := range []*[]CatalogDiffEntry{&diff.Added, &diff.Removed, &diff.Modified} {
+		entries := *list
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].StorageRoot != entries[j].StorageRoot {
+				return entries[i].StorageRoot < entries[j].StorageRoot
+			}
+			return entries[i].Path < entries[j].Path
+		})
+		if len(entries) > req.Limit {
+			*list = entries[:req.Limit]
+			diff.Truncated = true
+		}
+	}
+	return diff, nil
+}
+
+// add folds the changes of one file, oldest first, into the diff. The
+// file existed at From unless its first change added it, and exists at
+// To unless its last change removed it.
+func (d *CatalogDiff) add(history []catalogChangeRow) {
+	first, last := history[0], history[len(history)-1]
+	existedBefore := first.changeType != CatalogChangeAdded
+	existsAfter := last.changeType != CatalogChangeRemoved
+	originalPath := first.path
+	if first.changeType == CatalogChangeMoved {
+		originalPath = first.oldPath
+	}
+	entry := CatalogDiffEntry{
+		FileID:      last.fileID,
+		StorageRoot: last.root,
+		Path:        last.path,
+		IsDirectory: last.isDir,
+		Size:        last.newSize.Int64,
+		ChangedAt:   last.changedAt,
+	}
+
+	switch {
+	case !existedBefore && existsAfter:
+		d.Added = append(d.Added, entry)
+		d.Summary.Added++
+		d.Summary.AddedBytes += entry.Size
+	case existedBefore && !existsAfter:
+		entry.Path, entry.Size = originalPath, first.oldSize.Int64
+		d.Removed = append(d.Removed, entry)
+		d.Summary.Removed++
+		d.Summary.RemovedBytes += entry.Size
+	case existedBefore && existsAfter:
+		oldSize := first.oldSize.Int64
+		if oldSize == entry.Size && originalPath == entry.Path && !hasContentChange(history) {
+			return
+		}
+		if oldSize != entry.Size {
+			entry.OldSize = &oldSize
+		}
+		if originalPath != entry.Path {
+			entry.OldPath = originalPath
+		}
+		d.Modified = append(d.Modified, entry)
+		d.Summary.Modified++
+		d.Summary.ModifiedBytes += entry.Size - oldSize
+	}
+}
+
+// hasContentChange reports whether any change in history modified the
+// file in place rather than only moving it.
+func hasContentChange(history []catalogChangeRow) bool {
+	for _, row := range history {
+		if row.changeType == CatalogChangeModified {
+			return true
+		}
+	}
+	return false
+}
+
+// scanEnd returns when a scan finished and the name of its storage root.
+func (s *CatalogDiffService) scanEnd(ctx context.Context, id int64) (time.Time, string, error) {
+	var end sql.NullTime
+	var root string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sh.end_time, r.name FROM scan_history sh JOIN storage_roots r ON r.id = sh.storage_root_id
+		 WHERE sh.id = ?`, id).Scan(&end, &root)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, "", fmt.Errorf("scan %d not found", id)
+	}
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("failed to load scan %d: %w", id, err)
+	}
+	if !end.Valid {
+		return time.Time{}, "", fmt.Errorf("invalid comparison: scan %d has not finished", id)
+	}
+	return end.Time, root, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCatalogDiffService_CompareScans(t *testing.T) {
+	f := newScannerFixture(t)
+	svc := NewCatalogDiffService(f.db, zap.NewNop())
+	ctx := context.Background()
+
+	before := time.Now()
+	f.write(t, "films/a.mkv", "aaaa")
+	f.write(t, "films/b.mkv", "bb")
+	f.write(t, "notes.txt", "n")
+	first := f.scan(t)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(f.dir, "archive"), 0755))
+	require.NoError(t, os.Rename(filepath.Join(f.dir, "films", "a.mkv"), filepath.Join(f.dir, "archive", "a-2024.mkv")))
+	require.NoError(t, os.Remove(filepath.Join(f.dir, "notes.txt")))
+	f.write(t, "films/b.mkv", "bbbbbb")
+	f.write(t, "new.txt", "xyz")
+	second := f.scan(t)
+
+	diff, err := svc.Compare(ctx, CatalogDiffRequest{FromScan: first.ID, ToScan: second.ID})
+	require.NoError(t, err)
+	assert.Equal(t, "media", diff.StorageRoot)
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, "new.txt", diff.Added[0].Path)
+	assert.Equal(t, int64(3), diff.Added[0].Size)
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, "notes.txt", diff.Removed[0].Path)
+	assert.Equal(t, int64(1), diff.Removed[0].Size)
+	require.Len(t, diff.Modified, 2)
+	assert.Equal(t, "archive/a-2024.mkv", diff.Modified[0].Path)
+	assert.Equal(t, "films/a.mkv", diff.Modified[0].OldPath)
+	assert.Nil(t, diff.Modified[0].OldSize)
+	assert.Equal(t, "films/b.mkv", diff.Modified[1].Path)
+	require.NotNil(t, diff.Modified[1].OldSize)
+	assert.Equal(t, int64(2), *diff.Modified[1].OldSize)
+	assert.Equal(t, int64(6), diff.Modified[1].Size)
+	assert.Equal(t, CatalogDiffSummary{Added: 1, Removed: 1, Modified: 2, AddedBytes: 3, RemovedBytes: 1, ModifiedBytes: 4}, diff.Summary)
+
+	withDirs, err := svc.Compare(ctx, CatalogDiffRequest{FromScan: first.ID, ToScan: second.ID, IncludeDirectories: true})
+	require.NoError(t, err)
+	require.Len(t, withDirs.Added, 2)
+	assert.Equal(t, "archive", withDirs.Added[0].Path)
+
+	// A file added and removed between the two points is left out
+	f.write(t, "tmp.txt", "t")
+	f.scan(t)
+	require.NoError(t, os.Remove(filepath.Join(f.dir, "tmp.txt")))
+	f.scan(t)
+	diff, err = svc.Compare(ctx, CatalogDiffRequest{FromScan: second.ID})
+	require.NoError(t, err)
+	assert.Equal(t, CatalogDiffSummary{}, diff.Summary)
+
+	// Since a date: notes.txt came and went, a.mkv was added then moved
+	diff, err = svc.Compare(ctx, CatalogDiffRequest{From: &before, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, diff.Summary.Added)
+	assert.Equal(t, 0, diff.Summary.Removed)
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, "archive/a-2024.mkv", diff.Added[0].Path)
+	assert.True(t, diff.Truncated)
+}
+
+func TestCatalogDiffService_InvalidRequests(t *testing.T) {
+	f := newScannerFixture(t)
+	svc := NewCatalogDiffService(f.db, zap.NewNop())
+	ctx := context.Background()
+
+	_, err := svc.Compare(ctx, CatalogDiffRequest{})
+	assert.ErrorContains(t, err, "invalid")
+	_, err = svc.Compare(ctx, CatalogDiffRequest{FromScan: 99})
+	assert.ErrorContains(t, err, "not found")
+
+	from, to := time.Now(), time.Now().Add(-time.Hour)
+	_, err = svc.Compare(ctx, CatalogDiffRequest{From: &from, To: &to})
+	assert.ErrorContains(t, err, "invalid")
+}
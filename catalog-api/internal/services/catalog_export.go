@@ -0,0 +1,149 @@
+package services
+
+import (
+	"catalogizer/internal/models"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Catalog export formats.
+const (
+	CatalogExportNDJSON = "ndjson"
+	CatalogExportCSV    = "csv"
+)
+
+// catalogExportFlushEvery is how many files are written between flushes
+// of the response, so a client receives the export as it is read rather
+// than when the server's buffers fill.
+const catalogExportFlushEvery = 500
+
+// catalogExportColumns is the header row of CSV exports.
+var catalogExportColumns = []string{
+	"id", "name", "path", "type", "size", "last_modified", "hash",
+	"extension", "mime_type", "parent_id", "smb_root", "created_at", "updated_at",
+}
+
+// ValidCatalogExportFormat reports whether format is one ExportFiles
+// can write.
+func ValidCatalogExportFormat(format string) bool {
+	return format == CatalogExportNDJSON || format == CatalogExportCSV
+}
+
+// ExportFiles writes every file matching req's filters to w, in ID order,
+// as NDJSON (one FileInfo object per line) or CSV with a header row.
+// Files are read through a single query's cursor and written as they are
+// scanned, so the whole catalog is never held in memory; w is flushed
+// periodically when it has a Flush method. req's paging and sort fields
+// are ignored. It returns how many files were written, which is also
+// meaningful when the export fails part way.
+func (s *CatalogService) ExportFiles(ctx context.Context, req *models.SearchRequest, format string, w io.Writer) (int64, error) {
+	if !ValidCatalogExportFormat(format) {
+		return 0, fmt.Errorf("invalid export format: %s", format)
+	}
+
+	whereClause, args := searchConditions(req)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT f.id, f.name, f.path, f.is_directory, f.size, f.modified_at, f.quick_hash, f.extension, f.mime_type, f.parent_id, sr.name as smb_root, f.created_at, f.last_scan_at
+		FROM files f
+		JOIN storage_roots sr ON f.storage_root_id = sr.id
+		WHERE 1=1
+	`+whereClause+` ORDER BY f.id`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var write func(models.FileInfo) error
+	var flush func() error
+	switch format {
+	case CatalogExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(catalogExportColumns); err != nil {
+			return 0, fmt.Errorf("failed to write export: %w", err)
+		}
+		write = func(file models.FileInfo) error { return cw.Write(catalogExportRecord(file)) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		enc := json.NewEncoder(w)
+		write = func(file models.FileInfo) error { return enc.Encode(file) }
+		flush = func() error { return nil }
+	}
+	flushResponse := func() error {
+		if err := flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	var written int64
+	for rows.Next() {
+		file, err := scanFileInfo(rows)
+		if err != nil {
+			return written, fmt.Errorf("failed to scan file: %w", err)
+		}
+		if err := write(file); err != nil {
+			return written, fmt.Errorf("failed to write export: %w", err)
+		}
+		written++
+		if written%catalogExportFlushEvery == 0 {
+			if err := flushResponse(); err != nil {
+				return written, fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return written, fmt.Errorf("failed to read files: %w", err)
+	}
+	if err := flushResponse(); err != nil {
+		return written, fmt.Errorf("failed to write export: %w", err)
+	}
+	return written, nil
+}
+
+// catalogExportRecord is a file's CSV row, in catalogExportColumns order.
+// Missing optional values are empty, times are RFC 3339, and names, which
+// come from whoever wrote to the share, are passed through csvSafe.
+func catalogExportRecord(file models.FileInfo) []string {
+	optional := func(v *string) string {
+		if v == nil {
+			return ""
+		}
+		return csvSafe(*v)
+	}
+	timestamp := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	parentID := ""
+	if file.ParentID != nil {
+		parentID = strconv.FormatInt(*file.ParentID, 10)
+	}
+	return []string{
+		strconv.FormatInt(file.ID, 10),
+		csvSafe(file.Name),
+		csvSafe(file.Path),
+		file.Type,
+		strconv.FormatInt(file.Size, 10),
+		timestamp(file.LastModified),
+		optional(file.Hash),
+		optional(file.Extension),
+		optional(file.MimeType),
+		parentID,
+		csvSafe(file.SmbRoot),
+		timestamp(file.CreatedAt),
+		timestamp(file.UpdatedAt),
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"catalogizer/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flushCounter records the export and how often it was flushed.
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (w *flushCounter) Flush() { w.flushes++ }
+
+func TestCatalogService_ExportFiles(t *testing.T) {
+	s := newCatalogPagesService(t)
+	ctx := context.Background()
+
+	var out flushCounter
+	written, err := s.ExportFiles(ctx, &models.SearchRequest{}, CatalogExportNDJSON, &out)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), written)
+	assert.Equal(t, 1, out.flushes)
+	var ids []int64
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var file models.FileInfo
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &file))
+		ids = append(ids, file.ID)
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, ids, "files are exported in ID order")
+
+	// Exports take the search filters
+	dir := false
+	var csvOut bytes.Buffer
+	written, err = s.ExportFiles(ctx, &models.SearchRequest{
+		Query: ".mkv", SmbRoots: []string{"nas"}, IsDirectory: &dir,
+		Limit: 1, SortBy: "size", SortOrder: "desc",
+	}, CatalogExportCSV, &csvOut)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), written, "paging and sorting are ignored")
+	records, err := csv.NewReader(&csvOut).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	assert.Equal(t, catalogExportColumns, records[0])
+	assert.Equal(t, []string{"2", "b.mkv", "/movies/b.mkv", "file", "100", "2026-10-01T12:00:00Z", "", "", "", "1", "nas"}, records[1][:11])
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO files (id, storage_root_id, path, name, size, is_directory, modified_at, parent_id)
+		VALUES (11, 1, '/movies/=cmd.mkv', '=cmd.mkv', 1, 0, ?, 1)`, time.Now())
+	require.NoError(t, err)
+	csvOut.Reset()
+	_, err = s.ExportFiles(ctx, &models.SearchRequest{Query: "cmd"}, CatalogExportCSV, &csvOut)
+	require.NoError(t, err)
+	assert.Contains(t, csvOut.String(), "\n11,'=cmd.mkv,/movies/=cmd.mkv,", "names are not run as formulas")
+
+	written, err = s.ExportFiles(ctx, &models.SearchRequest{Path: "/nothing"}, CatalogExportNDJSON, &out)
+	require.NoError(t, err)
+	assert.Zero(t, written)
+
+	_, err = s.ExportFiles(ctx, &models.SearchRequest{}, "xml", &out)
+	assert.ErrorContains(t, err, "invalid export format")
+}
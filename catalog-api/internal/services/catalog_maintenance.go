@@ -0,0 +1,869 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Maintenance run triggers and statuses.
+const (
+	MaintenanceTriggerManual   = "manual"
+	MaintenanceTriggerSchedule = "schedule"
+	MaintenanceTriggerRunbook  = "runbook"
+
+	MaintenanceRunning   = "running"
+	MaintenanceCompleted = "completed"
+	MaintenanceFailed    = "failed"
+)
+
+// Maintenance step outcomes.
+const (
+	MaintenanceStepDone    = "done"
+	MaintenanceStepSkipped = "skipped"
+	MaintenanceStepFailed  = "failed"
+)
+
+// ErrMaintenanceRunning is returned when a run is started while another
+// is in progress.
+var ErrMaintenanceRunning = errors.New("catalog maintenance is already running")
+
+// Defaults of the maintenance schedule until an admin changes it:
+// nightly at 03:30 for at most an hour.
+const (
+	defaultMaintenanceCron   = "30 3 * * *"
+	defaultMaintenanceWindow = 60
+)
+
+// incrementalVacuumPages is how many free pages one incremental vacuum
+// releases, so a run can stop between batches when its window ends.
+const incrementalVacuumPages = 2048
+
+// DatabaseSize is the size of the catalog database. FreeBytes is the
+// space inside the file a vacuum can release and WALBytes the size of the
+// write-ahead log beside it; both are zero on PostgreSQL.
+type DatabaseSize struct {
+	TotalBytes int64 `json:"total_bytes"`
+	FreeBytes  int64 `json:"free_bytes"`
+	WALBytes   int64 `json:"wal_bytes"`
+}
+
+// MaintenanceStep is the outcome of one step of a maintenance run.
+type MaintenanceStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// MaintenanceRun is one run of the maintenance job. ReclaimedBytes is how
+// much smaller the database and its log are after the run.
+type MaintenanceRun struct {
+	ID             int64             `json:"id"`
+	TriggeredBy    string            `json:"triggered_by"`
+	Status         string            `json:"status"`
+	FullVacuum     bool              `json:"full_vacuum"`
+	StartedAt      time.Time         `json:"started_at"`
+	FinishedAt     *time.Time        `json:"finished_at,omitempty"`
+	Before         *DatabaseSize     `json:"before,omitempty"`
+	After          *DatabaseSize     `json:"after,omitempty"`
+	ReclaimedBytes int64             `json:"reclaimed_bytes"`
+	Steps          []MaintenanceStep `json:"steps"`
+	Error          string            `json:"error,omitempty"`
+}
+
+// DatabaseBackup is a copy of the catalog database. Name and the upload
+// outcome are only set on backups kept by BackupService.
+type DatabaseBackup struct {
+	Name        string    `json:"name,omitempty"`
+	Path        string    `json:"path"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Encrypted   bool      `json:"encrypted"`
+	CreatedAt   time.Time `json:"created_at"`
+	Uploaded    bool      `json:"uploaded,omitempty"`
+	UploadError string    `json:"upload_error,omitempty"`
+}
+
+// MaintenanceSchedule is when scheduled maintenance runs. Steps not
+// reached WindowMinutes after the start are skipped until the next run.
+// The cron fields are read on the wall clock of TimeZone, an IANA name, or
+// of the server when it is empty.
+type MaintenanceSchedule struct {
+	Cron          string     `json:"cron"`
+	TimeZone      string     `json:"time_zone"`
+	Enabled       bool       `json:"enabled"`
+	WindowMinutes int        `json:"window_minutes"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// NextRunAtLocal repeats NextRunAt in DisplayTimeZone, the time zone
+	// of the user reading the schedule.
+	NextRunAtLocal  *time.Time `json:"next_run_at_local,omitempty"`
+	DisplayTimeZone string     `json:"display_time_zone,omitempty"`
+}
+
+// Localize puts the schedule's next run in UTC and fills in its
+// representation in loc.
+func (s *MaintenanceSchedule) Localize(loc *time.Location) {
+	s.NextRunAt = models.TimeIn(s.NextRunAt, time.UTC)
+	s.NextRunAtLocal = models.TimeIn(s.NextRunAt, loc)
+	s.DisplayTimeZone = loc.String()
+}
+
+// MaintenanceScheduleRequest changes the maintenance schedule. Fields
+// left out keep their value.
+type MaintenanceScheduleRequest struct {
+	Cron          *string `json:"cron"`
+	TimeZone      *string `json:"time_zone"`
+	Enabled       *bool   `json:"enabled"`
+	WindowMinutes *int    `json:"window_minutes"`
+}
+
+// MaintenanceStatus is the current state of the catalog database and its
+// maintenance.
+type MaintenanceStatus struct {
+	Size     *DatabaseSize        `json:"size"`
+	Schedule *MaintenanceSchedule `json:"schedule"`
+	Running  *MaintenanceRun      `json:"running,omitempty"`
+	LastRun  *MaintenanceRun      `json:"last_run,omitempty"`
+}
+
+// MaintenanceConfig controls how often the maintenance schedule is
+// checked.
+type MaintenanceConfig struct {
+	CheckInterval time.Duration
+}
+
+// CatalogMaintenanceService keeps the catalog database compact and its
+// query plans current. A run rebuilds indexes, refreshes planner
+// statistics, releases free pages and checkpoints the write-ahead log,
+// recording the size of the database before and after. Runs start on
+// demand or from a cron schedule set to low-usage hours, and one runs at
+// a time.
+type CatalogMaintenanceService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config MaintenanceConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	running *MaintenanceRun
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewCatalogMaintenanceService creates a CatalogMaintenanceService that
+// checks its schedule every minute unless cfg says otherwise.
+func NewCatalogMaintenanceService(db *database.DB, logger *zap.Logger, cfg MaintenanceConfig) *CatalogMaintenanceService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Minute
+	}
+	return &CatalogMaintenanceService{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+// Status returns the size of the database, the schedule, the run in
+// progress if any and the last finished run.
+func (s *CatalogMaintenanceService) Status(ctx context.Context) (*MaintenanceStatus, error) {
+	size, err := s.Size(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.GetSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &MaintenanceStatus{Size: size, Schedule: schedule, Running: s.runningSnapshot()}
+
+	runs, err := s.listRuns(ctx, `WHERE status <> ?`, []interface{}{MaintenanceRunning}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) > 0 {
+		status.LastRun = &runs[0]
+	}
+	return status, nil
+}
+
+// Size returns the current size of the catalog database.
+func (s *CatalogMaintenanceService) Size(ctx context.Context) (*DatabaseSize, error) {
+	var size DatabaseSize
+	if s.db.Dialect().IsPostgres() {
+		if err := s.db.QueryRowContext(ctx, `SELECT pg_database_size(current_database())`).Scan(&size.TotalBytes); err != nil {
+			return nil, fmt.Errorf("failed to read database size: %w", err)
+		}
+		return &size, nil
+	}
+
+	var pageSize, pages, free int64
+	for pragma, dest := range map[string]*int64{"page_size": &pageSize, "page_count": &pages, "freelist_count": &free} {
+		if err := s.db.QueryRowContext(ctx, `PRAGMA `+pragma).Scan(dest); err != nil {
+			return nil, fmt.Errorf("failed to read database size: %w", err)
+		}
+	}
+	size.TotalBytes, size.FreeBytes = pages*pageSize, free*pageSize
+	if file := s.databaseFile(ctx); file != "" {
+		if info, err := os.Stat(file + "-wal"); err == nil {
+			size.WALBytes = info.Size()
+		}
+	}
+	return &size, nil
+}
+
+// databaseFile returns the path of the main SQLite database file, or ""
+// for an in-memory database.
+func (s *CatalogMaintenanceService) databaseFile(ctx context.Context) string {
+	return sqliteDatabaseFile(ctx, s.db)
+}
+
+func sqliteDatabaseFile(ctx context.Context, db *database.DB) string {
+	rows, err := db.QueryContext(ctx, `PRAGMA database_list`)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		var name string
+		var file sql.NullString
+		if rows.Scan(&seq, &name, &file) == nil && name == "main" {
+			return file.String
+		}
+	}
+	return ""
+}
+
+// GetSchedule returns the maintenance schedule, creating the default one
+// the first time.
+func (s *CatalogMaintenanceService) GetSchedule(ctx context.Context) (*MaintenanceSchedule, error) {
+	schedule, err := s.loadSchedule(ctx)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			return nil, fmt.Errorf("failed to load maintenance schedule: %w", err)
+		}
+		return schedule, nil
+	}
+
+	cron, _ := parseCronSchedule(defaultMaintenanceCron)
+	next := cron.Next(s.now())
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO maintenance_schedule (id, cron, enabled, window_minutes, next_run_at, updated_at) VALUES (1, ?, ?, ?, ?, ?)`,
+		defaultMaintenanceCron, true, defaultMaintenanceWindow, next, s.now()); err != nil {
+		return nil, fmt.Errorf("failed to create maintenance schedule: %w", err)
+	}
+	return s.GetSchedule(ctx)
+}
+
+func (s *CatalogMaintenanceService) loadSchedule(ctx context.Context) (*MaintenanceSchedule, error) {
+	var schedule MaintenanceSchedule
+	var next sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT cron, time_zone, enabled, window_minutes, next_run_at, updated_at FROM maintenance_schedule WHERE id = 1`).
+		Scan(&schedule.Cron, &schedule.TimeZone, &schedule.Enabled, &schedule.WindowMinutes, &next, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if next.Valid {
+		schedule.NextRunAt = &next.Time
+	}
+	return &schedule, nil
+}
+
+// UpdateSchedule changes the maintenance schedule and works out its next
+// run.
+func (s *CatalogMaintenanceService) UpdateSchedule(ctx context.Context, req MaintenanceScheduleRequest) (*MaintenanceSchedule, error) {
+	schedule, err := s.GetSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Cron != nil {
+		schedule.Cron = strings.TrimSpace(*req.Cron)
+	}
+	if req.TimeZone != nil {
+		schedule.TimeZone = strings.TrimSpace(*req.TimeZone)
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if req.WindowMinutes != nil {
+		if *req.WindowMinutes < 1 || *req.WindowMinutes > 24*60 {
+			return nil, fmt.Errorf("invalid maintenance window: window_minutes must be between 1 and 1440")
+		}
+		schedule.WindowMinutes = *req.WindowMinutes
+	}
+	cron, err := parseCronSchedule(schedule.Cron)
+	if err != nil {
+		return nil, err
+	}
+	t, err := cron.NextIn(s.now(), schedule.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance schedule: %w", err)
+	}
+
+	var next *time.Time
+	if schedule.Enabled && !t.IsZero() {
+		next = &t
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE maintenance_schedule SET cron = ?, time_zone = ?, enabled = ?, window_minutes = ?, next_run_at = ?, updated_at = ? WHERE id = 1`,
+		schedule.Cron, schedule.TimeZone, schedule.Enabled, schedule.WindowMinutes, next, s.now()); err != nil {
+		return nil, fmt.Errorf("failed to save maintenance schedule: %w", err)
+	}
+	return s.GetSchedule(ctx)
+}
+
+// StartRun starts a maintenance run in the background and returns it.
+// A full vacuum rebuilds the whole database file, which on SQLite also
+// switches it to incremental vacuuming so later runs can release free
+// pages without a rebuild.
+func (s *CatalogMaintenanceService) StartRun(ctx context.Context, fullVacuum bool) (*MaintenanceRun, error) {
+	run, err := s.begin(ctx, MaintenanceTriggerManual, fullVacuum)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := s.runningSnapshot()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(context.Background(), run, time.Time{})
+	}()
+	return snapshot, nil
+}
+
+// Run runs maintenance and waits for it to finish, for callers that
+// sequence it with other work. Once started, the run is not interrupted
+// by ctx.
+func (s *CatalogMaintenanceService) Run(ctx context.Context, trigger string, fullVacuum bool) (*MaintenanceRun, error) {
+	run, err := s.begin(ctx, trigger, fullVacuum)
+	if err != nil {
+		return nil, err
+	}
+	s.execute(context.WithoutCancel(ctx), run, time.Time{})
+	return run, nil
+}
+
+// Backup writes a copy of the SQLite catalog database into dir, named
+// after the time it was taken. sqlcipher_export copies every table in one
+// transaction, so the copy is consistent while writers carry on.
+func (s *CatalogMaintenanceService) Backup(ctx context.Context, dir string) (*DatabaseBackup, error) {
+	if s.db.Dialect().IsPostgres() {
+		return nil, fmt.Errorf("database backups are not supported on PostgreSQL; use pg_dump")
+	}
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("invalid backup directory %q: the path must be absolute", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	created := s.now()
+	path := filepath.Join(dir, "catalog-"+created.UTC().Format("20060102-150405")+".db")
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", path)
+	}
+	if err := s.exportDatabase(ctx, path); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	s.logger.Info("Catalog database backed up", zap.String("path", path), zap.Int64("size_bytes", info.Size()))
+	return &DatabaseBackup{Path: path, SizeBytes: info.Size(), Encrypted: s.db.EncryptionKey() != "", CreatedAt: created}, nil
+}
+
+// exportDatabase copies the database into a new file at path, encrypted
+// with the same key as the database when it is encrypted.
+func (s *CatalogMaintenanceService) exportDatabase(ctx context.Context, path string) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return exportSQLite(ctx, conn, path, s.db.EncryptionKey())
+}
+
+// exportSQLite copies the database conn reads into a new file at path,
+// keyed with key unless it is empty. The file is attached to one
+// connection, as attachments are per connection, and cannot be attached
+// inside a transaction.
+func exportSQLite(ctx context.Context, conn *sql.Conn, path, key string) error {
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS backup KEY ?`, path, key); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `DETACH DATABASE backup`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT sqlcipher_export('backup')`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RunDue runs scheduled maintenance when it is due and waits for it to
+// finish. A run still in progress makes the schedule skip to its next
+// slot.
+func (s *CatalogMaintenanceService) RunDue(ctx context.Context) {
+	schedule, err := s.GetSchedule(ctx)
+	if err != nil {
+		s.logger.Error("Failed to load maintenance schedule", zap.Error(err))
+		return
+	}
+	now := s.now()
+	if !schedule.Enabled || schedule.NextRunAt == nil || schedule.NextRunAt.After(now) {
+		return
+	}
+
+	var next *time.Time
+	if cron, err := parseCronSchedule(schedule.Cron); err == nil {
+		if t, err := cron.NextIn(now, schedule.TimeZone); err == nil && !t.IsZero() {
+			next = &t
+		}
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE maintenance_schedule SET next_run_at = ? WHERE id = 1`, next); err != nil {
+		s.logger.Error("Failed to advance maintenance schedule", zap.Error(err))
+		return
+	}
+
+	run, err := s.begin(ctx, MaintenanceTriggerSchedule, false)
+	if err != nil {
+		s.logger.Warn("Skipped scheduled maintenance", zap.Error(err))
+		return
+	}
+	s.execute(ctx, run, now.Add(time.Duration(schedule.WindowMinutes)*time.Minute))
+}
+
+// begin records a new run unless one is in progress.
+func (s *CatalogMaintenanceService) begin(ctx context.Context, trigger string, fullVacuum bool) (*MaintenanceRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		return nil, ErrMaintenanceRunning
+	}
+
+	run := &MaintenanceRun{
+		TriggeredBy: trigger,
+		Status:      MaintenanceRunning,
+		FullVacuum:  fullVacuum,
+		StartedAt:   s.now(),
+		Steps:       []MaintenanceStep{},
+	}
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO maintenance_runs (triggered_by, status, full_vacuum, started_at) VALUES (?, ?, ?, ?)`,
+		run.TriggeredBy, run.Status, run.FullVacuum, run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record maintenance run: %w", err)
+	}
+	run.ID = id
+	s.running = run
+	return run, nil
+}
+
+// runningSnapshot returns a copy of the run in progress, or nil.
+func (s *CatalogMaintenanceService) runningSnapshot() *MaintenanceRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == nil {
+		return nil
+	}
+	run := *s.running
+	run.Steps = append([]MaintenanceStep(nil), s.running.Steps...)
+	return &run
+}
+
+type maintenanceStep struct {
+	name string
+	run  func(ctx context.Context, conn *sql.Conn, deadline time.Time) (status, detail string, err error)
+}
+
+// execute runs every step, recording each as it finishes. A failed step
+// does not stop the ones after it. Once the deadline passes, steps other
+// than the WAL checkpoint are skipped; the checkpoint is quick and leaves
+// the log at its smallest.
+func (s *CatalogMaintenanceService) execute(ctx context.Context, run *MaintenanceRun, deadline time.Time) {
+	var failures []string
+	fail := func(what string, err error) {
+		failures = append(failures, fmt.Sprintf("%s: %v", what, err))
+		s.logger.Warn("Catalog maintenance step failed", zap.Int64("run_id", run.ID), zap.String("step", what), zap.Error(err))
+	}
+
+	if before, err := s.Size(ctx); err != nil {
+		fail("size", err)
+	} else {
+		s.update(func() { run.Before = before })
+	}
+
+	if err := s.runSteps(ctx, run, deadline, fail); err != nil {
+		fail("connect", err)
+	}
+
+	after, err := s.Size(ctx)
+	if err != nil {
+		fail("size", err)
+	}
+	finished := s.now()
+	s.update(func() {
+		run.After, run.FinishedAt = after, &finished
+		if run.Before != nil && run.After != nil {
+			run.ReclaimedBytes = (run.Before.TotalBytes + run.Before.WALBytes) - (run.After.TotalBytes + run.After.WALBytes)
+		}
+		run.Status = MaintenanceCompleted
+		if len(failures) > 0 {
+			run.Status, run.Error = MaintenanceFailed, strings.Join(failures, "; ")
+		}
+	})
+
+	if err := s.saveRun(ctx, run); err != nil {
+		s.logger.Error("Failed to save maintenance run", zap.Int64("run_id", run.ID), zap.Error(err))
+	}
+	s.mu.Lock()
+	s.running = nil
+	s.mu.Unlock()
+	s.logger.Info("Catalog maintenance finished", zap.Int64("run_id", run.ID), zap.String("status", run.Status),
+		zap.Int64("reclaimed_bytes", run.ReclaimedBytes))
+}
+
+// runSteps runs the steps of a run on one connection, since SQLite
+// pragmas such as auto_vacuum apply to the connection that sets them.
+func (s *CatalogMaintenanceService) runSteps(ctx context.Context, run *MaintenanceRun, deadline time.Time,
+	fail func(string, error)) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, step := range s.steps(run.FullVacuum) {
+		started := s.now()
+		var status, detail string
+		if !deadline.IsZero() && !started.Before(deadline) && step.name != "wal_checkpoint" {
+			status, detail = MaintenanceStepSkipped, "maintenance window ended"
+		} else if status, detail, err = step.run(ctx, conn, deadline); err != nil {
+			status, detail = MaintenanceStepFailed, err.Error()
+			fail(step.name, err)
+		}
+		result := MaintenanceStep{Name: step.name, Status: status, Detail: detail,
+			DurationMs: s.now().Sub(started).Milliseconds()}
+		s.update(func() { run.Steps = append(run.Steps, result) })
+	}
+	return nil
+}
+
+// update changes the run in progress under the lock Status reads it with.
+func (s *CatalogMaintenanceService) update(change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+}
+
+func (s *CatalogMaintenanceService) saveRun(ctx context.Context, run *MaintenanceRun) error {
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return err
+	}
+	var before, after DatabaseSize
+	if run.Before != nil {
+		before = *run.Before
+	}
+	if run.After != nil {
+		after = *run.After
+	}
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE maintenance_runs SET status = ?, finished_at = ?, size_before = ?, free_before = ?, wal_before = ?,
+		 size_after = ?, free_after = ?, wal_after = ?, steps = ?, error = ? WHERE id = ?`,
+		run.Status, run.FinishedAt, before.TotalBytes, before.FreeBytes, before.WALBytes,
+		after.TotalBytes, after.FreeBytes, after.WALBytes, string(steps), run.Error, run.ID)
+	return err
+}
+
+// steps returns the steps of a run for the database in use, in order:
+// indexes are rebuilt before statistics are gathered on them, and the
+// log is checkpointed last to take in what the other steps wrote.
+func (s *CatalogMaintenanceService) steps(fullVacuum bool) []maintenanceStep {
+	if s.db.Dialect().IsPostgres() {
+		return []maintenanceStep{
+			{"reindex", s.reindexPostgres},
+			{"analyze", execMaintenance(`ANALYZE`)},
+			{"vacuum", s.vacuumPostgres(fullVacuum)},
+			{"wal_checkpoint", func(context.Context, *sql.Conn, time.Time) (string, string, error) {
+				return MaintenanceStepSkipped, "PostgreSQL checkpoints its log itself", nil
+			}},
+		}
+	}
+	return []maintenanceStep{
+		{"reindex", execMaintenance(`REINDEX`)},
+		{"analyze", execMaintenance(`ANALYZE`)},
+		{"vacuum", s.vacuumSQLite(fullVacuum)},
+		{"wal_checkpoint", checkpointSQLite},
+	}
+}
+
+func execMaintenance(statement string) func(context.Context, *sql.Conn, time.Time) (string, string, error) {
+	return func(ctx context.Context, conn *sql.Conn, _ time.Time) (string, string, error) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return "", "", err
+		}
+		return MaintenanceStepDone, "", nil
+	}
+}
+
+func (s *CatalogMaintenanceService) reindexPostgres(ctx context.Context, conn *sql.Conn, _ time.Time) (string, string, error) {
+	var name string
+	if err := conn.QueryRowContext(ctx, `SELECT current_database()`).Scan(&name); err != nil {
+		return "", "", err
+	}
+	// Concurrent rebuilds keep the catalog writable while they run
+	if _, err := conn.ExecContext(ctx, `REINDEX DATABASE CONCURRENTLY "`+strings.ReplaceAll(name, `"`, `""`)+`"`); err != nil {
+		return "", "", err
+	}
+	return MaintenanceStepDone, "", nil
+}
+
+func (s *CatalogMaintenanceService) vacuumPostgres(fullVacuum bool) func(context.Context, *sql.Conn, time.Time) (string, string, error) {
+	statement := `VACUUM`
+	if fullVacuum {
+		statement = `VACUUM FULL`
+	}
+	return execMaintenance(statement)
+}
+
+// vacuumSQLite releases free pages. Without a full vacuum it needs the
+// database in incremental auto_vacuum mode and releases them in batches
+// until none are left or the deadline passes.
+func (s *CatalogMaintenanceService) vacuumSQLite(fullVacuum bool) func(context.Context, *sql.Conn, time.Time) (string, string, error) {
+	return func(ctx context.Context, conn *sql.Conn, deadline time.Time) (string, string, error) {
+		freePages := func() (int64, error) {
+			var n int64
+			err := conn.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&n)
+			return n, err
+		}
+		before, err := freePages()
+		if err != nil {
+			return "", "", err
+		}
+
+		if fullVacuum {
+			if _, err := conn.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+				return "", "", err
+			}
+			if _, err := conn.ExecContext(ctx, `VACUUM`); err != nil {
+				return "", "", err
+			}
+			return MaintenanceStepDone, fmt.Sprintf("rebuilt the database, releasing %d free pages", before), nil
+		}
+
+		var mode int
+		if err := conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+			return "", "", err
+		}
+		if mode != 2 {
+			return MaintenanceStepSkipped, "incremental vacuum is not enabled; run with full_vacuum once to enable it", nil
+		}
+
+		free := before
+		for free > 0 {
+			if !deadline.IsZero() && !s.now().Before(deadline) {
+				return MaintenanceStepDone, fmt.Sprintf("released %d free pages; the maintenance window ended with %d left",
+					before-free, free), nil
+			}
+			// incremental_vacuum releases a page per step, so its rows are
+			// read to the end rather than executed once
+			rows, err := conn.QueryContext(ctx, fmt.Sprintf(`PRAGMA incremental_vacuum(%d)`, incrementalVacuumPages))
+			if err != nil {
+				return "", "", err
+			}
+			for rows.Next() {
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return "", "", err
+			}
+			left, err := freePages()
+			if err != nil {
+				return "", "", err
+			}
+			if left >= free {
+				break
+			}
+			free = left
+		}
+		return MaintenanceStepDone, fmt.Sprintf("released %d free pages", before-free), nil
+	}
+}
+
+// checkpointSQLite copies the write-ahead log into the database and
+// truncates it.
+func checkpointSQLite(ctx context.Context, conn *sql.Conn, _ time.Time) (string, string, error) {
+	var busy, logPages, checkpointed int
+	if err := conn.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logPages, &checkpointed); err != nil {
+		return "", "", err
+	}
+	if logPages < 0 {
+		return MaintenanceStepSkipped, "the database is not in WAL mode", nil
+	}
+	if busy != 0 {
+		return MaintenanceStepDone, fmt.Sprintf("checkpointed %d of %d log pages; readers kept the log from being truncated",
+			checkpointed, logPages), nil
+	}
+	return MaintenanceStepDone, fmt.Sprintf("checkpointed %d log pages", checkpointed), nil
+}
+
+const maintenanceRunColumns = `id, triggered_by, status, full_vacuum, started_at, finished_at, size_before, free_before, wal_before,
+	size_after, free_after, wal_after, steps, error`
+
+func scanMaintenanceRun(row shareLinkScanner) (*MaintenanceRun, error) {
+	var run MaintenanceRun
+	var finished sql.NullTime
+	var sizes [6]sql.NullInt64
+	var steps string
+	var runErr sql.NullString
+	if err := row.Scan(&run.ID, &run.TriggeredBy, &run.Status, &run.FullVacuum, &run.StartedAt, &finished,
+		&sizes[0], &sizes[1], &sizes[2], &sizes[3], &sizes[4], &sizes[5], &steps, &runErr); err != nil {
+		return nil, err
+	}
+	if finished.Valid {
+		run.FinishedAt = &finished.Time
+	}
+	if sizes[0].Valid {
+		run.Before = &DatabaseSize{TotalBytes: sizes[0].Int64, FreeBytes: sizes[1].Int64, WALBytes: sizes[2].Int64}
+	}
+	if sizes[3].Valid {
+		run.After = &DatabaseSize{TotalBytes: sizes[3].Int64, FreeBytes: sizes[4].Int64, WALBytes: sizes[5].Int64}
+	}
+	if run.Before != nil && run.After != nil {
+		run.ReclaimedBytes = (run.Before.TotalBytes + run.Before.WALBytes) - (run.After.TotalBytes + run.After.WALBytes)
+	}
+	if err := json.Unmarshal([]byte(steps), &run.Steps); err != nil {
+		return nil, fmt.Errorf("invalid steps of maintenance run %d: %w", run.ID, err)
+	}
+	run.Error = runErr.String
+	return &run, nil
+}
+
+// GetRun returns a maintenance run, with its progress so far when it is
+// still running.
+func (s *CatalogMaintenanceService) GetRun(ctx context.Context, id int64) (*MaintenanceRun, error) {
+	if running := s.runningSnapshot(); running != nil && running.ID == id {
+		return running, nil
+	}
+	runs, err := s.listRuns(ctx, `WHERE id = ?`, []interface{}{id}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("maintenance run %d not found", id)
+	}
+	return &runs[0], nil
+}
+
+// ListRuns returns the most recent maintenance runs, newest first.
+func (s *CatalogMaintenanceService) ListRuns(ctx context.Context, limit int) ([]MaintenanceRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	runs, err := s.listRuns(ctx, "", nil, limit)
+	if err != nil {
+		return nil, err
+	}
+	if running := s.runningSnapshot(); running != nil {
+		for i := range runs {
+			if runs[i].ID == running.ID {
+				runs[i] = *running
+			}
+		}
+	}
+	return runs, nil
+}
+
+func (s *CatalogMaintenanceService) listRuns(ctx context.Context, where string, args []interface{}, limit int) ([]MaintenanceRun, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+maintenanceRunColumns+` FROM maintenance_runs `+where+` ORDER BY started_at DESC, id DESC LIMIT ?`,
+		append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list maintenance runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []MaintenanceRun{}
+	for rows.Next() {
+		run, err := scanMaintenanceRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// Start closes runs a restart interrupted and checks the schedule on the
+// configured interval until Stop is called.
+func (s *CatalogMaintenanceService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(context.Background(),
+		`UPDATE maintenance_runs SET status = ?, finished_at = ?, error = ? WHERE status = ?`,
+		MaintenanceFailed, s.now(), "interrupted by server restart", MaintenanceRunning); err != nil {
+		s.logger.Warn("Failed to close interrupted maintenance runs", zap.Error(err))
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunDue(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for a run in progress to finish.
+func (s *CatalogMaintenanceService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMaintenanceTestService(t *testing.T) (*CatalogMaintenanceService, *database.DB) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	sqlDB, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		PRAGMA journal_mode = WAL;
+		CREATE TABLE maintenance_schedule (
+			id INTEGER PRIMARY KEY,
+			cron TEXT NOT NULL,
+			time_zone TEXT NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL,
+			window_minutes INTEGER NOT NULL,
+			next_run_at DATETIME,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE maintenance_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			triggered_by TEXT NOT NULL,
+			status TEXT NOT NULL,
+			full_vacuum BOOLEAN NOT NULL,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			size_before BIGINT,
+			free_before BIGINT,
+			wal_before BIGINT,
+			size_after BIGINT,
+			free_after BIGINT,
+			wal_after BIGINT,
+			steps TEXT NOT NULL DEFAULT '[]',
+			error TEXT
+		);
+		CREATE TABLE files (id INTEGER PRIMARY KEY AUTOINCREMENT, path TEXT NOT NULL);
+		CREATE INDEX idx_files_path ON files(path);
+	`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewCatalogMaintenanceService(db, nil, MaintenanceConfig{}), db
+}
+
+// bloat fills the files table and deletes most of it again, leaving free
+// pages behind.
+func bloat(t *testing.T, db *database.DB) {
+	t.Helper()
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	for i := 0; i < 5000; i++ {
+		_, err := tx.Exec(`INSERT INTO files (path) VALUES (?)`, "/media/"+strings.Repeat("x", 200)+string(rune('a'+i%26)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	_, err = db.Exec(`DELETE FROM files WHERE id > 100`)
+	require.NoError(t, err)
+}
+
+func waitForMaintenance(t *testing.T, s *CatalogMaintenanceService, id int64) *MaintenanceRun {
+	t.Helper()
+	require.Eventually(t, func() bool { return s.runningSnapshot() == nil }, 10*time.Second, 10*time.Millisecond)
+	run, err := s.GetRun(context.Background(), id)
+	require.NoError(t, err)
+	return run
+}
+
+func stepsByName(run *MaintenanceRun) map[string]MaintenanceStep {
+	steps := map[string]MaintenanceStep{}
+	for _, step := range run.Steps {
+		steps[step.Name] = step
+	}
+	return steps
+}
+
+func TestCatalogMaintenance_FullVacuumThenIncremental(t *testing.T) {
+	s, db := newMaintenanceTestService(t)
+	ctx := context.Background()
+	bloat(t, db)
+
+	before, err := s.Size(ctx)
+	require.NoError(t, err)
+	assert.Positive(t, before.FreeBytes)
+	assert.Positive(t, before.WALBytes)
+
+	// Without incremental vacuuming enabled only a full vacuum compacts
+	started, err := s.StartRun(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, MaintenanceRunning, started.Status)
+	run := waitForMaintenance(t, s, started.ID)
+	assert.Equal(t, MaintenanceCompleted, run.Status, run.Error)
+	steps := stepsByName(run)
+	assert.Equal(t, MaintenanceStepDone, steps["reindex"].Status)
+	assert.Equal(t, MaintenanceStepDone, steps["analyze"].Status)
+	assert.Equal(t, MaintenanceStepSkipped, steps["vacuum"].Status)
+	assert.Equal(t, MaintenanceStepDone, steps["wal_checkpoint"].Status)
+	assert.Zero(t, run.After.WALBytes)
+
+	run, err = s.StartRun(ctx, true)
+	require.NoError(t, err)
+	run = waitForMaintenance(t, s, run.ID)
+	assert.Equal(t, MaintenanceCompleted, run.Status, run.Error)
+	assert.Equal(t, MaintenanceStepDone, stepsByName(run)["vacuum"].Status)
+	assert.Zero(t, run.After.FreeBytes)
+	assert.Less(t, run.After.TotalBytes, before.TotalBytes)
+	assert.Positive(t, run.ReclaimedBytes)
+
+	// The full vacuum switched the database to incremental vacuuming
+	bloat(t, db)
+	run, err = s.StartRun(ctx, false)
+	require.NoError(t, err)
+	run = waitForMaintenance(t, s, run.ID)
+	vacuum := stepsByName(run)["vacuum"]
+	assert.Equal(t, MaintenanceStepDone, vacuum.Status)
+	assert.Contains(t, vacuum.Detail, "released")
+	assert.Positive(t, run.Before.FreeBytes)
+	assert.Zero(t, run.After.FreeBytes)
+
+	runs, err := s.ListRuns(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, run.ID, runs[0].ID)
+	assert.Len(t, runs[0].Steps, 4)
+
+	status, err := s.Status(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, status.Running)
+	require.NotNil(t, status.LastRun)
+	assert.Equal(t, run.ID, status.LastRun.ID)
+}
+
+func TestCatalogMaintenance_OneRunAtATime(t *testing.T) {
+	s, _ := newMaintenanceTestService(t)
+	ctx := context.Background()
+
+	_, err := s.begin(ctx, MaintenanceTriggerManual, false)
+	require.NoError(t, err)
+	_, err = s.StartRun(ctx, false)
+	assert.ErrorIs(t, err, ErrMaintenanceRunning)
+}
+
+func TestCatalogMaintenance_RunAndBackup(t *testing.T) {
+	s, db := newMaintenanceTestService(t)
+	ctx := context.Background()
+	bloat(t, db)
+
+	run, err := s.Run(ctx, MaintenanceTriggerRunbook, true)
+	require.NoError(t, err)
+	assert.Equal(t, MaintenanceCompleted, run.Status, run.Error)
+	assert.Equal(t, MaintenanceTriggerRunbook, run.TriggeredBy)
+	assert.Nil(t, s.runningSnapshot())
+
+	_, err = s.Backup(ctx, "relative/dir")
+	assert.ErrorContains(t, err, "invalid backup directory")
+
+	s.now = func() time.Time { return time.Date(2024, 5, 1, 3, 30, 0, 0, time.UTC) }
+	dir := filepath.Join(t.TempDir(), "backups")
+	backup, err := s.Backup(ctx, dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "catalog-20240501-033000.db"), backup.Path)
+	assert.Positive(t, backup.SizeBytes)
+
+	copyDB, err := sql.Open("sqlite3", backup.Path)
+	require.NoError(t, err)
+	defer copyDB.Close()
+	var files int
+	require.NoError(t, copyDB.QueryRow(`SELECT COUNT(*) FROM files`).Scan(&files))
+	assert.Equal(t, 100, files)
+
+	_, err = s.Backup(ctx, dir)
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestCatalogMaintenance_Schedule(t *testing.T) {
+	s, _ := newMaintenanceTestService(t)
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	schedule, err := s.GetSchedule(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, defaultMaintenanceCron, schedule.Cron)
+	assert.True(t, schedule.Enabled)
+	require.NotNil(t, schedule.NextRunAt)
+	assert.True(t, schedule.NextRunAt.Equal(time.Date(2024, 5, 2, 3, 30, 0, 0, time.UTC)))
+
+	invalid := "not a cron"
+	_, err = s.UpdateSchedule(ctx, MaintenanceScheduleRequest{Cron: &invalid})
+	assert.ErrorContains(t, err, "invalid")
+	window := 0
+	_, err = s.UpdateSchedule(ctx, MaintenanceScheduleRequest{WindowMinutes: &window})
+	assert.ErrorContains(t, err, "invalid")
+
+	cron, window := "0 13 * * *", 30
+	schedule, err = s.UpdateSchedule(ctx, MaintenanceScheduleRequest{Cron: &cron, WindowMinutes: &window})
+	require.NoError(t, err)
+	assert.Equal(t, 30, schedule.WindowMinutes)
+	assert.True(t, schedule.NextRunAt.Equal(time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)))
+
+	// Not due yet
+	s.RunDue(ctx)
+	runs, err := s.ListRuns(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	// Due: the run happens, and steps past the window are skipped. The
+	// clock moves an hour per reading, so every step starts outside the
+	// window
+	now = time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		t := now
+		now = now.Add(time.Hour)
+		return t
+	}
+	s.RunDue(ctx)
+	runs, err = s.ListRuns(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	run := runs[0]
+	assert.Equal(t, MaintenanceTriggerSchedule, run.TriggeredBy)
+	steps := stepsByName(&run)
+	assert.Equal(t, MaintenanceStepSkipped, steps["reindex"].Status)
+	assert.Equal(t, "maintenance window ended", steps["analyze"].Detail)
+	assert.Equal(t, MaintenanceStepDone, steps["wal_checkpoint"].Status)
+
+	schedule, err = s.GetSchedule(ctx)
+	require.NoError(t, err)
+	assert.True(t, schedule.NextRunAt.After(time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)))
+
+	// 03:30 in New York on the day clocks go back is 08:30 UTC
+	now = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	cron, zone := "30 3 * * *", "America/New_York"
+	schedule, err = s.UpdateSchedule(ctx, MaintenanceScheduleRequest{Cron: &cron, TimeZone: &zone})
+	require.NoError(t, err)
+	assert.Equal(t, zone, schedule.TimeZone)
+	assert.True(t, schedule.NextRunAt.Equal(time.Date(2026, 11, 1, 8, 30, 0, 0, time.UTC)))
+	zone = "Mars/Base"
+	_, err = s.UpdateSchedule(ctx, MaintenanceScheduleRequest{TimeZone: &zone})
+	assert.ErrorContains(t, err, "invalid time zone")
+
+	enabled := false
+	schedule, err = s.UpdateSchedule(ctx, MaintenanceScheduleRequest{Enabled: &enabled})
+	require.NoError(t, err)
+	assert.Nil(t, schedule.NextRunAt)
+}
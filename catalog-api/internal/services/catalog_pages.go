@@ -0,0 +1,297 @@
+package services
+
+import (
+	"catalogizer/internal/models"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListPathPage lists a directory a page at a time. An empty cursor starts
+// at the first entry; the returned cursor continues after the last one,
+// and is empty once the listing is exhausted. Unlike an offset, a cursor
+// seeks straight to its position, so late pages of a directory with
+// hundreds of thousands of entries cost the same as the first.
+func (s *CatalogService) ListPathPage(ctx context.Context, path, sortBy, sortOrder, cursor string, limit int) ([]models.FileInfo, string, error) {
+	return s.listPath(ctx, path, sortBy, sortOrder, cursor, limit, 0)
+}
+
+// SearchFilesPage returns a page of search results continuing after
+// cursor, as ListPathPage does. req.Offset is ignored.
+func (s *CatalogService) SearchFilesPage(ctx context.Context, req *models.SearchRequest, cursor string) ([]models.FileInfo, string, error) {
+	return s.searchFiles(ctx, req, cursor, 0)
+}
+
+// DirectoriesBySizePage returns a page of GetDirectoriesBySize continuing
+// after cursor.
+func (s *CatalogService) DirectoriesBySizePage(ctx context.Context, smbRoot, cursor string, limit int) ([]models.DirectoryStats, string, error) {
+	return s.directoriesBySize(ctx, smbRoot, cursor, limit)
+}
+
+// DuplicateGroupsPage returns a page of GetDuplicateGroups continuing
+// after cursor.
+func (s *CatalogService) DuplicateGroupsPage(ctx context.Context, smbRoot string, minCount int, cursor string, limit int) ([]models.DuplicateGroup, string, error) {
+	return s.duplicateGroups(ctx, smbRoot, minCount, cursor, limit)
+}
+
+// keysetKind is the type of a sort key, which tells how to read it back
+// from a cursor.
+type keysetKind int
+
+const (
+	keysetString keysetKind = iota
+	keysetInt
+	keysetBool
+	keysetTime
+)
+
+// keysetColumn is one column of a keyset ordering, and how to read its
+// value from a row of the page.
+type keysetColumn[T any] struct {
+	expr  string
+	desc  bool
+	kind  keysetKind
+	value func(T) interface{}
+}
+
+// keyset orders rows by columns whose values together are unique, so a
+// page can continue after the last row of the previous one by its sort
+// keys, rather than skipping an offset's worth of rows. name tells
+// orderings apart, so a cursor is only used with the one it came from.
+type keyset[T any] struct {
+	name    string
+	columns []keysetColumn[T]
+}
+
+// pageCursor is what a cursor token encodes: the ordering and the sort
+// keys of the last row of a page.
+type pageCursor struct {
+	Order string            `json:"o"`
+	Keys  []json.RawMessage `json:"k"`
+}
+
+// fileKeyset orders files as ListPath and SearchFiles always have,
+// breaking ties by ID. sortOrder applies to the sort_by column, with
+// directories first when sorting by name by default.
+func fileKeyset(sortBy, sortOrder string) keyset[models.FileInfo] {
+	desc := sortOrder == "desc"
+	name := keysetColumn[models.FileInfo]{"f.name", desc, keysetString, func(f models.FileInfo) interface{} { return f.Name }}
+
+	var columns []keysetColumn[models.FileInfo]
+	switch sortBy {
+	case "name":
+		columns = append(columns, name)
+	case "size":
+		columns = append(columns, keysetColumn[models.FileInfo]{"f.size", desc, keysetInt, func(f models.FileInfo) interface{} { return f.Size }})
+	case "modified":
+		columns = append(columns, keysetColumn[models.FileInfo]{"f.modified_at", desc, keysetTime, func(f models.FileInfo) interface{} { return f.LastModified }})
+	default:
+		sortBy = "default"
+		columns = append(columns,
+			keysetColumn[models.FileInfo]{"f.is_directory", true, keysetBool, func(f models.FileInfo) interface{} { return f.IsDirectory }},
+			name)
+	}
+	columns = append(columns, keysetColumn[models.FileInfo]{"f.id", desc, keysetInt, func(f models.FileInfo) interface{} { return f.ID }})
+
+	direction := "asc"
+	if desc {
+		direction = "desc"
+	}
+	return keyset[models.FileInfo]{name: "files:" + sortBy + ":" + direction, columns: columns}
+}
+
+// directorySizeKeyset orders directories largest first, then by path.
+func directorySizeKeyset() keyset[models.DirectoryStats] {
+	return keyset[models.DirectoryStats]{name: "directories:size", columns: []keysetColumn[models.DirectoryStats]{
+		{"total_size", true, keysetInt, func(d models.DirectoryStats) interface{} { return d.TotalSize }},
+		{"path", false, keysetString, func(d models.DirectoryStats) interface{} { return d.Path }},
+	}}
+}
+
+// duplicateGroupKeyset orders duplicate groups with the most files first,
+// then the largest, then by hash.
+func duplicateGroupKeyset() keyset[models.DuplicateGroup] {
+	return keyset[models.DuplicateGroup]{name: "duplicates:count", columns: []keysetColumn[models.DuplicateGroup]{
+		{"group_count", true, keysetInt, func(g models.DuplicateGroup) interface{} { return int64(g.Count) }},
+		{"size", true, keysetInt, func(g models.DuplicateGroup) interface{} { return g.Size }},
+		{"sha256", false, keysetString, func(g models.DuplicateGroup) interface{} { return g.Hash }},
+	}}
+}
+
+// apply appends to query, which must end in a WHERE clause, the condition
+// selecting the rows after cursor, the ordering and a limit one row beyond
+// limit, which tells page whether another page follows.
+func (k keyset[T]) apply(query string, args []interface{}, cursor string, limit int) (string, []interface{}, error) {
+	if cursor != "" {
+		cond, keys, err := k.after(cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		query += " AND " + cond
+		args = append(args, keys...)
+	}
+
+	terms := make([]string, len(k.columns))
+	for i, col := range k.columns {
+		terms[i] = col.expr + " ASC"
+		if col.desc {
+			terms[i] = col.expr + " DESC"
+		}
+	}
+	query += " ORDER BY " + strings.Join(terms, ", ")
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+	return query, args, nil
+}
+
+// after decodes cursor into the condition selecting the rows after it:
+// for columns (a, b, c) ascending, a > ? OR (a = ? AND (b > ? OR (b = ?
+// AND c > ?))).
+func (k keyset[T]) after(cursor string) (string, []interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return "", nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if c.Order != k.name || len(c.Keys) != len(k.columns) {
+		return "", nil, fmt.Errorf("invalid cursor: it belongs to another ordering")
+	}
+
+	var cond string
+	var args []interface{}
+	for i := len(k.columns) - 1; i >= 0; i-- {
+		col := k.columns[i]
+		key, err := col.kind.decode(c.Keys[i])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		op := " > ?"
+		if col.desc {
+			op = " < ?"
+		}
+		if cond == "" {
+			cond, args = col.expr+op, []interface{}{key}
+			continue
+		}
+		cond = "(" + col.expr + op + " OR (" + col.expr + " = ? AND " + cond + "))"
+		args = append([]interface{}{key, key}, args...)
+	}
+	return "(" + cond + ")", args, nil
+}
+
+// page trims rows, fetched with apply, to limit, and returns the cursor
+// after the last of them when another page follows.
+func (k keyset[T]) page(rows []T, limit int) ([]T, string, error) {
+	if limit <= 0 || len(rows) <= limit {
+		return rows, "", nil
+	}
+	rows = rows[:limit]
+
+	c := pageCursor{Order: k.name, Keys: make([]json.RawMessage, len(k.columns))}
+	for i, col := range k.columns {
+		key, err := json.Marshal(col.value(rows[limit-1]))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		c.Keys[i] = key
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return rows, base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (kind keysetKind) decode(raw json.RawMessage) (interface{}, error) {
+	switch kind {
+	case keysetInt:
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case keysetBool:
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case keysetTime:
+		var v time.Time
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+}
+
+// queryFilePage runs a file query, which must end in a WHERE clause, for
+// a page in the keyset's order, by offset or continuing after cursor.
+func (s *CatalogService) queryFilePage(ctx context.Context, query string, args []interface{}, keys keyset[models.FileInfo], cursor string, limit, offset int) ([]models.FileInfo, string, error) {
+	query, args, err := keys.apply(query, args, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var files []models.FileInfo
+	for rows.Next() {
+		file, err := scanFileInfo(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan file: %w", err)
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	return keys.page(files, limit)
+}
+
+// scanFileInfo scans a row of the file columns catalog queries select.
+func scanFileInfo(rows *sql.Rows) (models.FileInfo, error) {
+	var file models.FileInfo
+	var lastModified sql.NullTime
+	var createdAt sql.NullTime
+	var updatedAt sql.NullTime
+	err := rows.Scan(
+		&file.ID, &file.Name, &file.Path, &file.IsDirectory, &file.Size,
+		&lastModified, &file.Hash, &file.Extension, &file.MimeType,
+		&file.ParentID, &file.SmbRoot, &createdAt, &updatedAt,
+	)
+	if err != nil {
+		return file, err
+	}
+	if lastModified.Valid {
+		file.LastModified = lastModified.Time
+	}
+	if createdAt.Valid {
+		file.CreatedAt = createdAt.Time
+	}
+	if updatedAt.Valid {
+		file.UpdatedAt = updatedAt.Time
+	}
+	if file.IsDirectory {
+		file.Type = "directory"
+	} else {
+		file.Type = "file"
+	}
+	return file, nil
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"catalogizer/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newCatalogPagesService catalogs /movies with two directories and five
+// files, several of which share a size or modification time, and a
+// second root with copies of two of them.
+func newCatalogPagesService(t *testing.T) *CatalogService {
+	t.Helper()
+	db := newMetadataRefreshTestDB(t)
+	s := NewCatalogService(nil, zap.NewNop())
+	s.SetDB(db)
+
+	ctx := context.Background()
+	_, err := db.ExecContext(ctx, `INSERT INTO storage_roots (id, name, protocol) VALUES (1, 'nas', 'local'), (2, 'backup', 'local')`)
+	require.NoError(t, err)
+	modified := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	insert := func(id, root int, path, name string, size int64, dir bool, parent interface{}, sha256 interface{}, modified time.Time) {
+		_, err := db.ExecContext(ctx, `INSERT INTO files (id, storage_root_id, path, name, size, is_directory, modified_at, parent_id, sha256)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, id, root, path, name, size, dir, modified, parent, sha256)
+		require.NoError(t, err)
+	}
+	insert(1, 1, "/movies", "movies", 0, true, nil, nil, modified)
+	insert(2, 1, "/movies/b.mkv", "b.mkv", 100, false, 1, "aaa", modified)
+	insert(3, 1, "/movies/extras", "extras", 0, true, 1, nil, modified)
+	insert(4, 1, "/movies/a.mkv", "a.mkv", 100, false, 1, "aaa", modified.Add(time.Hour))
+	insert(5, 1, "/movies/d.mkv", "d.mkv", 300, false, 1, "ccc", modified)
+	insert(6, 1, "/movies/c.mkv", "c.mkv", 100, false, 1, nil, modified)
+	insert(7, 1, "/movies/art", "art", 0, true, 1, nil, modified)
+	insert(8, 1, "/movies/e.mkv", "e.mkv", 5, false, 1, nil, modified)
+	insert(9, 2, "/b.mkv", "b.mkv", 100, false, nil, "aaa", modified)
+	insert(10, 2, "/d.mkv", "d.mkv", 300, false, nil, "ccc", modified)
+	return s
+}
+
+// collectPages follows next cursors from the first page to the last.
+func collectPages[T any](t *testing.T, fetch func(cursor string) ([]T, string, error)) [][]T {
+	t.Helper()
+	var pages [][]T
+	cursor := ""
+	for {
+		page, next, err := fetch(cursor)
+		require.NoError(t, err)
+		pages = append(pages, page)
+		if next == "" {
+			return pages
+		}
+		require.Less(t, len(pages), 10, "pages must end")
+		cursor = next
+	}
+}
+
+func fileNames(pages ...[]models.FileInfo) []string {
+	var names []string
+	for _, page := range pages {
+		for _, f := range page {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+func TestCatalogService_ListPathPage(t *testing.T) {
+	s := newCatalogPagesService(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		sortBy, sortOrder string
+		want              []string
+	}{
+		{"", "asc", []string{"art", "extras", "a.mkv", "b.mkv", "c.mkv", "d.mkv", "e.mkv"}},
+		{"name", "desc", []string{"extras", "e.mkv", "d.mkv", "c.mkv", "b.mkv", "art", "a.mkv"}},
+		{"size", "asc", []string{"extras", "art", "e.mkv", "b.mkv", "a.mkv", "c.mkv", "d.mkv"}},
+		{"size", "desc", []string{"d.mkv", "c.mkv", "a.mkv", "b.mkv", "e.mkv", "art", "extras"}},
+		{"modified", "desc", []string{"a.mkv", "e.mkv", "art", "c.mkv", "d.mkv", "extras", "b.mkv"}},
+	} {
+		name := tc.sortBy + " " + tc.sortOrder
+		pages := collectPages(t, func(cursor string) ([]models.FileInfo, string, error) {
+			return s.ListPathPage(ctx, "/movies", tc.sortBy, tc.sortOrder, cursor, 3)
+		})
+		require.Len(t, pages, 3, name)
+		assert.Len(t, pages[2], 1, name)
+		assert.Equal(t, tc.want, fileNames(pages...), name)
+
+		// Offsets page through the same order, ties and all
+		all, err := s.ListPath("/movies", tc.sortBy, tc.sortOrder, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, fileNames(all), name)
+		byOffset, err := s.ListPath("/movies", tc.sortBy, tc.sortOrder, 3, 3)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want[3:6], fileNames(byOffset), name)
+	}
+
+	// A listing that fits a page has no next cursor
+	files, next, err := s.ListPathPage(ctx, "/movies", "name", "asc", "", 7)
+	require.NoError(t, err)
+	assert.Len(t, files, 7)
+	assert.Empty(t, next)
+
+	_, next, err = s.ListPathPage(ctx, "/movies", "name", "asc", "", 2)
+	require.NoError(t, err)
+	_, _, err = s.ListPathPage(ctx, "/movies", "size", "asc", next, 2)
+	assert.ErrorContains(t, err, "invalid cursor", "a cursor only continues its own ordering")
+	_, _, err = s.ListPathPage(ctx, "/movies", "name", "asc", "not a cursor", 2)
+	assert.ErrorContains(t, err, "invalid cursor")
+	_, _, err = s.ListPathPage(ctx, "/series", "name", "asc", "", 2)
+	assert.ErrorContains(t, err, "path not found")
+}
+
+func TestCatalogService_SearchFilesPage(t *testing.T) {
+	s := newCatalogPagesService(t)
+	ctx := context.Background()
+	req := &models.SearchRequest{Query: ".mkv", SortBy: "name", SortOrder: "asc", Limit: 4}
+
+	pages := collectPages(t, func(cursor string) ([]models.FileInfo, string, error) {
+		return s.SearchFilesPage(ctx, req, cursor)
+	})
+	require.Len(t, pages, 2)
+	assert.Equal(t, []string{"a.mkv", "b.mkv", "b.mkv", "c.mkv", "d.mkv", "d.mkv", "e.mkv"}, fileNames(pages...))
+	assert.Equal(t, []string{"nas", "backup"}, []string{pages[0][1].SmbRoot, pages[0][2].SmbRoot}, "equal names are ordered by ID")
+
+	total, err := s.CountSearchResults(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), total)
+	files, total, err := s.SearchFiles(&models.SearchRequest{Query: ".mkv", SmbRoots: []string{"nas"}, SortBy: "size", Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	assert.Equal(t, []string{"b.mkv", "a.mkv"}, fileNames(files))
+}
+
+func TestCatalogService_StatsPages(t *testing.T) {
+	s := newCatalogPagesService(t)
+	ctx := context.Background()
+
+	groupPages := collectPages(t, func(cursor string) ([]models.DuplicateGroup, string, error) {
+		return s.DuplicateGroupsPage(ctx, "", 2, cursor, 1)
+	})
+	require.Len(t, groupPages, 2)
+	assert.Equal(t, "aaa", groupPages[0][0].Hash, "the largest group comes first")
+	assert.Equal(t, 3, groupPages[0][0].Count)
+	assert.Len(t, groupPages[0][0].Files, 3)
+	assert.Equal(t, "ccc", groupPages[1][0].Hash)
+	assert.Equal(t, int64(600), groupPages[1][0].TotalSize)
+	groups, err := s.GetDuplicateGroups("backup", 1, 0)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []string{"ccc", "aaa"}, []string{groups[0].Hash, groups[1].Hash}, "equal counts are ordered by size")
+
+	dirPages := collectPages(t, func(cursor string) ([]models.DirectoryStats, string, error) {
+		return s.DirectoriesBySizePage(ctx, "nas", cursor, 2)
+	})
+	var paths []string
+	for _, page := range dirPages {
+		for _, d := range page {
+			paths = append(paths, d.Path)
+		}
+	}
+	stats, err := s.GetDirectoriesBySize("nas", 10)
+	require.NoError(t, err)
+	var want []string
+	for _, d := range stats {
+		want = append(want, d.Path)
+	}
+	assert.Equal(t, want, paths)
+	assert.Len(t, paths, 3)
+
+	_, next, err := s.DuplicateGroupsPage(ctx, "", 2, "", 1)
+	require.NoError(t, err)
+	_, _, err = s.DirectoriesBySizePage(ctx, "nas", next, 2)
+	assert.ErrorContains(t, err, "invalid cursor")
+}
@@ -0,0 +1,621 @@
+package services
+
+import (
+	"bufio"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Playlist export formats.
+const (
+	PlaylistExportM3U  = "m3u"
+	PlaylistExportJSON = "json"
+)
+
+// smartPlaylistLimit caps how many items a smart playlist evaluates to.
+const smartPlaylistLimit = 500
+
+// CatalogPlaylist is a user's playlist of catalog media items. Regular
+// playlists keep their items in order; smart playlists have a Rule and
+// are evaluated when read.
+type CatalogPlaylist struct {
+	ID          int64                 `json:"id"`
+	UserID      int                   `json:"user_id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	IsPublic    bool                  `json:"is_public"`
+	IsSmart     bool                  `json:"is_smart"`
+	Rule        string                `json:"rule,omitempty"`
+	RuleKey     string                `json:"rule_key,omitempty"`
+	ItemCount   *int                  `json:"item_count,omitempty"`
+	Items       []CatalogPlaylistItem `json:"items,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+}
+
+// CatalogPlaylistItem is one entry of a playlist. ID is the playlist item
+// and is zero for smart playlists. FileID is the media item's primary
+// file, which the play queue streams.
+type CatalogPlaylistItem struct {
+	ID          int64  `json:"id,omitempty"`
+	Position    int    `json:"position"`
+	MediaItemID int64  `json:"media_item_id"`
+	Title       string `json:"title"`
+	MediaType   string `json:"media_type"`
+	Year        *int   `json:"year,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Runtime     *int   `json:"runtime,omitempty"`
+	FileID      *int64 `json:"file_id,omitempty"`
+}
+
+// CatalogPlaylistInput creates or updates a playlist. Nil fields are left
+// unchanged on update. Setting Rule makes a playlist smart and an empty
+// Rule makes it a regular playlist again.
+type CatalogPlaylistInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"is_public"`
+	Rule        *string `json:"rule"`
+}
+
+// PlaylistConfigSource provides users' playlist settings.
+type PlaylistConfigSource interface {
+	GetPlaylistConfig(ctx context.Context, userID int64) (*PlaylistConfig, error)
+}
+
+// CatalogPlaylistService manages playlists of catalog media items and
+// evaluates smart playlist rules against catalog metadata.
+type CatalogPlaylistService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config PlaylistConfigSource
+	now    func() time.Time
+}
+
+// NewCatalogPlaylistService creates a new CatalogPlaylistService.
+func NewCatalogPlaylistService(db *database.DB, logger *zap.Logger) *CatalogPlaylistService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &CatalogPlaylistService{db: db, logger: logger, now: time.Now}
+}
+
+// SetPlaylistConfigSource sets where users' playlist settings come from.
+// Without one every user has DefaultPlaylistConfig.
+func (s *CatalogPlaylistService) SetPlaylistConfigSource(source PlaylistConfigSource) {
+	s.config = source
+}
+
+func (s *CatalogPlaylistService) playlistConfig(ctx context.Context, userID int) *PlaylistConfig {
+	if s.config != nil {
+		config, err := s.config.GetPlaylistConfig(ctx, int64(userID))
+		if err == nil && config != nil {
+			return config
+		}
+		if err != nil {
+			s.logger.Warn("Failed to load playlist settings", zap.Int("user_id", userID), zap.Error(err))
+		}
+	}
+	return DefaultPlaylistConfig()
+}
+
+// ListPlaylists returns a user's playlists followed by other users'
+// public playlists. The smart playlists named in the user's playlist
+// settings are created first when the settings ask for it. Smart
+// playlists are not evaluated, so they have no item count.
+func (s *CatalogPlaylistService) ListPlaylists(ctx context.Context, userID int) ([]CatalogPlaylist, error) {
+	if config := s.playlistConfig(ctx, userID); config.AutoCreatePlaylists {
+		if err := s.ensureConfiguredPlaylists(ctx, userID, config); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+playlistColumns+`,
+		        (SELECT COUNT(*) FROM playlist_items pi
+		         JOIN media_items mi ON mi.id = pi.media_item_id
+		         WHERE pi.playlist_id = p.id AND mi.deleted_at IS NULL)
+		 FROM playlists p
+		 WHERE p.dismissed = ? AND p.deleted_at IS NULL AND (p.user_id = ? OR p.is_public = ?)
+		 ORDER BY CASE WHEN p.user_id = ? THEN 0 ELSE 1 END, p.name, p.id`,
+		false, userID, true, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlists: %w", err)
+	}
+	defer rows.Close()
+
+	var playlists []CatalogPlaylist
+	for rows.Next() {
+		var count int
+		p, err := scanPlaylist(rows, &count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan playlist: %w", err)
+		}
+		if !p.IsSmart {
+			p.ItemCount = &count
+		}
+		playlists = append(playlists, *p)
+	}
+	return playlists, rows.Err()
+}
+
+// ensureConfiguredPlaylists creates the smart playlists in a user's
+// settings that the user does not have yet. Entries are preset names or
+// rule expressions; entries that do not parse are skipped.
+func (s *CatalogPlaylistService) ensureConfiguredPlaylists(ctx context.Context, userID int, config *PlaylistConfig) error {
+	for _, key := range config.SmartPlaylistRules {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		name, rule := key, key
+		if preset, ok := SmartPlaylistPresets[key]; ok {
+			name, rule = preset.Name, preset.Rule
+		}
+		if _, err := ParseSmartPlaylistRule(rule); err != nil {
+			s.logger.Warn("Skipping smart playlist rule from playlist settings",
+				zap.String("rule", key), zap.Error(err))
+			continue
+		}
+
+		var exists int
+		err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM playlists WHERE user_id = ? AND smart_rule_key = ?`, userID, key).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check smart playlists: %w", err)
+		}
+		if exists > 0 {
+			continue
+		}
+		now := s.now()
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO playlists (user_id, name, is_public, is_smart_playlist, smart_criteria, smart_rule_key, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, name, config.PublicDefault, true, rule, key, now, now); err != nil {
+			return fmt.Errorf("failed to create smart playlist %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+const playlistColumns = `p.id, p.user_id, p.name, p.description, p.is_public, p.is_smart_playlist,
+	p.smart_criteria, p.smart_rule_key, p.created_at, p.updated_at`
+
+type playlistScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPlaylist(row playlistScanner, extra ...interface{}) (*CatalogPlaylist, error) {
+	var p CatalogPlaylist
+	dest := []interface{}{&p.ID, &p.UserID, &p.Name, &p.Description, &p.IsPublic, &p.IsSmart,
+		&p.Rule, &p.RuleKey, &p.CreatedAt, &p.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// loadPlaylist returns a playlist the user owns, or when owned is false,
+// one the user may see.
+func (s *CatalogPlaylistService) loadPlaylist(ctx context.Context, userID int, id int64, owned bool) (*CatalogPlaylist, error) {
+	p, err := scanPlaylist(s.db.QueryRowContext(ctx,
+		`SELECT `+playlistColumns+` FROM playlists p WHERE p.id = ? AND p.dismissed = ? AND p.deleted_at IS NULL`, id, false))
+	if err == sql.ErrNoRows || (err == nil && p.UserID != userID && (owned || !p.IsPublic)) {
+		return nil, fmt.Errorf("playlist not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playlist: %w", err)
+	}
+	return p, nil
+}
+
+// CreatePlaylist creates a playlist for a user. A playlist with a rule is
+// a smart playlist.
+func (s *CatalogPlaylistService) CreatePlaylist(ctx context.Context, userID int, input CatalogPlaylistInput) (*CatalogPlaylist, error) {
+	p := &CatalogPlaylist{UserID: userID, IsPublic: s.playlistConfig(ctx, userID).PublicDefault}
+	if err := applyPlaylistInput(p, input); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("invalid playlist: name is required")
+	}
+
+	p.CreatedAt = s.now()
+	p.UpdatedAt = p.CreatedAt
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO playlists (user_id, name, description, is_public, is_smart_playlist, smart_criteria, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.UserID, p.Name, p.Description, p.IsPublic, p.IsSmart, p.Rule, p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create playlist: %w", err)
+	}
+	p.ID = id
+	if !p.IsSmart {
+		zero := 0
+		p.ItemCount = &zero
+	}
+	return p, nil
+}
+
+// applyPlaylistInput copies the fields set in input onto p, checking the
+// name and rule.
+func applyPlaylistInput(p *CatalogPlaylist, input CatalogPlaylistInput) error {
+	if input.Name != nil {
+		p.Name = strings.TrimSpace(*input.Name)
+		if p.Name == "" {
+			return fmt.Errorf("invalid playlist: name is required")
+		}
+	}
+	if input.Description != nil {
+		p.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.IsPublic != nil {
+		p.IsPublic = *input.IsPublic
+	}
+	if input.Rule != nil {
+		p.Rule = strings.TrimSpace(ResolveSmartPlaylistRule(*input.Rule))
+		p.IsSmart = p.Rule != ""
+		if p.IsSmart {
+			if _, err := ParseSmartPlaylistRule(p.Rule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetPlaylist returns a playlist the user owns or that is public, with
+// its items. Smart playlists are evaluated for their owner.
+func (s *CatalogPlaylistService) GetPlaylist(ctx context.Context, userID int, id int64) (*CatalogPlaylist, error) {
+	p, err := s.loadPlaylist(ctx, userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsSmart {
+		p.Items, err = s.evaluateRule(ctx, p)
+	} else {
+		p.Items, err = s.playlistItems(ctx, p.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	count := len(p.Items)
+	p.ItemCount = &count
+	return p, nil
+}
+
+// UpdatePlaylist changes a user's playlist. Turning a regular playlist
+// into a smart one drops its items.
+func (s *CatalogPlaylistService) UpdatePlaylist(ctx context.Context, userID int, id int64, input CatalogPlaylistInput) (*CatalogPlaylist, error) {
+	p, err := s.loadPlaylist(ctx, userID, id, true)
+	if err != nil {
+		return nil, err
+	}
+	wasSmart := p.IsSmart
+	if err := applyPlaylistInput(p, input); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = s.now()
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE playlists SET name = ?, description = ?, is_public = ?, is_smart_playlist = ?, smart_criteria = ?, updated_at = ?
+		 WHERE id = ?`,
+		p.Name, p.Description, p.IsPublic, p.IsSmart, p.Rule, p.UpdatedAt, p.ID); err != nil {
+		return nil, fmt.Errorf("failed to update playlist: %w", err)
+	}
+	if p.IsSmart && !wasSmart {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM playlist_items WHERE playlist_id = ?`, p.ID); err != nil {
+			return nil, fmt.Errorf("failed to clear playlist items: %w", err)
+		}
+	}
+	return s.GetPlaylist(ctx, userID, id)
+}
+
+// DeletePlaylist moves a user's playlist to the recycle bin. Smart
+// playlists created from the user's playlist settings are dismissed
+// instead, so they are not created again.
+func (s *CatalogPlaylistService) DeletePlaylist(ctx context.Context, userID int, id int64) error {
+	p, err := s.loadPlaylist(ctx, userID, id, true)
+	if err != nil {
+		return err
+	}
+	if p.RuleKey != "" {
+		_, err = s.db.ExecContext(ctx, `UPDATE playlists SET dismissed = ?, updated_at = ? WHERE id = ?`, true, s.now(), p.ID)
+	} else {
+		_, err = s.db.SoftDelete(ctx, "playlists", p.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete playlist: %w", err)
+	}
+	return nil
+}
+
+// RestorePlaylist brings one of the user's deleted playlists back from the
+// recycle bin, or a dismissed smart playlist back into their list.
+func (s *CatalogPlaylistService) RestorePlaylist(ctx context.Context, userID int, id int64) (*CatalogPlaylist, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE playlists SET deleted_at = NULL, dismissed = ?, updated_at = ?
+		 WHERE id = ? AND user_id = ? AND (deleted_at IS NOT NULL OR dismissed = ?)`,
+		false, s.now(), id, userID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore playlist: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, fmt.Errorf("playlist not found")
+	}
+	return s.GetPlaylist(ctx, userID, id)
+}
+
+// AddItems adds media items to a user's regular playlist at position, or
+// at the end when position is 0. Positions start at 1.
+func (s *CatalogPlaylistService) AddItems(ctx context.Context, userID int, id int64, mediaItemIDs []int64, position int) (*CatalogPlaylist, error) {
+	p, err := s.editablePlaylist(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(mediaItemIDs) == 0 {
+		return nil, fmt.Errorf("invalid playlist items: media_item_ids is required")
+	}
+	for _, mediaItemID := range mediaItemIDs {
+		var exists int
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM media_items WHERE id = ? AND deleted_at IS NULL`, mediaItemID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to load media item %d: %w", mediaItemID, err)
+		}
+		if exists == 0 {
+			return nil, fmt.Errorf("media item %d not found", mediaItemID)
+		}
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM playlist_items WHERE playlist_id = ?`, p.ID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count playlist items: %w", err)
+	}
+	if position < 0 || position > count+1 {
+		return nil, fmt.Errorf("invalid position %d: the playlist has %d items", position, count)
+	}
+	if position == 0 {
+		position = count + 1
+	}
+
+	if position <= count {
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE playlist_items SET position = position + ? WHERE playlist_id = ? AND position >= ?`,
+			len(mediaItemIDs), p.ID, position); err != nil {
+			return nil, fmt.Errorf("failed to make room in playlist: %w", err)
+		}
+	}
+	now := s.now()
+	for i, mediaItemID := range mediaItemIDs {
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO playlist_items (playlist_id, media_item_id, position, added_by, added_at) VALUES (?, ?, ?, ?, ?)`,
+			p.ID, mediaItemID, position+i, userID, now); err != nil {
+			return nil, fmt.Errorf("failed to add playlist item: %w", err)
+		}
+	}
+	s.touch(ctx, p.ID)
+	return s.GetPlaylist(ctx, userID, id)
+}
+
+// RemoveItem removes an item from a user's regular playlist and closes
+// the gap it leaves.
+func (s *CatalogPlaylistService) RemoveItem(ctx context.Context, userID int, id, itemID int64) (*CatalogPlaylist, error) {
+	p, err := s.editablePlaylist(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	var position int
+	err = s.db.QueryRowContext(ctx,
+		`SELECT position FROM playlist_items WHERE id = ? AND playlist_id = ?`, itemID, p.ID).Scan(&position)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("playlist item %d not found", itemID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playlist item: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM playlist_items WHERE id = ?`, itemID); err != nil {
+		return nil, fmt.Errorf("failed to remove playlist item: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE playlist_items SET position = position - 1 WHERE playlist_id = ? AND position > ?`,
+		p.ID, position); err != nil {
+		return nil, fmt.Errorf("failed to renumber playlist items: %w", err)
+	}
+	s.touch(ctx, p.ID)
+	return s.GetPlaylist(ctx, userID, id)
+}
+
+// ReorderItems puts a user's regular playlist in the order of itemIDs,
+// which must list every item of the playlist once.
+func (s *CatalogPlaylistService) ReorderItems(ctx context.Context, userID int, id int64, itemIDs []int64) (*CatalogPlaylist, error) {
+	p, err := s.editablePlaylist(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.playlistItems(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[int64]bool, len(items))
+	for _, item := range items {
+		current[item.ID] = true
+	}
+	if len(itemIDs) != len(items) {
+		return nil, fmt.Errorf("invalid order: expected %d item ids, got %d", len(items), len(itemIDs))
+	}
+	for _, itemID := range itemIDs {
+		if !current[itemID] {
+			return nil, fmt.Errorf("invalid order: item %d is not in the playlist or is listed twice", itemID)
+		}
+		delete(current, itemID)
+	}
+
+	for i, itemID := range itemIDs {
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE playlist_items SET position = ? WHERE id = ?`, i+1, itemID); err != nil {
+			return nil, fmt.Errorf("failed to reorder playlist: %w", err)
+		}
+	}
+	s.touch(ctx, p.ID)
+	return s.GetPlaylist(ctx, userID, id)
+}
+
+// editablePlaylist returns a user's playlist for item changes, which
+// smart playlists do not take.
+func (s *CatalogPlaylistService) editablePlaylist(ctx context.Context, userID int, id int64) (*CatalogPlaylist, error) {
+	p, err := s.loadPlaylist(ctx, userID, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsSmart {
+		return nil, fmt.Errorf("invalid playlist: smart playlist items follow its rule and cannot be edited")
+	}
+	return p, nil
+}
+
+func (s *CatalogPlaylistService) touch(ctx context.Context, id int64) {
+	if _, err := s.db.ExecContext(ctx, `UPDATE playlists SET updated_at = ? WHERE id = ?`, s.now(), id); err != nil {
+		s.logger.Warn("Failed to update playlist timestamp", zap.Int64("playlist_id", id), zap.Error(err))
+	}
+}
+
+// playlistItemColumns selects a media item with its type and primary
+// file; the query joins media_items mi and media_types mt.
+const playlistItemColumns = `mi.id, mt.name, mi.year, mi.genre, mi.runtime,
+	(SELECT mf.file_id FROM media_files mf WHERE mf.media_item_id = mi.id
+	 ORDER BY mf.is_primary DESC, mf.id LIMIT 1)`
+
+func (s *CatalogPlaylistService) playlistItems(ctx context.Context, playlistID int64) ([]CatalogPlaylistItem, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT pi.id, pi.position, COALESCE(NULLIF(pi.custom_title, ''), mi.title), `+playlistItemColumns+`
+		 FROM playlist_items pi
+		 JOIN media_items mi ON mi.id = pi.media_item_id
+		 JOIN media_types mt ON mt.id = mi.media_type_id
+		 WHERE pi.playlist_id = ? AND mi.deleted_at IS NULL
+		 ORDER BY pi.position, pi.id`, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playlist items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []CatalogPlaylistItem
+	for rows.Next() {
+		var item CatalogPlaylistItem
+		if err := scanPlaylistItem(rows, &item, &item.ID, &item.Position, &item.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan playlist item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// evaluateRule returns the media items matching a smart playlist's rule
+// for its owner, newest first.
+func (s *CatalogPlaylistService) evaluateRule(ctx context.Context, p *CatalogPlaylist) ([]CatalogPlaylistItem, error) {
+	rule, err := ParseSmartPlaylistRule(p.Rule)
+	if err != nil {
+		return nil, err
+	}
+	where, args := rule.where(s.now())
+	args = append([]interface{}{p.UserID}, args...)
+	args = append(args, smartPlaylistLimit)
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT mi.title, `+playlistItemColumns+`
+		 FROM media_items mi
+		 JOIN media_types mt ON mt.id = mi.media_type_id
+		 LEFT JOIN user_metadata um ON um.media_item_id = mi.id AND um.user_id = ?
+		 WHERE mi.deleted_at IS NULL AND (`+where+`)
+		 ORDER BY mi.first_detected DESC, mi.id DESC
+		 LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate smart playlist: %w", err)
+	}
+	defer rows.Close()
+
+	var items []CatalogPlaylistItem
+	for rows.Next() {
+		item := CatalogPlaylistItem{Position: len(items) + 1}
+		if err := scanPlaylistItem(rows, &item, &item.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan smart playlist item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func scanPlaylistItem(row playlistScanner, item *CatalogPlaylistItem, leading ...interface{}) error {
+	var year, runtime sql.NullInt64
+	var genre sql.NullString
+	var fileID sql.NullInt64
+	dest := append(leading, &item.MediaItemID, &item.MediaType, &year, &genre, &runtime, &fileID)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	item.Genre = genre.String
+	if year.Valid {
+		y := int(year.Int64)
+		item.Year = &y
+	}
+	if runtime.Valid {
+		r := int(runtime.Int64)
+		item.Runtime = &r
+	}
+	if fileID.Valid {
+		item.FileID = &fileID.Int64
+	}
+	return nil
+}
+
+// ExportPlaylist writes a playlist the user can see as a play queue. M3U
+// lists the stream URL of each item with a file under the request's base
+// URL; JSON is the playlist with its items.
+func (s *CatalogPlaylistService) ExportPlaylist(ctx context.Context, userID int, id int64, format string, w io.Writer) error {
+	if format != PlaylistExportM3U && format != PlaylistExportJSON {
+		return fmt.Errorf("invalid format %q: use %s or %s", format, PlaylistExportM3U, PlaylistExportJSON)
+	}
+	p, err := s.GetPlaylist(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if format == PlaylistExportJSON {
+		return json.NewEncoder(w).Encode(p)
+	}
+	return WritePlaylistM3U(w, p, RequestBaseURL(ctx))
+}
+
+// WritePlaylistM3U writes a playlist as extended M3U with a stream URL
+// per item. Items without a file cannot be played and are left out.
+func WritePlaylistM3U(w io.Writer, p *CatalogPlaylist, baseURL string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	fmt.Fprintf(bw, "#PLAYLIST:%s\n", m3uText(p.Name))
+	for _, item := range p.Items {
+		if item.FileID == nil {
+			continue
+		}
+		seconds := -1
+		if item.Runtime != nil && *item.Runtime > 0 {
+			seconds = *item.Runtime * 60
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", seconds, m3uText(item.Title))
+		fmt.Fprintf(bw, "%s/api/v1/stream/%d\n", strings.TrimRight(baseURL, "/"), *item.FileID)
+	}
+	return bw.Flush()
+}
+
+// m3uText keeps a title on its directive line.
+func m3uText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
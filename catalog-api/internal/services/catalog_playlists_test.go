@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubPlaylistConfig struct{ config *PlaylistConfig }
+
+func (s stubPlaylistConfig) GetPlaylistConfig(ctx context.Context, userID int64) (*PlaylistConfig, error) {
+	return s.config, nil
+}
+
+func newPlaylistTestService(t *testing.T) (*CatalogPlaylistService, *database.DB) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE media_types (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TABLE media_items (
+			id INTEGER PRIMARY KEY,
+			media_type_id INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			year INTEGER, genre TEXT, rating REAL, runtime INTEGER,
+			director TEXT, language TEXT, country TEXT, status TEXT,
+			first_detected DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
+		);
+		CREATE TABLE media_files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_item_id INTEGER NOT NULL,
+			file_id INTEGER NOT NULL,
+			is_primary BOOLEAN DEFAULT 0
+		);
+		CREATE TABLE user_metadata (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_item_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			user_rating REAL, watched_date DATETIME, favorite INTEGER DEFAULT 0
+		);
+		CREATE TABLE playlists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			is_public BOOLEAN NOT NULL DEFAULT FALSE,
+			is_smart_playlist BOOLEAN NOT NULL DEFAULT FALSE,
+			smart_criteria TEXT NOT NULL DEFAULT '',
+			smart_rule_key TEXT NOT NULL DEFAULT '',
+			dismissed BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
+		);
+		CREATE TABLE playlist_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			playlist_id INTEGER NOT NULL,
+			media_item_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			added_by INTEGER,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			custom_title TEXT NOT NULL DEFAULT ''
+		)`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	now := time.Now().UTC()
+	_, err = db.Exec(`INSERT INTO media_types (id, name) VALUES (1, 'music'), (2, 'movie')`)
+	require.NoError(t, err)
+	for _, item := range []struct {
+		id, typeID int
+		title      string
+		genre      string
+		rating     float64
+		runtime    int
+		added      time.Time
+	}{
+		{1, 1, "Kind of Blue", "Jazz", 9.1, 46, now.AddDate(0, 0, -3)},
+		{2, 1, "Blue Train", "jazz", 8.4, 42, now.AddDate(0, 0, -90)},
+		{3, 1, "Nevermind", "Rock", 8.8, 49, now.AddDate(0, 0, -1)},
+		{4, 2, "Whiplash", "Drama", 8.5, 107, now.AddDate(0, 0, -10)},
+	} {
+		_, err = db.Exec(`INSERT INTO media_items (id, media_type_id, title, genre, rating, runtime, first_detected) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			item.id, item.typeID, item.title, item.genre, item.rating, item.runtime, item.added)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO media_files (media_item_id, file_id, is_primary) VALUES (?, ?, 1)`, item.id, item.id*100)
+		require.NoError(t, err)
+	}
+	_, err = db.Exec(`INSERT INTO user_metadata (media_item_id, user_id, watched_date, favorite) VALUES (1, 7, ?, 1), (3, 8, ?, 1)`,
+		now.AddDate(0, 0, -2), now.AddDate(0, 0, -2))
+	require.NoError(t, err)
+
+	service := NewCatalogPlaylistService(db, nil)
+	service.SetPlaylistConfigSource(stubPlaylistConfig{&PlaylistConfig{}})
+	return service, db
+}
+
+func playlistMediaIDs(p *CatalogPlaylist) []int64 {
+	var ids []int64
+	for _, item := range p.Items {
+		ids = append(ids, item.MediaItemID)
+	}
+	return ids
+}
+
+func TestCatalogPlaylists_RegularItems(t *testing.T) {
+	service, db := newPlaylistTestService(t)
+	ctx := context.Background()
+
+	p, err := service.CreatePlaylist(ctx, 7, CatalogPlaylistInput{Name: strPtr(" Evening ")})
+	require.NoError(t, err)
+	assert.Equal(t, "Evening", p.Name)
+	assert.False(t, p.IsSmart)
+
+	p, err = service.AddItems(ctx, 7, p.ID, []int64{1, 2}, 0)
+	require.NoError(t, err)
+	p, err = service.AddItems(ctx, 7, p.ID, []int64{4}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 4, 2}, playlistMediaIDs(p))
+	assert.Equal(t, 3, *p.ItemCount)
+
+	_, err = service.AddItems(ctx, 7, p.ID, []int64{99}, 0)
+	assert.ErrorContains(t, err, "media item 99 not found")
+	_, err = service.AddItems(ctx, 7, p.ID, []int64{1}, 9)
+	assert.ErrorContains(t, err, "invalid position")
+
+	// Reordering needs every item exactly once
+	ids := []int64{p.Items[2].ID, p.Items[0].ID, p.Items[1].ID}
+	_, err = service.ReorderItems(ctx, 7, p.ID, []int64{ids[0], ids[0], ids[1]})
+	assert.ErrorContains(t, err, "invalid order")
+	p, err = service.ReorderItems(ctx, 7, p.ID, ids)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 1, 4}, playlistMediaIDs(p))
+
+	p, err = service.RemoveItem(ctx, 7, p.ID, p.Items[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 4}, playlistMediaIDs(p))
+	assert.Equal(t, []int{1, 2}, []int{p.Items[0].Position, p.Items[1].Position})
+
+	// Private playlists are invisible to other users
+	_, err = service.GetPlaylist(ctx, 8, p.ID)
+	assert.ErrorContains(t, err, "playlist not found")
+	_, err = service.AddItems(ctx, 8, p.ID, []int64{1}, 0)
+	assert.ErrorContains(t, err, "playlist not found")
+
+	// Items of media in the recycle bin are hidden
+	_, err = db.Exec(`UPDATE media_items SET deleted_at = ? WHERE id = 4`, time.Now().UTC())
+	require.NoError(t, err)
+	p, err = service.GetPlaylist(ctx, 7, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, playlistMediaIDs(p))
+	_, err = service.AddItems(ctx, 7, p.ID, []int64{4}, 0)
+	assert.ErrorContains(t, err, "media item 4 not found")
+
+	require.NoError(t, service.DeletePlaylist(ctx, 7, p.ID))
+	_, err = service.GetPlaylist(ctx, 7, p.ID)
+	assert.ErrorContains(t, err, "playlist not found")
+
+	// Only the owner can restore a deleted playlist
+	_, err = service.RestorePlaylist(ctx, 8, p.ID)
+	assert.ErrorContains(t, err, "playlist not found")
+	p, err = service.RestorePlaylist(ctx, 7, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, playlistMediaIDs(p))
+	_, err = service.RestorePlaylist(ctx, 7, p.ID)
+	assert.ErrorContains(t, err, "playlist not found")
+}
+
+func TestCatalogPlaylists_SmartRules(t *testing.T) {
+	service, _ := newPlaylistTestService(t)
+	ctx := context.Background()
+
+	_, err := service.CreatePlaylist(ctx, 7, CatalogPlaylistInput{Name: strPtr("Bad"), Rule: strPtr("genre<jazz")})
+	assert.ErrorContains(t, err, "invalid rule")
+
+	p, err := service.CreatePlaylist(ctx, 7, CatalogPlaylistInput{Name: strPtr("New jazz"), Rule: strPtr("genre=jazz AND added<30d")})
+	require.NoError(t, err)
+	assert.True(t, p.IsSmart)
+
+	p, err = service.GetPlaylist(ctx, 7, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, playlistMediaIDs(p))
+	require.NotNil(t, p.Items[0].FileID)
+	assert.Equal(t, int64(100), *p.Items[0].FileID)
+
+	_, err = service.AddItems(ctx, 7, p.ID, []int64{2}, 0)
+	assert.ErrorContains(t, err, "cannot be edited")
+
+	// User fields are evaluated for the owner
+	p, err = service.UpdatePlaylist(ctx, 7, p.ID, CatalogPlaylistInput{Rule: strPtr("favorites")})
+	require.NoError(t, err)
+	assert.Equal(t, "favorite=true", p.Rule)
+	assert.Equal(t, []int64{1}, playlistMediaIDs(p))
+
+	p, err = service.UpdatePlaylist(ctx, 7, p.ID, CatalogPlaylistInput{Rule: strPtr("NOT watched<30d AND type=music")})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, playlistMediaIDs(p))
+}
+
+func TestCatalogPlaylists_ConfiguredSmartPlaylists(t *testing.T) {
+	service, _ := newPlaylistTestService(t)
+	service.SetPlaylistConfigSource(stubPlaylistConfig{&PlaylistConfig{
+		AutoCreatePlaylists: true,
+		SmartPlaylistRules:  []string{"top_rated", "genre=rock", "mood=happy"},
+	}})
+	ctx := context.Background()
+
+	playlists, err := service.ListPlaylists(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, playlists, 2)
+	assert.Equal(t, "Top Rated", playlists[0].Name)
+	assert.Equal(t, "rating>=8", playlists[0].Rule)
+	assert.Nil(t, playlists[0].ItemCount)
+	assert.Equal(t, "genre=rock", playlists[1].Name)
+
+	// Listing again does not create them twice, and a deleted one stays
+	// deleted
+	require.NoError(t, service.DeletePlaylist(ctx, 7, playlists[1].ID))
+	playlists, err = service.ListPlaylists(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, playlists, 1)
+	assert.Equal(t, "top_rated", playlists[0].RuleKey)
+
+	// A dismissed smart playlist can be brought back
+	dismissedID := playlists[0].ID
+	require.NoError(t, service.DeletePlaylist(ctx, 7, dismissedID))
+	restored, err := service.RestorePlaylist(ctx, 7, dismissedID)
+	require.NoError(t, err)
+	assert.Equal(t, "top_rated", restored.RuleKey)
+	playlists, err = service.ListPlaylists(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, playlists, 1)
+
+	// Other users see public playlists after their own
+	_, err = service.CreatePlaylist(ctx, 8, CatalogPlaylistInput{Name: strPtr("Shared"), IsPublic: boolPtr(true)})
+	require.NoError(t, err)
+	playlists, err = service.ListPlaylists(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, playlists, 2)
+	assert.Equal(t, "Shared", playlists[1].Name)
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestCatalogPlaylists_Export(t *testing.T) {
+	service, _ := newPlaylistTestService(t)
+	ctx := WithRequestBaseURL(context.Background(), "https://media.example.com/")
+
+	p, err := service.CreatePlaylist(ctx, 7, CatalogPlaylistInput{Name: strPtr("Queue")})
+	require.NoError(t, err)
+	_, err = service.AddItems(ctx, 7, p.ID, []int64{2, 4}, 0)
+	require.NoError(t, err)
+
+	var m3u bytes.Buffer
+	require.NoError(t, service.ExportPlaylist(ctx, 7, p.ID, PlaylistExportM3U, &m3u))
+	assert.Equal(t, "#EXTM3U\n#PLAYLIST:Queue\n"+
+		"#EXTINF:2520,Blue Train\nhttps://media.example.com/api/v1/stream/200\n"+
+		"#EXTINF:6420,Whiplash\nhttps://media.example.com/api/v1/stream/400\n", m3u.String())
+
+	var out bytes.Buffer
+	require.NoError(t, service.ExportPlaylist(ctx, 7, p.ID, PlaylistExportJSON, &out))
+	var exported CatalogPlaylist
+	require.NoError(t, json.Unmarshal(out.Bytes(), &exported))
+	assert.Equal(t, []int64{2, 4}, playlistMediaIDs(&exported))
+
+	assert.ErrorContains(t, service.ExportPlaylist(ctx, 7, p.ID, "pls", &out), "invalid format")
+}
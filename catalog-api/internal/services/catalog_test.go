@@ -71,6 +71,7 @@ func (suite *CatalogServiceTestSuite) setupDatabase() {
 			size INTEGER,
 			modified_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			quick_hash TEXT,
+			sha256 TEXT,
 			extension TEXT,
 			mime_type TEXT,
 			file_type TEXT,
@@ -91,6 +92,16 @@ func (suite *CatalogServiceTestSuite) setupDatabase() {
 			total_size INTEGER DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);
+		CREATE TABLE IF NOT EXISTS duplicate_resolutions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file_id INTEGER NOT NULL,
+			sha256 TEXT NOT NULL,
+			action TEXT NOT NULL,
+			kept_file_id INTEGER,
+			resolved_by INTEGER,
+			resolved_at DATETIME NOT NULL,
+			UNIQUE(file_id, sha256)
+		);
 	`)
 	suite.Require().NoError(err)
 
@@ -198,14 +209,17 @@ func (suite *CatalogServiceTestSuite) TestSearch() {
 func (suite *CatalogServiceTestSuite) TestSearchDuplicates() {
 	// Add duplicate files
 	_, err := suite.db.Exec(`
-		INSERT INTO files (storage_root_id, name, path, is_directory, size, modified_at, quick_hash, parent_id)
-		VALUES (1, 'duplicate1.mp4', '/media/movies/duplicate1.mp4', 0, 1000000, CURRENT_TIMESTAMP, 'hash1',
+		INSERT INTO files (storage_root_id, name, path, is_directory, size, modified_at, quick_hash, sha256, parent_id)
+		VALUES (1, 'duplicate1.mp4', '/media/movies/duplicate1.mp4', 0, 1000000, CURRENT_TIMESTAMP, 'quick1', 'hash1',
 			(SELECT id FROM files WHERE path = '/media/movies' AND is_directory = 1)),
-		(1, 'duplicate2.mp4', '/media/movies/duplicate2.mp4', 0, 1000000, CURRENT_TIMESTAMP, 'hash1',
+		(1, 'duplicate2.mp4', '/media/movies/duplicate2.mp4', 0, 1000000, CURRENT_TIMESTAMP, 'quick1', 'hash1',
+			(SELECT id FROM files WHERE path = '/media/movies' AND is_directory = 1)),
+		(1, 'candidate.mp4', '/media/movies/candidate.mp4', 0, 1000000, CURRENT_TIMESTAMP, 'quick1', 'hash2',
 			(SELECT id FROM files WHERE path = '/media/movies' AND is_directory = 1))
 	`)
 	suite.Require().NoError(err)
 
+	// A matching quick hash alone does not make a duplicate
 	duplicates, err := suite.service.SearchDuplicates()
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), duplicates, 1)
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CatalogVersion identifies the state of a catalog listing or file, for
+// answering conditional requests without loading it. Tag changes whenever
+// the listing or file does; Modified is when it last changed, to the
+// second.
+type CatalogVersion struct {
+	Tag      string
+	Modified time.Time
+}
+
+// RootsVersion returns the version of the storage root list, which
+// changes as roots gain or lose top-level entries.
+func (s *CatalogService) RootsVersion(ctx context.Context) (*CatalogVersion, error) {
+	version, _, err := s.catalogVersion(ctx, "f.parent_id IS NULL")
+	return version, err
+}
+
+// ListingVersion returns the version of the listing of a directory, or
+// nil when ListPath would not find the path.
+func (s *CatalogService) ListingVersion(ctx context.Context, path string) (*CatalogVersion, error) {
+	var parentID int64
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM files WHERE path = ? LIMIT 1`, path).Scan(&parentID)
+	switch {
+	case err == sql.ErrNoRows && path == "/":
+		return s.RootsVersion(ctx)
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to check path: %w", err)
+	}
+	version, _, err := s.catalogVersion(ctx, "f.parent_id = ?", parentID)
+	return version, err
+}
+
+// FileVersion returns the version of a file or directory, by ID or path
+// as GetFileInfo finds it, or nil when there is none.
+func (s *CatalogService) FileVersion(ctx context.Context, pathOrID string) (*CatalogVersion, error) {
+	where, arg := "f.id = (SELECT id FROM files WHERE path = ? LIMIT 1)", interface{}(pathOrID)
+	if id, err := strconv.ParseInt(pathOrID, 10, 64); err == nil {
+		where, arg = "f.id = ?", id
+	}
+	version, count, err := s.catalogVersion(ctx, where, arg)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+	return version, nil
+}
+
+// catalogVersion summarizes the files matching where: how many there are,
+// the highest ID, which changes as files are replaced, their total size
+// and when they were last modified and scanned. Renaming a storage root
+// changes the version too, as listings show root names.
+func (s *CatalogService) catalogVersion(ctx context.Context, where string, args ...interface{}) (*CatalogVersion, int64, error) {
+	epoch := func(column string) string {
+		if s.db.Dialect().IsPostgres() {
+			return "COALESCE(EXTRACT(EPOCH FROM MAX(" + column + "))::BIGINT, 0)"
+		}
+		return "COALESCE(CAST(strftime('%s', MAX(" + column + ")) AS INTEGER), 0)"
+	}
+	query := fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(MAX(f.id), 0), COALESCE(SUM(f.size), 0), %s, %s,
+			(SELECT %s FROM storage_roots)
+		FROM files f
+		WHERE %s`,
+		epoch("f.modified_at"), epoch("f.last_scan_at"), epoch("updated_at"), where)
+
+	var count, maxID, size, modified, scanned, rootsUpdated int64
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&count, &maxID, &size, &modified, &scanned, &rootsUpdated); err != nil {
+		return nil, 0, fmt.Errorf("failed to get catalog version: %w", err)
+	}
+	latest := modified
+	for _, t := range []int64{scanned, rootsUpdated} {
+		if t > latest {
+			latest = t
+		}
+	}
+	version := &CatalogVersion{Tag: fmt.Sprintf("%d-%d-%d-%d-%d-%d", count, maxID, size, modified, scanned, rootsUpdated)}
+	if latest > 0 {
+		version.Modified = time.Unix(latest, 0).UTC()
+	}
+	return version, count, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCatalogService_Versions(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	s := NewCatalogService(nil, zap.NewNop())
+	s.SetDB(db)
+
+	modified := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	_, err := db.ExecContext(ctx, `INSERT INTO storage_roots (id, name, protocol, updated_at) VALUES (1, 'nas', 'local', '2026-01-01 00:00:00')`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO files (id, storage_root_id, path, name, size, is_directory, modified_at, last_scan_at, parent_id) VALUES
+		(1, 1, '/movies', 'movies', 0, 1, ?, ?, NULL),
+		(2, 1, '/movies/a.mkv', 'a.mkv', 100, 0, ?, ?, 1)`, modified, modified, modified, modified)
+	require.NoError(t, err)
+
+	roots, err := s.RootsVersion(ctx)
+	require.NoError(t, err)
+	listing, err := s.ListingVersion(ctx, "/movies")
+	require.NoError(t, err)
+	require.NotNil(t, listing)
+	assert.Equal(t, "1-2-100-1790856000-1790856000-1767225600", listing.Tag)
+	assert.Equal(t, modified, listing.Modified)
+	file, err := s.FileVersion(ctx, "/movies/a.mkv")
+	require.NoError(t, err)
+	require.NotNil(t, file)
+	byID, err := s.FileVersion(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, file, byID)
+
+	missing, err := s.ListingVersion(ctx, "/series")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	missing, err = s.FileVersion(ctx, "/movies/b.mkv")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// A file added by a scan changes the listing but not its siblings
+	_, err = db.ExecContext(ctx, `INSERT INTO files (id, storage_root_id, path, name, size, is_directory, modified_at, last_scan_at, parent_id)
+		VALUES (3, 1, '/movies/b.mkv', 'b.mkv', 50, 0, ?, ?, 1)`, modified, modified)
+	require.NoError(t, err)
+	changed, err := s.ListingVersion(ctx, "/movies")
+	require.NoError(t, err)
+	assert.NotEqual(t, listing.Tag, changed.Tag)
+	unchanged, err := s.FileVersion(ctx, "/movies/a.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, file.Tag, unchanged.Tag)
+	sameRoots, err := s.RootsVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, roots.Tag, sameRoots.Tag)
+
+	// So does a file changing in place
+	_, err = db.ExecContext(ctx, `UPDATE files SET size = 120, modified_at = ? WHERE id = 2`, modified.Add(time.Hour))
+	require.NoError(t, err)
+	updated, err := s.FileVersion(ctx, "2")
+	require.NoError(t, err)
+	assert.NotEqual(t, file.Tag, updated.Tag)
+	assert.Equal(t, modified.Add(time.Hour), updated.Modified)
+}
@@ -0,0 +1,681 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Recall job states. A job moves from pending to in_progress once the
+// backend accepted the request, to available when the file has been staged
+// on local disk, and to expired once the staged copy is removed again.
+const (
+	RecallStatusPending    = "pending"
+	RecallStatusInProgress = "in_progress"
+	RecallStatusAvailable  = "available"
+	RecallStatusFailed     = "failed"
+	RecallStatusExpired    = "expired"
+)
+
+// ErrNotColdStorage is returned when a recall is requested for a file whose
+// storage root is not a cold tier.
+var ErrNotColdStorage = errors.New("file is not on a cold storage tier")
+
+// ColdStorageTier marks a storage root as cold: its files are catalogued but
+// have to be recalled through Backend before they can be read.
+type ColdStorageTier struct {
+	StorageRoot    string          `json:"storage_root"`
+	Backend        string          `json:"backend"`
+	Config         json.RawMessage `json:"config"`
+	RetentionHours int             `json:"retention_hours"`
+	UpdatedAt      time.Time       `json:"updated_at,omitempty"`
+}
+
+// RecallJob tracks the recall of one catalogued file from a cold tier.
+type RecallJob struct {
+	ID           int64      `json:"id"`
+	FileID       int64      `json:"file_id"`
+	StorageRoot  string     `json:"storage_root"`
+	Path         string     `json:"path"`
+	Backend      string     `json:"backend"`
+	Status       string     `json:"status"`
+	RequestedBy  *int       `json:"requested_by,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	AvailableAt  *time.Time `json:"available_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	stagedPath string
+}
+
+// RecallBackend brings files back from offline media. Request starts the
+// recall, Ready reports whether the file can now be read and Retrieve copies
+// it out. Paths are relative to the storage root.
+type RecallBackend interface {
+	Request(ctx context.Context, path string) error
+	Ready(ctx context.Context, path string) (bool, error)
+	Retrieve(ctx context.Context, path string, w io.Writer) error
+}
+
+// RecallBackendFactory builds a backend from a tier's JSON configuration.
+type RecallBackendFactory func(ctx context.Context, config json.RawMessage) (RecallBackend, error)
+
+// RecallNotifier tells users about recall jobs that became available or failed.
+type RecallNotifier interface {
+	NotifyRecall(ctx context.Context, job *RecallJob) error
+}
+
+// RecallNotifierFunc adapts a plain function to the RecallNotifier interface.
+type RecallNotifierFunc func(ctx context.Context, job *RecallJob) error
+
+// NotifyRecall calls f(ctx, job).
+func (f RecallNotifierFunc) NotifyRecall(ctx context.Context, job *RecallJob) error {
+	return f(ctx, job)
+}
+
+// ColdStorageConfig configures where recalled files are staged, how often
+// outstanding recalls are polled and how long staged copies are kept for
+// tiers without their own retention.
+type ColdStorageConfig struct {
+	StagingDir       string
+	PollInterval     time.Duration
+	DefaultRetention time.Duration
+}
+
+// ColdStorageService manages cold storage tiers and the recall jobs that
+// make their files temporarily available.
+type ColdStorageService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	config    ColdStorageConfig
+	mu        sync.Mutex
+	backends  map[string]RecallBackendFactory
+	notifiers []RecallNotifier
+	processMu sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	now       func() time.Time
+}
+
+// NewColdStorageService creates a ColdStorageService with the built-in
+// "ltfs" and "glacier" backends registered.
+func NewColdStorageService(db *database.DB, logger *zap.Logger, cfg ColdStorageConfig) *ColdStorageService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.StagingDir == "" {
+		cfg.StagingDir = filepath.Join(".", "data", "recalls")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Minute
+	}
+	if cfg.DefaultRetention <= 0 {
+		cfg.DefaultRetention = 24 * time.Hour
+	}
+
+	s := &ColdStorageService{
+		db:       db,
+		logger:   logger,
+		config:   cfg,
+		backends: make(map[string]RecallBackendFactory),
+		now:      time.Now,
+	}
+	s.RegisterBackend("ltfs", NewLTFSRecallBackend)
+	s.RegisterBackend("glacier", NewGlacierRecallBackend)
+	return s
+}
+
+// RegisterBackend makes a recall backend available to tiers under name.
+func (s *ColdStorageService) RegisterBackend(name string, factory RecallBackendFactory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backends[name] = factory
+}
+
+// AddNotifier registers an additional recall notification channel.
+func (s *ColdStorageService) AddNotifier(notifier RecallNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifiers = append(s.notifiers, notifier)
+}
+
+func (s *ColdStorageService) openBackend(ctx context.Context, tier *ColdStorageTier) (RecallBackend, error) {
+	s.mu.Lock()
+	factory, ok := s.backends[tier.Backend]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown recall backend: %s", tier.Backend)
+	}
+	return factory(ctx, tier.Config)
+}
+
+// SetTier marks a storage root as cold. The backend configuration is
+// validated by building the backend before it is stored.
+func (s *ColdStorageService) SetTier(ctx context.Context, tier ColdStorageTier) error {
+	if tier.StorageRoot == "" {
+		return fmt.Errorf("storage root is required")
+	}
+	if tier.RetentionHours < 0 {
+		return fmt.Errorf("invalid tier: retention must not be negative")
+	}
+	if len(tier.Config) == 0 {
+		tier.Config = json.RawMessage("{}")
+	}
+	if _, err := s.openBackend(ctx, &tier); err != nil {
+		return fmt.Errorf("invalid tier: %w", err)
+	}
+
+	now := s.now()
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE cold_storage_tiers SET backend = ?, config = ?, retention_hours = ?, updated_at = ?
+		 WHERE storage_root = ?`,
+		tier.Backend, string(tier.Config), tier.RetentionHours, now, tier.StorageRoot)
+	if err != nil {
+		return fmt.Errorf("failed to save cold storage tier: %w", err)
+	}
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO cold_storage_tiers (storage_root, backend, config, retention_hours, updated_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		tier.StorageRoot, tier.Backend, string(tier.Config), tier.RetentionHours, now)
+	if err != nil {
+		return fmt.Errorf("failed to save cold storage tier: %w", err)
+	}
+	return nil
+}
+
+// GetTier returns the cold tier of a storage root, or nil when the root is
+// not cold.
+func (s *ColdStorageService) GetTier(ctx context.Context, storageRoot string) (*ColdStorageTier, error) {
+	tier := &ColdStorageTier{StorageRoot: storageRoot}
+	var config string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT backend, config, retention_hours, updated_at FROM cold_storage_tiers WHERE storage_root = ?`,
+		storageRoot).Scan(&tier.Backend, &config, &tier.RetentionHours, &tier.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cold storage tier: %w", err)
+	}
+	tier.Config = json.RawMessage(config)
+	return tier, nil
+}
+
+// ListTiers returns every configured cold tier.
+func (s *ColdStorageService) ListTiers(ctx context.Context) ([]ColdStorageTier, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT storage_root, backend, config, retention_hours, updated_at FROM cold_storage_tiers ORDER BY storage_root`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cold storage tiers: %w", err)
+	}
+	defer rows.Close()
+
+	var tiers []ColdStorageTier
+	for rows.Next() {
+		var tier ColdStorageTier
+		var config string
+		if err := rows.Scan(&tier.StorageRoot, &tier.Backend, &config, &tier.RetentionHours, &tier.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan cold storage tier: %w", err)
+		}
+		tier.Config = json.RawMessage(config)
+		tiers = append(tiers, tier)
+	}
+	return tiers, rows.Err()
+}
+
+// DeleteTier returns a storage root to normal, directly readable storage.
+// Outstanding recall jobs are left to finish or expire.
+func (s *ColdStorageService) DeleteTier(ctx context.Context, storageRoot string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM cold_storage_tiers WHERE storage_root = ?`, storageRoot)
+	if err != nil {
+		return fmt.Errorf("failed to delete cold storage tier: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("cold storage tier not found")
+	}
+	return nil
+}
+
+func (s *ColdStorageService) lookupFile(ctx context.Context, fileID int64) (string, string, error) {
+	var storageRoot, path string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sr.name, f.path FROM files f
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE f.id = ?`, fileID).Scan(&storageRoot, &path)
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("file not found")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up file: %w", err)
+	}
+	return storageRoot, path, nil
+}
+
+// RequestRecall asks the file's cold backend to bring it back online. A
+// recall that is still running or whose staged copy is still available is
+// returned instead of starting a new one.
+func (s *ColdStorageService) RequestRecall(ctx context.Context, fileID int64, userID *int) (*RecallJob, error) {
+	storageRoot, path, err := s.lookupFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	tier, err := s.GetTier(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	if tier == nil {
+		return nil, ErrNotColdStorage
+	}
+
+	if job, err := s.activeRecall(ctx, fileID); err != nil {
+		return nil, err
+	} else if job != nil {
+		return job, nil
+	}
+
+	now := s.now()
+	job := &RecallJob{
+		FileID:      fileID,
+		StorageRoot: storageRoot,
+		Path:        path,
+		Backend:     tier.Backend,
+		Status:      RecallStatusPending,
+		RequestedBy: userID,
+		RequestedAt: now,
+		UpdatedAt:   now,
+	}
+	job.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO recall_jobs (file_id, storage_root, path, backend, status, requested_by, requested_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.FileID, job.StorageRoot, job.Path, job.Backend, job.Status, job.RequestedBy, job.RequestedAt, job.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recall job: %w", err)
+	}
+
+	backend, err := s.openBackend(ctx, tier)
+	if err == nil {
+		err = backend.Request(ctx, path)
+	}
+	if err != nil {
+		s.failRecall(ctx, job, err)
+		return job, fmt.Errorf("failed to request recall: %w", err)
+	}
+
+	job.Status = RecallStatusInProgress
+	if err := s.updateRecall(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Recall requested",
+		zap.Int64("job_id", job.ID),
+		zap.String("storage_root", storageRoot),
+		zap.String("path", path),
+		zap.String("backend", tier.Backend))
+	return job, nil
+}
+
+const recallJobColumns = `id, file_id, storage_root, path, backend, status, requested_by, staged_path, error_message, requested_at, available_at, expires_at, updated_at`
+
+func scanRecallJob(row interface{ Scan(...interface{}) error }) (*RecallJob, error) {
+	var job RecallJob
+	var stagedPath sql.NullString
+	err := row.Scan(&job.ID, &job.FileID, &job.StorageRoot, &job.Path, &job.Backend, &job.Status,
+		&job.RequestedBy, &stagedPath, &job.ErrorMessage, &job.RequestedAt, &job.AvailableAt, &job.ExpiresAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.stagedPath = stagedPath.String
+	return &job, nil
+}
+
+func (s *ColdStorageService) activeRecall(ctx context.Context, fileID int64) (*RecallJob, error) {
+	job, err := scanRecallJob(s.db.QueryRowContext(ctx,
+		`SELECT `+recallJobColumns+` FROM recall_jobs
+		 WHERE file_id = ? AND status IN (?, ?, ?)
+		 ORDER BY id DESC LIMIT 1`,
+		fileID, RecallStatusPending, RecallStatusInProgress, RecallStatusAvailable))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up recall job: %w", err)
+	}
+	return job, nil
+}
+
+// GetRecall returns a recall job by ID.
+func (s *ColdStorageService) GetRecall(ctx context.Context, id int64) (*RecallJob, error) {
+	job, err := scanRecallJob(s.db.QueryRowContext(ctx,
+		`SELECT `+recallJobColumns+` FROM recall_jobs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("recall job not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recall job: %w", err)
+	}
+	return job, nil
+}
+
+// ListRecalls returns recall jobs, newest first. A nil userID lists the jobs
+// of every user.
+func (s *ColdStorageService) ListRecalls(ctx context.Context, userID *int) ([]RecallJob, error) {
+	query := `SELECT ` + recallJobColumns + ` FROM recall_jobs`
+	var args []interface{}
+	if userID != nil {
+		query += ` WHERE requested_by = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY requested_at DESC, id DESC`
+
+	return s.queryRecalls(ctx, query, args...)
+}
+
+func (s *ColdStorageService) queryRecalls(ctx context.Context, query string, args ...interface{}) ([]RecallJob, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recall jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []RecallJob
+	for rows.Next() {
+		job, err := scanRecallJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recall job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// StagedFile reports whether a file lives on a cold tier and, if so, the
+// local path of its recalled copy. The path is empty when the file has not
+// been recalled or its copy has expired.
+func (s *ColdStorageService) StagedFile(ctx context.Context, fileID int64) (string, bool, error) {
+	storageRoot, _, err := s.lookupFile(ctx, fileID)
+	if err != nil {
+		return "", false, err
+	}
+	tier, err := s.GetTier(ctx, storageRoot)
+	if err != nil || tier == nil {
+		return "", false, err
+	}
+
+	job, err := s.activeRecall(ctx, fileID)
+	if err != nil {
+		return "", true, err
+	}
+	if job == nil || job.Status != RecallStatusAvailable || job.stagedPath == "" {
+		return "", true, nil
+	}
+	if _, err := os.Stat(job.stagedPath); err != nil {
+		return "", true, nil
+	}
+	return job.stagedPath, true, nil
+}
+
+func (s *ColdStorageService) updateRecall(ctx context.Context, job *RecallJob) error {
+	job.UpdatedAt = s.now()
+	var stagedPath *string
+	if job.stagedPath != "" {
+		stagedPath = &job.stagedPath
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE recall_jobs SET status = ?, staged_path = ?, error_message = ?, available_at = ?, expires_at = ?, updated_at = ?
+		 WHERE id = ?`,
+		job.Status, stagedPath, job.ErrorMessage, job.AvailableAt, job.ExpiresAt, job.UpdatedAt, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update recall job: %w", err)
+	}
+	return nil
+}
+
+func (s *ColdStorageService) failRecall(ctx context.Context, job *RecallJob, cause error) {
+	msg := cause.Error()
+	job.Status = RecallStatusFailed
+	job.ErrorMessage = &msg
+	if err := s.updateRecall(ctx, job); err != nil {
+		s.logger.Error("Failed to record recall failure", zap.Int64("job_id", job.ID), zap.Error(err))
+	}
+	s.logger.Warn("Recall failed",
+		zap.Int64("job_id", job.ID),
+		zap.String("storage_root", job.StorageRoot),
+		zap.String("path", job.Path),
+		zap.Error(cause))
+	s.notify(ctx, job)
+}
+
+func (s *ColdStorageService) notify(ctx context.Context, job *RecallJob) {
+	s.mu.Lock()
+	notifiers := make([]RecallNotifier, len(s.notifiers))
+	copy(notifiers, s.notifiers)
+	s.mu.Unlock()
+
+	for _, notifier := range notifiers {
+		if err := notifier.NotifyRecall(ctx, job); err != nil {
+			s.logger.Error("Failed to deliver recall notification",
+				zap.Int64("job_id", job.ID),
+				zap.Error(err))
+		}
+	}
+}
+
+// ProcessRecalls stages every in-progress recall whose backend reports the
+// file as ready and removes staged copies past their expiry. It is called
+// periodically by Start; overlapping calls return immediately.
+func (s *ColdStorageService) ProcessRecalls(ctx context.Context) error {
+	if !s.processMu.TryLock() {
+		return nil
+	}
+	defer s.processMu.Unlock()
+
+	jobs, err := s.queryRecalls(ctx,
+		`SELECT `+recallJobColumns+` FROM recall_jobs WHERE status = ? ORDER BY id`, RecallStatusInProgress)
+	if err != nil {
+		return err
+	}
+
+	tiers := make(map[string]*ColdStorageTier)
+	backends := make(map[string]RecallBackend)
+	for i := range jobs {
+		job := &jobs[i]
+		tier, ok := tiers[job.StorageRoot]
+		if !ok {
+			if tier, err = s.GetTier(ctx, job.StorageRoot); err != nil {
+				return err
+			}
+			tiers[job.StorageRoot] = tier
+		}
+		if tier == nil {
+			s.failRecall(ctx, job, ErrNotColdStorage)
+			continue
+		}
+
+		backend, ok := backends[job.StorageRoot]
+		if !ok {
+			if backend, err = s.openBackend(ctx, tier); err != nil {
+				s.failRecall(ctx, job, err)
+				continue
+			}
+			backends[job.StorageRoot] = backend
+		}
+
+		ready, err := backend.Ready(ctx, job.Path)
+		if err != nil {
+			s.logger.Warn("Failed to check recall status", zap.Int64("job_id", job.ID), zap.Error(err))
+			continue
+		}
+		if !ready {
+			continue
+		}
+
+		if err := s.stage(ctx, backend, job); err != nil {
+			s.failRecall(ctx, job, err)
+			continue
+		}
+
+		now := s.now()
+		expires := now.Add(s.retention(tier))
+		job.Status = RecallStatusAvailable
+		job.AvailableAt = &now
+		job.ExpiresAt = &expires
+		if err := s.updateRecall(ctx, job); err != nil {
+			return err
+		}
+		s.logger.Info("Recalled file is available",
+			zap.Int64("job_id", job.ID),
+			zap.String("storage_root", job.StorageRoot),
+			zap.String("path", job.Path))
+		s.notify(ctx, job)
+	}
+
+	return s.expireRecalls(ctx)
+}
+
+func (s *ColdStorageService) retention(tier *ColdStorageTier) time.Duration {
+	if tier.RetentionHours > 0 {
+		return time.Duration(tier.RetentionHours) * time.Hour
+	}
+	return s.config.DefaultRetention
+}
+
+// stage copies a recalled file into the staging area, writing to a temporary
+// name first so a partial copy is never served.
+func (s *ColdStorageService) stage(ctx context.Context, backend RecallBackend, job *RecallJob) error {
+	dir := filepath.Join(s.config.StagingDir, strconv.FormatInt(job.ID, 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".recall-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	err = backend.Retrieve(ctx, job.Path, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	name := filepath.Base(filepath.FromSlash(strings.TrimPrefix(job.Path, "/")))
+	if name == "." || name == string(filepath.Separator) {
+		name = "file"
+	}
+	staged := filepath.Join(dir, name)
+	if err := os.Rename(tmpName, staged); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	job.stagedPath = staged
+	return nil
+}
+
+func (s *ColdStorageService) expireRecalls(ctx context.Context) error {
+	jobs, err := s.queryRecalls(ctx,
+		`SELECT `+recallJobColumns+` FROM recall_jobs WHERE status = ? AND expires_at < ?`,
+		RecallStatusAvailable, s.now())
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.stagedPath != "" {
+			if err := os.RemoveAll(filepath.Dir(job.stagedPath)); err != nil {
+				s.logger.Warn("Failed to remove expired recall", zap.Int64("job_id", job.ID), zap.Error(err))
+				continue
+			}
+		}
+		job.Status = RecallStatusExpired
+		job.stagedPath = ""
+		if err := s.updateRecall(ctx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start polls outstanding recalls every PollInterval until Stop is called.
+func (s *ColdStorageService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := s.ProcessRecalls(context.Background()); err != nil {
+					s.logger.Error("Failed to process recall jobs", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the polling loop started by Start and waits for it to exit.
+func (s *ColdStorageService) Stop() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// LogRecallNotifier writes recall updates to the application log.
+type LogRecallNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogRecallNotifier creates a log-based recall notifier.
+func NewLogRecallNotifier(logger *zap.Logger) *LogRecallNotifier {
+	return &LogRecallNotifier{logger: logger}
+}
+
+// NotifyRecall logs the job's new state.
+func (n *LogRecallNotifier) NotifyRecall(ctx context.Context, job *RecallJob) error {
+	fields := []zap.Field{
+		zap.Int64("job_id", job.ID),
+		zap.Int64("file_id", job.FileID),
+		zap.String("status", job.Status),
+	}
+	if job.RequestedBy != nil {
+		fields = append(fields, zap.Int("user_id", *job.RequestedBy))
+	}
+	n.logger.Info("Recall job update", fields...)
+	return nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// LTFSRecallBackend recalls files from an LTFS-formatted tape library
+// mounted on the server. Reading through the mount loads the right tape, so
+// a file is ready as soon as it is present in the LTFS index and retrieval
+// is a plain copy performed in the background.
+type LTFSRecallBackend struct {
+	mountPoint string
+}
+
+// NewLTFSRecallBackend builds an LTFS backend from {"mount_point": "..."}.
+func NewLTFSRecallBackend(ctx context.Context, config json.RawMessage) (RecallBackend, error) {
+	var cfg struct {
+		MountPoint string `json:"mount_point"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse LTFS config: %w", err)
+	}
+	if cfg.MountPoint == "" {
+		return nil, fmt.Errorf("mount_point is required for LTFS tiers")
+	}
+	return &LTFSRecallBackend{mountPoint: cfg.MountPoint}, nil
+}
+
+func (b *LTFSRecallBackend) resolve(p string) string {
+	clean := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return filepath.Join(b.mountPoint, filepath.FromSlash(clean))
+}
+
+// Request checks that the file is present in the LTFS index.
+func (b *LTFSRecallBackend) Request(ctx context.Context, p string) error {
+	info, err := os.Stat(b.resolve(p))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", p)
+	}
+	return nil
+}
+
+// Ready reports whether the file is visible through the mount.
+func (b *LTFSRecallBackend) Ready(ctx context.Context, p string) (bool, error) {
+	if _, err := os.Stat(b.resolve(p)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Retrieve copies the file off tape.
+func (b *LTFSRecallBackend) Retrieve(ctx context.Context, p string, w io.Writer) error {
+	src, err := os.Open(b.resolve(p))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(w, &contextReader{ctx: ctx, r: src})
+	return err
+}
+
+// contextReader stops a long copy once ctx is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// glacierAPI is the subset of the S3 client used for archive restores.
+type glacierAPI interface {
+	RestoreObject(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// GlacierRecallBackend restores objects archived in the S3 Glacier Flexible
+// Retrieval or Deep Archive storage classes. Keys are the file path below
+// Prefix.
+type GlacierRecallBackend struct {
+	client glacierAPI
+	bucket string
+	prefix string
+	tier   s3types.Tier
+	days   int32
+}
+
+// NewGlacierRecallBackend builds a Glacier backend from
+// {"bucket", "prefix", "region", "tier", "days", "access_key", "secret_key"}.
+// Credentials fall back to the default AWS chain when no keys are given.
+func NewGlacierRecallBackend(ctx context.Context, config json.RawMessage) (RecallBackend, error) {
+	var cfg struct {
+		Bucket    string `json:"bucket"`
+		Prefix    string `json:"prefix"`
+		Region    string `json:"region"`
+		Tier      string `json:"tier"`
+		Days      int32  `json:"days"`
+		AccessKey string `json:"access_key"`
+		SecretKey string `json:"secret_key"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse Glacier config: %w", err)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required for Glacier tiers")
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKey != "" && cfg.SecretKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{
+				AccessKeyID:     cfg.AccessKey,
+				SecretAccessKey: cfg.SecretKey,
+			}, nil
+		})))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS config: %w", err)
+	}
+
+	return newGlacierRecallBackend(s3.NewFromConfig(awsCfg), cfg.Bucket, cfg.Prefix, cfg.Tier, cfg.Days)
+}
+
+func newGlacierRecallBackend(client glacierAPI, bucket, prefix, tier string, days int32) (*GlacierRecallBackend, error) {
+	if tier == "" {
+		tier = string(s3types.TierStandard)
+	}
+	switch s3types.Tier(tier) {
+	case s3types.TierStandard, s3types.TierBulk, s3types.TierExpedited:
+	default:
+		return nil, fmt.Errorf("unsupported Glacier retrieval tier: %s", tier)
+	}
+	if days <= 0 {
+		days = 1
+	}
+	return &GlacierRecallBackend{
+		client: client,
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		tier:   s3types.Tier(tier),
+		days:   days,
+	}, nil
+}
+
+func (b *GlacierRecallBackend) key(p string) string {
+	clean := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+	if b.prefix == "" {
+		return clean
+	}
+	return b.prefix + "/" + clean
+}
+
+// Request starts a restore of the archived object. A restore that is
+// already running is not an error.
+func (b *GlacierRecallBackend) Request(ctx context.Context, p string) error {
+	_, err := b.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(p)),
+		RestoreRequest: &s3types.RestoreRequest{
+			Days:                 aws.Int32(b.days),
+			GlacierJobParameters: &s3types.GlacierJobParameters{Tier: b.tier},
+		},
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "RestoreAlreadyInProgress" {
+		return nil
+	}
+	return err
+}
+
+// Ready reports whether a restored copy exists, or the object is not in an
+// archive storage class at all.
+func (b *GlacierRecallBackend) Ready(ctx context.Context, p string) (bool, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(p)),
+	})
+	if err != nil {
+		return false, err
+	}
+	switch out.StorageClass {
+	case s3types.StorageClassGlacier, s3types.StorageClassDeepArchive:
+	default:
+		return true, nil
+	}
+	return out.Restore != nil && strings.Contains(*out.Restore, `ongoing-request="false"`), nil
+}
+
+// Retrieve downloads the restored copy.
+func (b *GlacierRecallBackend) Retrieve(ctx context.Context, p string, w io.Writer) error {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(p)),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	_, err = io.Copy(w, out.Body)
+	return err
+}
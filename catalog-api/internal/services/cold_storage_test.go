@@ -0,0 +1,367 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupColdStorageTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL
+		);
+		CREATE TABLE cold_storage_tiers (
+			storage_root TEXT PRIMARY KEY,
+			backend TEXT NOT NULL,
+			config TEXT NOT NULL DEFAULT '{}',
+			retention_hours INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE recall_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file_id INTEGER NOT NULL,
+			storage_root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			backend TEXT NOT NULL,
+			status TEXT NOT NULL,
+			requested_by INTEGER,
+			staged_path TEXT,
+			error_message TEXT,
+			requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			available_at DATETIME,
+			expires_at DATETIME,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO storage_roots (name) VALUES ('archive'), ('nas');
+		INSERT INTO files (storage_root_id, path) VALUES (1, '/films/1999/reel.mkv'), (2, '/docs/report.txt');`)
+	require.NoError(t, err)
+
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+// fakeRecallBackend serves files from memory once they have been marked ready.
+type fakeRecallBackend struct {
+	files     map[string][]byte
+	ready     map[string]bool
+	requested []string
+	failWith  error
+}
+
+func (b *fakeRecallBackend) Request(ctx context.Context, path string) error {
+	if b.failWith != nil {
+		return b.failWith
+	}
+	b.requested = append(b.requested, path)
+	return nil
+}
+
+func (b *fakeRecallBackend) Ready(ctx context.Context, path string) (bool, error) {
+	return b.ready[path], nil
+}
+
+func (b *fakeRecallBackend) Retrieve(ctx context.Context, path string, w io.Writer) error {
+	data, ok := b.files[path]
+	if !ok {
+		return fmt.Errorf("no such object: %s", path)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func newTestColdStorageService(t *testing.T, backend *fakeRecallBackend) *ColdStorageService {
+	t.Helper()
+	svc := NewColdStorageService(setupColdStorageTestDB(t), zap.NewNop(), ColdStorageConfig{
+		StagingDir:       t.TempDir(),
+		DefaultRetention: time.Hour,
+	})
+	svc.RegisterBackend("fake", func(ctx context.Context, config json.RawMessage) (RecallBackend, error) {
+		return backend, nil
+	})
+	require.NoError(t, svc.SetTier(context.Background(), ColdStorageTier{StorageRoot: "archive", Backend: "fake"}))
+	return svc
+}
+
+func TestColdStorageService_RecallLifecycle(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeRecallBackend{
+		files: map[string][]byte{"/films/1999/reel.mkv": []byte("reel contents")},
+		ready: map[string]bool{},
+	}
+	svc := newTestColdStorageService(t, backend)
+
+	var notified []string
+	svc.AddNotifier(RecallNotifierFunc(func(_ context.Context, job *RecallJob) error {
+		notified = append(notified, job.Status)
+		return nil
+	}))
+
+	staged, cold, err := svc.StagedFile(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, cold)
+	assert.Empty(t, staged)
+
+	userID := 7
+	job, err := svc.RequestRecall(ctx, 1, &userID)
+	require.NoError(t, err)
+	assert.Equal(t, RecallStatusInProgress, job.Status)
+	assert.Equal(t, "fake", job.Backend)
+	assert.Equal(t, []string{"/films/1999/reel.mkv"}, backend.requested)
+
+	// A second request reuses the running job
+	again, err := svc.RequestRecall(ctx, 1, &userID)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, again.ID)
+	assert.Len(t, backend.requested, 1)
+
+	// Not ready yet: nothing is staged
+	require.NoError(t, svc.ProcessRecalls(ctx))
+	job, err = svc.GetRecall(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RecallStatusInProgress, job.Status)
+	assert.Empty(t, notified)
+
+	backend.ready["/films/1999/reel.mkv"] = true
+	require.NoError(t, svc.ProcessRecalls(ctx))
+
+	job, err = svc.GetRecall(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RecallStatusAvailable, job.Status)
+	require.NotNil(t, job.ExpiresAt)
+	assert.Equal(t, []string{RecallStatusAvailable}, notified)
+
+	staged, cold, err = svc.StagedFile(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, cold)
+	assert.Equal(t, "reel.mkv", filepath.Base(staged))
+	data, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.Equal(t, "reel contents", string(data))
+
+	jobs, err := svc.ListRecalls(ctx, &userID)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	otherUser := 8
+	jobs, err = svc.ListRecalls(ctx, &otherUser)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestColdStorageService_ExpiresStagedCopies(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeRecallBackend{
+		files: map[string][]byte{"/films/1999/reel.mkv": []byte("reel")},
+		ready: map[string]bool{"/films/1999/reel.mkv": true},
+	}
+	svc := newTestColdStorageService(t, backend)
+
+	job, err := svc.RequestRecall(ctx, 1, nil)
+	require.NoError(t, err)
+	require.NoError(t, svc.ProcessRecalls(ctx))
+
+	staged, _, err := svc.StagedFile(ctx, 1)
+	require.NoError(t, err)
+	require.FileExists(t, staged)
+
+	svc.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	require.NoError(t, svc.ProcessRecalls(ctx))
+
+	job, err = svc.GetRecall(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RecallStatusExpired, job.Status)
+	assert.NoFileExists(t, staged)
+
+	// An expired recall does not block a new one
+	next, err := svc.RequestRecall(ctx, 1, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, job.ID, next.ID)
+}
+
+func TestColdStorageService_FailedRequest(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeRecallBackend{failWith: fmt.Errorf("tape library offline")}
+	svc := newTestColdStorageService(t, backend)
+
+	var notified []*RecallJob
+	svc.AddNotifier(RecallNotifierFunc(func(_ context.Context, job *RecallJob) error {
+		notified = append(notified, job)
+		return nil
+	}))
+
+	job, err := svc.RequestRecall(ctx, 1, nil)
+	require.Error(t, err)
+	require.NotNil(t, job)
+
+	job, err = svc.GetRecall(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RecallStatusFailed, job.Status)
+	require.NotNil(t, job.ErrorMessage)
+	assert.Contains(t, *job.ErrorMessage, "tape library offline")
+	require.Len(t, notified, 1)
+}
+
+func TestColdStorageService_NotCold(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestColdStorageService(t, &fakeRecallBackend{})
+
+	staged, cold, err := svc.StagedFile(ctx, 2)
+	require.NoError(t, err)
+	assert.False(t, cold)
+	assert.Empty(t, staged)
+
+	_, err = svc.RequestRecall(ctx, 2, nil)
+	assert.ErrorIs(t, err, ErrNotColdStorage)
+
+	_, err = svc.RequestRecall(ctx, 99, nil)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestColdStorageService_Tiers(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestColdStorageService(t, &fakeRecallBackend{})
+
+	err := svc.SetTier(ctx, ColdStorageTier{StorageRoot: "nas", Backend: "punch-cards"})
+	assert.ErrorContains(t, err, "invalid tier")
+
+	err = svc.SetTier(ctx, ColdStorageTier{StorageRoot: "nas", Backend: "ltfs", Config: json.RawMessage(`{}`)})
+	assert.ErrorContains(t, err, "mount_point")
+
+	require.NoError(t, svc.SetTier(ctx, ColdStorageTier{
+		StorageRoot:    "nas",
+		Backend:        "ltfs",
+		Config:         json.RawMessage(`{"mount_point":"/mnt/ltfs"}`),
+		RetentionHours: 48,
+	}))
+
+	tier, err := svc.GetTier(ctx, "nas")
+	require.NoError(t, err)
+	require.NotNil(t, tier)
+	assert.Equal(t, "ltfs", tier.Backend)
+	assert.Equal(t, 48, tier.RetentionHours)
+	assert.Equal(t, 48*time.Hour, svc.retention(tier))
+
+	tiers, err := svc.ListTiers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tiers, 2)
+
+	require.NoError(t, svc.DeleteTier(ctx, "nas"))
+	tier, err = svc.GetTier(ctx, "nas")
+	require.NoError(t, err)
+	assert.Nil(t, tier)
+	assert.ErrorContains(t, svc.DeleteTier(ctx, "nas"), "not found")
+}
+
+func TestLTFSRecallBackend(t *testing.T) {
+	ctx := context.Background()
+	mount := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(mount, "films"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mount, "films", "reel.mkv"), []byte("from tape"), 0644))
+
+	backend, err := NewLTFSRecallBackend(ctx, json.RawMessage(`{"mount_point":"`+filepath.ToSlash(mount)+`"}`))
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Request(ctx, "/films/reel.mkv"))
+	assert.Error(t, backend.Request(ctx, "/films"))
+	assert.Error(t, backend.Request(ctx, "/films/missing.mkv"))
+
+	ready, err := backend.Ready(ctx, "/films/reel.mkv")
+	require.NoError(t, err)
+	assert.True(t, ready)
+	ready, err = backend.Ready(ctx, "/films/missing.mkv")
+	require.NoError(t, err)
+	assert.False(t, ready)
+
+	var buf bytes.Buffer
+	require.NoError(t, backend.Retrieve(ctx, "/../films/reel.mkv", &buf))
+	assert.Equal(t, "from tape", buf.String())
+}
+
+// fakeGlacier records restore requests and reports a fixed object state.
+type fakeGlacier struct {
+	restoreKey   string
+	restoreTier  s3types.Tier
+	restoreErr   error
+	storageClass s3types.StorageClass
+	restore      *string
+	body         string
+}
+
+func (f *fakeGlacier) RestoreObject(ctx context.Context, in *s3.RestoreObjectInput, _ ...func(*s3.Options)) (*s3.RestoreObjectOutput, error) {
+	f.restoreKey = aws.ToString(in.Key)
+	f.restoreTier = in.RestoreRequest.GlacierJobParameters.Tier
+	return &s3.RestoreObjectOutput{}, f.restoreErr
+}
+
+func (f *fakeGlacier) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{StorageClass: f.storageClass, Restore: f.restore}, nil
+}
+
+func (f *fakeGlacier) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(f.body))}, nil
+}
+
+func TestGlacierRecallBackend(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeGlacier{storageClass: s3types.StorageClassDeepArchive, body: "restored"}
+
+	_, err := newGlacierRecallBackend(api, "vault", "", "Instant", 0)
+	assert.ErrorContains(t, err, "unsupported Glacier retrieval tier")
+
+	backend, err := newGlacierRecallBackend(api, "vault", "/catalog/", "Bulk", 0)
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Request(ctx, "/films/reel.mkv"))
+	assert.Equal(t, "catalog/films/reel.mkv", api.restoreKey)
+	assert.Equal(t, s3types.TierBulk, api.restoreTier)
+
+	api.restoreErr = &smithy.GenericAPIError{Code: "RestoreAlreadyInProgress"}
+	assert.NoError(t, backend.Request(ctx, "/films/reel.mkv"))
+
+	ready, err := backend.Ready(ctx, "/films/reel.mkv")
+	require.NoError(t, err)
+	assert.False(t, ready)
+
+	api.restore = aws.String(`ongoing-request="true"`)
+	ready, err = backend.Ready(ctx, "/films/reel.mkv")
+	require.NoError(t, err)
+	assert.False(t, ready)
+
+	api.restore = aws.String(`ongoing-request="false", expiry-date="Fri, 23 Dec 2022 00:00:00 GMT"`)
+	ready, err = backend.Ready(ctx, "/films/reel.mkv")
+	require.NoError(t, err)
+	assert.True(t, ready)
+
+	var buf bytes.Buffer
+	require.NoError(t, backend.Retrieve(ctx, "/films/reel.mkv", &buf))
+	assert.Equal(t, "restored", buf.String())
+}
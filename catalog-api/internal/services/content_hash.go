@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// quickHashChunkSize is how much of a file each sample of a quick hash
+// reads.
+const quickHashChunkSize = 1 << 20
+
+// quickHashSampleThreshold is the size above which a file with a seekable
+// stream is sampled at its start, middle and end instead of read whole.
+const quickHashSampleThreshold = 3 * quickHashChunkSize
+
+// QuickHash returns an xxhash64 of a file's size and content, cheap enough
+// to run on every file a scan finds. Large files are hashed from three
+// chunks when the provider's stream can seek, and from their first chunk
+// when it cannot, so equal quick hashes only mark candidates that
+// ContentHash has to confirm.
+func QuickHash(ctx context.Context, provider StorageProvider, file string, size int64) (string, error) {
+	hash, _, err := quickHashWithHead(ctx, provider, file, size)
+	return hash, err
+}
+
+// quickHashWithHead returns the quick hash of a file along with its first
+// bytes, up to mediaSniffLength, for media type detection. Every quick
+// hash starts reading at the beginning of the file, so this costs no
+// extra read.
+func quickHashWithHead(ctx context.Context, provider StorageProvider, file string, size int64) (string, []byte, error) {
+	rc, err := provider.Open(ctx, file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rc.Close()
+
+	h := xxhash.New()
+	var sizeBytes [8]byte
+	binary.LittleEndian.PutUint64(sizeBytes[:], uint64(size))
+	h.Write(sizeBytes[:])
+
+	head := &headBuffer{}
+	w := io.MultiWriter(h, head)
+	r := &contextReader{ctx: ctx, r: rc}
+	if size <= quickHashSampleThreshold {
+		if _, err := io.Copy(w, r); err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%016x", h.Sum64()), head.data, nil
+	}
+
+	seeker, ok := rc.(io.Seeker)
+	if !ok {
+		if _, err := io.CopyN(w, r, quickHashChunkSize); err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%016x", h.Sum64()), head.data, nil
+	}
+	for _, offset := range []int64{0, size/2 - quickHashChunkSize/2, size - quickHashChunkSize} {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		if _, err := io.CopyN(w, r, quickHashChunkSize); err != nil {
+			return "", nil, err
+		}
+	}
+	return fmt.Sprintf("%016x", h.Sum64()), head.data, nil
+}
+
+// ContentHash returns the SHA-256 of a whole file, which confirms that
+// files with the same quick hash really are identical.
+func ContentHash(ctx context.Context, provider StorageProvider, file string) (string, error) {
+	rc, err := provider.Open(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, &contextReader{ctx: ctx, r: rc}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
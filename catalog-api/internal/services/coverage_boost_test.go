@@ -46,6 +46,7 @@ func setupCatalogTestDB(t *testing.T) (*database.DB, *CatalogService) {
 			size INTEGER,
 			modified_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			quick_hash TEXT,
+			sha256 TEXT,
 			extension TEXT,
 			mime_type TEXT,
 			file_type TEXT,
@@ -65,6 +66,16 @@ func setupCatalogTestDB(t *testing.T) (*database.DB, *CatalogService) {
 			total_size INTEGER DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);
+		CREATE TABLE IF NOT EXISTS duplicate_resolutions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file_id INTEGER NOT NULL,
+			sha256 TEXT NOT NULL,
+			action TEXT NOT NULL,
+			kept_file_id INTEGER,
+			resolved_by INTEGER,
+			resolved_at DATETIME NOT NULL,
+			UNIQUE(file_id, sha256)
+		);
 	`)
 	require.NoError(t, err)
 
@@ -73,13 +84,13 @@ func setupCatalogTestDB(t *testing.T) (*database.DB, *CatalogService) {
 	require.NoError(t, err)
 
 	_, err = db.Exec(`
-		INSERT INTO files (id, storage_root_id, name, path, is_directory, size, parent_id, quick_hash, extension, mime_type) VALUES
-		(1, 1, 'media',       '/media',                     1, 0,        NULL, NULL,    NULL,  NULL),
-		(2, 1, 'movies',      '/media/movies',              1, 0,        1,    NULL,    NULL,  NULL),
-		(3, 1, 'video.mp4',   '/media/movies/video.mp4',    0, 500000,   2,    'h1',    'mp4', 'video/mp4'),
-		(4, 1, 'video2.mp4',  '/media/movies/video2.mp4',   0, 500000,   2,    'h1',    'mp4', 'video/mp4'),
-		(5, 2, 'docs',        '/docs',                      1, 0,        NULL, NULL,    NULL,  NULL),
-		(6, 2, 'readme.txt',  '/docs/readme.txt',           0, 1024,     5,    NULL,    'txt', 'text/plain')
+		INSERT INTO files (id, storage_root_id, name, path, is_directory, size, parent_id, quick_hash, sha256, extension, mime_type) VALUES
+		(1, 1, 'media',       '/media',                     1, 0,        NULL, NULL,    NULL,    NULL,  NULL),
+		(2, 1, 'movies',      '/media/movies',              1, 0,        1,    NULL,    NULL,    NULL,  NULL),
+		(3, 1, 'video.mp4',   '/media/movies/video.mp4',    0, 500000,   2,    'q1',    'h1',    'mp4', 'video/mp4'),
+		(4, 1, 'video2.mp4',  '/media/movies/video2.mp4',   0, 500000,   2,    'q1',    'h1',    'mp4', 'video/mp4'),
+		(5, 2, 'docs',        '/docs',                      1, 0,        NULL, NULL,    NULL,    NULL,  NULL),
+		(6, 2, 'readme.txt',  '/docs/readme.txt',           0, 1024,     5,    NULL,    NULL,    'txt', 'text/plain')
 	`)
 	require.NoError(t, err)
 
@@ -296,7 +307,7 @@ func TestCatalogService_GetFileInfo_ByID(t *testing.T) {
 func TestCatalogService_GetDuplicateGroups_WithSMBRoot(t *testing.T) {
 	_, svc := setupCatalogTestDB(t)
 
-	// Files with quick_hash 'h1' are duplicates
+	// Files with sha256 'h1' are duplicates
 	groups, err := svc.GetDuplicateGroups("test-root", 2, 10)
 	require.NoError(t, err)
 	assert.Len(t, groups, 1)
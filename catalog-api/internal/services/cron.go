@@ -0,0 +1,223 @@
+package services
+
+import (
+	"catalogizer/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression. It accepts the five standard
+// fields (minute hour day-of-month month day-of-week) with *, lists,
+// ranges and steps, the @hourly, @daily, @weekly and @monthly shorthands,
+// and "@every <duration>" for fixed intervals of a minute or more.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record unrestricted day fields: when both day
+	// fields are restricted a day matching either one qualifies.
+	domAny, dowAny bool
+	every          time.Duration
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// parseCronSchedule parses a cron expression.
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("invalid cron expression %q: interval must be at least a minute", expr)
+		}
+		return &cronSchedule{every: d}, nil
+	}
+	if full, ok := cronShorthands[expr]; ok {
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the set of values a field allows as a bitmask.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo = n
+			// "5/15" runs from 5 to the end of the range
+			if step == 1 {
+				hi = n
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", rangePart, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first run time strictly after t, or the zero time if
+// the expression never matches (e.g. 30 February). The fields match the
+// wall clock of t's location. A run falling in the hour skipped when the
+// clocks go forward happens the moment they do, and one falling in the
+// hour repeated when they go back happens the first time round only.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+
+	// The search runs on the wall clock written as UTC, which has no
+	// gaps or repeats; each match is then placed back in t's location.
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	limit := wall.AddDate(5, 0, 0)
+	for wall = c.nextWall(wall.Add(time.Minute), limit); !wall.IsZero(); wall = c.nextWall(wall.Add(time.Minute), limit) {
+		if run := wallInstant(wall, t.Location()); run.After(t) {
+			return run
+		}
+	}
+	return time.Time{}
+}
+
+// NextIn is Next with the fields read on the wall clock of timeZone, an
+// IANA name, or of now's own location when it is empty. The run time
+// comes back in now's location, the one run times are stored in.
+func (c *cronSchedule) NextIn(now time.Time, timeZone string) (time.Time, error) {
+	if timeZone == "" {
+		return c.Next(now), nil
+	}
+	loc, err := models.LoadTimeZone(timeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := c.Next(now.In(loc))
+	if next.IsZero() {
+		return next, nil
+	}
+	return next.In(now.Location()), nil
+}
+
+// nextWall returns the first wall clock minute from t on that matches,
+// or the zero time if there is none before limit.
+func (c *cronSchedule) nextWall(t, limit time.Time) time.Time {
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// wallInstant returns the first instant the clocks of loc show wall, a
+// wall clock time written as UTC. When the clocks skip wall it returns
+// the moment they skip.
+func wallInstant(wall time.Time, loc *time.Location) time.Time {
+	guess := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+	start, end := guess.ZoneBounds()
+	zones := []time.Time{guess}
+	if !start.IsZero() {
+		zones = append(zones, start.Add(-time.Second))
+	}
+	if !end.IsZero() {
+		zones = append(zones, end)
+	}
+
+	var first time.Time
+	for _, z := range zones {
+		_, offset := z.Zone()
+		at := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if _, atOffset := at.Zone(); atOffset == offset && (first.IsZero() || at.Before(first)) {
+			first = at
+		}
+	}
+	if !first.IsZero() {
+		return first
+	}
+
+	// wall lies in a gap; guess is on one side of it
+	shown := time.Date(guess.Year(), guess.Month(), guess.Day(), guess.Hour(), guess.Minute(), 0, 0, time.UTC)
+	if shown.After(wall) {
+		return start
+	}
+	return end
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if !c.domAny && !c.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return v
+	}
+
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"*/15 * * * *", "2024-01-01 10:07", "2024-01-01 10:15"},
+		{"*/15 * * * *", "2024-01-01 10:45", "2024-01-01 11:00"},
+		{"0 3 * * *", "2024-01-01 04:00", "2024-01-02 03:00"},
+		{"30 2-4 * * *", "2024-01-01 02:30", "2024-01-01 03:30"},
+		{"0 0 * * 1", "2024-01-03 12:00", "2024-01-08 00:00"},
+		{"0 0 * * 7", "2024-01-01 00:00", "2024-01-07 00:00"},
+		// Both day fields restricted: the 13th or any Friday
+		{"0 0 13 * 5", "2024-01-01 00:00", "2024-01-05 00:00"},
+		{"0 0 1 1,7 *", "2024-02-01 00:00", "2024-07-01 00:00"},
+		{"@daily", "2024-01-01 00:00", "2024-01-02 00:00"},
+		{"@hourly", "2024-01-01 00:59", "2024-01-01 01:00"},
+		{"@every 90m", "2024-01-01 00:00", "2024-01-01 01:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" from "+tt.from, func(t *testing.T) {
+			c, err := parseCronSchedule(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, at(tt.want), c.Next(at(tt.from)))
+		})
+	}
+}
+
+func TestCronSchedule_NextAcrossDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(day, hour, minute int, month time.Month) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, ny)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"before the gap", "30 2 * * *", at(7, 0, 0, time.March), at(7, 2, 30, time.March)},
+		// 02:30 does not exist on 8 March: the run happens when the
+		// clocks jump to 03:00
+		{"in the gap", "30 2 * * *", at(8, 0, 0, time.March), time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC)},
+		{"gap runs once", "*/15 2 * * *", time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC), at(9, 2, 0, time.March)},
+		{"after the gap", "0 3 * * *", at(8, 0, 0, time.March), time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC)},
+		// 01:30 happens twice on 1 November: first in EDT, then in EST
+		{"first of the repeated hour", "30 1 * * *", at(1, 0, 0, time.November), time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"not the second", "30 1 * * *", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), at(2, 1, 30, time.November)},
+		{"wall clock kept", "0 9 * * *", at(31, 9, 0, time.October), time.Date(2026, 11, 1, 14, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCronSchedule(tt.expr)
+			require.NoError(t, err)
+			got := c.Next(tt.from.In(ny))
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want.UTC(), got.UTC())
+		})
+	}
+}
+
+func TestCronSchedule_NextIn(t *testing.T) {
+	c, err := parseCronSchedule("0 9 * * *")
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	next, err := c.NextIn(now, "Asia/Tokyo")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), next)
+
+	next, err = c.NextIn(now, "")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), next)
+
+	_, err = c.NextIn(now, "Atlantis/Capital")
+	assert.ErrorContains(t, err, "invalid time zone")
+}
+
+func TestCronSchedule_NeverMatches(t *testing.T) {
+	c, err := parseCronSchedule("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, c.Next(time.Now()).IsZero())
+}
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 10s",
+		"@every soon",
+		"@yearly",
+	} {
+		_, err := parseCronSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
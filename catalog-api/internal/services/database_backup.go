@@ -0,0 +1,424 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sqlcipher "github.com/mutecomm/go-sqlcipher"
+	"go.uber.org/zap"
+)
+
+// Backup triggers.
+const (
+	BackupTriggerManual   = "manual"
+	BackupTriggerSchedule = "schedule"
+	BackupTriggerRestore  = "pre-restore"
+)
+
+// backupTimeLayout names backup files after the UTC time they were taken.
+const backupTimeLayout = "20060102-150405"
+
+// backupNamePattern matches the names of the files BackupService keeps.
+// The names are also what restores are requested by, so nothing else in
+// the directory can be addressed.
+var backupNamePattern = regexp.MustCompile(`^catalog-(\d{8}-\d{6})(-pre-restore)?\.db$`)
+
+// BackupUploader copies backups to off-site storage such as a WebDAV sync
+// endpoint.
+type BackupUploader interface {
+	UploadFile(localPath, remotePath string) error
+	DeleteFile(remotePath string) error
+}
+
+// BackupConfig controls where backups are kept and how often they are
+// taken. Backups are encrypted with EncryptionKey, or with the key of
+// the database when it is empty, and are only plain SQLite files when
+// neither is set.
+type BackupConfig struct {
+	// Dir is the absolute directory backups are written to
+	Dir string
+	// Interval between scheduled backups; zero takes them on demand only
+	Interval time.Duration
+	// Retention is how many backups are kept, oldest removed first
+	Retention     int
+	EncryptionKey string
+	// Uploader, when set, receives every backup under RemoteDir
+	Uploader  BackupUploader
+	RemoteDir string
+	// CheckInterval is how often the schedule is checked
+	CheckInterval time.Duration
+}
+
+// BackupStatus describes the backup configuration and the backups kept.
+type BackupStatus struct {
+	Dir             string           `json:"dir"`
+	IntervalSeconds float64          `json:"interval_seconds"`
+	Retention       int              `json:"retention"`
+	Encrypted       bool             `json:"encrypted"`
+	Upload          bool             `json:"upload"`
+	Backups         []DatabaseBackup `json:"backups"`
+}
+
+// DatabaseRestore is a backup staged to replace the catalog database.
+// The server reads the database through connections opened at start, so
+// the staged copy takes effect when it next starts. SafetyBackup is the
+// backup of the database taken just before.
+type DatabaseRestore struct {
+	Backup          string          `json:"backup"`
+	SchemaVersion   int             `json:"schema_version"`
+	SafetyBackup    *DatabaseBackup `json:"safety_backup"`
+	RestartRequired bool            `json:"restart_required"`
+}
+
+// BackupService takes backups of the SQLite catalog database on a
+// schedule and on demand, keeps the most recent ones, copies them
+// off-site and stages them for restore. The backup directory is the
+// record of what exists, so the list stays right after a restore rolls
+// the database back.
+type BackupService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config BackupConfig
+	now    func() time.Time
+
+	mu   sync.Mutex
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewBackupService creates a BackupService keeping seven backups unless
+// cfg says otherwise.
+func NewBackupService(db *database.DB, logger *zap.Logger, cfg BackupConfig) *BackupService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Minute
+	}
+	return &BackupService{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+// key returns the key backups are written with.
+func (s *BackupService) key() string {
+	if s.config.EncryptionKey != "" {
+		return s.config.EncryptionKey
+	}
+	return s.db.EncryptionKey()
+}
+
+func (s *BackupService) checkSupported() error {
+	if s.db.Dialect().IsPostgres() {
+		return fmt.Errorf("database backups are not supported on PostgreSQL; use pg_dump")
+	}
+	if !filepath.IsAbs(s.config.Dir) {
+		return fmt.Errorf("invalid backup directory %q: the path must be absolute", s.config.Dir)
+	}
+	return nil
+}
+
+// Status returns the backup configuration and the backups kept, newest
+// first.
+func (s *BackupService) Status(ctx context.Context) (*BackupStatus, error) {
+	backups, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupStatus{
+		Dir:             s.config.Dir,
+		IntervalSeconds: s.config.Interval.Seconds(),
+		Retention:       s.config.Retention,
+		Encrypted:       s.key() != "",
+		Upload:          s.config.Uploader != nil,
+		Backups:         backups,
+	}, nil
+}
+
+// List returns the backups kept, newest first.
+func (s *BackupService) List(ctx context.Context) ([]DatabaseBackup, error) {
+	if err := s.checkSupported(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.config.Dir)
+	if os.IsNotExist(err) {
+		return []DatabaseBackup{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	backups := []DatabaseBackup{}
+	for _, entry := range entries {
+		match := backupNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		created, err := time.ParseInLocation(backupTimeLayout, match[1], time.UTC)
+		if err != nil {
+			continue
+		}
+		backupPath := filepath.Join(s.config.Dir, entry.Name())
+		encrypted, _ := sqlcipher.IsEncrypted(backupPath)
+		backups = append(backups, DatabaseBackup{
+			Name:      entry.Name(),
+			Path:      backupPath,
+			SizeBytes: info.Size(),
+			Encrypted: encrypted,
+			CreatedAt: created,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// Create takes a backup, uploads it when an uploader is configured and
+// removes the backups past the retention count. A failed upload is
+// reported on the backup rather than failing it.
+func (s *BackupService) Create(ctx context.Context, trigger string) (*DatabaseBackup, error) {
+	if err := s.checkSupported(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(ctx, trigger)
+}
+
+func (s *BackupService) create(ctx context.Context, trigger string) (*DatabaseBackup, error) {
+	if err := os.MkdirAll(s.config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	created := s.now().UTC().Truncate(time.Second)
+	name := "catalog-" + created.Format(backupTimeLayout) + ".db"
+	if trigger == BackupTriggerRestore {
+		name = "catalog-" + created.Format(backupTimeLayout) + "-pre-restore.db"
+	}
+	backupPath := filepath.Join(s.config.Dir, name)
+	if _, err := os.Stat(backupPath); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	err = exportSQLite(ctx, conn, backupPath, s.key())
+	conn.Close()
+	if err != nil {
+		os.Remove(backupPath)
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	backup := &DatabaseBackup{
+		Name:      name,
+		Path:      backupPath,
+		SizeBytes: info.Size(),
+		Encrypted: s.key() != "",
+		CreatedAt: created,
+	}
+
+	if s.config.Uploader != nil {
+		if err := s.config.Uploader.UploadFile(backupPath, s.remotePath(name)); err != nil {
+			backup.UploadError = err.Error()
+			s.logger.Warn("Failed to upload database backup", zap.String("backup", name), zap.Error(err))
+		} else {
+			backup.Uploaded = true
+		}
+	}
+	s.logger.Info("Catalog database backed up", zap.String("backup", name), zap.String("trigger", trigger),
+		zap.Int64("size_bytes", backup.SizeBytes), zap.Bool("uploaded", backup.Uploaded))
+
+	s.rotate(ctx)
+	return backup, nil
+}
+
+func (s *BackupService) remotePath(name string) string {
+	return path.Join("/", s.config.RemoteDir, name)
+}
+
+// rotate removes the oldest backups past the retention count, locally
+// and from the upload destination.
+func (s *BackupService) rotate(ctx context.Context) {
+	backups, err := s.List(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to list backups for rotation", zap.Error(err))
+		return
+	}
+	for _, old := range backups[min(s.config.Retention, len(backups)):] {
+		if err := os.Remove(old.Path); err != nil {
+			s.logger.Warn("Failed to remove old backup", zap.String("backup", old.Name), zap.Error(err))
+			continue
+		}
+		if s.config.Uploader != nil {
+			if err := s.config.Uploader.DeleteFile(s.remotePath(old.Name)); err != nil {
+				s.logger.Warn("Failed to remove old backup from upload destination", zap.String("backup", old.Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Restore stages the named backup to replace the catalog database when
+// the server next starts. The backup must pass an integrity check and
+// must not come from a newer schema than the running one; older ones are
+// brought up to date by the migrations at start. The current database is
+// backed up first so the restore can be undone.
+func (s *BackupService) Restore(ctx context.Context, name string) (*DatabaseRestore, error) {
+	if err := s.checkSupported(); err != nil {
+		return nil, err
+	}
+	if !backupNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+	backupPath := filepath.Join(s.config.Dir, name)
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("backup %s not found", name)
+	}
+	dbFile := sqliteDatabaseFile(ctx, s.db)
+	if dbFile == "" {
+		return nil, fmt.Errorf("cannot restore an in-memory database")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := ""
+	if encrypted, err := sqlcipher.IsEncrypted(backupPath); err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	} else if encrypted {
+		key = s.key()
+	}
+	src, err := database.OpenSQLiteFile(backupPath, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup %s: %w", name, err)
+	}
+	defer src.Close()
+
+	var check string
+	if err := src.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&check); err != nil {
+		return nil, fmt.Errorf("invalid backup %s: integrity check failed: %w", name, err)
+	}
+	if check != "ok" {
+		return nil, fmt.Errorf("invalid backup %s: integrity check failed: %s", name, check)
+	}
+	var backupVersion, currentVersion int
+	if err := src.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM migrations`).Scan(&backupVersion); err != nil {
+		return nil, fmt.Errorf("invalid backup %s: no migration history: %w", name, err)
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM migrations`).Scan(&currentVersion); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if backupVersion > currentVersion {
+		return nil, fmt.Errorf("invalid backup %s: it has schema version %d, newer than this server's %d", name, backupVersion, currentVersion)
+	}
+
+	safety, err := s.create(ctx, BackupTriggerRestore)
+	if err != nil {
+		return nil, err
+	}
+
+	staged := dbFile + database.StagedRestoreSuffix
+	os.Remove(staged)
+	conn, err := src.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage restore: %w", err)
+	}
+	err = exportSQLite(ctx, conn, staged, s.db.EncryptionKey())
+	conn.Close()
+	if err != nil {
+		os.Remove(staged)
+		return nil, fmt.Errorf("failed to stage restore: %w", err)
+	}
+	s.logger.Warn("Database restore staged; it takes effect when the server restarts",
+		zap.String("backup", name), zap.String("safety_backup", safety.Name))
+	return &DatabaseRestore{Backup: name, SchemaVersion: backupVersion, SafetyBackup: safety, RestartRequired: true}, nil
+}
+
+// RunDue takes a scheduled backup when the newest backup is older than
+// the interval.
+func (s *BackupService) RunDue(ctx context.Context) {
+	if s.config.Interval <= 0 {
+		return
+	}
+	backups, err := s.List(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list backups", zap.Error(err))
+		return
+	}
+	if len(backups) > 0 && s.now().Sub(backups[0].CreatedAt) < s.config.Interval {
+		return
+	}
+	if _, err := s.Create(ctx, BackupTriggerSchedule); err != nil && !strings.Contains(err.Error(), "already exists") {
+		s.logger.Error("Scheduled database backup failed", zap.Error(err))
+	}
+}
+
+// Start begins taking scheduled backups, when an interval is set.
+func (s *BackupService) Start() {
+	if s.config.Interval <= 0 || s.db.Dialect().IsPostgres() {
+		return
+	}
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunDue(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for a backup in progress to finish.
+func (s *BackupService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"catalogizer/config"
+	"catalogizer/database"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqlcipher "github.com/mutecomm/go-sqlcipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackupUploader struct {
+	uploaded []string
+	deleted  []string
+	fail     bool
+}
+
+func (u *fakeBackupUploader) UploadFile(localPath, remotePath string) error {
+	if u.fail {
+		return fmt.Errorf("connection refused")
+	}
+	u.uploaded = append(u.uploaded, remotePath)
+	return nil
+}
+
+func (u *fakeBackupUploader) DeleteFile(remotePath string) error {
+	u.deleted = append(u.deleted, remotePath)
+	return nil
+}
+
+// openBackupTestDB opens an encrypted catalog at path with a migration
+// history and one table of notes.
+func openBackupTestDB(t *testing.T, path string) *database.DB {
+	t.Helper()
+	t.Setenv("TEST_BACKUP_DB_KEY", "catalog-key")
+	db, err := database.NewConnection(&config.DatabaseConfig{
+		Type:       "sqlite",
+		Path:       path,
+		Encryption: config.DatabaseEncryptionConfig{Enabled: true, KeyEnv: "TEST_BACKUP_DB_KEY"},
+	})
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS migrations (version INTEGER PRIMARY KEY, name TEXT);
+		INSERT OR IGNORE INTO migrations (version, name) VALUES (1, 'initial');
+		CREATE TABLE IF NOT EXISTS notes (body TEXT);
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func TestBackupService_CreateAndRotate(t *testing.T) {
+	db := openBackupTestDB(t, filepath.Join(t.TempDir(), "catalog.db"))
+	t.Cleanup(func() { db.Close() })
+	uploader := &fakeBackupUploader{}
+	s := NewBackupService(db, nil, BackupConfig{Dir: t.TempDir(), Retention: 2, Uploader: uploader, RemoteDir: "catalog"})
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		backup, err := s.Create(ctx, BackupTriggerManual)
+		require.NoError(t, err)
+		assert.True(t, backup.Encrypted, "backups take the database key")
+		assert.True(t, backup.Uploaded)
+		now = now.Add(time.Hour)
+	}
+	_, err := s.Create(ctx, BackupTriggerManual)
+	require.NoError(t, err)
+	_, err = s.Create(ctx, BackupTriggerManual)
+	assert.ErrorContains(t, err, "already exists")
+
+	backups, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "catalog-20261016-150000.db", backups[0].Name)
+	assert.Equal(t, "catalog-20261016-140000.db", backups[1].Name)
+	assert.Equal(t, []string{"/catalog/catalog-20261016-120000.db", "/catalog/catalog-20261016-130000.db"}, uploader.deleted)
+	assert.Len(t, uploader.uploaded, 4)
+
+	uploader.fail = true
+	now = now.Add(time.Hour)
+	backup, err := s.Create(ctx, BackupTriggerManual)
+	require.NoError(t, err, "a failed upload keeps the local backup")
+	assert.False(t, backup.Uploaded)
+	assert.Contains(t, backup.UploadError, "connection refused")
+
+	_, err = NewBackupService(db, nil, BackupConfig{Dir: "relative"}).Create(ctx, BackupTriggerManual)
+	assert.ErrorContains(t, err, "invalid backup directory")
+}
+
+func TestBackupService_RunDue(t *testing.T) {
+	db := openBackupTestDB(t, filepath.Join(t.TempDir(), "catalog.db"))
+	t.Cleanup(func() { db.Close() })
+	s := NewBackupService(db, nil, BackupConfig{Dir: t.TempDir(), Interval: 24 * time.Hour})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.RunDue(ctx)
+	now = now.Add(time.Hour)
+	s.RunDue(ctx)
+	backups, err := s.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, backups, 1, "the newest backup is within the interval")
+
+	now = now.Add(24 * time.Hour)
+	s.RunDue(ctx)
+	backups, err = s.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+}
+
+func TestBackupService_Restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	db := openBackupTestDB(t, path)
+	s := NewBackupService(db, nil, BackupConfig{Dir: t.TempDir(), EncryptionKey: "backup-key"})
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := db.Exec(`INSERT INTO notes (body) VALUES ('before')`)
+	require.NoError(t, err)
+	backup, err := s.Create(ctx, BackupTriggerManual)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO notes (body) VALUES ('after')`)
+	require.NoError(t, err)
+
+	_, err = s.Restore(ctx, "../catalog.db")
+	assert.ErrorContains(t, err, "invalid backup name")
+	_, err = s.Restore(ctx, "catalog-20200101-000000.db")
+	assert.ErrorContains(t, err, "not found")
+
+	// Backups from a newer schema cannot be restored
+	_, err = db.Exec(`INSERT INTO migrations (version, name) VALUES (2, 'next')`)
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	newer, err := s.Create(ctx, BackupTriggerManual)
+	require.NoError(t, err)
+	_, err = db.Exec(`DELETE FROM migrations WHERE version = 2`)
+	require.NoError(t, err)
+	_, err = s.Restore(ctx, newer.Name)
+	assert.ErrorContains(t, err, "newer than this server's 1")
+
+	now = now.Add(time.Minute)
+	restore, err := s.Restore(ctx, backup.Name)
+	require.NoError(t, err)
+	assert.True(t, restore.RestartRequired)
+	assert.Equal(t, 1, restore.SchemaVersion)
+	assert.Equal(t, "catalog-20261016-120200-pre-restore.db", restore.SafetyBackup.Name)
+	encrypted, err := sqlcipher.IsEncrypted(path + database.StagedRestoreSuffix)
+	require.NoError(t, err)
+	assert.True(t, encrypted, "the staged copy is keyed like the database")
+
+	// The restore takes effect when the database is next opened
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&count))
+	assert.Equal(t, 2, count)
+	require.NoError(t, db.Close())
+
+	db = openBackupTestDB(t, path)
+	t.Cleanup(func() { db.Close() })
+	var body string
+	require.NoError(t, db.QueryRow(`SELECT group_concat(body) FROM notes`).Scan(&body))
+	assert.Equal(t, "before", body)
+	_, err = os.Stat(path + database.StagedRestoreSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
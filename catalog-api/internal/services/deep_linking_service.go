@@ -3,16 +3,19 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
 	neturl "net/url"
 	"strings"
 	"time"
 
 	"catalogizer/internal/models"
+	"catalogizer/repository"
 )
 
 type DeepLinkingService struct {
 	baseURL    string
 	apiVersion string
+	events     *repository.LinkEventRepository
 }
 
 type DeepLinkRequest struct {
@@ -71,6 +74,7 @@ type LinkTrackingEvent struct {
 	TrackingID   string                 `json:"tracking_id"`
 	EventType    string                 `json:"event_type"` // click, open, fallback, error
 	Platform     string                 `json:"platform"`
+	UserID       int                    `json:"user_id,omitempty"`
 	UserAgent    string                 `json:"user_agent,omitempty"`
 	IPAddress    string                 `json:"ip_address,omitempty"`
 	Timestamp    time.Time              `json:"timestamp"`
@@ -101,7 +105,31 @@ func NewDeepLinkingService(baseURL, apiVersion string) *DeepLinkingService {
 	}
 }
 
+// SetEventRepository stores tracked link events, which GetLinkAnalytics
+// aggregates. Without it events are dropped and analytics are empty.
+func (dls *DeepLinkingService) SetEventRepository(events *repository.LinkEventRepository) {
+	dls.events = events
+}
+
+// forRequest returns the service to build a request's links with. Without
+// a configured base URL, links point at the address the client used to
+// reach the API, as carried by WithRequestBaseURL.
+func (dls *DeepLinkingService) forRequest(ctx context.Context) *DeepLinkingService {
+	if dls.baseURL != "" {
+		return dls
+	}
+	baseURL := RequestBaseURL(ctx)
+	if baseURL == "" {
+		return dls
+	}
+	scoped := *dls
+	scoped.baseURL = baseURL
+	return &scoped
+}
+
 func (dls *DeepLinkingService) GenerateDeepLinks(ctx context.Context, req *DeepLinkRequest) (*DeepLinkResponse, error) {
+	dls = dls.forRequest(ctx)
+
 	// Validate request
 	if req.MediaID == "" {
 		return nil, fmt.Errorf("media ID is required")
@@ -432,8 +460,13 @@ func (dls *DeepLinkingService) generateFallbackURL(req *DeepLinkRequest) string
 }
 
 func (dls *DeepLinkingService) generateQRCodeURL(link string) string {
-	// Use a QR code generation service
-	return fmt.Sprintf("https://api.qrserver.com/v1/create-qr-code/?size=200x200&data=%s", neturl.QueryEscape(link))
+	baseURL := dls.baseURL
+	if baseURL == "" {
+		baseURL = "https://catalogizer.app"
+	}
+
+	// Rendered by the API itself, see QRCodePNG
+	return fmt.Sprintf("%s/api/v1/links/qr?size=200&data=%s", baseURL, neturl.QueryEscape(link))
 }
 
 func (dls *DeepLinkingService) generateTrackingID() string {
@@ -488,41 +521,81 @@ func (dls *DeepLinkingService) getRequiredFeatures(req *DeepLinkRequest) []strin
 	return features
 }
 
+// linkEventTypes are the events tracked for links: clicks on universal
+// links, and the app opens, store fallbacks and errors apps report
+var linkEventTypes = map[string]bool{"click": true, "open": true, "fallback": true, "error": true}
+
 // Link tracking methods
+
+// TrackLinkEvent records an event of a link. Events without a time, or
+// dated in the future, happened now.
 func (dls *DeepLinkingService) TrackLinkEvent(ctx context.Context, event *LinkTrackingEvent) error {
-	// This would normally store the event in a database or analytics service
-	// For now, we'll just log it
-	fmt.Printf("Link tracking event: %+v\n", event)
-	return nil
+	if event.TrackingID == "" {
+		return fmt.Errorf("invalid link event: tracking ID is required")
+	}
+	if !linkEventTypes[event.EventType] {
+		return fmt.Errorf("invalid link event type: %s", event.EventType)
+	}
+	if now := time.Now(); event.Timestamp.IsZero() || event.Timestamp.After(now) {
+		event.Timestamp = now
+	}
+	if dls.events == nil {
+		return nil
+	}
+
+	return dls.events.Insert(ctx, &repository.LinkEvent{
+		TrackingID:   event.TrackingID,
+		EventType:    event.EventType,
+		Platform:     event.Platform,
+		UserID:       int64(event.UserID),
+		UserAgent:    event.UserAgent,
+		IPAddress:    event.IPAddress,
+		Success:      event.Success,
+		AppOpened:    event.AppOpened,
+		FallbackUsed: event.FallbackUsed,
+		ErrorMessage: event.ErrorMessage,
+		Metadata:     event.Metadata,
+		OccurredAt:   event.Timestamp,
+	})
 }
 
+// GetLinkAnalytics aggregates the recorded events of a link. The
+// conversion rate is the share of clicks that opened the app.
 func (dls *DeepLinkingService) GetLinkAnalytics(ctx context.Context, trackingID string) (*LinkAnalytics, error) {
-	// This would normally retrieve analytics from storage
-	// Mock implementation
-	return &LinkAnalytics{
-		TrackingID:   trackingID,
-		TotalClicks:  45,
-		UniqueClicks: 32,
-		PlatformBreakdown: map[string]int{
-			"web":     20,
-			"android": 15,
-			"ios":     8,
-			"desktop": 2,
-		},
-		ConversionRate: 0.71, // 71% opened the app
-		FirstClickAt:   time.Now().Add(-24 * time.Hour),
-		LastClickAt:    time.Now().Add(-1 * time.Hour),
-	}, nil
+	analytics := &LinkAnalytics{TrackingID: trackingID, PlatformBreakdown: map[string]int{}}
+	if dls.events == nil {
+		return analytics, nil
+	}
+
+	summary, err := dls.events.Summarize(ctx, trackingID)
+	if err != nil {
+		return nil, err
+	}
+	analytics.TotalClicks = summary.TotalClicks
+	analytics.UniqueClicks = summary.UniqueClicks
+	analytics.Opens = summary.Opens
+	analytics.Fallbacks = summary.Fallbacks
+	analytics.Errors = summary.Errors
+	analytics.PlatformBreakdown = summary.PlatformBreakdown
+	analytics.FirstClickAt = summary.FirstClickAt
+	analytics.LastClickAt = summary.LastClickAt
+	if summary.TotalClicks > 0 {
+		analytics.ConversionRate = math.Min(1, float64(summary.Opens)/float64(summary.TotalClicks))
+	}
+	return analytics, nil
 }
 
 type LinkAnalytics struct {
 	TrackingID        string         `json:"tracking_id"`
 	TotalClicks       int            `json:"total_clicks"`
 	UniqueClicks      int            `json:"unique_clicks"`
+	Opens             int            `json:"opens"`
+	Fallbacks         int            `json:"fallbacks"`
+	Errors            int            `json:"errors"`
 	PlatformBreakdown map[string]int `json:"platform_breakdown"`
 	ConversionRate    float64        `json:"conversion_rate"`
-	FirstClickAt      time.Time      `json:"first_click_at"`
-	LastClickAt       time.Time      `json:"last_click_at"`
+	FirstClickAt      *time.Time     `json:"first_click_at,omitempty"`
+	LastClickAt       *time.Time     `json:"last_click_at,omitempty"`
 }
 
 // App registration and configuration
@@ -576,6 +649,12 @@ func (dls *DeepLinkingService) GetAppConfiguration(ctx context.Context, appID st
 
 // Smart link routing based on user context
 func (dls *DeepLinkingService) GenerateSmartLink(ctx context.Context, req *DeepLinkRequest) (*SmartLinkResponse, error) {
+	dls = dls.forRequest(ctx)
+
+	if req.MediaID == "" {
+		return nil, fmt.Errorf("media ID is required")
+	}
+
 	// Analyze user context to determine best link strategy
 	strategy := dls.determineRoutingStrategy(req.Context)
 
@@ -641,6 +720,78 @@ func (dls *DeepLinkingService) determineRoutingStrategy(context *LinkContext) st
 	}
 }
 
+// LinkRedirect says where a universal link sends the visitor who opens it
+type LinkRedirect struct {
+	Platform   string `json:"platform"` // android, ios or web
+	TrackingID string `json:"tracking_id"`
+	AppURL     string `json:"app_url,omitempty"`   // Opens the installed app
+	StoreURL   string `json:"store_url,omitempty"` // Where to get the app
+	WebURL     string `json:"web_url"`             // The web app
+}
+
+// linkActions are the actions universal links are generated for
+var linkActions = map[string]bool{"detail": true, "play": true, "download": true, "edit": true}
+
+// DetectPlatform tells from a browser's user agent which native app can
+// open links: android, ios, or web when there is none
+func DetectPlatform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "android"):
+		return "android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return "ios"
+	default:
+		return "web"
+	}
+}
+
+// ResolveLink works out where the universal link for action on mediaID
+// sends a visitor with userAgent. On Android the app link is an intent
+// URL that falls back to the Play Store by itself; on iOS the visitor
+// must be sent to the App Store when the app does not open.
+func (dls *DeepLinkingService) ResolveLink(ctx context.Context, action, mediaID, trackingID, userAgent string) (*LinkRedirect, error) {
+	dls = dls.forRequest(ctx)
+
+	if !linkActions[action] {
+		return nil, fmt.Errorf("invalid link action: %s", action)
+	}
+	if mediaID == "" {
+		return nil, fmt.Errorf("media ID is required")
+	}
+	if trackingID == "" {
+		trackingID = dls.generateTrackingID()
+	}
+
+	req := &DeepLinkRequest{MediaID: mediaID, Action: action}
+	webLink, err := dls.generateWebLink(req, trackingID)
+	if err != nil {
+		return nil, err
+	}
+	redirect := &LinkRedirect{Platform: DetectPlatform(userAgent), TrackingID: trackingID, WebURL: webLink.URL}
+
+	switch redirect.Platform {
+	case "android":
+		appLink, err := dls.generateAndroidLink(req, trackingID)
+		if err != nil {
+			return nil, err
+		}
+		redirect.StoreURL = appLink.StoreURL
+		redirect.AppURL = fmt.Sprintf("intent://%s#Intent;scheme=%s;package=%s;S.browser_fallback_url=%s;end",
+			strings.TrimPrefix(appLink.URL, appLink.Scheme+"://"), appLink.Scheme, appLink.Package,
+			neturl.QueryEscape(appLink.StoreURL))
+	case "ios":
+		appLink, err := dls.generateIOSLink(req, trackingID)
+		if err != nil {
+			return nil, err
+		}
+		redirect.AppURL = appLink.URL
+		redirect.StoreURL = appLink.StoreURL
+	}
+
+	return redirect, nil
+}
+
 // Batch link generation for multiple items
 func (dls *DeepLinkingService) GenerateBatchLinks(ctx context.Context, requests []*DeepLinkRequest) ([]*DeepLinkResponse, error) {
 	responses := make([]*DeepLinkResponse, 0, len(requests))
@@ -2,11 +2,15 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"catalogizer/database"
 	"catalogizer/internal/models"
+	"catalogizer/repository"
 )
 
 // ---------------------------------------------------------------------------
@@ -203,6 +207,32 @@ func TestGenerateDeepLinks_DefaultAction(t *testing.T) {
 	}
 }
 
+func TestGenerateDeepLinks_RequestBaseURL(t *testing.T) {
+	ctx := WithRequestBaseURL(context.Background(), "https://media.example.com")
+	req := &DeepLinkRequest{MediaID: "media-789", Action: "detail"}
+
+	// Without a configured base URL, links use the request address
+	resp, err := NewDeepLinkingService("", "v1").GenerateDeepLinks(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(resp.UniversalLink, "https://media.example.com/link/detail/media-789") {
+		t.Errorf("universal link should use the request address, got %s", resp.UniversalLink)
+	}
+	if resp.FallbackURL != "https://media.example.com/detail/media-789" {
+		t.Errorf("fallback URL = %q", resp.FallbackURL)
+	}
+
+	// A configured base URL wins
+	resp, err = NewDeepLinkingService("https://catalogizer.app", "v1").GenerateDeepLinks(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(resp.UniversalLink, "https://catalogizer.app/") {
+		t.Errorf("universal link should use the configured base URL, got %s", resp.UniversalLink)
+	}
+}
+
 func TestGenerateDeepLinks_ExpirationForPlayAndDownloadOnly(t *testing.T) {
 	svc := NewDeepLinkingService("https://catalogizer.app", "v1")
 	ctx := context.Background()
@@ -1200,10 +1230,10 @@ func TestGenerateQRCodeURL(t *testing.T) {
 
 	qr := svc.generateQRCodeURL("https://catalogizer.app/link/detail/m1?track=abc")
 
-	if !strings.HasPrefix(qr, "https://api.qrserver.com/v1/create-qr-code/") {
-		t.Errorf("QR URL should use qrserver.com, got %q", qr)
+	if !strings.HasPrefix(qr, "https://catalogizer.app/api/v1/links/qr?") {
+		t.Errorf("QR URL should point at the API, got %q", qr)
 	}
-	if !strings.Contains(qr, "size=200x200") {
+	if !strings.Contains(qr, "size=200") {
 		t.Error("QR URL should specify size")
 	}
 	if !strings.Contains(qr, "data=") {
@@ -1386,57 +1416,116 @@ func TestTrackLinkEvent(t *testing.T) {
 			if err := svc.TrackLinkEvent(ctx, tt.event); err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
+			if tt.event.Timestamp.IsZero() {
+				t.Error("expected the event to be timestamped")
+			}
 		})
 	}
+
+	if err := svc.TrackLinkEvent(ctx, &LinkTrackingEvent{TrackingID: "t5", EventType: "view"}); err == nil {
+		t.Error("expected an error for an unknown event type")
+	}
+	if err := svc.TrackLinkEvent(ctx, &LinkTrackingEvent{EventType: "click"}); err == nil {
+		t.Error("expected an error without a tracking ID")
+	}
 }
 
 // ---------------------------------------------------------------------------
 // GetLinkAnalytics
 // ---------------------------------------------------------------------------
 
+func TestGetLinkAnalytics_WithoutEventRepository(t *testing.T) {
+	svc := NewDeepLinkingService("https://catalogizer.app", "v1")
+
+	a, err := svc.GetLinkAnalytics(context.Background(), "track_123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.TrackingID != "track_123" {
+		t.Errorf("tracking ID = %q, want %q", a.TrackingID, "track_123")
+	}
+	if a.TotalClicks != 0 || a.ConversionRate != 0 || a.FirstClickAt != nil {
+		t.Errorf("expected empty analytics, got %+v", a)
+	}
+	if a.PlatformBreakdown == nil {
+		t.Error("expected non-nil platform breakdown")
+	}
+}
+
 func TestGetLinkAnalytics(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	if _, err := sqlDB.Exec(`CREATE TABLE link_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tracking_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		platform TEXT NOT NULL DEFAULT '',
+		user_id INTEGER,
+		user_agent TEXT,
+		ip_address TEXT,
+		success BOOLEAN NOT NULL DEFAULT FALSE,
+		app_opened BOOLEAN NOT NULL DEFAULT FALSE,
+		fallback_used BOOLEAN NOT NULL DEFAULT FALSE,
+		error_message TEXT,
+		metadata TEXT,
+		occurred_at DATETIME NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+
 	svc := NewDeepLinkingService("https://catalogizer.app", "v1")
+	svc.SetEventRepository(repository.NewLinkEventRepository(database.WrapDB(sqlDB, database.DialectSQLite)))
 	ctx := context.Background()
 
-	tests := []struct {
-		name       string
-		trackingID string
-	}{
-		{"standard", "track_123"},
-		{"other", "track_abc"},
+	first := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, event := range []*LinkTrackingEvent{
+		{TrackingID: "t1", EventType: "click", Platform: "android", IPAddress: "10.0.0.1", UserAgent: "A", Timestamp: first},
+		{TrackingID: "t1", EventType: "click", Platform: "android", IPAddress: "10.0.0.1", UserAgent: "A", Timestamp: first.Add(time.Minute)},
+		{TrackingID: "t1", EventType: "click", Platform: "ios", UserID: 7, IPAddress: "10.0.0.2", Timestamp: first.Add(time.Hour)},
+		{TrackingID: "t1", EventType: "click", Platform: "web", IPAddress: "10.0.0.3", Timestamp: first.Add(2 * time.Hour)},
+		{TrackingID: "t1", EventType: "open", Platform: "android", Success: true, AppOpened: true, Timestamp: first.Add(time.Minute)},
+		{TrackingID: "t1", EventType: "fallback", Platform: "ios", FallbackUsed: true, Timestamp: first.Add(time.Hour)},
+		{TrackingID: "t2", EventType: "click", Platform: "web", Timestamp: first},
+	} {
+		if err := svc.TrackLinkEvent(ctx, event); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			a, err := svc.GetLinkAnalytics(ctx, tt.trackingID)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if a == nil {
-				t.Fatal("expected non-nil analytics")
-			}
-			if a.TrackingID != tt.trackingID {
-				t.Errorf("tracking ID = %q, want %q", a.TrackingID, tt.trackingID)
-			}
-			if a.TotalClicks <= 0 {
-				t.Error("expected positive total clicks")
-			}
-			if a.UniqueClicks <= 0 {
-				t.Error("expected positive unique clicks")
-			}
-			if a.UniqueClicks > a.TotalClicks {
-				t.Error("unique should not exceed total")
-			}
-			if a.PlatformBreakdown == nil || len(a.PlatformBreakdown) == 0 {
-				t.Error("expected non-empty platform breakdown")
-			}
-			if a.ConversionRate < 0 || a.ConversionRate > 1 {
-				t.Errorf("conversion rate %f out of [0,1]", a.ConversionRate)
-			}
-			if a.FirstClickAt.After(a.LastClickAt) {
-				t.Error("first click should be before last click")
-			}
-		})
+	a, err := svc.GetLinkAnalytics(ctx, "t1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.TotalClicks != 4 || a.UniqueClicks != 3 {
+		t.Errorf("clicks = %d total, %d unique, want 4 and 3", a.TotalClicks, a.UniqueClicks)
+	}
+	if a.Opens != 1 || a.Fallbacks != 1 || a.Errors != 0 {
+		t.Errorf("opens = %d, fallbacks = %d, errors = %d", a.Opens, a.Fallbacks, a.Errors)
+	}
+	if a.ConversionRate != 0.25 {
+		t.Errorf("conversion rate = %f, want 0.25", a.ConversionRate)
+	}
+	want := map[string]int{"android": 2, "ios": 1, "web": 1}
+	if fmt.Sprint(a.PlatformBreakdown) != fmt.Sprint(want) {
+		t.Errorf("platform breakdown = %v, want %v", a.PlatformBreakdown, want)
+	}
+	if a.FirstClickAt == nil || !a.FirstClickAt.Equal(first) {
+		t.Errorf("first click = %v, want %v", a.FirstClickAt, first)
+	}
+	if a.LastClickAt == nil || !a.LastClickAt.Equal(first.Add(2*time.Hour)) {
+		t.Errorf("last click = %v", a.LastClickAt)
+	}
+
+	empty, err := svc.GetLinkAnalytics(ctx, "unknown")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty.TotalClicks != 0 || empty.FirstClickAt != nil {
+		t.Errorf("expected no events, got %+v", empty)
 	}
 }
 
@@ -2091,3 +2180,69 @@ func TestNativePlatformLinks_NilContextHandling(t *testing.T) {
 		})
 	}
 }
+
+// ---------------------------------------------------------------------------
+// DetectPlatform / ResolveLink
+// ---------------------------------------------------------------------------
+
+func TestDetectPlatform(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", "android"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", "ios"},
+		{"Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15", "ios"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0", "web"},
+		{"", "web"},
+	}
+
+	for _, tt := range tests {
+		if got := DetectPlatform(tt.userAgent); got != tt.want {
+			t.Errorf("DetectPlatform(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	svc := NewDeepLinkingService("https://catalogizer.app", "v1")
+	ctx := context.Background()
+
+	android, err := svc.ResolveLink(ctx, "play", "m1", "track_1", "Mozilla/5.0 (Linux; Android 14)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(android.AppURL, "intent://play/m1?") {
+		t.Errorf("android app URL = %q", android.AppURL)
+	}
+	if !strings.Contains(android.AppURL, "package=com.catalogizer.app;") ||
+		!strings.Contains(android.AppURL, "S.browser_fallback_url=https%3A%2F%2Fplay.google.com") {
+		t.Errorf("android app URL should fall back to the Play Store, got %q", android.AppURL)
+	}
+
+	ios, err := svc.ResolveLink(ctx, "detail", "m1", "track_1", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(ios.AppURL, "catalogizer://detail/m1") {
+		t.Errorf("ios app URL = %q", ios.AppURL)
+	}
+	if !strings.HasPrefix(ios.StoreURL, "https://apps.apple.com/") {
+		t.Errorf("ios store URL = %q", ios.StoreURL)
+	}
+
+	web, err := svc.ResolveLink(ctx, "detail", "m1", "", "curl/8.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if web.Platform != "web" || web.AppURL != "" {
+		t.Errorf("web redirect = %+v", web)
+	}
+	if !strings.HasPrefix(web.WebURL, "https://catalogizer.app/detail/m1?") || !strings.Contains(web.WebURL, "track=track_") {
+		t.Errorf("web URL = %q", web.WebURL)
+	}
+
+	if _, err := svc.ResolveLink(ctx, "delete", "m1", "", ""); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// demoLibraryFile is one file of the demo library: a path relative to the
+// library and the kind of placeholder written there.
+type demoLibraryFile struct {
+	path string
+	kind string
+}
+
+// demoLibraryFiles lays the demo library out the way media is usually
+// organised, so the scanner recognises movies, series, albums and photos.
+var demoLibraryFiles = []demoLibraryFile{
+	{"Movies/The Placeholder (2021)/The Placeholder (2021).mp4", "mp4"},
+	{"Movies/Sample Story (2019)/Sample Story (2019).mp4", "mp4"},
+	{"Movies/Test Pattern Returns (2023)/Test Pattern Returns (2023).mkv", "mkv"},
+	{"TV Shows/Demo Series/Season 01/Demo Series - S01E01.mkv", "mkv"},
+	{"TV Shows/Demo Series/Season 01/Demo Series - S01E02.mkv", "mkv"},
+	{"TV Shows/Demo Series/Season 02/Demo Series - S02E01.mkv", "mkv"},
+	{"Music/Demo Artist/First Light (2020)/01 - Opening.wav", "wav"},
+	{"Music/Demo Artist/First Light (2020)/02 - Interlude.wav", "wav"},
+	{"Music/Demo Artist/First Light (2020)/03 - Closing.wav", "wav"},
+	{"Music/Sample Band/Placeholder Sessions (2022)/01 - Warm Up.wav", "wav"},
+	{"Photos/2024/Sunrise.png", "png"},
+	{"Photos/2024/Dusk.png", "png"},
+	{"Photos/2024/Ocean.png", "png"},
+}
+
+// GenerateDemoLibrary writes small placeholder media under dir for
+// exploring the UI: videos that carry only a container header, one
+// second of silence for each song and gradient images for photos. Files
+// that already exist are kept. It returns the paths written, relative to
+// dir.
+func GenerateDemoLibrary(dir string) ([]string, error) {
+	var written []string
+	for i, file := range demoLibraryFiles {
+		path := filepath.Join(dir, filepath.FromSlash(file.path))
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		data, err := demoLibraryContent(file.kind, i)
+		if err != nil {
+			return written, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return written, fmt.Errorf("failed to create demo library directory: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return written, fmt.Errorf("failed to write demo library file: %w", err)
+		}
+		written = append(written, file.path)
+	}
+	return written, nil
+}
+
+// demoLibraryContent returns the placeholder content of a kind of file;
+// seed varies the colours of images.
+func demoLibraryContent(kind string, seed int) ([]byte, error) {
+	switch kind {
+	case "mp4":
+		// An ftyp box, enough for the file to be identified as MP4
+		box := []byte{0, 0, 0, 24, 'f', 't', 'y', 'p', 'i', 's', 'o', 'm', 0, 0, 2, 0, 'i', 's', 'o', 'm', 'm', 'p', '4', '1'}
+		return box, nil
+	case "mkv":
+		// The EBML header magic of Matroska files
+		return []byte{0x1A, 0x45, 0xDF, 0xA3}, nil
+	case "wav":
+		return silentWAV(8000), nil
+	case "png":
+		img := image.NewRGBA(image.Rect(0, 0, 320, 180))
+		for y := 0; y < 180; y++ {
+			for x := 0; x < 320; x++ {
+				img.Set(x, y, color.RGBA{
+					R: uint8(x * 255 / 320),
+					G: uint8(y * 255 / 180),
+					B: uint8(seed * 60),
+					A: 255,
+				})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode demo image: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown demo file kind: %s", kind)
+}
+
+// silentWAV returns one second of 8-bit mono silence at sampleRate.
+func silentWAV(sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+sampleRate))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))         // fmt chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))          // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))          // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate)) // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(1))          // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(8))          // bits per sample
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	buf.Write(bytes.Repeat([]byte{0x80}, sampleRate)) // 8-bit PCM is silent at 128
+	return buf.Bytes()
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogizer/database"
+
+	"go.uber.org/zap"
+)
+
+// Dependency kinds reported by DependencyMonitor.
+const (
+	DependencyKindBinary  = "binary"
+	DependencyKindService = "service"
+	DependencyKindStorage = "storage"
+)
+
+// DependencyProbe checks an external dependency, returning nil when it is
+// usable. The returned error is shown to clients as the reason the
+// dependency is unavailable.
+type DependencyProbe func(ctx context.Context) error
+
+// DependencySource lists dependencies that change at runtime, such as
+// the configured storage roots, keyed by dependency name.
+type DependencySource func(ctx context.Context) (map[string]DependencyProbe, error)
+
+// DependencyStatus is the outcome of the latest probe of a dependency.
+type DependencyStatus struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Available bool      `json:"available"`
+	Reason    string    `json:"reason,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Since is when the dependency last changed availability.
+	Since time.Time `json:"since"`
+	// LatencyMs is how long the latest probe took.
+	LatencyMs float64 `json:"latency_ms"`
+	// Critical dependencies make the server not ready while unavailable.
+	Critical bool `json:"critical,omitempty"`
+}
+
+// DependencyMonitorConfig controls how often dependencies are re-probed.
+type DependencyMonitorConfig struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type registeredDependency struct {
+	kind     string
+	critical bool
+	probe    DependencyProbe
+}
+
+type registeredSource struct {
+	kind string
+	list DependencySource
+}
+
+// DependencyMonitor probes the external dependencies the server needs
+// (tools such as ffmpeg, Redis, storage roots) at boot and periodically
+// afterwards. Missing dependencies put the server in degraded mode: the
+// features that need them report unavailable instead of failing in
+// unpredictable ways, and recover on their own once a later probe
+// succeeds.
+type DependencyMonitor struct {
+	logger *zap.Logger
+	config DependencyMonitorConfig
+	now    func() time.Time
+
+	// probeMu lets concurrent ProbeFresh calls share one probe
+	probeMu sync.Mutex
+
+	mu           sync.RWMutex
+	dependencies map[string]registeredDependency
+	sources      []registeredSource
+	statuses     map[string]DependencyStatus
+	probedAt     time.Time
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewDependencyMonitor creates a new DependencyMonitor.
+func NewDependencyMonitor(logger *zap.Logger, config DependencyMonitorConfig) *DependencyMonitor {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &DependencyMonitor{
+		logger:       logger,
+		config:       config,
+		now:          time.Now,
+		dependencies: make(map[string]registeredDependency),
+		statuses:     make(map[string]DependencyStatus),
+	}
+}
+
+// Register adds a dependency, replacing any existing one with the same
+// name. It is not probed until the next ProbeAll.
+func (m *DependencyMonitor) Register(name, kind string, probe DependencyProbe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dependencies[name] = registeredDependency{kind: kind, probe: probe}
+}
+
+// RegisterCritical adds a dependency the server cannot serve requests
+// without, such as its database. Ready fails while it is unavailable.
+func (m *DependencyMonitor) RegisterCritical(name, kind string, probe DependencyProbe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dependencies[name] = registeredDependency{kind: kind, critical: true, probe: probe}
+}
+
+// RegisterSource adds a dynamic set of dependencies, listed again on
+// every probe. Dependencies that drop out of the list are forgotten.
+func (m *DependencyMonitor) RegisterSource(kind string, list DependencySource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources = append(m.sources, registeredSource{kind: kind, list: list})
+}
+
+// ProbeAll probes every dependency and returns their statuses.
+func (m *DependencyMonitor) ProbeAll(ctx context.Context) []DependencyStatus {
+	m.mu.RLock()
+	dependencies := make(map[string]registeredDependency, len(m.dependencies))
+	for name, dep := range m.dependencies {
+		dependencies[name] = dep
+	}
+	sources := append([]registeredSource(nil), m.sources...)
+	m.mu.RUnlock()
+
+	for _, source := range sources {
+		probes, err := source.list(ctx)
+		if err != nil {
+			// Keep the previous statuses of this kind rather than
+			// forgetting them because the listing failed
+			m.logger.Warn("Failed to list dependencies", zap.String("kind", source.kind), zap.Error(err))
+			m.mu.RLock()
+			for name, status := range m.statuses {
+				if _, ok := dependencies[name]; !ok && status.Kind == source.kind {
+					dependencies[name] = registeredDependency{kind: source.kind}
+				}
+			}
+			m.mu.RUnlock()
+			continue
+		}
+		for name, probe := range probes {
+			dependencies[name] = registeredDependency{kind: source.kind, probe: probe}
+		}
+	}
+
+	type probeResult struct {
+		err     error
+		latency time.Duration
+	}
+	results := make(map[string]probeResult, len(dependencies))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for name, dep := range dependencies {
+		if dep.probe == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, probe DependencyProbe) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+			defer cancel()
+			started := time.Now()
+			err := probe(probeCtx)
+			latency := time.Since(started)
+			resultsMu.Lock()
+			results[name] = probeResult{err: err, latency: latency}
+			resultsMu.Unlock()
+		}(name, dep.probe)
+	}
+	wg.Wait()
+
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make(map[string]DependencyStatus, len(dependencies))
+	for name, dep := range dependencies {
+		previous, known := m.statuses[name]
+		result, probed := results[name]
+		if !probed {
+			statuses[name] = previous
+			continue
+		}
+
+		status := DependencyStatus{
+			Name:      name,
+			Kind:      dep.kind,
+			Available: result.err == nil,
+			Critical:  dep.critical,
+			LatencyMs: float64(result.latency.Microseconds()) / 1000,
+			CheckedAt: now,
+			Since:     now,
+		}
+		if result.err != nil {
+			status.Reason = result.err.Error()
+		}
+		if known && previous.Available == status.Available {
+			status.Since = previous.Since
+		}
+		switch {
+		case !status.Available && (!known || previous.Available):
+			m.logger.Warn("Dependency unavailable, running in degraded mode",
+				zap.String("dependency", name), zap.String("kind", dep.kind), zap.String("reason", status.Reason))
+		case status.Available && known && !previous.Available:
+			m.logger.Info("Dependency available again", zap.String("dependency", name), zap.String("kind", dep.kind))
+		}
+		statuses[name] = status
+	}
+	m.statuses = statuses
+	m.probedAt = now
+	return m.sortedStatuses()
+}
+
+// ProbeFresh returns statuses no older than maxAge, probing every
+// dependency when the latest probe is older. Callers arriving while a
+// probe runs wait for it instead of starting another.
+func (m *DependencyMonitor) ProbeFresh(ctx context.Context, maxAge time.Duration) []DependencyStatus {
+	m.probeMu.Lock()
+	defer m.probeMu.Unlock()
+
+	m.mu.RLock()
+	fresh := !m.probedAt.IsZero() && m.now().Sub(m.probedAt) < maxAge
+	m.mu.RUnlock()
+	if fresh {
+		return m.Statuses()
+	}
+	return m.ProbeAll(ctx)
+}
+
+// Statuses returns the statuses from the latest probe, sorted by kind and
+// name.
+func (m *DependencyMonitor) Statuses() []DependencyStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sortedStatuses()
+}
+
+func (m *DependencyMonitor) sortedStatuses() []DependencyStatus {
+	statuses := make([]DependencyStatus, 0, len(m.statuses))
+	for _, status := range m.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kind != statuses[j].Kind {
+			return statuses[i].Kind < statuses[j].Kind
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Status returns the latest status of a dependency.
+func (m *DependencyMonitor) Status(name string) (DependencyStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status, ok := m.statuses[name]
+	return status, ok
+}
+
+// Available reports whether a dependency passed its latest probe.
+// Dependencies that have not been probed yet count as available.
+func (m *DependencyMonitor) Available(name string) bool {
+	return m.Check(name) == nil
+}
+
+// Check returns an error naming the reason when a dependency failed its
+// latest probe.
+func (m *DependencyMonitor) Check(name string) error {
+	status, ok := m.Status(name)
+	if !ok || status.Available {
+		return nil
+	}
+	return fmt.Errorf("%s is unavailable: %s", name, status.Reason)
+}
+
+// Degraded reports whether any dependency failed its latest probe.
+func (m *DependencyMonitor) Degraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, status := range m.statuses {
+		if !status.Available {
+			return true
+		}
+	}
+	return false
+}
+
+// Ready returns an error naming the critical dependencies that failed
+// their latest probe.
+func (m *DependencyMonitor) Ready() error {
+	var failed []string
+	for _, status := range m.Statuses() {
+		if status.Critical && !status.Available {
+			failed = append(failed, status.Name+": "+status.Reason)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("critical dependencies unavailable: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Start re-probes dependencies periodically until Stop is called.
+func (m *DependencyMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.ProbeAll(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops periodic probing.
+func (m *DependencyMonitor) Stop() {
+	m.mu.Lock()
+	stop := m.stop
+	m.stop = nil
+	m.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	m.wg.Wait()
+}
+
+// BinaryProbe checks that an executable is on the PATH.
+func BinaryProbe(binary string) DependencyProbe {
+	return func(context.Context) error {
+		if _, err := exec.LookPath(binary); err != nil {
+			return fmt.Errorf("%s not found in PATH", binary)
+		}
+		return nil
+	}
+}
+
+// StorageRootDependency is the dependency name of a storage root.
+func StorageRootDependency(name string) string {
+	return "storage:" + name
+}
+
+// StorageRootProbes lists the enabled storage roots, each probed by
+// connecting to it, even while its circuit breaker is open.
+func StorageRootProbes(db *database.DB, providers *StorageProviderFactory) DependencySource {
+	return func(ctx context.Context) (map[string]DependencyProbe, error) {
+		rows, err := db.QueryContext(ctx, `SELECT name, enabled FROM storage_roots`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list storage roots: %w", err)
+		}
+		defer rows.Close()
+
+		probes := make(map[string]DependencyProbe)
+		for rows.Next() {
+			var name string
+			var enabled sql.NullBool
+			if err := rows.Scan(&name, &enabled); err != nil {
+				return nil, fmt.Errorf("failed to scan storage root: %w", err)
+			}
+			if enabled.Valid && !enabled.Bool {
+				continue
+			}
+			probes[StorageRootDependency(name)] = func(ctx context.Context) error {
+				return providers.Probe(ctx, name)
+			}
+		}
+		return probes, rows.Err()
+	}
+}
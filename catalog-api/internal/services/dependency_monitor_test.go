@@ -0,0 +1,163 @@
+package services
+
+import (
+	"catalogizer/config"
+	"catalogizer/database"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDependencyMonitor_ProbeAll(t *testing.T) {
+	monitor := NewDependencyMonitor(zap.NewNop(), DependencyMonitorConfig{})
+	now := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	assert.NoError(t, monitor.Check("redis"), "unprobed dependencies count as available")
+
+	var redisErr error = errors.New("connection refused")
+	monitor.Register("redis", DependencyKindService, func(context.Context) error { return redisErr })
+	monitor.Register("ffmpeg", DependencyKindBinary, func(context.Context) error { return nil })
+
+	statuses := monitor.ProbeAll(ctx)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "ffmpeg", statuses[0].Name)
+	assert.True(t, statuses[0].Available)
+	assert.Equal(t, "redis", statuses[1].Name)
+	assert.False(t, statuses[1].Available)
+	assert.Equal(t, "connection refused", statuses[1].Reason)
+	assert.True(t, monitor.Degraded())
+	assert.True(t, monitor.Available("ffmpeg"))
+	assert.EqualError(t, monitor.Check("redis"), "redis is unavailable: connection refused")
+
+	// Still down: Since stays at the first failure
+	failedAt := now
+	now = now.Add(time.Minute)
+	monitor.ProbeAll(ctx)
+	status, ok := monitor.Status("redis")
+	require.True(t, ok)
+	assert.Equal(t, failedAt, status.Since)
+	assert.Equal(t, now, status.CheckedAt)
+
+	// Recovers on the next probe
+	redisErr = nil
+	now = now.Add(time.Minute)
+	monitor.ProbeAll(ctx)
+	status, _ = monitor.Status("redis")
+	assert.True(t, status.Available)
+	assert.Empty(t, status.Reason)
+	assert.Equal(t, now, status.Since)
+	assert.False(t, monitor.Degraded())
+}
+
+func TestDependencyMonitor_Timeout(t *testing.T) {
+	monitor := NewDependencyMonitor(zap.NewNop(), DependencyMonitorConfig{Timeout: 10 * time.Millisecond})
+	monitor.Register("nas", DependencyKindStorage, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	monitor.ProbeAll(context.Background())
+	assert.ErrorContains(t, monitor.Check("nas"), "deadline exceeded")
+}
+
+func TestDependencyMonitor_Sources(t *testing.T) {
+	monitor := NewDependencyMonitor(zap.NewNop(), DependencyMonitorConfig{})
+	ctx := context.Background()
+
+	probes := map[string]DependencyProbe{
+		"storage:a": func(context.Context) error { return errors.New("unreachable") },
+		"storage:b": func(context.Context) error { return nil },
+	}
+	var listErr error
+	monitor.RegisterSource(DependencyKindStorage, func(context.Context) (map[string]DependencyProbe, error) {
+		return probes, listErr
+	})
+
+	monitor.ProbeAll(ctx)
+	assert.Len(t, monitor.Statuses(), 2)
+	assert.Error(t, monitor.Check("storage:a"))
+
+	// A failed listing keeps the previous statuses
+	listErr = errors.New("database is locked")
+	monitor.ProbeAll(ctx)
+	assert.Len(t, monitor.Statuses(), 2)
+	assert.Error(t, monitor.Check("storage:a"))
+
+	// Removed roots are forgotten
+	listErr = nil
+	delete(probes, "storage:a")
+	monitor.ProbeAll(ctx)
+	assert.Len(t, monitor.Statuses(), 1)
+	assert.NoError(t, monitor.Check("storage:a"))
+}
+
+func TestStorageRootProbes(t *testing.T) {
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "deps.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	present := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "unmounted")
+	_, err = db.ExecContext(ctx, `INSERT INTO storage_roots (name, protocol, path, enabled) VALUES
+		('media', 'local', ?, 1), ('backup', 'local', ?, 1), ('archive', 'local', ?, 0)`,
+		present, missing, missing)
+	require.NoError(t, err)
+
+	monitor := NewDependencyMonitor(zap.NewNop(), DependencyMonitorConfig{})
+	monitor.RegisterSource(DependencyKindStorage, StorageRootProbes(db, NewStorageProviderFactory(db, localRootClients{}, zap.NewNop())))
+	statuses := monitor.ProbeAll(ctx)
+
+	require.Len(t, statuses, 2, "disabled roots are not probed")
+	assert.NoError(t, monitor.Check(StorageRootDependency("media")))
+	assert.ErrorContains(t, monitor.Check(StorageRootDependency("backup")), "storage:backup is unavailable")
+
+	// Mounting the root makes it available again
+	require.NoError(t, os.Mkdir(missing, 0o755))
+	monitor.ProbeAll(ctx)
+	assert.False(t, monitor.Degraded())
+}
+
+func TestDependencyMonitor_Ready(t *testing.T) {
+	monitor := NewDependencyMonitor(zap.NewNop(), DependencyMonitorConfig{})
+	now := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	probes := 0
+	var dbErr error
+	monitor.RegisterCritical("database", DependencyKindService, func(context.Context) error {
+		probes++
+		time.Sleep(2 * time.Millisecond)
+		return dbErr
+	})
+	monitor.Register("redis", DependencyKindService, func(context.Context) error { return errors.New("connection refused") })
+
+	statuses := monitor.ProbeFresh(ctx, 5*time.Second)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Critical)
+	assert.GreaterOrEqual(t, statuses[0].LatencyMs, 2.0)
+	assert.False(t, statuses[1].Critical)
+	assert.NoError(t, monitor.Ready(), "only critical dependencies make the server not ready")
+
+	// Recent probes are reused
+	dbErr = errors.New("database is locked")
+	monitor.ProbeFresh(ctx, 5*time.Second)
+	assert.Equal(t, 1, probes)
+	assert.NoError(t, monitor.Ready())
+
+	now = now.Add(5 * time.Second)
+	monitor.ProbeFresh(ctx, 5*time.Second)
+	assert.Equal(t, 2, probes)
+	assert.EqualError(t, monitor.Ready(), "critical dependencies unavailable: database: database is locked")
+}
@@ -0,0 +1,489 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Protocols network discovery looks for. All but DLNA can be added as
+// storage roots.
+const (
+	DiscoveryProtocolSMB    = "smb"
+	DiscoveryProtocolNFS    = "nfs"
+	DiscoveryProtocolWebDAV = "webdav"
+	DiscoveryProtocolDLNA   = "dlna"
+)
+
+// How a source was discovered.
+const (
+	// DiscoveryMethodSMB is share enumeration on an SMB host.
+	DiscoveryMethodSMB = "smb"
+	// DiscoveryMethodShowmount is the export list of an NFS server.
+	DiscoveryMethodShowmount = "showmount"
+	// DiscoveryMethodMDNS is an mDNS/Bonjour service announcement.
+	DiscoveryMethodMDNS = "mdns"
+	// DiscoveryMethodSSDP is an SSDP reply of a UPnP device.
+	DiscoveryMethodSSDP = "ssdp"
+)
+
+// DiscoveryProtocols lists the protocols discovery looks for.
+func DiscoveryProtocols() []string {
+	return []string{DiscoveryProtocolSMB, DiscoveryProtocolNFS, DiscoveryProtocolWebDAV, DiscoveryProtocolDLNA}
+}
+
+// DiscoveryRequest narrows a discovery. Without a host the local network
+// is browsed over mDNS and SSDP, and every server found is asked for its
+// NFS exports.
+type DiscoveryRequest struct {
+	// Host limits discovery to one server, which is also probed directly
+	Host string `json:"host"`
+	// Protocols limits discovery to some protocols, all when empty
+	Protocols []string `json:"protocols"`
+	// Username, Password and Domain sign in to SMB hosts to list their
+	// shares
+	Username string  `json:"username"`
+	Password string  `json:"password"`
+	Domain   *string `json:"domain"`
+}
+
+// DiscoveredRoot is the storage root a discovered source would be added
+// as, in the form the storage root API takes.
+type DiscoveredRoot struct {
+	Name     string  `json:"name"`
+	Protocol string  `json:"protocol"`
+	Host     *string `json:"host,omitempty"`
+	Port     *int    `json:"port,omitempty"`
+	Path     *string `json:"path,omitempty"`
+	URL      *string `json:"url,omitempty"`
+}
+
+// DiscoveredSource is a share, export or server found on the network.
+type DiscoveredSource struct {
+	Protocol string `json:"protocol"`
+	Host     string `json:"host"`
+	// Address is the host's IP address, when discovery learned it
+	Address string `json:"address,omitempty"`
+	Port    int    `json:"port"`
+	// ShareName is the SMB share, NFS export or WebDAV path; empty for
+	// servers whose shares are not known
+	ShareName string `json:"share_name,omitempty"`
+	// Name is the name the server announces itself under
+	Name        string  `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Method      string  `json:"method"`
+	Reachable   bool    `json:"reachable"`
+	// Root is set for sources that can be added as a storage root as
+	// they are
+	Root *DiscoveredRoot `json:"root,omitempty"`
+}
+
+// DiscoveryResult is what a discovery found.
+type DiscoveryResult struct {
+	Sources []DiscoveredSource `json:"sources"`
+	// Errors holds why a discovery method found nothing, by method
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// DiscoveryService finds storage the setup wizard can offer to add: SMB
+// shares through SMBDiscoveryService, NFS exports with showmount, and
+// SMB, NFS and WebDAV servers and DLNA media servers that announce
+// themselves over mDNS or SSDP. Every source is checked for reachability.
+type DiscoveryService struct {
+	smb    *SMBDiscoveryService
+	logger *zap.Logger
+	// window is how long mDNS and SSDP replies are waited for
+	window time.Duration
+	// probeTimeout bounds reachability checks and showmount
+	probeTimeout time.Duration
+
+	showmount  func(ctx context.Context, host string) ([]byte, error)
+	browseMDNS func(ctx context.Context, window time.Duration, serviceTypes []string) ([]mdnsService, error)
+	searchSSDP func(ctx context.Context, window time.Duration, target string) ([]ssdpDevice, error)
+	dial       func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewDiscoveryService creates a DiscoveryService that lists SMB shares
+// through smb.
+func NewDiscoveryService(smb *SMBDiscoveryService, logger *zap.Logger) *DiscoveryService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &DiscoveryService{
+		smb:          smb,
+		logger:       logger,
+		window:       3 * time.Second,
+		probeTimeout: 3 * time.Second,
+		showmount: func(ctx context.Context, host string) ([]byte, error) {
+			return exec.CommandContext(ctx, "showmount", "-e", host).Output()
+		},
+		browseMDNS: browseMDNS,
+		searchSSDP: searchSSDP,
+		dial:       (&net.Dialer{}).DialContext,
+	}
+}
+
+// mDNS service types and the protocols they announce.
+var discoveryServiceTypes = map[string]string{
+	"_smb._tcp.local.":     DiscoveryProtocolSMB,
+	"_nfs._tcp.local.":     DiscoveryProtocolNFS,
+	"_webdav._tcp.local.":  DiscoveryProtocolWebDAV,
+	"_webdavs._tcp.local.": DiscoveryProtocolWebDAV,
+}
+
+// ssdpMediaServer is the UPnP device type of DLNA media servers.
+const ssdpMediaServer = "urn:schemas-upnp-org:device:MediaServer:1"
+
+// Default ports of discovered protocols.
+const (
+	smbPort = 445
+	nfsPort = 2049
+)
+
+// Discover finds storage on the network, or on one host. Methods that
+// fail are reported in the result rather than failing the discovery.
+func (s *DiscoveryService) Discover(ctx context.Context, req DiscoveryRequest) (*DiscoveryResult, error) {
+	wanted := make(map[string]bool)
+	for _, p := range req.Protocols {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !containsString(DiscoveryProtocols(), p) {
+			return nil, fmt.Errorf("invalid protocol %q, want one of %s", p, strings.Join(DiscoveryProtocols(), ", "))
+		}
+		wanted[p] = true
+	}
+	if len(wanted) == 0 {
+		for _, p := range DiscoveryProtocols() {
+			wanted[p] = true
+		}
+	}
+	host := strings.TrimSpace(req.Host)
+	s.logger.Info("Discovering network storage", zap.String("host", host), zap.Strings("protocols", req.Protocols))
+
+	result := &DiscoveryResult{Sources: []DiscoveredSource{}}
+	var mu sync.Mutex
+	found := func(sources ...DiscoveredSource) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Sources = append(result.Sources, sources...)
+	}
+	failed := func(method string, err error) {
+		s.logger.Debug("Discovery method failed", zap.String("method", method), zap.Error(err))
+		mu.Lock()
+		defer mu.Unlock()
+		if result.Errors == nil {
+			result.Errors = make(map[string]string)
+		}
+		result.Errors[method] = err.Error()
+	}
+
+	// Servers announce themselves first; their addresses are then asked
+	// for NFS exports, which are rarely announced
+	var wg sync.WaitGroup
+	var nfsHosts []string
+	if host != "" {
+		nfsHosts = append(nfsHosts, host)
+	}
+	var types []string
+	for serviceType, protocol := range discoveryServiceTypes {
+		if wanted[protocol] || wanted[DiscoveryProtocolNFS] {
+			types = append(types, serviceType)
+		}
+	}
+	sort.Strings(types)
+	if len(types) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			services, err := s.browseMDNS(ctx, s.window, types)
+			if err != nil {
+				failed(DiscoveryMethodMDNS, err)
+				return
+			}
+			for _, svc := range services {
+				if host != "" && !svc.matchesHost(host) {
+					continue
+				}
+				// A host asked about keeps the name it was asked by
+				sourceHost := host
+				if host == "" {
+					sourceHost = svc.hostName()
+					mu.Lock()
+					nfsHosts = append(nfsHosts, svc.address())
+					mu.Unlock()
+				}
+				if source, ok := svc.source(sourceHost); ok && wanted[source.Protocol] {
+					found(source)
+				}
+			}
+		}()
+	}
+	if wanted[DiscoveryProtocolDLNA] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			devices, err := s.searchSSDP(ctx, s.window, ssdpMediaServer)
+			if err != nil {
+				failed(DiscoveryMethodSSDP, err)
+				return
+			}
+			for _, device := range devices {
+				source := device.source()
+				if host != "" && !strings.EqualFold(source.Host, host) {
+					continue
+				}
+				found(source)
+			}
+		}()
+	}
+	if host != "" && wanted[DiscoveryProtocolSMB] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sources, err := s.smbShares(ctx, host, req)
+			if err != nil {
+				failed(DiscoveryMethodSMB, err)
+				return
+			}
+			found(sources...)
+		}()
+	}
+	wg.Wait()
+
+	if wanted[DiscoveryProtocolNFS] {
+		for _, h := range uniqueStrings(nfsHosts) {
+			exports, err := s.nfsExports(ctx, h)
+			if err != nil {
+				// Only a host asked about is worth an error; most announced
+				// servers export nothing
+				if host != "" {
+					failed(DiscoveryMethodShowmount, err)
+				}
+				continue
+			}
+			found(exports...)
+		}
+	}
+
+	result.Sources = dedupeSources(result.Sources)
+	s.checkReachability(ctx, result.Sources)
+	sort.SliceStable(result.Sources, func(i, j int) bool {
+		a, b := result.Sources[i], result.Sources[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.ShareName < b.ShareName
+	})
+	return result, nil
+}
+
+// smbShares lists the SMB shares of a host. Without credentials the host
+// itself is reported, for the wizard to ask for them.
+func (s *DiscoveryService) smbShares(ctx context.Context, host string, req DiscoveryRequest) ([]DiscoveredSource, error) {
+	server := DiscoveredSource{Protocol: DiscoveryProtocolSMB, Host: host, Port: smbPort, Method: DiscoveryMethodSMB}
+	if req.Username == "" || s.smb == nil {
+		return []DiscoveredSource{server}, nil
+	}
+	shares, err := s.smb.DiscoverShares(ctx, host, req.Username, req.Password, req.Domain)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]DiscoveredSource, 0, len(shares))
+	for _, share := range shares {
+		// Administrative shares are no place for a catalog
+		if strings.HasSuffix(share.ShareName, "$") {
+			continue
+		}
+		source := server
+		source.ShareName = share.ShareName
+		source.Description = share.Description
+		source.Root = discoveredRoot(source)
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// nfsExports asks an NFS server for its exports.
+func (s *DiscoveryService) nfsExports(ctx context.Context, host string) ([]DiscoveredSource, error) {
+	showCtx, cancel := context.WithTimeout(ctx, s.probeTimeout)
+	defer cancel()
+	out, err := s.showmount(showCtx, host)
+	if err != nil {
+		return nil, fmt.Errorf("showmount -e %s: %w", host, err)
+	}
+	var sources []DiscoveredSource
+	for _, export := range parseShowmountExports(out) {
+		source := DiscoveredSource{
+			Protocol:  DiscoveryProtocolNFS,
+			Host:      host,
+			Port:      nfsPort,
+			ShareName: export,
+			Method:    DiscoveryMethodShowmount,
+		}
+		source.Root = discoveredRoot(source)
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// parseShowmountExports returns the exported paths in the output of
+// showmount -e: a header line, then an export and its clients per line.
+func parseShowmountExports(out []byte) []string {
+	var exports []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "Export list for") || !strings.HasPrefix(line, "/") {
+			continue
+		}
+		// The export is padded out to the client list, which has no
+		// spaces; a path may
+		if i := strings.LastIndexAny(line, " \t"); i > 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		exports = append(exports, line)
+	}
+	return exports
+}
+
+// discoveredRoot returns the storage root an SMB share or NFS export
+// would be added as, or nil for servers whose shares are not known.
+func discoveredRoot(source DiscoveredSource) *DiscoveredRoot {
+	host, port := source.Host, source.Port
+	root := &DiscoveredRoot{Protocol: source.Protocol, Host: &host, Port: &port}
+	switch source.Protocol {
+	case DiscoveryProtocolSMB:
+		if source.ShareName == "" {
+			return nil
+		}
+		share := source.ShareName
+		root.Name = source.Host + "-" + share
+		root.Path = &share
+	case DiscoveryProtocolNFS:
+		if source.ShareName == "" {
+			return nil
+		}
+		export := source.ShareName
+		root.Name = source.Host + "-" + strings.ReplaceAll(strings.Trim(export, "/"), "/", "-")
+		root.Path = &export
+	default:
+		return nil
+	}
+	root.Name = strings.TrimSuffix(strings.ToLower(root.Name), "-")
+	return root
+}
+
+// dedupeSources merges sources found by more than one method into the
+// first, and drops servers whose shares were found too.
+func dedupeSources(sources []DiscoveredSource) []DiscoveredSource {
+	seen := make(map[string]int)
+	withShares := make(map[string]bool)
+	for _, s := range sources {
+		if s.ShareName != "" {
+			withShares[s.Protocol+"|"+strings.ToLower(s.Host)] = true
+		}
+	}
+	var deduped []DiscoveredSource
+	for _, s := range sources {
+		server := s.Protocol + "|" + strings.ToLower(s.Host)
+		if s.ShareName == "" && s.Protocol != DiscoveryProtocolWebDAV && withShares[server] {
+			continue
+		}
+		key := server + "|" + strconv.Itoa(s.Port) + "|" + s.ShareName
+		i, ok := seen[key]
+		if !ok {
+			seen[key] = len(deduped)
+			deduped = append(deduped, s)
+			continue
+		}
+		first := &deduped[i]
+		if first.Name == "" {
+			first.Name = s.Name
+		}
+		if first.Address == "" {
+			first.Address = s.Address
+		}
+		if first.Description == nil {
+			first.Description = s.Description
+		}
+	}
+	return deduped
+}
+
+// checkReachability connects to every source's port, once per address.
+func (s *DiscoveryService) checkReachability(ctx context.Context, sources []DiscoveredSource) {
+	var addrs []string
+	for _, source := range sources {
+		if addr := source.dialAddress(); !containsString(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	reachable := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			dialCtx, cancel := context.WithTimeout(ctx, s.probeTimeout)
+			defer cancel()
+			conn, err := s.dial(dialCtx, "tcp", addr)
+			if err != nil {
+				return
+			}
+			conn.Close()
+			mu.Lock()
+			reachable[addr] = true
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	for i := range sources {
+		sources[i].Reachable = reachable[sources[i].dialAddress()]
+	}
+}
+
+// webdavRoot returns the storage root a WebDAV server would be added as,
+// over HTTPS when secure.
+func webdavRoot(source DiscoveredSource, secure bool) *DiscoveredRoot {
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	url := fmt.Sprintf("%s://%s/%s", scheme, net.JoinHostPort(source.Host, strconv.Itoa(source.Port)),
+		strings.TrimPrefix(source.ShareName, "/"))
+	return &DiscoveredRoot{
+		Name:     strings.ToLower(source.Host) + "-webdav",
+		Protocol: DiscoveryProtocolWebDAV,
+		URL:      &url,
+	}
+}
+
+func (s DiscoveredSource) dialAddress() string {
+	host := s.Host
+	if s.Address != "" {
+		host = s.Address
+	}
+	return net.JoinHostPort(host, strconv.Itoa(s.Port))
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mDNS and SSDP multicast groups.
+var (
+	mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+)
+
+// mdnsService is a service instance announced over mDNS.
+type mdnsService struct {
+	Type     string
+	Instance string
+	Target   string
+	Address  string
+	Port     int
+	TXT      map[string]string
+}
+
+// hostName returns the host the service runs on, without the root dot.
+func (m mdnsService) hostName() string {
+	return strings.TrimSuffix(m.Target, ".")
+}
+
+// address returns the host's address, or its name when none was
+// announced.
+func (m mdnsService) address() string {
+	if m.Address != "" {
+		return m.Address
+	}
+	return m.hostName()
+}
+
+// matchesHost reports whether the service runs on host, given by name,
+// with or without .local, or by address.
+func (m mdnsService) matchesHost(host string) bool {
+	name := m.hostName()
+	return strings.EqualFold(host, name) || strings.EqualFold(host, strings.TrimSuffix(name, ".local")) ||
+		host == m.Address
+}
+
+// source returns the discovered source a service announces, on host.
+func (m mdnsService) source(host string) (DiscoveredSource, bool) {
+	protocol, ok := discoveryServiceTypes[m.Type]
+	if !ok {
+		return DiscoveredSource{}, false
+	}
+	source := DiscoveredSource{
+		Protocol: protocol,
+		Host:     host,
+		Address:  m.Address,
+		Port:     m.Port,
+		Name:     strings.TrimSuffix(strings.TrimSuffix(m.Instance, m.Type), "."),
+		Method:   DiscoveryMethodMDNS,
+	}
+	switch protocol {
+	case DiscoveryProtocolNFS:
+		// Apple's convention: the export in a path key
+		source.ShareName = m.TXT["path"]
+		source.Root = discoveredRoot(source)
+	case DiscoveryProtocolWebDAV:
+		source.ShareName = m.TXT["path"]
+		source.Root = webdavRoot(source, m.Type == "_webdavs._tcp.local.")
+	}
+	return source, true
+}
+
+// browseMDNS asks the local network for instances of service types and
+// collects the answers that arrive within window. The query is a legacy
+// unicast one, answered straight to the asking socket.
+func browseMDNS(ctx context.Context, window time.Duration, serviceTypes []string) ([]mdnsService, error) {
+	query, err := mdnsQuery(serviceTypes)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := multicastExchange(ctx, window, mdnsGroup, query)
+	if err != nil {
+		return nil, fmt.Errorf("mDNS browse failed: %w", err)
+	}
+	records := newMDNSRecords()
+	for _, reply := range replies {
+		records.add(reply)
+	}
+	return records.services(serviceTypes), nil
+}
+
+func mdnsQuery(serviceTypes []string) ([]byte, error) {
+	msg := dnsmessage.Message{}
+	for _, serviceType := range serviceTypes {
+		name, err := dnsmessage.NewName(serviceType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service type %q: %w", serviceType, err)
+		}
+		msg.Questions = append(msg.Questions, dnsmessage.Question{
+			Name:  name,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		})
+	}
+	return msg.Pack()
+}
+
+// mdnsRecords gathers the records of mDNS answers, by lower-cased name.
+type mdnsRecords struct {
+	ptr  map[string][]string
+	srv  map[string]dnsmessage.SRVResource
+	txt  map[string][]string
+	addr map[string]string
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{
+		ptr:  make(map[string][]string),
+		srv:  make(map[string]dnsmessage.SRVResource),
+		txt:  make(map[string][]string),
+		addr: make(map[string]string),
+	}
+}
+
+// add records the answers and additional records of a reply. Replies
+// that do not parse are ignored.
+func (r *mdnsRecords) add(reply []byte) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		return
+	}
+	for _, rr := range append(msg.Answers, msg.Additionals...) {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			instance := body.PTR.String()
+			if !containsString(r.ptr[name], instance) {
+				r.ptr[name] = append(r.ptr[name], instance)
+			}
+		case *dnsmessage.SRVResource:
+			r.srv[name] = *body
+		case *dnsmessage.TXTResource:
+			r.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			r.addr[name] = net.IP(body.A[:]).String()
+		case *dnsmessage.AAAAResource:
+			if _, ok := r.addr[name]; !ok {
+				r.addr[name] = net.IP(body.AAAA[:]).String()
+			}
+		}
+	}
+}
+
+// services returns the instances of service types that gave their host
+// and port.
+func (r *mdnsRecords) services(serviceTypes []string) []mdnsService {
+	var services []mdnsService
+	for _, serviceType := range serviceTypes {
+		for _, instance := range r.ptr[strings.ToLower(serviceType)] {
+			srv, ok := r.srv[strings.ToLower(instance)]
+			if !ok {
+				continue
+			}
+			target := srv.Target.String()
+			txt := make(map[string]string)
+			for _, entry := range r.txt[strings.ToLower(instance)] {
+				key, value, _ := strings.Cut(entry, "=")
+				txt[strings.ToLower(key)] = value
+			}
+			services = append(services, mdnsService{
+				Type:     serviceType,
+				Instance: instance,
+				Target:   target,
+				Address:  r.addr[strings.ToLower(target)],
+				Port:     int(srv.Port),
+				TXT:      txt,
+			})
+		}
+	}
+	return services
+}
+
+// ssdpDevice is a UPnP device that answered an SSDP search.
+type ssdpDevice struct {
+	Location     string
+	USN          string
+	Server       string
+	FriendlyName string
+}
+
+// source returns the discovered source of a media server. DLNA servers
+// cannot be storage roots, so it has none.
+func (d ssdpDevice) source() DiscoveredSource {
+	source := DiscoveredSource{
+		Protocol: DiscoveryProtocolDLNA,
+		Name:     d.FriendlyName,
+		Method:   DiscoveryMethodSSDP,
+	}
+	if u, err := url.Parse(d.Location); err == nil {
+		source.Host = u.Hostname()
+		source.Port, _ = strconv.Atoi(u.Port())
+		if source.Port == 0 {
+			source.Port = 80
+		}
+	}
+	if d.Server != "" {
+		server := d.Server
+		source.Description = &server
+	}
+	return source
+}
+
+// searchSSDP searches the local network for UPnP devices of a type, and
+// reads the friendly name from the description of each that answers
+// within window.
+func searchSSDP(ctx context.Context, window time.Duration, target string) ([]ssdpDevice, error) {
+	mx := int(window / time.Second)
+	if mx < 1 {
+		mx = 1
+	}
+	search := fmt.Sprintf("M-SEARCH * HTTP/1.1\r\nHOST: %s\r\nMAN: \"ssdp:discover\"\r\nMX: %d\r\nST: %s\r\n\r\n",
+		ssdpGroup, mx, target)
+	replies, err := multicastExchange(ctx, window, ssdpGroup, []byte(search))
+	if err != nil {
+		return nil, fmt.Errorf("SSDP search failed: %w", err)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	seen := make(map[string]bool)
+	var devices []ssdpDevice
+	for _, reply := range replies {
+		device, ok := parseSSDPReply(reply)
+		if !ok || seen[device.USN] {
+			continue
+		}
+		seen[device.USN] = true
+		device.FriendlyName = upnpFriendlyName(ctx, client, device.Location)
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// parseSSDPReply reads an SSDP search reply, an HTTP response over UDP.
+func parseSSDPReply(reply []byte) (ssdpDevice, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(reply)), nil)
+	if err != nil {
+		return ssdpDevice{}, false
+	}
+	resp.Body.Close()
+	device := ssdpDevice{
+		Location: resp.Header.Get("Location"),
+		USN:      resp.Header.Get("Usn"),
+		Server:   resp.Header.Get("Server"),
+	}
+	if device.USN == "" {
+		device.USN = device.Location
+	}
+	return device, resp.StatusCode == http.StatusOK && device.Location != ""
+}
+
+// upnpFriendlyName reads the friendly name from a UPnP device
+// description, or returns nothing.
+func upnpFriendlyName(ctx context.Context, client *http.Client, location string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	var description struct {
+		Device struct {
+			FriendlyName string `xml:"friendlyName"`
+		} `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&description); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(description.Device.FriendlyName)
+}
+
+// multicastExchange sends a datagram to a multicast group and returns
+// the replies that arrive within window.
+func multicastExchange(ctx context.Context, window time.Duration, group *net.UDPAddr, request []byte) ([][]byte, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	deadline := time.Now().Add(window)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(request, group); err != nil {
+		return nil, err
+	}
+
+	var replies [][]byte
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return replies, ctx.Err()
+			}
+			return replies, err
+		}
+		replies = append(replies, append([]byte(nil), buf[:n]...))
+	}
+}
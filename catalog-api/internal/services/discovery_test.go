@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseShowmountExports(t *testing.T) {
+	out := []byte("Export list for nas:\n/volume1/media      192.168.1.0/24\n/volume1/My Films  *\n\n")
+	assert.Equal(t, []string{"/volume1/media", "/volume1/My Films"}, parseShowmountExports(out))
+	assert.Empty(t, parseShowmountExports([]byte("Export list for nas:\n")))
+}
+
+func mdnsReply(t *testing.T, build func(b *dnsmessage.Builder)) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	require.NoError(t, b.StartAnswers())
+	build(&b)
+	msg, err := b.Finish()
+	require.NoError(t, err)
+	return msg
+}
+
+func rrHeader(name string) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 120}
+}
+
+func TestMDNSRecords_Services(t *testing.T) {
+	records := newMDNSRecords()
+	records.add(mdnsReply(t, func(b *dnsmessage.Builder) {
+		require.NoError(t, b.PTRResource(rrHeader("_webdavs._tcp.local."),
+			dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Files._webdavs._tcp.local.")}))
+		require.NoError(t, b.SRVResource(rrHeader("Files._webdavs._tcp.local."),
+			dnsmessage.SRVResource{Port: 5006, Target: dnsmessage.MustNewName("nas.local.")}))
+		require.NoError(t, b.TXTResource(rrHeader("Files._webdavs._tcp.local."),
+			dnsmessage.TXTResource{TXT: []string{"path=/media"}}))
+		require.NoError(t, b.AResource(rrHeader("nas.local."), dnsmessage.AResource{A: [4]byte{192, 168, 1, 10}}))
+	}))
+	// An instance without SRV record cannot be reached
+	records.add(mdnsReply(t, func(b *dnsmessage.Builder) {
+		require.NoError(t, b.PTRResource(rrHeader("_smb._tcp.local."),
+			dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Ghost._smb._tcp.local.")}))
+	}))
+	records.add([]byte("not dns"))
+
+	services := records.services([]string{"_smb._tcp.local.", "_webdavs._tcp.local."})
+	require.Len(t, services, 1)
+	svc := services[0]
+	assert.Equal(t, "192.168.1.10", svc.address())
+	assert.True(t, svc.matchesHost("nas"))
+	assert.True(t, svc.matchesHost("192.168.1.10"))
+
+	source, ok := svc.source(svc.hostName())
+	require.True(t, ok)
+	assert.Equal(t, DiscoveryProtocolWebDAV, source.Protocol)
+	assert.Equal(t, "Files", source.Name)
+	assert.Equal(t, "nas.local", source.Host)
+	require.NotNil(t, source.Root)
+	assert.Equal(t, "https://nas.local:5006/media", *source.Root.URL)
+}
+
+func TestParseSSDPReply(t *testing.T) {
+	device, ok := parseSSDPReply([]byte("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\n" +
+		"LOCATION: http://192.168.1.20:8200/rootDesc.xml\r\nSERVER: Linux DLNADOC/1.50 MiniDLNA/1.3\r\n" +
+		"ST: urn:schemas-upnp-org:device:MediaServer:1\r\nUSN: uuid:4d696e69::urn:schemas-upnp-org:device:MediaServer:1\r\n\r\n"))
+	require.True(t, ok)
+	device.FriendlyName = "Living room"
+
+	source := device.source()
+	assert.Equal(t, DiscoveryProtocolDLNA, source.Protocol)
+	assert.Equal(t, "192.168.1.20", source.Host)
+	assert.Equal(t, 8200, source.Port)
+	assert.Equal(t, "Living room", source.Name)
+	assert.Nil(t, source.Root)
+
+	_, ok = parseSSDPReply([]byte("M-SEARCH * HTTP/1.1\r\n\r\n"))
+	assert.False(t, ok)
+}
+
+type fakeConn struct{ net.Conn }
+
+func (fakeConn) Close() error { return nil }
+
+func newFakeDiscoveryService(reachable ...string) *DiscoveryService {
+	s := NewDiscoveryService(nil, zap.NewNop())
+	s.browseMDNS = func(ctx context.Context, window time.Duration, serviceTypes []string) ([]mdnsService, error) {
+		return []mdnsService{
+			{Type: "_smb._tcp.local.", Instance: "NAS._smb._tcp.local.", Target: "nas.local.", Address: "192.168.1.10", Port: 445},
+			{Type: "_webdav._tcp.local.", Instance: "Box._webdav._tcp.local.", Target: "box.local.", Address: "192.168.1.30", Port: 80},
+		}, nil
+	}
+	s.searchSSDP = func(ctx context.Context, window time.Duration, target string) ([]ssdpDevice, error) {
+		return []ssdpDevice{{Location: "http://192.168.1.20:8200/rootDesc.xml", USN: "uuid:1", FriendlyName: "MiniDLNA"}}, nil
+	}
+	s.showmount = func(ctx context.Context, host string) ([]byte, error) {
+		if host == "192.168.1.10" {
+			return []byte("Export list for 192.168.1.10:\n/volume1/media *\n"), nil
+		}
+		return nil, &net.OpError{Op: "dial", Err: assert.AnError}
+	}
+	s.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		for _, addr := range reachable {
+			if addr == address {
+				return fakeConn{}, nil
+			}
+		}
+		return nil, assert.AnError
+	}
+	return s
+}
+
+func TestDiscoveryService_DiscoversNetwork(t *testing.T) {
+	s := newFakeDiscoveryService("192.168.1.10:445", "192.168.1.20:8200")
+
+	result, err := s.Discover(context.Background(), DiscoveryRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	require.Len(t, result.Sources, 4)
+
+	byProtocol := make(map[string]DiscoveredSource)
+	for _, source := range result.Sources {
+		byProtocol[source.Protocol] = source
+	}
+	smb := byProtocol[DiscoveryProtocolSMB]
+	assert.Equal(t, "NAS", smb.Name)
+	assert.True(t, smb.Reachable)
+	assert.Nil(t, smb.Root, "SMB servers need a share")
+
+	nfs := byProtocol[DiscoveryProtocolNFS]
+	assert.Equal(t, DiscoveryMethodShowmount, nfs.Method)
+	assert.Equal(t, "/volume1/media", nfs.ShareName)
+	assert.False(t, nfs.Reachable)
+	require.NotNil(t, nfs.Root)
+	assert.Equal(t, "192.168.1.10-volume1-media", nfs.Root.Name)
+	assert.Equal(t, "/volume1/media", *nfs.Root.Path)
+
+	webdav := byProtocol[DiscoveryProtocolWebDAV]
+	require.NotNil(t, webdav.Root)
+	assert.Equal(t, "http://box.local:80/", *webdav.Root.URL)
+
+	assert.True(t, byProtocol[DiscoveryProtocolDLNA].Reachable)
+}
+
+func TestDiscoveryService_DiscoversHost(t *testing.T) {
+	s := newFakeDiscoveryService()
+
+	result, err := s.Discover(context.Background(), DiscoveryRequest{Host: "nas", Protocols: []string{"smb", "NFS"}})
+	require.NoError(t, err)
+	// The server is found both directly and by its announcement
+	require.Len(t, result.Sources, 1)
+	smb := result.Sources[0]
+	assert.Equal(t, "nas", smb.Host)
+	assert.Equal(t, DiscoveryProtocolSMB, smb.Protocol)
+	assert.Equal(t, "NAS", smb.Name)
+	assert.Equal(t, "192.168.1.10", smb.Address)
+	assert.Contains(t, result.Errors, DiscoveryMethodShowmount)
+
+	_, err = s.Discover(context.Background(), DiscoveryRequest{Protocols: []string{"ftp"}})
+	assert.ErrorContains(t, err, "invalid protocol")
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Encryption key types.
+const (
+	EncryptionKeyAge = "age"
+	EncryptionKeyGPG = "gpg"
+)
+
+// EncryptionKey is a public key a user registered for encrypted downloads.
+type EncryptionKey struct {
+	ID          int64     `json:"id"`
+	UserID      int       `json:"user_id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	IsDefault   bool      `json:"is_default"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Extension returns the file name suffix of artifacts encrypted to the key.
+func (k *EncryptionKey) Extension() string {
+	if k.Type == EncryptionKeyGPG {
+		return ".gpg"
+	}
+	return ".age"
+}
+
+// DownloadEncryptionService manages users' public keys and encrypts
+// downloads to them by streaming through the age or gpg command-line tools.
+type DownloadEncryptionService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	ageBinary string
+	gpgBinary string
+	now       func() time.Time
+}
+
+// NewDownloadEncryptionService creates a DownloadEncryptionService.
+func NewDownloadEncryptionService(db *database.DB, logger *zap.Logger) *DownloadEncryptionService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &DownloadEncryptionService{
+		db:        db,
+		logger:    logger,
+		ageBinary: "age",
+		gpgBinary: "gpg",
+		now:       time.Now,
+	}
+}
+
+// SetAgeBinary overrides the age executable.
+func (s *DownloadEncryptionService) SetAgeBinary(binary string) {
+	s.ageBinary = binary
+}
+
+// SetGPGBinary overrides the gpg executable.
+func (s *DownloadEncryptionService) SetGPGBinary(binary string) {
+	s.gpgBinary = binary
+}
+
+// ageRecipients returns the recipients in an age recipients file, skipping
+// blank lines and comments, or an error for anything that is not a native
+// age or SSH recipient.
+func ageRecipients(publicKey string) ([]string, error) {
+	var recipients []string
+	for _, line := range strings.Split(publicKey, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "age1") && !strings.HasPrefix(line, "ssh-ed25519 ") && !strings.HasPrefix(line, "ssh-rsa ") {
+			return nil, fmt.Errorf("invalid key: %q is not an age or SSH recipient", line)
+		}
+		recipients = append(recipients, line)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("invalid key: no age recipients found")
+	}
+	return recipients, nil
+}
+
+// gpgFingerprint reads the primary key fingerprint of an exported GPG
+// public key without importing it anywhere.
+func (s *DownloadEncryptionService) gpgFingerprint(ctx context.Context, publicKey string) (string, error) {
+	if !strings.Contains(publicKey, "BEGIN PGP PUBLIC KEY BLOCK") {
+		return "", fmt.Errorf("invalid key: expected an ASCII-armored GPG public key")
+	}
+	home, err := os.MkdirTemp("", "gpg-home-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create gpg home: %w", err)
+	}
+	defer os.RemoveAll(home)
+
+	cmd := exec.CommandContext(ctx, s.gpgBinary, "--batch", "--no-tty", "--homedir", home,
+		"--with-colons", "--show-keys")
+	cmd.Stdin = strings.NewReader(publicKey)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("invalid key: gpg could not read it: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		// An upper-case E in the pub record's capabilities means some
+		// (sub)key can encrypt; the first fpr record is the primary key's
+		if len(fields) > 11 && fields[0] == "pub" && !strings.Contains(fields[11], "E") {
+			return "", fmt.Errorf("invalid key: it has no encryption subkey")
+		}
+		if len(fields) > 9 && fields[0] == "fpr" && fields[9] != "" {
+			return fields[9], nil
+		}
+	}
+	return "", fmt.Errorf("invalid key: no public key found")
+}
+
+// AddKey validates and stores a public key for a user. A user's first key
+// becomes their default.
+func (s *DownloadEncryptionService) AddKey(ctx context.Context, key *EncryptionKey) error {
+	key.Name = strings.TrimSpace(key.Name)
+	key.PublicKey = strings.TrimSpace(key.PublicKey)
+	if key.Name == "" {
+		return fmt.Errorf("invalid key: name is required")
+	}
+
+	switch key.Type {
+	case EncryptionKeyAge:
+		recipients, err := ageRecipients(key.PublicKey)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256([]byte(strings.Join(recipients, "\n")))
+		key.Fingerprint = hex.EncodeToString(sum[:16])
+	case EncryptionKeyGPG:
+		fingerprint, err := s.gpgFingerprint(ctx, key.PublicKey)
+		if err != nil {
+			return err
+		}
+		key.Fingerprint = fingerprint
+	default:
+		return fmt.Errorf("invalid key: type must be %q or %q", EncryptionKeyAge, EncryptionKeyGPG)
+	}
+
+	var existing int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_encryption_keys WHERE user_id = ?`, key.UserID).Scan(&existing); err != nil {
+		return fmt.Errorf("failed to count encryption keys: %w", err)
+	}
+	var duplicate int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_encryption_keys WHERE user_id = ? AND fingerprint = ?`,
+		key.UserID, key.Fingerprint).Scan(&duplicate); err != nil {
+		return fmt.Errorf("failed to check for duplicate key: %w", err)
+	}
+	if duplicate > 0 {
+		return fmt.Errorf("encryption key %s is already registered", key.Fingerprint)
+	}
+
+	key.IsDefault = existing == 0
+	key.CreatedAt = s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO user_encryption_keys (user_id, name, key_type, public_key, fingerprint, is_default, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.UserID, key.Name, key.Type, key.PublicKey, key.Fingerprint, key.IsDefault, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save encryption key: %w", err)
+	}
+	key.ID = id
+	return nil
+}
+
+const encryptionKeyColumns = `id, user_id, name, key_type, public_key, fingerprint, is_default, created_at`
+
+func scanEncryptionKey(row interface{ Scan(...interface{}) error }) (*EncryptionKey, error) {
+	var k EncryptionKey
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Type, &k.PublicKey, &k.Fingerprint, &k.IsDefault, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListKeys returns a user's keys, default first.
+func (s *DownloadEncryptionService) ListKeys(ctx context.Context, userID int) ([]EncryptionKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+encryptionKeyColumns+` FROM user_encryption_keys
+		 WHERE user_id = ? ORDER BY is_default DESC, created_at, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list encryption keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []EncryptionKey
+	for rows.Next() {
+		k, err := scanEncryptionKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan encryption key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// GetKey returns one of a user's keys. Keys of other users are reported as
+// not found.
+func (s *DownloadEncryptionService) GetKey(ctx context.Context, userID int, id int64) (*EncryptionKey, error) {
+	k, err := scanEncryptionKey(s.db.QueryRowContext(ctx,
+		`SELECT `+encryptionKeyColumns+` FROM user_encryption_keys WHERE id = ? AND user_id = ?`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("encryption key %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	return k, nil
+}
+
+// ResolveKey finds the key a download asked for: "default" selects the
+// user's default key, anything else is a key ID.
+func (s *DownloadEncryptionService) ResolveKey(ctx context.Context, userID int, ref string) (*EncryptionKey, error) {
+	if ref != "default" {
+		id, err := strconv.ParseInt(ref, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %q is neither \"default\" nor a key ID", ref)
+		}
+		return s.GetKey(ctx, userID, id)
+	}
+
+	k, err := scanEncryptionKey(s.db.QueryRowContext(ctx,
+		`SELECT `+encryptionKeyColumns+` FROM user_encryption_keys WHERE user_id = ? AND is_default = ?`, userID, true))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("default encryption key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	return k, nil
+}
+
+// SetDefaultKey makes a key its owner's default.
+func (s *DownloadEncryptionService) SetDefaultKey(ctx context.Context, userID int, id int64) error {
+	if _, err := s.GetKey(ctx, userID, id); err != nil {
+		return err
+	}
+	return database.NewTxContext(s.db, database.DefaultTransactionConfig()).RunInTransaction(ctx, func(tx *database.Transaction) error {
+		if _, err := tx.Exec(`UPDATE user_encryption_keys SET is_default = ? WHERE user_id = ?`, false, userID); err != nil {
+			return fmt.Errorf("failed to clear default key: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE user_encryption_keys SET is_default = ? WHERE id = ?`, true, id); err != nil {
+			return fmt.Errorf("failed to set default key: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteKey removes one of a user's keys.
+func (s *DownloadEncryptionService) DeleteKey(ctx context.Context, userID int, id int64) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM user_encryption_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete encryption key: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("encryption key %d not found", id)
+	}
+	return nil
+}
+
+// encryptingWriter feeds plaintext to an encryption process whose output
+// goes to the destination writer.
+type encryptingWriter struct {
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	dir    string
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// Close finishes the encrypted stream and reports any failure of the
+// encryption process.
+func (w *encryptingWriter) Close() error {
+	defer os.RemoveAll(w.dir)
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("encryption failed: %v: %s", err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// Encrypt returns a writer that encrypts everything written to it to key
+// and writes the ciphertext to dst. The writer must be closed to flush the
+// stream.
+func (s *DownloadEncryptionService) Encrypt(ctx context.Context, key *EncryptionKey, dst io.Writer) (io.WriteCloser, error) {
+	dir, err := os.MkdirTemp("", "encrypt-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryption workspace: %w", err)
+	}
+	recipientFile := filepath.Join(dir, "recipient")
+	if err := os.WriteFile(recipientFile, []byte(key.PublicKey+"\n"), 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write recipient: %w", err)
+	}
+
+	var cmd *exec.Cmd
+	switch key.Type {
+	case EncryptionKeyAge:
+		cmd = exec.CommandContext(ctx, s.ageBinary, "--encrypt", "-R", recipientFile)
+	case EncryptionKeyGPG:
+		// A throwaway home keeps the server's keyrings untouched; the
+		// recipient file means the key never has to be imported
+		cmd = exec.CommandContext(ctx, s.gpgBinary, "--batch", "--no-tty", "--quiet",
+			"--homedir", dir, "--trust-model", "always",
+			"--recipient-file", recipientFile, "--encrypt", "--output", "-")
+	default:
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("invalid key: unsupported type %q", key.Type)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = dst
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open encryption input: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start %s: %w", key.Type, err)
+	}
+
+	s.logger.Debug("Encrypting download", zap.String("type", key.Type), zap.String("fingerprint", key.Fingerprint))
+	return &encryptingWriter{stdin: stdin, cmd: cmd, stderr: stderr, dir: dir}, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testAgeRecipient = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+
+const testGPGKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEZQAAABYJKwYBBAHaRw8BAQdA
+-----END PGP PUBLIC KEY BLOCK-----`
+
+func setupEncryptionTestService(t *testing.T) *DownloadEncryptionService {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE user_encryption_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			key_type TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			is_default BOOLEAN NOT NULL DEFAULT 0,
+			created_at DATETIME,
+			UNIQUE(user_id, fingerprint)
+		);`)
+	require.NoError(t, err)
+
+	return NewDownloadEncryptionService(database.WrapDB(sqlDB, database.DialectSQLite), zap.NewNop())
+}
+
+// writeFakeTool writes a shell script standing in for age or gpg.
+func writeFakeTool(t *testing.T, name, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake encryption tools require a POSIX shell")
+	}
+	binary := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\n"+script), 0755))
+	return binary
+}
+
+func TestDownloadEncryptionService_AddKeyValidation(t *testing.T) {
+	svc := setupEncryptionTestService(t)
+	ctx := context.Background()
+
+	err := svc.AddKey(ctx, &EncryptionKey{UserID: 1, Name: "laptop", Type: EncryptionKeyAge, PublicKey: "not-a-key"})
+	assert.ErrorContains(t, err, "invalid key")
+
+	err = svc.AddKey(ctx, &EncryptionKey{UserID: 1, Name: "laptop", Type: "pgp", PublicKey: testAgeRecipient})
+	assert.ErrorContains(t, err, "type must be")
+
+	err = svc.AddKey(ctx, &EncryptionKey{UserID: 1, Name: "laptop", Type: EncryptionKeyGPG, PublicKey: testAgeRecipient})
+	assert.ErrorContains(t, err, "ASCII-armored")
+
+	err = svc.AddKey(ctx, &EncryptionKey{UserID: 1, Name: " ", Type: EncryptionKeyAge, PublicKey: testAgeRecipient})
+	assert.ErrorContains(t, err, "name is required")
+}
+
+func TestDownloadEncryptionService_KeyManagement(t *testing.T) {
+	svc := setupEncryptionTestService(t)
+	ctx := context.Background()
+	svc.SetGPGBinary(writeFakeTool(t, "gpg", `cat > /dev/null
+echo "pub:-:255:22:1122334455667788:1700000000:::-:::scESC::::::23::0:"
+echo "fpr:::::::::0123456789ABCDEF0123456789ABCDEF01234567:"
+echo "sub:-:255:18:8877665544332211:1700000000::::::e::::::18:"
+echo "fpr:::::::::FEDCBA9876543210FEDCBA9876543210FEDCBA98:"
+`))
+
+	ageKey := &EncryptionKey{UserID: 1, Name: "laptop", Type: EncryptionKeyAge, PublicKey: "# laptop\n" + testAgeRecipient + "\n"}
+	require.NoError(t, svc.AddKey(ctx, ageKey))
+	assert.True(t, ageKey.IsDefault, "a user's first key becomes the default")
+	assert.Len(t, ageKey.Fingerprint, 32)
+
+	gpgKey := &EncryptionKey{UserID: 1, Name: "work", Type: EncryptionKeyGPG, PublicKey: testGPGKey}
+	require.NoError(t, svc.AddKey(ctx, gpgKey))
+	assert.False(t, gpgKey.IsDefault)
+	assert.Equal(t, "0123456789ABCDEF0123456789ABCDEF01234567", gpgKey.Fingerprint, "the primary key fingerprint is used")
+
+	err := svc.AddKey(ctx, &EncryptionKey{UserID: 1, Name: "again", Type: EncryptionKeyAge, PublicKey: testAgeRecipient})
+	assert.ErrorContains(t, err, "already registered")
+
+	svc.SetGPGBinary(writeFakeTool(t, "gpg", `cat > /dev/null
+echo "pub:-:255:22:1122334455667788:1700000000:::-:::scSC::::::23::0:"
+echo "fpr:::::::::0123456789ABCDEF0123456789ABCDEF01234567:"
+`))
+	err = svc.AddKey(ctx, &EncryptionKey{UserID: 1, Name: "signing", Type: EncryptionKeyGPG, PublicKey: testGPGKey})
+	assert.ErrorContains(t, err, "no encryption subkey")
+
+	key, err := svc.ResolveKey(ctx, 1, "default")
+	require.NoError(t, err)
+	assert.Equal(t, ageKey.ID, key.ID)
+
+	require.NoError(t, svc.SetDefaultKey(ctx, 1, gpgKey.ID))
+	key, err = svc.ResolveKey(ctx, 1, "default")
+	require.NoError(t, err)
+	assert.Equal(t, gpgKey.ID, key.ID)
+	assert.Equal(t, ".gpg", key.Extension())
+
+	keys, err := svc.ListKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, gpgKey.ID, keys[0].ID, "default key is listed first")
+
+	// Keys are private to their owner
+	_, err = svc.GetKey(ctx, 2, ageKey.ID)
+	assert.ErrorContains(t, err, "not found")
+	_, err = svc.ResolveKey(ctx, 2, "default")
+	assert.ErrorContains(t, err, "not found")
+	assert.ErrorContains(t, svc.DeleteKey(ctx, 2, ageKey.ID), "not found")
+	assert.ErrorContains(t, svc.SetDefaultKey(ctx, 2, ageKey.ID), "not found")
+
+	_, err = svc.ResolveKey(ctx, 1, "laptop")
+	assert.ErrorContains(t, err, "invalid key")
+
+	require.NoError(t, svc.DeleteKey(ctx, 1, ageKey.ID))
+	keys, err = svc.ListKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestDownloadEncryptionService_Encrypt(t *testing.T) {
+	svc := setupEncryptionTestService(t)
+	ctx := context.Background()
+	argsFile := filepath.Join(t.TempDir(), "args")
+	// The fake age tags its input and records the recipients file it was given
+	svc.SetAgeBinary(writeFakeTool(t, "age", `echo "$@" > "`+argsFile+`"
+cat "$3" >> "`+argsFile+`"
+printf 'AGE['
+cat
+printf ']'
+`))
+
+	key := &EncryptionKey{UserID: 1, Name: "laptop", Type: EncryptionKeyAge, PublicKey: testAgeRecipient}
+	require.NoError(t, svc.AddKey(ctx, key))
+
+	var out bytes.Buffer
+	w, err := svc.Encrypt(ctx, key, &out)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "secret film")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "AGE[secret film]", out.String())
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "--encrypt -R ")
+	assert.Contains(t, string(args), testAgeRecipient)
+
+	svc.SetAgeBinary(writeFakeTool(t, "age", `cat > /dev/null
+echo "age: error: malformed recipient" >&2
+exit 1
+`))
+	w, err = svc.Encrypt(ctx, key, io.Discard)
+	require.NoError(t, err)
+	io.WriteString(w, "secret film")
+	assert.ErrorContains(t, w.Close(), "malformed recipient")
+}
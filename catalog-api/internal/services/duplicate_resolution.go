@@ -0,0 +1,296 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Ways a duplicate group can be resolved.
+const (
+	// DuplicateActionDelete deletes every copy but the kept file.
+	DuplicateActionDelete = "delete"
+	// DuplicateActionKeep leaves every copy in place and stops reporting
+	// the group.
+	DuplicateActionKeep = "keep"
+	// DuplicateActionSymlink replaces every copy but the kept file with a
+	// symbolic link to it. Only files on local storage roots qualify.
+	DuplicateActionSymlink = "symlink"
+)
+
+// AuditEventDuplicatesResolved is recorded in auth_audit_log when a
+// duplicate group is resolved.
+const AuditEventDuplicatesResolved = "duplicates_resolved"
+
+// DuplicateResolveRequest identifies a duplicate group by content hash and
+// says how to resolve it.
+type DuplicateResolveRequest struct {
+	Hash       string
+	Action     string
+	KeepFileID int64
+	UserID     int
+	IPAddress  string
+	UserAgent  string
+}
+
+// DuplicateResolution is the outcome of resolving a duplicate group.
+// Copies that could not be changed are listed in Failed and the group is
+// reported again until they are dealt with.
+type DuplicateResolution struct {
+	Hash       string                    `json:"hash"`
+	Action     string                    `json:"action"`
+	KeptFileID int64                     `json:"kept_file_id"`
+	Resolved   []int64                   `json:"resolved_file_ids"`
+	Failed     []DuplicateResolveFailure `json:"failed,omitempty"`
+}
+
+// DuplicateResolveFailure is a copy a resolution could not change.
+type DuplicateResolveFailure struct {
+	FileID int64  `json:"file_id"`
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+}
+
+// duplicateCopy is one cataloged file of a duplicate group.
+type duplicateCopy struct {
+	id       int64
+	path     string
+	root     string
+	protocol string
+	rootPath sql.NullString
+}
+
+// DuplicateResolver acts on the duplicate groups CatalogService reports.
+type DuplicateResolver struct {
+	db        *database.DB
+	logger    *zap.Logger
+	providers *StorageProviderFactory
+	lockdowns lockdownStatus
+	now       func() time.Time
+}
+
+// NewDuplicateResolver creates a DuplicateResolver that reaches storage
+// through providers.
+func NewDuplicateResolver(db *database.DB, providers *StorageProviderFactory, logger *zap.Logger) *DuplicateResolver {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &DuplicateResolver{db: db, logger: logger, providers: providers, now: time.Now}
+}
+
+// SetLockdownChecker makes resolutions that change files honour
+// ransomware lockdowns.
+func (r *DuplicateResolver) SetLockdownChecker(checker lockdownStatus) {
+	r.lockdowns = checker
+}
+
+// ResolveDuplicates resolves the group of files whose content hashes to
+// req.Hash. Delete and symlink keep req.KeepFileID and change the other
+// copies; keep only records that the copies are wanted. Every copy that
+// was dealt with is recorded in duplicate_resolutions against its current
+// content, so the group stops being reported until a new copy appears.
+func (r *DuplicateResolver) ResolveDuplicates(ctx context.Context, req DuplicateResolveRequest) (*DuplicateResolution, error) {
+	switch req.Action {
+	case DuplicateActionDelete, DuplicateActionKeep, DuplicateActionSymlink:
+	default:
+		return nil, fmt.Errorf("invalid action %q: use delete, keep or symlink", req.Action)
+	}
+	if req.Hash == "" {
+		return nil, fmt.Errorf("invalid hash: a content hash is required")
+	}
+
+	copies, err := r.loadCopies(ctx, req.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(copies) < 2 {
+		return nil, fmt.Errorf("duplicate group %s not found", req.Hash)
+	}
+
+	var kept *duplicateCopy
+	for i := range copies {
+		if copies[i].id == req.KeepFileID {
+			kept = &copies[i]
+		}
+	}
+	if kept == nil {
+		if req.Action != DuplicateActionKeep {
+			return nil, fmt.Errorf("invalid keep_file_id: file %d is not in duplicate group %s", req.KeepFileID, req.Hash)
+		}
+		kept = &copies[0]
+	}
+
+	if req.Action != DuplicateActionKeep && r.lockdowns != nil {
+		for _, c := range copies {
+			if c.id != kept.id && r.lockdowns.IsLocked(c.root) {
+				return nil, fmt.Errorf("storage root %s is locked", c.root)
+			}
+		}
+	}
+
+	result := &DuplicateResolution{
+		Hash:       req.Hash,
+		Action:     req.Action,
+		KeptFileID: kept.id,
+		Resolved:   []int64{kept.id},
+	}
+	providers := make(map[string]StorageProvider)
+	defer func() {
+		for _, p := range providers {
+			p.Close()
+		}
+	}()
+
+	for _, c := range copies {
+		if c.id == kept.id {
+			continue
+		}
+		var err error
+		switch req.Action {
+		case DuplicateActionDelete:
+			err = r.deleteCopy(ctx, providers, c)
+		case DuplicateActionSymlink:
+			err = linkDuplicateCopy(*kept, c)
+		}
+		if err != nil {
+			r.logger.Warn("Failed to resolve duplicate",
+				zap.String("action", req.Action), zap.String("path", c.path), zap.Error(err))
+			result.Failed = append(result.Failed, DuplicateResolveFailure{FileID: c.id, Path: c.path, Error: err.Error()})
+			continue
+		}
+		result.Resolved = append(result.Resolved, c.id)
+	}
+
+	resolvedAt := r.now()
+	for _, id := range result.Resolved {
+		updated, err := r.db.ExecContext(ctx,
+			`UPDATE duplicate_resolutions SET action = ?, kept_file_id = ?, resolved_by = ?, resolved_at = ?
+			 WHERE file_id = ? AND sha256 = ?`,
+			req.Action, kept.id, req.UserID, resolvedAt, id, req.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record duplicate resolution: %w", err)
+		}
+		if rows, _ := updated.RowsAffected(); rows > 0 {
+			continue
+		}
+		if _, err := r.db.ExecContext(ctx,
+			`INSERT INTO duplicate_resolutions (file_id, sha256, action, kept_file_id, resolved_by, resolved_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			id, req.Hash, req.Action, kept.id, req.UserID, resolvedAt); err != nil {
+			return nil, fmt.Errorf("failed to record duplicate resolution: %w", err)
+		}
+	}
+
+	r.logger.Info("Resolved duplicate group",
+		zap.String("hash", req.Hash),
+		zap.String("action", req.Action),
+		zap.Int64("kept_file_id", kept.id),
+		zap.Int("resolved", len(result.Resolved)-1),
+		zap.Int("failed", len(result.Failed)),
+		zap.Int("user_id", req.UserID))
+	r.recordAudit(ctx, req, result)
+	return result, nil
+}
+
+// loadCopies returns the live files of a duplicate group, oldest first.
+func (r *DuplicateResolver) loadCopies(ctx context.Context, hash string) ([]duplicateCopy, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT f.id, f.path, sr.name, sr.protocol, sr.path
+		 FROM files f
+		 JOIN storage_roots sr ON f.storage_root_id = sr.id
+		 WHERE f.sha256 = ? AND f.deleted = 0 AND f.is_directory = 0
+		 ORDER BY f.id`, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load duplicate group: %w", err)
+	}
+	defer rows.Close()
+
+	var copies []duplicateCopy
+	for rows.Next() {
+		var c duplicateCopy
+		if err := rows.Scan(&c.id, &c.path, &c.root, &c.protocol, &c.rootPath); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate file: %w", err)
+		}
+		copies = append(copies, c)
+	}
+	return copies, rows.Err()
+}
+
+// deleteCopy removes a copy from storage and marks its record deleted.
+func (r *DuplicateResolver) deleteCopy(ctx context.Context, providers map[string]StorageProvider, c duplicateCopy) error {
+	if r.providers == nil {
+		return fmt.Errorf("storage providers not configured")
+	}
+	provider, ok := providers[c.root]
+	if !ok {
+		var err error
+		provider, err = r.providers.Provider(ctx, c.root)
+		if err != nil {
+			return err
+		}
+		providers[c.root] = provider
+	}
+	if err := provider.Delete(ctx, c.path); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE files SET deleted = ?, deleted_at = ? WHERE id = ?`, true, r.now(), c.id)
+	return err
+}
+
+// linkDuplicateCopy replaces a copy with a symbolic link to the kept
+// file. The link is created beside the copy and renamed over it, so a
+// failure leaves the copy untouched.
+func linkDuplicateCopy(kept, c duplicateCopy) error {
+	target, err := localCopyPath(kept)
+	if err != nil {
+		return err
+	}
+	link, err := localCopyPath(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(link), ".dedupe-"+filepath.Base(link))
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// localCopyPath resolves a copy to its path on the API host.
+func localCopyPath(c duplicateCopy) (string, error) {
+	if !strings.EqualFold(c.protocol, "local") || !c.rootPath.Valid {
+		return "", fmt.Errorf("symlink is only supported on local storage roots, not %s", c.root)
+	}
+	return resolveInside(c.rootPath.String, c.path)
+}
+
+func (r *DuplicateResolver) recordAudit(ctx context.Context, req DuplicateResolveRequest, result *DuplicateResolution) {
+	details, _ := json.Marshal(map[string]interface{}{
+		"hash":         req.Hash,
+		"action":       req.Action,
+		"kept_file_id": result.KeptFileID,
+		"resolved":     result.Resolved,
+		"failed":       len(result.Failed),
+	})
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO auth_audit_log (user_id, event_type, ip_address, user_agent, details) VALUES (?, ?, ?, ?, ?)`,
+		req.UserID, AuditEventDuplicatesResolved, req.IPAddress, req.UserAgent, string(details))
+	if err != nil {
+		r.logger.Error("Failed to record duplicate resolution in audit log", zap.Error(err))
+	}
+}
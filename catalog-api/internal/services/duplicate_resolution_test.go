@@ -0,0 +1,187 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type duplicateFixture struct {
+	db       *database.DB
+	resolver *DuplicateResolver
+	catalog  *CatalogService
+	dir      string
+}
+
+func newDuplicateFixture(t *testing.T) *duplicateFixture {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			extension TEXT,
+			mime_type TEXT,
+			size INTEGER NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			modified_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_scan_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted BOOLEAN DEFAULT 0,
+			deleted_at DATETIME,
+			parent_id INTEGER,
+			quick_hash TEXT,
+			sha256 TEXT
+		);
+		CREATE TABLE duplicate_resolutions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file_id INTEGER NOT NULL,
+			sha256 TEXT NOT NULL,
+			action TEXT NOT NULL,
+			kept_file_id INTEGER,
+			resolved_by INTEGER,
+			resolved_at DATETIME NOT NULL,
+			UNIQUE(file_id, sha256)
+		);
+		CREATE TABLE auth_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			event_type TEXT NOT NULL,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	require.NoError(t, err)
+
+	f := &duplicateFixture{db: database.WrapDB(sqlDB, database.DialectSQLite), dir: t.TempDir()}
+	_, err = f.db.Exec(`INSERT INTO storage_roots (id, name, protocol, path) VALUES (1, 'media', 'local', ?), (2, 'nas', 'smb', 'share')`, f.dir)
+	require.NoError(t, err)
+
+	providers := NewStorageProviderFactory(f.db, localRootClients{}, zap.NewNop())
+	f.resolver = NewDuplicateResolver(f.db, providers, zap.NewNop())
+	f.catalog = NewCatalogService(nil, zap.NewNop())
+	f.catalog.SetDB(f.db)
+	return f
+}
+
+// add writes a file to the local root and catalogs it with a content hash.
+func (f *duplicateFixture) add(t *testing.T, id int64, rootID int, name, hash string) {
+	t.Helper()
+	if rootID == 1 {
+		require.NoError(t, os.WriteFile(filepath.Join(f.dir, name), []byte(hash), 0644))
+	}
+	_, err := f.db.Exec(`INSERT INTO files (id, storage_root_id, path, name, size, quick_hash, sha256) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, rootID, name, name, len(hash), "q-"+hash, hash)
+	require.NoError(t, err)
+}
+
+func (f *duplicateFixture) groups(t *testing.T) []string {
+	t.Helper()
+	groups, err := f.catalog.GetDuplicateGroups("", 2, 0)
+	require.NoError(t, err)
+	var hashes []string
+	for _, g := range groups {
+		hashes = append(hashes, g.Hash)
+	}
+	return hashes
+}
+
+func TestDuplicateResolver_Delete(t *testing.T) {
+	f := newDuplicateFixture(t)
+	f.add(t, 1, 1, "a.mkv", "aaaa")
+	f.add(t, 2, 1, "a copy.mkv", "aaaa")
+	f.add(t, 3, 1, "a copy 2.mkv", "aaaa")
+	require.Equal(t, []string{"aaaa"}, f.groups(t))
+
+	result, err := f.resolver.ResolveDuplicates(context.Background(), DuplicateResolveRequest{
+		Hash: "aaaa", Action: DuplicateActionDelete, KeepFileID: 2, UserID: 7,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.KeptFileID)
+	assert.ElementsMatch(t, []int64{1, 2, 3}, result.Resolved)
+	assert.Empty(t, result.Failed)
+
+	assert.FileExists(t, filepath.Join(f.dir, "a copy.mkv"))
+	assert.NoFileExists(t, filepath.Join(f.dir, "a.mkv"))
+	assert.NoFileExists(t, filepath.Join(f.dir, "a copy 2.mkv"))
+	var deleted int
+	require.NoError(t, f.db.QueryRow(`SELECT COUNT(*) FROM files WHERE deleted = 1`).Scan(&deleted))
+	assert.Equal(t, 2, deleted)
+	assert.Empty(t, f.groups(t))
+
+	var audits int
+	require.NoError(t, f.db.QueryRow(`SELECT COUNT(*) FROM auth_audit_log WHERE event_type = ?`, AuditEventDuplicatesResolved).Scan(&audits))
+	assert.Equal(t, 1, audits)
+}
+
+func TestDuplicateResolver_KeepAndSymlink(t *testing.T) {
+	f := newDuplicateFixture(t)
+	f.add(t, 1, 1, "b.mkv", "bbbb")
+	f.add(t, 2, 1, "b copy.mkv", "bbbb")
+	f.add(t, 3, 1, "c.mkv", "cccc")
+	f.add(t, 4, 1, "c copy.mkv", "cccc")
+	f.add(t, 5, 2, "c remote.mkv", "cccc")
+
+	_, err := f.resolver.ResolveDuplicates(context.Background(), DuplicateResolveRequest{Hash: "bbbb", Action: DuplicateActionKeep})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cccc"}, f.groups(t))
+
+	// A new copy brings the kept group back
+	f.add(t, 6, 1, "b copy 2.mkv", "bbbb")
+	assert.ElementsMatch(t, []string{"bbbb", "cccc"}, f.groups(t))
+
+	// Copies off local roots cannot be linked and keep the group reported
+	result, err := f.resolver.ResolveDuplicates(context.Background(), DuplicateResolveRequest{
+		Hash: "cccc", Action: DuplicateActionSymlink, KeepFileID: 3,
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{3, 4}, result.Resolved)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, int64(5), result.Failed[0].FileID)
+	assert.Contains(t, f.groups(t), "cccc")
+
+	target, err := os.Readlink(filepath.Join(f.dir, "c copy.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(f.dir, "c.mkv"), target)
+}
+
+func TestDuplicateResolver_Rejects(t *testing.T) {
+	f := newDuplicateFixture(t)
+	f.add(t, 1, 1, "d.mkv", "dddd")
+	f.add(t, 2, 1, "d copy.mkv", "dddd")
+	ctx := context.Background()
+
+	_, err := f.resolver.ResolveDuplicates(ctx, DuplicateResolveRequest{Hash: "dddd", Action: "merge", KeepFileID: 1})
+	assert.ErrorContains(t, err, "invalid action")
+	_, err = f.resolver.ResolveDuplicates(ctx, DuplicateResolveRequest{Hash: "eeee", Action: DuplicateActionDelete, KeepFileID: 1})
+	assert.ErrorContains(t, err, "not found")
+	_, err = f.resolver.ResolveDuplicates(ctx, DuplicateResolveRequest{Hash: "dddd", Action: DuplicateActionDelete, KeepFileID: 9})
+	assert.ErrorContains(t, err, "invalid keep_file_id")
+
+	f.resolver.SetLockdownChecker(lockedRoots{"media": true})
+	_, err = f.resolver.ResolveDuplicates(ctx, DuplicateResolveRequest{Hash: "dddd", Action: DuplicateActionDelete, KeepFileID: 1})
+	assert.ErrorContains(t, err, "is locked")
+	assert.FileExists(t, filepath.Join(f.dir, "d copy.mkv"))
+}
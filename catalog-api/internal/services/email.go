@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailMessage is a plain-text email to a single recipient.
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailSender delivers email.
+type EmailSender interface {
+	SendEmail(ctx context.Context, msg *EmailMessage) error
+}
+
+// EmailSenderFunc adapts a plain function to the EmailSender interface.
+type EmailSenderFunc func(ctx context.Context, msg *EmailMessage) error
+
+// SendEmail calls f(ctx, msg).
+func (f EmailSenderFunc) SendEmail(ctx context.Context, msg *EmailMessage) error {
+	return f(ctx, msg)
+}
+
+// SMTPConfig configures SMTPEmailSender.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPEmailSender sends email through an SMTP relay, upgrading to TLS
+// when the server offers STARTTLS.
+type SMTPEmailSender struct {
+	config SMTPConfig
+}
+
+// NewSMTPEmailSender creates an SMTPEmailSender. The port defaults to 587.
+func NewSMTPEmailSender(config SMTPConfig) *SMTPEmailSender {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &SMTPEmailSender{config: config}
+}
+
+// SendEmail delivers msg, giving up when ctx is done.
+func (s *SMTPEmailSender) SendEmail(ctx context.Context, msg *EmailMessage) error {
+	data, err := buildEmail(s.config.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Mail(s.config.From); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP server rejected recipient %s: %w", msg.To, err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// Verify connects and authenticates to the SMTP relay without sending
+// anything, to check the settings before they are saved.
+func (s *SMTPEmailSender) Verify(ctx context.Context) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Quit()
+}
+
+// connect opens an SMTP session, upgraded to TLS when the server offers
+// STARTTLS and authenticated when a username is configured.
+func (s *SMTPEmailSender) connect(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// buildEmail renders msg as an RFC 5322 message with CRLF line endings.
+// Addresses are parsed so header values cannot smuggle in extra headers.
+func buildEmail(from string, msg *EmailMessage, at time.Time) ([]byte, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient address %q: %w", msg.To, err)
+	}
+	subject := strings.Join(strings.Fields(msg.Subject), " ")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", fromAddr.String())
+	fmt.Fprintf(&b, "To: %s\r\n", toAddr.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", at.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	b.WriteString(body)
+	if !strings.HasSuffix(body, "\r\n") {
+		b.WriteString("\r\n")
+	}
+	return b.Bytes(), nil
+}
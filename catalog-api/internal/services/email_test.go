@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEmail(t *testing.T) {
+	data, err := buildEmail("Catalogizer <noreply@example.com>", &EmailMessage{
+		To:      "bob@example.com",
+		Subject: "Hello\r\nBcc: eve@example.com",
+		Body:    "line one\nline two",
+	}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.NoError(t, err)
+
+	msg := string(data)
+	assert.Contains(t, msg, "From: \"Catalogizer\" <noreply@example.com>\r\n")
+	assert.Contains(t, msg, "To: <bob@example.com>\r\n")
+	assert.Contains(t, msg, "Subject: Hello Bcc: eve@example.com\r\n")
+	assert.NotContains(t, msg, "\r\nBcc:")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nline one\r\nline two\r\n"))
+
+	_, err = buildEmail("noreply@example.com", &EmailMessage{To: "bob@example.com\r\nCc: eve@example.com"}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestSMTPEmailSender_Verify(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	commands := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 test ESMTP\r\n"))
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.Fields(line)[0]
+			commands <- cmd
+			if cmd == "QUIT" {
+				conn.Write([]byte("221 bye\r\n"))
+				return
+			}
+			conn.Write([]byte("250 test\r\n"))
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	sender := NewSMTPEmailSender(SMTPConfig{Host: "127.0.0.1", Port: addr.Port})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, sender.Verify(ctx))
+	assert.Equal(t, "EHLO", <-commands)
+	assert.Equal(t, "QUIT", <-commands)
+
+	// Nothing listens on a closed listener's port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	err = NewSMTPEmailSender(SMTPConfig{Host: "127.0.0.1", Port: port}).Verify(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "127.0.0.1:"+strconv.Itoa(port))
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Real-time event channels a client can subscribe to.
+const (
+	EventChannelScan       = "scan"
+	EventChannelConversion = "conversion"
+	EventChannelMedia      = "media"
+)
+
+// EventChannels lists every channel, in the order clients see them.
+var EventChannels = []string{EventChannelScan, EventChannelConversion, EventChannelMedia}
+
+// Event types pushed on the channels.
+const (
+	EventScanProgress       = "scan_progress"
+	EventConversionStatus   = "conversion_status"
+	EventConversionProgress = "conversion_progress"
+	EventMediaAdded         = "media_added"
+)
+
+// HubEvent is one real-time notification. Events with a UserID are only
+// delivered to that user and to administrators; the rest go to every
+// subscriber of the channel.
+type HubEvent struct {
+	Type      string      `json:"type"`
+	Channel   string      `json:"channel"`
+	UserID    *int        `json:"-"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventPublisher accepts real-time events for delivery to clients.
+type EventPublisher interface {
+	Publish(event HubEvent)
+}
+
+// eventSubscriptionBuffer is how many events a slow client may fall
+// behind before further events are dropped for it.
+const eventSubscriptionBuffer = 256
+
+// EventHub fans real-time events out to per-user subscriptions. Delivery
+// never blocks the publisher: a subscriber whose buffer is full misses
+// the event.
+type EventHub struct {
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu   sync.RWMutex
+	subs map[*EventSubscription]struct{}
+}
+
+// NewEventHub creates a new EventHub.
+func NewEventHub(logger *zap.Logger) *EventHub {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &EventHub{
+		logger: logger,
+		now:    time.Now,
+		subs:   make(map[*EventSubscription]struct{}),
+	}
+}
+
+// EventSubscription receives the events of the channels it subscribed to
+// that its user may see.
+type EventSubscription struct {
+	hub     *EventHub
+	userID  int
+	isAdmin bool
+	events  chan HubEvent
+
+	mu       sync.Mutex
+	channels map[string]bool
+	closed   bool
+	dropped  int64
+}
+
+// Subscribe registers a subscription for a user, initially to the given
+// channels or to all of them when none are given.
+func (h *EventHub) Subscribe(userID int, isAdmin bool, channels ...string) (*EventSubscription, error) {
+	if len(channels) == 0 {
+		channels = EventChannels
+	}
+	sub := &EventSubscription{
+		hub:      h,
+		userID:   userID,
+		isAdmin:  isAdmin,
+		events:   make(chan HubEvent, eventSubscriptionBuffer),
+		channels: make(map[string]bool),
+	}
+	if err := sub.Subscribe(channels...); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub, nil
+}
+
+// Publish delivers an event to every subscription entitled to it.
+func (h *EventHub) Publish(event HubEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = h.now()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		sub.deliver(event)
+	}
+}
+
+// SubscriberCount returns the number of open subscriptions.
+func (h *EventHub) SubscriberCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the subscription is closed.
+func (s *EventSubscription) Events() <-chan HubEvent {
+	return s.events
+}
+
+// Subscribe adds channels to the subscription.
+func (s *EventSubscription) Subscribe(channels ...string) error {
+	for _, channel := range channels {
+		if !isEventChannel(channel) {
+			return fmt.Errorf("unknown event channel: %s", channel)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, channel := range channels {
+		s.channels[channel] = true
+	}
+	return nil
+}
+
+// Unsubscribe removes channels from the subscription.
+func (s *EventSubscription) Unsubscribe(channels ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, channel := range channels {
+		delete(s.channels, channel)
+	}
+}
+
+// Channels returns the subscribed channels, sorted.
+func (s *EventSubscription) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Dropped returns how many events were dropped because the subscriber
+// fell behind.
+func (s *EventSubscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close removes the subscription from the hub and closes its event channel.
+func (s *EventSubscription) Close() {
+	s.hub.mu.Lock()
+	delete(s.hub.subs, s)
+	s.hub.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+func (s *EventSubscription) deliver(event HubEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || !s.channels[event.Channel] {
+		return
+	}
+	if event.UserID != nil && *event.UserID != s.userID && !s.isAdmin {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		s.dropped++
+		s.hub.logger.Debug("Dropped real-time event for slow subscriber",
+			zap.Int("user_id", s.userID), zap.String("type", event.Type))
+	}
+}
+
+func isEventChannel(channel string) bool {
+	for _, c := range EventChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvents(sub *EventSubscription) []HubEvent {
+	var events []HubEvent
+	for {
+		select {
+		case event := <-sub.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventHub_ChannelsAndUsers(t *testing.T) {
+	hub := NewEventHub(nil)
+	alice, err := hub.Subscribe(1, false)
+	require.NoError(t, err)
+	bob, err := hub.Subscribe(2, false, EventChannelScan)
+	require.NoError(t, err)
+	admin, err := hub.Subscribe(3, true, EventChannelConversion)
+	require.NoError(t, err)
+	assert.Equal(t, 3, hub.SubscriberCount())
+	assert.Equal(t, []string{"conversion", "media", "scan"}, alice.Channels())
+
+	aliceID := 1
+	hub.Publish(HubEvent{Type: EventScanProgress, Channel: EventChannelScan, Data: "scan"})
+	hub.Publish(HubEvent{Type: EventConversionStatus, Channel: EventChannelConversion, UserID: &aliceID, Data: "job"})
+
+	aliceEvents := receiveEvents(alice)
+	require.Len(t, aliceEvents, 2)
+	assert.False(t, aliceEvents[0].Timestamp.IsZero())
+
+	bobEvents := receiveEvents(bob)
+	require.Len(t, bobEvents, 1)
+	assert.Equal(t, EventScanProgress, bobEvents[0].Type)
+
+	// Administrators see other users' jobs
+	adminEvents := receiveEvents(admin)
+	require.Len(t, adminEvents, 1)
+	assert.Equal(t, EventConversionStatus, adminEvents[0].Type)
+}
+
+func TestEventSubscription_SubscribeUnsubscribe(t *testing.T) {
+	hub := NewEventHub(nil)
+	sub, err := hub.Subscribe(1, false, EventChannelScan)
+	require.NoError(t, err)
+
+	assert.Error(t, sub.Subscribe("bogus"))
+	require.NoError(t, sub.Subscribe(EventChannelMedia))
+	sub.Unsubscribe(EventChannelScan)
+	assert.Equal(t, []string{"media"}, sub.Channels())
+
+	hub.Publish(HubEvent{Type: EventScanProgress, Channel: EventChannelScan})
+	hub.Publish(HubEvent{Type: EventMediaAdded, Channel: EventChannelMedia})
+	events := receiveEvents(sub)
+	require.Len(t, events, 1)
+	assert.Equal(t, EventMediaAdded, events[0].Type)
+
+	_, err = hub.Subscribe(1, false, "bogus")
+	assert.Error(t, err)
+}
+
+func TestEventSubscription_DropsWhenFullAndCloses(t *testing.T) {
+	hub := NewEventHub(nil)
+	sub, err := hub.Subscribe(1, false)
+	require.NoError(t, err)
+
+	for i := 0; i < eventSubscriptionBuffer+5; i++ {
+		hub.Publish(HubEvent{Type: EventMediaAdded, Channel: EventChannelMedia})
+	}
+	assert.Equal(t, int64(5), sub.Dropped())
+
+	sub.Close()
+	sub.Close()
+	assert.Equal(t, 0, hub.SubscriberCount())
+	for range sub.Events() {
+	}
+	// Publishing after close is harmless
+	hub.Publish(HubEvent{Type: EventMediaAdded, Channel: EventChannelMedia})
+}
@@ -179,6 +179,7 @@ func setupExtendedTestDB(t *testing.T) *database.DB {
 			is_favorite BOOLEAN DEFAULT FALSE,
 			watched_percentage REAL DEFAULT 0.0,
 			artist_id INTEGER,
+			deleted_at DATETIME,
 			FOREIGN KEY (media_type_id) REFERENCES media_types(id),
 			FOREIGN KEY (parent_id) REFERENCES media_items(id)
 		)`,
@@ -192,6 +193,10 @@ func setupExtendedTestDB(t *testing.T) *database.DB {
 			language TEXT,
 			is_primary BOOLEAN DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			edition TEXT,
+			part_number INTEGER,
+			segment_index INTEGER,
+			segment_count INTEGER,
 			FOREIGN KEY (media_item_id) REFERENCES media_items(id)
 		)`,
 
@@ -223,6 +228,22 @@ func setupExtendedTestDB(t *testing.T) *database.DB {
 			last_fetched DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// ------------- metadata sources --------------------------------------
+		`CREATE TABLE IF NOT EXISTS metadata_source_priorities (
+			field TEXT PRIMARY KEY,
+			providers TEXT NOT NULL,
+			updated_by INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS media_item_field_sources (
+			media_item_id INTEGER NOT NULL,
+			field TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			external_id TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (media_item_id, field)
+		)`,
+
 		// ------------- users (FK target) -----------------------------------
 		`CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
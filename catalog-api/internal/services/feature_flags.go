@@ -0,0 +1,436 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Analytics event written when a client shows an experiment variant.
+const (
+	ExperimentExposureEvent    = "experiment_exposure"
+	ExperimentExposureCategory = "experiment"
+)
+
+// featureBuckets is the resolution of allocations: 0.01%.
+const featureBuckets = 10000
+
+var featureFlagKeyRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// FeatureVariant is one arm of an experiment. Users in the experiment are
+// split between variants in proportion to their weights.
+type FeatureVariant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// FeatureFlag is a flag clients evaluate per user. Allocation is the
+// percentage of users the flag is on for; a flag with variants is an
+// experiment, and the allocated users are further split between its
+// variants. Bucketing hashes the user ID with the flag's salt, so a user
+// always gets the same answer until the salt changes, and raising the
+// allocation only adds users.
+type FeatureFlag struct {
+	ID          int64            `json:"id"`
+	Key         string           `json:"key"`
+	Description string           `json:"description,omitempty"`
+	Enabled     bool             `json:"enabled"`
+	Allocation  int              `json:"allocation"`
+	Variants    []FeatureVariant `json:"variants"`
+	Salt        string           `json:"salt,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// IsExperiment reports whether the flag splits users between variants.
+func (f *FeatureFlag) IsExperiment() bool {
+	return len(f.Variants) > 0
+}
+
+// FeatureAssignment is a flag evaluated for one user. Variant is set only
+// when the user is in an experiment.
+type FeatureAssignment struct {
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+	Variant string `json:"variant,omitempty"`
+}
+
+// Assign evaluates the flag for a user.
+func (f *FeatureFlag) Assign(userID int) FeatureAssignment {
+	assignment := FeatureAssignment{Key: f.Key}
+	if !f.Enabled || featureBucket(f.Salt, "allocation", userID) >= f.Allocation*featureBuckets/100 {
+		return assignment
+	}
+	assignment.Enabled = true
+
+	total := 0
+	for _, v := range f.Variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return assignment
+	}
+	// A separate hash, so changing the allocation does not move users
+	// between variants
+	point := featureBucket(f.Salt, "variant", userID) * total / featureBuckets
+	for _, v := range f.Variants {
+		if point < v.Weight {
+			assignment.Variant = v.Name
+			break
+		}
+		point -= v.Weight
+	}
+	return assignment
+}
+
+// featureBucket deterministically maps a user to [0, featureBuckets).
+func featureBucket(salt, purpose string, userID int) int {
+	sum := sha256.Sum256([]byte(salt + ":" + purpose + ":" + strconv.Itoa(userID)))
+	return int(binary.BigEndian.Uint64(sum[:8]) % featureBuckets)
+}
+
+// ExperimentVariantResult is the conversion of one variant. A user
+// converts by logging the conversion event after their first exposure.
+type ExperimentVariantResult struct {
+	Variant        string  `json:"variant"`
+	ExposedUsers   int     `json:"exposed_users"`
+	ConvertedUsers int     `json:"converted_users"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// ExperimentResults compares an experiment's variants on a conversion
+// event. Users count toward the variant of their first exposure.
+type ExperimentResults struct {
+	Key             string                    `json:"key"`
+	ConversionEvent string                    `json:"conversion_event"`
+	Since           *time.Time                `json:"since,omitempty"`
+	Variants        []ExperimentVariantResult `json:"variants"`
+}
+
+// FeatureFlagService stores feature flags and A/B experiments, evaluates
+// them per user and measures experiments from analytics events: clients
+// log an exposure when they show a variant and their usual analytics
+// events serve as conversions.
+type FeatureFlagService struct {
+	db     *database.DB
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewFeatureFlagService creates a new FeatureFlagService.
+func NewFeatureFlagService(db *database.DB, logger *zap.Logger) *FeatureFlagService {
+	return &FeatureFlagService{
+		db:     db,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// validateFeatureFlag checks a flag before it is saved.
+func validateFeatureFlag(flag *FeatureFlag) error {
+	if !featureFlagKeyRe.MatchString(flag.Key) {
+		return fmt.Errorf("invalid feature flag: key %q must be lowercase letters, digits, '.', '_' or '-'", flag.Key)
+	}
+	if flag.Allocation < 0 || flag.Allocation > 100 {
+		return fmt.Errorf("invalid feature flag: allocation must be between 0 and 100")
+	}
+	if len(flag.Variants) == 1 {
+		return fmt.Errorf("invalid feature flag: an experiment needs at least two variants")
+	}
+	seen := make(map[string]bool)
+	for _, v := range flag.Variants {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("invalid feature flag: variant names must be unique and not empty")
+		}
+		if v.Weight <= 0 {
+			return fmt.Errorf("invalid feature flag: variant %s needs a positive weight", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+const featureFlagColumns = `id, key, description, enabled, allocation, variants, salt, created_at, updated_at`
+
+func scanFeatureFlag(row shareLinkScanner) (*FeatureFlag, error) {
+	var flag FeatureFlag
+	var description sql.NullString
+	var variants string
+	if err := row.Scan(&flag.ID, &flag.Key, &description, &flag.Enabled, &flag.Allocation, &variants,
+		&flag.Salt, &flag.CreatedAt, &flag.UpdatedAt); err != nil {
+		return nil, err
+	}
+	flag.Description = description.String
+	if err := json.Unmarshal([]byte(variants), &flag.Variants); err != nil {
+		return nil, fmt.Errorf("invalid variants for feature flag %s: %w", flag.Key, err)
+	}
+	if flag.Variants == nil {
+		flag.Variants = []FeatureVariant{}
+	}
+	return &flag, nil
+}
+
+// ListFlags returns all flags by key.
+func (s *FeatureFlagService) ListFlags(ctx context.Context) ([]FeatureFlag, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+featureFlagColumns+` FROM feature_flags ORDER BY key`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := []FeatureFlag{}
+	for rows.Next() {
+		flag, err := scanFeatureFlag(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags = append(flags, *flag)
+	}
+	return flags, rows.Err()
+}
+
+// GetFlag returns the flag with the given key.
+func (s *FeatureFlagService) GetFlag(ctx context.Context, key string) (*FeatureFlag, error) {
+	flag, err := scanFeatureFlag(s.db.QueryRowContext(ctx,
+		`SELECT `+featureFlagColumns+` FROM feature_flags WHERE key = ?`, key))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("feature flag %s not found", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feature flag %s: %w", key, err)
+	}
+	return flag, nil
+}
+
+// SaveFlag creates or replaces the flag with flag.Key. An empty salt keeps
+// the current one, or generates one for a new flag; setting a new salt
+// reshuffles every user.
+func (s *FeatureFlagService) SaveFlag(ctx context.Context, flag *FeatureFlag) (*FeatureFlag, error) {
+	if err := validateFeatureFlag(flag); err != nil {
+		return nil, err
+	}
+	if flag.Variants == nil {
+		flag.Variants = []FeatureVariant{}
+	}
+	variants, err := json.Marshal(flag.Variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal variants: %w", err)
+	}
+
+	var existingID int64
+	var existingSalt string
+	err = s.db.QueryRowContext(ctx, `SELECT id, salt FROM feature_flags WHERE key = ?`, flag.Key).Scan(&existingID, &existingSalt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load feature flag %s: %w", flag.Key, err)
+	}
+	now := s.now()
+	if err == nil {
+		if flag.Salt == "" {
+			flag.Salt = existingSalt
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE feature_flags SET description = ?, enabled = ?, allocation = ?, variants = ?, salt = ?, updated_at = ?
+			 WHERE id = ?`,
+			flag.Description, flag.Enabled, flag.Allocation, string(variants), flag.Salt, now, existingID); err != nil {
+			return nil, fmt.Errorf("failed to update feature flag %s: %w", flag.Key, err)
+		}
+		return s.GetFlag(ctx, flag.Key)
+	}
+
+	if flag.Salt == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate feature flag salt: %w", err)
+		}
+		flag.Salt = hex.EncodeToString(b)
+	}
+	if _, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO feature_flags (key, description, enabled, allocation, variants, salt, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		flag.Key, flag.Description, flag.Enabled, flag.Allocation, string(variants), flag.Salt, now, now); err != nil {
+		return nil, fmt.Errorf("failed to create feature flag %s: %w", flag.Key, err)
+	}
+	return s.GetFlag(ctx, flag.Key)
+}
+
+// DeleteFlag deletes a flag. Its exposures stay in analytics_events.
+func (s *FeatureFlagService) DeleteFlag(ctx context.Context, key string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE key = ?`, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature flag %s: %w", key, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("feature flag %s not found", key)
+	}
+	return nil
+}
+
+// Evaluate evaluates every flag for a user.
+func (s *FeatureFlagService) Evaluate(ctx context.Context, userID int) ([]FeatureAssignment, error) {
+	flags, err := s.ListFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	assignments := make([]FeatureAssignment, 0, len(flags))
+	for i := range flags {
+		assignments = append(assignments, flags[i].Assign(userID))
+	}
+	return assignments, nil
+}
+
+// LogExposure records that a user was shown their variant of an
+// experiment. The variant is the one the server assigns; exposures of
+// users outside the experiment are not logged.
+func (s *FeatureFlagService) LogExposure(ctx context.Context, userID int, key string) (*FeatureAssignment, error) {
+	flag, err := s.GetFlag(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	assignment := flag.Assign(userID)
+	if assignment.Variant == "" {
+		return &assignment, nil
+	}
+
+	data, err := json.Marshal(map[string]string{"flag": flag.Key, "variant": assignment.Variant})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal exposure: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO analytics_events (user_id, event_type, event_category, entity_type, entity_id, data, timestamp)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, ExperimentExposureEvent, ExperimentExposureCategory, "feature_flag", flag.ID, string(data), s.now()); err != nil {
+		return nil, fmt.Errorf("failed to log experiment exposure: %w", err)
+	}
+	return &assignment, nil
+}
+
+// Results compares an experiment's variants on conversionEvent, an
+// analytics event type, counting exposures since the given time.
+func (s *FeatureFlagService) Results(ctx context.Context, key, conversionEvent string, since *time.Time) (*ExperimentResults, error) {
+	if conversionEvent == "" {
+		return nil, fmt.Errorf("invalid experiment results: a conversion event is required")
+	}
+	flag, err := s.GetFlag(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT user_id, data, timestamp FROM analytics_events
+		WHERE event_type = ? AND entity_type = 'feature_flag' AND entity_id = ? AND user_id IS NOT NULL`
+	args := []interface{}{ExperimentExposureEvent, flag.ID}
+	if since != nil {
+		query += ` AND timestamp >= ?`
+		args = append(args, *since)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY timestamp, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load experiment exposures: %w", err)
+	}
+	type exposure struct {
+		variant string
+		at      time.Time
+	}
+	first := make(map[int]exposure)
+	var earliest *time.Time
+	for rows.Next() {
+		var userID int
+		var data string
+		var at time.Time
+		if err := rows.Scan(&userID, &data, &at); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan experiment exposure: %w", err)
+		}
+		if _, ok := first[userID]; ok {
+			continue
+		}
+		var payload struct {
+			Variant string `json:"variant"`
+		}
+		if json.Unmarshal([]byte(data), &payload) != nil || payload.Variant == "" {
+			continue
+		}
+		first[userID] = exposure{variant: payload.Variant, at: at}
+		if earliest == nil || at.Before(*earliest) {
+			earliest = &at
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load experiment exposures: %w", err)
+	}
+
+	converted := make(map[int]bool)
+	if earliest != nil {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT user_id, timestamp FROM analytics_events WHERE event_type = ? AND user_id IS NOT NULL AND timestamp >= ?`,
+			conversionEvent, *earliest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load conversions: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var userID int
+			var at time.Time
+			if err := rows.Scan(&userID, &at); err != nil {
+				return nil, fmt.Errorf("failed to scan conversion: %w", err)
+			}
+			if e, ok := first[userID]; ok && !at.Before(e.at) {
+				converted[userID] = true
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to load conversions: %w", err)
+		}
+	}
+
+	byVariant := make(map[string]*ExperimentVariantResult)
+	results := &ExperimentResults{Key: flag.Key, ConversionEvent: conversionEvent, Since: since}
+	variant := func(name string) *ExperimentVariantResult {
+		if byVariant[name] == nil {
+			byVariant[name] = &ExperimentVariantResult{Variant: name}
+		}
+		return byVariant[name]
+	}
+	for _, v := range flag.Variants {
+		variant(v.Name)
+	}
+	for userID, e := range first {
+		r := variant(e.variant)
+		r.ExposedUsers++
+		if converted[userID] {
+			r.ConvertedUsers++
+		}
+	}
+
+	// Current variants in their configured order, then retired ones
+	for _, v := range flag.Variants {
+		results.Variants = append(results.Variants, *byVariant[v.Name])
+		delete(byVariant, v.Name)
+	}
+	retired := make([]string, 0, len(byVariant))
+	for name := range byVariant {
+		retired = append(retired, name)
+	}
+	sort.Strings(retired)
+	for _, name := range retired {
+		results.Variants = append(results.Variants, *byVariant[name])
+	}
+	for i := range results.Variants {
+		if r := &results.Variants[i]; r.ExposedUsers > 0 {
+			r.ConversionRate = float64(r.ConvertedUsers) / float64(r.ExposedUsers)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"catalogizer/config"
+	"catalogizer/database"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newFeatureFlagFixture(t *testing.T) (*FeatureFlagService, *database.DB) {
+	t.Helper()
+
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "flags.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.RunMigrations(context.Background()))
+	return NewFeatureFlagService(db, zap.NewNop()), db
+}
+
+func TestFeatureFlag_Assign(t *testing.T) {
+	flag := &FeatureFlag{
+		Key: "new-player", Enabled: true, Allocation: 50, Salt: "s1",
+		Variants: []FeatureVariant{{Name: "control", Weight: 1}, {Name: "compact", Weight: 3}},
+	}
+
+	enrolled := map[int]string{}
+	counts := map[string]int{}
+	for userID := 1; userID <= 10000; userID++ {
+		a := flag.Assign(userID)
+		assert.Equal(t, a, flag.Assign(userID), "assignment is deterministic")
+		if a.Enabled {
+			enrolled[userID] = a.Variant
+			counts[a.Variant]++
+		}
+	}
+	assert.InDelta(t, 5000, len(enrolled), 250)
+	assert.InDelta(t, 0.25, float64(counts["control"])/float64(len(enrolled)), 0.03)
+	assert.InDelta(t, 0.75, float64(counts["compact"])/float64(len(enrolled)), 0.03)
+
+	// Raising the allocation keeps users in the experiment and their variant
+	flag.Allocation = 80
+	for userID, variant := range enrolled {
+		a := flag.Assign(userID)
+		require.True(t, a.Enabled)
+		require.Equal(t, variant, a.Variant)
+	}
+
+	flag.Allocation = 0
+	assert.False(t, flag.Assign(1).Enabled)
+	flag.Allocation = 100
+	flag.Enabled = false
+	assert.False(t, flag.Assign(1).Enabled)
+
+	plain := &FeatureFlag{Key: "dark-mode", Enabled: true, Allocation: 100, Salt: "s2"}
+	assert.Equal(t, FeatureAssignment{Key: "dark-mode", Enabled: true}, plain.Assign(7))
+}
+
+func TestFeatureFlagService_SaveFlag(t *testing.T) {
+	svc, _ := newFeatureFlagFixture(t)
+	ctx := context.Background()
+
+	for _, flag := range []FeatureFlag{
+		{Key: "Bad Key"},
+		{Key: "ok", Allocation: 101},
+		{Key: "ok", Variants: []FeatureVariant{{Name: "a", Weight: 1}}},
+		{Key: "ok", Variants: []FeatureVariant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}},
+		{Key: "ok", Variants: []FeatureVariant{{Name: "a", Weight: 1}, {Name: "b", Weight: 0}}},
+	} {
+		_, err := svc.SaveFlag(ctx, &flag)
+		assert.ErrorContains(t, err, "invalid feature flag", flag)
+	}
+
+	created, err := svc.SaveFlag(ctx, &FeatureFlag{Key: "dark-mode", Enabled: true, Allocation: 100})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.Salt)
+	assert.Empty(t, created.Variants)
+
+	updated, err := svc.SaveFlag(ctx, &FeatureFlag{Key: "dark-mode", Description: "Dark theme", Allocation: 10})
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Equal(t, created.Salt, updated.Salt, "an empty salt keeps the current one")
+	assert.False(t, updated.Enabled)
+	assert.Equal(t, "Dark theme", updated.Description)
+
+	flags, err := svc.ListFlags(ctx)
+	require.NoError(t, err)
+	assert.Len(t, flags, 1)
+
+	require.NoError(t, svc.DeleteFlag(ctx, "dark-mode"))
+	assert.ErrorContains(t, svc.DeleteFlag(ctx, "dark-mode"), "not found")
+}
+
+func TestFeatureFlagService_ExposuresAndResults(t *testing.T) {
+	svc, db := newFeatureFlagFixture(t)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	flag, err := svc.SaveFlag(ctx, &FeatureFlag{
+		Key: "onboarding", Enabled: true, Allocation: 100, Salt: "fixed",
+		Variants: []FeatureVariant{{Name: "control", Weight: 1}, {Name: "wizard", Weight: 1}},
+	})
+	require.NoError(t, err)
+
+	logEvent := func(userID int, eventType string, at time.Time) {
+		_, err := db.ExecContext(ctx, `INSERT INTO analytics_events (user_id, event_type, timestamp) VALUES (?, ?, ?)`,
+			userID, eventType, at)
+		require.NoError(t, err)
+	}
+
+	variants := map[int]string{}
+	for userID := 1; userID <= 20; userID++ {
+		// An earlier conversion does not count
+		logEvent(userID, "collection_created", now.Add(-time.Hour))
+		a, err := svc.LogExposure(ctx, userID, "onboarding")
+		require.NoError(t, err)
+		require.NotEmpty(t, a.Variant)
+		variants[userID] = a.Variant
+		// A repeated exposure is the same user
+		_, err = svc.LogExposure(ctx, userID, "onboarding")
+		require.NoError(t, err)
+	}
+	wantConverted := map[string]int{}
+	for userID := 1; userID <= 20; userID += 2 {
+		logEvent(userID, "collection_created", now.Add(time.Minute))
+		wantConverted[variants[userID]]++
+	}
+	wantExposed := map[string]int{}
+	for _, v := range variants {
+		wantExposed[v]++
+	}
+
+	results, err := svc.Results(ctx, "onboarding", "collection_created", nil)
+	require.NoError(t, err)
+	require.Len(t, results.Variants, 2)
+	assert.Equal(t, "control", results.Variants[0].Variant)
+	assert.Equal(t, "wizard", results.Variants[1].Variant)
+	for _, r := range results.Variants {
+		assert.Equal(t, wantExposed[r.Variant], r.ExposedUsers, r.Variant)
+		assert.Equal(t, wantConverted[r.Variant], r.ConvertedUsers, r.Variant)
+		if r.ExposedUsers > 0 {
+			assert.InDelta(t, float64(r.ConvertedUsers)/float64(r.ExposedUsers), r.ConversionRate, 1e-9)
+		}
+	}
+
+	later := now.Add(time.Hour)
+	results, err = svc.Results(ctx, "onboarding", "collection_created", &later)
+	require.NoError(t, err)
+	for _, r := range results.Variants {
+		assert.Zero(t, r.ExposedUsers)
+	}
+
+	_, err = svc.Results(ctx, "onboarding", "", nil)
+	assert.ErrorContains(t, err, "conversion event is required")
+
+	// Users outside the experiment are not logged
+	_, err = svc.SaveFlag(ctx, &FeatureFlag{Key: "onboarding", Enabled: false, Variants: flag.Variants})
+	require.NoError(t, err)
+	a, err := svc.LogExposure(ctx, 99, "onboarding")
+	require.NoError(t, err)
+	assert.False(t, a.Enabled)
+	var count int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM analytics_events WHERE user_id = 99`).Scan(&count))
+	assert.Zero(t, count)
+}
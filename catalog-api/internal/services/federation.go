@@ -0,0 +1,836 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Federation modes: a mirrored remote's catalog is copied locally on a
+// schedule, a proxied remote is queried on every request.
+const (
+	FederationModeMirror = "mirror"
+	FederationModeProxy  = "proxy"
+)
+
+// federationPageSize is the page size used to read a remote's catalog; it
+// is the largest page the entities API serves.
+const federationPageSize = 200
+
+var (
+	// ErrRemoteUnavailable is returned when a remote instance cannot be
+	// reached or refuses the stored account.
+	ErrRemoteUnavailable = errors.New("remote library unavailable")
+	// ErrInvalidStreamSignature is returned for stream URLs that were not
+	// signed by this server or have expired.
+	ErrInvalidStreamSignature = errors.New("invalid or expired stream signature")
+)
+
+// FederationRemote is a remote Catalogizer instance registered as a
+// read-only library.
+type FederationRemote struct {
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	BaseURL       string     `json:"base_url"`
+	Username      string     `json:"username"`
+	Password      string     `json:"-"`
+	Mode          string     `json:"mode"`
+	Enabled       bool       `json:"enabled"`
+	ItemCount     int        `json:"item_count"`
+	LastSyncedAt  *time.Time `json:"last_synced_at,omitempty"`
+	LastSyncError string     `json:"last_sync_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// FederationRemoteRequest registers or updates a remote. On update, empty
+// fields keep their current values.
+type FederationRemoteRequest struct {
+	Name     string `json:"name"`
+	BaseURL  string `json:"base_url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Mode     string `json:"mode"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// FederatedItem is a media entity in a remote library. Details holds the
+// entity as the remote's entities API returns it.
+type FederatedItem struct {
+	RemoteID   int64           `json:"remote_id"`
+	RemoteName string          `json:"remote_name"`
+	ID         int64           `json:"id"`
+	MediaType  string          `json:"media_type"`
+	Title      string          `json:"title"`
+	Year       *int            `json:"year,omitempty"`
+	Details    json.RawMessage `json:"details"`
+}
+
+// FederationStream is a stream proxied from a remote instance. The caller
+// must close Body.
+type FederationStream struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// FederationConfig controls federation scheduling and stream URL signing.
+type FederationConfig struct {
+	// SigningKey signs stream URLs handed to local clients.
+	SigningKey string
+	// SyncInterval is how often mirrored remotes are copied.
+	SyncInterval time.Duration
+	// StreamURLTTL is how long a signed stream URL stays valid.
+	StreamURLTTL time.Duration
+}
+
+type federationToken struct {
+	value   string
+	expires time.Time
+}
+
+// FederationService registers remote Catalogizer instances as read-only
+// libraries, makes their catalogs browsable and searchable locally, and
+// proxies their streams through signed URLs.
+type FederationService struct {
+	db           *database.DB
+	logger       *zap.Logger
+	config       FederationConfig
+	client       *http.Client
+	streamClient *http.Client
+	tokensMu     sync.Mutex
+	tokens       map[int64]federationToken
+	mu           sync.Mutex
+	stop         chan struct{}
+	wg           sync.WaitGroup
+	now          func() time.Time
+}
+
+// NewFederationService creates a FederationService. Mirrored remotes are
+// copied every six hours and stream URLs are valid for six hours unless
+// cfg says otherwise.
+func NewFederationService(db *database.DB, logger *zap.Logger, cfg FederationConfig) *FederationService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = 6 * time.Hour
+	}
+	if cfg.StreamURLTTL <= 0 {
+		cfg.StreamURLTTL = 6 * time.Hour
+	}
+	return &FederationService{
+		db:           db,
+		logger:       logger,
+		config:       cfg,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		streamClient: &http.Client{},
+		tokens:       make(map[int64]federationToken),
+		now:          time.Now,
+	}
+}
+
+const federationRemoteColumns = `id, name, base_url, username, password, mode, enabled, item_count,
+	last_synced_at, last_sync_error, created_at, updated_at`
+
+type federationRowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFederationRemote(row federationRowScanner) (*FederationRemote, error) {
+	var remote FederationRemote
+	var lastSynced sql.NullTime
+	var lastError sql.NullString
+	if err := row.Scan(&remote.ID, &remote.Name, &remote.BaseURL, &remote.Username, &remote.Password,
+		&remote.Mode, &remote.Enabled, &remote.ItemCount, &lastSynced, &lastError,
+		&remote.CreatedAt, &remote.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if lastSynced.Valid {
+		remote.LastSyncedAt = &lastSynced.Time
+	}
+	remote.LastSyncError = lastError.String
+	return &remote, nil
+}
+
+// ListRemotes returns the registered remotes by name; enabledOnly leaves
+// out disabled ones.
+func (s *FederationService) ListRemotes(ctx context.Context, enabledOnly bool) ([]FederationRemote, error) {
+	query := `SELECT ` + federationRemoteColumns + ` FROM federation_remotes`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
+	defer rows.Close()
+
+	remotes := []FederationRemote{}
+	for rows.Next() {
+		remote, err := scanFederationRemote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan remote: %w", err)
+		}
+		remotes = append(remotes, *remote)
+	}
+	return remotes, rows.Err()
+}
+
+// GetRemote returns a registered remote.
+func (s *FederationService) GetRemote(ctx context.Context, id int64) (*FederationRemote, error) {
+	remote, err := scanFederationRemote(s.db.QueryRowContext(ctx,
+		`SELECT `+federationRemoteColumns+` FROM federation_remotes WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("remote library not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote: %w", err)
+	}
+	return remote, nil
+}
+
+// enabledRemote returns a remote that is open for browsing.
+func (s *FederationService) enabledRemote(ctx context.Context, id int64) (*FederationRemote, error) {
+	remote, err := s.GetRemote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !remote.Enabled {
+		return nil, fmt.Errorf("remote library not found")
+	}
+	return remote, nil
+}
+
+func validateFederationRemote(remote *FederationRemote) error {
+	remote.Name = strings.TrimSpace(remote.Name)
+	if remote.Name == "" {
+		return fmt.Errorf("invalid remote: name is required")
+	}
+	parsed, err := url.Parse(remote.BaseURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid remote: base_url must be an http or https URL")
+	}
+	remote.BaseURL = strings.TrimRight(remote.BaseURL, "/")
+	if remote.Username == "" || remote.Password == "" {
+		return fmt.Errorf("invalid remote: username and password are required")
+	}
+	if remote.Mode != FederationModeMirror && remote.Mode != FederationModeProxy {
+		return fmt.Errorf("invalid remote: mode must be %s or %s", FederationModeMirror, FederationModeProxy)
+	}
+	return nil
+}
+
+// checkRemoteName rejects a name another remote already uses.
+func (s *FederationService) checkRemoteName(ctx context.Context, name string, id int64) error {
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM federation_remotes WHERE name = ? AND id <> ?`, name, id).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check remote name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("remote %s already exists", name)
+	}
+	return nil
+}
+
+// CreateRemote registers a remote instance. Mode defaults to mirror; a
+// mirrored remote's catalog is copied on the next sync.
+func (s *FederationService) CreateRemote(ctx context.Context, req FederationRemoteRequest) (*FederationRemote, error) {
+	remote := &FederationRemote{
+		Name:     req.Name,
+		BaseURL:  req.BaseURL,
+		Username: req.Username,
+		Password: req.Password,
+		Mode:     req.Mode,
+		Enabled:  true,
+	}
+	if remote.Mode == "" {
+		remote.Mode = FederationModeMirror
+	}
+	if req.Enabled != nil {
+		remote.Enabled = *req.Enabled
+	}
+	if err := validateFederationRemote(remote); err != nil {
+		return nil, err
+	}
+	if err := s.checkRemoteName(ctx, remote.Name, 0); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO federation_remotes (name, base_url, username, password, mode, enabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		remote.Name, remote.BaseURL, remote.Username, remote.Password, remote.Mode, remote.Enabled, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote: %w", err)
+	}
+	return s.GetRemote(ctx, id)
+}
+
+// UpdateRemote changes a remote's settings. Switching a remote to proxy
+// mode drops its mirrored catalog.
+func (s *FederationService) UpdateRemote(ctx context.Context, id int64, req FederationRemoteRequest) (*FederationRemote, error) {
+	remote, err := s.GetRemote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != "" {
+		remote.Name = req.Name
+	}
+	if req.BaseURL != "" {
+		remote.BaseURL = req.BaseURL
+	}
+	if req.Username != "" {
+		remote.Username = req.Username
+	}
+	if req.Password != "" {
+		remote.Password = req.Password
+	}
+	if req.Mode != "" {
+		remote.Mode = req.Mode
+	}
+	if req.Enabled != nil {
+		remote.Enabled = *req.Enabled
+	}
+	if err := validateFederationRemote(remote); err != nil {
+		return nil, err
+	}
+	if err := s.checkRemoteName(ctx, remote.Name, id); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE federation_remotes SET name = ?, base_url = ?, username = ?, password = ?, mode = ?, enabled = ?, updated_at = ?
+		 WHERE id = ?`,
+		remote.Name, remote.BaseURL, remote.Username, remote.Password, remote.Mode, remote.Enabled, s.now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update remote: %w", err)
+	}
+	if remote.Mode == FederationModeProxy {
+		if err := s.clearMirror(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	s.dropToken(id)
+	return s.GetRemote(ctx, id)
+}
+
+// DeleteRemote unregisters a remote and drops its mirrored catalog.
+func (s *FederationService) DeleteRemote(ctx context.Context, id int64) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM federation_items WHERE remote_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete mirrored items: %w", err)
+	}
+	result, err := s.db.ExecContext(ctx, `DELETE FROM federation_remotes WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete remote: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("remote library not found")
+	}
+	s.dropToken(id)
+	return nil
+}
+
+func (s *FederationService) clearMirror(ctx context.Context, id int64) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM federation_items WHERE remote_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete mirrored items: %w", err)
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE federation_remotes SET item_count = 0 WHERE id = ?`, id)
+	return err
+}
+
+// SyncRemote copies a mirrored remote's catalog, replacing the previous
+// copy. A failed sync keeps the previous copy and is recorded on the
+// remote.
+func (s *FederationService) SyncRemote(ctx context.Context, id int64) (*FederationRemote, error) {
+	remote, err := s.GetRemote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if remote.Mode != FederationModeMirror {
+		return nil, fmt.Errorf("invalid sync: remote %s is proxied, not mirrored", remote.Name)
+	}
+
+	items, err := s.fetchCatalog(ctx, remote)
+	if err != nil {
+		if _, recErr := s.db.ExecContext(ctx,
+			`UPDATE federation_remotes SET last_sync_error = ? WHERE id = ?`, err.Error(), id); recErr != nil {
+			s.logger.Warn("Failed to record federation sync error", zap.Int64("remote_id", id), zap.Error(recErr))
+		}
+		return nil, fmt.Errorf("failed to sync remote %s: %w", remote.Name, err)
+	}
+
+	now := s.now()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM federation_items WHERE remote_id = ?`, id); err != nil {
+		return nil, fmt.Errorf("failed to clear mirrored items: %w", err)
+	}
+	for _, item := range items {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO federation_items (remote_id, remote_item_id, media_type, title, year, details, synced_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, item.ID, item.MediaType, item.Title, item.Year, string(item.Details), now); err != nil {
+			return nil, fmt.Errorf("failed to store mirrored item: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE federation_remotes SET item_count = ?, last_synced_at = ?, last_sync_error = NULL WHERE id = ?`,
+		len(items), now, id); err != nil {
+		return nil, fmt.Errorf("failed to update remote: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit sync: %w", err)
+	}
+
+	s.logger.Info("Federated library mirrored", zap.String("remote", remote.Name), zap.Int("items", len(items)))
+	return s.GetRemote(ctx, id)
+}
+
+// SyncAll syncs every enabled mirrored remote, logging failures.
+func (s *FederationService) SyncAll(ctx context.Context) {
+	remotes, err := s.ListRemotes(ctx, true)
+	if err != nil {
+		s.logger.Error("Failed to list federated libraries", zap.Error(err))
+		return
+	}
+	for _, remote := range remotes {
+		if remote.Mode != FederationModeMirror {
+			continue
+		}
+		if _, err := s.SyncRemote(ctx, remote.ID); err != nil {
+			s.logger.Warn("Federated library sync failed", zap.String("remote", remote.Name), zap.Error(err))
+		}
+	}
+}
+
+// Start syncs mirrored remotes on the configured interval until Stop is
+// called.
+func (s *FederationService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.SyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.SyncAll(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for a sync in progress to finish.
+func (s *FederationService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
+
+// Browse lists a remote library's entities, optionally filtered by a title
+// query and media type. Mirrored remotes are read from the local copy.
+func (s *FederationService) Browse(ctx context.Context, remoteID int64, query, mediaType string, limit, offset int) ([]FederatedItem, int, error) {
+	remote, err := s.enabledRemote(ctx, remoteID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.browse(ctx, remote, query, mediaType, limit, offset)
+}
+
+func (s *FederationService) browse(ctx context.Context, remote *FederationRemote, query, mediaType string, limit, offset int) ([]FederatedItem, int, error) {
+	if limit <= 0 || limit > federationPageSize {
+		limit = 24
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if remote.Mode == FederationModeProxy {
+		typeNames, err := s.remoteTypes(ctx, remote)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s.remotePage(ctx, remote, typeNames, query, mediaType, limit, offset)
+	}
+
+	where := `WHERE remote_id = ?`
+	args := []interface{}{remote.ID}
+	if query != "" {
+		where += ` AND LOWER(title) LIKE ?`
+		args = append(args, "%"+strings.ToLower(query)+"%")
+	}
+	if mediaType != "" {
+		where += ` AND media_type = ?`
+		args = append(args, mediaType)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM federation_items `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count mirrored items: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT remote_item_id, media_type, title, year, details FROM federation_items `+where+
+			` ORDER BY title, remote_item_id LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list mirrored items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []FederatedItem{}
+	for rows.Next() {
+		item, err := scanFederatedItem(rows, remote)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, *item)
+	}
+	return items, total, rows.Err()
+}
+
+func scanFederatedItem(row federationRowScanner, remote *FederationRemote) (*FederatedItem, error) {
+	item := FederatedItem{RemoteID: remote.ID, RemoteName: remote.Name}
+	var year sql.NullInt64
+	var details string
+	if err := row.Scan(&item.ID, &item.MediaType, &item.Title, &year, &details); err != nil {
+		return nil, err
+	}
+	if year.Valid {
+		y := int(year.Int64)
+		item.Year = &y
+	}
+	item.Details = json.RawMessage(details)
+	return &item, nil
+}
+
+// Search looks for entities across all enabled remotes. A remote that
+// cannot be reached is left out of the results.
+func (s *FederationService) Search(ctx context.Context, query, mediaType string, limit int) ([]FederatedItem, error) {
+	remotes, err := s.ListRemotes(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	results := []FederatedItem{}
+	for i := range remotes {
+		items, _, err := s.browse(ctx, &remotes[i], query, mediaType, limit, 0)
+		if err != nil {
+			s.logger.Warn("Federated search failed", zap.String("remote", remotes[i].Name), zap.Error(err))
+			continue
+		}
+		results = append(results, items...)
+	}
+	return results, nil
+}
+
+// GetItem returns one entity of a remote library. Proxied remotes return
+// the remote's full entity details.
+func (s *FederationService) GetItem(ctx context.Context, remoteID, itemID int64) (*FederatedItem, error) {
+	remote, err := s.enabledRemote(ctx, remoteID)
+	if err != nil {
+		return nil, err
+	}
+	if remote.Mode == FederationModeMirror {
+		item, err := scanFederatedItem(s.db.QueryRowContext(ctx,
+			`SELECT remote_item_id, media_type, title, year, details FROM federation_items
+			 WHERE remote_id = ? AND remote_item_id = ?`, remoteID, itemID), remote)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("remote item not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mirrored item: %w", err)
+		}
+		return item, nil
+	}
+
+	var details json.RawMessage
+	if err := s.remoteJSON(ctx, remote, "/api/v1/entities/"+strconv.FormatInt(itemID, 10), &details); err != nil {
+		return nil, err
+	}
+	var entity struct {
+		ID        int64  `json:"id"`
+		MediaType string `json:"media_type"`
+		Title     string `json:"title"`
+		Year      *int   `json:"year"`
+	}
+	if err := json.Unmarshal(details, &entity); err != nil {
+		return nil, fmt.Errorf("%w: malformed entity: %v", ErrRemoteUnavailable, err)
+	}
+	return &FederatedItem{RemoteID: remote.ID, RemoteName: remote.Name, ID: entity.ID,
+		MediaType: entity.MediaType, Title: entity.Title, Year: entity.Year, Details: details}, nil
+}
+
+func (s *FederationService) streamSignature(remoteID, itemID, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	fmt.Fprintf(mac, "%d:%d:%d", remoteID, itemID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StreamURL returns a signed URL that streams a remote entity through
+// this server without further authentication, and when it expires.
+func (s *FederationService) StreamURL(ctx context.Context, remoteID, itemID int64) (string, time.Time, error) {
+	if _, err := s.enabledRemote(ctx, remoteID); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := s.now().Add(s.config.StreamURLTTL).Truncate(time.Second)
+	params := url.Values{}
+	params.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	params.Set("signature", s.streamSignature(remoteID, itemID, expires.Unix()))
+	return fmt.Sprintf("/api/v1/federation/stream/%d/%d?%s", remoteID, itemID, params.Encode()), expires, nil
+}
+
+// OpenStream checks a signed stream URL and opens the entity's primary
+// file on the remote. rangeHeader is forwarded so players can seek.
+func (s *FederationService) OpenStream(ctx context.Context, remoteID, itemID, expires int64, signature, rangeHeader string) (*FederationStream, error) {
+	expected := s.streamSignature(remoteID, itemID, expires)
+	if s.now().Unix() > expires || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrInvalidStreamSignature
+	}
+	remote, err := s.enabledRemote(ctx, remoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		StreamURL string `json:"stream_url"`
+	}
+	if err := s.remoteJSON(ctx, remote, fmt.Sprintf("/api/v1/entities/%d/stream", itemID), &info); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(info.StreamURL, "/") {
+		return nil, fmt.Errorf("%w: unexpected stream URL %q", ErrRemoteUnavailable, info.StreamURL)
+	}
+
+	header := http.Header{}
+	if rangeHeader != "" {
+		header.Set("Range", rangeHeader)
+	}
+	resp, err := s.remoteRequest(ctx, s.streamClient, remote, info.StreamURL, header)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("remote item not found")
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: stream returned status %d", ErrRemoteUnavailable, resp.StatusCode)
+	}
+	return &FederationStream{StatusCode: resp.StatusCode, Header: resp.Header, Body: resp.Body}, nil
+}
+
+func (s *FederationService) dropToken(remoteID int64) {
+	s.tokensMu.Lock()
+	delete(s.tokens, remoteID)
+	s.tokensMu.Unlock()
+}
+
+// token signs in to a remote with the stored account, reusing the session
+// until shortly before it expires.
+func (s *FederationService) token(ctx context.Context, remote *FederationRemote, renew bool) (string, error) {
+	s.tokensMu.Lock()
+	cached, ok := s.tokens[remote.ID]
+	s.tokensMu.Unlock()
+	if ok && !renew && s.now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"username": remote.Username, "password": remote.Password})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, remote.BaseURL+"/api/v1/auth/login", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRemoteUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", subtitleUserAgent)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRemoteUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: sign-in returned status %d", ErrRemoteUnavailable, resp.StatusCode)
+	}
+
+	var result struct {
+		SessionToken string    `json:"session_token"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.SessionToken == "" {
+		return "", fmt.Errorf("%w: malformed sign-in response", ErrRemoteUnavailable)
+	}
+	expires := result.ExpiresAt.Add(-time.Minute)
+	if result.ExpiresAt.IsZero() {
+		expires = s.now().Add(time.Hour)
+	}
+	s.tokensMu.Lock()
+	s.tokens[remote.ID] = federationToken{value: result.SessionToken, expires: expires}
+	s.tokensMu.Unlock()
+	return result.SessionToken, nil
+}
+
+// remoteRequest sends an authenticated GET to a remote, signing in again
+// once if the session was rejected.
+func (s *FederationService) remoteRequest(ctx context.Context, client *http.Client, remote *FederationRemote, path string, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := s.token(ctx, remote, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, remote.BaseURL+path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRemoteUnavailable, err)
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("User-Agent", subtitleUserAgent)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRemoteUnavailable, err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			resp.Body.Close()
+			continue
+		}
+		return resp, nil
+	}
+}
+
+func (s *FederationService) remoteJSON(ctx context.Context, remote *FederationRemote, path string, out interface{}) error {
+	resp, err := s.remoteRequest(ctx, s.client, remote, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("remote item not found")
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: %s returned status %d", ErrRemoteUnavailable, path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: malformed response from %s: %v", ErrRemoteUnavailable, path, err)
+	}
+	return nil
+}
+
+// remoteTypes maps a remote's media type IDs to names.
+func (s *FederationService) remoteTypes(ctx context.Context, remote *FederationRemote) (map[int64]string, error) {
+	var response struct {
+		Types []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"types"`
+	}
+	if err := s.remoteJSON(ctx, remote, "/api/v1/entities/types", &response); err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(response.Types))
+	for _, t := range response.Types {
+		names[t.ID] = t.Name
+	}
+	return names, nil
+}
+
+// remotePage reads one page of a remote's entities API.
+func (s *FederationService) remotePage(ctx context.Context, remote *FederationRemote, typeNames map[int64]string, query, mediaType string, limit, offset int) ([]FederatedItem, int, error) {
+	params := url.Values{}
+	if query != "" {
+		params.Set("query", query)
+	}
+	if mediaType != "" {
+		params.Set("type", mediaType)
+	}
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("offset", strconv.Itoa(offset))
+
+	var response struct {
+		Items []json.RawMessage `json:"items"`
+		Total int               `json:"total"`
+	}
+	if err := s.remoteJSON(ctx, remote, "/api/v1/entities?"+params.Encode(), &response); err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]FederatedItem, 0, len(response.Items))
+	for _, raw := range response.Items {
+		var entity struct {
+			ID          int64  `json:"id"`
+			MediaTypeID int64  `json:"media_type_id"`
+			Title       string `json:"title"`
+			Year        *int   `json:"year"`
+		}
+		if err := json.Unmarshal(raw, &entity); err != nil {
+			return nil, 0, fmt.Errorf("%w: malformed entity: %v", ErrRemoteUnavailable, err)
+		}
+		items = append(items, FederatedItem{RemoteID: remote.ID, RemoteName: remote.Name, ID: entity.ID,
+			MediaType: typeNames[entity.MediaTypeID], Title: entity.Title, Year: entity.Year, Details: raw})
+	}
+	return items, response.Total, nil
+}
+
+// fetchCatalog reads a remote's whole catalog, one media type at a time.
+func (s *FederationService) fetchCatalog(ctx context.Context, remote *FederationRemote) ([]FederatedItem, error) {
+	typeNames, err := s.remoteTypes(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	var items []FederatedItem
+	for _, name := range typeNames {
+		for offset := 0; ; {
+			page, total, err := s.remotePage(ctx, remote, typeNames, "", name, federationPageSize, offset)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, page...)
+			offset += len(page)
+			if len(page) == 0 || offset >= total {
+				break
+			}
+		}
+	}
+	return items, nil
+}
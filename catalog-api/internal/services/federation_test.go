@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRemoteCatalog serves the parts of the Catalogizer API a federated
+// instance reads.
+type fakeRemoteCatalog struct {
+	mu      sync.Mutex
+	logins  int
+	revoked bool
+	items   []map[string]interface{}
+}
+
+func (f *fakeRemoteCatalog) loginCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins
+}
+
+func (f *fakeRemoteCatalog) revoke() {
+	f.mu.Lock()
+	f.revoked = true
+	f.mu.Unlock()
+}
+
+func (f *fakeRemoteCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/api/v1/auth/login" {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["username"] != "mirror" || req["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.logins++
+		f.revoked = false
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"session_token": "token-" + strconv.Itoa(f.logins),
+			"expires_at":    time.Now().Add(24 * time.Hour),
+		})
+		return
+	}
+	if f.revoked || r.Header.Get("Authorization") != "Bearer token-"+strconv.Itoa(f.logins) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+	switch {
+	case path == "entities/types":
+		json.NewEncoder(w).Encode(map[string]interface{}{"types": []map[string]interface{}{
+			{"id": 1, "name": "movie"}, {"id": 7, "name": "song"},
+		}})
+	case path == "entities":
+		typeID := map[string]float64{"movie": 1, "song": 7}[r.URL.Query().Get("type")]
+		var matched []map[string]interface{}
+		for _, item := range f.items {
+			if typeID != 0 && item["media_type_id"] != typeID {
+				continue
+			}
+			if q := r.URL.Query().Get("query"); q != "" && !strings.Contains(strings.ToLower(item["title"].(string)), strings.ToLower(q)) {
+				continue
+			}
+			matched = append(matched, item)
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		page := matched[min(offset, len(matched)):min(offset+limit, len(matched))]
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": page, "total": len(matched)})
+	case path == "entities/2/stream":
+		json.NewEncoder(w).Encode(map[string]interface{}{"entity_id": 2, "stream_url": "/api/v1/download/file/20"})
+	case path == "download/file/20":
+		http.ServeContent(w, r, "heat.mkv", time.Time{}, bytes.NewReader([]byte("0123456789")))
+	case path == "entities/2":
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 2, "media_type": "movie", "title": "Heat", "year": 1995, "file_count": 1})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFederationTestService(t *testing.T) (*FederationService, *fakeRemoteCatalog, *httptest.Server) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE federation_remotes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, base_url TEXT NOT NULL,
+			username TEXT NOT NULL, password TEXT NOT NULL, mode TEXT NOT NULL DEFAULT 'mirror',
+			enabled BOOLEAN NOT NULL DEFAULT TRUE, item_count INTEGER NOT NULL DEFAULT 0,
+			last_synced_at DATETIME, last_sync_error TEXT, created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL);
+		CREATE TABLE federation_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, remote_id INTEGER NOT NULL, remote_item_id INTEGER NOT NULL,
+			media_type TEXT NOT NULL, title TEXT NOT NULL, year INTEGER, details TEXT NOT NULL,
+			synced_at DATETIME NOT NULL, UNIQUE (remote_id, remote_item_id))`)
+	require.NoError(t, err)
+
+	remote := &fakeRemoteCatalog{items: []map[string]interface{}{
+		{"id": 1.0, "media_type_id": 1.0, "title": "Alien", "year": 1979.0},
+		{"id": 2.0, "media_type_id": 1.0, "title": "Heat", "year": 1995.0},
+		{"id": 3.0, "media_type_id": 7.0, "title": "Heatwave"},
+	}}
+	server := httptest.NewServer(remote)
+	t.Cleanup(server.Close)
+
+	service := NewFederationService(database.WrapDB(sqlDB, database.DialectSQLite), nil,
+		FederationConfig{SigningKey: "test-key", StreamURLTTL: time.Hour})
+	return service, remote, server
+}
+
+func TestFederation_RemoteValidation(t *testing.T) {
+	service, _, server := newFederationTestService(t)
+	ctx := context.Background()
+
+	_, err := service.CreateRemote(ctx, FederationRemoteRequest{Name: "Cabin", BaseURL: "ftp://cabin", Username: "u", Password: "p"})
+	assert.ErrorContains(t, err, "invalid remote")
+	_, err = service.CreateRemote(ctx, FederationRemoteRequest{Name: "Cabin", BaseURL: server.URL, Username: "u"})
+	assert.ErrorContains(t, err, "invalid remote")
+	_, err = service.CreateRemote(ctx, FederationRemoteRequest{Name: "Cabin", BaseURL: server.URL, Username: "u", Password: "p", Mode: "copy"})
+	assert.ErrorContains(t, err, "invalid remote")
+
+	remote, err := service.CreateRemote(ctx, FederationRemoteRequest{Name: " Cabin ", BaseURL: server.URL + "/", Username: "u", Password: "p"})
+	require.NoError(t, err)
+	assert.Equal(t, "Cabin", remote.Name)
+	assert.Equal(t, server.URL, remote.BaseURL)
+	assert.Equal(t, FederationModeMirror, remote.Mode)
+	assert.True(t, remote.Enabled)
+	_, err = service.CreateRemote(ctx, FederationRemoteRequest{Name: "Cabin", BaseURL: server.URL, Username: "u", Password: "p"})
+	assert.ErrorContains(t, err, "already exists")
+
+	disabled := false
+	remote, err = service.UpdateRemote(ctx, remote.ID, FederationRemoteRequest{Mode: FederationModeProxy, Enabled: &disabled})
+	require.NoError(t, err)
+	assert.Equal(t, FederationModeProxy, remote.Mode)
+	assert.Equal(t, "p", remote.Password)
+
+	remotes, err := service.ListRemotes(ctx, true)
+	require.NoError(t, err)
+	assert.Empty(t, remotes)
+	_, _, err = service.Browse(ctx, remote.ID, "", "", 10, 0)
+	assert.ErrorContains(t, err, "not found")
+
+	require.NoError(t, service.DeleteRemote(ctx, remote.ID))
+	assert.ErrorContains(t, service.DeleteRemote(ctx, remote.ID), "not found")
+}
+
+func TestFederation_MirrorSyncAndBrowse(t *testing.T) {
+	service, fake, server := newFederationTestService(t)
+	ctx := context.Background()
+
+	remote, err := service.CreateRemote(ctx, FederationRemoteRequest{Name: "Lake house", BaseURL: server.URL, Username: "mirror", Password: "secret"})
+	require.NoError(t, err)
+
+	remote, err = service.SyncRemote(ctx, remote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, remote.ItemCount)
+	assert.NotNil(t, remote.LastSyncedAt)
+	assert.Equal(t, 1, fake.loginCount(), "the session is reused across requests")
+
+	items, total, err := service.Browse(ctx, remote.ID, "heat", "", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, items, 2)
+	assert.Equal(t, "Heat", items[0].Title)
+	assert.Equal(t, "movie", items[0].MediaType)
+	require.NotNil(t, items[0].Year)
+	assert.Equal(t, 1995, *items[0].Year)
+	assert.Equal(t, "song", items[1].MediaType)
+	assert.Equal(t, "Lake house", items[1].RemoteName)
+
+	items, total, err = service.Browse(ctx, remote.ID, "", "movie", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Heat", items[0].Title)
+
+	item, err := service.GetItem(ctx, remote.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Alien", item.Title)
+	assert.JSONEq(t, `{"id":1,"media_type_id":1,"title":"Alien","year":1979}`, string(item.Details))
+	_, err = service.GetItem(ctx, remote.ID, 99)
+	assert.ErrorContains(t, err, "not found")
+
+	// A rejected session signs in again; an unreachable remote keeps the copy
+	fake.revoke()
+	_, err = service.SyncRemote(ctx, remote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.loginCount())
+
+	server.Close()
+	_, err = service.SyncRemote(ctx, remote.ID)
+	assert.True(t, errors.Is(err, ErrRemoteUnavailable))
+	remote, err = service.GetRemote(ctx, remote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, remote.ItemCount)
+	assert.NotEmpty(t, remote.LastSyncError)
+	items, err = service.Search(ctx, "alien", "", 10)
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestFederation_ProxySearch(t *testing.T) {
+	service, _, server := newFederationTestService(t)
+	ctx := context.Background()
+
+	proxied, err := service.CreateRemote(ctx, FederationRemoteRequest{Name: "Cabin", BaseURL: server.URL, Username: "mirror", Password: "secret", Mode: FederationModeProxy})
+	require.NoError(t, err)
+	_, err = service.CreateRemote(ctx, FederationRemoteRequest{Name: "Offline", BaseURL: "http://127.0.0.1:1", Username: "mirror", Password: "secret", Mode: FederationModeProxy})
+	require.NoError(t, err)
+
+	_, err = service.SyncRemote(ctx, proxied.ID)
+	assert.ErrorContains(t, err, "invalid sync")
+
+	items, err := service.Search(ctx, "heat", "movie", 10)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Heat", items[0].Title)
+	assert.Equal(t, "movie", items[0].MediaType)
+	assert.Equal(t, proxied.ID, items[0].RemoteID)
+
+	item, err := service.GetItem(ctx, proxied.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Heat", item.Title)
+	assert.Contains(t, string(item.Details), "file_count")
+}
+
+func TestFederation_SignedStream(t *testing.T) {
+	service, _, server := newFederationTestService(t)
+	ctx := context.Background()
+
+	remote, err := service.CreateRemote(ctx, FederationRemoteRequest{Name: "Cabin", BaseURL: server.URL, Username: "mirror", Password: "secret"})
+	require.NoError(t, err)
+
+	streamURL, expires, err := service.StreamURL(ctx, remote.ID, 2)
+	require.NoError(t, err)
+	parsed, err := url.Parse(streamURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/federation/stream/"+strconv.FormatInt(remote.ID, 10)+"/2", parsed.Path)
+	assert.Equal(t, strconv.FormatInt(expires.Unix(), 10), parsed.Query().Get("expires"))
+	signature := parsed.Query().Get("signature")
+
+	stream, err := service.OpenStream(ctx, remote.ID, 2, expires.Unix(), signature, "bytes=2-5")
+	require.NoError(t, err)
+	body, err := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, stream.StatusCode)
+	assert.Equal(t, "2345", string(body))
+	assert.Equal(t, "bytes 2-5/10", stream.Header.Get("Content-Range"))
+
+	_, err = service.OpenStream(ctx, remote.ID, 3, expires.Unix(), signature, "")
+	assert.ErrorIs(t, err, ErrInvalidStreamSignature)
+	_, err = service.OpenStream(ctx, remote.ID, 2, expires.Unix()+1, signature, "")
+	assert.ErrorIs(t, err, ErrInvalidStreamSignature)
+
+	service.now = func() time.Time { return expires.Add(time.Second) }
+	_, err = service.OpenStream(ctx, remote.ID, 2, expires.Unix(), signature, "")
+	assert.ErrorIs(t, err, ErrInvalidStreamSignature)
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// localFileIdentity identifies a file on the API host by its device and
+// inode.
+func localFileIdentity(name string) (FileIdentity, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return FileIdentity{}, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileIdentity{}, errFileIdentityUnsupported
+	}
+	return FileIdentity{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}, nil
+}
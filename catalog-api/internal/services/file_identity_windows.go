@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package services
+
+// localFileIdentity is not supported on Windows, where scans neither
+// check devices nor detect cycles.
+func localFileIdentity(name string) (FileIdentity, error) {
+	return FileIdentity{}, errFileIdentityUnsupported
+}
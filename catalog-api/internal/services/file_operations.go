@@ -0,0 +1,664 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// TrashDirName is the directory at the top of every storage root that
+// holds what users deleted there until they restore or purge it. Scans
+// skip it.
+const TrashDirName = ".catalogizer-trash"
+
+// Audit events of file operations, recorded in auth_audit_log.
+const (
+	// AuditEventFileMoved is recorded when a file is moved or renamed.
+	AuditEventFileMoved = "file_moved"
+	// AuditEventFileTrashed is recorded when a file is deleted to the
+	// trash.
+	AuditEventFileTrashed = "file_trashed"
+	// AuditEventFileRestored is recorded when a file is restored from
+	// the trash.
+	AuditEventFileRestored = "file_restored"
+	// AuditEventTrashPurged is recorded when a file is deleted from the
+	// trash for good.
+	AuditEventTrashPurged = "trash_purged"
+	// AuditEventShareTrashRestored is recorded when a file is restored
+	// from a recycle bin of a NAS share.
+	AuditEventShareTrashRestored = "share_trash_restored"
+)
+
+var (
+	// errRenameUnsupported is returned for storage that cannot move
+	// files in one step.
+	errRenameUnsupported = errors.New("storage cannot move files in one step")
+	// errRemoveTreeUnsupported is returned for storage that cannot
+	// remove directories.
+	errRemoveTreeUnsupported = errors.New("storage cannot remove directories")
+)
+
+// storageRenamer is implemented by providers that can move a file or
+// directory within the root in one step.
+type storageRenamer interface {
+	Rename(ctx context.Context, srcPath, dstPath string) error
+}
+
+// treeRemover is implemented by providers that can remove a directory
+// with everything in it.
+type treeRemover interface {
+	RemoveAll(ctx context.Context, path string) error
+}
+
+// renameFile moves a file within a root through provider, if it can.
+func renameFile(ctx context.Context, provider StorageProvider, srcPath, dstPath string) error {
+	if renamer, ok := provider.(storageRenamer); ok {
+		return renamer.Rename(ctx, srcPath, dstPath)
+	}
+	return errRenameUnsupported
+}
+
+// removeTree removes a file or directory through provider, if it can.
+func removeTree(ctx context.Context, provider StorageProvider, path string) error {
+	if remover, ok := provider.(treeRemover); ok {
+		return remover.RemoveAll(ctx, path)
+	}
+	return errRemoveTreeUnsupported
+}
+
+// FileActor is the user a file operation is done for, as it is audited.
+type FileActor struct {
+	UserID    int
+	IPAddress string
+	UserAgent string
+}
+
+// FileMoveRequest moves a file or directory to another path, on the same
+// storage root or another one.
+type FileMoveRequest struct {
+	StorageRoot string
+	Path        string
+	// DestStorageRoot is the root to move to, the same root when empty
+	DestStorageRoot string
+	DestPath        string
+}
+
+// FileMove is a completed move.
+type FileMove struct {
+	StorageRoot     string `json:"storage_root"`
+	Path            string `json:"path"`
+	DestStorageRoot string `json:"dest_storage_root"`
+	DestPath        string `json:"dest_path"`
+	IsDirectory     bool   `json:"is_directory"`
+}
+
+// TrashItem is a file or directory a user deleted, kept in the trash of
+// its storage root until it is restored or purged.
+type TrashItem struct {
+	ID            int64     `json:"id"`
+	UserID        int       `json:"user_id"`
+	StorageRootID int64     `json:"storage_root_id"`
+	StorageRoot   string    `json:"storage_root"`
+	OriginalPath  string    `json:"original_path"`
+	TrashPath     string    `json:"trash_path"`
+	IsDirectory   bool      `json:"is_directory"`
+	Size          int64     `json:"size"`
+	DeletedAt     time.Time `json:"deleted_at"`
+}
+
+// FileOperations moves, renames and deletes files on storage roots and
+// keeps the catalog in step. Deleted files go to a per-user trash on
+// their own root, under TrashDirName, from which they can be restored or
+// purged.
+//
+// Directories can only be moved and deleted on storage that can rename,
+// which local roots can; elsewhere a file is copied and the original
+// deleted. Directories are never moved to another root, and files moved
+// there are cataloged by its next scan.
+type FileOperations struct {
+	db        *database.DB
+	logger    *zap.Logger
+	providers *StorageProviderFactory
+	lockdowns lockdownStatus
+	now       func() time.Time
+}
+
+// NewFileOperations creates a FileOperations that reaches storage
+// through providers.
+func NewFileOperations(db *database.DB, providers *StorageProviderFactory, logger *zap.Logger) *FileOperations {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &FileOperations{db: db, logger: logger, providers: providers, now: time.Now}
+}
+
+// SetLockdownChecker makes file operations honour ransomware lockdowns.
+func (o *FileOperations) SetLockdownChecker(checker lockdownStatus) {
+	o.lockdowns = checker
+}
+
+// cleanOperationPath normalizes a path given to a file operation. The
+// root itself and the trash cannot be operated on.
+func cleanOperationPath(p string) (string, error) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid path: the storage root itself cannot be changed")
+	}
+	if cleaned == TrashDirName || strings.HasPrefix(cleaned, TrashDirName+"/") {
+		return "", fmt.Errorf("invalid path: %s is in the trash", p)
+	}
+	return cleaned, nil
+}
+
+// connect loads a storage root by name and connects to it, refusing
+// roots under lockdown.
+func (o *FileOperations) connect(ctx context.Context, name string) (*models.StorageRoot, StorageProvider, error) {
+	if o.providers == nil {
+		return nil, nil, fmt.Errorf("storage providers not configured")
+	}
+	root, err := loadStorageRootByName(ctx, o.db, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.lockdowns != nil && o.lockdowns.IsLocked(root.Name) {
+		return nil, nil, fmt.Errorf("storage root %s is locked", root.Name)
+	}
+	provider, err := o.providers.ProviderFor(ctx, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, provider, nil
+}
+
+// Move moves a file or directory. The destination must not exist.
+func (o *FileOperations) Move(ctx context.Context, actor FileActor, req FileMoveRequest) (*FileMove, error) {
+	return o.move(ctx, actor, req, "move")
+}
+
+// Rename gives a file or directory a new name in the same directory.
+func (o *FileOperations) Rename(ctx context.Context, actor FileActor, storageRoot, filePath, newName string) (*FileMove, error) {
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return nil, fmt.Errorf("invalid name %q", newName)
+	}
+	src, err := cleanOperationPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return o.move(ctx, actor, FileMoveRequest{
+		StorageRoot: storageRoot,
+		Path:        src,
+		DestPath:    path.Join(path.Dir(src), newName),
+	}, "rename")
+}
+
+func (o *FileOperations) move(ctx context.Context, actor FileActor, req FileMoveRequest, action string) (*FileMove, error) {
+	src, err := cleanOperationPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := cleanOperationPath(req.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	destRoot := req.DestStorageRoot
+	if destRoot == "" {
+		destRoot = req.StorageRoot
+	}
+	sameRoot := destRoot == req.StorageRoot
+	if sameRoot && (dst == src || strings.HasPrefix(dst, src+"/")) {
+		return nil, fmt.Errorf("invalid destination: %s is inside %s", dst, src)
+	}
+
+	srcRoot, srcProvider, err := o.connect(ctx, req.StorageRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer srcProvider.Close()
+	dstRoot, dstProvider := srcRoot, srcProvider
+	if !sameRoot {
+		dstRoot, dstProvider, err = o.connect(ctx, destRoot)
+		if err != nil {
+			return nil, err
+		}
+		defer dstProvider.Close()
+	}
+
+	info, err := statExisting(ctx, srcProvider, srcRoot.Name, src)
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := dstProvider.Exists(ctx, dst); err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", dst, err)
+	} else if exists {
+		return nil, fmt.Errorf("%s already exists in %s", dst, dstRoot.Name)
+	}
+
+	if sameRoot {
+		if err := moveWithinRoot(ctx, srcProvider, src, dst, info.IsDir); err != nil {
+			return nil, fmt.Errorf("failed to move %s: %w", src, err)
+		}
+		if err := o.relocateCatalog(ctx, srcRoot.ID, src, dst); err != nil {
+			o.logger.Warn("Failed to update catalog after move",
+				zap.String("storage_root", srcRoot.Name), zap.String("from", src), zap.String("to", dst), zap.Error(err))
+		}
+	} else {
+		if info.IsDir {
+			return nil, fmt.Errorf("moving directories between storage roots is not supported")
+		}
+		if err := copyBetweenProviders(ctx, srcProvider, dstProvider, src, dst); err != nil {
+			return nil, fmt.Errorf("failed to move %s: %w", src, err)
+		}
+		if err := srcProvider.Delete(ctx, src); err != nil {
+			return nil, fmt.Errorf("copied %s to %s but failed to remove the original: %w", src, dstRoot.Name, err)
+		}
+		if _, err := o.db.ExecContext(ctx,
+			`UPDATE files SET deleted = ?, deleted_at = ? WHERE storage_root_id = ? AND path = ?`,
+			true, o.now(), srcRoot.ID, src); err != nil {
+			o.logger.Warn("Failed to update catalog after move",
+				zap.String("storage_root", srcRoot.Name), zap.String("path", src), zap.Error(err))
+		}
+	}
+
+	result := &FileMove{
+		StorageRoot:     srcRoot.Name,
+		Path:            src,
+		DestStorageRoot: dstRoot.Name,
+		DestPath:        dst,
+		IsDirectory:     info.IsDir,
+	}
+	o.logger.Info("Moved file",
+		zap.String("action", action),
+		zap.String("storage_root", result.StorageRoot),
+		zap.String("from", src),
+		zap.String("dest_storage_root", result.DestStorageRoot),
+		zap.String("to", dst),
+		zap.Int("user_id", actor.UserID))
+	o.recordAudit(ctx, actor, AuditEventFileMoved, map[string]interface{}{
+		"action":            action,
+		"storage_root":      result.StorageRoot,
+		"path":              src,
+		"dest_storage_root": result.DestStorageRoot,
+		"dest_path":         dst,
+		"is_directory":      info.IsDir,
+	})
+	return result, nil
+}
+
+// statExisting returns the info of a file that must exist.
+func statExisting(ctx context.Context, provider StorageProvider, root, p string) (*filesystem.FileInfo, error) {
+	exists, err := provider.Exists(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", p, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s not found in %s", p, root)
+	}
+	info, err := provider.Stat(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", p, err)
+	}
+	return info, nil
+}
+
+// moveWithinRoot renames a file or directory, or copies a file and
+// deletes the original on storage that cannot rename.
+func moveWithinRoot(ctx context.Context, provider StorageProvider, src, dst string, isDir bool) error {
+	err := renameFile(ctx, provider, src, dst)
+	if !errors.Is(err, errRenameUnsupported) {
+		return err
+	}
+	if isDir {
+		return fmt.Errorf("directories are not supported on %s storage", provider.Protocol())
+	}
+	if err := provider.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := provider.Delete(ctx, src); err != nil {
+		provider.Delete(ctx, dst)
+		return err
+	}
+	return nil
+}
+
+// copyBetweenProviders streams a file from one root to another.
+func copyBetweenProviders(ctx context.Context, src, dst StorageProvider, srcPath, dstPath string) error {
+	r, err := src.Open(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Write(ctx, dstPath, r)
+}
+
+// underPath matches the catalog records of a path and everything in it.
+// Its arguments are the path, its length in characters plus one and the
+// path with a trailing slash.
+const underPath = `(path = ? OR substr(path, 1, ?) = ?)`
+
+func underPathArgs(p string) []interface{} {
+	return []interface{}{p, utf8.RuneCountInString(p) + 1, p + "/"}
+}
+
+// moveCatalogPaths changes the path of the catalog records of a file,
+// and of everything in it, from one prefix to another.
+func (o *FileOperations) moveCatalogPaths(ctx context.Context, rootID int64, from, to string) error {
+	args := append([]interface{}{to, utf8.RuneCountInString(from) + 1, rootID}, underPathArgs(from)...)
+	_, err := o.db.ExecContext(ctx,
+		`UPDATE files SET path = CAST(? AS TEXT) || substr(path, ?) WHERE storage_root_id = ? AND `+underPath, args...)
+	return err
+}
+
+// relocateCatalog moves the catalog records of a file, and of everything
+// in it, to a new path on the same root, and gives the file its new
+// name and parent. Records of deleted files that were at the new path
+// are removed first.
+func (o *FileOperations) relocateCatalog(ctx context.Context, rootID int64, from, to string) error {
+	if _, err := o.db.ExecContext(ctx, `DELETE FROM files WHERE storage_root_id = ? AND deleted = ? AND `+underPath,
+		append([]interface{}{rootID, true}, underPathArgs(to)...)...); err != nil {
+		return err
+	}
+	if err := o.moveCatalogPaths(ctx, rootID, from, to); err != nil {
+		return err
+	}
+
+	var id int64
+	var detected sql.NullString
+	err := o.db.QueryRowContext(ctx,
+		`SELECT id, detected_mime_type FROM files WHERE storage_root_id = ? AND path = ?`, rootID, to).Scan(&id, &detected)
+	if err == sql.ErrNoRows {
+		// Not cataloged yet; the next scan adds it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var parentID *int64
+	if parent := path.Dir(to); parent != "." {
+		var pid int64
+		err := o.db.QueryRowContext(ctx,
+			`SELECT id FROM files WHERE storage_root_id = ? AND path = ? AND deleted = ?`, rootID, parent, false).Scan(&pid)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			parentID = &pid
+		}
+	}
+	name := path.Base(to)
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	_, err = o.db.ExecContext(ctx,
+		`UPDATE files SET name = ?, extension = ?, mime_type = ?, file_type = ?, type_mismatch = ?, parent_id = ? WHERE id = ?`,
+		name, ext, mime.TypeByExtension("."+ext), contentFileType(ext, detected.String),
+		mediaTypeMismatch(ext, detected.String), parentID, id)
+	return err
+}
+
+// setCatalogDeleted marks the catalog records of a file, and of
+// everything in it, deleted or not.
+func (o *FileOperations) setCatalogDeleted(ctx context.Context, rootID int64, p string, deleted bool) error {
+	var deletedAt *time.Time
+	if deleted {
+		now := o.now()
+		deletedAt = &now
+	}
+	_, err := o.db.ExecContext(ctx, `UPDATE files SET deleted = ?, deleted_at = ? WHERE storage_root_id = ? AND `+underPath,
+		append([]interface{}{deleted, deletedAt, rootID}, underPathArgs(p)...)...)
+	return err
+}
+
+// Trash deletes a file or directory to the user's trash on its storage
+// root. Its catalog records go with it and are marked deleted.
+func (o *FileOperations) Trash(ctx context.Context, actor FileActor, storageRoot, filePath string) (*TrashItem, error) {
+	p, err := cleanOperationPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	root, provider, err := o.connect(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	info, err := statExisting(ctx, provider, root.Name, p)
+	if err != nil {
+		return nil, err
+	}
+	trashPath := path.Join(TrashDirName, strconv.Itoa(actor.UserID), uuid.NewString(), path.Base(p))
+	if err := moveWithinRoot(ctx, provider, p, trashPath, info.IsDir); err != nil {
+		return nil, fmt.Errorf("failed to move %s to the trash: %w", p, err)
+	}
+
+	item := &TrashItem{
+		UserID:        actor.UserID,
+		StorageRootID: root.ID,
+		StorageRoot:   root.Name,
+		OriginalPath:  p,
+		TrashPath:     trashPath,
+		IsDirectory:   info.IsDir,
+		Size:          info.Size,
+		DeletedAt:     o.now(),
+	}
+	item.ID, err = o.db.InsertReturningID(ctx,
+		`INSERT INTO trash_items (user_id, storage_root_id, original_path, trash_path, is_directory, size, deleted_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		item.UserID, item.StorageRootID, item.OriginalPath, item.TrashPath, item.IsDirectory, item.Size, item.DeletedAt)
+	if err != nil {
+		// Without its record the file could not be restored
+		if undo := moveWithinRoot(ctx, provider, trashPath, p, info.IsDir); undo != nil {
+			o.logger.Error("Failed to take file back out of the trash",
+				zap.String("storage_root", root.Name), zap.String("path", p), zap.Error(undo))
+		}
+		return nil, fmt.Errorf("failed to record trash item: %w", err)
+	}
+
+	err = o.moveCatalogPaths(ctx, root.ID, p, trashPath)
+	if err == nil {
+		err = o.setCatalogDeleted(ctx, root.ID, trashPath, true)
+	}
+	if err != nil {
+		o.logger.Warn("Failed to update catalog after delete",
+			zap.String("storage_root", root.Name), zap.String("path", p), zap.Error(err))
+	}
+
+	o.logger.Info("Moved file to trash",
+		zap.String("storage_root", root.Name),
+		zap.String("path", p),
+		zap.Int64("trash_item_id", item.ID),
+		zap.Int("user_id", actor.UserID))
+	o.recordAudit(ctx, actor, AuditEventFileTrashed, map[string]interface{}{
+		"trash_item_id": item.ID,
+		"storage_root":  root.Name,
+		"path":          p,
+		"is_directory":  info.IsDir,
+		"size":          info.Size,
+	})
+	return item, nil
+}
+
+const trashItemColumns = `t.id, t.user_id, t.storage_root_id, sr.name, t.original_path, t.trash_path, t.is_directory, t.size, t.deleted_at`
+
+func scanTrashItem(row shareLinkScanner) (*TrashItem, error) {
+	var item TrashItem
+	if err := row.Scan(&item.ID, &item.UserID, &item.StorageRootID, &item.StorageRoot, &item.OriginalPath,
+		&item.TrashPath, &item.IsDirectory, &item.Size, &item.DeletedAt); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListTrash returns what a user has in the trash, newest first.
+func (o *FileOperations) ListTrash(ctx context.Context, userID int) ([]TrashItem, error) {
+	rows, err := o.db.QueryContext(ctx,
+		`SELECT `+trashItemColumns+` FROM trash_items t JOIN storage_roots sr ON sr.id = t.storage_root_id
+		 WHERE t.user_id = ? ORDER BY t.deleted_at DESC, t.id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var items []TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trash item: %w", err)
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+// loadTrashItem returns an item of a user's trash.
+func (o *FileOperations) loadTrashItem(ctx context.Context, userID int, id int64) (*TrashItem, error) {
+	item, err := scanTrashItem(o.db.QueryRowContext(ctx,
+		`SELECT `+trashItemColumns+` FROM trash_items t JOIN storage_roots sr ON sr.id = t.storage_root_id
+		 WHERE t.id = ? AND t.user_id = ?`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("trash item %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trash item: %w", err)
+	}
+	return item, nil
+}
+
+// RestoreTrash moves an item of the user's trash back to where it was
+// deleted from, which must be free again, and revives its catalog
+// records.
+func (o *FileOperations) RestoreTrash(ctx context.Context, actor FileActor, id int64) (*TrashItem, error) {
+	item, err := o.loadTrashItem(ctx, actor.UserID, id)
+	if err != nil {
+		return nil, err
+	}
+	root, provider, err := o.connect(ctx, item.StorageRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	if _, err := statExisting(ctx, provider, root.Name, item.TrashPath); err != nil {
+		return nil, err
+	}
+	if exists, err := provider.Exists(ctx, item.OriginalPath); err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", item.OriginalPath, err)
+	} else if exists {
+		return nil, fmt.Errorf("%s already exists in %s", item.OriginalPath, root.Name)
+	}
+	if err := moveWithinRoot(ctx, provider, item.TrashPath, item.OriginalPath, item.IsDirectory); err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", item.OriginalPath, err)
+	}
+	removeTree(ctx, provider, path.Dir(item.TrashPath))
+
+	if _, err := o.db.ExecContext(ctx, `DELETE FROM trash_items WHERE id = ?`, item.ID); err != nil {
+		return nil, fmt.Errorf("failed to remove trash item: %w", err)
+	}
+	err = o.relocateCatalog(ctx, root.ID, item.TrashPath, item.OriginalPath)
+	if err == nil {
+		err = o.setCatalogDeleted(ctx, root.ID, item.OriginalPath, false)
+	}
+	if err != nil {
+		o.logger.Warn("Failed to update catalog after restore",
+			zap.String("storage_root", root.Name), zap.String("path", item.OriginalPath), zap.Error(err))
+	}
+
+	o.logger.Info("Restored file from trash",
+		zap.String("storage_root", root.Name),
+		zap.String("path", item.OriginalPath),
+		zap.Int64("trash_item_id", item.ID),
+		zap.Int("user_id", actor.UserID))
+	o.recordAudit(ctx, actor, AuditEventFileRestored, map[string]interface{}{
+		"trash_item_id": item.ID,
+		"storage_root":  root.Name,
+		"path":          item.OriginalPath,
+	})
+	return item, nil
+}
+
+// PurgeTrash deletes an item of the user's trash for good.
+func (o *FileOperations) PurgeTrash(ctx context.Context, actor FileActor, id int64) error {
+	item, err := o.loadTrashItem(ctx, actor.UserID, id)
+	if err != nil {
+		return err
+	}
+	return o.purge(ctx, actor, item)
+}
+
+// EmptyTrash deletes everything in the user's trash for good and returns
+// how many items were purged. It stops at the first item that cannot be
+// purged.
+func (o *FileOperations) EmptyTrash(ctx context.Context, actor FileActor) (int, error) {
+	items, err := o.ListTrash(ctx, actor.UserID)
+	if err != nil {
+		return 0, err
+	}
+	for i := range items {
+		if err := o.purge(ctx, actor, &items[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(items), nil
+}
+
+func (o *FileOperations) purge(ctx context.Context, actor FileActor, item *TrashItem) error {
+	root, provider, err := o.connect(ctx, item.StorageRoot)
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+
+	// An item already gone from storage is only forgotten
+	exists, err := provider.Exists(ctx, item.TrashPath)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", item.TrashPath, err)
+	}
+	if exists {
+		err := removeTree(ctx, provider, path.Dir(item.TrashPath))
+		if errors.Is(err, errRemoveTreeUnsupported) && !item.IsDirectory {
+			err = provider.Delete(ctx, item.TrashPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to purge %s: %w", item.OriginalPath, err)
+		}
+	}
+	if _, err := o.db.ExecContext(ctx, `DELETE FROM trash_items WHERE id = ?`, item.ID); err != nil {
+		return fmt.Errorf("failed to remove trash item: %w", err)
+	}
+
+	o.logger.Info("Purged file from trash",
+		zap.String("storage_root", root.Name),
+		zap.String("path", item.OriginalPath),
+		zap.Int64("trash_item_id", item.ID),
+		zap.Int("user_id", actor.UserID))
+	o.recordAudit(ctx, actor, AuditEventTrashPurged, map[string]interface{}{
+		"trash_item_id": item.ID,
+		"storage_root":  root.Name,
+		"path":          item.OriginalPath,
+		"is_directory":  item.IsDirectory,
+		"size":          item.Size,
+	})
+	return nil
+}
+
+func (o *FileOperations) recordAudit(ctx context.Context, actor FileActor, event string, details map[string]interface{}) {
+	encoded, _ := json.Marshal(details)
+	_, err := o.db.ExecContext(ctx,
+		`INSERT INTO auth_audit_log (user_id, event_type, ip_address, user_agent, details) VALUES (?, ?, ?, ?, ?)`,
+		actor.UserID, event, actor.IPAddress, actor.UserAgent, string(encoded))
+	if err != nil {
+		o.logger.Error("Failed to record file operation in audit log", zap.String("event", event), zap.Error(err))
+	}
+}
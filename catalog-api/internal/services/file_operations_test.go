@@ -0,0 +1,284 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fileOperationsFixture struct {
+	db    *database.DB
+	ops   *FileOperations
+	dir   string
+	other string
+	actor FileActor
+}
+
+func newFileOperationsFixture(t *testing.T) *fileOperationsFixture {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			extension TEXT,
+			mime_type TEXT,
+			file_type TEXT,
+			detected_mime_type TEXT,
+			type_mismatch BOOLEAN DEFAULT 0,
+			size INTEGER NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			deleted BOOLEAN DEFAULT 0,
+			deleted_at DATETIME,
+			parent_id INTEGER,
+			UNIQUE(storage_root_id, path)
+		);
+		CREATE TABLE trash_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			storage_root_id INTEGER NOT NULL,
+			original_path TEXT NOT NULL,
+			trash_path TEXT NOT NULL,
+			is_directory BOOLEAN NOT NULL,
+			size BIGINT NOT NULL DEFAULT 0,
+			deleted_at DATETIME NOT NULL
+		);
+		CREATE TABLE auth_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			event_type TEXT NOT NULL,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	require.NoError(t, err)
+
+	f := &fileOperationsFixture{
+		db:    database.WrapDB(sqlDB, database.DialectSQLite),
+		dir:   t.TempDir(),
+		other: t.TempDir(),
+		actor: FileActor{UserID: 7, IPAddress: "10.0.0.1"},
+	}
+	_, err = f.db.Exec(`INSERT INTO storage_roots (id, name, protocol, path) VALUES (1, 'media', 'local', ?), (2, 'archive', 'local', ?)`,
+		f.dir, f.other)
+	require.NoError(t, err)
+
+	f.ops = NewFileOperations(f.db, NewStorageProviderFactory(f.db, localRootClients{}, zap.NewNop()), zap.NewNop())
+	return f
+}
+
+// add writes a file to the media root and catalogs it with its parent
+// directories.
+func (f *fileOperationsFixture) add(t *testing.T, name, content string) {
+	t.Helper()
+	full := filepath.Join(f.dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+	require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+
+	var parentID *int64
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		rel := strings.Join(parts[:i+1], "/")
+		isDir := i < len(parts)-1
+		var id int64
+		err := f.db.QueryRow(`SELECT id FROM files WHERE storage_root_id = 1 AND path = ?`, rel).Scan(&id)
+		if err == sql.ErrNoRows {
+			size := 0
+			if !isDir {
+				size = len(content)
+			}
+			id, err = f.db.InsertReturningID(context.Background(),
+				`INSERT INTO files (storage_root_id, path, name, size, is_directory, parent_id) VALUES (1, ?, ?, ?, ?, ?)`,
+				rel, parts[i], size, isDir, parentID)
+		}
+		require.NoError(t, err)
+		parentID = &id
+	}
+}
+
+type cataloged struct {
+	name     string
+	deleted  bool
+	parentID sql.NullInt64
+}
+
+func (f *fileOperationsFixture) record(t *testing.T, path string) *cataloged {
+	t.Helper()
+	var c cataloged
+	err := f.db.QueryRow(`SELECT name, deleted, parent_id FROM files WHERE storage_root_id = 1 AND path = ?`, path).
+		Scan(&c.name, &c.deleted, &c.parentID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	require.NoError(t, err)
+	return &c
+}
+
+func (f *fileOperationsFixture) audits(t *testing.T, event string) int {
+	t.Helper()
+	var count int
+	require.NoError(t, f.db.QueryRow(`SELECT COUNT(*) FROM auth_audit_log WHERE event_type = ? AND user_id = ?`,
+		event, f.actor.UserID).Scan(&count))
+	return count
+}
+
+func TestFileOperations_MoveAndRename(t *testing.T) {
+	f := newFileOperationsFixture(t)
+	ctx := context.Background()
+	f.add(t, "films/a.mkv", "aaaa")
+	f.add(t, "films/extras/b.mkv", "bb")
+	f.add(t, "old/c.mkv", "c")
+	f.add(t, "shows/.keep", "")
+
+	// A directory moves with everything in it
+	moved, err := f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "/films/", DestPath: "shows/films"})
+	require.NoError(t, err)
+	assert.True(t, moved.IsDirectory)
+	assert.Equal(t, "shows/films", moved.DestPath)
+	assert.FileExists(t, filepath.Join(f.dir, "shows", "films", "extras", "b.mkv"))
+	assert.NoDirExists(t, filepath.Join(f.dir, "films"))
+	assert.Nil(t, f.record(t, "films/a.mkv"))
+	require.NotNil(t, f.record(t, "shows/films/extras/b.mkv"))
+	dir := f.record(t, "shows/films")
+	require.NotNil(t, dir)
+	assert.True(t, dir.parentID.Valid, "the moved directory gets its new parent")
+
+	renamed, err := f.ops.Rename(ctx, f.actor, "media", "shows/films/a.mkv", "a (2020).mp4")
+	require.NoError(t, err)
+	assert.Equal(t, "shows/films/a (2020).mp4", renamed.DestPath)
+	record := f.record(t, "shows/films/a (2020).mp4")
+	require.NotNil(t, record)
+	assert.Equal(t, "a (2020).mp4", record.name)
+
+	// Files move to other roots by copy, and leave the catalog of this one
+	moved, err = f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "old/c.mkv", DestStorageRoot: "archive", DestPath: "c.mkv"})
+	require.NoError(t, err)
+	assert.Equal(t, "archive", moved.DestStorageRoot)
+	assert.FileExists(t, filepath.Join(f.other, "c.mkv"))
+	assert.NoFileExists(t, filepath.Join(f.dir, "old", "c.mkv"))
+	assert.True(t, f.record(t, "old/c.mkv").deleted)
+
+	assert.Equal(t, 3, f.audits(t, AuditEventFileMoved))
+}
+
+func TestFileOperations_MoveRejects(t *testing.T) {
+	f := newFileOperationsFixture(t)
+	ctx := context.Background()
+	f.add(t, "films/a.mkv", "aaaa")
+	f.add(t, "films/b.mkv", "bbbb")
+
+	_, err := f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "films/a.mkv", DestPath: "films/b.mkv"})
+	assert.ErrorContains(t, err, "already exists")
+	_, err = f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "films/x.mkv", DestPath: "x.mkv"})
+	assert.ErrorContains(t, err, "not found")
+	_, err = f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "films", DestPath: "films/inner"})
+	assert.ErrorContains(t, err, "invalid destination")
+	_, err = f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "films", DestStorageRoot: "archive", DestPath: "films"})
+	assert.ErrorContains(t, err, "not supported")
+	_, err = f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "../..", DestPath: "x"})
+	assert.ErrorContains(t, err, "invalid path")
+	_, err = f.ops.Move(ctx, f.actor, FileMoveRequest{StorageRoot: "media", Path: "films/a.mkv", DestPath: TrashDirName + "/a.mkv"})
+	assert.ErrorContains(t, err, "invalid path")
+	_, err = f.ops.Rename(ctx, f.actor, "media", "films/a.mkv", "../a.mkv")
+	assert.ErrorContains(t, err, "invalid name")
+
+	f.ops.SetLockdownChecker(lockedRoots{"media": true})
+	_, err = f.ops.Trash(ctx, f.actor, "media", "films/a.mkv")
+	assert.ErrorContains(t, err, "is locked")
+	assert.FileExists(t, filepath.Join(f.dir, "films", "a.mkv"))
+	assert.Zero(t, f.audits(t, AuditEventFileMoved))
+}
+
+func TestFileOperations_TrashRestorePurge(t *testing.T) {
+	f := newFileOperationsFixture(t)
+	ctx := context.Background()
+	f.add(t, "films/a.mkv", "aaaa")
+	f.add(t, "films/extras/b.mkv", "bb")
+	f.add(t, "c.mkv", "c")
+
+	item, err := f.ops.Trash(ctx, f.actor, "media", "films")
+	require.NoError(t, err)
+	assert.True(t, item.IsDirectory)
+	assert.Equal(t, "films", item.OriginalPath)
+	assert.NoDirExists(t, filepath.Join(f.dir, "films"))
+	assert.FileExists(t, filepath.Join(f.dir, filepath.FromSlash(item.TrashPath), "extras", "b.mkv"))
+	assert.Nil(t, f.record(t, "films/a.mkv"))
+	assert.True(t, f.record(t, item.TrashPath+"/a.mkv").deleted)
+
+	// Each user only sees their own trash
+	items, err := f.ops.ListTrash(ctx, f.actor.UserID)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "media", items[0].StorageRoot)
+	_, err = f.ops.RestoreTrash(ctx, FileActor{UserID: 8}, item.ID)
+	assert.ErrorContains(t, err, "not found")
+
+	// Restoring needs the original path to be free
+	require.NoError(t, os.Mkdir(filepath.Join(f.dir, "films"), 0755))
+	_, err = f.ops.RestoreTrash(ctx, f.actor, item.ID)
+	assert.ErrorContains(t, err, "already exists")
+	require.NoError(t, os.Remove(filepath.Join(f.dir, "films")))
+
+	_, err = f.ops.RestoreTrash(ctx, f.actor, item.ID)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(f.dir, "films", "extras", "b.mkv"))
+	record := f.record(t, "films/extras/b.mkv")
+	require.NotNil(t, record)
+	assert.False(t, record.deleted)
+	items, err = f.ops.ListTrash(ctx, f.actor.UserID)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	item, err = f.ops.Trash(ctx, f.actor, "media", "c.mkv")
+	require.NoError(t, err)
+	_, err = f.ops.Trash(ctx, f.actor, "media", "films/a.mkv")
+	require.NoError(t, err)
+	require.NoError(t, f.ops.PurgeTrash(ctx, f.actor, item.ID))
+	assert.NoDirExists(t, filepath.Join(f.dir, filepath.FromSlash(filepath.Dir(item.TrashPath))))
+	assert.ErrorContains(t, f.ops.PurgeTrash(ctx, f.actor, item.ID), "not found")
+
+	purged, err := f.ops.EmptyTrash(ctx, f.actor)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.NoFileExists(t, filepath.Join(f.dir, "films", "a.mkv"))
+	assert.FileExists(t, filepath.Join(f.dir, "films", "extras", "b.mkv"))
+
+	assert.Equal(t, 3, f.audits(t, AuditEventFileTrashed))
+	assert.Equal(t, 1, f.audits(t, AuditEventFileRestored))
+	assert.Equal(t, 2, f.audits(t, AuditEventTrashPurged))
+}
+
+func TestScannerService_SkipsTrash(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "a.mkv", "aaaa")
+	f.write(t, TrashDirName+"/7/x/b.mkv", "bbbb")
+
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.True(t, f.cataloged(t, "a.mkv"))
+	assert.False(t, f.cataloged(t, TrashDirName))
+	assert.False(t, f.cataloged(t, TrashDirName+"/7/x/b.mkv"))
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Search engines, reported with every result page.
+const (
+	SearchEngineFTS5  = "fts5"
+	SearchEngineBasic = "basic"
+)
+
+// Highlight markers around matched words in snippets. The surrounding text
+// is not HTML-escaped.
+const (
+	searchMarkStart = "<mark>"
+	searchMarkEnd   = "</mark>"
+)
+
+// FileSearchOptions controls paging and ordering of a search.
+type FileSearchOptions struct {
+	Page  int
+	Limit int
+	// Sort overrides a sort: term in the query, e.g. "-size".
+	Sort           string
+	IncludeDeleted bool
+}
+
+// FileSearchHit is one file matching a search.
+type FileSearchHit struct {
+	FileID      int64     `json:"file_id"`
+	StorageRoot string    `json:"storage_root"`
+	Path        string    `json:"path"`
+	Name        string    `json:"name"`
+	Extension   string    `json:"extension,omitempty"`
+	FileType    string    `json:"file_type,omitempty"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Size        int64     `json:"size"`
+	IsDirectory bool      `json:"is_directory"`
+	ModifiedAt  time.Time `json:"modified_at"`
+	Title       string    `json:"title,omitempty"`
+	Year        *int      `json:"year,omitempty"`
+	Snippet     string    `json:"snippet,omitempty"`
+	Score       float64   `json:"score"`
+}
+
+// FileSearchResult is one page of search hits.
+type FileSearchResult struct {
+	Query      *SearchQuery    `json:"query"`
+	Hits       []FileSearchHit `json:"hits"`
+	Total      int64           `json:"total"`
+	Page       int             `json:"page"`
+	Limit      int             `json:"limit"`
+	TotalPages int             `json:"total_pages"`
+	Sort       string          `json:"sort"`
+	Descending bool            `json:"descending"`
+	Engine     string          `json:"engine"`
+}
+
+// FileSearchService runs full-text searches over the catalog. On SQLite
+// with the FTS5 module it uses the file_search index, ranking with BM25
+// weighted towards names and titles; otherwise it matches the
+// file_search_documents view with LIKE and builds snippets itself.
+type FileSearchService struct {
+	db     *database.DB
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	checked bool
+	fts     bool
+}
+
+// NewFileSearchService creates a new FileSearchService.
+func NewFileSearchService(db *database.DB, logger *zap.Logger) *FileSearchService {
+	return &FileSearchService{db: db, logger: logger}
+}
+
+// hasFTS reports whether the FTS5 index exists.
+func (s *FileSearchService) hasFTS(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checked {
+		return s.fts, nil
+	}
+	if !s.db.Dialect().IsPostgres() {
+		var n int
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'file_search'`).Scan(&n); err != nil {
+			return false, fmt.Errorf("failed to detect search index: %w", err)
+		}
+		s.fts = n > 0
+	}
+	s.checked = true
+	return s.fts, nil
+}
+
+// Engine returns the engine searches use, SearchEngineFTS5 or
+// SearchEngineBasic.
+func (s *FileSearchService) Engine(ctx context.Context) string {
+	if fts, err := s.hasFTS(ctx); err == nil && fts {
+		return SearchEngineFTS5
+	}
+	return SearchEngineBasic
+}
+
+// searchWords splits free text into lower-case words, dropping punctuation
+// so user input never reaches the match syntax.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchText returns the query's words and phrases (as word lists).
+func searchText(q *SearchQuery) (words []string, phrases [][]string) {
+	for _, term := range q.Terms {
+		words = append(words, searchWords(term)...)
+	}
+	for _, phrase := range q.Phrases {
+		if w := searchWords(phrase); len(w) > 0 {
+			phrases = append(phrases, w)
+		}
+	}
+	return words, phrases
+}
+
+// ftsMatchExpression builds an FTS5 query: every word as a prefix and
+// every phrase exactly, all required.
+func ftsMatchExpression(words []string, phrases [][]string) string {
+	var parts []string
+	for _, w := range words {
+		parts = append(parts, `"`+w+`"*`)
+	}
+	for _, p := range phrases {
+		parts = append(parts, `"`+strings.Join(p, " ")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// escapeLike escapes LIKE wildcards for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+const (
+	searchTitleExpr = `(SELECT mi.title FROM media_files mf JOIN media_items mi ON mi.id = mf.media_item_id
+		WHERE mf.file_id = f.id ORDER BY mf.is_primary DESC, mi.id LIMIT 1)`
+	searchYearExpr = `(SELECT mi.year FROM media_files mf JOIN media_items mi ON mi.id = mf.media_item_id
+		WHERE mf.file_id = f.id AND mi.year IS NOT NULL ORDER BY mf.is_primary DESC, mi.id LIMIT 1)`
+)
+
+// searchFilters returns the WHERE conditions for the query's filters.
+func searchFilters(q *SearchQuery, includeDeleted bool) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	placeholders := func(n int) string {
+		return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+	}
+
+	if !includeDeleted {
+		where = append(where, "(f.deleted = ? OR f.deleted IS NULL)")
+		args = append(args, false)
+	}
+	if len(q.Types) > 0 {
+		var types []interface{}
+		dirs := false
+		for _, t := range q.Types {
+			if t == "dir" || t == "directory" || t == "folder" {
+				dirs = true
+			} else {
+				types = append(types, t)
+			}
+		}
+		var anyOf []string
+		if dirs {
+			anyOf = append(anyOf, "f.is_directory = ?")
+			args = append(args, true)
+		}
+		if len(types) > 0 {
+			anyOf = append(anyOf, "f.file_type IN ("+placeholders(len(types))+")")
+			args = append(args, types...)
+		}
+		where = append(where, "("+strings.Join(anyOf, " OR ")+")")
+	}
+	if len(q.Extensions) > 0 {
+		where = append(where, "LOWER(f.extension) IN ("+placeholders(len(q.Extensions))+")")
+		for _, ext := range q.Extensions {
+			args = append(args, ext)
+		}
+	}
+	if len(q.Roots) > 0 {
+		where = append(where, "sr.name IN ("+placeholders(len(q.Roots))+")")
+		for _, root := range q.Roots {
+			args = append(args, root)
+		}
+	}
+	if q.PathPrefix != "" {
+		// Paths are stored with or without a leading slash depending on
+		// the scanner that added them
+		p := q.PathPrefix
+		where = append(where, `(f.path = ? OR f.path = ? OR f.path LIKE ? ESCAPE '\' OR f.path LIKE ? ESCAPE '\')`)
+		args = append(args, p, "/"+p, escapeLike(p)+"/%", "/"+escapeLike(p)+"/%")
+	}
+	if q.Size != nil {
+		if q.Size.Min != nil {
+			where = append(where, "f.size >= ?")
+			args = append(args, *q.Size.Min)
+		}
+		if q.Size.Max != nil {
+			where = append(where, "f.size <= ?")
+			args = append(args, *q.Size.Max)
+		}
+	}
+	if q.Year != nil {
+		cond := "EXISTS (SELECT 1 FROM media_files mf JOIN media_items mi ON mi.id = mf.media_item_id WHERE mf.file_id = f.id"
+		if q.Year.Min != nil {
+			cond += " AND mi.year >= ?"
+			args = append(args, *q.Year.Min)
+		}
+		if q.Year.Max != nil {
+			cond += " AND mi.year <= ?"
+			args = append(args, *q.Year.Max)
+		}
+		where = append(where, cond+")")
+	}
+	if q.Modified != nil {
+		if q.Modified.From != nil {
+			where = append(where, "f.modified_at >= ?")
+			args = append(args, *q.Modified.From)
+		}
+		if q.Modified.To != nil {
+			where = append(where, "f.modified_at <= ?")
+			args = append(args, *q.Modified.To)
+		}
+	}
+	return where, args
+}
+
+// searchOrder returns the ORDER BY clause.
+func searchOrder(sort string, desc bool) string {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	switch sort {
+	case SearchSortRelevance:
+		// Best match first unless reversed
+		if desc {
+			return " ORDER BY score ASC, f.id"
+		}
+		return " ORDER BY score DESC, LOWER(f.name), f.id"
+	case SearchSortSize:
+		return " ORDER BY f.size" + dir + ", f.id"
+	case SearchSortModified:
+		return " ORDER BY f.modified_at" + dir + ", f.id"
+	case SearchSortYear:
+		// Files without a year last in either direction
+		return " ORDER BY (" + searchYearExpr + ") IS NULL, " + searchYearExpr + dir + ", f.id"
+	case SearchSortPath:
+		return " ORDER BY sr.name" + dir + ", f.path" + dir + ", f.id"
+	default:
+		return " ORDER BY LOWER(f.name)" + dir + ", f.id"
+	}
+}
+
+// Search parses and runs a search query.
+func (s *FileSearchService) Search(ctx context.Context, input string, opts FileSearchOptions) (*FileSearchResult, error) {
+	// Decomposed input, as macOS clients send, matches NFC catalog names
+	q, err := ParseSearchQuery(norm.NFC.String(input))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Sort != "" {
+		if err := q.setSort(opts.Sort); err != nil {
+			return nil, fmt.Errorf("invalid search query: %w", err)
+		}
+	}
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 50
+	}
+	if opts.Limit > 200 {
+		opts.Limit = 200
+	}
+
+	words, phrases := searchText(q)
+	hasText := len(words) > 0 || len(phrases) > 0
+	sort := q.Sort
+	if sort == "" || (sort == SearchSortRelevance && !hasText) {
+		sort = SearchSortName
+		if hasText {
+			sort = SearchSortRelevance
+		}
+	}
+
+	useFTS, err := s.hasFTS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	engine := SearchEngineBasic
+	if useFTS {
+		engine = SearchEngineFTS5
+	}
+
+	from := " FROM files f JOIN storage_roots sr ON sr.id = f.storage_root_id"
+	where, args := searchFilters(q, opts.IncludeDeleted)
+	var textSelect string
+	var textArgs []interface{}
+	switch {
+	case hasText && useFTS:
+		from += " JOIN file_search ON file_search.rowid = f.id"
+		where = append([]string{"file_search MATCH ?"}, where...)
+		args = append([]interface{}{ftsMatchExpression(words, phrases)}, args...)
+		textSelect = `, snippet(file_search, -1, '` + searchMarkStart + `', '` + searchMarkEnd + `', '…', 16),
+			-bm25(file_search, 10.0, 1.0, 8.0, 2.0, 4.0) AS score`
+	case hasText:
+		from += " JOIN file_search_documents d ON d.file_id = f.id"
+		var score []string
+		for _, pattern := range basicSearchPatterns(words, phrases) {
+			where = append(where, `(LOWER(d.name) LIKE ? ESCAPE '\' OR LOWER(d.title) LIKE ? ESCAPE '\'
+				OR LOWER(d.tags) LIKE ? ESCAPE '\' OR LOWER(d.description) LIKE ? ESCAPE '\' OR LOWER(d.path) LIKE ? ESCAPE '\')`)
+			args = append(args, pattern, pattern, pattern, pattern, pattern)
+			score = append(score, `(CASE WHEN LOWER(d.name) LIKE ? ESCAPE '\' THEN 10 ELSE 0 END
+				+ CASE WHEN LOWER(d.title) LIKE ? ESCAPE '\' THEN 8 ELSE 0 END
+				+ CASE WHEN LOWER(d.tags) LIKE ? ESCAPE '\' THEN 4 ELSE 0 END
+				+ CASE WHEN LOWER(d.description) LIKE ? ESCAPE '\' THEN 2 ELSE 0 END
+				+ CASE WHEN LOWER(d.path) LIKE ? ESCAPE '\' THEN 1 ELSE 0 END)`)
+			textArgs = append(textArgs, pattern, pattern, pattern, pattern, pattern)
+		}
+		textSelect = `, d.title, d.name, d.description, d.tags, d.path, ` + strings.Join(score, " + ") + ` AS score`
+	default:
+		textSelect = `, 0 AS score`
+	}
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	result := &FileSearchResult{
+		Query:      q,
+		Hits:       []FileSearchHit{},
+		Page:       opts.Page,
+		Limit:      opts.Limit,
+		Sort:       sort,
+		Descending: q.Descending,
+		Engine:     engine,
+	}
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+from+whereClause, args...).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+	result.TotalPages = int((result.Total + int64(opts.Limit) - 1) / int64(opts.Limit))
+
+	query := `SELECT f.id, sr.name, f.path, f.name, COALESCE(f.extension, ''), COALESCE(f.file_type, ''),
+			COALESCE(f.mime_type, ''), f.size, f.is_directory, f.modified_at, ` + searchTitleExpr + `, ` + searchYearExpr +
+		textSelect + from + whereClause + searchOrder(sort, q.Descending) + ` LIMIT ? OFFSET ?`
+	queryArgs := append(append(append([]interface{}{}, textArgs...), args...), opts.Limit, (opts.Page-1)*opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run search: %w", err)
+	}
+	defer rows.Close()
+
+	highlightWords := append([]string{}, words...)
+	for _, p := range phrases {
+		highlightWords = append(highlightWords, p...)
+	}
+	for rows.Next() {
+		var hit FileSearchHit
+		var isDir sql.NullBool
+		var title sql.NullString
+		var year sql.NullInt64
+		dest := []interface{}{&hit.FileID, &hit.StorageRoot, &hit.Path, &hit.Name, &hit.Extension, &hit.FileType,
+			&hit.MimeType, &hit.Size, &isDir, &hit.ModifiedAt, &title, &year}
+		var snippet sql.NullString
+		var docs [5]sql.NullString
+		switch {
+		case hasText && useFTS:
+			dest = append(dest, &snippet)
+		case hasText:
+			dest = append(dest, &docs[0], &docs[1], &docs[2], &docs[3], &docs[4])
+		}
+		dest = append(dest, &hit.Score)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		hit.IsDirectory = isDir.Bool
+		hit.Title = title.String
+		if year.Valid {
+			y := int(year.Int64)
+			hit.Year = &y
+		}
+		hit.Snippet = snippet.String
+		if hasText && !useFTS {
+			for _, doc := range docs {
+				if text, ok := highlightSnippet(doc.String, highlightWords, 48); ok {
+					hit.Snippet = text
+					break
+				}
+			}
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, rows.Err()
+}
+
+// basicSearchPatterns returns a LIKE pattern per word and phrase.
+func basicSearchPatterns(words []string, phrases [][]string) []string {
+	var patterns []string
+	for _, w := range words {
+		patterns = append(patterns, "%"+escapeLike(w)+"%")
+	}
+	for _, p := range phrases {
+		patterns = append(patterns, "%"+escapeLike(strings.Join(p, " "))+"%")
+	}
+	return patterns
+}
+
+// highlightSnippet returns the part of text around the first matched word,
+// with every match marked, or false when nothing matches. context is the
+// number of characters kept before the first match.
+func highlightSnippet(text string, words []string, context int) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(lower); {
+		longest := 0
+		for _, w := range words {
+			wr := []rune(w)
+			if len(wr) > longest && i+len(wr) <= len(lower) && string(lower[i:i+len(wr)]) == w {
+				longest = len(wr)
+			}
+		}
+		if longest > 0 {
+			spans = append(spans, span{i, i + longest})
+			i += longest
+		} else {
+			i++
+		}
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+
+	start := spans[0].start - context
+	if start < 0 {
+		start = 0
+	}
+	end := spans[0].end + 2*context
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, sp := range spans {
+		if sp.start < start || sp.start >= end {
+			continue
+		}
+		stop := sp.end
+		if stop > end {
+			stop = end
+		}
+		b.WriteString(string(runes[pos:sp.start]))
+		b.WriteString(searchMarkStart + string(runes[sp.start:stop]) + searchMarkEnd)
+		pos = stop
+	}
+	b.WriteString(string(runes[pos:end]))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// RebuildIndex recreates the FTS5 index from the catalog, dropping entries
+// of files replaced outside the triggers. It returns the number of indexed
+// files, or zero when there is no FTS5 index to rebuild.
+func (s *FileSearchService) RebuildIndex(ctx context.Context) (int64, error) {
+	useFTS, err := s.hasFTS(ctx)
+	if err != nil || !useFTS {
+		return 0, err
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM file_search`); err != nil {
+		return 0, fmt.Errorf("failed to clear search index: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO file_search (rowid, name, path, title, description, tags)
+		SELECT file_id, name, path, title, description, tags FROM file_search_documents`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	s.logger.Info("Rebuilt file search index", zap.Int64("files", n))
+	return n, nil
+}
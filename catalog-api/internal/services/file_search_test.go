@@ -0,0 +1,167 @@
+package services
+
+import (
+	"catalogizer/config"
+	"catalogizer/database"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newFileSearchFixture migrates a fresh database and catalogs a few films.
+func newFileSearchFixture(t *testing.T) *database.DB {
+	t.Helper()
+
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "search.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	rootID, err := db.InsertReturningID(ctx, `INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'local', '/srv')`)
+	require.NoError(t, err)
+	typeID, err := db.InsertReturningID(ctx, `INSERT INTO media_types (name) VALUES ('search-test-film')`)
+	require.NoError(t, err)
+
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	addFile := func(path, name, ext, fileType string, size int64) int64 {
+		id, err := db.InsertReturningID(ctx,
+			`INSERT INTO files (storage_root_id, path, name, extension, file_type, size, modified_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rootID, path, name, ext, fileType, size, modified)
+		require.NoError(t, err)
+		return id
+	}
+	addItem := func(fileID int64, title string, year int, description, genre string) {
+		itemID, err := db.InsertReturningID(ctx,
+			`INSERT INTO media_items (media_type_id, title, year, description, genre) VALUES (?, ?, ?, ?, ?)`,
+			typeID, title, year, description, genre)
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, `INSERT INTO media_files (media_item_id, file_id, is_primary) VALUES (?, ?, 1)`, itemID, fileID)
+		require.NoError(t, err)
+	}
+
+	blade := addFile("films/Blade.Runner.1982.mkv", "Blade.Runner.1982.mkv", "mkv", "video", 8<<30)
+	addItem(blade, "Blade Runner", 1982, "A blade runner must pursue and terminate four replicants.", "Science Fiction")
+	alien := addFile("films/alien.mp4", "alien.mp4", "mp4", "video", 700<<20)
+	addItem(alien, "Alien", 1979, "The crew of a commercial spacecraft encounters a deadly lifeform.", "Horror")
+	arrival := addFile("films/new/arrival.mkv", "arrival.mkv", "mkv", "video", 3<<30)
+	addItem(arrival, "Arrival", 2016, "A linguist works to communicate with aliens.", "Science Fiction")
+	notes := addFile("notes/blade-runner-notes.txt", "blade-runner-notes.txt", "txt", "document", 2<<10)
+	_, err = db.ExecContext(ctx, `INSERT INTO file_metadata (file_id, key, value) VALUES (?, 'tags', 'essay replicants')`, notes)
+	require.NoError(t, err)
+	gone := addFile("films/blade-runner-2049.mkv", "blade-runner-2049.mkv", "mkv", "video", 9<<30)
+	_, err = db.ExecContext(ctx, `UPDATE files SET deleted = 1 WHERE id = ?`, gone)
+	require.NoError(t, err)
+	return db
+}
+
+func searchNames(r *FileSearchResult) []string {
+	names := []string{}
+	for _, hit := range r.Hits {
+		names = append(names, hit.Name)
+	}
+	return names
+}
+
+// searchEngines runs a test against the FTS5 index, when the SQLite build
+// has it, and against the LIKE fallback.
+func searchEngines(t *testing.T, run func(t *testing.T, svc *FileSearchService)) {
+	db := newFileSearchFixture(t)
+
+	t.Run("default", func(t *testing.T) {
+		run(t, NewFileSearchService(db, zap.NewNop()))
+	})
+	t.Run("basic", func(t *testing.T) {
+		svc := NewFileSearchService(db, zap.NewNop())
+		svc.checked, svc.fts = true, false
+		run(t, svc)
+	})
+}
+
+func TestFileSearchService_FreeText(t *testing.T) {
+	searchEngines(t, func(t *testing.T, svc *FileSearchService) {
+		ctx := context.Background()
+
+		r, err := svc.Search(ctx, "replicants", FileSearchOptions{})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Blade.Runner.1982.mkv", "blade-runner-notes.txt"}, searchNames(r))
+		assert.Equal(t, SearchSortRelevance, r.Sort)
+		for _, hit := range r.Hits {
+			assert.Contains(t, hit.Snippet, "<mark>")
+		}
+
+		// Names and titles outrank descriptions
+		r, err = svc.Search(ctx, "alien", FileSearchOptions{})
+		require.NoError(t, err)
+		require.Len(t, r.Hits, 2)
+		assert.Equal(t, "alien.mp4", r.Hits[0].Name)
+		assert.Equal(t, "Alien", r.Hits[0].Title)
+		require.NotNil(t, r.Hits[0].Year)
+		assert.Equal(t, 1979, *r.Hits[0].Year)
+
+		r, err = svc.Search(ctx, `"blade runner" type:video`, FileSearchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Blade.Runner.1982.mkv"}, searchNames(r))
+
+		r, err = svc.Search(ctx, `blade`, FileSearchOptions{IncludeDeleted: true})
+		require.NoError(t, err)
+		assert.Len(t, r.Hits, 3)
+	})
+}
+
+func TestFileSearchService_Filters(t *testing.T) {
+	searchEngines(t, func(t *testing.T, svc *FileSearchService) {
+		ctx := context.Background()
+		search := func(q string) []string {
+			r, err := svc.Search(ctx, q, FileSearchOptions{})
+			require.NoError(t, err, q)
+			return searchNames(r)
+		}
+
+		assert.Equal(t, []string{"alien.mp4", "arrival.mkv", "Blade.Runner.1982.mkv"}, search("type:video"))
+		assert.Equal(t, []string{"Blade.Runner.1982.mkv", "arrival.mkv"}, search("size:>1GB sort:-size"))
+		assert.Equal(t, []string{"alien.mp4", "Blade.Runner.1982.mkv"}, search("year:1975..1985"))
+		assert.Equal(t, []string{"arrival.mkv", "Blade.Runner.1982.mkv", "alien.mp4"}, search("type:video sort:-year"))
+		assert.Equal(t, []string{"arrival.mkv"}, search("path:films/new"))
+		assert.Equal(t, []string{"arrival.mkv", "Blade.Runner.1982.mkv"}, search("ext:mkv"))
+		assert.Equal(t, []string{"blade-runner-notes.txt"}, search("root:nas type:document modified:2024-03-01"))
+		assert.Empty(t, search("modified:<2024-03-01"))
+		assert.Equal(t, []string{"arrival.mkv"}, search("science size:<4GB"))
+	})
+}
+
+func TestFileSearchService_Pagination(t *testing.T) {
+	searchEngines(t, func(t *testing.T, svc *FileSearchService) {
+		r, err := svc.Search(context.Background(), "type:video", FileSearchOptions{Page: 2, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), r.Total)
+		assert.Equal(t, 2, r.TotalPages)
+		assert.Equal(t, []string{"Blade.Runner.1982.mkv"}, searchNames(r))
+
+		_, err = svc.Search(context.Background(), "size:huge", FileSearchOptions{})
+		assert.ErrorContains(t, err, "invalid search query")
+	})
+}
+
+func TestFileSearchService_IndexFollowsMetadata(t *testing.T) {
+	db := newFileSearchFixture(t)
+	svc := NewFileSearchService(db, zap.NewNop())
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, `UPDATE media_items SET description = 'A cult classic about a tyrell corporation' WHERE title = 'Alien'`)
+	require.NoError(t, err)
+	r, err := svc.Search(ctx, "tyrell", FileSearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alien.mp4"}, searchNames(r))
+
+	_, err = svc.RebuildIndex(ctx)
+	require.NoError(t, err)
+	r, err = svc.Search(ctx, "tyrell", FileSearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alien.mp4"}, searchNames(r))
+}
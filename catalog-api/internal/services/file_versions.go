@@ -0,0 +1,494 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Origins recorded for preserved file versions.
+const (
+	VersionOriginUpload  = "upload"
+	VersionOriginSync    = "sync"
+	VersionOriginRestore = "restore"
+)
+
+// FileVersion is a preserved copy of a file taken just before it was overwritten.
+type FileVersion struct {
+	ID            int64     `json:"id"`
+	StorageRoot   string    `json:"storage_root"`
+	Path          string    `json:"path"`
+	FileID        *int64    `json:"file_id,omitempty"`
+	VersionNumber int       `json:"version_number"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256,omitempty"`
+	Origin        string    `json:"origin"`
+	CreatedBy     *int      `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	storedPath string
+	localPath  string
+}
+
+// VersionRetentionPolicy controls how many previous versions a share keeps.
+// MaxVersions of zero disables capturing new versions for the share (existing
+// ones are still subject to MaxAgeDays); MaxAgeDays of zero keeps versions
+// regardless of age.
+type VersionRetentionPolicy struct {
+	StorageRoot string    `json:"storage_root"`
+	MaxVersions int       `json:"max_versions"`
+	MaxAgeDays  int       `json:"max_age_days"`
+	IsDefault   bool      `json:"is_default"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// FileVersionConfig configures the versions area and the fallback retention
+// applied to shares without an explicit policy.
+type FileVersionConfig struct {
+	Dir                string
+	DefaultMaxVersions int
+	DefaultMaxAgeDays  int
+}
+
+// remoteFileStore moves files between a remote share and local disk.
+// SMBServiceInterface satisfies it.
+type remoteFileStore interface {
+	DownloadFile(hostName, remotePath, localPath string) error
+	UploadFile(hostName, localPath, remotePath string) error
+}
+
+// FileVersionService preserves previous versions of files overwritten by
+// uploads or sync, applies per-share retention and restores old versions.
+type FileVersionService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config FileVersionConfig
+	remote remoteFileStore
+	now    func() time.Time
+}
+
+// NewFileVersionService creates a FileVersionService storing versions under cfg.Dir.
+func NewFileVersionService(db *database.DB, logger *zap.Logger, cfg FileVersionConfig) *FileVersionService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(".", "data", "versions")
+	}
+	return &FileVersionService{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+// SetRemoteStore sets the store used to capture and restore versions of
+// files that live on remote shares.
+func (s *FileVersionService) SetRemoteStore(store remoteFileStore) {
+	s.remote = store
+}
+
+// GetPolicy returns the retention policy for a share, falling back to the
+// configured default when none has been set.
+func (s *FileVersionService) GetPolicy(ctx context.Context, storageRoot string) (*VersionRetentionPolicy, error) {
+	policy := &VersionRetentionPolicy{StorageRoot: storageRoot}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT max_versions, max_age_days, updated_at FROM file_version_policies WHERE storage_root = ?`,
+		storageRoot).Scan(&policy.MaxVersions, &policy.MaxAgeDays, &policy.UpdatedAt)
+	if err == sql.ErrNoRows {
+		policy.MaxVersions = s.config.DefaultMaxVersions
+		policy.MaxAgeDays = s.config.DefaultMaxAgeDays
+		policy.IsDefault = true
+		return policy, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load version policy: %w", err)
+	}
+	return policy, nil
+}
+
+// SetPolicy stores the retention policy for a share and prunes versions that
+// no longer fit it.
+func (s *FileVersionService) SetPolicy(ctx context.Context, policy VersionRetentionPolicy) error {
+	if policy.StorageRoot == "" {
+		return fmt.Errorf("storage root is required")
+	}
+	if policy.MaxVersions < 0 || policy.MaxAgeDays < 0 {
+		return fmt.Errorf("invalid policy: limits must not be negative")
+	}
+
+	now := s.now()
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE file_version_policies SET max_versions = ?, max_age_days = ?, updated_at = ?
+		 WHERE storage_root = ?`,
+		policy.MaxVersions, policy.MaxAgeDays, now, policy.StorageRoot)
+	if err != nil {
+		return fmt.Errorf("failed to save version policy: %w", err)
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO file_version_policies (storage_root, max_versions, max_age_days, updated_at)
+			 VALUES (?, ?, ?, ?)`,
+			policy.StorageRoot, policy.MaxVersions, policy.MaxAgeDays, now); err != nil {
+			return fmt.Errorf("failed to save version policy: %w", err)
+		}
+	}
+
+	return s.pruneShare(ctx, &policy)
+}
+
+// CaptureLocal preserves the current content of a file on local disk before
+// it is overwritten. It returns nil without error when versioning is disabled
+// for the share or the file does not exist yet.
+func (s *FileVersionService) CaptureLocal(ctx context.Context, storageRoot, path, absPath, origin string, userID *int) (*FileVersion, error) {
+	info, err := os.Stat(absPath)
+	if err != nil || info.IsDir() {
+		return nil, nil
+	}
+
+	return s.capture(ctx, storageRoot, path, absPath, origin, userID, func(dst io.Writer) error {
+		src, err := os.Open(absPath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+}
+
+// CaptureRemote preserves the current content of a file on a remote share
+// before it is overwritten.
+func (s *FileVersionService) CaptureRemote(ctx context.Context, storageRoot, path, origin string, userID *int) (*FileVersion, error) {
+	if s.remote == nil {
+		return nil, fmt.Errorf("remote file store not configured")
+	}
+
+	return s.capture(ctx, storageRoot, path, "", origin, userID, func(dst io.Writer) error {
+		if err := os.MkdirAll(s.config.Dir, 0755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(s.config.Dir, ".fetch-*")
+		if err != nil {
+			return err
+		}
+		tmpName := tmp.Name()
+		tmp.Close()
+		defer os.Remove(tmpName)
+
+		if err := s.remote.DownloadFile(storageRoot, path, tmpName); err != nil {
+			return err
+		}
+		src, err := os.Open(tmpName)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+}
+
+func (s *FileVersionService) capture(ctx context.Context, storageRoot, path, localPath, origin string, userID *int, copyTo func(io.Writer) error) (*FileVersion, error) {
+	policy, err := s.GetPolicy(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaxVersions <= 0 {
+		return nil, nil
+	}
+
+	var next int
+	err = s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version_number), 0) + 1 FROM file_versions WHERE storage_root = ? AND path = ?`,
+		storageRoot, path).Scan(&next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine version number: %w", err)
+	}
+
+	key := sha256.Sum256([]byte(storageRoot + "\x00" + path))
+	keyHex := hex.EncodeToString(key[:])
+	dir := filepath.Join(s.config.Dir, keyHex[:2], keyHex)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create versions directory: %w", err)
+	}
+	storedPath := filepath.Join(dir, fmt.Sprintf("v%d-%d", next, s.now().UnixNano()))
+
+	out, err := os.Create(storedPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create version file: %w", err)
+	}
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	if err := copyTo(io.MultiWriter(out, hasher, counter)); err != nil {
+		out.Close()
+		os.Remove(storedPath)
+		return nil, fmt.Errorf("failed to copy previous version: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(storedPath)
+		return nil, fmt.Errorf("failed to write version file: %w", err)
+	}
+
+	version := &FileVersion{
+		StorageRoot:   storageRoot,
+		Path:          path,
+		FileID:        s.lookupFileID(ctx, storageRoot, path),
+		VersionNumber: next,
+		Size:          counter.n,
+		SHA256:        hex.EncodeToString(hasher.Sum(nil)),
+		Origin:        origin,
+		CreatedBy:     userID,
+		CreatedAt:     s.now(),
+		storedPath:    storedPath,
+		localPath:     localPath,
+	}
+
+	var local interface{}
+	if localPath != "" {
+		local = localPath
+	}
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO file_versions (storage_root, path, file_id, version_number, size, sha256, stored_path, origin, local_path, created_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		version.StorageRoot, version.Path, version.FileID, version.VersionNumber, version.Size,
+		version.SHA256, version.storedPath, version.Origin, local, version.CreatedBy, version.CreatedAt)
+	if err != nil {
+		os.Remove(storedPath)
+		return nil, fmt.Errorf("failed to record file version: %w", err)
+	}
+	version.ID = id
+
+	s.logger.Debug("Preserved previous file version",
+		zap.String("storage_root", storageRoot),
+		zap.String("path", path),
+		zap.Int("version", next),
+		zap.String("origin", origin))
+
+	if err := s.pruneShare(ctx, policy); err != nil {
+		s.logger.Warn("Failed to apply version retention", zap.String("storage_root", storageRoot), zap.Error(err))
+	}
+	return version, nil
+}
+
+// lookupFileID finds the catalog entry for a share path, tolerating paths
+// stored with or without a leading slash.
+func (s *FileVersionService) lookupFileID(ctx context.Context, storageRoot, path string) *int64 {
+	trimmed := strings.TrimPrefix(path, "/")
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT f.id FROM files f
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE sr.name = ? AND f.path IN (?, ?)`,
+		storageRoot, trimmed, "/"+trimmed).Scan(&id)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// ListVersions returns the preserved versions of a catalogued file, newest first.
+func (s *FileVersionService) ListVersions(ctx context.Context, fileID int64) ([]FileVersion, error) {
+	var storageRoot, path string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sr.name, f.path FROM files f
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE f.id = ?`, fileID).Scan(&storageRoot, &path)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up file: %w", err)
+	}
+
+	trimmed := strings.TrimPrefix(path, "/")
+	return s.queryVersions(ctx, `file_id = ? OR (storage_root = ? AND path IN (?, ?))`,
+		fileID, storageRoot, trimmed, "/"+trimmed)
+}
+
+// ListPathVersions returns the preserved versions of a path on a share,
+// newest first. Unlike ListVersions it finds versions of files that are not
+// catalogued, such as those kept by sync under their endpoint's name.
+func (s *FileVersionService) ListPathVersions(ctx context.Context, storageRoot, path string) ([]FileVersion, error) {
+	trimmed := strings.TrimPrefix(path, "/")
+	return s.queryVersions(ctx, `storage_root = ? AND path IN (?, ?)`, storageRoot, trimmed, "/"+trimmed)
+}
+
+// queryVersions returns the versions matching where, newest first.
+func (s *FileVersionService) queryVersions(ctx context.Context, where string, args ...interface{}) ([]FileVersion, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, storage_root, path, file_id, version_number, size, sha256, stored_path, origin, local_path, created_by, created_at
+		 FROM file_versions
+		 WHERE `+where+`
+		 ORDER BY created_at DESC, version_number DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []FileVersion
+	for rows.Next() {
+		v, err := scanFileVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+type fileVersionScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFileVersion(row fileVersionScanner) (*FileVersion, error) {
+	var v FileVersion
+	var fileID sql.NullInt64
+	var sum, localPath sql.NullString
+	var createdBy sql.NullInt64
+	if err := row.Scan(&v.ID, &v.StorageRoot, &v.Path, &fileID, &v.VersionNumber, &v.Size,
+		&sum, &v.storedPath, &v.Origin, &localPath, &createdBy, &v.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan file version: %w", err)
+	}
+	if fileID.Valid {
+		v.FileID = &fileID.Int64
+	}
+	if createdBy.Valid {
+		uid := int(createdBy.Int64)
+		v.CreatedBy = &uid
+	}
+	v.SHA256 = sum.String
+	v.localPath = localPath.String
+	return &v, nil
+}
+
+// RestoreVersion writes a preserved version back over the live file. The
+// content being replaced is itself preserved first, so a restore can be undone.
+func (s *FileVersionService) RestoreVersion(ctx context.Context, fileID, versionID int64, userID int) (*FileVersion, error) {
+	versions, err := s.ListVersions(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	var version *FileVersion
+	for i := range versions {
+		if versions[i].ID == versionID {
+			version = &versions[i]
+			break
+		}
+	}
+	if version == nil {
+		return nil, fmt.Errorf("version not found")
+	}
+	return s.restore(ctx, version, userID)
+}
+
+// RestoreShareVersion writes a preserved version of a file on the share back
+// over the live file, like RestoreVersion, for versions found through
+// ListPathVersions.
+func (s *FileVersionService) RestoreShareVersion(ctx context.Context, storageRoot string, versionID int64, userID int) (*FileVersion, error) {
+	versions, err := s.queryVersions(ctx, `id = ? AND storage_root = ?`, versionID, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("version not found")
+	}
+	return s.restore(ctx, &versions[0], userID)
+}
+
+// restore writes version back over the live file after preserving it.
+func (s *FileVersionService) restore(ctx context.Context, version *FileVersion, userID int) (*FileVersion, error) {
+	info, err := os.Stat(version.storedPath)
+	if err != nil {
+		return nil, fmt.Errorf("version content missing: %w", err)
+	}
+
+	if version.localPath != "" {
+		if _, err := s.CaptureLocal(ctx, version.StorageRoot, version.Path, version.localPath, VersionOriginRestore, &userID); err != nil {
+			s.logger.Warn("Failed to preserve current version before restore", zap.Error(err))
+		}
+		if err := restoreFile(version.storedPath, version.localPath, info); err != nil {
+			return nil, fmt.Errorf("failed to restore version: %w", err)
+		}
+	} else {
+		if s.remote == nil {
+			return nil, fmt.Errorf("remote file store not configured")
+		}
+		if _, err := s.CaptureRemote(ctx, version.StorageRoot, version.Path, VersionOriginRestore, &userID); err != nil {
+			s.logger.Warn("Failed to preserve current version before restore", zap.Error(err))
+		}
+		if err := s.remote.UploadFile(version.StorageRoot, version.storedPath, version.Path); err != nil {
+			return nil, fmt.Errorf("failed to restore version: %w", err)
+		}
+	}
+
+	s.logger.Info("Restored file version",
+		zap.String("storage_root", version.StorageRoot),
+		zap.String("path", version.Path),
+		zap.Int("version", version.VersionNumber),
+		zap.Int("user_id", userID))
+	return version, nil
+}
+
+// pruneShare deletes versions of every file on the share that exceed the
+// policy's count or age limits.
+func (s *FileVersionService) pruneShare(ctx context.Context, policy *VersionRetentionPolicy) error {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, storage_root, path, file_id, version_number, size, sha256, stored_path, origin, local_path, created_by, created_at
+		 FROM file_versions WHERE storage_root = ?
+		 ORDER BY path, version_number DESC`, policy.StorageRoot)
+	if err != nil {
+		return fmt.Errorf("failed to load versions for pruning: %w", err)
+	}
+
+	var expired []*FileVersion
+	cutoff := time.Time{}
+	if policy.MaxAgeDays > 0 {
+		cutoff = s.now().AddDate(0, 0, -policy.MaxAgeDays)
+	}
+	seen := make(map[string]int)
+	for rows.Next() {
+		v, err := scanFileVersion(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		seen[v.Path]++
+		if (policy.MaxVersions > 0 && seen[v.Path] > policy.MaxVersions) || (!cutoff.IsZero() && v.CreatedAt.Before(cutoff)) {
+			expired = append(expired, v)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, v := range expired {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM file_versions WHERE id = ?`, v.ID); err != nil {
+			return fmt.Errorf("failed to delete expired version: %w", err)
+		}
+		if err := os.Remove(v.storedPath); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn("Failed to remove expired version file", zap.String("path", v.storedPath), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+type countingWriter struct{ n int64 }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
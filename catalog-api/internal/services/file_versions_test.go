@@ -0,0 +1,190 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupFileVersionTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL
+		);
+		CREATE TABLE file_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			file_id INTEGER,
+			version_number INTEGER NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			sha256 TEXT,
+			stored_path TEXT NOT NULL,
+			origin TEXT NOT NULL,
+			local_path TEXT,
+			created_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE file_version_policies (
+			storage_root TEXT PRIMARY KEY,
+			max_versions INTEGER NOT NULL DEFAULT 0,
+			max_age_days INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO storage_roots (name) VALUES ('nas');
+		INSERT INTO files (storage_root_id, path) VALUES (1, '/docs/report.txt');`)
+	require.NoError(t, err)
+
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+// fakeRemoteStore keeps "remote" files in memory keyed by host:path.
+type fakeRemoteStore struct {
+	files map[string][]byte
+}
+
+func (f *fakeRemoteStore) DownloadFile(host, remotePath, localPath string) error {
+	return os.WriteFile(localPath, f.files[host+":"+remotePath], 0644)
+}
+
+func (f *fakeRemoteStore) UploadFile(host, localPath, remotePath string) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	f.files[host+":"+remotePath] = data
+	return nil
+}
+
+func TestFileVersionService_DisabledByDefault(t *testing.T) {
+	db := setupFileVersionTestDB(t)
+	svc := NewFileVersionService(db, zap.NewNop(), FileVersionConfig{Dir: t.TempDir()})
+
+	live := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(live, []byte("v1"), 0644))
+
+	v, err := svc.CaptureLocal(context.Background(), "nas", "a.txt", live, VersionOriginSync, nil)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	policy, err := svc.GetPolicy(context.Background(), "nas")
+	require.NoError(t, err)
+	assert.True(t, policy.IsDefault)
+	assert.Equal(t, 0, policy.MaxVersions)
+}
+
+func TestFileVersionService_CaptureListRestoreRemote(t *testing.T) {
+	db := setupFileVersionTestDB(t)
+	svc := NewFileVersionService(db, zap.NewNop(), FileVersionConfig{Dir: t.TempDir(), DefaultMaxVersions: 5})
+	remote := &fakeRemoteStore{files: map[string][]byte{"nas:docs/report.txt": []byte("first draft")}}
+	svc.SetRemoteStore(remote)
+	ctx := context.Background()
+
+	uid := 3
+	v, err := svc.CaptureRemote(ctx, "nas", "docs/report.txt", VersionOriginUpload, &uid)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, 1, v.VersionNumber)
+	assert.Equal(t, int64(len("first draft")), v.Size)
+	require.NotNil(t, v.FileID)
+	assert.Equal(t, int64(1), *v.FileID)
+
+	// The upload overwrites the file
+	remote.files["nas:docs/report.txt"] = []byte("final")
+
+	versions, err := svc.ListVersions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, VersionOriginUpload, versions[0].Origin)
+
+	restored, err := svc.RestoreVersion(ctx, 1, versions[0].ID, uid)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored.VersionNumber)
+	assert.Equal(t, "first draft", string(remote.files["nas:docs/report.txt"]))
+
+	// The overwritten content was preserved as a new version
+	versions, err = svc.ListVersions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	_, err = svc.RestoreVersion(ctx, 1, 999, uid)
+	assert.ErrorContains(t, err, "version not found")
+
+	_, err = svc.ListVersions(ctx, 42)
+	assert.ErrorContains(t, err, "file not found")
+}
+
+func TestFileVersionService_RetentionPolicy(t *testing.T) {
+	db := setupFileVersionTestDB(t)
+	dir := t.TempDir()
+	svc := NewFileVersionService(db, zap.NewNop(), FileVersionConfig{Dir: dir})
+	ctx := context.Background()
+
+	require.NoError(t, svc.SetPolicy(ctx, VersionRetentionPolicy{StorageRoot: "sync:1", MaxVersions: 2}))
+	assert.Error(t, svc.SetPolicy(ctx, VersionRetentionPolicy{StorageRoot: "sync:1", MaxVersions: -1}))
+
+	live := filepath.Join(t.TempDir(), "notes.txt")
+	for _, content := range []string{"one", "two", "three"} {
+		require.NoError(t, os.WriteFile(live, []byte(content), 0644))
+		_, err := svc.CaptureLocal(ctx, "sync:1", "notes.txt", live, VersionOriginSync, nil)
+		require.NoError(t, err)
+	}
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM file_versions`).Scan(&count))
+	assert.Equal(t, 2, count)
+
+	var oldest int
+	require.NoError(t, db.QueryRow(`SELECT MIN(version_number) FROM file_versions`).Scan(&oldest))
+	assert.Equal(t, 2, oldest)
+
+	// Age-based pruning
+	svc.now = func() time.Time { return time.Now().AddDate(0, 0, 10) }
+	require.NoError(t, svc.SetPolicy(ctx, VersionRetentionPolicy{StorageRoot: "sync:1", MaxVersions: 2, MaxAgeDays: 7}))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM file_versions`).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestFileVersionService_RestoreLocal(t *testing.T) {
+	db := setupFileVersionTestDB(t)
+	svc := NewFileVersionService(db, zap.NewNop(), FileVersionConfig{Dir: t.TempDir(), DefaultMaxVersions: 3})
+	ctx := context.Background()
+
+	live := filepath.Join(t.TempDir(), "report.txt")
+	require.NoError(t, os.WriteFile(live, []byte("original"), 0644))
+	_, err := svc.CaptureLocal(ctx, "nas", "/docs/report.txt", live, VersionOriginSync, nil)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(live, []byte("overwritten"), 0644))
+
+	versions, err := svc.ListVersions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+
+	_, err = svc.RestoreVersion(ctx, 1, versions[0].ID, 1)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(live)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// hashCheckpointInterval is how much of a file a content hash reads
+// between saving its progress, bounding the work an interruption loses.
+var hashCheckpointInterval int64 = 64 << 20
+
+// hashPrioritySize is the size up to which files are hashed before larger
+// ones. Within each group the most recently modified go first, so new
+// additions are checked for duplicates soon after they appear.
+const hashPrioritySize = 64 << 20
+
+// hashRateBurst is the most a rate limited hash reads at once.
+const hashRateBurst = 1 << 20
+
+// hashCheckpoint is the state of a content hash part way through a file.
+type hashCheckpoint struct {
+	bytesHashed int64
+	state       []byte
+}
+
+// resumableContentHash returns the SHA-256 of a whole file like
+// ContentHash, continuing from a checkpoint when one is given and
+// passing a new one to save every hashCheckpointInterval bytes. The
+// skipped part is sought past when the provider's stream can seek and
+// read without hashing when it cannot.
+func resumableContentHash(ctx context.Context, provider StorageProvider, file string, from *hashCheckpoint,
+	save func(hashCheckpoint) error) (string, error) {
+	rc, err := provider.Open(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	var offset int64
+	if from != nil && h.(encoding.BinaryUnmarshaler).UnmarshalBinary(from.state) == nil {
+		offset = from.bytesHashed
+	} else {
+		h.Reset()
+	}
+
+	r := &contextReader{ctx: ctx, r: rc}
+	if offset > 0 {
+		if seeker, ok := rc.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, r, offset)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to resume hash at byte %d: %w", offset, err)
+		}
+	}
+
+	for {
+		n, err := io.CopyN(h, r, hashCheckpointInterval)
+		offset += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err == nil {
+			err = save(hashCheckpoint{bytesHashed: offset, state: state})
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to save hash checkpoint: %w", err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadHashCheckpoint returns the saved progress of a file's content hash,
+// or nil when there is none.
+func (s *ScannerService) loadHashCheckpoint(ctx context.Context, fileID int64) (*hashCheckpoint, error) {
+	var cp hashCheckpoint
+	err := s.db.QueryRowContext(ctx,
+		`SELECT bytes_hashed, state FROM hash_checkpoints WHERE file_id = ?`, fileID).Scan(&cp.bytesHashed, &cp.state)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (s *ScannerService) saveHashCheckpoint(ctx context.Context, fileID int64, cp hashCheckpoint) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE hash_checkpoints SET bytes_hashed = ?, state = ?, updated_at = ? WHERE file_id = ?`,
+		cp.bytesHashed, cp.state, s.now(), fileID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO hash_checkpoints (file_id, bytes_hashed, state, updated_at) VALUES (?, ?, ?, ?)`,
+		fileID, cp.bytesHashed, cp.state, s.now())
+	return err
+}
+
+// HashRateLimit caps how fast scans of one storage root read file
+// content to hash it.
+type HashRateLimit struct {
+	StorageRootID  int64     `json:"storage_root_id"`
+	StorageRoot    string    `json:"storage_root"`
+	BytesPerSecond int64     `json:"bytes_per_second"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// newHashLimiter returns the limiter a job hashes under; zero means no
+// limit.
+func newHashLimiter(bytesPerSecond int64) *rate.Limiter {
+	limiter := rate.NewLimiter(rate.Inf, hashRateBurst)
+	if bytesPerSecond > 0 {
+		limiter.SetLimit(rate.Limit(bytesPerSecond))
+	}
+	return limiter
+}
+
+// SetHashRateLimit caps the bytes per second that scans of a storage root
+// read to hash content. A scan of the root in progress slows down or
+// speeds up at once.
+func (s *ScannerService) SetHashRateLimit(ctx context.Context, storageRootID, bytesPerSecond int64) (*HashRateLimit, error) {
+	if bytesPerSecond <= 0 {
+		return nil, fmt.Errorf("invalid hash rate limit: bytes_per_second must be positive")
+	}
+	if _, err := s.loadScanRoot(ctx, storageRootID); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE hash_rate_limits SET bytes_per_second = ?, updated_at = ? WHERE storage_root_id = ?`,
+		bytesPerSecond, s.now(), storageRootID)
+	if err == nil {
+		if n, _ := res.RowsAffected(); n == 0 {
+			_, err = s.db.ExecContext(ctx,
+				`INSERT INTO hash_rate_limits (storage_root_id, bytes_per_second, updated_at) VALUES (?, ?, ?)`,
+				storageRootID, bytesPerSecond, s.now())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save hash rate limit: %w", err)
+	}
+	s.applyHashRateLimit(storageRootID, bytesPerSecond)
+	return s.GetHashRateLimit(ctx, storageRootID)
+}
+
+// applyHashRateLimit retunes the limiter of a running scan of a root.
+func (s *ScannerService) applyHashRateLimit(storageRootID, bytesPerSecond int64) {
+	limit := rate.Inf
+	if bytesPerSecond > 0 {
+		limit = rate.Limit(bytesPerSecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.progress.StorageRootID == storageRootID {
+			job.hashLimiter.SetLimit(limit)
+		}
+	}
+}
+
+const hashRateLimitColumns = `hl.storage_root_id, sr.name, hl.bytes_per_second, hl.updated_at`
+
+func scanHashRateLimit(row shareLinkScanner) (*HashRateLimit, error) {
+	var limit HashRateLimit
+	if err := row.Scan(&limit.StorageRootID, &limit.StorageRoot, &limit.BytesPerSecond, &limit.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// GetHashRateLimit returns the hash rate limit of a storage root.
+func (s *ScannerService) GetHashRateLimit(ctx context.Context, storageRootID int64) (*HashRateLimit, error) {
+	limit, err := scanHashRateLimit(s.db.QueryRowContext(ctx,
+		`SELECT `+hashRateLimitColumns+` FROM hash_rate_limits hl JOIN storage_roots sr ON sr.id = hl.storage_root_id
+		 WHERE hl.storage_root_id = ?`, storageRootID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("hash rate limit for storage root %d not found", storageRootID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hash rate limit: %w", err)
+	}
+	return limit, nil
+}
+
+// ListHashRateLimits returns every hash rate limit.
+func (s *ScannerService) ListHashRateLimits(ctx context.Context) ([]HashRateLimit, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+hashRateLimitColumns+` FROM hash_rate_limits hl JOIN storage_roots sr ON sr.id = hl.storage_root_id
+		 ORDER BY sr.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hash rate limits: %w", err)
+	}
+	defer rows.Close()
+
+	var limits []HashRateLimit
+	for rows.Next() {
+		limit, err := scanHashRateLimit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan hash rate limit: %w", err)
+		}
+		limits = append(limits, *limit)
+	}
+	return limits, rows.Err()
+}
+
+// DeleteHashRateLimit lets scans of a storage root hash at full speed.
+func (s *ScannerService) DeleteHashRateLimit(ctx context.Context, storageRootID int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM hash_rate_limits WHERE storage_root_id = ?`, storageRootID)
+	if err != nil {
+		return fmt.Errorf("failed to delete hash rate limit: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("hash rate limit for storage root %d not found", storageRootID)
+	}
+	s.applyHashRateLimit(storageRootID, 0)
+	return nil
+}
+
+// loadHashRateLimit returns the bytes per second a root may be hashed at,
+// zero when it is not limited.
+func (s *ScannerService) loadHashRateLimit(ctx context.Context, storageRootID int64) (int64, error) {
+	var bytesPerSecond int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT bytes_per_second FROM hash_rate_limits WHERE storage_root_id = ?`, storageRootID).Scan(&bytesPerSecond)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return bytesPerSecond, err
+}
+
+// throttledProvider reads file content no faster than its limiter allows.
+type throttledProvider struct {
+	StorageProvider
+	limiter *rate.Limiter
+}
+
+func (p *throttledProvider) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := p.StorageProvider.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	r := &throttledReader{ctx: ctx, rc: rc, limiter: p.limiter}
+	if seeker, ok := rc.(io.Seeker); ok {
+		return &throttledReadSeeker{throttledReader: r, seeker: seeker}, nil
+	}
+	return r, nil
+}
+
+// throttledReader waits after each read until the limiter has allowed
+// the bytes it returned.
+type throttledReader struct {
+	ctx     context.Context
+	rc      io.ReadCloser
+	limiter *rate.Limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > hashRateBurst {
+		p = p[:hashRateBurst]
+	}
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.rc.Close()
+}
+
+// throttledReadSeeker keeps a seekable stream seekable, so sampled quick
+// hashes and resumed content hashes skip what they do not read.
+type throttledReadSeeker struct {
+	*throttledReader
+	seeker io.Seeker
+}
+
+func (r *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.seeker.Seek(offset, whence)
+}
+
+// hashRateLimited reports whether the job's root has a hash rate limit.
+func (j *scanJob) hashRateLimited() bool {
+	return j.hashLimiter.Limit() != rate.Inf
+}
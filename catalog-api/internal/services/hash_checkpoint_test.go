@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestResumableContentHash_ResumesFromCheckpoint(t *testing.T) {
+	saved := hashCheckpointInterval
+	hashCheckpointInterval = 1024
+	t.Cleanup(func() { hashCheckpointInterval = saved })
+
+	dir := t.TempDir()
+	provider := NewLocalStorageProvider(connectedLocalClient(t, dir), dir)
+	content := make([]byte, 5*1024+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), content, 0644))
+	want, err := ContentHash(context.Background(), provider, "big.bin")
+	require.NoError(t, err)
+
+	// Interrupted after two checkpoints
+	interrupted := errors.New("interrupted")
+	var checkpoints []hashCheckpoint
+	_, err = resumableContentHash(context.Background(), provider, "big.bin", nil, func(cp hashCheckpoint) error {
+		checkpoints = append(checkpoints, cp)
+		if len(checkpoints) == 2 {
+			return interrupted
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, interrupted)
+	assert.Equal(t, int64(2048), checkpoints[1].bytesHashed)
+
+	var resumed []hashCheckpoint
+	got, err := resumableContentHash(context.Background(), provider, "big.bin", &checkpoints[1], func(cp hashCheckpoint) error {
+		resumed = append(resumed, cp)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	require.NotEmpty(t, resumed)
+	assert.Equal(t, int64(3072), resumed[0].bytesHashed)
+
+	// An unreadable checkpoint starts over
+	got, err = resumableContentHash(context.Background(), provider, "big.bin",
+		&hashCheckpoint{bytesHashed: 2048, state: []byte("garbage")}, func(hashCheckpoint) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestScannerService_ResumesCheckpointedHash(t *testing.T) {
+	saved := hashCheckpointInterval
+	hashCheckpointInterval = 4
+	t.Cleanup(func() { hashCheckpointInterval = saved })
+
+	f := newScannerFixture(t)
+	ctx := context.Background()
+	f.write(t, "a.mkv", "same content")
+	f.write(t, "b.mkv", "same content")
+	f.scan(t)
+	_, want := f.hashes(t, "a.mkv")
+	require.True(t, want.Valid)
+	assert.Zero(t, f.checkpoints(t), "finished hashes drop their checkpoints")
+
+	// A checkpoint taken over other first bytes shows the hash resumed
+	// from it rather than starting over
+	provider := NewLocalStorageProvider(connectedLocalClient(t, f.dir), f.dir)
+	f.write(t, "other.mkv", "SAME content")
+	var cp hashCheckpoint
+	_, err := resumableContentHash(ctx, provider, "other.mkv", nil, func(c hashCheckpoint) error {
+		cp = c
+		return errors.New("interrupted")
+	})
+	require.Error(t, err)
+	a := f.file(t, "a.mkv")
+	require.NoError(t, f.svc.saveHashCheckpoint(ctx, a.id, cp))
+	_, err = f.db.ExecContext(ctx, `UPDATE files SET sha256 = NULL WHERE id = ?`, a.id)
+	require.NoError(t, err)
+
+	f.scan(t)
+	_, resumed := f.hashes(t, "a.mkv")
+	require.True(t, resumed.Valid)
+	assert.NotEqual(t, want, resumed)
+	assert.Zero(t, f.checkpoints(t))
+
+	// A changed file drops its checkpoint
+	require.NoError(t, f.svc.saveHashCheckpoint(ctx, a.id, cp))
+	f.write(t, "a.mkv", "edited content")
+	f.scan(t)
+	assert.Zero(t, f.checkpoints(t))
+}
+
+func (f *scannerFixture) checkpoints(t *testing.T) int {
+	t.Helper()
+	var n int
+	require.NoError(t, f.db.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM hash_checkpoints`).Scan(&n))
+	return n
+}
+
+func TestScannerService_HashRateLimits(t *testing.T) {
+	f := newScannerFixture(t)
+	ctx := context.Background()
+
+	_, err := f.svc.SetHashRateLimit(ctx, f.rootID, 0)
+	assert.ErrorContains(t, err, "invalid hash rate limit")
+	_, err = f.svc.SetHashRateLimit(ctx, 999, 1024)
+	assert.ErrorContains(t, err, "not found")
+
+	limit, err := f.svc.SetHashRateLimit(ctx, f.rootID, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "media", limit.StorageRoot)
+	assert.Equal(t, int64(1024), limit.BytesPerSecond)
+	limit, err = f.svc.SetHashRateLimit(ctx, f.rootID, 4<<20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4<<20), limit.BytesPerSecond)
+
+	limits, err := f.svc.ListHashRateLimits(ctx)
+	require.NoError(t, err)
+	require.Len(t, limits, 1)
+
+	// Scans of the root hash under the limit
+	f.write(t, "a.mkv", "same content")
+	f.write(t, "b.mkv", "same content")
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	_, sha := f.hashes(t, "a.mkv")
+	assert.True(t, sha.Valid)
+
+	require.NoError(t, f.svc.DeleteHashRateLimit(ctx, f.rootID))
+	assert.ErrorContains(t, f.svc.DeleteHashRateLimit(ctx, f.rootID), "not found")
+	_, err = f.svc.GetHashRateLimit(ctx, f.rootID)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestThrottledProvider_PacesReads(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "f.bin"), make([]byte, 3000), 0644))
+	limiter := rate.NewLimiter(rate.Limit(10000), hashRateBurst)
+	limiter.AllowN(time.Now(), hashRateBurst)
+	provider := &throttledProvider{
+		StorageProvider: NewLocalStorageProvider(connectedLocalClient(t, dir), dir),
+		limiter:         limiter,
+	}
+
+	rc, err := provider.Open(context.Background(), "f.bin")
+	require.NoError(t, err)
+	defer rc.Close()
+	_, seekable := rc.(io.Seeker)
+	assert.True(t, seekable)
+
+	start := time.Now()
+	_, err = io.Copy(io.Discard, rc)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+}
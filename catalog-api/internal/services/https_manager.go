@@ -0,0 +1,506 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogizer/models"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// HTTPS defaults applied by NewHTTPSManager.
+const (
+	defaultHTTPSPort        = 443
+	defaultHTTPRedirectPort = 80
+	defaultACMECacheDir     = "cache/acme"
+	defaultACMERenewBefore  = 30 * 24 * time.Hour
+	defaultDNSPropagation   = time.Minute
+	acmeRenewalCheck        = time.Hour
+)
+
+// HTTPSManager terminates TLS for the API with a certificate from a file
+// pair or issued and renewed through ACME. HTTP-01 (and TLS-ALPN-01)
+// issuance is handled on demand by autocert; DNS-01 issuance runs in the
+// background and publishes the TXT record through an external hook.
+type HTTPSManager struct {
+	config models.HTTPSConfig
+	logger *zap.Logger
+
+	autocert *autocert.Manager
+	dns      *dnsCertManager
+	static   *tls.Certificate
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewHTTPSManager validates an HTTPS configuration, filling in defaults,
+// and loads its certificate source. Without ACME or a certificate file
+// pair the fallback certificate is served.
+func NewHTTPSManager(config *models.HTTPSConfig, fallback *tls.Certificate, logger *zap.Logger) (*HTTPSManager, error) {
+	if config == nil {
+		return nil, errors.New("https configuration is required")
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	m := &HTTPSManager{config: *config, logger: logger}
+	if m.config.Port <= 0 {
+		m.config.Port = defaultHTTPSPort
+	}
+	if m.config.RedirectPort <= 0 {
+		m.config.RedirectPort = defaultHTTPRedirectPort
+	}
+
+	acmeConfig := config.ACME
+	if acmeConfig == nil || !acmeConfig.Enabled {
+		if (config.CertPath == "") != (config.KeyPath == "") {
+			return nil, errors.New("cert_path and key_path must be set together")
+		}
+		if config.CertPath == "" {
+			if fallback == nil {
+				return nil, errors.New("https requires a certificate or acme")
+			}
+			m.static = fallback
+			return m, nil
+		}
+		cert, err := tls.LoadX509KeyPair(config.CertPath, config.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load https certificate: %w", err)
+		}
+		m.static = &cert
+		return m, nil
+	}
+
+	if len(acmeConfig.Domains) == 0 {
+		return nil, errors.New("acme requires at least one domain")
+	}
+	cacheDir := acmeConfig.CacheDir
+	if cacheDir == "" {
+		cacheDir = defaultACMECacheDir
+	}
+	renewBefore := defaultACMERenewBefore
+	if acmeConfig.RenewBeforeDays > 0 {
+		renewBefore = time.Duration(acmeConfig.RenewBeforeDays) * 24 * time.Hour
+	}
+	directoryURL := acmeConfig.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = acme.LetsEncryptURL
+	}
+
+	switch acmeConfig.Challenge {
+	case "", models.ACMEChallengeHTTP01:
+		for _, domain := range acmeConfig.Domains {
+			if strings.HasPrefix(domain, "*.") {
+				return nil, fmt.Errorf("wildcard domain %s requires the dns-01 challenge", domain)
+			}
+		}
+		m.autocert = &autocert.Manager{
+			Prompt:      autocert.AcceptTOS,
+			Cache:       autocert.DirCache(cacheDir),
+			HostPolicy:  autocert.HostWhitelist(acmeConfig.Domains...),
+			RenewBefore: renewBefore,
+			Email:       acmeConfig.Email,
+			Client:      &acme.Client{DirectoryURL: directoryURL},
+		}
+	case models.ACMEChallengeDNS01:
+		if acmeConfig.DNSHook == "" {
+			return nil, errors.New("the dns-01 challenge requires dns_hook")
+		}
+		propagation := defaultDNSPropagation
+		if acmeConfig.DNSPropagationSeconds > 0 {
+			propagation = time.Duration(acmeConfig.DNSPropagationSeconds) * time.Second
+		}
+		m.dns = &dnsCertManager{
+			domains:     acmeConfig.Domains,
+			email:       acmeConfig.Email,
+			hook:        acmeConfig.DNSHook,
+			propagation: propagation,
+			cacheDir:    cacheDir,
+			renewBefore: renewBefore,
+			directory:   directoryURL,
+			logger:      logger,
+			now:         time.Now,
+		}
+		if err := m.dns.load(); err != nil {
+			logger.Info("No cached ACME certificate, one will be issued", zap.Error(err))
+		}
+	default:
+		return nil, fmt.Errorf("unknown acme challenge: %s", acmeConfig.Challenge)
+	}
+	return m, nil
+}
+
+// Config returns the configuration with defaults applied.
+func (m *HTTPSManager) Config() models.HTTPSConfig {
+	return m.config
+}
+
+// TLSConfig returns the server TLS configuration. Certificates are looked
+// up per handshake so renewals take effect without a restart.
+func (m *HTTPSManager) TLSConfig() *tls.Config {
+	var tlsConfig *tls.Config
+	switch {
+	case m.autocert != nil:
+		// Includes the acme-tls/1 protocol for TLS-ALPN-01 challenges
+		tlsConfig = m.autocert.TLSConfig()
+	case m.dns != nil:
+		tlsConfig = &tls.Config{GetCertificate: m.dns.getCertificate}
+	default:
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{*m.static}}
+	}
+	tlsConfig.MinVersion = tls.VersionTLS12
+	tlsConfig.NextProtos = []string{"h3", "h2", "http/1.1"}
+	if m.autocert != nil {
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+	}
+	return tlsConfig
+}
+
+// RedirectHandler serves the plain HTTP listener: it answers ACME HTTP-01
+// challenges and permanently redirects everything else to HTTPS.
+func (m *HTTPSManager) RedirectHandler() http.Handler {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if m.config.Port != defaultHTTPSPort {
+			host = net.JoinHostPort(host, strconv.Itoa(m.config.Port))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+	if m.autocert != nil {
+		return m.autocert.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// Start issues a missing DNS-01 certificate and renews it before it
+// expires. File and HTTP-01 certificates need no background work.
+func (m *HTTPSManager) Start() {
+	if m.dns == nil || m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stop
+			cancel()
+		}()
+
+		ticker := time.NewTicker(acmeRenewalCheck)
+		defer ticker.Stop()
+		for {
+			if m.dns.needsRenewal() {
+				if err := m.dns.obtain(ctx); err != nil && ctx.Err() == nil {
+					m.logger.Error("Failed to obtain ACME certificate", zap.Strings("domains", m.dns.domains), zap.Error(err))
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends background renewal and waits for an issuance in progress to
+// be abandoned.
+func (m *HTTPSManager) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.stop = nil
+	m.wg.Wait()
+}
+
+// ListenDualStack listens on host:port. An empty or wildcard host gets
+// separate IPv4 and IPv6 listeners, so both families are served even
+// where IPv6 sockets do not accept IPv4 traffic; the IPv6 listener is
+// skipped on hosts without IPv6.
+func ListenDualStack(host string, port int) ([]net.Listener, error) {
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+
+	v4, err := net.Listen("tcp4", net.JoinHostPort("0.0.0.0", strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	// Port 0 picks a free port; serve IPv6 on the same one
+	port = v4.Addr().(*net.TCPAddr).Port
+	v6, err := net.Listen("tcp6", net.JoinHostPort("::", strconv.Itoa(port)))
+	if err != nil {
+		return []net.Listener{v4}, nil
+	}
+	return []net.Listener{v4, v6}, nil
+}
+
+// dnsCertManager issues and renews a certificate through the ACME DNS-01
+// challenge. The certificate and account key are cached in cacheDir.
+type dnsCertManager struct {
+	domains     []string
+	email       string
+	hook        string
+	propagation time.Duration
+	cacheDir    string
+	renewBefore time.Duration
+	directory   string
+	logger      *zap.Logger
+	now         func() time.Time
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (d *dnsCertManager) certPath() string {
+	return filepath.Join(d.cacheDir, "dns01_"+strings.ReplaceAll(d.domains[0], "*", "_")+".pem")
+}
+
+func (d *dnsCertManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.cert == nil {
+		return nil, errors.New("acme certificate has not been issued yet")
+	}
+	return d.cert, nil
+}
+
+// load reads the cached certificate.
+func (d *dnsCertManager) load() error {
+	data, err := os.ReadFile(d.certPath())
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	d.cert = &cert
+	d.mu.Unlock()
+	return nil
+}
+
+// needsRenewal reports whether the certificate is missing, about to
+// expire or does not cover every configured domain.
+func (d *dnsCertManager) needsRenewal() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.cert == nil || d.cert.Leaf == nil {
+		return true
+	}
+	if d.now().Add(d.renewBefore).After(d.cert.Leaf.NotAfter) {
+		return true
+	}
+	covered := make(map[string]bool, len(d.cert.Leaf.DNSNames))
+	for _, name := range d.cert.Leaf.DNSNames {
+		covered[name] = true
+	}
+	for _, domain := range d.domains {
+		if !covered[domain] {
+			return true
+		}
+	}
+	return false
+}
+
+// obtain runs an ACME order for the domains and stores the certificate.
+func (d *dnsCertManager) obtain(ctx context.Context) error {
+	accountKey, err := d.accountKey()
+	if err != nil {
+		return err
+	}
+	client := &acme.Client{Key: accountKey, DirectoryURL: d.directory}
+	account := &acme.Account{}
+	if d.email != "" {
+		account.Contact = []string{"mailto:" + d.email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("failed to register acme account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(d.domains...))
+	if err != nil {
+		return fmt.Errorf("failed to create acme order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := d.authorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("acme order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: d.domains}, key)
+	if err != nil {
+		return err
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize acme order: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return err
+	}
+
+	if err := d.save(der, key); err != nil {
+		d.logger.Warn("Failed to cache ACME certificate", zap.Error(err))
+	}
+	d.mu.Lock()
+	d.cert = &tls.Certificate{Certificate: der, PrivateKey: key, Leaf: leaf}
+	d.mu.Unlock()
+	d.logger.Info("Obtained ACME certificate", zap.Strings("domains", d.domains), zap.Time("not_after", leaf.NotAfter))
+	return nil
+}
+
+// authorize completes the DNS-01 challenge of one authorization.
+func (d *dnsCertManager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get acme authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == models.ACMEChallengeDNS01 {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("acme server offered no dns-01 challenge for %s", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+	fqdn := "_acme-challenge." + authz.Identifier.Value
+	if err := d.runHook(ctx, "present", fqdn, value); err != nil {
+		return err
+	}
+	defer func() {
+		if err := d.runHook(context.Background(), "cleanup", fqdn, value); err != nil {
+			d.logger.Warn("Failed to remove ACME challenge record", zap.String("fqdn", fqdn), zap.Error(err))
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d.propagation):
+	}
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept dns-01 challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("dns-01 authorization for %s failed: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// runHook runs the DNS hook as `hook action fqdn value`.
+func (d *dnsCertManager) runHook(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, d.hook, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dns hook %s failed: %w: %s", action, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// accountKey loads the ACME account key, creating it on first use.
+func (d *dnsCertManager) accountKey() (crypto.Signer, error) {
+	path := filepath.Join(d.cacheDir, "dns01_account.key")
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid acme account key in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(d.cacheDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// save caches the private key and certificate chain in one PEM file.
+func (d *dnsCertManager) save(chain [][]byte, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}); err != nil {
+		return err
+	}
+	for _, cert := range chain {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert}); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(d.cacheDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(d.certPath(), buf.Bytes(), 0600)
+}
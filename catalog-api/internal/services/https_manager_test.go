@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewHTTPSManager_Validation(t *testing.T) {
+	fallback := &tls.Certificate{}
+	tests := []struct {
+		name    string
+		config  *models.HTTPSConfig
+		wantErr string
+	}{
+		{"nil", nil, "https configuration is required"},
+		{"fallback", &models.HTTPSConfig{Enabled: true}, ""},
+		{"half a pair", &models.HTTPSConfig{Enabled: true, CertPath: "/tls/cert.pem"}, "cert_path and key_path must be set together"},
+		{"missing files", &models.HTTPSConfig{Enabled: true, CertPath: "/nonexistent/cert.pem", KeyPath: "/nonexistent/key.pem"}, "failed to load https certificate"},
+		{"no domains", &models.HTTPSConfig{ACME: &models.ACMEConfig{Enabled: true}}, "acme requires at least one domain"},
+		{"http-01", &models.HTTPSConfig{ACME: &models.ACMEConfig{Enabled: true, Domains: []string{"media.example.com"}}}, ""},
+		{"http-01 wildcard", &models.HTTPSConfig{ACME: &models.ACMEConfig{Enabled: true, Domains: []string{"*.example.com"}}}, "requires the dns-01 challenge"},
+		{"dns-01 without hook", &models.HTTPSConfig{ACME: &models.ACMEConfig{Enabled: true, Domains: []string{"*.example.com"}, Challenge: "dns-01"}}, "requires dns_hook"},
+		{"unknown challenge", &models.HTTPSConfig{ACME: &models.ACMEConfig{Enabled: true, Domains: []string{"example.com"}, Challenge: "tls-sni-01"}}, "unknown acme challenge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.config != nil && tt.config.ACME != nil {
+				tt.config.ACME.CacheDir = t.TempDir()
+			}
+			m, err := NewHTTPSManager(tt.config, fallback, zap.NewNop())
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 443, m.Config().Port)
+			assert.Equal(t, 80, m.Config().RedirectPort)
+			assert.NotNil(t, m.TLSConfig())
+		})
+	}
+}
+
+func TestHTTPSManager_RedirectHandler(t *testing.T) {
+	for port, want := range map[int]string{
+		443:  "https://media.example.com/api/v1/health?full=1",
+		8443: "https://media.example.com:8443/api/v1/health?full=1",
+	} {
+		m, err := NewHTTPSManager(&models.HTTPSConfig{Enabled: true, Port: port}, &tls.Certificate{}, nil)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		m.RedirectHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://media.example.com:80/api/v1/health?full=1", nil))
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, want, w.Header().Get("Location"))
+	}
+}
+
+func TestListenDualStack(t *testing.T) {
+	listeners, err := ListenDualStack("127.0.0.1", 0)
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	listeners[0].Close()
+
+	listeners, err = ListenDualStack("", 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, listeners)
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+func testCertificateChain(t *testing.T, notAfter time.Time, names ...string) ([][]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     names,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return [][]byte{der}, key
+}
+
+func TestDNSCertManager_CacheAndRenewal(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	d := &dnsCertManager{
+		domains:     []string{"example.com", "*.example.com"},
+		cacheDir:    t.TempDir(),
+		renewBefore: 30 * 24 * time.Hour,
+		logger:      zap.NewNop(),
+		now:         func() time.Time { return now },
+	}
+	assert.True(t, d.needsRenewal())
+	_, err := d.getCertificate(nil)
+	assert.Error(t, err)
+
+	chain, key := testCertificateChain(t, now.Add(60*24*time.Hour), "example.com", "*.example.com")
+	require.NoError(t, d.save(chain, key))
+	require.NoError(t, d.load())
+	cert, err := d.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, chain[0], cert.Certificate[0])
+	assert.False(t, d.needsRenewal())
+
+	// Renewal is due within renewBefore of expiry
+	now = now.Add(31 * 24 * time.Hour)
+	assert.True(t, d.needsRenewal())
+
+	// A certificate missing a configured domain is replaced
+	now = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	d.domains = append(d.domains, "media.example.org")
+	assert.True(t, d.needsRenewal())
+}
+
+func TestDNSCertManager_RunHook(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "calls")
+	hook := filepath.Join(dir, "hook.sh")
+	require.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n"), 0755))
+
+	d := &dnsCertManager{hook: hook}
+	require.NoError(t, d.runHook(context.Background(), "present", "_acme-challenge.example.com", "token"))
+	require.NoError(t, d.runHook(context.Background(), "cleanup", "_acme-challenge.example.com", "token"))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "present _acme-challenge.example.com token\ncleanup _acme-challenge.example.com token\n", string(data))
+
+	d.hook = filepath.Join(dir, "missing.sh")
+	assert.Error(t, d.runHook(context.Background(), "present", "_acme-challenge.example.com", "token"))
+}
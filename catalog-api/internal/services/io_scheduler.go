@@ -0,0 +1,373 @@
+package services
+
+import (
+	"catalogizer/filesystem"
+	"catalogizer/internal/metrics"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// IOPriority is the lane a storage operation is scheduled in. Lower
+// values are served first.
+type IOPriority int
+
+const (
+	// IOPriorityInteractive is for requests a user is waiting on:
+	// browsing, streaming and downloads.
+	IOPriorityInteractive IOPriority = iota
+	// IOPriorityTransfer is for copies, uploads and replication.
+	IOPriorityTransfer
+	// IOPriorityBackground is for scans, hashing and other maintenance.
+	IOPriorityBackground
+
+	ioLanes = 3
+)
+
+var ioPriorityNames = [ioLanes]string{"interactive", "transfer", "background"}
+
+func (p IOPriority) String() string {
+	if p < 0 || p >= ioLanes {
+		return "unknown"
+	}
+	return ioPriorityNames[p]
+}
+
+type ioPriorityKey struct{}
+
+// WithIOPriority schedules the storage operations made with ctx in the
+// given lane.
+func WithIOPriority(ctx context.Context, priority IOPriority) context.Context {
+	return context.WithValue(ctx, ioPriorityKey{}, priority)
+}
+
+// IOPriorityFrom returns the lane of the operations made with ctx.
+// Operations with no lane set are interactive.
+func IOPriorityFrom(ctx context.Context) IOPriority {
+	if priority, ok := ctx.Value(ioPriorityKey{}).(IOPriority); ok && priority >= 0 && priority < ioLanes {
+		return priority
+	}
+	return IOPriorityInteractive
+}
+
+// IOSchedulerConfig configures how storage operations of each root are
+// scheduled.
+type IOSchedulerConfig struct {
+	// Slots is how many operations run against one storage root at once.
+	// Defaults to 8.
+	Slots int
+	// LatencyTarget is the average interactive operation time, queueing
+	// included, above which transfers and background work are throttled.
+	// Defaults to 200ms.
+	LatencyTarget time.Duration
+	// AdjustInterval is how often lane limits are adjusted. Defaults to
+	// one second.
+	AdjustInterval time.Duration
+}
+
+func (c IOSchedulerConfig) withDefaults() IOSchedulerConfig {
+	if c.Slots <= 0 {
+		c.Slots = 8
+	}
+	if c.LatencyTarget <= 0 {
+		c.LatencyTarget = 200 * time.Millisecond
+	}
+	if c.AdjustInterval <= 0 {
+		c.AdjustInterval = time.Second
+	}
+	return c
+}
+
+// ioScheduler orders the operations against one storage root. A free
+// slot goes to the highest lane with a waiter. Transfers and background
+// work always leave one slot to interactive requests, and each has a
+// limit of its own: while interactive operations take longer than the
+// target, background work is halved and transfers cut by one slot every
+// adjustment, and both grow back a slot at a time once they are fast
+// again. Neither lane is ever stopped entirely.
+type ioScheduler struct {
+	root   string
+	config IOSchedulerConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	running [ioLanes]int
+	limit   [ioLanes]int
+	waiting [ioLanes][]chan struct{}
+	// latency is a moving average of interactive operation time
+	latency    time.Duration
+	samples    int
+	lastAdjust time.Time
+}
+
+func newIOScheduler(root string, config IOSchedulerConfig) *ioScheduler {
+	s := &ioScheduler{root: root, config: config.withDefaults(), now: time.Now}
+	s.limit = [ioLanes]int{s.config.Slots, s.sharedSlots(), s.sharedSlots()}
+	s.lastAdjust = s.now()
+	return s
+}
+
+// sharedSlots is how many slots transfers and background work may hold
+// together.
+func (s *ioScheduler) sharedSlots() int {
+	if s.config.Slots > 1 {
+		return s.config.Slots - 1
+	}
+	return 1
+}
+
+func (s *ioScheduler) grantableLocked(lane IOPriority) bool {
+	total := s.running[IOPriorityInteractive] + s.running[IOPriorityTransfer] + s.running[IOPriorityBackground]
+	if total >= s.config.Slots || s.running[lane] >= s.limit[lane] {
+		return false
+	}
+	if lane != IOPriorityInteractive && s.running[IOPriorityTransfer]+s.running[IOPriorityBackground] >= s.sharedSlots() {
+		return false
+	}
+	return true
+}
+
+// acquire waits for a slot in a lane.
+func (s *ioScheduler) acquire(ctx context.Context, lane IOPriority) error {
+	s.mu.Lock()
+	if len(s.waiting[lane]) == 0 && s.grantableLocked(lane) {
+		s.running[lane]++
+		s.mu.Unlock()
+		return nil
+	}
+	granted := make(chan struct{}, 1)
+	s.waiting[lane] = append(s.waiting[lane], granted)
+	s.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, ch := range s.waiting[lane] {
+		if ch == granted {
+			s.waiting[lane] = append(s.waiting[lane][:i], s.waiting[lane][i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// The slot was granted as the context ended; pass it on
+	s.running[lane]--
+	s.dispatchLocked()
+	return ctx.Err()
+}
+
+// release returns a slot taken at started, recording how long an
+// interactive operation took.
+func (s *ioScheduler) release(lane IOPriority, started time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[lane]--
+	now := s.now()
+	if lane == IOPriorityInteractive {
+		elapsed := now.Sub(started)
+		if s.samples == 0 && s.latency == 0 {
+			s.latency = elapsed
+		} else {
+			s.latency += (elapsed - s.latency) / 5
+		}
+		s.samples++
+	}
+	if now.Sub(s.lastAdjust) >= s.config.AdjustInterval {
+		s.adjustLocked(now)
+	}
+	s.dispatchLocked()
+}
+
+func (s *ioScheduler) dispatchLocked() {
+	for lane := IOPriorityInteractive; lane < ioLanes; lane++ {
+		for len(s.waiting[lane]) > 0 && s.grantableLocked(lane) {
+			s.running[lane]++
+			s.waiting[lane][0] <- struct{}{}
+			s.waiting[lane] = s.waiting[lane][1:]
+		}
+	}
+}
+
+// adjustLocked throttles transfers and background work while interactive
+// operations are slow, and lets them recover otherwise.
+func (s *ioScheduler) adjustLocked(now time.Time) {
+	s.lastAdjust = now
+	if s.samples > 0 && s.latency > s.config.LatencyTarget {
+		s.limit[IOPriorityBackground] = max(1, s.limit[IOPriorityBackground]/2)
+		s.limit[IOPriorityTransfer] = max(1, s.limit[IOPriorityTransfer]-1)
+	} else {
+		s.limit[IOPriorityBackground] = min(s.sharedSlots(), s.limit[IOPriorityBackground]+1)
+		s.limit[IOPriorityTransfer] = min(s.sharedSlots(), s.limit[IOPriorityTransfer]+1)
+	}
+	s.samples = 0
+
+	metrics.SetStorageIOLatency(s.root, s.latency)
+	for lane := IOPriorityInteractive; lane < ioLanes; lane++ {
+		metrics.UpdateStorageIOLane(s.root, lane.String(), len(s.waiting[lane]), s.limit[lane])
+	}
+}
+
+// scheduledProvider runs a provider's operations through its root's
+// scheduler, in the lane of their context. Reads and writes take a slot
+// per chunk, so long streams give way to other work between chunks.
+// Watch is not scheduled.
+type scheduledProvider struct {
+	StorageProvider
+	scheduler *ioScheduler
+}
+
+func (p *scheduledProvider) do(ctx context.Context, op func() error) error {
+	lane := IOPriorityFrom(ctx)
+	started := p.scheduler.now()
+	if err := p.scheduler.acquire(ctx, lane); err != nil {
+		return err
+	}
+	defer p.scheduler.release(lane, started)
+	return op()
+}
+
+func (p *scheduledProvider) List(ctx context.Context, dir string) (entries []*filesystem.FileInfo, err error) {
+	err = p.do(ctx, func() error {
+		entries, err = p.StorageProvider.List(ctx, dir)
+		return err
+	})
+	return entries, err
+}
+
+func (p *scheduledProvider) Stat(ctx context.Context, file string) (info *filesystem.FileInfo, err error) {
+	err = p.do(ctx, func() error {
+		info, err = p.StorageProvider.Stat(ctx, file)
+		return err
+	})
+	return info, err
+}
+
+func (p *scheduledProvider) Identify(ctx context.Context, file string) (identity FileIdentity, err error) {
+	err = p.do(ctx, func() error {
+		identity, err = identifyFile(ctx, p.StorageProvider, file)
+		return err
+	})
+	return identity, err
+}
+
+func (p *scheduledProvider) Rename(ctx context.Context, srcPath, dstPath string) error {
+	return p.do(ctx, func() error {
+		return renameFile(ctx, p.StorageProvider, srcPath, dstPath)
+	})
+}
+
+func (p *scheduledProvider) RemoveAll(ctx context.Context, file string) error {
+	return p.do(ctx, func() error {
+		return removeTree(ctx, p.StorageProvider, file)
+	})
+}
+
+func (p *scheduledProvider) Exists(ctx context.Context, file string) (exists bool, err error) {
+	err = p.do(ctx, func() error {
+		exists, err = p.StorageProvider.Exists(ctx, file)
+		return err
+	})
+	return exists, err
+}
+
+func (p *scheduledProvider) Copy(ctx context.Context, srcPath, dstPath string) error {
+	return p.do(ctx, func() error {
+		return p.StorageProvider.Copy(ctx, srcPath, dstPath)
+	})
+}
+
+func (p *scheduledProvider) Delete(ctx context.Context, file string) error {
+	return p.do(ctx, func() error {
+		return p.StorageProvider.Delete(ctx, file)
+	})
+}
+
+func (p *scheduledProvider) Open(ctx context.Context, file string) (rc io.ReadCloser, err error) {
+	err = p.do(ctx, func() error {
+		rc, err = p.StorageProvider.Open(ctx, file)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &scheduledReader{ctx: ctx, lane: IOPriorityFrom(ctx), rc: rc, scheduler: p.scheduler}
+	if seeker, ok := rc.(io.Seeker); ok {
+		return &scheduledReadSeeker{scheduledReader: r, seeker: seeker}, nil
+	}
+	return r, nil
+}
+
+// Write paces the provider by the data it is given. The provider writes
+// each chunk between two reads, so a slot is held from the end of one
+// read to the start of the next. None is held while reading the data,
+// so copies between two roots never wait on one while holding the other.
+func (p *scheduledProvider) Write(ctx context.Context, file string, data io.Reader) error {
+	source := &scheduledWriteSource{ctx: ctx, lane: IOPriorityFrom(ctx), r: data, scheduler: p.scheduler}
+	defer source.releaseHeld()
+	return p.StorageProvider.Write(ctx, file, source)
+}
+
+// scheduledReader takes a slot for each read of a stream.
+type scheduledReader struct {
+	ctx       context.Context
+	lane      IOPriority
+	rc        io.ReadCloser
+	scheduler *ioScheduler
+}
+
+func (r *scheduledReader) Read(p []byte) (int, error) {
+	started := r.scheduler.now()
+	if err := r.scheduler.acquire(r.ctx, r.lane); err != nil {
+		return 0, err
+	}
+	defer r.scheduler.release(r.lane, started)
+	return r.rc.Read(p)
+}
+
+func (r *scheduledReader) Close() error {
+	return r.rc.Close()
+}
+
+// scheduledReadSeeker keeps a seekable stream seekable.
+type scheduledReadSeeker struct {
+	*scheduledReader
+	seeker io.Seeker
+}
+
+func (r *scheduledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.seeker.Seek(offset, whence)
+}
+
+type scheduledWriteSource struct {
+	ctx       context.Context
+	lane      IOPriority
+	r         io.Reader
+	scheduler *ioScheduler
+
+	held    bool
+	started time.Time
+}
+
+func (s *scheduledWriteSource) Read(p []byte) (int, error) {
+	s.releaseHeld()
+	n, err := s.r.Read(p)
+	if n > 0 {
+		started := s.scheduler.now()
+		if aerr := s.scheduler.acquire(s.ctx, s.lane); aerr != nil {
+			return n, aerr
+		}
+		s.held, s.started = true, started
+	}
+	return n, err
+}
+
+func (s *scheduledWriteSource) releaseHeld() {
+	if s.held {
+		s.held = false
+		s.scheduler.release(s.lane, s.started)
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// acquireAsync queues for a slot and reports on the returned channel
+// once it is granted.
+func acquireAsync(t *testing.T, s *ioScheduler, ctx context.Context, lane IOPriority) <-chan error {
+	t.Helper()
+	waiters := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.waiting[lane])
+	}
+	before := waiters()
+	done := make(chan error, 1)
+	go func() { done <- s.acquire(ctx, lane) }()
+	require.Eventually(t, func() bool {
+		return waiters() > before
+	}, time.Second, time.Millisecond)
+	return done
+}
+
+func requireGranted(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("slot was not granted")
+	}
+}
+
+func requireWaiting(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("slot was granted early: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestIOScheduler_ServesHigherLanesFirst(t *testing.T) {
+	s := newIOScheduler("media", IOSchedulerConfig{Slots: 2})
+	ctx := context.Background()
+
+	// Background work takes the one shared slot, an interactive request
+	// the reserved one
+	require.NoError(t, s.acquire(ctx, IOPriorityBackground))
+	require.NoError(t, s.acquire(ctx, IOPriorityInteractive))
+
+	background := acquireAsync(t, s, ctx, IOPriorityBackground)
+	transfer := acquireAsync(t, s, ctx, IOPriorityTransfer)
+	interactive := acquireAsync(t, s, ctx, IOPriorityInteractive)
+
+	s.release(IOPriorityInteractive, s.now())
+	requireGranted(t, interactive)
+	requireWaiting(t, transfer)
+
+	// The shared slot goes to the transfer before the background work
+	s.release(IOPriorityBackground, s.now())
+	requireGranted(t, transfer)
+	requireWaiting(t, background)
+
+	s.release(IOPriorityTransfer, s.now())
+	requireGranted(t, background)
+}
+
+func TestIOScheduler_KeepsASlotForInteractiveRequests(t *testing.T) {
+	s := newIOScheduler("media", IOSchedulerConfig{Slots: 3})
+	ctx := context.Background()
+
+	require.NoError(t, s.acquire(ctx, IOPriorityTransfer))
+	require.NoError(t, s.acquire(ctx, IOPriorityBackground))
+	blocked := acquireAsync(t, s, ctx, IOPriorityTransfer)
+	requireWaiting(t, blocked)
+
+	require.NoError(t, s.acquire(ctx, IOPriorityInteractive))
+
+	// Cancelled waiters leave the queue
+	cancelled, cancel := context.WithCancel(ctx)
+	waiter := acquireAsync(t, s, cancelled, IOPriorityBackground)
+	cancel()
+	assert.ErrorIs(t, <-waiter, context.Canceled)
+
+	s.release(IOPriorityBackground, s.now())
+	requireGranted(t, blocked)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Empty(t, s.waiting[IOPriorityBackground])
+	assert.Equal(t, [ioLanes]int{1, 2, 0}, s.running)
+}
+
+func TestIOScheduler_ThrottlesBackgroundWhileInteractiveIsSlow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := newIOScheduler("media", IOSchedulerConfig{Slots: 9, LatencyTarget: 100 * time.Millisecond, AdjustInterval: time.Second})
+	s.now = func() time.Time { return now }
+	s.lastAdjust = now
+	ctx := context.Background()
+
+	interactive := func(took time.Duration) {
+		require.NoError(t, s.acquire(ctx, IOPriorityInteractive))
+		started := now
+		now = now.Add(took)
+		s.release(IOPriorityInteractive, started)
+	}
+	adjust := func() {
+		now = now.Add(time.Second)
+		require.NoError(t, s.acquire(ctx, IOPriorityBackground))
+		s.release(IOPriorityBackground, now)
+	}
+
+	assert.Equal(t, [ioLanes]int{9, 8, 8}, s.limit)
+	interactive(500 * time.Millisecond)
+	adjust()
+	assert.Equal(t, [ioLanes]int{9, 7, 4}, s.limit)
+	for i := 0; i < 3; i++ {
+		interactive(500 * time.Millisecond)
+		adjust()
+	}
+	assert.Equal(t, [ioLanes]int{9, 4, 1}, s.limit)
+
+	// Background work keeps one slot however slow interactive requests are
+	require.NoError(t, s.acquire(ctx, IOPriorityBackground))
+	blocked := acquireAsync(t, s, ctx, IOPriorityBackground)
+	requireWaiting(t, blocked)
+	s.release(IOPriorityBackground, now)
+	requireGranted(t, blocked)
+	s.release(IOPriorityBackground, now)
+
+	// Once interactive requests are fast again the lanes grow back
+	for i := 0; i < 20; i++ {
+		interactive(0)
+	}
+	adjust()
+	assert.Equal(t, [ioLanes]int{9, 5, 2}, s.limit)
+	for i := 0; i < 10; i++ {
+		adjust()
+	}
+	assert.Equal(t, [ioLanes]int{9, 8, 8}, s.limit)
+}
+
+// memoryProvider serves fixed file contents and keeps what is written.
+type memoryProvider struct {
+	StorageProvider
+	files map[string][]byte
+
+	mu      sync.Mutex
+	written map[string][]byte
+}
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+func (p *memoryProvider) Protocol() string { return "memory" }
+
+func (p *memoryProvider) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return memoryFile{bytes.NewReader(p.files[path])}, nil
+}
+
+func (p *memoryProvider) Write(ctx context.Context, path string, data io.Reader) error {
+	content, err := io.ReadAll(data)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written[path] = content
+	return err
+}
+
+func TestScheduledProvider_SchedulesStreams(t *testing.T) {
+	scheduler := newIOScheduler("media", IOSchedulerConfig{Slots: 2})
+	provider := &scheduledProvider{
+		StorageProvider: &memoryProvider{files: map[string][]byte{"a.mkv": []byte("0123456789")}, written: map[string][]byte{}},
+		scheduler:       scheduler,
+	}
+	assert.Equal(t, "memory", provider.Protocol())
+
+	ctx := WithIOPriority(context.Background(), IOPriorityBackground)
+	assert.Equal(t, IOPriorityBackground, IOPriorityFrom(ctx))
+	assert.Equal(t, IOPriorityInteractive, IOPriorityFrom(context.Background()))
+
+	rc, err := provider.Open(ctx, "a.mkv")
+	require.NoError(t, err)
+	defer rc.Close()
+	seeker, ok := rc.(io.Seeker)
+	require.True(t, ok, "seekable streams stay seekable")
+	_, err = seeker.Seek(4, io.SeekStart)
+	require.NoError(t, err)
+
+	// A read waits while the background lane is full
+	require.NoError(t, scheduler.acquire(ctx, IOPriorityBackground))
+	read := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(rc)
+		read <- data
+	}()
+	select {
+	case <-read:
+		t.Fatal("read did not wait for a slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	scheduler.release(IOPriorityBackground, scheduler.now())
+	assert.Equal(t, []byte("456789"), <-read)
+
+	// Writes hold a slot only while the provider writes
+	require.NoError(t, provider.Write(WithIOPriority(context.Background(), IOPriorityTransfer), "b.mkv",
+		bytes.NewReader([]byte("copied"))))
+	assert.Equal(t, []byte("copied"), provider.StorageProvider.(*memoryProvider).written["b.mkv"])
+	assert.Equal(t, [ioLanes]int{0, 0, 0}, scheduler.running)
+}
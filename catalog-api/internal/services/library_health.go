@@ -0,0 +1,577 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Library health remediation kinds. Enrichment is run by the service;
+// the others point at the endpoints where the problem is reviewed.
+const (
+	LibraryHealthActionEnrich           = "enrich"
+	LibraryHealthActionReviewUnmatched  = "review_unmatched"
+	LibraryHealthActionReviewDuplicates = "review_duplicates"
+	LibraryHealthActionReplaceCorrupt   = "replace_corrupt"
+	LibraryHealthActionUpgradeQuality   = "upgrade_quality"
+)
+
+// ErrLibraryHealthFixRunning is returned when enrichment is started for a
+// section that is already being enriched.
+var ErrLibraryHealthFixRunning = errors.New("enrichment is already running for this section")
+
+// libraryHealthWeights is how much each problem, as a share of the
+// section's items or files, takes off its score. The weights add up to
+// one, so a section where everything is wrong scores zero.
+var libraryHealthWeights = struct {
+	missingMetadata, unmatched, duplicates, corrupt, lowQuality float64
+}{0.25, 0.20, 0.15, 0.25, 0.15}
+
+// libraryHealthSampleSize caps the item IDs listed with an action.
+const libraryHealthSampleSize = 50
+
+// lowQualityRanks are the resolutions of copies worth upgrading, and
+// betterQualityRanks those that make an item fine however many poor
+// copies it also has.
+var (
+	lowQualityRanks    = []string{"480p"}
+	betterQualityRanks = []string{"720p", "1080p", "2160p"}
+)
+
+// librarySections groups the media types of child items under the
+// section of their top-level items.
+var librarySections = map[string]string{
+	"tv_season":    "tv_show",
+	"tv_episode":   "tv_show",
+	"music_artist": "music",
+	"music_album":  "music",
+	"song":         "music",
+}
+
+func librarySection(mediaType string) string {
+	if section, ok := librarySections[mediaType]; ok {
+		return section
+	}
+	return mediaType
+}
+
+// sectionMediaTypes returns the media types that make up a section.
+func sectionMediaTypes(section string) []string {
+	types := []string{section}
+	for mediaType, parent := range librarySections {
+		if parent == section {
+			types = append(types, mediaType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// LibraryHealthAction is a remediation for one problem of a section.
+type LibraryHealthAction struct {
+	Kind        string  `json:"kind"`
+	Count       int     `json:"count"`
+	Description string  `json:"description"`
+	Endpoint    string  `json:"endpoint"`
+	ItemIDs     []int64 `json:"item_ids,omitempty"`
+}
+
+// LibraryHealthPoint is a recorded score of a section.
+type LibraryHealthPoint struct {
+	Score      int       `json:"score"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// LibraryHealthSection is the health of one library section, a media
+// type with its child types. Items counts top-level items, and Files the
+// files linked to items at any level.
+type LibraryHealthSection struct {
+	Section         string                `json:"section"`
+	Score           int                   `json:"score"`
+	Items           int                   `json:"items"`
+	Files           int                   `json:"files"`
+	MissingMetadata int                   `json:"missing_metadata"`
+	Unmatched       int                   `json:"unmatched"`
+	DuplicateFiles  int                   `json:"duplicate_files"`
+	DuplicateRatio  float64               `json:"duplicate_ratio"`
+	CorruptFiles    int                   `json:"corrupt_files"`
+	LowQuality      int                   `json:"low_quality"`
+	Actions         []LibraryHealthAction `json:"actions"`
+	Trend           []LibraryHealthPoint  `json:"trend,omitempty"`
+
+	// linkedItems counts items at any level with files, which low
+	// quality is a share of
+	linkedItems int
+}
+
+// LibraryHealthReport is the health of every library section. Score is
+// the average of the section scores weighted by their items.
+type LibraryHealthReport struct {
+	Score       int                    `json:"score"`
+	Sections    []LibraryHealthSection `json:"sections"`
+	GeneratedAt time.Time              `json:"generated_at"`
+}
+
+// LibraryHealthConfig controls how often health snapshots are recorded.
+type LibraryHealthConfig struct {
+	// SnapshotInterval is the time between recorded scores
+	SnapshotInterval time.Duration
+	// CheckInterval is how often a snapshot is checked to be due
+	CheckInterval time.Duration
+}
+
+// LibraryHealthService scores each library section on its missing
+// metadata, unmatched items, duplicate and corrupt files and low-quality
+// copies, lists what would fix each problem, and records the scores over
+// time. Corrupt files are linked files that are empty or whose content
+// is not what their extension says.
+type LibraryHealthService struct {
+	db       *database.DB
+	logger   *zap.Logger
+	config   LibraryHealthConfig
+	enricher MediaEnricher
+	now      func() time.Time
+
+	mu     sync.Mutex
+	fixing map[string]bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	// fixCtx is cancelled by Stop to end enrichment in progress
+	fixCtx    context.Context
+	cancelFix context.CancelFunc
+}
+
+// NewLibraryHealthService creates a LibraryHealthService recording a
+// snapshot a day unless cfg says otherwise.
+func NewLibraryHealthService(db *database.DB, logger *zap.Logger, cfg LibraryHealthConfig) *LibraryHealthService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.SnapshotInterval <= 0 {
+		cfg.SnapshotInterval = 24 * time.Hour
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Hour
+	}
+	fixCtx, cancelFix := context.WithCancel(context.Background())
+	return &LibraryHealthService{
+		db:        db,
+		logger:    logger,
+		config:    cfg,
+		now:       time.Now,
+		fixing:    make(map[string]bool),
+		fixCtx:    fixCtx,
+		cancelFix: cancelFix,
+	}
+}
+
+// SetEnricher sets the enricher run by the enrich action.
+func (s *LibraryHealthService) SetEnricher(enricher MediaEnricher) {
+	s.enricher = enricher
+}
+
+// Report scores every section with items, worst first, with the scores
+// recorded over the last trendDays days.
+func (s *LibraryHealthService) Report(ctx context.Context, trendDays int) (*LibraryHealthReport, error) {
+	sections, err := s.measure(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &LibraryHealthReport{Score: 100, Sections: []LibraryHealthSection{}, GeneratedAt: s.now()}
+	var weighted, items float64
+	for _, section := range sections {
+		if err := s.addActions(ctx, section); err != nil {
+			return nil, err
+		}
+		if trendDays > 0 {
+			if section.Trend, err = s.trend(ctx, section.Section, s.now().AddDate(0, 0, -trendDays)); err != nil {
+				return nil, err
+			}
+		}
+		report.Sections = append(report.Sections, *section)
+		weighted += float64(section.Score * section.Items)
+		items += float64(section.Items)
+	}
+	if items > 0 {
+		report.Score = int(math.Round(weighted / items))
+	}
+	sort.SliceStable(report.Sections, func(i, j int) bool {
+		if report.Sections[i].Score != report.Sections[j].Score {
+			return report.Sections[i].Score < report.Sections[j].Score
+		}
+		return report.Sections[i].Section < report.Sections[j].Section
+	})
+	return report, nil
+}
+
+// measure counts the problems of each section and scores it. Sections
+// without top-level items are left out.
+func (s *LibraryHealthService) measure(ctx context.Context) (map[string]*LibraryHealthSection, error) {
+	sections := map[string]*LibraryHealthSection{}
+	section := func(mediaType string) *LibraryHealthSection {
+		name := librarySection(mediaType)
+		if sections[name] == nil {
+			sections[name] = &LibraryHealthSection{Section: name}
+		}
+		return sections[name]
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT mt.name, COUNT(*),
+		       SUM(CASE WHEN mi.description IS NULL OR mi.description = '' OR mi.year IS NULL THEN 1 ELSE 0 END),
+		       SUM(CASE WHEN mi.status = 'detected' THEN 1 ELSE 0 END)
+		FROM media_items mi
+		JOIN media_types mt ON mt.id = mi.media_type_id
+		WHERE mi.parent_id IS NULL
+		GROUP BY mt.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count media items: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mediaType string
+		var items, missing, unmatched int
+		if err := rows.Scan(&mediaType, &items, &missing, &unmatched); err != nil {
+			return nil, fmt.Errorf("failed to count media items: %w", err)
+		}
+		sec := section(mediaType)
+		sec.Items += items
+		sec.MissingMetadata += missing
+		sec.Unmatched += unmatched
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count media items: %w", err)
+	}
+
+	fileRows, err := s.db.QueryContext(ctx, `
+		SELECT mt.name, COUNT(DISTINCT mi.id), COUNT(DISTINCT f.id),
+		       COUNT(DISTINCT CASE WHEN f.is_duplicate = 1 THEN f.id END),
+		       COUNT(DISTINCT CASE WHEN f.size = 0 OR f.type_mismatch = ? THEN f.id END)
+		FROM media_files mf
+		JOIN media_items mi ON mi.id = mf.media_item_id
+		JOIN media_types mt ON mt.id = mi.media_type_id
+		JOIN files f ON f.id = mf.file_id
+		WHERE f.deleted = 0
+		GROUP BY mt.name`, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count media files: %w", err)
+	}
+	defer fileRows.Close()
+	for fileRows.Next() {
+		var mediaType string
+		var linked, files, duplicates, corrupt int
+		if err := fileRows.Scan(&mediaType, &linked, &files, &duplicates, &corrupt); err != nil {
+			return nil, fmt.Errorf("failed to count media files: %w", err)
+		}
+		sec := section(mediaType)
+		sec.linkedItems += linked
+		sec.Files += files
+		sec.DuplicateFiles += duplicates
+		sec.CorruptFiles += corrupt
+	}
+	if err := fileRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count media files: %w", err)
+	}
+
+	qualityRows, err := s.db.QueryContext(ctx, `
+		SELECT mt.name, COUNT(*)
+		FROM media_items mi
+		JOIN media_types mt ON mt.id = mi.media_type_id
+		WHERE `+lowQualityCondition+`
+		GROUP BY mt.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count low-quality items: %w", err)
+	}
+	defer qualityRows.Close()
+	for qualityRows.Next() {
+		var mediaType string
+		var low int
+		if err := qualityRows.Scan(&mediaType, &low); err != nil {
+			return nil, fmt.Errorf("failed to count low-quality items: %w", err)
+		}
+		section(mediaType).LowQuality += low
+	}
+	if err := qualityRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count low-quality items: %w", err)
+	}
+
+	for name, sec := range sections {
+		if sec.Items == 0 {
+			delete(sections, name)
+			continue
+		}
+		if sec.Files > 0 {
+			sec.DuplicateRatio = math.Round(float64(sec.DuplicateFiles)/float64(sec.Files)*1000) / 1000
+		}
+		sec.Score = libraryHealthScore(sec)
+	}
+	return sections, nil
+}
+
+// lowQualityCondition matches items whose copies are all of a resolution
+// worth upgrading. Copies of unknown resolution are not counted.
+var lowQualityCondition = `EXISTS (SELECT 1 FROM media_files mf WHERE mf.media_item_id = mi.id AND mf.quality_info IN ('` +
+	strings.Join(lowQualityRanks, "','") + `'))
+	AND NOT EXISTS (SELECT 1 FROM media_files mf WHERE mf.media_item_id = mi.id AND mf.quality_info IN ('` +
+	strings.Join(betterQualityRanks, "','") + `'))`
+
+// missingMetadataCondition matches top-level items without a description
+// or year.
+const missingMetadataCondition = `mi.parent_id IS NULL AND (mi.description IS NULL OR mi.description = '' OR mi.year IS NULL)`
+
+// libraryHealthScore rates a section from 0 to 100.
+func libraryHealthScore(sec *LibraryHealthSection) int {
+	share := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return math.Min(float64(n)/float64(of), 1)
+	}
+	w := libraryHealthWeights
+	penalty := w.missingMetadata*share(sec.MissingMetadata, sec.Items) +
+		w.unmatched*share(sec.Unmatched, sec.Items) +
+		w.duplicates*share(sec.DuplicateFiles, sec.Files) +
+		w.corrupt*share(sec.CorruptFiles, sec.Files) +
+		w.lowQuality*share(sec.LowQuality, sec.linkedItems)
+	return int(math.Round(100 * (1 - penalty)))
+}
+
+// addActions lists the remediations for the problems a section has, with
+// a sample of the items concerned.
+func (s *LibraryHealthService) addActions(ctx context.Context, sec *LibraryHealthSection) error {
+	sec.Actions = []LibraryHealthAction{}
+	if sec.MissingMetadata > 0 {
+		ids, err := s.sectionItems(ctx, sec.Section, missingMetadataCondition, libraryHealthSampleSize)
+		if err != nil {
+			return err
+		}
+		sec.Actions = append(sec.Actions, LibraryHealthAction{
+			Kind:        LibraryHealthActionEnrich,
+			Count:       sec.MissingMetadata,
+			Description: fmt.Sprintf("Re-run metadata enrichment on %d items missing a description or year", sec.MissingMetadata),
+			Endpoint:    "POST /api/v1/admin/library-health/" + sec.Section + "/enrich",
+			ItemIDs:     ids,
+		})
+	}
+	if sec.Unmatched > 0 {
+		ids, err := s.sectionItems(ctx, sec.Section, `mi.parent_id IS NULL AND mi.status = 'detected'`, libraryHealthSampleSize)
+		if err != nil {
+			return err
+		}
+		sec.Actions = append(sec.Actions, LibraryHealthAction{
+			Kind:        LibraryHealthActionReviewUnmatched,
+			Count:       sec.Unmatched,
+			Description: fmt.Sprintf("Review %d items no metadata provider matched and identify them", sec.Unmatched),
+			Endpoint:    "GET /api/v1/entities/{id}/metadata/matches",
+			ItemIDs:     ids,
+		})
+	}
+	if sec.DuplicateFiles > 0 {
+		sec.Actions = append(sec.Actions, LibraryHealthAction{
+			Kind:        LibraryHealthActionReviewDuplicates,
+			Count:       sec.DuplicateFiles,
+			Description: fmt.Sprintf("Review %d duplicate files and resolve them", sec.DuplicateFiles),
+			Endpoint:    "GET /api/v1/search/duplicates",
+		})
+	}
+	if sec.CorruptFiles > 0 {
+		sec.Actions = append(sec.Actions, LibraryHealthAction{
+			Kind:        LibraryHealthActionReplaceCorrupt,
+			Count:       sec.CorruptFiles,
+			Description: fmt.Sprintf("Replace %d files that are empty or not what their extension says", sec.CorruptFiles),
+			Endpoint:    "GET /api/v1/scan/type-mismatches",
+		})
+	}
+	if sec.LowQuality > 0 {
+		ids, err := s.sectionItems(ctx, sec.Section, lowQualityCondition, libraryHealthSampleSize)
+		if err != nil {
+			return err
+		}
+		sec.Actions = append(sec.Actions, LibraryHealthAction{
+			Kind:        LibraryHealthActionUpgradeQuality,
+			Count:       sec.LowQuality,
+			Description: fmt.Sprintf("Find better copies of %d items only available in %s", sec.LowQuality, strings.Join(lowQualityRanks, " or ")),
+			Endpoint:    "GET /api/v1/entities/{id}",
+			ItemIDs:     ids,
+		})
+	}
+	return nil
+}
+
+// sectionItems returns the IDs of up to limit items of a section matching
+// condition, or all of them when limit is 0.
+func (s *LibraryHealthService) sectionItems(ctx context.Context, section, condition string, limit int) ([]int64, error) {
+	types := sectionMediaTypes(section)
+	args := make([]interface{}, len(types))
+	for i, mediaType := range types {
+		args[i] = mediaType
+	}
+	query := `SELECT mi.id FROM media_items mi
+		JOIN media_types mt ON mt.id = mi.media_type_id
+		WHERE mt.name IN (?` + strings.Repeat(", ?", len(types)-1) + `) AND ` + condition + `
+		ORDER BY mi.id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s items: %w", section, err)
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Enrich re-runs metadata enrichment in the background on the items of a
+// section missing a description or year, and returns how many there are.
+func (s *LibraryHealthService) Enrich(ctx context.Context, section string) (int, error) {
+	if s.enricher == nil {
+		return 0, fmt.Errorf("metadata enrichment is not configured")
+	}
+	ids, err := s.sectionItems(ctx, section, missingMetadataCondition, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	if s.fixing[section] {
+		s.mu.Unlock()
+		return 0, ErrLibraryHealthFixRunning
+	}
+	s.fixing[section] = true
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.fixing, section)
+			s.mu.Unlock()
+		}()
+		s.enricher.EnrichItems(s.fixCtx, ids)
+	}()
+	s.logger.Info("Library health enrichment started", zap.String("section", section), zap.Int("items", len(ids)))
+	return len(ids), nil
+}
+
+// trend returns the scores of a section recorded since a time, oldest
+// first.
+func (s *LibraryHealthService) trend(ctx context.Context, section string, since time.Time) ([]LibraryHealthPoint, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT score, recorded_at FROM library_health_snapshots WHERE section = ? AND recorded_at >= ? ORDER BY recorded_at`,
+		section, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load library health trend: %w", err)
+	}
+	defer rows.Close()
+	points := []LibraryHealthPoint{}
+	for rows.Next() {
+		var point LibraryHealthPoint
+		if err := rows.Scan(&point.Score, &point.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// RecordSnapshot records the current score and counts of every section.
+func (s *LibraryHealthService) RecordSnapshot(ctx context.Context) error {
+	sections, err := s.measure(ctx)
+	if err != nil {
+		return err
+	}
+	recorded := s.now()
+	for _, sec := range sections {
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO library_health_snapshots (section, score, items, files, missing_metadata, unmatched,
+			 duplicate_files, corrupt_files, low_quality, recorded_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sec.Section, sec.Score, sec.Items, sec.Files, sec.MissingMetadata, sec.Unmatched,
+			sec.DuplicateFiles, sec.CorruptFiles, sec.LowQuality, recorded); err != nil {
+			return fmt.Errorf("failed to record library health: %w", err)
+		}
+	}
+	return nil
+}
+
+// RunDue records a snapshot when the last one is older than the snapshot
+// interval.
+func (s *LibraryHealthService) RunDue(ctx context.Context) {
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM library_health_snapshots WHERE recorded_at > ?`,
+		s.now().Add(-s.config.SnapshotInterval)).Scan(&count); err != nil {
+		s.logger.Error("Failed to check library health snapshots", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		return
+	}
+	if err := s.RecordSnapshot(ctx); err != nil {
+		s.logger.Error("Failed to record library health", zap.Error(err))
+	}
+}
+
+// Start begins recording snapshots, taking the first one if none was
+// taken within the interval.
+func (s *LibraryHealthService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.RunDue(context.Background())
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunDue(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule, cancels enrichment in progress and waits for
+// both to return.
+func (s *LibraryHealthService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.cancelFix()
+	s.wg.Wait()
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"catalogizer/config"
+	"catalogizer/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLibraryHealthFixture catalogs two healthy films, a film with no
+// metadata in a 480p copy, a duplicated film and an unmatched show with
+// an empty episode file.
+func newLibraryHealthFixture(t *testing.T) (*database.DB, map[string]int64) {
+	t.Helper()
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "health.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	rootID, err := db.InsertReturningID(ctx, `INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'local', '/srv')`)
+	require.NoError(t, err)
+	items := map[string]int64{}
+	addItem := func(name, mediaType, status string, parent int64, year interface{}, description string) int64 {
+		var parentID interface{}
+		if parent != 0 {
+			parentID = parent
+		}
+		id, err := db.InsertReturningID(ctx,
+			`INSERT INTO media_items (media_type_id, title, year, description, status, parent_id)
+			 VALUES ((SELECT id FROM media_types WHERE name = ?), ?, ?, ?, ?, ?)`,
+			mediaType, name, year, description, status, parentID)
+		require.NoError(t, err)
+		items[name] = id
+		return id
+	}
+	addFile := func(item int64, name string, size int64, duplicate bool, quality string) {
+		fileID, err := db.InsertReturningID(ctx,
+			`INSERT INTO files (storage_root_id, path, name, is_directory, size, is_duplicate, modified_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+			rootID, "/"+name, name, false, size, duplicate)
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, `INSERT INTO media_files (media_item_id, file_id, quality_info) VALUES (?, ?, ?)`, item, fileID, quality)
+		require.NoError(t, err)
+	}
+
+	addFile(addItem("Alpha", "movie", "matched", 0, 2001, "A film"), "alpha.mkv", 10, false, "1080p")
+	beta := addItem("Beta", "movie", "matched", 0, 2002, "A film")
+	addFile(beta, "beta.mkv", 10, false, "480p")
+	addFile(beta, "beta-hd.mkv", 10, false, "1080p")
+	addFile(addItem("Gamma", "movie", "detected", 0, nil, ""), "gamma.avi", 10, false, "480p")
+	delta := addItem("Delta", "movie", "matched", 0, 2004, "A film")
+	addFile(delta, "delta.mkv", 10, false, "720p")
+	addFile(delta, "delta copy.mkv", 10, true, "720p")
+
+	show := addItem("Show", "tv_show", "detected", 0, 2010, "A show")
+	season := addItem("Show S1", "tv_season", "detected", show, nil, "")
+	addFile(addItem("Show S1E1", "tv_episode", "detected", season, nil, ""), "show.s01e01.mkv", 0, false, "")
+	return db, items
+}
+
+func TestLibraryHealthService_Report(t *testing.T) {
+	db, items := newLibraryHealthFixture(t)
+	s := NewLibraryHealthService(db, nil, LibraryHealthConfig{})
+	report, err := s.Report(context.Background(), 30)
+	require.NoError(t, err)
+	require.Len(t, report.Sections, 2)
+
+	show := report.Sections[0]
+	assert.Equal(t, "tv_show", show.Section, "the worst section comes first")
+	assert.Equal(t, 1, show.Items, "seasons and episodes count towards their show")
+	assert.Equal(t, 0, show.MissingMetadata)
+	assert.Equal(t, 1, show.Unmatched)
+	assert.Equal(t, 1, show.CorruptFiles, "empty files are corrupt")
+	assert.Equal(t, 55, show.Score)
+
+	movies := report.Sections[1]
+	assert.Equal(t, "movie", movies.Section)
+	assert.Equal(t, 4, movies.Items)
+	assert.Equal(t, 6, movies.Files)
+	assert.Equal(t, 1, movies.MissingMetadata)
+	assert.Equal(t, 1, movies.Unmatched)
+	assert.Equal(t, 1, movies.DuplicateFiles)
+	assert.InDelta(t, 0.167, movies.DuplicateRatio, 0.001)
+	assert.Equal(t, 0, movies.CorruptFiles)
+	assert.Equal(t, 1, movies.LowQuality, "a better copy makes up for a 480p one")
+	assert.Equal(t, 83, movies.Score)
+	assert.Equal(t, 77, report.Score, "sections are weighted by their items")
+
+	kinds := map[string]LibraryHealthAction{}
+	for _, action := range movies.Actions {
+		kinds[action.Kind] = action
+	}
+	assert.Equal(t, []int64{items["Gamma"]}, kinds[LibraryHealthActionEnrich].ItemIDs)
+	assert.Equal(t, "POST /api/v1/admin/library-health/movie/enrich", kinds[LibraryHealthActionEnrich].Endpoint)
+	assert.Equal(t, []int64{items["Gamma"]}, kinds[LibraryHealthActionReviewUnmatched].ItemIDs)
+	assert.Equal(t, 1, kinds[LibraryHealthActionReviewDuplicates].Count)
+	assert.Equal(t, []int64{items["Gamma"]}, kinds[LibraryHealthActionUpgradeQuality].ItemIDs)
+	assert.NotContains(t, kinds, LibraryHealthActionReplaceCorrupt)
+	assert.Empty(t, movies.Trend)
+}
+
+func TestLibraryHealthService_Trend(t *testing.T) {
+	db, _ := newLibraryHealthFixture(t)
+	s := NewLibraryHealthService(db, nil, LibraryHealthConfig{SnapshotInterval: 24 * time.Hour})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.RunDue(ctx)
+	now = now.Add(time.Hour)
+	s.RunDue(ctx)
+	_, err := db.ExecContext(ctx, `UPDATE media_items SET status = 'matched', year = 2003, description = 'A film' WHERE title = 'Gamma'`)
+	require.NoError(t, err)
+	now = now.Add(24 * time.Hour)
+	s.RunDue(ctx)
+
+	report, err := s.Report(ctx, 30)
+	require.NoError(t, err)
+	for _, section := range report.Sections {
+		if section.Section != "movie" {
+			continue
+		}
+		require.Len(t, section.Trend, 2, "one snapshot per interval")
+		assert.Equal(t, 83, section.Trend[0].Score)
+		assert.Equal(t, 94, section.Trend[1].Score)
+	}
+
+	report, err = s.Report(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, report.Sections[0].Trend)
+}
+
+func TestLibraryHealthService_Enrich(t *testing.T) {
+	db, items := newLibraryHealthFixture(t)
+	s := NewLibraryHealthService(db, nil, LibraryHealthConfig{})
+	ctx := context.Background()
+
+	_, err := s.Enrich(ctx, "movie")
+	assert.ErrorContains(t, err, "not configured")
+
+	enricher := &recordingEnricher{}
+	s.SetEnricher(enricher)
+	n, err := s.Enrich(ctx, "movie")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.Enrich(ctx, "tv_show")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	s.Stop()
+	assert.Equal(t, []int64{items["Gamma"]}, enricher.ids)
+}
@@ -0,0 +1,544 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LibraryExportVersion is the version of the collection and playlist
+// export format.
+const LibraryExportVersion = 1
+
+// libraryHashColumns are the file hashes an exported item is matched by
+// on import, strongest first.
+var libraryHashColumns = []string{"sha256", "md5", "quick_hash"}
+
+// LibraryItemRef identifies a media item independently of its ID: by the
+// hashes and location of its primary file, with its title for reports.
+// IDs change on re-scans and differ between instances; hashes and paths
+// do not.
+type LibraryItemRef struct {
+	Title       string `json:"title"`
+	MediaType   string `json:"media_type,omitempty"`
+	Year        *int   `json:"year,omitempty"`
+	StorageRoot string `json:"storage_root,omitempty"`
+	Path        string `json:"path,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+	QuickHash   string `json:"quick_hash,omitempty"`
+}
+
+func (r LibraryItemRef) hash(column string) string {
+	switch column {
+	case "sha256":
+		return r.SHA256
+	case "md5":
+		return r.MD5
+	case "quick_hash":
+		return r.QuickHash
+	}
+	return ""
+}
+
+// ExportedCollectionItem is a collection entry in an export.
+type ExportedCollectionItem struct {
+	LibraryItemRef
+	SequenceNumber *int `json:"sequence_number,omitempty"`
+	SeasonNumber   *int `json:"season_number,omitempty"`
+	ReleaseOrder   *int `json:"release_order,omitempty"`
+}
+
+// ExportedCollection is a media collection in an export.
+type ExportedCollection struct {
+	Name           string                   `json:"name"`
+	CollectionType string                   `json:"collection_type"`
+	Description    *string                  `json:"description,omitempty"`
+	CoverURL       *string                  `json:"cover_url,omitempty"`
+	ExternalIDs    map[string]string        `json:"external_ids,omitempty"`
+	Items          []ExportedCollectionItem `json:"items"`
+}
+
+// ExportedPlaylistItem is a playlist entry in an export.
+type ExportedPlaylistItem struct {
+	LibraryItemRef
+	CustomTitle string `json:"custom_title,omitempty"`
+}
+
+// ExportedPlaylist is a playlist in an export. Smart playlists carry their
+// rule and no items.
+type ExportedPlaylist struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	IsPublic    bool                   `json:"is_public"`
+	Rule        string                 `json:"rule,omitempty"`
+	Items       []ExportedPlaylistItem `json:"items"`
+}
+
+// LibraryExport is a set of collections and playlists that can be imported
+// on another instance.
+type LibraryExport struct {
+	Version     int                  `json:"version"`
+	ExportedAt  time.Time            `json:"exported_at"`
+	Collections []ExportedCollection `json:"collections"`
+	Playlists   []ExportedPlaylist   `json:"playlists"`
+}
+
+// LibraryExportRequest selects what to export. When both lists are empty
+// every collection and all of the user's own playlists are exported.
+type LibraryExportRequest struct {
+	CollectionIDs []int64 `json:"collection_ids"`
+	PlaylistIDs   []int64 `json:"playlist_ids"`
+}
+
+// ImportedLibraryContainer is a collection or playlist created by an
+// import, with how many of its items were found.
+type ImportedLibraryContainer struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Items    int    `json:"items"`
+	Resolved int    `json:"resolved"`
+}
+
+// UnresolvedLibraryItem is an exported item that matched no media item on
+// import.
+type UnresolvedLibraryItem struct {
+	Kind      string `json:"kind"`
+	Container string `json:"container"`
+	Position  int    `json:"position"`
+	LibraryItemRef
+}
+
+// LibraryImportReport describes the result of an import.
+type LibraryImportReport struct {
+	Collections    []ImportedLibraryContainer `json:"collections"`
+	Playlists      []ImportedLibraryContainer `json:"playlists"`
+	ResolvedByHash int                        `json:"resolved_by_hash"`
+	ResolvedByPath int                        `json:"resolved_by_path"`
+	Unresolved     []UnresolvedLibraryItem    `json:"unresolved"`
+}
+
+// LibraryTransferService exports collections and playlists with item
+// references that survive re-scans, and imports them on this or another
+// instance.
+type LibraryTransferService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	playlists *CatalogPlaylistService
+	now       func() time.Time
+}
+
+// NewLibraryTransferService creates a new LibraryTransferService.
+func NewLibraryTransferService(db *database.DB, logger *zap.Logger, playlists *CatalogPlaylistService) *LibraryTransferService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &LibraryTransferService{db: db, logger: logger, playlists: playlists, now: time.Now}
+}
+
+// Export returns the selected collections and playlists. Playlists must be
+// the user's own or public.
+func (s *LibraryTransferService) Export(ctx context.Context, userID int, request LibraryExportRequest) (*LibraryExport, error) {
+	export := &LibraryExport{
+		Version:     LibraryExportVersion,
+		ExportedAt:  s.now().UTC(),
+		Collections: []ExportedCollection{},
+		Playlists:   []ExportedPlaylist{},
+	}
+
+	collectionIDs, playlistIDs := request.CollectionIDs, request.PlaylistIDs
+	if len(collectionIDs) == 0 && len(playlistIDs) == 0 {
+		var err error
+		if collectionIDs, err = s.queryIDs(ctx,
+			`SELECT id FROM media_collections WHERE deleted_at IS NULL ORDER BY id`); err != nil {
+			return nil, fmt.Errorf("failed to list collections: %w", err)
+		}
+		if playlistIDs, err = s.queryIDs(ctx,
+			`SELECT id FROM playlists WHERE user_id = ? AND dismissed = ? AND deleted_at IS NULL ORDER BY id`,
+			userID, false); err != nil {
+			return nil, fmt.Errorf("failed to list playlists: %w", err)
+		}
+	}
+
+	for _, id := range collectionIDs {
+		collection, err := s.exportCollection(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		export.Collections = append(export.Collections, *collection)
+	}
+	for _, id := range playlistIDs {
+		playlist, err := s.exportPlaylist(ctx, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		export.Playlists = append(export.Playlists, *playlist)
+	}
+	return export, nil
+}
+
+func (s *LibraryTransferService) queryIDs(ctx context.Context, query string, args ...interface{}) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *LibraryTransferService) exportCollection(ctx context.Context, id int64) (*ExportedCollection, error) {
+	var c ExportedCollection
+	var description, coverURL, externalIDs sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT name, collection_type, description, cover_url, external_ids
+		 FROM media_collections WHERE id = ? AND deleted_at IS NULL`, id).Scan(
+		&c.Name, &c.CollectionType, &description, &coverURL, &externalIDs)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("collection %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection %d: %w", id, err)
+	}
+	if description.Valid {
+		c.Description = &description.String
+	}
+	if coverURL.Valid {
+		c.CoverURL = &coverURL.String
+	}
+	if externalIDs.Valid && externalIDs.String != "" && externalIDs.String != "null" {
+		if err := json.Unmarshal([]byte(externalIDs.String), &c.ExternalIDs); err != nil {
+			s.logger.Warn("Ignoring invalid collection external IDs", zap.Int64("collection_id", id), zap.Error(err))
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT mci.media_item_id, mci.sequence_number, mci.season_number, mci.release_order
+		 FROM media_collection_items mci
+		 JOIN media_items mi ON mi.id = mci.media_item_id
+		 WHERE mci.collection_id = ? AND mi.deleted_at IS NULL
+		 ORDER BY mci.id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection items: %w", err)
+	}
+	type entry struct {
+		mediaItemID                    int64
+		sequence, season, releaseOrder sql.NullInt64
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.mediaItemID, &e.sequence, &e.season, &e.releaseOrder); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan collection item: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load collection items: %w", err)
+	}
+
+	c.Items = []ExportedCollectionItem{}
+	for _, e := range entries {
+		ref, err := s.itemRef(ctx, e.mediaItemID)
+		if err != nil {
+			return nil, err
+		}
+		c.Items = append(c.Items, ExportedCollectionItem{
+			LibraryItemRef: *ref,
+			SequenceNumber: nullIntPtr(e.sequence),
+			SeasonNumber:   nullIntPtr(e.season),
+			ReleaseOrder:   nullIntPtr(e.releaseOrder),
+		})
+	}
+	return &c, nil
+}
+
+func (s *LibraryTransferService) exportPlaylist(ctx context.Context, userID int, id int64) (*ExportedPlaylist, error) {
+	p, err := s.playlists.loadPlaylist(ctx, userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	exported := &ExportedPlaylist{
+		Name:        p.Name,
+		Description: p.Description,
+		IsPublic:    p.IsPublic,
+		Rule:        p.Rule,
+		Items:       []ExportedPlaylistItem{},
+	}
+	if p.IsSmart {
+		return exported, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT pi.media_item_id, pi.custom_title
+		 FROM playlist_items pi
+		 JOIN media_items mi ON mi.id = pi.media_item_id
+		 WHERE pi.playlist_id = ? AND mi.deleted_at IS NULL
+		 ORDER BY pi.position, pi.id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playlist items: %w", err)
+	}
+	type entry struct {
+		mediaItemID int64
+		customTitle string
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.mediaItemID, &e.customTitle); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan playlist item: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load playlist items: %w", err)
+	}
+
+	for _, e := range entries {
+		ref, err := s.itemRef(ctx, e.mediaItemID)
+		if err != nil {
+			return nil, err
+		}
+		exported.Items = append(exported.Items, ExportedPlaylistItem{LibraryItemRef: *ref, CustomTitle: e.customTitle})
+	}
+	return exported, nil
+}
+
+// itemRef describes a media item by its primary file. Items without files
+// are exported by title only and can only be reported on import.
+func (s *LibraryTransferService) itemRef(ctx context.Context, mediaItemID int64) (*LibraryItemRef, error) {
+	var ref LibraryItemRef
+	var year sql.NullInt64
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT mi.title, mt.name, mi.year FROM media_items mi
+		 JOIN media_types mt ON mt.id = mi.media_type_id
+		 WHERE mi.id = ?`, mediaItemID).Scan(&ref.Title, &ref.MediaType, &year); err != nil {
+		return nil, fmt.Errorf("failed to load media item %d: %w", mediaItemID, err)
+	}
+	ref.Year = nullIntPtr(year)
+
+	var sha256, md5, quickHash sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sr.name, f.path, f.sha256, f.md5, f.quick_hash
+		 FROM media_files mf
+		 JOIN files f ON f.id = mf.file_id
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE mf.media_item_id = ?
+		 ORDER BY mf.is_primary DESC, mf.id
+		 LIMIT 1`, mediaItemID).Scan(&ref.StorageRoot, &ref.Path, &sha256, &md5, &quickHash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load files of media item %d: %w", mediaItemID, err)
+	}
+	ref.SHA256, ref.MD5, ref.QuickHash = sha256.String, md5.String, quickHash.String
+	return &ref, nil
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+// Import creates the collections and playlists of an export. Playlists are
+// created for the user. Items are matched to media items by file hash
+// first and path second; items that match nothing are left out and listed
+// in the report.
+func (s *LibraryTransferService) Import(ctx context.Context, userID int, export *LibraryExport) (*LibraryImportReport, error) {
+	if export == nil || export.Version != LibraryExportVersion {
+		return nil, fmt.Errorf("invalid export: unsupported version")
+	}
+	for _, c := range export.Collections {
+		if strings.TrimSpace(c.Name) == "" {
+			return nil, fmt.Errorf("invalid export: collection name is required")
+		}
+	}
+	for _, p := range export.Playlists {
+		if strings.TrimSpace(p.Name) == "" {
+			return nil, fmt.Errorf("invalid export: playlist name is required")
+		}
+		if p.Rule != "" {
+			if _, err := ParseSmartPlaylistRule(ResolveSmartPlaylistRule(p.Rule)); err != nil {
+				return nil, fmt.Errorf("invalid export: playlist %q: %w", p.Name, err)
+			}
+		}
+	}
+
+	report := &LibraryImportReport{
+		Collections: []ImportedLibraryContainer{},
+		Playlists:   []ImportedLibraryContainer{},
+		Unresolved:  []UnresolvedLibraryItem{},
+	}
+	for _, c := range export.Collections {
+		imported, err := s.importCollection(ctx, c, report)
+		if err != nil {
+			return nil, err
+		}
+		report.Collections = append(report.Collections, *imported)
+	}
+	for _, p := range export.Playlists {
+		imported, err := s.importPlaylist(ctx, userID, p, report)
+		if err != nil {
+			return nil, err
+		}
+		report.Playlists = append(report.Playlists, *imported)
+	}
+
+	s.logger.Info("Imported collections and playlists",
+		zap.Int("user_id", userID),
+		zap.Int("collections", len(report.Collections)),
+		zap.Int("playlists", len(report.Playlists)),
+		zap.Int("unresolved", len(report.Unresolved)))
+	return report, nil
+}
+
+func (s *LibraryTransferService) importCollection(ctx context.Context, c ExportedCollection, report *LibraryImportReport) (*ImportedLibraryContainer, error) {
+	imported := &ImportedLibraryContainer{Name: strings.TrimSpace(c.Name), Items: len(c.Items)}
+	type resolvedItem struct {
+		mediaItemID int64
+		item        ExportedCollectionItem
+	}
+	var resolved []resolvedItem
+	for i, item := range c.Items {
+		mediaItemID, err := s.resolveItem(ctx, item.LibraryItemRef, report)
+		if err != nil {
+			return nil, err
+		}
+		if mediaItemID == 0 {
+			report.Unresolved = append(report.Unresolved, UnresolvedLibraryItem{
+				Kind: "collection", Container: imported.Name, Position: i + 1, LibraryItemRef: item.LibraryItemRef,
+			})
+			continue
+		}
+		resolved = append(resolved, resolvedItem{mediaItemID, item})
+	}
+
+	collectionType := c.CollectionType
+	if collectionType == "" {
+		collectionType = "custom"
+	}
+	externalIDs, err := json.Marshal(c.ExternalIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal external_ids: %w", err)
+	}
+	now := s.now()
+	imported.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO media_collections (name, collection_type, description, total_items, external_ids, cover_url, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		imported.Name, collectionType, c.Description, len(resolved), string(externalIDs), c.CoverURL, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collection %q: %w", imported.Name, err)
+	}
+	for _, r := range resolved {
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO media_collection_items (collection_id, media_item_id, sequence_number, season_number, release_order)
+			 VALUES (?, ?, ?, ?, ?)`,
+			imported.ID, r.mediaItemID, r.item.SequenceNumber, r.item.SeasonNumber, r.item.ReleaseOrder); err != nil {
+			return nil, fmt.Errorf("failed to add collection item: %w", err)
+		}
+	}
+	imported.Resolved = len(resolved)
+	return imported, nil
+}
+
+func (s *LibraryTransferService) importPlaylist(ctx context.Context, userID int, p ExportedPlaylist, report *LibraryImportReport) (*ImportedLibraryContainer, error) {
+	name, description, isPublic, rule := p.Name, p.Description, p.IsPublic, p.Rule
+	created, err := s.playlists.CreatePlaylist(ctx, userID, CatalogPlaylistInput{
+		Name: &name, Description: &description, IsPublic: &isPublic, Rule: &rule,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create playlist %q: %w", name, err)
+	}
+	imported := &ImportedLibraryContainer{ID: created.ID, Name: created.Name, Items: len(p.Items)}
+	if created.IsSmart {
+		return imported, nil
+	}
+
+	now := s.now()
+	for i, item := range p.Items {
+		mediaItemID, err := s.resolveItem(ctx, item.LibraryItemRef, report)
+		if err != nil {
+			return nil, err
+		}
+		if mediaItemID == 0 {
+			report.Unresolved = append(report.Unresolved, UnresolvedLibraryItem{
+				Kind: "playlist", Container: created.Name, Position: i + 1, LibraryItemRef: item.LibraryItemRef,
+			})
+			continue
+		}
+		imported.Resolved++
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO playlist_items (playlist_id, media_item_id, position, added_by, added_at, custom_title)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			created.ID, mediaItemID, imported.Resolved, userID, now, item.CustomTitle); err != nil {
+			return nil, fmt.Errorf("failed to add playlist item: %w", err)
+		}
+	}
+	return imported, nil
+}
+
+// resolveItem finds the media item an exported item refers to: by any of
+// its file hashes first, then by path, preferring a file on a storage root
+// of the same name. It returns 0 when nothing matches.
+func (s *LibraryTransferService) resolveItem(ctx context.Context, ref LibraryItemRef, report *LibraryImportReport) (int64, error) {
+	const match = `SELECT mf.media_item_id
+		 FROM files f
+		 JOIN media_files mf ON mf.file_id = f.id
+		 JOIN media_items mi ON mi.id = mf.media_item_id
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE %s = ? AND f.deleted = ? AND mi.deleted_at IS NULL
+		 ORDER BY CASE WHEN sr.name = ? THEN 0 ELSE 1 END, mf.is_primary DESC, mf.id
+		 LIMIT 1`
+
+	for _, column := range libraryHashColumns {
+		hash := ref.hash(column)
+		if hash == "" {
+			continue
+		}
+		id, err := s.matchItem(ctx, fmt.Sprintf(match, "f."+column), hash, ref.StorageRoot)
+		if err != nil || id != 0 {
+			if id != 0 {
+				report.ResolvedByHash++
+			}
+			return id, err
+		}
+	}
+	if ref.Path != "" {
+		id, err := s.matchItem(ctx, fmt.Sprintf(match, "f.path"), ref.Path, ref.StorageRoot)
+		if id != 0 {
+			report.ResolvedByPath++
+		}
+		return id, err
+	}
+	return 0, nil
+}
+
+func (s *LibraryTransferService) matchItem(ctx context.Context, query, value, storageRoot string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, value, false, storageRoot).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve media item: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLibraryTransferTestService extends the playlist test schema with
+// storage roots, files and collections. Media item N has file N*100.
+func newLibraryTransferTestService(t *testing.T, files [][]interface{}) (*LibraryTransferService, *database.DB) {
+	t.Helper()
+
+	playlists, db := newPlaylistTestService(t)
+	_, err := db.Exec(`
+		CREATE TABLE storage_roots (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			deleted BOOLEAN NOT NULL DEFAULT 0,
+			md5 TEXT, sha256 TEXT, quick_hash TEXT
+		);
+		CREATE TABLE media_collections (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			collection_type TEXT NOT NULL,
+			description TEXT,
+			total_items INTEGER DEFAULT 0,
+			external_ids TEXT,
+			cover_url TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
+		);
+		CREATE TABLE media_collection_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			collection_id INTEGER NOT NULL,
+			media_item_id INTEGER NOT NULL,
+			sequence_number INTEGER,
+			season_number INTEGER,
+			release_order INTEGER
+		);
+		INSERT INTO storage_roots (id, name) VALUES (1, 'nas'), (2, 'backup')`)
+	require.NoError(t, err)
+	for _, f := range files {
+		_, err = db.Exec(`INSERT INTO files (id, storage_root_id, path, sha256, md5, quick_hash) VALUES (?, ?, ?, ?, ?, ?)`, f...)
+		require.NoError(t, err)
+	}
+	return NewLibraryTransferService(db, nil, playlists), db
+}
+
+func TestLibraryTransfer_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	source, db := newLibraryTransferTestService(t, [][]interface{}{
+		{100, 1, "music/Kind of Blue.flac", "sha-kob", nil, nil},
+		{200, 1, "music/Blue Train.flac", "sha-bt", nil, nil},
+		{300, 1, "music/Nevermind.flac", nil, "md5-nm", nil},
+		{400, 1, "movies/Whiplash.mkv", nil, nil, "qh-wl"},
+	})
+	_, err := db.Exec(`INSERT INTO media_collections (id, name, collection_type, external_ids) VALUES (1, 'Blue Note', 'custom', '{"discogs":"42"}')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO media_collection_items (collection_id, media_item_id, sequence_number) VALUES (1, 1, 1), (1, 2, 2)`)
+	require.NoError(t, err)
+
+	mix, err := source.playlists.CreatePlaylist(ctx, 7, CatalogPlaylistInput{Name: strPtr("Mix")})
+	require.NoError(t, err)
+	_, err = source.playlists.AddItems(ctx, 7, mix.ID, []int64{3, 1, 4}, 0)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE playlist_items SET custom_title = 'Grunge' WHERE media_item_id = 3`)
+	require.NoError(t, err)
+	_, err = source.playlists.CreatePlaylist(ctx, 7, CatalogPlaylistInput{Name: strPtr("Jazz"), Rule: strPtr("genre = jazz")})
+	require.NoError(t, err)
+	_, err = source.playlists.CreatePlaylist(ctx, 8, CatalogPlaylistInput{Name: strPtr("Private")})
+	require.NoError(t, err)
+
+	export, err := source.Export(ctx, 7, LibraryExportRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, LibraryExportVersion, export.Version)
+	require.Len(t, export.Collections, 1)
+	assert.Equal(t, map[string]string{"discogs": "42"}, export.Collections[0].ExternalIDs)
+	require.Len(t, export.Collections[0].Items, 2)
+	assert.Equal(t, "sha-kob", export.Collections[0].Items[0].SHA256)
+	assert.Equal(t, 2, *export.Collections[0].Items[1].SequenceNumber)
+	require.Len(t, export.Playlists, 2)
+	mixExport := export.Playlists[0]
+	require.Len(t, mixExport.Items, 3)
+	assert.Equal(t, "Nevermind", mixExport.Items[0].Title)
+	assert.Equal(t, "Grunge", mixExport.Items[0].CustomTitle)
+	assert.Equal(t, "nas", mixExport.Items[0].StorageRoot)
+	assert.Equal(t, "music/Nevermind.flac", mixExport.Items[0].Path)
+	assert.Equal(t, "genre = jazz", export.Playlists[1].Rule)
+	assert.Empty(t, export.Playlists[1].Items)
+
+	// Another user's private playlist cannot be exported
+	_, err = source.Export(ctx, 7, LibraryExportRequest{PlaylistIDs: []int64{3}})
+	assert.ErrorContains(t, err, "not found")
+
+	// The export survives a round trip through JSON
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	var decoded LibraryExport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	// On the target the files were re-scanned: Kind of Blue moved but kept
+	// its hash, Nevermind was re-encoded at the same path, Blue Train now
+	// belongs to media item 4 and Whiplash is gone.
+	target, targetDB := newLibraryTransferTestService(t, [][]interface{}{
+		{100, 2, "archive/kob.flac", "sha-kob", nil, nil},
+		{300, 1, "music/Nevermind.flac", nil, "md5-other", nil},
+		{400, 1, "music/Blue Train.flac", "sha-bt", nil, nil},
+	})
+	report, err := target.Import(ctx, 9, &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.ResolvedByHash) // Kind of Blue twice, Blue Train once
+	assert.Equal(t, 1, report.ResolvedByPath)
+	require.Len(t, report.Unresolved, 1)
+	assert.Equal(t, "playlist", report.Unresolved[0].Kind)
+	assert.Equal(t, "Mix", report.Unresolved[0].Container)
+	assert.Equal(t, 3, report.Unresolved[0].Position)
+	assert.Equal(t, "Whiplash", report.Unresolved[0].Title)
+
+	require.Len(t, report.Collections, 1)
+	assert.Equal(t, 2, report.Collections[0].Resolved)
+	var collectionItems []int64
+	rows, err := targetDB.Query(`SELECT media_item_id FROM media_collection_items WHERE collection_id = ? ORDER BY sequence_number`, report.Collections[0].ID)
+	require.NoError(t, err)
+	for rows.Next() {
+		var id int64
+		require.NoError(t, rows.Scan(&id))
+		collectionItems = append(collectionItems, id)
+	}
+	rows.Close()
+	assert.Equal(t, []int64{1, 4}, collectionItems)
+
+	require.Len(t, report.Playlists, 2)
+	imported, err := target.playlists.GetPlaylist(ctx, 9, report.Playlists[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 1}, playlistMediaIDs(imported))
+	assert.Equal(t, 3, report.Playlists[0].Items)
+	assert.Equal(t, 2, report.Playlists[0].Resolved)
+	smart, err := target.playlists.GetPlaylist(ctx, 9, report.Playlists[1].ID)
+	require.NoError(t, err)
+	assert.True(t, smart.IsSmart)
+	assert.Equal(t, "genre = jazz", smart.Rule)
+}
+
+func TestLibraryTransfer_ImportValidation(t *testing.T) {
+	service, _ := newLibraryTransferTestService(t, nil)
+	ctx := context.Background()
+
+	_, err := service.Import(ctx, 7, &LibraryExport{Version: 99})
+	assert.ErrorContains(t, err, "invalid export")
+	_, err = service.Import(ctx, 7, &LibraryExport{Version: LibraryExportVersion, Collections: []ExportedCollection{{Name: " "}}})
+	assert.ErrorContains(t, err, "collection name is required")
+	_, err = service.Import(ctx, 7, &LibraryExport{Version: LibraryExportVersion, Playlists: []ExportedPlaylist{{Name: "Bad", Rule: "genre ="}}})
+	assert.ErrorContains(t, err, "invalid export")
+
+	// Nothing is created when the export is rejected
+	playlists, err := service.playlists.ListPlaylists(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, playlists)
+}
@@ -1065,16 +1065,26 @@ func (s *LocalizationService) getMediaPlayerConfig(ctx context.Context, userID i
 	}, nil
 }
 
-func (s *LocalizationService) getPlaylistConfig(ctx context.Context, userID int64) (*PlaylistConfig, error) {
-	// This would typically fetch from a user_playlist_settings table
-	// For now, return default settings
+// DefaultPlaylistConfig returns the playlist settings users start with.
+func DefaultPlaylistConfig() *PlaylistConfig {
 	return &PlaylistConfig{
 		AutoCreatePlaylists:  true,
 		SmartPlaylistRules:   []string{"recently_played", "top_rated"},
 		DefaultPlaylistType:  "standard",
 		CollaborativeDefault: false,
 		PublicDefault:        false,
-	}, nil
+	}
+}
+
+// GetPlaylistConfig returns a user's playlist settings.
+func (s *LocalizationService) GetPlaylistConfig(ctx context.Context, userID int64) (*PlaylistConfig, error) {
+	return s.getPlaylistConfig(ctx, userID)
+}
+
+func (s *LocalizationService) getPlaylistConfig(ctx context.Context, userID int64) (*PlaylistConfig, error) {
+	// This would typically fetch from a user_playlist_settings table
+	// For now, return default settings
+	return DefaultPlaylistConfig(), nil
 }
 
 func (s *LocalizationService) validateConfiguration(config *ConfigurationExport) []string {
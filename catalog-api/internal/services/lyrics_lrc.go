@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lrcTimestampPattern matches an LRC time tag such as [01:02.34],
+// [01:02.345] or [01:02].
+var lrcTimestampPattern = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// lrcTagPattern matches an LRC metadata tag such as [ar:Artist].
+var lrcTagPattern = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]\s*$`)
+
+// ParseLRC parses LRC timed lyrics. A line may carry several time tags and
+// is repeated at each of them. Lines are returned in time order, each
+// ending where the next one starts; the [offset:ms] tag is applied, where
+// a positive offset shows lyrics earlier. Other metadata tags such as
+// [ar:], [ti:] and [al:] are returned by name. Content without time tags
+// yields no lines.
+func ParseLRC(content string) ([]LyricsLine, map[string]string) {
+	var lines []LyricsLine
+	tags := map[string]string{}
+
+	for _, raw := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		var times []float64
+		for {
+			m := lrcTimestampPattern.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			times = append(times, lrcSeconds(m[1], m[2], m[3]))
+			line = line[len(m[0]):]
+		}
+		if len(times) == 0 {
+			if m := lrcTagPattern.FindStringSubmatch(line); m != nil {
+				tags[strings.ToLower(m[1])] = strings.TrimSpace(m[2])
+			}
+			continue
+		}
+		text := strings.TrimSpace(line)
+		for _, t := range times {
+			lines = append(lines, LyricsLine{StartTime: t, Text: text})
+		}
+	}
+
+	if offset, err := strconv.ParseFloat(strings.TrimPrefix(tags["offset"], "+"), 64); err == nil && offset != 0 {
+		for i := range lines {
+			lines[i].StartTime = math.Max(0, lines[i].StartTime-offset/1000)
+		}
+	}
+	delete(tags, "offset")
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].StartTime < lines[j].StartTime })
+	for i := 0; i+1 < len(lines); i++ {
+		end := lines[i+1].StartTime
+		lines[i].EndTime = &end
+	}
+	return lines, tags
+}
+
+// lrcSeconds converts the parts of an LRC time tag to seconds. The
+// fraction is read as tenths, hundredths or thousandths by its length.
+func lrcSeconds(minutes, seconds, fraction string) float64 {
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	total := float64(m*60 + s)
+	if fraction != "" {
+		f, _ := strconv.Atoi(fraction)
+		total += float64(f) / math.Pow(10, float64(len(fraction)))
+	}
+	return total
+}
+
+// FormatLRC writes timed lyrics as LRC with hundredth-second time tags,
+// preceded by the given metadata tags in name order.
+func FormatLRC(lines []LyricsLine, tags map[string]string) string {
+	var b strings.Builder
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "[%s:%s]\n", name, tags[name])
+	}
+	for _, line := range lines {
+		centis := int64(math.Round(line.StartTime * 100))
+		fmt.Fprintf(&b, "[%02d:%02d.%02d]%s\n", centis/6000, (centis/100)%60, centis%100, line.Text)
+	}
+	return b.String()
+}
+
+// lrcPlainText returns the text of timed lyrics, one line per entry.
+func lrcPlainText(lines []LyricsLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "\n")
+}
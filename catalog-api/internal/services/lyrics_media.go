@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LyricsPreferenceSource provides users' lyrics language priority lists and
+// whether lyrics are fetched automatically. LocalizationService implements
+// it.
+type LyricsPreferenceSource interface {
+	GetPreferredLanguagesForContent(ctx context.Context, userID int64, contentType string) ([]string, error)
+	ShouldAutoDownload(ctx context.Context, userID int64, contentType string) (bool, error)
+}
+
+// SetPreferenceSource sets where users' lyrics settings are read from.
+// Without one lyrics are looked up in English and fetched automatically.
+func (s *LyricsService) SetPreferenceSource(source LyricsPreferenceSource) {
+	s.preferences = source
+}
+
+// normalizeLyricsLanguage reduces a language tag such as "en-US" to its
+// lower-case primary subtag. Anything that is not a language code becomes
+// "und".
+func normalizeLyricsLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	if len(language) < 2 || len(language) > 3 {
+		return "und"
+	}
+	return language
+}
+
+// lyricsLanguages returns the languages to look for in order, and whether
+// they were asked for explicitly. Without an explicit language the user's
+// lyrics language priority list is used.
+func (s *LyricsService) lyricsLanguages(ctx context.Context, userID int64, language string) ([]string, bool) {
+	if strings.TrimSpace(language) != "" {
+		return []string{normalizeLyricsLanguage(language)}, true
+	}
+	var languages []string
+	if s.preferences != nil {
+		preferred, err := s.preferences.GetPreferredLanguagesForContent(ctx, userID, ContentTypeLyrics)
+		if err != nil {
+			s.logger.Warn("Failed to load lyrics languages", zap.Int64("user_id", userID), zap.Error(err))
+		}
+		for _, l := range preferred {
+			if l = normalizeLyricsLanguage(l); l != "und" {
+				languages = append(languages, l)
+			}
+		}
+	}
+	if len(languages) == 0 {
+		languages = []string{"en"}
+	}
+	return languages, false
+}
+
+// autoDownloadLyrics reports whether lyrics missing from the cache are
+// fetched from providers for the user. It defaults to true.
+func (s *LyricsService) autoDownloadLyrics(ctx context.Context, userID int64) bool {
+	if s.preferences == nil {
+		return true
+	}
+	enabled, err := s.preferences.ShouldAutoDownload(ctx, userID, ContentTypeLyrics)
+	if err != nil {
+		s.logger.Warn("Failed to load lyrics settings", zap.Int64("user_id", userID), zap.Error(err))
+		return true
+	}
+	return enabled
+}
+
+// lyricsTrack is the catalog metadata lyrics are searched by. A song's
+// album and artist are its parent and grandparent media items.
+type lyricsTrack struct {
+	title, artist, album, language string
+}
+
+func (s *LyricsService) loadLyricsTrack(ctx context.Context, mediaItemID int64) (*lyricsTrack, error) {
+	var track lyricsTrack
+	var parentType, parentTitle, grandparentTitle string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT mi.title, COALESCE(mi.language, ''), COALESCE(pt.name, ''), COALESCE(p.title, ''), COALESCE(gp.title, '')
+		 FROM media_items mi
+		 LEFT JOIN media_items p ON p.id = mi.parent_id
+		 LEFT JOIN media_types pt ON pt.id = p.media_type_id
+		 LEFT JOIN media_items gp ON gp.id = p.parent_id
+		 WHERE mi.id = ? AND mi.deleted_at IS NULL`, mediaItemID).Scan(
+		&track.title, &track.language, &parentType, &parentTitle, &grandparentTitle)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("media item %d not found", mediaItemID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media item %d: %w", mediaItemID, err)
+	}
+	switch parentType {
+	case "music_album":
+		track.album, track.artist = parentTitle, grandparentTitle
+	case "music_artist":
+		track.artist = parentTitle
+	}
+	track.language = normalizeLyricsLanguage(track.language)
+	return &track, nil
+}
+
+// GetMediaLyrics returns lyrics for a media item in the given language, or
+// when language is empty, in the first language of the user's priority
+// list that has lyrics, falling back to lyrics in any language. Cached
+// lyrics are returned when present; otherwise, or when refresh is set,
+// the providers are searched if the user fetches lyrics automatically and
+// the best match is cached. Results without a language are taken to be in
+// the track's language.
+func (s *LyricsService) GetMediaLyrics(ctx context.Context, userID, mediaItemID int64, language string, refresh bool) (*LyricsData, error) {
+	track, err := s.loadLyricsTrack(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	languages, explicit := s.lyricsLanguages(ctx, userID, language)
+
+	if !refresh {
+		cached, err := s.listMediaLyrics(ctx, mediaItemID)
+		if err != nil {
+			return nil, err
+		}
+		if i := pickLyrics(len(cached), languages, explicit, func(i int) string { return cached[i].Language }); i >= 0 {
+			return &cached[i], nil
+		}
+		if !s.autoDownloadLyrics(ctx, userID) {
+			return nil, fmt.Errorf("lyrics not found")
+		}
+	}
+
+	request := &LyricsSearchRequest{
+		MediaItemID: mediaItemID,
+		Title:       track.title,
+		Artist:      track.artist,
+		Languages:   languages,
+	}
+	if track.album != "" {
+		request.Album = &track.album
+	}
+	results, err := s.SearchLyrics(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].LanguageCode == "" {
+			results[i].LanguageCode = track.language
+		}
+		results[i].LanguageCode = normalizeLyricsLanguage(results[i].LanguageCode)
+	}
+	i := pickLyrics(len(results), languages, explicit, func(i int) string { return results[i].LanguageCode })
+	if i < 0 {
+		return nil, fmt.Errorf("lyrics not found")
+	}
+	best := results[i]
+
+	now := time.Now()
+	lyrics := &LyricsData{
+		ID:          generateLyricsID(),
+		MediaItemID: mediaItemID,
+		Source:      string(best.Provider),
+		Language:    best.LanguageCode,
+		Content:     best.Content,
+		IsSynced:    best.IsSynced,
+		SyncData:    best.SyncData,
+		CreatedAt:   now,
+		CachedAt:    &now,
+	}
+	if err := s.saveLyricsData(ctx, lyrics); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Lyrics cached",
+		zap.Int64("media_item_id", mediaItemID),
+		zap.String("provider", lyrics.Source),
+		zap.String("language", lyrics.Language),
+		zap.Bool("synced", lyrics.IsSynced))
+	return lyrics, nil
+}
+
+// pickLyrics returns the index of the first of n candidates in the first
+// of the languages that has one, or -1. Unless the languages were asked
+// for explicitly it falls back to the first candidate.
+func pickLyrics(n int, languages []string, explicit bool, language func(i int) string) int {
+	for _, l := range languages {
+		for i := 0; i < n; i++ {
+			if language(i) == l {
+				return i
+			}
+		}
+	}
+	if !explicit && n > 0 {
+		return 0
+	}
+	return -1
+}
+
+// SetMediaLyrics stores lyrics supplied by a user for a media item,
+// replacing cached lyrics in that language. LRC content is stored as
+// timed lyrics.
+func (s *LyricsService) SetMediaLyrics(ctx context.Context, mediaItemID int64, language, content string) (*LyricsData, error) {
+	language = normalizeLyricsLanguage(language)
+	content = strings.TrimSpace(content)
+	if language == "und" {
+		return nil, fmt.Errorf("invalid lyrics: language is required")
+	}
+	if content == "" {
+		return nil, fmt.Errorf("invalid lyrics: content is required")
+	}
+	if _, err := s.loadLyricsTrack(ctx, mediaItemID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	lyrics := &LyricsData{
+		ID:          generateLyricsID(),
+		MediaItemID: mediaItemID,
+		Source:      "user",
+		Language:    language,
+		Content:     content,
+		CreatedAt:   now,
+		CachedAt:    &now,
+	}
+	if lines, _ := ParseLRC(content); len(lines) > 0 {
+		lyrics.IsSynced = true
+		lyrics.SyncData = lines
+		lyrics.Content = lrcPlainText(lines)
+	}
+	if err := s.saveLyricsData(ctx, lyrics); err != nil {
+		return nil, err
+	}
+	return lyrics, nil
+}
+
+// DeleteMediaLyrics removes a media item's cached lyrics in a language,
+// or in every language when language is empty, so they are fetched again.
+func (s *LyricsService) DeleteMediaLyrics(ctx context.Context, mediaItemID int64, language string) error {
+	query, args := `DELETE FROM lyrics_data WHERE media_item_id = ?`, []interface{}{mediaItemID}
+	if strings.TrimSpace(language) != "" {
+		query += ` AND language = ?`
+		args = append(args, normalizeLyricsLanguage(language))
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete lyrics: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("lyrics not found")
+	}
+	return nil
+}
+
+const lyricsDataColumns = `id, media_item_id, source, language, content, is_synced,
+	sync_data, translations, created_at, cached_at`
+
+type lyricsScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLyricsData scans a lyrics_data row selected with lyricsDataColumns.
+func (s *LyricsService) scanLyricsData(row lyricsScanner) (*LyricsData, error) {
+	var lyrics LyricsData
+	var syncDataJSON, translationsJSON sql.NullString
+	var cachedAt sql.NullTime
+
+	if err := row.Scan(
+		&lyrics.ID, &lyrics.MediaItemID, &lyrics.Source, &lyrics.Language,
+		&lyrics.Content, &lyrics.IsSynced, &syncDataJSON, &translationsJSON,
+		&lyrics.CreatedAt, &cachedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if cachedAt.Valid {
+		lyrics.CachedAt = &cachedAt.Time
+	}
+	if syncDataJSON.Valid && syncDataJSON.String != "" {
+		if err := json.Unmarshal([]byte(syncDataJSON.String), &lyrics.SyncData); err != nil {
+			s.logger.Warn("Failed to parse sync data", zap.Error(err))
+		}
+	}
+	if translationsJSON.Valid && translationsJSON.String != "" {
+		if err := json.Unmarshal([]byte(translationsJSON.String), &lyrics.Translations); err != nil {
+			s.logger.Warn("Failed to parse translations", zap.Error(err))
+		}
+	}
+	return &lyrics, nil
+}
+
+// listMediaLyrics returns a media item's cached lyrics, newest first.
+func (s *LyricsService) listMediaLyrics(ctx context.Context, mediaItemID int64) ([]LyricsData, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+lyricsDataColumns+` FROM lyrics_data WHERE media_item_id = ? ORDER BY created_at DESC`, mediaItemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lyrics: %w", err)
+	}
+	defer rows.Close()
+	var lyrics []LyricsData
+	for rows.Next() {
+		l, err := s.scanLyricsData(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan lyrics: %w", err)
+		}
+		lyrics = append(lyrics, *l)
+	}
+	return lyrics, rows.Err()
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseLRC(t *testing.T) {
+	lines, tags := ParseLRC("[ar:Miles Davis]\r\n[ti:So What]\n[offset:+500]\n[00:10.50][01:00.00]Chorus\n[00:05.2]Intro\nnot timed\n[00:20.123]Verse\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, map[string]string{"ar": "Miles Davis", "ti": "So What"}, tags)
+
+	assert.Equal(t, "Intro", lines[0].Text)
+	assert.InDelta(t, 4.7, lines[0].StartTime, 0.001)
+	require.NotNil(t, lines[0].EndTime)
+	assert.InDelta(t, 10.0, *lines[0].EndTime, 0.001)
+	assert.Equal(t, "Chorus", lines[1].Text)
+	assert.InDelta(t, 19.623, lines[2].StartTime, 0.001)
+	assert.Equal(t, "Chorus", lines[3].Text)
+	assert.Nil(t, lines[3].EndTime)
+
+	assert.Equal(t, "[ti:So What]\n[00:04.70]Intro\n[00:10.00]Chorus\n", FormatLRC(lines[:2], map[string]string{"ti": "So What"}))
+
+	lines, _ = ParseLRC("Just plain\nlyrics")
+	assert.Empty(t, lines)
+}
+
+func newLRCLIBTestServer(t *testing.T, records []lrclibRecord) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			var matched []lrclibRecord
+			for _, record := range records {
+				if record.TrackName == r.URL.Query().Get("track_name") {
+					matched = append(matched, record)
+				}
+			}
+			json.NewEncoder(w).Encode(matched)
+		case "/get/2":
+			json.NewEncoder(w).Encode(records[1])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLRCLIBProvider(t *testing.T) {
+	server := newLRCLIBTestServer(t, []lrclibRecord{
+		{ID: 1, TrackName: "So What", ArtistName: "Someone Else", PlainLyrics: "Cover"},
+		{ID: 2, TrackName: "So What", ArtistName: "Miles Davis", AlbumName: "Kind of Blue",
+			PlainLyrics: "Hum", SyncedLyrics: "[00:01.00]Hum"},
+		{ID: 3, TrackName: "So What", ArtistName: "Miles Davis", Instrumental: true},
+	})
+	provider := NewLRCLIBProvider(server.URL, nil)
+	ctx := context.Background()
+
+	results, err := provider.Search(ctx, &LyricsSearchRequest{Title: "Freddie Freeloader"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = provider.Search(ctx, &LyricsSearchRequest{Title: "So What", Artist: "Miles Davis"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, 0.8, results[0].MatchScore)
+	assert.Equal(t, "lrclib_2", results[1].ID)
+	assert.Equal(t, 1.0, results[1].MatchScore)
+	assert.True(t, results[1].IsSynced)
+	assert.Equal(t, "Kind of Blue", *results[1].Album)
+
+	fetched, err := provider.Fetch(ctx, "lrclib_2")
+	require.NoError(t, err)
+	assert.Equal(t, "Hum", fetched.Content)
+	_, err = provider.Fetch(ctx, "lrclib_9")
+	assert.ErrorContains(t, err, "not found")
+}
+
+type stubLyricsPreferences struct {
+	languages    []string
+	autoDownload bool
+}
+
+func (s stubLyricsPreferences) GetPreferredLanguagesForContent(ctx context.Context, userID int64, contentType string) ([]string, error) {
+	return s.languages, nil
+}
+
+func (s stubLyricsPreferences) ShouldAutoDownload(ctx context.Context, userID int64, contentType string) (bool, error) {
+	return s.autoDownload, nil
+}
+
+func newLyricsTestService(t *testing.T) (*LyricsService, *database.DB, string) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	rootDir := t.TempDir()
+	_, err = sqlDB.Exec(`
+		CREATE TABLE media_types (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TABLE media_items (
+			id INTEGER PRIMARY KEY,
+			media_type_id INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			language TEXT,
+			parent_id INTEGER,
+			deleted_at DATETIME
+		);
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			deleted BOOLEAN NOT NULL DEFAULT 0
+		);
+		CREATE TABLE media_files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_item_id INTEGER NOT NULL,
+			file_id INTEGER NOT NULL,
+			is_primary BOOLEAN DEFAULT 0
+		);
+		CREATE TABLE lyrics_data (
+			id TEXT PRIMARY KEY,
+			media_item_id INTEGER NOT NULL,
+			source TEXT NOT NULL,
+			language TEXT NOT NULL,
+			content TEXT NOT NULL,
+			is_synced BOOLEAN NOT NULL DEFAULT FALSE,
+			sync_data TEXT,
+			translations TEXT,
+			created_at DATETIME NOT NULL,
+			cached_at DATETIME,
+			UNIQUE (media_item_id, language)
+		);
+		INSERT INTO media_types (id, name) VALUES (1, 'music_artist'), (2, 'music_album'), (3, 'song');
+		INSERT INTO media_items (id, media_type_id, title, language, parent_id) VALUES
+			(1, 1, 'Miles Davis', NULL, NULL),
+			(2, 2, 'Kind of Blue', NULL, 1),
+			(3, 3, 'So What', 'en', 2),
+			(4, 3, 'Blue in Green', 'English', 2);
+		INSERT INTO media_files (media_item_id, file_id, is_primary) VALUES (3, 30, 1), (4, 40, 1);`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO storage_roots (id, name, protocol, path) VALUES (1, 'nas', 'local', ?)`, rootDir)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO files (id, storage_root_id, path) VALUES (30, 1, 'music/So What.flac'), (40, 1, 'music/Blue in Green.flac')`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewLyricsService(db, zap.NewNop()), db, rootDir
+}
+
+func TestLyricsService_GetMediaLyrics(t *testing.T) {
+	service, db, rootDir := newLyricsTestService(t)
+	server := newLRCLIBTestServer(t, []lrclibRecord{
+		{ID: 1, TrackName: "Blue in Green", ArtistName: "Miles Davis", PlainLyrics: "Instrumental, mostly"},
+		{ID: 2, TrackName: "So What", ArtistName: "Miles Davis", SyncedLyrics: "[00:01.00]So what\n[00:03.00]Indeed"},
+	})
+	service.SetProviders(NewLRCLIBProvider(server.URL, nil))
+	service.SetStorageClients(localRootClients{})
+	service.SetPreferenceSource(stubLyricsPreferences{languages: []string{"de", "en"}, autoDownload: true})
+	ctx := context.Background()
+
+	// A German LRC file next to the track wins over the online provider
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "music"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "music", "So What.de.lrc"),
+		[]byte("[ti:So What]\n[00:02.00]Na und"), 0644))
+
+	lyrics, err := service.GetMediaLyrics(ctx, 7, 3, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "embedded", lyrics.Source)
+	assert.Equal(t, "de", lyrics.Language)
+	assert.Equal(t, "Na und", lyrics.Content)
+	assert.True(t, lyrics.IsSynced)
+
+	// Asking for English fetches from LRCLIB, whose lyrics are taken to be
+	// in the track's language, and caches them next to the German ones
+	lyrics, err = service.GetMediaLyrics(ctx, 7, 3, "en-US", false)
+	require.NoError(t, err)
+	assert.Equal(t, "lrclib", lyrics.Source)
+	assert.Equal(t, "en", lyrics.Language)
+	require.Len(t, lyrics.SyncData, 2)
+	assert.InDelta(t, 3.0, *lyrics.SyncData[0].EndTime, 0.001)
+	var cached int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM lyrics_data WHERE media_item_id = 3`).Scan(&cached))
+	assert.Equal(t, 2, cached)
+
+	// Cached lyrics are served without asking providers again
+	server.Close()
+	lyrics, err = service.GetMediaLyrics(ctx, 7, 3, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "de", lyrics.Language)
+	lyrics, err = service.GetMediaLyrics(ctx, 7, 3, "en", false)
+	require.NoError(t, err)
+	assert.Equal(t, "lrclib", lyrics.Source)
+	_, err = service.GetMediaLyrics(ctx, 7, 3, "fr", false)
+	assert.ErrorContains(t, err, "lyrics not found")
+
+	_, err = service.GetMediaLyrics(ctx, 7, 99, "", false)
+	assert.ErrorContains(t, err, "media item 99 not found")
+}
+
+func TestLyricsService_PriorityFallbackAndAutoDownload(t *testing.T) {
+	service, _, _ := newLyricsTestService(t)
+	server := newLRCLIBTestServer(t, []lrclibRecord{
+		{ID: 1, TrackName: "Blue in Green", ArtistName: "Miles Davis", PlainLyrics: "Blue"},
+	})
+	service.SetProviders(NewLRCLIBProvider(server.URL, nil))
+	ctx := context.Background()
+
+	// Automatic fetching is off: nothing is looked up
+	service.SetPreferenceSource(stubLyricsPreferences{languages: []string{"fr"}})
+	_, err := service.GetMediaLyrics(ctx, 7, 4, "", false)
+	assert.ErrorContains(t, err, "lyrics not found")
+
+	// The track's language is not a code, so the lyrics are "und"; with no
+	// French lyrics the original ones are returned
+	service.SetPreferenceSource(stubLyricsPreferences{languages: []string{"fr"}, autoDownload: true})
+	lyrics, err := service.GetMediaLyrics(ctx, 7, 4, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "und", lyrics.Language)
+	assert.Equal(t, "Blue", lyrics.Content)
+	assert.False(t, lyrics.IsSynced)
+}
+
+func TestLyricsService_SetAndDeleteMediaLyrics(t *testing.T) {
+	service, _, _ := newLyricsTestService(t)
+	service.SetProviders()
+	ctx := context.Background()
+
+	lyrics, err := service.SetMediaLyrics(ctx, 3, "EN", "[00:01.00]So what\n[00:02.50]Indeed")
+	require.NoError(t, err)
+	assert.Equal(t, "user", lyrics.Source)
+	assert.True(t, lyrics.IsSynced)
+	assert.Equal(t, "So what\nIndeed", lyrics.Content)
+
+	// Replaces the cached English lyrics
+	_, err = service.SetMediaLyrics(ctx, 3, "en", "Plain words")
+	require.NoError(t, err)
+	got, err := service.GetMediaLyrics(ctx, 7, 3, "en", false)
+	require.NoError(t, err)
+	assert.Equal(t, "Plain words", got.Content)
+	assert.False(t, got.IsSynced)
+
+	latest, err := service.GetLyrics(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "Plain words", latest.Content)
+
+	_, err = service.SetMediaLyrics(ctx, 3, "", "words")
+	assert.ErrorContains(t, err, "invalid lyrics")
+	_, err = service.SetMediaLyrics(ctx, 3, "en", " ")
+	assert.ErrorContains(t, err, "invalid lyrics")
+	_, err = service.SetMediaLyrics(ctx, 99, "en", "words")
+	assert.ErrorContains(t, err, "not found")
+
+	require.NoError(t, service.DeleteMediaLyrics(ctx, 3, "en"))
+	assert.ErrorContains(t, service.DeleteMediaLyrics(ctx, 3, "en"), "lyrics not found")
+	_, err = service.GetMediaLyrics(ctx, 7, 3, "en", false)
+	assert.ErrorContains(t, err, "lyrics not found")
+}
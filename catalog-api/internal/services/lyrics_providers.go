@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"catalogizer/database"
+
+	"go.uber.org/zap"
+)
+
+// LyricsProviderLRCLIB is the lrclib.net lyrics database, which serves
+// plain and LRC timed lyrics without an API key.
+const LyricsProviderLRCLIB LyricsProvider = "lrclib"
+
+// defaultLRCLIBURL is the API used for LRCLIB unless NewLRCLIBProvider is
+// given a compatible mirror.
+const defaultLRCLIBURL = "https://lrclib.net/api"
+
+// maxSidecarLyricsSize caps the lyrics files read from storage roots.
+const maxSidecarLyricsSize = 1 << 20
+
+// LyricsProviderAdapter fetches lyrics from one source. Result IDs start
+// with the provider name and an underscore so a result can be fetched
+// again by ID.
+type LyricsProviderAdapter interface {
+	Provider() LyricsProvider
+	Search(ctx context.Context, request *LyricsSearchRequest) ([]LyricsSearchResult, error)
+	Fetch(ctx context.Context, resultID string) (*LyricsSearchResult, error)
+}
+
+// SetProviders replaces the online lyrics providers, which are searched in
+// the given order. Lyrics files next to the media are always searched
+// first when storage clients are set.
+func (s *LyricsService) SetProviders(providers ...LyricsProviderAdapter) {
+	s.providers = providers
+}
+
+// SetStorageClients enables reading .lrc and .txt lyrics files stored next
+// to a track's media file on its storage root.
+func (s *LyricsService) SetStorageClients(clients storageClientProvider) {
+	s.clients = clients
+}
+
+// adapters returns the providers to search, lyrics files first.
+func (s *LyricsService) adapters() []LyricsProviderAdapter {
+	var adapters []LyricsProviderAdapter
+	if s.clients != nil && s.db != nil {
+		adapters = append(adapters, &sidecarLyricsProvider{db: s.db, clients: s.clients, logger: s.logger})
+	}
+	return append(adapters, s.providers...)
+}
+
+// adapter returns the provider with the given name.
+func (s *LyricsService) adapter(provider LyricsProvider) (LyricsProviderAdapter, error) {
+	for _, a := range s.adapters() {
+		if a.Provider() == provider {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", provider)
+}
+
+// lyricsMatchScore rates how well a provider's track matches the request:
+// 1 when title and artist match, 0.8 for the title alone and 0.5
+// otherwise.
+func lyricsMatchScore(request *LyricsSearchRequest, title, artist string) float64 {
+	titleMatch := strings.EqualFold(strings.TrimSpace(title), strings.TrimSpace(request.Title))
+	artistMatch := request.Artist == "" || strings.EqualFold(strings.TrimSpace(artist), strings.TrimSpace(request.Artist))
+	switch {
+	case titleMatch && artistMatch:
+		return 1.0
+	case titleMatch:
+		return 0.8
+	}
+	return 0.5
+}
+
+// LRCLIBProvider searches an LRCLIB-compatible API.
+type LRCLIBProvider struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewLRCLIBProvider creates a provider for the LRCLIB API at baseURL, or
+// lrclib.net when baseURL is empty.
+func NewLRCLIBProvider(baseURL string, httpClient *http.Client) *LRCLIBProvider {
+	if baseURL == "" {
+		baseURL = defaultLRCLIBURL
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &LRCLIBProvider{baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
+}
+
+// lrclibRecord is a track in LRCLIB API responses.
+type lrclibRecord struct {
+	ID           int64   `json:"id"`
+	TrackName    string  `json:"trackName"`
+	ArtistName   string  `json:"artistName"`
+	AlbumName    string  `json:"albumName"`
+	Duration     float64 `json:"duration"`
+	Instrumental bool    `json:"instrumental"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	SyncedLyrics string  `json:"syncedLyrics"`
+}
+
+// Provider implements LyricsProviderAdapter.
+func (p *LRCLIBProvider) Provider() LyricsProvider { return LyricsProviderLRCLIB }
+
+// Search implements LyricsProviderAdapter. Instrumental tracks and tracks
+// without lyrics are skipped.
+func (p *LRCLIBProvider) Search(ctx context.Context, request *LyricsSearchRequest) ([]LyricsSearchResult, error) {
+	params := url.Values{}
+	params.Set("track_name", request.Title)
+	if request.Artist != "" {
+		params.Set("artist_name", request.Artist)
+	}
+	if request.Album != nil && *request.Album != "" {
+		params.Set("album_name", *request.Album)
+	}
+
+	var records []lrclibRecord
+	if err := p.get(ctx, "/search?"+params.Encode(), &records); err != nil {
+		return nil, err
+	}
+	results := []LyricsSearchResult{}
+	for _, record := range records {
+		if result := p.result(record, request); result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
+// Fetch implements LyricsProviderAdapter.
+func (p *LRCLIBProvider) Fetch(ctx context.Context, resultID string) (*LyricsSearchResult, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(resultID, string(LyricsProviderLRCLIB)+"_"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lrclib result ID: %s", resultID)
+	}
+	var record lrclibRecord
+	if err := p.get(ctx, "/get/"+strconv.FormatInt(id, 10), &record); err != nil {
+		return nil, err
+	}
+	result := p.result(record, &LyricsSearchRequest{Title: record.TrackName, Artist: record.ArtistName})
+	if result == nil {
+		return nil, fmt.Errorf("lyrics not found: %s", resultID)
+	}
+	return result, nil
+}
+
+func (p *LRCLIBProvider) get(ctx context.Context, endpoint string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", subtitleUserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("lyrics not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lrclib returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// result converts an LRCLIB record, preferring its timed lyrics. LRCLIB
+// does not say which language lyrics are in.
+func (p *LRCLIBProvider) result(record lrclibRecord, request *LyricsSearchRequest) *LyricsSearchResult {
+	if record.Instrumental || (record.PlainLyrics == "" && record.SyncedLyrics == "") {
+		return nil
+	}
+	result := &LyricsSearchResult{
+		ID:         fmt.Sprintf("%s_%d", LyricsProviderLRCLIB, record.ID),
+		Provider:   LyricsProviderLRCLIB,
+		Title:      record.TrackName,
+		Artist:     record.ArtistName,
+		Content:    record.PlainLyrics,
+		Source:     "lrclib.net",
+		Confidence: 0.8,
+		MatchScore: lyricsMatchScore(request, record.TrackName, record.ArtistName),
+	}
+	if record.AlbumName != "" {
+		album := record.AlbumName
+		result.Album = &album
+	}
+	if lines, _ := ParseLRC(record.SyncedLyrics); len(lines) > 0 {
+		result.IsSynced = true
+		result.SyncData = lines
+		result.Confidence = 0.9
+		if result.Content == "" {
+			result.Content = lrcPlainText(lines)
+		}
+	}
+	return result
+}
+
+// sidecarLyricsProvider reads lyrics files stored next to a track's
+// primary media file: <name>.<language>.lrc or <name>.lrc, then the same
+// with .txt. LRC files give timed lyrics.
+type sidecarLyricsProvider struct {
+	db      *database.DB
+	clients storageClientProvider
+	logger  *zap.Logger
+}
+
+// Provider implements LyricsProviderAdapter.
+func (p *sidecarLyricsProvider) Provider() LyricsProvider { return LyricsProviderEmbedded }
+
+// Search implements LyricsProviderAdapter. It needs the request's media
+// item and returns one result per lyrics file found.
+func (p *sidecarLyricsProvider) Search(ctx context.Context, request *LyricsSearchRequest) ([]LyricsSearchResult, error) {
+	if request.MediaItemID == 0 {
+		return []LyricsSearchResult{}, nil
+	}
+	var suffixes []string
+	for _, ext := range []string{"lrc", "txt"} {
+		for _, language := range request.Languages {
+			suffixes = append(suffixes, strings.ToLower(language)+"."+ext)
+		}
+		suffixes = append(suffixes, ext)
+	}
+	return p.read(ctx, request.MediaItemID, suffixes)
+}
+
+// Fetch implements LyricsProviderAdapter. Result IDs are
+// embedded_<media item>_<file suffix>.
+func (p *sidecarLyricsProvider) Fetch(ctx context.Context, resultID string) (*LyricsSearchResult, error) {
+	parts := strings.SplitN(strings.TrimPrefix(resultID, string(LyricsProviderEmbedded)+"_"), "_", 2)
+	mediaItemID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return nil, fmt.Errorf("invalid embedded lyrics result ID: %s", resultID)
+	}
+	results, err := p.read(ctx, mediaItemID, []string{parts[1]})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("lyrics not found: %s", resultID)
+	}
+	return &results[0], nil
+}
+
+// read returns the lyrics files with the given suffixes that exist next
+// to the media item's primary file.
+func (p *sidecarLyricsProvider) read(ctx context.Context, mediaItemID int64, suffixes []string) ([]LyricsSearchResult, error) {
+	var rootName, mediaPath string
+	err := p.db.QueryRowContext(ctx,
+		`SELECT sr.name, f.path FROM media_files mf
+		 JOIN files f ON f.id = mf.file_id
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE mf.media_item_id = ? AND f.deleted = ?
+		 ORDER BY mf.is_primary DESC, mf.id LIMIT 1`, mediaItemID, false).Scan(&rootName, &mediaPath)
+	if err == sql.ErrNoRows {
+		return []LyricsSearchResult{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media file: %w", err)
+	}
+
+	root, err := loadStorageRootByName(ctx, p.db, rootName)
+	if err != nil {
+		return nil, err
+	}
+	client, err := p.clients.NewClient(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s: %w", rootName, err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", rootName, err)
+	}
+	defer client.Disconnect(ctx)
+
+	base := strings.TrimSuffix(mediaPath, path.Ext(mediaPath))
+	results := []LyricsSearchResult{}
+	for _, suffix := range suffixes {
+		filePath := base + "." + suffix
+		exists, err := client.FileExists(ctx, filePath)
+		if err != nil || !exists {
+			continue
+		}
+		reader, err := client.ReadFile(ctx, filePath)
+		if err != nil {
+			p.logger.Warn("Failed to read lyrics file", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, maxSidecarLyricsSize))
+		reader.Close()
+		if err != nil || strings.TrimSpace(string(data)) == "" {
+			continue
+		}
+
+		result := LyricsSearchResult{
+			ID:         fmt.Sprintf("%s_%d_%s", LyricsProviderEmbedded, mediaItemID, suffix),
+			Provider:   LyricsProviderEmbedded,
+			Content:    strings.TrimSpace(string(data)),
+			Source:     path.Base(filePath),
+			Confidence: 1.0,
+			MatchScore: 1.0,
+		}
+		if parts := strings.Split(suffix, "."); len(parts) == 2 {
+			result.LanguageCode = parts[0]
+			result.Language = getLanguageName(parts[0])
+		}
+		if lines, tags := ParseLRC(result.Content); len(lines) > 0 {
+			result.IsSynced = true
+			result.SyncData = lines
+			result.Content = lrcPlainText(lines)
+			result.Title, result.Artist = tags["ti"], tags["ar"]
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"catalogizer/database"
-	"catalogizer/utils"
 
 	"go.uber.org/zap"
 )
@@ -23,6 +22,9 @@ type LyricsService struct {
 	httpClient         *http.Client
 	apiKeys            map[string]string
 	cacheDir           string
+	providers          []LyricsProviderAdapter
+	clients            storageClientProvider
+	preferences        LyricsPreferenceSource
 }
 
 // LyricsProvider represents different lyrics providers
@@ -39,14 +41,15 @@ const (
 
 // LyricsSearchRequest represents a lyrics search request
 type LyricsSearchRequest struct {
-	Title      string           `json:"title"`
-	Artist     string           `json:"artist"`
-	Album      *string          `json:"album,omitempty"`
-	Duration   *float64         `json:"duration,omitempty"`
-	Languages  []string         `json:"languages,omitempty"`
-	Providers  []LyricsProvider `json:"providers,omitempty"`
-	SyncedOnly bool             `json:"synced_only"`
-	UseCache   bool             `json:"use_cache"`
+	MediaItemID int64            `json:"media_item_id,omitempty"`
+	Title       string           `json:"title"`
+	Artist      string           `json:"artist"`
+	Album       *string          `json:"album,omitempty"`
+	Duration    *float64         `json:"duration,omitempty"`
+	Languages   []string         `json:"languages,omitempty"`
+	Providers   []LyricsProvider `json:"providers,omitempty"`
+	SyncedOnly  bool             `json:"synced_only"`
+	UseCache    bool             `json:"use_cache"`
 }
 
 // LyricsSearchResult represents a lyrics search result
@@ -117,13 +120,15 @@ type SyncedLyricsLine struct {
 
 // NewLyricsService creates a new lyrics service
 func NewLyricsService(db *database.DB, logger *zap.Logger) *LyricsService {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
 	return &LyricsService{
 		db:                 db,
 		logger:             logger,
 		translationService: NewTranslationService(logger),
-		httpClient:         &http.Client{Timeout: 30 * time.Second},
+		httpClient:         httpClient,
 		apiKeys:            make(map[string]string),
 		cacheDir:           "./cache/lyrics",
+		providers:          []LyricsProviderAdapter{NewLRCLIBProvider("", httpClient)},
 	}
 }
 
@@ -142,13 +147,11 @@ func (s *LyricsService) SearchLyrics(ctx context.Context, request *LyricsSearchR
 
 	var allResults []LyricsSearchResult
 
-	// Default providers if none specified
+	// Default to every configured provider
 	providers := request.Providers
 	if len(providers) == 0 {
-		providers = []LyricsProvider{
-			LyricsProviderGenius,
-			LyricsProviderMusixmatch,
-			LyricsProviderAZLyrics,
+		for _, adapter := range s.adapters() {
+			providers = append(providers, adapter.Provider())
 		}
 	}
 
@@ -190,12 +193,16 @@ func (s *LyricsService) DownloadLyrics(ctx context.Context, request *LyricsDownl
 		return nil, fmt.Errorf("failed to get download info: %w", err)
 	}
 
+	if result.LanguageCode == "" {
+		result.LanguageCode = strings.ToLower(request.Language)
+	}
+
 	// Create lyrics data
 	lyricsData := &LyricsData{
 		ID:          generateLyricsID(),
 		MediaItemID: request.MediaItemID,
 		Source:      string(result.Provider),
-		Language:    result.Language,
+		Language:    result.LanguageCode,
 		Content:     result.Content,
 		IsSynced:    result.IsSynced,
 		SyncData:    result.SyncData,
@@ -251,7 +258,7 @@ func (s *LyricsService) TranslateLyrics(ctx context.Context, request *LyricsTran
 		ID:          generateLyricsID(),
 		MediaItemID: original.MediaItemID,
 		Source:      "translated",
-		Language:    getLanguageName(request.TargetLanguage),
+		Language:    request.TargetLanguage,
 		Content:     translatedContent.TranslatedText,
 		IsSynced:    original.IsSynced && request.PreserveTiming,
 		CreatedAt:   time.Now(),
@@ -374,122 +381,27 @@ func (s *LyricsService) GetConcertLyrics(ctx context.Context, request *ConcertLy
 	return concertLyrics, nil
 }
 
-// GetLyrics returns lyrics for a media item
+// GetLyrics returns the most recently cached lyrics for a media item
 func (s *LyricsService) GetLyrics(ctx context.Context, mediaItemID int64) (*LyricsData, error) {
-	query := `
-		SELECT id, media_item_id, source, language, content, is_synced,
-		       sync_data, translations, created_at, cached_at
-		FROM lyrics_data WHERE media_item_id = ?
-		ORDER BY created_at DESC LIMIT 1`
-
-	var lyrics LyricsData
-	var syncDataJSON, translationsJSON sql.NullString
-	var cachedAt sql.NullTime
-
-	err := s.db.QueryRowContext(ctx, query, mediaItemID).Scan(
-		&lyrics.ID, &lyrics.MediaItemID, &lyrics.Source, &lyrics.Language,
-		&lyrics.Content, &lyrics.IsSynced, &syncDataJSON, &translationsJSON,
-		&lyrics.CreatedAt, &cachedAt,
-	)
-
+	lyrics, err := s.scanLyricsData(s.db.QueryRowContext(ctx,
+		`SELECT `+lyricsDataColumns+` FROM lyrics_data WHERE media_item_id = ?
+		 ORDER BY created_at DESC LIMIT 1`, mediaItemID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No lyrics found
 		}
 		return nil, fmt.Errorf("failed to get lyrics: %w", err)
 	}
-
-	if cachedAt.Valid {
-		lyrics.CachedAt = &cachedAt.Time
-	}
-
-	// Parse sync data
-	if syncDataJSON.Valid && syncDataJSON.String != "" {
-		if err := json.Unmarshal([]byte(syncDataJSON.String), &lyrics.SyncData); err != nil {
-			s.logger.Warn("Failed to parse sync data", zap.Error(err))
-		}
-	}
-
-	// Parse translations
-	if translationsJSON.Valid && translationsJSON.String != "" {
-		if err := json.Unmarshal([]byte(translationsJSON.String), &lyrics.Translations); err != nil {
-			s.logger.Warn("Failed to parse translations", zap.Error(err))
-		}
-	}
-
-	return &lyrics, nil
+	return lyrics, nil
 }
 
-// Provider-specific implementations
+// searchProvider searches one configured provider
 func (s *LyricsService) searchProvider(ctx context.Context, provider LyricsProvider, request *LyricsSearchRequest) ([]LyricsSearchResult, error) {
-	switch provider {
-	case LyricsProviderGenius:
-		return s.searchGenius(ctx, request)
-	case LyricsProviderMusixmatch:
-		return s.searchMusixmatch(ctx, request)
-	case LyricsProviderAZLyrics:
-		return s.searchAZLyrics(ctx, request)
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", provider)
-	}
-}
-
-func (s *LyricsService) searchGenius(ctx context.Context, request *LyricsSearchRequest) ([]LyricsSearchResult, error) {
-	s.logger.Debug("Searching Genius",
-		zap.String("title", request.Title),
-		zap.String("artist", request.Artist))
-
-	// Mock implementation for demonstration
-	result := LyricsSearchResult{
-		ID:           "genius_1",
-		Provider:     LyricsProviderGenius,
-		Title:        request.Title,
-		Artist:       request.Artist,
-		Language:     "English",
-		LanguageCode: "en",
-		Content:      generateSampleLyrics(request.Title, request.Artist),
-		IsSynced:     false,
-		Source:       "genius.com",
-		Confidence:   0.95,
-		MatchScore:   0.9,
-		URL:          utils.StringPtr("https://genius.com/sample"),
-	}
-
-	return []LyricsSearchResult{result}, nil
-}
-
-func (s *LyricsService) searchMusixmatch(ctx context.Context, request *LyricsSearchRequest) ([]LyricsSearchResult, error) {
-	s.logger.Debug("Searching Musixmatch")
-
-	// Mock synced lyrics
-	syncData := []LyricsLine{
-		{StartTime: 0.0, EndTime: floatPtr(3.5), Text: "Verse 1 line 1"},
-		{StartTime: 3.5, EndTime: floatPtr(7.0), Text: "Verse 1 line 2"},
-		{StartTime: 7.0, EndTime: floatPtr(10.5), Text: "Chorus line 1"},
-		{StartTime: 10.5, EndTime: floatPtr(14.0), Text: "Chorus line 2"},
-	}
-
-	result := LyricsSearchResult{
-		ID:           "musixmatch_1",
-		Provider:     LyricsProviderMusixmatch,
-		Title:        request.Title,
-		Artist:       request.Artist,
-		Language:     "English",
-		LanguageCode: "en",
-		Content:      generateSampleLyrics(request.Title, request.Artist),
-		IsSynced:     true,
-		SyncData:     syncData,
-		Source:       "musixmatch.com",
-		Confidence:   0.88,
-		MatchScore:   0.85,
+	adapter, err := s.adapter(provider)
+	if err != nil {
+		return nil, err
 	}
-
-	return []LyricsSearchResult{result}, nil
-}
-
-func (s *LyricsService) searchAZLyrics(ctx context.Context, request *LyricsSearchRequest) ([]LyricsSearchResult, error) {
-	s.logger.Debug("Searching AZLyrics")
-	return []LyricsSearchResult{}, nil
+	return adapter.Search(ctx, request)
 }
 
 // Synchronization methods
@@ -592,38 +504,6 @@ func (s *LyricsService) sortLyricsResults(results []LyricsSearchResult) {
 	}
 }
 
-func generateSampleLyrics(title, artist string) string {
-	return fmt.Sprintf(`[Verse 1]
-Sample lyrics for "%s" by %s
-This is a demonstration of lyrics content
-With multiple lines and verses
-
-[Chorus]
-This is the chorus section
-It repeats throughout the song
-Making it memorable and catchy
-
-[Verse 2]
-Another verse with different content
-Continuing the story or theme
-Building on the first verse
-
-[Chorus]
-This is the chorus section
-It repeats throughout the song
-Making it memorable and catchy
-
-[Bridge]
-A bridge section with different melody
-Providing contrast to verses and chorus
-Leading back to the final chorus
-
-[Chorus]
-This is the chorus section
-It repeats throughout the song
-Making it memorable and catchy`, title, artist)
-}
-
 func generateLyricsID() string {
 	return fmt.Sprintf("lyrics_%d", time.Now().UnixNano())
 }
@@ -643,22 +523,15 @@ func (s *LyricsService) getCachedLyrics(ctx context.Context, title, artist strin
 	return nil
 }
 
-// getLyricsDownloadInfo retrieves download information for a lyrics result
+// getLyricsDownloadInfo fetches a search result again from the provider
+// named by its ID prefix
 func (s *LyricsService) getLyricsDownloadInfo(ctx context.Context, resultID string) (*LyricsSearchResult, error) {
-	// Mock implementation - would normally fetch from provider
-	return &LyricsSearchResult{
-		ID:           resultID,
-		Provider:     LyricsProviderGenius,
-		Title:        "Sample Title",
-		Artist:       "Sample Artist",
-		Language:     "English",
-		LanguageCode: "en",
-		Content:      "Sample lyrics content",
-		IsSynced:     false,
-		Source:       "genius.com",
-		Confidence:   0.9,
-		MatchScore:   0.85,
-	}, nil
+	provider, _, _ := strings.Cut(resultID, "_")
+	adapter, err := s.adapter(LyricsProvider(provider))
+	if err != nil {
+		return nil, err
+	}
+	return adapter.Fetch(ctx, resultID)
 }
 
 // saveLyricsData saves lyrics data to the database
@@ -673,17 +546,28 @@ func (s *LyricsService) saveLyricsData(ctx context.Context, lyrics *LyricsData)
 		return fmt.Errorf("failed to marshal translations: %w", err)
 	}
 
-	query := `
-		INSERT OR REPLACE INTO lyrics_data (id, media_item_id, source, language, content, is_synced, sync_data, translations, created_at, cached_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
 	var cachedAt interface{}
 	if lyrics.CachedAt != nil {
 		cachedAt = *lyrics.CachedAt
 	}
 
-	_, err = s.db.ExecContext(ctx, query,
+	// Lyrics are cached once per media item and language
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE lyrics_data SET id = ?, source = ?, content = ?, is_synced = ?, sync_data = ?,
+			translations = ?, created_at = ?, cached_at = ?
+		WHERE media_item_id = ? AND language = ?`,
+		lyrics.ID, lyrics.Source, lyrics.Content, lyrics.IsSynced, string(syncDataJSON),
+		string(translationsJSON), lyrics.CreatedAt, cachedAt, lyrics.MediaItemID, lyrics.Language)
+	if err != nil {
+		return fmt.Errorf("failed to save lyrics data: %w", err)
+	}
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		return nil
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO lyrics_data (id, media_item_id, source, language, content, is_synced, sync_data, translations, created_at, cached_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		lyrics.ID, lyrics.MediaItemID, lyrics.Source, lyrics.Language,
 		lyrics.Content, lyrics.IsSynced, string(syncDataJSON), string(translationsJSON),
 		lyrics.CreatedAt, cachedAt)
@@ -724,48 +608,15 @@ func (s *LyricsService) getCachedTranslation(ctx context.Context, lyricsID, targ
 
 // getLyricsData retrieves lyrics data by ID
 func (s *LyricsService) getLyricsData(ctx context.Context, lyricsID string) (*LyricsData, error) {
-	query := `
-		SELECT id, media_item_id, source, language, content, is_synced,
-		       sync_data, translations, created_at, cached_at
-		FROM lyrics_data WHERE id = ?
-	`
-
-	var lyrics LyricsData
-	var syncDataJSON, translationsJSON sql.NullString
-	var cachedAt sql.NullTime
-
-	err := s.db.QueryRowContext(ctx, query, lyricsID).Scan(
-		&lyrics.ID, &lyrics.MediaItemID, &lyrics.Source, &lyrics.Language,
-		&lyrics.Content, &lyrics.IsSynced, &syncDataJSON, &translationsJSON,
-		&lyrics.CreatedAt, &cachedAt,
-	)
-
+	lyrics, err := s.scanLyricsData(s.db.QueryRowContext(ctx,
+		`SELECT `+lyricsDataColumns+` FROM lyrics_data WHERE id = ?`, lyricsID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("lyrics not found: %s", lyricsID)
 		}
 		return nil, fmt.Errorf("failed to get lyrics data: %w", err)
 	}
-
-	if cachedAt.Valid {
-		lyrics.CachedAt = &cachedAt.Time
-	}
-
-	// Parse sync data
-	if syncDataJSON.Valid && syncDataJSON.String != "" {
-		if err := json.Unmarshal([]byte(syncDataJSON.String), &lyrics.SyncData); err != nil {
-			s.logger.Warn("Failed to parse sync data", zap.Error(err))
-		}
-	}
-
-	// Parse translations
-	if translationsJSON.Valid && translationsJSON.String != "" {
-		if err := json.Unmarshal([]byte(translationsJSON.String), &lyrics.Translations); err != nil {
-			s.logger.Warn("Failed to parse translations", zap.Error(err))
-		}
-	}
-
-	return &lyrics, nil
+	return lyrics, nil
 }
 
 // saveCachedLyricsTranslation saves a cached translation of lyrics
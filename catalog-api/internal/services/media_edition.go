@@ -0,0 +1,78 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// editionPatterns maps filename markers to edition names, most specific
+// first so "Director's Cut" is not read as a plain cut.
+var editionPatterns = []struct {
+	re      *regexp.Regexp
+	edition string
+}{
+	{regexp.MustCompile(`(?i)\bdirector'?s[ ._-]?cut\b`), "Director's Cut"},
+	{regexp.MustCompile(`(?i)\bfinal[ ._-]?cut\b`), "Final Cut"},
+	{regexp.MustCompile(`(?i)\bextended(?:[ ._-]?(?:cut|edition|version))?\b`), "Extended"},
+	{regexp.MustCompile(`(?i)\btheatrical(?:[ ._-]?(?:cut|edition|version))?\b`), "Theatrical"},
+	{regexp.MustCompile(`(?i)\bunrated\b`), "Unrated"},
+	{regexp.MustCompile(`(?i)\buncut\b`), "Uncut"},
+	{regexp.MustCompile(`(?i)\bultimate[ ._-]?(?:cut|edition)\b`), "Ultimate"},
+	{regexp.MustCompile(`(?i)\bspecial[ ._-]?edition\b`), "Special Edition"},
+	{regexp.MustCompile(`(?i)\bcriterion\b`), "Criterion"},
+	{regexp.MustCompile(`(?i)\bimax\b`), "IMAX"},
+	{regexp.MustCompile(`(?i)\bremastered\b`), "Remastered"},
+}
+
+// editionSeparators turns the word separators of release names into
+// spaces, which word boundaries recognize.
+var editionSeparators = strings.NewReplacer("_", " ", ".", " ")
+
+// qualityPatterns maps resolution markers to the resolution they name.
+var qualityPatterns = []struct {
+	re      *regexp.Regexp
+	quality string
+}{
+	{regexp.MustCompile(`(?i)\b(?:2160p|4k|uhd)\b`), "2160p"},
+	{regexp.MustCompile(`(?i)\b1080[pi]\b`), "1080p"},
+	{regexp.MustCompile(`(?i)\b720p\b`), "720p"},
+	{regexp.MustCompile(`(?i)\b(?:576p|480p|dvdrip)\b`), "480p"},
+}
+
+// ParseEdition reads the edition and resolution of a copy of a title from
+// its file or directory name, such as "Extended" and "2160p" from
+// "Movie.2001.Extended.Cut.2160p.mkv". Either is empty when not named.
+func ParseEdition(name string) (edition, quality string) {
+	name = editionSeparators.Replace(name)
+	for _, p := range editionPatterns {
+		if p.re.MatchString(name) {
+			edition = p.edition
+			break
+		}
+	}
+	for _, p := range qualityPatterns {
+		if p.re.MatchString(name) {
+			quality = p.quality
+			break
+		}
+	}
+	return edition, quality
+}
+
+// StripEdition removes edition and resolution markers from a name, so the
+// copies of one title parse to the same title. Names without markers are
+// returned unchanged.
+func StripEdition(name string) string {
+	stripped := editionSeparators.Replace(name)
+	for _, p := range editionPatterns {
+		stripped = p.re.ReplaceAllString(stripped, " ")
+	}
+	for _, p := range qualityPatterns {
+		stripped = p.re.ReplaceAllString(stripped, " ")
+	}
+	stripped = strings.Join(strings.Fields(stripped), " ")
+	if stripped == strings.Join(strings.Fields(editionSeparators.Replace(name)), " ") {
+		return name
+	}
+	return stripped
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEdition(t *testing.T) {
+	tests := []struct {
+		name    string
+		edition string
+		quality string
+	}{
+		{"Movie.2001.Extended.Cut.2160p.mkv", "Extended", "2160p"},
+		{"Movie (2001) Director's Cut", "Director's Cut", ""},
+		{"Movie_2001_Directors_Cut_1080p.mkv", "Director's Cut", "1080p"},
+		{"Movie 2001 4K UHD", "", "2160p"},
+		{"Movie.2001.Theatrical.720p.mkv", "Theatrical", "720p"},
+		{"Movie.2001.UNRATED.DVDRip.avi", "Unrated", "480p"},
+		{"Movie.2001.mkv", "", ""},
+		{"Extendedly Boring.mkv", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edition, quality := ParseEdition(tt.name)
+			assert.Equal(t, tt.edition, edition)
+			assert.Equal(t, tt.quality, quality)
+		})
+	}
+}
+
+func TestStripEdition(t *testing.T) {
+	assert.Equal(t, "Movie (2001)", StripEdition("Movie (2001) Extended Cut 2160p"))
+	assert.Equal(t, "Movie 2001", StripEdition("Movie.2001.Directors.Cut"))
+	assert.Equal(t, "Movie.2001", StripEdition("Movie.2001"), "names without markers are kept")
+}
+
+func TestAggregation_Editions(t *testing.T) {
+	_, itemRepo, fileRepo, files := aggregatedFixture(t,
+		[]string{"Film (2001)", "Film.2001.1080p.mkv", "Film.2001.1080p.srt"},
+		[]string{"Film (2001) Extended Cut", "Film.2001.2160p.mkv"},
+		[]string{"Film (2001) 4K", "Film.2001.mkv"},
+	)
+	ctx := context.Background()
+
+	_, movieTypeID, err := itemRepo.GetMediaTypeByName(ctx, "movie")
+	require.NoError(t, err)
+	film, err := itemRepo.GetByTitle(ctx, "Film", movieTypeID)
+	require.NoError(t, err)
+	require.NotNil(t, film)
+	duplicates, err := itemRepo.GetDuplicates(ctx, "Film", movieTypeID, nil)
+	require.NoError(t, err)
+	assert.Len(t, duplicates, 1, "every copy groups under one title")
+
+	linked, err := fileRepo.GetFilesByItem(ctx, film.ID)
+	require.NoError(t, err)
+	require.Len(t, linked, 4)
+	primaries := 0
+	for _, f := range linked {
+		if f.IsPrimary {
+			primaries++
+		}
+	}
+	assert.Equal(t, 1, primaries)
+
+	editions, err := fileRepo.GetEditionsByItems(ctx, []int64{film.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []repository.MediaEdition{
+		{Quality: "1080p"}, {Quality: "2160p"}, {Edition: "Extended", Quality: "2160p"},
+	}, editions[film.ID])
+
+	subtitles, err := fileRepo.GetLinksByFile(ctx, files["Film.2001.1080p.srt"])
+	require.NoError(t, err)
+	require.Len(t, subtitles, 1)
+	assert.Nil(t, subtitles[0].Edition)
+	assert.Nil(t, subtitles[0].QualityInfo)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxEpisodeSpan bounds the episodes one file can hold, so that names such
+// as "S01E01-720" are not read as a run of hundreds of episodes.
+const maxEpisodeSpan = 12
+
+var (
+	// episodeStartRe finds the first episode of a file name: S01E01.
+	episodeStartRe = regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._-]?E(\d{1,3})`)
+	// episodeMoreRe reads each further episode after it: E02 adds one
+	// episode, while -E03 and -03 run to it from the one before.
+	episodeMoreRe = regexp.MustCompile(`(?i)^(-[ ._]?E?|[ ._]?E)(\d{1,3})`)
+	// partRe finds part markers such as CD1, Disc 2, Part.3 and pt2.
+	partRe = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])(?:cd|dis[ck]|part|pt)[ ._-]?(\d{1,2})(?:$|[ ._\-\])])`)
+)
+
+// ParseEpisodeSpan reads the season and the episodes a file holds from its
+// name: S01E01 holds one, S01E01E02 and S01E01-E02 hold two and S01E01-03
+// holds three. It returns false when the name has no episode.
+func ParseEpisodeSpan(name string) (int, []int, bool) {
+	loc := episodeStartRe.FindStringSubmatchIndex(name)
+	if loc == nil {
+		return 0, nil, false
+	}
+	season, _ := strconv.Atoi(name[loc[2]:loc[3]])
+	first, _ := strconv.Atoi(name[loc[4]:loc[5]])
+	episodes := []int{first}
+
+	rest := name[loc[1]:]
+	for {
+		m := episodeMoreRe.FindStringSubmatch(rest)
+		if m == nil || (len(rest) > len(m[0]) && isDigit(rest[len(m[0])])) {
+			break
+		}
+		n, _ := strconv.Atoi(m[2])
+		last := episodes[len(episodes)-1]
+		if n <= last || n-first >= maxEpisodeSpan {
+			break
+		}
+		if strings.HasPrefix(m[1], "-") {
+			for e := last + 1; e < n; e++ {
+				episodes = append(episodes, e)
+			}
+		}
+		episodes = append(episodes, n)
+		rest = rest[len(m[0]):]
+	}
+	return season, episodes, true
+}
+
+// ParsePartNumber reads the part marker of a file name, such as CD2 or
+// Part 2, ignoring the extension. It returns false when there is none.
+func ParsePartNumber(name string) (int, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	m := partRe.FindStringSubmatch(base)
+	if m == nil {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n, n > 0
+}
+
+// partNumbers numbers the files that are parts of one item by their part
+// markers, keyed by index into names. It returns nil unless at least two
+// files are marked with distinct parts, since a lone "Part 2" is more
+// likely a title than half of a film.
+func partNumbers(names []string) map[int]int {
+	parts := make(map[int]int)
+	seen := make(map[int]bool)
+	for i, name := range names {
+		if n, ok := ParsePartNumber(name); ok {
+			parts[i] = n
+			seen[n] = true
+		}
+	}
+	if len(seen) < 2 {
+		return nil
+	}
+	return parts
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEpisodeSpan(t *testing.T) {
+	tests := []struct {
+		name     string
+		season   int
+		episodes []int
+		ok       bool
+	}{
+		{"Show.S01E05.mkv", 1, []int{5}, true},
+		{"Show.S01E01E02.mkv", 1, []int{1, 2}, true},
+		{"Show.S01E01-E02.720p.mkv", 1, []int{1, 2}, true},
+		{"Show S02E01-03.mkv", 2, []int{1, 2, 3}, true},
+		{"show.s03e09.e10.mkv", 3, []int{9, 10}, true},
+		{"Show.S01E01-1080p.mkv", 1, []int{1}, true},
+		{"Show.S01E04-E02.mkv", 1, []int{4}, true},
+		{"Show.S01E01-E40.mkv", 1, []int{1}, true},
+		{"Movie.2010.mkv", 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			season, episodes, ok := ParseEpisodeSpan(tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.season, season)
+			assert.Equal(t, tt.episodes, episodes)
+		})
+	}
+}
+
+func TestParsePartNumber(t *testing.T) {
+	tests := []struct {
+		name string
+		part int
+		ok   bool
+	}{
+		{"Movie CD1.avi", 1, true},
+		{"Movie.cd2.avi", 2, true},
+		{"Movie - Disc 2.mkv", 2, true},
+		{"Movie [Part.3].mkv", 3, true},
+		{"movie-pt2.mp4", 2, true},
+		{"Departures.2008.mkv", 0, false},
+		{"Movie.CD0.avi", 0, false},
+		{"Movie.mkv", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			part, ok := ParsePartNumber(tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.part, part)
+		})
+	}
+}
+
+func TestPartNumbers(t *testing.T) {
+	assert.Equal(t, map[int]int{0: 1, 2: 2},
+		partNumbers([]string{"Film CD1.avi", "Film.srt", "Film CD2.avi"}))
+	assert.Nil(t, partNumbers([]string{"Kill Bill Part 2.mkv", "Kill Bill Part 2.srt"}),
+		"one part number is not a split item")
+	assert.Nil(t, partNumbers([]string{"Film.mkv"}))
+}
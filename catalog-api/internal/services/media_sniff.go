@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// mediaSniffLength is how much of the start of a file media type
+// detection looks at, the read limit of mimetype.
+const mediaSniffLength = 3072
+
+// octetStream is the type of content that matches no known format.
+const octetStream = "application/octet-stream"
+
+// sniffedExtensionAliases lists, by the extension mimetype gives a
+// detected type, the other extensions files of that type are given.
+var sniffedExtensionAliases = map[string][]string{
+	"jpg":  {"jpeg", "jpe", "jfif"},
+	"tiff": {"tif"},
+	"heic": {"heif"},
+	"heif": {"heic"},
+	"mpeg": {"mpg", "mpe", "m2v", "vob"},
+	// MP4 and QuickTime are the same ISO base media container
+	"mp4":  {"m4v", "m4a", "m4b", "m4p", "mov"},
+	"m4v":  {"mp4"},
+	"m4a":  {"m4b", "m4p", "mp4"},
+	"mov":  {"qt", "mp4", "m4v"},
+	"mkv":  {"mka", "mks", "mk3d"},
+	"webm": {"mkv"},
+	"oga":  {"ogg", "opus", "spx"},
+	"ogv":  {"ogg"},
+	"asf":  {"wmv", "wma"},
+	"midi": {"mid"},
+	"aiff": {"aif", "aifc"},
+}
+
+// headBuffer keeps the first mediaSniffLength bytes written to it.
+type headBuffer struct {
+	data []byte
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if room := mediaSniffLength - len(b.data); room > 0 {
+		b.data = append(b.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// DetectMediaType returns the MIME type of content from its first bytes,
+// without parameters: application/octet-stream when it matches no known
+// format, "" when there is no content.
+func DetectMediaType(head []byte) string {
+	if len(head) == 0 {
+		return ""
+	}
+	detected, _, err := mime.ParseMediaType(mimetype.Detect(head).String())
+	if err != nil {
+		return octetStream
+	}
+	return detected
+}
+
+// sniffedExtension returns the extension, without the dot, that mimetype
+// gives a detected type.
+func sniffedExtension(detected string) string {
+	if detected == "" || detected == octetStream {
+		return ""
+	}
+	if mt := mimetype.Lookup(detected); mt != nil {
+		return strings.TrimPrefix(mt.Extension(), ".")
+	}
+	return ""
+}
+
+// isMediaFileType reports whether a file type is audio, video or an
+// image.
+func isMediaFileType(fileType string) bool {
+	return fileType == "video" || fileType == "audio" || fileType == "image"
+}
+
+// mediaTypeMismatch reports whether content detected as one type has an
+// extension that declares another. Only media is judged: a media
+// extension on other content or media content under another extension.
+// Content of no known format and files without an extension are never
+// mismatches.
+func mediaTypeMismatch(ext, detected string) bool {
+	ext = strings.ToLower(ext)
+	detectedExt := sniffedExtension(detected)
+	if ext == "" || detectedExt == "" || ext == detectedExt {
+		return false
+	}
+	if !isMediaFileType(classifyFileType(ext)) && !isMediaFileType(classifyFileType(detectedExt)) {
+		return false
+	}
+	for _, alias := range sniffedExtensionAliases[detectedExt] {
+		if ext == alias {
+			return false
+		}
+	}
+	return true
+}
+
+// contentFileType classifies a file by its detected content when its
+// extension is missing, unknown or does not match the content, and by
+// its extension otherwise.
+func contentFileType(ext, detected string) string {
+	fileType := classifyFileType(ext)
+	if fileType != "other" && !mediaTypeMismatch(ext, detected) {
+		return fileType
+	}
+	if detectedType := classifyFileType(sniffedExtension(detected)); detectedType != "other" {
+		return detectedType
+	}
+	return fileType
+}
+
+// TypeMismatch is a file whose content is not what its extension
+// declares.
+type TypeMismatch struct {
+	FileID        int64  `json:"file_id"`
+	StorageRootID int64  `json:"storage_root_id"`
+	StorageRoot   string `json:"storage_root"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	Extension     string `json:"extension"`
+	// DeclaredMimeType is the type of the extension, when it is known
+	DeclaredMimeType string `json:"declared_mime_type,omitempty"`
+	DetectedMimeType string `json:"detected_mime_type"`
+	// SuggestedExtension is the usual extension of the detected type
+	SuggestedExtension string `json:"suggested_extension,omitempty"`
+	FileType           string `json:"file_type"`
+}
+
+// ListTypeMismatches returns the cataloged files whose content scans
+// found not to match their extension, by path, for review. A
+// storageRootID of 0 lists every root. It also returns how many there
+// are in total.
+func (s *ScannerService) ListTypeMismatches(ctx context.Context, storageRootID int64, limit, offset int) ([]TypeMismatch, int64, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	where := `f.type_mismatch = ? AND f.deleted = ?`
+	args := []interface{}{true, false}
+	if storageRootID > 0 {
+		where += ` AND f.storage_root_id = ?`
+		args = append(args, storageRootID)
+	}
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM files f WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count type mismatches: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT f.id, f.storage_root_id, sr.name, f.path, f.size, f.mime_type, f.detected_mime_type, f.file_type
+		 FROM files f JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE `+where+`
+		 ORDER BY sr.name, f.path LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list type mismatches: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []TypeMismatch
+	for rows.Next() {
+		var m TypeMismatch
+		var declared, detected, fileType *string
+		if err := rows.Scan(&m.FileID, &m.StorageRootID, &m.StorageRoot, &m.Path, &m.Size,
+			&declared, &detected, &fileType); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan type mismatch: %w", err)
+		}
+		m.Extension = strings.TrimPrefix(path.Ext(m.Path), ".")
+		if declared != nil {
+			m.DeclaredMimeType = *declared
+		}
+		if detected != nil {
+			m.DetectedMimeType = *detected
+			m.SuggestedExtension = sniffedExtension(*detected)
+		}
+		if fileType != nil {
+			m.FileType = *fileType
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, total, rows.Err()
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal headers of a Matroska video and a PNG image
+const (
+	mkvHeader = "\x1A\x45\xDF\xA3\x93\x42\x82\x88matroska"
+	pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+)
+
+func TestDetectMediaType(t *testing.T) {
+	assert.Equal(t, "video/x-matroska", DetectMediaType([]byte(mkvHeader)))
+	assert.Equal(t, "image/png", DetectMediaType([]byte(pngHeader)))
+	assert.Equal(t, "text/plain", DetectMediaType([]byte("just some notes\n")))
+	assert.Equal(t, octetStream, DetectMediaType([]byte{0x00, 0x01, 0x02, 0xff}))
+	assert.Empty(t, DetectMediaType(nil))
+}
+
+func TestMediaTypeMismatch(t *testing.T) {
+	tests := []struct {
+		ext, detected string
+		mismatch      bool
+	}{
+		{"mkv", "video/x-matroska", false},
+		{"MKV", "video/x-matroska", false},
+		{"avi", "video/x-matroska", true},
+		{"jpeg", "image/jpeg", false},
+		{"mov", "video/mp4", false},
+		{"mp4", "text/plain", true},
+		{"jpg", "video/mp4", true},
+		{"txt", "image/png", true},
+		// Not media, or nothing known to compare with
+		{"srt", "text/plain", false},
+		{"cbz", "application/zip", false},
+		{"ts", octetStream, false},
+		{"", "video/x-matroska", false},
+		{"avi", "", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.mismatch, mediaTypeMismatch(tt.ext, tt.detected), "%s as %s", tt.ext, tt.detected)
+	}
+}
+
+func TestContentFileType(t *testing.T) {
+	assert.Equal(t, "video", contentFileType("", "video/x-matroska"))
+	assert.Equal(t, "image", contentFileType("mp4", "image/png"))
+	assert.Equal(t, "book", contentFileType("cbz", "application/zip"))
+	assert.Equal(t, "video", contentFileType("avi", ""))
+	assert.Equal(t, "other", contentFileType("", octetStream))
+}
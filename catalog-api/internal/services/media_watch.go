@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"catalogizer/internal/media/models"
+	"catalogizer/repository"
+)
+
+// Watch states kept in user_metadata.watched_status.
+const (
+	WatchStatusWatching = "watching"
+	WatchStatusWatched  = "watched"
+)
+
+// watchedThreshold is the share of an item played for it to count as
+// watched, leaving room for end credits.
+const watchedThreshold = 0.9
+
+// MediaWatchState is the watch state of a media item after playback
+// progress was recorded for it.
+type MediaWatchState struct {
+	MediaItemID   int64   `json:"media_item_id"`
+	WatchedStatus string  `json:"watched_status"`
+	Progress      float64 `json:"progress"`
+}
+
+// MediaWatchService tracks watch state from playback progress on the
+// files of media items. Progress on one part of an item split across
+// files counts toward the whole item, and progress on a file holding
+// several episodes counts toward each episode in turn.
+type MediaWatchService struct {
+	fileRepo     *repository.MediaFileRepository
+	userMetaRepo *repository.UserMetadataRepository
+	now          func() time.Time
+}
+
+// NewMediaWatchService creates a new media watch service.
+func NewMediaWatchService(fileRepo *repository.MediaFileRepository, userMetaRepo *repository.UserMetadataRepository) *MediaWatchService {
+	return &MediaWatchService{
+		fileRepo:     fileRepo,
+		userMetaRepo: userMetaRepo,
+		now:          time.Now,
+	}
+}
+
+// RecordProgress records that a user has played a file of a media item up
+// to position seconds of duration, and returns the watch state of every
+// item the progress counts toward.
+func (s *MediaWatchService) RecordProgress(ctx context.Context, userID, mediaItemID, fileID int64, position, duration float64) ([]MediaWatchState, error) {
+	if duration <= 0 || position < 0 {
+		return nil, fmt.Errorf("invalid playback progress: position and duration must be positive")
+	}
+	played := position / duration
+	if played > 1 {
+		played = 1
+	}
+
+	links, err := s.fileRepo.GetLinksByFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	var link *repository.MediaFileRecord
+	for i := range links {
+		if links[i].MediaItemID == mediaItemID {
+			link = &links[i]
+			break
+		}
+	}
+	if link == nil {
+		return nil, fmt.Errorf("file %d not found in media item %d", fileID, mediaItemID)
+	}
+
+	var states []MediaWatchState
+	switch {
+	case link.SegmentCount != nil && link.SegmentIndex != nil:
+		// The file holds several episodes in order; each is watched once
+		// playback is most of the way through its share of the file.
+		count := float64(*link.SegmentCount)
+		for _, l := range links {
+			if l.SegmentIndex == nil || l.SegmentCount == nil || *l.SegmentCount != *link.SegmentCount {
+				continue
+			}
+			progress := clampUnit(played*count - float64(*l.SegmentIndex-1))
+			if progress > 0 {
+				states = append(states, watchState(l.MediaItemID, progress, progress >= watchedThreshold))
+			}
+		}
+	case link.PartNumber != nil:
+		files, err := s.fileRepo.GetFilesByItem(ctx, mediaItemID)
+		if err != nil {
+			return nil, err
+		}
+		var parts []repository.MediaFileRecord
+		for _, f := range files {
+			if f.PartNumber != nil {
+				parts = append(parts, f)
+			}
+		}
+		index := 0
+		for i, p := range parts {
+			if p.FileID == fileID {
+				index = i
+			}
+		}
+		// Earlier parts count as played; the item is watched only near
+		// the end of its last part.
+		progress := (float64(index) + played) / float64(len(parts))
+		last := index == len(parts)-1
+		states = append(states, watchState(mediaItemID, progress, last && played >= watchedThreshold))
+	default:
+		states = append(states, watchState(mediaItemID, played, played >= watchedThreshold))
+	}
+
+	for i := range states {
+		if err := s.saveWatchState(ctx, userID, &states[i]); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// saveWatchState stores a watch state in the user's metadata for the
+// item, keeping their other metadata. Items already watched stay watched
+// when played again.
+func (s *MediaWatchService) saveWatchState(ctx context.Context, userID int64, state *MediaWatchState) error {
+	um, err := s.userMetaRepo.GetByItemAndUser(ctx, state.MediaItemID, userID)
+	if err != nil {
+		return err
+	}
+	if um == nil {
+		um = &models.UserMetadata{MediaItemID: state.MediaItemID, UserID: userID}
+	}
+	if um.WatchedStatus != nil && *um.WatchedStatus == WatchStatusWatched {
+		state.WatchedStatus = WatchStatusWatched
+		return nil
+	}
+	status := state.WatchedStatus
+	um.WatchedStatus = &status
+	if status == WatchStatusWatched {
+		now := s.now()
+		um.WatchedDate = &now
+	}
+	return s.userMetaRepo.Upsert(ctx, um)
+}
+
+func watchState(mediaItemID int64, progress float64, watched bool) MediaWatchState {
+	status := WatchStatusWatching
+	if watched {
+		status = WatchStatusWatched
+	}
+	return MediaWatchState{MediaItemID: mediaItemID, WatchedStatus: status, Progress: progress}
+}
+
+func clampUnit(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
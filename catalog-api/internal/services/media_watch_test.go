@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"catalogizer/config"
+	"catalogizer/database"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// aggregatedFixture catalogs top-level directories of files, each given
+// as the directory name followed by its file names, then aggregates them.
+func aggregatedFixture(t *testing.T, dirs ...[]string) (*database.DB, *repository.MediaItemRepository, *repository.MediaFileRepository, map[string]int64) {
+	t.Helper()
+
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "aggregated.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO roles (id, name, permissions) VALUES (100, 'aggregated-test', '[]');
+		INSERT INTO users (id, username, email, password_hash, salt, role_id) VALUES
+			(7, 'viewer', 'viewer@example.com', 'x', 'x', 100);`)
+	require.NoError(t, err)
+	rootID, err := db.InsertReturningID(ctx, `INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'local', '/srv')`)
+	require.NoError(t, err)
+	files := make(map[string]int64)
+	add := func(parentID *int64, path, name string, isDir bool) int64 {
+		id, err := db.InsertReturningID(ctx,
+			`INSERT INTO files (storage_root_id, path, name, extension, is_directory, parent_id, size, modified_at) VALUES (?, ?, ?, ?, ?, ?, 1, CURRENT_TIMESTAMP)`,
+			rootID, path, name, filepath.Ext(name), isDir, parentID)
+		require.NoError(t, err)
+		files[name] = id
+		return id
+	}
+	for _, dir := range dirs {
+		dirID := add(nil, "/"+dir[0], dir[0], true)
+		for _, name := range dir[1:] {
+			add(&dirID, "/"+dir[0]+"/"+name, name, false)
+		}
+	}
+
+	itemRepo := repository.NewMediaItemRepository(db)
+	fileRepo := repository.NewMediaFileRepository(db)
+	svc := NewAggregationService(db, zap.NewNop(), itemRepo, fileRepo,
+		repository.NewDirectoryAnalysisRepository(db), repository.NewExternalMetadataRepository(db))
+	require.NoError(t, svc.AggregateAfterScan(ctx, rootID))
+	return db, itemRepo, fileRepo, files
+}
+
+// newMediaLayoutFixture catalogs a show with a two-episode file and an
+// episode in two parts, and a film on two discs.
+func newMediaLayoutFixture(t *testing.T) (*database.DB, *repository.MediaItemRepository, *repository.MediaFileRepository, map[string]int64) {
+	return aggregatedFixture(t,
+		[]string{"Show Season 1", "Show.S01E01-E02.mkv", "Show.S01E03.Part1.mkv", "Show.S01E03.Part2.mkv", "Show.S01E01-E02.srt"},
+		[]string{"Film (2001)", "Film CD1.avi", "Film CD2.avi"},
+	)
+}
+
+// episodeID finds an aggregated episode by its season and episode number.
+func episodeID(t *testing.T, db *database.DB, season, episode int) int64 {
+	t.Helper()
+	var id int64
+	require.NoError(t, db.QueryRowContext(context.Background(),
+		`SELECT mi.id FROM media_items mi JOIN media_types mt ON mt.id = mi.media_type_id
+		WHERE mt.name = 'tv_episode' AND mi.season_number = ? AND mi.episode_number = ?`, season, episode).Scan(&id))
+	return id
+}
+
+func TestAggregation_MediaFileLayout(t *testing.T) {
+	db, itemRepo, fileRepo, files := newMediaLayoutFixture(t)
+	ctx := context.Background()
+
+	// The two-episode file is linked to both episodes as their segments
+	links, err := fileRepo.GetLinksByFile(ctx, files["Show.S01E01-E02.mkv"])
+	require.NoError(t, err)
+	var segments []int64
+	for _, l := range links {
+		if l.SegmentIndex != nil {
+			assert.Equal(t, 2, *l.SegmentCount)
+			segments = append(segments, l.MediaItemID)
+		}
+	}
+	assert.Equal(t, []int64{episodeID(t, db, 1, 1), episodeID(t, db, 1, 2)}, segments)
+	noSubtitles, err := fileRepo.GetLinksByFile(ctx, files["Show.S01E01-E02.srt"])
+	require.NoError(t, err)
+	assert.Len(t, noSubtitles, 1, "subtitles stay with the show only")
+
+	// Episode 3 is made of two ordered parts
+	parts, err := fileRepo.GetFilesByItem(ctx, episodeID(t, db, 1, 3))
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, files["Show.S01E03.Part1.mkv"], parts[0].FileID)
+	assert.Equal(t, 1, *parts[0].PartNumber)
+	assert.True(t, parts[0].IsPrimary)
+	assert.Equal(t, 2, *parts[1].PartNumber)
+
+	_, movieTypeID, err := itemRepo.GetMediaTypeByName(ctx, "movie")
+	require.NoError(t, err)
+	film, err := itemRepo.GetByTitle(ctx, "Film", movieTypeID)
+	require.NoError(t, err)
+	require.NotNil(t, film)
+	filmFiles, err := fileRepo.GetFilesByItem(ctx, film.ID)
+	require.NoError(t, err)
+	require.Len(t, filmFiles, 2)
+	assert.Equal(t, 1, *filmFiles[0].PartNumber)
+	assert.Equal(t, 2, *filmFiles[1].PartNumber)
+}
+
+func TestMediaWatchService_RecordProgress(t *testing.T) {
+	db, itemRepo, fileRepo, files := newMediaLayoutFixture(t)
+	ctx := context.Background()
+	userMetaRepo := repository.NewUserMetadataRepository(db)
+	watch := NewMediaWatchService(fileRepo, userMetaRepo)
+	ep1, ep2 := episodeID(t, db, 1, 1), episodeID(t, db, 1, 2)
+	double := files["Show.S01E01-E02.mkv"]
+
+	// Playing past the first episode's share of the file watches it and
+	// starts the second
+	states, err := watch.RecordProgress(ctx, 7, ep1, double, 1500, 2400)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+	assert.Equal(t, MediaWatchState{MediaItemID: ep1, WatchedStatus: WatchStatusWatched, Progress: 1}, states[0])
+	assert.Equal(t, MediaWatchState{MediaItemID: ep2, WatchedStatus: WatchStatusWatching, Progress: 0.25}, states[1])
+
+	states, err = watch.RecordProgress(ctx, 7, ep2, double, 2300, 2400)
+	require.NoError(t, err)
+	assert.Equal(t, WatchStatusWatched, states[1].WatchedStatus)
+	um, err := userMetaRepo.GetByItemAndUser(ctx, ep2, 7)
+	require.NoError(t, err)
+	require.NotNil(t, um)
+	assert.Equal(t, WatchStatusWatched, *um.WatchedStatus)
+	assert.NotNil(t, um.WatchedDate)
+
+	// Rewatching the start does not undo either
+	states, err = watch.RecordProgress(ctx, 7, ep1, double, 10, 2400)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, WatchStatusWatched, states[0].WatchedStatus)
+
+	// A film on two discs is watched only near the end of the second
+	_, movieTypeID, err := itemRepo.GetMediaTypeByName(ctx, "movie")
+	require.NoError(t, err)
+	film, err := itemRepo.GetByTitle(ctx, "Film", movieTypeID)
+	require.NoError(t, err)
+	states, err = watch.RecordProgress(ctx, 7, film.ID, files["Film CD1.avi"], 3000, 3000)
+	require.NoError(t, err)
+	assert.Equal(t, MediaWatchState{MediaItemID: film.ID, WatchedStatus: WatchStatusWatching, Progress: 0.5}, states[0])
+	states, err = watch.RecordProgress(ctx, 7, film.ID, files["Film CD2.avi"], 2900, 3000)
+	require.NoError(t, err)
+	assert.Equal(t, WatchStatusWatched, states[0].WatchedStatus)
+
+	_, err = watch.RecordProgress(ctx, 7, film.ID, double, 10, 100)
+	assert.ErrorContains(t, err, "not found")
+	_, err = watch.RecordProgress(ctx, 7, film.ID, files["Film CD1.avi"], 10, 0)
+	assert.ErrorContains(t, err, "invalid")
+}
@@ -0,0 +1,717 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"catalogizer/database"
+	"catalogizer/internal/media/models"
+	"catalogizer/repository"
+
+	"go.uber.org/zap"
+)
+
+// Media item statuses set by metadata enrichment. Items start out as
+// "detected" when the aggregation service creates them.
+const (
+	MediaStatusMatched    = "matched"
+	MediaStatusIdentified = "identified"
+)
+
+// metadataAutoMatchScore is the lowest score at which a search result is
+// applied without a user choosing it.
+const metadataAutoMatchScore = 0.75
+
+// maxCoverImageSize caps downloaded poster and cover images.
+const maxCoverImageSize = 10 << 20
+
+// MetadataQuery describes a media item to look up with metadata providers.
+type MetadataQuery struct {
+	MediaType string `json:"media_type"`
+	Title     string `json:"title"`
+	Year      *int   `json:"year,omitempty"`
+	Artist    string `json:"artist,omitempty"` // album artist or book author
+}
+
+// MetadataMatch is a provider's record for a media item. Score rates how
+// well it matches the query, from 0 to 1.
+type MetadataMatch struct {
+	Provider      string          `json:"provider"`
+	ExternalID    string          `json:"external_id"`
+	Title         string          `json:"title"`
+	OriginalTitle string          `json:"original_title,omitempty"`
+	Creator       string          `json:"creator,omitempty"`
+	Year          *int            `json:"year,omitempty"`
+	Description   string          `json:"description,omitempty"`
+	Genres        []string        `json:"genres,omitempty"`
+	Director      string          `json:"director,omitempty"`
+	Rating        *float64        `json:"rating,omitempty"`
+	Runtime       *int            `json:"runtime,omitempty"`
+	Language      string          `json:"language,omitempty"`
+	CoverURL      string          `json:"cover_url,omitempty"`
+	URL           string          `json:"url,omitempty"`
+	Score         float64         `json:"score"`
+	Data          json.RawMessage `json:"-"`
+}
+
+// MetadataEnrichmentResult reports the record applied to a media item.
+type MetadataEnrichmentResult struct {
+	MediaItemID int64          `json:"media_item_id"`
+	MediaType   string         `json:"media_type"`
+	Status      string         `json:"status"`
+	Match       *MetadataMatch `json:"match"`
+	CoverCached bool           `json:"cover_cached"`
+	// Sources names the provider each field set was taken from
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// RematchRequest corrects what a misdetected media item is searched as.
+// Empty fields keep the item's current values.
+type RematchRequest struct {
+	MediaType string `json:"media_type"`
+	Title     string `json:"title"`
+	Year      *int   `json:"year"`
+}
+
+// IdentifyRequest assigns a specific provider record to a media item.
+type IdentifyRequest struct {
+	MediaType  string `json:"media_type"`
+	Provider   string `json:"provider" binding:"required"`
+	ExternalID string `json:"external_id" binding:"required"`
+}
+
+// MetadataEnrichmentService matches media items to records in external
+// metadata databases, fills in their metadata and caches their poster or
+// cover art. Automatic matching only fills in missing fields; re-matching
+// and identifying replace them.
+type MetadataEnrichmentService struct {
+	db          *database.DB
+	logger      *zap.Logger
+	itemRepo    *repository.MediaItemRepository
+	extMetaRepo *repository.ExternalMetadataRepository
+	providers   []MetadataProviderClient
+	coverDir    string
+	httpClient  *http.Client
+}
+
+// NewMetadataEnrichmentService creates a new metadata enrichment service.
+// Covers are stored as <coverDir>/media_item/<id>.<ext>, where the cover
+// art resolver finds them; an empty coverDir disables caching them.
+func NewMetadataEnrichmentService(
+	db *database.DB,
+	logger *zap.Logger,
+	itemRepo *repository.MediaItemRepository,
+	extMetaRepo *repository.ExternalMetadataRepository,
+	coverDir string,
+) *MetadataEnrichmentService {
+	return &MetadataEnrichmentService{
+		db:          db,
+		logger:      logger,
+		itemRepo:    itemRepo,
+		extMetaRepo: extMetaRepo,
+		coverDir:    coverDir,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetProviders sets the provider clients, searched in the given order.
+func (s *MetadataEnrichmentService) SetProviders(providers ...MetadataProviderClient) {
+	s.providers = providers
+}
+
+func (s *MetadataEnrichmentService) providersFor(mediaType string) []MetadataProviderClient {
+	var providers []MetadataProviderClient
+	for _, p := range s.providers {
+		if p.Supports(mediaType) {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Supports reports whether the named provider, or any provider when name
+// is empty, covers a media type.
+func (s *MetadataEnrichmentService) Supports(name, mediaType string) bool {
+	for _, p := range s.providers {
+		if (name == "" || p.Name() == name) && p.Supports(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasProvider reports whether a provider of that name is configured.
+func (s *MetadataEnrichmentService) HasProvider(name string) bool {
+	for _, p := range s.providers {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MetadataEnrichmentService) provider(name, mediaType string) (MetadataProviderClient, error) {
+	for _, p := range s.providers {
+		if p.Name() == name {
+			if !p.Supports(mediaType) {
+				return nil, fmt.Errorf("invalid provider %s for media type %s", name, mediaType)
+			}
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid provider: %s", name)
+}
+
+// loadItem returns a media item and the name of its media type.
+func (s *MetadataEnrichmentService) loadItem(ctx context.Context, mediaItemID int64) (*models.MediaItem, string, error) {
+	item, err := s.itemRepo.GetByID(ctx, mediaItemID)
+	if err != nil {
+		return nil, "", err
+	}
+	var mediaType string
+	if err := s.db.QueryRowContext(ctx, `SELECT name FROM media_types WHERE id = ?`, item.MediaTypeID).Scan(&mediaType); err != nil {
+		return nil, "", fmt.Errorf("failed to load media type: %w", err)
+	}
+	return item, mediaType, nil
+}
+
+// setMediaType changes a misdetected item's media type.
+func (s *MetadataEnrichmentService) setMediaType(ctx context.Context, item *models.MediaItem, mediaType string) error {
+	_, typeID, err := s.itemRepo.GetMediaTypeByName(ctx, mediaType)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return fmt.Errorf("invalid media type: %s", mediaType)
+		}
+		return err
+	}
+	item.MediaTypeID = typeID
+	return nil
+}
+
+// itemQuery builds the search for a media item. An album's artist is its
+// parent music_artist item.
+func (s *MetadataEnrichmentService) itemQuery(ctx context.Context, item *models.MediaItem, mediaType string) MetadataQuery {
+	query := MetadataQuery{MediaType: mediaType, Title: item.Title, Year: item.Year}
+	if item.ParentID != nil {
+		var artist string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT mi.title FROM media_items mi JOIN media_types mt ON mt.id = mi.media_type_id
+			 WHERE mi.id = ? AND mt.name = 'music_artist'`, *item.ParentID).Scan(&artist)
+		if err == nil {
+			query.Artist = artist
+		} else if err != sql.ErrNoRows {
+			s.logger.Warn("Failed to load album artist", zap.Int64("media_item_id", item.ID), zap.Error(err))
+		}
+	}
+	return query
+}
+
+// search queries every provider for the media type and returns the results
+// best match first. A provider that fails is skipped.
+func (s *MetadataEnrichmentService) search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	return s.searchProviders(ctx, query, s.providersFor(query.MediaType))
+}
+
+func (s *MetadataEnrichmentService) searchProviders(ctx context.Context, query MetadataQuery, providers []MetadataProviderClient) ([]MetadataMatch, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("unsupported media type: %s", query.MediaType)
+	}
+	matches := []MetadataMatch{}
+	var lastErr error
+	for _, p := range providers {
+		results, err := p.Search(ctx, query)
+		if err != nil {
+			s.logger.Warn("Metadata provider search failed",
+				zap.String("provider", p.Name()), zap.String("title", query.Title), zap.Error(err))
+			lastErr = err
+			continue
+		}
+		for _, m := range results {
+			m.Score = metadataMatchScore(query, m)
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metadata search failed: %w", lastErr)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches, nil
+}
+
+// bestMatch returns the full record of the best search result, if it
+// scores high enough to be applied. With a provider order configured, the
+// providers are tried one after the other instead.
+func (s *MetadataEnrichmentService) bestMatch(ctx context.Context, query MetadataQuery) (*MetadataMatch, error) {
+	if cfg := s.sourceConfig(ctx); len(cfg.ProviderOrder) > 0 {
+		return s.matchInOrder(ctx, query, s.orderedProviders(query.MediaType, cfg))
+	}
+	return s.bestMatchFrom(ctx, query, s.providersFor(query.MediaType))
+}
+
+func (s *MetadataEnrichmentService) bestMatchFrom(ctx context.Context, query MetadataQuery, providers []MetadataProviderClient) (*MetadataMatch, error) {
+	matches, err := s.searchProviders(ctx, query, providers)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 || matches[0].Score < metadataAutoMatchScore {
+		return nil, fmt.Errorf("no metadata match found for %q", query.Title)
+	}
+	best := matches[0]
+	p, err := s.provider(best.Provider, query.MediaType)
+	if err != nil {
+		return nil, err
+	}
+	details, err := p.Lookup(ctx, query.MediaType, best.ExternalID)
+	if err != nil {
+		// Search results carry most fields; use them if the lookup fails
+		s.logger.Warn("Metadata lookup failed",
+			zap.String("provider", best.Provider), zap.String("external_id", best.ExternalID), zap.Error(err))
+		return &best, nil
+	}
+	details.Score = best.Score
+	return details, nil
+}
+
+// Enrich matches a media item automatically and fills in the metadata it
+// is missing. Items of media types no provider covers are left alone.
+func (s *MetadataEnrichmentService) Enrich(ctx context.Context, mediaItemID int64) (*MetadataEnrichmentResult, error) {
+	item, mediaType, err := s.loadItem(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	match, err := s.bestMatch(ctx, s.itemQuery(ctx, item, mediaType))
+	if err != nil {
+		return nil, err
+	}
+	return s.apply(ctx, item, mediaType, match, applyMissing, MediaStatusMatched)
+}
+
+// EnrichItems enriches newly detected media items, logging failures. The
+// aggregation service calls it after a scan.
+func (s *MetadataEnrichmentService) EnrichItems(ctx context.Context, mediaItemIDs []int64) {
+	matched := 0
+	for _, id := range mediaItemIDs {
+		if _, err := s.Enrich(ctx, id); err != nil {
+			s.logger.Debug("Media item not enriched", zap.Int64("media_item_id", id), zap.Error(err))
+			continue
+		}
+		matched++
+	}
+	if len(mediaItemIDs) > 0 {
+		s.logger.Info("Metadata enrichment completed",
+			zap.Int("items", len(mediaItemIDs)), zap.Int("matched", matched))
+	}
+}
+
+// Refresh fetches a media item's metadata again from the provider it was
+// matched with, or from provider when it is set. An item without a record
+// from that provider is matched as Enrich does. Unless onlyMissing is set,
+// the fresh record replaces the item's fields, but not its title or how it
+// was matched.
+func (s *MetadataEnrichmentService) Refresh(ctx context.Context, mediaItemID int64, provider string, onlyMissing bool) (*MetadataEnrichmentResult, error) {
+	item, mediaType, err := s.loadItem(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.extMetaRepo.GetByItem(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	matched := s.matchedProvider(ctx, mediaItemID)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Provider == matched && records[j].Provider != matched
+	})
+	for _, record := range records {
+		if provider != "" && record.Provider != provider {
+			continue
+		}
+		p, err := s.provider(record.Provider, mediaType)
+		if err != nil {
+			continue
+		}
+		match, err := p.Lookup(ctx, mediaType, record.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+		match.Score = 1
+		status := MediaStatusMatched
+		if item.Status == MediaStatusIdentified {
+			status = MediaStatusIdentified
+		}
+		mode := applyRefresh
+		if onlyMissing {
+			mode = applyMissing
+		}
+		return s.apply(ctx, item, mediaType, match, mode, status)
+	}
+
+	query := s.itemQuery(ctx, item, mediaType)
+	var match *MetadataMatch
+	if provider != "" {
+		var p MetadataProviderClient
+		if p, err = s.provider(provider, mediaType); err != nil {
+			return nil, err
+		}
+		match, err = s.bestMatchFrom(ctx, query, []MetadataProviderClient{p})
+	} else {
+		match, err = s.bestMatch(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.apply(ctx, item, mediaType, match, applyMissing, MediaStatusMatched)
+}
+
+// FindMatches returns candidate records for a media item, best first, for
+// a user to identify it with. The request overrides what is searched for.
+func (s *MetadataEnrichmentService) FindMatches(ctx context.Context, mediaItemID int64, request RematchRequest) ([]MetadataMatch, error) {
+	item, mediaType, err := s.loadItem(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	return s.search(ctx, s.rematchQuery(ctx, item, mediaType, request))
+}
+
+func (s *MetadataEnrichmentService) rematchQuery(ctx context.Context, item *models.MediaItem, mediaType string, request RematchRequest) MetadataQuery {
+	query := s.itemQuery(ctx, item, mediaType)
+	if request.MediaType != "" {
+		query.MediaType = request.MediaType
+	}
+	if strings.TrimSpace(request.Title) != "" {
+		query.Title = strings.TrimSpace(request.Title)
+	}
+	if request.Year != nil {
+		query.Year = request.Year
+	}
+	return query
+}
+
+// Rematch discards a media item's external metadata and matches it again,
+// optionally as a different media type or under a corrected title and
+// year. The match replaces the item's metadata.
+func (s *MetadataEnrichmentService) Rematch(ctx context.Context, mediaItemID int64, request RematchRequest) (*MetadataEnrichmentResult, error) {
+	item, mediaType, err := s.loadItem(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	if request.MediaType != "" && request.MediaType != mediaType {
+		if err := s.setMediaType(ctx, item, request.MediaType); err != nil {
+			return nil, err
+		}
+	}
+	query := s.rematchQuery(ctx, item, mediaType, request)
+	match, err := s.bestMatch(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.clearExternalMetadata(ctx, mediaItemID); err != nil {
+		return nil, err
+	}
+	return s.apply(ctx, item, query.MediaType, match, applyReplace, MediaStatusMatched)
+}
+
+// Identify assigns a provider record chosen by a user to a media item,
+// replacing its external metadata and metadata.
+func (s *MetadataEnrichmentService) Identify(ctx context.Context, mediaItemID int64, request IdentifyRequest) (*MetadataEnrichmentResult, error) {
+	item, mediaType, err := s.loadItem(ctx, mediaItemID)
+	if err != nil {
+		return nil, err
+	}
+	if request.MediaType != "" && request.MediaType != mediaType {
+		if err := s.setMediaType(ctx, item, request.MediaType); err != nil {
+			return nil, err
+		}
+		mediaType = request.MediaType
+	}
+	p, err := s.provider(request.Provider, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	match, err := p.Lookup(ctx, mediaType, request.ExternalID)
+	if err != nil {
+		return nil, err
+	}
+	match.Score = 1
+	if err := s.clearExternalMetadata(ctx, mediaItemID); err != nil {
+		return nil, err
+	}
+	return s.apply(ctx, item, mediaType, match, applyReplace, MediaStatusIdentified)
+}
+
+func (s *MetadataEnrichmentService) clearExternalMetadata(ctx context.Context, mediaItemID int64) error {
+	existing, err := s.extMetaRepo.GetByItem(ctx, mediaItemID)
+	if err != nil {
+		return err
+	}
+	for _, em := range existing {
+		if err := s.extMetaRepo.Delete(ctx, em.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM media_item_field_sources WHERE media_item_id = ?`, mediaItemID); err != nil {
+		return fmt.Errorf("failed to clear metadata sources: %w", err)
+	}
+	return nil
+}
+
+// metadataApply is which of an item's fields a match is copied to.
+type metadataApply int
+
+const (
+	// applyMissing fills in empty fields and keeps the title
+	applyMissing metadataApply = iota
+	// applyReplace replaces every field the match has, title included
+	applyReplace
+	// applyRefresh replaces every field the match has but the title
+	applyRefresh
+)
+
+// apply stores a match as the item's external metadata and copies its
+// fields to the item as mode says. With field priorities configured, the
+// records of the preferred providers are stored too and each field is
+// taken from the first of them that has it. Which record supplied each
+// field set is recorded.
+func (s *MetadataEnrichmentService) apply(ctx context.Context, item *models.MediaItem, mediaType string, match *MetadataMatch, mode metadataApply, status string) (*MetadataEnrichmentResult, error) {
+	cfg := s.sourceConfig(ctx)
+	matches := s.sourceMatches(ctx, item, mediaType, match, mode, cfg)
+	overwrite := mode != applyMissing
+	sources := map[string]*MetadataMatch{MetadataFieldMatch: match}
+	// set copies a field from its source record when the item may take it
+	set := func(field string, empty bool, has func(m *MetadataMatch) bool, assign func(m *MetadataMatch)) {
+		if !overwrite && !empty {
+			return
+		}
+		if m := fieldSource(field, matches, cfg, has); m != nil {
+			assign(m)
+			sources[field] = m
+		}
+	}
+	setString := func(field string, dst **string, value func(m *MetadataMatch) string) {
+		set(field, *dst == nil || **dst == "",
+			func(m *MetadataMatch) bool { return value(m) != "" },
+			func(m *MetadataMatch) { v := value(m); *dst = &v })
+	}
+	if mode == applyReplace && match.Title != "" {
+		item.Title = match.Title
+	}
+	setString(MetadataFieldOriginalTitle, &item.OriginalTitle, func(m *MetadataMatch) string { return m.OriginalTitle })
+	setString(MetadataFieldDescription, &item.Description, func(m *MetadataMatch) string { return m.Description })
+	setString(MetadataFieldDirector, &item.Director, func(m *MetadataMatch) string { return m.Director })
+	setString(MetadataFieldLanguage, &item.Language, func(m *MetadataMatch) string { return m.Language })
+	set(MetadataFieldYear, item.Year == nil,
+		func(m *MetadataMatch) bool { return m.Year != nil },
+		func(m *MetadataMatch) { item.Year = m.Year })
+	set(MetadataFieldGenres, len(item.Genre) == 0,
+		func(m *MetadataMatch) bool { return len(m.Genres) > 0 },
+		func(m *MetadataMatch) { item.Genre = m.Genres })
+	set(MetadataFieldRating, item.Rating == nil,
+		func(m *MetadataMatch) bool { return m.Rating != nil },
+		func(m *MetadataMatch) { item.Rating = m.Rating })
+	set(MetadataFieldRuntime, item.Runtime == nil,
+		func(m *MetadataMatch) bool { return m.Runtime != nil },
+		func(m *MetadataMatch) { item.Runtime = m.Runtime })
+	item.Status = status
+	if err := s.itemRepo.Update(ctx, item); err != nil {
+		return nil, err
+	}
+
+	for _, m := range matches {
+		if err := s.storeExternalMetadata(ctx, item.ID, m); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &MetadataEnrichmentResult{
+		MediaItemID: item.ID,
+		MediaType:   mediaType,
+		Status:      status,
+		Match:       match,
+	}
+	cover := fieldSource(MetadataFieldCover, matches, cfg, func(m *MetadataMatch) bool { return m.CoverURL != "" })
+	if cover != nil && s.coverDir != "" {
+		if err := s.cacheCover(ctx, item.ID, cover.CoverURL); err != nil {
+			s.logger.Warn("Failed to cache cover art",
+				zap.Int64("media_item_id", item.ID), zap.String("url", cover.CoverURL), zap.Error(err))
+		} else {
+			result.CoverCached = true
+			sources[MetadataFieldCover] = cover
+		}
+	}
+
+	if err := s.recordFieldSources(ctx, item.ID, sources); err != nil {
+		s.logger.Warn("Failed to record metadata sources", zap.Int64("media_item_id", item.ID), zap.Error(err))
+	}
+	result.Sources = make(map[string]string, len(sources))
+	for field, m := range sources {
+		result.Sources[field] = m.Provider
+	}
+
+	s.logger.Info("Media item metadata enriched",
+		zap.Int64("media_item_id", item.ID),
+		zap.String("provider", match.Provider),
+		zap.String("external_id", match.ExternalID),
+		zap.Int("sources", len(matches)),
+		zap.String("status", status))
+	return result, nil
+}
+
+// storeExternalMetadata saves a provider record of a media item.
+func (s *MetadataEnrichmentService) storeExternalMetadata(ctx context.Context, mediaItemID int64, match *MetadataMatch) error {
+	data := []byte(match.Data)
+	if len(data) == 0 {
+		var err error
+		if data, err = json.Marshal(match); err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+	}
+	em := &models.ExternalMetadata{
+		MediaItemID: mediaItemID,
+		Provider:    match.Provider,
+		ExternalID:  match.ExternalID,
+		Data:        string(data),
+		Rating:      match.Rating,
+	}
+	if match.CoverURL != "" {
+		em.CoverURL = &match.CoverURL
+	}
+	if match.URL != "" {
+		em.ReviewURL = &match.URL
+	}
+	return s.extMetaRepo.Upsert(ctx, em)
+}
+
+// coverImageExtensions maps the image types accepted as covers to the
+// extensions the cover art resolver looks for.
+var coverImageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// cacheCover downloads a cover image to <coverDir>/media_item/<id>.<ext>,
+// replacing a previous cover of any type.
+func (s *MetadataEnrichmentService) cacheCover(ctx context.Context, mediaItemID int64, coverURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coverURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", subtitleUserAgent)
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cover download returned status %d", resp.StatusCode)
+	}
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	ext, ok := coverImageExtensions[contentType]
+	if !ok {
+		return fmt.Errorf("unsupported cover image type %q", contentType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverImageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxCoverImageSize {
+		return fmt.Errorf("cover image exceeds %d bytes", maxCoverImageSize)
+	}
+
+	dir := filepath.Join(s.coverDir, "media_item")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d", mediaItemID)
+	for _, other := range []string{".jpg", ".jpeg", ".png", ".webp"} {
+		if other != ext {
+			os.Remove(filepath.Join(dir, name+other))
+		}
+	}
+	tmp := filepath.Join(dir, name+ext+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, name+ext))
+}
+
+// metadataMatchScore rates a search result against the query: up to 0.7
+// for the title and 0.3 for the year, reduced when the artist or author
+// differs.
+func metadataMatchScore(query MetadataQuery, match MetadataMatch) float64 {
+	title := metadataTitleSimilarity(query.Title, match.Title)
+	if match.OriginalTitle != "" {
+		title = math.Max(title, metadataTitleSimilarity(query.Title, match.OriginalTitle))
+	}
+	score := 0.7 * title
+	switch {
+	case query.Year == nil || match.Year == nil:
+		score += 0.15
+	case *query.Year == *match.Year:
+		score += 0.3
+	case *query.Year-*match.Year == 1 || *match.Year-*query.Year == 1:
+		score += 0.15
+	}
+	if query.Artist != "" && match.Creator != "" && metadataTitleSimilarity(query.Artist, match.Creator) < 0.5 {
+		score *= 0.8
+	}
+	return math.Round(score*100) / 100
+}
+
+// metadataTitleSimilarity compares titles ignoring case, punctuation and a
+// leading article: 1 when equal, at least 0.8 when one contains the other
+// and otherwise the share of words they have in common.
+func metadataTitleSimilarity(a, b string) float64 {
+	wordsA, wordsB := metadataTitleWords(a), metadataTitleWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	joinedA, joinedB := strings.Join(wordsA, " "), strings.Join(wordsB, " ")
+	if joinedA == joinedB {
+		return 1
+	}
+
+	setB := map[string]bool{}
+	for _, w := range wordsB {
+		setB[w] = true
+	}
+	union := len(setB)
+	common := 0
+	seen := map[string]bool{}
+	for _, w := range wordsA {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		if setB[w] {
+			common++
+		} else {
+			union++
+		}
+	}
+	similarity := float64(common) / float64(union)
+	if strings.Contains(" "+joinedA+" ", " "+joinedB+" ") || strings.Contains(" "+joinedB+" ", " "+joinedA+" ") {
+		similarity = math.Max(similarity, 0.8)
+	}
+	return similarity
+}
+
+func metadataTitleWords(title string) []string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && (words[0] == "the" || words[0] == "a" || words[0] == "an") {
+		words = words[1:]
+	}
+	return words
+}
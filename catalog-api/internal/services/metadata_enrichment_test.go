@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/media/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMetadataMatchScore(t *testing.T) {
+	year := func(y int) *int { return &y }
+
+	assert.Equal(t, 1.0, metadataTitleSimilarity("The Matrix", "matrix"))
+	assert.Equal(t, 0.8, metadataTitleSimilarity("Matrix", "The Matrix Reloaded"))
+	assert.Equal(t, 0.0, metadataTitleSimilarity("Alien", "Heat"))
+
+	query := MetadataQuery{Title: "The Matrix", Year: year(1999)}
+	assert.Equal(t, 1.0, metadataMatchScore(query, MetadataMatch{Title: "The Matrix", Year: year(1999)}))
+	assert.Equal(t, 0.85, metadataMatchScore(query, MetadataMatch{Title: "The Matrix", Year: year(2000)}))
+	assert.Equal(t, 0.7, metadataMatchScore(query, MetadataMatch{Title: "The Matrix", Year: year(2021)}))
+	assert.Equal(t, 0.85, metadataMatchScore(MetadataQuery{Title: "Matrix"}, MetadataMatch{Title: "The Matrix", Year: year(1999)}))
+	assert.Equal(t, 1.0, metadataMatchScore(query, MetadataMatch{Title: "Matrix, The", OriginalTitle: "The Matrix", Year: year(1999)}))
+
+	album := MetadataQuery{Title: "Kind of Blue", Artist: "Miles Davis"}
+	assert.Equal(t, 0.85, metadataMatchScore(album, MetadataMatch{Title: "Kind of Blue", Creator: "Miles Davis"}))
+	assert.Equal(t, 0.68, metadataMatchScore(album, MetadataMatch{Title: "Kind of Blue", Creator: "Tribute Band"}))
+}
+
+// newMetadataTestServer serves TMDB, MusicBrainz, Google Books and cover
+// image responses.
+func newMetadataTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	write := func(w http.ResponseWriter, v interface{}) { json.NewEncoder(w).Encode(v) }
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/tmdb/search/movie":
+			if q.Get("api_key") != "key" || !strings.Contains(q.Get("query"), "Matrix") {
+				write(w, map[string]interface{}{"results": []interface{}{}})
+				return
+			}
+			write(w, map[string]interface{}{"results": []map[string]interface{}{
+				{"id": 604, "title": "The Matrix Reloaded", "release_date": "2003-05-15"},
+				{"id": 603, "title": "The Matrix", "release_date": "1999-03-30", "poster_path": "/matrix.jpg"},
+			}})
+		case "/tmdb/movie/603":
+			write(w, map[string]interface{}{
+				"id": 603, "title": "The Matrix", "original_title": "The Matrix", "release_date": "1999-03-30",
+				"overview": "A hacker learns the truth.", "poster_path": "/matrix.jpg", "vote_average": 8.2,
+				"runtime": 136, "original_language": "en",
+				"genres":  []map[string]string{{"name": "Action"}, {"name": "Science Fiction"}},
+				"credits": map[string]interface{}{"crew": []map[string]string{{"job": "Writer", "name": "Someone"}, {"job": "Director", "name": "Lana Wachowski"}}},
+			})
+		case "/tmdb/search/tv":
+			write(w, map[string]interface{}{"results": []map[string]interface{}{
+				{"id": 1396, "name": "Breaking Bad", "first_air_date": "2008-01-20"},
+			}})
+		case "/tmdb/tv/1396":
+			write(w, map[string]interface{}{
+				"id": 1396, "name": "Breaking Bad", "first_air_date": "2008-01-20", "episode_run_time": []int{47},
+				"created_by": []map[string]string{{"name": "Vince Gilligan"}},
+			})
+		case "/mb/release-group":
+			if !strings.Contains(q.Get("query"), `artist:"Miles Davis"`) {
+				write(w, map[string]interface{}{"release-groups": []interface{}{}})
+				return
+			}
+			write(w, map[string]interface{}{"release-groups": []map[string]interface{}{
+				{"id": "kob", "title": "Kind of Blue", "first-release-date": "1959-08-17",
+					"artist-credit": []map[string]string{{"name": "Miles Davis"}}},
+			}})
+		case "/mb/release-group/kob":
+			write(w, map[string]interface{}{
+				"id": "kob", "title": "Kind of Blue", "first-release-date": "1959-08-17",
+				"artist-credit": []map[string]string{{"name": "Miles Davis"}},
+				"genres":        []map[string]string{{"name": "jazz"}},
+			})
+		case "/books/volumes/vol1":
+			write(w, map[string]interface{}{"id": "vol1", "volumeInfo": map[string]interface{}{
+				"title": "Dune", "authors": []string{"Frank Herbert"}, "publishedDate": "1965",
+				"averageRating": 4.5, "categories": []string{"Fiction"},
+			}})
+		case "/img/matrix.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("jpeg"))
+		case "/covers/release-group/kob/front":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type metadataFixture struct {
+	svc      *MetadataEnrichmentService
+	itemRepo *repository.MediaItemRepository
+	extRepo  *repository.ExternalMetadataRepository
+	coverDir string
+}
+
+func newMetadataFixture(t *testing.T) *metadataFixture {
+	t.Helper()
+	db := setupExtendedTestDB(t)
+	server := newMetadataTestServer(t)
+
+	tmdb := NewTMDBMetadataClient(server.URL+"/tmdb", "key", nil)
+	tmdb.imageURL = server.URL + "/img"
+	musicBrainz := NewMusicBrainzMetadataClient(server.URL+"/mb", nil)
+	musicBrainz.coverURL = server.URL + "/covers"
+	books := NewGoogleBooksMetadataClient(server.URL+"/books", "", nil)
+
+	f := &metadataFixture{
+		itemRepo: repository.NewMediaItemRepository(db),
+		extRepo:  repository.NewExternalMetadataRepository(db),
+		coverDir: t.TempDir(),
+	}
+	f.svc = NewMetadataEnrichmentService(db, zap.NewNop(), f.itemRepo, f.extRepo, f.coverDir)
+	f.svc.SetProviders(tmdb, musicBrainz, books)
+	return f
+}
+
+func (f *metadataFixture) createItem(t *testing.T, mediaTypeID int64, title string, year *int, parentID *int64) int64 {
+	t.Helper()
+	id, err := f.itemRepo.Create(context.Background(), &models.MediaItem{
+		MediaTypeID: mediaTypeID, Title: title, Year: year, ParentID: parentID, Status: "detected",
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func TestMetadataEnrichment_Enrich(t *testing.T) {
+	f := newMetadataFixture(t)
+	ctx := context.Background()
+	year := 1999
+	id := f.createItem(t, 1, "Matrix", &year, nil)
+	item, err := f.itemRepo.GetByID(ctx, id)
+	require.NoError(t, err)
+	mine := "My own summary"
+	item.Description = &mine
+	require.NoError(t, f.itemRepo.Update(ctx, item))
+
+	result, err := f.svc.Enrich(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "603", result.Match.ExternalID)
+	assert.Equal(t, 1.0, result.Match.Score)
+	assert.True(t, result.CoverCached)
+
+	item, err = f.itemRepo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "Matrix", item.Title, "automatic matches keep the title")
+	assert.Equal(t, "My own summary", *item.Description, "automatic matches keep existing fields")
+	assert.Equal(t, []string{"Action", "Science Fiction"}, item.Genre)
+	assert.Equal(t, "Lana Wachowski", *item.Director)
+	assert.Equal(t, 136, *item.Runtime)
+	assert.Equal(t, 8.2, *item.Rating)
+	assert.Nil(t, item.OriginalTitle)
+	assert.Equal(t, MediaStatusMatched, item.Status)
+
+	external, err := f.extRepo.GetByItem(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, external, 1)
+	assert.Equal(t, "tmdb", external[0].Provider)
+	assert.Contains(t, *external[0].CoverURL, "/img/matrix.jpg")
+	assert.Equal(t, "https://www.themoviedb.org/movie/603", *external[0].ReviewURL)
+	assert.Contains(t, external[0].Data, "Lana Wachowski")
+
+	cover, err := os.ReadFile(filepath.Join(f.coverDir, "media_item", strconv.FormatInt(id, 10)+".jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(cover))
+
+	_, err = f.svc.Enrich(ctx, f.createItem(t, 1, "Completely Unknown Film", nil, nil))
+	assert.ErrorContains(t, err, "no metadata match found")
+	_, err = f.svc.Enrich(ctx, f.createItem(t, 8, "Some Game", nil, nil))
+	assert.ErrorContains(t, err, "unsupported media type")
+	_, err = f.svc.Enrich(ctx, 999)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestMetadataEnrichment_EnrichAlbumUsesArtist(t *testing.T) {
+	f := newMetadataFixture(t)
+	ctx := context.Background()
+	artistID := f.createItem(t, 6, "Miles Davis", nil, nil)
+	albumID := f.createItem(t, 5, "Kind of Blue", nil, &artistID)
+
+	result, err := f.svc.Enrich(ctx, albumID)
+	require.NoError(t, err)
+	assert.Equal(t, "musicbrainz", result.Match.Provider)
+	assert.Equal(t, "Miles Davis", result.Match.Creator)
+	assert.True(t, result.CoverCached)
+	_, err = os.Stat(filepath.Join(f.coverDir, "media_item", strconv.FormatInt(albumID, 10)+".png"))
+	assert.NoError(t, err)
+
+	item, err := f.itemRepo.GetByID(ctx, albumID)
+	require.NoError(t, err)
+	assert.Equal(t, 1959, *item.Year)
+	assert.Equal(t, []string{"jazz"}, item.Genre)
+}
+
+func TestMetadataEnrichment_RematchAndIdentify(t *testing.T) {
+	f := newMetadataFixture(t)
+	ctx := context.Background()
+
+	// A series misdetected as a movie under its folder name
+	id := f.createItem(t, 1, "Breaking Bad S01 1080p", nil, nil)
+	_, err := f.svc.Enrich(ctx, id)
+	require.Error(t, err)
+
+	matches, err := f.svc.FindMatches(ctx, id, RematchRequest{MediaType: "tv_show", Title: "Breaking Bad"})
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, "1396", matches[0].ExternalID)
+
+	_, err = f.svc.Rematch(ctx, id, RematchRequest{MediaType: "podcast"})
+	assert.ErrorContains(t, err, "invalid media type")
+
+	result, err := f.svc.Rematch(ctx, id, RematchRequest{MediaType: "tv_show", Title: "Breaking Bad"})
+	require.NoError(t, err)
+	assert.Equal(t, "tv_show", result.MediaType)
+	item, err := f.itemRepo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), item.MediaTypeID)
+	assert.Equal(t, "Breaking Bad", item.Title)
+	assert.Equal(t, 2008, *item.Year)
+	assert.Equal(t, "Vince Gilligan", *item.Director)
+	assert.Equal(t, 47, *item.Runtime)
+
+	// Identifying replaces the TMDB record with a chosen one
+	_, err = f.svc.Identify(ctx, id, IdentifyRequest{Provider: "google_books", ExternalID: "vol1"})
+	assert.ErrorContains(t, err, "invalid provider google_books for media type tv_show")
+	_, err = f.svc.Identify(ctx, id, IdentifyRequest{Provider: "imdb", ExternalID: "tt1"})
+	assert.ErrorContains(t, err, "invalid provider")
+
+	result, err = f.svc.Identify(ctx, id, IdentifyRequest{MediaType: "book", Provider: "google_books", ExternalID: "vol1"})
+	require.NoError(t, err)
+	assert.Equal(t, MediaStatusIdentified, result.Status)
+	assert.False(t, result.CoverCached)
+	item, err = f.itemRepo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", item.Title)
+	assert.Equal(t, 1965, *item.Year)
+	assert.Equal(t, 9.0, *item.Rating)
+	assert.Equal(t, MediaStatusIdentified, item.Status)
+
+	external, err := f.extRepo.GetByItem(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, external, 1)
+	assert.Equal(t, "google_books", external[0].Provider)
+	assert.Equal(t, "vol1", external[0].ExternalID)
+}
+
+type recordingEnricher struct{ ids []int64 }
+
+func (r *recordingEnricher) EnrichItems(ctx context.Context, mediaItemIDs []int64) {
+	r.ids = append(r.ids, mediaItemIDs...)
+}
+
+func TestAggregateAfterScan_EnrichesCreatedItems(t *testing.T) {
+	db := setupExtendedTestDB(t)
+	ctx := context.Background()
+	itemRepo := repository.NewMediaItemRepository(db)
+	svc := NewAggregationService(db, zap.NewNop(), itemRepo, repository.NewMediaFileRepository(db),
+		repository.NewDirectoryAnalysisRepository(db), repository.NewExternalMetadataRepository(db))
+	enricher := &recordingEnricher{}
+	svc.SetEnricher(enricher)
+
+	_, err := db.Exec("INSERT INTO storage_roots (id, name, protocol) VALUES (1, 'test-root', 'local')")
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO files (id, storage_root_id, path, name, is_directory, deleted, parent_id, size)
+		VALUES (10, 1, '/movies/Inception (2010)', 'Inception (2010)', 1, 0, NULL, 0)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO files (id, storage_root_id, path, name, extension, is_directory, deleted, parent_id, size)
+		VALUES (11, 1, '/movies/Inception (2010)/Inception.mkv', 'Inception.mkv', '.mkv', 0, 0, 10, 5000000000)`)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.AggregateAfterScan(ctx, 1))
+	item, err := itemRepo.GetByTitle(ctx, "Inception", 1)
+	require.NoError(t, err)
+	require.NotNil(t, item)
+	assert.Equal(t, []int64{item.ID}, enricher.ids)
+
+	// Items that already exist are not enriched again
+	require.NoError(t, svc.AggregateAfterScan(ctx, 1))
+	assert.Len(t, enricher.ids, 1)
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultMetadataProviderCacheTTL is how long provider responses are kept
+// unless configured otherwise.
+const DefaultMetadataProviderCacheTTL = 7 * 24 * time.Hour
+
+// cachedMetadataMatch stores a match with its raw provider record, which
+// MetadataMatch leaves out of its JSON.
+type cachedMetadataMatch struct {
+	MetadataMatch
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// MetadataProviderCacheStats counts the cached responses of one provider.
+// Hits and misses are counted since the server started.
+type MetadataProviderCacheStats struct {
+	Provider string `json:"provider"`
+	Entries  int    `json:"entries"`
+	Expired  int    `json:"expired"`
+	Hits     int64  `json:"hits"`
+	Misses   int64  `json:"misses"`
+}
+
+// MetadataProviderCache keeps metadata provider search results and
+// records in metadata_provider_cache, so re-enriching a library does not
+// query the providers again for what they answered recently. Failed
+// requests are not cached.
+type MetadataProviderCache struct {
+	db     *database.DB
+	logger *zap.Logger
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	hits   map[string]int64
+	misses map[string]int64
+}
+
+// NewMetadataProviderCache creates a MetadataProviderCache keeping
+// responses for ttl, or DefaultMetadataProviderCacheTTL when it is zero.
+func NewMetadataProviderCache(db *database.DB, logger *zap.Logger, ttl time.Duration) *MetadataProviderCache {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if ttl <= 0 {
+		ttl = DefaultMetadataProviderCacheTTL
+	}
+	return &MetadataProviderCache{
+		db:     db,
+		logger: logger,
+		ttl:    ttl,
+		now:    time.Now,
+		hits:   make(map[string]int64),
+		misses: make(map[string]int64),
+	}
+}
+
+// Wrap returns a client answering from the cache before asking provider.
+func (c *MetadataProviderCache) Wrap(provider MetadataProviderClient) MetadataProviderClient {
+	return &cachedMetadataProvider{MetadataProviderClient: provider, cache: c}
+}
+
+// WrapAll wraps each provider.
+func (c *MetadataProviderCache) WrapAll(providers []MetadataProviderClient) []MetadataProviderClient {
+	wrapped := make([]MetadataProviderClient, len(providers))
+	for i, p := range providers {
+		wrapped[i] = c.Wrap(p)
+	}
+	return wrapped
+}
+
+// metadataCacheKey identifies a request within a provider. Searches are
+// keyed on a hash of the query, records on their media type and ID.
+func metadataCacheKey(kind string, request interface{}) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return kind + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// get decodes a cached response into dest, reporting whether there was
+// one. Lookup errors count as misses.
+func (c *MetadataProviderCache) get(ctx context.Context, provider, key string, dest interface{}) bool {
+	var response string
+	err := c.db.QueryRowContext(ctx,
+		`SELECT response FROM metadata_provider_cache WHERE provider = ? AND request_key = ? AND expires_at > ?`,
+		provider, key, c.now()).Scan(&response)
+	if err == nil {
+		err = json.Unmarshal([]byte(response), dest)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if err != sql.ErrNoRows {
+			c.logger.Warn("Failed to read metadata provider cache", zap.String("provider", provider), zap.Error(err))
+		}
+		c.misses[provider]++
+		return false
+	}
+	c.hits[provider]++
+	return true
+}
+
+// put stores a response, replacing an earlier one for the same request.
+func (c *MetadataProviderCache) put(ctx context.Context, provider, mediaType, key string, response interface{}) {
+	data, err := json.Marshal(response)
+	if err == nil {
+		now := c.now()
+		var result sql.Result
+		result, err = c.db.ExecContext(ctx,
+			`UPDATE metadata_provider_cache SET media_type = ?, response = ?, created_at = ?, expires_at = ?
+			 WHERE provider = ? AND request_key = ?`,
+			mediaType, string(data), now, now.Add(c.ttl), provider, key)
+		if err == nil {
+			if updated, _ := result.RowsAffected(); updated == 0 {
+				_, err = c.db.ExecContext(ctx,
+					`INSERT INTO metadata_provider_cache (provider, media_type, request_key, response, created_at, expires_at)
+					 VALUES (?, ?, ?, ?, ?, ?)`,
+					provider, mediaType, key, string(data), now, now.Add(c.ttl))
+			}
+		}
+	}
+	if err != nil {
+		c.logger.Warn("Failed to write metadata provider cache", zap.String("provider", provider), zap.Error(err))
+	}
+}
+
+// Stats counts the cached responses of each provider that has any or
+// was asked for one.
+func (c *MetadataProviderCache) Stats(ctx context.Context) ([]MetadataProviderCacheStats, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT provider, COUNT(*), SUM(CASE WHEN expires_at <= ? THEN 1 ELSE 0 END)
+		 FROM metadata_provider_cache GROUP BY provider ORDER BY provider`, c.now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count cached metadata: %w", err)
+	}
+	defer rows.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := []MetadataProviderCacheStats{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var s MetadataProviderCacheStats
+		if err := rows.Scan(&s.Provider, &s.Entries, &s.Expired); err != nil {
+			return nil, fmt.Errorf("failed to count cached metadata: %w", err)
+		}
+		s.Hits, s.Misses = c.hits[s.Provider], c.misses[s.Provider]
+		seen[s.Provider] = true
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count cached metadata: %w", err)
+	}
+	for provider := range c.misses {
+		if !seen[provider] {
+			stats = append(stats, MetadataProviderCacheStats{Provider: provider, Hits: c.hits[provider], Misses: c.misses[provider]})
+		}
+	}
+	return stats, nil
+}
+
+// Invalidate deletes the cached responses of a provider, or of every
+// provider when it is empty, optionally only those for one media type.
+// It returns how many were deleted.
+func (c *MetadataProviderCache) Invalidate(ctx context.Context, provider, mediaType string) (int64, error) {
+	query, args := `DELETE FROM metadata_provider_cache WHERE 1 = 1`, []interface{}{}
+	if provider != "" {
+		query += ` AND provider = ?`
+		args = append(args, provider)
+	}
+	if mediaType != "" {
+		query += ` AND media_type = ?`
+		args = append(args, mediaType)
+	}
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to invalidate metadata cache: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	c.logger.Info("Metadata provider cache invalidated",
+		zap.String("provider", provider), zap.String("media_type", mediaType), zap.Int64("entries", deleted))
+	return deleted, nil
+}
+
+// cachedMetadataProvider answers searches and lookups from the cache.
+type cachedMetadataProvider struct {
+	MetadataProviderClient
+	cache *MetadataProviderCache
+}
+
+func (p *cachedMetadataProvider) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	key, err := metadataCacheKey("search", query)
+	if err != nil {
+		return nil, err
+	}
+	var cached []cachedMetadataMatch
+	if p.cache.get(ctx, p.Name(), key, &cached) {
+		matches := make([]MetadataMatch, len(cached))
+		for i, m := range cached {
+			matches[i] = m.MetadataMatch
+			matches[i].Data = m.Data
+		}
+		return matches, nil
+	}
+
+	matches, err := p.MetadataProviderClient.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	cached = make([]cachedMetadataMatch, len(matches))
+	for i, m := range matches {
+		cached[i] = cachedMetadataMatch{MetadataMatch: m, Data: m.Data}
+	}
+	p.cache.put(ctx, p.Name(), query.MediaType, key, cached)
+	return matches, nil
+}
+
+func (p *cachedMetadataProvider) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	key, err := metadataCacheKey("lookup", []string{mediaType, externalID})
+	if err != nil {
+		return nil, err
+	}
+	var cached cachedMetadataMatch
+	if p.cache.get(ctx, p.Name(), key, &cached) {
+		match := cached.MetadataMatch
+		match.Data = cached.Data
+		return &match, nil
+	}
+
+	match, err := p.MetadataProviderClient.Lookup(ctx, mediaType, externalID)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.put(ctx, p.Name(), mediaType, key, cachedMetadataMatch{MetadataMatch: *match, Data: match.Data})
+	return match, nil
+}
@@ -0,0 +1,510 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Metadata provider names, as stored in external_metadata.provider.
+const (
+	MetadataProviderTMDB        = "tmdb"
+	MetadataProviderMusicBrainz = "musicbrainz"
+	MetadataProviderGoogleBooks = "google_books"
+)
+
+const (
+	defaultTMDBURL          = "https://api.themoviedb.org/3"
+	defaultTMDBImageURL     = "https://image.tmdb.org/t/p/w500"
+	defaultMusicBrainzURL   = "https://musicbrainz.org/ws/2"
+	defaultCoverArchiveURL  = "https://coverartarchive.org"
+	defaultGoogleBooksURL   = "https://www.googleapis.com/books/v1"
+	metadataSearchResultMax = 10
+)
+
+// MetadataProviderClient looks up media items in an external metadata
+// database. Search results may be partial; Lookup returns the full record
+// for one of them.
+type MetadataProviderClient interface {
+	Name() string
+	Supports(mediaType string) bool
+	Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error)
+	Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error)
+}
+
+// metadataGetJSON fetches a provider API URL and decodes the JSON response.
+func metadataGetJSON(ctx context.Context, client *http.Client, endpoint string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", subtitleUserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("metadata record not found")
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return providerRateLimited(resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metadata provider returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// metadataGetKeyed fetches a provider API URL with an API key in the
+// keyParam query parameter: one of the provider's keys in pool, rotated
+// on 429 responses, or failing that key. Without either the request is
+// sent without a key.
+func metadataGetKeyed(ctx context.Context, client *http.Client, pool *ProviderKeyPool, provider, endpoint string, params url.Values, keyParam, key string, dest interface{}) error {
+	get := func(key string) error {
+		if key != "" {
+			params.Set(keyParam, key)
+		}
+		target := endpoint
+		if encoded := params.Encode(); encoded != "" {
+			target += "?" + encoded
+		}
+		return metadataGetJSON(ctx, client, target, dest)
+	}
+	if pool != nil && pool.HasKeys(provider) {
+		return pool.Do(ctx, provider, get)
+	}
+	return get(key)
+}
+
+// metadataYear returns the year of a date such as 1999-03-31 or 1999.
+func metadataYear(date string) *int {
+	if len(date) < 4 {
+		return nil
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil || year < 1800 {
+		return nil
+	}
+	return &year
+}
+
+// TMDBMetadataClient looks up movies and TV shows on The Movie Database.
+type TMDBMetadataClient struct {
+	baseURL    string
+	imageURL   string
+	apiKey     string
+	keys       *ProviderKeyPool
+	httpClient *http.Client
+}
+
+// NewTMDBMetadataClient creates a TMDB client for the API at baseURL, or
+// api.themoviedb.org when baseURL is empty. TMDB requires an API key.
+func NewTMDBMetadataClient(baseURL, apiKey string, httpClient *http.Client) *TMDBMetadataClient {
+	if baseURL == "" {
+		baseURL = defaultTMDBURL
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &TMDBMetadataClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		imageURL:   defaultTMDBImageURL,
+		apiKey:     apiKey,
+		httpClient: httpClient,
+	}
+}
+
+// SetKeyPool makes the client take its API keys from pool, when the pool
+// has TMDB keys, instead of the one it was created with.
+func (c *TMDBMetadataClient) SetKeyPool(pool *ProviderKeyPool) {
+	c.keys = pool
+}
+
+// Name implements MetadataProviderClient.
+func (c *TMDBMetadataClient) Name() string { return MetadataProviderTMDB }
+
+// Supports implements MetadataProviderClient.
+func (c *TMDBMetadataClient) Supports(mediaType string) bool {
+	return mediaType == "movie" || mediaType == "tv_show"
+}
+
+// tmdbRecord holds the fields of TMDB movie and TV records; movies use
+// title and release_date, TV shows name and first_air_date.
+type tmdbRecord struct {
+	ID               int64   `json:"id"`
+	Title            string  `json:"title"`
+	Name             string  `json:"name"`
+	OriginalTitle    string  `json:"original_title"`
+	OriginalName     string  `json:"original_name"`
+	ReleaseDate      string  `json:"release_date"`
+	FirstAirDate     string  `json:"first_air_date"`
+	Overview         string  `json:"overview"`
+	PosterPath       string  `json:"poster_path"`
+	VoteAverage      float64 `json:"vote_average"`
+	OriginalLanguage string  `json:"original_language"`
+	Runtime          int     `json:"runtime"`
+	EpisodeRunTime   []int   `json:"episode_run_time"`
+	Genres           []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	CreatedBy []struct {
+		Name string `json:"name"`
+	} `json:"created_by"`
+	Credits struct {
+		Crew []struct {
+			Job  string `json:"job"`
+			Name string `json:"name"`
+		} `json:"crew"`
+	} `json:"credits"`
+}
+
+// tmdbKind returns the TMDB path segment for a media type.
+func tmdbKind(mediaType string) string {
+	if mediaType == "tv_show" {
+		return "tv"
+	}
+	return "movie"
+}
+
+// Search implements MetadataProviderClient.
+func (c *TMDBMetadataClient) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	kind := tmdbKind(query.MediaType)
+	params := url.Values{}
+	params.Set("query", query.Title)
+	if query.Year != nil {
+		if kind == "tv" {
+			params.Set("first_air_date_year", strconv.Itoa(*query.Year))
+		} else {
+			params.Set("year", strconv.Itoa(*query.Year))
+		}
+	}
+
+	var response struct {
+		Results []tmdbRecord `json:"results"`
+	}
+	if err := metadataGetKeyed(ctx, c.httpClient, c.keys, MetadataProviderTMDB, c.baseURL+"/search/"+kind, params, "api_key", c.apiKey, &response); err != nil {
+		return nil, err
+	}
+	matches := []MetadataMatch{}
+	for i, record := range response.Results {
+		if i == metadataSearchResultMax {
+			break
+		}
+		matches = append(matches, *c.match(kind, record))
+	}
+	return matches, nil
+}
+
+// Lookup implements MetadataProviderClient.
+func (c *TMDBMetadataClient) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	if _, err := strconv.ParseInt(externalID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid tmdb ID: %s", externalID)
+	}
+	kind := tmdbKind(mediaType)
+	params := url.Values{}
+	params.Set("append_to_response", "credits")
+
+	var raw json.RawMessage
+	if err := metadataGetKeyed(ctx, c.httpClient, c.keys, MetadataProviderTMDB, c.baseURL+"/"+kind+"/"+externalID, params, "api_key", c.apiKey, &raw); err != nil {
+		return nil, err
+	}
+	var record tmdbRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse tmdb record: %w", err)
+	}
+	match := c.match(kind, record)
+	match.Data = raw
+	return match, nil
+}
+
+func (c *TMDBMetadataClient) match(kind string, record tmdbRecord) *MetadataMatch {
+	match := &MetadataMatch{
+		Provider:      MetadataProviderTMDB,
+		ExternalID:    strconv.FormatInt(record.ID, 10),
+		Title:         record.Title,
+		OriginalTitle: record.OriginalTitle,
+		Year:          metadataYear(record.ReleaseDate),
+		Description:   record.Overview,
+		Language:      record.OriginalLanguage,
+		URL:           fmt.Sprintf("https://www.themoviedb.org/%s/%d", kind, record.ID),
+	}
+	if kind == "tv" {
+		match.Title, match.OriginalTitle = record.Name, record.OriginalName
+		match.Year = metadataYear(record.FirstAirDate)
+	}
+	if match.OriginalTitle == match.Title {
+		match.OriginalTitle = ""
+	}
+	if record.VoteAverage > 0 {
+		rating := record.VoteAverage
+		match.Rating = &rating
+	}
+	if record.PosterPath != "" {
+		match.CoverURL = c.imageURL + record.PosterPath
+	}
+	for _, genre := range record.Genres {
+		match.Genres = append(match.Genres, genre.Name)
+	}
+	runtime := record.Runtime
+	if len(record.EpisodeRunTime) > 0 {
+		runtime = record.EpisodeRunTime[0]
+	}
+	if runtime > 0 {
+		match.Runtime = &runtime
+	}
+	for _, crew := range record.Credits.Crew {
+		if crew.Job == "Director" {
+			match.Director = crew.Name
+			break
+		}
+	}
+	if match.Director == "" && len(record.CreatedBy) > 0 {
+		match.Director = record.CreatedBy[0].Name
+	}
+	return match
+}
+
+// MusicBrainzMetadataClient looks up albums as MusicBrainz release groups,
+// with cover art from the Cover Art Archive.
+type MusicBrainzMetadataClient struct {
+	baseURL    string
+	coverURL   string
+	httpClient *http.Client
+}
+
+// NewMusicBrainzMetadataClient creates a MusicBrainz client for the API at
+// baseURL, or musicbrainz.org when baseURL is empty.
+func NewMusicBrainzMetadataClient(baseURL string, httpClient *http.Client) *MusicBrainzMetadataClient {
+	if baseURL == "" {
+		baseURL = defaultMusicBrainzURL
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &MusicBrainzMetadataClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		coverURL:   defaultCoverArchiveURL,
+		httpClient: httpClient,
+	}
+}
+
+// Name implements MetadataProviderClient.
+func (c *MusicBrainzMetadataClient) Name() string { return MetadataProviderMusicBrainz }
+
+// Supports implements MetadataProviderClient.
+func (c *MusicBrainzMetadataClient) Supports(mediaType string) bool {
+	return mediaType == "music_album"
+}
+
+// musicBrainzReleaseGroup is a release group in MusicBrainz responses.
+type musicBrainzReleaseGroup struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	FirstReleaseDate string `json:"first-release-date"`
+	ArtistCredit     []struct {
+		Name       string `json:"name"`
+		JoinPhrase string `json:"joinphrase"`
+	} `json:"artist-credit"`
+	Genres []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+}
+
+// luceneQuote quotes a term for a MusicBrainz search query.
+func luceneQuote(term string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(term) + `"`
+}
+
+// Search implements MetadataProviderClient.
+func (c *MusicBrainzMetadataClient) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	lucene := "releasegroup:" + luceneQuote(query.Title)
+	if query.Artist != "" {
+		lucene += " AND artist:" + luceneQuote(query.Artist)
+	}
+	params := url.Values{}
+	params.Set("query", lucene)
+	params.Set("fmt", "json")
+	params.Set("limit", strconv.Itoa(metadataSearchResultMax))
+
+	var response struct {
+		ReleaseGroups []musicBrainzReleaseGroup `json:"release-groups"`
+	}
+	if err := metadataGetJSON(ctx, c.httpClient, c.baseURL+"/release-group?"+params.Encode(), &response); err != nil {
+		return nil, err
+	}
+	matches := []MetadataMatch{}
+	for _, group := range response.ReleaseGroups {
+		matches = append(matches, *c.match(group))
+	}
+	return matches, nil
+}
+
+// Lookup implements MetadataProviderClient.
+func (c *MusicBrainzMetadataClient) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	if externalID == "" || strings.ContainsAny(externalID, "/?#") {
+		return nil, fmt.Errorf("invalid musicbrainz ID: %s", externalID)
+	}
+	params := url.Values{}
+	params.Set("inc", "artist-credits genres")
+	params.Set("fmt", "json")
+
+	var raw json.RawMessage
+	if err := metadataGetJSON(ctx, c.httpClient, c.baseURL+"/release-group/"+externalID+"?"+params.Encode(), &raw); err != nil {
+		return nil, err
+	}
+	var group musicBrainzReleaseGroup
+	if err := json.Unmarshal(raw, &group); err != nil {
+		return nil, fmt.Errorf("failed to parse musicbrainz release group: %w", err)
+	}
+	match := c.match(group)
+	match.Data = raw
+	return match, nil
+}
+
+func (c *MusicBrainzMetadataClient) match(group musicBrainzReleaseGroup) *MetadataMatch {
+	var artist strings.Builder
+	for _, credit := range group.ArtistCredit {
+		artist.WriteString(credit.Name + credit.JoinPhrase)
+	}
+	match := &MetadataMatch{
+		Provider:   MetadataProviderMusicBrainz,
+		ExternalID: group.ID,
+		Title:      group.Title,
+		Creator:    artist.String(),
+		Year:       metadataYear(group.FirstReleaseDate),
+		CoverURL:   c.coverURL + "/release-group/" + group.ID + "/front",
+		URL:        "https://musicbrainz.org/release-group/" + group.ID,
+	}
+	for _, genre := range group.Genres {
+		match.Genres = append(match.Genres, genre.Name)
+	}
+	return match
+}
+
+// GoogleBooksMetadataClient looks up books and comics on Google Books.
+type GoogleBooksMetadataClient struct {
+	baseURL    string
+	apiKey     string
+	keys       *ProviderKeyPool
+	httpClient *http.Client
+}
+
+// NewGoogleBooksMetadataClient creates a Google Books client for the API
+// at baseURL, or googleapis.com when baseURL is empty. The API key is
+// optional.
+func NewGoogleBooksMetadataClient(baseURL, apiKey string, httpClient *http.Client) *GoogleBooksMetadataClient {
+	if baseURL == "" {
+		baseURL = defaultGoogleBooksURL
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &GoogleBooksMetadataClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: httpClient,
+	}
+}
+
+// SetKeyPool makes the client take its API keys from pool, when the pool
+// has Google Books keys.
+func (c *GoogleBooksMetadataClient) SetKeyPool(pool *ProviderKeyPool) {
+	c.keys = pool
+}
+
+// Name implements MetadataProviderClient.
+func (c *GoogleBooksMetadataClient) Name() string { return MetadataProviderGoogleBooks }
+
+// Supports implements MetadataProviderClient.
+func (c *GoogleBooksMetadataClient) Supports(mediaType string) bool {
+	return mediaType == "book" || mediaType == "comic"
+}
+
+// googleBooksVolume is a volume in Google Books responses.
+type googleBooksVolume struct {
+	ID         string `json:"id"`
+	VolumeInfo struct {
+		Title         string   `json:"title"`
+		Authors       []string `json:"authors"`
+		PublishedDate string   `json:"publishedDate"`
+		Description   string   `json:"description"`
+		Categories    []string `json:"categories"`
+		AverageRating float64  `json:"averageRating"`
+		Language      string   `json:"language"`
+		InfoLink      string   `json:"infoLink"`
+		ImageLinks    struct {
+			Thumbnail string `json:"thumbnail"`
+		} `json:"imageLinks"`
+	} `json:"volumeInfo"`
+}
+
+// Search implements MetadataProviderClient.
+func (c *GoogleBooksMetadataClient) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	q := "intitle:" + query.Title
+	if query.Artist != "" {
+		q += " inauthor:" + query.Artist
+	}
+	params := url.Values{}
+	params.Set("q", q)
+	params.Set("maxResults", strconv.Itoa(metadataSearchResultMax))
+
+	var response struct {
+		Items []googleBooksVolume `json:"items"`
+	}
+	if err := metadataGetKeyed(ctx, c.httpClient, c.keys, MetadataProviderGoogleBooks, c.baseURL+"/volumes", params, "key", c.apiKey, &response); err != nil {
+		return nil, err
+	}
+	matches := []MetadataMatch{}
+	for _, volume := range response.Items {
+		matches = append(matches, *c.match(volume))
+	}
+	return matches, nil
+}
+
+// Lookup implements MetadataProviderClient.
+func (c *GoogleBooksMetadataClient) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	if externalID == "" || strings.ContainsAny(externalID, "/?#") {
+		return nil, fmt.Errorf("invalid google books ID: %s", externalID)
+	}
+	var raw json.RawMessage
+	if err := metadataGetKeyed(ctx, c.httpClient, c.keys, MetadataProviderGoogleBooks, c.baseURL+"/volumes/"+externalID, url.Values{}, "key", c.apiKey, &raw); err != nil {
+		return nil, err
+	}
+	var volume googleBooksVolume
+	if err := json.Unmarshal(raw, &volume); err != nil {
+		return nil, fmt.Errorf("failed to parse google books volume: %w", err)
+	}
+	match := c.match(volume)
+	match.Data = raw
+	return match, nil
+}
+
+func (c *GoogleBooksMetadataClient) match(volume googleBooksVolume) *MetadataMatch {
+	info := volume.VolumeInfo
+	match := &MetadataMatch{
+		Provider:    MetadataProviderGoogleBooks,
+		ExternalID:  volume.ID,
+		Title:       info.Title,
+		Creator:     strings.Join(info.Authors, ", "),
+		Year:        metadataYear(info.PublishedDate),
+		Description: info.Description,
+		Genres:      info.Categories,
+		Language:    info.Language,
+		URL:         info.InfoLink,
+		// Google Books serves thumbnails over plain HTTP by default
+		CoverURL: strings.Replace(info.ImageLinks.Thumbnail, "http://", "https://", 1),
+	}
+	if info.AverageRating > 0 {
+		// Ratings are stored on TMDB's 0-10 scale
+		rating := info.AverageRating * 2
+		match.Rating = &rating
+	}
+	return match
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Metadata refresh job statuses.
+const (
+	MetadataRefreshRunning   = "running"
+	MetadataRefreshCompleted = "completed"
+	MetadataRefreshFailed    = "failed"
+	MetadataRefreshCancelled = "cancelled"
+)
+
+// ErrMetadataRefreshRunning is returned when a refresh is started while
+// another is in progress.
+var ErrMetadataRefreshRunning = errors.New("a metadata refresh is already running")
+
+// metadataRefreshSaveEvery is how many items a job processes between
+// saves of its progress.
+const metadataRefreshSaveEvery = 25
+
+// metadataRefresher defines the enrichment methods MetadataRefreshService
+// uses.
+type metadataRefresher interface {
+	Refresh(ctx context.Context, mediaItemID int64, provider string, onlyMissing bool) (*MetadataEnrichmentResult, error)
+	Supports(provider, mediaType string) bool
+	HasProvider(name string) bool
+}
+
+// providerAvailability tells whether providers with pooled API keys have
+// one usable now; ProviderKeyPool implements it.
+type providerAvailability interface {
+	Providers() []string
+	Available(ctx context.Context, provider string) (bool, time.Time)
+}
+
+// MetadataRefreshRequest scopes a refresh. An empty section or provider
+// means all of them. OnlyMissing refreshes only items missing a
+// description, year or rating, and fills in only their empty fields.
+// InvalidateCache drops the cached provider responses for the scope
+// first, so every record is fetched again.
+type MetadataRefreshRequest struct {
+	Section         string `json:"section"`
+	Provider        string `json:"provider"`
+	OnlyMissing     bool   `json:"only_missing"`
+	InvalidateCache bool   `json:"invalidate_cache"`
+}
+
+// MetadataRefreshJob is one refresh run and its progress. Unmatched
+// counts items no provider record was found for. The rate and estimate
+// are set while the job runs. PausedUntil is set while the job waits for
+// a provider's API keys to come off their rate limit or daily quota.
+type MetadataRefreshJob struct {
+	ID                  int64      `json:"id"`
+	Section             string     `json:"section,omitempty"`
+	Provider            string     `json:"provider,omitempty"`
+	OnlyMissing         bool       `json:"only_missing"`
+	Status              string     `json:"status"`
+	Total               int        `json:"total"`
+	Processed           int        `json:"processed"`
+	Updated             int        `json:"updated"`
+	Unmatched           int        `json:"unmatched"`
+	Failed              int        `json:"failed"`
+	Percent             float64    `json:"percent"`
+	ItemsPerMinute      float64    `json:"items_per_minute,omitempty"`
+	ETASeconds          *int64     `json:"eta_seconds,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+	StartedBy           int        `json:"started_by"`
+	StartedAt           time.Time  `json:"started_at"`
+	FinishedAt          *time.Time `json:"finished_at,omitempty"`
+	PausedUntil         *time.Time `json:"paused_until,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+// runningMetadataRefresh is the job in progress and how to cancel it.
+type runningMetadataRefresh struct {
+	job       *MetadataRefreshJob
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// MetadataRefreshService re-enriches media items in bulk, after metadata
+// providers or their API keys change. One job runs at a time, in the
+// background.
+type MetadataRefreshService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	refresher metadataRefresher
+	cache     *MetadataProviderCache
+	keys      providerAvailability
+	now       func() time.Time
+
+	mu      sync.Mutex
+	running *runningMetadataRefresh
+	wg      sync.WaitGroup
+}
+
+// NewMetadataRefreshService creates a new MetadataRefreshService. cache
+// may be nil when provider responses are not cached.
+func NewMetadataRefreshService(db *database.DB, logger *zap.Logger, refresher metadataRefresher, cache *MetadataProviderCache) *MetadataRefreshService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &MetadataRefreshService{
+		db:        db,
+		logger:    logger,
+		refresher: refresher,
+		cache:     cache,
+		now:       time.Now,
+	}
+}
+
+// SetKeyPool makes jobs pause, rather than fail items, while the API keys
+// of a provider they use are all rate limited or out of daily quota.
+func (s *MetadataRefreshService) SetKeyPool(pool *ProviderKeyPool) {
+	s.keys = pool
+}
+
+// refreshMissingCondition matches items missing a field enrichment fills.
+const refreshMissingCondition = `(mi.description IS NULL OR mi.description = '' OR mi.year IS NULL OR mi.rating IS NULL)`
+
+// scopeMediaTypes returns the media types of a section that the provider,
+// or any provider, covers.
+func (s *MetadataRefreshService) scopeMediaTypes(ctx context.Context, req MetadataRefreshRequest) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM media_types ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media types: %w", err)
+	}
+	defer rows.Close()
+	var types []string
+	for rows.Next() {
+		var mediaType string
+		if err := rows.Scan(&mediaType); err != nil {
+			return nil, err
+		}
+		if req.Section != "" && librarySection(mediaType) != req.Section {
+			continue
+		}
+		if s.refresher.Supports(req.Provider, mediaType) {
+			types = append(types, mediaType)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		if req.Section != "" {
+			return nil, fmt.Errorf("invalid section %s: no metadata provider covers it", req.Section)
+		}
+		return nil, fmt.Errorf("no metadata provider is configured")
+	}
+	return types, nil
+}
+
+// scopeItems returns the IDs of the items a refresh covers. With a
+// provider, items matched by another provider are left out.
+func (s *MetadataRefreshService) scopeItems(ctx context.Context, req MetadataRefreshRequest, types []string) ([]int64, error) {
+	args := make([]interface{}, 0, len(types)+1)
+	for _, mediaType := range types {
+		args = append(args, mediaType)
+	}
+	query := `SELECT mi.id FROM media_items mi
+		JOIN media_types mt ON mt.id = mi.media_type_id
+		WHERE mt.name IN (?` + strings.Repeat(", ?", len(types)-1) + `)`
+	if req.OnlyMissing {
+		query += ` AND ` + refreshMissingCondition
+	}
+	if req.Provider != "" {
+		query += ` AND (EXISTS (SELECT 1 FROM external_metadata em WHERE em.media_item_id = mi.id AND em.provider = ?)
+			OR NOT EXISTS (SELECT 1 FROM external_metadata em WHERE em.media_item_id = mi.id))`
+		args = append(args, req.Provider)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY mi.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list items to refresh: %w", err)
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// StartJob starts a refresh in the background and returns it.
+func (s *MetadataRefreshService) StartJob(ctx context.Context, req MetadataRefreshRequest, userID int) (*MetadataRefreshJob, error) {
+	if req.Provider != "" && !s.refresher.HasProvider(req.Provider) {
+		return nil, fmt.Errorf("invalid provider: %s", req.Provider)
+	}
+	types, err := s.scopeMediaTypes(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		return nil, ErrMetadataRefreshRunning
+	}
+	ids, err := s.scopeItems(ctx, req, types)
+	if err != nil {
+		return nil, err
+	}
+	if req.InvalidateCache && s.cache != nil {
+		scopes := []string{""}
+		if req.Section != "" {
+			scopes = types
+		}
+		for _, mediaType := range scopes {
+			if _, err := s.cache.Invalidate(ctx, req.Provider, mediaType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	job := &MetadataRefreshJob{
+		Section:     req.Section,
+		Provider:    req.Provider,
+		OnlyMissing: req.OnlyMissing,
+		Status:      MetadataRefreshRunning,
+		Total:       len(ids),
+		StartedBy:   userID,
+		StartedAt:   s.now(),
+	}
+	job.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO metadata_refresh_jobs (section, provider, only_missing, status, total, started_by, started_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		job.Section, job.Provider, job.OnlyMissing, job.Status, job.Total, job.StartedBy, job.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record metadata refresh: %w", err)
+	}
+
+	jobCtx, cancel := context.WithCancel(context.Background())
+	s.running = &runningMetadataRefresh{job: job, cancel: cancel}
+	snapshot := s.snapshotLocked()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		s.execute(jobCtx, job, ids)
+	}()
+	s.logger.Info("Metadata refresh started", zap.Int64("job_id", job.ID), zap.String("section", job.Section),
+		zap.String("provider", job.Provider), zap.Bool("only_missing", job.OnlyMissing), zap.Int("items", job.Total))
+	return snapshot, nil
+}
+
+// execute refreshes each item, saving progress as it goes.
+func (s *MetadataRefreshService) execute(ctx context.Context, job *MetadataRefreshJob, ids []int64) {
+	for _, id := range ids {
+		if !s.pace(ctx, job) {
+			break
+		}
+		_, err := s.refresher.Refresh(ctx, id, job.Provider, job.OnlyMissing)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		s.mu.Lock()
+		job.Processed++
+		switch {
+		case err == nil:
+			job.Updated++
+		case strings.Contains(err.Error(), "no metadata match found"):
+			job.Unmatched++
+		default:
+			job.Failed++
+			s.logger.Debug("Media item not refreshed", zap.Int64("media_item_id", id), zap.Error(err))
+		}
+		processed := job.Processed
+		s.mu.Unlock()
+		if processed%metadataRefreshSaveEvery == 0 {
+			s.saveJob(job)
+		}
+	}
+
+	s.mu.Lock()
+	finished := s.now()
+	job.FinishedAt = &finished
+	job.Status = MetadataRefreshCompleted
+	if s.running.cancelled {
+		job.Status = MetadataRefreshCancelled
+	} else if ctx.Err() != nil {
+		job.Status, job.Error = MetadataRefreshFailed, "interrupted by server shutdown"
+	}
+	s.mu.Unlock()
+	s.saveJob(job)
+
+	s.mu.Lock()
+	s.running = nil
+	s.mu.Unlock()
+	s.logger.Info("Metadata refresh finished", zap.Int64("job_id", job.ID), zap.String("status", job.Status),
+		zap.Int("updated", job.Updated), zap.Int("unmatched", job.Unmatched), zap.Int("failed", job.Failed))
+}
+
+// pace waits until every provider with pooled keys that job uses has a
+// key available, and reports whether the job should go on.
+func (s *MetadataRefreshService) pace(ctx context.Context, job *MetadataRefreshJob) bool {
+	for ctx.Err() == nil {
+		if s.keys == nil {
+			return true
+		}
+		var until time.Time
+		for _, provider := range s.keys.Providers() {
+			if job.Provider != "" && provider != job.Provider || !s.refresher.HasProvider(provider) {
+				continue
+			}
+			if ok, next := s.keys.Available(ctx, provider); !ok && next.After(until) {
+				until = next
+			}
+		}
+		if until.IsZero() {
+			s.mu.Lock()
+			job.PausedUntil = nil
+			s.mu.Unlock()
+			return true
+		}
+
+		s.mu.Lock()
+		job.PausedUntil = &until
+		s.mu.Unlock()
+		s.logger.Info("Metadata refresh paused for provider API keys", zap.Int64("job_id", job.ID), zap.Time("until", until))
+		timer := time.NewTimer(until.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+	return false
+}
+
+func (s *MetadataRefreshService) saveJob(job *MetadataRefreshJob) {
+	s.mu.Lock()
+	saved := *job
+	s.mu.Unlock()
+	if _, err := s.db.ExecContext(context.Background(),
+		`UPDATE metadata_refresh_jobs SET status = ?, processed = ?, updated = ?, unmatched = ?, failed = ?,
+		 finished_at = ?, error = ? WHERE id = ?`,
+		saved.Status, saved.Processed, saved.Updated, saved.Unmatched, saved.Failed,
+		saved.FinishedAt, saved.Error, saved.ID); err != nil {
+		s.logger.Error("Failed to save metadata refresh", zap.Int64("job_id", saved.ID), zap.Error(err))
+	}
+}
+
+// snapshotLocked returns a copy of the running job with its progress
+// estimated. s.mu must be held.
+func (s *MetadataRefreshService) snapshotLocked() *MetadataRefreshJob {
+	if s.running == nil {
+		return nil
+	}
+	job := *s.running.job
+	job.Percent = refreshPercent(job.Processed, job.Total)
+	elapsed := s.now().Sub(job.StartedAt)
+	if job.Processed > 0 && elapsed > 0 {
+		perItem := elapsed / time.Duration(job.Processed)
+		job.ItemsPerMinute = math.Round(float64(time.Minute)/float64(perItem)*10) / 10
+		remaining := perItem * time.Duration(job.Total-job.Processed)
+		eta := int64(math.Ceil(remaining.Seconds()))
+		completion := s.now().Add(remaining)
+		job.ETASeconds, job.EstimatedCompletion = &eta, &completion
+	}
+	return &job
+}
+
+func refreshPercent(processed, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return math.Round(float64(processed)/float64(total)*1000) / 10
+}
+
+// runningSnapshot returns a copy of the job in progress, or nil.
+func (s *MetadataRefreshService) runningSnapshot() *MetadataRefreshJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// CancelJob stops the job in progress after the item it is refreshing.
+func (s *MetadataRefreshService) CancelJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	if s.running != nil && s.running.job.ID == id {
+		s.running.cancelled = true
+		s.running.cancel()
+		s.mu.Unlock()
+		s.logger.Info("Metadata refresh cancelled", zap.Int64("job_id", id))
+		return nil
+	}
+	s.mu.Unlock()
+
+	if _, err := s.GetJob(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("metadata refresh %d is not running", id)
+}
+
+const metadataRefreshColumns = `id, section, provider, only_missing, status, total, processed, updated, unmatched, failed,
+	started_by, started_at, finished_at, error`
+
+func scanMetadataRefreshJob(row shareLinkScanner) (*MetadataRefreshJob, error) {
+	var job MetadataRefreshJob
+	var finished sql.NullTime
+	var jobErr sql.NullString
+	if err := row.Scan(&job.ID, &job.Section, &job.Provider, &job.OnlyMissing, &job.Status, &job.Total,
+		&job.Processed, &job.Updated, &job.Unmatched, &job.Failed, &job.StartedBy, &job.StartedAt,
+		&finished, &jobErr); err != nil {
+		return nil, err
+	}
+	if finished.Valid {
+		job.FinishedAt = &finished.Time
+	}
+	job.Error = jobErr.String
+	job.Percent = refreshPercent(job.Processed, job.Total)
+	return &job, nil
+}
+
+// GetJob returns a refresh job, with its live progress while it runs.
+func (s *MetadataRefreshService) GetJob(ctx context.Context, id int64) (*MetadataRefreshJob, error) {
+	if running := s.runningSnapshot(); running != nil && running.ID == id {
+		return running, nil
+	}
+	job, err := scanMetadataRefreshJob(s.db.QueryRowContext(ctx,
+		`SELECT `+metadataRefreshColumns+` FROM metadata_refresh_jobs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("metadata refresh %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata refresh: %w", err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the most recent refresh jobs, newest first.
+func (s *MetadataRefreshService) ListJobs(ctx context.Context, limit int) ([]MetadataRefreshJob, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+metadataRefreshColumns+` FROM metadata_refresh_jobs ORDER BY started_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata refreshes: %w", err)
+	}
+	defer rows.Close()
+
+	running := s.runningSnapshot()
+	jobs := []MetadataRefreshJob{}
+	for rows.Next() {
+		job, err := scanMetadataRefreshJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan metadata refresh: %w", err)
+		}
+		if running != nil && running.ID == job.ID {
+			job = running
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// Start closes jobs a restart interrupted.
+func (s *MetadataRefreshService) Start() {
+	if _, err := s.db.ExecContext(context.Background(),
+		`UPDATE metadata_refresh_jobs SET status = ?, finished_at = ?, error = ? WHERE status = ?`,
+		MetadataRefreshFailed, s.now(), "interrupted by server restart", MetadataRefreshRunning); err != nil {
+		s.logger.Warn("Failed to close interrupted metadata refreshes", zap.Error(err))
+	}
+}
+
+// Stop interrupts the job in progress and waits for it to save.
+func (s *MetadataRefreshService) Stop() {
+	s.mu.Lock()
+	if s.running != nil {
+		s.running.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
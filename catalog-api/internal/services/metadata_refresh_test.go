@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"catalogizer/config"
+	"catalogizer/database"
+	"catalogizer/internal/media/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeMetadataProvider knows one film, "Solaris", and counts requests.
+type fakeMetadataProvider struct {
+	description string
+	searches    int
+	lookups     int
+}
+
+func (p *fakeMetadataProvider) Name() string                   { return "fake" }
+func (p *fakeMetadataProvider) Supports(mediaType string) bool { return mediaType == "movie" }
+
+func (p *fakeMetadataProvider) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	p.searches++
+	if query.Title != "Solaris" {
+		return []MetadataMatch{}, nil
+	}
+	year := 1972
+	return []MetadataMatch{{Provider: "fake", ExternalID: "1", Title: "Solaris", Year: &year}}, nil
+}
+
+func (p *fakeMetadataProvider) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	p.lookups++
+	if externalID != "1" {
+		return nil, fmt.Errorf("metadata record not found")
+	}
+	year, rating := 1972, 8.1
+	return &MetadataMatch{Provider: "fake", ExternalID: "1", Title: "Solaris", Year: &year, Rating: &rating,
+		Description: p.description, Data: json.RawMessage(`{"id":1}`)}, nil
+}
+
+func newMetadataRefreshTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "refresh.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.RunMigrations(context.Background()))
+	return db
+}
+
+func TestMetadataProviderCache(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	cache := NewMetadataProviderCache(db, nil, time.Hour)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	provider := &fakeMetadataProvider{description: "A planet"}
+	cached := cache.Wrap(provider)
+
+	for i := 0; i < 2; i++ {
+		matches, err := cached.Search(ctx, MetadataQuery{MediaType: "movie", Title: "Solaris"})
+		require.NoError(t, err)
+		require.Len(t, matches, 1)
+		match, err := cached.Lookup(ctx, "movie", "1")
+		require.NoError(t, err)
+		assert.Equal(t, "A planet", match.Description)
+		assert.JSONEq(t, `{"id":1}`, string(match.Data), "the raw record is cached with the match")
+	}
+	assert.Equal(t, 1, provider.searches)
+	assert.Equal(t, 1, provider.lookups)
+	_, err := cached.Lookup(ctx, "movie", "2")
+	assert.Error(t, err)
+	_, err = cached.Lookup(ctx, "movie", "2")
+	assert.Error(t, err)
+	assert.Equal(t, 3, provider.lookups, "failures are not cached")
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, MetadataProviderCacheStats{Provider: "fake", Entries: 2, Hits: 2, Misses: 4}, stats[0])
+
+	// Expired responses are fetched again
+	now = now.Add(2 * time.Hour)
+	_, err = cached.Lookup(ctx, "movie", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 4, provider.lookups)
+
+	deleted, err := cache.Invalidate(ctx, "other", "")
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	deleted, err = cache.Invalidate(ctx, "fake", "movie")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	_, err = cached.Search(ctx, MetadataQuery{MediaType: "movie", Title: "Solaris"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.searches)
+}
+
+// waitForRefresh polls a refresh job until it is no longer running.
+func waitForRefresh(t *testing.T, s *MetadataRefreshService, id int64) *MetadataRefreshJob {
+	t.Helper()
+	var job *MetadataRefreshJob
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = s.GetJob(context.Background(), id)
+		require.NoError(t, err)
+		return job.Status != MetadataRefreshRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestMetadataRefreshService_Refresh(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	itemRepo := repository.NewMediaItemRepository(db)
+	extRepo := repository.NewExternalMetadataRepository(db)
+	enrichment := NewMetadataEnrichmentService(db, zap.NewNop(), itemRepo, extRepo, "")
+	provider := &fakeMetadataProvider{description: "A planet"}
+	cache := NewMetadataProviderCache(db, nil, 0)
+	enrichment.SetProviders(cache.Wrap(provider))
+	s := NewMetadataRefreshService(db, nil, enrichment, cache)
+
+	_, movieType, err := itemRepo.GetMediaTypeByName(ctx, "movie")
+	require.NoError(t, err)
+	create := func(title string) int64 {
+		id, err := itemRepo.Create(ctx, &models.MediaItem{MediaTypeID: movieType, Title: title, Status: "detected"})
+		require.NoError(t, err)
+		return id
+	}
+	renamed := create("Solaris (Tarkovsky)")
+	create("Unknown Film")
+	_, err = enrichment.Identify(ctx, renamed, IdentifyRequest{Provider: "fake", ExternalID: "1"})
+	require.NoError(t, err)
+	item, err := itemRepo.GetByID(ctx, renamed)
+	require.NoError(t, err)
+	item.Title = "Solaris (Tarkovsky)"
+	require.NoError(t, itemRepo.Update(ctx, item))
+	found := create("Solaris")
+
+	_, err = s.StartJob(ctx, MetadataRefreshRequest{Provider: "tmdb"}, 1)
+	assert.ErrorContains(t, err, "invalid provider")
+	_, err = s.StartJob(ctx, MetadataRefreshRequest{Section: "music"}, 1)
+	assert.ErrorContains(t, err, "invalid section music")
+
+	// The provider's description changed; the cached record hides it
+	// until the cache is invalidated
+	provider.description = "A planet that reads minds"
+	job, err := s.StartJob(ctx, MetadataRefreshRequest{Section: "movie"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, job.Total)
+	job = waitForRefresh(t, s, job.ID)
+	assert.Equal(t, MetadataRefreshCompleted, job.Status)
+	assert.Equal(t, 3, job.Processed)
+	assert.Equal(t, 2, job.Updated)
+	assert.Equal(t, 1, job.Unmatched)
+	assert.Equal(t, 100.0, job.Percent)
+	item, err = itemRepo.GetByID(ctx, renamed)
+	require.NoError(t, err)
+	assert.Equal(t, "A planet", *item.Description)
+
+	job, err = s.StartJob(ctx, MetadataRefreshRequest{InvalidateCache: true}, 1)
+	require.NoError(t, err)
+	waitForRefresh(t, s, job.ID)
+	item, err = itemRepo.GetByID(ctx, renamed)
+	require.NoError(t, err)
+	assert.Equal(t, "A planet that reads minds", *item.Description)
+	assert.Equal(t, "Solaris (Tarkovsky)", item.Title, "refreshing keeps the title")
+	assert.Equal(t, MediaStatusIdentified, item.Status)
+	item, err = itemRepo.GetByID(ctx, found)
+	require.NoError(t, err)
+	assert.Equal(t, MediaStatusMatched, item.Status)
+
+	// Only items missing fields are refreshed in only-missing mode
+	job, err = s.StartJob(ctx, MetadataRefreshRequest{Provider: "fake", OnlyMissing: true}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, job.Total)
+	job = waitForRefresh(t, s, job.ID)
+	assert.Equal(t, 1, job.Unmatched)
+
+	jobs, err := s.ListJobs(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	assert.Equal(t, job.ID, jobs[0].ID)
+}
+
+// blockingRefresher refreshes an item each time release is signalled.
+type blockingRefresher struct {
+	release chan struct{}
+}
+
+func (r *blockingRefresher) Refresh(ctx context.Context, mediaItemID int64, provider string, onlyMissing bool) (*MetadataEnrichmentResult, error) {
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &MetadataEnrichmentResult{MediaItemID: mediaItemID}, nil
+}
+
+func (r *blockingRefresher) Supports(provider, mediaType string) bool { return mediaType == "movie" }
+func (r *blockingRefresher) HasProvider(name string) bool             { return true }
+
+func TestMetadataRefreshService_ProgressAndCancel(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO media_items (media_type_id, title, status) VALUES ((SELECT id FROM media_types WHERE name = 'movie'), ?, 'detected')`,
+			fmt.Sprintf("Film %d", i))
+		require.NoError(t, err)
+	}
+	refresher := &blockingRefresher{release: make(chan struct{})}
+	s := NewMetadataRefreshService(db, nil, refresher, nil)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var clock sync.Mutex
+	s.now = func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		return now
+	}
+
+	job, err := s.StartJob(ctx, MetadataRefreshRequest{}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 4, job.Total)
+	assert.Nil(t, job.ETASeconds)
+	_, err = s.StartJob(ctx, MetadataRefreshRequest{}, 7)
+	assert.ErrorIs(t, err, ErrMetadataRefreshRunning)
+
+	clock.Lock()
+	now = now.Add(time.Minute)
+	clock.Unlock()
+	refresher.release <- struct{}{}
+	require.Eventually(t, func() bool {
+		job, err = s.GetJob(ctx, job.ID)
+		return err == nil && job.Processed == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 25.0, job.Percent)
+	assert.Equal(t, 1.0, job.ItemsPerMinute)
+	require.NotNil(t, job.ETASeconds)
+	assert.Equal(t, int64(180), *job.ETASeconds, "three items left at a minute each")
+	assert.Equal(t, now.Add(3*time.Minute), *job.EstimatedCompletion)
+
+	require.NoError(t, s.CancelJob(ctx, job.ID))
+	job = waitForRefresh(t, s, job.ID)
+	assert.Equal(t, MetadataRefreshCancelled, job.Status)
+	assert.Equal(t, 1, job.Processed)
+	assert.Equal(t, 7, job.StartedBy)
+	assert.ErrorContains(t, s.CancelJob(ctx, job.ID), "is not running")
+	assert.ErrorContains(t, s.CancelJob(ctx, 999), "not found")
+	s.Stop()
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogizer/internal/media/models"
+
+	"go.uber.org/zap"
+)
+
+// Metadata fields whose source provider can be configured.
+const (
+	MetadataFieldOriginalTitle = "original_title"
+	MetadataFieldDescription   = "description"
+	MetadataFieldYear          = "year"
+	MetadataFieldGenres        = "genres"
+	MetadataFieldDirector      = "director"
+	MetadataFieldRating        = "rating"
+	MetadataFieldRuntime       = "runtime"
+	MetadataFieldLanguage      = "language"
+	MetadataFieldCover         = "cover"
+)
+
+// MetadataFieldMatch is the provenance entry of the record a media item
+// was matched or identified with, which also supplies its title.
+const MetadataFieldMatch = "match"
+
+// MetadataSourceFields lists the fields a source priority can be set for.
+var MetadataSourceFields = []string{
+	MetadataFieldOriginalTitle, MetadataFieldDescription, MetadataFieldYear, MetadataFieldGenres,
+	MetadataFieldDirector, MetadataFieldRating, MetadataFieldRuntime, MetadataFieldLanguage, MetadataFieldCover,
+}
+
+// metadataProviderOrderKey is the metadata_source_priorities row holding
+// the provider failover order.
+const metadataProviderOrderKey = "provider_order"
+
+// MetadataSourceConfig sets where metadata comes from. ProviderOrder is
+// the order providers are tried in when matching an item: the first one
+// with a good enough match wins, and the next is tried when one fails or
+// has none. Without it, every provider is searched and the best match
+// wins. FieldPriority names, per field, the providers to take the field
+// from, most preferred first; the records of those providers are looked
+// up alongside the match. A field none of them has comes from the match,
+// then from the other records.
+type MetadataSourceConfig struct {
+	ProviderOrder []string            `json:"provider_order"`
+	FieldPriority map[string][]string `json:"field_priority"`
+	UpdatedBy     int                 `json:"updated_by,omitempty"`
+	UpdatedAt     *time.Time          `json:"updated_at,omitempty"`
+}
+
+// MetadataFieldSource records which provider record supplied a field of a
+// media item.
+type MetadataFieldSource struct {
+	Field      string    `json:"field"`
+	Provider   string    `json:"provider"`
+	ExternalID string    `json:"external_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ProviderNames returns the names of the configured providers.
+func (s *MetadataEnrichmentService) ProviderNames() []string {
+	names := make([]string, len(s.providers))
+	for i, p := range s.providers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// GetSourceConfig returns the stored source configuration.
+func (s *MetadataEnrichmentService) GetSourceConfig(ctx context.Context) (*MetadataSourceConfig, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT field, providers, updated_by, updated_at FROM metadata_source_priorities`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata sources: %w", err)
+	}
+	defer rows.Close()
+	cfg := &MetadataSourceConfig{ProviderOrder: []string{}, FieldPriority: map[string][]string{}}
+	for rows.Next() {
+		var field, providers string
+		var updatedBy int
+		var updatedAt time.Time
+		if err := rows.Scan(&field, &providers, &updatedBy, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to load metadata sources: %w", err)
+		}
+		if field == metadataProviderOrderKey {
+			cfg.ProviderOrder = strings.Split(providers, ",")
+		} else {
+			cfg.FieldPriority[field] = strings.Split(providers, ",")
+		}
+		if cfg.UpdatedAt == nil || updatedAt.After(*cfg.UpdatedAt) {
+			cfg.UpdatedBy, cfg.UpdatedAt = updatedBy, &updatedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load metadata sources: %w", err)
+	}
+	return cfg, nil
+}
+
+// sourceConfig returns the source configuration, or none when it cannot
+// be loaded, so enrichment goes on with the default behaviour.
+func (s *MetadataEnrichmentService) sourceConfig(ctx context.Context) *MetadataSourceConfig {
+	cfg, err := s.GetSourceConfig(ctx)
+	if err != nil {
+		s.logger.Warn("Using default metadata sources", zap.Error(err))
+		return &MetadataSourceConfig{FieldPriority: map[string][]string{}}
+	}
+	return cfg
+}
+
+// validateProviderList checks that a list names configured providers, each
+// once.
+func (s *MetadataEnrichmentService) validateProviderList(what string, providers []string) error {
+	seen := map[string]bool{}
+	for _, name := range providers {
+		if !s.HasProvider(name) {
+			return fmt.Errorf("invalid provider %q in %s", name, what)
+		}
+		if seen[name] {
+			return fmt.Errorf("invalid %s: provider %s is listed twice", what, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// SetSourceConfig replaces the source configuration. Empty lists are
+// dropped.
+func (s *MetadataEnrichmentService) SetSourceConfig(ctx context.Context, cfg MetadataSourceConfig, userID int) (*MetadataSourceConfig, error) {
+	if err := s.validateProviderList("provider_order", cfg.ProviderOrder); err != nil {
+		return nil, err
+	}
+	for field, providers := range cfg.FieldPriority {
+		valid := false
+		for _, f := range MetadataSourceFields {
+			valid = valid || f == field
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid field %q: expected one of %s", field, strings.Join(MetadataSourceFields, ", "))
+		}
+		if err := s.validateProviderList(field+" priority", providers); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM metadata_source_priorities`); err != nil {
+		return nil, fmt.Errorf("failed to save metadata sources: %w", err)
+	}
+	now := time.Now()
+	save := func(field string, providers []string) error {
+		if len(providers) == 0 {
+			return nil
+		}
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO metadata_source_priorities (field, providers, updated_by, updated_at) VALUES (?, ?, ?, ?)`,
+			field, strings.Join(providers, ","), userID, now)
+		return err
+	}
+	if err := save(metadataProviderOrderKey, cfg.ProviderOrder); err != nil {
+		return nil, fmt.Errorf("failed to save metadata sources: %w", err)
+	}
+	for field, providers := range cfg.FieldPriority {
+		if err := save(field, providers); err != nil {
+			return nil, fmt.Errorf("failed to save metadata sources: %w", err)
+		}
+	}
+	s.logger.Info("Metadata sources updated", zap.Int("user_id", userID),
+		zap.Strings("provider_order", cfg.ProviderOrder), zap.Int("fields", len(cfg.FieldPriority)))
+	return s.GetSourceConfig(ctx)
+}
+
+// orderedProviders returns the providers for a media type in failover
+// order; providers the order leaves out follow in their configured order.
+func (s *MetadataEnrichmentService) orderedProviders(mediaType string, cfg *MetadataSourceConfig) []MetadataProviderClient {
+	providers := s.providersFor(mediaType)
+	rank := func(name string) int {
+		for i, n := range cfg.ProviderOrder {
+			if n == name {
+				return i
+			}
+		}
+		return len(cfg.ProviderOrder)
+	}
+	sort.SliceStable(providers, func(i, j int) bool { return rank(providers[i].Name()) < rank(providers[j].Name()) })
+	return providers
+}
+
+// matchInOrder returns the best match of the first provider, in failover
+// order, that has one good enough. A "no match" result is reported over
+// provider failures.
+func (s *MetadataEnrichmentService) matchInOrder(ctx context.Context, query MetadataQuery, providers []MetadataProviderClient) (*MetadataMatch, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("unsupported media type: %s", query.MediaType)
+	}
+	var lastErr error
+	for _, p := range providers {
+		match, err := s.bestMatchFrom(ctx, query, []MetadataProviderClient{p})
+		if err == nil {
+			return match, nil
+		}
+		if lastErr == nil || !strings.Contains(lastErr.Error(), "no metadata match found") {
+			lastErr = err
+		}
+		s.logger.Debug("Metadata provider has no match, trying the next",
+			zap.String("provider", p.Name()), zap.String("title", query.Title), zap.Error(err))
+	}
+	return nil, lastErr
+}
+
+// sourceMatches returns the records an item's fields may come from: the
+// match first, then the records of the other providers the field
+// priorities name. Those are looked up again by the item's existing
+// records, unless its metadata is being replaced, and otherwise searched
+// for under the match's title and year. Providers without one are skipped.
+func (s *MetadataEnrichmentService) sourceMatches(ctx context.Context, item *models.MediaItem, mediaType string, match *MetadataMatch, mode metadataApply, cfg *MetadataSourceConfig) []*MetadataMatch {
+	matches := []*MetadataMatch{match}
+	wanted := map[string]bool{}
+	for _, providers := range cfg.FieldPriority {
+		for _, name := range providers {
+			if name != match.Provider {
+				wanted[name] = true
+			}
+		}
+	}
+	if len(wanted) == 0 {
+		return matches
+	}
+	records := map[string]string{}
+	if mode != applyReplace {
+		existing, err := s.extMetaRepo.GetByItem(ctx, item.ID)
+		if err != nil {
+			s.logger.Warn("Failed to load external metadata", zap.Int64("media_item_id", item.ID), zap.Error(err))
+		}
+		for _, em := range existing {
+			records[em.Provider] = em.ExternalID
+		}
+	}
+
+	query := s.itemQuery(ctx, item, mediaType)
+	query.Title, query.Year = match.Title, match.Year
+	for _, p := range s.orderedProviders(mediaType, cfg) {
+		if !wanted[p.Name()] {
+			continue
+		}
+		var source *MetadataMatch
+		var err error
+		if externalID, ok := records[p.Name()]; ok {
+			if source, err = p.Lookup(ctx, mediaType, externalID); err == nil {
+				source.Score = 1
+			}
+		} else {
+			source, err = s.bestMatchFrom(ctx, query, []MetadataProviderClient{p})
+		}
+		if err != nil {
+			s.logger.Debug("No metadata source record", zap.Int64("media_item_id", item.ID),
+				zap.String("provider", p.Name()), zap.Error(err))
+			continue
+		}
+		matches = append(matches, source)
+	}
+	return matches
+}
+
+// fieldSource returns the record to take a field from: the first of the
+// field's preferred providers that has it, else the first record that
+// does, or nil.
+func fieldSource(field string, matches []*MetadataMatch, cfg *MetadataSourceConfig, has func(*MetadataMatch) bool) *MetadataMatch {
+	for _, name := range cfg.FieldPriority[field] {
+		for _, m := range matches {
+			if m.Provider == name && has(m) {
+				return m
+			}
+		}
+	}
+	for _, m := range matches {
+		if has(m) {
+			return m
+		}
+	}
+	return nil
+}
+
+// recordFieldSources stores which record supplied each field.
+func (s *MetadataEnrichmentService) recordFieldSources(ctx context.Context, mediaItemID int64, sources map[string]*MetadataMatch) error {
+	now := time.Now()
+	for field, m := range sources {
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE media_item_field_sources SET provider = ?, external_id = ?, updated_at = ? WHERE media_item_id = ? AND field = ?`,
+			m.Provider, m.ExternalID, now, mediaItemID, field)
+		if err == nil {
+			if updated, _ := result.RowsAffected(); updated == 0 {
+				_, err = s.db.ExecContext(ctx,
+					`INSERT INTO media_item_field_sources (media_item_id, field, provider, external_id, updated_at) VALUES (?, ?, ?, ?, ?)`,
+					mediaItemID, field, m.Provider, m.ExternalID, now)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record metadata source of %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// matchedProvider returns the provider a media item was matched with, or
+// "" when that was not recorded.
+func (s *MetadataEnrichmentService) matchedProvider(ctx context.Context, mediaItemID int64) string {
+	var provider string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT provider FROM media_item_field_sources WHERE media_item_id = ? AND field = ?`,
+		mediaItemID, MetadataFieldMatch).Scan(&provider)
+	if err != nil && err != sql.ErrNoRows {
+		s.logger.Warn("Failed to load metadata match source", zap.Int64("media_item_id", mediaItemID), zap.Error(err))
+	}
+	return provider
+}
+
+// FieldSources returns which provider record supplied each field of a
+// media item.
+func (s *MetadataEnrichmentService) FieldSources(ctx context.Context, mediaItemID int64) ([]MetadataFieldSource, error) {
+	if _, err := s.itemRepo.GetByID(ctx, mediaItemID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT field, provider, external_id, updated_at FROM media_item_field_sources WHERE media_item_id = ? ORDER BY field`,
+		mediaItemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata sources: %w", err)
+	}
+	defer rows.Close()
+	sources := []MetadataFieldSource{}
+	for rows.Next() {
+		var source MetadataFieldSource
+		if err := rows.Scan(&source.Field, &source.Provider, &source.ExternalID, &source.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to load metadata sources: %w", err)
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
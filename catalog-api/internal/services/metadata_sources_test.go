@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ratingsMetadataProvider knows The Matrix, with a rating and summary of
+// its own, and fails every search while down.
+type ratingsMetadataProvider struct {
+	down     bool
+	searches int
+	lookups  int
+}
+
+func (p *ratingsMetadataProvider) Name() string                   { return "ratings" }
+func (p *ratingsMetadataProvider) Supports(mediaType string) bool { return mediaType == "movie" }
+
+func (p *ratingsMetadataProvider) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	p.searches++
+	if p.down {
+		return nil, fmt.Errorf("ratings service unavailable")
+	}
+	if !strings.Contains(query.Title, "Matrix") {
+		return []MetadataMatch{}, nil
+	}
+	year := 1999
+	return []MetadataMatch{{Provider: "ratings", ExternalID: "tt0133093", Title: "The Matrix", Year: &year}}, nil
+}
+
+func (p *ratingsMetadataProvider) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	p.lookups++
+	if externalID != "tt0133093" {
+		return nil, fmt.Errorf("metadata record not found")
+	}
+	year, rating := 1999, 8.7
+	return &MetadataMatch{Provider: "ratings", ExternalID: "tt0133093", Title: "The Matrix", Year: &year,
+		Rating: &rating, Description: "Neo takes the red pill."}, nil
+}
+
+func newMetadataSourcesFixture(t *testing.T) (*metadataFixture, *ratingsMetadataProvider) {
+	t.Helper()
+	f := newMetadataFixture(t)
+	ratings := &ratingsMetadataProvider{}
+	f.svc.SetProviders(append(f.svc.providers, ratings)...)
+	return f, ratings
+}
+
+func TestMetadataSources_Config(t *testing.T) {
+	f, _ := newMetadataSourcesFixture(t)
+	ctx := context.Background()
+
+	cfg, err := f.svc.GetSourceConfig(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.ProviderOrder)
+	assert.Empty(t, cfg.FieldPriority)
+	assert.Equal(t, []string{"tmdb", "musicbrainz", "google_books", "ratings"}, f.svc.ProviderNames())
+
+	_, err = f.svc.SetSourceConfig(ctx, MetadataSourceConfig{ProviderOrder: []string{"imdb"}}, 1)
+	assert.ErrorContains(t, err, `invalid provider "imdb"`)
+	_, err = f.svc.SetSourceConfig(ctx, MetadataSourceConfig{FieldPriority: map[string][]string{"plot": {"tmdb"}}}, 1)
+	assert.ErrorContains(t, err, `invalid field "plot"`)
+	_, err = f.svc.SetSourceConfig(ctx, MetadataSourceConfig{FieldPriority: map[string][]string{"rating": {"ratings", "ratings"}}}, 1)
+	assert.ErrorContains(t, err, "listed twice")
+
+	cfg, err = f.svc.SetSourceConfig(ctx, MetadataSourceConfig{
+		ProviderOrder: []string{"ratings", "tmdb"},
+		FieldPriority: map[string][]string{MetadataFieldRating: {"ratings", "tmdb"}, MetadataFieldCover: {}},
+	}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ratings", "tmdb"}, cfg.ProviderOrder)
+	assert.Equal(t, map[string][]string{MetadataFieldRating: {"ratings", "tmdb"}}, cfg.FieldPriority, "empty lists are dropped")
+	assert.Equal(t, 7, cfg.UpdatedBy)
+	require.NotNil(t, cfg.UpdatedAt)
+
+	// A new configuration replaces the old one
+	cfg, err = f.svc.SetSourceConfig(ctx, MetadataSourceConfig{ProviderOrder: []string{"tmdb"}}, 7)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.FieldPriority)
+}
+
+func TestMetadataSources_FieldPriority(t *testing.T) {
+	f, ratings := newMetadataSourcesFixture(t)
+	ctx := context.Background()
+	_, err := f.svc.SetSourceConfig(ctx, MetadataSourceConfig{
+		FieldPriority: map[string][]string{MetadataFieldRating: {"ratings"}},
+	}, 1)
+	require.NoError(t, err)
+
+	year := 1999
+	id := f.createItem(t, 1, "Matrix", &year, nil)
+	result, err := f.svc.Enrich(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "tmdb", result.Match.Provider, "without an order the best match is applied")
+	assert.Equal(t, "ratings", result.Sources[MetadataFieldRating])
+	assert.Equal(t, "tmdb", result.Sources[MetadataFieldDescription])
+	assert.Equal(t, "tmdb", result.Sources[MetadataFieldCover])
+
+	item, err := f.itemRepo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 8.7, *item.Rating)
+	assert.Equal(t, "A hacker learns the truth.", *item.Description)
+	assert.Equal(t, "Lana Wachowski", *item.Director)
+
+	external, err := f.extRepo.GetByItem(ctx, id)
+	require.NoError(t, err)
+	assert.Len(t, external, 2, "the record of every source is kept")
+
+	sources, err := f.svc.FieldSources(ctx, id)
+	require.NoError(t, err)
+	provenance := map[string]string{}
+	for _, source := range sources {
+		provenance[source.Field] = source.Provider + ":" + source.ExternalID
+	}
+	assert.Equal(t, "ratings:tt0133093", provenance[MetadataFieldRating])
+	assert.Equal(t, "tmdb:603", provenance[MetadataFieldMatch])
+	assert.Equal(t, "tmdb:603", provenance[MetadataFieldRuntime])
+	_, err = f.svc.FieldSources(ctx, 999)
+	assert.ErrorContains(t, err, "not found")
+
+	// A refresh goes back to the matched record and looks the other
+	// sources up by their stored records
+	searches := ratings.searches
+	result, err = f.svc.Refresh(ctx, id, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "tmdb", result.Match.Provider)
+	assert.Equal(t, "ratings", result.Sources[MetadataFieldRating])
+	assert.Equal(t, searches, ratings.searches)
+
+	// Identifying replaces the provenance along with the records
+	_, err = f.svc.Identify(ctx, id, IdentifyRequest{MediaType: "book", Provider: "google_books", ExternalID: "vol1"})
+	require.NoError(t, err)
+	sources, err = f.svc.FieldSources(ctx, id)
+	require.NoError(t, err)
+	for _, source := range sources {
+		assert.Equal(t, "google_books", source.Provider, source.Field)
+	}
+}
+
+func TestMetadataSources_ProviderOrder(t *testing.T) {
+	f, ratings := newMetadataSourcesFixture(t)
+	ctx := context.Background()
+	_, err := f.svc.SetSourceConfig(ctx, MetadataSourceConfig{ProviderOrder: []string{"ratings", "tmdb"}}, 1)
+	require.NoError(t, err)
+	year := 1999
+
+	result, err := f.svc.Enrich(ctx, f.createItem(t, 1, "Matrix", &year, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "ratings", result.Match.Provider, "the first provider with a match wins")
+	assert.Equal(t, "ratings", result.Sources[MetadataFieldMatch])
+
+	ratings.down = true
+	result, err = f.svc.Enrich(ctx, f.createItem(t, 1, "Matrix", &year, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "tmdb", result.Match.Provider, "a failing provider fails over to the next")
+
+	_, err = f.svc.Enrich(ctx, f.createItem(t, 1, "Completely Unknown Film", nil, nil))
+	assert.ErrorContains(t, err, "no metadata match found")
+}
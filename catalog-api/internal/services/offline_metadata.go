@@ -0,0 +1,615 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"catalogizer/database"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MetadataProviderOffline names the provider of imported offline metadata
+// bundles.
+const MetadataProviderOffline = "offline"
+
+// Offline metadata import statuses.
+const (
+	OfflineImportImported = "imported"
+	OfflineImportFailed   = "failed"
+)
+
+// offlineMetadataLineMax caps one line of a bundle.
+const offlineMetadataLineMax = 4 << 20
+
+// offlineMetadataCandidates is how many records a search scores.
+const offlineMetadataCandidates = 100
+
+// offlineBundleName matches the names bundles may have.
+var offlineBundleName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// OfflineMetadataBundle is an imported bundle and its current version.
+type OfflineMetadataBundle struct {
+	Name       string    `json:"name"`
+	Version    string    `json:"version"`
+	Source     string    `json:"source,omitempty"`
+	MediaTypes []string  `json:"media_types"`
+	Records    int       `json:"records"`
+	Checksum   string    `json:"checksum"`
+	ImportedBy *int      `json:"imported_by,omitempty"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// OfflineMetadataImport is one attempt to import a bundle version.
+// PreviousVersion is the version it replaced, if any.
+type OfflineMetadataImport struct {
+	ID              int64     `json:"id"`
+	Bundle          string    `json:"bundle"`
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previous_version,omitempty"`
+	Status          string    `json:"status"`
+	Records         int       `json:"records"`
+	Error           string    `json:"error,omitempty"`
+	ImportedBy      *int      `json:"imported_by,omitempty"`
+	ImportedAt      time.Time `json:"imported_at"`
+}
+
+// offlineBundleHeader is the first line of a bundle.
+type offlineBundleHeader struct {
+	Bundle  string `json:"bundle"`
+	Version string `json:"version"`
+	Source  string `json:"source"`
+}
+
+// offlineMetadataRecord is a line of a bundle after the header: one
+// provider record, in the fields of MetadataMatch.
+type offlineMetadataRecord struct {
+	MediaType     string   `json:"media_type"`
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	OriginalTitle string   `json:"original_title"`
+	Creator       string   `json:"creator"`
+	Year          *int     `json:"year"`
+	Description   string   `json:"description"`
+	Genres        []string `json:"genres"`
+	Director      string   `json:"director"`
+	Rating        *float64 `json:"rating"`
+	Runtime       *int     `json:"runtime"`
+	Language      string   `json:"language"`
+	CoverURL      string   `json:"cover_url"`
+	URL           string   `json:"url"`
+}
+
+// OfflineMetadataProvider is a metadata provider backed by bundles of
+// provider records imported into the database, for deployments without
+// internet access. A bundle is JSON Lines, optionally gzip-compressed: a
+// header line naming the bundle and its version, then one record per
+// line. Importing a bundle replaces the records of its previous version.
+// When several bundles hold a record, the most recently imported wins.
+type OfflineMetadataProvider struct {
+	db     *database.DB
+	logger *zap.Logger
+	now    func() time.Time
+
+	// importMu serializes imports; mu guards types, the media types of
+	// the imported records, loaded on first use
+	importMu sync.Mutex
+	mu       sync.Mutex
+	types    map[string]bool
+}
+
+// NewOfflineMetadataProvider creates a new OfflineMetadataProvider.
+func NewOfflineMetadataProvider(db *database.DB, logger *zap.Logger) *OfflineMetadataProvider {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &OfflineMetadataProvider{
+		db:     db,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Name implements MetadataProviderClient.
+func (p *OfflineMetadataProvider) Name() string { return MetadataProviderOffline }
+
+// Supports implements MetadataProviderClient. The provider covers the
+// media types of the records it has.
+func (p *OfflineMetadataProvider) Supports(mediaType string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.types == nil {
+		p.loadTypesLocked(context.Background())
+	}
+	return p.types[mediaType]
+}
+
+// loadTypesLocked reads the media types of the imported bundles. p.mu
+// must be held.
+func (p *OfflineMetadataProvider) loadTypesLocked(ctx context.Context) {
+	types := map[string]bool{}
+	rows, err := p.db.QueryContext(ctx, `SELECT media_types FROM offline_metadata_bundles`)
+	if err != nil {
+		p.logger.Warn("Failed to load offline metadata bundles", zap.Error(err))
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var list string
+		if err := rows.Scan(&list); err != nil {
+			p.logger.Warn("Failed to load offline metadata bundles", zap.Error(err))
+			return
+		}
+		for _, mediaType := range splitOfflineMediaTypes(list) {
+			types[mediaType] = true
+		}
+	}
+	if rows.Err() == nil {
+		p.types = types
+	}
+}
+
+func (p *OfflineMetadataProvider) reloadTypes(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loadTypesLocked(ctx)
+}
+
+func splitOfflineMediaTypes(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+// Search implements MetadataProviderClient. Records whose title equals the
+// query's, ignoring case and punctuation, come first, then records whose
+// title starts with its first word or contains its longest word.
+func (p *OfflineMetadataProvider) Search(ctx context.Context, query MetadataQuery) ([]MetadataMatch, error) {
+	words := metadataTitleWords(query.Title)
+	if len(words) == 0 {
+		return []MetadataMatch{}, nil
+	}
+	exact := strings.Join(words, " ")
+	longest := words[0]
+	for _, w := range words[1:] {
+		if len(w) > len(longest) {
+			longest = w
+		}
+	}
+
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT r.data FROM offline_metadata_records r
+		 JOIN offline_metadata_bundles b ON b.name = r.bundle
+		 WHERE r.media_type = ? AND (r.search_title = ? OR r.search_title LIKE ? OR r.search_title LIKE ?)
+		 ORDER BY CASE WHEN r.search_title = ? THEN 0 ELSE 1 END, b.imported_at DESC, r.id
+		 LIMIT ?`,
+		query.MediaType, exact, words[0]+"%", "%"+longest+"%", exact, offlineMetadataCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search offline metadata: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []MetadataMatch{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		match, err := offlineMetadataMatch(data)
+		if err != nil {
+			p.logger.Warn("Skipping unreadable offline metadata record", zap.Error(err))
+			continue
+		}
+		if seen[match.ExternalID] {
+			continue
+		}
+		seen[match.ExternalID] = true
+		match.Score = metadataMatchScore(query, *match)
+		matches = append(matches, *match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > metadataSearchResultMax {
+		matches = matches[:metadataSearchResultMax]
+	}
+	return matches, nil
+}
+
+// Lookup implements MetadataProviderClient.
+func (p *OfflineMetadataProvider) Lookup(ctx context.Context, mediaType, externalID string) (*MetadataMatch, error) {
+	var data string
+	err := p.db.QueryRowContext(ctx,
+		`SELECT r.data FROM offline_metadata_records r
+		 JOIN offline_metadata_bundles b ON b.name = r.bundle
+		 WHERE r.media_type = ? AND r.external_id = ?
+		 ORDER BY b.imported_at DESC LIMIT 1`, mediaType, externalID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("metadata record not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load offline metadata: %w", err)
+	}
+	return offlineMetadataMatch(data)
+}
+
+// offlineMetadataMatch converts a stored bundle line to a match. The line
+// is kept as the match's raw record.
+func offlineMetadataMatch(data string) (*MetadataMatch, error) {
+	var record offlineMetadataRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, err
+	}
+	return &MetadataMatch{
+		Provider:      MetadataProviderOffline,
+		ExternalID:    record.ID,
+		Title:         record.Title,
+		OriginalTitle: record.OriginalTitle,
+		Creator:       record.Creator,
+		Year:          record.Year,
+		Description:   record.Description,
+		Genres:        record.Genres,
+		Director:      record.Director,
+		Rating:        record.Rating,
+		Runtime:       record.Runtime,
+		Language:      record.Language,
+		CoverURL:      record.CoverURL,
+		URL:           record.URL,
+		Data:          json.RawMessage(data),
+	}, nil
+}
+
+// compareBundleVersions compares versions such as 2026.10 or 2026-10-16
+// part by part, numerically where both parts are numbers. It returns -1,
+// 0 or 1 as a is older than, the same as or newer than b.
+func compareBundleVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '_' || r == ' ' })
+	}
+	partsA, partsB := split(a), split(b)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.ParseInt(partsA[i], 10, 64)
+		numB, errB := strconv.ParseInt(partsB[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil && numA != numB:
+			if numA < numB {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && partsA[i] != partsB[i]:
+			if partsA[i] < partsB[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
+
+// Import reads a bundle and replaces the records of its installed
+// version. Only a newer version than the installed one is imported,
+// unless force is set. The import is recorded, and on failure the
+// installed version is kept.
+func (p *OfflineMetadataProvider) Import(ctx context.Context, r io.Reader, force bool, userID int) (*OfflineMetadataBundle, error) {
+	p.importMu.Lock()
+	defer p.importMu.Unlock()
+
+	checksum := sha256.New()
+	buffered := bufio.NewReader(io.TeeReader(r, checksum))
+	var input io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: %w", err)
+		}
+		defer gz.Close()
+		input = gz
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), offlineMetadataLineMax)
+
+	header, line, err := readOfflineBundleHeader(scanner)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := p.GetBundle(ctx, header.Bundle)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return nil, err
+	}
+	previous := ""
+	if installed != nil {
+		previous = installed.Version
+		if !force && compareBundleVersions(header.Version, installed.Version) <= 0 {
+			err := fmt.Errorf("bundle %s version %s is not newer than the installed version %s",
+				header.Bundle, header.Version, installed.Version)
+			p.recordImport(ctx, header, previous, OfflineImportFailed, 0, err, userID)
+			return nil, err
+		}
+	}
+
+	bundle, err := p.replaceBundle(ctx, scanner, line, header, checksum, userID)
+	if err != nil {
+		p.recordImport(ctx, header, previous, OfflineImportFailed, 0, err, userID)
+		return nil, err
+	}
+	p.recordImport(ctx, header, previous, OfflineImportImported, bundle.Records, nil, userID)
+	p.reloadTypes(ctx)
+	p.logger.Info("Offline metadata bundle imported", zap.String("bundle", bundle.Name),
+		zap.String("version", bundle.Version), zap.String("previous_version", previous), zap.Int("records", bundle.Records))
+	return bundle, nil
+}
+
+// readOfflineBundleHeader reads the first line of a bundle that is not
+// blank, and returns it with its line number.
+func readOfflineBundleHeader(scanner *bufio.Scanner) (*offlineBundleHeader, int, error) {
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var header offlineBundleHeader
+		if err := json.Unmarshal(text, &header); err != nil {
+			return nil, line, fmt.Errorf("invalid bundle: header on line %d: %w", line, err)
+		}
+		header.Version = strings.TrimSpace(header.Version)
+		if !offlineBundleName.MatchString(header.Bundle) {
+			return nil, line, fmt.Errorf("invalid bundle: name %q must be up to 64 letters, digits, dots, dashes or underscores", header.Bundle)
+		}
+		if header.Version == "" {
+			return nil, line, fmt.Errorf("invalid bundle: %s has no version", header.Bundle)
+		}
+		return &header, line, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, line, fmt.Errorf("invalid bundle: %w", err)
+	}
+	return nil, line, fmt.Errorf("invalid bundle: it is empty")
+}
+
+// replaceBundle stores the records after the header, in place of the
+// bundle's installed ones, in one transaction.
+func (p *OfflineMetadataProvider) replaceBundle(ctx context.Context, scanner *bufio.Scanner, line int, header *offlineBundleHeader, checksum hash.Hash, userID int) (*OfflineMetadataBundle, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM offline_metadata_records WHERE bundle = ?`, header.Bundle); err != nil {
+		return nil, fmt.Errorf("failed to clear bundle records: %w", err)
+	}
+	insert, err := tx.PrepareContext(ctx,
+		`INSERT INTO offline_metadata_records (bundle, media_type, external_id, title, search_title, year, data)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare record insert: %w", err)
+	}
+	defer insert.Close()
+
+	count := 0
+	types := map[string]bool{}
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var record offlineMetadataRecord
+		if err := json.Unmarshal(text, &record); err != nil {
+			return nil, fmt.Errorf("invalid bundle: line %d: %w", line, err)
+		}
+		if record.MediaType == "" || record.ID == "" || strings.TrimSpace(record.Title) == "" {
+			return nil, fmt.Errorf("invalid bundle: line %d: media_type, id and title are required", line)
+		}
+		if _, err := insert.ExecContext(ctx, header.Bundle, record.MediaType, record.ID, record.Title,
+			strings.Join(metadataTitleWords(record.Title), " "), record.Year, string(text)); err != nil {
+			return nil, fmt.Errorf("failed to store record on line %d: %w", line, err)
+		}
+		count++
+		types[record.MediaType] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("invalid bundle: %s has no records", header.Bundle)
+	}
+
+	mediaTypes := make([]string, 0, len(types))
+	for mediaType := range types {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	bundle := &OfflineMetadataBundle{
+		Name:       header.Bundle,
+		Version:    header.Version,
+		Source:     header.Source,
+		MediaTypes: mediaTypes,
+		Records:    count,
+		Checksum:   hex.EncodeToString(checksum.Sum(nil)),
+		ImportedBy: &userID,
+		ImportedAt: p.now(),
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE offline_metadata_bundles SET version = ?, source = ?, media_types = ?, record_count = ?, checksum = ?,
+		 imported_by = ?, imported_at = ? WHERE name = ?`,
+		bundle.Version, bundle.Source, strings.Join(mediaTypes, ","), bundle.Records, bundle.Checksum,
+		userID, bundle.ImportedAt, bundle.Name)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			_, err = tx.ExecContext(ctx,
+				`INSERT INTO offline_metadata_bundles (name, version, source, media_types, record_count, checksum, imported_by, imported_at)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				bundle.Name, bundle.Version, bundle.Source, strings.Join(mediaTypes, ","), bundle.Records, bundle.Checksum,
+				userID, bundle.ImportedAt)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store bundle: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit bundle import: %w", err)
+	}
+	return bundle, nil
+}
+
+func (p *OfflineMetadataProvider) recordImport(ctx context.Context, header *offlineBundleHeader, previous, status string, records int, importErr error, userID int) {
+	var message interface{}
+	if importErr != nil {
+		message = importErr.Error()
+	}
+	var previousVersion interface{}
+	if previous != "" {
+		previousVersion = previous
+	}
+	if _, err := p.db.ExecContext(ctx,
+		`INSERT INTO offline_metadata_imports (bundle, version, previous_version, status, record_count, error, imported_by, imported_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		header.Bundle, header.Version, previousVersion, status, records, message, userID, p.now()); err != nil {
+		p.logger.Warn("Failed to record offline metadata import", zap.String("bundle", header.Bundle), zap.Error(err))
+	}
+}
+
+const offlineBundleColumns = `name, version, source, media_types, record_count, checksum, imported_by, imported_at`
+
+func scanOfflineBundle(row shareLinkScanner) (*OfflineMetadataBundle, error) {
+	var bundle OfflineMetadataBundle
+	var source sql.NullString
+	var mediaTypes string
+	var importedBy sql.NullInt64
+	if err := row.Scan(&bundle.Name, &bundle.Version, &source, &mediaTypes, &bundle.Records, &bundle.Checksum,
+		&importedBy, &bundle.ImportedAt); err != nil {
+		return nil, err
+	}
+	bundle.Source = source.String
+	bundle.MediaTypes = splitOfflineMediaTypes(mediaTypes)
+	if importedBy.Valid {
+		id := int(importedBy.Int64)
+		bundle.ImportedBy = &id
+	}
+	return &bundle, nil
+}
+
+// ListBundles returns the imported bundles, by name.
+func (p *OfflineMetadataProvider) ListBundles(ctx context.Context) ([]OfflineMetadataBundle, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+offlineBundleColumns+` FROM offline_metadata_bundles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offline metadata bundles: %w", err)
+	}
+	defer rows.Close()
+	bundles := []OfflineMetadataBundle{}
+	for rows.Next() {
+		bundle, err := scanOfflineBundle(rows)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, *bundle)
+	}
+	return bundles, rows.Err()
+}
+
+// GetBundle returns an imported bundle.
+func (p *OfflineMetadataProvider) GetBundle(ctx context.Context, name string) (*OfflineMetadataBundle, error) {
+	bundle, err := scanOfflineBundle(p.db.QueryRowContext(ctx,
+		`SELECT `+offlineBundleColumns+` FROM offline_metadata_bundles WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("offline metadata bundle %s not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load offline metadata bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+// ListImports returns the most recent import attempts, newest first, of
+// one bundle or, when bundle is empty, of all of them.
+func (p *OfflineMetadataProvider) ListImports(ctx context.Context, bundle string, limit int) ([]OfflineMetadataImport, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	query := `SELECT id, bundle, version, previous_version, status, record_count, error, imported_by, imported_at
+		FROM offline_metadata_imports`
+	args := []interface{}{}
+	if bundle != "" {
+		query += ` WHERE bundle = ?`
+		args = append(args, bundle)
+	}
+	rows, err := p.db.QueryContext(ctx, query+` ORDER BY imported_at DESC, id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offline metadata imports: %w", err)
+	}
+	defer rows.Close()
+	imports := []OfflineMetadataImport{}
+	for rows.Next() {
+		var imp OfflineMetadataImport
+		var previous, message sql.NullString
+		var importedBy sql.NullInt64
+		if err := rows.Scan(&imp.ID, &imp.Bundle, &imp.Version, &previous, &imp.Status, &imp.Records, &message,
+			&importedBy, &imp.ImportedAt); err != nil {
+			return nil, err
+		}
+		imp.PreviousVersion, imp.Error = previous.String, message.String
+		if importedBy.Valid {
+			id := int(importedBy.Int64)
+			imp.ImportedBy = &id
+		}
+		imports = append(imports, imp)
+	}
+	return imports, rows.Err()
+}
+
+// DeleteBundle removes a bundle and its records. Items matched to its
+// records keep the metadata they were given.
+func (p *OfflineMetadataProvider) DeleteBundle(ctx context.Context, name string) error {
+	p.importMu.Lock()
+	defer p.importMu.Unlock()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, `DELETE FROM offline_metadata_bundles WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete offline metadata bundle: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("offline metadata bundle %s not found", name)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM offline_metadata_records WHERE bundle = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete offline metadata records: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bundle deletion: %w", err)
+	}
+	p.reloadTypes(ctx)
+	p.logger.Info("Offline metadata bundle deleted", zap.String("bundle", name))
+	return nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+
+	"catalogizer/internal/media/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// offlineBundle builds a bundle from its header and record lines.
+func offlineBundle(lines ...string) *strings.Reader {
+	return strings.NewReader(strings.Join(lines, "\n") + "\n")
+}
+
+func TestCompareBundleVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"2026.10", "2026.9", 1},
+		{"2026-10-16", "2026-10-16", 0},
+		{"2026.10", "2026.10.1", -1},
+		{"3", "12", -1},
+		{"2026.10-b", "2026.10-a", 1},
+	} {
+		assert.Equal(t, tc.want, compareBundleVersions(tc.a, tc.b), "%s vs %s", tc.a, tc.b)
+	}
+}
+
+func TestOfflineMetadataProvider_ImportAndSearch(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	p := NewOfflineMetadataProvider(db, zap.NewNop())
+	assert.False(t, p.Supports("movie"), "nothing is covered before a bundle is imported")
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(`{"bundle":"films","version":"2026.09","source":"tmdb export"}
+
+{"media_type":"movie","id":"tt0069293","title":"Solaris","original_title":"Солярис","year":1972,"description":"A planet","director":"Andrei Tarkovsky","rating":8.1}
+{"media_type":"movie","id":"tt0307479","title":"Solaris","year":2002,"description":"A remake"}
+{"media_type":"music_album","id":"mb-1","title":"Solaris","creator":"Cliff Martinez","year":2002}
+`))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	bundle, err := p.Import(ctx, &compressed, false, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "2026.09", bundle.Version)
+	assert.Equal(t, 3, bundle.Records)
+	assert.Equal(t, []string{"movie", "music_album"}, bundle.MediaTypes)
+	assert.Len(t, bundle.Checksum, 64)
+	assert.True(t, p.Supports("movie"))
+	assert.False(t, p.Supports("book"))
+
+	year := 1972
+	matches, err := p.Search(ctx, MetadataQuery{MediaType: "movie", Title: "solaris", Year: &year})
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "tt0069293", matches[0].ExternalID)
+	assert.Equal(t, 1.0, matches[0].Score)
+	assert.Equal(t, MetadataProviderOffline, matches[0].Provider)
+	matches, err = p.Search(ctx, MetadataQuery{MediaType: "movie", Title: "Solaris Director's Cut"})
+	require.NoError(t, err)
+	assert.Len(t, matches, 2, "titles starting with the query's first word are candidates")
+
+	match, err := p.Lookup(ctx, "movie", "tt0069293")
+	require.NoError(t, err)
+	assert.Equal(t, "Andrei Tarkovsky", match.Director)
+	assert.Contains(t, string(match.Data), `"original_title":"Солярис"`)
+	_, err = p.Lookup(ctx, "movie", "tt9999999")
+	assert.ErrorContains(t, err, "metadata record not found")
+
+	// Only newer versions replace the installed one
+	update := offlineBundle(`{"bundle":"films","version":"2026.10"}`,
+		`{"media_type":"movie","id":"tt0069293","title":"Solaris","year":1972,"description":"A planet that reads minds"}`)
+	_, err = p.Import(ctx, offlineBundle(`{"bundle":"films","version":"2026.9"}`, `{"media_type":"movie","id":"x","title":"X"}`), false, 1)
+	assert.ErrorContains(t, err, "version 2026.9 is not newer than the installed version 2026.09")
+	_, err = p.Import(ctx, offlineBundle(`{"bundle":"films","version":"2026.11"}`, `{"media_type":"movie","title":"No ID"}`), false, 1)
+	assert.ErrorContains(t, err, "invalid bundle: line 2: media_type, id and title are required")
+	bundle, err = p.Import(ctx, update, false, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, bundle.Records)
+	assert.False(t, p.Supports("music_album"))
+	match, err = p.Lookup(ctx, "movie", "tt0069293")
+	require.NoError(t, err)
+	assert.Equal(t, "A planet that reads minds", match.Description)
+	_, err = p.Lookup(ctx, "movie", "tt0307479")
+	assert.ErrorContains(t, err, "not found", "records of the previous version are gone")
+
+	_, err = p.Import(ctx, offlineBundle(`{"bundle":"films","version":"2026.10"}`, `{"media_type":"movie","id":"x","title":"X"}`), false, 1)
+	assert.ErrorContains(t, err, "not newer")
+	_, err = p.Import(ctx, offlineBundle(`{"bundle":"films","version":"2026.10"}`, `{"media_type":"movie","id":"x","title":"X"}`), true, 1)
+	require.NoError(t, err, "force re-imports a version")
+
+	imports, err := p.ListImports(ctx, "films", 0)
+	require.NoError(t, err)
+	require.Len(t, imports, 6)
+	assert.Equal(t, OfflineImportImported, imports[0].Status)
+	assert.Equal(t, "2026.10", imports[0].PreviousVersion)
+	assert.Equal(t, OfflineImportFailed, imports[1].Status)
+	assert.Equal(t, OfflineImportImported, imports[2].Status)
+	assert.Equal(t, 1, imports[2].Records)
+	assert.Equal(t, "2026.09", imports[2].PreviousVersion)
+	assert.Empty(t, imports[5].PreviousVersion)
+
+	_, err = p.Import(ctx, offlineBundle(`{"version":"1"}`), false, 1)
+	assert.ErrorContains(t, err, "invalid bundle: name")
+	_, err = p.Import(ctx, offlineBundle(`{"bundle":"music","version":"1"}`), false, 1)
+	assert.ErrorContains(t, err, "invalid bundle: music has no records")
+	_, err = p.Import(ctx, strings.NewReader(""), false, 1)
+	assert.ErrorContains(t, err, "invalid bundle: it is empty")
+
+	bundles, err := p.ListBundles(ctx)
+	require.NoError(t, err)
+	require.Len(t, bundles, 1)
+	require.NoError(t, p.DeleteBundle(ctx, "films"))
+	assert.False(t, p.Supports("movie"))
+	assert.ErrorContains(t, p.DeleteBundle(ctx, "films"), "not found")
+	matches, err = p.Search(ctx, MetadataQuery{MediaType: "movie", Title: "X"})
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestOfflineMetadataProvider_Enrichment(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	offline := NewOfflineMetadataProvider(db, nil)
+	_, err := offline.Import(ctx, offlineBundle(`{"bundle":"films","version":"1"}`,
+		`{"media_type":"movie","id":"tt0069293","title":"Solaris","year":1972,"description":"A planet","genres":["Drama"]}`), false, 1)
+	require.NoError(t, err)
+
+	itemRepo := repository.NewMediaItemRepository(db)
+	enrichment := NewMetadataEnrichmentService(db, zap.NewNop(), itemRepo, repository.NewExternalMetadataRepository(db), "")
+	enrichment.SetProviders(&fakeMetadataProvider{}, offline)
+	_, err = enrichment.SetSourceConfig(ctx, MetadataSourceConfig{ProviderOrder: []string{MetadataProviderOffline}}, 1)
+	require.NoError(t, err, "the offline provider can be put in the provider order")
+
+	_, movieType, err := itemRepo.GetMediaTypeByName(ctx, "movie")
+	require.NoError(t, err)
+	id, err := itemRepo.Create(ctx, &models.MediaItem{MediaTypeID: movieType, Title: "Solaris", Status: "detected"})
+	require.NoError(t, err)
+	result, err := enrichment.Enrich(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, MetadataProviderOffline, result.Match.Provider)
+	item, err := itemRepo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "A planet", *item.Description)
+}
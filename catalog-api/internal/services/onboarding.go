@@ -0,0 +1,359 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Onboarding tasks
+const (
+	OnboardingTaskAddShare   = "add_share"
+	OnboardingTaskFirstScan  = "first_scan"
+	OnboardingTaskCreateUser = "create_user"
+	OnboardingTaskMobileApp  = "install_mobile_app"
+)
+
+// Onboarding task statuses
+const (
+	OnboardingStatusPending   = "pending"
+	OnboardingStatusCompleted = "completed"
+	OnboardingStatusSkipped   = "skipped"
+)
+
+// DemoLibraryRootName names the storage root of the demo library. It does
+// not count as a share for onboarding.
+const DemoLibraryRootName = "Demo Library"
+
+// onboardingTaskDefinition describes a guided task and how to tell that
+// it has been done.
+type onboardingTaskDefinition struct {
+	id          string
+	title       string
+	description string
+	query       string
+}
+
+// onboardingTasks are the guided tasks in the order they are shown. A
+// task whose query counts at least one row is completed.
+var onboardingTasks = []onboardingTaskDefinition{
+	{
+		id:          OnboardingTaskAddShare,
+		title:       "Add a share",
+		description: "Connect an SMB, NFS, FTP, WebDAV or local folder that holds your media.",
+		query:       `SELECT COUNT(*) FROM storage_roots WHERE name <> '` + DemoLibraryRootName + `'`,
+	},
+	{
+		id:          OnboardingTaskFirstScan,
+		title:       "Run your first scan",
+		description: "Scan a share so its media appears in the catalog.",
+		query: `SELECT COUNT(*) FROM files f JOIN storage_roots r ON r.id = f.storage_root_id
+			WHERE r.name <> '` + DemoLibraryRootName + `' AND f.is_directory = 0`,
+	},
+	{
+		id:          OnboardingTaskCreateUser,
+		title:       "Create a user",
+		description: "Invite someone to browse and play the catalog with their own account.",
+		query:       `SELECT COUNT(*) - 1 FROM users`,
+	},
+	{
+		id:          OnboardingTaskMobileApp,
+		title:       "Install the mobile app",
+		description: "Sign in from the Android or Android TV app to browse and play on the go.",
+		query: `SELECT COUNT(*) FROM user_sessions
+			WHERE device_info LIKE '%"platform":"android"%' OR device_info LIKE '%"platform":"ios"%'
+			OR device_info LIKE '%"device_type":"mobile"%' OR device_info LIKE '%"device_type":"tablet"%'
+			OR device_info LIKE '%"device_type":"tv"%'`,
+	},
+}
+
+// OnboardingTask is a guided task and its status. Tasks are completed as
+// soon as what they ask for is detected and stay completed; any task can
+// also be completed or skipped by hand.
+type OnboardingTask struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// DemoLibrary describes the generated demo library.
+type DemoLibrary struct {
+	StorageRootID int64    `json:"storage_root_id"`
+	Path          string   `json:"path"`
+	Enabled       bool     `json:"enabled"`
+	FilesWritten  []string `json:"files_written,omitempty"`
+	ScanJobID     string   `json:"scan_job_id,omitempty"`
+}
+
+// OnboardingStatus is the state of onboarding. Finished is set once every
+// task is completed or skipped.
+type OnboardingStatus struct {
+	Tasks       []OnboardingTask `json:"tasks"`
+	Completed   int              `json:"completed"`
+	Total       int              `json:"total"`
+	Finished    bool             `json:"finished"`
+	DemoLibrary *DemoLibrary     `json:"demo_library,omitempty"`
+}
+
+// onboardingScanner queues scans of the demo library.
+type onboardingScanner interface {
+	QueueScan(job ScanJob) error
+}
+
+// OnboardingConfig says where the demo library is generated.
+type OnboardingConfig struct {
+	DemoLibraryDir string
+}
+
+// OnboardingService tracks the guided tasks that take a new installation
+// from an empty dashboard to a working catalog, and generates a demo
+// library of placeholder media to explore the UI with meanwhile.
+type OnboardingService struct {
+	db      *database.DB
+	logger  *zap.Logger
+	config  OnboardingConfig
+	scanner onboardingScanner
+	now     func() time.Time
+}
+
+// NewOnboardingService creates an OnboardingService that generates the
+// demo library under ./data/demo-library unless cfg says otherwise.
+// scanner may be nil, in which case the demo library is not scanned.
+func NewOnboardingService(db *database.DB, logger *zap.Logger, scanner onboardingScanner, cfg OnboardingConfig) *OnboardingService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.DemoLibraryDir == "" {
+		cfg.DemoLibraryDir = filepath.Join("data", "demo-library")
+	}
+	return &OnboardingService{
+		db:      db,
+		logger:  logger,
+		config:  cfg,
+		scanner: scanner,
+		now:     time.Now,
+	}
+}
+
+// Status returns every task with its status, recording the tasks that
+// are detected as done for the first time.
+func (s *OnboardingService) Status(ctx context.Context) (*OnboardingStatus, error) {
+	status := &OnboardingStatus{Tasks: make([]OnboardingTask, 0, len(onboardingTasks)), Total: len(onboardingTasks)}
+	for _, def := range onboardingTasks {
+		task, err := s.task(ctx, def)
+		if err != nil {
+			return nil, err
+		}
+		if task.Status != OnboardingStatusCompleted {
+			var count int
+			if err := s.db.QueryRowContext(ctx, def.query).Scan(&count); err != nil {
+				return nil, fmt.Errorf("failed to check onboarding task %s: %w", def.id, err)
+			}
+			if count > 0 {
+				if task, err = s.setTaskStatus(ctx, def, OnboardingStatusCompleted, 0); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if task.Status == OnboardingStatusCompleted {
+			status.Completed++
+		}
+		status.Tasks = append(status.Tasks, *task)
+	}
+
+	status.Finished = true
+	for _, task := range status.Tasks {
+		if task.Status == OnboardingStatusPending {
+			status.Finished = false
+		}
+	}
+
+	demo, err := s.demoLibrary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.DemoLibrary = demo
+	return status, nil
+}
+
+// CompleteTask marks a task as done by hand, for what cannot be detected.
+func (s *OnboardingService) CompleteTask(ctx context.Context, taskID string, userID int) (*OnboardingTask, error) {
+	def, err := lookupOnboardingTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return s.setTaskStatus(ctx, def, OnboardingStatusCompleted, userID)
+}
+
+// SkipTask hides a task that is not wanted. A skipped task still
+// completes when it is detected as done.
+func (s *OnboardingService) SkipTask(ctx context.Context, taskID string, userID int) (*OnboardingTask, error) {
+	def, err := lookupOnboardingTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.task(ctx, def)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status == OnboardingStatusCompleted {
+		return nil, fmt.Errorf("invalid onboarding task %s: already completed", taskID)
+	}
+	return s.setTaskStatus(ctx, def, OnboardingStatusSkipped, userID)
+}
+
+func lookupOnboardingTask(taskID string) (onboardingTaskDefinition, error) {
+	for _, def := range onboardingTasks {
+		if def.id == taskID {
+			return def, nil
+		}
+	}
+	return onboardingTaskDefinition{}, fmt.Errorf("onboarding task %s not found", taskID)
+}
+
+// task returns the recorded status of a task, pending when none was
+// recorded.
+func (s *OnboardingService) task(ctx context.Context, def onboardingTaskDefinition) (*OnboardingTask, error) {
+	task := &OnboardingTask{ID: def.id, Title: def.title, Description: def.description, Status: OnboardingStatusPending}
+	var completedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT status, completed_at FROM onboarding_tasks WHERE task = ?`, def.id).Scan(&task.Status, &completedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load onboarding task %s: %w", def.id, err)
+	}
+	if completedAt.Valid {
+		task.CompletedAt = &completedAt.Time
+	}
+	return task, nil
+}
+
+// setTaskStatus records a task's status; userID is 0 when it was detected.
+func (s *OnboardingService) setTaskStatus(ctx context.Context, def onboardingTaskDefinition, status string, userID int) (*OnboardingTask, error) {
+	now := s.now().UTC()
+	var completedAt *time.Time
+	if status == OnboardingStatusCompleted {
+		completedAt = &now
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO onboarding_tasks (task, status) VALUES (?, ?)`, def.id, status); err != nil {
+		return nil, fmt.Errorf("failed to save onboarding task %s: %w", def.id, err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE onboarding_tasks SET status = ?, completed_at = ?, updated_by = ?, updated_at = ? WHERE task = ?`,
+		status, completedAt, userID, now, def.id); err != nil {
+		return nil, fmt.Errorf("failed to save onboarding task %s: %w", def.id, err)
+	}
+	if status == OnboardingStatusCompleted {
+		s.logger.Info("Onboarding task completed", zap.String("task", def.id), zap.Int("user_id", userID))
+	}
+	return s.task(ctx, def)
+}
+
+// CreateDemoLibrary writes the demo library, adds it as a local storage
+// root and queues its scan. Running it again restores missing files and
+// scans again.
+func (s *OnboardingService) CreateDemoLibrary(ctx context.Context) (*DemoLibrary, error) {
+	dir, err := filepath.Abs(s.config.DemoLibraryDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve demo library directory: %w", err)
+	}
+	written, err := GenerateDemoLibrary(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	demo, err := s.demoLibrary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if demo == nil {
+		id, err := s.db.InsertReturningID(ctx,
+			`INSERT INTO storage_roots (name, protocol, path, enabled, max_depth) VALUES (?, ?, ?, ?, ?)`,
+			DemoLibraryRootName, "local", dir, true, 10)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add demo library storage root: %w", err)
+		}
+		demo = &DemoLibrary{StorageRootID: id}
+	} else if _, err := s.db.ExecContext(ctx,
+		`UPDATE storage_roots SET protocol = ?, path = ?, enabled = ?, updated_at = ? WHERE id = ?`,
+		"local", dir, true, s.now().UTC(), demo.StorageRootID); err != nil {
+		return nil, fmt.Errorf("failed to update demo library storage root: %w", err)
+	}
+	demo.Path = dir
+	demo.Enabled = true
+	demo.FilesWritten = written
+
+	if s.scanner != nil {
+		job := ScanJob{
+			ID:          uuid.New().String(),
+			StorageRoot: &models.StorageRoot{ID: demo.StorageRootID, Name: DemoLibraryRootName, Protocol: "local", Path: &dir, Enabled: true, MaxDepth: 10},
+			ScanType:    "full",
+			MaxDepth:    10,
+			Context:     context.Background(),
+		}
+		if err := s.scanner.QueueScan(job); err != nil {
+			return nil, fmt.Errorf("demo library created but its scan was not queued: %w", err)
+		}
+		demo.ScanJobID = job.ID
+	}
+	s.logger.Info("Demo library created", zap.String("path", dir), zap.Int("files_written", len(written)))
+	return demo, nil
+}
+
+// RemoveDemoLibrary disables the demo library's storage root, removes its
+// files from the catalog and deletes the generated files.
+func (s *OnboardingService) RemoveDemoLibrary(ctx context.Context) error {
+	demo, err := s.demoLibrary(ctx)
+	if err != nil {
+		return err
+	}
+	if demo == nil {
+		return fmt.Errorf("demo library not found")
+	}
+
+	now := s.now().UTC()
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE files SET deleted = ?, deleted_at = ? WHERE storage_root_id = ? AND deleted = ?`,
+		true, now, demo.StorageRootID, false); err != nil {
+		return fmt.Errorf("failed to remove demo library files: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE storage_roots SET enabled = ?, updated_at = ? WHERE id = ?`, false, now, demo.StorageRootID); err != nil {
+		return fmt.Errorf("failed to disable demo library storage root: %w", err)
+	}
+	if demo.Path != "" {
+		if err := os.RemoveAll(demo.Path); err != nil {
+			return fmt.Errorf("failed to delete demo library directory: %w", err)
+		}
+	}
+	s.logger.Info("Demo library removed", zap.String("path", demo.Path))
+	return nil
+}
+
+// demoLibrary returns the demo library's storage root, or nil when it was
+// never created.
+func (s *OnboardingService) demoLibrary(ctx context.Context) (*DemoLibrary, error) {
+	demo := &DemoLibrary{}
+	var path sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, path, enabled FROM storage_roots WHERE name = ?`, DemoLibraryRootName).Scan(&demo.StorageRootID, &path, &demo.Enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load demo library: %w", err)
+	}
+	demo.Path = path.String
+	return demo, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingScanner struct {
+	jobs []ScanJob
+}
+
+func (r *recordingScanner) QueueScan(job ScanJob) error {
+	r.jobs = append(r.jobs, job)
+	return nil
+}
+
+func newOnboardingTestService(t *testing.T) (*OnboardingService, *sql.DB, *recordingScanner) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			path TEXT,
+			enabled BOOLEAN DEFAULT 1,
+			max_depth INTEGER DEFAULT 10,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			deleted BOOLEAN DEFAULT 0,
+			deleted_at DATETIME
+		);
+		CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL);
+		CREATE TABLE user_sessions (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, device_info TEXT);
+		CREATE TABLE onboarding_tasks (
+			task TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			completed_at DATETIME,
+			updated_by INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO users (username) VALUES ('admin');
+	`)
+	require.NoError(t, err)
+
+	scanner := &recordingScanner{}
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	svc := NewOnboardingService(db, nil, scanner, OnboardingConfig{DemoLibraryDir: filepath.Join(t.TempDir(), "demo")})
+	return svc, sqlDB, scanner
+}
+
+func onboardingTaskStatus(status *OnboardingStatus, taskID string) string {
+	for _, task := range status.Tasks {
+		if task.ID == taskID {
+			return task.Status
+		}
+	}
+	return ""
+}
+
+func TestOnboardingService_Tasks(t *testing.T) {
+	svc, sqlDB, _ := newOnboardingTestService(t)
+	ctx := context.Background()
+
+	status, err := svc.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, status.Total)
+	assert.Equal(t, 0, status.Completed)
+	assert.False(t, status.Finished)
+
+	_, err = sqlDB.Exec(`INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'smb', 'media')`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO user_sessions (user_id, device_info) VALUES (1, '{"device_type":"mobile","platform":"android"}')`)
+	require.NoError(t, err)
+	status, err = svc.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, OnboardingStatusCompleted, onboardingTaskStatus(status, OnboardingTaskAddShare))
+	assert.Equal(t, OnboardingStatusCompleted, onboardingTaskStatus(status, OnboardingTaskMobileApp))
+	assert.Equal(t, OnboardingStatusPending, onboardingTaskStatus(status, OnboardingTaskFirstScan))
+
+	// Completed tasks stay completed
+	_, err = sqlDB.Exec(`DELETE FROM storage_roots`)
+	require.NoError(t, err)
+	status, err = svc.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, OnboardingStatusCompleted, onboardingTaskStatus(status, OnboardingTaskAddShare))
+
+	_, err = svc.SkipTask(ctx, OnboardingTaskFirstScan, 1)
+	require.NoError(t, err)
+	task, err := svc.CompleteTask(ctx, OnboardingTaskCreateUser, 1)
+	require.NoError(t, err)
+	assert.Equal(t, OnboardingStatusCompleted, task.Status)
+	require.NotNil(t, task.CompletedAt)
+	_, err = svc.SkipTask(ctx, OnboardingTaskCreateUser, 1)
+	assert.ErrorContains(t, err, "already completed")
+	_, err = svc.CompleteTask(ctx, "watch_movie", 1)
+	assert.ErrorContains(t, err, "not found")
+
+	status, err = svc.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, status.Completed)
+	assert.True(t, status.Finished)
+}
+
+func TestOnboardingService_DemoLibrary(t *testing.T) {
+	svc, sqlDB, scanner := newOnboardingTestService(t)
+	ctx := context.Background()
+
+	demo, err := svc.CreateDemoLibrary(ctx)
+	require.NoError(t, err)
+	assert.Len(t, demo.FilesWritten, len(demoLibraryFiles))
+	require.Len(t, scanner.jobs, 1)
+	assert.Equal(t, demo.StorageRootID, scanner.jobs[0].StorageRoot.ID)
+	assert.Equal(t, demo.ScanJobID, scanner.jobs[0].ID)
+
+	wav, err := os.ReadFile(filepath.Join(demo.Path, "Music/Demo Artist/First Light (2020)/01 - Opening.wav"))
+	require.NoError(t, err)
+	assert.Equal(t, "RIFF", string(wav[:4]))
+	assert.Len(t, wav, 44+8000)
+
+	// The demo library is not a share and its files are not a first scan
+	_, err = sqlDB.Exec(`INSERT INTO files (storage_root_id, path) VALUES (?, '/Movies/The Placeholder (2021)')`, demo.StorageRootID)
+	require.NoError(t, err)
+	status, err := svc.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status.Completed)
+	require.NotNil(t, status.DemoLibrary)
+	assert.True(t, status.DemoLibrary.Enabled)
+
+	// Creating it again keeps the files and storage root
+	again, err := svc.CreateDemoLibrary(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, again.FilesWritten)
+	assert.Equal(t, demo.StorageRootID, again.StorageRootID)
+
+	require.NoError(t, svc.RemoveDemoLibrary(ctx))
+	_, err = os.Stat(demo.Path)
+	assert.True(t, os.IsNotExist(err))
+	var deleted bool
+	require.NoError(t, sqlDB.QueryRow(`SELECT deleted FROM files WHERE storage_root_id = ?`, demo.StorageRootID).Scan(&deleted))
+	assert.True(t, deleted)
+	status, err = svc.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, status.DemoLibrary.Enabled)
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Results of a permission trace step.
+const (
+	PermissionStepAllow = "allow"
+	PermissionStepDeny  = "deny"
+	PermissionStepInfo  = "info"
+)
+
+// lockdownBlockedActions are the actions refused on a storage root in
+// read-only lockdown.
+var lockdownBlockedActions = []string{
+	models.PermissionMediaUpload,
+	models.PermissionMediaEdit,
+	models.PermissionMediaDelete,
+	models.PermissionMediaManage,
+}
+
+// PermissionCheck is a what-if question: may this user perform this action,
+// optionally on this storage root, path or file? The user is identified by
+// ID or username.
+type PermissionCheck struct {
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
+	Action      string `json:"action"`
+	StorageRoot string `json:"storage_root,omitempty"`
+	Path        string `json:"path,omitempty"`
+	FileID      int64  `json:"file_id,omitempty"`
+}
+
+// PermissionTraceStep is one check made while evaluating a PermissionCheck.
+type PermissionTraceStep struct {
+	Check  string `json:"check"`
+	Result string `json:"result"`
+	Detail string `json:"detail"`
+}
+
+// PermissionDecision is the outcome of a PermissionCheck with every check
+// that contributed to it. Evaluation does not stop at the first denial, so
+// the trace shows everything that would need to change.
+type PermissionDecision struct {
+	Allowed     bool                  `json:"allowed"`
+	Reason      string                `json:"reason"`
+	UserID      int                   `json:"user_id"`
+	Username    string                `json:"username"`
+	Role        string                `json:"role"`
+	Action      string                `json:"action"`
+	StorageRoot string                `json:"storage_root,omitempty"`
+	Path        string                `json:"path,omitempty"`
+	Trace       []PermissionTraceStep `json:"trace"`
+}
+
+// PermissionSimulator answers "why can't user X do Y" by evaluating an
+// action against the same rules the API applies: the account state, the
+// role's grants with their wildcards, the target resource and read-only
+// lockdowns. Nothing is changed and the user does not need to sign in.
+type PermissionSimulator struct {
+	db        *database.DB
+	lockdowns lockdownStatus
+	now       func() time.Time
+}
+
+// NewPermissionSimulator creates a new PermissionSimulator.
+func NewPermissionSimulator(db *database.DB) *PermissionSimulator {
+	return &PermissionSimulator{db: db, now: time.Now}
+}
+
+// SetLockdownChecker makes simulations report storage roots in read-only
+// lockdown.
+func (s *PermissionSimulator) SetLockdownChecker(checker lockdownStatus) {
+	s.lockdowns = checker
+}
+
+// simulatedUser is the account a simulation is run for.
+type simulatedUser struct {
+	id          int
+	username    string
+	isActive    bool
+	isLocked    bool
+	lockedUntil *time.Time
+	roleID      int
+	role        sql.NullString
+	permissions models.Permissions
+}
+
+// Simulate evaluates a PermissionCheck.
+func (s *PermissionSimulator) Simulate(ctx context.Context, check *PermissionCheck) (*PermissionDecision, error) {
+	action := strings.TrimSpace(check.Action)
+	if action == "" {
+		return nil, fmt.Errorf("invalid permission check: action is required")
+	}
+	if check.UserID == 0 && strings.TrimSpace(check.Username) == "" {
+		return nil, fmt.Errorf("invalid permission check: user_id or username is required")
+	}
+	if check.Path != "" && check.StorageRoot == "" && check.FileID == 0 {
+		return nil, fmt.Errorf("invalid permission check: path requires storage_root")
+	}
+
+	user, err := s.loadUser(ctx, check)
+	if err != nil {
+		return nil, err
+	}
+	decision := &PermissionDecision{
+		Allowed:  true,
+		UserID:   user.id,
+		Username: user.username,
+		Role:     user.role.String,
+		Action:   action,
+		Trace:    []PermissionTraceStep{},
+	}
+
+	s.checkAccount(decision, user)
+	s.checkRole(decision, user, action)
+	if err := s.checkDirectGrants(ctx, decision, user, action); err != nil {
+		return nil, err
+	}
+	if err := s.checkResource(ctx, decision, check, action); err != nil {
+		return nil, err
+	}
+
+	if decision.Allowed {
+		decision.Reason = "all checks passed"
+	}
+	return decision, nil
+}
+
+// step appends a trace step; the first denial becomes the decision's reason.
+func (d *PermissionDecision) step(check, result, detail string) {
+	d.Trace = append(d.Trace, PermissionTraceStep{Check: check, Result: result, Detail: detail})
+	if result == PermissionStepDeny && d.Allowed {
+		d.Allowed = false
+		d.Reason = detail
+	}
+}
+
+func (s *PermissionSimulator) loadUser(ctx context.Context, check *PermissionCheck) (*simulatedUser, error) {
+	query := `SELECT u.id, u.username, u.is_active, u.is_locked, u.locked_until, u.role_id, r.name, r.permissions
+		FROM users u LEFT JOIN roles r ON r.id = u.role_id `
+	var row *sql.Row
+	if check.UserID != 0 {
+		row = s.db.QueryRowContext(ctx, query+`WHERE u.id = ?`, check.UserID)
+	} else {
+		row = s.db.QueryRowContext(ctx, query+`WHERE u.username = ?`, strings.TrimSpace(check.Username))
+	}
+
+	var user simulatedUser
+	var lockedUntil sql.NullTime
+	var permissions sql.NullString
+	err := row.Scan(&user.id, &user.username, &user.isActive, &user.isLocked, &lockedUntil, &user.roleID,
+		&user.role, &permissions)
+	if err == sql.ErrNoRows {
+		if check.UserID != 0 {
+			return nil, fmt.Errorf("user %d not found", check.UserID)
+		}
+		return nil, fmt.Errorf("user %s not found", check.Username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if lockedUntil.Valid {
+		user.lockedUntil = &lockedUntil.Time
+	}
+	if permissions.Valid {
+		if err := user.permissions.Scan(permissions.String); err != nil {
+			return nil, fmt.Errorf("failed to parse permissions of role %s: %w", user.role.String, err)
+		}
+	}
+	return &user, nil
+}
+
+// checkAccount denies everything to accounts that cannot sign in.
+func (s *PermissionSimulator) checkAccount(d *PermissionDecision, user *simulatedUser) {
+	switch {
+	case !user.isActive:
+		d.step("account", PermissionStepDeny, fmt.Sprintf("user %s is deactivated", user.username))
+	case user.isLocked && user.lockedUntil == nil:
+		d.step("account", PermissionStepDeny, fmt.Sprintf("user %s is locked", user.username))
+	case user.isLocked && user.lockedUntil.After(s.now()):
+		d.step("account", PermissionStepDeny, fmt.Sprintf("user %s is locked until %s",
+			user.username, user.lockedUntil.UTC().Format(time.RFC3339)))
+	default:
+		d.step("account", PermissionStepAllow, fmt.Sprintf("user %s is active", user.username))
+	}
+}
+
+// checkRole matches the action against the role's grants the way
+// models.Permissions.HasPermission does, naming the grant that matched.
+func (s *PermissionSimulator) checkRole(d *PermissionDecision, user *simulatedUser, action string) {
+	if !user.role.Valid {
+		d.step("role", PermissionStepDeny, fmt.Sprintf("role %d assigned to %s does not exist", user.roleID, user.username))
+		return
+	}
+	if grant := matchingGrant(user.permissions, action); grant != "" {
+		d.step("role", PermissionStepAllow, fmt.Sprintf("role %s grants %s through %q", user.role.String, action, grant))
+		return
+	}
+
+	detail := fmt.Sprintf("role %s does not grant %s", user.role.String, action)
+	// Catch-all names like media.manage read as if they imply the rest of
+	// their group, but only exact names and trailing wildcards match
+	if i := strings.Index(action, "."); i > 0 {
+		group := action[:i+1]
+		var related []string
+		for _, p := range user.permissions {
+			if strings.HasPrefix(p, group) {
+				related = append(related, p)
+			}
+		}
+		if len(related) > 0 {
+			detail += fmt.Sprintf(" (it has %s; only exact names and wildcards such as %q match)",
+				strings.Join(related, ", "), group+"*")
+		}
+	}
+	d.step("role", PermissionStepDeny, detail)
+}
+
+// matchingGrant returns the grant that allows permission, or "".
+func matchingGrant(grants models.Permissions, permission string) string {
+	for _, grant := range grants {
+		if models.Permissions([]string{grant}).HasPermission(permission) {
+			return grant
+		}
+	}
+	return ""
+}
+
+// checkDirectGrants reports permissions granted to the user individually.
+// They are recorded in user_permissions but authorization only consults
+// the role, so a matching direct grant does not allow anything.
+func (s *PermissionSimulator) checkDirectGrants(ctx context.Context, d *PermissionDecision, user *simulatedUser, action string) error {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT p.name FROM user_permissions up JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = ?`, user.id)
+	if err != nil {
+		return fmt.Errorf("failed to load direct permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var grants models.Permissions
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan direct permission: %w", err)
+		}
+		grants = append(grants, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if grant := matchingGrant(grants, action); grant != "" {
+		d.step("direct_grants", PermissionStepInfo, fmt.Sprintf(
+			"%s is granted %q directly, but direct grants are not enforced; add it to role %s instead",
+			user.username, grant, user.role.String))
+	}
+	return nil
+}
+
+// checkResource resolves the target, if any, and applies the read-only
+// lockdown of its storage root to write actions.
+func (s *PermissionSimulator) checkResource(ctx context.Context, d *PermissionDecision, check *PermissionCheck, action string) error {
+	root, filePath := check.StorageRoot, strings.TrimPrefix(check.Path, "/")
+	var deleted bool
+
+	switch {
+	case check.FileID != 0:
+		err := s.db.QueryRowContext(ctx,
+			`SELECT sr.name, f.path, f.deleted FROM files f JOIN storage_roots sr ON sr.id = f.storage_root_id
+			 WHERE f.id = ?`, check.FileID).Scan(&root, &filePath, &deleted)
+		if err == sql.ErrNoRows {
+			d.step("resource", PermissionStepDeny, fmt.Sprintf("file %d does not exist", check.FileID))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load file %d: %w", check.FileID, err)
+		}
+		filePath = strings.TrimPrefix(filePath, "/")
+	case root != "":
+		var rootID int64
+		err := s.db.QueryRowContext(ctx, `SELECT id FROM storage_roots WHERE name = ?`, root).Scan(&rootID)
+		if err == sql.ErrNoRows {
+			d.step("resource", PermissionStepDeny, fmt.Sprintf("storage root %s does not exist", root))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load storage root %s: %w", root, err)
+		}
+		if filePath != "" {
+			err = s.db.QueryRowContext(ctx,
+				`SELECT deleted FROM files WHERE storage_root_id = ? AND (path = ? OR path = ?)`,
+				rootID, filePath, "/"+filePath).Scan(&deleted)
+			if err == sql.ErrNoRows {
+				d.step("resource", PermissionStepInfo, fmt.Sprintf("%s is not in the catalog of %s", filePath, root))
+				filePath = ""
+			} else if err != nil {
+				return fmt.Errorf("failed to load %s: %w", filePath, err)
+			}
+		}
+	default:
+		return nil
+	}
+
+	d.StorageRoot = root
+	d.Path = check.Path
+	if filePath != "" {
+		d.Path = filePath
+		if deleted {
+			d.step("resource", PermissionStepDeny, fmt.Sprintf("%s on %s has been deleted", filePath, root))
+		} else {
+			d.step("resource", PermissionStepAllow, fmt.Sprintf("%s on %s exists", filePath, root))
+		}
+	}
+
+	if s.lockdowns == nil {
+		return nil
+	}
+	switch {
+	case !s.lockdowns.IsLocked(root):
+		d.step("lockdown", PermissionStepAllow, fmt.Sprintf("storage root %s is not in lockdown", root))
+	case containsString(lockdownBlockedActions, action):
+		d.step("lockdown", PermissionStepDeny, fmt.Sprintf(
+			"storage root %s is in read-only lockdown; release it under /api/v1/admin/lockdowns", root))
+	default:
+		d.step("lockdown", PermissionStepInfo, fmt.Sprintf(
+			"storage root %s is in read-only lockdown, which does not affect %s", root, action))
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPermissionSimulatorFixture(t *testing.T) *PermissionSimulator {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE roles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			permissions TEXT DEFAULT '[]'
+		);
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			role_id INTEGER NOT NULL,
+			is_active INTEGER DEFAULT 1,
+			is_locked INTEGER DEFAULT 0,
+			locked_until DATETIME
+		);
+		CREATE TABLE permissions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			resource TEXT NOT NULL,
+			action TEXT NOT NULL
+		);
+		CREATE TABLE user_permissions (
+			user_id INTEGER NOT NULL,
+			permission_id INTEGER NOT NULL,
+			PRIMARY KEY (user_id, permission_id)
+		);
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			deleted BOOLEAN DEFAULT 0
+		);
+		INSERT INTO roles (id, name, permissions) VALUES
+			(1, 'admin', '["*"]'),
+			(2, 'viewer', '["media.view", "media.manage"]'),
+			(3, 'editor', '["media.*"]');
+		INSERT INTO users (id, username, role_id, is_active, is_locked) VALUES
+			(1, 'root', 1, 1, 0),
+			(2, 'alice', 2, 1, 0),
+			(3, 'bob', 3, 1, 0),
+			(4, 'carol', 3, 0, 0),
+			(5, 'dave', 9, 1, 0);
+		INSERT INTO permissions (id, name, resource, action) VALUES (1, 'media.download', 'media', 'download');
+		INSERT INTO user_permissions (user_id, permission_id) VALUES (2, 1);
+		INSERT INTO storage_roots (id, name) VALUES (1, 'nas'), (2, 'archive');
+		INSERT INTO files (id, storage_root_id, path, deleted) VALUES
+			(1, 1, '/films/a.mkv', 0),
+			(2, 2, 'old/b.mkv', 1);`)
+	require.NoError(t, err)
+
+	s := NewPermissionSimulator(database.WrapDB(sqlDB, database.DialectSQLite))
+	s.SetLockdownChecker(stubLockdowns{"archive": true})
+	return s
+}
+
+func traceResults(d *PermissionDecision) map[string]string {
+	results := map[string]string{}
+	for _, step := range d.Trace {
+		results[step.Check] = step.Result
+	}
+	return results
+}
+
+func TestPermissionSimulator_RoleGrants(t *testing.T) {
+	s := newPermissionSimulatorFixture(t)
+	ctx := context.Background()
+
+	d, err := s.Simulate(ctx, &PermissionCheck{Username: "root", Action: "system.admin"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, "admin", d.Role)
+	assert.Contains(t, d.Trace[1].Detail, `"*"`)
+
+	d, err = s.Simulate(ctx, &PermissionCheck{UserID: 3, Action: "media.delete"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Contains(t, d.Trace[1].Detail, `"media.*"`)
+
+	// media.manage does not imply media.download and the direct grant is
+	// not enforced; both are spelled out
+	d, err = s.Simulate(ctx, &PermissionCheck{Username: "alice", Action: "media.download"})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Contains(t, d.Reason, "does not grant media.download")
+	assert.Contains(t, d.Reason, "media.manage")
+	assert.Equal(t, map[string]string{"account": "allow", "role": "deny", "direct_grants": "info"}, traceResults(d))
+}
+
+func TestPermissionSimulator_Account(t *testing.T) {
+	s := newPermissionSimulatorFixture(t)
+	ctx := context.Background()
+
+	d, err := s.Simulate(ctx, &PermissionCheck{Username: "carol", Action: "media.view"})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Contains(t, d.Reason, "deactivated")
+	// Evaluation continues past the first denial
+	assert.Equal(t, "allow", traceResults(d)["role"])
+
+	d, err = s.Simulate(ctx, &PermissionCheck{Username: "dave", Action: "media.view"})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Contains(t, d.Reason, "role 9")
+
+	_, err = s.Simulate(ctx, &PermissionCheck{Username: "nobody", Action: "media.view"})
+	assert.ErrorContains(t, err, "not found")
+	_, err = s.Simulate(ctx, &PermissionCheck{Username: "root"})
+	assert.ErrorContains(t, err, "invalid permission check")
+}
+
+func TestPermissionSimulator_LockedAccountExpires(t *testing.T) {
+	s := newPermissionSimulatorFixture(t)
+	now := time.Now()
+	_, err := s.db.ExecContext(context.Background(), `UPDATE users SET is_locked = 1, locked_until = ? WHERE id = 3`, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	d, err := s.Simulate(context.Background(), &PermissionCheck{UserID: 3, Action: "media.view"})
+	require.NoError(t, err)
+	assert.Contains(t, d.Reason, "locked until")
+
+	s.now = func() time.Time { return now.Add(2 * time.Hour) }
+	d, err = s.Simulate(context.Background(), &PermissionCheck{UserID: 3, Action: "media.view"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+}
+
+func TestPermissionSimulator_Resources(t *testing.T) {
+	s := newPermissionSimulatorFixture(t)
+	ctx := context.Background()
+
+	d, err := s.Simulate(ctx, &PermissionCheck{Username: "bob", Action: "media.edit", StorageRoot: "nas", Path: "films/a.mkv"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, "films/a.mkv", d.Path)
+	assert.Equal(t, map[string]string{"account": "allow", "role": "allow", "resource": "allow", "lockdown": "allow"}, traceResults(d))
+
+	// Writes are refused on a root in lockdown, reads are not
+	d, err = s.Simulate(ctx, &PermissionCheck{Username: "bob", Action: "media.upload", StorageRoot: "archive", Path: "new.mkv"})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Contains(t, d.Reason, "read-only lockdown")
+
+	d, err = s.Simulate(ctx, &PermissionCheck{Username: "bob", Action: "media.view", StorageRoot: "archive"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, "info", traceResults(d)["lockdown"])
+
+	d, err = s.Simulate(ctx, &PermissionCheck{Username: "bob", Action: "media.view", FileID: 2})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, "archive", d.StorageRoot)
+	assert.Contains(t, d.Reason, "deleted")
+
+	d, err = s.Simulate(ctx, &PermissionCheck{Username: "bob", Action: "media.view", StorageRoot: "missing"})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Contains(t, d.Reason, "does not exist")
+
+	_, err = s.Simulate(ctx, &PermissionCheck{Username: "bob", Action: "media.view", Path: "a.mkv"})
+	assert.ErrorContains(t, err, "requires storage_root")
+}
@@ -0,0 +1,574 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/internal/metrics"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reasons a file was prefetched.
+const (
+	PrefetchReasonNextEpisode  = "next_episode"
+	PrefetchReasonNextTrack    = "next_track"
+	PrefetchReasonPlaylistNext = "playlist_next"
+)
+
+// prefetchMetricsLabel is the cache_type label of the shared cache metrics.
+const prefetchMetricsLabel = "prefetch"
+
+// PrefetchConfig configures the local prefetch cache.
+type PrefetchConfig struct {
+	// CacheDir is the local directory holding prefetched copies.
+	CacheDir string
+	// MaxBytes is the cache budget; least recently used entries are evicted
+	// to stay below it.
+	MaxBytes int64
+	// Lookahead is how many upcoming episodes or tracks are prefetched.
+	Lookahead int
+	// Roots limits prefetching to these storage roots. When empty, every
+	// root except local ones is prefetched from.
+	Roots []string
+	// QueueSize bounds the number of pending prefetches; further requests
+	// are dropped until the queue drains.
+	QueueSize int
+}
+
+// PrefetchEntry is a file held in the prefetch cache.
+type PrefetchEntry struct {
+	FileID         int64     `json:"file_id"`
+	Size           int64     `json:"size"`
+	Reason         string    `json:"reason"`
+	Hits           int       `json:"hits"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastAccessedAt time.Time `json:"last_accessed_at"`
+	cachedPath     string
+}
+
+// PrefetchStats summarises cache usage since the service started.
+type PrefetchStats struct {
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRate     float64 `json:"hit_rate"`
+	Prefetched  int64   `json:"prefetched"`
+	Failed      int64   `json:"failed"`
+	Dropped     int64   `json:"dropped"`
+	Evicted     int64   `json:"evicted"`
+	Entries     int     `json:"entries"`
+	UsedBytes   int64   `json:"used_bytes"`
+	BudgetBytes int64   `json:"budget_bytes"`
+}
+
+type prefetchRequest struct {
+	fileID int64
+	reason string
+}
+
+// PrefetchService copies the content a user is likely to open next, such as
+// the following episodes of a series or the next tracks of an album or
+// playlist, from remote storage roots into a local cache directory.
+type PrefetchService struct {
+	db      *database.DB
+	logger  *zap.Logger
+	config  PrefetchConfig
+	clients storageClientProvider
+	queue   chan prefetchRequest
+	mu      sync.Mutex
+	pending map[int64]bool
+	fillMu  sync.Mutex
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	now     func() time.Time
+
+	hits, misses, prefetched, failed, dropped, evicted atomic.Int64
+}
+
+// NewPrefetchService creates a PrefetchService that reads remote files
+// through clients.
+func NewPrefetchService(db *database.DB, logger *zap.Logger, clients storageClientProvider, cfg PrefetchConfig) *PrefetchService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = filepath.Join(".", "data", "prefetch")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 20 << 30
+	}
+	if cfg.Lookahead <= 0 {
+		cfg.Lookahead = 2
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 64
+	}
+	return &PrefetchService{
+		db:      db,
+		logger:  logger,
+		config:  cfg,
+		clients: clients,
+		queue:   make(chan prefetchRequest, cfg.QueueSize),
+		pending: make(map[int64]bool),
+		now:     time.Now,
+	}
+}
+
+// CachedFile returns the local copy of a file when it is cached and still
+// matches the catalog. Every call counts as a cache hit or miss.
+func (s *PrefetchService) CachedFile(ctx context.Context, fileID int64) (string, bool, error) {
+	var cachedPath string
+	var cachedSize, sourceSize, currentSize int64
+	var sourceModified, currentModified sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT p.cached_path, p.size, p.source_size, p.source_modified_at, f.size, f.modified_at
+		 FROM prefetch_cache_entries p JOIN files f ON f.id = p.file_id
+		 WHERE p.file_id = ? AND f.deleted = ?`, fileID, false).Scan(
+		&cachedPath, &cachedSize, &sourceSize, &sourceModified, &currentSize, &currentModified)
+	if err == sql.ErrNoRows {
+		s.recordMiss()
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up prefetch cache: %w", err)
+	}
+
+	stale := sourceSize != currentSize ||
+		(sourceModified.Valid && currentModified.Valid && !sourceModified.Time.Equal(currentModified.Time))
+	if !stale {
+		if info, statErr := os.Stat(cachedPath); statErr != nil || info.Size() != cachedSize {
+			stale = true
+		}
+	}
+	if stale {
+		if err := s.Evict(ctx, fileID); err != nil {
+			s.logger.Warn("Failed to drop stale prefetch entry", zap.Int64("file_id", fileID), zap.Error(err))
+		}
+		s.recordMiss()
+		return "", false, nil
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE prefetch_cache_entries SET hits = hits + 1, last_accessed_at = ? WHERE file_id = ?`,
+		s.now(), fileID); err != nil {
+		return "", false, fmt.Errorf("failed to update prefetch cache entry: %w", err)
+	}
+	s.hits.Add(1)
+	metrics.RecordCacheHit(prefetchMetricsLabel)
+	return cachedPath, true, nil
+}
+
+func (s *PrefetchService) recordMiss() {
+	s.misses.Add(1)
+	metrics.RecordCacheMiss(prefetchMetricsLabel)
+}
+
+// Predict returns the files likely to be opened after fileID and why. When playlistID is non-zero the playlist order is used;
+// otherwise the following episodes or tracks of the same parent item are.
+func (s *PrefetchService) Predict(ctx context.Context, fileID, playlistID int64) ([]int64, string, error) {
+	var itemID int64
+	var parentID, season, episode, track sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT mi.id, mi.parent_id, mi.season_number, mi.episode_number, mi.track_number
+		 FROM media_files mf JOIN media_items mi ON mi.id = mf.media_item_id
+		 WHERE mf.file_id = ? ORDER BY mf.is_primary DESC LIMIT 1`, fileID).Scan(
+		&itemID, &parentID, &season, &episode, &track)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to look up media item: %w", err)
+	}
+
+	var query, reason string
+	var args []interface{}
+	switch {
+	case playlistID > 0:
+		reason = PrefetchReasonPlaylistNext
+		query = `SELECT pi.media_item_id FROM playlist_items pi
+			WHERE pi.playlist_id = ? AND pi.position > (
+				SELECT MIN(position) FROM playlist_items WHERE playlist_id = ? AND media_item_id = ?)
+			ORDER BY pi.position LIMIT ?`
+		args = []interface{}{playlistID, playlistID, itemID, s.config.Lookahead}
+	case parentID.Valid && episode.Valid:
+		reason = PrefetchReasonNextEpisode
+		seasonNumber := season.Int64
+		query = `SELECT id FROM media_items
+			WHERE parent_id = ? AND episode_number IS NOT NULL
+			  AND (COALESCE(season_number, 0) > ? OR (COALESCE(season_number, 0) = ? AND episode_number > ?))
+			ORDER BY COALESCE(season_number, 0), episode_number LIMIT ?`
+		args = []interface{}{parentID.Int64, seasonNumber, seasonNumber, episode.Int64, s.config.Lookahead}
+	case parentID.Valid && track.Valid:
+		reason = PrefetchReasonNextTrack
+		query = `SELECT id FROM media_items
+			WHERE parent_id = ? AND track_number > ?
+			ORDER BY track_number LIMIT ?`
+		args = []interface{}{parentID.Int64, track.Int64, s.config.Lookahead}
+	default:
+		return nil, "", nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find upcoming media items: %w", err)
+	}
+	var itemIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, "", fmt.Errorf("failed to scan upcoming media item: %w", err)
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var fileIDs []int64
+	for _, id := range itemIDs {
+		var next int64
+		err := s.db.QueryRowContext(ctx,
+			`SELECT mf.file_id FROM media_files mf JOIN files f ON f.id = mf.file_id
+			 WHERE mf.media_item_id = ? AND f.deleted = ? AND f.is_directory = ?
+			 ORDER BY mf.is_primary DESC, mf.id LIMIT 1`, id, false, false).Scan(&next)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to look up media file: %w", err)
+		}
+		fileIDs = append(fileIDs, next)
+	}
+	return fileIDs, reason, nil
+}
+
+// Prefetch queues the files predicted to follow fileID. It never blocks;
+// requests that do not fit in the queue are dropped.
+func (s *PrefetchService) Prefetch(ctx context.Context, fileID, playlistID int64) {
+	fileIDs, reason, err := s.Predict(ctx, fileID, playlistID)
+	if err != nil {
+		s.logger.Debug("Failed to predict next files", zap.Int64("file_id", fileID), zap.Error(err))
+		return
+	}
+	for _, id := range fileIDs {
+		s.mu.Lock()
+		if s.pending[id] {
+			s.mu.Unlock()
+			continue
+		}
+		s.pending[id] = true
+		s.mu.Unlock()
+
+		select {
+		case s.queue <- prefetchRequest{fileID: id, reason: reason}:
+		default:
+			s.done(id)
+			s.dropped.Add(1)
+		}
+	}
+}
+
+func (s *PrefetchService) done(fileID int64) {
+	s.mu.Lock()
+	delete(s.pending, fileID)
+	s.mu.Unlock()
+}
+
+func (s *PrefetchService) prefetchable(rootName, protocol string) bool {
+	if len(s.config.Roots) == 0 {
+		return protocol != "local"
+	}
+	for _, name := range s.config.Roots {
+		if name == rootName {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch copies a file into the cache, evicting least recently used entries
+// to make room. Files already cached, outside the configured roots or
+// larger than the whole budget are skipped.
+func (s *PrefetchService) Fetch(ctx context.Context, fileID int64, reason string) error {
+	var exists int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM prefetch_cache_entries WHERE file_id = ?`, fileID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check prefetch cache: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	var rootName, protocol, filePath string
+	var size int64
+	var modified sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sr.name, sr.protocol, f.path, f.size, f.modified_at FROM files f
+		 JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE f.id = ? AND f.deleted = ? AND f.is_directory = ?`, fileID, false, false).Scan(
+		&rootName, &protocol, &filePath, &size, &modified)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("file %d not found", fileID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load file %d: %w", fileID, err)
+	}
+	if !s.prefetchable(rootName, protocol) || size > s.config.MaxBytes {
+		return nil
+	}
+
+	// One fill at a time keeps the budget check and the copy consistent
+	s.fillMu.Lock()
+	defer s.fillMu.Unlock()
+
+	if err := s.makeRoom(ctx, size); err != nil {
+		return err
+	}
+
+	root, err := loadStorageRootByName(ctx, s.db, rootName)
+	if err != nil {
+		return err
+	}
+	client, err := s.clients.NewClient(root)
+	if err != nil {
+		return fmt.Errorf("failed to create client for %s: %w", rootName, err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", rootName, err)
+	}
+	defer client.Disconnect(ctx)
+
+	if err := os.MkdirAll(s.config.CacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create prefetch cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.config.CacheDir, "prefetch_*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	reader, err := client.ReadFile(ctx, filePath)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	written, err := io.Copy(tmp, reader)
+	reader.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s into the cache: %w", filePath, err)
+	}
+	if written != size {
+		return fmt.Errorf("size mismatch after copy: expected %d bytes, got %d", size, written)
+	}
+
+	cachedPath := filepath.Join(s.config.CacheDir, strconv.FormatInt(fileID, 10)+filepath.Ext(filePath))
+	if err := os.Rename(tmp.Name(), cachedPath); err != nil {
+		return fmt.Errorf("failed to store cache file: %w", err)
+	}
+
+	now := s.now()
+	var sourceModified interface{}
+	if modified.Valid {
+		sourceModified = modified.Time
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO prefetch_cache_entries
+		 (file_id, cached_path, size, source_size, source_modified_at, reason, hits, created_at, last_accessed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?)`,
+		fileID, cachedPath, written, size, sourceModified, reason, now, now); err != nil {
+		os.Remove(cachedPath)
+		return fmt.Errorf("failed to record prefetch cache entry: %w", err)
+	}
+
+	s.prefetched.Add(1)
+	s.updateSizeMetric(ctx)
+	s.logger.Debug("Prefetched file", zap.Int64("file_id", fileID), zap.String("reason", reason), zap.Int64("size", written))
+	return nil
+}
+
+// makeRoom evicts least recently used entries until need more bytes fit in
+// the budget.
+func (s *PrefetchService) makeRoom(ctx context.Context, need int64) error {
+	used, err := s.usedBytes(ctx)
+	if err != nil {
+		return err
+	}
+	if used+need <= s.config.MaxBytes {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT file_id, size FROM prefetch_cache_entries ORDER BY last_accessed_at, file_id`)
+	if err != nil {
+		return fmt.Errorf("failed to list prefetch cache entries: %w", err)
+	}
+	var victims []int64
+	for rows.Next() && used+need > s.config.MaxBytes {
+		var id, size int64
+		if err := rows.Scan(&id, &size); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan prefetch cache entry: %w", err)
+		}
+		victims = append(victims, id)
+		used -= size
+	}
+	rows.Close()
+
+	for _, id := range victims {
+		if err := s.Evict(ctx, id); err != nil {
+			return err
+		}
+		s.evicted.Add(1)
+	}
+	return nil
+}
+
+func (s *PrefetchService) usedBytes(ctx context.Context) (int64, error) {
+	var used int64
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(size), 0) FROM prefetch_cache_entries`).Scan(&used); err != nil {
+		return 0, fmt.Errorf("failed to measure prefetch cache: %w", err)
+	}
+	return used, nil
+}
+
+func (s *PrefetchService) updateSizeMetric(ctx context.Context) {
+	if used, err := s.usedBytes(ctx); err == nil {
+		metrics.CacheSize.WithLabelValues(prefetchMetricsLabel).Set(float64(used))
+	}
+}
+
+// Evict removes a file from the cache.
+func (s *PrefetchService) Evict(ctx context.Context, fileID int64) error {
+	var cachedPath string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT cached_path FROM prefetch_cache_entries WHERE file_id = ?`, fileID).Scan(&cachedPath)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("prefetch cache entry %d not found", fileID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load prefetch cache entry: %w", err)
+	}
+
+	if err := os.Remove(cachedPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cache file: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM prefetch_cache_entries WHERE file_id = ?`, fileID); err != nil {
+		return fmt.Errorf("failed to delete prefetch cache entry: %w", err)
+	}
+	s.updateSizeMetric(ctx)
+	return nil
+}
+
+// Clear empties the cache and returns how many entries were removed.
+func (s *PrefetchService) Clear(ctx context.Context) (int, error) {
+	entries, err := s.ListEntries(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err := s.Evict(ctx, entry.FileID); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// ListEntries returns the cached files, most recently used first.
+func (s *PrefetchService) ListEntries(ctx context.Context) ([]PrefetchEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT file_id, cached_path, size, reason, hits, created_at, last_accessed_at
+		 FROM prefetch_cache_entries ORDER BY last_accessed_at DESC, file_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prefetch cache entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []PrefetchEntry
+	for rows.Next() {
+		var e PrefetchEntry
+		if err := rows.Scan(&e.FileID, &e.cachedPath, &e.Size, &e.Reason, &e.Hits, &e.CreatedAt, &e.LastAccessedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan prefetch cache entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Stats returns hit-rate and usage figures for the cache.
+func (s *PrefetchService) Stats(ctx context.Context) (*PrefetchStats, error) {
+	stats := &PrefetchStats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Prefetched:  s.prefetched.Load(),
+		Failed:      s.failed.Load(),
+		Dropped:     s.dropped.Load(),
+		Evicted:     s.evicted.Load(),
+		BudgetBytes: s.config.MaxBytes,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM prefetch_cache_entries`).Scan(
+		&stats.Entries, &stats.UsedBytes); err != nil {
+		return nil, fmt.Errorf("failed to measure prefetch cache: %w", err)
+	}
+	return stats, nil
+}
+
+// Start processes queued prefetches until Stop is called.
+func (s *PrefetchService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case req := <-s.queue:
+				if err := s.Fetch(context.Background(), req.fileID, req.reason); err != nil {
+					s.failed.Add(1)
+					s.logger.Warn("Prefetch failed", zap.Int64("file_id", req.fileID), zap.Error(err))
+				}
+				s.done(req.fileID)
+			}
+		}
+	}()
+}
+
+// Stop ends queue processing and waits for the current copy to finish.
+func (s *PrefetchService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
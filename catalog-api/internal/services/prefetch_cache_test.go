@@ -0,0 +1,246 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type prefetchFixture struct {
+	db        *database.DB
+	svc       *PrefetchService
+	remoteDir string
+	cacheDir  string
+}
+
+func newPrefetchFixture(t *testing.T, maxBytes int64) *prefetchFixture {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			modified_at DATETIME NOT NULL,
+			deleted BOOLEAN DEFAULT 0
+		);
+		CREATE TABLE media_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL,
+			parent_id INTEGER,
+			season_number INTEGER,
+			episode_number INTEGER,
+			track_number INTEGER
+		);
+		CREATE TABLE media_files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_item_id INTEGER NOT NULL,
+			file_id INTEGER NOT NULL,
+			is_primary INTEGER DEFAULT 0
+		);
+		CREATE TABLE playlist_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			playlist_id INTEGER NOT NULL,
+			media_item_id INTEGER NOT NULL,
+			position INTEGER NOT NULL
+		);
+		CREATE TABLE prefetch_cache_entries (
+			file_id INTEGER PRIMARY KEY,
+			cached_path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			source_size INTEGER NOT NULL DEFAULT 0,
+			source_modified_at DATETIME,
+			reason TEXT NOT NULL DEFAULT '',
+			hits INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME,
+			last_accessed_at DATETIME
+		);`)
+	require.NoError(t, err)
+
+	f := &prefetchFixture{
+		db:        database.WrapDB(sqlDB, database.DialectSQLite),
+		remoteDir: t.TempDir(),
+		cacheDir:  t.TempDir(),
+	}
+	_, err = f.db.ExecContext(context.Background(),
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('main-nas', 'local', ?)`, f.remoteDir)
+	require.NoError(t, err)
+
+	f.svc = NewPrefetchService(f.db, zap.NewNop(), localRootClients{}, PrefetchConfig{
+		CacheDir: f.cacheDir,
+		MaxBytes: maxBytes,
+		Roots:    []string{"main-nas"},
+	})
+	return f
+}
+
+// addMedia catalogues a file on the remote root and links it to a new media item.
+func (f *prefetchFixture) addMedia(t *testing.T, title string, parentID, season, episode, track interface{}) (int64, int64) {
+	t.Helper()
+	ctx := context.Background()
+	rel := title + ".mkv"
+	content := "content of " + title
+	require.NoError(t, os.WriteFile(filepath.Join(f.remoteDir, rel), []byte(content), 0644))
+
+	fileID, err := f.db.InsertReturningID(ctx,
+		`INSERT INTO files (storage_root_id, path, name, size, modified_at) VALUES (1, ?, ?, ?, ?)`,
+		rel, rel, len(content), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	itemID, err := f.db.InsertReturningID(ctx,
+		`INSERT INTO media_items (title, parent_id, season_number, episode_number, track_number) VALUES (?, ?, ?, ?, ?)`,
+		title, parentID, season, episode, track)
+	require.NoError(t, err)
+	_, err = f.db.ExecContext(ctx, `INSERT INTO media_files (media_item_id, file_id, is_primary) VALUES (?, ?, 1)`, itemID, fileID)
+	require.NoError(t, err)
+	return fileID, itemID
+}
+
+func TestPrefetchService_PredictNextEpisodes(t *testing.T) {
+	f := newPrefetchFixture(t, 0)
+	ctx := context.Background()
+
+	show, err := f.db.InsertReturningID(ctx, `INSERT INTO media_items (title) VALUES ('Show')`)
+	require.NoError(t, err)
+	s1e2, _ := f.addMedia(t, "s1e2", show, 1, 2, nil)
+	s1e1, _ := f.addMedia(t, "s1e1", show, 1, 1, nil)
+	s2e1, _ := f.addMedia(t, "s2e1", show, 2, 1, nil)
+	f.addMedia(t, "s2e2", show, 2, 2, nil)
+
+	next, reason, err := f.svc.Predict(ctx, s1e1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, PrefetchReasonNextEpisode, reason)
+	assert.Equal(t, []int64{s1e2, s2e1}, next, "lookahead crosses into the next season in order")
+}
+
+func TestPrefetchService_PredictTracksAndPlaylist(t *testing.T) {
+	f := newPrefetchFixture(t, 0)
+	ctx := context.Background()
+
+	album, err := f.db.InsertReturningID(ctx, `INSERT INTO media_items (title) VALUES ('Album')`)
+	require.NoError(t, err)
+	t1, item1 := f.addMedia(t, "track1", album, nil, nil, 1)
+	t2, item2 := f.addMedia(t, "track2", album, nil, nil, 2)
+	t3, item3 := f.addMedia(t, "track3", album, nil, nil, 3)
+
+	next, reason, err := f.svc.Predict(ctx, t1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, PrefetchReasonNextTrack, reason)
+	assert.Equal(t, []int64{t2, t3}, next)
+
+	// A playlist that plays the album backwards overrides album order
+	_, err = f.db.ExecContext(ctx,
+		`INSERT INTO playlist_items (playlist_id, media_item_id, position) VALUES (7, ?, 1), (7, ?, 2), (7, ?, 3)`,
+		item3, item2, item1)
+	require.NoError(t, err)
+	next, reason, err = f.svc.Predict(ctx, t3, 7)
+	require.NoError(t, err)
+	assert.Equal(t, PrefetchReasonPlaylistNext, reason)
+	assert.Equal(t, []int64{t2, t1}, next)
+
+	next, _, err = f.svc.Predict(ctx, 9999, 0)
+	require.NoError(t, err)
+	assert.Empty(t, next, "files without media items predict nothing")
+}
+
+func TestPrefetchService_FetchServesHitsAndDropsStaleCopies(t *testing.T) {
+	f := newPrefetchFixture(t, 0)
+	ctx := context.Background()
+	fileID, _ := f.addMedia(t, "movie", nil, nil, nil, nil)
+
+	_, ok, err := f.svc.CachedFile(ctx, fileID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, f.svc.Fetch(ctx, fileID, PrefetchReasonNextEpisode))
+	cached, ok, err := f.svc.CachedFile(ctx, fileID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	data, err := os.ReadFile(cached)
+	require.NoError(t, err)
+	assert.Equal(t, "content of movie", string(data))
+
+	stats, err := f.svc.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.InDelta(t, 0.5, stats.HitRate, 0.001)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, int64(len(data)), stats.UsedBytes)
+
+	// The original changes on the NAS: the cached copy must not be served
+	_, err = f.db.ExecContext(ctx, `UPDATE files SET size = size + 1 WHERE id = ?`, fileID)
+	require.NoError(t, err)
+	_, ok, err = f.svc.CachedFile(ctx, fileID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, err = os.Stat(cached)
+	assert.True(t, os.IsNotExist(err), "stale copy is removed")
+}
+
+func TestPrefetchService_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Every file is 16 bytes ("content of fileN"), so two fit in the budget
+	f := newPrefetchFixture(t, 40)
+	ctx := context.Background()
+	first, _ := f.addMedia(t, "file1", nil, nil, nil, nil)
+	second, _ := f.addMedia(t, "file2", nil, nil, nil, nil)
+	third, _ := f.addMedia(t, "file3", nil, nil, nil, nil)
+
+	clock := time.Now()
+	f.svc.now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	require.NoError(t, f.svc.Fetch(ctx, first, PrefetchReasonNextTrack))
+	require.NoError(t, f.svc.Fetch(ctx, second, PrefetchReasonNextTrack))
+	_, ok, err := f.svc.CachedFile(ctx, first)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, f.svc.Fetch(ctx, third, PrefetchReasonNextTrack))
+
+	entries, err := f.svc.ListEntries(ctx)
+	require.NoError(t, err)
+	var ids []int64
+	for _, e := range entries {
+		ids = append(ids, e.FileID)
+	}
+	assert.ElementsMatch(t, []int64{first, third}, ids, "the least recently used file is evicted")
+
+	stats, err := f.svc.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Evicted)
+	assert.LessOrEqual(t, stats.UsedBytes, stats.BudgetBytes)
+}
+
+func TestPrefetchService_SkipsRootsOutsideConfig(t *testing.T) {
+	f := newPrefetchFixture(t, 0)
+	ctx := context.Background()
+	fileID, _ := f.addMedia(t, "local", nil, nil, nil, nil)
+	f.svc.config.Roots = []string{"other-nas"}
+
+	require.NoError(t, f.svc.Fetch(ctx, fileID, PrefetchReasonNextEpisode))
+	entries, err := f.svc.ListEntries(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
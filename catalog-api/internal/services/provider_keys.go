@@ -0,0 +1,368 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultProviderRetryAfter is how long a key rests after a 429 response
+// that does not say when to retry.
+const defaultProviderRetryAfter = time.Minute
+
+// ProviderRateLimitedError is returned for a provider request refused
+// with 429 Too Many Requests. RetryAfter is from the response's
+// Retry-After header, or zero without one.
+type ProviderRateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ProviderRateLimitedError) Error() string {
+	return fmt.Sprintf("provider rate limit exceeded (status %d)", http.StatusTooManyRequests)
+}
+
+// providerRateLimited returns the error for a 429 response.
+func providerRateLimited(resp *http.Response) error {
+	err := &ProviderRateLimitedError{}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	} else if at, parseErr := http.ParseTime(resp.Header.Get("Retry-After")); parseErr == nil {
+		err.RetryAfter = time.Until(at)
+	}
+	return err
+}
+
+// ProviderKeyUsage is one API key's use today. The key is identified by
+// a fingerprint and its last characters, never shown whole.
+type ProviderKeyUsage struct {
+	ID               string     `json:"id"`
+	Hint             string     `json:"hint"`
+	Requests         int        `json:"requests_today"`
+	RateLimited      int        `json:"rate_limited_today"`
+	Remaining        *int       `json:"remaining,omitempty"`
+	CoolingDownUntil *time.Time `json:"cooling_down_until,omitempty"`
+}
+
+// ProviderKeyStatus is a provider's keys and how much of their daily
+// quota is left. Remaining is across all keys, and absent without a
+// quota. NextAvailableAt is set while no key can be used.
+type ProviderKeyStatus struct {
+	Provider        string             `json:"provider"`
+	DailyQuota      int                `json:"daily_quota"`
+	Remaining       *int               `json:"remaining,omitempty"`
+	Available       bool               `json:"available"`
+	NextAvailableAt *time.Time         `json:"next_available_at,omitempty"`
+	QuotaResetsAt   time.Time          `json:"quota_resets_at"`
+	Keys            []ProviderKeyUsage `json:"keys"`
+}
+
+// providerKey is an API key and its use on day.
+type providerKey struct {
+	id          string
+	secret      string
+	day         string
+	requests    int
+	rateLimited int
+	coolUntil   time.Time
+}
+
+type providerKeyRing struct {
+	quota int
+	keys  []*providerKey
+	next  int
+}
+
+// ProviderKeyPool hands out the API keys of external metadata and
+// subtitle providers in turn. A key the provider answers with 429 rests
+// for the Retry-After the provider asks for and the request is retried
+// with the next one; a key that reached its daily quota rests until the
+// next UTC day. Each key's requests per day are recorded, so quotas hold
+// across restarts and admins can see what is left.
+type ProviderKeyPool struct {
+	db     *database.DB
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	rings map[string]*providerKeyRing
+}
+
+// NewProviderKeyPool creates an empty ProviderKeyPool.
+func NewProviderKeyPool(db *database.DB, logger *zap.Logger) *ProviderKeyPool {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ProviderKeyPool{
+		db:     db,
+		logger: logger,
+		now:    time.Now,
+		rings:  make(map[string]*providerKeyRing),
+	}
+}
+
+// SetKeys sets a provider's API keys, ignoring blanks and repeats, and how
+// many requests each may make per UTC day; 0 leaves them unlimited.
+// Without keys the provider is left out of the pool.
+func (p *ProviderKeyPool) SetKeys(provider string, keys []string, dailyQuota int) {
+	ring := &providerKeyRing{quota: dailyQuota}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		sum := sha256.Sum256([]byte(provider + "\x00" + key))
+		ring.keys = append(ring.keys, &providerKey{id: hex.EncodeToString(sum[:6]), secret: key})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(ring.keys) == 0 {
+		delete(p.rings, provider)
+		return
+	}
+	p.rings[provider] = ring
+}
+
+// HasKeys reports whether a provider has keys in the pool.
+func (p *ProviderKeyPool) HasKeys(provider string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rings[provider] != nil
+}
+
+// Providers returns the providers with keys in the pool, by name.
+func (p *ProviderKeyPool) Providers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	providers := make([]string, 0, len(p.rings))
+	for provider := range p.rings {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// Do calls call with the next usable key of provider. When the provider
+// refuses the key with 429, the key rests and call is retried with the
+// next one, until every key has been tried.
+func (p *ProviderKeyPool) Do(ctx context.Context, provider string, call func(key string) error) error {
+	p.mu.Lock()
+	ring := p.rings[provider]
+	p.mu.Unlock()
+	if ring == nil {
+		return fmt.Errorf("%s API key not configured", provider)
+	}
+
+	var err error
+	for attempt := 0; attempt < len(ring.keys); attempt++ {
+		var key *providerKey
+		if key, err = p.acquire(ctx, provider, ring); err != nil {
+			return err
+		}
+		err = call(key.secret)
+		var limited *ProviderRateLimitedError
+		if !errors.As(err, &limited) {
+			return err
+		}
+		p.rest(ctx, provider, key, limited.RetryAfter)
+	}
+	return err
+}
+
+// acquire takes the next key of ring that is neither resting nor out of
+// quota, and counts a request against it.
+func (p *ProviderKeyPool) acquire(ctx context.Context, provider string, ring *providerKeyRing) (*providerKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for i := range ring.keys {
+		key := ring.keys[(ring.next+i)%len(ring.keys)]
+		p.loadDay(ctx, provider, key, now)
+		if now.Before(key.coolUntil) || (ring.quota > 0 && key.requests >= ring.quota) {
+			continue
+		}
+		ring.next = (ring.next + i + 1) % len(ring.keys)
+		key.requests++
+		p.record(ctx, provider, key, 1, 0, now)
+		return key, nil
+	}
+	next, _ := p.nextAvailableLocked(ring, now)
+	return nil, fmt.Errorf("no %s API key available until %s: rate limited or daily quota used up",
+		provider, next.UTC().Format(time.RFC3339))
+}
+
+// rest keeps a key out of use for retryAfter after a 429 response.
+func (p *ProviderKeyPool) rest(ctx context.Context, provider string, key *providerKey, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = defaultProviderRetryAfter
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	key.coolUntil = now.Add(retryAfter)
+	key.rateLimited++
+	p.record(ctx, provider, key, 0, 1, now)
+	p.logger.Info("Provider API key rate limited", zap.String("provider", provider),
+		zap.String("key_id", key.id), zap.Duration("retry_after", retryAfter))
+}
+
+// providerKeyDay returns the UTC day quotas are counted on.
+func providerKeyDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// loadDay reads a key's counts for the day of now, once per day.
+func (p *ProviderKeyPool) loadDay(ctx context.Context, provider string, key *providerKey, now time.Time) {
+	day := providerKeyDay(now)
+	if key.day == day {
+		return
+	}
+	key.day, key.requests, key.rateLimited = day, 0, 0
+	err := p.db.QueryRowContext(ctx,
+		`SELECT requests, rate_limited FROM provider_key_usage WHERE provider = ? AND key_id = ? AND day = ?`,
+		provider, key.id, day).Scan(&key.requests, &key.rateLimited)
+	if err != nil && err != sql.ErrNoRows {
+		p.logger.Warn("Failed to read provider key usage", zap.String("provider", provider), zap.Error(err))
+	}
+}
+
+// record adds to a key's counts for its day.
+func (p *ProviderKeyPool) record(ctx context.Context, provider string, key *providerKey, requests, rateLimited int, now time.Time) {
+	result, err := p.db.ExecContext(ctx,
+		`UPDATE provider_key_usage SET requests = requests + ?, rate_limited = rate_limited + ?, last_used_at = ?
+		 WHERE provider = ? AND key_id = ? AND day = ?`,
+		requests, rateLimited, now, provider, key.id, key.day)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			_, err = p.db.ExecContext(ctx,
+				`INSERT INTO provider_key_usage (provider, key_id, day, requests, rate_limited, last_used_at)
+				 VALUES (?, ?, ?, ?, ?, ?)`,
+				provider, key.id, key.day, requests, rateLimited, now)
+		}
+	}
+	if err != nil {
+		p.logger.Warn("Failed to record provider key usage", zap.String("provider", provider), zap.Error(err))
+	}
+}
+
+// nextAvailableLocked returns when a key of ring can next be used, and
+// whether one can be now.
+func (p *ProviderKeyPool) nextAvailableLocked(ring *providerKeyRing, now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, key := range ring.keys {
+		at := now
+		if ring.quota > 0 && key.day == providerKeyDay(now) && key.requests >= ring.quota {
+			at = nextProviderQuotaReset(now)
+		}
+		if key.coolUntil.After(at) {
+			at = key.coolUntil
+		}
+		if !at.After(now) {
+			return now, true
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next, false
+}
+
+// nextProviderQuotaReset returns the start of the next UTC day.
+func nextProviderQuotaReset(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// Available reports whether a provider has a key usable now, and when
+// not, when it will. Providers without keys in the pool are always
+// available.
+func (p *ProviderKeyPool) Available(ctx context.Context, provider string) (bool, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ring := p.rings[provider]
+	now := p.now()
+	if ring == nil {
+		return true, now
+	}
+	for _, key := range ring.keys {
+		p.loadDay(ctx, provider, key, now)
+	}
+	next, ok := p.nextAvailableLocked(ring, now)
+	return ok, next
+}
+
+// Status returns each provider's keys, their use today and the quota
+// left.
+func (p *ProviderKeyPool) Status(ctx context.Context) []ProviderKeyStatus {
+	providers := p.Providers()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	statuses := make([]ProviderKeyStatus, 0, len(providers))
+	for _, provider := range providers {
+		ring := p.rings[provider]
+		status := ProviderKeyStatus{
+			Provider:      provider,
+			DailyQuota:    ring.quota,
+			QuotaResetsAt: nextProviderQuotaReset(now),
+			Keys:          []ProviderKeyUsage{},
+		}
+		total := 0
+		for _, key := range ring.keys {
+			p.loadDay(ctx, provider, key, now)
+			usage := ProviderKeyUsage{
+				ID:          key.id,
+				Hint:        providerKeyHint(key.secret),
+				Requests:    key.requests,
+				RateLimited: key.rateLimited,
+			}
+			if ring.quota > 0 {
+				remaining := ring.quota - key.requests
+				if remaining < 0 {
+					remaining = 0
+				}
+				usage.Remaining = &remaining
+				total += remaining
+			}
+			if key.coolUntil.After(now) {
+				until := key.coolUntil
+				usage.CoolingDownUntil = &until
+			}
+			status.Keys = append(status.Keys, usage)
+		}
+		if ring.quota > 0 {
+			status.Remaining = &total
+		}
+		next, ok := p.nextAvailableLocked(ring, now)
+		status.Available = ok
+		if !ok {
+			status.NextAvailableAt = &next
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// providerKeyHint returns the last four characters of a key, enough to
+// tell keys apart.
+func providerKeyHint(key string) string {
+	if len(key) <= 8 {
+		return "…"
+	}
+	return "…" + key[len(key)-4:]
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestProviderKeyPool_RotatesOnRateLimit(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	var mu sync.Mutex
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("api_key")
+		mu.Lock()
+		used = append(used, key)
+		mu.Unlock()
+		if key == "tmdb-key-0001" {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"results":[]}`)
+	}))
+	defer server.Close()
+
+	pool := NewProviderKeyPool(db, zap.NewNop())
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	pool.now = func() time.Time { return now }
+	pool.SetKeys(MetadataProviderTMDB, []string{"tmdb-key-0001", " tmdb-key-0002 ", "", "tmdb-key-0001"}, 0)
+	tmdb := NewTMDBMetadataClient(server.URL, "", nil)
+	tmdb.SetKeyPool(pool)
+
+	for i := 0; i < 2; i++ {
+		_, err := tmdb.Search(ctx, MetadataQuery{MediaType: "movie", Title: "Solaris"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"tmdb-key-0001", "tmdb-key-0002", "tmdb-key-0002"}, used,
+		"a rate limited key is retried with the next and rests for its Retry-After")
+
+	statuses := pool.Status(ctx)
+	require.Len(t, statuses, 1)
+	status := statuses[0]
+	assert.True(t, status.Available)
+	assert.Nil(t, status.Remaining, "keys without a quota have no remaining count")
+	require.Len(t, status.Keys, 2)
+	assert.Equal(t, "…0001", status.Keys[0].Hint)
+	assert.Equal(t, 1, status.Keys[0].Requests)
+	assert.Equal(t, 1, status.Keys[0].RateLimited)
+	require.NotNil(t, status.Keys[0].CoolingDownUntil)
+	assert.Equal(t, now.Add(2*time.Minute), *status.Keys[0].CoolingDownUntil)
+	assert.Equal(t, 2, status.Keys[1].Requests)
+
+	// With every key rate limited the request fails with the limit
+	pool.SetKeys(MetadataProviderTMDB, []string{"tmdb-key-0001"}, 0)
+	now = now.Add(3 * time.Minute)
+	_, err := tmdb.Search(ctx, MetadataQuery{MediaType: "movie", Title: "Solaris"})
+	var limited *ProviderRateLimitedError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, 2*time.Minute, limited.RetryAfter)
+	available, next := pool.Available(ctx, MetadataProviderTMDB)
+	assert.False(t, available)
+	assert.Equal(t, now.Add(2*time.Minute), next)
+
+	err = pool.Do(ctx, "opensubtitles", func(string) error { return nil })
+	assert.ErrorContains(t, err, "opensubtitles API key not configured")
+}
+
+func TestProviderKeyPool_DailyQuota(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC)
+	newPool := func() *ProviderKeyPool {
+		pool := NewProviderKeyPool(db, nil)
+		pool.now = func() time.Time { return now }
+		pool.SetKeys(MetadataProviderGoogleBooks, []string{"books-key-0001", "books-key-0002"}, 2)
+		return pool
+	}
+	pool := newPool()
+
+	var used []string
+	call := func(key string) error {
+		used = append(used, key)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.Do(ctx, MetadataProviderGoogleBooks, call))
+	}
+	assert.Equal(t, []string{"books-key-0001", "books-key-0002", "books-key-0001"}, used)
+	status := pool.Status(ctx)[0]
+	require.NotNil(t, status.Remaining)
+	assert.Equal(t, 1, *status.Remaining)
+	assert.Equal(t, 0, *status.Keys[0].Remaining)
+	assert.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), status.QuotaResetsAt)
+
+	require.NoError(t, pool.Do(ctx, MetadataProviderGoogleBooks, call))
+	err := pool.Do(ctx, MetadataProviderGoogleBooks, call)
+	assert.ErrorContains(t, err, "no google_books API key available until 2026-10-17T00:00:00Z")
+	assert.Len(t, used, 4)
+
+	// Usage is recorded, so a restart does not reset the quota
+	restarted := newPool()
+	available, next := restarted.Available(ctx, MetadataProviderGoogleBooks)
+	assert.False(t, available)
+	assert.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), next)
+	status = restarted.Status(ctx)[0]
+	assert.Equal(t, 0, *status.Remaining)
+	require.NotNil(t, status.NextAvailableAt)
+
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, restarted.Do(ctx, MetadataProviderGoogleBooks, call), "quotas reset each UTC day")
+	assert.Equal(t, 3, *restarted.Status(ctx)[0].Remaining)
+}
+
+func TestMetadataRefreshService_PausesForProviderKeys(t *testing.T) {
+	db := newMetadataRefreshTestDB(t)
+	ctx := context.Background()
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO media_items (media_type_id, title, status) VALUES ((SELECT id FROM media_types WHERE name = 'movie'), 'Solaris', 'detected')`)
+	require.NoError(t, err)
+
+	pool := NewProviderKeyPool(db, nil)
+	pool.SetKeys(MetadataProviderTMDB, []string{"tmdb-key-0001"}, 0)
+	err = pool.Do(ctx, MetadataProviderTMDB, func(string) error {
+		return &ProviderRateLimitedError{RetryAfter: 300 * time.Millisecond}
+	})
+	require.Error(t, err)
+
+	refresher := &blockingRefresher{release: make(chan struct{}, 1)}
+	s := NewMetadataRefreshService(db, nil, refresher, nil)
+	s.SetKeyPool(pool)
+	job, err := s.StartJob(ctx, MetadataRefreshRequest{}, 1)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, err = s.GetJob(ctx, job.ID)
+		return err == nil && job.PausedUntil != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, job.Processed)
+
+	refresher.release <- struct{}{}
+	job = waitForRefresh(t, s, job.ID)
+	assert.Equal(t, MetadataRefreshCompleted, job.Status)
+	assert.Equal(t, 1, job.Updated)
+	assert.Nil(t, job.PausedUntil)
+	s.Stop()
+}
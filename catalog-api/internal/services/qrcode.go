@@ -0,0 +1,515 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// QR codes are encoded in byte mode at error correction level M, which
+// survives about 15% of the symbol being damaged or covered.
+
+// qrMaxTextLength is the longest text a version 40 symbol holds at level M
+const qrMaxTextLength = 2331
+
+// qrQuietZone is the blank border, in modules, scanners need around a symbol
+const qrQuietZone = 4
+
+// qrECCCodewordsPerBlock and qrErrorCorrectionBlocks describe level M's
+// error correction for each version; index 0 is unused
+var qrECCCodewordsPerBlock = [41]int{-1,
+	10, 16, 26, 18, 24, 16, 18, 22, 22, 26,
+	30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+	26, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	28, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+}
+
+var qrErrorCorrectionBlocks = [41]int{-1,
+	1, 1, 1, 2, 2, 4, 4, 4, 5, 5,
+	5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+	17, 17, 18, 20, 21, 23, 25, 26, 28, 29,
+	31, 33, 35, 37, 38, 40, 43, 45, 47, 49,
+}
+
+// qrCode is an encoded symbol; modules[y][x] is true for dark modules
+type qrCode struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// QRCodePNG encodes text as a QR code and renders it as a black on white
+// PNG about pixels wide, including the quiet zone. The image is never
+// smaller than one pixel per module.
+func QRCodePNG(text string, pixels int) ([]byte, error) {
+	qr, err := encodeQRCode([]byte(text))
+	if err != nil {
+		return nil, err
+	}
+
+	modules := qr.size + 2*qrQuietZone
+	scale := pixels / modules
+	if scale < 1 {
+		scale = 1
+	}
+	img := image.NewGray(image.Rect(0, 0, modules*scale, modules*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if !qr.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeQRCode encodes data in the smallest version that holds it, with
+// the mask that scores the lowest penalty
+func encodeQRCode(data []byte) (*qrCode, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid QR code data: empty")
+	}
+	if len(data) > qrMaxTextLength {
+		return nil, fmt.Errorf("invalid QR code data: longer than %d bytes", qrMaxTextLength)
+	}
+
+	version := 1
+	for ; version <= 40; version++ {
+		if qrHeaderBits(version)+8*len(data) <= 8*qrDataCodewords(version) {
+			break
+		}
+	}
+
+	// Mode indicator, character count, data, terminator and padding
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), qrHeaderBits(version)-4)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * qrDataCodewords(version)
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < capacity; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	qr := newQRCode(version)
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qrAddErrorCorrection(codewords, version))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // masking twice undoes it
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+	return qr, nil
+}
+
+// qrHeaderBits returns the length of the byte mode header in version
+func qrHeaderBits(version int) int {
+	if version <= 9 {
+		return 4 + 8
+	}
+	return 4 + 16
+}
+
+// qrRawDataModules returns the number of modules in version that hold
+// data or error correction, after the function patterns
+func qrRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataCodewords returns the number of data codewords version holds
+func qrDataCodewords(version int) int {
+	return qrRawDataModules(version)/8 - qrECCCodewordsPerBlock[version]*qrErrorCorrectionBlocks[version]
+}
+
+// qrAlignmentPositions returns the centre coordinates of version's
+// alignment patterns
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// qrAddErrorCorrection splits data into blocks, appends each block's
+// Reed-Solomon error correction and interleaves the blocks
+func qrAddErrorCorrection(data []byte, version int) []byte {
+	numBlocks := qrErrorCorrectionBlocks[version]
+	eccLen := qrECCCodewordsPerBlock[version]
+	rawCodewords := qrRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		dataLen := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+dataLen]...)
+		k += dataLen
+		if i < numShortBlocks {
+			// A placeholder keeps the blocks' codewords aligned; it is
+			// skipped when interleaving
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, qrReedSolomonRemainder(data[k-dataLen:k], divisor)...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor returns the generator polynomial of the given
+// degree, highest coefficient first with the leading 1 dropped
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrReedSolomonRemainder returns the error correction codewords for data
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= qrMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// qrMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func qrMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrBitBuffer is a sequence of bits, most significant first
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>uint(i))&1 != 0)
+	}
+}
+
+func newQRCode(version int) *qrCode {
+	size := version*4 + 17
+	qr := &qrCode{version: version, size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := 0; i < size; i++ {
+		qr.modules[i] = make([]bool, size)
+		qr.function[i] = make([]bool, size)
+	}
+	return qr
+}
+
+func (qr *qrCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder, alignment and version
+// patterns and reserves the format areas
+func (qr *qrCode) drawFunctionPatterns() {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, centre := range [][2]int{{3, 3}, {qr.size - 4, 3}, {3, qr.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := centre[0]+dx, centre[1]+dy
+				if x < 0 || x >= qr.size || y < 0 || y >= qr.size {
+					continue
+				}
+				distance := qrMax(qrAbs(dx), qrAbs(dy))
+				qr.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	positions := qrAlignmentPositions(qr.version)
+	last := len(positions) - 1
+	for i, cx := range positions {
+		for j, cy := range positions {
+			// Alignment patterns never overlap the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(cx+dx, cy+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0)
+	qr.drawVersion()
+}
+
+// drawFormatBits draws both copies of the error correction level and mask
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // always dark
+}
+
+// drawVersion draws both copies of the version, from version 7 on
+func (qr *qrCode) drawVersion() {
+	if qr.version < 7 {
+		return
+	}
+	rem := qr.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+	bits := qr.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := qr.size-11+i%3, i/3
+		qr.setFunction(a, b, dark)
+		qr.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords fills the data area in the zigzag order, two columns at a
+// time from the bottom right, skipping the vertical timing pattern
+func (qr *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < qr.size; vert++ {
+			y := vert
+			if upward {
+				y = qr.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if qr.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				qr.modules[y][x] = (codewords[i>>3]>>uint(7-(i&7)))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by mask
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !qr.function[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the standard's four rules: long runs, 2x2
+// blocks, finder-like patterns and an unbalanced share of dark modules
+func (qr *qrCode) penalty() int {
+	penalty, dark := 0, 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for _, vertical := range []bool{false, true} {
+		at := func(line, i int) bool {
+			if vertical {
+				return qr.modules[i][line]
+			}
+			return qr.modules[line][i]
+		}
+		for line := 0; line < qr.size; line++ {
+			run := 1
+			for i := 1; i <= qr.size; i++ {
+				if i < qr.size && at(line, i) == at(line, i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+
+			for i := 0; i+7 <= qr.size; i++ {
+				matches := true
+				for k, want := range finderLike {
+					if at(line, i+k) != want {
+						matches = false
+						break
+					}
+				}
+				if matches && (qr.lightRun(at, line, i-4, i) || qr.lightRun(at, line, i+7, i+11)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := qr.size * qr.size
+	// Ten points for every full 5% the dark share is away from half
+	penalty += qrAbs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+// lightRun reports whether modules from..to (exclusive) of line are light;
+// modules outside the symbol count as light
+func (qr *qrCode) lightRun(at func(line, i int) bool, line, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < qr.size && at(line, i) {
+			return false
+		}
+	}
+	return true
+}
+
+func qrAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
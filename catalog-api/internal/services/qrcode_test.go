@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRCode_ReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at version 1-M, from the standard's worked example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		qrReedSolomonRemainder(data, qrReedSolomonDivisor(10)))
+}
+
+func TestQRCode_Tables(t *testing.T) {
+	assert.Equal(t, 16, qrDataCodewords(1))
+	assert.Equal(t, 216, qrDataCodewords(10))
+	assert.Equal(t, 2334, qrDataCodewords(40))
+	assert.Nil(t, qrAlignmentPositions(1))
+	assert.Equal(t, []int{6, 22, 38}, qrAlignmentPositions(7))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, qrAlignmentPositions(32))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, qrAlignmentPositions(40))
+}
+
+func TestQRCode_FormatAndVersion(t *testing.T) {
+	qr := newQRCode(7)
+	qr.drawFormatBits(5)
+	qr.drawVersion()
+
+	format := 0
+	for i := 0; i < 8; i++ {
+		if qr.modules[8][qr.size-1-i] {
+			format |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if qr.modules[qr.size-15+i][8] {
+			format |= 1 << i
+		}
+	}
+	assert.Equal(t, 0x40ce, format, "level M, mask 5")
+
+	version := 0
+	for i := 0; i < 18; i++ {
+		if qr.modules[i/3][qr.size-11+i%3] {
+			version |= 1 << i
+		}
+	}
+	assert.Equal(t, 0x07c94, version)
+}
+
+func TestQRCode_Versions(t *testing.T) {
+	link := strings.Repeat("https://catalogizer.app/link/detail/42?track=track_1", 50)
+	for length, version := range map[int]int{14: 1, 15: 2, 213: 10, 2331: 40} {
+		qr, err := encodeQRCode([]byte(link[:length]))
+		require.NoError(t, err)
+		assert.Equal(t, version, qr.version, "%d bytes", length)
+		assert.Len(t, qr.modules, version*4+17)
+	}
+
+	_, err := encodeQRCode(nil)
+	assert.Error(t, err)
+	_, err = encodeQRCode(make([]byte, qrMaxTextLength+1))
+	assert.Error(t, err)
+}
+
+func TestQRCodePNG(t *testing.T) {
+	data, err := QRCodePNG("https://catalogizer.app/link/detail/42", 200)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// Version 3 plus the quiet zone is 37 modules, 5 pixels each
+	assert.Equal(t, 185, img.Bounds().Dx())
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r, "quiet zone is white")
+	r, _, _, _ = img.At(4*5, 4*5).RGBA()
+	assert.Equal(t, uint32(0), r, "finder pattern corner is black")
+}
@@ -0,0 +1,572 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Lockdown trigger types recorded in share_lockdowns.trigger_type.
+const (
+	LockdownTriggerMassRename   = "mass_rename"
+	LockdownTriggerEntropySpike = "entropy_spike"
+	// LockdownTriggerMaintenance is a lockdown placed for maintenance
+	LockdownTriggerMaintenance = "maintenance"
+)
+
+// Lockdown statuses.
+const (
+	LockdownStatusActive   = "active"
+	LockdownStatusReleased = "released"
+)
+
+// RansomwareDetectorConfig holds the thresholds used by the ransomware heuristics.
+type RansomwareDetectorConfig struct {
+	// Window is the sliding time window in which suspicious events are counted.
+	Window time.Duration
+	// MassRenameThreshold is the number of renames to unknown extensions
+	// within Window that triggers a lockdown.
+	MassRenameThreshold int
+	// EntropyThreshold is the Shannon entropy (bits per byte) above which a
+	// rewritten file is considered encrypted.
+	EntropyThreshold float64
+	// HighEntropyFileThreshold is the number of high-entropy rewrites within
+	// Window that triggers a lockdown.
+	HighEntropyFileThreshold int
+	// SampleSize is the number of bytes read from a file for entropy analysis.
+	SampleSize int
+}
+
+// DefaultRansomwareDetectorConfig returns conservative defaults that avoid
+// tripping on ordinary bulk reorganisation of a media library.
+func DefaultRansomwareDetectorConfig() RansomwareDetectorConfig {
+	return RansomwareDetectorConfig{
+		Window:                   2 * time.Minute,
+		MassRenameThreshold:      50,
+		EntropyThreshold:         7.5,
+		HighEntropyFileThreshold: 25,
+		SampleSize:               64 * 1024,
+	}
+}
+
+// ShareLockdown is a persisted read-only lockdown of a storage root.
+type ShareLockdown struct {
+	ID          int64                  `json:"id"`
+	StorageRoot string                 `json:"storage_root"`
+	TriggerType string                 `json:"trigger_type"`
+	Reason      string                 `json:"reason"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Status      string                 `json:"status"`
+	TriggeredAt time.Time              `json:"triggered_at"`
+	ReleasedAt  *time.Time             `json:"released_at,omitempty"`
+	ReleasedBy  *int                   `json:"released_by,omitempty"`
+	ReleaseNote *string                `json:"release_note,omitempty"`
+}
+
+// LockdownNotifier delivers lockdown alerts to administrators over a single
+// notification channel. The detector fans out to every registered notifier.
+type LockdownNotifier interface {
+	NotifyLockdown(ctx context.Context, lockdown *ShareLockdown) error
+}
+
+// LockdownNotifierFunc adapts a plain function to the LockdownNotifier interface.
+type LockdownNotifierFunc func(ctx context.Context, lockdown *ShareLockdown) error
+
+// NotifyLockdown calls f(ctx, lockdown).
+func (f LockdownNotifierFunc) NotifyLockdown(ctx context.Context, lockdown *ShareLockdown) error {
+	return f(ctx, lockdown)
+}
+
+// suspiciousEvent is a single heuristic hit kept in the sliding window.
+type suspiciousEvent struct {
+	at   time.Time
+	path string
+}
+
+// RansomwareDetector watches change events for patterns typical of ransomware
+// (mass renames to unknown extensions, bursts of high-entropy rewrites) and
+// places the affected storage root into a read-only lockdown that persists
+// until an administrator releases it.
+type RansomwareDetector struct {
+	db        *database.DB
+	logger    *zap.Logger
+	config    RansomwareDetectorConfig
+	mu        sync.Mutex
+	renames   map[string][]suspiciousEvent
+	rewrites  map[string][]suspiciousEvent
+	locked    map[string]*ShareLockdown
+	notifiers []LockdownNotifier
+	now       func() time.Time
+}
+
+// NewRansomwareDetector creates a detector. Zero-valued config fields fall back
+// to DefaultRansomwareDetectorConfig.
+func NewRansomwareDetector(db *database.DB, logger *zap.Logger, config RansomwareDetectorConfig) *RansomwareDetector {
+	defaults := DefaultRansomwareDetectorConfig()
+	if config.Window <= 0 {
+		config.Window = defaults.Window
+	}
+	if config.MassRenameThreshold <= 0 {
+		config.MassRenameThreshold = defaults.MassRenameThreshold
+	}
+	if config.EntropyThreshold <= 0 {
+		config.EntropyThreshold = defaults.EntropyThreshold
+	}
+	if config.HighEntropyFileThreshold <= 0 {
+		config.HighEntropyFileThreshold = defaults.HighEntropyFileThreshold
+	}
+	if config.SampleSize <= 0 {
+		config.SampleSize = defaults.SampleSize
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &RansomwareDetector{
+		db:       db,
+		logger:   logger,
+		config:   config,
+		renames:  make(map[string][]suspiciousEvent),
+		rewrites: make(map[string][]suspiciousEvent),
+		locked:   make(map[string]*ShareLockdown),
+		now:      time.Now,
+	}
+}
+
+// AddNotifier registers an additional alert channel.
+func (d *RansomwareDetector) AddNotifier(notifier LockdownNotifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append(d.notifiers, notifier)
+}
+
+// SampleSize returns the number of bytes callers should read for ObserveWrite.
+func (d *RansomwareDetector) SampleSize() int {
+	return d.config.SampleSize
+}
+
+// LoadActiveLockdowns restores active lockdowns from the database so that a
+// restart does not silently lift a lockdown.
+func (d *RansomwareDetector) LoadActiveLockdowns(ctx context.Context) error {
+	lockdowns, err := d.ListLockdowns(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range lockdowns {
+		d.locked[lockdowns[i].StorageRoot] = &lockdowns[i]
+	}
+	return nil
+}
+
+// IsLocked reports whether the storage root is currently in read-only lockdown.
+func (d *RansomwareDetector) IsLocked(storageRoot string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, locked := d.locked[storageRoot]
+	return locked
+}
+
+// ObserveRename records a rename/move event. Renames that change a known
+// extension into an unknown one count towards the mass-rename heuristic.
+func (d *RansomwareDetector) ObserveRename(ctx context.Context, storageRoot, oldPath, newPath string) {
+	if !isSuspiciousRename(oldPath, newPath) {
+		return
+	}
+
+	d.mu.Lock()
+	events := d.record(d.renames, storageRoot, newPath)
+	_, alreadyLocked := d.locked[storageRoot]
+	d.mu.Unlock()
+
+	if alreadyLocked || len(events) < d.config.MassRenameThreshold {
+		return
+	}
+
+	d.trigger(ctx, storageRoot, LockdownTriggerMassRename,
+		fmt.Sprintf("%d files renamed to unknown extensions within %s", len(events), d.config.Window),
+		events)
+}
+
+// ObserveWrite records a file modification with a sample of its new content.
+// Samples whose entropy exceeds the threshold count towards the entropy-spike
+// heuristic. Files whose extension is expected to be compressed (video,
+// audio, images, archives) are ignored since they are naturally high entropy.
+func (d *RansomwareDetector) ObserveWrite(ctx context.Context, storageRoot, path string, sample []byte) {
+	if len(sample) == 0 || isNaturallyHighEntropy(path) {
+		return
+	}
+	if ShannonEntropy(sample) < d.config.EntropyThreshold {
+		return
+	}
+
+	d.mu.Lock()
+	events := d.record(d.rewrites, storageRoot, path)
+	_, alreadyLocked := d.locked[storageRoot]
+	d.mu.Unlock()
+
+	if alreadyLocked || len(events) < d.config.HighEntropyFileThreshold {
+		return
+	}
+
+	d.trigger(ctx, storageRoot, LockdownTriggerEntropySpike,
+		fmt.Sprintf("%d files rewritten with high-entropy content within %s", len(events), d.config.Window),
+		events)
+}
+
+// record appends an event to the per-root window, prunes expired entries and
+// returns the current window. Callers must hold d.mu.
+func (d *RansomwareDetector) record(windows map[string][]suspiciousEvent, storageRoot, path string) []suspiciousEvent {
+	now := d.now()
+	cutoff := now.Add(-d.config.Window)
+
+	events := windows[storageRoot]
+	kept := events[:0]
+	for _, e := range events {
+		if e.at.After(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, suspiciousEvent{at: now, path: path})
+	windows[storageRoot] = kept
+
+	out := make([]suspiciousEvent, len(kept))
+	copy(out, kept)
+	return out
+}
+
+// trigger persists a lockdown, marks the root as locked and alerts admins.
+func (d *RansomwareDetector) trigger(ctx context.Context, storageRoot, triggerType, reason string, events []suspiciousEvent) {
+	samplePaths := make([]string, 0, 10)
+	for i := 0; i < len(events) && i < 10; i++ {
+		samplePaths = append(samplePaths, events[i].path)
+	}
+
+	lockdown := &ShareLockdown{
+		StorageRoot: storageRoot,
+		TriggerType: triggerType,
+		Reason:      reason,
+		Details: map[string]interface{}{
+			"event_count":  len(events),
+			"window":       d.config.Window.String(),
+			"sample_paths": samplePaths,
+		},
+		Status:      LockdownStatusActive,
+		TriggeredAt: d.now(),
+	}
+
+	d.mu.Lock()
+	if _, exists := d.locked[storageRoot]; exists {
+		d.mu.Unlock()
+		return
+	}
+	d.locked[storageRoot] = lockdown
+	delete(d.renames, storageRoot)
+	delete(d.rewrites, storageRoot)
+	notifiers := make([]LockdownNotifier, len(d.notifiers))
+	copy(notifiers, d.notifiers)
+	d.mu.Unlock()
+
+	if err := d.persistLockdown(ctx, lockdown); err != nil {
+		d.logger.Error("Failed to persist share lockdown",
+			zap.String("storage_root", storageRoot),
+			zap.Error(err))
+	}
+
+	d.logger.Warn("Storage root placed in read-only lockdown",
+		zap.String("storage_root", storageRoot),
+		zap.String("trigger", triggerType),
+		zap.String("reason", reason))
+
+	for _, notifier := range notifiers {
+		if err := notifier.NotifyLockdown(ctx, lockdown); err != nil {
+			d.logger.Error("Failed to deliver lockdown notification",
+				zap.String("storage_root", storageRoot),
+				zap.Error(err))
+		}
+	}
+}
+
+// Lock places a storage root in read-only lockdown for maintenance. No
+// alert is sent, as nothing suspicious happened; the lockdown is lifted
+// with Release like any other.
+func (d *RansomwareDetector) Lock(ctx context.Context, storageRoot, reason string) (*ShareLockdown, error) {
+	if d.db == nil {
+		return nil, fmt.Errorf("database not configured")
+	}
+
+	lockdown := &ShareLockdown{
+		StorageRoot: storageRoot,
+		TriggerType: LockdownTriggerMaintenance,
+		Reason:      reason,
+		Status:      LockdownStatusActive,
+		TriggeredAt: d.now(),
+	}
+	d.mu.Lock()
+	if _, exists := d.locked[storageRoot]; exists {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("storage root %s is already in read-only lockdown", storageRoot)
+	}
+	d.locked[storageRoot] = lockdown
+	d.mu.Unlock()
+
+	if err := d.persistLockdown(ctx, lockdown); err != nil {
+		d.mu.Lock()
+		delete(d.locked, storageRoot)
+		d.mu.Unlock()
+		return nil, err
+	}
+
+	d.logger.Info("Storage root placed in read-only lockdown for maintenance",
+		zap.String("storage_root", storageRoot),
+		zap.String("reason", reason))
+	locked := *lockdown
+	return &locked, nil
+}
+
+func (d *RansomwareDetector) persistLockdown(ctx context.Context, lockdown *ShareLockdown) error {
+	if d.db == nil {
+		return nil
+	}
+
+	details, err := json.Marshal(lockdown.Details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockdown details: %w", err)
+	}
+
+	id, err := d.db.InsertReturningID(ctx,
+		`INSERT INTO share_lockdowns (storage_root, trigger_type, reason, details, status, triggered_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		lockdown.StorageRoot, lockdown.TriggerType, lockdown.Reason, string(details),
+		lockdown.Status, lockdown.TriggeredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert share lockdown: %w", err)
+	}
+
+	d.mu.Lock()
+	lockdown.ID = id
+	d.mu.Unlock()
+	return nil
+}
+
+// ListLockdowns returns persisted lockdowns, newest first.
+func (d *RansomwareDetector) ListLockdowns(ctx context.Context, activeOnly bool) ([]ShareLockdown, error) {
+	if d.db == nil {
+		return nil, fmt.Errorf("database not configured")
+	}
+
+	query := `SELECT id, storage_root, trigger_type, reason, details, status, triggered_at,
+		released_at, released_by, release_note
+		FROM share_lockdowns`
+	args := []interface{}{}
+	if activeOnly {
+		query += " WHERE status = ?"
+		args = append(args, LockdownStatusActive)
+	}
+	query += " ORDER BY triggered_at DESC"
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share lockdowns: %w", err)
+	}
+	defer rows.Close()
+
+	var lockdowns []ShareLockdown
+	for rows.Next() {
+		var l ShareLockdown
+		var details sql.NullString
+		var releasedAt sql.NullTime
+		var releasedBy sql.NullInt64
+		var releaseNote sql.NullString
+
+		if err := rows.Scan(&l.ID, &l.StorageRoot, &l.TriggerType, &l.Reason, &details,
+			&l.Status, &l.TriggeredAt, &releasedAt, &releasedBy, &releaseNote); err != nil {
+			return nil, fmt.Errorf("failed to scan share lockdown: %w", err)
+		}
+
+		if details.Valid && details.String != "" {
+			_ = json.Unmarshal([]byte(details.String), &l.Details)
+		}
+		if releasedAt.Valid {
+			l.ReleasedAt = &releasedAt.Time
+		}
+		if releasedBy.Valid {
+			by := int(releasedBy.Int64)
+			l.ReleasedBy = &by
+		}
+		if releaseNote.Valid {
+			l.ReleaseNote = &releaseNote.String
+		}
+
+		lockdowns = append(lockdowns, l)
+	}
+
+	return lockdowns, rows.Err()
+}
+
+// Release lifts an active lockdown. Lockdowns are never lifted automatically;
+// this must be invoked by an administrator after investigating the share.
+func (d *RansomwareDetector) Release(ctx context.Context, lockdownID int64, releasedBy int, note string) error {
+	if d.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+
+	var storageRoot, status string
+	err := d.db.QueryRowContext(ctx,
+		"SELECT storage_root, status FROM share_lockdowns WHERE id = ?", lockdownID,
+	).Scan(&storageRoot, &status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("lockdown not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get share lockdown: %w", err)
+	}
+	if status != LockdownStatusActive {
+		return fmt.Errorf("lockdown already released")
+	}
+
+	_, err = d.db.ExecContext(ctx,
+		`UPDATE share_lockdowns SET status = ?, released_at = ?, released_by = ?, release_note = ?
+		 WHERE id = ?`,
+		LockdownStatusReleased, d.now(), releasedBy, note, lockdownID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release share lockdown: %w", err)
+	}
+
+	d.mu.Lock()
+	delete(d.locked, storageRoot)
+	delete(d.renames, storageRoot)
+	delete(d.rewrites, storageRoot)
+	d.mu.Unlock()
+
+	d.logger.Info("Share lockdown released",
+		zap.Int64("lockdown_id", lockdownID),
+		zap.String("storage_root", storageRoot),
+		zap.Int("released_by", releasedBy))
+
+	return nil
+}
+
+// ShannonEntropy returns the Shannon entropy of data in bits per byte (0-8).
+// Encrypted or well-compressed data approaches 8.
+func ShannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	total := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / total
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// isSuspiciousRename reports whether a rename turns a file with a recognised
+// extension into one with an unrecognised extension (e.g. movie.mkv ->
+// movie.mkv.locked).
+func isSuspiciousRename(oldPath, newPath string) bool {
+	oldExt := strings.TrimPrefix(filepath.Ext(oldPath), ".")
+	newExt := strings.TrimPrefix(filepath.Ext(newPath), ".")
+	if strings.EqualFold(oldExt, newExt) {
+		return false
+	}
+	return classifyFileType(oldExt) != "other" && classifyFileType(newExt) == "other"
+}
+
+// isNaturallyHighEntropy reports whether a path's extension denotes content
+// that is compressed by design and therefore meaningless for entropy checks.
+func isNaturallyHighEntropy(path string) bool {
+	switch classifyFileType(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case "video", "audio", "image", "archive", "software":
+		return true
+	}
+	return false
+}
+
+// LogLockdownNotifier writes lockdown alerts to the application log.
+type LogLockdownNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogLockdownNotifier creates a log-based lockdown notifier.
+func NewLogLockdownNotifier(logger *zap.Logger) *LogLockdownNotifier {
+	return &LogLockdownNotifier{logger: logger}
+}
+
+// NotifyLockdown logs the lockdown at error level so it surfaces in alerting.
+func (n *LogLockdownNotifier) NotifyLockdown(ctx context.Context, lockdown *ShareLockdown) error {
+	n.logger.Error("[ADMIN ALERT] Possible ransomware activity, share locked read-only",
+		zap.String("storage_root", lockdown.StorageRoot),
+		zap.String("trigger", lockdown.TriggerType),
+		zap.String("reason", lockdown.Reason))
+	return nil
+}
+
+// WebhookLockdownNotifier posts lockdown alerts to a Slack-compatible webhook.
+type WebhookLockdownNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookLockdownNotifier creates a webhook notifier for the given URL.
+func NewWebhookLockdownNotifier(url string) *WebhookLockdownNotifier {
+	return &WebhookLockdownNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NotifyLockdown posts a JSON payload describing the lockdown.
+func (n *WebhookLockdownNotifier) NotifyLockdown(ctx context.Context, lockdown *ShareLockdown) error {
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf(":rotating_light: Storage root %q placed in read-only lockdown: %s",
+			lockdown.StorageRoot, lockdown.Reason),
+		"lockdown": lockdown,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mutecomm/go-sqlcipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupLockdownTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE share_lockdowns (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root TEXT NOT NULL,
+			trigger_type TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			details TEXT,
+			status TEXT NOT NULL DEFAULT 'active',
+			triggered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			released_at DATETIME,
+			released_by INTEGER,
+			release_note TEXT
+		)`)
+	require.NoError(t, err)
+
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+type recordingNotifier struct {
+	mu        sync.Mutex
+	lockdowns []*ShareLockdown
+}
+
+func (n *recordingNotifier) NotifyLockdown(ctx context.Context, lockdown *ShareLockdown) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lockdowns = append(n.lockdowns, lockdown)
+	return nil
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.lockdowns)
+}
+
+func TestNewRansomwareDetector_AppliesDefaults(t *testing.T) {
+	d := NewRansomwareDetector(nil, nil, RansomwareDetectorConfig{})
+	defaults := DefaultRansomwareDetectorConfig()
+
+	assert.Equal(t, defaults.Window, d.config.Window)
+	assert.Equal(t, defaults.MassRenameThreshold, d.config.MassRenameThreshold)
+	assert.Equal(t, defaults.EntropyThreshold, d.config.EntropyThreshold)
+	assert.Equal(t, defaults.HighEntropyFileThreshold, d.config.HighEntropyFileThreshold)
+	assert.Equal(t, defaults.SampleSize, d.SampleSize())
+}
+
+func TestShannonEntropy(t *testing.T) {
+	assert.Equal(t, 0.0, ShannonEntropy(nil))
+	assert.Equal(t, 0.0, ShannonEntropy([]byte(strings.Repeat("a", 1024))))
+	assert.InDelta(t, 1.0, ShannonEntropy([]byte("abababab")), 0.0001)
+
+	random := make([]byte, 64*1024)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+	assert.Greater(t, ShannonEntropy(random), 7.9)
+}
+
+func TestIsSuspiciousRename(t *testing.T) {
+	tests := []struct {
+		oldPath  string
+		newPath  string
+		expected bool
+	}{
+		{"/movies/a.mkv", "/movies/a.mkv.locked", true},
+		{"/docs/report.pdf", "/docs/report.encrypted", true},
+		{"/movies/a.mkv", "/movies/b.mkv", false},
+		{"/movies/a.mkv", "/movies/a.mp4", false},
+		{"/misc/a.xyz", "/misc/a.abc", false},
+		{"/music/A.MP3", "/music/a.mp3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.oldPath+"->"+tt.newPath, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isSuspiciousRename(tt.oldPath, tt.newPath))
+		})
+	}
+}
+
+func TestRansomwareDetector_MassRenameTriggersLockdown(t *testing.T) {
+	db := setupLockdownTestDB(t)
+	d := NewRansomwareDetector(db, zap.NewNop(), RansomwareDetectorConfig{
+		Window:              time.Minute,
+		MassRenameThreshold: 3,
+	})
+	notifier := &recordingNotifier{}
+	d.AddNotifier(notifier)
+	ctx := context.Background()
+
+	d.ObserveRename(ctx, "nas", "/a.mkv", "/a.mkv.crypt")
+	d.ObserveRename(ctx, "nas", "/b.mkv", "/b.mkv.crypt")
+	assert.False(t, d.IsLocked("nas"))
+
+	// Benign renames do not count
+	d.ObserveRename(ctx, "nas", "/c.mkv", "/d.mkv")
+	assert.False(t, d.IsLocked("nas"))
+
+	d.ObserveRename(ctx, "nas", "/e.mkv", "/e.mkv.crypt")
+	assert.True(t, d.IsLocked("nas"))
+	assert.False(t, d.IsLocked("other"))
+	assert.Equal(t, 1, notifier.count())
+
+	// Further events on a locked root do not re-notify
+	d.ObserveRename(ctx, "nas", "/f.mkv", "/f.mkv.crypt")
+	assert.Equal(t, 1, notifier.count())
+
+	lockdowns, err := d.ListLockdowns(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, lockdowns, 1)
+	assert.Equal(t, "nas", lockdowns[0].StorageRoot)
+	assert.Equal(t, LockdownTriggerMassRename, lockdowns[0].TriggerType)
+	assert.Equal(t, LockdownStatusActive, lockdowns[0].Status)
+	assert.EqualValues(t, 3, lockdowns[0].Details["event_count"])
+}
+
+func TestRansomwareDetector_WindowExpiry(t *testing.T) {
+	d := NewRansomwareDetector(nil, zap.NewNop(), RansomwareDetectorConfig{
+		Window:              time.Minute,
+		MassRenameThreshold: 2,
+	})
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	d.ObserveRename(ctx, "nas", "/a.mkv", "/a.mkv.crypt")
+	now = now.Add(2 * time.Minute)
+	d.ObserveRename(ctx, "nas", "/b.mkv", "/b.mkv.crypt")
+
+	assert.False(t, d.IsLocked("nas"))
+}
+
+func TestRansomwareDetector_EntropySpikeTriggersLockdown(t *testing.T) {
+	d := NewRansomwareDetector(nil, zap.NewNop(), RansomwareDetectorConfig{
+		Window:                   time.Minute,
+		HighEntropyFileThreshold: 2,
+	})
+	notifier := &recordingNotifier{}
+	d.AddNotifier(notifier)
+	ctx := context.Background()
+
+	random := make([]byte, 4096)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+
+	// Low-entropy rewrites and naturally compressed formats are ignored
+	d.ObserveWrite(ctx, "nas", "/notes.txt", []byte(strings.Repeat("hello ", 500)))
+	d.ObserveWrite(ctx, "nas", "/movie.mkv", random)
+	d.ObserveWrite(ctx, "nas", "/movie2.mkv", random)
+	assert.False(t, d.IsLocked("nas"))
+
+	d.ObserveWrite(ctx, "nas", "/notes.txt", random)
+	d.ObserveWrite(ctx, "nas", "/report.docx", random)
+	assert.True(t, d.IsLocked("nas"))
+	require.Equal(t, 1, notifier.count())
+	assert.Equal(t, LockdownTriggerEntropySpike, notifier.lockdowns[0].TriggerType)
+}
+
+func TestRansomwareDetector_ReleaseRequiresActiveLockdown(t *testing.T) {
+	db := setupLockdownTestDB(t)
+	d := NewRansomwareDetector(db, zap.NewNop(), RansomwareDetectorConfig{MassRenameThreshold: 1})
+	ctx := context.Background()
+
+	d.ObserveRename(ctx, "nas", "/a.pdf", "/a.pdf.locked")
+	require.True(t, d.IsLocked("nas"))
+
+	lockdowns, err := d.ListLockdowns(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, lockdowns, 1)
+
+	require.NoError(t, d.Release(ctx, lockdowns[0].ID, 1, "restored from backup"))
+	assert.False(t, d.IsLocked("nas"))
+
+	err = d.Release(ctx, lockdowns[0].ID, 1, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already released")
+
+	err = d.Release(ctx, 999, 1, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	all, err := d.ListLockdowns(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, LockdownStatusReleased, all[0].Status)
+	require.NotNil(t, all[0].ReleasedBy)
+	assert.Equal(t, 1, *all[0].ReleasedBy)
+	require.NotNil(t, all[0].ReleaseNote)
+	assert.Equal(t, "restored from backup", *all[0].ReleaseNote)
+}
+
+func TestRansomwareDetector_LockForMaintenance(t *testing.T) {
+	db := setupLockdownTestDB(t)
+	d := NewRansomwareDetector(db, zap.NewNop(), RansomwareDetectorConfig{})
+	notified := 0
+	d.AddNotifier(LockdownNotifierFunc(func(context.Context, *ShareLockdown) error {
+		notified++
+		return nil
+	}))
+	ctx := context.Background()
+
+	lockdown, err := d.Lock(ctx, "nas", "nightly maintenance")
+	require.NoError(t, err)
+	assert.Positive(t, lockdown.ID)
+	assert.Equal(t, LockdownTriggerMaintenance, lockdown.TriggerType)
+	assert.True(t, d.IsLocked("nas"))
+	assert.Zero(t, notified)
+
+	_, err = d.Lock(ctx, "nas", "again")
+	assert.ErrorContains(t, err, "already in read-only lockdown")
+
+	require.NoError(t, d.Release(ctx, lockdown.ID, 1, "done"))
+	assert.False(t, d.IsLocked("nas"))
+}
+
+func TestRansomwareDetector_LoadActiveLockdowns(t *testing.T) {
+	db := setupLockdownTestDB(t)
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO share_lockdowns (storage_root, trigger_type, reason, status) VALUES (?, ?, ?, ?)`,
+		"archive", LockdownTriggerEntropySpike, "test", LockdownStatusActive)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO share_lockdowns (storage_root, trigger_type, reason, status) VALUES (?, ?, ?, ?)`,
+		"media", LockdownTriggerMassRename, "test", LockdownStatusReleased)
+	require.NoError(t, err)
+
+	d := NewRansomwareDetector(db, zap.NewNop(), DefaultRansomwareDetectorConfig())
+	require.NoError(t, d.LoadActiveLockdowns(ctx))
+
+	assert.True(t, d.IsLocked("archive"))
+	assert.False(t, d.IsLocked("media"))
+}
+
+func TestLockdownNotifierFunc(t *testing.T) {
+	called := false
+	var n LockdownNotifier = LockdownNotifierFunc(func(ctx context.Context, l *ShareLockdown) error {
+		called = true
+		return fmt.Errorf("boom")
+	})
+
+	err := n.NotifyLockdown(context.Background(), &ShareLockdown{})
+	assert.True(t, called)
+	assert.EqualError(t, err, "boom")
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recycleBinResource describes a soft-deletable table: the column that
+// names a row in listings and the column holding the ID of the user who
+// owns a row, empty when rows have no owner.
+type recycleBinResource struct {
+	table       string
+	nameColumn  string
+	ownerColumn string
+}
+
+// recycleBinResources maps the resource types of the recycle bin API to
+// their tables. Every table has a deleted_at column.
+var recycleBinResources = map[string]recycleBinResource{
+	"collections": {table: "media_collections", nameColumn: "name", ownerColumn: "user_id"},
+	"playlists":   {table: "playlists", nameColumn: "name", ownerColumn: "user_id"},
+	"users":       {table: "users", nameColumn: "username", ownerColumn: "id"},
+	"media":       {table: "media_items", nameColumn: "title"},
+}
+
+// RecycleBinResourceTypes returns the resource types the recycle bin
+// holds, sorted.
+func RecycleBinResourceTypes() []string {
+	types := make([]string, 0, len(recycleBinResources))
+	for resource := range recycleBinResources {
+		types = append(types, resource)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// RecycleBinEntry is a soft-deleted row waiting to be restored or purged.
+type RecycleBinEntry struct {
+	Resource  string    `json:"resource"`
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// RecycleBinConfig controls how long deleted rows are kept and how often
+// expired ones are purged.
+type RecycleBinConfig struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// RecycleBinService lists, restores and purges soft-deleted collections,
+// playlists, users and media items. Rows deleted longer than the retention
+// period ago are purged on a schedule.
+type RecycleBinService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config RecycleBinConfig
+	mu     sync.Mutex
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	now    func() time.Time
+}
+
+// NewRecycleBinService creates a RecycleBinService. Deleted rows are kept
+// for 30 days and purged daily unless cfg says otherwise.
+func NewRecycleBinService(db *database.DB, logger *zap.Logger, cfg RecycleBinConfig) *RecycleBinService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 30 * 24 * time.Hour
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	return &RecycleBinService{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+// Retention returns how long deleted rows are kept before they are purged.
+func (s *RecycleBinService) Retention() time.Duration {
+	return s.config.Retention
+}
+
+func lookupRecycleBinResource(resource string) (recycleBinResource, error) {
+	r, ok := recycleBinResources[resource]
+	if !ok {
+		return r, fmt.Errorf("invalid resource type: %s", resource)
+	}
+	return r, nil
+}
+
+// Summary returns the number of deleted rows of every resource type.
+func (s *RecycleBinService) Summary(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int, len(recycleBinResources))
+	for resource, r := range recycleBinResources {
+		var count int
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM `+r.table+` WHERE deleted_at IS NOT NULL`).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count deleted %s: %w", resource, err)
+		}
+		counts[resource] = count
+	}
+	return counts, nil
+}
+
+// List returns a page of deleted rows of one resource type, most recently
+// deleted first, with the total number of deleted rows.
+func (s *RecycleBinService) List(ctx context.Context, resource string, limit, offset int) ([]RecycleBinEntry, int, error) {
+	r, err := lookupRecycleBinResource(resource)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM `+r.table+` WHERE deleted_at IS NOT NULL`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count deleted %s: %w", resource, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, `+r.nameColumn+`, deleted_at FROM `+r.table+`
+		 WHERE deleted_at IS NOT NULL
+		 ORDER BY deleted_at DESC, id DESC
+		 LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list deleted %s: %w", resource, err)
+	}
+	defer rows.Close()
+
+	entries := []RecycleBinEntry{}
+	for rows.Next() {
+		entry := RecycleBinEntry{Resource: resource}
+		if err := rows.Scan(&entry.ID, &entry.Name, &entry.DeletedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan deleted %s: %w", resource, err)
+		}
+		entry.PurgeAt = entry.DeletedAt.Add(s.config.Retention)
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// Delete moves a row to the recycle bin.
+func (s *RecycleBinService) Delete(ctx context.Context, resource string, id int64) error {
+	r, err := lookupRecycleBinResource(resource)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.db.SoftDelete(ctx, r.table, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s %d: %w", resource, id, err)
+	}
+	if !deleted {
+		return fmt.Errorf("%s %d not found", resource, id)
+	}
+	return nil
+}
+
+// Owner returns the ID of the user who owns a deleted row, or nil when the
+// row has no owner.
+func (s *RecycleBinService) Owner(ctx context.Context, resource string, id int64) (*int64, error) {
+	r, err := lookupRecycleBinResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	column := "NULL"
+	if r.ownerColumn != "" {
+		column = r.ownerColumn
+	}
+	var owner sql.NullInt64
+	err = s.db.QueryRowContext(ctx,
+		`SELECT `+column+` FROM `+r.table+` WHERE id = ? AND deleted_at IS NOT NULL`, id).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("deleted %s %d not found", resource, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner of %s %d: %w", resource, id, err)
+	}
+	if !owner.Valid {
+		return nil, nil
+	}
+	return &owner.Int64, nil
+}
+
+// Restore brings a row back from the recycle bin.
+func (s *RecycleBinService) Restore(ctx context.Context, resource string, id int64) error {
+	r, err := lookupRecycleBinResource(resource)
+	if err != nil {
+		return err
+	}
+	restored, err := s.db.RestoreDeleted(ctx, r.table, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s %d: %w", resource, id, err)
+	}
+	if !restored {
+		return fmt.Errorf("deleted %s %d not found", resource, id)
+	}
+	return nil
+}
+
+// Purge permanently removes a row from the recycle bin. Rows that were not
+// deleted first are left alone.
+func (s *RecycleBinService) Purge(ctx context.Context, resource string, id int64) error {
+	r, err := lookupRecycleBinResource(resource)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM `+r.table+` WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to purge %s %d: %w", resource, id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("deleted %s %d not found", resource, id)
+	}
+	return nil
+}
+
+// PurgeExpired permanently removes rows deleted longer than the retention
+// period ago and returns how many were removed per resource type. A row
+// that cannot be removed, for example because other rows still reference
+// it, is logged and retried on the next run.
+func (s *RecycleBinService) PurgeExpired(ctx context.Context) map[string]int {
+	cutoff := s.now().UTC().Add(-s.config.Retention)
+	purged := make(map[string]int, len(recycleBinResources))
+	for _, resource := range RecycleBinResourceTypes() {
+		r := recycleBinResources[resource]
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT id FROM `+r.table+` WHERE deleted_at IS NOT NULL AND deleted_at < ?`, cutoff)
+		if err != nil {
+			s.logger.Error("Failed to find expired recycle bin entries",
+				zap.String("resource", resource), zap.Error(err))
+			continue
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			if err := s.Purge(ctx, resource, id); err != nil {
+				s.logger.Warn("Failed to purge recycle bin entry",
+					zap.String("resource", resource), zap.Int64("id", id), zap.Error(err))
+				continue
+			}
+			purged[resource]++
+		}
+		if purged[resource] > 0 {
+			s.logger.Info("Purged expired recycle bin entries",
+				zap.String("resource", resource), zap.Int("count", purged[resource]))
+		}
+	}
+	return purged
+}
+
+// Start purges expired rows on the configured interval until Stop is
+// called.
+func (s *RecycleBinService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.PurgeExpired(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for a purge in progress to finish.
+func (s *RecycleBinService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
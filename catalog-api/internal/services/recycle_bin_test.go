@@ -0,0 +1,126 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecycleBinTestService(t *testing.T) (*RecycleBinService, *database.DB) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE media_collections (id INTEGER PRIMARY KEY, name TEXT NOT NULL, user_id INTEGER, deleted_at DATETIME);
+		CREATE TABLE playlists (id INTEGER PRIMARY KEY, name TEXT NOT NULL, user_id INTEGER, deleted_at DATETIME);
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT NOT NULL, deleted_at DATETIME);
+		CREATE TABLE media_items (id INTEGER PRIMARY KEY, title TEXT NOT NULL, deleted_at DATETIME);
+		INSERT INTO media_collections (id, name, user_id) VALUES (1, 'Noir', NULL), (2, 'Westerns', 2);
+		INSERT INTO users (id, username) VALUES (1, 'admin'), (2, 'guest');
+		INSERT INTO media_items (id, title) VALUES (1, 'Whiplash')`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewRecycleBinService(db, nil, RecycleBinConfig{Retention: 7 * 24 * time.Hour}), db
+}
+
+func TestRecycleBin_DeleteListRestore(t *testing.T) {
+	service, _ := newRecycleBinTestService(t)
+	ctx := context.Background()
+
+	require.NoError(t, service.Delete(ctx, "collections", 2))
+	require.NoError(t, service.Delete(ctx, "users", 2))
+	assert.ErrorContains(t, service.Delete(ctx, "users", 2), "not found")
+	assert.ErrorContains(t, service.Delete(ctx, "files", 1), "invalid resource type")
+
+	summary, err := service.Summary(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"collections": 1, "playlists": 0, "users": 1, "media": 0}, summary)
+
+	entries, total, err := service.List(ctx, "collections", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Westerns", entries[0].Name)
+	assert.Equal(t, 7*24*time.Hour, entries[0].PurgeAt.Sub(entries[0].DeletedAt))
+
+	assert.ErrorContains(t, service.Restore(ctx, "collections", 1), "not found")
+	require.NoError(t, service.Restore(ctx, "collections", 2))
+	entries, total, err = service.List(ctx, "collections", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, entries)
+}
+
+func TestRecycleBin_Owner(t *testing.T) {
+	service, _ := newRecycleBinTestService(t)
+	ctx := context.Background()
+
+	// Live rows have no owner in the recycle bin
+	_, err := service.Owner(ctx, "collections", 2)
+	assert.ErrorContains(t, err, "not found")
+
+	for _, step := range []struct {
+		resource string
+		id       int64
+	}{{"collections", 1}, {"collections", 2}, {"users", 2}, {"media", 1}} {
+		require.NoError(t, service.Delete(ctx, step.resource, step.id))
+	}
+
+	owner, err := service.Owner(ctx, "collections", 2)
+	require.NoError(t, err)
+	require.NotNil(t, owner)
+	assert.Equal(t, int64(2), *owner)
+
+	owner, err = service.Owner(ctx, "users", 2)
+	require.NoError(t, err)
+	require.NotNil(t, owner)
+	assert.Equal(t, int64(2), *owner)
+
+	// Collections made before owners were kept, and media, have no owner
+	owner, err = service.Owner(ctx, "collections", 1)
+	require.NoError(t, err)
+	assert.Nil(t, owner)
+	owner, err = service.Owner(ctx, "media", 1)
+	require.NoError(t, err)
+	assert.Nil(t, owner)
+
+	_, err = service.Owner(ctx, "files", 1)
+	assert.ErrorContains(t, err, "invalid resource type")
+}
+
+func TestRecycleBin_Purge(t *testing.T) {
+	service, db := newRecycleBinTestService(t)
+	ctx := context.Background()
+
+	// Live rows cannot be purged
+	assert.ErrorContains(t, service.Purge(ctx, "media", 1), "not found")
+
+	require.NoError(t, service.Delete(ctx, "media", 1))
+	require.NoError(t, service.Purge(ctx, "media", 1))
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM media_items`).Scan(&count))
+	assert.Equal(t, 0, count)
+
+	// Only rows past the retention period are purged on schedule
+	require.NoError(t, service.Delete(ctx, "collections", 1))
+	_, err := db.Exec(`UPDATE media_collections SET deleted_at = ? WHERE id = 1`, time.Now().UTC().AddDate(0, 0, -8))
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, "collections", 2))
+
+	purged := service.PurgeExpired(ctx)
+	assert.Equal(t, 1, purged["collections"])
+	entries, _, err := service.List(ctx, "collections", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(2), entries[0].ID)
+}
@@ -0,0 +1,1005 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Replication sources: a rule copies either one collection of the remote
+// or a whole section, named by media type.
+const (
+	ReplicationSourceCollection = "collection"
+	ReplicationSourceSection    = "section"
+)
+
+// Replication run outcomes recorded on a rule.
+const (
+	ReplicationStatusCompleted = "completed"
+	ReplicationStatusPartial   = "partial"
+	ReplicationStatusFailed    = "failed"
+	ReplicationStatusPaused    = "paused"
+)
+
+// Replicated file states.
+const (
+	ReplicationItemCopied = "copied"
+	ReplicationItemFailed = "failed"
+)
+
+// errReplicationPaused stops a transfer when a pause window opens.
+var errReplicationPaused = errors.New("replication paused by bandwidth schedule")
+
+var replicationWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ReplicationBandwidthWindow overrides a rule's bandwidth limit between
+// Start and End ("HH:MM") on the given days, or on every day when Days is
+// empty. Windows may wrap midnight and are read on the clock of TimeZone,
+// an IANA name, or of the server when it is empty. A pause window stops
+// scheduled transfers; a limit of zero means unlimited.
+type ReplicationBandwidthWindow struct {
+	Days      []string `json:"days,omitempty"`
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	TimeZone  string   `json:"time_zone,omitempty"`
+	LimitKBps int      `json:"limit_kbps"`
+	Pause     bool     `json:"pause,omitempty"`
+}
+
+// ReplicationRule copies a collection or section of a federated remote
+// into a folder of a local storage root.
+type ReplicationRule struct {
+	ID                 int64                        `json:"id"`
+	RemoteID           int64                        `json:"remote_id"`
+	Name               string                       `json:"name"`
+	SourceType         string                       `json:"source_type"`
+	Source             string                       `json:"source"`
+	StorageRoot        string                       `json:"storage_root"`
+	TargetPath         string                       `json:"target_path"`
+	BandwidthLimitKBps int                          `json:"bandwidth_limit_kbps"`
+	BandwidthSchedule  []ReplicationBandwidthWindow `json:"bandwidth_schedule"`
+	Enabled            bool                         `json:"enabled"`
+	Running            bool                         `json:"running"`
+	LastRunAt          *time.Time                   `json:"last_run_at,omitempty"`
+	LastRunStatus      string                       `json:"last_run_status,omitempty"`
+	LastRunError       string                       `json:"last_run_error,omitempty"`
+	LastRunFiles       int                          `json:"last_run_files"`
+	LastRunBytes       int64                        `json:"last_run_bytes"`
+	CreatedAt          time.Time                    `json:"created_at"`
+	UpdatedAt          time.Time                    `json:"updated_at"`
+}
+
+// ReplicationRuleRequest creates or updates a rule. On update, empty
+// fields keep their current values.
+type ReplicationRuleRequest struct {
+	RemoteID           int64                         `json:"remote_id"`
+	Name               string                        `json:"name"`
+	SourceType         string                        `json:"source_type"`
+	Source             string                        `json:"source"`
+	StorageRoot        string                        `json:"storage_root"`
+	TargetPath         *string                       `json:"target_path"`
+	BandwidthLimitKBps *int                          `json:"bandwidth_limit_kbps"`
+	BandwidthSchedule  *[]ReplicationBandwidthWindow `json:"bandwidth_schedule"`
+	Enabled            *bool                         `json:"enabled"`
+}
+
+// ReplicationItem is a remote file a rule has copied or tried to copy.
+type ReplicationItem struct {
+	ID           int64     `json:"id"`
+	RuleID       int64     `json:"rule_id"`
+	RemoteItemID int64     `json:"remote_item_id"`
+	RemoteFileID int64     `json:"remote_file_id"`
+	LocalPath    string    `json:"local_path"`
+	Size         int64     `json:"size"`
+	RemoteHash   string    `json:"remote_hash,omitempty"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	ReplicatedAt time.Time `json:"replicated_at"`
+}
+
+// replicationStorage opens the local storage roots rules copy into.
+type replicationStorage interface {
+	Provider(ctx context.Context, storageRoot string) (StorageProvider, error)
+}
+
+// ReplicationService copies chosen collections and sections of federated
+// remotes to local storage, so a machine that travels can keep a subset
+// of the main library. Files are downloaded over the remote's
+// authenticated API within the rule's bandwidth schedule and verified
+// against the remote's size and quick hash.
+type ReplicationService struct {
+	db         *database.DB
+	logger     *zap.Logger
+	federation *FederationService
+	storage    replicationStorage
+	interval   time.Duration
+
+	runningMu sync.Mutex
+	running   map[int64]bool
+
+	mu     sync.Mutex
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	now    func() time.Time
+}
+
+// NewReplicationService creates a ReplicationService. Enabled rules run
+// every interval, hourly when interval is zero.
+func NewReplicationService(db *database.DB, logger *zap.Logger, federation *FederationService, storage replicationStorage, interval time.Duration) *ReplicationService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ReplicationService{
+		db:         db,
+		logger:     logger,
+		federation: federation,
+		storage:    storage,
+		interval:   interval,
+		running:    make(map[int64]bool),
+		ctx:        ctx,
+		cancel:     cancel,
+		now:        time.Now,
+	}
+}
+
+const replicationRuleColumns = `id, remote_id, name, source_type, source, storage_root, target_path,
+	bandwidth_limit_kbps, bandwidth_schedule, enabled, last_run_at, last_run_status, last_run_error,
+	last_run_files, last_run_bytes, created_at, updated_at`
+
+func (s *ReplicationService) scanRule(row federationRowScanner) (*ReplicationRule, error) {
+	var rule ReplicationRule
+	var schedule string
+	var lastRun sql.NullTime
+	var lastStatus, lastError sql.NullString
+	if err := row.Scan(&rule.ID, &rule.RemoteID, &rule.Name, &rule.SourceType, &rule.Source,
+		&rule.StorageRoot, &rule.TargetPath, &rule.BandwidthLimitKBps, &schedule, &rule.Enabled,
+		&lastRun, &lastStatus, &lastError, &rule.LastRunFiles, &rule.LastRunBytes,
+		&rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(schedule), &rule.BandwidthSchedule); err != nil {
+		s.logger.Warn("Ignoring invalid replication schedule", zap.Int64("rule_id", rule.ID), zap.Error(err))
+	}
+	if rule.BandwidthSchedule == nil {
+		rule.BandwidthSchedule = []ReplicationBandwidthWindow{}
+	}
+	if lastRun.Valid {
+		rule.LastRunAt = &lastRun.Time
+	}
+	rule.LastRunStatus = lastStatus.String
+	rule.LastRunError = lastError.String
+	rule.Running = s.isRunning(rule.ID)
+	return &rule, nil
+}
+
+// ListRules returns the replication rules by name.
+func (s *ReplicationService) ListRules(ctx context.Context) ([]ReplicationRule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+replicationRuleColumns+` FROM replication_rules ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replication rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []ReplicationRule{}
+	for rows.Next() {
+		rule, err := s.scanRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan replication rule: %w", err)
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetRule returns a replication rule.
+func (s *ReplicationService) GetRule(ctx context.Context, id int64) (*ReplicationRule, error) {
+	rule, err := s.scanRule(s.db.QueryRowContext(ctx,
+		`SELECT `+replicationRuleColumns+` FROM replication_rules WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("replication rule not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replication rule: %w", err)
+	}
+	return rule, nil
+}
+
+// parseReplicationClock parses "HH:MM" into minutes since midnight.
+func parseReplicationClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *ReplicationService) validateRule(ctx context.Context, rule *ReplicationRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("invalid replication rule: name is required")
+	}
+	switch rule.SourceType {
+	case ReplicationSourceCollection:
+		if id, err := strconv.ParseInt(rule.Source, 10, 64); err != nil || id <= 0 {
+			return fmt.Errorf("invalid replication rule: source must be a remote collection ID")
+		}
+	case ReplicationSourceSection:
+		if strings.TrimSpace(rule.Source) == "" {
+			return fmt.Errorf("invalid replication rule: source must name a media type")
+		}
+	default:
+		return fmt.Errorf("invalid replication rule: source_type must be %s or %s",
+			ReplicationSourceCollection, ReplicationSourceSection)
+	}
+	if rule.StorageRoot == "" {
+		return fmt.Errorf("invalid replication rule: storage_root is required")
+	}
+	rule.TargetPath = strings.Trim(path.Clean("/"+rule.TargetPath), "/")
+	if rule.BandwidthLimitKBps < 0 {
+		return fmt.Errorf("invalid replication rule: bandwidth_limit_kbps must not be negative")
+	}
+	for _, w := range rule.BandwidthSchedule {
+		if _, err := parseReplicationClock(w.Start); err != nil {
+			return fmt.Errorf("invalid replication rule: schedule window start: %w", err)
+		}
+		if _, err := parseReplicationClock(w.End); err != nil {
+			return fmt.Errorf("invalid replication rule: schedule window end: %w", err)
+		}
+		if w.LimitKBps < 0 {
+			return fmt.Errorf("invalid replication rule: schedule window limit_kbps must not be negative")
+		}
+		if _, err := models.LoadTimeZone(w.TimeZone); err != nil {
+			return fmt.Errorf("invalid replication rule: schedule window: %w", err)
+		}
+		for _, d := range w.Days {
+			if _, ok := replicationWeekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("invalid replication rule: unknown day %q", d)
+			}
+		}
+	}
+	if _, err := s.federation.GetRemote(ctx, rule.RemoteID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return fmt.Errorf("invalid replication rule: remote library %d not found", rule.RemoteID)
+		}
+		return err
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM replication_rules WHERE name = ? AND id <> ?`, rule.Name, rule.ID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check replication rule name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("replication rule %s already exists", rule.Name)
+	}
+	return nil
+}
+
+// applyTo copies the fields set in req onto rule.
+func (req ReplicationRuleRequest) applyTo(rule *ReplicationRule) {
+	if req.RemoteID != 0 {
+		rule.RemoteID = req.RemoteID
+	}
+	if req.Name != "" {
+		rule.Name = req.Name
+	}
+	if req.SourceType != "" {
+		rule.SourceType = req.SourceType
+	}
+	if req.Source != "" {
+		rule.Source = req.Source
+	}
+	if req.StorageRoot != "" {
+		rule.StorageRoot = req.StorageRoot
+	}
+	if req.TargetPath != nil {
+		rule.TargetPath = *req.TargetPath
+	}
+	if req.BandwidthLimitKBps != nil {
+		rule.BandwidthLimitKBps = *req.BandwidthLimitKBps
+	}
+	if req.BandwidthSchedule != nil {
+		rule.BandwidthSchedule = *req.BandwidthSchedule
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+}
+
+// CreateRule adds a replication rule. It first runs on the next schedule
+// tick or when started by hand.
+func (s *ReplicationService) CreateRule(ctx context.Context, req ReplicationRuleRequest) (*ReplicationRule, error) {
+	rule := &ReplicationRule{Enabled: true, BandwidthSchedule: []ReplicationBandwidthWindow{}}
+	req.applyTo(rule)
+	if err := s.validateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	schedule, err := json.Marshal(rule.BandwidthSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bandwidth schedule: %w", err)
+	}
+
+	now := s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO replication_rules (remote_id, name, source_type, source, storage_root, target_path,
+			bandwidth_limit_kbps, bandwidth_schedule, enabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.RemoteID, rule.Name, rule.SourceType, rule.Source, rule.StorageRoot, rule.TargetPath,
+		rule.BandwidthLimitKBps, string(schedule), rule.Enabled, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replication rule: %w", err)
+	}
+	return s.GetRule(ctx, id)
+}
+
+// UpdateRule changes a rule's settings. Files already copied stay where
+// they are.
+func (s *ReplicationService) UpdateRule(ctx context.Context, id int64, req ReplicationRuleRequest) (*ReplicationRule, error) {
+	rule, err := s.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	req.applyTo(rule)
+	if err := s.validateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	schedule, err := json.Marshal(rule.BandwidthSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bandwidth schedule: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE replication_rules SET remote_id = ?, name = ?, source_type = ?, source = ?, storage_root = ?,
+			target_path = ?, bandwidth_limit_kbps = ?, bandwidth_schedule = ?, enabled = ?, updated_at = ?
+		 WHERE id = ?`,
+		rule.RemoteID, rule.Name, rule.SourceType, rule.Source, rule.StorageRoot, rule.TargetPath,
+		rule.BandwidthLimitKBps, string(schedule), rule.Enabled, s.now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update replication rule: %w", err)
+	}
+	return s.GetRule(ctx, id)
+}
+
+// DeleteRule removes a rule and its file records. Copied files are left
+// in local storage.
+func (s *ReplicationService) DeleteRule(ctx context.Context, id int64) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM replication_items WHERE rule_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete replication items: %w", err)
+	}
+	result, err := s.db.ExecContext(ctx, `DELETE FROM replication_rules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete replication rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("replication rule not found")
+	}
+	return nil
+}
+
+// ListItems returns the files a rule has copied or failed to copy,
+// newest first; status narrows the list to one state.
+func (s *ReplicationService) ListItems(ctx context.Context, ruleID int64, status string, limit, offset int) ([]ReplicationItem, int, error) {
+	if _, err := s.GetRule(ctx, ruleID); err != nil {
+		return nil, 0, err
+	}
+	where := `WHERE rule_id = ?`
+	args := []interface{}{ruleID}
+	if status != "" {
+		where += ` AND status = ?`
+		args = append(args, status)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM replication_items `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count replication items: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, rule_id, remote_item_id, remote_file_id, local_path, size, remote_hash, status, error, replicated_at
+		 FROM replication_items `+where+` ORDER BY replicated_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list replication items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []ReplicationItem{}
+	for rows.Next() {
+		var item ReplicationItem
+		var hash, itemErr sql.NullString
+		if err := rows.Scan(&item.ID, &item.RuleID, &item.RemoteItemID, &item.RemoteFileID, &item.LocalPath,
+			&item.Size, &hash, &item.Status, &itemErr, &item.ReplicatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan replication item: %w", err)
+		}
+		item.RemoteHash, item.Error = hash.String, itemErr.String
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+func (s *ReplicationService) isRunning(id int64) bool {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	return s.running[id]
+}
+
+// claim marks a rule as running, failing when a run is in progress.
+func (s *ReplicationService) claim(rule *ReplicationRule) error {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	if s.running[rule.ID] {
+		return fmt.Errorf("replication rule %s is already running", rule.Name)
+	}
+	s.running[rule.ID] = true
+	return nil
+}
+
+func (s *ReplicationService) release(id int64) {
+	s.runningMu.Lock()
+	delete(s.running, id)
+	s.runningMu.Unlock()
+}
+
+// RunRule runs a rule now and waits for it to finish. Manual runs ignore
+// pause windows but keep the schedule's bandwidth limits.
+func (s *ReplicationService) RunRule(ctx context.Context, id int64) (*ReplicationRule, error) {
+	rule, err := s.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.claim(rule); err != nil {
+		return nil, err
+	}
+	defer s.release(rule.ID)
+	if err := s.run(ctx, rule, false); err != nil {
+		return nil, err
+	}
+	return s.GetRule(ctx, id)
+}
+
+// StartRule runs a rule in the background, as RunRule does. Stop
+// cancels runs still in progress.
+func (s *ReplicationService) StartRule(ctx context.Context, id int64) (*ReplicationRule, error) {
+	rule, err := s.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.claim(rule); err != nil {
+		return nil, err
+	}
+	rule.Running = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.release(rule.ID)
+		if err := s.run(s.ctx, rule, false); err != nil {
+			s.logger.Warn("Replication run failed", zap.String("rule", rule.Name), zap.Error(err))
+		}
+	}()
+	return rule, nil
+}
+
+// RunAll runs every enabled rule that is not already running and whose
+// schedule does not pause it now, logging failures.
+func (s *ReplicationService) RunAll(ctx context.Context) {
+	rules, err := s.ListRules(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list replication rules", zap.Error(err))
+		return
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		if _, paused := replicationLimit(rule, s.now()); paused {
+			continue
+		}
+		if err := s.claim(rule); err != nil {
+			continue
+		}
+		if err := s.run(ctx, rule, true); err != nil {
+			s.logger.Warn("Replication run failed", zap.String("rule", rule.Name), zap.Error(err))
+		}
+		s.release(rule.ID)
+	}
+}
+
+// Start runs enabled rules on the configured interval until Stop is
+// called.
+func (s *ReplicationService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunAll(s.ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule, cancels runs in progress and waits for them to
+// wind down. Partly copied files are fetched again on the next run.
+func (s *ReplicationService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// replicationLimit returns the bandwidth cap in bytes per second that
+// applies to rule at t, and whether a pause window is open. The first
+// matching window wins; outside every window the rule's own limit applies.
+func replicationLimit(rule *ReplicationRule, t time.Time) (int64, bool) {
+	for _, w := range rule.BandwidthSchedule {
+		start, err1 := parseReplicationClock(w.Start)
+		end, err2 := parseReplicationClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		local := t
+		if w.TimeZone != "" {
+			loc, err := models.LoadTimeZone(w.TimeZone)
+			if err != nil {
+				continue
+			}
+			local = t.In(loc)
+		}
+		minute := local.Hour()*60 + local.Minute()
+
+		// For windows wrapping midnight, the part after midnight belongs to
+		// the window that started the previous day.
+		day := local.Weekday()
+		var inside bool
+		switch {
+		case start <= end:
+			inside = minute >= start && minute < end
+		case minute >= start:
+			inside = true
+		case minute < end:
+			inside = true
+			day = (day + 6) % 7
+		}
+		if inside && replicationWindowAppliesOn(w, day) {
+			return int64(w.LimitKBps) * 1024, w.Pause
+		}
+	}
+	return int64(rule.BandwidthLimitKBps) * 1024, false
+}
+
+func replicationWindowAppliesOn(w ReplicationBandwidthWindow, day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if replicationWeekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// replicationReader paces a download to the limit the bandwidth schedule
+// sets at each read, so windows that open mid-transfer take effect. It
+// fails with errReplicationPaused when a pause window opens.
+type replicationReader struct {
+	r           io.Reader
+	limit       func() (int64, bool)
+	bytesPerSec int64
+	start       time.Time
+	read        int64
+}
+
+func (t *replicationReader) Read(p []byte) (int, error) {
+	bytesPerSec, paused := t.limit()
+	if paused {
+		return 0, errReplicationPaused
+	}
+	if bytesPerSec != t.bytesPerSec || t.start.IsZero() {
+		t.bytesPerSec, t.start, t.read = bytesPerSec, time.Now(), 0
+	}
+	if bytesPerSec <= 0 {
+		return t.r.Read(p)
+	}
+	// Keep individual reads to roughly a tenth of a second's worth of data
+	// so pacing stays smooth.
+	if chunk := bytesPerSec / 10; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	expected := time.Duration(float64(t.read) / float64(bytesPerSec) * float64(time.Second))
+	if elapsed := time.Since(t.start); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+	return n, err
+}
+
+// replicationFile is a remote file selected by a rule.
+type replicationFile struct {
+	itemID int64
+	fileID int64
+	path   string
+	size   int64
+	hash   string
+}
+
+// replicationRun tallies one run of a rule.
+type replicationRun struct {
+	files  int
+	bytes  int64
+	failed int
+	paused bool
+}
+
+// run copies the rule's files and records the outcome on the rule. An
+// error means the run could not start or list the remote; failures of
+// single files are recorded on their items.
+func (s *ReplicationService) run(ctx context.Context, rule *ReplicationRule, scheduled bool) error {
+	result, err := s.copyRule(ctx, rule, scheduled)
+	status, message := ReplicationStatusCompleted, ""
+	switch {
+	case err != nil:
+		status, message = ReplicationStatusFailed, err.Error()
+	case result.paused:
+		status = ReplicationStatusPaused
+	case result.failed > 0:
+		status, message = ReplicationStatusPartial, fmt.Sprintf("%d files failed to replicate", result.failed)
+	}
+	if _, recErr := s.db.ExecContext(context.Background(),
+		`UPDATE replication_rules SET last_run_at = ?, last_run_status = ?, last_run_error = ?,
+			last_run_files = ?, last_run_bytes = ? WHERE id = ?`,
+		s.now(), status, message, result.files, result.bytes, rule.ID); recErr != nil {
+		s.logger.Warn("Failed to record replication run", zap.Int64("rule_id", rule.ID), zap.Error(recErr))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to replicate %s: %w", rule.Name, err)
+	}
+	s.logger.Info("Replication run finished", zap.String("rule", rule.Name), zap.String("status", status),
+		zap.Int("files", result.files), zap.Int64("bytes", result.bytes))
+	return nil
+}
+
+func (s *ReplicationService) copyRule(ctx context.Context, rule *ReplicationRule, scheduled bool) (replicationRun, error) {
+	var result replicationRun
+	remote, err := s.federation.enabledRemote(ctx, rule.RemoteID)
+	if err != nil {
+		return result, err
+	}
+	if s.storage == nil {
+		return result, fmt.Errorf("storage providers not configured")
+	}
+	ctx = WithIOPriority(ctx, IOPriorityTransfer)
+	provider, err := s.storage.Provider(ctx, rule.StorageRoot)
+	if err != nil {
+		return result, err
+	}
+	defer provider.Close()
+
+	files, err := s.remoteFiles(ctx, remote, rule)
+	if err != nil {
+		return result, err
+	}
+
+	limit := func() (int64, bool) {
+		bytesPerSec, paused := replicationLimit(rule, s.now())
+		if paused && !scheduled {
+			// Manual runs go ahead at the rule's own limit.
+			return int64(rule.BandwidthLimitKBps) * 1024, false
+		}
+		return bytesPerSec, paused
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if _, paused := limit(); paused {
+			result.paused = true
+			return result, nil
+		}
+		if s.upToDate(ctx, provider, rule, file) {
+			continue
+		}
+
+		localPath := path.Join(rule.TargetPath, path.Clean("/"+file.path))
+		localPath = strings.TrimPrefix(localPath, "/")
+		copyErr := s.copyFile(ctx, remote, provider, file, localPath, limit)
+		if errors.Is(copyErr, errReplicationPaused) {
+			result.paused = true
+			return result, nil
+		}
+		if copyErr != nil && ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if err := s.recordItem(ctx, rule.ID, file, localPath, copyErr); err != nil {
+			return result, err
+		}
+		if copyErr != nil {
+			result.failed++
+			s.logger.Warn("Failed to replicate file", zap.String("rule", rule.Name),
+				zap.String("path", file.path), zap.Error(copyErr))
+			continue
+		}
+		result.files++
+		result.bytes += file.size
+	}
+	return result, nil
+}
+
+// upToDate reports whether a file was copied by an earlier run and the
+// copy still has the remote's size and hash.
+func (s *ReplicationService) upToDate(ctx context.Context, provider StorageProvider, rule *ReplicationRule, file replicationFile) bool {
+	var localPath string
+	var size int64
+	var hash sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT local_path, size, remote_hash FROM replication_items WHERE rule_id = ? AND remote_file_id = ? AND status = ?`,
+		rule.ID, file.fileID, ReplicationItemCopied).Scan(&localPath, &size, &hash)
+	if err != nil || size != file.size || hash.String != file.hash {
+		return false
+	}
+	info, err := provider.Stat(ctx, localPath)
+	return err == nil && info.Size == file.size
+}
+
+// copyFile downloads a remote file into local storage and verifies the
+// copy, removing it when it does not match.
+func (s *ReplicationService) copyFile(ctx context.Context, remote *FederationRemote, provider StorageProvider, file replicationFile, localPath string, limit func() (int64, bool)) error {
+	resp, err := s.federation.remoteRequest(ctx, s.federation.streamClient, remote,
+		fmt.Sprintf("/api/v1/download/file/%d", file.fileID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	if err := provider.Write(ctx, localPath, &replicationReader{r: resp.Body, limit: limit}); err != nil {
+		provider.Delete(ctx, localPath)
+		return err
+	}
+	if err := verifyReplicatedFile(ctx, provider, file, localPath); err != nil {
+		provider.Delete(ctx, localPath)
+		return err
+	}
+	return nil
+}
+
+// verifyReplicatedFile checks a copy against the remote's size and, when
+// the remote has hashed the file, its quick hash.
+func verifyReplicatedFile(ctx context.Context, provider StorageProvider, file replicationFile, localPath string) error {
+	info, err := provider.Stat(ctx, localPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	if info.Size != file.size {
+		return fmt.Errorf("verification failed: copied %d bytes, remote has %d", info.Size, file.size)
+	}
+	if file.hash == "" {
+		return nil
+	}
+	hash, err := QuickHash(ctx, provider, localPath, file.size)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+	if hash != file.hash {
+		return fmt.Errorf("verification failed: hash %s does not match remote hash %s", hash, file.hash)
+	}
+	return nil
+}
+
+func (s *ReplicationService) recordItem(ctx context.Context, ruleID int64, file replicationFile, localPath string, copyErr error) error {
+	status, message := ReplicationItemCopied, sql.NullString{}
+	if copyErr != nil {
+		status, message = ReplicationItemFailed, sql.NullString{String: copyErr.Error(), Valid: true}
+	}
+	hash := sql.NullString{String: file.hash, Valid: file.hash != ""}
+	now := s.now()
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE replication_items SET remote_item_id = ?, local_path = ?, size = ?, remote_hash = ?, status = ?,
+			error = ?, replicated_at = ? WHERE rule_id = ? AND remote_file_id = ?`,
+		file.itemID, localPath, file.size, hash, status, message, now, ruleID, file.fileID)
+	if err != nil {
+		return fmt.Errorf("failed to record replicated file: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO replication_items (rule_id, remote_item_id, remote_file_id, local_path, size, remote_hash,
+			status, error, replicated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ruleID, file.itemID, file.fileID, localPath, file.size, hash, status, message, now); err != nil {
+		return fmt.Errorf("failed to record replicated file: %w", err)
+	}
+	return nil
+}
+
+// remoteFiles lists the files a rule selects: the entities of the
+// collection or section, their children (seasons, episodes, tracks) and
+// the files linked to each.
+func (s *ReplicationService) remoteFiles(ctx context.Context, remote *FederationRemote, rule *ReplicationRule) ([]replicationFile, error) {
+	roots, err := s.remoteEntities(ctx, remote, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool)
+	seenFiles := make(map[int64]bool)
+	var files []replicationFile
+	for queue := roots; len(queue) > 0; {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		children, err := s.remoteChildren(ctx, remote, id)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, children...)
+
+		var linked struct {
+			Files []struct {
+				FileID int64 `json:"FileID"`
+			} `json:"files"`
+		}
+		if err := s.federation.remoteJSON(ctx, remote, fmt.Sprintf("/api/v1/entities/%d/files", id), &linked); err != nil {
+			return nil, err
+		}
+		for _, f := range linked.Files {
+			if seenFiles[f.FileID] {
+				continue
+			}
+			seenFiles[f.FileID] = true
+			var info struct {
+				Path        string  `json:"path"`
+				Size        int64   `json:"size"`
+				Hash        *string `json:"hash"`
+				IsDirectory bool    `json:"is_directory"`
+			}
+			if err := s.federation.remoteJSON(ctx, remote, fmt.Sprintf("/api/v1/catalog-info/%d", f.FileID), &info); err != nil {
+				return nil, err
+			}
+			if info.IsDirectory || info.Path == "" {
+				continue
+			}
+			file := replicationFile{itemID: id, fileID: f.FileID, path: info.Path, size: info.Size}
+			if info.Hash != nil {
+				file.hash = *info.Hash
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// remoteEntities lists the top-level entities a rule selects.
+func (s *ReplicationService) remoteEntities(ctx context.Context, remote *FederationRemote, rule *ReplicationRule) ([]int64, error) {
+	var ids []int64
+	if rule.SourceType == ReplicationSourceCollection {
+		for offset := 0; ; {
+			var page struct {
+				MediaItemIDs []int64 `json:"media_item_ids"`
+				Total        int     `json:"total"`
+			}
+			params := url.Values{}
+			params.Set("limit", strconv.Itoa(federationPageSize))
+			params.Set("offset", strconv.Itoa(offset))
+			if err := s.federation.remoteJSON(ctx, remote,
+				"/api/v1/collections/"+rule.Source+"/items?"+params.Encode(), &page); err != nil {
+				if strings.Contains(err.Error(), "not found") {
+					return nil, fmt.Errorf("remote collection %s not found", rule.Source)
+				}
+				return nil, err
+			}
+			ids = append(ids, page.MediaItemIDs...)
+			offset += len(page.MediaItemIDs)
+			if len(page.MediaItemIDs) == 0 || offset >= page.Total {
+				return ids, nil
+			}
+		}
+	}
+
+	typeNames, err := s.federation.remoteTypes(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	known := false
+	for _, name := range typeNames {
+		known = known || name == rule.Source
+	}
+	if !known {
+		return nil, fmt.Errorf("remote has no %s section", rule.Source)
+	}
+	for offset := 0; ; {
+		page, total, err := s.federation.remotePage(ctx, remote, typeNames, "", rule.Source, federationPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page {
+			ids = append(ids, item.ID)
+		}
+		offset += len(page)
+		if len(page) == 0 || offset >= total {
+			return ids, nil
+		}
+	}
+}
+
+// remoteChildren lists the IDs of an entity's direct children.
+func (s *ReplicationService) remoteChildren(ctx context.Context, remote *FederationRemote, id int64) ([]int64, error) {
+	var ids []int64
+	for offset := 0; ; {
+		var page struct {
+			Items []struct {
+				ID int64 `json:"id"`
+			} `json:"items"`
+			Total int `json:"total"`
+		}
+		endpoint := fmt.Sprintf("/api/v1/entities/%d/children?limit=%d&offset=%d", id, federationPageSize, offset)
+		if err := s.federation.remoteJSON(ctx, remote, endpoint, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			ids = append(ids, item.ID)
+		}
+		offset += len(page.Items)
+		if len(page.Items) == 0 || offset >= page.Total {
+			return ids, nil
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeReplicationRemote serves a small library: movies Alien (1) and
+// Heat (2), and the show The Wire (10) with one episode (11). Collection
+// 5 holds Heat and The Wire.
+type fakeReplicationRemote struct {
+	mu        sync.Mutex
+	dir       string
+	hashes    map[int64]string
+	downloads map[int64]int
+}
+
+var fakeReplicationFiles = map[int64]struct {
+	entity int64
+	path   string
+	body   string
+}{
+	21: {1, "Movies/Alien.mkv", "alien"},
+	20: {2, "Movies/Heat.mkv", "heat heat heat"},
+	31: {11, "Shows/The Wire/S01E01.mkv", "episode one"},
+}
+
+func (f *fakeReplicationRemote) downloadCount(fileID int64) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.downloads[fileID]
+}
+
+func (f *fakeReplicationRemote) setHash(fileID int64, hash string) {
+	f.mu.Lock()
+	f.hashes[fileID] = hash
+	f.mu.Unlock()
+}
+
+func (f *fakeReplicationRemote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/api/v1/auth/login" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"session_token": "token", "expires_at": time.Now().Add(time.Hour)})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+	var id int64
+	switch {
+	case path == "entities/types":
+		json.NewEncoder(w).Encode(map[string]interface{}{"types": []map[string]interface{}{
+			{"id": 1, "name": "movie"}, {"id": 3, "name": "tv_show"},
+		}})
+	case path == "entities":
+		items := []map[string]interface{}{}
+		if r.URL.Query().Get("type") == "movie" {
+			items = []map[string]interface{}{{"id": 1, "media_type_id": 1, "title": "Alien"}, {"id": 2, "media_type_id": 1, "title": "Heat"}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "total": len(items)})
+	case path == "collections/5/items":
+		json.NewEncoder(w).Encode(map[string]interface{}{"media_item_ids": []int64{2, 10}, "total": 2})
+	case scanPath(path, "entities/%d/children", &id):
+		items := []map[string]interface{}{}
+		if id == 10 {
+			items = append(items, map[string]interface{}{"id": 11, "title": "Episode 1"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "total": len(items)})
+	case scanPath(path, "entities/%d/files", &id):
+		files := []map[string]interface{}{}
+		for fileID, file := range fakeReplicationFiles {
+			if file.entity == id {
+				files = append(files, map[string]interface{}{"ID": 1, "MediaItemID": id, "FileID": fileID, "IsPrimary": true})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files, "total": len(files)})
+	case scanPath(path, "catalog-info/%d", &id):
+		file := fakeReplicationFiles[id]
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "path": file.path, "size": len(file.body), "hash": f.hashes[id]})
+	case scanPath(path, "download/file/%d", &id):
+		f.downloads[id]++
+		http.ServeFile(w, r, filepath.Join(f.dir, filepath.FromSlash(fakeReplicationFiles[id].path)))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func scanPath(path, format string, id *int64) bool {
+	n, err := fmt.Sscanf(path, format, id)
+	return err == nil && n == 1 && fmt.Sprintf(format, *id) == path
+}
+
+type replicationFixture struct {
+	service  *ReplicationService
+	remote   *fakeReplicationRemote
+	remoteID int64
+	localDir string
+}
+
+func newReplicationFixture(t *testing.T) *replicationFixture {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT);
+		CREATE TABLE federation_remotes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, base_url TEXT NOT NULL,
+			username TEXT NOT NULL, password TEXT NOT NULL, mode TEXT NOT NULL DEFAULT 'mirror',
+			enabled BOOLEAN NOT NULL DEFAULT TRUE, item_count INTEGER NOT NULL DEFAULT 0,
+			last_synced_at DATETIME, last_sync_error TEXT, created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL);
+		CREATE TABLE replication_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, remote_id INTEGER NOT NULL, name TEXT NOT NULL UNIQUE,
+			source_type TEXT NOT NULL, source TEXT NOT NULL, storage_root TEXT NOT NULL,
+			target_path TEXT NOT NULL DEFAULT '', bandwidth_limit_kbps INTEGER NOT NULL DEFAULT 0,
+			bandwidth_schedule TEXT NOT NULL DEFAULT '[]', enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			last_run_at DATETIME, last_run_status TEXT, last_run_error TEXT,
+			last_run_files INTEGER NOT NULL DEFAULT 0, last_run_bytes INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL);
+		CREATE TABLE replication_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, rule_id INTEGER NOT NULL, remote_item_id INTEGER NOT NULL,
+			remote_file_id INTEGER NOT NULL, local_path TEXT NOT NULL, size INTEGER NOT NULL DEFAULT 0,
+			remote_hash TEXT, status TEXT NOT NULL, error TEXT, replicated_at DATETIME NOT NULL,
+			UNIQUE (rule_id, remote_file_id))`)
+	require.NoError(t, err)
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+
+	// The remote's files and the quick hashes its scanner would record
+	remoteDir := t.TempDir()
+	remoteFS := NewLocalStorageProvider(connectedLocalClient(t, remoteDir), remoteDir)
+	fake := &fakeReplicationRemote{dir: remoteDir, hashes: map[int64]string{}, downloads: map[int64]int{}}
+	for fileID, file := range fakeReplicationFiles {
+		full := filepath.Join(remoteDir, filepath.FromSlash(file.path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		require.NoError(t, os.WriteFile(full, []byte(file.body), 0o644))
+		hash, err := QuickHash(context.Background(), remoteFS, file.path, int64(len(file.body)))
+		require.NoError(t, err)
+		fake.hashes[fileID] = hash
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	localDir := t.TempDir()
+	_, err = db.Exec(`INSERT INTO storage_roots (name, protocol, path) VALUES ('travel', 'local', ?)`, localDir)
+	require.NoError(t, err)
+
+	federation := NewFederationService(db, nil, FederationConfig{SigningKey: "test-key"})
+	remote, err := federation.CreateRemote(context.Background(), FederationRemoteRequest{
+		Name: "Home", BaseURL: server.URL, Username: "mirror", Password: "secret", Mode: FederationModeProxy})
+	require.NoError(t, err)
+
+	service := NewReplicationService(db, nil, federation,
+		NewStorageProviderFactory(db, localRootClients{}, zap.NewNop()), time.Hour)
+	t.Cleanup(service.Stop)
+	return &replicationFixture{service: service, remote: fake, remoteID: remote.ID, localDir: localDir}
+}
+
+func (f *replicationFixture) localFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(f.localDir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestReplication_RuleValidation(t *testing.T) {
+	f := newReplicationFixture(t)
+	ctx := context.Background()
+
+	valid := ReplicationRuleRequest{RemoteID: f.remoteID, Name: "Laptop", SourceType: ReplicationSourceCollection,
+		Source: "5", StorageRoot: "travel"}
+	for _, change := range []func(*ReplicationRuleRequest){
+		func(r *ReplicationRuleRequest) { r.Name = " " },
+		func(r *ReplicationRuleRequest) { r.SourceType = "playlist" },
+		func(r *ReplicationRuleRequest) { r.Source = "heat" },
+		func(r *ReplicationRuleRequest) { r.RemoteID = 99 },
+		func(r *ReplicationRuleRequest) { r.StorageRoot = "" },
+		func(r *ReplicationRuleRequest) {
+			r.BandwidthSchedule = &[]ReplicationBandwidthWindow{{Start: "9am", End: "17:00"}}
+		},
+		func(r *ReplicationRuleRequest) {
+			r.BandwidthSchedule = &[]ReplicationBandwidthWindow{{Days: []string{"someday"}, Start: "09:00", End: "17:00"}}
+		},
+	} {
+		req := valid
+		change(&req)
+		_, err := f.service.CreateRule(ctx, req)
+		assert.ErrorContains(t, err, "invalid replication rule")
+	}
+
+	target := "/Travel/../Library/"
+	valid.TargetPath = &target
+	rule, err := f.service.CreateRule(ctx, valid)
+	require.NoError(t, err)
+	assert.Equal(t, "Library", rule.TargetPath)
+	assert.True(t, rule.Enabled)
+	assert.Empty(t, rule.BandwidthSchedule)
+	_, err = f.service.CreateRule(ctx, valid)
+	assert.ErrorContains(t, err, "already exists")
+
+	limit := 512
+	rule, err = f.service.UpdateRule(ctx, rule.ID, ReplicationRuleRequest{BandwidthLimitKBps: &limit})
+	require.NoError(t, err)
+	assert.Equal(t, 512, rule.BandwidthLimitKBps)
+	assert.Equal(t, "5", rule.Source)
+
+	require.NoError(t, f.service.DeleteRule(ctx, rule.ID))
+	assert.ErrorContains(t, f.service.DeleteRule(ctx, rule.ID), "not found")
+}
+
+func TestReplication_CollectionRunAndVerification(t *testing.T) {
+	f := newReplicationFixture(t)
+	ctx := context.Background()
+
+	target := "Home"
+	rule, err := f.service.CreateRule(ctx, ReplicationRuleRequest{RemoteID: f.remoteID, Name: "Laptop",
+		SourceType: ReplicationSourceCollection, Source: "5", StorageRoot: "travel", TargetPath: &target})
+	require.NoError(t, err)
+
+	// Heat and the episode of The Wire are copied, Alien is not in the collection
+	rule, err = f.service.RunRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationStatusCompleted, rule.LastRunStatus)
+	assert.Equal(t, 2, rule.LastRunFiles)
+	assert.Equal(t, int64(len("heat heat heat")+len("episode one")), rule.LastRunBytes)
+	assert.Equal(t, "heat heat heat", f.localFile(t, "Home/Movies/Heat.mkv"))
+	assert.Equal(t, "episode one", f.localFile(t, "Home/Shows/The Wire/S01E01.mkv"))
+	assert.Empty(t, f.localFile(t, "Home/Movies/Alien.mkv"))
+
+	// Verified copies are not fetched again
+	rule, err = f.service.RunRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rule.LastRunFiles)
+	assert.Equal(t, 1, f.remote.downloadCount(20))
+
+	// A copy that does not match the remote's hash is discarded
+	f.remote.setHash(20, "0000000000000000")
+	rule, err = f.service.RunRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationStatusPartial, rule.LastRunStatus)
+	assert.Equal(t, 2, f.remote.downloadCount(20))
+	assert.Empty(t, f.localFile(t, "Home/Movies/Heat.mkv"))
+
+	failed, total, err := f.service.ListItems(ctx, rule.ID, ReplicationItemFailed, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, failed, 1)
+	assert.Equal(t, int64(20), failed[0].RemoteFileID)
+	assert.Contains(t, failed[0].Error, "verification failed")
+	_, total, err = f.service.ListItems(ctx, rule.ID, "", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
+
+func TestReplication_SectionRunAndSchedule(t *testing.T) {
+	f := newReplicationFixture(t)
+	ctx := context.Background()
+
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC) // a Wednesday
+	f.service.now = func() time.Time { return now }
+	schedule := []ReplicationBandwidthWindow{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00", Pause: true},
+		{Start: "22:00", End: "06:00", LimitKBps: 4096},
+	}
+	rule, err := f.service.CreateRule(ctx, ReplicationRuleRequest{RemoteID: f.remoteID, Name: "Movies",
+		SourceType: ReplicationSourceSection, Source: "movie", StorageRoot: "travel", BandwidthSchedule: &schedule})
+	require.NoError(t, err)
+
+	_, paused := replicationLimit(rule, now)
+	assert.True(t, paused)
+	limit, paused := replicationLimit(rule, time.Date(2026, 3, 5, 2, 0, 0, 0, time.UTC))
+	assert.False(t, paused)
+	assert.Equal(t, int64(4096*1024), limit)
+	limit, paused = replicationLimit(rule, time.Date(2026, 3, 7, 10, 0, 0, 0, time.UTC))
+	assert.False(t, paused, "the pause window is for weekdays only")
+	assert.Zero(t, limit)
+
+	// 22:00-06:00 on Tokyo's clock is 13:00-21:00 UTC
+	tokyo := &ReplicationRule{BandwidthSchedule: []ReplicationBandwidthWindow{
+		{Start: "22:00", End: "06:00", TimeZone: "Asia/Tokyo", LimitKBps: 512},
+	}}
+	limit, _ = replicationLimit(tokyo, time.Date(2026, 3, 7, 14, 0, 0, 0, time.UTC))
+	assert.Equal(t, int64(512*1024), limit)
+	limit, _ = replicationLimit(tokyo, time.Date(2026, 3, 7, 22, 0, 0, 0, time.UTC))
+	assert.Zero(t, limit)
+
+	// Scheduled runs wait for the pause window to close
+	f.service.RunAll(ctx)
+	rule, err = f.service.GetRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.Nil(t, rule.LastRunAt)
+	assert.Empty(t, f.localFile(t, "Movies/Alien.mkv"))
+
+	now = time.Date(2026, 3, 4, 18, 0, 0, 0, time.UTC)
+	f.service.RunAll(ctx)
+	rule, err = f.service.GetRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationStatusCompleted, rule.LastRunStatus)
+	assert.Equal(t, "alien", f.localFile(t, "Movies/Alien.mkv"))
+	assert.Equal(t, "heat heat heat", f.localFile(t, "Movies/Heat.mkv"))
+
+	missing, err := f.service.CreateRule(ctx, ReplicationRuleRequest{RemoteID: f.remoteID, Name: "Games",
+		SourceType: ReplicationSourceSection, Source: "game", StorageRoot: "travel"})
+	require.NoError(t, err)
+	_, err = f.service.RunRule(ctx, missing.ID)
+	assert.ErrorContains(t, err, "no game section")
+	missing, err = f.service.GetRule(ctx, missing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationStatusFailed, missing.LastRunStatus)
+}
+
+func TestReplication_StartRuleRejectsConcurrentRuns(t *testing.T) {
+	f := newReplicationFixture(t)
+	ctx := context.Background()
+
+	rule, err := f.service.CreateRule(ctx, ReplicationRuleRequest{RemoteID: f.remoteID, Name: "Laptop",
+		SourceType: ReplicationSourceCollection, Source: "5", StorageRoot: "travel"})
+	require.NoError(t, err)
+
+	require.NoError(t, f.service.claim(rule))
+	_, err = f.service.StartRule(ctx, rule.ID)
+	assert.ErrorContains(t, err, "already running")
+	f.service.release(rule.ID)
+
+	started, err := f.service.StartRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.True(t, started.Running)
+	require.Eventually(t, func() bool {
+		rule, err := f.service.GetRule(ctx, rule.ID)
+		return err == nil && !rule.Running && rule.LastRunStatus == ReplicationStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, f.remote.downloadCount(20))
+	assert.Equal(t, 1, f.remote.downloadCount(31))
+}
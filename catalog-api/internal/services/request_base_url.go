@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+	"strings"
+)
+
+type requestBaseURLKey struct{}
+
+// WithRequestBaseURL returns a context carrying the scheme and host a
+// client used to reach the API, e.g. https://media.example.com. Services
+// build absolute URLs from it when no public URL is configured.
+func WithRequestBaseURL(ctx context.Context, baseURL string) context.Context {
+	return context.WithValue(ctx, requestBaseURLKey{}, strings.TrimRight(baseURL, "/"))
+}
+
+// RequestBaseURL returns the base URL stored by WithRequestBaseURL, or ""
+// when there is none.
+func RequestBaseURL(ctx context.Context) string {
+	baseURL, _ := ctx.Value(requestBaseURLKey{}).(string)
+	return baseURL
+}
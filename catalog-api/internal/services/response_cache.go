@@ -0,0 +1,384 @@
+package services
+
+import (
+	"catalogizer/internal/metrics"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Response cache namespaces. Each caches one family of read endpoints and
+// can be purged on its own.
+const (
+	ResponseCacheCatalog = "catalog"
+	ResponseCacheSearch  = "search"
+	ResponseCacheStats   = "stats"
+)
+
+// ResponseCacheNamespaces lists every namespace, in reporting order.
+var ResponseCacheNamespaces = []string{ResponseCacheCatalog, ResponseCacheSearch, ResponseCacheStats}
+
+// Response cache backends.
+const (
+	ResponseCacheBackendMemory = "memory"
+	ResponseCacheBackendRedis  = "redis"
+)
+
+// responseCacheKeyPrefix prefixes every key, so purges never touch the
+// rate limiter's keys sharing the Redis database.
+const responseCacheKeyPrefix = "catalogizer:response:"
+
+// ResponseCacheBackend stores cached responses. Keys are opaque strings;
+// DeletePrefix removes every key starting with prefix and returns how many
+// were removed.
+type ResponseCacheBackend interface {
+	Name() string
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	DeletePrefix(ctx context.Context, prefix string) (int64, error)
+}
+
+// memoryResponseEntry is an entry of the in-memory backend.
+type memoryResponseEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryResponseCacheBackend keeps responses in process, evicting the
+// least recently used entry beyond maxEntries.
+type memoryResponseCacheBackend struct {
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewMemoryResponseCacheBackend creates an in-memory backend holding at
+// most maxEntries responses, or 1000 when it is zero.
+func NewMemoryResponseCacheBackend(maxEntries int) ResponseCacheBackend {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &memoryResponseCacheBackend{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (b *memoryResponseCacheBackend) Name() string { return ResponseCacheBackendMemory }
+
+func (b *memoryResponseCacheBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	elem, ok := b.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryResponseEntry)
+	if !b.now().Before(entry.expiresAt) {
+		b.order.Remove(elem)
+		delete(b.entries, key)
+		return nil, false, nil
+	}
+	b.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (b *memoryResponseCacheBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	expiresAt := b.now().Add(ttl)
+	if elem, ok := b.entries[key]; ok {
+		entry := elem.Value.(*memoryResponseEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		b.order.MoveToFront(elem)
+		return nil
+	}
+	b.entries[key] = b.order.PushFront(&memoryResponseEntry{key: key, value: value, expiresAt: expiresAt})
+	for b.order.Len() > b.maxEntries {
+		oldest := b.order.Back()
+		b.order.Remove(oldest)
+		delete(b.entries, oldest.Value.(*memoryResponseEntry).key)
+	}
+	return nil
+}
+
+func (b *memoryResponseCacheBackend) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var deleted int64
+	for key, elem := range b.entries {
+		if strings.HasPrefix(key, prefix) {
+			b.order.Remove(elem)
+			delete(b.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// redisResponseCacheBackend keeps responses in Redis, shared by every
+// server instance, with Redis expiring them.
+type redisResponseCacheBackend struct {
+	client *redis.Client
+}
+
+// NewRedisResponseCacheBackend creates a backend storing responses in
+// client.
+func NewRedisResponseCacheBackend(client *redis.Client) ResponseCacheBackend {
+	return &redisResponseCacheBackend{client: client}
+}
+
+func (b *redisResponseCacheBackend) Name() string { return ResponseCacheBackendRedis }
+
+func (b *redisResponseCacheBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := b.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (b *redisResponseCacheBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return b.client.Set(ctx, key, value, ttl).Err()
+}
+
+// DeletePrefix scans for the keys rather than using KEYS, so a purge does
+// not block Redis on a large keyspace.
+func (b *redisResponseCacheBackend) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := b.client.Scan(ctx, cursor, prefix+"*", 500).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) > 0 {
+			n, err := b.client.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
+// ResponseCacheConfig sets how long each namespace keeps responses.
+// Responses larger than MaxBodyBytes are not cached.
+type ResponseCacheConfig struct {
+	CatalogTTL   time.Duration
+	SearchTTL    time.Duration
+	StatsTTL     time.Duration
+	MaxBodyBytes int
+}
+
+// CachedResponse is a response replayed from the cache.
+type CachedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// ResponseCacheNamespaceMetrics counts the lookups of one namespace since
+// the server started.
+type ResponseCacheNamespaceMetrics struct {
+	Namespace  string  `json:"namespace"`
+	TTLSeconds int64   `json:"ttl_seconds"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRate    float64 `json:"hit_rate"`
+	Purges     int64   `json:"purges"`
+}
+
+// ResponseCacheMetrics describes the response cache.
+type ResponseCacheMetrics struct {
+	Backend    string                          `json:"backend"`
+	Errors     int64                           `json:"errors"`
+	Namespaces []ResponseCacheNamespaceMetrics `json:"namespaces"`
+}
+
+// responseCacheCounters are the counters of one namespace.
+type responseCacheCounters struct {
+	hits, misses, purges atomic.Int64
+}
+
+// ResponseCacheService caches the responses of catalog listings, searches
+// and statistics. Backend errors are logged and treated as misses, so an
+// unavailable Redis slows requests down rather than failing them.
+type ResponseCacheService struct {
+	backend  ResponseCacheBackend
+	logger   *zap.Logger
+	ttls     map[string]time.Duration
+	maxBody  int
+	counters map[string]*responseCacheCounters
+	errors   atomic.Int64
+}
+
+// NewResponseCacheService creates a ResponseCacheService. Zero TTLs
+// default to ten minutes for listings and statistics and two minutes for
+// searches; MaxBodyBytes defaults to 1 MiB.
+func NewResponseCacheService(backend ResponseCacheBackend, logger *zap.Logger, cfg ResponseCacheConfig) *ResponseCacheService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.CatalogTTL <= 0 {
+		cfg.CatalogTTL = 10 * time.Minute
+	}
+	if cfg.SearchTTL <= 0 {
+		cfg.SearchTTL = 2 * time.Minute
+	}
+	if cfg.StatsTTL <= 0 {
+		cfg.StatsTTL = 10 * time.Minute
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20
+	}
+	s := &ResponseCacheService{
+		backend: backend,
+		logger:  logger,
+		ttls: map[string]time.Duration{
+			ResponseCacheCatalog: cfg.CatalogTTL,
+			ResponseCacheSearch:  cfg.SearchTTL,
+			ResponseCacheStats:   cfg.StatsTTL,
+		},
+		maxBody:  cfg.MaxBodyBytes,
+		counters: make(map[string]*responseCacheCounters),
+	}
+	for _, namespace := range ResponseCacheNamespaces {
+		s.counters[namespace] = &responseCacheCounters{}
+	}
+	return s
+}
+
+// Backend returns the name of the backend in use.
+func (s *ResponseCacheService) Backend() string {
+	return s.backend.Name()
+}
+
+// MaxBodyBytes returns the size of the largest response that is cached.
+func (s *ResponseCacheService) MaxBodyBytes() int {
+	return s.maxBody
+}
+
+func (s *ResponseCacheService) validNamespace(namespace string) error {
+	if _, ok := s.counters[namespace]; !ok {
+		return fmt.Errorf("invalid namespace %q: expected one of %s", namespace, strings.Join(ResponseCacheNamespaces, ", "))
+	}
+	return nil
+}
+
+// Get returns the cached response for key in namespace, if there is one.
+func (s *ResponseCacheService) Get(ctx context.Context, namespace, key string) (*CachedResponse, bool) {
+	counters, ok := s.counters[namespace]
+	if !ok {
+		return nil, false
+	}
+	data, found, err := s.backend.Get(ctx, responseCacheKeyPrefix+namespace+":"+key)
+	var response CachedResponse
+	if err == nil && found {
+		err = json.Unmarshal(data, &response)
+	}
+	if err != nil {
+		s.errors.Add(1)
+		s.logger.Warn("Failed to read response cache", zap.String("namespace", namespace), zap.Error(err))
+	}
+	if err != nil || !found {
+		counters.misses.Add(1)
+		metrics.RecordCacheMiss("response_" + namespace)
+		return nil, false
+	}
+	counters.hits.Add(1)
+	metrics.RecordCacheHit("response_" + namespace)
+	return &response, true
+}
+
+// Set caches a response under key in namespace for the namespace's TTL.
+// Oversized responses are skipped.
+func (s *ResponseCacheService) Set(ctx context.Context, namespace, key string, response CachedResponse) {
+	ttl, ok := s.ttls[namespace]
+	if !ok || len(response.Body) > s.maxBody {
+		return
+	}
+	data, err := json.Marshal(response)
+	if err == nil {
+		err = s.backend.Set(ctx, responseCacheKeyPrefix+namespace+":"+key, data, ttl)
+	}
+	if err != nil {
+		s.errors.Add(1)
+		s.logger.Warn("Failed to write response cache", zap.String("namespace", namespace), zap.Error(err))
+	}
+}
+
+// Purge drops the cached responses of a namespace, or of every namespace
+// when it is empty, and returns how many were dropped.
+func (s *ResponseCacheService) Purge(ctx context.Context, namespace string) (int64, error) {
+	namespaces := ResponseCacheNamespaces
+	if namespace != "" {
+		if err := s.validNamespace(namespace); err != nil {
+			return 0, err
+		}
+		namespaces = []string{namespace}
+	}
+	var deleted int64
+	for _, ns := range namespaces {
+		n, err := s.backend.DeletePrefix(ctx, responseCacheKeyPrefix+ns+":")
+		deleted += n
+		if err != nil {
+			s.errors.Add(1)
+			return deleted, fmt.Errorf("failed to purge %s responses: %w", ns, err)
+		}
+		s.counters[ns].purges.Add(1)
+	}
+	s.logger.Info("Response cache purged", zap.String("namespace", namespace), zap.Int64("entries", deleted))
+	return deleted, nil
+}
+
+// InvalidateCatalog drops every cached response after the catalog
+// changed. Listings, searches and statistics all derive from the files
+// table, so a scan stales all three.
+func (s *ResponseCacheService) InvalidateCatalog(ctx context.Context) {
+	if _, err := s.Purge(ctx, ""); err != nil {
+		s.logger.Error("Failed to invalidate response cache", zap.Error(err))
+	}
+}
+
+// Metrics returns the hits, misses and purges of each namespace.
+func (s *ResponseCacheService) Metrics() ResponseCacheMetrics {
+	stats := ResponseCacheMetrics{Backend: s.backend.Name(), Errors: s.errors.Load()}
+	for _, namespace := range ResponseCacheNamespaces {
+		counters := s.counters[namespace]
+		ns := ResponseCacheNamespaceMetrics{
+			Namespace:  namespace,
+			TTLSeconds: int64(s.ttls[namespace].Seconds()),
+			Hits:       counters.hits.Load(),
+			Misses:     counters.misses.Load(),
+			Purges:     counters.purges.Load(),
+		}
+		if total := ns.Hits + ns.Misses; total > 0 {
+			ns.HitRate = float64(ns.Hits) / float64(total)
+		}
+		stats.Namespaces = append(stats.Namespaces, ns)
+	}
+	return stats
+}
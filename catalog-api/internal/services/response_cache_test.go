@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCacheService_Backends(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	require.NoError(t, client.Set(context.Background(), "rate_limit:10.0.0.1", "3", 0).Err())
+
+	backends := map[string]ResponseCacheBackend{
+		ResponseCacheBackendMemory: NewMemoryResponseCacheBackend(0),
+		ResponseCacheBackendRedis:  NewRedisResponseCacheBackend(client),
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewResponseCacheService(backend, nil, ResponseCacheConfig{MaxBodyBytes: 16})
+			assert.Equal(t, name, s.Backend())
+
+			_, ok := s.Get(ctx, ResponseCacheCatalog, "root")
+			assert.False(t, ok)
+			listing := CachedResponse{Status: 200, ContentType: "application/json", Body: []byte(`{"files":[]}`)}
+			s.Set(ctx, ResponseCacheCatalog, "root", listing)
+			s.Set(ctx, ResponseCacheSearch, "q=film", CachedResponse{Status: 200, Body: []byte(`[]`)})
+			s.Set(ctx, ResponseCacheStats, "overall", CachedResponse{Status: 200, Body: []byte(`{"files":12345678901}`)})
+			cached, ok := s.Get(ctx, ResponseCacheCatalog, "root")
+			require.True(t, ok)
+			assert.Equal(t, listing, *cached)
+			_, ok = s.Get(ctx, ResponseCacheStats, "overall")
+			assert.False(t, ok, "responses over MaxBodyBytes are not cached")
+
+			_, err := s.Purge(ctx, "users")
+			assert.ErrorContains(t, err, "invalid namespace")
+			deleted, err := s.Purge(ctx, ResponseCacheSearch)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), deleted)
+			_, ok = s.Get(ctx, ResponseCacheCatalog, "root")
+			assert.True(t, ok, "purging one namespace keeps the others")
+
+			s.InvalidateCatalog(ctx)
+			_, ok = s.Get(ctx, ResponseCacheCatalog, "root")
+			assert.False(t, ok)
+
+			stats := s.Metrics()
+			assert.Zero(t, stats.Errors)
+			require.Len(t, stats.Namespaces, 3)
+			assert.Equal(t, ResponseCacheNamespaceMetrics{Namespace: "catalog", TTLSeconds: 600, Hits: 2, Misses: 2, HitRate: 0.5, Purges: 1},
+				stats.Namespaces[0])
+			assert.Equal(t, int64(2), stats.Namespaces[1].Purges)
+		})
+	}
+	assert.True(t, mr.Exists("rate_limit:10.0.0.1"), "purges leave other keys alone")
+}
+
+func TestResponseCacheService_Expiry(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryResponseCacheBackend(2).(*memoryResponseCacheBackend)
+	now := time.Now()
+	backend.now = func() time.Time { return now }
+	s := NewResponseCacheService(backend, nil, ResponseCacheConfig{CatalogTTL: time.Minute, SearchTTL: time.Hour})
+
+	s.Set(ctx, ResponseCacheCatalog, "a", CachedResponse{Status: 200})
+	s.Set(ctx, ResponseCacheSearch, "b", CachedResponse{Status: 200})
+	now = now.Add(2 * time.Minute)
+	_, ok := s.Get(ctx, ResponseCacheCatalog, "a")
+	assert.False(t, ok, "listings expire after their TTL")
+	_, ok = s.Get(ctx, ResponseCacheSearch, "b")
+	assert.True(t, ok)
+
+	// The least recently used response is evicted beyond the entry limit
+	s.Set(ctx, ResponseCacheSearch, "c", CachedResponse{Status: 200})
+	s.Get(ctx, ResponseCacheSearch, "b")
+	s.Set(ctx, ResponseCacheSearch, "d", CachedResponse{Status: 200})
+	_, ok = s.Get(ctx, ResponseCacheSearch, "c")
+	assert.False(t, ok)
+	_, ok = s.Get(ctx, ResponseCacheSearch, "b")
+	assert.True(t, ok)
+}
+
+func TestResponseCacheService_RedisUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	s := NewResponseCacheService(NewRedisResponseCacheBackend(client), nil, ResponseCacheConfig{})
+	mr.Close()
+
+	ctx := context.Background()
+	s.Set(ctx, ResponseCacheStats, "overall", CachedResponse{Status: 200})
+	_, ok := s.Get(ctx, ResponseCacheStats, "overall")
+	assert.False(t, ok, "a failing backend is a miss")
+	_, err := s.Purge(ctx, "")
+	assert.Error(t, err)
+	assert.Equal(t, int64(3), s.Metrics().Errors)
+}
@@ -0,0 +1,594 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Upload session statuses.
+const (
+	UploadStatusUploading = "uploading"
+	UploadStatusCompleted = "completed"
+)
+
+// Errors returned by UploadService.
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadBusy is returned while another request of the same upload
+	// is in progress.
+	ErrUploadBusy = errors.New("upload is busy with another request")
+	// ErrUploadTooLarge is returned for files over the caller's upload
+	// limit and for chunks over the maximum chunk size.
+	ErrUploadTooLarge         = errors.New("upload exceeds the maximum size")
+	ErrUploadIncomplete       = errors.New("upload is incomplete")
+	ErrUploadChecksumMismatch = errors.New("upload checksum mismatch")
+	ErrUploadExists           = errors.New("destination file already exists")
+	ErrUploadLocked           = errors.New("storage root is in read-only lockdown")
+	// ErrUploadLimit is returned when a user starts an upload while at
+	// their limit of uploads in progress.
+	ErrUploadLimit = errors.New("too many uploads in progress")
+)
+
+// UploadOffsetError is returned for a chunk sent at an offset other than
+// where the upload stands; Offset is where the next chunk must start.
+type UploadOffsetError struct {
+	Offset int64
+}
+
+func (e *UploadOffsetError) Error() string {
+	return fmt.Sprintf("upload offset mismatch: expected chunk at offset %d", e.Offset)
+}
+
+// UploadSession is a resumable upload. Received is how many bytes of the
+// file have arrived, and so the offset of the next chunk.
+type UploadSession struct {
+	ID           string     `json:"id"`
+	UserID       int        `json:"user_id"`
+	StorageRoot  string     `json:"storage_root"`
+	Path         string     `json:"path"`
+	Size         int64      `json:"size"`
+	Received     int64      `json:"received"`
+	SHA256       string     `json:"sha256"`
+	Overwrite    bool       `json:"overwrite"`
+	Status       string     `json:"status"`
+	MaxChunkSize int64      `json:"max_chunk_size"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// UploadRequest starts a resumable upload of a file of Size bytes whose
+// SHA-256 is SHA256, to Destination given as 'storage_root:path'.
+type UploadRequest struct {
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Overwrite   bool   `json:"overwrite"`
+}
+
+// UploadConfig controls where partial uploads are kept and for how long.
+type UploadConfig struct {
+	// Dir holds the received parts of uploads in progress.
+	Dir string
+	// MaxChunkSize bounds the size of one chunk. Defaults to 16 MiB.
+	MaxChunkSize int64
+	// Expiry is how long an upload may sit idle before it is discarded.
+	// Defaults to 24 hours.
+	Expiry time.Duration
+	// CleanupInterval is how often expired uploads are discarded.
+	// Defaults to an hour.
+	CleanupInterval time.Duration
+	// MaxOpenPerUser bounds how many uploads one user may have in
+	// progress, each holding a part file on disk. Defaults to 20.
+	MaxOpenPerUser int
+}
+
+// uploadStorage opens the storage roots assembled uploads are written to.
+type uploadStorage interface {
+	Provider(ctx context.Context, storageRoot string) (StorageProvider, error)
+}
+
+// uploadVersioner preserves the file an upload overwrites.
+type uploadVersioner interface {
+	CaptureRemote(ctx context.Context, storageRoot, path, origin string, userID *int) (*FileVersion, error)
+}
+
+// UploadService receives files in chunks over any number of requests.
+// Chunks are appended to a part file on local disk at the offset the
+// upload stands at, so a client whose connection drops asks for the
+// offset and carries on from there, across server restarts too. Once
+// every byte has arrived the file is checked against its SHA-256 and
+// written to its storage root.
+type UploadService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	storage   uploadStorage
+	config    UploadConfig
+	lockdowns lockdownStatus
+	versions  uploadVersioner
+	now       func() time.Time
+
+	// createMu makes counting a user's uploads and adding one a single
+	// step
+	createMu sync.Mutex
+
+	mu   sync.Mutex
+	busy map[string]bool
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewUploadService creates an UploadService keeping partial uploads in
+// config.Dir.
+func NewUploadService(db *database.DB, logger *zap.Logger, storage uploadStorage, config UploadConfig) *UploadService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Dir == "" {
+		config.Dir = filepath.Join(os.TempDir(), "catalogizer-uploads")
+	}
+	if config.MaxChunkSize <= 0 {
+		config.MaxChunkSize = 16 << 20
+	}
+	if config.Expiry <= 0 {
+		config.Expiry = 24 * time.Hour
+	}
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = time.Hour
+	}
+	if config.MaxOpenPerUser <= 0 {
+		config.MaxOpenPerUser = 20
+	}
+	return &UploadService{
+		db:      db,
+		logger:  logger,
+		storage: storage,
+		config:  config,
+		now:     time.Now,
+		busy:    make(map[string]bool),
+	}
+}
+
+// SetLockdownChecker makes uploads to storage roots in read-only lockdown
+// fail.
+func (s *UploadService) SetLockdownChecker(checker lockdownStatus) {
+	s.lockdowns = checker
+}
+
+// SetVersionService keeps previous versions of files uploads overwrite.
+func (s *UploadService) SetVersionService(versions uploadVersioner) {
+	s.versions = versions
+}
+
+func (s *UploadService) partPath(id string) string {
+	return filepath.Join(s.config.Dir, id+".part")
+}
+
+const uploadSessionColumns = `id, user_id, storage_root, path, size, received, sha256, overwrite, status,
+	created_at, updated_at, expires_at, completed_at`
+
+func (s *UploadService) scanSession(row interface{ Scan(...interface{}) error }) (*UploadSession, error) {
+	var session UploadSession
+	var completedAt sql.NullTime
+	if err := row.Scan(&session.ID, &session.UserID, &session.StorageRoot, &session.Path, &session.Size,
+		&session.Received, &session.SHA256, &session.Overwrite, &session.Status,
+		&session.CreatedAt, &session.UpdatedAt, &session.ExpiresAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		session.CompletedAt = &completedAt.Time
+	}
+	session.MaxChunkSize = s.config.MaxChunkSize
+	return &session, nil
+}
+
+// Create starts an upload for userID. maxSize is the largest file the
+// user may upload, 0 for no limit. It returns ErrUploadLimit when the user
+// already has the configured number of uploads in progress.
+func (s *UploadService) Create(ctx context.Context, userID int, req UploadRequest, maxSize int64) (*UploadSession, error) {
+	root, path, ok := strings.Cut(req.Destination, ":")
+	if !ok || root == "" || strings.Trim(path, "/") == "" {
+		return nil, fmt.Errorf("invalid destination %q: expected 'storage_root:path'", req.Destination)
+	}
+	if req.Size < 0 {
+		return nil, fmt.Errorf("invalid size %d", req.Size)
+	}
+	if maxSize > 0 && req.Size > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes", ErrUploadTooLarge, maxSize)
+	}
+	checksum := strings.ToLower(req.SHA256)
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256 %q: expected 64 hex digits", req.SHA256)
+	}
+	if s.lockdowns != nil && s.lockdowns.IsLocked(root) {
+		return nil, ErrUploadLocked
+	}
+	if !req.Overwrite {
+		if err := s.checkDestinationFree(ctx, root, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(s.config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	s.createMu.Lock()
+	defer s.createMu.Unlock()
+	now := s.now()
+	var open int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM upload_sessions WHERE user_id = ? AND status = ? AND expires_at >= ?`,
+		userID, UploadStatusUploading, now).Scan(&open); err != nil {
+		return nil, fmt.Errorf("failed to count uploads: %w", err)
+	}
+	if open >= s.config.MaxOpenPerUser {
+		return nil, fmt.Errorf("%w: at most %d at once", ErrUploadLimit, s.config.MaxOpenPerUser)
+	}
+	session := &UploadSession{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		StorageRoot:  root,
+		Path:         path,
+		Size:         req.Size,
+		SHA256:       checksum,
+		Overwrite:    req.Overwrite,
+		Status:       UploadStatusUploading,
+		MaxChunkSize: s.config.MaxChunkSize,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ExpiresAt:    now.Add(s.config.Expiry),
+	}
+	part, err := os.OpenFile(s.partPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload part: %w", err)
+	}
+	part.Close()
+
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO upload_sessions (`+uploadSessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, userID, root, path, session.Size, 0, checksum, session.Overwrite, session.Status,
+		now, now, session.ExpiresAt, nil); err != nil {
+		os.Remove(s.partPath(session.ID))
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return session, nil
+}
+
+// checkDestinationFree returns ErrUploadExists when path exists on root.
+func (s *UploadService) checkDestinationFree(ctx context.Context, root, path string) error {
+	dest, err := s.storage.Provider(ctx, root)
+	if err != nil {
+		return fmt.Errorf("failed to connect to storage root %s: %w", root, err)
+	}
+	defer dest.Close()
+	exists, err := dest.Exists(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to check destination: %w", err)
+	}
+	if exists {
+		return ErrUploadExists
+	}
+	return nil
+}
+
+// Get returns one of userID's uploads.
+func (s *UploadService) Get(ctx context.Context, userID int, id string) (*UploadSession, error) {
+	session, err := s.scanSession(s.db.QueryRowContext(ctx,
+		`SELECT `+uploadSessionColumns+` FROM upload_sessions WHERE id = ? AND user_id = ?`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	return session, nil
+}
+
+// acquire marks an upload busy, so two requests cannot write its part
+// file at once.
+func (s *UploadService) acquire(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return ErrUploadBusy
+	}
+	s.busy[id] = true
+	return nil
+}
+
+func (s *UploadService) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.busy, id)
+}
+
+// setReceived records how much of an upload has arrived and extends its
+// expiry.
+func (s *UploadService) setReceived(ctx context.Context, session *UploadSession, received int64) error {
+	now := s.now()
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET received = ?, updated_at = ?, expires_at = ? WHERE id = ?`,
+		received, now, now.Add(s.config.Expiry), session.ID); err != nil {
+		return fmt.Errorf("failed to save upload progress: %w", err)
+	}
+	session.Received, session.UpdatedAt, session.ExpiresAt = received, now, now.Add(s.config.Expiry)
+	return nil
+}
+
+// WriteChunk appends data to an upload. offset must be where the upload
+// stands. When checksum, the chunk's hex SHA-256, is given a chunk that
+// does not match is dropped; otherwise a chunk cut short by a dropped
+// connection keeps the bytes that arrived, and the upload continues from
+// there.
+func (s *UploadService) WriteChunk(ctx context.Context, userID int, id string, offset int64, data io.Reader, checksum string) (*UploadSession, error) {
+	if err := s.acquire(id); err != nil {
+		return nil, err
+	}
+	defer s.release(id)
+
+	session, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != UploadStatusUploading {
+		return nil, fmt.Errorf("invalid upload state: upload is %s", session.Status)
+	}
+	if offset != session.Received {
+		return nil, &UploadOffsetError{Offset: session.Received}
+	}
+
+	part, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload part: %w", err)
+	}
+	defer part.Close()
+	// Drop whatever a write the database did not record left past the
+	// offset
+	if err := part.Truncate(offset); err != nil {
+		return nil, fmt.Errorf("failed to write upload part: %w", err)
+	}
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to write upload part: %w", err)
+	}
+
+	limit := session.Size - offset
+	if limit > s.config.MaxChunkSize {
+		limit = s.config.MaxChunkSize
+	}
+	hash := sha256.New()
+	written, copyErr := io.Copy(io.MultiWriter(part, hash), io.LimitReader(data, limit))
+	if copyErr == nil {
+		// Anything past the limit is more than the file or chunk may hold
+		var probe [1]byte
+		if n, _ := data.Read(probe[:]); n > 0 {
+			part.Truncate(offset)
+			if limit < session.Size-offset {
+				return nil, fmt.Errorf("%w: chunks may be at most %d bytes", ErrUploadTooLarge, s.config.MaxChunkSize)
+			}
+			return nil, fmt.Errorf("%w: the file is %d bytes", ErrUploadTooLarge, session.Size)
+		}
+	}
+	if checksum != "" && (copyErr != nil || !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), checksum)) {
+		part.Truncate(offset)
+		if copyErr != nil {
+			return nil, fmt.Errorf("failed to receive chunk: %w", copyErr)
+		}
+		return nil, fmt.Errorf("%w: chunk at offset %d", ErrUploadChecksumMismatch, offset)
+	}
+	if err := part.Sync(); err != nil {
+		part.Truncate(offset)
+		return nil, fmt.Errorf("failed to write upload part: %w", err)
+	}
+	if err := s.setReceived(ctx, session, offset+written); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return session, fmt.Errorf("failed to receive chunk: %w", copyErr)
+	}
+	return session, nil
+}
+
+// Complete verifies an upload whose bytes have all arrived against its
+// SHA-256 and writes it to its destination. A file that does not match is
+// discarded so the upload can start over.
+func (s *UploadService) Complete(ctx context.Context, userID int, id string) (*UploadSession, error) {
+	if err := s.acquire(id); err != nil {
+		return nil, err
+	}
+	defer s.release(id)
+
+	session, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status == UploadStatusCompleted {
+		return session, nil
+	}
+	if session.Received != session.Size {
+		return nil, fmt.Errorf("%w: %d of %d bytes received", ErrUploadIncomplete, session.Received, session.Size)
+	}
+
+	part, err := os.Open(s.partPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload part: %w", err)
+	}
+	defer part.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, part); err != nil {
+		return nil, fmt.Errorf("failed to read upload part: %w", err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != session.SHA256 {
+		if err := os.Truncate(s.partPath(id), 0); err != nil {
+			return nil, fmt.Errorf("failed to reset upload: %w", err)
+		}
+		if err := s.setReceived(ctx, session, 0); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: received file has SHA-256 %s", ErrUploadChecksumMismatch, sum)
+	}
+
+	if s.lockdowns != nil && s.lockdowns.IsLocked(session.StorageRoot) {
+		return nil, ErrUploadLocked
+	}
+	ctx = WithIOPriority(ctx, IOPriorityTransfer)
+	dest, err := s.storage.Provider(ctx, session.StorageRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to storage root %s: %w", session.StorageRoot, err)
+	}
+	defer dest.Close()
+	exists, err := dest.Exists(ctx, session.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check destination: %w", err)
+	}
+	if exists && !session.Overwrite {
+		return nil, ErrUploadExists
+	}
+	if exists && s.versions != nil {
+		if _, err := s.versions.CaptureRemote(ctx, session.StorageRoot, session.Path, VersionOriginUpload, &userID); err != nil {
+			return nil, fmt.Errorf("failed to preserve previous version: %w", err)
+		}
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read upload part: %w", err)
+	}
+	if err := dest.Write(ctx, session.Path, part); err != nil {
+		return nil, fmt.Errorf("failed to write to storage: %w", err)
+	}
+
+	now := s.now()
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET status = ?, updated_at = ?, completed_at = ? WHERE id = ?`,
+		UploadStatusCompleted, now, now, id); err != nil {
+		return nil, fmt.Errorf("failed to complete upload: %w", err)
+	}
+	part.Close()
+	if err := os.Remove(s.partPath(id)); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("Failed to remove upload part", zap.String("upload_id", id), zap.Error(err))
+	}
+	s.logger.Info("Upload completed",
+		zap.String("upload_id", id),
+		zap.String("destination", session.StorageRoot+":"+session.Path),
+		zap.Int64("size", session.Size))
+
+	session.Status, session.UpdatedAt, session.CompletedAt = UploadStatusCompleted, now, &now
+	return session, nil
+}
+
+// Abort discards one of userID's uploads and what it received.
+func (s *UploadService) Abort(ctx context.Context, userID int, id string) error {
+	if err := s.acquire(id); err != nil {
+		return err
+	}
+	defer s.release(id)
+
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.discard(ctx, id)
+}
+
+func (s *UploadService) discard(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if err := os.Remove(s.partPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload part: %w", err)
+	}
+	return nil
+}
+
+// Cleanup discards uploads idle past their expiry and the records of
+// completed ones, returning how many it discarded. Uploads busy with a
+// request are left for the next cleanup.
+func (s *UploadService) Cleanup(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM upload_sessions WHERE expires_at < ?`, s.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to list expired uploads: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+
+	discarded := 0
+	for _, id := range ids {
+		if s.acquire(id) != nil {
+			continue
+		}
+		err := s.discard(ctx, id)
+		s.release(id)
+		if err != nil {
+			return discarded, err
+		}
+		discarded++
+	}
+	return discarded, nil
+}
+
+// Start discards expired uploads periodically until Stop is called.
+func (s *UploadService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.CleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if n, err := s.Cleanup(context.Background()); err != nil {
+					s.logger.Error("Failed to clean up expired uploads", zap.Error(err))
+				} else if n > 0 {
+					s.logger.Info("Discarded expired uploads", zap.Int("count", n))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the cleanup started by Start.
+func (s *UploadService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
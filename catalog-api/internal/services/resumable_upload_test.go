@@ -0,0 +1,313 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadTestProvider is a memoryProvider that reports which files exist.
+type uploadTestProvider struct {
+	*memoryProvider
+}
+
+func (p uploadTestProvider) Exists(ctx context.Context, path string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, written := p.written[path]
+	_, existing := p.files[path]
+	return written || existing, nil
+}
+
+func (p uploadTestProvider) Close() error { return nil }
+
+type uploadTestStorage struct {
+	provider uploadTestProvider
+}
+
+func (s uploadTestStorage) Provider(ctx context.Context, storageRoot string) (StorageProvider, error) {
+	if storageRoot != "media" {
+		return nil, errors.New("unknown storage root")
+	}
+	return s.provider, nil
+}
+
+type uploadTestVersions struct {
+	captured []string
+}
+
+func (v *uploadTestVersions) CaptureRemote(ctx context.Context, storageRoot, path, origin string, userID *int) (*FileVersion, error) {
+	v.captured = append(v.captured, storageRoot+":"+path)
+	return &FileVersion{}, nil
+}
+
+func newUploadTestService(t *testing.T, files map[string][]byte) (*UploadService, uploadTestProvider) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	_, err = sqlDB.Exec(`CREATE TABLE upload_sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		storage_root TEXT NOT NULL,
+		path TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		received BIGINT NOT NULL,
+		sha256 TEXT NOT NULL,
+		overwrite BOOLEAN NOT NULL,
+		status TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		completed_at DATETIME
+	)`)
+	require.NoError(t, err)
+
+	provider := uploadTestProvider{&memoryProvider{files: files, written: map[string][]byte{}}}
+	s := NewUploadService(database.WrapDB(sqlDB, database.DialectSQLite), nil, uploadTestStorage{provider},
+		UploadConfig{Dir: t.TempDir(), MaxChunkSize: 8})
+	return s, provider
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cutReader returns its data and then fails, like a dropped connection.
+type cutReader struct {
+	data []byte
+}
+
+func (r *cutReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestUploadService_ChunkedUploadWithResume(t *testing.T) {
+	s, provider := newUploadTestService(t, nil)
+	ctx := context.Background()
+	content := []byte("0123456789abcdefghij")
+
+	session, err := s.Create(ctx, 1, UploadRequest{Destination: "media:movies/a.mkv", Size: int64(len(content)), SHA256: sha256Hex(content)}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "media", session.StorageRoot)
+	assert.Equal(t, "movies/a.mkv", session.Path)
+	assert.Equal(t, int64(8), session.MaxChunkSize)
+
+	session, err = s.WriteChunk(ctx, 1, session.ID, 0, bytes.NewReader(content[:8]), sha256Hex(content[:8]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), session.Received)
+
+	// A chunk at the wrong offset says where to continue
+	_, err = s.WriteChunk(ctx, 1, session.ID, 4, bytes.NewReader(content[4:8]), "")
+	var offsetErr *UploadOffsetError
+	require.ErrorAs(t, err, &offsetErr)
+	assert.Equal(t, int64(8), offsetErr.Offset)
+
+	// A corrupted chunk is dropped
+	_, err = s.WriteChunk(ctx, 1, session.ID, 8, bytes.NewReader([]byte("XXXXXXXX")), sha256Hex(content[8:16]))
+	assert.ErrorIs(t, err, ErrUploadChecksumMismatch)
+
+	// Chunks over the maximum are refused
+	_, err = s.WriteChunk(ctx, 1, session.ID, 8, bytes.NewReader(content[8:]), "")
+	assert.ErrorIs(t, err, ErrUploadTooLarge)
+
+	// A connection dropped mid-chunk keeps what arrived
+	session, err = s.WriteChunk(ctx, 1, session.ID, 8, &cutReader{data: content[8:11]}, "")
+	require.Error(t, err)
+	require.NotNil(t, session)
+	assert.Equal(t, int64(11), session.Received)
+
+	_, err = s.Complete(ctx, 1, session.ID)
+	assert.ErrorIs(t, err, ErrUploadIncomplete)
+
+	// Resume from the recorded offset
+	session, err = s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	for offset := session.Received; offset < int64(len(content)); offset += 8 {
+		end := min(offset+8, int64(len(content)))
+		session, err = s.WriteChunk(ctx, 1, session.ID, offset, bytes.NewReader(content[offset:end]), "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(len(content)), session.Received)
+
+	_, err = s.Get(ctx, 2, session.ID)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+
+	session, err = s.Complete(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, UploadStatusCompleted, session.Status)
+	assert.Equal(t, content, provider.written["movies/a.mkv"])
+	_, err = os.Stat(s.partPath(session.ID))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploadService_ChecksumMismatchRestarts(t *testing.T) {
+	s, provider := newUploadTestService(t, nil)
+	ctx := context.Background()
+
+	session, err := s.Create(ctx, 1, UploadRequest{Destination: "media:a.txt", Size: 5, SHA256: sha256Hex([]byte("hello"))}, 0)
+	require.NoError(t, err)
+	_, err = s.WriteChunk(ctx, 1, session.ID, 0, bytes.NewReader([]byte("jello")), "")
+	require.NoError(t, err)
+
+	_, err = s.Complete(ctx, 1, session.ID)
+	assert.ErrorIs(t, err, ErrUploadChecksumMismatch)
+	assert.Empty(t, provider.written)
+	session, err = s.Get(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Zero(t, session.Received)
+
+	_, err = s.WriteChunk(ctx, 1, session.ID, 0, bytes.NewReader([]byte("hello")), "")
+	require.NoError(t, err)
+	_, err = s.Complete(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), provider.written["a.txt"])
+}
+
+func TestUploadService_CreateChecks(t *testing.T) {
+	s, _ := newUploadTestService(t, map[string][]byte{"existing.txt": []byte("old")})
+	ctx := context.Background()
+	checksum := sha256Hex([]byte("hello"))
+
+	_, err := s.Create(ctx, 1, UploadRequest{Destination: "media", Size: 5, SHA256: checksum}, 0)
+	assert.ErrorContains(t, err, "invalid destination")
+	_, err = s.Create(ctx, 1, UploadRequest{Destination: "media:a.txt", Size: 5, SHA256: "abc"}, 0)
+	assert.ErrorContains(t, err, "invalid sha256")
+	_, err = s.Create(ctx, 1, UploadRequest{Destination: "media:a.txt", Size: 5, SHA256: checksum}, 4)
+	assert.ErrorIs(t, err, ErrUploadTooLarge)
+	_, err = s.Create(ctx, 1, UploadRequest{Destination: "media:existing.txt", Size: 5, SHA256: checksum}, 0)
+	assert.ErrorIs(t, err, ErrUploadExists)
+
+	s.SetLockdownChecker(stubLockdowns{"media": true})
+	_, err = s.Create(ctx, 1, UploadRequest{Destination: "media:a.txt", Size: 5, SHA256: checksum}, 0)
+	assert.ErrorIs(t, err, ErrUploadLocked)
+}
+
+func TestUploadService_OpenUploadLimit(t *testing.T) {
+	s, _ := newUploadTestService(t, nil)
+	s.config.MaxOpenPerUser = 2
+	ctx := context.Background()
+	content := []byte("hello")
+	create := func(userID int, name string) (*UploadSession, error) {
+		return s.Create(ctx, userID, UploadRequest{Destination: "media:" + name, Size: 5, SHA256: sha256Hex(content)}, 0)
+	}
+
+	// Concurrent requests cannot get past the limit together
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := create(1, fmt.Sprintf("%d.txt", i))
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	created := 0
+	for err := range results {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, ErrUploadLimit)
+		}
+	}
+	assert.Equal(t, 2, created)
+
+	// The limit is per user
+	other, err := create(2, "other.txt")
+	require.NoError(t, err)
+	require.NoError(t, s.Abort(ctx, 2, other.ID))
+
+	// Finished and aborted uploads free their place
+	var ids []string
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM upload_sessions WHERE user_id = 1`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Close())
+	require.Len(t, ids, 2)
+	_, err = s.WriteChunk(ctx, 1, ids[0], 0, bytes.NewReader(content), "")
+	require.NoError(t, err)
+	_, err = s.Complete(ctx, 1, ids[0])
+	require.NoError(t, err)
+	_, err = create(1, "a.txt")
+	require.NoError(t, err)
+	_, err = create(1, "b.txt")
+	assert.ErrorIs(t, err, ErrUploadLimit)
+	require.NoError(t, s.Abort(ctx, 1, ids[1]))
+	_, err = create(1, "b.txt")
+	assert.NoError(t, err)
+}
+
+func TestUploadService_OverwriteKeepsVersion(t *testing.T) {
+	s, provider := newUploadTestService(t, map[string][]byte{"existing.txt": []byte("old")})
+	versions := &uploadTestVersions{}
+	s.SetVersionService(versions)
+	ctx := context.Background()
+
+	session, err := s.Create(ctx, 1, UploadRequest{Destination: "media:existing.txt", Size: 5, SHA256: sha256Hex([]byte("hello")), Overwrite: true}, 0)
+	require.NoError(t, err)
+	_, err = s.WriteChunk(ctx, 1, session.ID, 0, bytes.NewReader([]byte("hello")), "")
+	require.NoError(t, err)
+	_, err = s.Complete(ctx, 1, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"media:existing.txt"}, versions.captured)
+	assert.Equal(t, []byte("hello"), provider.written["existing.txt"])
+}
+
+func TestUploadService_AbortAndCleanup(t *testing.T) {
+	s, _ := newUploadTestService(t, nil)
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	checksum := sha256Hex([]byte("hello"))
+
+	aborted, err := s.Create(ctx, 1, UploadRequest{Destination: "media:a.txt", Size: 5, SHA256: checksum}, 0)
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.Abort(ctx, 2, aborted.ID), ErrUploadNotFound)
+	require.NoError(t, s.Abort(ctx, 1, aborted.ID))
+	_, err = s.Get(ctx, 1, aborted.ID)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+	_, err = os.Stat(s.partPath(aborted.ID))
+	assert.True(t, os.IsNotExist(err))
+
+	idle, err := s.Create(ctx, 1, UploadRequest{Destination: "media:b.txt", Size: 5, SHA256: checksum}, 0)
+	require.NoError(t, err)
+	now = now.Add(23 * time.Hour)
+	active, err := s.Create(ctx, 1, UploadRequest{Destination: "media:c.txt", Size: 5, SHA256: checksum}, 0)
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Hour)
+	n, err := s.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = s.Get(ctx, 1, idle.ID)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+	_, err = s.Get(ctx, 1, active.ID)
+	assert.NoError(t, err)
+}
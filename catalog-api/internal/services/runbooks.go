@@ -0,0 +1,854 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Runbook step actions.
+const (
+	// RunbookActionReadOnly places one storage root, or every enabled
+	// one, in read-only lockdown
+	RunbookActionReadOnly = "read_only"
+	// RunbookActionBackup copies the catalog database into a directory
+	RunbookActionBackup = "backup"
+	// RunbookActionVacuum runs catalog maintenance, fully vacuuming when
+	// asked
+	RunbookActionVacuum = "vacuum"
+	// RunbookActionRescan scans a storage root and waits for the scan
+	RunbookActionRescan = "rescan"
+	// RunbookActionExitReadOnly releases the lockdowns the run placed
+	RunbookActionExitReadOnly = "exit_read_only"
+)
+
+// Runbook run statuses.
+const (
+	RunbookRunning   = "running"
+	RunbookCompleted = "completed"
+	RunbookFailed    = "failed"
+	RunbookAborted   = "aborted"
+)
+
+// Runbook step statuses.
+const (
+	RunbookStepPending = "pending"
+	RunbookStepRunning = "running"
+	RunbookStepDone    = "done"
+	RunbookStepFailed  = "failed"
+	RunbookStepSkipped = "skipped"
+)
+
+// ErrRunbookRunning is returned when a runbook is run while another run
+// is in progress.
+var ErrRunbookRunning = errors.New("a runbook is already running")
+
+// runbookActions lists the params each action takes, and whether each is
+// required.
+var runbookActions = map[string]map[string]bool{
+	RunbookActionReadOnly:     {"storage_root": false},
+	RunbookActionBackup:       {"directory": true},
+	RunbookActionVacuum:       {"full_vacuum": false},
+	RunbookActionRescan:       {"storage_root": true},
+	RunbookActionExitReadOnly: {},
+}
+
+var (
+	runbookParameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	runbookParameterRef  = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+// RunbookParameter is a value given when a runbook is run, referenced in
+// step params as ${name}. A parameter without a default is required.
+type RunbookParameter struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Default     *string `json:"default,omitempty"`
+}
+
+// RunbookStep is one action of a runbook. Once a step fails or the run is
+// aborted, the steps after it are skipped except those marked always,
+// which undo what came before, such as leaving read-only mode.
+type RunbookStep struct {
+	Action string            `json:"action"`
+	Params map[string]string `json:"params,omitempty"`
+	Always bool              `json:"always,omitempty"`
+}
+
+// Runbook is a saved sequence of maintenance actions, run in one call.
+type Runbook struct {
+	ID          int64              `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Parameters  []RunbookParameter `json:"parameters"`
+	Steps       []RunbookStep      `json:"steps"`
+	CreatedBy   int                `json:"created_by"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// RunbookRequest creates or replaces a runbook.
+type RunbookRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Parameters  []RunbookParameter `json:"parameters"`
+	Steps       []RunbookStep      `json:"steps"`
+}
+
+// RunbookStepResult is the status of one step of a run. Params are the
+// step's params with the run's parameters filled in.
+type RunbookStepResult struct {
+	Action     string            `json:"action"`
+	Params     map[string]string `json:"params,omitempty"`
+	Always     bool              `json:"always,omitempty"`
+	Status     string            `json:"status"`
+	Detail     string            `json:"detail,omitempty"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// RunbookRun is one run of a runbook, with the status of every step.
+type RunbookRun struct {
+	ID          int64               `json:"id"`
+	RunbookID   int64               `json:"runbook_id"`
+	RunbookName string              `json:"runbook_name"`
+	Status      string              `json:"status"`
+	Parameters  map[string]string   `json:"parameters"`
+	Steps       []RunbookStepResult `json:"steps"`
+	StartedBy   int                 `json:"started_by"`
+	StartedAt   time.Time           `json:"started_at"`
+	FinishedAt  *time.Time          `json:"finished_at,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// runbookMaintenance is the catalog maintenance a runbook runs.
+type runbookMaintenance interface {
+	Run(ctx context.Context, trigger string, fullVacuum bool) (*MaintenanceRun, error)
+	Backup(ctx context.Context, dir string) (*DatabaseBackup, error)
+}
+
+// runbookScanner starts and follows the scans of rescan steps.
+type runbookScanner interface {
+	StartScan(ctx context.Context, storageRootID int64, trigger string) (*ScanJobProgress, error)
+	GetJob(ctx context.Context, id int64) (*ScanJobProgress, error)
+	CancelJob(ctx context.Context, id int64) error
+}
+
+// runbookLockdowns places and releases the lockdowns of read-only mode.
+type runbookLockdowns interface {
+	IsLocked(storageRoot string) bool
+	Lock(ctx context.Context, storageRoot, reason string) (*ShareLockdown, error)
+	Release(ctx context.Context, lockdownID int64, releasedBy int, note string) error
+}
+
+// runbookExecution is the run in progress. lockdowns are those its
+// read_only steps placed, for exit_read_only to release; it is only used
+// by the goroutine executing the run.
+type runbookExecution struct {
+	run       *RunbookRun
+	cancel    context.CancelFunc
+	aborted   bool
+	lockdowns []int64
+}
+
+// RunbookService saves runbooks, parameterized sequences of maintenance
+// actions such as read-only mode, a database backup, a vacuum and
+// rescans, and runs them step by step in the background. One runbook
+// runs at a time, and a run can be aborted between or during steps.
+type RunbookService struct {
+	db           *database.DB
+	logger       *zap.Logger
+	maintenance  runbookMaintenance
+	scanner      runbookScanner
+	lockdowns    runbookLockdowns
+	now          func() time.Time
+	pollInterval time.Duration
+
+	mu      sync.Mutex
+	running *runbookExecution
+	wg      sync.WaitGroup
+}
+
+// NewRunbookService creates a RunbookService running actions with the
+// given maintenance service, scanner and lockdowns.
+func NewRunbookService(db *database.DB, logger *zap.Logger, maintenance runbookMaintenance,
+	scanner runbookScanner, lockdowns runbookLockdowns) *RunbookService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &RunbookService{
+		db:           db,
+		logger:       logger,
+		maintenance:  maintenance,
+		scanner:      scanner,
+		lockdowns:    lockdowns,
+		now:          time.Now,
+		pollInterval: 2 * time.Second,
+	}
+}
+
+// Start marks runs a server restart interrupted as failed. Lockdowns they
+// placed stay until released under /api/v1/admin/lockdowns.
+func (s *RunbookService) Start() {
+	if _, err := s.db.ExecContext(context.Background(),
+		`UPDATE runbook_runs SET status = ?, finished_at = ?, error = ? WHERE status = ?`,
+		RunbookFailed, s.now(), "interrupted by server restart", RunbookRunning); err != nil {
+		s.logger.Warn("Failed to mark interrupted runbook runs", zap.Error(err))
+	}
+}
+
+// Stop aborts the run in progress and waits for its always steps.
+func (s *RunbookService) Stop() {
+	s.mu.Lock()
+	if s.running != nil {
+		s.running.aborted = true
+		s.running.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// validateRunbook checks a runbook's actions, their params and the
+// parameters they refer to.
+func validateRunbook(req *RunbookRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("invalid runbook: name is required")
+	}
+	if len(req.Steps) == 0 {
+		return fmt.Errorf("invalid runbook: at least one step is required")
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range req.Parameters {
+		if !runbookParameterName.MatchString(p.Name) {
+			return fmt.Errorf("invalid runbook: parameter name %q must be letters, digits and underscores", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("invalid runbook: parameter %q is declared twice", p.Name)
+		}
+		declared[p.Name] = true
+	}
+
+	for i, step := range req.Steps {
+		params, ok := runbookActions[step.Action]
+		if !ok {
+			return fmt.Errorf("invalid runbook: step %d has unknown action %q", i+1, step.Action)
+		}
+		for key, value := range step.Params {
+			if _, ok := params[key]; !ok {
+				return fmt.Errorf("invalid runbook: step %d (%s) takes no %q param", i+1, step.Action, key)
+			}
+			for _, ref := range runbookParameterRef.FindAllStringSubmatch(value, -1) {
+				if !declared[ref[1]] {
+					return fmt.Errorf("invalid runbook: step %d (%s) refers to undeclared parameter %q", i+1, step.Action, ref[1])
+				}
+			}
+		}
+		for key, required := range params {
+			if required && strings.TrimSpace(step.Params[key]) == "" {
+				return fmt.Errorf("invalid runbook: step %d (%s) needs a %q param", i+1, step.Action, key)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveParameters returns the value of every parameter of a run, from
+// those given or the defaults.
+func resolveParameters(runbook *Runbook, given map[string]string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, p := range runbook.Parameters {
+		value, ok := given[p.Name]
+		switch {
+		case ok:
+			values[p.Name] = value
+		case p.Default != nil:
+			values[p.Name] = *p.Default
+		default:
+			return nil, fmt.Errorf("invalid parameters: %s is required", p.Name)
+		}
+	}
+	for name := range given {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("invalid parameters: runbook %s has no parameter %q", runbook.Name, name)
+		}
+	}
+	return values, nil
+}
+
+// CreateRunbook saves a new runbook.
+func (s *RunbookService) CreateRunbook(ctx context.Context, req RunbookRequest, userID int) (*Runbook, error) {
+	if err := validateRunbook(&req); err != nil {
+		return nil, err
+	}
+	if err := s.checkNameFree(ctx, req.Name, 0); err != nil {
+		return nil, err
+	}
+	definition, err := marshalRunbookDefinition(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO runbooks (name, description, definition, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		req.Name, req.Description, definition, userID, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save runbook: %w", err)
+	}
+	return s.GetRunbook(ctx, id)
+}
+
+// UpdateRunbook replaces a runbook's name, description, parameters and
+// steps. Runs already started keep the steps they started with.
+func (s *RunbookService) UpdateRunbook(ctx context.Context, id int64, req RunbookRequest) (*Runbook, error) {
+	if err := validateRunbook(&req); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetRunbook(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.checkNameFree(ctx, req.Name, id); err != nil {
+		return nil, err
+	}
+	definition, err := marshalRunbookDefinition(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE runbooks SET name = ?, description = ?, definition = ?, updated_at = ? WHERE id = ?`,
+		req.Name, req.Description, definition, s.now(), id); err != nil {
+		return nil, fmt.Errorf("failed to save runbook: %w", err)
+	}
+	return s.GetRunbook(ctx, id)
+}
+
+func (s *RunbookService) checkNameFree(ctx context.Context, name string, id int64) error {
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM runbooks WHERE name = ? AND id <> ?`, name, id).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check runbook name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("runbook %q already exists", name)
+	}
+	return nil
+}
+
+// runbookDefinition is what runbooks.definition holds.
+type runbookDefinition struct {
+	Parameters []RunbookParameter `json:"parameters"`
+	Steps      []RunbookStep      `json:"steps"`
+}
+
+func marshalRunbookDefinition(req RunbookRequest) (string, error) {
+	definition, err := json.Marshal(runbookDefinition{Parameters: req.Parameters, Steps: req.Steps})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode runbook: %w", err)
+	}
+	return string(definition), nil
+}
+
+const runbookColumns = `id, name, description, definition, created_by, created_at, updated_at`
+
+func scanRunbook(row shareLinkScanner) (*Runbook, error) {
+	var runbook Runbook
+	var description sql.NullString
+	var definition string
+	if err := row.Scan(&runbook.ID, &runbook.Name, &description, &definition, &runbook.CreatedBy,
+		&runbook.CreatedAt, &runbook.UpdatedAt); err != nil {
+		return nil, err
+	}
+	runbook.Description = description.String
+	var d runbookDefinition
+	if err := json.Unmarshal([]byte(definition), &d); err != nil {
+		return nil, fmt.Errorf("invalid definition of runbook %d: %w", runbook.ID, err)
+	}
+	runbook.Parameters, runbook.Steps = d.Parameters, d.Steps
+	if runbook.Parameters == nil {
+		runbook.Parameters = []RunbookParameter{}
+	}
+	return &runbook, nil
+}
+
+// GetRunbook returns a runbook.
+func (s *RunbookService) GetRunbook(ctx context.Context, id int64) (*Runbook, error) {
+	runbook, err := scanRunbook(s.db.QueryRowContext(ctx, `SELECT `+runbookColumns+` FROM runbooks WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("runbook %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load runbook: %w", err)
+	}
+	return runbook, nil
+}
+
+// ListRunbooks returns every runbook, by name.
+func (s *RunbookService) ListRunbooks(ctx context.Context) ([]Runbook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+runbookColumns+` FROM runbooks ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runbooks: %w", err)
+	}
+	defer rows.Close()
+
+	runbooks := []Runbook{}
+	for rows.Next() {
+		runbook, err := scanRunbook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan runbook: %w", err)
+		}
+		runbooks = append(runbooks, *runbook)
+	}
+	return runbooks, rows.Err()
+}
+
+// DeleteRunbook deletes a runbook. Its runs are kept.
+func (s *RunbookService) DeleteRunbook(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM runbooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete runbook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("runbook %d not found", id)
+	}
+	return nil
+}
+
+// StartRun runs a runbook in the background with the given parameters
+// and returns the run, its steps all pending.
+func (s *RunbookService) StartRun(ctx context.Context, runbookID int64, parameters map[string]string, userID int) (*RunbookRun, error) {
+	runbook, err := s.GetRunbook(ctx, runbookID)
+	if err != nil {
+		return nil, err
+	}
+	values, err := resolveParameters(runbook, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &RunbookRun{
+		RunbookID:   runbook.ID,
+		RunbookName: runbook.Name,
+		Status:      RunbookRunning,
+		Parameters:  values,
+		StartedBy:   userID,
+		StartedAt:   s.now(),
+	}
+	for _, step := range runbook.Steps {
+		params := make(map[string]string, len(step.Params))
+		for key, value := range step.Params {
+			params[key] = runbookParameterRef.ReplaceAllStringFunc(value, func(ref string) string {
+				return values[ref[2:len(ref)-1]]
+			})
+		}
+		run.Steps = append(run.Steps, RunbookStepResult{
+			Action: step.Action,
+			Params: params,
+			Always: step.Always,
+			Status: RunbookStepPending,
+		})
+	}
+	encodedParameters, err := json.Marshal(run.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode parameters: %w", err)
+	}
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode steps: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		return nil, ErrRunbookRunning
+	}
+	run.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO runbook_runs (runbook_id, runbook_name, status, parameters, steps, started_by, started_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.RunbookID, run.RunbookName, run.Status, string(encodedParameters), string(steps), run.StartedBy, run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record runbook run: %w", err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	exec := &runbookExecution{run: run, cancel: cancel}
+	s.running = exec
+	snapshot := copyRunbookRun(run)
+
+	s.wg.Add(1)
+	go s.execute(runCtx, exec)
+	s.logger.Info("Runbook started", zap.Int64("run_id", run.ID), zap.String("runbook", run.RunbookName),
+		zap.Int("started_by", userID))
+	return snapshot, nil
+}
+
+func copyRunbookRun(run *RunbookRun) *RunbookRun {
+	c := *run
+	c.Steps = append([]RunbookStepResult(nil), run.Steps...)
+	return &c
+}
+
+// runningSnapshot returns a copy of the run in progress, or nil.
+func (s *RunbookService) runningSnapshot() *RunbookRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == nil {
+		return nil
+	}
+	return copyRunbookRun(s.running.run)
+}
+
+// update changes the run in progress under the lock snapshots read it
+// with.
+func (s *RunbookService) update(change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+}
+
+// execute runs the steps in order and records the outcome. Always steps
+// run on a context an abort does not cancel.
+func (s *RunbookService) execute(ctx context.Context, exec *runbookExecution) {
+	defer s.wg.Done()
+	defer exec.cancel()
+	run := exec.run
+
+	var failure string
+	for i := range run.Steps {
+		step := run.Steps[i]
+		if !step.Always && (failure != "" || ctx.Err() != nil) {
+			detail := "an earlier step failed"
+			if ctx.Err() != nil {
+				detail = "the run was aborted"
+			}
+			s.update(func() { run.Steps[i].Status, run.Steps[i].Detail = RunbookStepSkipped, detail })
+			continue
+		}
+
+		stepCtx := ctx
+		if step.Always {
+			stepCtx = context.WithoutCancel(ctx)
+		}
+		started := s.now()
+		s.update(func() { run.Steps[i].Status, run.Steps[i].StartedAt = RunbookStepRunning, &started })
+		detail, err := s.runStep(stepCtx, exec, step)
+		finished := s.now()
+		s.update(func() {
+			run.Steps[i].Status, run.Steps[i].Detail, run.Steps[i].FinishedAt = RunbookStepDone, detail, &finished
+			if err != nil {
+				run.Steps[i].Status, run.Steps[i].Detail = RunbookStepFailed, err.Error()
+			}
+		})
+		if err != nil {
+			s.logger.Warn("Runbook step failed", zap.Int64("run_id", run.ID), zap.Int("step", i+1),
+				zap.String("action", step.Action), zap.Error(err))
+			if failure == "" {
+				failure = fmt.Sprintf("step %d (%s): %v", i+1, step.Action, err)
+			}
+		}
+	}
+
+	finished := s.now()
+	s.update(func() {
+		run.FinishedAt = &finished
+		switch {
+		case exec.aborted:
+			run.Status, run.Error = RunbookAborted, "aborted"
+			if failure != "" {
+				run.Error += "; " + failure
+			}
+		case failure != "":
+			run.Status, run.Error = RunbookFailed, failure
+		default:
+			run.Status = RunbookCompleted
+		}
+	})
+
+	if err := s.saveRun(context.Background(), run); err != nil {
+		s.logger.Error("Failed to save runbook run", zap.Int64("run_id", run.ID), zap.Error(err))
+	}
+	s.mu.Lock()
+	s.running = nil
+	s.mu.Unlock()
+	s.logger.Info("Runbook finished", zap.Int64("run_id", run.ID), zap.String("runbook", run.RunbookName),
+		zap.String("status", run.Status))
+}
+
+func (s *RunbookService) saveRun(ctx context.Context, run *RunbookRun) error {
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE runbook_runs SET status = ?, steps = ?, finished_at = ?, error = ? WHERE id = ?`,
+		run.Status, string(steps), run.FinishedAt, run.Error, run.ID)
+	return err
+}
+
+// runStep carries out one step and describes what it did.
+func (s *RunbookService) runStep(ctx context.Context, exec *runbookExecution, step RunbookStepResult) (string, error) {
+	switch step.Action {
+	case RunbookActionReadOnly:
+		return s.enterReadOnly(ctx, exec, step.Params["storage_root"])
+	case RunbookActionExitReadOnly:
+		return s.exitReadOnly(ctx, exec)
+	case RunbookActionBackup:
+		backup, err := s.maintenance.Backup(ctx, step.Params["directory"])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("backed up the catalog database to %s (%d bytes)", backup.Path, backup.SizeBytes), nil
+	case RunbookActionVacuum:
+		fullVacuum := false
+		if value := step.Params["full_vacuum"]; value != "" {
+			var err error
+			if fullVacuum, err = strconv.ParseBool(value); err != nil {
+				return "", fmt.Errorf("invalid full_vacuum %q", value)
+			}
+		}
+		run, err := s.maintenance.Run(ctx, MaintenanceTriggerRunbook, fullVacuum)
+		if err != nil {
+			return "", err
+		}
+		if run.Status != MaintenanceCompleted {
+			return "", fmt.Errorf("maintenance run %d %s: %s", run.ID, run.Status, run.Error)
+		}
+		return fmt.Sprintf("maintenance run %d reclaimed %d bytes", run.ID, run.ReclaimedBytes), nil
+	case RunbookActionRescan:
+		return s.rescan(ctx, step.Params["storage_root"])
+	}
+	return "", fmt.Errorf("unknown action %q", step.Action)
+}
+
+// enterReadOnly places a storage root, or every enabled one, in read-only
+// lockdown. Roots already locked are left to whoever locked them.
+func (s *RunbookService) enterReadOnly(ctx context.Context, exec *runbookExecution, storageRoot string) (string, error) {
+	roots, err := s.enabledStorageRoots(ctx)
+	if err != nil {
+		return "", err
+	}
+	if storageRoot != "" {
+		if !containsString(roots, storageRoot) {
+			return "", fmt.Errorf("storage root %q not found or disabled", storageRoot)
+		}
+		roots = []string{storageRoot}
+	}
+
+	var locked, already int
+	reason := fmt.Sprintf("runbook %s, run %d", exec.run.RunbookName, exec.run.ID)
+	for _, root := range roots {
+		if s.lockdowns.IsLocked(root) {
+			already++
+			continue
+		}
+		lockdown, err := s.lockdowns.Lock(ctx, root, reason)
+		if err != nil {
+			return "", err
+		}
+		exec.lockdowns = append(exec.lockdowns, lockdown.ID)
+		locked++
+	}
+	detail := fmt.Sprintf("placed %d storage roots in read-only lockdown", locked)
+	if already > 0 {
+		detail += fmt.Sprintf("; %d already were and stay locked after the run", already)
+	}
+	return detail, nil
+}
+
+func (s *RunbookService) enabledStorageRoots(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, enabled FROM storage_roots`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage roots: %w", err)
+	}
+	defer rows.Close()
+
+	var roots []string
+	for rows.Next() {
+		var name string
+		var enabled sql.NullBool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan storage root: %w", err)
+		}
+		if !enabled.Valid || enabled.Bool {
+			roots = append(roots, name)
+		}
+	}
+	sort.Strings(roots)
+	return roots, rows.Err()
+}
+
+// exitReadOnly releases the lockdowns the run placed. Those an
+// administrator released in the meantime are passed over.
+func (s *RunbookService) exitReadOnly(ctx context.Context, exec *runbookExecution) (string, error) {
+	note := fmt.Sprintf("released by runbook %s, run %d", exec.run.RunbookName, exec.run.ID)
+	released := 0
+	var failed []string
+	for _, id := range exec.lockdowns {
+		err := s.lockdowns.Release(ctx, id, exec.run.StartedBy, note)
+		if err != nil && !strings.Contains(err.Error(), "already released") {
+			failed = append(failed, fmt.Sprintf("lockdown %d: %v", id, err))
+			continue
+		}
+		if err == nil {
+			released++
+		}
+	}
+	exec.lockdowns = nil
+	if len(failed) > 0 {
+		return "", fmt.Errorf("failed to release %s", strings.Join(failed, "; "))
+	}
+	return fmt.Sprintf("released %d lockdowns", released), nil
+}
+
+// rescan scans a storage root and waits for the scan to finish. An abort
+// cancels the scan.
+func (s *RunbookService) rescan(ctx context.Context, storageRoot string) (string, error) {
+	var rootID int64
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM storage_roots WHERE name = ?`, storageRoot).Scan(&rootID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("storage root %q not found", storageRoot)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load storage root: %w", err)
+	}
+	job, err := s.scanner.StartScan(ctx, rootID, ScanTriggerRunbook)
+	if err != nil {
+		return "", err
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		switch job.Status {
+		case ScanJobCompleted:
+			return fmt.Sprintf("scan job %d: %d files added, %d updated, %d deleted, %d renamed",
+				job.ID, job.FilesAdded, job.FilesUpdated, job.FilesDeleted, job.FilesRenamed), nil
+		case ScanJobFailed, ScanJobCancelled:
+			return "", fmt.Errorf("scan job %d %s: %s", job.ID, job.Status, job.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := s.scanner.CancelJob(context.Background(), job.ID); err != nil {
+				s.logger.Warn("Failed to cancel runbook scan", zap.Int64("scan_job_id", job.ID), zap.Error(err))
+			}
+			return "", fmt.Errorf("scan job %d cancelled", job.ID)
+		case <-ticker.C:
+		}
+		if job, err = s.scanner.GetJob(context.WithoutCancel(ctx), job.ID); err != nil {
+			return "", err
+		}
+	}
+}
+
+// AbortRun aborts a run in progress. The step running is stopped where it
+// can be, and only always steps run after it.
+func (s *RunbookService) AbortRun(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	if s.running != nil && s.running.run.ID == id {
+		s.running.aborted = true
+		s.running.cancel()
+		s.mu.Unlock()
+		s.logger.Info("Runbook aborted", zap.Int64("run_id", id))
+		return nil
+	}
+	s.mu.Unlock()
+
+	if _, err := s.GetRun(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("runbook run %d is not running", id)
+}
+
+const runbookRunColumns = `id, runbook_id, runbook_name, status, parameters, steps, started_by, started_at, finished_at, error`
+
+func scanRunbookRun(row shareLinkScanner) (*RunbookRun, error) {
+	var run RunbookRun
+	var parameters, steps string
+	var finished sql.NullTime
+	var runErr sql.NullString
+	if err := row.Scan(&run.ID, &run.RunbookID, &run.RunbookName, &run.Status, &parameters, &steps,
+		&run.StartedBy, &run.StartedAt, &finished, &runErr); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(parameters), &run.Parameters); err != nil {
+		return nil, fmt.Errorf("invalid parameters of runbook run %d: %w", run.ID, err)
+	}
+	if err := json.Unmarshal([]byte(steps), &run.Steps); err != nil {
+		return nil, fmt.Errorf("invalid steps of runbook run %d: %w", run.ID, err)
+	}
+	if finished.Valid {
+		run.FinishedAt = &finished.Time
+	}
+	run.Error = runErr.String
+	return &run, nil
+}
+
+// GetRun returns a runbook run, with the status of its steps so far when
+// it is still running.
+func (s *RunbookService) GetRun(ctx context.Context, id int64) (*RunbookRun, error) {
+	if running := s.runningSnapshot(); running != nil && running.ID == id {
+		return running, nil
+	}
+	run, err := scanRunbookRun(s.db.QueryRowContext(ctx, `SELECT `+runbookRunColumns+` FROM runbook_runs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("runbook run %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load runbook run: %w", err)
+	}
+	return run, nil
+}
+
+// ListRuns returns the most recent runs, newest first, of one runbook or
+// of all when runbookID is 0.
+func (s *RunbookService) ListRuns(ctx context.Context, runbookID int64, limit int) ([]RunbookRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	where, args := "", []interface{}{}
+	if runbookID > 0 {
+		where, args = `WHERE runbook_id = ? `, append(args, runbookID)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+runbookRunColumns+` FROM runbook_runs `+where+`ORDER BY started_at DESC, id DESC LIMIT ?`,
+		append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runbook runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []RunbookRun{}
+	for rows.Next() {
+		run, err := scanRunbookRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan runbook run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if running := s.runningSnapshot(); running != nil {
+		for i := range runs {
+			if runs[i].ID == running.ID {
+				runs[i] = *running
+			}
+		}
+	}
+	return runs, nil
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRunbookMaintenance struct {
+	mu         sync.Mutex
+	backupErr  error
+	backupDir  string
+	fullVacuum bool
+}
+
+func (f *fakeRunbookMaintenance) Run(ctx context.Context, trigger string, fullVacuum bool) (*MaintenanceRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fullVacuum = fullVacuum
+	return &MaintenanceRun{ID: 3, TriggeredBy: trigger, Status: MaintenanceCompleted, ReclaimedBytes: 4096}, nil
+}
+
+func (f *fakeRunbookMaintenance) Backup(ctx context.Context, dir string) (*DatabaseBackup, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.backupErr != nil {
+		return nil, f.backupErr
+	}
+	f.backupDir = dir
+	return &DatabaseBackup{Path: dir + "/catalog.db", SizeBytes: 8192}, nil
+}
+
+// fakeRunbookScanner finishes scans at once unless hold is set, when they
+// run until cancelled.
+type fakeRunbookScanner struct {
+	mu        sync.Mutex
+	hold      bool
+	started   []int64
+	cancelled []int64
+}
+
+func (f *fakeRunbookScanner) StartScan(ctx context.Context, storageRootID int64, trigger string) (*ScanJobProgress, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started = append(f.started, storageRootID)
+	return &ScanJobProgress{ID: 11, StorageRootID: storageRootID, Trigger: trigger, Status: ScanJobRunning}, nil
+}
+
+func (f *fakeRunbookScanner) GetJob(ctx context.Context, id int64) (*ScanJobProgress, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := ScanJobCompleted
+	if len(f.cancelled) > 0 {
+		status = ScanJobCancelled
+	} else if f.hold {
+		status = ScanJobRunning
+	}
+	return &ScanJobProgress{ID: id, Status: status, FilesAdded: 2}, nil
+}
+
+func (f *fakeRunbookScanner) CancelJob(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = append(f.cancelled, id)
+	return nil
+}
+
+type fakeRunbookLockdowns struct {
+	mu       sync.Mutex
+	nextID   int64
+	locked   map[string]int64
+	released []int64
+}
+
+func (f *fakeRunbookLockdowns) IsLocked(storageRoot string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.locked[storageRoot]
+	return ok
+}
+
+func (f *fakeRunbookLockdowns) Lock(ctx context.Context, storageRoot, reason string) (*ShareLockdown, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	f.locked[storageRoot] = f.nextID
+	return &ShareLockdown{ID: f.nextID, StorageRoot: storageRoot, TriggerType: LockdownTriggerMaintenance, Reason: reason}, nil
+}
+
+func (f *fakeRunbookLockdowns) Release(ctx context.Context, lockdownID int64, releasedBy int, note string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for root, id := range f.locked {
+		if id == lockdownID {
+			delete(f.locked, root)
+			f.released = append(f.released, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("lockdown not found")
+}
+
+func (f *fakeRunbookLockdowns) lockedRoots() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var roots []string
+	for root := range f.locked {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+type runbookFixture struct {
+	service     *RunbookService
+	maintenance *fakeRunbookMaintenance
+	scanner     *fakeRunbookScanner
+	lockdowns   *fakeRunbookLockdowns
+}
+
+func newRunbookFixture(t *testing.T) *runbookFixture {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (id INTEGER PRIMARY KEY, name TEXT NOT NULL, enabled BOOLEAN);
+		INSERT INTO storage_roots (id, name, enabled) VALUES (1, 'films', 1), (2, 'music', 1), (3, 'old', 0), (4, 'photos', NULL);
+		CREATE TABLE runbooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			definition TEXT NOT NULL,
+			created_by INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE runbook_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			runbook_id INTEGER NOT NULL,
+			runbook_name TEXT NOT NULL,
+			status TEXT NOT NULL,
+			parameters TEXT NOT NULL DEFAULT '{}',
+			steps TEXT NOT NULL DEFAULT '[]',
+			started_by INTEGER NOT NULL,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			error TEXT
+		);
+	`)
+	require.NoError(t, err)
+
+	f := &runbookFixture{
+		maintenance: &fakeRunbookMaintenance{},
+		scanner:     &fakeRunbookScanner{},
+		lockdowns:   &fakeRunbookLockdowns{locked: map[string]int64{"photos": 100}, nextID: 0},
+	}
+	f.service = NewRunbookService(database.WrapDB(sqlDB, database.DialectSQLite), nil, f.maintenance, f.scanner, f.lockdowns)
+	f.service.pollInterval = 5 * time.Millisecond
+	t.Cleanup(f.service.Stop)
+	return f
+}
+
+func (f *runbookFixture) wait(t *testing.T, id int64) *RunbookRun {
+	t.Helper()
+	require.Eventually(t, func() bool { return f.service.runningSnapshot() == nil }, 5*time.Second, 5*time.Millisecond)
+	run, err := f.service.GetRun(context.Background(), id)
+	require.NoError(t, err)
+	return run
+}
+
+func nightlyRunbook() RunbookRequest {
+	dir := "/var/backups/catalogizer"
+	return RunbookRequest{
+		Name:       "nightly",
+		Parameters: []RunbookParameter{{Name: "share"}, {Name: "backup_dir", Default: &dir}},
+		Steps: []RunbookStep{
+			{Action: RunbookActionReadOnly},
+			{Action: RunbookActionBackup, Params: map[string]string{"directory": "${backup_dir}"}},
+			{Action: RunbookActionVacuum, Params: map[string]string{"full_vacuum": "true"}},
+			{Action: RunbookActionRescan, Params: map[string]string{"storage_root": "${share}"}},
+			{Action: RunbookActionExitReadOnly, Always: true},
+		},
+	}
+}
+
+func TestValidateRunbook(t *testing.T) {
+	for name, req := range map[string]RunbookRequest{
+		"no name":           {Steps: []RunbookStep{{Action: RunbookActionVacuum}}},
+		"no steps":          {Name: "empty"},
+		"unknown action":    {Name: "x", Steps: []RunbookStep{{Action: "reboot"}}},
+		"unknown param":     {Name: "x", Steps: []RunbookStep{{Action: RunbookActionVacuum, Params: map[string]string{"dry_run": "1"}}}},
+		"missing param":     {Name: "x", Steps: []RunbookStep{{Action: RunbookActionRescan}}},
+		"undeclared ref":    {Name: "x", Steps: []RunbookStep{{Action: RunbookActionRescan, Params: map[string]string{"storage_root": "${share}"}}}},
+		"bad parameter":     {Name: "x", Parameters: []RunbookParameter{{Name: "a-b"}}, Steps: []RunbookStep{{Action: RunbookActionVacuum}}},
+		"repeated argument": {Name: "x", Parameters: []RunbookParameter{{Name: "a"}, {Name: "a"}}, Steps: []RunbookStep{{Action: RunbookActionVacuum}}},
+	} {
+		req := req
+		assert.ErrorContains(t, validateRunbook(&req), "invalid runbook", name)
+	}
+	req := nightlyRunbook()
+	assert.NoError(t, validateRunbook(&req))
+}
+
+func TestRunbookService_CRUD(t *testing.T) {
+	f := newRunbookFixture(t)
+	ctx := context.Background()
+
+	runbook, err := f.service.CreateRunbook(ctx, nightlyRunbook(), 1)
+	require.NoError(t, err)
+	assert.Len(t, runbook.Steps, 5)
+	assert.Len(t, runbook.Parameters, 2)
+
+	_, err = f.service.CreateRunbook(ctx, nightlyRunbook(), 1)
+	assert.ErrorContains(t, err, "already exists")
+
+	req := nightlyRunbook()
+	req.Name, req.Steps = "vacuum only", req.Steps[2:3]
+	runbook, err = f.service.UpdateRunbook(ctx, runbook.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, "vacuum only", runbook.Name)
+	assert.Len(t, runbook.Steps, 1)
+
+	runbooks, err := f.service.ListRunbooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, runbooks, 1)
+
+	require.NoError(t, f.service.DeleteRunbook(ctx, runbook.ID))
+	_, err = f.service.GetRunbook(ctx, runbook.ID)
+	assert.ErrorContains(t, err, "not found")
+	assert.ErrorContains(t, f.service.DeleteRunbook(ctx, runbook.ID), "not found")
+}
+
+func TestRunbookService_RunsSteps(t *testing.T) {
+	f := newRunbookFixture(t)
+	ctx := context.Background()
+	runbook, err := f.service.CreateRunbook(ctx, nightlyRunbook(), 1)
+	require.NoError(t, err)
+
+	_, err = f.service.StartRun(ctx, runbook.ID, nil, 1)
+	assert.ErrorContains(t, err, "invalid parameters: share is required")
+	_, err = f.service.StartRun(ctx, runbook.ID, map[string]string{"share": "films", "typo": "x"}, 1)
+	assert.ErrorContains(t, err, "invalid parameters")
+
+	started, err := f.service.StartRun(ctx, runbook.ID, map[string]string{"share": "films"}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, RunbookRunning, started.Status)
+	assert.Equal(t, "films", started.Steps[3].Params["storage_root"])
+	assert.Equal(t, "/var/backups/catalogizer", started.Steps[1].Params["directory"])
+
+	run := f.wait(t, started.ID)
+	assert.Equal(t, RunbookCompleted, run.Status, run.Error)
+	for _, step := range run.Steps {
+		assert.Equal(t, RunbookStepDone, step.Status, step.Action)
+		assert.NotNil(t, step.FinishedAt)
+	}
+	// Enabled roots were locked and released; photos was already locked
+	assert.Contains(t, run.Steps[0].Detail, "placed 2 storage roots")
+	assert.Contains(t, run.Steps[0].Detail, "1 already were")
+	assert.Equal(t, []int64{1, 2}, f.lockdowns.released)
+	assert.Equal(t, []string{"photos"}, f.lockdowns.lockedRoots())
+	assert.Equal(t, "/var/backups/catalogizer", f.maintenance.backupDir)
+	assert.True(t, f.maintenance.fullVacuum)
+	assert.Equal(t, []int64{1}, f.scanner.started)
+
+	runs, err := f.service.ListRuns(ctx, runbook.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, 7, runs[0].StartedBy)
+	assert.Equal(t, "films", runs[0].Parameters["share"])
+	assert.ErrorContains(t, f.service.AbortRun(ctx, run.ID), "not running")
+}
+
+func TestRunbookService_FailedStepSkipsTheRest(t *testing.T) {
+	f := newRunbookFixture(t)
+	ctx := context.Background()
+	f.maintenance.backupErr = fmt.Errorf("disk full")
+	runbook, err := f.service.CreateRunbook(ctx, nightlyRunbook(), 1)
+	require.NoError(t, err)
+
+	started, err := f.service.StartRun(ctx, runbook.ID, map[string]string{"share": "films"}, 1)
+	require.NoError(t, err)
+	run := f.wait(t, started.ID)
+	assert.Equal(t, RunbookFailed, run.Status)
+	assert.Contains(t, run.Error, "step 2 (backup): disk full")
+	assert.Equal(t, RunbookStepFailed, run.Steps[1].Status)
+	assert.Equal(t, RunbookStepSkipped, run.Steps[2].Status)
+	assert.Equal(t, RunbookStepSkipped, run.Steps[3].Status)
+	// Read-only mode is left all the same
+	assert.Equal(t, RunbookStepDone, run.Steps[4].Status)
+	assert.Equal(t, []string{"photos"}, f.lockdowns.lockedRoots())
+	assert.Empty(t, f.scanner.started)
+}
+
+func TestRunbookService_Abort(t *testing.T) {
+	f := newRunbookFixture(t)
+	ctx := context.Background()
+	f.scanner.hold = true
+	req := nightlyRunbook()
+	req.Steps = append(req.Steps[:4], RunbookStep{Action: RunbookActionVacuum}, req.Steps[4])
+	runbook, err := f.service.CreateRunbook(ctx, req, 1)
+	require.NoError(t, err)
+
+	started, err := f.service.StartRun(ctx, runbook.ID, map[string]string{"share": "music"}, 1)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		run, err := f.service.GetRun(ctx, started.ID)
+		return err == nil && run.Steps[3].Status == RunbookStepRunning
+	}, 5*time.Second, 5*time.Millisecond)
+
+	_, err = f.service.StartRun(ctx, runbook.ID, map[string]string{"share": "music"}, 1)
+	assert.ErrorIs(t, err, ErrRunbookRunning)
+
+	require.NoError(t, f.service.AbortRun(ctx, started.ID))
+	run := f.wait(t, started.ID)
+	assert.Equal(t, RunbookAborted, run.Status)
+	assert.Equal(t, RunbookStepFailed, run.Steps[3].Status)
+	assert.Equal(t, RunbookStepSkipped, run.Steps[4].Status)
+	assert.Equal(t, "the run was aborted", run.Steps[4].Detail)
+	assert.Equal(t, RunbookStepDone, run.Steps[5].Status)
+	assert.Equal(t, []int64{11}, f.scanner.cancelled)
+	assert.Equal(t, []string{"photos"}, f.lockdowns.lockedRoots())
+}
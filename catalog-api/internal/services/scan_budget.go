@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// ioBudget limits the storage operations, directory listings and file
+// hashes, that all running scan jobs perform at once. A freed slot goes
+// to the jobs waiting for one in turn, so a root with thousands of files
+// to hash cannot starve the roots scanned alongside it.
+type ioBudget struct {
+	mu      sync.Mutex
+	free    int
+	waiting map[int64][]chan struct{}
+	// order lists the jobs with waiters, the next to be served first
+	order []int64
+}
+
+func newIOBudget(size int) *ioBudget {
+	return &ioBudget{free: size, waiting: make(map[int64][]chan struct{})}
+}
+
+// acquire waits for a slot on behalf of a job.
+func (b *ioBudget) acquire(ctx context.Context, jobID int64) error {
+	b.mu.Lock()
+	if b.free > 0 && len(b.order) == 0 {
+		b.free--
+		b.mu.Unlock()
+		return nil
+	}
+	granted := make(chan struct{}, 1)
+	if len(b.waiting[jobID]) == 0 {
+		b.order = append(b.order, jobID)
+	}
+	b.waiting[jobID] = append(b.waiting[jobID], granted)
+	b.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue := b.waiting[jobID]
+	for i, ch := range queue {
+		if ch == granted {
+			b.waiting[jobID] = append(queue[:i], queue[i+1:]...)
+			if len(b.waiting[jobID]) == 0 {
+				b.dropJob(jobID)
+			}
+			return ctx.Err()
+		}
+	}
+	// The slot was handed over as the context ended; pass it on
+	b.releaseLocked()
+	return ctx.Err()
+}
+
+// release returns a slot, handing it to the next job in turn.
+func (b *ioBudget) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.releaseLocked()
+}
+
+func (b *ioBudget) releaseLocked() {
+	if len(b.order) == 0 {
+		b.free++
+		return
+	}
+	jobID := b.order[0]
+	queue := b.waiting[jobID]
+	queue[0] <- struct{}{}
+	b.order = b.order[1:]
+	if len(queue) > 1 {
+		b.waiting[jobID] = queue[1:]
+		b.order = append(b.order, jobID)
+	} else {
+		delete(b.waiting, jobID)
+	}
+}
+
+func (b *ioBudget) dropJob(jobID int64) {
+	delete(b.waiting, jobID)
+	for i, id := range b.order {
+		if id == jobID {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			return
+		}
+	}
+}
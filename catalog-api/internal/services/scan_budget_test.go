@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// grant records which job is handed a slot next.
+func grant(t *testing.T, b *ioBudget, jobID int64, granted chan<- int64) {
+	t.Helper()
+	go func() {
+		if b.acquire(context.Background(), jobID) == nil {
+			granted <- jobID
+		}
+	}()
+	// Queue waiters in a known order
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, id := range b.order {
+			if id == jobID {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+}
+
+func TestIOBudget_TakesTurnsBetweenJobs(t *testing.T) {
+	b := newIOBudget(1)
+	require.NoError(t, b.acquire(context.Background(), 1))
+
+	granted := make(chan int64, 4)
+	// The big job queues three hashes before the small job asks for one
+	grant(t, b, 1, granted)
+	b.mu.Lock()
+	assert.Len(t, b.waiting[1], 1)
+	b.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		go func() {
+			if b.acquire(context.Background(), 1) == nil {
+				granted <- 1
+			}
+		}()
+	}
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.waiting[1]) == 3
+	}, time.Second, time.Millisecond)
+	grant(t, b, 2, granted)
+
+	var order []int64
+	for i := 0; i < 4; i++ {
+		b.release()
+		order = append(order, <-granted)
+	}
+	assert.Equal(t, []int64{1, 2, 1, 1}, order)
+
+	b.release()
+	assert.Equal(t, 1, b.free)
+}
+
+func TestIOBudget_CancelledWaiterGivesUpItsTurn(t *testing.T) {
+	b := newIOBudget(1)
+	require.NoError(t, b.acquire(context.Background(), 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.acquire(ctx, 2) }()
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.order) == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, b.order)
+
+	b.release()
+	assert.Equal(t, 1, b.free)
+	require.NoError(t, b.acquire(context.Background(), 3))
+}
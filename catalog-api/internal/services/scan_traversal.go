@@ -0,0 +1,271 @@
+package services
+
+import (
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How scans treat symlinks, per storage root.
+const (
+	// SymlinkPolicyNever skips symlinks, neither following nor
+	// cataloging them
+	SymlinkPolicyNever = "never"
+	// SymlinkPolicySameDevice follows symlinks to targets on the
+	// filesystem of the root, on storage that can tell
+	SymlinkPolicySameDevice = "same_device"
+	// SymlinkPolicyAlways follows every symlink
+	SymlinkPolicyAlways = "always"
+)
+
+// ScanTraversalPolicy controls how scans of one storage root walk it:
+// whether they follow symlinks, how deep they go and whether they cross
+// into other filesystems mounted below the root. Followed symlinks are
+// cataloged as their target.
+//
+// Device and cycle checks need storage that can identify files, which
+// local roots can. There a directory already being walked is never
+// entered again, so symlink loops end at once. Elsewhere same_device
+// follows nothing, mount points are not noticed and only the depth limit
+// bounds a loop.
+type ScanTraversalPolicy struct {
+	StorageRootID  int64  `json:"storage_root_id"`
+	StorageRoot    string `json:"storage_root"`
+	FollowSymlinks string `json:"follow_symlinks"`
+	// MaxDepth replaces the root's max_depth when positive
+	MaxDepth         int       `json:"max_depth"`
+	CrossFilesystems bool      `json:"cross_filesystems"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// defaultTraversalPolicy is the policy of roots without one: symlinks are
+// skipped and mount points entered.
+func defaultTraversalPolicy(root *models.StorageRoot) ScanTraversalPolicy {
+	return ScanTraversalPolicy{
+		StorageRootID:    root.ID,
+		StorageRoot:      root.Name,
+		FollowSymlinks:   SymlinkPolicyNever,
+		CrossFilesystems: true,
+	}
+}
+
+// SetTraversalPolicy creates or replaces the traversal policy of a storage
+// root. It applies from the next scan of the root.
+func (s *ScannerService) SetTraversalPolicy(ctx context.Context, policy ScanTraversalPolicy) (*ScanTraversalPolicy, error) {
+	switch policy.FollowSymlinks {
+	case SymlinkPolicyNever, SymlinkPolicySameDevice, SymlinkPolicyAlways:
+	default:
+		return nil, fmt.Errorf("invalid traversal policy: follow_symlinks must be never, same_device or always")
+	}
+	if policy.MaxDepth < 0 {
+		return nil, fmt.Errorf("invalid traversal policy: max_depth must not be negative")
+	}
+	if _, err := s.loadScanRoot(ctx, policy.StorageRootID); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE scan_traversal_policies SET follow_symlinks = ?, max_depth = ?, cross_filesystems = ?, updated_at = ?
+		 WHERE storage_root_id = ?`,
+		policy.FollowSymlinks, policy.MaxDepth, policy.CrossFilesystems, s.now(), policy.StorageRootID)
+	if err == nil {
+		if n, _ := res.RowsAffected(); n == 0 {
+			_, err = s.db.ExecContext(ctx,
+				`INSERT INTO scan_traversal_policies (storage_root_id, follow_symlinks, max_depth, cross_filesystems, updated_at)
+				 VALUES (?, ?, ?, ?, ?)`,
+				policy.StorageRootID, policy.FollowSymlinks, policy.MaxDepth, policy.CrossFilesystems, s.now())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save traversal policy: %w", err)
+	}
+	return s.GetTraversalPolicy(ctx, policy.StorageRootID)
+}
+
+const traversalPolicyColumns = `tp.storage_root_id, sr.name, tp.follow_symlinks, tp.max_depth, tp.cross_filesystems, tp.updated_at`
+
+func scanTraversalPolicy(row shareLinkScanner) (*ScanTraversalPolicy, error) {
+	var policy ScanTraversalPolicy
+	if err := row.Scan(&policy.StorageRootID, &policy.StorageRoot, &policy.FollowSymlinks, &policy.MaxDepth,
+		&policy.CrossFilesystems, &policy.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetTraversalPolicy returns the traversal policy of a storage root.
+func (s *ScannerService) GetTraversalPolicy(ctx context.Context, storageRootID int64) (*ScanTraversalPolicy, error) {
+	policy, err := scanTraversalPolicy(s.db.QueryRowContext(ctx,
+		`SELECT `+traversalPolicyColumns+` FROM scan_traversal_policies tp JOIN storage_roots sr ON sr.id = tp.storage_root_id
+		 WHERE tp.storage_root_id = ?`, storageRootID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("traversal policy for storage root %d not found", storageRootID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load traversal policy: %w", err)
+	}
+	return policy, nil
+}
+
+// ListTraversalPolicies returns every traversal policy.
+func (s *ScannerService) ListTraversalPolicies(ctx context.Context) ([]ScanTraversalPolicy, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+traversalPolicyColumns+` FROM scan_traversal_policies tp JOIN storage_roots sr ON sr.id = tp.storage_root_id
+		 ORDER BY sr.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list traversal policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []ScanTraversalPolicy
+	for rows.Next() {
+		policy, err := scanTraversalPolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan traversal policy: %w", err)
+		}
+		policies = append(policies, *policy)
+	}
+	return policies, rows.Err()
+}
+
+// DeleteTraversalPolicy returns a storage root to the default policy.
+func (s *ScannerService) DeleteTraversalPolicy(ctx context.Context, storageRootID int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM scan_traversal_policies WHERE storage_root_id = ?`, storageRootID)
+	if err != nil {
+		return fmt.Errorf("failed to delete traversal policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("traversal policy for storage root %d not found", storageRootID)
+	}
+	return nil
+}
+
+// loadTraversalPolicy returns the policy a root is scanned under.
+func (s *ScannerService) loadTraversalPolicy(ctx context.Context, root *models.StorageRoot) (ScanTraversalPolicy, error) {
+	policy, err := scanTraversalPolicy(s.db.QueryRowContext(ctx,
+		`SELECT `+traversalPolicyColumns+` FROM scan_traversal_policies tp JOIN storage_roots sr ON sr.id = tp.storage_root_id
+		 WHERE tp.storage_root_id = ?`, root.ID))
+	if err == sql.ErrNoRows {
+		return defaultTraversalPolicy(root), nil
+	}
+	if err != nil {
+		return ScanTraversalPolicy{}, err
+	}
+	return *policy, nil
+}
+
+// FileIdentity identifies the file behind a path on the storage host.
+type FileIdentity struct {
+	Device uint64
+	Inode  uint64
+}
+
+// errFileIdentityUnsupported is returned for storage that cannot
+// identify files.
+var errFileIdentityUnsupported = errors.New("storage cannot identify files")
+
+// fileIdentifier is implemented by providers that can identify the file
+// behind a path, following symlinks.
+type fileIdentifier interface {
+	Identify(ctx context.Context, path string) (FileIdentity, error)
+}
+
+// identifyFile identifies a file through provider, if it can.
+func identifyFile(ctx context.Context, provider StorageProvider, path string) (FileIdentity, error) {
+	if identifier, ok := provider.(fileIdentifier); ok {
+		return identifier.Identify(ctx, path)
+	}
+	return FileIdentity{}, errFileIdentityUnsupported
+}
+
+// traversalSkip is why a walk does not enter a directory.
+type traversalSkip int
+
+const (
+	traversalEnter traversalSkip = iota
+	traversalSkipCycle
+	traversalSkipMount
+)
+
+// scanTraversal applies a traversal policy to one walk of a root.
+type scanTraversal struct {
+	policy   ScanTraversalPolicy
+	provider StorageProvider
+	// identified is set when the provider identified the root, which the
+	// device and cycle checks need
+	identified bool
+	rootDevice uint64
+	// walking holds the directories being walked, root to current
+	walking map[FileIdentity]bool
+}
+
+// newScanTraversal starts a walk. Files are only identified when the
+// policy can follow symlinks or stops at mount points.
+func newScanTraversal(ctx context.Context, provider StorageProvider, policy ScanTraversalPolicy) *scanTraversal {
+	t := &scanTraversal{policy: policy, provider: provider, walking: make(map[FileIdentity]bool)}
+	if policy.FollowSymlinks == SymlinkPolicyNever && policy.CrossFilesystems {
+		return t
+	}
+	if root, err := identifyFile(ctx, provider, ""); err == nil {
+		t.identified = true
+		t.rootDevice = root.Device
+		t.walking[root] = true
+	}
+	return t
+}
+
+// follow resolves a symlink to its target under the policy, keeping the
+// link's name. It returns false for links that are not followed,
+// including broken ones.
+func (t *scanTraversal) follow(ctx context.Context, rel string, link *filesystem.FileInfo) (*filesystem.FileInfo, bool) {
+	switch t.policy.FollowSymlinks {
+	case SymlinkPolicyAlways:
+	case SymlinkPolicySameDevice:
+		if !t.identified {
+			return nil, false
+		}
+		target, err := identifyFile(ctx, t.provider, rel)
+		if err != nil || target.Device != t.rootDevice {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	target, err := t.provider.Stat(ctx, rel)
+	if err != nil || target == nil {
+		return nil, false
+	}
+	followed := *target
+	followed.Name = link.Name
+	followed.Path = link.Path
+	return &followed, true
+}
+
+// enter checks a directory before the walk descends into it and returns
+// the function to call once it has been walked. Directories reached
+// through a symlink are not checked for crossing filesystems; the
+// symlink policy covers them.
+func (t *scanTraversal) enter(ctx context.Context, rel string, followed bool) (func(), traversalSkip) {
+	leave := func() {}
+	if !t.identified {
+		return leave, traversalEnter
+	}
+	dir, err := identifyFile(ctx, t.provider, rel)
+	if err != nil {
+		// Listing it reports the problem
+		return leave, traversalEnter
+	}
+	if t.walking[dir] {
+		return nil, traversalSkipCycle
+	}
+	if !followed && !t.policy.CrossFilesystems && dir.Device != t.rootDevice {
+		return nil, traversalSkipMount
+	}
+	t.walking[dir] = true
+	return func() { delete(t.walking, dir) }, traversalEnter
+}
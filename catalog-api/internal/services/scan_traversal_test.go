@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (f *scannerFixture) symlink(t *testing.T, target, name string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	require.NoError(t, os.Symlink(target, filepath.Join(f.dir, filepath.FromSlash(name))))
+}
+
+func (f *scannerFixture) cataloged(t *testing.T, path string) bool {
+	t.Helper()
+	var count int
+	require.NoError(t, f.db.QueryRowContext(context.Background(),
+		`SELECT COUNT(*) FROM files WHERE storage_root_id = ? AND path = ? AND deleted = ?`, f.rootID, path, false).Scan(&count))
+	return count > 0
+}
+
+func TestScannerService_SkipsSymlinksByDefault(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "films/a.mkv", "aaaa")
+	f.symlink(t, "films", "shortcut")
+	f.symlink(t, "films/a.mkv", "latest.mkv")
+
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.Equal(t, int64(2), job.SkippedSymlinks)
+	assert.False(t, f.cataloged(t, "shortcut"))
+	assert.False(t, f.cataloged(t, "latest.mkv"))
+	assert.True(t, f.cataloged(t, "films/a.mkv"))
+
+	// The counters are kept with the finished job
+	jobs, err := f.svc.ListJobs(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), jobs[0].SkippedSymlinks)
+}
+
+func TestScannerService_FollowsSymlinksWithoutLooping(t *testing.T) {
+	f := newScannerFixture(t)
+	ctx := context.Background()
+	f.write(t, "films/a.mkv", "aaaa")
+	f.symlink(t, "films", "shortcut")
+	f.symlink(t, "a.mkv", "films/latest.mkv")
+	// Links back to the directory they are in, and to the root
+	f.symlink(t, ".", "films/again")
+	f.symlink(t, "..", "films/up")
+	f.symlink(t, "missing", "broken")
+
+	for _, follow := range []string{SymlinkPolicyAlways, SymlinkPolicySameDevice} {
+		_, err := f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: f.rootID, FollowSymlinks: follow, CrossFilesystems: true})
+		require.NoError(t, err)
+
+		job := f.scan(t)
+		assert.Equal(t, ScanJobCompleted, job.Status, follow)
+		assert.Equal(t, int64(1), job.SkippedSymlinks, "only the broken link is skipped with %s", follow)
+		assert.Positive(t, job.SkippedCycles, follow)
+		assert.Zero(t, job.ErrorCount, follow)
+
+		// Followed links are cataloged as their target
+		assert.Equal(t, int64(4), f.file(t, "films/latest.mkv").size, follow)
+		assert.True(t, f.cataloged(t, "shortcut/a.mkv"), follow)
+		assert.False(t, f.cataloged(t, "broken"), follow)
+		// A link into a directory being walked is cataloged but not entered
+		assert.True(t, f.cataloged(t, "films/again"), follow)
+		assert.False(t, f.cataloged(t, "films/again/a.mkv"), follow)
+		assert.False(t, f.cataloged(t, "films/up/films"), follow)
+	}
+}
+
+func TestScannerService_TraversalPolicyDepth(t *testing.T) {
+	f := newScannerFixture(t)
+	ctx := context.Background()
+	f.write(t, "a/b/c/deep.txt", "d")
+
+	_, err := f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: f.rootID, FollowSymlinks: SymlinkPolicyNever, MaxDepth: 2})
+	require.NoError(t, err)
+	job := f.scan(t)
+	assert.Equal(t, int64(1), job.SkippedDepth)
+	assert.True(t, f.cataloged(t, "a/b/c"))
+	assert.False(t, f.cataloged(t, "a/b/c/deep.txt"))
+
+	// Without a policy the root's own max_depth applies again
+	require.NoError(t, f.svc.DeleteTraversalPolicy(ctx, f.rootID))
+	job = f.scan(t)
+	assert.Zero(t, job.SkippedDepth)
+	assert.True(t, f.cataloged(t, "a/b/c/deep.txt"))
+}
+
+func TestScannerService_TraversalPolicies(t *testing.T) {
+	f := newScannerFixture(t)
+	ctx := context.Background()
+
+	_, err := f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: f.rootID, FollowSymlinks: "sometimes"})
+	assert.ErrorContains(t, err, "invalid traversal policy")
+	_, err = f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: f.rootID, FollowSymlinks: SymlinkPolicyNever, MaxDepth: -1})
+	assert.ErrorContains(t, err, "invalid traversal policy")
+	_, err = f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: 999, FollowSymlinks: SymlinkPolicyNever})
+	assert.ErrorContains(t, err, "not found")
+
+	policy, err := f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: f.rootID, FollowSymlinks: SymlinkPolicyAlways})
+	require.NoError(t, err)
+	assert.Equal(t, "media", policy.StorageRoot)
+	assert.False(t, policy.CrossFilesystems)
+
+	policy, err = f.svc.SetTraversalPolicy(ctx, ScanTraversalPolicy{StorageRootID: f.rootID, FollowSymlinks: SymlinkPolicySameDevice, MaxDepth: 3, CrossFilesystems: true})
+	require.NoError(t, err)
+	assert.Equal(t, SymlinkPolicySameDevice, policy.FollowSymlinks)
+	assert.Equal(t, 3, policy.MaxDepth)
+	assert.True(t, policy.CrossFilesystems)
+
+	policies, err := f.svc.ListTraversalPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+
+	require.NoError(t, f.svc.DeleteTraversalPolicy(ctx, f.rootID))
+	assert.ErrorContains(t, f.svc.DeleteTraversalPolicy(ctx, f.rootID), "not found")
+	_, err = f.svc.GetTraversalPolicy(ctx, f.rootID)
+	assert.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultScanWriteBatchSize is how many catalog rows a scan commits
+	// per transaction unless configured otherwise.
+	defaultScanWriteBatchSize = 1000
+	// scanWriteFlushInterval bounds how long a row waits for its batch to
+	// fill, so a slow walk still commits as it goes.
+	scanWriteFlushInterval = time.Second
+)
+
+// catalogWrite is one row a scan writes to the catalog. exec writes it
+// in a batch; done runs once the batch has committed, failed if the row
+// could not be written. All three run on the writer goroutine.
+type catalogWrite struct {
+	exec   func(ctx context.Context, b *catalogBatch) error
+	done   func()
+	failed func(err error)
+}
+
+// catalogWriter writes the catalog rows of a scan on a dedicated
+// goroutine, so listing storage and writing the catalog overlap. Rows
+// are committed in transactions of up to batchSize, in the order they
+// were queued, with each statement prepared once per transaction. When
+// a row fails its batch is rolled back and replayed row by row, so a bad
+// row only costs itself. Rows still queued when the scan is cancelled
+// are dropped.
+type catalogWriter struct {
+	db        *database.DB
+	logger    *zap.Logger
+	batchSize int
+	// committed reports each batch written, with the time it took
+	committed func(rows int, elapsed time.Duration)
+
+	writes chan catalogWrite
+	done   chan struct{}
+}
+
+func newCatalogWriter(ctx context.Context, db *database.DB, logger *zap.Logger, batchSize int,
+	committed func(rows int, elapsed time.Duration)) *catalogWriter {
+	if batchSize <= 0 {
+		batchSize = defaultScanWriteBatchSize
+	}
+	w := &catalogWriter{
+		db:        db,
+		logger:    logger,
+		batchSize: batchSize,
+		committed: committed,
+		writes:    make(chan catalogWrite, batchSize),
+		done:      make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// write queues a row, waiting while a full batch is ahead of it.
+func (w *catalogWriter) write(row catalogWrite) {
+	w.writes <- row
+}
+
+// close writes the rows still queued and stops the writer.
+func (w *catalogWriter) close() {
+	close(w.writes)
+	<-w.done
+}
+
+func (w *catalogWriter) run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(scanWriteFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]catalogWrite, 0, w.batchSize)
+	for {
+		select {
+		case row, ok := <-w.writes:
+			if !ok {
+				w.flush(ctx, batch)
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		w.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes a batch in one transaction, falling back to one row at a
+// time if the transaction fails.
+func (w *catalogWriter) flush(ctx context.Context, batch []catalogWrite) {
+	if len(batch) == 0 || ctx.Err() != nil {
+		return
+	}
+	started := time.Now()
+	if err := w.commit(ctx, batch); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		w.logger.Debug("Catalog write batch failed, writing rows one at a time",
+			zap.Int("rows", len(batch)), zap.Error(err))
+		w.replay(ctx, batch, started)
+		return
+	}
+	for _, row := range batch {
+		if row.done != nil {
+			row.done()
+		}
+	}
+	if w.committed != nil {
+		w.committed(len(batch), time.Since(started))
+	}
+}
+
+func (w *catalogWriter) commit(ctx context.Context, batch []catalogWrite) error {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	b := &catalogBatch{db: w.db, conn: tx, stmts: make(map[string]*sql.Stmt)}
+	defer b.close()
+	for _, row := range batch {
+		if err := row.exec(ctx, b); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// replay writes each row of a failed batch on its own.
+func (w *catalogWriter) replay(ctx context.Context, batch []catalogWrite, started time.Time) {
+	b := &catalogBatch{db: w.db, conn: w.db.DB, stmts: make(map[string]*sql.Stmt)}
+	defer b.close()
+	written := 0
+	for _, row := range batch {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := row.exec(ctx, b); err != nil {
+			if row.failed != nil && ctx.Err() == nil {
+				row.failed(err)
+			}
+			continue
+		}
+		written++
+		if row.done != nil {
+			row.done()
+		}
+	}
+	if w.committed != nil && written > 0 {
+		w.committed(written, time.Since(started))
+	}
+}
+
+// statementPreparer is a transaction or connection pool statements are
+// prepared on.
+type statementPreparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// catalogBatch runs the statements of one batch, preparing each distinct
+// query once.
+type catalogBatch struct {
+	db    *database.DB
+	conn  statementPreparer
+	stmts map[string]*sql.Stmt
+}
+
+func (b *catalogBatch) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := b.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := b.conn.PrepareContext(ctx, b.db.Dialect().RewritePlaceholders(query))
+	if err != nil {
+		return nil, err
+	}
+	b.stmts[query] = stmt
+	return stmt, nil
+}
+
+// exec runs a statement.
+func (b *catalogBatch) exec(ctx context.Context, query string, args ...interface{}) error {
+	stmt, err := b.prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, args...)
+	return err
+}
+
+// insert runs an INSERT and returns the new row's ID.
+func (b *catalogBatch) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	if b.db.Dialect().IsPostgres() {
+		stmt, err := b.prepare(ctx, query+" RETURNING id")
+		if err != nil {
+			return 0, err
+		}
+		var id int64
+		if err := stmt.QueryRowContext(ctx, args...).Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	stmt, err := b.prepare(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (b *catalogBatch) close() {
+	for _, stmt := range b.stmts {
+		stmt.Close()
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newScanWriterTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	_, err = sqlDB.Exec(`CREATE TABLE items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		parent_id INTEGER
+	)`)
+	require.NoError(t, err)
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+func TestCatalogWriter_CommitsInBatches(t *testing.T) {
+	db := newScanWriterTestDB(t)
+	var batches []int
+	w := newCatalogWriter(context.Background(), db, zap.NewNop(), 4, func(rows int, elapsed time.Duration) {
+		batches = append(batches, rows)
+	})
+
+	// Later rows see the IDs of earlier ones, as children see their parents
+	ids := make(map[string]int64)
+	done := 0
+	for i := 0; i < 10; i++ {
+		name, parent := fmt.Sprintf("item-%d", i), fmt.Sprintf("item-%d", i-1)
+		w.write(catalogWrite{
+			exec: func(ctx context.Context, b *catalogBatch) error {
+				var parentID *int64
+				if id, ok := ids[parent]; ok {
+					parentID = &id
+				}
+				id, err := b.insert(ctx, `INSERT INTO items (name, parent_id) VALUES (?, ?)`, name, parentID)
+				ids[name] = id
+				return err
+			},
+			done: func() { done++ },
+		})
+	}
+	w.close()
+
+	assert.Equal(t, []int{4, 4, 2}, batches)
+	assert.Equal(t, 10, done)
+	var parentID int64
+	require.NoError(t, db.QueryRow(`SELECT parent_id FROM items WHERE name = 'item-9'`).Scan(&parentID))
+	assert.Equal(t, ids["item-8"], parentID)
+}
+
+func TestCatalogWriter_FailedRowOnlyCostsItself(t *testing.T) {
+	db := newScanWriterTestDB(t)
+	_, err := db.Exec(`INSERT INTO items (name) VALUES ('taken')`)
+	require.NoError(t, err)
+
+	written := 0
+	w := newCatalogWriter(context.Background(), db, zap.NewNop(), 10, func(rows int, elapsed time.Duration) {
+		written += rows
+	})
+	var failed []error
+	for _, name := range []string{"a", "taken", "b"} {
+		w.write(catalogWrite{
+			exec: func(ctx context.Context, b *catalogBatch) error {
+				return b.exec(ctx, `INSERT INTO items (name) VALUES (?)`, name)
+			},
+			failed: func(err error) { failed = append(failed, err) },
+		})
+	}
+	w.close()
+
+	assert.Equal(t, 2, written)
+	require.Len(t, failed, 1)
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&count))
+	assert.Equal(t, 3, count)
+}
+
+func TestCatalogWriter_FlushesPartialBatch(t *testing.T) {
+	db := newScanWriterTestDB(t)
+	committed := make(chan int, 1)
+	w := newCatalogWriter(context.Background(), db, zap.NewNop(), 100, func(rows int, elapsed time.Duration) {
+		committed <- rows
+	})
+	defer w.close()
+
+	w.write(catalogWrite{exec: func(ctx context.Context, b *catalogBatch) error {
+		return b.exec(ctx, `INSERT INTO items (name) VALUES ('slow')`)
+	}})
+	select {
+	case rows := <-committed:
+		assert.Equal(t, 1, rows)
+	case <-time.After(5 * scanWriteFlushInterval):
+		t.Fatal("partial batch was not committed")
+	}
+}
+
+func TestCatalogWriter_DropsRowsOnceCancelled(t *testing.T) {
+	db := newScanWriterTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := newCatalogWriter(ctx, db, zap.NewNop(), 10, nil)
+	cancel()
+	w.write(catalogWrite{
+		exec: func(ctx context.Context, b *catalogBatch) error {
+			return b.exec(ctx, `INSERT INTO items (name) VALUES ('late')`)
+		},
+		failed: func(err error) { t.Errorf("unexpected failure: %v", err) },
+		done:   func() { t.Error("dropped row reported written") },
+	})
+	w.close()
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&count))
+	assert.Zero(t, count)
+}
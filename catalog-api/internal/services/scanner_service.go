@@ -0,0 +1,1484 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/filesystem"
+	"catalogizer/internal/metrics"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// Scan job states.
+const (
+	ScanJobQueued    = "queued"
+	ScanJobRunning   = "running"
+	ScanJobCompleted = "completed"
+	ScanJobFailed    = "failed"
+	ScanJobCancelled = "cancelled"
+)
+
+// Phases of a running scan job.
+const (
+	ScanPhaseListing = "listing"
+	ScanPhaseHashing = "hashing"
+)
+
+// What started a scan job.
+const (
+	ScanTriggerManual   = "manual"
+	ScanTriggerSchedule = "schedule"
+	// ScanTriggerResume restarts a scan a server restart interrupted
+	ScanTriggerResume = "resume"
+	// ScanTriggerRunbook is a rescan step of a maintenance runbook
+	ScanTriggerRunbook = "runbook"
+)
+
+// ScanJobProgress is the state of a scan job. Counters are live while the
+// job runs and final once it has finished.
+//
+// A running job also reports its phase, with the rate and estimated
+// completion of that phase; these are not kept once it has finished.
+// While listing, FilesExpected is the size of the root's catalog after
+// its previous scan, so a first scan has no ETA. While hashing, it is the
+// number of files to hash, counted by FilesHashed.
+//
+// RowsWritten counts the catalog rows a running job has committed and
+// RowsPerSecond the rate the catalog took them at, over the time spent
+// writing. Like the phase rate they are not kept once it has finished,
+// but its final event carries them.
+//
+// The skipped counters are the symlinks not followed, directories not
+// entered again because the walk was already inside them, directories
+// beyond the depth limit and mount points not crossed, under the root's
+// ScanTraversalPolicy. Skipped directories are cataloged but not walked;
+// skipped symlinks are not cataloged.
+type ScanJobProgress struct {
+	ID              int64      `json:"id"`
+	StorageRootID   int64      `json:"storage_root_id"`
+	StorageRoot     string     `json:"storage_root"`
+	Trigger         string     `json:"trigger"`
+	Status          string     `json:"status"`
+	Phase           string     `json:"phase,omitempty"`
+	CurrentPath     string     `json:"current_path,omitempty"`
+	FilesProcessed  int64      `json:"files_processed"`
+	FilesAdded      int64      `json:"files_added"`
+	FilesUpdated    int64      `json:"files_updated"`
+	FilesDeleted    int64      `json:"files_deleted"`
+	FilesRenamed    int64      `json:"files_renamed"`
+	FilesHashed     int64      `json:"files_hashed,omitempty"`
+	FilesExpected   int64      `json:"files_expected,omitempty"`
+	FilesPerSecond  float64    `json:"files_per_second,omitempty"`
+	ETA             *time.Time `json:"eta,omitempty"`
+	RowsWritten     int64      `json:"rows_written,omitempty"`
+	RowsPerSecond   float64    `json:"rows_per_second,omitempty"`
+	SkippedSymlinks int64      `json:"skipped_symlinks"`
+	SkippedCycles   int64      `json:"skipped_cycles"`
+	SkippedDepth    int64      `json:"skipped_depth"`
+	SkippedMounts   int64      `json:"skipped_mounts"`
+	ErrorCount      int64      `json:"error_count"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// ScanSchedule scans one storage root on a cron schedule. The cron fields
+// are read on the wall clock of TimeZone, an IANA name, or of the server
+// when it is empty.
+type ScanSchedule struct {
+	ID            int64      `json:"id"`
+	StorageRootID int64      `json:"storage_root_id"`
+	StorageRoot   string     `json:"storage_root"`
+	Cron          string     `json:"cron"`
+	TimeZone      string     `json:"time_zone"`
+	Enabled       bool       `json:"enabled"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	// LastRunAtLocal and NextRunAtLocal repeat LastRunAt and NextRunAt in
+	// DisplayTimeZone, the time zone of the user reading the schedule.
+	LastRunAtLocal  *time.Time `json:"last_run_at_local,omitempty"`
+	NextRunAtLocal  *time.Time `json:"next_run_at_local,omitempty"`
+	DisplayTimeZone string     `json:"display_time_zone,omitempty"`
+}
+
+// Localize puts the schedule's run times in UTC and fills in their
+// representation in loc.
+func (s *ScanSchedule) Localize(loc *time.Location) {
+	s.LastRunAt, s.NextRunAt = models.TimeIn(s.LastRunAt, time.UTC), models.TimeIn(s.NextRunAt, time.UTC)
+	s.LastRunAtLocal, s.NextRunAtLocal = models.TimeIn(s.LastRunAt, loc), models.TimeIn(s.NextRunAt, loc)
+	s.DisplayTimeZone = loc.String()
+}
+
+// ScannerConfig configures ScannerService.
+type ScannerConfig struct {
+	// MaxConcurrentJobs limits how many roots are scanned at once.
+	// Defaults to 4; further jobs wait in the queued state.
+	MaxConcurrentJobs int
+	// MaxIOWorkers limits the directory listings and file hashes in
+	// flight across all running jobs. Defaults to 8. A job hashes on up
+	// to this many workers, and jobs take turns for free slots.
+	MaxIOWorkers int
+	// CheckInterval is how often due schedules are started. Defaults to
+	// a minute, the resolution of a cron expression.
+	CheckInterval time.Duration
+	// WriteBatchSize is how many catalog rows a job commits per
+	// transaction. Defaults to 1000.
+	WriteBatchSize int
+}
+
+// ScannerService keeps the catalog in step with storage. Each job walks a
+// storage root through its StorageProvider, updates changed files in
+// place, adds new ones, matches files that moved to their old records
+// and marks files that disappeared as deleted, then hashes file content
+// for duplicate detection. Catalog writes are committed in batches on a
+// writer goroutine while the walk goes on. Jobs are started on demand or
+// from per-root cron schedules and recorded in scan_history. Roots are
+// scanned in parallel and share one I/O budget; admins can further cap
+// how fast a root is read for hashing, and set how its walk treats
+// symlinks, depth and mount points. Content hashes of large files are
+// checkpointed, and scans a restart interrupted are started again, so
+// hashing resumes where it stopped.
+type ScannerService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	providers *StorageProviderFactory
+	config    ScannerConfig
+	now       func() time.Time
+	deps      dependencyChecker
+	events    EventPublisher
+	detector  ransomwareObserver
+
+	slots chan struct{}
+	io    *ioBudget
+
+	mu     sync.Mutex
+	jobs   map[int64]*scanJob
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// scanJob is a queued or running job.
+type scanJob struct {
+	progress  ScanJobProgress
+	root      *models.StorageRoot
+	cancel    context.CancelFunc
+	published time.Time
+	// phaseStarted is when the current phase began, for its rate
+	phaseStarted time.Time
+	// hashLimiter paces the content reads of the hashing phase
+	hashLimiter *rate.Limiter
+	// writeTime is the time spent committing catalog rows
+	writeTime time.Duration
+	// traversal is the policy the root is walked under
+	traversal ScanTraversalPolicy
+	// detector is told of the job's renames and rewrites
+	detector ransomwareObserver
+	// rewritten holds the IDs of files whose content changed since the
+	// last scan, whose new content the detector samples while hashing
+	rewritten map[int64]bool
+}
+
+// scanProgressInterval is the minimum time between progress events for
+// one job; status changes are always published.
+const scanProgressInterval = 500 * time.Millisecond
+
+// NewScannerService creates a new ScannerService.
+func NewScannerService(db *database.DB, logger *zap.Logger, providers *StorageProviderFactory, config ScannerConfig) *ScannerService {
+	if config.MaxConcurrentJobs <= 0 {
+		config.MaxConcurrentJobs = 4
+	}
+	if config.MaxIOWorkers <= 0 {
+		config.MaxIOWorkers = 8
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Minute
+	}
+	if config.WriteBatchSize <= 0 {
+		config.WriteBatchSize = defaultScanWriteBatchSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ScannerService{
+		db:        db,
+		logger:    logger,
+		providers: providers,
+		config:    config,
+		now:       time.Now,
+		slots:     make(chan struct{}, config.MaxConcurrentJobs),
+		io:        newIOBudget(config.MaxIOWorkers),
+		jobs:      make(map[int64]*scanJob),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// dependencyChecker reports why a dependency is unavailable.
+type dependencyChecker interface {
+	Check(name string) error
+}
+
+// SetDependencyChecker makes StartScan refuse roots that failed their
+// latest availability probe.
+func (s *ScannerService) SetDependencyChecker(deps dependencyChecker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deps = deps
+}
+
+// SetEventPublisher pushes job progress and newly cataloged files to
+// real-time clients.
+func (s *ScannerService) SetEventPublisher(events EventPublisher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = events
+}
+
+// ransomwareObserver is told of the renames and rewrites a scan finds.
+type ransomwareObserver interface {
+	ObserveRename(ctx context.Context, storageRoot, oldPath, newPath string)
+	ObserveWrite(ctx context.Context, storageRoot, path string, sample []byte)
+	SampleSize() int
+}
+
+// SetRansomwareDetector passes the files scans find moved, and samples of
+// files they find rewritten, to the ransomware heuristics.
+func (s *ScannerService) SetRansomwareDetector(detector ransomwareObserver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.detector = detector
+}
+
+// Start marks jobs left over from a previous run as failed, scans their
+// roots again and begins starting scheduled scans.
+func (s *ScannerService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.resumeInterrupted(context.Background())
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunDueSchedules(context.Background())
+			}
+		}
+	}()
+}
+
+// resumeInterrupted closes the jobs a restart left queued or running and
+// starts a new scan of each of their roots. Files hashed before the
+// restart keep their hashes and large files resume from their last
+// checkpoint, so only the walk is repeated in full.
+func (s *ScannerService) resumeInterrupted(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT storage_root_id FROM scan_history WHERE status IN (?, ?)`, ScanJobQueued, ScanJobRunning)
+	if err != nil {
+		s.logger.Warn("Failed to load interrupted scan jobs", zap.Error(err))
+		return
+	}
+	var rootIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			s.logger.Warn("Failed to scan interrupted scan job", zap.Error(err))
+			continue
+		}
+		rootIDs = append(rootIDs, id)
+	}
+	rows.Close()
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE scan_history SET status = ?, end_time = ?, error_message = ? WHERE status IN (?, ?)`,
+		ScanJobFailed, s.now(), "interrupted by server restart", ScanJobQueued, ScanJobRunning); err != nil {
+		s.logger.Warn("Failed to close interrupted scan jobs", zap.Error(err))
+		return
+	}
+	for _, id := range rootIDs {
+		if _, err := s.StartScan(ctx, id, ScanTriggerResume); err != nil {
+			s.logger.Warn("Failed to resume interrupted scan", zap.Int64("storage_root_id", id), zap.Error(err))
+		}
+	}
+}
+
+// Stop ends the schedule, cancels scans in progress and waits for them
+// to exit.
+func (s *ScannerService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// loadScanRoot loads a storage root with its connection and scan settings.
+func (s *ScannerService) loadScanRoot(ctx context.Context, id int64) (*models.StorageRoot, error) {
+	var root models.StorageRoot
+	var enabled sql.NullBool
+	var maxDepth sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, name, protocol, host, port, path, username, password, domain, mount_point, options, url,
+		        enabled, max_depth
+		 FROM storage_roots WHERE id = ?`, id).Scan(
+		&root.ID, &root.Name, &root.Protocol, &root.Host, &root.Port, &root.Path, &root.Username,
+		&root.Password, &root.Domain, &root.MountPoint, &root.Options, &root.URL, &enabled, &maxDepth)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("storage root %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage root %d: %w", id, err)
+	}
+	root.Enabled = !enabled.Valid || enabled.Bool
+	root.MaxDepth = int(maxDepth.Int64)
+	if root.MaxDepth <= 0 {
+		root.MaxDepth = 10
+	}
+	return &root, nil
+}
+
+// StartScan queues a scan of a storage root. A root is only scanned by
+// one job at a time.
+func (s *ScannerService) StartScan(ctx context.Context, storageRootID int64, trigger string) (*ScanJobProgress, error) {
+	root, err := s.loadScanRoot(ctx, storageRootID)
+	if err != nil {
+		return nil, err
+	}
+	if !root.Enabled {
+		return nil, fmt.Errorf("storage root %s is disabled", root.Name)
+	}
+	if trigger != ScanTriggerSchedule && trigger != ScanTriggerResume && trigger != ScanTriggerRunbook {
+		trigger = ScanTriggerManual
+	}
+	bytesPerSecond, err := s.loadHashRateLimit(ctx, root.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hash rate limit: %w", err)
+	}
+	traversal, err := s.loadTraversalPolicy(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load traversal policy: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return nil, fmt.Errorf("scanner is shutting down")
+	}
+	if s.deps != nil {
+		if err := s.deps.Check(StorageRootDependency(root.Name)); err != nil {
+			return nil, err
+		}
+	}
+	for _, job := range s.jobs {
+		if job.progress.StorageRootID == root.ID {
+			return nil, fmt.Errorf("storage root %s is already being scanned", root.Name)
+		}
+	}
+
+	job := &scanJob{
+		root:        root,
+		hashLimiter: newHashLimiter(bytesPerSecond),
+		traversal:   traversal,
+		detector:    s.detector,
+		rewritten:   make(map[int64]bool),
+		progress: ScanJobProgress{
+			StorageRootID: root.ID,
+			StorageRoot:   root.Name,
+			Trigger:       trigger,
+			Status:        ScanJobQueued,
+			StartedAt:     s.now(),
+		},
+	}
+	job.progress.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO scan_history (storage_root_id, scan_type, status, start_time, triggered_by) VALUES (?, ?, ?, ?, ?)`,
+		root.ID, "full", ScanJobQueued, job.progress.StartedAt, trigger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record scan job: %w", err)
+	}
+
+	var jobCtx context.Context
+	jobCtx, job.cancel = context.WithCancel(s.ctx)
+	s.jobs[job.progress.ID] = job
+	started := job.progress
+	if s.events != nil {
+		job.published = s.now()
+		s.events.Publish(HubEvent{Type: EventScanProgress, Channel: EventChannelScan, Data: started})
+	}
+
+	s.wg.Add(1)
+	go s.run(jobCtx, job)
+	return &started, nil
+}
+
+// run waits for a free slot, scans and records the outcome.
+func (s *ScannerService) run(ctx context.Context, job *scanJob) {
+	defer s.wg.Done()
+	defer job.cancel()
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		s.finish(job, ctx.Err())
+		return
+	}
+	defer func() { <-s.slots }()
+
+	s.update(job, func(p *ScanJobProgress) { p.Status = ScanJobRunning })
+	if _, err := s.db.ExecContext(context.Background(),
+		`UPDATE scan_history SET status = ? WHERE id = ?`, ScanJobRunning, job.progress.ID); err != nil {
+		s.logger.Warn("Failed to record scan job start", zap.Int64("scan_job_id", job.progress.ID), zap.Error(err))
+	}
+	s.logger.Info("Scan started",
+		zap.Int64("scan_job_id", job.progress.ID),
+		zap.String("storage_root", job.root.Name),
+		zap.String("protocol", job.root.Protocol))
+
+	s.finish(job, s.scan(ctx, job))
+}
+
+// update changes a job's progress under the lock and publishes it,
+// throttled to scanProgressInterval unless the status changed.
+func (s *ScannerService) update(job *scanJob, change func(p *ScanJobProgress)) {
+	s.mu.Lock()
+	status := job.progress.Status
+	change(&job.progress)
+	job.estimate(s.now())
+	events := s.events
+	publish := events != nil && (job.progress.Status != status || s.now().Sub(job.published) >= scanProgressInterval)
+	if publish {
+		job.published = s.now()
+	}
+	progress := job.progress
+	s.mu.Unlock()
+
+	if publish {
+		events.Publish(HubEvent{Type: EventScanProgress, Channel: EventChannelScan, Data: progress})
+	}
+}
+
+// beginPhase starts a phase of a running job, expecting to get through
+// expected files.
+func (s *ScannerService) beginPhase(job *scanJob, phase string, expected int64) {
+	s.update(job, func(p *ScanJobProgress) {
+		p.Phase = phase
+		p.FilesExpected = expected
+		job.phaseStarted = s.now()
+	})
+}
+
+// estimate sets the rate and completion estimate of a running job's
+// current phase.
+func (j *scanJob) estimate(now time.Time) {
+	p := &j.progress
+	p.FilesPerSecond, p.ETA = 0, nil
+	if p.Status != ScanJobRunning || j.phaseStarted.IsZero() {
+		return
+	}
+	done := p.FilesProcessed
+	if p.Phase == ScanPhaseHashing {
+		done = p.FilesHashed
+	}
+	elapsed := now.Sub(j.phaseStarted).Seconds()
+	if done == 0 || elapsed <= 0 {
+		return
+	}
+	rate := float64(done) / elapsed
+	p.FilesPerSecond = math.Round(rate*100) / 100
+	if remaining := p.FilesExpected - done; remaining > 0 {
+		eta := now.Add(time.Duration(float64(remaining) / rate * float64(time.Second)))
+		p.ETA = &eta
+	}
+}
+
+func (s *ScannerService) finish(job *scanJob, scanErr error) {
+	finished := s.now()
+	s.update(job, func(p *ScanJobProgress) {
+		p.FinishedAt = &finished
+		p.CurrentPath = ""
+		p.Phase = ""
+		switch {
+		case scanErr == nil:
+			p.Status = ScanJobCompleted
+		case errors.Is(scanErr, context.Canceled):
+			p.Status = ScanJobCancelled
+		default:
+			p.Status = ScanJobFailed
+			p.Error = scanErr.Error()
+		}
+	})
+
+	s.mu.Lock()
+	p := job.progress
+	delete(s.jobs, p.ID)
+	s.mu.Unlock()
+
+	ctx := context.Background()
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE scan_history SET status = ?, end_time = ?, files_processed = ?, files_added = ?, files_updated = ?,
+		        files_deleted = ?, files_renamed = ?, skipped_symlinks = ?, skipped_cycles = ?, skipped_depth = ?,
+		        skipped_mounts = ?, error_count = ?, error_message = ?
+		 WHERE id = ?`,
+		p.Status, finished, p.FilesProcessed, p.FilesAdded, p.FilesUpdated, p.FilesDeleted, p.FilesRenamed,
+		p.SkippedSymlinks, p.SkippedCycles, p.SkippedDepth, p.SkippedMounts, p.ErrorCount, p.Error, p.ID); err != nil {
+		s.logger.Warn("Failed to record scan job result", zap.Int64("scan_job_id", p.ID), zap.Error(err))
+	}
+	if p.Status == ScanJobCompleted {
+		if _, err := s.db.ExecContext(ctx, `UPDATE storage_roots SET last_scan_at = ? WHERE id = ?`,
+			finished, p.StorageRootID); err != nil {
+			s.logger.Warn("Failed to record storage root scan time", zap.String("storage_root", p.StorageRoot), zap.Error(err))
+		}
+	}
+
+	s.logger.Info("Scan finished",
+		zap.Int64("scan_job_id", p.ID),
+		zap.String("storage_root", p.StorageRoot),
+		zap.String("status", p.Status),
+		zap.Int64("files_processed", p.FilesProcessed),
+		zap.Int64("files_added", p.FilesAdded),
+		zap.Int64("files_updated", p.FilesUpdated),
+		zap.Int64("files_deleted", p.FilesDeleted),
+		zap.Int64("files_renamed", p.FilesRenamed),
+		zap.Int64("skipped_symlinks", p.SkippedSymlinks),
+		zap.Int64("skipped_cycles", p.SkippedCycles),
+		zap.Int64("skipped_depth", p.SkippedDepth),
+		zap.Int64("skipped_mounts", p.SkippedMounts),
+		zap.Int64("rows_written", p.RowsWritten),
+		zap.Float64("rows_per_second", p.RowsPerSecond),
+		zap.Duration("duration", finished.Sub(p.StartedAt)))
+}
+
+// catalogEntry is a file already in the catalog for the root being scanned.
+type catalogEntry struct {
+	id       int64
+	size     int64
+	modified time.Time
+	isDir    bool
+	deleted  bool
+	// detected is the media type sniffed from its content, if known
+	detected string
+}
+
+// scannedEntry is a file found on storage with no catalog record.
+type scannedEntry struct {
+	path string
+	info *filesystem.FileInfo
+}
+
+// scan walks a root and reconciles the catalog with what it found.
+// Catalog records are only marked deleted when the directory that held
+// them was listed successfully, so an unreachable directory or the
+// depth limit never looks like a mass deletion. Catalog writes go
+// through a catalogWriter, which has committed them all before hashing
+// starts. A cancelled walk changes nothing beyond the batches already
+// committed.
+func (s *ScannerService) scan(ctx context.Context, job *scanJob) error {
+	// Walking and hashing give way to browsing, streaming and transfers
+	ctx = WithIOPriority(ctx, IOPriorityBackground)
+	provider, err := s.providers.ProviderFor(ctx, job.root)
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+
+	w := newCatalogWriter(ctx, s.db, s.logger, s.config.WriteBatchSize, func(rows int, elapsed time.Duration) {
+		metrics.RecordScanWriteBatch(job.root.Name, rows, elapsed)
+		s.update(job, func(p *ScanJobProgress) {
+			p.RowsWritten += int64(rows)
+			job.writeTime += elapsed
+			if seconds := job.writeTime.Seconds(); seconds > 0 {
+				p.RowsPerSecond = math.Round(float64(p.RowsWritten)/seconds*100) / 100
+			}
+		})
+	})
+	err = s.reconcile(ctx, job, provider, w)
+	w.close()
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.hashContent(ctx, job, provider)
+}
+
+// reconcile lists a root and queues the catalog writes that bring the
+// catalog in step with it.
+func (s *ScannerService) reconcile(ctx context.Context, job *scanJob, provider StorageProvider, w *catalogWriter) error {
+	known, err := s.loadCatalog(ctx, job.root.ID)
+	if err != nil {
+		return err
+	}
+	var expected int64
+	for _, entry := range known {
+		if !entry.deleted {
+			expected++
+		}
+	}
+	s.beginPhase(job, ScanPhaseListing, expected)
+
+	seen := make(map[string]bool)
+	listed := make(map[string]bool)
+	var added []scannedEntry
+
+	traversal := newScanTraversal(ctx, provider, job.traversal)
+	maxDepth := job.root.MaxDepth
+	if job.traversal.MaxDepth > 0 {
+		maxDepth = job.traversal.MaxDepth
+	}
+
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		if ctx.Err() != nil {
+			return
+		}
+		s.update(job, func(p *ScanJobProgress) { p.CurrentPath = dir })
+
+		if err := s.io.acquire(ctx, job.progress.ID); err != nil {
+			return
+		}
+		entries, err := provider.List(ctx, dir)
+		s.io.release()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Warn("Failed to list directory during scan",
+					zap.String("storage_root", job.root.Name), zap.String("path", dir), zap.Error(err))
+				s.update(job, func(p *ScanJobProgress) { p.ErrorCount++ })
+			}
+			return
+		}
+		listed[dir] = true
+
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			// What users deleted stays out of the catalog until restored,
+			// whether through Catalogizer or the share's own recycle bin
+			if dir == "" && e.Name == TrashDirName {
+				continue
+			}
+			if _, ok := shareTrashConvention(e.Name); dir == "" && ok && e.IsDir {
+				continue
+			}
+			rel := path.Join(dir, e.Name)
+			followed := e.Mode&os.ModeSymlink != 0
+			if followed {
+				target, ok := traversal.follow(ctx, rel, e)
+				if !ok {
+					s.update(job, func(p *ScanJobProgress) { p.SkippedSymlinks++ })
+					continue
+				}
+				e = target
+			}
+			seen[rel] = true
+			s.update(job, func(p *ScanJobProgress) { p.FilesProcessed++ })
+
+			if entry, ok := known[rel]; ok {
+				s.refresh(w, job, rel, entry, e)
+			} else {
+				added = append(added, scannedEntry{path: rel, info: e})
+			}
+
+			if !e.IsDir {
+				continue
+			}
+			if depth+1 > maxDepth {
+				s.update(job, func(p *ScanJobProgress) { p.SkippedDepth++ })
+				continue
+			}
+			leave, skip := traversal.enter(ctx, rel, followed)
+			switch skip {
+			case traversalSkipCycle:
+				s.update(job, func(p *ScanJobProgress) { p.SkippedCycles++ })
+			case traversalSkipMount:
+				s.update(job, func(p *ScanJobProgress) { p.SkippedMounts++ })
+			default:
+				walk(rel, depth+1)
+				leave()
+			}
+		}
+	}
+	walk("", 0)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Files that were in a listed directory, or under a directory that
+	// itself disappeared, and were not found are gone or have moved
+	var covered func(p string) bool
+	covered = func(p string) bool {
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		if listed[parent] {
+			return true
+		}
+		if entry, ok := known[parent]; ok && !entry.deleted && !seen[parent] {
+			return covered(parent)
+		}
+		return false
+	}
+	missing := make(map[string]*catalogEntry)
+	for p, entry := range known {
+		if !entry.deleted && !seen[p] && covered(p) {
+			missing[p] = entry
+		}
+	}
+
+	if err := s.applyAdditions(ctx, w, job, known, added, missing); err != nil {
+		return err
+	}
+
+	deletedAt := s.now()
+	for p, entry := range missing {
+		id, size, isDir := entry.id, entry.size, entry.isDir
+		var written int64
+		w.write(catalogWrite{
+			exec: func(ctx context.Context, b *catalogBatch) error {
+				written = 0
+				if err := b.exec(ctx, `UPDATE files SET deleted = ?, deleted_at = ? WHERE id = ?`, true, deletedAt, id); err != nil {
+					return err
+				}
+				written = id
+				return nil
+			},
+			done:   func() { s.update(job, func(p *ScanJobProgress) { p.FilesDeleted++ }) },
+			failed: s.writeFailed(job, "Failed to mark file deleted", p),
+		})
+		s.recordChange(w, job, &written, catalogChange{changeType: CatalogChangeRemoved, path: p,
+			isDir: isDir, oldSize: &size, at: deletedAt})
+	}
+	return nil
+}
+
+// writeFailed returns the failure handler of a catalog write, which logs
+// and counts the error.
+func (s *ScannerService) writeFailed(job *scanJob, message, rel string) func(err error) {
+	return func(err error) {
+		s.logger.Warn(message, zap.String("path", rel), zap.Error(err))
+		s.update(job, func(p *ScanJobProgress) { p.ErrorCount++ })
+	}
+}
+
+// hashContent gives every file of the root without one a quick hash, and
+// detects its media type from the bytes the hash reads first: the file
+// is classified by content when its extension is missing or wrong, and
+// flagged when the two disagree. It then confirms files whose size and
+// quick hash match another cataloged file with a full SHA-256. Small files go first, newest first, and reads are
+// paced by the root's hash rate limit. A full hash saves its progress
+// through a large file so an interrupted one resumes. A file that cannot
+// be read is logged and retried on the next scan. Duplicates on another
+// root are confirmed when that root is scanned.
+func (s *ScannerService) hashContent(ctx context.Context, job *scanJob, provider StorageProvider) error {
+	provider = &throttledProvider{StorageProvider: provider, limiter: job.hashLimiter}
+	query := func(q string) ([]unhashedFile, error) {
+		rows, err := s.db.QueryContext(ctx, q, job.root.ID, hashPrioritySize)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var files []unhashedFile
+		for rows.Next() {
+			var f unhashedFile
+			if err := rows.Scan(&f.id, &f.path, &f.size); err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+		return files, rows.Err()
+	}
+
+	pending, err := query(`SELECT id, path, size FROM files
+		WHERE storage_root_id = ? AND deleted = 0 AND is_directory = 0 AND size > 0
+		  AND (quick_hash IS NULL OR detected_mime_type IS NULL)
+		ORDER BY CASE WHEN size <= ? THEN 0 ELSE 1 END, modified_at DESC, size`)
+	if err != nil {
+		return fmt.Errorf("failed to list files to hash: %w", err)
+	}
+	s.beginPhase(job, ScanPhaseHashing, int64(len(pending)))
+	s.hashFiles(ctx, job, pending, "Failed to hash file", func(f unhashedFile) error {
+		hash, head, err := quickHashWithHead(ctx, provider, f.path, f.size)
+		if err != nil {
+			return err
+		}
+		detected := DetectMediaType(head)
+		ext := strings.TrimPrefix(path.Ext(f.path), ".")
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE files SET quick_hash = ?, detected_mime_type = ?, type_mismatch = ?, file_type = ? WHERE id = ?`,
+			hash, detected, mediaTypeMismatch(ext, detected), contentFileType(ext, detected), f.id); err != nil {
+			return err
+		}
+		if job.detector != nil && job.rewritten[f.id] {
+			return s.observeRewrite(ctx, job, provider, f)
+		}
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	candidates, err := query(`SELECT f.id, f.path, f.size FROM files f
+		WHERE f.storage_root_id = ? AND f.deleted = 0 AND f.quick_hash IS NOT NULL AND f.sha256 IS NULL
+		  AND EXISTS (SELECT 1 FROM files d WHERE d.quick_hash = f.quick_hash AND d.size = f.size
+		                                      AND d.id <> f.id AND d.deleted = 0)
+		ORDER BY CASE WHEN f.size <= ? THEN 0 ELSE 1 END, f.modified_at DESC, f.size`)
+	if err != nil {
+		return fmt.Errorf("failed to list duplicate candidates: %w", err)
+	}
+	s.update(job, func(p *ScanJobProgress) { p.FilesExpected += int64(len(candidates)) })
+	s.hashFiles(ctx, job, candidates, "Failed to hash file content", func(f unhashedFile) error {
+		from, err := s.loadHashCheckpoint(ctx, f.id)
+		if err != nil {
+			return fmt.Errorf("failed to load hash checkpoint: %w", err)
+		}
+		hash, err := resumableContentHash(ctx, provider, f.path, from, func(cp hashCheckpoint) error {
+			return s.saveHashCheckpoint(ctx, f.id, cp)
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE files SET sha256 = ? WHERE id = ?`, hash, f.id); err != nil {
+			return err
+		}
+		_, err = s.db.ExecContext(ctx, `DELETE FROM hash_checkpoints WHERE file_id = ?`, f.id)
+		return err
+	})
+	return ctx.Err()
+}
+
+// observeRewrite passes the start of a file the scan found rewritten to
+// the ransomware detector.
+func (s *ScannerService) observeRewrite(ctx context.Context, job *scanJob, provider StorageProvider, f unhashedFile) error {
+	rc, err := provider.Open(ctx, f.path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	sample, err := io.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: rc}, int64(job.detector.SampleSize())))
+	if err != nil {
+		return err
+	}
+	job.detector.ObserveWrite(ctx, job.root.Name, f.path, sample)
+	return nil
+}
+
+// unhashedFile is a cataloged file waiting for a hash.
+type unhashedFile struct {
+	id   int64
+	path string
+	size int64
+}
+
+// hashFiles runs hash over files on up to MaxIOWorkers workers, each
+// file taking a slot of the shared I/O budget. A rate limited root is
+// hashed on one worker: more would only hold slots other roots could
+// use. Failures are logged and counted.
+func (s *ScannerService) hashFiles(ctx context.Context, job *scanJob, files []unhashedFile, failure string,
+	hash func(f unhashedFile) error) {
+	workers := s.config.MaxIOWorkers
+	if job.hashRateLimited() {
+		workers = 1
+	}
+	work := make(chan unhashedFile)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range work {
+				if err := s.io.acquire(ctx, job.progress.ID); err != nil {
+					continue
+				}
+				s.update(job, func(p *ScanJobProgress) { p.CurrentPath = f.path })
+				err := hash(f)
+				s.io.release()
+				if err != nil && ctx.Err() == nil {
+					s.logger.Warn(failure, zap.String("path", f.path), zap.Error(err))
+					s.update(job, func(p *ScanJobProgress) { p.ErrorCount++ })
+				}
+				s.update(job, func(p *ScanJobProgress) { p.FilesHashed++ })
+			}
+		}()
+	}
+
+feed:
+	for _, f := range files {
+		select {
+		case work <- f:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// loadCatalog returns every record of a root by path, deleted ones too so
+// files that come back are revived rather than duplicated.
+func (s *ScannerService) loadCatalog(ctx context.Context, storageRootID int64) (map[string]*catalogEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, path, size, modified_at, is_directory, deleted, detected_mime_type FROM files WHERE storage_root_id = ?`,
+		storageRootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalog: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[string]*catalogEntry)
+	for rows.Next() {
+		var entry catalogEntry
+		var p string
+		var isDir, deleted sql.NullBool
+		var detected sql.NullString
+		if err := rows.Scan(&entry.id, &p, &entry.size, &entry.modified, &isDir, &deleted, &detected); err != nil {
+			return nil, fmt.Errorf("failed to scan catalog entry: %w", err)
+		}
+		entry.isDir, entry.deleted, entry.detected = isDir.Bool, deleted.Bool, detected.String
+		known[strings.TrimPrefix(p, "/")] = &entry
+	}
+	return known, rows.Err()
+}
+
+// refresh queues the update of a catalogued file whose size, time or type
+// changed and the revival of one that had been marked deleted. A changed
+// file loses its hashes and any hash checkpoint so the next hashing pass
+// recomputes them, and a file rewritten in place is sampled for the
+// ransomware detector while it is hashed.
+func (s *ScannerService) refresh(w *catalogWriter, job *scanJob, rel string, entry *catalogEntry, info *filesystem.FileInfo) {
+	changed := entry.size != info.Size || entry.isDir != info.IsDir || entry.modified.Unix() != info.ModTime.Unix()
+	if !changed && !entry.deleted {
+		return
+	}
+	now := s.now()
+	modified := info.ModTime
+	if modified.IsZero() {
+		modified = now
+	}
+	id, oldSize, size, isDir := entry.id, entry.size, info.Size, info.IsDir
+	revived := entry.deleted
+	entry.deleted = false
+	if changed && !revived && !isDir && size > 0 {
+		job.rewritten[id] = true
+	}
+
+	var written int64
+	w.write(catalogWrite{
+		exec: func(ctx context.Context, b *catalogBatch) error {
+			written = 0
+			if err := b.exec(ctx,
+				`UPDATE files SET size = ?, modified_at = ?, is_directory = ?, deleted = ?, deleted_at = NULL, last_scan_at = ?,
+				        quick_hash = CASE WHEN ? THEN NULL ELSE quick_hash END,
+				        sha256 = CASE WHEN ? THEN NULL ELSE sha256 END
+				 WHERE id = ?`,
+				size, modified, isDir, false, now, changed, changed, id); err != nil {
+				return err
+			}
+			if changed {
+				if err := b.exec(ctx, `DELETE FROM hash_checkpoints WHERE file_id = ?`, id); err != nil {
+					return err
+				}
+			}
+			written = id
+			return nil
+		},
+		done: func() {
+			s.update(job, func(p *ScanJobProgress) {
+				if revived {
+					p.FilesAdded++
+				} else {
+					p.FilesUpdated++
+				}
+			})
+		},
+		failed: s.writeFailed(job, "Failed to update file during scan", rel),
+	})
+
+	change := catalogChange{changeType: CatalogChangeModified, path: rel, isDir: isDir,
+		oldSize: &oldSize, newSize: &size, at: now}
+	if revived {
+		change.changeType, change.oldSize = CatalogChangeAdded, nil
+	}
+	s.recordChange(w, job, &written, change)
+}
+
+// catalogChange is one entry of the catalog_changes journal.
+type catalogChange struct {
+	changeType string
+	path       string
+	oldPath    string
+	isDir      bool
+	oldSize    *int64
+	newSize    *int64
+	at         time.Time
+}
+
+// recordChange queues an entry of the catalog_changes journal read by
+// CatalogDiffService for the file whose ID *fileID holds once the write
+// queued before it has run. Nothing is recorded when that write failed
+// and left it 0. A failure is only logged: the journal must never fail a
+// scan.
+func (s *ScannerService) recordChange(w *catalogWriter, job *scanJob, fileID *int64, change catalogChange) {
+	var oldPath *string
+	if change.oldPath != "" {
+		oldPath = &change.oldPath
+	}
+	w.write(catalogWrite{
+		exec: func(ctx context.Context, b *catalogBatch) error {
+			if *fileID == 0 {
+				return nil
+			}
+			return b.exec(ctx,
+				`INSERT INTO catalog_changes (scan_id, storage_root_id, file_id, change_type, path, old_path, is_directory,
+				                              old_size, new_size, changed_at)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				job.progress.ID, job.root.ID, *fileID, change.changeType, change.path, oldPath, change.isDir,
+				change.oldSize, change.newSize, change.at)
+		},
+		failed: func(err error) {
+			s.logger.Warn("Failed to record catalog change", zap.String("path", change.path), zap.Error(err))
+		},
+	})
+}
+
+// renameKey identifies a file by content signature for move detection.
+type renameKey struct {
+	size     int64
+	modified int64
+}
+
+// applyAdditions queues the records of new files. A new file with the
+// same size and modification time as a missing one is taken to be that
+// file renamed or moved, and its record is updated so metadata, history
+// and share links follow it, and the ransomware detector is told of the
+// move. Matched files are removed from missing; if
+// updating the record fails, the move is found again by the next scan.
+func (s *ScannerService) applyAdditions(ctx context.Context, w *catalogWriter, job *scanJob, known map[string]*catalogEntry,
+	added []scannedEntry, missing map[string]*catalogEntry) error {
+	candidates := make(map[renameKey][]string)
+	for p, entry := range missing {
+		if !entry.isDir && entry.size > 0 {
+			key := renameKey{entry.size, entry.modified.Unix()}
+			candidates[key] = append(candidates[key], p)
+		}
+	}
+	for _, paths := range candidates {
+		sort.Strings(paths)
+	}
+
+	// ids is only used by the writes, in the order they run
+	ids := make(map[string]int64, len(known))
+	for p, entry := range known {
+		ids[p] = entry.id
+	}
+
+	// Parents sort before their children, so their IDs are known in time
+	sort.Slice(added, func(i, j int) bool { return added[i].path < added[j].path })
+	now := s.now()
+	for _, a := range added {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		parent := path.Dir(a.path)
+		ext := strings.TrimPrefix(path.Ext(a.info.Name), ".")
+		modified := a.info.ModTime
+		if modified.IsZero() {
+			modified = now
+		}
+		parentID := func() *int64 {
+			if id, ok := ids[parent]; ok {
+				return &id
+			}
+			return nil
+		}
+
+		var written int64
+		if old := takeRenameCandidate(candidates, a, missing); old != "" {
+			entry := missing[old]
+			delete(missing, old)
+			id, oldSize, detected := entry.id, entry.size, entry.detected
+			w.write(catalogWrite{
+				exec: func(ctx context.Context, b *catalogBatch) error {
+					written = 0
+					// A new name can fix or break the match with the content
+					if err := b.exec(ctx,
+						`UPDATE files SET path = ?, name = ?, extension = ?, mime_type = ?, file_type = ?, type_mismatch = ?,
+						        parent_id = ?, deleted = ?, deleted_at = NULL, last_scan_at = ?
+						 WHERE id = ?`,
+						a.path, a.info.Name, ext, mime.TypeByExtension("."+ext), contentFileType(ext, detected),
+						mediaTypeMismatch(ext, detected), parentID(), false, now, id); err != nil {
+						return err
+					}
+					ids[a.path] = id
+					written = id
+					return nil
+				},
+				done: func() {
+					s.logger.Debug("Detected moved file", zap.String("from", old), zap.String("to", a.path))
+					if job.detector != nil {
+						job.detector.ObserveRename(ctx, job.root.Name, old, a.path)
+					}
+					s.update(job, func(p *ScanJobProgress) { p.FilesRenamed++ })
+				},
+				failed: func(err error) {
+					s.logger.Warn("Failed to record moved file", zap.String("from", old), zap.String("to", a.path), zap.Error(err))
+					s.update(job, func(p *ScanJobProgress) { p.ErrorCount++ })
+				},
+			})
+			s.recordChange(w, job, &written, catalogChange{changeType: CatalogChangeMoved, path: a.path,
+				oldPath: old, oldSize: &oldSize, newSize: &a.info.Size, at: now})
+			continue
+		}
+
+		w.write(catalogWrite{
+			exec: func(ctx context.Context, b *catalogBatch) error {
+				// A rolled back batch is replayed, so forget its IDs first
+				delete(ids, a.path)
+				id, err := b.insert(ctx,
+					`INSERT INTO files (storage_root_id, path, name, extension, mime_type, file_type, size, is_directory,
+					                    modified_at, last_scan_at, parent_id)
+					 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					job.root.ID, a.path, a.info.Name, ext, mime.TypeByExtension("."+ext), classifyFileType(ext), a.info.Size,
+					a.info.IsDir, modified, now, parentID())
+				written = id
+				if err != nil {
+					return err
+				}
+				ids[a.path] = id
+				return nil
+			},
+			done: func() {
+				s.update(job, func(p *ScanJobProgress) { p.FilesAdded++ })
+				if !a.info.IsDir {
+					s.publishMediaAdded(job, written, a, ext)
+				}
+			},
+			failed: s.writeFailed(job, "Failed to add file", a.path),
+		})
+		s.recordChange(w, job, &written, catalogChange{changeType: CatalogChangeAdded, path: a.path,
+			isDir: a.info.IsDir, newSize: &a.info.Size, at: now})
+	}
+	return nil
+}
+
+// publishMediaAdded notifies real-time clients of a newly cataloged file.
+func (s *ScannerService) publishMediaAdded(job *scanJob, id int64, a scannedEntry, ext string) {
+	s.mu.Lock()
+	events := s.events
+	s.mu.Unlock()
+	if events == nil {
+		return
+	}
+	events.Publish(HubEvent{
+		Type:    EventMediaAdded,
+		Channel: EventChannelMedia,
+		Data: map[string]interface{}{
+			"file_id":         id,
+			"storage_root_id": job.root.ID,
+			"storage_root":    job.root.Name,
+			"path":            a.path,
+			"name":            a.info.Name,
+			"file_type":       classifyFileType(ext),
+			"size":            a.info.Size,
+		},
+	})
+}
+
+// takeRenameCandidate picks the missing file a new one was moved from,
+// preferring one with the same name, and removes it from the candidates.
+func takeRenameCandidate(candidates map[renameKey][]string, a scannedEntry, missing map[string]*catalogEntry) string {
+	if a.info.IsDir || a.info.Size <= 0 {
+		return ""
+	}
+	key := renameKey{a.info.Size, a.info.ModTime.Unix()}
+	paths := candidates[key]
+	if len(paths) == 0 {
+		return ""
+	}
+	pick := 0
+	for i, p := range paths {
+		if path.Base(p) == a.info.Name {
+			pick = i
+			break
+		}
+	}
+	old := paths[pick]
+	candidates[key] = append(paths[:pick], paths[pick+1:]...)
+	if _, ok := missing[old]; !ok {
+		return ""
+	}
+	return old
+}
+
+// GetJob returns a scan job, live if it is still queued or running.
+func (s *ScannerService) GetJob(ctx context.Context, id int64) (*ScanJobProgress, error) {
+	s.mu.Lock()
+	if job, ok := s.jobs[id]; ok {
+		p := job.progress
+		s.mu.Unlock()
+		return &p, nil
+	}
+	s.mu.Unlock()
+
+	jobs, err := s.queryJobs(ctx, `WHERE sh.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("scan job %d not found", id)
+	}
+	return &jobs[0], nil
+}
+
+// ListJobs returns the most recent scan jobs, newest first.
+func (s *ScannerService) ListJobs(ctx context.Context, limit int) ([]ScanJobProgress, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	jobs, err := s.queryJobs(ctx, `ORDER BY sh.start_time DESC, sh.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range jobs {
+		if job, ok := s.jobs[jobs[i].ID]; ok {
+			jobs[i] = job.progress
+		}
+	}
+	return jobs, nil
+}
+
+func (s *ScannerService) queryJobs(ctx context.Context, clause string, args ...interface{}) ([]ScanJobProgress, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT sh.id, sh.storage_root_id, COALESCE(sr.name, ''), COALESCE(sh.triggered_by, ''), sh.status,
+		        COALESCE(sh.files_processed, 0), COALESCE(sh.files_added, 0), COALESCE(sh.files_updated, 0),
+		        COALESCE(sh.files_deleted, 0), COALESCE(sh.files_renamed, 0), COALESCE(sh.skipped_symlinks, 0),
+		        COALESCE(sh.skipped_cycles, 0), COALESCE(sh.skipped_depth, 0), COALESCE(sh.skipped_mounts, 0),
+		        COALESCE(sh.error_count, 0), COALESCE(sh.error_message, ''), sh.start_time, sh.end_time
+		 FROM scan_history sh LEFT JOIN storage_roots sr ON sr.id = sh.storage_root_id `+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scan jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ScanJobProgress
+	for rows.Next() {
+		var p ScanJobProgress
+		var finished sql.NullTime
+		if err := rows.Scan(&p.ID, &p.StorageRootID, &p.StorageRoot, &p.Trigger, &p.Status,
+			&p.FilesProcessed, &p.FilesAdded, &p.FilesUpdated, &p.FilesDeleted, &p.FilesRenamed,
+			&p.SkippedSymlinks, &p.SkippedCycles, &p.SkippedDepth, &p.SkippedMounts, &p.ErrorCount,
+			&p.Error, &p.StartedAt, &finished); err != nil {
+			return nil, fmt.Errorf("failed to scan scan job: %w", err)
+		}
+		if finished.Valid {
+			p.FinishedAt = &finished.Time
+		}
+		jobs = append(jobs, p)
+	}
+	return jobs, rows.Err()
+}
+
+// CancelJob stops a queued or running scan job.
+func (s *ScannerService) CancelJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	s.mu.Unlock()
+	if ok {
+		job.cancel()
+		return nil
+	}
+
+	if _, err := s.GetJob(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("scan job %d is not running", id)
+}
+
+// SetSchedule creates or replaces the scan schedule of a storage root.
+// timeZone is the IANA zone the cron fields are read in; empty means the
+// server's.
+func (s *ScannerService) SetSchedule(ctx context.Context, storageRootID int64, cron, timeZone string, enabled bool) (*ScanSchedule, error) {
+	schedule, err := parseCronSchedule(cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	timeZone = strings.TrimSpace(timeZone)
+	now := s.now()
+	t, err := schedule.NextIn(now, timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	if _, err := s.loadScanRoot(ctx, storageRootID); err != nil {
+		return nil, err
+	}
+
+	var next *time.Time
+	if enabled && !t.IsZero() {
+		next = &t
+	}
+
+	var id int64
+	err = s.db.QueryRowContext(ctx, `SELECT id FROM scan_schedules WHERE storage_root_id = ?`, storageRootID).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = s.db.InsertReturningID(ctx,
+			`INSERT INTO scan_schedules (storage_root_id, cron, time_zone, enabled, next_run_at, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			storageRootID, strings.TrimSpace(cron), timeZone, enabled, next, now, now)
+	case err == nil:
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE scan_schedules SET cron = ?, time_zone = ?, enabled = ?, next_run_at = ?, updated_at = ? WHERE id = ?`,
+			strings.TrimSpace(cron), timeZone, enabled, next, now, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save scan schedule: %w", err)
+	}
+	return s.GetSchedule(ctx, storageRootID)
+}
+
+const scanScheduleColumns = `ss.id, ss.storage_root_id, sr.name, ss.cron, ss.time_zone, ss.enabled, ss.last_run_at, ss.next_run_at, ss.created_at`
+
+func scanScanSchedule(row shareLinkScanner) (*ScanSchedule, error) {
+	var schedule ScanSchedule
+	var lastRun, nextRun sql.NullTime
+	if err := row.Scan(&schedule.ID, &schedule.StorageRootID, &schedule.StorageRoot, &schedule.Cron,
+		&schedule.TimeZone, &schedule.Enabled, &lastRun, &nextRun, &schedule.CreatedAt); err != nil {
+		return nil, err
+	}
+	if lastRun.Valid {
+		schedule.LastRunAt = &lastRun.Time
+	}
+	if nextRun.Valid {
+		schedule.NextRunAt = &nextRun.Time
+	}
+	return &schedule, nil
+}
+
+// GetSchedule returns the scan schedule of a storage root.
+func (s *ScannerService) GetSchedule(ctx context.Context, storageRootID int64) (*ScanSchedule, error) {
+	schedule, err := scanScanSchedule(s.db.QueryRowContext(ctx,
+		`SELECT `+scanScheduleColumns+` FROM scan_schedules ss JOIN storage_roots sr ON sr.id = ss.storage_root_id
+		 WHERE ss.storage_root_id = ?`, storageRootID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("scan schedule for storage root %d not found", storageRootID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scan schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListSchedules returns every scan schedule.
+func (s *ScannerService) ListSchedules(ctx context.Context) ([]ScanSchedule, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+scanScheduleColumns+` FROM scan_schedules ss JOIN storage_roots sr ON sr.id = ss.storage_root_id
+		 ORDER BY sr.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scan schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []ScanSchedule
+	for rows.Next() {
+		schedule, err := scanScanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scan schedule: %w", err)
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// DeleteSchedule removes the scan schedule of a storage root.
+func (s *ScannerService) DeleteSchedule(ctx context.Context, storageRootID int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM scan_schedules WHERE storage_root_id = ?`, storageRootID)
+	if err != nil {
+		return fmt.Errorf("failed to delete scan schedule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("scan schedule for storage root %d not found", storageRootID)
+	}
+	return nil
+}
+
+// RunDueSchedules starts the scans whose schedule is due. A root that is
+// still being scanned skips the run and waits for its next slot.
+func (s *ScannerService) RunDueSchedules(ctx context.Context) {
+	now := s.now()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT storage_root_id, cron, time_zone FROM scan_schedules WHERE enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?`,
+		true, now)
+	if err != nil {
+		s.logger.Error("Failed to load due scan schedules", zap.Error(err))
+		return
+	}
+	type due struct {
+		rootID   int64
+		cron     string
+		timeZone string
+	}
+	var schedules []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.rootID, &d.cron, &d.timeZone); err != nil {
+			s.logger.Error("Failed to scan scan schedule", zap.Error(err))
+			continue
+		}
+		schedules = append(schedules, d)
+	}
+	rows.Close()
+
+	for _, d := range schedules {
+		var next *time.Time
+		if schedule, err := parseCronSchedule(d.cron); err == nil {
+			if t, err := schedule.NextIn(now, d.timeZone); err == nil && !t.IsZero() {
+				next = &t
+			}
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE scan_schedules SET last_run_at = ?, next_run_at = ? WHERE storage_root_id = ?`,
+			now, next, d.rootID); err != nil {
+			s.logger.Error("Failed to advance scan schedule", zap.Int64("storage_root_id", d.rootID), zap.Error(err))
+			continue
+		}
+		if _, err := s.StartScan(ctx, d.rootID, ScanTriggerSchedule); err != nil {
+			s.logger.Warn("Skipped scheduled scan", zap.Int64("storage_root_id", d.rootID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,659 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type scannerFixture struct {
+	db     *database.DB
+	svc    *ScannerService
+	dir    string
+	rootID int64
+}
+
+func newScannerFixture(t *testing.T) *scannerFixture {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT,
+			enabled BOOLEAN DEFAULT 1,
+			max_depth INTEGER DEFAULT 10,
+			last_scan_at DATETIME
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			extension TEXT,
+			mime_type TEXT,
+			file_type TEXT,
+			size INTEGER NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			modified_at DATETIME NOT NULL,
+			deleted BOOLEAN DEFAULT 0,
+			deleted_at DATETIME,
+			last_scan_at DATETIME,
+			parent_id INTEGER,
+			quick_hash TEXT,
+			sha256 TEXT,
+			detected_mime_type TEXT,
+			type_mismatch BOOLEAN NOT NULL DEFAULT 0,
+			UNIQUE(storage_root_id, path)
+		);
+		CREATE TABLE scan_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			scan_type TEXT NOT NULL,
+			status TEXT NOT NULL,
+			start_time DATETIME NOT NULL,
+			end_time DATETIME,
+			files_processed INTEGER DEFAULT 0,
+			files_added INTEGER DEFAULT 0,
+			files_updated INTEGER DEFAULT 0,
+			files_deleted INTEGER DEFAULT 0,
+			error_count INTEGER DEFAULT 0,
+			error_message TEXT,
+			files_renamed INTEGER DEFAULT 0,
+			triggered_by TEXT NOT NULL DEFAULT 'manual',
+			skipped_symlinks INTEGER DEFAULT 0,
+			skipped_cycles INTEGER DEFAULT 0,
+			skipped_depth INTEGER DEFAULT 0,
+			skipped_mounts INTEGER DEFAULT 0
+		);
+		CREATE TABLE scan_schedules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL UNIQUE,
+			cron TEXT NOT NULL,
+			time_zone TEXT NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT 1,
+			last_run_at DATETIME,
+			next_run_at DATETIME,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE hash_checkpoints (
+			file_id INTEGER PRIMARY KEY,
+			bytes_hashed INTEGER NOT NULL,
+			state BLOB NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE hash_rate_limits (
+			storage_root_id INTEGER PRIMARY KEY,
+			bytes_per_second INTEGER NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE scan_traversal_policies (
+			storage_root_id INTEGER PRIMARY KEY,
+			follow_symlinks TEXT NOT NULL,
+			max_depth INTEGER NOT NULL DEFAULT 0,
+			cross_filesystems BOOLEAN NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE catalog_changes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			scan_id INTEGER,
+			storage_root_id INTEGER NOT NULL,
+			file_id INTEGER NOT NULL,
+			change_type TEXT NOT NULL,
+			path TEXT NOT NULL,
+			old_path TEXT,
+			is_directory BOOLEAN NOT NULL DEFAULT 0,
+			old_size INTEGER,
+			new_size INTEGER,
+			changed_at DATETIME NOT NULL
+		);`)
+	require.NoError(t, err)
+
+	f := &scannerFixture{db: database.WrapDB(sqlDB, database.DialectSQLite), dir: t.TempDir()}
+	f.rootID, err = f.db.InsertReturningID(context.Background(),
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('media', 'local', ?)`, f.dir)
+	require.NoError(t, err)
+
+	providers := NewStorageProviderFactory(f.db, localRootClients{}, zap.NewNop())
+	f.svc = NewScannerService(f.db, zap.NewNop(), providers, ScannerConfig{})
+	t.Cleanup(f.svc.Stop)
+	return f
+}
+
+func (f *scannerFixture) write(t *testing.T, name, content string) {
+	t.Helper()
+	full := filepath.Join(f.dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+	require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+}
+
+// scan runs a manual scan of the fixture root to completion.
+func (f *scannerFixture) scan(t *testing.T) *ScanJobProgress {
+	t.Helper()
+	started, err := f.svc.StartScan(context.Background(), f.rootID, ScanTriggerManual)
+	require.NoError(t, err)
+	return waitForScanJob(t, f.svc, started.ID)
+}
+
+func waitForScanJob(t *testing.T, svc *ScannerService, id int64) *ScanJobProgress {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := svc.GetJob(context.Background(), id)
+		require.NoError(t, err)
+		if job.Status != ScanJobQueued && job.Status != ScanJobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("scan job %d did not finish", id)
+	return nil
+}
+
+type scannedFile struct {
+	id       int64
+	parentID sql.NullInt64
+	size     int64
+	deleted  bool
+}
+
+func (f *scannerFixture) file(t *testing.T, path string) scannedFile {
+	t.Helper()
+	var file scannedFile
+	require.NoError(t, f.db.QueryRowContext(context.Background(),
+		`SELECT id, parent_id, size, deleted FROM files WHERE storage_root_id = ? AND path = ?`, f.rootID, path).Scan(
+		&file.id, &file.parentID, &file.size, &file.deleted), path)
+	return file
+}
+
+func TestScannerService_ReconcilesCatalog(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "films/a.mkv", "aaaa")
+	f.write(t, "films/b.mkv", "bb")
+	f.write(t, "notes.txt", "n")
+
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.Equal(t, ScanTriggerManual, job.Trigger)
+	assert.Equal(t, int64(4), job.FilesAdded)
+	assert.NotNil(t, job.FinishedAt)
+
+	films := f.file(t, "films")
+	moved := f.file(t, "films/a.mkv")
+	assert.Equal(t, films.id, moved.parentID.Int64)
+	assert.False(t, f.file(t, "notes.txt").parentID.Valid)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(f.dir, "archive"), 0755))
+	require.NoError(t, os.Rename(filepath.Join(f.dir, "films", "a.mkv"), filepath.Join(f.dir, "archive", "a-2024.mkv")))
+	require.NoError(t, os.Remove(filepath.Join(f.dir, "notes.txt")))
+	f.write(t, "films/b.mkv", "bbbbbb")
+	f.write(t, "new.txt", "xyz")
+
+	job = f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.Equal(t, int64(2), job.FilesAdded)
+	assert.Equal(t, int64(1), job.FilesRenamed)
+	assert.Equal(t, int64(1), job.FilesDeleted)
+	assert.GreaterOrEqual(t, job.FilesUpdated, int64(1))
+
+	// The moved file keeps its record
+	renamed := f.file(t, "archive/a-2024.mkv")
+	assert.Equal(t, moved.id, renamed.id)
+	assert.Equal(t, f.file(t, "archive").id, renamed.parentID.Int64)
+	assert.Equal(t, int64(6), f.file(t, "films/b.mkv").size)
+	assert.True(t, f.file(t, "notes.txt").deleted)
+
+	// A file that comes back is revived rather than duplicated
+	f.write(t, "notes.txt", "n")
+	job = f.scan(t)
+	assert.False(t, f.file(t, "notes.txt").deleted)
+
+	var lastScan sql.NullTime
+	require.NoError(t, f.db.QueryRowContext(context.Background(),
+		`SELECT last_scan_at FROM storage_roots WHERE id = ?`, f.rootID).Scan(&lastScan))
+	assert.True(t, lastScan.Valid)
+
+	jobs, err := f.svc.ListJobs(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	assert.Equal(t, job.ID, jobs[0].ID)
+}
+
+func (f *scannerFixture) hashes(t *testing.T, path string) (quick, sha sql.NullString) {
+	t.Helper()
+	require.NoError(t, f.db.QueryRowContext(context.Background(),
+		`SELECT quick_hash, sha256 FROM files WHERE storage_root_id = ? AND path = ?`, f.rootID, path).Scan(
+		&quick, &sha), path)
+	return quick, sha
+}
+
+func TestScannerService_HashesContent(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "a/movie.mkv", "same content")
+	f.write(t, "b/movie copy.mkv", "same content")
+	f.write(t, "other.mkv", "diff content")
+
+	job := f.scan(t)
+	require.Equal(t, ScanJobCompleted, job.Status)
+
+	quickA, shaA := f.hashes(t, "a/movie.mkv")
+	quickB, shaB := f.hashes(t, "b/movie copy.mkv")
+	quickOther, shaOther := f.hashes(t, "other.mkv")
+	require.True(t, quickA.Valid)
+	assert.Equal(t, quickA, quickB)
+	assert.NotEqual(t, quickA, quickOther)
+
+	// Only files sharing a quick hash are read in full
+	require.True(t, shaA.Valid)
+	assert.Equal(t, shaA, shaB)
+	assert.False(t, shaOther.Valid)
+
+	// A changed file is hashed again
+	f.write(t, "b/movie copy.mkv", "edited content")
+	f.scan(t)
+	quickB, shaB = f.hashes(t, "b/movie copy.mkv")
+	assert.True(t, quickB.Valid)
+	assert.NotEqual(t, quickA, quickB)
+	assert.False(t, shaB.Valid)
+}
+
+func TestScannerService_DetectsMediaTypes(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "films/clip.avi", mkvHeader+"...")
+	f.write(t, "films/poster", pngHeader+"...")
+	f.write(t, "films/real.mkv", mkvHeader+"!!!")
+	f.write(t, "notes.txt", "just some notes")
+	ctx := context.Background()
+
+	job := f.scan(t)
+	require.Equal(t, ScanJobCompleted, job.Status)
+
+	detected := func(path string) (mimeType, fileType string, mismatch bool) {
+		t.Helper()
+		require.NoError(t, f.db.QueryRowContext(ctx,
+			`SELECT detected_mime_type, file_type, type_mismatch FROM files WHERE storage_root_id = ? AND path = ?`,
+			f.rootID, path).Scan(&mimeType, &fileType, &mismatch), path)
+		return mimeType, fileType, mismatch
+	}
+	mimeType, fileType, mismatch := detected("films/clip.avi")
+	assert.Equal(t, "video/x-matroska", mimeType)
+	assert.Equal(t, "video", fileType)
+	assert.True(t, mismatch)
+	// A file without an extension is classified by its content
+	mimeType, fileType, mismatch = detected("films/poster")
+	assert.Equal(t, "image/png", mimeType)
+	assert.Equal(t, "image", fileType)
+	assert.False(t, mismatch)
+	_, _, mismatch = detected("films/real.mkv")
+	assert.False(t, mismatch)
+
+	mismatches, total, err := f.svc.ListTypeMismatches(ctx, f.rootID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, "films/clip.avi", mismatches[0].Path)
+	assert.Equal(t, "avi", mismatches[0].Extension)
+	assert.Equal(t, "mkv", mismatches[0].SuggestedExtension)
+
+	// Renaming the file to its real type clears the flag
+	require.NoError(t, os.Rename(filepath.Join(f.dir, "films", "clip.avi"), filepath.Join(f.dir, "films", "clip.mkv")))
+	job = f.scan(t)
+	require.Equal(t, int64(1), job.FilesRenamed)
+	_, _, mismatch = detected("films/clip.mkv")
+	assert.False(t, mismatch)
+	_, total, err = f.svc.ListTypeMismatches(ctx, 0, 0, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
+
+func TestQuickHash_SamplesLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	provider := NewLocalStorageProvider(connectedLocalClient(t, dir), dir)
+
+	// Sampled at [0, 1), [1.5, 2.5) and [3, 4) MiB
+	size := 4 * quickHashChunkSize
+	content := make([]byte, size)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), content, 0644))
+	first, err := QuickHash(context.Background(), provider, "big.bin", int64(size))
+	require.NoError(t, err)
+
+	// A change between the sampled chunks goes unnoticed, one inside a
+	// chunk does not
+	content[quickHashChunkSize+10] = 1
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), content, 0644))
+	unsampled, err := QuickHash(context.Background(), provider, "big.bin", int64(size))
+	require.NoError(t, err)
+	assert.Equal(t, first, unsampled)
+
+	content[size-1] = 1
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), content, 0644))
+	sampled, err := QuickHash(context.Background(), provider, "big.bin", int64(size))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, sampled)
+
+	full, err := ContentHash(context.Background(), provider, "big.bin")
+	require.NoError(t, err)
+	assert.Len(t, full, 64)
+}
+
+func TestScannerService_PublishesEvents(t *testing.T) {
+	f := newScannerFixture(t)
+	hub := NewEventHub(nil)
+	sub, err := hub.Subscribe(1, false)
+	require.NoError(t, err)
+	f.svc.SetEventPublisher(hub)
+	f.write(t, "films/a.mkv", "aaaa")
+	f.scan(t)
+
+	var statuses, added []string
+	timeout := time.After(5 * time.Second)
+	for len(statuses) == 0 || statuses[len(statuses)-1] != ScanJobCompleted {
+		select {
+		case event := <-sub.Events():
+			switch event.Type {
+			case EventScanProgress:
+				statuses = append(statuses, event.Data.(ScanJobProgress).Status)
+			case EventMediaAdded:
+				added = append(added, event.Data.(map[string]interface{})["path"].(string))
+			}
+		case <-timeout:
+			t.Fatalf("no completion event, got statuses %v", statuses)
+		}
+	}
+	assert.Equal(t, ScanJobQueued, statuses[0])
+	assert.Contains(t, statuses, ScanJobRunning)
+	// Directories are not announced as media
+	assert.Equal(t, []string{"films/a.mkv"}, added)
+}
+
+func TestScannerService_FeedsRansomwareDetector(t *testing.T) {
+	f := newScannerFixture(t)
+	detector := NewRansomwareDetector(nil, zap.NewNop(), RansomwareDetectorConfig{
+		Window:                   time.Minute,
+		MassRenameThreshold:      3,
+		HighEntropyFileThreshold: 3,
+	})
+	notifier := &recordingNotifier{}
+	detector.AddNotifier(notifier)
+	f.svc.SetRansomwareDetector(detector)
+
+	random := make([]byte, 4096)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		f.write(t, fmt.Sprintf("docs/report%d.docx", i), strings.Repeat("x", i))
+		f.write(t, fmt.Sprintf("films/movie%d.mkv", i), strings.Repeat("y", 10+i))
+	}
+	// New files are not rewrites, whatever their content
+	f.write(t, "keys.bin", string(random))
+	f.write(t, "random.dat", string(random[1:]))
+	f.write(t, "noise.txt", string(random[2:]))
+	f.scan(t)
+	assert.False(t, detector.IsLocked("media"))
+
+	// Files rewritten in place are sampled while they are hashed
+	for i := 1; i <= 3; i++ {
+		f.write(t, fmt.Sprintf("docs/report%d.docx", i), string(random[i:]))
+	}
+	assert.Equal(t, ScanJobCompleted, f.scan(t).Status)
+	assert.True(t, detector.IsLocked("media"))
+	require.Equal(t, 1, notifier.count())
+	assert.Equal(t, LockdownTriggerEntropySpike, notifier.lockdowns[0].TriggerType)
+
+	// Moves to unknown extensions count towards the mass rename heuristic
+	f = newScannerFixture(t)
+	detector = NewRansomwareDetector(nil, zap.NewNop(), RansomwareDetectorConfig{
+		Window:              time.Minute,
+		MassRenameThreshold: 3,
+	})
+	notifier = &recordingNotifier{}
+	detector.AddNotifier(notifier)
+	f.svc.SetRansomwareDetector(detector)
+	for i := 1; i <= 3; i++ {
+		f.write(t, fmt.Sprintf("films/movie%d.mkv", i), strings.Repeat("y", i))
+	}
+	f.scan(t)
+	for i := 1; i <= 3; i++ {
+		name := filepath.Join(f.dir, "films", fmt.Sprintf("movie%d.mkv", i))
+		require.NoError(t, os.Rename(name, name+".crypt"))
+	}
+	job := f.scan(t)
+	assert.Equal(t, int64(3), job.FilesRenamed)
+	assert.True(t, detector.IsLocked("media"))
+	require.Equal(t, 1, notifier.count())
+	assert.Equal(t, LockdownTriggerMassRename, notifier.lockdowns[0].TriggerType)
+}
+
+func TestScannerService_BatchesCatalogWrites(t *testing.T) {
+	f := newScannerFixture(t)
+	f.svc.config.WriteBatchSize = 2
+	hub := NewEventHub(nil)
+	sub, err := hub.Subscribe(1, false)
+	require.NoError(t, err)
+	f.svc.SetEventPublisher(hub)
+	f.write(t, "a/b/c/deep.mkv", "deep")
+	f.write(t, "a/top.mkv", "top")
+
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.Equal(t, int64(5), job.FilesAdded)
+
+	// Parents written in an earlier batch are found by their children
+	assert.Equal(t, f.file(t, "a/b/c").id, f.file(t, "a/b/c/deep.mkv").parentID.Int64)
+	assert.Equal(t, f.file(t, "a").id, f.file(t, "a/b").parentID.Int64)
+
+	var changes int
+	require.NoError(t, f.db.QueryRowContext(context.Background(),
+		`SELECT COUNT(*) FROM catalog_changes WHERE scan_id = ?`, job.ID).Scan(&changes))
+	assert.Equal(t, 5, changes)
+
+	// The final event reports the rows written: each file and its change
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-sub.Events():
+			progress, ok := event.Data.(ScanJobProgress)
+			if !ok || progress.Status != ScanJobCompleted {
+				continue
+			}
+			assert.Equal(t, int64(10), progress.RowsWritten)
+			assert.Positive(t, progress.RowsPerSecond)
+			return
+		case <-timeout:
+			t.Fatal("no completion event")
+		}
+	}
+}
+
+func TestScannerService_KeepsFilesOutsideScannedDepth(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "a/b/deep.txt", "d")
+	f.scan(t)
+	assert.False(t, f.file(t, "a/b/deep.txt").deleted)
+
+	_, err := f.db.ExecContext(context.Background(), `UPDATE storage_roots SET max_depth = 1 WHERE id = ?`, f.rootID)
+	require.NoError(t, err)
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.Zero(t, job.FilesDeleted)
+	assert.Equal(t, int64(1), job.SkippedDepth)
+	assert.False(t, f.file(t, "a/b/deep.txt").deleted)
+}
+
+func TestScannerService_RejectsDisabledRoot(t *testing.T) {
+	f := newScannerFixture(t)
+	_, err := f.db.ExecContext(context.Background(), `UPDATE storage_roots SET enabled = 0 WHERE id = ?`, f.rootID)
+	require.NoError(t, err)
+
+	_, err = f.svc.StartScan(context.Background(), f.rootID, ScanTriggerManual)
+	assert.ErrorContains(t, err, "disabled")
+
+	_, err = f.svc.StartScan(context.Background(), 999, ScanTriggerManual)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestScannerService_Schedules(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "a.txt", "a")
+	ctx := context.Background()
+
+	_, err := f.svc.SetSchedule(ctx, f.rootID, "every day", "", true)
+	assert.ErrorContains(t, err, "invalid schedule")
+	_, err = f.svc.SetSchedule(ctx, f.rootID, "@daily", "Nowhere/Special", true)
+	assert.ErrorContains(t, err, "invalid schedule")
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	f.svc.now = func() time.Time { return now }
+	schedule, err := f.svc.SetSchedule(ctx, f.rootID, "@every 1h", "", true)
+	require.NoError(t, err)
+	assert.Equal(t, "media", schedule.StorageRoot)
+	require.NotNil(t, schedule.NextRunAt)
+	assert.True(t, schedule.NextRunAt.Equal(now.Add(time.Hour)))
+
+	// Not due yet
+	f.svc.RunDueSchedules(ctx)
+	jobs, err := f.svc.ListJobs(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	now = now.Add(2 * time.Hour)
+	f.svc.RunDueSchedules(ctx)
+	jobs, err = f.svc.ListJobs(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, ScanTriggerSchedule, jobs[0].Trigger)
+	assert.Equal(t, ScanJobCompleted, waitForScanJob(t, f.svc, jobs[0].ID).Status)
+
+	schedules, err := f.svc.ListSchedules(ctx)
+	require.NoError(t, err)
+	require.Len(t, schedules, 1)
+	require.NotNil(t, schedules[0].LastRunAt)
+	assert.True(t, schedules[0].LastRunAt.Equal(now))
+	assert.True(t, schedules[0].NextRunAt.Equal(now.Add(time.Hour)))
+
+	// Midnight in Tokyo
+	schedule, err = f.svc.SetSchedule(ctx, f.rootID, "0 0 * * *", "Asia/Tokyo", true)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", schedule.TimeZone)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	want := time.Date(now.In(tokyo).Year(), now.In(tokyo).Month(), now.In(tokyo).Day()+1, 0, 0, 0, 0, tokyo)
+	assert.True(t, schedule.NextRunAt.Equal(want))
+
+	schedule.Localize(tokyo)
+	assert.Equal(t, time.UTC, schedule.NextRunAt.Location())
+	assert.Equal(t, 0, schedule.NextRunAtLocal.Hour())
+	assert.Equal(t, "Asia/Tokyo", schedule.DisplayTimeZone)
+
+	require.NoError(t, f.svc.DeleteSchedule(ctx, f.rootID))
+	assert.ErrorContains(t, f.svc.DeleteSchedule(ctx, f.rootID), "not found")
+}
+
+func TestScannerService_ScansRootsInParallel(t *testing.T) {
+	f := newScannerFixture(t)
+	other := t.TempDir()
+	otherID, err := f.db.InsertReturningID(context.Background(),
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('music', 'local', ?)`, other)
+	require.NoError(t, err)
+	for _, name := range []string{"a.mkv", "b.mkv", "c/d.mkv"} {
+		f.write(t, name, name)
+		full := filepath.Join(other, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.WriteFile(full, []byte(name), 0644))
+	}
+
+	first, err := f.svc.StartScan(context.Background(), f.rootID, ScanTriggerManual)
+	require.NoError(t, err)
+	second, err := f.svc.StartScan(context.Background(), otherID, ScanTriggerManual)
+	require.NoError(t, err)
+
+	for _, id := range []int64{first.ID, second.ID} {
+		job := waitForScanJob(t, f.svc, id)
+		assert.Equal(t, ScanJobCompleted, job.Status)
+		assert.Equal(t, int64(4), job.FilesProcessed)
+		assert.Empty(t, job.Phase)
+		assert.Nil(t, job.ETA)
+	}
+	assert.Equal(t, f.svc.config.MaxIOWorkers, f.svc.io.free)
+}
+
+func TestScanJob_Estimate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	job := &scanJob{phaseStarted: start, progress: ScanJobProgress{
+		Status: ScanJobRunning, Phase: ScanPhaseListing, FilesProcessed: 100, FilesExpected: 400}}
+
+	job.estimate(start.Add(10 * time.Second))
+	assert.Equal(t, 10.0, job.progress.FilesPerSecond)
+	require.NotNil(t, job.progress.ETA)
+	assert.True(t, job.progress.ETA.Equal(start.Add(40*time.Second)))
+
+	// Past the previous catalog size there is no estimate left
+	job.progress.FilesProcessed = 500
+	job.estimate(start.Add(10 * time.Second))
+	assert.Equal(t, 50.0, job.progress.FilesPerSecond)
+	assert.Nil(t, job.progress.ETA)
+
+	// Hashing counts hashed files
+	job.progress.Phase, job.progress.FilesHashed, job.progress.FilesExpected = ScanPhaseHashing, 3, 9
+	job.estimate(start.Add(time.Second))
+	assert.Equal(t, 3.0, job.progress.FilesPerSecond)
+	assert.True(t, job.progress.ETA.Equal(start.Add(3*time.Second)))
+
+	job.progress.Status = ScanJobCompleted
+	job.estimate(start.Add(time.Second))
+	assert.Zero(t, job.progress.FilesPerSecond)
+	assert.Nil(t, job.progress.ETA)
+}
+
+func TestScannerService_ResumesInterruptedScans(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "a.txt", "a")
+	ctx := context.Background()
+	interrupted, err := f.db.InsertReturningID(ctx,
+		`INSERT INTO scan_history (storage_root_id, scan_type, status, start_time, triggered_by) VALUES (?, ?, ?, ?, ?)`,
+		f.rootID, "full", ScanJobRunning, time.Now(), ScanTriggerManual)
+	require.NoError(t, err)
+
+	f.svc.Start()
+	jobs, err := f.svc.ListJobs(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	resumed := jobs[0]
+	if resumed.ID == interrupted {
+		resumed = jobs[1]
+	}
+	assert.Equal(t, ScanTriggerResume, resumed.Trigger)
+	assert.Equal(t, ScanJobCompleted, waitForScanJob(t, f.svc, resumed.ID).Status)
+
+	old, err := f.svc.GetJob(ctx, interrupted)
+	require.NoError(t, err)
+	assert.Equal(t, ScanJobFailed, old.Status)
+	assert.False(t, f.file(t, "a.txt").deleted)
+}
+
+func TestScannerService_CancelFinishedJob(t *testing.T) {
+	f := newScannerFixture(t)
+	job := f.scan(t)
+
+	assert.ErrorContains(t, f.svc.CancelJob(context.Background(), job.ID), "not running")
+	assert.ErrorContains(t, f.svc.CancelJob(context.Background(), 999), "not found")
+}
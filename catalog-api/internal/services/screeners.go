@@ -0,0 +1,410 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Screener campaign states, derived from the campaign's expiry and
+// whether it was closed early.
+const (
+	ScreenerStatusActive  = "active"
+	ScreenerStatusExpired = "expired"
+	ScreenerStatusClosed  = "closed"
+)
+
+// screenerWatermarkText stamps every watermarked screener copy with the
+// recipient it was issued to.
+const screenerWatermarkText = "Screener for {label} {timestamp}"
+
+// ScreenerCampaign sends a set of files to named recipients. Each
+// recipient gets their own share link per file, so every play and
+// download can be attributed to them.
+type ScreenerCampaign struct {
+	ID          int64               `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	CreatedBy   int                 `json:"created_by"`
+	ExpiresAt   time.Time           `json:"expires_at"`
+	Watermark   bool                `json:"watermark"`
+	Status      string              `json:"status"`
+	FileIDs     []int64             `json:"file_ids,omitempty"`
+	Recipients  []ScreenerRecipient `json:"recipients,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	ClosedAt    *time.Time          `json:"closed_at,omitempty"`
+}
+
+// ScreenerRecipient is a person a campaign's files were sent to.
+type ScreenerRecipient struct {
+	ID    int64       `json:"id"`
+	Name  string      `json:"name"`
+	Email string      `json:"email"`
+	Links []ShareLink `json:"links,omitempty"`
+}
+
+// ScreenerAccess is one logged play or download of a screener link.
+type ScreenerAccess struct {
+	RecipientID int64     `json:"recipient_id"`
+	Recipient   string    `json:"recipient"`
+	Email       string    `json:"email"`
+	ShareLinkID int64     `json:"share_link_id"`
+	FileName    string    `json:"file_name"`
+	Action      string    `json:"action"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	Result      string    `json:"result"`
+	AccessedAt  time.Time `json:"accessed_at"`
+}
+
+// ScreenerRecipientSummary totals one recipient's activity.
+type ScreenerRecipientSummary struct {
+	RecipientID int64  `json:"recipient_id"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	ShareAccessTotals
+}
+
+// ScreenerReport is the activity report for a campaign.
+type ScreenerReport struct {
+	Campaign   *ScreenerCampaign          `json:"campaign"`
+	Recipients []ScreenerRecipientSummary `json:"recipients"`
+	Accesses   []ScreenerAccess           `json:"accesses"`
+}
+
+// ScreenerService manages screener campaigns on top of share links.
+type ScreenerService struct {
+	db     *database.DB
+	logger *zap.Logger
+	links  *ShareLinkService
+	now    func() time.Time
+}
+
+// NewScreenerService creates a new ScreenerService.
+func NewScreenerService(db *database.DB, logger *zap.Logger, links *ShareLinkService) *ScreenerService {
+	return &ScreenerService{
+		db:     db,
+		logger: logger,
+		links:  links,
+		now:    time.Now,
+	}
+}
+
+func (s *ScreenerService) status(c *ScreenerCampaign) string {
+	switch {
+	case c.ClosedAt != nil:
+		return ScreenerStatusClosed
+	case !c.ExpiresAt.After(s.now()):
+		return ScreenerStatusExpired
+	}
+	return ScreenerStatusActive
+}
+
+// CreateCampaign validates a campaign and issues a share link per
+// recipient and file, all expiring with the campaign. If any link cannot
+// be created the whole campaign is rolled back.
+func (s *ScreenerService) CreateCampaign(ctx context.Context, campaign *ScreenerCampaign) error {
+	if campaign.Name = strings.TrimSpace(campaign.Name); campaign.Name == "" {
+		return fmt.Errorf("invalid screener campaign: name is required")
+	}
+	if !campaign.ExpiresAt.After(s.now()) {
+		return fmt.Errorf("invalid screener campaign: expires_at must be in the future")
+	}
+	if len(campaign.FileIDs) == 0 {
+		return fmt.Errorf("invalid screener campaign: at least one file is required")
+	}
+	if len(campaign.Recipients) == 0 {
+		return fmt.Errorf("invalid screener campaign: at least one recipient is required")
+	}
+	seen := make(map[string]bool)
+	for i := range campaign.Recipients {
+		r := &campaign.Recipients[i]
+		r.Name = strings.TrimSpace(r.Name)
+		r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+		if r.Name == "" {
+			return fmt.Errorf("invalid screener campaign: recipient name is required")
+		}
+		if !strings.Contains(r.Email, "@") {
+			return fmt.Errorf("invalid screener campaign: recipient %s has an invalid email", r.Name)
+		}
+		if seen[r.Email] {
+			return fmt.Errorf("invalid screener campaign: recipient %s is listed twice", r.Email)
+		}
+		seen[r.Email] = true
+	}
+
+	campaign.CreatedAt = s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO screener_campaigns (name, description, created_by, expires_at, watermark, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		campaign.Name, campaign.Description, campaign.CreatedBy, campaign.ExpiresAt, campaign.Watermark, campaign.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create screener campaign: %w", err)
+	}
+	campaign.ID = id
+	campaign.Status = ScreenerStatusActive
+
+	if err := s.issueLinks(ctx, campaign); err != nil {
+		s.discard(campaign)
+		return err
+	}
+
+	s.logger.Info("Created screener campaign",
+		zap.Int64("campaign_id", campaign.ID),
+		zap.Int("recipients", len(campaign.Recipients)),
+		zap.Int("files", len(campaign.FileIDs)))
+	return nil
+}
+
+func (s *ScreenerService) issueLinks(ctx context.Context, campaign *ScreenerCampaign) error {
+	expires := campaign.ExpiresAt
+	for i := range campaign.Recipients {
+		r := &campaign.Recipients[i]
+		recipientID, err := s.db.InsertReturningID(ctx,
+			`INSERT INTO screener_recipients (campaign_id, name, email, created_at) VALUES (?, ?, ?, ?)`,
+			campaign.ID, r.Name, r.Email, campaign.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to add screener recipient: %w", err)
+		}
+		r.ID = recipientID
+
+		for _, fileID := range campaign.FileIDs {
+			link := ShareLink{
+				FileID:    fileID,
+				CreatedBy: campaign.CreatedBy,
+				Label:     fmt.Sprintf("%s <%s>", r.Name, r.Email),
+				ExpiresAt: &expires,
+			}
+			// Files that cannot carry a watermark are shared as they are
+			if campaign.Watermark && watermarkKind(s.fileName(ctx, fileID)) != "" {
+				link.Watermark = true
+				link.WatermarkText = screenerWatermarkText
+			}
+			if err := s.links.CreateLink(ctx, &link); err != nil {
+				return err
+			}
+			r.Links = append(r.Links, link)
+			if _, err := s.db.ExecContext(ctx,
+				`INSERT INTO screener_links (recipient_id, share_link_id) VALUES (?, ?)`, recipientID, link.ID); err != nil {
+				return fmt.Errorf("failed to link screener recipient: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ScreenerService) fileName(ctx context.Context, fileID int64) string {
+	var name string
+	s.db.QueryRowContext(ctx, `SELECT name FROM files WHERE id = ?`, fileID).Scan(&name)
+	return name
+}
+
+// discard removes a campaign that failed part way through creation.
+func (s *ScreenerService) discard(campaign *ScreenerCampaign) {
+	ctx := context.Background()
+	for _, r := range campaign.Recipients {
+		for _, link := range r.Links {
+			if err := s.links.RevokeLink(ctx, campaign.CreatedBy, link.ID); err != nil {
+				s.logger.Warn("Failed to revoke screener link", zap.Int64("share_link_id", link.ID), zap.Error(err))
+			}
+		}
+	}
+	for _, stmt := range []string{
+		`DELETE FROM screener_links WHERE recipient_id IN (SELECT id FROM screener_recipients WHERE campaign_id = ?)`,
+		`DELETE FROM screener_recipients WHERE campaign_id = ?`,
+		`DELETE FROM screener_campaigns WHERE id = ?`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt, campaign.ID); err != nil {
+			s.logger.Warn("Failed to discard screener campaign", zap.Int64("campaign_id", campaign.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *ScreenerService) scanCampaign(row shareLinkScanner) (*ScreenerCampaign, error) {
+	var c ScreenerCampaign
+	var closed sql.NullTime
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.CreatedBy, &c.ExpiresAt, &c.Watermark,
+		&c.CreatedAt, &closed); err != nil {
+		return nil, err
+	}
+	if closed.Valid {
+		c.ClosedAt = &closed.Time
+	}
+	c.Status = s.status(&c)
+	return &c, nil
+}
+
+const screenerCampaignColumns = `id, name, description, created_by, expires_at, watermark, created_at, closed_at`
+
+// ListCampaigns returns a user's campaigns, newest first, without
+// recipients.
+func (s *ScreenerService) ListCampaigns(ctx context.Context, userID int) ([]ScreenerCampaign, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+screenerCampaignColumns+` FROM screener_campaigns
+		 WHERE created_by = ? ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list screener campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	var campaigns []ScreenerCampaign
+	for rows.Next() {
+		c, err := s.scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan screener campaign: %w", err)
+		}
+		campaigns = append(campaigns, *c)
+	}
+	return campaigns, rows.Err()
+}
+
+// GetCampaign returns one of a user's campaigns with its recipients and
+// their links.
+func (s *ScreenerService) GetCampaign(ctx context.Context, userID int, id int64) (*ScreenerCampaign, error) {
+	campaign, err := s.scanCampaign(s.db.QueryRowContext(ctx,
+		`SELECT `+screenerCampaignColumns+` FROM screener_campaigns WHERE id = ? AND created_by = ?`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("screener campaign not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load screener campaign: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, email FROM screener_recipients WHERE campaign_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load screener recipients: %w", err)
+	}
+	for rows.Next() {
+		var r ScreenerRecipient
+		if err := rows.Scan(&r.ID, &r.Name, &r.Email); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan screener recipient: %w", err)
+		}
+		campaign.Recipients = append(campaign.Recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load screener recipients: %w", err)
+	}
+
+	files := make(map[int64]bool)
+	for i := range campaign.Recipients {
+		r := &campaign.Recipients[i]
+		linkRows, err := s.db.QueryContext(ctx,
+			`SELECT `+shareLinkColumns+` FROM screener_links scl
+			 JOIN share_links sl ON sl.id = scl.share_link_id
+			 JOIN files f ON f.id = sl.file_id
+			 WHERE scl.recipient_id = ? ORDER BY sl.id`, r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load screener links: %w", err)
+		}
+		for linkRows.Next() {
+			link, err := scanShareLink(linkRows)
+			if err != nil {
+				linkRows.Close()
+				return nil, fmt.Errorf("failed to scan screener link: %w", err)
+			}
+			r.Links = append(r.Links, *link)
+			if !files[link.FileID] {
+				files[link.FileID] = true
+				campaign.FileIDs = append(campaign.FileIDs, link.FileID)
+			}
+		}
+		linkRows.Close()
+		if err := linkRows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to load screener links: %w", err)
+		}
+	}
+	return campaign, nil
+}
+
+// CloseCampaign ends a campaign before it expires, revoking every link it
+// issued.
+func (s *ScreenerService) CloseCampaign(ctx context.Context, userID int, id int64) error {
+	campaign, err := s.GetCampaign(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if campaign.ClosedAt != nil {
+		return nil
+	}
+	for _, r := range campaign.Recipients {
+		for _, link := range r.Links {
+			if link.RevokedAt != nil {
+				continue
+			}
+			if err := s.links.RevokeLink(ctx, userID, link.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE screener_campaigns SET closed_at = ? WHERE id = ?`, s.now(), id); err != nil {
+		return fmt.Errorf("failed to close screener campaign: %w", err)
+	}
+	return nil
+}
+
+// Report returns every logged access to a campaign's links together with
+// per-recipient totals.
+func (s *ScreenerService) Report(ctx context.Context, userID int, id int64) (*ScreenerReport, error) {
+	campaign, err := s.GetCampaign(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScreenerReport{Campaign: campaign, Accesses: []ScreenerAccess{}}
+	summaries := make(map[int64]*ScreenerRecipientSummary)
+	for _, r := range campaign.Recipients {
+		report.Recipients = append(report.Recipients, ScreenerRecipientSummary{
+			RecipientID: r.ID, Name: r.Name, Email: r.Email,
+			ShareAccessTotals: ShareAccessTotals{IPAddresses: []string{}},
+		})
+	}
+	for i := range report.Recipients {
+		summaries[report.Recipients[i].RecipientID] = &report.Recipients[i]
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT sr.id, sr.name, sr.email, l.share_link_id, f.name, l.action, l.ip_address, l.user_agent, l.result, l.accessed_at
+		 FROM share_link_access_log l
+		 JOIN screener_links scl ON scl.share_link_id = l.share_link_id
+		 JOIN screener_recipients sr ON sr.id = scl.recipient_id
+		 JOIN share_links sl ON sl.id = l.share_link_id
+		 JOIN files f ON f.id = sl.file_id
+		 WHERE sr.campaign_id = ?
+		 ORDER BY l.accessed_at, l.id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load screener access log: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a ScreenerAccess
+		if err := rows.Scan(&a.RecipientID, &a.Recipient, &a.Email, &a.ShareLinkID, &a.FileName, &a.Action,
+			&a.IPAddress, &a.UserAgent, &a.Result, &a.AccessedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan screener access: %w", err)
+		}
+		report.Accesses = append(report.Accesses, a)
+
+		if summary := summaries[a.RecipientID]; summary != nil {
+			summary.record(a.Action, a.IPAddress, a.Result, a.AccessedAt)
+		}
+	}
+	return report, rows.Err()
+}
+
+func containsString(values []string, v string) bool {
+	for _, existing := range values {
+		if existing == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newScreenerFixture(t *testing.T) (*shareLinkFixture, *ScreenerService) {
+	t.Helper()
+	f := newShareLinkFixture(t)
+	return f, NewScreenerService(f.db, zap.NewNop(), f.svc)
+}
+
+func TestScreenerService_CreateValidation(t *testing.T) {
+	f, svc := newScreenerFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "cut.pdf", []byte("pdf"))
+	week := time.Now().Add(7 * 24 * time.Hour)
+	alice := []ScreenerRecipient{{Name: "Alice", Email: "alice@example.com"}}
+
+	err := svc.CreateCampaign(ctx, &ScreenerCampaign{Name: "Festival", ExpiresAt: time.Now().Add(-time.Hour), FileIDs: []int64{doc}, Recipients: alice})
+	assert.ErrorContains(t, err, "expires_at must be in the future")
+
+	err = svc.CreateCampaign(ctx, &ScreenerCampaign{Name: "Festival", ExpiresAt: week, Recipients: alice})
+	assert.ErrorContains(t, err, "at least one file")
+
+	err = svc.CreateCampaign(ctx, &ScreenerCampaign{Name: "Festival", ExpiresAt: week, FileIDs: []int64{doc},
+		Recipients: []ScreenerRecipient{{Name: "Alice", Email: "alice"}}})
+	assert.ErrorContains(t, err, "invalid email")
+
+	err = svc.CreateCampaign(ctx, &ScreenerCampaign{Name: "Festival", ExpiresAt: week, FileIDs: []int64{doc},
+		Recipients: append(alice, ScreenerRecipient{Name: "Also Alice", Email: "ALICE@example.com"})})
+	assert.ErrorContains(t, err, "listed twice")
+
+	// A missing file fails the campaign after recipients were added: nothing is left behind
+	err = svc.CreateCampaign(ctx, &ScreenerCampaign{Name: "Festival", CreatedBy: 1, ExpiresAt: week,
+		FileIDs: []int64{doc, 999}, Recipients: alice})
+	assert.ErrorContains(t, err, "not found")
+	campaigns, err := svc.ListCampaigns(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, campaigns)
+	links, err := f.svc.ListLinks(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.NotNil(t, links[0].RevokedAt, "the link issued before the failure is revoked")
+}
+
+func TestScreenerService_ReportAttributesAccessToRecipients(t *testing.T) {
+	f, svc := newScreenerFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "cut.pdf", []byte("rough cut"))
+
+	campaign := &ScreenerCampaign{
+		Name:      "Awards season",
+		CreatedBy: 1,
+		ExpiresAt: time.Now().Add(48 * time.Hour),
+		Watermark: true,
+		FileIDs:   []int64{doc},
+		Recipients: []ScreenerRecipient{
+			{Name: "Alice", Email: "alice@example.com"},
+			{Name: "Bob", Email: "bob@example.com"},
+		},
+	}
+	require.NoError(t, svc.CreateCampaign(ctx, campaign))
+	require.Len(t, campaign.Recipients[0].Links, 1)
+	aliceLink := campaign.Recipients[0].Links[0]
+	assert.False(t, aliceLink.Watermark, "files that cannot be watermarked are shared as they are")
+	require.NotNil(t, aliceLink.ExpiresAt)
+	assert.True(t, aliceLink.ExpiresAt.Equal(campaign.ExpiresAt), "links expire with the campaign")
+
+	download, err := f.svc.Open(ctx, aliceLink.Token, ShareAccess{Action: ShareAccessPlay, IPAddress: "203.0.113.7", UserAgent: "Safari"})
+	require.NoError(t, err)
+	readShare(t, download)
+	download, err = f.svc.Open(ctx, aliceLink.Token, ShareAccess{Action: ShareAccessDownload, IPAddress: "198.51.100.2"})
+	require.NoError(t, err)
+	readShare(t, download)
+
+	// After expiry the attempt is refused but still logged
+	f.svc.now = func() time.Time { return campaign.ExpiresAt.Add(time.Minute) }
+	svc.now = f.svc.now
+	_, err = f.svc.Open(ctx, aliceLink.Token, ShareAccess{IPAddress: "203.0.113.7"})
+	assert.ErrorContains(t, err, "expired")
+
+	report, err := svc.Report(ctx, 1, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ScreenerStatusExpired, report.Campaign.Status)
+	require.Len(t, report.Recipients, 2)
+	alice := report.Recipients[0]
+	assert.Equal(t, "alice@example.com", alice.Email)
+	assert.Equal(t, 1, alice.Plays)
+	assert.Equal(t, 1, alice.Downloads)
+	assert.Equal(t, 1, alice.Refused)
+	assert.Equal(t, []string{"203.0.113.7", "198.51.100.2"}, alice.IPAddresses)
+	assert.NotNil(t, alice.FirstAccess)
+	assert.Zero(t, report.Recipients[1].Plays+report.Recipients[1].Downloads)
+	assert.Nil(t, report.Recipients[1].LastAccess)
+
+	require.Len(t, report.Accesses, 3)
+	assert.Equal(t, "Alice", report.Accesses[0].Recipient)
+	assert.Equal(t, "cut.pdf", report.Accesses[0].FileName)
+	assert.Equal(t, "Safari", report.Accesses[0].UserAgent)
+	assert.Equal(t, ShareAccessServed, report.Accesses[0].Result)
+
+	_, err = svc.Report(ctx, 2, campaign.ID)
+	assert.ErrorContains(t, err, "not found", "reports are private to the campaign owner")
+}
+
+func TestScreenerService_CloseRevokesLinks(t *testing.T) {
+	f, svc := newScreenerFixture(t)
+	ctx := context.Background()
+	first := f.addFile(t, "reel1.pdf", []byte("reel one"))
+	second := f.addFile(t, "reel2.pdf", []byte("reel two"))
+
+	campaign := &ScreenerCampaign{
+		Name:       "Press",
+		CreatedBy:  1,
+		ExpiresAt:  time.Now().Add(time.Hour),
+		FileIDs:    []int64{first, second},
+		Recipients: []ScreenerRecipient{{Name: "Carol", Email: "carol@example.com"}},
+	}
+	require.NoError(t, svc.CreateCampaign(ctx, campaign))
+
+	loaded, err := svc.GetCampaign(ctx, 1, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ScreenerStatusActive, loaded.Status)
+	assert.Equal(t, []int64{first, second}, loaded.FileIDs)
+	require.Len(t, loaded.Recipients, 1)
+	require.Len(t, loaded.Recipients[0].Links, 2)
+
+	require.NoError(t, svc.CloseCampaign(ctx, 1, campaign.ID))
+	for _, link := range loaded.Recipients[0].Links {
+		_, err := f.svc.Open(ctx, link.Token, ShareAccess{})
+		assert.ErrorContains(t, err, "not found")
+	}
+	loaded, err = svc.GetCampaign(ctx, 1, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ScreenerStatusClosed, loaded.Status)
+
+	require.NoError(t, svc.CloseCampaign(ctx, 1, campaign.ID), "closing twice is a no-op")
+	assert.ErrorContains(t, svc.CloseCampaign(ctx, 2, campaign.ID), "not found")
+}
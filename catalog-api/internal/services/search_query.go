@@ -0,0 +1,283 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sort orders accepted by full-text search.
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortName      = "name"
+	SearchSortSize      = "size"
+	SearchSortModified  = "modified"
+	SearchSortYear      = "year"
+	SearchSortPath      = "path"
+)
+
+var searchSortFields = []string{
+	SearchSortRelevance, SearchSortName, SearchSortSize, SearchSortModified, SearchSortYear, SearchSortPath,
+}
+
+// SearchRange is an inclusive numeric range; a nil bound is open.
+type SearchRange struct {
+	Min *int64 `json:"min,omitempty"`
+	Max *int64 `json:"max,omitempty"`
+}
+
+// SearchTimeRange is an inclusive time range; a nil bound is open.
+type SearchTimeRange struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// SearchQuery is a parsed search query. Free text is matched against file
+// names, paths, titles, descriptions and tags; the remaining fields are
+// structured filters.
+//
+//	terminator type:video size:>1GB year:2020..2023 sort:-size
+//	"blade runner" ext:mkv root:nas path:films/ modified:2024-01-01..
+type SearchQuery struct {
+	Terms      []string         `json:"terms,omitempty"`
+	Phrases    []string         `json:"phrases,omitempty"`
+	Types      []string         `json:"types,omitempty"`
+	Extensions []string         `json:"extensions,omitempty"`
+	Roots      []string         `json:"roots,omitempty"`
+	PathPrefix string           `json:"path,omitempty"`
+	Size       *SearchRange     `json:"size,omitempty"`
+	Year       *SearchRange     `json:"year,omitempty"`
+	Modified   *SearchTimeRange `json:"modified,omitempty"`
+	Sort       string           `json:"sort,omitempty"`
+	Descending bool             `json:"descending,omitempty"`
+}
+
+// HasText reports whether the query has free text to match.
+func (q *SearchQuery) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Phrases) > 0
+}
+
+// ParseSearchQuery parses the search query language. Words and "quoted
+// phrases" are free text; key:value tokens with a known key are filters:
+//
+//	type:video            file type (video, audio, image, book, document,
+//	                      ...) or dir for directories; comma lists allowed
+//	ext:mkv               extension
+//	size:>1GB             size with B, KB, MB, GB or TB (powers of 1024);
+//	                      also <, >=, <=, exact values and ranges 1GB..4GB
+//	year:2020..2023       release year of the file's media item
+//	modified:>2024-01-01  modification date, same operators and ranges
+//	root:nas              storage root
+//	path:films/2024       path prefix
+//	sort:-size            sort by relevance, name, size, modified, year or
+//	                      path; a leading "-" sorts descending
+//
+// A token with an unknown key is treated as free text.
+func ParseSearchQuery(input string) (*SearchQuery, error) {
+	q := &SearchQuery{}
+	for _, token := range tokenizeSearchQuery(input) {
+		if token.quoted {
+			if text := strings.TrimSpace(token.text); text != "" {
+				q.Phrases = append(q.Phrases, text)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(token.text, ":")
+		if !found || value == "" {
+			q.Terms = append(q.Terms, token.text)
+			continue
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "type":
+			q.Types = append(q.Types, splitSearchList(value)...)
+		case "ext":
+			for _, ext := range splitSearchList(value) {
+				q.Extensions = append(q.Extensions, strings.TrimPrefix(ext, "."))
+			}
+		case "root":
+			q.Roots = append(q.Roots, strings.Split(value, ",")...)
+		case "path":
+			q.PathPrefix = strings.Trim(value, "/")
+		case "size":
+			q.Size, err = parseSearchRange(value, parseSearchSize)
+		case "year":
+			q.Year, err = parseSearchRange(value, parseSearchYear)
+		case "modified":
+			q.Modified, err = parseSearchTimeRange(value)
+		case "sort":
+			err = q.setSort(value)
+		default:
+			q.Terms = append(q.Terms, token.text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid search query: %s: %w", token.text, err)
+		}
+	}
+	return q, nil
+}
+
+// setSort sets the sort order from a sort: value such as "-size".
+func (q *SearchQuery) setSort(value string) error {
+	field, desc := strings.CutPrefix(strings.ToLower(value), "-")
+	if !containsString(searchSortFields, field) {
+		return fmt.Errorf("unknown sort %q, expected one of %s", field, strings.Join(searchSortFields, ", "))
+	}
+	q.Sort, q.Descending = field, desc
+	return nil
+}
+
+type searchToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSearchQuery splits on whitespace, keeping "quoted phrases"
+// together. A quote may also follow a key, as in path:"My Films".
+func tokenizeSearchQuery(input string) []searchToken {
+	var tokens []searchToken
+	var b strings.Builder
+	inQuote, quotedWhole := false, false
+	flush := func() {
+		if b.Len() > 0 || quotedWhole {
+			tokens = append(tokens, searchToken{text: b.String(), quoted: quotedWhole})
+		}
+		b.Reset()
+		quotedWhole = false
+	}
+	for _, r := range input {
+		switch {
+		case r == '"':
+			if !inQuote && b.Len() == 0 {
+				quotedWhole = true
+			}
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func splitSearchList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(strings.ToLower(value), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseSearchRange parses ">x", ">=x", "<x", "<=x", "x..y", "x.." , "..y"
+// and "x" with parse converting each bound.
+func parseSearchRange(value string, parse func(string) (int64, error)) (*SearchRange, error) {
+	r := &SearchRange{}
+	bound := func(s string) (*int64, error) {
+		if s == "" {
+			return nil, nil
+		}
+		n, err := parse(s)
+		if err != nil {
+			return nil, err
+		}
+		return &n, nil
+	}
+	var err error
+	switch {
+	case strings.Contains(value, ".."):
+		lo, hi, _ := strings.Cut(value, "..")
+		if r.Min, err = bound(lo); err == nil {
+			r.Max, err = bound(hi)
+		}
+		if err == nil && r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			err = fmt.Errorf("range is empty")
+		}
+	case strings.HasPrefix(value, ">="):
+		r.Min, err = bound(value[2:])
+	case strings.HasPrefix(value, "<="):
+		r.Max, err = bound(value[2:])
+	case strings.HasPrefix(value, ">"):
+		if r.Min, err = bound(value[1:]); err == nil && r.Min != nil {
+			*r.Min++
+		}
+	case strings.HasPrefix(value, "<"):
+		if r.Max, err = bound(value[1:]); err == nil && r.Max != nil {
+			*r.Max--
+		}
+	default:
+		r.Min, err = bound(value)
+		r.Max = r.Min
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Min == nil && r.Max == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	return r, nil
+}
+
+var searchSizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"tb", 1 << 40}, {"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1},
+}
+
+// parseSearchSize parses sizes such as 700MB or 1.5GB.
+func parseSearchSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	factor := 1.0
+	for _, unit := range searchSizeUnits {
+		if rest, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s, factor = rest, unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(math.Round(n * factor)), nil
+}
+
+func parseSearchYear(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1000 || n > 9999 {
+		return 0, fmt.Errorf("invalid year %q", s)
+	}
+	return n, nil
+}
+
+// parseSearchTimeRange parses a date range. Dates are YYYY-MM-DD in UTC;
+// an upper bound includes the whole day.
+func parseSearchTimeRange(value string) (*SearchTimeRange, error) {
+	days, err := parseSearchRange(value, func(s string) (int64, error) {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+		}
+		return t.Unix() / 86400, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &SearchTimeRange{}
+	if days.Min != nil {
+		from := time.Unix(*days.Min*86400, 0).UTC()
+		r.From = &from
+	}
+	if days.Max != nil {
+		to := time.Unix((*days.Max+1)*86400, 0).UTC().Add(-time.Nanosecond)
+		r.To = &to
+	}
+	return r, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := ParseSearchQuery(`blade "tears in rain" type:video,dir ext:.MKV size:>1GB year:2020..2023 root:nas path:/films/2024/ sort:-size Wars:`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"blade", "Wars:"}, q.Terms)
+	assert.Equal(t, []string{"tears in rain"}, q.Phrases)
+	assert.Equal(t, []string{"video", "dir"}, q.Types)
+	assert.Equal(t, []string{"mkv"}, q.Extensions)
+	assert.Equal(t, []string{"nas"}, q.Roots)
+	assert.Equal(t, "films/2024", q.PathPrefix)
+	assert.Equal(t, &SearchRange{Min: int64Ptr(1<<30 + 1)}, q.Size)
+	assert.Equal(t, &SearchRange{Min: int64Ptr(2020), Max: int64Ptr(2023)}, q.Year)
+	assert.Equal(t, SearchSortSize, q.Sort)
+	assert.True(t, q.Descending)
+	assert.True(t, q.HasText())
+}
+
+func TestParseSearchQuery_QuotedFilterValue(t *testing.T) {
+	q, err := ParseSearchQuery(`path:"My Films/Sci Fi" foo:bar`)
+	require.NoError(t, err)
+	assert.Equal(t, "My Films/Sci Fi", q.PathPrefix)
+	assert.Equal(t, []string{"foo:bar"}, q.Terms)
+}
+
+func TestParseSearchQuery_Ranges(t *testing.T) {
+	tests := []struct {
+		value string
+		want  SearchRange
+	}{
+		{"700MB", SearchRange{Min: int64Ptr(700 << 20), Max: int64Ptr(700 << 20)}},
+		{"1.5GB..", SearchRange{Min: int64Ptr(3 << 29)}},
+		{"..10kb", SearchRange{Max: int64Ptr(10 << 10)}},
+		{"<1kb", SearchRange{Max: int64Ptr(1023)}},
+		{">=2tb", SearchRange{Min: int64Ptr(2 << 40)}},
+		{"<=512", SearchRange{Max: int64Ptr(512)}},
+	}
+	for _, tt := range tests {
+		q, err := ParseSearchQuery("size:" + tt.value)
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, &tt.want, q.Size, tt.value)
+	}
+
+	q, err := ParseSearchQuery("year:>2019")
+	require.NoError(t, err)
+	assert.Equal(t, &SearchRange{Min: int64Ptr(2020)}, q.Year)
+}
+
+func TestParseSearchQuery_Modified(t *testing.T) {
+	q, err := ParseSearchQuery("modified:2024-01-01..2024-01-31")
+	require.NoError(t, err)
+	require.NotNil(t, q.Modified.From)
+	require.NotNil(t, q.Modified.To)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *q.Modified.From)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), *q.Modified.To)
+
+	q, err = ParseSearchQuery("modified:>2024-01-01")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), *q.Modified.From)
+	assert.Nil(t, q.Modified.To)
+}
+
+func TestParseSearchQuery_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"size:big",
+		"size:-1",
+		"size:..",
+		"size:2GB..1GB",
+		"year:20",
+		"year:abc",
+		"modified:yesterday",
+		"sort:random",
+	} {
+		_, err := ParseSearchQuery(input)
+		assert.ErrorContains(t, err, "invalid search query", input)
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	text, ok := highlightSnippet("Blade Runner 2049 (Final Cut)", []string{"runner", "cut"}, 10)
+	require.True(t, ok)
+	assert.Equal(t, "Blade <mark>Runner</mark> 2049 (Final <mark>Cut</mark>)", text)
+
+	text, ok = highlightSnippet("a very long description that eventually mentions replicants near the end", []string{"replicant"}, 10)
+	require.True(t, ok)
+	assert.Equal(t, "… mentions <mark>replicant</mark>s near the end", text)
+
+	_, ok = highlightSnippet("nothing here", []string{"blade"}, 10)
+	assert.False(t, ok)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Share access guard defaults.
+const (
+	DefaultShareChallengeDifficulty = 18
+	DefaultShareAttackCooldown      = 10 * time.Minute
+	shareAttackWindow               = time.Minute
+	shareChallengeTTL               = 5 * time.Minute
+	maxShareChallengeDifficulty     = 28
+)
+
+// ShareGuardConfig configures ShareAccessGuard.
+type ShareGuardConfig struct {
+	// AttackThreshold is how many failed share accesses within a minute,
+	// across all links, count as an attack. Zero disables challenges.
+	AttackThreshold int
+	// Difficulty is the number of leading zero bits a challenge solution
+	// must produce. Defaults to DefaultShareChallengeDifficulty.
+	Difficulty int
+	// Cooldown is how long challenges stay required after the last burst
+	// of failures. Defaults to DefaultShareAttackCooldown.
+	Cooldown time.Duration
+}
+
+// ShareChallenge is a proof-of-work challenge for anonymous share access.
+// A solution is any string such that the SHA-256 digest of challenge
+// followed by solution starts with Difficulty zero bits.
+type ShareChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	Algorithm  string    `json:"algorithm"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ShareAccessGuard detects guessing attacks on public share tokens and
+// passwords, and while one lasts requires anonymous clients to solve a
+// proof-of-work challenge before each access. Challenges are signed, so
+// issuing them keeps no state; only solved ones are remembered until they
+// expire, to stop their reuse.
+type ShareAccessGuard struct {
+	config ShareGuardConfig
+	key    []byte
+
+	mu          sync.Mutex
+	failures    []time.Time
+	attackUntil time.Time
+	used        map[string]time.Time
+
+	now func() time.Time
+}
+
+// NewShareAccessGuard creates a new ShareAccessGuard.
+func NewShareAccessGuard(config ShareGuardConfig) (*ShareAccessGuard, error) {
+	if config.Difficulty <= 0 {
+		config.Difficulty = DefaultShareChallengeDifficulty
+	}
+	if config.Difficulty > maxShareChallengeDifficulty {
+		return nil, fmt.Errorf("share challenge difficulty must be at most %d bits", maxShareChallengeDifficulty)
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultShareAttackCooldown
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate share challenge key: %w", err)
+	}
+	return &ShareAccessGuard{
+		config: config,
+		key:    key,
+		used:   make(map[string]time.Time),
+		now:    time.Now,
+	}, nil
+}
+
+// RecordFailure records a failed share access: an unknown token or a
+// wrong password. Reaching the attack threshold within a minute turns on
+// challenges for the cooldown.
+func (g *ShareAccessGuard) RecordFailure() {
+	if g.config.AttackThreshold <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	cutoff := now.Add(-shareAttackWindow)
+	kept := g.failures[:0]
+	for _, at := range g.failures {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	// Only the most recent threshold failures decide whether the window is full
+	if len(kept) >= g.config.AttackThreshold {
+		kept = kept[len(kept)-g.config.AttackThreshold+1:]
+	}
+	g.failures = append(kept, now)
+	if len(g.failures) >= g.config.AttackThreshold {
+		g.attackUntil = now.Add(g.config.Cooldown)
+	}
+}
+
+// UnderAttack reports whether anonymous share access currently requires
+// a solved challenge.
+func (g *ShareAccessGuard) UnderAttack() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.now().Before(g.attackUntil)
+}
+
+// Challenge issues a new challenge.
+func (g *ShareAccessGuard) Challenge() (*ShareChallenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate share challenge: %w", err)
+	}
+	expires := g.now().Add(shareChallengeTTL).Truncate(time.Second)
+	payload := strconv.FormatInt(expires.Unix(), 10) + "." + hex.EncodeToString(nonce) + "." + strconv.Itoa(g.config.Difficulty)
+	return &ShareChallenge{
+		Challenge:  payload + "." + g.sign(payload),
+		Difficulty: g.config.Difficulty,
+		Algorithm:  "sha256",
+		ExpiresAt:  expires,
+	}, nil
+}
+
+// Verify checks a solved challenge issued by this guard. Each challenge
+// can be used once.
+func (g *ShareAccessGuard) Verify(challenge, solution string) error {
+	payload, signature, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(g.sign(payload))) {
+		return fmt.Errorf("invalid share challenge")
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid share challenge")
+	}
+	expiresUnix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid share challenge")
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid share challenge")
+	}
+	expires := time.Unix(expiresUnix, 0)
+	now := g.now()
+	if !now.Before(expires) {
+		return fmt.Errorf("share challenge expired")
+	}
+	digest := sha256.Sum256([]byte(challenge + solution))
+	if leadingZeroBits(digest[:]) < difficulty {
+		return fmt.Errorf("share challenge solution is wrong")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for c, until := range g.used {
+		if !now.Before(until) {
+			delete(g.used, c)
+		}
+	}
+	if _, seen := g.used[challenge]; seen {
+		return fmt.Errorf("share challenge already used")
+	}
+	g.used[challenge] = expires
+	return nil
+}
+
+func (g *ShareAccessGuard) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// leadingZeroBits counts the zero bits at the start of b.
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
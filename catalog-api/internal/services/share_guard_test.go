@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func solveShareChallenge(t *testing.T, c *ShareChallenge) string {
+	t.Helper()
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		digest := sha256.Sum256([]byte(c.Challenge + solution))
+		if leadingZeroBits(digest[:]) >= c.Difficulty {
+			return solution
+		}
+	}
+}
+
+func TestShareAccessGuard_AttackDetection(t *testing.T) {
+	guard, err := NewShareAccessGuard(ShareGuardConfig{AttackThreshold: 3, Cooldown: time.Minute})
+	require.NoError(t, err)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	guard.RecordFailure()
+	guard.RecordFailure()
+	assert.False(t, guard.UnderAttack())
+	// Failures older than the window do not count
+	now = now.Add(2 * time.Minute)
+	guard.RecordFailure()
+	assert.False(t, guard.UnderAttack())
+	guard.RecordFailure()
+	guard.RecordFailure()
+	assert.True(t, guard.UnderAttack())
+	assert.Len(t, guard.failures, 3)
+
+	now = now.Add(time.Minute)
+	assert.False(t, guard.UnderAttack(), "challenges stop after the cooldown")
+
+	disabled, err := NewShareAccessGuard(ShareGuardConfig{})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		disabled.RecordFailure()
+	}
+	assert.False(t, disabled.UnderAttack())
+
+	_, err = NewShareAccessGuard(ShareGuardConfig{Difficulty: 40})
+	assert.Error(t, err)
+}
+
+func TestShareAccessGuard_Challenge(t *testing.T) {
+	guard, err := NewShareAccessGuard(ShareGuardConfig{AttackThreshold: 1, Difficulty: 8})
+	require.NoError(t, err)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	challenge, err := guard.Challenge()
+	require.NoError(t, err)
+	assert.Equal(t, 8, challenge.Difficulty)
+	assert.Equal(t, "sha256", challenge.Algorithm)
+	solution := solveShareChallenge(t, challenge)
+
+	// A wrong solution fails without using up the challenge
+	for i := 0; ; i++ {
+		digest := sha256.Sum256([]byte(challenge.Challenge + "x" + strconv.Itoa(i)))
+		if leadingZeroBits(digest[:]) < challenge.Difficulty {
+			assert.ErrorContains(t, guard.Verify(challenge.Challenge, "x"+strconv.Itoa(i)), "wrong")
+			break
+		}
+	}
+	require.NoError(t, guard.Verify(challenge.Challenge, solution))
+	assert.ErrorContains(t, guard.Verify(challenge.Challenge, solution), "already used")
+
+	// Tampering with the difficulty breaks the signature
+	other, err := guard.Challenge()
+	require.NoError(t, err)
+	tampered := other.Challenge[:len(other.Challenge)-66] + "0" + other.Challenge[len(other.Challenge)-65:]
+	assert.ErrorContains(t, guard.Verify(tampered, "0"), "invalid")
+	assert.ErrorContains(t, guard.Verify("garbage", "0"), "invalid")
+
+	stranger, err := NewShareAccessGuard(ShareGuardConfig{Difficulty: 8})
+	require.NoError(t, err)
+	assert.ErrorContains(t, stranger.Verify(other.Challenge, solveShareChallenge(t, other)), "invalid")
+
+	now = now.Add(shareChallengeTTL)
+	assert.ErrorContains(t, guard.Verify(other.Challenge, solveShareChallenge(t, other)), "expired")
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, leadingZeroBits([]byte{0x80}))
+	assert.Equal(t, 7, leadingZeroBits([]byte{0x01, 0xff}))
+	assert.Equal(t, 12, leadingZeroBits([]byte{0x00, 0x0f}))
+	assert.Equal(t, 16, leadingZeroBits([]byte{0x00, 0x00}))
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// shareEmailText is the body of the email that delivers a recipient's
+// link. Its arguments are the sharer, the file name, the sharer's message,
+// the link and the expiry line.
+const shareEmailText = `%s has shared "%s" with you.
+%s
+Open it here:
+
+%s
+%s
+This link was issued to you alone and is tracked; please do not forward it.
+`
+
+// ShareWithRecipients issues a separate link to each email address, built
+// from the link template, and emails every recipient their own link. The
+// links are created together or not at all; a failed email is recorded on
+// its link and can be retried with ResendLinkEmail.
+func (s *ShareLinkService) ShareWithRecipients(ctx context.Context, template *ShareLink, recipients []string, message string) ([]ShareLink, error) {
+	if s.mailer == nil || s.publicURL(ctx) == "" {
+		return nil, fmt.Errorf("email delivery is not configured")
+	}
+	emails, err := normalizeRecipients(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]ShareLink, 0, len(emails))
+	for _, email := range emails {
+		link := *template
+		link.RecipientEmail = email
+		if link.Label == "" {
+			link.Label = email
+		}
+		if err := s.CreateLink(ctx, &link); err != nil {
+			s.deleteLinks(links)
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	for i := range links {
+		if err := s.sendLinkEmail(ctx, &links[i], message); err != nil {
+			s.logger.Warn("Failed to email share link",
+				zap.Int64("share_link_id", links[i].ID), zap.String("recipient", links[i].RecipientEmail), zap.Error(err))
+		}
+	}
+	return links, nil
+}
+
+// normalizeRecipients parses, lower-cases and de-duplicates addresses.
+func normalizeRecipients(recipients []string) ([]string, error) {
+	var emails []string
+	for _, r := range recipients {
+		if strings.TrimSpace(r) == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid share link: invalid recipient email %q", r)
+		}
+		email := strings.ToLower(addr.Address)
+		if !containsString(emails, email) {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("invalid share link: at least one recipient email is required")
+	}
+	return emails, nil
+}
+
+// deleteLinks removes links whose batch failed before any was sent.
+func (s *ShareLinkService) deleteLinks(links []ShareLink) {
+	for _, link := range links {
+		if _, err := s.db.ExecContext(context.Background(), `DELETE FROM share_links WHERE id = ?`, link.ID); err != nil {
+			s.logger.Warn("Failed to discard share link", zap.Int64("share_link_id", link.ID), zap.Error(err))
+		}
+	}
+}
+
+// ResendLinkEmail emails a recipient their link again.
+func (s *ShareLinkService) ResendLinkEmail(ctx context.Context, userID int, id int64, message string) (*ShareLink, error) {
+	link, err := s.GetLink(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if link.RecipientEmail == "" {
+		return nil, fmt.Errorf("invalid share link: link was not issued to a recipient")
+	}
+	if link.RevokedAt != nil {
+		return nil, fmt.Errorf("invalid share link: link has been revoked")
+	}
+	if s.mailer == nil || s.publicURL(ctx) == "" {
+		return nil, fmt.Errorf("email delivery is not configured")
+	}
+	if err := s.sendLinkEmail(ctx, link, message); err != nil {
+		return nil, fmt.Errorf("failed to send share link email: %w", err)
+	}
+	return link, nil
+}
+
+// sendLinkEmail emails a link to its recipient and records the outcome
+// on the link.
+func (s *ShareLinkService) sendLinkEmail(ctx context.Context, link *ShareLink, message string) error {
+	var sharer string
+	err := s.db.QueryRowContext(ctx, `SELECT username FROM users WHERE id = ?`, link.CreatedBy).Scan(&sharer)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to load share link owner: %w", err)
+	}
+	if sharer == "" {
+		sharer = "Someone"
+	}
+	if message = strings.TrimSpace(message); message != "" {
+		message = "\n" + message + "\n"
+	}
+	expiry := ""
+	if link.ExpiresAt != nil {
+		expiry = fmt.Sprintf("\nThe link expires on %s.\n", link.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+
+	sendErr := s.mailer.SendEmail(ctx, &EmailMessage{
+		To:      link.RecipientEmail,
+		Subject: fmt.Sprintf("%s shared %s with you", sharer, link.FileName),
+		Body:    fmt.Sprintf(shareEmailText, sharer, link.FileName, message, s.linkURL(ctx, link), expiry),
+	})
+
+	link.EmailError = ""
+	if sendErr != nil {
+		link.EmailError = sendErr.Error()
+		_, err = s.db.ExecContext(ctx, `UPDATE share_links SET email_error = ? WHERE id = ?`, link.EmailError, link.ID)
+	} else {
+		now := s.now()
+		link.EmailSentAt = &now
+		_, err = s.db.ExecContext(ctx, `UPDATE share_links SET email_sent_at = ?, email_error = '' WHERE id = ?`, now, link.ID)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to record share link email", zap.Int64("share_link_id", link.ID), zap.Error(err))
+	}
+	return sendErr
+}
+
+// publicURL is the base URL links are built on: the configured PublicURL,
+// else the address of the request being served.
+func (s *ShareLinkService) publicURL(ctx context.Context) string {
+	if s.config.PublicURL != "" {
+		return strings.TrimRight(s.config.PublicURL, "/")
+	}
+	return RequestBaseURL(ctx)
+}
+
+// linkURL is the public address of a link, or "" when it is not known.
+func (s *ShareLinkService) linkURL(ctx context.Context, link *ShareLink) string {
+	base := s.publicURL(ctx)
+	if base == "" {
+		return ""
+	}
+	return base + "/api/v1/shared/" + link.Token
+}
+
+// LinkStats returns every logged access to one of a user's links with
+// totals, so each recipient's viewing can be followed separately.
+func (s *ShareLinkService) LinkStats(ctx context.Context, userID int, id int64) (*ShareLinkStats, error) {
+	link, err := s.GetLink(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ShareLinkStats{
+		Link:              link,
+		ShareAccessTotals: ShareAccessTotals{IPAddresses: []string{}},
+		Accesses:          []ShareLinkAccess{},
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT action, ip_address, user_agent, result, accessed_at FROM share_link_access_log
+		 WHERE share_link_id = ? ORDER BY accessed_at, id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share link access log: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a ShareLinkAccess
+		if err := rows.Scan(&a.Action, &a.IPAddress, &a.UserAgent, &a.Result, &a.AccessedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share link access: %w", err)
+		}
+		stats.Accesses = append(stats.Accesses, a)
+		stats.record(a.Action, a.IPAddress, a.Result, a.AccessedAt)
+	}
+	return stats, rows.Err()
+}
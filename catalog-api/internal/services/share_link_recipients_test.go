@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []EmailMessage
+	fail map[string]bool
+}
+
+func (m *recordingMailer) SendEmail(_ context.Context, msg *EmailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail[msg.To] {
+		return errors.New("mailbox unavailable")
+	}
+	m.sent = append(m.sent, *msg)
+	return nil
+}
+
+func newRecipientFixture(t *testing.T) (*shareLinkFixture, *recordingMailer) {
+	f := newShareLinkFixture(t)
+	mailer := &recordingMailer{fail: map[string]bool{}}
+	f.svc.config.PublicURL = "https://media.example.com/"
+	f.svc.SetEmailSender(mailer)
+	return f, mailer
+}
+
+func TestShareLinkService_ShareWithRecipients(t *testing.T) {
+	f, mailer := newRecipientFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf"))
+	mailer.fail["carol@example.com"] = true
+
+	links, err := f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1},
+		[]string{"Bob <Bob@Example.com>", "bob@example.com", "carol@example.com", " "}, "For review")
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "bob@example.com", links[0].RecipientEmail)
+	assert.Equal(t, "bob@example.com", links[0].Label)
+	assert.NotEqual(t, links[0].Token, links[1].Token)
+
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "bob@example.com", mailer.sent[0].To)
+	assert.Contains(t, mailer.sent[0].Subject, "alice shared notes.pdf")
+	assert.Contains(t, mailer.sent[0].Body, "https://media.example.com/api/v1/shared/"+links[0].Token)
+	assert.Contains(t, mailer.sent[0].Body, "For review")
+
+	bob, err := f.svc.GetLink(ctx, 1, links[0].ID)
+	require.NoError(t, err)
+	assert.NotNil(t, bob.EmailSentAt)
+	assert.Empty(t, bob.EmailError)
+	carol, err := f.svc.GetLink(ctx, 1, links[1].ID)
+	require.NoError(t, err)
+	assert.Nil(t, carol.EmailSentAt)
+	assert.Equal(t, "mailbox unavailable", carol.EmailError)
+
+	// A retry after the mailbox recovers clears the error
+	delete(mailer.fail, "carol@example.com")
+	carol, err = f.svc.ResendLinkEmail(ctx, 1, carol.ID, "")
+	require.NoError(t, err)
+	assert.NotNil(t, carol.EmailSentAt)
+	assert.Len(t, mailer.sent, 2)
+
+	// Revoking one recipient leaves the other's link working
+	require.NoError(t, f.svc.RevokeLink(ctx, 1, bob.ID))
+	_, err = f.svc.Open(ctx, bob.Token, ShareAccess{})
+	assert.Error(t, err)
+	d, err := f.svc.Open(ctx, carol.Token, ShareAccess{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("pdf"), readShare(t, d))
+
+	_, err = f.svc.ResendLinkEmail(ctx, 1, bob.ID, "")
+	assert.ErrorContains(t, err, "revoked")
+}
+
+func TestShareLinkService_ShareWithRecipientsValidation(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf"))
+
+	_, err := f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1}, []string{"bob@example.com"}, "")
+	assert.ErrorContains(t, err, "not configured")
+
+	f, _ = newRecipientFixture(t)
+	doc = f.addFile(t, "notes.pdf", []byte("pdf"))
+	_, err = f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1}, []string{"not an email"}, "")
+	assert.ErrorContains(t, err, "invalid recipient email")
+	_, err = f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1}, nil, "")
+	assert.ErrorContains(t, err, "at least one recipient")
+
+	// Invalid link settings create nothing
+	_, err = f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1, MaxDownloads: -1}, []string{"bob@example.com"}, "")
+	assert.Error(t, err)
+	links, err := f.svc.ListLinks(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	plain := ShareLink{FileID: doc, CreatedBy: 1}
+	require.NoError(t, f.svc.CreateLink(ctx, &plain))
+	_, err = f.svc.ResendLinkEmail(ctx, 1, plain.ID, "")
+	assert.ErrorContains(t, err, "not issued to a recipient")
+}
+
+func TestShareLinkService_LinkURLs(t *testing.T) {
+	f := newShareLinkFixture(t)
+	doc := f.addFile(t, "notes.pdf", []byte("pdf"))
+
+	// Without a public URL or request address links have no URL
+	link := ShareLink{FileID: doc, CreatedBy: 1}
+	require.NoError(t, f.svc.CreateLink(context.Background(), &link))
+	assert.Empty(t, link.URL)
+
+	// The address the client used is the fallback, including for email
+	mailer := &recordingMailer{fail: map[string]bool{}}
+	f.svc.SetEmailSender(mailer)
+	ctx := WithRequestBaseURL(context.Background(), "https://media.example.com/")
+	links, err := f.svc.ListLinks(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "https://media.example.com/api/v1/shared/"+link.Token, links[0].URL)
+
+	shared, err := f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1}, []string{"bob@example.com"}, "")
+	require.NoError(t, err)
+	require.Len(t, mailer.sent, 1)
+	assert.Contains(t, mailer.sent[0].Body, shared[0].URL)
+
+	// A configured public URL wins
+	f.svc.config.PublicURL = "https://share.example.com"
+	got, err := f.svc.GetLink(ctx, 1, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://share.example.com/api/v1/shared/"+link.Token, got.URL)
+}
+
+func TestShareLinkService_LinkStats(t *testing.T) {
+	f, _ := newRecipientFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf"))
+
+	links, err := f.svc.ShareWithRecipients(ctx, &ShareLink{FileID: doc, CreatedBy: 1, MaxDownloads: 2},
+		[]string{"bob@example.com", "carol@example.com"}, "")
+	require.NoError(t, err)
+	bob := links[0]
+
+	for _, access := range []ShareAccess{
+		{Action: ShareAccessPlay, IPAddress: "203.0.113.7"},
+		{Action: ShareAccessDownload, IPAddress: "198.51.100.2"},
+		{Action: ShareAccessDownload, IPAddress: "203.0.113.7"},
+	} {
+		if d, err := f.svc.Open(ctx, bob.Token, access); err == nil {
+			readShare(t, d)
+		}
+	}
+
+	stats, err := f.svc.LinkStats(ctx, 1, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", stats.Link.RecipientEmail)
+	assert.Equal(t, 1, stats.Plays)
+	assert.Equal(t, 1, stats.Downloads)
+	assert.Equal(t, 1, stats.Refused)
+	assert.Equal(t, []string{"203.0.113.7", "198.51.100.2"}, stats.IPAddresses)
+	assert.Len(t, stats.Accesses, 3)
+	assert.NotNil(t, stats.FirstAccess)
+
+	carol, err := f.svc.LinkStats(ctx, 1, links[1].ID)
+	require.NoError(t, err)
+	assert.Empty(t, carol.Accesses)
+	assert.Zero(t, carol.Downloads+carol.Plays+carol.Refused)
+
+	_, err = f.svc.LinkStats(ctx, 2, bob.ID)
+	assert.ErrorContains(t, err, "not found")
+}
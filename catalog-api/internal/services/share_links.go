@@ -0,0 +1,869 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Watermark modes. Cached links render one watermarked copy when the link
+// is created; live links render on every download so the timestamp is the
+// download time. Live mode is only offered for images because re-encoding
+// a video does not fit in a request.
+const (
+	WatermarkModeCached = "cached"
+	WatermarkModeLive   = "live"
+)
+
+// Cached watermark states.
+const (
+	WatermarkStatusPending = "pending"
+	WatermarkStatusReady   = "ready"
+	WatermarkStatusFailed  = "failed"
+)
+
+// DefaultWatermarkText is used when a watermarked link sets no template.
+const DefaultWatermarkText = "{username} {timestamp}"
+
+// ErrWatermarkPending is returned by Open while the watermarked copy of a
+// cached link is still being rendered.
+var ErrWatermarkPending = errors.New("watermarked copy is still being prepared")
+
+// Errors returned by Open for password-protected links.
+var (
+	ErrSharePasswordRequired = errors.New("share link password required")
+	ErrSharePasswordWrong    = errors.New("wrong share link password")
+)
+
+// ShareLinkLockedError is returned by Open while a password-protected link
+// is locked after wrong passwords.
+type ShareLinkLockedError struct {
+	Until time.Time
+}
+
+func (e *ShareLinkLockedError) Error() string {
+	return "share link is locked after wrong passwords until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+// Share link password limits. The first few wrong passwords in a row cost
+// nothing; after that each one locks the link for twice as long, up to
+// maxShareLockout.
+const (
+	minSharePasswordLength = 4
+	freeSharePasswordTries = 3
+	maxShareLockout        = 15 * time.Minute
+	// DefaultShareMaxFailedAttempts is how many wrong passwords in a row
+	// revoke a link when ShareLinkConfig sets no limit.
+	DefaultShareMaxFailedAttempts = 10
+)
+
+// shareRevokedTooManyAttempts is the revoked_reason of links revoked
+// after too many wrong passwords.
+const shareRevokedTooManyAttempts = "too many wrong passwords"
+
+// ShareLink is a public, tokenised link to a single file.
+type ShareLink struct {
+	ID                int64      `json:"id"`
+	Token             string     `json:"token"`
+	URL               string     `json:"url,omitempty"`
+	FileID            int64      `json:"file_id"`
+	FileName          string     `json:"file_name"`
+	CreatedBy         int        `json:"created_by"`
+	Label             string     `json:"label"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads      int        `json:"max_downloads"`
+	DownloadCount     int        `json:"download_count"`
+	Watermark         bool       `json:"watermark"`
+	WatermarkText     string     `json:"watermark_text,omitempty"`
+	WatermarkPosition string     `json:"watermark_position,omitempty"`
+	WatermarkMode     string     `json:"watermark_mode,omitempty"`
+	WatermarkStatus   string     `json:"watermark_status,omitempty"`
+	WatermarkError    string     `json:"watermark_error,omitempty"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason     string     `json:"revoked_reason,omitempty"`
+	PasswordProtected bool       `json:"password_protected"`
+	FailedAttempts    int        `json:"failed_attempts"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty"`
+	RecipientEmail    string     `json:"recipient_email,omitempty"`
+	EmailSentAt       *time.Time `json:"email_sent_at,omitempty"`
+	EmailError        string     `json:"email_error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastAccessedAt    *time.Time `json:"last_accessed_at,omitempty"`
+	// Password protects a new link; only its hash is stored.
+	Password string `json:"-"`
+
+	watermarkPath string
+	passwordHash  string
+}
+
+// Share link access actions and results for the access log. Other results
+// are the error that refused the request.
+const (
+	ShareAccessDownload = "download"
+	ShareAccessPlay     = "play"
+	ShareAccessServed   = "served"
+	ShareAccessPending  = "pending"
+)
+
+// ShareAccess identifies a request for a share link's content.
+type ShareAccess struct {
+	Action    string
+	IPAddress string
+	UserAgent string
+	// Password is the password given for a protected link.
+	Password string
+}
+
+// ShareAccessTotals counts logged accesses to one or more share links.
+type ShareAccessTotals struct {
+	Downloads   int        `json:"downloads"`
+	Plays       int        `json:"plays"`
+	Refused     int        `json:"refused"`
+	IPAddresses []string   `json:"ip_addresses"`
+	FirstAccess *time.Time `json:"first_access,omitempty"`
+	LastAccess  *time.Time `json:"last_access,omitempty"`
+}
+
+// record adds one access log entry. Entries must arrive oldest first.
+func (t *ShareAccessTotals) record(action, ipAddress, result string, at time.Time) {
+	switch {
+	case result != ShareAccessServed:
+		t.Refused++
+	case action == ShareAccessPlay:
+		t.Plays++
+	default:
+		t.Downloads++
+	}
+	if ipAddress != "" && !containsString(t.IPAddresses, ipAddress) {
+		t.IPAddresses = append(t.IPAddresses, ipAddress)
+	}
+	if t.FirstAccess == nil {
+		t.FirstAccess = &at
+	}
+	t.LastAccess = &at
+}
+
+// ShareLinkAccess is one logged request for a share link's content.
+type ShareLinkAccess struct {
+	Action     string    `json:"action"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Result     string    `json:"result"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// ShareLinkStats is the viewing activity of a single link.
+type ShareLinkStats struct {
+	Link *ShareLink `json:"link"`
+	ShareAccessTotals
+	Accesses []ShareLinkAccess `json:"accesses"`
+}
+
+// ShareLinkConfig configures ShareLinkService.
+type ShareLinkConfig struct {
+	// CacheDir holds watermarked copies. Defaults to ./data/share_links.
+	CacheDir string
+	// PublicURL is the externally reachable base URL of the API, used to
+	// build link URLs and the links emailed to recipients, e.g.
+	// https://media.example.com. Without it the address of the request,
+	// as seen through trusted proxies, is used.
+	PublicURL string
+	// MaxFailedAttempts is how many wrong passwords in a row revoke a
+	// password-protected link. Defaults to DefaultShareMaxFailedAttempts;
+	// negative never revokes.
+	MaxFailedAttempts int
+}
+
+// ShareDownload is the content served for a share link. Size is -1 when
+// it is not known up front.
+type ShareDownload struct {
+	Name   string
+	Size   int64
+	Reader io.ReadCloser
+}
+
+// ShareLinkService manages public share links and serves their content,
+// watermarking images and videos when the link asks for it.
+type ShareLinkService struct {
+	db          *database.DB
+	logger      *zap.Logger
+	config      ShareLinkConfig
+	clients     storageClientProvider
+	watermarker *Watermarker
+	mailer      EmailSender
+	now         func() time.Time
+
+	mu        sync.Mutex
+	rendering map[int64]bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewShareLinkService creates a new ShareLinkService.
+func NewShareLinkService(db *database.DB, logger *zap.Logger, clients storageClientProvider, watermarker *Watermarker, config ShareLinkConfig) *ShareLinkService {
+	if config.CacheDir == "" {
+		config.CacheDir = filepath.Join("data", "share_links")
+	}
+	if config.MaxFailedAttempts == 0 {
+		config.MaxFailedAttempts = DefaultShareMaxFailedAttempts
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ShareLinkService{
+		db:          db,
+		logger:      logger,
+		config:      config,
+		clients:     clients,
+		watermarker: watermarker,
+		now:         time.Now,
+		rendering:   make(map[int64]bool),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// SetEmailSender enables sending links to recipients by email.
+func (s *ShareLinkService) SetEmailSender(sender EmailSender) {
+	s.mailer = sender
+}
+
+// Stop cancels watermark renders in progress and waits for them to exit.
+func (s *ShareLinkService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func generateShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateLink validates and stores a new link, filling in its token and
+// watermark defaults. Cached watermarks start rendering straight away.
+func (s *ShareLinkService) CreateLink(ctx context.Context, link *ShareLink) error {
+	var name string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT name FROM files WHERE id = ? AND deleted = ? AND is_directory = ?`,
+		link.FileID, false, false).Scan(&name)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("file %d not found", link.FileID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load file %d: %w", link.FileID, err)
+	}
+	link.FileName = name
+
+	if link.MaxDownloads < 0 {
+		return fmt.Errorf("invalid share link: max_downloads cannot be negative")
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(s.now()) {
+		return fmt.Errorf("invalid share link: expires_at must be in the future")
+	}
+
+	if link.Watermark {
+		kind := watermarkKind(name)
+		if kind == "" {
+			return fmt.Errorf("invalid share link: only images and videos can be watermarked")
+		}
+		if link.WatermarkText = strings.TrimSpace(link.WatermarkText); link.WatermarkText == "" {
+			link.WatermarkText = DefaultWatermarkText
+		}
+		if link.WatermarkPosition == "" {
+			link.WatermarkPosition = WatermarkBottomRight
+		}
+		if !validWatermarkPosition(link.WatermarkPosition) {
+			return fmt.Errorf("invalid share link: unknown watermark position %q", link.WatermarkPosition)
+		}
+		switch link.WatermarkMode {
+		case "":
+			link.WatermarkMode = WatermarkModeCached
+		case WatermarkModeCached:
+		case WatermarkModeLive:
+			if kind != watermarkKindImage {
+				return fmt.Errorf("invalid share link: live watermarking is only supported for images")
+			}
+		default:
+			return fmt.Errorf("invalid share link: watermark mode must be %q or %q", WatermarkModeCached, WatermarkModeLive)
+		}
+		if link.WatermarkMode == WatermarkModeCached {
+			link.WatermarkStatus = WatermarkStatusPending
+		}
+	} else {
+		link.WatermarkText, link.WatermarkPosition, link.WatermarkMode = "", "", ""
+	}
+
+	link.passwordHash = ""
+	if link.Password != "" {
+		if len(link.Password) < minSharePasswordLength {
+			return fmt.Errorf("invalid share link: password must be at least %d characters", minSharePasswordLength)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(link.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("invalid share link: %w", err)
+		}
+		link.passwordHash = string(hash)
+	}
+	link.PasswordProtected = link.passwordHash != ""
+
+	token, err := generateShareToken()
+	if err != nil {
+		return err
+	}
+	link.Token = token
+	link.CreatedAt = s.now()
+	link.DownloadCount = 0
+
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO share_links
+		 (token, file_id, created_by, label, expires_at, max_downloads, watermark_enabled,
+		  watermark_text, watermark_position, watermark_mode, watermark_status, recipient_email, password_hash, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.Token, link.FileID, link.CreatedBy, link.Label, link.ExpiresAt, link.MaxDownloads, link.Watermark,
+		link.WatermarkText, link.WatermarkPosition, link.WatermarkMode, link.WatermarkStatus, link.RecipientEmail,
+		link.passwordHash, link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+	link.ID = id
+	link.URL = s.linkURL(ctx, link)
+
+	if link.WatermarkStatus == WatermarkStatusPending {
+		s.startRender(link.ID)
+	}
+	return nil
+}
+
+const shareLinkColumns = `sl.id, sl.token, sl.file_id, f.name, sl.created_by, sl.label, sl.expires_at,
+	sl.max_downloads, sl.download_count, sl.watermark_enabled, sl.watermark_text, sl.watermark_position,
+	sl.watermark_mode, sl.watermark_status, sl.watermark_error, sl.watermark_path, sl.revoked_at,
+	sl.recipient_email, sl.email_sent_at, sl.email_error, sl.created_at, sl.last_accessed_at,
+	sl.revoked_reason, sl.password_hash, sl.failed_attempts, sl.locked_until`
+
+type shareLinkScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanShareLink(row shareLinkScanner) (*ShareLink, error) {
+	var link ShareLink
+	var expires, revoked, emailed, accessed, locked sql.NullTime
+	if err := row.Scan(&link.ID, &link.Token, &link.FileID, &link.FileName, &link.CreatedBy, &link.Label, &expires,
+		&link.MaxDownloads, &link.DownloadCount, &link.Watermark, &link.WatermarkText, &link.WatermarkPosition,
+		&link.WatermarkMode, &link.WatermarkStatus, &link.WatermarkError, &link.watermarkPath, &revoked,
+		&link.RecipientEmail, &emailed, &link.EmailError, &link.CreatedAt, &accessed,
+		&link.RevokedReason, &link.passwordHash, &link.FailedAttempts, &locked); err != nil {
+		return nil, err
+	}
+	link.PasswordProtected = link.passwordHash != ""
+	if locked.Valid {
+		link.LockedUntil = &locked.Time
+	}
+	if emailed.Valid {
+		link.EmailSentAt = &emailed.Time
+	}
+	if expires.Valid {
+		link.ExpiresAt = &expires.Time
+	}
+	if revoked.Valid {
+		link.RevokedAt = &revoked.Time
+	}
+	if accessed.Valid {
+		link.LastAccessedAt = &accessed.Time
+	}
+	return &link, nil
+}
+
+func (s *ShareLinkService) loadLink(ctx context.Context, where string, args ...interface{}) (*ShareLink, error) {
+	link, err := scanShareLink(s.db.QueryRowContext(ctx,
+		`SELECT `+shareLinkColumns+` FROM share_links sl JOIN files f ON f.id = sl.file_id WHERE `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("share link not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share link: %w", err)
+	}
+	link.URL = s.linkURL(ctx, link)
+	return link, nil
+}
+
+// ListLinks returns the links a user created, newest first.
+func (s *ShareLinkService) ListLinks(ctx context.Context, userID int) ([]ShareLink, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+shareLinkColumns+` FROM share_links sl JOIN files f ON f.id = sl.file_id
+		 WHERE sl.created_by = ? ORDER BY sl.created_at DESC, sl.id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []ShareLink
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		link.URL = s.linkURL(ctx, link)
+		links = append(links, *link)
+	}
+	return links, rows.Err()
+}
+
+// GetLink returns one of a user's links.
+func (s *ShareLinkService) GetLink(ctx context.Context, userID int, id int64) (*ShareLink, error) {
+	return s.loadLink(ctx, `sl.id = ? AND sl.created_by = ?`, id, userID)
+}
+
+// RevokeLink disables a user's link and drops its watermarked copy.
+func (s *ShareLinkService) RevokeLink(ctx context.Context, userID int, id int64) error {
+	link, err := s.GetLink(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE share_links SET revoked_at = ?, watermark_path = '' WHERE id = ? AND revoked_at IS NULL`,
+		s.now(), id); err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	if link.watermarkPath != "" {
+		os.Remove(link.watermarkPath)
+	}
+	return nil
+}
+
+// Open resolves a public token and returns the content to send, counting
+// the download against the link's limit. Every attempt on a known link is
+// recorded in the access log, including refused ones.
+func (s *ShareLinkService) Open(ctx context.Context, token string, access ShareAccess) (*ShareDownload, error) {
+	link, err := s.loadLink(ctx, `sl.token = ? AND sl.revoked_at IS NULL AND f.deleted = ?`, token, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPassword(ctx, link, access.Password); err != nil {
+		s.logAccess(ctx, link.ID, access, err.Error())
+		return nil, err
+	}
+	download, err := s.open(ctx, link)
+	result := ShareAccessServed
+	if errors.Is(err, ErrWatermarkPending) {
+		result = ShareAccessPending
+	} else if err != nil {
+		result = err.Error()
+	}
+	s.logAccess(ctx, link.ID, access, result)
+	return download, err
+}
+
+// checkPassword verifies the password of a protected link. Every attempt
+// counts as a wrong password until it proves right, so concurrent guesses
+// cannot outrun the lockout: after freeSharePasswordTries wrong passwords
+// in a row each one locks the link for a doubling delay, and
+// MaxFailedAttempts of them revoke it.
+func (s *ShareLinkService) checkPassword(ctx context.Context, link *ShareLink, password string) error {
+	if link.passwordHash == "" {
+		return nil
+	}
+	now := s.now()
+	if link.LockedUntil != nil && link.LockedUntil.After(now) {
+		return &ShareLinkLockedError{Until: *link.LockedUntil}
+	}
+	if password == "" {
+		return ErrSharePasswordRequired
+	}
+
+	var lockedUntil *time.Time
+	if delay := shareLockout(link.FailedAttempts + 1); delay > 0 {
+		until := now.Add(delay)
+		lockedUntil = &until
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE share_links SET failed_attempts = failed_attempts + 1, locked_until = ?
+		 WHERE id = ? AND revoked_at IS NULL AND (locked_until IS NULL OR locked_until <= ?)`,
+		lockedUntil, link.ID, now)
+	if err != nil {
+		return fmt.Errorf("failed to record share link password attempt: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to record share link password attempt: %w", err)
+	} else if affected == 0 {
+		// Another attempt locked or revoked the link first
+		if reloaded, err := s.loadLink(ctx, `sl.id = ? AND sl.revoked_at IS NULL`, link.ID); err != nil {
+			return err
+		} else if reloaded.LockedUntil != nil {
+			return &ShareLinkLockedError{Until: *reloaded.LockedUntil}
+		}
+		return ErrSharePasswordWrong
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(link.passwordHash), []byte(password)) == nil {
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE share_links SET failed_attempts = 0, locked_until = NULL WHERE id = ?`, link.ID); err != nil {
+			return fmt.Errorf("failed to record share link password attempt: %w", err)
+		}
+		return nil
+	}
+
+	if max := s.config.MaxFailedAttempts; max > 0 {
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE share_links SET revoked_at = ?, revoked_reason = ?, watermark_path = ''
+			 WHERE id = ? AND revoked_at IS NULL AND failed_attempts >= ?`,
+			now, shareRevokedTooManyAttempts, link.ID, max)
+		if err != nil {
+			s.logger.Error("Failed to revoke share link", zap.Int64("share_link_id", link.ID), zap.Error(err))
+		} else if affected, _ := result.RowsAffected(); affected > 0 {
+			s.logger.Warn("Revoked share link after too many wrong passwords",
+				zap.Int64("share_link_id", link.ID), zap.Int("attempts", max))
+			if link.watermarkPath != "" {
+				os.Remove(link.watermarkPath)
+			}
+		}
+	}
+	return ErrSharePasswordWrong
+}
+
+// shareLockout is how long the given wrong password in a row locks a link.
+func shareLockout(attempt int) time.Duration {
+	if attempt <= freeSharePasswordTries {
+		return 0
+	}
+	shift := attempt - freeSharePasswordTries
+	if shift > 10 {
+		return maxShareLockout
+	}
+	if delay := time.Second << shift; delay < maxShareLockout {
+		return delay
+	}
+	return maxShareLockout
+}
+
+func (s *ShareLinkService) logAccess(ctx context.Context, linkID int64, access ShareAccess, result string) {
+	if access.Action != ShareAccessPlay {
+		access.Action = ShareAccessDownload
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO share_link_access_log (share_link_id, action, ip_address, user_agent, result, accessed_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		linkID, access.Action, access.IPAddress, access.UserAgent, result, s.now()); err != nil {
+		s.logger.Warn("Failed to log share link access", zap.Int64("share_link_id", linkID), zap.Error(err))
+	}
+}
+
+func (s *ShareLinkService) open(ctx context.Context, link *ShareLink) (*ShareDownload, error) {
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(s.now()) {
+		return nil, fmt.Errorf("share link has expired")
+	}
+	if link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads {
+		return nil, fmt.Errorf("share link download limit reached")
+	}
+
+	var download *ShareDownload
+	var err error
+	switch {
+	case !link.Watermark:
+		download, err = s.openOriginal(ctx, link)
+	case link.WatermarkMode == WatermarkModeLive:
+		download, err = s.openLive(ctx, link)
+	default:
+		download, err = s.openCached(link)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The guard makes concurrent downloads of the last allowed copy race safely
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE share_links SET download_count = download_count + 1, last_accessed_at = ?
+		 WHERE id = ? AND (max_downloads = 0 OR download_count < max_downloads)`, s.now(), link.ID)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			download.Reader.Close()
+			return nil, fmt.Errorf("share link download limit reached")
+		}
+	}
+	if err != nil {
+		download.Reader.Close()
+		return nil, fmt.Errorf("failed to record share link download: %w", err)
+	}
+	return download, nil
+}
+
+// sourceReader streams a catalogued file and disconnects its client when
+// closed.
+type sourceReader struct {
+	io.ReadCloser
+	disconnect func()
+}
+
+func (r *sourceReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.disconnect()
+	return err
+}
+
+// openSource opens a file on its storage root.
+func (s *ShareLinkService) openSource(ctx context.Context, fileID int64) (io.ReadCloser, int64, error) {
+	var rootName, filePath string
+	var size int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sr.name, f.path, f.size FROM files f JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE f.id = ?`, fileID).Scan(&rootName, &filePath, &size)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("file %d not found", fileID)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load file %d: %w", fileID, err)
+	}
+
+	root, err := loadStorageRootByName(ctx, s.db, rootName)
+	if err != nil {
+		return nil, 0, err
+	}
+	client, err := s.clients.NewClient(root)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create client for %s: %w", rootName, err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to %s: %w", rootName, err)
+	}
+	reader, err := client.ReadFile(ctx, filePath)
+	if err != nil {
+		client.Disconnect(ctx)
+		return nil, 0, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return &sourceReader{ReadCloser: reader, disconnect: func() { client.Disconnect(context.Background()) }}, size, nil
+}
+
+func (s *ShareLinkService) openOriginal(ctx context.Context, link *ShareLink) (*ShareDownload, error) {
+	reader, size, err := s.openSource(ctx, link.FileID)
+	if err != nil {
+		return nil, err
+	}
+	return &ShareDownload{Name: link.FileName, Size: size, Reader: reader}, nil
+}
+
+func (s *ShareLinkService) openLive(ctx context.Context, link *ShareLink) (*ShareDownload, error) {
+	text, err := s.watermarkText(ctx, link, s.now())
+	if err != nil {
+		return nil, err
+	}
+	reader, _, err := s.openSource(ctx, link.FileID)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var out bytes.Buffer
+	ext, err := s.watermarker.WatermarkImage(reader, &out, text, link.WatermarkPosition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watermark %s: %w", link.FileName, err)
+	}
+	return &ShareDownload{
+		Name:   watermarkedName(link.FileName, ext),
+		Size:   int64(out.Len()),
+		Reader: io.NopCloser(&out),
+	}, nil
+}
+
+func (s *ShareLinkService) openCached(link *ShareLink) (*ShareDownload, error) {
+	switch link.WatermarkStatus {
+	case WatermarkStatusFailed:
+		return nil, fmt.Errorf("failed to prepare watermarked copy: %s", link.WatermarkError)
+	case WatermarkStatusReady:
+		f, err := os.Open(link.watermarkPath)
+		if err == nil {
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to stat watermarked copy: %w", err)
+			}
+			return &ShareDownload{
+				Name:   watermarkedName(link.FileName, filepath.Ext(link.watermarkPath)),
+				Size:   info.Size(),
+				Reader: f,
+			}, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to open watermarked copy: %w", err)
+		}
+		// The cache was cleared underneath us; render it again
+		s.logger.Warn("Watermarked copy missing, re-rendering", zap.Int64("share_link_id", link.ID))
+	}
+	s.startRender(link.ID)
+	return nil, ErrWatermarkPending
+}
+
+// watermarkedName swaps a file name's extension for the rendered one.
+func watermarkedName(name, ext string) string {
+	if strings.EqualFold(filepath.Ext(name), ext) {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+}
+
+// watermarkText expands the link's template. Cached copies are stamped
+// with the link's creation time; live ones with the download time.
+func (s *ShareLinkService) watermarkText(ctx context.Context, link *ShareLink, at time.Time) (string, error) {
+	var username string
+	err := s.db.QueryRowContext(ctx, `SELECT username FROM users WHERE id = ?`, link.CreatedBy).Scan(&username)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to load share link owner: %w", err)
+	}
+	return strings.NewReplacer(
+		"{username}", username,
+		"{label}", link.Label,
+		"{recipient}", link.RecipientEmail,
+		"{timestamp}", at.UTC().Format("2006-01-02 15:04 UTC"),
+		"{link}", strconv.FormatInt(link.ID, 10),
+	).Replace(link.WatermarkText), nil
+}
+
+// startRender renders a link's watermarked copy in the background unless
+// a render is already running.
+func (s *ShareLinkService) startRender(id int64) {
+	s.mu.Lock()
+	if s.rendering[id] || s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.rendering[id] = true
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.rendering, id)
+			s.mu.Unlock()
+		}()
+		if err := s.render(s.ctx, id); err != nil {
+			s.logger.Error("Failed to render watermarked copy", zap.Int64("share_link_id", id), zap.Error(err))
+			if _, dbErr := s.db.ExecContext(context.Background(),
+				`UPDATE share_links SET watermark_status = ?, watermark_error = ? WHERE id = ?`,
+				WatermarkStatusFailed, err.Error(), id); dbErr != nil {
+				s.logger.Error("Failed to record watermark failure", zap.Int64("share_link_id", id), zap.Error(dbErr))
+			}
+		}
+	}()
+}
+
+// render stages the source file and writes its watermarked copy into the
+// cache directory as <link id><ext>.
+func (s *ShareLinkService) render(ctx context.Context, id int64) error {
+	link, err := s.loadLink(ctx, `sl.id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE share_links SET watermark_status = ?, watermark_error = '' WHERE id = ?`,
+		WatermarkStatusPending, id); err != nil {
+		return fmt.Errorf("failed to update share link: %w", err)
+	}
+	text, err := s.watermarkText(ctx, link, link.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.config.CacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create share link cache directory: %w", err)
+	}
+	src, err := os.CreateTemp(s.config.CacheDir, "source_*"+filepath.Ext(link.FileName))
+	if err != nil {
+		return fmt.Errorf("failed to stage source file: %w", err)
+	}
+	defer os.Remove(src.Name())
+	reader, _, err := s.openSource(ctx, link.FileID)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	_, err = io.Copy(src, reader)
+	reader.Close()
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stage source file: %w", err)
+	}
+
+	base := filepath.Join(s.config.CacheDir, strconv.FormatInt(id, 10))
+	var outPath string
+	if watermarkKind(link.FileName) == watermarkKindVideo {
+		outPath = base + ".mp4"
+		partial := base + ".partial.mp4"
+		if err := s.watermarker.WatermarkVideo(ctx, src.Name(), partial, text, link.WatermarkPosition); err != nil {
+			return err
+		}
+		if err := os.Rename(partial, outPath); err != nil {
+			os.Remove(partial)
+			return fmt.Errorf("failed to store watermarked copy: %w", err)
+		}
+	} else {
+		outPath, err = s.renderImage(src.Name(), base, text, link.WatermarkPosition)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE share_links SET watermark_status = ?, watermark_error = '', watermark_path = ?
+		 WHERE id = ? AND revoked_at IS NULL`, WatermarkStatusReady, outPath, id)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			// Revoked while rendering
+			os.Remove(outPath)
+			return nil
+		}
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("failed to update share link: %w", err)
+	}
+	s.logger.Info("Rendered watermarked copy", zap.Int64("share_link_id", id), zap.String("path", outPath))
+	return nil
+}
+
+func (s *ShareLinkService) renderImage(srcPath, base, text, position string) (string, error) {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open staged image: %w", err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(base), "watermark_*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create watermarked copy: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	ext, err := s.watermarker.WatermarkImage(in, tmp, text, position)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	outPath := base + ext
+	if err := os.Rename(tmp.Name(), outPath); err != nil {
+		return "", fmt.Errorf("failed to store watermarked copy: %w", err)
+	}
+	return outPath, nil
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/config"
+	"catalogizer/database"
+	"context"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type shareLinkFixture struct {
+	db        *database.DB
+	svc       *ShareLinkService
+	remoteDir string
+	cacheDir  string
+}
+
+func newShareLinkFixture(t *testing.T) *shareLinkFixture {
+	t.Helper()
+
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "share_links.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	f := &shareLinkFixture{
+		db:        db,
+		remoteDir: t.TempDir(),
+		cacheDir:  t.TempDir(),
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO roles (id, name, permissions) VALUES (100, 'share-links-test', '[]');
+		INSERT INTO users (id, username, email, password_hash, salt, role_id) VALUES
+			(1, 'alice', 'alice@example.com', 'x', 'x', 100);`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO storage_roots (id, name, protocol, path) VALUES (1, 'main-nas', 'local', ?)`, f.remoteDir)
+	require.NoError(t, err)
+
+	f.svc = NewShareLinkService(f.db, zap.NewNop(), localRootClients{}, NewWatermarker(), ShareLinkConfig{CacheDir: f.cacheDir})
+	t.Cleanup(f.svc.Stop)
+	return f
+}
+
+func (f *shareLinkFixture) addFile(t *testing.T, name string, content []byte) int64 {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(f.remoteDir, name), content, 0644))
+	id, err := f.db.InsertReturningID(context.Background(),
+		`INSERT INTO files (storage_root_id, path, name, size, modified_at) VALUES (1, ?, ?, ?, CURRENT_TIMESTAMP)`, name, name, len(content))
+	require.NoError(t, err)
+	return id
+}
+
+func readShare(t *testing.T, d *ShareDownload) []byte {
+	t.Helper()
+	defer d.Reader.Close()
+	data, err := io.ReadAll(d.Reader)
+	require.NoError(t, err)
+	return data
+}
+
+// waitForWatermark waits for a cached render to leave the pending state.
+func (f *shareLinkFixture) waitForWatermark(t *testing.T, id int64) *ShareLink {
+	t.Helper()
+	var link *ShareLink
+	require.Eventually(t, func() bool {
+		loaded, err := f.svc.GetLink(context.Background(), 1, id)
+		if err != nil {
+			return false
+		}
+		link = loaded
+		return link.WatermarkStatus != WatermarkStatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+	return link
+}
+
+func TestShareLinkService_CreateValidation(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf"))
+	film := f.addFile(t, "film.mkv", []byte("video"))
+
+	err := f.svc.CreateLink(ctx, &ShareLink{FileID: 999, CreatedBy: 1})
+	assert.ErrorContains(t, err, "not found")
+
+	err = f.svc.CreateLink(ctx, &ShareLink{FileID: doc, CreatedBy: 1, Watermark: true})
+	assert.ErrorContains(t, err, "only images and videos")
+
+	err = f.svc.CreateLink(ctx, &ShareLink{FileID: film, CreatedBy: 1, Watermark: true, WatermarkMode: WatermarkModeLive})
+	assert.ErrorContains(t, err, "only supported for images")
+
+	err = f.svc.CreateLink(ctx, &ShareLink{FileID: film, CreatedBy: 1, Watermark: true, WatermarkPosition: "middle"})
+	assert.ErrorContains(t, err, "invalid share link")
+
+	past := time.Now().Add(-time.Hour)
+	err = f.svc.CreateLink(ctx, &ShareLink{FileID: doc, CreatedBy: 1, ExpiresAt: &past})
+	assert.ErrorContains(t, err, "invalid share link")
+}
+
+func TestShareLinkService_DownloadLimitsAndExpiry(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf content"))
+
+	link := &ShareLink{FileID: doc, CreatedBy: 1, MaxDownloads: 1}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	assert.Len(t, link.Token, 48)
+
+	download, err := f.svc.Open(ctx, link.Token, ShareAccess{})
+	require.NoError(t, err)
+	assert.Equal(t, "notes.pdf", download.Name)
+	assert.Equal(t, int64(11), download.Size)
+	assert.Equal(t, "pdf content", string(readShare(t, download)))
+
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{})
+	assert.ErrorContains(t, err, "download limit reached")
+
+	_, err = f.svc.Open(ctx, "no-such-token", ShareAccess{})
+	assert.ErrorContains(t, err, "not found")
+
+	expiring := time.Now().Add(time.Hour)
+	link = &ShareLink{FileID: doc, CreatedBy: 1, ExpiresAt: &expiring}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	f.svc.now = func() time.Time { return expiring.Add(time.Minute) }
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{})
+	assert.ErrorContains(t, err, "expired")
+}
+
+func TestShareLinkService_PasswordThrottling(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf content"))
+	now := time.Now()
+	f.svc.now = func() time.Time { return now }
+
+	err := f.svc.CreateLink(ctx, &ShareLink{FileID: doc, CreatedBy: 1, Password: "abc"})
+	assert.ErrorContains(t, err, "invalid share link")
+
+	link := &ShareLink{FileID: doc, CreatedBy: 1, Password: "open sesame"}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	assert.True(t, link.PasswordProtected)
+
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{})
+	assert.ErrorIs(t, err, ErrSharePasswordRequired)
+
+	// The first wrong passwords cost nothing, then each one locks the link
+	for i := 0; i < freeSharePasswordTries; i++ {
+		_, err = f.svc.Open(ctx, link.Token, ShareAccess{Password: "guess"})
+		assert.ErrorIs(t, err, ErrSharePasswordWrong)
+	}
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{Password: "guess"})
+	assert.ErrorIs(t, err, ErrSharePasswordWrong)
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{Password: "open sesame"})
+	var locked *ShareLinkLockedError
+	require.ErrorAs(t, err, &locked)
+	assert.True(t, locked.Until.Equal(now.Add(2*time.Second)))
+
+	now = now.Add(2 * time.Second)
+	download, err := f.svc.Open(ctx, link.Token, ShareAccess{Password: "open sesame"})
+	require.NoError(t, err)
+	assert.Equal(t, "pdf content", string(readShare(t, download)))
+	loaded, err := f.svc.GetLink(ctx, 1, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, loaded.FailedAttempts)
+	assert.Nil(t, loaded.LockedUntil)
+
+	var results []string
+	rows, err := f.db.QueryContext(ctx, `SELECT result FROM share_link_access_log WHERE share_link_id = ? ORDER BY id`, link.ID)
+	require.NoError(t, err)
+	for rows.Next() {
+		var result string
+		require.NoError(t, rows.Scan(&result))
+		results = append(results, result)
+	}
+	require.NoError(t, rows.Close())
+	assert.Len(t, results, 7)
+	assert.Equal(t, ErrSharePasswordRequired.Error(), results[0])
+}
+
+func TestShareLinkService_RevokesAfterFailedAttempts(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	doc := f.addFile(t, "notes.pdf", []byte("pdf content"))
+	now := time.Now()
+	f.svc.now = func() time.Time { return now }
+	f.svc.config.MaxFailedAttempts = 5
+
+	link := &ShareLink{FileID: doc, CreatedBy: 1, Password: "open sesame"}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	for i := 0; i < 5; i++ {
+		_, err := f.svc.Open(ctx, link.Token, ShareAccess{Password: "guess"})
+		assert.ErrorIs(t, err, ErrSharePasswordWrong)
+		now = now.Add(time.Hour)
+	}
+
+	_, err := f.svc.Open(ctx, link.Token, ShareAccess{Password: "open sesame"})
+	assert.ErrorContains(t, err, "not found")
+	var reason string
+	require.NoError(t, f.db.QueryRowContext(ctx, `SELECT revoked_reason FROM share_links WHERE id = ?`, link.ID).Scan(&reason))
+	assert.Equal(t, shareRevokedTooManyAttempts, reason)
+}
+
+func TestShareLockout(t *testing.T) {
+	assert.Equal(t, time.Duration(0), shareLockout(freeSharePasswordTries))
+	assert.Equal(t, 2*time.Second, shareLockout(freeSharePasswordTries+1))
+	assert.Equal(t, 16*time.Second, shareLockout(freeSharePasswordTries+4))
+	assert.Equal(t, maxShareLockout, shareLockout(freeSharePasswordTries+10))
+	assert.Equal(t, maxShareLockout, shareLockout(1000))
+}
+
+func TestShareLinkService_CachedImageWatermark(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, solidImage(320, 240)))
+	photo := f.addFile(t, "photo.png", src.Bytes())
+
+	link := &ShareLink{FileID: photo, CreatedBy: 1, Watermark: true, Label: "press"}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	assert.Equal(t, DefaultWatermarkText, link.WatermarkText)
+	assert.Equal(t, WatermarkModeCached, link.WatermarkMode)
+
+	ready := f.waitForWatermark(t, link.ID)
+	require.Equal(t, WatermarkStatusReady, ready.WatermarkStatus, ready.WatermarkError)
+
+	download, err := f.svc.Open(ctx, link.Token, ShareAccess{})
+	require.NoError(t, err)
+	assert.Equal(t, "photo.png", download.Name)
+	img, err := png.Decode(bytes.NewReader(readShare(t, download)))
+	require.NoError(t, err)
+	assert.Greater(t, changedPixels(img, img.Bounds()), 0)
+
+	text, err := f.svc.watermarkText(ctx, ready, ready.CreatedAt)
+	require.NoError(t, err)
+	assert.Contains(t, text, "alice ")
+
+	require.NoError(t, f.svc.RevokeLink(ctx, 1, link.ID))
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{})
+	assert.ErrorContains(t, err, "not found")
+	entries, err := os.ReadDir(f.cacheDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the watermarked copy is removed on revoke")
+
+	assert.ErrorContains(t, f.svc.RevokeLink(ctx, 2, link.ID), "not found", "only the creator can revoke")
+}
+
+func TestShareLinkService_LiveImageWatermark(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, solidImage(320, 240)))
+	photo := f.addFile(t, "photo.gif", src.Bytes())
+
+	link := &ShareLink{FileID: photo, CreatedBy: 1, Watermark: true, WatermarkMode: WatermarkModeLive,
+		WatermarkText: "{label} for {username}", Label: "review", WatermarkPosition: WatermarkTopLeft}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	assert.Empty(t, link.WatermarkStatus, "live links render nothing up front")
+
+	download, err := f.svc.Open(ctx, link.Token, ShareAccess{})
+	require.NoError(t, err)
+	assert.Equal(t, "photo.png", download.Name, "non-JPEG images are served as PNG")
+	assert.Equal(t, int64(len(readShare(t, download))), download.Size)
+
+	loaded, err := f.svc.GetLink(ctx, 1, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded.DownloadCount)
+	assert.NotNil(t, loaded.LastAccessedAt)
+}
+
+func TestShareLinkService_CachedVideoWatermark(t *testing.T) {
+	f := newShareLinkFixture(t)
+	ctx := context.Background()
+	argsFile := filepath.Join(t.TempDir(), "args")
+	// The fake ffmpeg records its arguments and writes to its last one
+	f.svc.watermarker.SetFFmpegBinary(writeFakeTool(t, "ffmpeg", `echo "$@" > "`+argsFile+`"
+for arg; do out="$arg"; done
+printf 'watermarked video' > "$out"
+`))
+	film := f.addFile(t, "film.mkv", []byte("original video"))
+
+	link := &ShareLink{FileID: film, CreatedBy: 1, Watermark: true, WatermarkPosition: WatermarkTopRight}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	ready := f.waitForWatermark(t, link.ID)
+	require.Equal(t, WatermarkStatusReady, ready.WatermarkStatus, ready.WatermarkError)
+
+	download, err := f.svc.Open(ctx, link.Token, ShareAccess{})
+	require.NoError(t, err)
+	assert.Equal(t, "film.mp4", download.Name)
+	assert.Equal(t, "watermarked video", string(readShare(t, download)))
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "drawtext=textfile=")
+	assert.Contains(t, string(args), "x=w-tw-h/40:y=h/40")
+
+	// A failed render is reported rather than retried on every download
+	f.svc.watermarker.SetFFmpegBinary(writeFakeTool(t, "ffmpeg", `echo "Unknown encoder 'libx264'" >&2
+exit 1
+`))
+	link = &ShareLink{FileID: film, CreatedBy: 1, Watermark: true}
+	require.NoError(t, f.svc.CreateLink(ctx, link))
+	failed := f.waitForWatermark(t, link.ID)
+	assert.Equal(t, WatermarkStatusFailed, failed.WatermarkStatus)
+	assert.Contains(t, failed.WatermarkError, "Unknown encoder")
+	_, err = f.svc.Open(ctx, link.Token, ShareAccess{})
+	assert.ErrorContains(t, err, "failed to prepare watermarked copy")
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"catalogizer/filesystem"
+	"catalogizer/models"
+
+	"go.uber.org/zap"
+)
+
+// Recycle-bin conventions of NAS shares and the clients that use them.
+// Their folders at the top of a storage root are kept out of the catalog
+// and shown in the share trash instead.
+const (
+	// ShareTrashSynology is the #recycle folder of Synology shares,
+	// which keeps the tree deleted files were in.
+	ShareTrashSynology = "synology"
+	// ShareTrashQNAP is the @Recycle folder of QNAP shares, which keeps
+	// the tree deleted files were in.
+	ShareTrashQNAP = "qnap"
+	// ShareTrashSamba is the .recycle folder of Samba's vfs_recycle
+	// module, set to keep the tree.
+	ShareTrashSamba = "samba"
+	// ShareTrashFreedesktop is the .Trash-<uid> or .Trash/<uid> folder
+	// Linux desktops keep on every volume, with the original path of
+	// each file in an info file.
+	ShareTrashFreedesktop = "freedesktop"
+	// ShareTrashWindows is the $RECYCLE.BIN folder Windows keeps on every
+	// volume, with the original path of each file in a $I file.
+	ShareTrashWindows = "windows"
+	// ShareTrashMacOS is the .Trashes folder macOS keeps on every
+	// volume, which records no original paths.
+	ShareTrashMacOS = "macos"
+)
+
+// maxShareTrashItems caps how many items a share trash listing walks.
+const maxShareTrashItems = 10000
+
+// shareTrashConvention returns the recycle-bin convention of a folder at
+// the top of a storage root, if it is a recycle bin.
+func shareTrashConvention(name string) (string, bool) {
+	switch {
+	case name == "#recycle":
+		return ShareTrashSynology, true
+	case name == "@Recycle":
+		return ShareTrashQNAP, true
+	case name == ".recycle":
+		return ShareTrashSamba, true
+	case name == ".Trash" || strings.HasPrefix(name, ".Trash-"):
+		return ShareTrashFreedesktop, true
+	case strings.EqualFold(name, "$RECYCLE.BIN"):
+		return ShareTrashWindows, true
+	case name == ".Trashes":
+		return ShareTrashMacOS, true
+	}
+	return "", false
+}
+
+// ShareTrashItem is a file or directory in a recycle bin of a storage
+// root, put there by the NAS or a client rather than by Catalogizer.
+type ShareTrashItem struct {
+	StorageRoot string `json:"storage_root"`
+	Convention  string `json:"convention"`
+	TrashPath   string `json:"trash_path"`
+	// OriginalPath is where the item was deleted from, empty when the
+	// recycle bin does not record it
+	OriginalPath string     `json:"original_path,omitempty"`
+	Restorable   bool       `json:"restorable"`
+	IsDirectory  bool       `json:"is_directory"`
+	Size         int64      `json:"size"`
+	ModifiedAt   time.Time  `json:"modified_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ShareTrashListing is what the recycle bins of a storage root hold.
+type ShareTrashListing struct {
+	StorageRoot string           `json:"storage_root"`
+	Items       []ShareTrashItem `json:"items"`
+	// Truncated is set when there were more than maxShareTrashItems
+	Truncated bool `json:"truncated"`
+}
+
+// ListShareTrash returns what the recycle bins of a storage root hold,
+// by trash path. Bins that keep the tree list every file in it; others
+// list what was deleted.
+func (o *FileOperations) ListShareTrash(ctx context.Context, storageRoot string) (*ShareTrashListing, error) {
+	root, provider, err := o.connect(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	entries, err := provider.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", root.Name, err)
+	}
+	listing := &ShareTrashListing{StorageRoot: root.Name, Items: []ShareTrashItem{}}
+	for _, e := range entries {
+		convention, ok := shareTrashConvention(e.Name)
+		if !ok || !e.IsDir {
+			continue
+		}
+		if err := o.listShareTrashBin(ctx, provider, root, convention, e.Name, listing); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(listing.Items, func(i, j int) bool { return listing.Items[i].TrashPath < listing.Items[j].TrashPath })
+	return listing, nil
+}
+
+func (o *FileOperations) listShareTrashBin(ctx context.Context, provider StorageProvider, root *models.StorageRoot,
+	convention, bin string, listing *ShareTrashListing) error {
+	add := func(trashPath string, info *filesystem.FileInfo) bool {
+		if len(listing.Items) >= maxShareTrashItems {
+			listing.Truncated = true
+			return false
+		}
+		listing.Items = append(listing.Items, describeShareTrashItem(ctx, provider, root, convention, trashPath, info))
+		return true
+	}
+	list := func(dir string) []*filesystem.FileInfo {
+		entries, err := provider.List(ctx, dir)
+		if err != nil {
+			o.logger.Warn("Failed to list share trash",
+				zap.String("storage_root", root.Name), zap.String("path", dir), zap.Error(err))
+			return nil
+		}
+		return entries
+	}
+
+	switch convention {
+	case ShareTrashFreedesktop:
+		// .Trash-<uid>/files, or .Trash/<uid>/files
+		dirs := []string{bin}
+		if bin == ".Trash" {
+			dirs = nil
+			for _, e := range list(bin) {
+				if e.IsDir {
+					dirs = append(dirs, path.Join(bin, e.Name))
+				}
+			}
+		}
+		for _, dir := range dirs {
+			for _, e := range list(path.Join(dir, "files")) {
+				if !add(path.Join(dir, "files", e.Name), e) {
+					return nil
+				}
+			}
+		}
+	case ShareTrashWindows:
+		// $RECYCLE.BIN/<SID>/$R..., beside the $I... file describing it
+		for _, sid := range list(bin) {
+			if !sid.IsDir {
+				continue
+			}
+			for _, e := range list(path.Join(bin, sid.Name)) {
+				if strings.HasPrefix(e.Name, "$R") && !add(path.Join(bin, sid.Name, e.Name), e) {
+					return nil
+				}
+			}
+		}
+	default:
+		var walk func(dir string) bool
+		walk = func(dir string) bool {
+			for _, e := range list(dir) {
+				p := path.Join(dir, e.Name)
+				if e.IsDir {
+					if !walk(p) {
+						return false
+					}
+				} else if !add(p, e) {
+					return false
+				}
+			}
+			return ctx.Err() == nil
+		}
+		walk(bin)
+	}
+	return ctx.Err()
+}
+
+// describeShareTrashItem returns a share trash item, with its original
+// path where the recycle bin records one.
+func describeShareTrashItem(ctx context.Context, provider StorageProvider, root *models.StorageRoot,
+	convention, trashPath string, info *filesystem.FileInfo) ShareTrashItem {
+	item := ShareTrashItem{
+		StorageRoot: root.Name,
+		Convention:  convention,
+		TrashPath:   trashPath,
+		IsDirectory: info.IsDir,
+		Size:        info.Size,
+		ModifiedAt:  info.ModTime,
+	}
+	parts := strings.Split(trashPath, "/")
+
+	switch convention {
+	case ShareTrashSynology, ShareTrashQNAP, ShareTrashSamba:
+		if len(parts) > 1 {
+			item.OriginalPath = strings.Join(parts[1:], "/")
+		}
+	case ShareTrashFreedesktop:
+		dir, name := path.Split(trashPath)
+		infoPath := path.Join(path.Dir(path.Clean(dir)), "info", name+".trashinfo")
+		original, deletedAt, err := readTrashInfo(ctx, provider, infoPath)
+		if err == nil {
+			item.OriginalPath = rootRelativePath(root, original)
+			item.DeletedAt = deletedAt
+		}
+	case ShareTrashWindows:
+		dir, name := path.Split(trashPath)
+		original, size, deletedAt, err := readRecycleBinInfo(ctx, provider, dir+"$I"+strings.TrimPrefix(name, "$R"))
+		if err == nil {
+			item.OriginalPath = windowsRootRelativePath(original)
+			item.DeletedAt = &deletedAt
+			if !item.IsDirectory {
+				item.Size = size
+			}
+		}
+	}
+	item.OriginalPath = restorablePath(item.OriginalPath)
+	item.Restorable = item.OriginalPath != ""
+	return item
+}
+
+// restorablePath returns a path a recycle bin recorded, or nothing when
+// it is not somewhere on the root a file can be restored to.
+func restorablePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	p = path.Clean(p)
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "/") {
+		return ""
+	}
+	top, _, _ := strings.Cut(p, "/")
+	if _, ok := shareTrashConvention(top); ok || top == TrashDirName {
+		return ""
+	}
+	return p
+}
+
+// rootRelativePath returns a path a recycle bin recorded relative to the
+// storage root. Absolute paths are only understood on local roots.
+func rootRelativePath(root *models.StorageRoot, p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return p
+	}
+	if root.Protocol != "local" || root.Path == nil {
+		return ""
+	}
+	base := strings.TrimSuffix(path.Clean(*root.Path), "/")
+	if !strings.HasPrefix(p, base+"/") {
+		return ""
+	}
+	return strings.TrimPrefix(p, base+"/")
+}
+
+// windowsRootRelativePath returns a path Windows recorded, such as
+// D:\Films\a.mkv, relative to the volume the storage root is the top of.
+func windowsRootRelativePath(p string) string {
+	if len(p) < 3 || p[1] != ':' || p[2] != '\\' {
+		return ""
+	}
+	return strings.ReplaceAll(p[3:], `\`, "/")
+}
+
+// readTrashInfo reads the original path and deletion date of a
+// freedesktop.org trash info file.
+func readTrashInfo(ctx context.Context, provider StorageProvider, infoPath string) (string, *time.Time, error) {
+	r, err := provider.Open(ctx, infoPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	var original string
+	var deletedAt *time.Time
+	scanner := bufio.NewScanner(io.LimitReader(r, 64*1024))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			if original, err = url.PathUnescape(value); err != nil {
+				return "", nil, fmt.Errorf("invalid trash info path %q: %w", value, err)
+			}
+		case "DeletionDate":
+			if t, err := time.ParseInLocation("2006-01-02T15:04:05", value, time.Local); err == nil {
+				deletedAt = &t
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	if original == "" {
+		return "", nil, fmt.Errorf("trash info %s has no path", infoPath)
+	}
+	return original, deletedAt, nil
+}
+
+// windowsEpochOffset is the number of 100ns intervals from 1601, the
+// epoch of Windows FILETIMEs, to 1970.
+const windowsEpochOffset = 116444736000000000
+
+// readRecycleBinInfo reads the original path, size and deletion time of
+// a Windows recycle bin $I file: a version, the size and a FILETIME as
+// little-endian 64-bit integers, then the path in UTF-16, 260 characters
+// long in version 1 and preceded by its length from version 2.
+func readRecycleBinInfo(ctx context.Context, provider StorageProvider, infoPath string) (string, int64, time.Time, error) {
+	r, err := provider.Open(ctx, infoPath)
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, 64*1024))
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+	if len(data) < 24 {
+		return "", 0, time.Time{}, fmt.Errorf("recycle bin info %s is too short", infoPath)
+	}
+
+	version := binary.LittleEndian.Uint64(data[0:8])
+	size := int64(binary.LittleEndian.Uint64(data[8:16]))
+	filetime := int64(binary.LittleEndian.Uint64(data[16:24]))
+	var name []byte
+	switch version {
+	case 1:
+		name = data[24:]
+	case 2:
+		if len(data) < 28 {
+			return "", 0, time.Time{}, fmt.Errorf("recycle bin info %s is too short", infoPath)
+		}
+		name = data[28:]
+		if n := int(binary.LittleEndian.Uint32(data[24:28])) * 2; n < len(name) {
+			name = name[:n]
+		}
+	default:
+		return "", 0, time.Time{}, fmt.Errorf("recycle bin info %s has unknown version %d", infoPath, version)
+	}
+
+	units := make([]uint16, 0, len(name)/2)
+	for i := 0; i+1 < len(name); i += 2 {
+		u := binary.LittleEndian.Uint16(name[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	deletedAt := time.Unix(0, (filetime-windowsEpochOffset)*100)
+	return string(utf16.Decode(units)), size, deletedAt, nil
+}
+
+// RestoreShareTrash moves an item of a storage root's recycle bins back
+// to where it was deleted from, which must be free again, and removes
+// what the bin recorded about it. The next scan catalogs it.
+func (o *FileOperations) RestoreShareTrash(ctx context.Context, actor FileActor, storageRoot, trashPath string) (*ShareTrashItem, error) {
+	p := strings.TrimPrefix(path.Clean("/"+trashPath), "/")
+	bin, _, _ := strings.Cut(p, "/")
+	convention, ok := shareTrashConvention(bin)
+	if !ok || p == bin {
+		return nil, fmt.Errorf("invalid path: %s is not in a share trash", trashPath)
+	}
+	root, provider, err := o.connect(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	info, err := statExisting(ctx, provider, root.Name, p)
+	if err != nil {
+		return nil, err
+	}
+	item := describeShareTrashItem(ctx, provider, root, convention, p, info)
+	if !item.Restorable {
+		return nil, fmt.Errorf("%s cannot be restored: the %s recycle bin does not record where it was, or it was outside the root", p, convention)
+	}
+	if exists, err := provider.Exists(ctx, item.OriginalPath); err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", item.OriginalPath, err)
+	} else if exists {
+		return nil, fmt.Errorf("%s already exists in %s", item.OriginalPath, root.Name)
+	}
+	if err := moveWithinRoot(ctx, provider, p, item.OriginalPath, item.IsDirectory); err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", item.OriginalPath, err)
+	}
+
+	// What the bin knew about the item would describe nothing now
+	dir, name := path.Split(p)
+	switch convention {
+	case ShareTrashFreedesktop:
+		provider.Delete(ctx, path.Join(path.Dir(path.Clean(dir)), "info", name+".trashinfo"))
+	case ShareTrashWindows:
+		provider.Delete(ctx, dir+"$I"+strings.TrimPrefix(name, "$R"))
+	}
+
+	o.logger.Info("Restored file from share trash",
+		zap.String("storage_root", root.Name),
+		zap.String("convention", convention),
+		zap.String("path", item.OriginalPath),
+		zap.Int("user_id", actor.UserID))
+	o.recordAudit(ctx, actor, AuditEventShareTrashRestored, map[string]interface{}{
+		"storage_root": root.Name,
+		"convention":   convention,
+		"trash_path":   p,
+		"path":         item.OriginalPath,
+		"is_directory": item.IsDirectory,
+	})
+	return &item, nil
+}
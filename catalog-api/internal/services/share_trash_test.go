@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (f *fileOperationsFixture) write(t *testing.T, name string, data []byte) {
+	t.Helper()
+	full := filepath.Join(f.dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+	require.NoError(t, os.WriteFile(full, data, 0644))
+}
+
+// recycleBinInfo encodes a version 2 Windows $I file.
+func recycleBinInfo(original string, size int64, deletedAt time.Time) []byte {
+	name := append(utf16.Encode([]rune(original)), 0)
+	data := make([]byte, 28, 28+2*len(name))
+	binary.LittleEndian.PutUint64(data[0:], 2)
+	binary.LittleEndian.PutUint64(data[8:], uint64(size))
+	binary.LittleEndian.PutUint64(data[16:], uint64(deletedAt.UnixNano()/100+windowsEpochOffset))
+	binary.LittleEndian.PutUint32(data[24:], uint32(len(name)))
+	for _, u := range name {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+func TestFileOperations_ListShareTrash(t *testing.T) {
+	f := newFileOperationsFixture(t)
+	deletedAt := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	f.write(t, "films/kept.mkv", []byte("kept"))
+	f.write(t, "#recycle/films/old.mkv", []byte("old"))
+	f.write(t, ".Trash-1000/files/notes.txt", []byte("notes"))
+	f.write(t, ".Trash-1000/info/notes.txt.trashinfo",
+		[]byte("[Trash Info]\nPath=docs/my%20notes.txt\nDeletionDate=2026-10-01T08:00:00\n"))
+	f.write(t, "$RECYCLE.BIN/S-1-5-21/$RAB12CD.mkv", []byte("win"))
+	f.write(t, "$RECYCLE.BIN/S-1-5-21/$IAB12CD.mkv", recycleBinInfo(`D:\films\win.mkv`, 3, deletedAt))
+	f.write(t, ".Trashes/501/mac.mkv", []byte("mac"))
+
+	listing, err := f.ops.ListShareTrash(context.Background(), "media")
+	require.NoError(t, err)
+	assert.False(t, listing.Truncated)
+	require.Len(t, listing.Items, 4)
+
+	byPath := make(map[string]ShareTrashItem)
+	for _, item := range listing.Items {
+		byPath[item.TrashPath] = item
+	}
+	assert.Equal(t, "films/old.mkv", byPath["#recycle/films/old.mkv"].OriginalPath)
+	assert.Equal(t, ShareTrashSynology, byPath["#recycle/films/old.mkv"].Convention)
+
+	notes := byPath[".Trash-1000/files/notes.txt"]
+	assert.Equal(t, "docs/my notes.txt", notes.OriginalPath)
+	require.NotNil(t, notes.DeletedAt)
+
+	win := byPath["$RECYCLE.BIN/S-1-5-21/$RAB12CD.mkv"]
+	assert.Equal(t, "films/win.mkv", win.OriginalPath)
+	assert.True(t, win.Restorable)
+	require.NotNil(t, win.DeletedAt)
+	assert.True(t, deletedAt.Equal(*win.DeletedAt))
+
+	mac := byPath[".Trashes/501/mac.mkv"]
+	assert.Equal(t, ShareTrashMacOS, mac.Convention)
+	assert.False(t, mac.Restorable)
+}
+
+func TestFileOperations_RestoreShareTrash(t *testing.T) {
+	f := newFileOperationsFixture(t)
+	ctx := context.Background()
+	f.write(t, "#recycle/films/old.mkv", []byte("old"))
+	f.write(t, ".Trash-1000/files/notes.txt", []byte("notes"))
+	f.write(t, ".Trash-1000/info/notes.txt.trashinfo", []byte("[Trash Info]\nPath=notes.txt\n"))
+	f.write(t, "$RECYCLE.BIN/S-1-5-21/$RAB12CD.mkv", []byte("win"))
+	f.write(t, "$RECYCLE.BIN/S-1-5-21/$IAB12CD.mkv", recycleBinInfo(`D:\win.mkv`, 3, time.Now()))
+	f.write(t, ".Trashes/501/mac.mkv", []byte("mac"))
+
+	item, err := f.ops.RestoreShareTrash(ctx, f.actor, "media", "#recycle/films/old.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, "films/old.mkv", item.OriginalPath)
+	data, err := os.ReadFile(filepath.Join(f.dir, "films", "old.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	_, err = f.ops.RestoreShareTrash(ctx, f.actor, "media", ".Trash-1000/files/notes.txt")
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(f.dir, "notes.txt"))
+	assert.NoFileExists(t, filepath.Join(f.dir, ".Trash-1000", "info", "notes.txt.trashinfo"))
+
+	_, err = f.ops.RestoreShareTrash(ctx, f.actor, "media", "$RECYCLE.BIN/S-1-5-21/$RAB12CD.mkv")
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(f.dir, "win.mkv"))
+	assert.NoFileExists(t, filepath.Join(f.dir, "$RECYCLE.BIN", "S-1-5-21", "$IAB12CD.mkv"))
+	assert.Equal(t, 3, f.audits(t, AuditEventShareTrashRestored))
+
+	_, err = f.ops.RestoreShareTrash(ctx, f.actor, "media", ".Trashes/501/mac.mkv")
+	assert.ErrorContains(t, err, "cannot be restored")
+	_, err = f.ops.RestoreShareTrash(ctx, f.actor, "media", "films/old.mkv")
+	assert.ErrorContains(t, err, "invalid path")
+
+	f.write(t, "#recycle/win.mkv", []byte("again"))
+	_, err = f.ops.RestoreShareTrash(ctx, f.actor, "media", "#recycle/win.mkv")
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestScannerService_SkipsShareTrash(t *testing.T) {
+	f := newScannerFixture(t)
+	f.write(t, "a.mkv", "aaaa")
+	f.write(t, "#recycle/b.mkv", "bbbb")
+	f.write(t, "$RECYCLE.BIN/S-1-5-21/$RAB12CD.mkv", "cccc")
+
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.True(t, f.cataloged(t, "a.mkv"))
+	assert.False(t, f.cataloged(t, "#recycle"))
+	assert.False(t, f.cataloged(t, "$RECYCLE.BIN"))
+}
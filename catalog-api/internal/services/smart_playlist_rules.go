@@ -0,0 +1,402 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SmartPlaylistPreset is a named rule PlaylistConfig.SmartPlaylistRules
+// may list instead of a rule expression.
+type SmartPlaylistPreset struct {
+	Name string
+	Rule string
+}
+
+// SmartPlaylistPresets are the smart playlists known by name.
+var SmartPlaylistPresets = map[string]SmartPlaylistPreset{
+	"recently_added":  {Name: "Recently Added", Rule: "added<30d"},
+	"recently_played": {Name: "Recently Played", Rule: "watched<30d"},
+	"top_rated":       {Name: "Top Rated", Rule: "rating>=8"},
+	"favorites":       {Name: "Favorites", Rule: "favorite=true"},
+}
+
+type smartFieldKind int
+
+const (
+	smartFieldText smartFieldKind = iota
+	smartFieldNumber
+	smartFieldDate
+	smartFieldBool
+)
+
+type smartField struct {
+	column string
+	kind   smartFieldKind
+}
+
+// smartPlaylistFields maps rule fields to catalog columns. mi is
+// media_items, mt its media type and um the playlist owner's
+// user_metadata row.
+var smartPlaylistFields = map[string]smartField{
+	"title":     {"mi.title", smartFieldText},
+	"genre":     {"mi.genre", smartFieldText},
+	"director":  {"mi.director", smartFieldText},
+	"language":  {"mi.language", smartFieldText},
+	"country":   {"mi.country", smartFieldText},
+	"status":    {"mi.status", smartFieldText},
+	"type":      {"mt.name", smartFieldText},
+	"year":      {"mi.year", smartFieldNumber},
+	"rating":    {"mi.rating", smartFieldNumber},
+	"runtime":   {"mi.runtime", smartFieldNumber},
+	"my_rating": {"um.user_rating", smartFieldNumber},
+	"added":     {"mi.first_detected", smartFieldDate},
+	"watched":   {"um.watched_date", smartFieldDate},
+	"favorite":  {"um.favorite", smartFieldBool},
+}
+
+var smartPlaylistOperators = []string{"<=", ">=", "!=", "!~", "=", "<", ">", "~"}
+
+// smartAgeUnits are the units of relative dates such as 30d.
+var smartAgeUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'm': 30 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// SmartPlaylistRule is a parsed smart playlist rule.
+type SmartPlaylistRule struct {
+	root smartNode
+}
+
+// ParseSmartPlaylistRule parses a smart playlist rule: conditions joined
+// with AND, OR and NOT, grouped with parentheses. A condition compares a
+// field with a value:
+//
+//	genre=jazz AND added<30d
+//	(type=movie OR type=tv_show) AND rating>=7.5 AND NOT watched<1y
+//	title~"live at" AND year>=1990
+//
+// Text fields (title, genre, director, language, country, status, type)
+// take = and != ignoring case, and ~ and !~ for contains. Number fields
+// (year, rating, runtime, my_rating) take =, !=, <, <=, > and >=. Date
+// fields (added, watched) take an age such as 12h, 30d, 2w, 6m or 1y,
+// where added<30d means added less than 30 days ago, or a YYYY-MM-DD
+// date compared directly. favorite takes true or false. Values with
+// spaces or operator characters are quoted.
+func ParseSmartPlaylistRule(input string) (*SmartPlaylistRule, error) {
+	tokens, err := tokenizeSmartRule(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("invalid rule: rule is empty")
+	}
+	p := &smartRuleParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q, expected AND or OR", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule: %w", err)
+	}
+	return &SmartPlaylistRule{root: root}, nil
+}
+
+// ResolveSmartPlaylistRule returns the rule for a preset name, or the
+// input itself when it is not one.
+func ResolveSmartPlaylistRule(rule string) string {
+	if preset, ok := SmartPlaylistPresets[strings.TrimSpace(rule)]; ok {
+		return preset.Rule
+	}
+	return rule
+}
+
+// where compiles the rule to a SQL condition with its arguments. Relative
+// dates are measured back from now.
+func (r *SmartPlaylistRule) where(now time.Time) (string, []interface{}) {
+	var args []interface{}
+	sql := r.root.sql(now.UTC(), &args)
+	return sql, args
+}
+
+type smartNode interface {
+	sql(now time.Time, args *[]interface{}) string
+}
+
+type smartAnd struct{ left, right smartNode }
+type smartOr struct{ left, right smartNode }
+type smartNot struct{ node smartNode }
+
+func (n smartAnd) sql(now time.Time, args *[]interface{}) string {
+	return "(" + n.left.sql(now, args) + " AND " + n.right.sql(now, args) + ")"
+}
+
+func (n smartOr) sql(now time.Time, args *[]interface{}) string {
+	return "(" + n.left.sql(now, args) + " OR " + n.right.sql(now, args) + ")"
+}
+
+// A condition on a missing value is unknown rather than false, so NOT
+// treats it as false: NOT watched<1y includes items never watched.
+func (n smartNot) sql(now time.Time, args *[]interface{}) string {
+	return "NOT COALESCE(" + n.node.sql(now, args) + ", FALSE)"
+}
+
+// smartCondition is one field comparison with its value already checked
+// against the field's kind.
+type smartCondition struct {
+	field smartField
+	op    string
+	text  string
+	num   float64
+	age   time.Duration
+	date  time.Time
+	flag  bool
+}
+
+func (c smartCondition) sql(now time.Time, args *[]interface{}) string {
+	col := c.field.column
+	switch c.field.kind {
+	case smartFieldText:
+		switch c.op {
+		case "=":
+			*args = append(*args, strings.ToLower(c.text))
+			return "LOWER(" + col + ") = ?"
+		case "!=":
+			*args = append(*args, strings.ToLower(c.text))
+			return "COALESCE(LOWER(" + col + "), '') <> ?"
+		case "~":
+			*args = append(*args, "%"+strings.ToLower(c.text)+"%")
+			return "LOWER(" + col + ") LIKE ?"
+		default: // !~
+			*args = append(*args, "%"+strings.ToLower(c.text)+"%")
+			return "COALESCE(LOWER(" + col + "), '') NOT LIKE ?"
+		}
+	case smartFieldNumber:
+		*args = append(*args, c.num)
+		if c.op == "!=" {
+			return "(" + col + " IS NULL OR " + col + " <> ?)"
+		}
+		return col + " " + c.op + " ?"
+	case smartFieldDate:
+		if c.age > 0 {
+			// An age turns the comparison around: younger than 30 days
+			// is later than 30 days ago
+			flipped := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+			*args = append(*args, now.Add(-c.age))
+			return col + " " + flipped[c.op] + " ?"
+		}
+		*args = append(*args, c.date)
+		return col + " " + c.op + " ?"
+	default:
+		*args = append(*args, false, c.flag)
+		if c.op == "!=" {
+			return "COALESCE(" + col + ", ?) <> ?"
+		}
+		return "COALESCE(" + col + ", ?) = ?"
+	}
+}
+
+func newSmartCondition(name, op, value string) (smartCondition, error) {
+	field, ok := smartPlaylistFields[strings.ToLower(name)]
+	if !ok {
+		return smartCondition{}, fmt.Errorf("unknown field %q", name)
+	}
+	c := smartCondition{field: field, op: op}
+	invalidOp := fmt.Errorf("operator %s cannot be used with %s", op, name)
+
+	switch field.kind {
+	case smartFieldText:
+		if op != "=" && op != "!=" && op != "~" && op != "!~" {
+			return c, invalidOp
+		}
+		c.text = value
+	case smartFieldNumber:
+		if op == "~" || op == "!~" {
+			return c, invalidOp
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c, fmt.Errorf("%s needs a number, got %q", name, value)
+		}
+		c.num = n
+	case smartFieldDate:
+		if op != "<" && op != "<=" && op != ">" && op != ">=" {
+			return c, invalidOp
+		}
+		if age, ok := parseSmartAge(value); ok {
+			c.age = age
+		} else if t, err := time.Parse("2006-01-02", value); err == nil {
+			c.date = t
+		} else {
+			return c, fmt.Errorf("%s needs an age such as 30d or a YYYY-MM-DD date, got %q", name, value)
+		}
+	case smartFieldBool:
+		if op != "=" && op != "!=" {
+			return c, invalidOp
+		}
+		switch strings.ToLower(value) {
+		case "true", "yes", "1":
+			c.flag = true
+		case "false", "no", "0":
+		default:
+			return c, fmt.Errorf("%s needs true or false, got %q", name, value)
+		}
+	}
+	return c, nil
+}
+
+// parseSmartAge parses ages such as 12h, 30d, 2w, 6m and 1y.
+func parseSmartAge(value string) (time.Duration, bool) {
+	value = strings.ToLower(value)
+	if len(value) < 2 {
+		return 0, false
+	}
+	unit, ok := smartAgeUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+type smartToken struct {
+	text   string
+	quoted bool
+	op     bool
+}
+
+// tokenizeSmartRule splits a rule into words, quoted values, operators
+// and parentheses.
+func tokenizeSmartRule(input string) ([]smartToken, error) {
+	var tokens []smartToken
+	for i := 0; i < len(input); {
+		ch := input[i]
+		switch {
+		case unicode.IsSpace(rune(ch)):
+			i++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, smartToken{text: string(ch)})
+			i++
+		case ch == '"' || ch == '\'':
+			end := strings.IndexByte(input[i+1:], ch)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			tokens = append(tokens, smartToken{text: input[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.IndexByte("=!<>~", ch) >= 0:
+			op := ""
+			for _, candidate := range smartPlaylistOperators {
+				if strings.HasPrefix(input[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unknown operator at %q", input[i:])
+			}
+			tokens = append(tokens, smartToken{text: op, op: true})
+			i += len(op)
+		default:
+			start := i
+			for i < len(input) && !unicode.IsSpace(rune(input[i])) && strings.IndexByte("()\"'=!<>~", input[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, smartToken{text: input[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type smartRuleParser struct {
+	tokens []smartToken
+	pos    int
+}
+
+func (p *smartRuleParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if !t.quoted && !t.op && strings.EqualFold(t.text, word) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *smartRuleParser) parseOr() (smartNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = smartOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *smartRuleParser) parseAnd() (smartNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = smartAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *smartRuleParser) parseFactor() (smartNode, error) {
+	if p.keyword("not") {
+		node, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return smartNot{node}, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("rule ends early, expected a condition")
+	}
+	if t := p.tokens[p.pos]; t.text == "(" && !t.quoted {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].text != ")" || p.tokens[p.pos].quoted {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("incomplete condition %q, expected field, operator and value", p.tokens[p.pos].text)
+	}
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.quoted || field.op || !op.op || value.op || (!value.quoted && (value.text == "(" || value.text == ")")) {
+		return nil, fmt.Errorf("expected a condition such as genre=jazz at %q", field.text)
+	}
+	p.pos += 3
+	c, err := newSmartCondition(field.text, op.text, value.text)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
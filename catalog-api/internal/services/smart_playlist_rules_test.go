@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSmartPlaylistRule(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule  string
+		where string
+		args  []interface{}
+	}{
+		{"genre=jazz AND added<30d", "(LOWER(mi.genre) = ? AND mi.first_detected > ?)",
+			[]interface{}{"jazz", now.AddDate(0, 0, -30)}},
+		{"genre = 'Free Jazz' or GENRE=bebop", "(LOWER(mi.genre) = ? OR LOWER(mi.genre) = ?)",
+			[]interface{}{"free jazz", "bebop"}},
+		{`title~"live at"`, "LOWER(mi.title) LIKE ?", []interface{}{"%live at%"}},
+		{"(type=movie OR type=tv_show) AND rating>=7.5",
+			"((LOWER(mt.name) = ? OR LOWER(mt.name) = ?) AND mi.rating >= ?)",
+			[]interface{}{"movie", "tv_show", 7.5}},
+		{"NOT watched<1y", "NOT COALESCE(um.watched_date > ?, FALSE)", []interface{}{now.AddDate(0, 0, -365)}},
+		{"added>=2024-01-01", "mi.first_detected >= ?", []interface{}{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"favorite=yes", "COALESCE(um.favorite, ?) = ?", []interface{}{false, true}},
+		{"year!=1999", "(mi.year IS NULL OR mi.year <> ?)", []interface{}{1999.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := ParseSmartPlaylistRule(tt.rule)
+			require.NoError(t, err)
+			where, args := rule.where(now)
+			assert.Equal(t, tt.where, where)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
+
+func TestParseSmartPlaylistRule_Precedence(t *testing.T) {
+	rule, err := ParseSmartPlaylistRule("genre=jazz OR genre=blues AND year<1970")
+	require.NoError(t, err)
+	where, _ := rule.where(time.Now())
+	assert.Equal(t, "(LOWER(mi.genre) = ? OR (LOWER(mi.genre) = ? AND mi.year < ?))", where)
+}
+
+func TestParseSmartPlaylistRule_Errors(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr string
+	}{
+		{"", "rule is empty"},
+		{"mood=happy", "unknown field"},
+		{"genre<jazz", "operator < cannot be used with genre"},
+		{"year=recent", "needs a number"},
+		{"added=30d", "operator = cannot be used with added"},
+		{"added<soon", "needs an age"},
+		{"favorite=maybe", "needs true or false"},
+		{"genre=jazz year>2000", "expected AND or OR"},
+		{"(genre=jazz", "missing )"},
+		{"genre=jazz AND", "rule ends early"},
+		{"genre=", "incomplete condition"},
+		{`title="live`, "unterminated quote"},
+		{"genre=!jazz", "unknown operator"},
+		{"genre=(jazz)", "expected a condition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, err := ParseSmartPlaylistRule(tt.rule)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid rule")
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestResolveSmartPlaylistRule(t *testing.T) {
+	assert.Equal(t, "rating>=8", ResolveSmartPlaylistRule("top_rated"))
+	assert.Equal(t, "genre=jazz", ResolveSmartPlaylistRule("genre=jazz"))
+	for key, preset := range SmartPlaylistPresets {
+		_, err := ParseSmartPlaylistRule(preset.Rule)
+		assert.NoError(t, err, key)
+	}
+}
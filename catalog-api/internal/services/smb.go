@@ -1,6 +1,7 @@
 package services
 
 import (
+	"catalogizer/filesystem"
 	"catalogizer/internal/config"
 	"catalogizer/internal/models"
 	"context"
@@ -60,17 +61,25 @@ func (s *SMBService) getConnection(hostName string) (*smb2.Session, error) {
 		return nil, fmt.Errorf("SMB host not found: %s", hostName)
 	}
 
-	conn, err := net.Dial("tcp", net.JoinHostPort(smbHost.Host, fmt.Sprintf("%d", smbHost.Port)))
+	opts := smbHostProtocolOptions(smbHost)
+	d, err := filesystem.NewSmbDialer(smbHost.Username, smbHost.Password, smbHost.Domain, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to SMB host: %w", err)
+		return nil, fmt.Errorf("invalid SMB settings for host %s: %w", hostName, err)
 	}
 
-	d := &smb2.Dialer{
-		Initiator: &smb2.NTLMInitiator{
-			User:     smbHost.Username,
-			Password: smbHost.Password,
-			Domain:   smbHost.Domain,
-		},
+	addr := net.JoinHostPort(smbHost.Host, fmt.Sprintf("%d", smbHost.Port))
+	if opts.RequireEncryption {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.SMB.Timeout)*time.Second)
+		_, err := filesystem.ProbeSmbServer(ctx, addr, opts)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMB host: %w", err)
 	}
 
 	session, err := d.Dial(conn)
@@ -82,6 +91,16 @@ func (s *SMBService) getConnection(hostName string) (*smb2.Session, error) {
 	return session, nil
 }
 
+// smbHostProtocolOptions returns the dialect and signing settings of a
+// configured host
+func smbHostProtocolOptions(host *config.SMBHost) filesystem.SmbProtocolOptions {
+	return filesystem.SmbProtocolOptions{
+		Dialect:           host.Dialect,
+		RequireSigning:    host.RequireSigning,
+		RequireEncryption: host.RequireEncryption,
+	}
+}
+
 func (s *SMBService) ListFiles(hostName, path string) ([]os.FileInfo, error) {
 	session, err := s.getConnection(hostName)
 	if err != nil {
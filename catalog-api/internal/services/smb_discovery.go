@@ -1,6 +1,7 @@
 package services
 
 import (
+	"catalogizer/filesystem"
 	"context"
 	"fmt"
 	"net"
@@ -37,6 +38,14 @@ type SMBConnectionConfig struct {
 	Username string  `json:"username"`
 	Password string  `json:"password"`
 	Domain   *string `json:"domain"`
+
+	filesystem.SmbProtocolOptions
+}
+
+// dialer returns an SMB dialer for the connection's credentials and
+// protocol options
+func (c SMBConnectionConfig) dialer() (*smb2.Dialer, error) {
+	return filesystem.NewSmbDialer(c.Username, c.Password, getStringValue(c.Domain), c.SmbProtocolOptions)
 }
 
 // SMBDiscoveryService provides SMB share discovery and testing
@@ -176,32 +185,45 @@ func (s *SMBDiscoveryService) getCommonShares(ctx context.Context, host, usernam
 
 // TestConnection tests an SMB connection with the provided credentials
 func (s *SMBDiscoveryService) TestConnection(ctx context.Context, config SMBConnectionConfig) bool {
+	_, err := s.ProbeConnection(ctx, config)
+	return err == nil
+}
+
+// ProbeConnection signs in to an SMB share and lists its root, reporting
+// the dialect and capabilities the server agreed to.
+func (s *SMBDiscoveryService) ProbeConnection(ctx context.Context, config SMBConnectionConfig) (*filesystem.SmbServerInfo, error) {
 	s.logger.Info("Testing SMB connection",
 		zap.String("host", config.Host),
 		zap.String("share", config.Share),
 		zap.String("username", config.Username))
 
+	d, err := config.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(config.Host, fmt.Sprintf("%d", config.Port))
+	probeCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	info, err := filesystem.ProbeSmbServer(probeCtx, addr, config.SmbProtocolOptions)
+	cancel()
+	if err != nil {
+		s.logger.Debug("SMB negotiation failed", zap.String("host", config.Host), zap.Error(err))
+		return nil, err
+	}
+
 	// Establish connection
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(config.Host, fmt.Sprintf("%d", config.Port)), s.timeout)
+	conn, err := net.DialTimeout("tcp", addr, s.timeout)
 	if err != nil {
 		s.logger.Debug("Failed to connect to SMB host", zap.String("host", config.Host), zap.Error(err))
-		return false
+		return nil, fmt.Errorf("failed to connect to SMB host %s: %w", config.Host, err)
 	}
 	defer conn.Close()
 
 	// Create SMB session
-	d := &smb2.Dialer{
-		Initiator: &smb2.NTLMInitiator{
-			User:     config.Username,
-			Password: config.Password,
-			Domain:   getStringValue(config.Domain),
-		},
-	}
-
-	session, err := d.Dial(conn)
+	session, err := d.DialContext(ctx, conn)
 	if err != nil {
 		s.logger.Debug("Failed to create SMB session", zap.String("host", config.Host), zap.Error(err))
-		return false
+		return nil, fmt.Errorf("failed to create SMB session: %w", err)
 	}
 	defer session.Logoff()
 
@@ -209,7 +231,7 @@ func (s *SMBDiscoveryService) TestConnection(ctx context.Context, config SMBConn
 	share, err := session.Mount(config.Share)
 	if err != nil {
 		s.logger.Debug("Failed to mount SMB share", zap.String("share", config.Share), zap.Error(err))
-		return false
+		return nil, fmt.Errorf("failed to mount SMB share: %w", filesystem.DescribeSmbError(err))
 	}
 	defer share.Umount()
 
@@ -217,11 +239,14 @@ func (s *SMBDiscoveryService) TestConnection(ctx context.Context, config SMBConn
 	_, err = share.ReadDir(".")
 	if err != nil {
 		s.logger.Debug("Failed to read SMB share directory", zap.String("share", config.Share), zap.Error(err))
-		return false
+		return nil, fmt.Errorf("failed to read SMB share: %w", filesystem.DescribeSmbError(err))
 	}
 
-	s.logger.Info("SMB connection test successful", zap.String("host", config.Host), zap.String("share", config.Share))
-	return true
+	s.logger.Info("SMB connection test successful",
+		zap.String("host", config.Host),
+		zap.String("share", config.Share),
+		zap.String("dialect", info.Dialect))
+	return info, nil
 }
 
 // BrowseShare browses files and directories in an SMB share
@@ -231,6 +256,19 @@ func (s *SMBDiscoveryService) BrowseShare(ctx context.Context, config SMBConnect
 		zap.String("share", config.Share),
 		zap.String("path", path))
 
+	d, err := config.dialer()
+	if err != nil {
+		return nil, err
+	}
+	if config.RequireEncryption {
+		probeCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		_, err := filesystem.ProbeSmbServer(probeCtx, net.JoinHostPort(config.Host, fmt.Sprintf("%d", config.Port)), config.SmbProtocolOptions)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Establish connection
 	conn, err := net.DialTimeout("tcp", net.JoinHostPort(config.Host, fmt.Sprintf("%d", config.Port)), s.timeout)
 	if err != nil {
@@ -239,14 +277,6 @@ func (s *SMBDiscoveryService) BrowseShare(ctx context.Context, config SMBConnect
 	defer conn.Close()
 
 	// Create SMB session
-	d := &smb2.Dialer{
-		Initiator: &smb2.NTLMInitiator{
-			User:     config.Username,
-			Password: config.Password,
-			Domain:   getStringValue(config.Domain),
-		},
-	}
-
 	session, err := d.Dial(conn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SMB session: %w", err)
@@ -263,7 +293,7 @@ func (s *SMBDiscoveryService) BrowseShare(ctx context.Context, config SMBConnect
 	// List directory contents
 	entries, err := share.ReadDir(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read directory %s: %w", path, err)
+		return nil, fmt.Errorf("failed to read directory %s: %w", path, filesystem.DescribeSmbError(err))
 	}
 
 	// Convert to our format
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Snapshot filesystem kinds.
+const (
+	SnapshotFSZFS   = "zfs"
+	SnapshotFSBtrfs = "btrfs"
+)
+
+// AuditEventSnapshotRestore is recorded in auth_audit_log when a file is
+// restored from a filesystem snapshot.
+const AuditEventSnapshotRestore = "snapshot_restore"
+
+// FilesystemSnapshot describes a single read-only snapshot of a local storage root.
+type FilesystemSnapshot struct {
+	ID         string    `json:"id"`
+	Filesystem string    `json:"filesystem"`
+	CreatedAt  time.Time `json:"created_at"`
+	path       string
+}
+
+// SnapshotProvider enumerates the snapshots exposed by one snapshot-capable
+// filesystem. Providers work purely on the directory layout the filesystem
+// exposes, so no external tooling is required.
+type SnapshotProvider interface {
+	Filesystem() string
+	ListSnapshots(rootPath string) ([]FilesystemSnapshot, error)
+}
+
+// zfsSnapshotProvider reads snapshots from the hidden <root>/.zfs/snapshot directory.
+type zfsSnapshotProvider struct{}
+
+func (zfsSnapshotProvider) Filesystem() string { return SnapshotFSZFS }
+
+func (zfsSnapshotProvider) ListSnapshots(rootPath string) ([]FilesystemSnapshot, error) {
+	dir := filepath.Join(rootPath, ".zfs", "snapshot")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []FilesystemSnapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snapPath := filepath.Join(dir, entry.Name())
+		snapshots = append(snapshots, FilesystemSnapshot{
+			ID:         entry.Name(),
+			Filesystem: SnapshotFSZFS,
+			CreatedAt:  dirModTime(snapPath),
+			path:       snapPath,
+		})
+	}
+	return snapshots, nil
+}
+
+// btrfsSnapshotProvider reads snapper-style snapshots from
+// <root>/.snapshots/<n>/snapshot.
+type btrfsSnapshotProvider struct{}
+
+func (btrfsSnapshotProvider) Filesystem() string { return SnapshotFSBtrfs }
+
+func (btrfsSnapshotProvider) ListSnapshots(rootPath string) ([]FilesystemSnapshot, error) {
+	dir := filepath.Join(rootPath, ".snapshots")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []FilesystemSnapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snapPath := filepath.Join(dir, entry.Name(), "snapshot")
+		if info, err := os.Stat(snapPath); err != nil || !info.IsDir() {
+			continue
+		}
+		snapshots = append(snapshots, FilesystemSnapshot{
+			ID:         entry.Name(),
+			Filesystem: SnapshotFSBtrfs,
+			CreatedAt:  dirModTime(snapPath),
+			path:       snapPath,
+		})
+	}
+	return snapshots, nil
+}
+
+func dirModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// SnapshotService exposes read-only browsing of ZFS/Btrfs snapshots for
+// local storage roots and restores individual files from them.
+type SnapshotService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	providers []SnapshotProvider
+	lockdowns lockdownStatus
+}
+
+// lockdownStatus reports whether a storage root is in read-only lockdown.
+type lockdownStatus interface {
+	IsLocked(storageRoot string) bool
+}
+
+// NewSnapshotService creates a SnapshotService with the built-in ZFS and
+// Btrfs providers.
+func NewSnapshotService(db *database.DB, logger *zap.Logger) *SnapshotService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &SnapshotService{
+		db:        db,
+		logger:    logger,
+		providers: []SnapshotProvider{zfsSnapshotProvider{}, btrfsSnapshotProvider{}},
+	}
+}
+
+// SetLockdownChecker makes restores honour ransomware lockdowns: a locked
+// root stays read-only until an administrator releases it.
+func (s *SnapshotService) SetLockdownChecker(checker lockdownStatus) {
+	s.lockdowns = checker
+}
+
+// localRootPath resolves the base path of an enabled local storage root.
+func (s *SnapshotService) localRootPath(ctx context.Context, storageRoot string) (string, error) {
+	if s.db == nil {
+		return "", fmt.Errorf("database not configured")
+	}
+
+	var protocol string
+	var path sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT protocol, path FROM storage_roots WHERE name = ? AND enabled = ?`,
+		storageRoot, true).Scan(&protocol, &path)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("storage root not found: %s", storageRoot)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up storage root: %w", err)
+	}
+	if protocol != "local" || !path.Valid || path.String == "" {
+		return "", fmt.Errorf("snapshots are only supported for local storage roots")
+	}
+	return path.String, nil
+}
+
+// ListSnapshots enumerates the snapshots available for a local storage root,
+// newest first.
+func (s *SnapshotService) ListSnapshots(ctx context.Context, storageRoot string) ([]FilesystemSnapshot, error) {
+	rootPath, err := s.localRootPath(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []FilesystemSnapshot
+	for _, provider := range s.providers {
+		found, err := provider.ListSnapshots(rootPath)
+		if err != nil {
+			s.logger.Warn("Failed to enumerate snapshots",
+				zap.String("storage_root", storageRoot),
+				zap.String("filesystem", provider.Filesystem()),
+				zap.Error(err))
+			continue
+		}
+		snapshots = append(snapshots, found...)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// findSnapshot returns the snapshot with the given ID for a local root path.
+func (s *SnapshotService) findSnapshot(rootPath, snapshotID string) (*FilesystemSnapshot, error) {
+	for _, provider := range s.providers {
+		found, err := provider.ListSnapshots(rootPath)
+		if err != nil {
+			continue
+		}
+		for i := range found {
+			if found[i].ID == snapshotID {
+				return &found[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("snapshot not found: %s", snapshotID)
+}
+
+// resolveInside joins relPath onto base and rejects results that escape base.
+func resolveInside(base, relPath string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(relPath))
+	full := filepath.Join(base, cleaned)
+	rel, err := filepath.Rel(base, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path: %s", relPath)
+	}
+	return full, nil
+}
+
+// ListSnapshotPath lists a directory as it existed in the given snapshot.
+// relPath is relative to the storage root.
+func (s *SnapshotService) ListSnapshotPath(ctx context.Context, storageRoot, snapshotID, relPath string) ([]models.FileInfo, error) {
+	rootPath, err := s.localRootPath(ctx, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := s.findSnapshot(rootPath, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := resolveInside(snapshot.path, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("path not found in snapshot: %s", relPath)
+		}
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	files := make([]models.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		file := models.FileInfo{
+			Name:         entry.Name(),
+			Path:         filepath.ToSlash(filepath.Join("/", relPath, entry.Name())),
+			IsDirectory:  entry.IsDir(),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+			SmbRoot:      storageRoot,
+		}
+		if entry.IsDir() {
+			file.Type = "directory"
+		} else {
+			file.Type = "file"
+			if ext := strings.TrimPrefix(filepath.Ext(entry.Name()), "."); ext != "" {
+				ext = strings.ToLower(ext)
+				file.Extension = &ext
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// SnapshotRestoreRequest identifies a file to restore and who asked for it.
+type SnapshotRestoreRequest struct {
+	StorageRoot string
+	SnapshotID  string
+	Path        string
+	UserID      int
+	IPAddress   string
+	UserAgent   string
+}
+
+// RestoreFromSnapshot copies a single file from a snapshot back over the
+// live path and records the action in the audit log.
+func (s *SnapshotService) RestoreFromSnapshot(ctx context.Context, req SnapshotRestoreRequest) error {
+	if s.lockdowns != nil && s.lockdowns.IsLocked(req.StorageRoot) {
+		return fmt.Errorf("storage root %s is locked", req.StorageRoot)
+	}
+
+	rootPath, err := s.localRootPath(ctx, req.StorageRoot)
+	if err != nil {
+		return err
+	}
+	snapshot, err := s.findSnapshot(rootPath, req.SnapshotID)
+	if err != nil {
+		return err
+	}
+	source, err := resolveInside(snapshot.path, req.Path)
+	if err != nil {
+		return err
+	}
+	target, err := resolveInside(rootPath, req.Path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("path not found in snapshot: %s", req.Path)
+		}
+		return fmt.Errorf("failed to stat snapshot file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("only files can be restored from a snapshot")
+	}
+
+	if err := restoreFile(source, target, info); err != nil {
+		return fmt.Errorf("failed to restore file: %w", err)
+	}
+
+	s.logger.Info("Restored file from snapshot",
+		zap.String("storage_root", req.StorageRoot),
+		zap.String("snapshot", req.SnapshotID),
+		zap.String("path", req.Path),
+		zap.Int("user_id", req.UserID))
+	s.recordRestore(ctx, req, snapshot.Filesystem, info.Size())
+	return nil
+}
+
+// restoreFile writes source to a temporary sibling of target and renames it
+// into place so a failed copy never leaves a truncated file behind.
+func restoreFile(source, target string, info os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".restore-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, target); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Chtimes(target, time.Now(), info.ModTime())
+}
+
+func (s *SnapshotService) recordRestore(ctx context.Context, req SnapshotRestoreRequest, filesystem string, size int64) {
+	details, _ := json.Marshal(map[string]interface{}{
+		"storage_root": req.StorageRoot,
+		"snapshot":     req.SnapshotID,
+		"filesystem":   filesystem,
+		"path":         req.Path,
+		"size":         size,
+	})
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO auth_audit_log (user_id, event_type, ip_address, user_agent, details) VALUES (?, ?, ?, ?, ?)`,
+		req.UserID, AuditEventSnapshotRestore, req.IPAddress, req.UserAgent, string(details))
+	if err != nil {
+		s.logger.Error("Failed to record snapshot restore in audit log", zap.Error(err))
+	}
+}
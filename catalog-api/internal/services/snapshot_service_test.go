@@ -0,0 +1,157 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type stubLockdowns map[string]bool
+
+func (s stubLockdowns) IsLocked(root string) bool { return s[root] }
+
+func setupSnapshotTestDB(t *testing.T, rootPath string) *database.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			path TEXT,
+			enabled BOOLEAN DEFAULT 1
+		);
+		CREATE TABLE auth_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			event_type TEXT NOT NULL,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	require.NoError(t, err)
+
+	_, err = sqlDB.Exec(`INSERT INTO storage_roots (name, protocol, path, enabled) VALUES ('local', 'local', ?, 1), ('nas', 'smb', 'share', 1)`, rootPath)
+	require.NoError(t, err)
+
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestSnapshotService_ListSnapshots(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, ".zfs", "snapshot", "daily-1", "movies", "a.mkv"), "old")
+	writeTestFile(t, filepath.Join(root, ".snapshots", "42", "snapshot", "movies", "a.mkv"), "older")
+	// Snapper directories without a snapshot subvolume are ignored
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".snapshots", "43"), 0755))
+
+	svc := NewSnapshotService(setupSnapshotTestDB(t, root), zap.NewNop())
+	ctx := context.Background()
+
+	snapshots, err := svc.ListSnapshots(ctx, "local")
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+
+	byID := map[string]string{}
+	for _, s := range snapshots {
+		byID[s.ID] = s.Filesystem
+	}
+	assert.Equal(t, SnapshotFSZFS, byID["daily-1"])
+	assert.Equal(t, SnapshotFSBtrfs, byID["42"])
+
+	_, err = svc.ListSnapshots(ctx, "nas")
+	assert.ErrorContains(t, err, "only supported for local")
+
+	_, err = svc.ListSnapshots(ctx, "missing")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestSnapshotService_ListSnapshotPath(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, ".zfs", "snapshot", "daily-1", "movies", "a.mkv"), "old")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", "daily-1", "movies", "extras"), 0755))
+
+	svc := NewSnapshotService(setupSnapshotTestDB(t, root), zap.NewNop())
+	ctx := context.Background()
+
+	files, err := svc.ListSnapshotPath(ctx, "local", "daily-1", "movies")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for _, f := range files {
+		switch f.Name {
+		case "a.mkv":
+			assert.False(t, f.IsDirectory)
+			assert.Equal(t, "/movies/a.mkv", f.Path)
+			require.NotNil(t, f.Extension)
+			assert.Equal(t, "mkv", *f.Extension)
+		case "extras":
+			assert.True(t, f.IsDirectory)
+		default:
+			t.Fatalf("unexpected entry %s", f.Name)
+		}
+	}
+
+	_, err = svc.ListSnapshotPath(ctx, "local", "nope", "movies")
+	assert.ErrorContains(t, err, "snapshot not found")
+
+	// Traversal is clamped to the snapshot root
+	files, err = svc.ListSnapshotPath(ctx, "local", "daily-1", "../../..")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "movies", files[0].Name)
+}
+
+func TestSnapshotService_RestoreFromSnapshot(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, ".zfs", "snapshot", "daily-1", "docs", "report.txt"), "original")
+	writeTestFile(t, filepath.Join(root, "docs", "report.txt"), "encrypted garbage")
+
+	db := setupSnapshotTestDB(t, root)
+	svc := NewSnapshotService(db, zap.NewNop())
+	ctx := context.Background()
+
+	err := svc.RestoreFromSnapshot(ctx, SnapshotRestoreRequest{
+		StorageRoot: "local",
+		SnapshotID:  "daily-1",
+		Path:        "docs/report.txt",
+		UserID:      5,
+		IPAddress:   "10.0.0.1",
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(root, "docs", "report.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+
+	var userID int
+	var eventType, details string
+	require.NoError(t, db.QueryRow(`SELECT user_id, event_type, details FROM auth_audit_log`).Scan(&userID, &eventType, &details))
+	assert.Equal(t, 5, userID)
+	assert.Equal(t, AuditEventSnapshotRestore, eventType)
+	assert.Contains(t, details, `"snapshot":"daily-1"`)
+
+	err = svc.RestoreFromSnapshot(ctx, SnapshotRestoreRequest{StorageRoot: "local", SnapshotID: "daily-1", Path: "docs"})
+	assert.ErrorContains(t, err, "only files")
+
+	svc.SetLockdownChecker(stubLockdowns{"local": true})
+	err = svc.RestoreFromSnapshot(ctx, SnapshotRestoreRequest{StorageRoot: "local", SnapshotID: "daily-1", Path: "docs/report.txt"})
+	assert.ErrorContains(t, err, "is locked")
+}
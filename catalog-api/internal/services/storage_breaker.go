@@ -0,0 +1,405 @@
+package services
+
+import (
+	"catalogizer/filesystem"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Storage breaker states.
+const (
+	StorageBreakerClosed   = "closed"
+	StorageBreakerOpen     = "open"
+	StorageBreakerHalfOpen = "half-open"
+)
+
+// StorageBreakerConfig configures the circuit breakers of storage roots.
+type StorageBreakerConfig struct {
+	// FailureThreshold is how many storage failures in a row open a
+	// root's breaker. Defaults to 3.
+	FailureThreshold int
+	// InitialBackoff is how long an open breaker waits before its first
+	// re-probe. Each failed re-probe doubles the wait. Defaults to 5s.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between re-probes. Defaults to 5m.
+	MaxBackoff time.Duration
+	// ConnectTimeout bounds connecting to a root and each re-probe.
+	// Defaults to 10s.
+	ConnectTimeout time.Duration
+	// CachedListings is how many directory listings, across all roots,
+	// are kept to answer while a root is unavailable. Defaults to 1000.
+	CachedListings int
+}
+
+func (c StorageBreakerConfig) withDefaults() StorageBreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 3
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 5 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = c.InitialBackoff
+	}
+	if c.ConnectTimeout <= 0 {
+		c.ConnectTimeout = 10 * time.Second
+	}
+	if c.CachedListings <= 0 {
+		c.CachedListings = 1000
+	}
+	return c
+}
+
+// StorageUnavailableError is returned without contacting a storage root
+// while its breaker is open.
+type StorageUnavailableError struct {
+	Root   string
+	Reason string
+	// RetryAt is when the root is next probed.
+	RetryAt time.Time
+}
+
+func (e *StorageUnavailableError) Error() string {
+	return fmt.Sprintf("storage root %s is unavailable: %s", e.Root, e.Reason)
+}
+
+// StorageBreakerStatus is the state of one storage root's breaker.
+type StorageBreakerStatus struct {
+	Root     string `json:"root"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	// LastError is the storage failure that counted last.
+	LastError   string     `json:"last_error,omitempty"`
+	OpenedAt    *time.Time `json:"opened_at,omitempty"`
+	NextProbeAt *time.Time `json:"next_probe_at,omitempty"`
+	// BackoffSeconds is the wait before the next re-probe.
+	BackoffSeconds float64 `json:"backoff_seconds,omitempty"`
+}
+
+// StorageListing is a directory listing of a storage root.
+type StorageListing struct {
+	Entries []*filesystem.FileInfo
+	// CachedAt is set when the root was unavailable and the listing
+	// was served from cache, as read at that time.
+	CachedAt *time.Time
+}
+
+type storageBreaker struct {
+	state     string
+	failures  int
+	lastError string
+	openedAt  time.Time
+	nextProbe time.Time
+	backoff   time.Duration
+	timer     *time.Timer
+}
+
+type cachedListing struct {
+	key      string
+	entries  []*filesystem.FileInfo
+	cachedAt time.Time
+}
+
+// StorageBreakers keeps a circuit breaker per storage root. Storage
+// failures in a row open a root's breaker; while it is open, connecting
+// to the root fails at once instead of waiting for the network to time
+// out, and directory listings read before are served from cache. An open
+// breaker re-probes its root on its own, waiting twice as long after
+// every failed probe, and closes as soon as one succeeds.
+type StorageBreakers struct {
+	config StorageBreakerConfig
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	probe    func(ctx context.Context, root string) error
+	breakers map[string]*storageBreaker
+	listings map[string]*list.Element
+	order    *list.List
+	stopped  bool
+	probes   sync.WaitGroup
+}
+
+// NewStorageBreakers creates a new StorageBreakers. Roots are re-probed
+// once it is attached to a StorageProviderFactory.
+func NewStorageBreakers(logger *zap.Logger, config StorageBreakerConfig) *StorageBreakers {
+	return &StorageBreakers{
+		config:   config.withDefaults(),
+		logger:   logger,
+		now:      time.Now,
+		breakers: make(map[string]*storageBreaker),
+		listings: make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (b *StorageBreakers) setProbe(probe func(ctx context.Context, root string) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probe = probe
+}
+
+// Allow returns a StorageUnavailableError while the root's breaker is
+// open.
+func (b *StorageBreakers) Allow(root string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, ok := b.breakers[root]
+	if !ok || breaker.state == StorageBreakerClosed {
+		return nil
+	}
+	return &StorageUnavailableError{Root: root, Reason: breaker.lastError, RetryAt: breaker.nextProbe}
+}
+
+// Record counts the outcome of using a root: nil when it answered, or
+// the error it could not be reached with. Attempts callers gave up on do
+// not count.
+func (b *StorageBreakers) Record(root string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, ok := b.breakers[root]
+	if !ok {
+		if err == nil {
+			return
+		}
+		breaker = &storageBreaker{state: StorageBreakerClosed}
+		b.breakers[root] = breaker
+	}
+
+	if err == nil {
+		if breaker.state != StorageBreakerClosed {
+			b.logger.Info("Storage root available again, closing circuit breaker", zap.String("storage_root", root))
+		}
+		if breaker.timer != nil {
+			breaker.timer.Stop()
+		}
+		delete(b.breakers, root)
+		return
+	}
+
+	breaker.failures++
+	breaker.lastError = err.Error()
+	if breaker.state == StorageBreakerClosed && breaker.failures >= b.config.FailureThreshold {
+		breaker.state = StorageBreakerOpen
+		breaker.openedAt = b.now()
+		breaker.backoff = b.config.InitialBackoff
+		b.logger.Warn("Storage root failing, opening circuit breaker",
+			zap.String("storage_root", root), zap.Int("failures", breaker.failures), zap.Error(err))
+		b.scheduleProbeLocked(root, breaker)
+	}
+}
+
+// scheduleProbeLocked re-probes an open breaker's root after its backoff.
+func (b *StorageBreakers) scheduleProbeLocked(root string, breaker *storageBreaker) {
+	breaker.nextProbe = b.now().Add(breaker.backoff)
+	if b.stopped {
+		return
+	}
+	breaker.timer = time.AfterFunc(breaker.backoff, func() { b.reprobe(root, breaker) })
+}
+
+func (b *StorageBreakers) reprobe(root string, breaker *storageBreaker) {
+	b.mu.Lock()
+	if b.stopped || b.breakers[root] != breaker || b.probe == nil {
+		b.mu.Unlock()
+		return
+	}
+	breaker.state = StorageBreakerHalfOpen
+	probe := b.probe
+	b.probes.Add(1)
+	b.mu.Unlock()
+	defer b.probes.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.ConnectTimeout)
+	err := probe(ctx, root)
+	cancel()
+	if err == nil {
+		b.Record(root, nil)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.breakers[root] != breaker {
+		return
+	}
+	breaker.state = StorageBreakerOpen
+	breaker.failures++
+	breaker.lastError = err.Error()
+	breaker.backoff *= 2
+	if breaker.backoff > b.config.MaxBackoff {
+		breaker.backoff = b.config.MaxBackoff
+	}
+	b.logger.Debug("Storage root still unavailable",
+		zap.String("storage_root", root), zap.Duration("next_probe_in", breaker.backoff), zap.Error(err))
+	b.scheduleProbeLocked(root, breaker)
+}
+
+// Statuses returns the state of every breaker that has counted failures,
+// sorted by root. Roots that are not listed are closed with no failures.
+func (b *StorageBreakers) Statuses() []StorageBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	statuses := make([]StorageBreakerStatus, 0, len(b.breakers))
+	for root, breaker := range b.breakers {
+		status := StorageBreakerStatus{
+			Root:      root,
+			State:     breaker.state,
+			Failures:  breaker.failures,
+			LastError: breaker.lastError,
+		}
+		if breaker.state != StorageBreakerClosed {
+			openedAt, nextProbe := breaker.openedAt, breaker.nextProbe
+			status.OpenedAt, status.NextProbeAt = &openedAt, &nextProbe
+			status.BackoffSeconds = breaker.backoff.Seconds()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Root < statuses[j].Root })
+	return statuses
+}
+
+// Open reports whether any breaker is open.
+func (b *StorageBreakers) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, breaker := range b.breakers {
+		if breaker.state != StorageBreakerClosed {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop cancels pending re-probes and waits for running ones.
+func (b *StorageBreakers) Stop() {
+	b.mu.Lock()
+	b.stopped = true
+	for _, breaker := range b.breakers {
+		if breaker.timer != nil {
+			breaker.timer.Stop()
+		}
+	}
+	b.mu.Unlock()
+	b.probes.Wait()
+}
+
+func listingKey(root, dir string) string {
+	return root + "\x00" + dir
+}
+
+// storeListing caches a directory listing, evicting the least recently
+// stored ones beyond the limit.
+func (b *StorageBreakers) storeListing(root, dir string, entries []*filesystem.FileInfo) {
+	key := listingKey(root, dir)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if element, ok := b.listings[key]; ok {
+		b.order.Remove(element)
+	}
+	b.listings[key] = b.order.PushFront(&cachedListing{key: key, entries: entries, cachedAt: b.now()})
+	for b.order.Len() > b.config.CachedListings {
+		oldest := b.order.Back()
+		b.order.Remove(oldest)
+		delete(b.listings, oldest.Value.(*cachedListing).key)
+	}
+}
+
+// CachedListing returns the latest listing read from a directory, and
+// when it was read.
+func (b *StorageBreakers) CachedListing(root, dir string) ([]*filesystem.FileInfo, time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	element, ok := b.listings[listingKey(root, dir)]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	listing := element.Value.(*cachedListing)
+	return listing.entries, listing.cachedAt, true
+}
+
+// storageFailure reports whether an operation failed because its storage
+// root could not be reached, rather than because of the operation itself,
+// such as a missing file or a refused permission.
+func storageFailure(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// breakerProvider counts the outcome of every operation on a root in its
+// breaker and caches the directory listings it reads.
+type breakerProvider struct {
+	StorageProvider
+	root     string
+	breakers *StorageBreakers
+}
+
+func (p *breakerProvider) record(err error) error {
+	if err == nil || storageFailure(err) {
+		p.breakers.Record(p.root, err)
+	}
+	return err
+}
+
+func (p *breakerProvider) List(ctx context.Context, dir string) ([]*filesystem.FileInfo, error) {
+	entries, err := p.StorageProvider.List(ctx, dir)
+	if err == nil {
+		p.breakers.storeListing(p.root, dir, entries)
+	}
+	return entries, p.record(err)
+}
+
+func (p *breakerProvider) Stat(ctx context.Context, file string) (*filesystem.FileInfo, error) {
+	info, err := p.StorageProvider.Stat(ctx, file)
+	return info, p.record(err)
+}
+
+func (p *breakerProvider) Exists(ctx context.Context, file string) (bool, error) {
+	exists, err := p.StorageProvider.Exists(ctx, file)
+	return exists, p.record(err)
+}
+
+func (p *breakerProvider) Open(ctx context.Context, file string) (io.ReadCloser, error) {
+	rc, err := p.StorageProvider.Open(ctx, file)
+	return rc, p.record(err)
+}
+
+func (p *breakerProvider) Write(ctx context.Context, file string, data io.Reader) error {
+	return p.record(p.StorageProvider.Write(ctx, file, data))
+}
+
+func (p *breakerProvider) Copy(ctx context.Context, srcPath, dstPath string) error {
+	return p.record(p.StorageProvider.Copy(ctx, srcPath, dstPath))
+}
+
+func (p *breakerProvider) Delete(ctx context.Context, file string) error {
+	return p.record(p.StorageProvider.Delete(ctx, file))
+}
+
+func (p *breakerProvider) Identify(ctx context.Context, file string) (FileIdentity, error) {
+	identity, err := identifyFile(ctx, p.StorageProvider, file)
+	return identity, p.record(err)
+}
+
+func (p *breakerProvider) Rename(ctx context.Context, srcPath, dstPath string) error {
+	return p.record(renameFile(ctx, p.StorageProvider, srcPath, dstPath))
+}
+
+func (p *breakerProvider) RemoveAll(ctx context.Context, file string) error {
+	return p.record(removeTree(ctx, p.StorageProvider, file))
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errConnectionRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func TestStorageBreakers_OpenAndClose(t *testing.T) {
+	breakers := NewStorageBreakers(zap.NewNop(), StorageBreakerConfig{FailureThreshold: 2, InitialBackoff: time.Hour})
+	t.Cleanup(breakers.Stop)
+
+	breakers.Record("nas", errConnectionRefused)
+	assert.NoError(t, breakers.Allow("nas"))
+	breakers.Record("nas", nil)
+	breakers.Record("nas", errConnectionRefused)
+	assert.NoError(t, breakers.Allow("nas"), "successes reset the failure count")
+
+	breakers.Record("nas", context.Canceled)
+	assert.NoError(t, breakers.Allow("nas"), "callers giving up do not count")
+	breakers.Record("nas", errConnectionRefused)
+	err := breakers.Allow("nas")
+	var unavailable *StorageUnavailableError
+	require.ErrorAs(t, err, &unavailable)
+	assert.Equal(t, "nas", unavailable.Root)
+	assert.Contains(t, err.Error(), "connection refused")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), unavailable.RetryAt, time.Minute)
+	assert.NoError(t, breakers.Allow("other"))
+	assert.True(t, breakers.Open())
+
+	statuses := breakers.Statuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, StorageBreakerOpen, statuses[0].State)
+	assert.Equal(t, 2, statuses[0].Failures)
+	assert.Equal(t, 3600.0, statuses[0].BackoffSeconds)
+
+	breakers.Record("nas", nil)
+	assert.NoError(t, breakers.Allow("nas"))
+	assert.Empty(t, breakers.Statuses())
+}
+
+func TestStorageBreakers_ReprobeWithBackoff(t *testing.T) {
+	breakers := NewStorageBreakers(zap.NewNop(), StorageBreakerConfig{
+		FailureThreshold: 1,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       20 * time.Millisecond,
+	})
+	t.Cleanup(breakers.Stop)
+	var probes atomic.Int32
+	breakers.setProbe(func(ctx context.Context, root string) error {
+		if probes.Add(1) <= 3 {
+			return errConnectionRefused
+		}
+		return nil
+	})
+
+	breakers.Record("nas", errConnectionRefused)
+	require.Error(t, breakers.Allow("nas"))
+	require.Eventually(t, func() bool { return breakers.Allow("nas") == nil }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(4), probes.Load())
+	assert.Empty(t, breakers.Statuses())
+}
+
+func TestStorageBreakers_BackoffIsCapped(t *testing.T) {
+	breakers := NewStorageBreakers(zap.NewNop(), StorageBreakerConfig{
+		FailureThreshold: 1,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       40 * time.Millisecond,
+	})
+	t.Cleanup(breakers.Stop)
+	var probes atomic.Int32
+	breakers.setProbe(func(ctx context.Context, root string) error {
+		probes.Add(1)
+		return errConnectionRefused
+	})
+
+	breakers.Record("nas", errConnectionRefused)
+	require.Eventually(t, func() bool { return probes.Load() >= 5 }, 5*time.Second, 5*time.Millisecond)
+	status := breakers.Statuses()[0]
+	assert.Equal(t, 0.04, status.BackoffSeconds)
+	assert.GreaterOrEqual(t, status.Failures, 5)
+}
+
+func TestStorageBreakers_ListingCache(t *testing.T) {
+	breakers := NewStorageBreakers(zap.NewNop(), StorageBreakerConfig{CachedListings: 2})
+	breakers.storeListing("nas", "films", []*filesystem.FileInfo{{Name: "a.mkv"}})
+	breakers.storeListing("nas", "music", nil)
+	breakers.storeListing("nas", "films", []*filesystem.FileInfo{{Name: "b.mkv"}})
+	breakers.storeListing("nas", "photos", nil)
+
+	entries, cachedAt, ok := breakers.CachedListing("nas", "films")
+	require.True(t, ok)
+	assert.Equal(t, "b.mkv", entries[0].Name)
+	assert.WithinDuration(t, time.Now(), cachedAt, time.Minute)
+	_, _, ok = breakers.CachedListing("nas", "music")
+	assert.False(t, ok, "the least recently stored listing is evicted")
+	_, _, ok = breakers.CachedListing("other", "films")
+	assert.False(t, ok)
+}
+
+// flakyRootClients connects to local roots while up is set, and fails
+// like an unreachable host otherwise.
+type flakyRootClients struct {
+	up *atomic.Bool
+}
+
+type flakyClient struct {
+	filesystem.FileSystemClient
+	up *atomic.Bool
+}
+
+func (c flakyRootClients) NewClient(root *models.StorageRoot) (filesystem.FileSystemClient, error) {
+	client, err := localRootClients{}.NewClient(root)
+	if err != nil {
+		return nil, err
+	}
+	return flakyClient{FileSystemClient: client, up: c.up}, nil
+}
+
+func (c flakyClient) Connect(ctx context.Context) error {
+	if !c.up.Load() {
+		return errConnectionRefused
+	}
+	return c.FileSystemClient.Connect(ctx)
+}
+
+func TestStorageProviderFactory_Breakers(t *testing.T) {
+	db := setupTieringTestDB(t)
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(dir+"/films", 0755))
+	require.NoError(t, os.WriteFile(dir+"/films/a.mkv", []byte("film"), 0644))
+	_, err := db.ExecContext(context.Background(),
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('nas', 'local', ?)`, dir)
+	require.NoError(t, err)
+
+	var up atomic.Bool
+	up.Store(true)
+	factory := NewStorageProviderFactory(db, flakyRootClients{up: &up}, zap.NewNop())
+	breakers := NewStorageBreakers(zap.NewNop(), StorageBreakerConfig{FailureThreshold: 2, InitialBackoff: time.Hour})
+	t.Cleanup(breakers.Stop)
+	factory.SetBreakers(breakers)
+	ctx := context.Background()
+
+	listing, err := factory.List(ctx, "nas", "films")
+	require.NoError(t, err)
+	require.Len(t, listing.Entries, 1)
+	assert.Nil(t, listing.CachedAt)
+
+	// Missing directories are answered by storage and do not count
+	_, err = factory.List(ctx, "nas", "missing")
+	require.Error(t, err)
+	_, err = factory.List(ctx, "nas", "missing")
+	require.Error(t, err)
+	assert.NoError(t, breakers.Allow("nas"))
+
+	up.Store(false)
+	listing, err = factory.List(ctx, "nas", "films")
+	require.NoError(t, err, "listings read before are served while the root is down")
+	require.NotNil(t, listing.CachedAt)
+	assert.Equal(t, "a.mkv", listing.Entries[0].Name)
+	_, err = factory.Provider(ctx, "nas")
+	assert.ErrorContains(t, err, "connection refused")
+	_, err = factory.Provider(ctx, "nas")
+	var unavailable *StorageUnavailableError
+	require.ErrorAs(t, err, &unavailable, "the second failure opens the breaker")
+
+	_, err = factory.List(ctx, "nas", "music")
+	assert.ErrorAs(t, err, &unavailable)
+
+	// A successful probe, such as the dependency monitor's, closes it
+	up.Store(true)
+	require.NoError(t, factory.Probe(ctx, "nas"))
+	listing, err = factory.List(ctx, "nas", "films")
+	require.NoError(t, err)
+	assert.Nil(t, listing.CachedAt)
+}
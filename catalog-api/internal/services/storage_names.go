@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"catalogizer/filesystem"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// File names are kept in the catalog, and handed to clients, in one
+// form whatever bytes storage returns for them: valid UTF-8 in Unicode
+// normalization form C. macOS and SMB shares it serves spell accented
+// names decomposed (NFD) where Linux and most clients type them composed
+// (NFC), so the same name would otherwise be two strings that never
+// match in search or when a client asks for the file.
+//
+// Names that are not valid UTF-8 keep their bytes: each invalid byte is
+// escaped as %XX. So that escaped names cannot be confused with real
+// ones, a name that is escaped also has every "%" escaped as %25, and
+// this is done as well for valid names that contain %XX sequences of
+// their own. A name without %XX sequences is therefore its own catalog
+// name, and any other is decoded by unescaping every %XX.
+
+const hexDigits = "0123456789ABCDEF"
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// hasPercentEscape reports whether s contains a %XX sequence.
+func hasPercentEscape(s string) bool {
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '%' && isHexDigit(s[i+1]) && isHexDigit(s[i+2]) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeStorageName returns the catalog form of a name as storage
+// spells it. Distinct names that only differ in normalization must be
+// told apart by the caller; see nameSafeProvider.List.
+func escapeStorageName(name string, normalize bool) string {
+	valid := utf8.ValidString(name)
+	if valid && normalize {
+		name = norm.NFC.String(name)
+	}
+	if valid && !hasPercentEscape(name) {
+		return name
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if r == '%' || (r == utf8.RuneError && size == 1) {
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[name[i]>>4])
+			b.WriteByte(hexDigits[name[i]&0x0F])
+		} else {
+			b.WriteString(name[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// unescapeStorageName reverses the escaping of escapeStorageName.
+func unescapeStorageName(name string) string {
+	if !hasPercentEscape(name) {
+		return name
+	}
+	b := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		if name[i] == '%' && i+2 < len(name) && isHexDigit(name[i+1]) && isHexDigit(name[i+2]) {
+			b = append(b, unhex(name[i+1])<<4|unhex(name[i+2]))
+			i += 2
+			continue
+		}
+		b = append(b, name[i])
+	}
+	return string(b)
+}
+
+// catalogStoragePath returns the catalog form of a path as storage
+// spells it, a name at a time.
+func catalogStoragePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = escapeStorageName(part, true)
+	}
+	return strings.Join(parts, "/")
+}
+
+// normalizationInvariant reports whether a name is spelled the same in
+// every normalization form, as plain ASCII is, so storage has it under
+// exactly that spelling.
+func normalizationInvariant(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return norm.NFC.IsNormalString(name) && norm.NFD.IsNormalString(name)
+		}
+	}
+	return true
+}
+
+// nameSafeProvider presents the names of a provider's files in their
+// catalog form, and finds files by it: paths are unescaped and then, when
+// storage spells a name in another normalization form, looked up a
+// directory at a time.
+type nameSafeProvider struct {
+	StorageProvider
+}
+
+// newNameSafeProvider wraps a provider so names round-trip through the
+// catalog.
+func newNameSafeProvider(provider StorageProvider) StorageProvider {
+	return &nameSafeProvider{StorageProvider: provider}
+}
+
+// resolve returns how storage spells a catalog path. Names it does not
+// have under any spelling, such as those of files about to be created,
+// are kept as given.
+func (p *nameSafeProvider) resolve(ctx context.Context, catalogPath string) string {
+	parts := strings.Split(catalogPath, "/")
+	invariant := true
+	for i, part := range parts {
+		parts[i] = unescapeStorageName(part)
+		invariant = invariant && normalizationInvariant(parts[i])
+	}
+	exact := strings.Join(parts, "/")
+	if invariant {
+		return exact
+	}
+	if exists, err := p.StorageProvider.Exists(ctx, exact); err == nil && exists {
+		return exact
+	}
+
+	resolved := ""
+	for i, part := range parts {
+		if part == "" || normalizationInvariant(part) {
+			resolved = joinStoragePath(resolved, part, i)
+			continue
+		}
+		entries, err := p.StorageProvider.List(ctx, resolved)
+		if err != nil {
+			return exact
+		}
+		match := ""
+		for _, e := range entries {
+			if e.Name == part {
+				match = part
+				break
+			}
+			if match == "" && utf8.ValidString(e.Name) && norm.NFC.String(e.Name) == norm.NFC.String(part) {
+				match = e.Name
+			}
+		}
+		if match == "" {
+			return joinStoragePath(resolved, strings.Join(parts[i:], "/"), i)
+		}
+		resolved = joinStoragePath(resolved, match, i)
+	}
+	return resolved
+}
+
+// joinStoragePath appends the name at index i of a split path, keeping a
+// leading slash.
+func joinStoragePath(dir, name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return dir + "/" + name
+}
+
+func (p *nameSafeProvider) List(ctx context.Context, dir string) ([]*filesystem.FileInfo, error) {
+	entries, err := p.StorageProvider.List(ctx, p.resolve(ctx, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	// Names only normalization tells apart keep their own spelling, bar
+	// the one already in NFC
+	spellings := make(map[string]int, len(entries))
+	for _, e := range entries {
+		spellings[escapeStorageName(e.Name, true)]++
+	}
+	listed := make([]*filesystem.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		entry := *e
+		entry.Name = escapeStorageName(e.Name, true)
+		if spellings[entry.Name] > 1 && entry.Name != e.Name {
+			entry.Name = escapeStorageName(e.Name, false)
+		}
+		entry.Path = path.Join(dir, entry.Name)
+		listed = append(listed, &entry)
+	}
+	return listed, nil
+}
+
+func (p *nameSafeProvider) Stat(ctx context.Context, file string) (*filesystem.FileInfo, error) {
+	info, err := p.StorageProvider.Stat(ctx, p.resolve(ctx, file))
+	if err != nil || info == nil {
+		return info, err
+	}
+	stat := *info
+	if name := path.Base(file); name != "." && name != "/" {
+		stat.Name = name
+	}
+	stat.Path = file
+	return &stat, nil
+}
+
+func (p *nameSafeProvider) Exists(ctx context.Context, file string) (bool, error) {
+	return p.StorageProvider.Exists(ctx, p.resolve(ctx, file))
+}
+
+func (p *nameSafeProvider) Open(ctx context.Context, file string) (io.ReadCloser, error) {
+	return p.StorageProvider.Open(ctx, p.resolve(ctx, file))
+}
+
+func (p *nameSafeProvider) Write(ctx context.Context, file string, data io.Reader) error {
+	return p.StorageProvider.Write(ctx, p.resolve(ctx, file), data)
+}
+
+func (p *nameSafeProvider) Copy(ctx context.Context, srcPath, dstPath string) error {
+	return p.StorageProvider.Copy(ctx, p.resolve(ctx, srcPath), p.resolve(ctx, dstPath))
+}
+
+func (p *nameSafeProvider) Delete(ctx context.Context, file string) error {
+	return p.StorageProvider.Delete(ctx, p.resolve(ctx, file))
+}
+
+func (p *nameSafeProvider) Identify(ctx context.Context, file string) (FileIdentity, error) {
+	return identifyFile(ctx, p.StorageProvider, p.resolve(ctx, file))
+}
+
+func (p *nameSafeProvider) Rename(ctx context.Context, srcPath, dstPath string) error {
+	return renameFile(ctx, p.StorageProvider, p.resolve(ctx, srcPath), p.resolve(ctx, dstPath))
+}
+
+func (p *nameSafeProvider) RemoveAll(ctx context.Context, file string) error {
+	return removeTree(ctx, p.StorageProvider, p.resolve(ctx, file))
+}
+
+// Watch reports changes under their catalog paths.
+func (p *nameSafeProvider) Watch(ctx context.Context, dir string) (<-chan StorageEvent, error) {
+	raw, err := p.StorageProvider.Watch(ctx, p.resolve(ctx, dir))
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan StorageEvent, cap(raw))
+	go func() {
+		defer close(events)
+		for event := range raw {
+			event.Path = catalogStoragePath(event.Path)
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
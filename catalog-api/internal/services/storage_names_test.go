@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	composedName   = "Caf\u00e9.mkv"
+	decomposedName = "Cafe\u0301.mkv"
+)
+
+func TestEscapeStorageName(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage string
+		catalog string
+	}{
+		{"plain", "a.mkv", "a.mkv"},
+		{"percent without escape", "100% pure.mkv", "100% pure.mkv"},
+		{"decomposed", decomposedName, composedName},
+		{"invalid utf-8", "bad\xff.mkv", "bad%FF.mkv"},
+		{"invalid utf-8 with percent", "50%\xfe", "50%25%FE"},
+		{"literal escape", "100%41.txt", "100%2541.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := escapeStorageName(tt.storage, true)
+			assert.Equal(t, tt.catalog, catalog)
+			if tt.storage != decomposedName {
+				assert.Equal(t, tt.storage, unescapeStorageName(catalog))
+			}
+		})
+	}
+}
+
+// writeRawFile creates a file under a name exactly as spelled, skipping
+// the test where the filesystem does not keep such names.
+func writeRawFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Skipf("filesystem rejects %q: %v", name, err)
+	}
+}
+
+func listedNames(t *testing.T, p StorageProvider, dir string) []string {
+	t.Helper()
+	entries, err := p.List(context.Background(), dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestNameSafeProvider_FindsFilesByCatalogName(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "films"), 0755))
+	writeRawFile(t, filepath.Join(dir, "films"), decomposedName, "cafe")
+	writeRawFile(t, dir, "bad\xff.mkv", "bad")
+	writeRawFile(t, dir, "100%41.txt", "literal")
+	p := newNameSafeProvider(NewLocalStorageProvider(connectedLocalClient(t, dir), dir))
+	ctx := context.Background()
+
+	assert.Equal(t, []string{composedName}, listedNames(t, p, "films"))
+	assert.Equal(t, []string{"100%2541.txt", "bad%FF.mkv", "films"}, listedNames(t, p, ""))
+
+	assert.Equal(t, "cafe", readProviderFile(t, p, "films/"+composedName))
+	assert.Equal(t, "cafe", readProviderFile(t, p, "films/"+decomposedName))
+	assert.Equal(t, "bad", readProviderFile(t, p, "bad%FF.mkv"))
+	assert.Equal(t, "literal", readProviderFile(t, p, "100%2541.txt"))
+
+	info, err := p.Stat(ctx, "films/"+composedName)
+	require.NoError(t, err)
+	assert.Equal(t, composedName, info.Name)
+	assert.Equal(t, int64(4), info.Size)
+
+	require.NoError(t, p.Write(ctx, "films/Cr\u00e8me.mkv", strings.NewReader("new")))
+	_, err = os.Stat(filepath.Join(dir, "films", "Cr\u00e8me.mkv"))
+	assert.NoError(t, err)
+}
+
+func TestNameSafeProvider_KeepsNamesOnlyNormalizationTellsApart(t *testing.T) {
+	dir := t.TempDir()
+	writeRawFile(t, dir, composedName, "composed")
+	writeRawFile(t, dir, decomposedName, "decomposed")
+	if entries, _ := os.ReadDir(dir); len(entries) < 2 {
+		t.Skip("filesystem folds normalization forms")
+	}
+	p := newNameSafeProvider(NewLocalStorageProvider(connectedLocalClient(t, dir), dir))
+
+	names := listedNames(t, p, "")
+	assert.ElementsMatch(t, []string{composedName, decomposedName}, names)
+	assert.Equal(t, "composed", readProviderFile(t, p, composedName))
+	assert.Equal(t, "decomposed", readProviderFile(t, p, decomposedName))
+}
+
+func TestScannerService_CatalogsNormalizedNames(t *testing.T) {
+	f := newScannerFixture(t)
+	require.NoError(t, os.Mkdir(filepath.Join(f.dir, "films"), 0755))
+	writeRawFile(t, filepath.Join(f.dir, "films"), decomposedName, "cafe")
+	writeRawFile(t, f.dir, "bad\xff.mkv", "bad")
+
+	job := f.scan(t)
+	assert.Equal(t, ScanJobCompleted, job.Status)
+	assert.Equal(t, int64(4), f.file(t, "films/"+composedName).size)
+	assert.Equal(t, int64(3), f.file(t, "bad%FF.mkv").size)
+}
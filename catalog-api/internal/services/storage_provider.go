@@ -0,0 +1,605 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// Change operations reported by StorageProvider.Watch.
+const (
+	StorageEventCreate = "create"
+	StorageEventModify = "modify"
+	StorageEventDelete = "delete"
+)
+
+// StorageEvent is a change to an entry in a watched directory.
+type StorageEvent struct {
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+}
+
+// StorageProvider gives protocol-independent access to one storage root.
+// Paths are relative to the root. A provider holds an open connection
+// until Close.
+type StorageProvider interface {
+	Protocol() string
+	List(ctx context.Context, path string) ([]*filesystem.FileInfo, error)
+	Stat(ctx context.Context, path string) (*filesystem.FileInfo, error)
+	Exists(ctx context.Context, path string) (bool, error)
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	Write(ctx context.Context, path string, data io.Reader) error
+	// Copy copies a file within the root, creating missing parent
+	// directories of dstPath.
+	Copy(ctx context.Context, srcPath, dstPath string) error
+	// Delete removes a file.
+	Delete(ctx context.Context, path string) error
+	// Watch reports changes to the entries of a directory until ctx is
+	// cancelled, then closes the channel.
+	Watch(ctx context.Context, path string) (<-chan StorageEvent, error)
+	Close() error
+}
+
+// clientStorageProvider implements StorageProvider on top of a connected
+// filesystem client, watching by polling the directory listing.
+type clientStorageProvider struct {
+	protocol     string
+	client       filesystem.FileSystemClient
+	pollInterval time.Duration
+	// mkdirAll is set when the client's CreateDirectory creates parents
+	mkdirAll bool
+}
+
+func (p *clientStorageProvider) Protocol() string {
+	return p.protocol
+}
+
+func (p *clientStorageProvider) List(ctx context.Context, dir string) ([]*filesystem.FileInfo, error) {
+	return p.client.ListDirectory(ctx, dir)
+}
+
+func (p *clientStorageProvider) Stat(ctx context.Context, file string) (*filesystem.FileInfo, error) {
+	return p.client.GetFileInfo(ctx, file)
+}
+
+func (p *clientStorageProvider) Exists(ctx context.Context, file string) (bool, error) {
+	return p.client.FileExists(ctx, file)
+}
+
+func (p *clientStorageProvider) Open(ctx context.Context, file string) (io.ReadCloser, error) {
+	return p.client.ReadFile(ctx, file)
+}
+
+func (p *clientStorageProvider) Write(ctx context.Context, file string, data io.Reader) error {
+	if err := p.ensureParent(ctx, file); err != nil {
+		return err
+	}
+	return p.client.WriteFile(ctx, file, data)
+}
+
+func (p *clientStorageProvider) Copy(ctx context.Context, srcPath, dstPath string) error {
+	if err := p.ensureParent(ctx, dstPath); err != nil {
+		return err
+	}
+	return p.client.CopyFile(ctx, srcPath, dstPath)
+}
+
+func (p *clientStorageProvider) Delete(ctx context.Context, file string) error {
+	return p.client.DeleteFile(ctx, file)
+}
+
+// ensureParent creates the missing parent directories of a file, one
+// level at a time for clients that cannot create them in one call.
+func (p *clientStorageProvider) ensureParent(ctx context.Context, file string) error {
+	dir := path.Dir(filepath.ToSlash(file))
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	if exists, err := p.client.FileExists(ctx, dir); err == nil && exists {
+		return nil
+	}
+	if p.mkdirAll {
+		return p.client.CreateDirectory(ctx, dir)
+	}
+
+	current := ""
+	if strings.HasPrefix(dir, "/") {
+		current = "/"
+	}
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current = path.Join(current, part)
+		exists, err := p.client.FileExists(ctx, current)
+		if err != nil {
+			return fmt.Errorf("failed to check directory %s: %w", current, err)
+		}
+		if !exists {
+			if err := p.client.CreateDirectory(ctx, current); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *clientStorageProvider) Watch(ctx context.Context, dir string) (<-chan StorageEvent, error) {
+	previous, err := p.snapshot(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan StorageEvent, 64)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := p.snapshot(ctx, dir)
+			if err != nil {
+				// Transient listing failures are retried on the next tick
+				continue
+			}
+			for _, event := range diffSnapshots(previous, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+	return events, nil
+}
+
+type snapshotEntry struct {
+	size     int64
+	modified time.Time
+}
+
+func (p *clientStorageProvider) snapshot(ctx context.Context, dir string) (map[string]snapshotEntry, error) {
+	entries, err := p.client.ListDirectory(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]snapshotEntry, len(entries))
+	for _, e := range entries {
+		snapshot[path.Join(filepath.ToSlash(dir), e.Name)] = snapshotEntry{size: e.Size, modified: e.ModTime}
+	}
+	return snapshot, nil
+}
+
+func diffSnapshots(previous, current map[string]snapshotEntry) []StorageEvent {
+	now := time.Now()
+	var events []StorageEvent
+	for p, entry := range current {
+		old, ok := previous[p]
+		switch {
+		case !ok:
+			events = append(events, StorageEvent{Op: StorageEventCreate, Path: p, Time: now})
+		case old.size != entry.size || !old.modified.Equal(entry.modified):
+			events = append(events, StorageEvent{Op: StorageEventModify, Path: p, Time: now})
+		}
+	}
+	for p := range previous {
+		if _, ok := current[p]; !ok {
+			events = append(events, StorageEvent{Op: StorageEventDelete, Path: p, Time: now})
+		}
+	}
+	return events
+}
+
+func (p *clientStorageProvider) Close() error {
+	return p.client.Disconnect(context.Background())
+}
+
+// LocalStorageProvider serves a directory on the API host and watches it
+// with filesystem notifications instead of polling.
+type LocalStorageProvider struct {
+	clientStorageProvider
+	basePath string
+}
+
+// NewLocalStorageProvider wraps a connected local client rooted at basePath.
+func NewLocalStorageProvider(client filesystem.FileSystemClient, basePath string) *LocalStorageProvider {
+	// Go only handles Windows paths past MAX_PATH when they are absolute
+	if abs, err := filepath.Abs(basePath); err == nil && basePath != "" {
+		basePath = abs
+	}
+	return &LocalStorageProvider{
+		clientStorageProvider: clientStorageProvider{protocol: "local", client: client, pollInterval: 5 * time.Second, mkdirAll: true},
+		basePath:              basePath,
+	}
+}
+
+// Identify identifies the file behind a path, following symlinks.
+func (p *LocalStorageProvider) Identify(ctx context.Context, file string) (FileIdentity, error) {
+	full, err := resolveInside(p.basePath, file)
+	if err != nil {
+		return FileIdentity{}, err
+	}
+	return localFileIdentity(full)
+}
+
+// Rename moves a file or directory within the root in one step,
+// creating missing parent directories of dstPath.
+func (p *LocalStorageProvider) Rename(ctx context.Context, srcPath, dstPath string) error {
+	src, err := resolveInside(p.basePath, srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := resolveInside(p.basePath, dstPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", dstPath, err)
+	}
+	return os.Rename(src, dst)
+}
+
+// RemoveAll removes a file or a directory with everything in it.
+func (p *LocalStorageProvider) RemoveAll(ctx context.Context, file string) error {
+	full, err := resolveInside(p.basePath, file)
+	if err != nil {
+		return err
+	}
+	if full == filepath.Clean(p.basePath) {
+		return fmt.Errorf("invalid path: %s", file)
+	}
+	return os.RemoveAll(full)
+}
+
+func (p *LocalStorageProvider) Watch(ctx context.Context, dir string) (<-chan StorageEvent, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Join(p.basePath, dir)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	events := make(chan StorageEvent, 64)
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				var op string
+				switch {
+				case ev.Has(fsnotify.Create):
+					op = StorageEventCreate
+				case ev.Has(fsnotify.Write), ev.Has(fsnotify.Chmod):
+					op = StorageEventModify
+				case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+					op = StorageEventDelete
+				default:
+					continue
+				}
+				rel, err := filepath.Rel(p.basePath, ev.Name)
+				if err != nil {
+					continue
+				}
+				select {
+				case events <- StorageEvent{Op: op, Path: filepath.ToSlash(rel), Time: time.Now()}:
+				case <-ctx.Done():
+					return
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// SMBStorageProvider serves an SMB share. SMB change notifications are not
+// exposed by the client, so Watch polls.
+type SMBStorageProvider struct {
+	clientStorageProvider
+}
+
+// NewSMBStorageProvider wraps a connected SMB client.
+func NewSMBStorageProvider(client filesystem.FileSystemClient) *SMBStorageProvider {
+	return &SMBStorageProvider{clientStorageProvider{protocol: "smb", client: client, pollInterval: 30 * time.Second}}
+}
+
+// FTPStorageProvider serves an FTP server. Listings are expensive, so
+// Watch polls slowly.
+type FTPStorageProvider struct {
+	clientStorageProvider
+}
+
+// NewFTPStorageProvider wraps a connected FTP client.
+func NewFTPStorageProvider(client filesystem.FileSystemClient) *FTPStorageProvider {
+	return &FTPStorageProvider{clientStorageProvider{protocol: "ftp", client: client, pollInterval: time.Minute}}
+}
+
+// NFSStorageProvider serves an NFS export through its local mount point.
+// Notifications on NFS mounts miss changes made by other clients, so
+// Watch polls.
+type NFSStorageProvider struct {
+	clientStorageProvider
+}
+
+// NewNFSStorageProvider wraps a connected NFS client.
+func NewNFSStorageProvider(client filesystem.FileSystemClient) *NFSStorageProvider {
+	return &NFSStorageProvider{clientStorageProvider{protocol: "nfs", client: client, pollInterval: 30 * time.Second, mkdirAll: true}}
+}
+
+// WebDAVStorageProvider serves a WebDAV collection. Copies use the
+// server-side COPY method.
+type WebDAVStorageProvider struct {
+	clientStorageProvider
+}
+
+// NewWebDAVStorageProvider wraps a connected WebDAV client.
+func NewWebDAVStorageProvider(client filesystem.FileSystemClient) *WebDAVStorageProvider {
+	return &WebDAVStorageProvider{clientStorageProvider{protocol: "webdav", client: client, pollInterval: time.Minute}}
+}
+
+// StorageProviderConstructor builds a provider for a storage root from a
+// connected client.
+type StorageProviderConstructor func(root *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider
+
+// StorageProviderFactory resolves storage roots to providers by their
+// protocol. Protocols without a registered constructor still get a
+// generic polling provider as long as the client factory supports them.
+type StorageProviderFactory struct {
+	db      *database.DB
+	clients storageClientProvider
+	logger  *zap.Logger
+
+	mu           sync.RWMutex
+	constructors map[string]StorageProviderConstructor
+	// ioScheduling is set when providers are scheduled, with one
+	// scheduler per root
+	ioScheduling *IOSchedulerConfig
+	schedulers   map[string]*ioScheduler
+	breakers     *StorageBreakers
+}
+
+// NewStorageProviderFactory creates a factory with providers for local,
+// SMB, FTP, NFS and WebDAV roots.
+func NewStorageProviderFactory(db *database.DB, clients storageClientProvider, logger *zap.Logger) *StorageProviderFactory {
+	f := &StorageProviderFactory{
+		db:           db,
+		clients:      clients,
+		logger:       logger,
+		constructors: make(map[string]StorageProviderConstructor),
+	}
+	f.Register("local", func(root *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider {
+		basePath := ""
+		if root.Path != nil {
+			basePath = *root.Path
+		}
+		return NewLocalStorageProvider(client, basePath)
+	})
+	f.Register("smb", func(_ *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider {
+		return NewSMBStorageProvider(client)
+	})
+	f.Register("ftp", func(_ *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider {
+		return NewFTPStorageProvider(client)
+	})
+	f.Register("nfs", func(_ *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider {
+		return NewNFSStorageProvider(client)
+	})
+	f.Register("webdav", func(_ *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider {
+		return NewWebDAVStorageProvider(client)
+	})
+	return f
+}
+
+// Register sets the provider constructor for a protocol, replacing any
+// existing one.
+func (f *StorageProviderFactory) Register(protocol string, constructor StorageProviderConstructor) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.constructors[strings.ToLower(protocol)] = constructor
+}
+
+// SetIOScheduling schedules the operations of the providers returned
+// from then on in priority lanes, per storage root: interactive requests
+// first, then transfers, then scans and hashing, which are throttled
+// while interactive requests slow down. The lane comes from each
+// operation's context; see WithIOPriority.
+func (f *StorageProviderFactory) SetIOScheduling(config IOSchedulerConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ioScheduling = &config
+	f.schedulers = make(map[string]*ioScheduler)
+}
+
+// SetBreakers guards the providers returned from then on with circuit
+// breakers: once a root keeps failing, connecting to it fails at once
+// until a re-probe reaches it again.
+func (f *StorageProviderFactory) SetBreakers(breakers *StorageBreakers) {
+	f.mu.Lock()
+	f.breakers = breakers
+	f.mu.Unlock()
+	breakers.setProbe(f.probe)
+}
+
+// Probe connects to a storage root and disconnects again, even while its
+// circuit breaker is open. The outcome counts in the breaker, so a
+// successful probe closes it.
+func (f *StorageProviderFactory) Probe(ctx context.Context, storageRoot string) error {
+	err := f.probe(ctx, storageRoot)
+	f.mu.RLock()
+	breakers := f.breakers
+	f.mu.RUnlock()
+	if breakers != nil {
+		breakers.Record(storageRoot, err)
+	}
+	return err
+}
+
+func (f *StorageProviderFactory) probe(ctx context.Context, storageRoot string) error {
+	root, err := loadStorageRootByName(ctx, f.db, storageRoot)
+	if err != nil {
+		return err
+	}
+	client, err := f.clients.NewClient(root)
+	if err != nil {
+		return fmt.Errorf("failed to create client for %s: %w", root.Name, err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", root.Name, err)
+	}
+	return client.Disconnect(ctx)
+}
+
+// scheduled wraps a provider in its root's scheduler when IO scheduling
+// is enabled.
+func (f *StorageProviderFactory) scheduled(root string, provider StorageProvider) StorageProvider {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ioScheduling == nil {
+		return provider
+	}
+	scheduler, ok := f.schedulers[root]
+	if !ok {
+		scheduler = newIOScheduler(root, *f.ioScheduling)
+		f.schedulers[root] = scheduler
+	}
+	return &scheduledProvider{StorageProvider: provider, scheduler: scheduler}
+}
+
+// ProviderFor connects to a storage root and returns its provider, which
+// names files in their catalog form (see nameSafeProvider). While the
+// root's circuit breaker is open it returns a StorageUnavailableError
+// without connecting.
+func (f *StorageProviderFactory) ProviderFor(ctx context.Context, root *models.StorageRoot) (StorageProvider, error) {
+	f.mu.RLock()
+	breakers := f.breakers
+	f.mu.RUnlock()
+	if breakers != nil {
+		if err := breakers.Allow(root.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := f.clients.NewClient(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s: %w", root.Name, err)
+	}
+	if err := f.connect(ctx, breakers, root.Name, client); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", root.Name, err)
+	}
+
+	protocol := strings.ToLower(root.Protocol)
+	f.mu.RLock()
+	constructor, ok := f.constructors[protocol]
+	f.mu.RUnlock()
+	var provider StorageProvider
+	if ok {
+		provider = newNameSafeProvider(constructor(root, client))
+	} else {
+		provider = newNameSafeProvider(&clientStorageProvider{protocol: protocol, client: client, pollInterval: time.Minute})
+	}
+	if breakers != nil {
+		provider = &breakerProvider{StorageProvider: provider, root: root.Name, breakers: breakers}
+	}
+	return f.scheduled(root.Name, provider), nil
+}
+
+// connect connects a client, within the breakers' connect timeout when
+// they are set, and counts the outcome in the root's breaker.
+func (f *StorageProviderFactory) connect(ctx context.Context, breakers *StorageBreakers, root string, client filesystem.FileSystemClient) error {
+	if breakers == nil {
+		return client.Connect(ctx)
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, breakers.config.ConnectTimeout)
+	defer cancel()
+	err := client.Connect(connectCtx)
+	breakers.Record(root, err)
+	return err
+}
+
+// Provider connects to the storage root with the given name.
+func (f *StorageProviderFactory) Provider(ctx context.Context, storageRoot string) (StorageProvider, error) {
+	root, err := loadStorageRootByName(ctx, f.db, storageRoot)
+	if err != nil {
+		return nil, err
+	}
+	return f.ProviderFor(ctx, root)
+}
+
+// List lists a directory of a storage root. When the root cannot be
+// reached, the directory's latest listing is served from cache if there
+// is one.
+func (f *StorageProviderFactory) List(ctx context.Context, storageRoot, dir string) (*StorageListing, error) {
+	provider, err := f.Provider(ctx, storageRoot)
+	reached := err == nil
+	if reached {
+		defer provider.Close()
+		var entries []*filesystem.FileInfo
+		if entries, err = provider.List(ctx, dir); err == nil {
+			return &StorageListing{Entries: entries}, nil
+		}
+	}
+
+	f.mu.RLock()
+	breakers := f.breakers
+	f.mu.RUnlock()
+	if breakers == nil || errors.Is(err, context.Canceled) || (reached && !storageFailure(err)) {
+		return nil, err
+	}
+	entries, cachedAt, ok := breakers.CachedListing(storageRoot, dir)
+	if !ok {
+		return nil, err
+	}
+	return &StorageListing{Entries: entries, CachedAt: &cachedAt}, nil
+}
+
+// StorageRootInfo names a configured storage root and its protocol.
+type StorageRootInfo struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+}
+
+// Roots lists the configured storage roots.
+func (f *StorageProviderFactory) Roots(ctx context.Context) ([]StorageRootInfo, error) {
+	rows, err := f.db.QueryContext(ctx, `SELECT name, protocol FROM storage_roots ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage roots: %w", err)
+	}
+	defer rows.Close()
+
+	var roots []StorageRootInfo
+	for rows.Next() {
+		var r StorageRootInfo
+		if err := rows.Scan(&r.Name, &r.Protocol); err != nil {
+			return nil, fmt.Errorf("failed to scan storage root: %w", err)
+		}
+		roots = append(roots, r)
+	}
+	return roots, rows.Err()
+}
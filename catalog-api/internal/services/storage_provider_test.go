@@ -0,0 +1,220 @@
+package services
+
+import (
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func connectedLocalClient(t *testing.T, dir string) filesystem.FileSystemClient {
+	t.Helper()
+	client := filesystem.NewLocalClient(&filesystem.LocalConfig{BasePath: dir})
+	require.NoError(t, client.Connect(context.Background()))
+	return client
+}
+
+func readProviderFile(t *testing.T, p StorageProvider, file string) string {
+	t.Helper()
+	reader, err := p.Open(context.Background(), file)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLocalStorageProvider_ReadWriteCopy(t *testing.T) {
+	dir := t.TempDir()
+	p := NewLocalStorageProvider(connectedLocalClient(t, dir), dir)
+	defer p.Close()
+	ctx := context.Background()
+
+	assert.Equal(t, "local", p.Protocol())
+	require.NoError(t, p.Write(ctx, "films/2024/a.mkv", strings.NewReader("film")))
+	assert.Equal(t, "film", readProviderFile(t, p, "films/2024/a.mkv"))
+
+	info, err := p.Stat(ctx, "films/2024/a.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), info.Size)
+
+	require.NoError(t, p.Copy(ctx, "films/2024/a.mkv", "backup/films/a.mkv"))
+	assert.Equal(t, "film", readProviderFile(t, p, "backup/films/a.mkv"))
+
+	exists, err := p.Exists(ctx, "backup/films/a.mkv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	entries, err := p.List(ctx, "films/2024")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a.mkv", entries[0].Name)
+}
+
+func TestLocalStorageProvider_IdentifyStaysInRoot(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "root")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	p := NewLocalStorageProvider(connectedLocalClient(t, dir), dir)
+	defer p.Close()
+	ctx := context.Background()
+
+	_, err := p.Identify(ctx, "a.txt")
+	require.NoError(t, err)
+	// Paths climbing out of the root are taken from the root
+	_, err = p.Identify(ctx, "../secret")
+	assert.True(t, os.IsNotExist(err), "got %v", err)
+}
+
+func TestClientStorageProvider_CreatesParentsOneLevelAtATime(t *testing.T) {
+	dir := t.TempDir()
+	p := &clientStorageProvider{protocol: "ftp", client: connectedLocalClient(t, dir), pollInterval: time.Minute}
+	ctx := context.Background()
+
+	require.NoError(t, p.Write(ctx, "/a/b/c/file.txt", strings.NewReader("x")))
+	data, err := os.ReadFile(filepath.Join(dir, "a", "b", "c", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(data))
+}
+
+func TestLocalStorageProvider_Watch(t *testing.T) {
+	dir := t.TempDir()
+	p := NewLocalStorageProvider(connectedLocalClient(t, dir), dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := p.Watch(ctx, ".")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("x"), 0644))
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, StorageEventCreate, ev.Op)
+		assert.Equal(t, "new.txt", ev.Path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for created file")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestClientStorageProvider_WatchPolls(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gone.txt"), []byte("x"), 0644))
+	p := &clientStorageProvider{protocol: "webdav", client: connectedLocalClient(t, dir), pollInterval: 20 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := p.Watch(ctx, "/")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("x"), 0644))
+
+	seen := map[string]string{}
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 2 {
+		select {
+		case ev := <-events:
+			seen[ev.Path] = ev.Op
+		case <-timeout:
+			t.Fatalf("missing events, got %v", seen)
+		}
+	}
+	assert.Equal(t, StorageEventDelete, seen["/gone.txt"])
+	assert.Equal(t, StorageEventCreate, seen["/new.txt"])
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	now := time.Now()
+	previous := map[string]snapshotEntry{
+		"a": {size: 1, modified: now},
+		"b": {size: 1, modified: now},
+		"c": {size: 1, modified: now},
+	}
+	current := map[string]snapshotEntry{
+		"a": {size: 1, modified: now},
+		"b": {size: 2, modified: now},
+		"d": {size: 1, modified: now},
+	}
+
+	ops := map[string]string{}
+	for _, ev := range diffSnapshots(previous, current) {
+		ops[ev.Path] = ev.Op
+	}
+	assert.Equal(t, map[string]string{"b": StorageEventModify, "c": StorageEventDelete, "d": StorageEventCreate}, ops)
+}
+
+func TestStorageProviderFactory_ResolvesByProtocol(t *testing.T) {
+	db := setupTieringTestDB(t)
+	localDir, otherDir := t.TempDir(), t.TempDir()
+	_, err := db.ExecContext(context.Background(),
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('media', 'local', ?), ('mirror', 'sftp', ?)`,
+		localDir, otherDir)
+	require.NoError(t, err)
+	factory := NewStorageProviderFactory(db, localRootClients{}, zap.NewNop())
+	ctx := context.Background()
+
+	p, err := factory.Provider(ctx, "media")
+	require.NoError(t, err)
+	assert.IsType(t, &LocalStorageProvider{}, p)
+	p.Close()
+
+	// Unregistered protocols fall back to the generic polling provider
+	p, err = factory.Provider(ctx, "mirror")
+	require.NoError(t, err)
+	assert.Equal(t, "sftp", p.Protocol())
+	p.Close()
+
+	factory.Register("sftp", func(root *models.StorageRoot, client filesystem.FileSystemClient) StorageProvider {
+		return NewNFSStorageProvider(client)
+	})
+	p, err = factory.Provider(ctx, "mirror")
+	require.NoError(t, err)
+	assert.IsType(t, &NFSStorageProvider{}, p)
+	p.Close()
+
+	_, err = factory.Provider(ctx, "missing")
+	assert.Error(t, err)
+
+	roots, err := factory.Roots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []StorageRootInfo{{Name: "media", Protocol: "local"}, {Name: "mirror", Protocol: "sftp"}}, roots)
+}
+
+func TestStorageProviderFactory_IOScheduling(t *testing.T) {
+	db := setupTieringTestDB(t)
+	dir := t.TempDir()
+	_, err := db.ExecContext(context.Background(),
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('media', 'local', ?)`, dir)
+	require.NoError(t, err)
+	factory := NewStorageProviderFactory(db, localRootClients{}, zap.NewNop())
+	factory.SetIOScheduling(IOSchedulerConfig{Slots: 2})
+	ctx := WithIOPriority(context.Background(), IOPriorityTransfer)
+
+	p, err := factory.Provider(ctx, "media")
+	require.NoError(t, err)
+	defer p.Close()
+	assert.Equal(t, "local", p.Protocol())
+	require.NoError(t, p.Write(ctx, "films/a.mkv", strings.NewReader("film")))
+	assert.Equal(t, "film", readProviderFile(t, p, "films/a.mkv"))
+
+	// Providers of one root share its scheduler
+	other, err := factory.Provider(ctx, "media")
+	require.NoError(t, err)
+	defer other.Close()
+	require.IsType(t, &scheduledProvider{}, p)
+	assert.Same(t, p.(*scheduledProvider).scheduler, other.(*scheduledProvider).scheduler)
+}
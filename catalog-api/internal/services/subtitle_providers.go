@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultOpenSubtitlesURL is the REST API used for OpenSubtitles unless
+// SetProviderConfig points the service at a compatible mirror.
+const defaultOpenSubtitlesURL = "https://api.opensubtitles.com/api/v1"
+
+// subtitleUserAgent identifies the API to subtitle providers.
+const subtitleUserAgent = "Catalogizer v1.0"
+
+// SetProviderConfig sets the base URL and API key used for a provider. An
+// empty baseURL keeps the current one.
+func (s *SubtitleService) SetProviderConfig(provider SubtitleProvider, baseURL, apiKey string) {
+	if baseURL != "" {
+		s.providerURLs[provider] = strings.TrimRight(baseURL, "/")
+	}
+	s.apiKeys[string(provider)] = apiKey
+}
+
+// SetKeyPool makes OpenSubtitles requests take their API keys from pool,
+// when it has OpenSubtitles keys, rotating to the next key on 429s.
+func (s *SubtitleService) SetKeyPool(pool *ProviderKeyPool) {
+	s.keys = pool
+}
+
+// openSubtitlesSearchResponse is the body of GET /subtitles on an
+// OpenSubtitles-compatible API.
+type openSubtitlesSearchResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Language        string    `json:"language"`
+			DownloadCount   int       `json:"download_count"`
+			Ratings         float64   `json:"ratings"`
+			HearingImpaired bool      `json:"hearing_impaired"`
+			FPS             float64   `json:"fps"`
+			UploadDate      time.Time `json:"upload_date"`
+			Release         string    `json:"release"`
+			MovieHashMatch  bool      `json:"moviehash_match"`
+			FeatureDetails  struct {
+				Title string `json:"title"`
+				Year  int    `json:"year"`
+			} `json:"feature_details"`
+			Files []struct {
+				FileID   int64  `json:"file_id"`
+				FileName string `json:"file_name"`
+			} `json:"files"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// openSubtitlesDownloadResponse is the body of POST /download.
+type openSubtitlesDownloadResponse struct {
+	Link     string `json:"link"`
+	FileName string `json:"file_name"`
+}
+
+// openSubtitlesRequest sends an authenticated request to the configured
+// OpenSubtitles-compatible API and decodes the JSON response into dest.
+func (s *SubtitleService) openSubtitlesRequest(ctx context.Context, method, endpoint string, body interface{}, dest interface{}) error {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+
+	send := func(apiKey string) error {
+		req, err := http.NewRequestWithContext(ctx, method, s.providerURLs[ProviderOpenSubtitles]+endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Api-Key", apiKey)
+		req.Header.Set("User-Agent", subtitleUserAgent)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return providerRateLimited(resp)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("opensubtitles returned status %d", resp.StatusCode)
+		}
+		return json.NewDecoder(resp.Body).Decode(dest)
+	}
+
+	if s.keys != nil && s.keys.HasKeys(string(ProviderOpenSubtitles)) {
+		return s.keys.Do(ctx, string(ProviderOpenSubtitles), send)
+	}
+	apiKey := s.apiKeys[string(ProviderOpenSubtitles)]
+	if apiKey == "" {
+		return fmt.Errorf("opensubtitles API key not configured")
+	}
+	return send(apiKey)
+}
+
+// searchOpenSubtitles queries an OpenSubtitles-compatible API. Every file
+// of every match becomes one result, cached so it can be downloaded by ID.
+func (s *SubtitleService) searchOpenSubtitles(ctx context.Context, request *SubtitleSearchRequest) ([]SubtitleSearchResult, error) {
+	s.logger.Debug("Searching OpenSubtitles", zap.String("title", getStringValue(request.Title)))
+
+	params := url.Values{}
+	query := getStringValue(request.Title)
+	if query == "" {
+		base := path.Base(strings.ReplaceAll(request.MediaPath, "\\", "/"))
+		query = strings.TrimSuffix(base, path.Ext(base))
+	}
+	params.Set("query", query)
+	if len(request.Languages) > 0 {
+		params.Set("languages", strings.Join(request.Languages, ","))
+	}
+	if request.Year != nil {
+		params.Set("year", strconv.Itoa(*request.Year))
+	}
+	if request.Season != nil {
+		params.Set("season_number", strconv.Itoa(*request.Season))
+	}
+	if request.Episode != nil {
+		params.Set("episode_number", strconv.Itoa(*request.Episode))
+	}
+	if request.FileHash != nil {
+		params.Set("moviehash", *request.FileHash)
+	}
+
+	var response openSubtitlesSearchResponse
+	if err := s.openSubtitlesRequest(ctx, http.MethodGet, "/subtitles?"+params.Encode(), nil, &response); err != nil {
+		return nil, fmt.Errorf("opensubtitles search failed: %w", err)
+	}
+
+	results := []SubtitleSearchResult{}
+	for _, item := range response.Data {
+		attrs := item.Attributes
+		title := attrs.Release
+		if title == "" {
+			title = attrs.FeatureDetails.Title
+		}
+		matchScore := 0.7
+		if attrs.MovieHashMatch {
+			matchScore = 1.0
+		}
+		var frameRate *float64
+		if attrs.FPS > 0 {
+			fps := attrs.FPS
+			frameRate = &fps
+		}
+
+		for _, file := range attrs.Files {
+			format := strings.TrimPrefix(strings.ToLower(path.Ext(file.FileName)), ".")
+			if format == "" {
+				format = "srt"
+			}
+			result := SubtitleSearchResult{
+				ID:                fmt.Sprintf("%s_%d", ProviderOpenSubtitles, file.FileID),
+				Provider:          ProviderOpenSubtitles,
+				Language:          getLanguageName(attrs.Language),
+				LanguageCode:      attrs.Language,
+				Title:             title,
+				Format:            format,
+				Encoding:          "utf-8",
+				UploadDate:        attrs.UploadDate,
+				Downloads:         attrs.DownloadCount,
+				Rating:            attrs.Ratings,
+				IsHearingImpaired: attrs.HearingImpaired,
+				FrameRate:         frameRate,
+				MovieHash:         request.FileHash,
+				MatchScore:        matchScore,
+			}
+			s.cacheSearchResult(ctx, result)
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// cacheSearchResult keeps a search result for a day so a later download
+// request can refer to it by ID.
+func (s *SubtitleService) cacheSearchResult(ctx context.Context, result SubtitleSearchResult) {
+	if s.cacheService == nil {
+		return
+	}
+	cacheKey := fmt.Sprintf("subtitle_download_info:%s", result.ID)
+	if err := s.cacheService.Set(ctx, cacheKey, result, 24*time.Hour); err != nil {
+		s.logger.Warn("Failed to cache subtitle search result",
+			zap.String("result_id", result.ID), zap.Error(err))
+	}
+}
+
+// resolveDownloadURL asks the provider for a download link for a result
+// that does not carry one.
+func (s *SubtitleService) resolveDownloadURL(ctx context.Context, result *SubtitleSearchResult) error {
+	switch result.Provider {
+	case ProviderOpenSubtitles:
+		fileID, err := strconv.ParseInt(strings.TrimPrefix(result.ID, string(ProviderOpenSubtitles)+"_"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid opensubtitles result ID: %s", result.ID)
+		}
+		var response openSubtitlesDownloadResponse
+		if err := s.openSubtitlesRequest(ctx, http.MethodPost, "/download",
+			map[string]int64{"file_id": fileID}, &response); err != nil {
+			return err
+		}
+		if response.Link == "" {
+			return fmt.Errorf("opensubtitles returned no download link")
+		}
+		result.DownloadURL = response.Link
+		if ext := strings.TrimPrefix(strings.ToLower(path.Ext(response.FileName)), "."); ext != "" {
+			result.Format = ext
+		}
+		return nil
+	default:
+		return fmt.Errorf("no download link for %s result %s", result.Provider, result.ID)
+	}
+}
@@ -31,6 +31,9 @@ type SubtitleService struct {
 	cacheService       CacheServiceInterface
 	httpClient         *http.Client
 	apiKeys            map[string]string
+	keys               *ProviderKeyPool
+	providerURLs       map[SubtitleProvider]string
+	clients            storageClientProvider
 	cacheDir           string
 	wg                 sync.WaitGroup // Tracks running goroutines for graceful shutdown
 	shutdown           chan struct{}  // Signals goroutines to stop
@@ -160,6 +163,7 @@ func NewSubtitleService(db *database.DB, logger *zap.Logger, cacheService CacheS
 		cacheService:       cacheService,
 		httpClient:         &http.Client{Timeout: 30 * time.Second},
 		apiKeys:            make(map[string]string),
+		providerURLs:       map[SubtitleProvider]string{ProviderOpenSubtitles: defaultOpenSubtitlesURL},
 		cacheDir:           "./cache/subtitles",
 		shutdown:           make(chan struct{}),
 	}
@@ -239,6 +243,17 @@ func (s *SubtitleService) DownloadSubtitle(ctx context.Context, request *Subtitl
 	if err != nil {
 		return nil, fmt.Errorf("failed to get download info: %w", err)
 	}
+	if result.LanguageCode == "" {
+		result.LanguageCode = request.Language
+		result.Language = getLanguageName(request.Language)
+	}
+
+	// Providers like OpenSubtitles hand out short-lived links on request
+	if result.DownloadURL == "" {
+		if err := s.resolveDownloadURL(ctx, result); err != nil {
+			return nil, fmt.Errorf("failed to get download link: %w", err)
+		}
+	}
 
 	// Download subtitle content
 	content, encoding, err := s.downloadContent(ctx, result.DownloadURL)
@@ -260,7 +275,6 @@ func (s *SubtitleService) DownloadSubtitle(ctx context.Context, request *Subtitl
 		Source:       "downloaded",
 		Format:       result.Format,
 		Content:      &content,
-		Path:         &result.DownloadURL, // Use download URL as path initially
 		IsDefault:    false,
 		IsForced:     false,
 		Encoding:     encoding,
@@ -280,6 +294,12 @@ func (s *SubtitleService) DownloadSubtitle(ctx context.Context, request *Subtitl
 		}
 	}
 
+	// Store the file next to the media file
+	if err := s.storeSubtitleFile(ctx, request.MediaItemID, track); err != nil {
+		s.logger.Warn("Failed to store subtitle file alongside media",
+			zap.Int64("media_item_id", request.MediaItemID), zap.Error(err))
+	}
+
 	// Save to database
 	if err := s.saveSubtitleTrack(ctx, request.MediaItemID, track); err != nil {
 		return nil, fmt.Errorf("failed to save subtitle track: %w", err)
@@ -477,34 +497,6 @@ func (s *SubtitleService) searchProvider(ctx context.Context, provider SubtitleP
 	}
 }
 
-func (s *SubtitleService) searchOpenSubtitles(ctx context.Context, request *SubtitleSearchRequest) ([]SubtitleSearchResult, error) {
-	// Implementation for OpenSubtitles API
-	// This is a simplified version - real implementation would use their API
-
-	s.logger.Debug("Searching OpenSubtitles", zap.String("title", getStringValue(request.Title)))
-
-	// Mock results for demonstration
-	results := []SubtitleSearchResult{
-		{
-			ID:           "opensubtitles_1",
-			Provider:     ProviderOpenSubtitles,
-			Language:     "English",
-			LanguageCode: "en",
-			Title:        "Sample Movie (2024)",
-			DownloadURL:  "https://dl.opensubtitles.org/sample1.srt",
-			Format:       "srt",
-			Encoding:     "utf-8",
-			UploadDate:   time.Now().AddDate(0, 0, -7),
-			Downloads:    1500,
-			Rating:       4.2,
-			Comments:     23,
-			MatchScore:   0.95,
-		},
-	}
-
-	return results, nil
-}
-
 func (s *SubtitleService) searchSubDB(ctx context.Context, request *SubtitleSearchRequest) ([]SubtitleSearchResult, error) {
 	// Implementation for SubDB
 	s.logger.Debug("Searching SubDB")
@@ -519,18 +511,6 @@ func (s *SubtitleService) searchYifySubtitles(ctx context.Context, request *Subt
 
 // Helper functions
 func (s *SubtitleService) downloadContent(ctx context.Context, url string) (string, string, error) {
-	// For testing, return mock subtitle content
-	if url == "https://dl.opensubtitles.org/1.srt" {
-		content := `1
-00:00:01,000 --> 00:00:03,000
-Test subtitle line 1
-
-2
-00:00:04,000 --> 00:00:06,000
-Test subtitle line 2`
-		return content, "utf-8", nil
-	}
-
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", "", err
@@ -541,6 +521,9 @@ Test subtitle line 2`
 		return "", "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
 
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -925,16 +908,14 @@ func (s *SubtitleService) getDownloadInfo(ctx context.Context, resultID string)
 	var reconstructedResult *SubtitleSearchResult
 	switch provider {
 	case ProviderOpenSubtitles:
+		// The language comes from the download request and the link is
+		// requested from the API at download time
 		reconstructedResult = &SubtitleSearchResult{
-			ID:           resultID,
-			Provider:     ProviderOpenSubtitles,
-			Language:     "English", // Default, would be determined from actual API
-			LanguageCode: "en",
-			Title:        "Unknown Title", // Would be fetched from API
-			DownloadURL:  "https://dl.opensubtitles.org/1.srt",
-			Format:       "srt",
-			Encoding:     "utf-8",
-			MatchScore:   0.9,
+			ID:         resultID,
+			Provider:   ProviderOpenSubtitles,
+			Format:     "srt",
+			Encoding:   "utf-8",
+			MatchScore: 0.9,
 		}
 	case ProviderSubDB:
 		reconstructedResult = &SubtitleSearchResult{
@@ -1025,12 +1006,16 @@ func (s *SubtitleService) saveSubtitleTrack(ctx context.Context, mediaItemID int
 		zap.Int("verified_sync", verifiedSync),
 		zap.Time("created_at", track.CreatedAt))
 
-	_, err := s.db.ExecContext(ctx, query,
+	id, err := s.db.InsertReturningID(ctx, query,
 		mediaItemID, track.Language, track.LanguageCode, track.Source,
 		track.Format, content, path, isDefault, isForced,
 		track.Encoding, track.SyncOffset, verifiedSync, track.CreatedAt)
+	if err != nil {
+		return err
+	}
 
-	return err
+	track.ID = strconv.FormatInt(id, 10)
+	return nil
 }
 
 // autoTranslateSubtitle automatically translates a subtitle to multiple languages
@@ -1079,6 +1064,12 @@ func (s *SubtitleService) SaveUploadedSubtitle(ctx context.Context, req *Subtitl
 		VerifiedSync: false, // Uploaded subtitles need sync verification
 	}
 
+	// Store the file next to the media file
+	if err := s.storeSubtitleFile(ctx, req.MediaID, track); err != nil {
+		s.logger.Warn("Failed to store subtitle file alongside media",
+			zap.Int64("media_id", req.MediaID), zap.Error(err))
+	}
+
 	// Save the subtitle track
 	err = s.saveSubtitleTrack(ctx, req.MediaID, track)
 	if err != nil {
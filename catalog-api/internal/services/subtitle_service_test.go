@@ -3,6 +3,9 @@ package services
 import (
 	"catalogizer/database"
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -66,12 +69,43 @@ func TestNewSubtitleService(t *testing.T) {
 	assert.Equal(t, "./cache/subtitles", service.cacheDir)
 }
 
+// newOpenSubtitlesTestServer serves an OpenSubtitles-compatible search and
+// download API with one English match.
+func newOpenSubtitlesTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/subtitles":
+			assert.Equal(t, "Test Movie", r.URL.Query().Get("query"))
+			fmt.Fprint(w, `{"data":[{"id":"9","attributes":{"language":"en","download_count":1500,
+				"ratings":4.2,"fps":23.976,"release":"Test.Movie.2023.1080p","moviehash_match":true,
+				"files":[{"file_id":123,"file_name":"Test.Movie.2023.srt"}]}}]}`)
+		case "/download":
+			fmt.Fprintf(w, `{"link":"%s/files/123.srt","file_name":"Test.Movie.2023.srt"}`, server.URL)
+		case "/files/123.srt":
+			fmt.Fprint(w, "1\n00:00:01,000 --> 00:00:03,000\nTest subtitle line 1\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
 func TestSubtitleService_SearchSubtitles(t *testing.T) {
 	mockDB := database.WrapDB(nil, database.DialectSQLite)
 	mockLogger := zap.NewNop()
 	mockCache := &MockCacheService{}
+	mockCache.On("Set", mock.Anything, "subtitle_download_info:opensubtitles_123", mock.AnythingOfType("services.SubtitleSearchResult"), 24*time.Hour).Return(nil)
 
 	service := NewSubtitleService(mockDB, mockLogger, mockCache)
+	service.SetProviderConfig(ProviderOpenSubtitles, newOpenSubtitlesTestServer(t).URL, "test-key")
 
 	request := &SubtitleSearchRequest{
 		MediaPath: "/path/to/movie.mp4",
@@ -84,21 +118,26 @@ func TestSubtitleService_SearchSubtitles(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.NotNil(t, results)
-	// Should return results from OpenSubtitles (mock data)
 	assert.Greater(t, len(results), 0)
-	assert.Equal(t, "opensubtitles_1", results[0].ID)
+	assert.Equal(t, "opensubtitles_123", results[0].ID)
 	assert.Equal(t, ProviderOpenSubtitles, results[0].Provider)
+	assert.Equal(t, "English", results[0].Language)
+	assert.Equal(t, "Test.Movie.2023.1080p", results[0].Title)
+	assert.Equal(t, 1.0, results[0].MatchScore)
+	mockCache.AssertExpectations(t)
 }
 
 func TestSubtitleService_SearchSubtitles_MultipleProviders(t *testing.T) {
 	mockDB := database.WrapDB(nil, database.DialectSQLite)
 	mockLogger := zap.NewNop()
 	mockCache := &MockCacheService{}
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	service := NewSubtitleService(mockDB, mockLogger, mockCache)
+	service.SetProviderConfig(ProviderOpenSubtitles, newOpenSubtitlesTestServer(t).URL, "test-key")
 
 	request := &SubtitleSearchRequest{
-		MediaPath: "/path/to/movie.mp4",
+		MediaPath: "/path/to/Test Movie.mp4",
 		Languages: []string{"en"},
 		Providers: []SubtitleProvider{ProviderOpenSubtitles, ProviderSubDB},
 	}
@@ -111,6 +150,20 @@ func TestSubtitleService_SearchSubtitles_MultipleProviders(t *testing.T) {
 	assert.Greater(t, len(results), 0)
 }
 
+func TestSubtitleService_SearchSubtitles_NoAPIKey(t *testing.T) {
+	mockDB := database.WrapDB(nil, database.DialectSQLite)
+	mockCache := &MockCacheService{}
+	service := NewSubtitleService(mockDB, zap.NewNop(), mockCache)
+
+	_, err := service.searchOpenSubtitles(context.Background(), &SubtitleSearchRequest{MediaPath: "/movie.mp4"})
+	assert.ErrorContains(t, err, "API key not configured")
+
+	// Failing providers are skipped
+	results, err := service.SearchSubtitles(context.Background(), &SubtitleSearchRequest{MediaPath: "/movie.mp4"})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
 func TestSubtitleService_ParseSRT(t *testing.T) {
 	mockDB := database.WrapDB(nil, database.DialectSQLite)
 	mockLogger := zap.NewNop()
@@ -244,9 +297,9 @@ func TestSubtitleService_GetDownloadInfo_OpenSubtitles(t *testing.T) {
 	assert.NotNil(t, result)
 	assert.Equal(t, "opensubtitles_123", result.ID)
 	assert.Equal(t, ProviderOpenSubtitles, result.Provider)
-	assert.Equal(t, "English", result.Language)
-	assert.Equal(t, "en", result.LanguageCode)
-	assert.Contains(t, result.DownloadURL, "dl.opensubtitles.org")
+	// Language comes from the download request, the link from the API
+	assert.Empty(t, result.LanguageCode)
+	assert.Empty(t, result.DownloadURL)
 	assert.Equal(t, "srt", result.Format)
 }
 
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/filesystem"
+
+	"go.uber.org/zap"
+)
+
+// SetStorageClients enables storing subtitle files next to their media
+// files on the media's storage root. Without clients subtitles are kept in
+// the database only.
+func (s *SubtitleService) SetStorageClients(clients storageClientProvider) {
+	s.clients = clients
+}
+
+// SubtitleResyncRequest shifts subtitle timestamps by an offset and, when
+// both frame rates are given, rescales them from the frame rate the
+// subtitle was timed for to the frame rate of the video.
+type SubtitleResyncRequest struct {
+	OffsetMs        int64   `json:"offset_ms"`
+	SourceFrameRate float64 `json:"source_frame_rate,omitempty"`
+	TargetFrameRate float64 `json:"target_frame_rate,omitempty"`
+}
+
+// Validate checks that the request changes something and that frame rates
+// are given in pairs.
+func (r *SubtitleResyncRequest) Validate() error {
+	if r.SourceFrameRate < 0 || r.TargetFrameRate < 0 {
+		return fmt.Errorf("invalid re-sync request: frame rates must be positive")
+	}
+	if (r.SourceFrameRate == 0) != (r.TargetFrameRate == 0) {
+		return fmt.Errorf("invalid re-sync request: source_frame_rate and target_frame_rate must be set together")
+	}
+	if r.OffsetMs == 0 && r.SourceFrameRate == r.TargetFrameRate {
+		return fmt.Errorf("invalid re-sync request: offset_ms or a frame rate change is required")
+	}
+	return nil
+}
+
+// subtitleTimestampPattern matches SRT (00:01:02,345) and WebVTT
+// (00:01:02.345 or 01:02.345) timestamps.
+var subtitleTimestampPattern = regexp.MustCompile(`(?:(\d+):)?(\d{2}):(\d{2})[,.](\d{3})`)
+
+// resyncSubtitleContent rewrites every cue timing line of SRT or WebVTT
+// content. Text, cue settings and headers are left untouched. Times that
+// would become negative are clamped to zero.
+func resyncSubtitleContent(content, format string, request *SubtitleResyncRequest) (string, error) {
+	format = strings.ToLower(format)
+	if format != "srt" && format != "vtt" {
+		return "", fmt.Errorf("unsupported format for re-sync: %s", format)
+	}
+
+	scale := 1.0
+	if request.SourceFrameRate > 0 && request.TargetFrameRate > 0 {
+		scale = request.SourceFrameRate / request.TargetFrameRate
+	}
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, "-->") {
+			continue
+		}
+		lines[i] = subtitleTimestampPattern.ReplaceAllStringFunc(line, func(ts string) string {
+			m := subtitleTimestampPattern.FindStringSubmatch(ts)
+			hours, _ := strconv.ParseInt(m[1], 10, 64)
+			minutes, _ := strconv.ParseInt(m[2], 10, 64)
+			seconds, _ := strconv.ParseInt(m[3], 10, 64)
+			millis, _ := strconv.ParseInt(m[4], 10, 64)
+			total := ((hours*60+minutes)*60+seconds)*1000 + millis
+
+			shifted := int64(math.Round(float64(total)*scale)) + request.OffsetMs
+			if shifted < 0 {
+				shifted = 0
+			}
+			return formatSubtitleTimestamp(shifted, format)
+		})
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatSubtitleTimestamp formats milliseconds as an SRT or WebVTT
+// timestamp.
+func formatSubtitleTimestamp(ms int64, format string) string {
+	separator := ","
+	if format == "vtt" {
+		separator = "."
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		ms/3600000, (ms/60000)%60, (ms/1000)%60, separator, ms%1000)
+}
+
+// ResyncSubtitle rewrites the timestamps of a stored subtitle track and of
+// its file next to the media. The detected sync offset is cleared and the
+// track has to be verified again.
+func (s *SubtitleService) ResyncSubtitle(ctx context.Context, subtitleID string, request *SubtitleResyncRequest) (*SubtitleTrack, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	var mediaItemID int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT media_item_id FROM subtitle_tracks WHERE id = ?`, subtitleID).Scan(&mediaItemID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("subtitle track %s not found", subtitleID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subtitle track: %w", err)
+	}
+
+	track, err := s.getSubtitleTrack(ctx, subtitleID)
+	if err != nil {
+		return nil, err
+	}
+	if track.Content == nil || *track.Content == "" {
+		return nil, fmt.Errorf("subtitle track %s has no content", subtitleID)
+	}
+
+	content, err := resyncSubtitleContent(*track.Content, track.Format, request)
+	if err != nil {
+		return nil, err
+	}
+	track.Content = &content
+	track.SyncOffset = 0
+	track.VerifiedSync = false
+
+	if track.Path != nil && *track.Path != "" && s.clients != nil {
+		if err := s.writeSubtitleFile(ctx, mediaItemID, *track.Path, content); err != nil {
+			return nil, fmt.Errorf("failed to rewrite subtitle file: %w", err)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE subtitle_tracks SET content = ?, sync_offset = 0, verified_sync = 0, updated_at = ? WHERE id = ?`,
+		content, time.Now(), subtitleID); err != nil {
+		return nil, fmt.Errorf("failed to save re-synced subtitle: %w", err)
+	}
+
+	s.logger.Info("Subtitle re-synced",
+		zap.String("subtitle_id", subtitleID),
+		zap.Int64("offset_ms", request.OffsetMs),
+		zap.Float64("source_frame_rate", request.SourceFrameRate),
+		zap.Float64("target_frame_rate", request.TargetFrameRate))
+
+	return track, nil
+}
+
+// connectMediaRoot connects to the storage root holding a media file and
+// returns the client with the media file's path. The caller disconnects.
+func (s *SubtitleService) connectMediaRoot(ctx context.Context, mediaItemID int64) (filesystem.FileSystemClient, string, error) {
+	var rootName, mediaPath string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT sr.name, f.path FROM files f JOIN storage_roots sr ON sr.id = f.storage_root_id
+		 WHERE f.id = ?`, mediaItemID).Scan(&rootName, &mediaPath)
+	if err == sql.ErrNoRows {
+		return nil, "", fmt.Errorf("media file %d not found", mediaItemID)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load media file %d: %w", mediaItemID, err)
+	}
+
+	root, err := loadStorageRootByName(ctx, s.db, rootName)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := s.clients.NewClient(root)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create client for %s: %w", rootName, err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to connect to %s: %w", rootName, err)
+	}
+	return client, mediaPath, nil
+}
+
+// storeSubtitleFile writes a track's content next to its media file as
+// <name>.<language>.<format>, adding a counter when that name is taken, and
+// records the path on the track. It does nothing without storage clients.
+func (s *SubtitleService) storeSubtitleFile(ctx context.Context, mediaItemID int64, track *SubtitleTrack) error {
+	if s.clients == nil || track.Content == nil {
+		return nil
+	}
+	client, mediaPath, err := s.connectMediaRoot(ctx, mediaItemID)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	base := strings.TrimSuffix(mediaPath, path.Ext(mediaPath))
+	language := track.LanguageCode
+	if language == "" {
+		language = "und"
+	}
+	format := strings.ToLower(track.Format)
+	target := fmt.Sprintf("%s.%s.%s", base, language, format)
+	for n := 2; ; n++ {
+		exists, err := client.FileExists(ctx, target)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", target, err)
+		}
+		if !exists {
+			break
+		}
+		target = fmt.Sprintf("%s.%s.%d.%s", base, language, n, format)
+	}
+
+	if err := client.WriteFile(ctx, target, strings.NewReader(*track.Content)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	track.Path = &target
+	return nil
+}
+
+// writeSubtitleFile overwrites a stored subtitle file on the storage root of
+// its media file.
+func (s *SubtitleService) writeSubtitleFile(ctx context.Context, mediaItemID int64, filePath, content string) error {
+	client, _, err := s.connectMediaRoot(ctx, mediaItemID)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	return client.WriteFile(ctx, filePath, strings.NewReader(content))
+}
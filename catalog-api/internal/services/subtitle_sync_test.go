@@ -0,0 +1,153 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestResyncSubtitleContent(t *testing.T) {
+	srt := "1\n00:00:01,000 --> 00:00:03,500\nHello\n\n2\n00:01:00,000 --> 00:01:02,000\n00:00:05,000 is not a timing\n"
+
+	shifted, err := resyncSubtitleContent(srt, "srt", &SubtitleResyncRequest{OffsetMs: 1500})
+	require.NoError(t, err)
+	assert.Equal(t, "1\n00:00:02,500 --> 00:00:05,000\nHello\n\n2\n00:01:01,500 --> 00:01:03,500\n00:00:05,000 is not a timing\n", shifted)
+
+	// Negative times are clamped to zero
+	shifted, err = resyncSubtitleContent(srt, "srt", &SubtitleResyncRequest{OffsetMs: -2000})
+	require.NoError(t, err)
+	assert.Contains(t, shifted, "00:00:00,000 --> 00:00:01,500")
+
+	// 25 fps PAL timing played against a 24 fps video
+	shifted, err = resyncSubtitleContent(srt, "SRT", &SubtitleResyncRequest{SourceFrameRate: 25, TargetFrameRate: 24})
+	require.NoError(t, err)
+	assert.Contains(t, shifted, "00:01:02,500 --> 00:01:04,583")
+
+	vtt := "WEBVTT\n\n01:02.345 --> 01:04.000 align:start\n<v Ann>Hi\n"
+	shifted, err = resyncSubtitleContent(vtt, "vtt", &SubtitleResyncRequest{OffsetMs: 655})
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:01:03.000 --> 00:01:04.655 align:start\n<v Ann>Hi\n", shifted)
+
+	_, err = resyncSubtitleContent("[Events]", "ass", &SubtitleResyncRequest{OffsetMs: 1})
+	assert.ErrorContains(t, err, "unsupported format")
+}
+
+func TestSubtitleResyncRequest_Validate(t *testing.T) {
+	assert.NoError(t, (&SubtitleResyncRequest{OffsetMs: -300}).Validate())
+	assert.NoError(t, (&SubtitleResyncRequest{SourceFrameRate: 23.976, TargetFrameRate: 25}).Validate())
+	assert.ErrorContains(t, (&SubtitleResyncRequest{}).Validate(), "required")
+	assert.ErrorContains(t, (&SubtitleResyncRequest{SourceFrameRate: 25}).Validate(), "set together")
+	assert.ErrorContains(t, (&SubtitleResyncRequest{SourceFrameRate: -1, TargetFrameRate: 25}).Validate(), "positive")
+}
+
+func newSubtitleStorageTestService(t *testing.T) (*SubtitleService, *database.DB, string) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	rootDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "movies"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "movies", "Test Movie.mkv"), []byte("video"), 0644))
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL
+		);
+		CREATE TABLE subtitle_tracks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_item_id INTEGER NOT NULL,
+			language TEXT NOT NULL,
+			language_code TEXT NOT NULL,
+			source TEXT NOT NULL,
+			format TEXT NOT NULL,
+			path TEXT,
+			content TEXT,
+			is_default BOOLEAN DEFAULT 0,
+			is_forced BOOLEAN DEFAULT 0,
+			encoding TEXT DEFAULT 'utf-8',
+			sync_offset REAL DEFAULT 0.0,
+			verified_sync BOOLEAN DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO storage_roots (id, name, protocol, path) VALUES (1, 'nas', 'local', ?)`, rootDir)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO files (id, storage_root_id, path, name) VALUES (7, 1, 'movies/Test Movie.mkv', 'Test Movie.mkv')`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	mockCache := &MockCacheService{}
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	service := NewSubtitleService(db, zap.NewNop(), mockCache)
+	service.SetStorageClients(localRootClients{})
+	return service, db, rootDir
+}
+
+func TestSubtitleService_DownloadStoresFileAndResync(t *testing.T) {
+	service, db, rootDir := newSubtitleStorageTestService(t)
+	service.SetProviderConfig(ProviderOpenSubtitles, newOpenSubtitlesTestServer(t).URL, "test-key")
+	ctx := context.Background()
+
+	track, err := service.DownloadSubtitle(ctx, &SubtitleDownloadRequest{
+		MediaItemID: 7, ResultID: "opensubtitles_123", Language: "en",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1", track.ID)
+	assert.Equal(t, "English", track.Language)
+	require.NotNil(t, track.Path)
+	assert.Equal(t, "movies/Test Movie.en.srt", *track.Path)
+
+	stored, err := os.ReadFile(filepath.Join(rootDir, "movies", "Test Movie.en.srt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(stored), "00:00:01,000 --> 00:00:03,000")
+
+	// A second subtitle in the same language does not replace the first
+	upload, err := service.SaveUploadedSubtitle(ctx, &SubtitleUploadRequest{
+		MediaID: 7, Language: "English", LanguageCode: "en", Format: "srt",
+		Content: "1\n00:00:02,000 --> 00:00:04,000\nUploaded\n", Encoding: "utf-8",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2", upload.SubtitleID)
+	assert.FileExists(t, filepath.Join(rootDir, "movies", "Test Movie.en.2.srt"))
+
+	resynced, err := service.ResyncSubtitle(ctx, track.ID, &SubtitleResyncRequest{OffsetMs: 1500})
+	require.NoError(t, err)
+	assert.Contains(t, *resynced.Content, "00:00:02,500 --> 00:00:04,500")
+	assert.False(t, resynced.VerifiedSync)
+
+	stored, err = os.ReadFile(filepath.Join(rootDir, "movies", "Test Movie.en.srt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(stored), "00:00:02,500 --> 00:00:04,500")
+	var content string
+	require.NoError(t, db.QueryRow(`SELECT content FROM subtitle_tracks WHERE id = 1`).Scan(&content))
+	assert.Equal(t, *resynced.Content, content)
+
+	_, err = service.ResyncSubtitle(ctx, "99", &SubtitleResyncRequest{OffsetMs: 1500})
+	assert.ErrorContains(t, err, "not found")
+	_, err = service.ResyncSubtitle(ctx, track.ID, &SubtitleResyncRequest{})
+	assert.ErrorContains(t, err, "invalid re-sync request")
+}
@@ -0,0 +1,659 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"catalogizer/models"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TelemetrySchemaVersion is the version of TelemetryReport. It changes
+// whenever a field is added to or removed from the report.
+const TelemetrySchemaVersion = 1
+
+// Report delivery states.
+const (
+	TelemetryReportSent   = "sent"
+	TelemetryReportFailed = "failed"
+)
+
+const telemetryDayLayout = "2006-01-02"
+
+// TelemetryFeature is a feature whose use is counted. Usage is attributed
+// to a feature by the route pattern of a successful API request.
+type TelemetryFeature struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Routes      []string `json:"routes"`
+}
+
+// telemetryFeatures is the complete telemetry schema. Only these names are
+// ever stored or reported; a request matching none of the routes is not
+// counted. Routes are prefixes of gin route patterns under /api/v1 and the
+// longest match wins.
+var telemetryFeatures = []TelemetryFeature{
+	{Name: "search", Description: "File and media search", Routes: []string{"/search", "/media/search"}},
+	{Name: "browse", Description: "Catalog and directory browsing", Routes: []string{"/catalog", "/catalog-info", "/browse", "/storage/list", "/entities", "/snapshots"}},
+	{Name: "stream", Description: "Media streaming", Routes: []string{"/entities/:id/stream"}},
+	{Name: "download", Description: "File, directory and archive downloads", Routes: []string{"/download", "/entities/:id/download"}},
+	{Name: "upload", Description: "Uploads", Routes: []string{"/copy/upload"}},
+	{Name: "copy", Description: "Copies between storage roots", Routes: []string{"/copy/local", "/copy/storage"}},
+	{Name: "share_links", Description: "Public share links", Routes: []string{"/share-links"}},
+	{Name: "screeners", Description: "Screener sessions", Routes: []string{"/screeners"}},
+	{Name: "collections", Description: "Collections", Routes: []string{"/collections"}},
+	{Name: "favorites", Description: "Favorites", Routes: []string{"/favorites", "/media/:id/favorite"}},
+	{Name: "subtitles", Description: "Subtitle search, download and translation", Routes: []string{"/subtitles"}},
+	{Name: "conversion", Description: "Format conversion", Routes: []string{"/conversion"}},
+	{Name: "sync", Description: "Remote synchronization", Routes: []string{"/sync"}},
+	{Name: "scan", Description: "Storage scans and scan schedules", Routes: []string{"/scan", "/scans"}},
+	{Name: "recommendations", Description: "Recommendations", Routes: []string{"/recommendations"}},
+	{Name: "file_versions", Description: "File version history and restore", Routes: []string{"/media/:id/versions"}},
+	{Name: "cold_storage", Description: "Cold storage recalls", Routes: []string{"/recalls", "/media/:id/recall"}},
+	{Name: "encryption", Description: "Encryption key management", Routes: []string{"/encryption-keys"}},
+	{Name: "analytics", Description: "Analytics, statistics and reports", Routes: []string{"/analytics", "/stats", "/reports"}},
+	{Name: "administration", Description: "Administration endpoints", Routes: []string{"/admin", "/users", "/roles", "/configuration"}},
+}
+
+// TelemetrySchema returns the features usage is counted for.
+func TelemetrySchema() []TelemetryFeature {
+	return telemetryFeatures
+}
+
+// TelemetryFeatureForRoute returns the feature a route pattern such as
+// /api/v1/entities/:id/stream belongs to, or "" if it belongs to none.
+func TelemetryFeatureForRoute(route string) string {
+	route = strings.TrimPrefix(route, "/api/v1")
+	feature, longest := "", -1
+	for _, f := range telemetryFeatures {
+		for _, prefix := range f.Routes {
+			if len(prefix) <= longest {
+				continue
+			}
+			if route == prefix || strings.HasPrefix(route, prefix+"/") {
+				feature, longest = f.Name, len(prefix)
+			}
+		}
+	}
+	return feature
+}
+
+func isTelemetryFeature(name string) bool {
+	for _, f := range telemetryFeatures {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TelemetrySettings is the server-wide telemetry opt-in. Nothing is
+// counted unless Enabled is set, and nothing leaves the server unless
+// UpstreamEnabled is set as well and an endpoint is configured.
+type TelemetrySettings struct {
+	Enabled         bool       `json:"enabled"`
+	UpstreamEnabled bool       `json:"upstream_enabled"`
+	Endpoint        string     `json:"endpoint,omitempty"`
+	InstallationID  string     `json:"installation_id"`
+	ReportedThrough string     `json:"reported_through,omitempty"`
+	LastReportedAt  *time.Time `json:"last_reported_at,omitempty"`
+}
+
+// TelemetryUsageDay is one day of feature counters.
+type TelemetryUsageDay struct {
+	Day      string           `json:"day"`
+	Features map[string]int64 `json:"features"`
+}
+
+// TelemetryUsage summarizes the counters collected locally.
+type TelemetryUsage struct {
+	From         string              `json:"from"`
+	To           string              `json:"to"`
+	Totals       map[string]int64    `json:"totals"`
+	Days         []TelemetryUsageDay `json:"days"`
+	OptedInUsers int                 `json:"opted_in_users"`
+}
+
+// TelemetryReport is the payload sent upstream, and the only data that
+// is: complete days of feature counters keyed by schema feature name and
+// a random installation ID that is not derived from anything on the
+// server. It carries no user, file or network information.
+type TelemetryReport struct {
+	SchemaVersion  int              `json:"schema_version"`
+	InstallationID string           `json:"installation_id"`
+	PeriodStart    string           `json:"period_start"`
+	PeriodEnd      string           `json:"period_end"`
+	Features       map[string]int64 `json:"features"`
+}
+
+// TelemetryReportLog records a report sent, or attempted, upstream.
+type TelemetryReportLog struct {
+	ID          int64           `json:"id"`
+	Endpoint    string          `json:"endpoint"`
+	PeriodStart string          `json:"period_start"`
+	PeriodEnd   string          `json:"period_end"`
+	Payload     TelemetryReport `json:"payload"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// TelemetryConfig configures TelemetryService.
+type TelemetryConfig struct {
+	// Endpoint receives reports as JSON POSTs. Without one, telemetry
+	// stays local.
+	Endpoint string
+	// ReportInterval is how often a report is sent while upstream
+	// reporting is enabled. Defaults to a day.
+	ReportInterval time.Duration
+	// OptInCacheTTL is how long a user's ShareUsageData preference is
+	// cached. Defaults to five minutes.
+	OptInCacheTTL time.Duration
+}
+
+// TelemetryService collects anonymous feature usage. Counting is opt-in
+// twice over: an administrator enables it for the server and each user
+// enables it for themselves with the share_usage_data privacy preference.
+// Counters are kept per day and feature only; no user, path or ID is
+// stored. Administrators can review the counters and preview the exact
+// report before enabling upstream reporting.
+type TelemetryService struct {
+	db     *database.DB
+	logger *zap.Logger
+	config TelemetryConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	settings *TelemetrySettings
+	optIns   map[int]telemetryOptIn
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type telemetryOptIn struct {
+	shareUsage bool
+	expires    time.Time
+}
+
+// NewTelemetryService creates a new TelemetryService.
+func NewTelemetryService(db *database.DB, logger *zap.Logger, config TelemetryConfig) *TelemetryService {
+	if config.ReportInterval <= 0 {
+		config.ReportInterval = 24 * time.Hour
+	}
+	if config.OptInCacheTTL <= 0 {
+		config.OptInCacheTTL = 5 * time.Minute
+	}
+	return &TelemetryService{
+		db:     db,
+		logger: logger,
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+		optIns: make(map[int]telemetryOptIn),
+	}
+}
+
+// Start begins sending periodic reports. Each tick is a no-op unless
+// upstream reporting is enabled.
+func (s *TelemetryService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.ReportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.reportIfEnabled(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops periodic reporting.
+func (s *TelemetryService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
+
+func (s *TelemetryService) reportIfEnabled(ctx context.Context) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to load telemetry settings", zap.Error(err))
+		return
+	}
+	if !settings.Enabled || !settings.UpstreamEnabled || settings.Endpoint == "" {
+		return
+	}
+	if settings.ReportedThrough >= s.yesterday() {
+		return
+	}
+	if _, err := s.Report(ctx); err != nil {
+		s.logger.Warn("Failed to send telemetry report", zap.Error(err))
+	}
+}
+
+// GetSettings returns the telemetry settings, creating them, with a new
+// installation ID and telemetry disabled, on first use.
+func (s *TelemetryService) GetSettings(ctx context.Context) (*TelemetrySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, err := s.loadSettingsLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	copied := *settings
+	return &copied, nil
+}
+
+func (s *TelemetryService) loadSettingsLocked(ctx context.Context) (*TelemetrySettings, error) {
+	if s.settings != nil {
+		return s.settings, nil
+	}
+
+	settings := &TelemetrySettings{Endpoint: s.config.Endpoint}
+	var reportedThrough sql.NullString
+	var lastReportedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT enabled, upstream_enabled, installation_id, reported_through, last_reported_at
+		 FROM telemetry_settings WHERE id = 1`).Scan(
+		&settings.Enabled, &settings.UpstreamEnabled, &settings.InstallationID, &reportedThrough, &lastReportedAt)
+	if err == sql.ErrNoRows {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate telemetry installation ID: %w", err)
+		}
+		settings.InstallationID = hex.EncodeToString(b)
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT INTO telemetry_settings (id, enabled, upstream_enabled, installation_id, updated_at) VALUES (1, ?, ?, ?, ?)`,
+			false, false, settings.InstallationID, s.now()); err != nil {
+			return nil, fmt.Errorf("failed to create telemetry settings: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load telemetry settings: %w", err)
+	}
+	settings.ReportedThrough = reportedThrough.String
+	if lastReportedAt.Valid {
+		settings.LastReportedAt = &lastReportedAt.Time
+	}
+	s.settings = settings
+	return settings, nil
+}
+
+// UpdateSettings enables or disables telemetry and upstream reporting;
+// a nil value is left unchanged. Upstream reporting needs an endpoint.
+// Disabling telemetry keeps the counters collected so far; PurgeUsage
+// deletes them.
+func (s *TelemetryService) UpdateSettings(ctx context.Context, enabled, upstreamEnabled *bool) (*TelemetrySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, err := s.loadSettingsLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *settings
+	if enabled != nil {
+		updated.Enabled = *enabled
+	}
+	if upstreamEnabled != nil {
+		updated.UpstreamEnabled = *upstreamEnabled
+	}
+	if updated.UpstreamEnabled && updated.Endpoint == "" {
+		return nil, fmt.Errorf("invalid telemetry settings: no upstream endpoint is configured")
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE telemetry_settings SET enabled = ?, upstream_enabled = ?, updated_at = ? WHERE id = 1`,
+		updated.Enabled, updated.UpstreamEnabled, s.now()); err != nil {
+		return nil, fmt.Errorf("failed to update telemetry settings: %w", err)
+	}
+	*settings = updated
+	return &updated, nil
+}
+
+// Record counts one use of feature by userID. It does nothing unless
+// telemetry is enabled and the user has opted in to sharing usage data.
+func (s *TelemetryService) Record(ctx context.Context, userID int, feature string) error {
+	if !isTelemetryFeature(feature) {
+		return fmt.Errorf("unknown telemetry feature %q", feature)
+	}
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return nil
+	}
+	optedIn, err := s.userOptedIn(ctx, userID)
+	if err != nil || !optedIn {
+		return err
+	}
+
+	day := s.now().UTC().Format(telemetryDayLayout)
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO telemetry_usage (day, feature, count) VALUES (?, ?, 0)`,
+		day, feature); err != nil {
+		return fmt.Errorf("failed to record telemetry: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE telemetry_usage SET count = count + 1 WHERE day = ? AND feature = ?`,
+		day, feature); err != nil {
+		return fmt.Errorf("failed to record telemetry: %w", err)
+	}
+	return nil
+}
+
+// RecordRoute counts a successful request to route by userID under the
+// feature the route belongs to, if any.
+func (s *TelemetryService) RecordRoute(ctx context.Context, userID int, route string) error {
+	if feature := TelemetryFeatureForRoute(route); feature != "" {
+		return s.Record(ctx, userID, feature)
+	}
+	return nil
+}
+
+// userOptedIn reports whether the user's privacy preferences share usage
+// data. Users who never set the preference have not opted in.
+func (s *TelemetryService) userOptedIn(ctx context.Context, userID int) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	cached, ok := s.optIns[userID]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.shareUsage, nil
+	}
+
+	var settings sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT settings FROM users WHERE id = ?`, userID).Scan(&settings)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to load user privacy preferences: %w", err)
+	}
+	shareUsage := sharesUsageData(settings.String)
+
+	s.mu.Lock()
+	s.optIns[userID] = telemetryOptIn{shareUsage: shareUsage, expires: now.Add(s.config.OptInCacheTTL)}
+	s.mu.Unlock()
+	return shareUsage, nil
+}
+
+func sharesUsageData(settings string) bool {
+	var prefs models.UserPreferences
+	if settings == "" || json.Unmarshal([]byte(settings), &prefs) != nil {
+		return false
+	}
+	return prefs.PrivacySettings.ShareUsageData
+}
+
+// Usage summarizes the counters for the last days days, today included.
+func (s *TelemetryService) Usage(ctx context.Context, days int) (*TelemetryUsage, error) {
+	if days <= 0 {
+		days = 30
+	}
+	today := s.now().UTC()
+	usage := &TelemetryUsage{
+		From:   today.AddDate(0, 0, -(days - 1)).Format(telemetryDayLayout),
+		To:     today.Format(telemetryDayLayout),
+		Totals: emptyTelemetryCounters(),
+		Days:   []TelemetryUsageDay{},
+	}
+
+	counters, err := s.loadUsage(ctx, usage.From, usage.To)
+	if err != nil {
+		return nil, err
+	}
+	for day, features := range counters {
+		usage.Days = append(usage.Days, TelemetryUsageDay{Day: day, Features: features})
+		for feature, count := range features {
+			usage.Totals[feature] += count
+		}
+	}
+	sort.Slice(usage.Days, func(i, j int) bool { return usage.Days[i].Day < usage.Days[j].Day })
+
+	rows, err := s.db.QueryContext(ctx, `SELECT settings FROM users WHERE is_active = ?`, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count opted-in users: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var settings sql.NullString
+		if err := rows.Scan(&settings); err != nil {
+			return nil, fmt.Errorf("failed to count opted-in users: %w", err)
+		}
+		if sharesUsageData(settings.String) {
+			usage.OptedInUsers++
+		}
+	}
+	return usage, rows.Err()
+}
+
+// loadUsage returns the counters between two days inclusive, by day.
+func (s *TelemetryService) loadUsage(ctx context.Context, from, to string) (map[string]map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT day, feature, count FROM telemetry_usage WHERE day >= ? AND day <= ?`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load telemetry usage: %w", err)
+	}
+	defer rows.Close()
+
+	counters := make(map[string]map[string]int64)
+	for rows.Next() {
+		var day, feature string
+		var count int64
+		if err := rows.Scan(&day, &feature, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan telemetry usage: %w", err)
+		}
+		if !isTelemetryFeature(feature) {
+			continue
+		}
+		if counters[day] == nil {
+			counters[day] = make(map[string]int64)
+		}
+		counters[day][feature] += count
+	}
+	return counters, rows.Err()
+}
+
+// PurgeUsage deletes all locally collected counters.
+func (s *TelemetryService) PurgeUsage(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM telemetry_usage`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge telemetry usage: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Preview returns the report the next upstream report would send: every
+// complete day since the last report, up to and including yesterday.
+func (s *TelemetryService) Preview(ctx context.Context) (*TelemetryReport, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	end := s.yesterday()
+	report := &TelemetryReport{
+		SchemaVersion:  TelemetrySchemaVersion,
+		InstallationID: settings.InstallationID,
+		PeriodEnd:      end,
+		Features:       emptyTelemetryCounters(),
+	}
+
+	from := ""
+	if settings.ReportedThrough != "" {
+		last, err := time.Parse(telemetryDayLayout, settings.ReportedThrough)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reported_through %q: %w", settings.ReportedThrough, err)
+		}
+		from = last.AddDate(0, 0, 1).Format(telemetryDayLayout)
+	}
+	counters, err := s.loadUsage(ctx, from, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report.PeriodStart = end
+	if from != "" && from < end {
+		report.PeriodStart = from
+	}
+	for day, features := range counters {
+		if from == "" && day < report.PeriodStart {
+			report.PeriodStart = day
+		}
+		for feature, count := range features {
+			report.Features[feature] += count
+		}
+	}
+	return report, nil
+}
+
+// Report sends the previewed report upstream and logs it. It fails
+// unless telemetry and upstream reporting are both enabled. On success
+// the reported days are not sent again.
+func (s *TelemetryService) Report(ctx context.Context) (*TelemetryReportLog, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled || !settings.UpstreamEnabled || settings.Endpoint == "" {
+		return nil, fmt.Errorf("upstream telemetry reporting is disabled")
+	}
+
+	report, err := s.Preview(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal telemetry report: %w", err)
+	}
+
+	entry := &TelemetryReportLog{
+		Endpoint:    settings.Endpoint,
+		PeriodStart: report.PeriodStart,
+		PeriodEnd:   report.PeriodEnd,
+		Payload:     *report,
+		Status:      TelemetryReportSent,
+		CreatedAt:   s.now(),
+	}
+	if sendErr := s.send(ctx, settings.Endpoint, payload); sendErr != nil {
+		entry.Status, entry.Error = TelemetryReportFailed, sendErr.Error()
+	}
+
+	entry.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO telemetry_reports (endpoint, period_start, period_end, payload, status, error, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.Endpoint, entry.PeriodStart, entry.PeriodEnd, string(payload), entry.Status, entry.Error, entry.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log telemetry report: %w", err)
+	}
+	if entry.Status == TelemetryReportFailed {
+		return entry, fmt.Errorf("failed to send telemetry report: %s", entry.Error)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE telemetry_settings SET reported_through = ?, last_reported_at = ? WHERE id = 1`,
+		report.PeriodEnd, entry.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to update telemetry settings: %w", err)
+	}
+	if s.settings != nil {
+		s.settings.ReportedThrough = report.PeriodEnd
+		s.settings.LastReportedAt = &entry.CreatedAt
+	}
+	return entry, nil
+}
+
+func (s *TelemetryService) send(ctx context.Context, endpoint string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ListReports returns the most recent reports, newest first.
+func (s *TelemetryService) ListReports(ctx context.Context, limit int) ([]TelemetryReportLog, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, endpoint, period_start, period_end, payload, status, error, created_at
+		 FROM telemetry_reports ORDER BY created_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list telemetry reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []TelemetryReportLog{}
+	for rows.Next() {
+		var entry TelemetryReportLog
+		var payload string
+		var errMsg sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Endpoint, &entry.PeriodStart, &entry.PeriodEnd, &payload,
+			&entry.Status, &errMsg, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan telemetry report: %w", err)
+		}
+		if err := json.Unmarshal([]byte(payload), &entry.Payload); err != nil {
+			return nil, fmt.Errorf("failed to decode telemetry report %d: %w", entry.ID, err)
+		}
+		entry.Error = errMsg.String
+		reports = append(reports, entry)
+	}
+	return reports, rows.Err()
+}
+
+func (s *TelemetryService) yesterday() string {
+	return s.now().UTC().AddDate(0, 0, -1).Format(telemetryDayLayout)
+}
+
+// emptyTelemetryCounters returns a zero counter for every feature, so
+// reports always have the same shape.
+func emptyTelemetryCounters() map[string]int64 {
+	counters := make(map[string]int64, len(telemetryFeatures))
+	for _, f := range telemetryFeatures {
+		counters[f.Name] = 0
+	}
+	return counters
+}
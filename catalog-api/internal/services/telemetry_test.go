@@ -0,0 +1,188 @@
+package services
+
+import (
+	"catalogizer/config"
+	"catalogizer/database"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newTelemetryFixture migrates a fresh database with two users, alice who
+// shares usage data and bob who never set the preference.
+func newTelemetryFixture(t *testing.T, endpoint string) (*TelemetryService, *time.Time) {
+	t.Helper()
+
+	db, err := database.NewConnection(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "telemetry.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	require.NoError(t, db.RunMigrations(ctx))
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO roles (id, name, permissions) VALUES (100, 'telemetry-test', '[]');
+		INSERT INTO users (id, username, email, password_hash, salt, role_id, settings) VALUES
+			(100, 'alice', 'alice@example.com', 'x', 'x', 100, '{"privacy":{"share_usage_data":true}}'),
+			(101, 'bob', 'bob@example.com', 'x', 'x', 100, '{}');`)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)
+	svc := NewTelemetryService(db, zap.NewNop(), TelemetryConfig{Endpoint: endpoint})
+	svc.now = func() time.Time { return now }
+	return svc, &now
+}
+
+func TestTelemetryFeatureForRoute(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/search/v2":                "search",
+		"/api/v1/media/search":             "search",
+		"/api/v1/entities/:id":             "browse",
+		"/api/v1/entities/:id/stream":      "stream",
+		"/api/v1/share-links/:id/resend":   "share_links",
+		"/api/v1/admin/telemetry":          "administration",
+		"/api/v1/scans":                    "scan",
+		"/api/v1/scanner":                  "",
+		"/api/v1/media/:id":                "",
+		"/api/v1/media/:id/versions/:v_id": "file_versions",
+		"/api/v1/discovery":                "",
+	}
+	for route, want := range tests {
+		assert.Equal(t, want, TelemetryFeatureForRoute(route), route)
+	}
+}
+
+func TestTelemetryService_RecordIsOptIn(t *testing.T) {
+	svc, now := newTelemetryFixture(t, "")
+	ctx := context.Background()
+
+	// Disabled by default
+	require.NoError(t, svc.Record(ctx, 100, "search"))
+	usage, err := svc.Usage(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, usage.Days)
+
+	enabled := true
+	_, err = svc.UpdateSettings(ctx, &enabled, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Record(ctx, 100, "search"))
+	require.NoError(t, svc.RecordRoute(ctx, 100, "/api/v1/search/v2"))
+	require.NoError(t, svc.RecordRoute(ctx, 100, "/api/v1/discovery"))
+	require.NoError(t, svc.Record(ctx, 101, "search"), "users who did not opt in are skipped")
+	require.NoError(t, svc.Record(ctx, 999, "search"), "unknown users are skipped")
+	assert.ErrorContains(t, svc.Record(ctx, 100, "user:alice"), "unknown telemetry feature")
+
+	*now = now.AddDate(0, 0, 1)
+	require.NoError(t, svc.Record(ctx, 100, "stream"))
+
+	usage, err = svc.Usage(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-05", usage.From)
+	assert.Equal(t, "2024-05-11", usage.To)
+	assert.Equal(t, 1, usage.OptedInUsers)
+	assert.Equal(t, int64(2), usage.Totals["search"])
+	assert.Equal(t, int64(1), usage.Totals["stream"])
+	assert.Equal(t, int64(0), usage.Totals["sync"])
+	require.Len(t, usage.Days, 2)
+	assert.Equal(t, "2024-05-10", usage.Days[0].Day)
+	assert.Equal(t, map[string]int64{"search": 2}, usage.Days[0].Features)
+
+	deleted, err := svc.PurgeUsage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func TestTelemetryService_UpstreamNeedsEndpoint(t *testing.T) {
+	svc, _ := newTelemetryFixture(t, "")
+	ctx := context.Background()
+
+	enabled := true
+	_, err := svc.UpdateSettings(ctx, &enabled, &enabled)
+	assert.ErrorContains(t, err, "invalid telemetry settings")
+
+	_, err = svc.Report(ctx)
+	assert.ErrorContains(t, err, "disabled")
+}
+
+func TestTelemetryService_PreviewAndReport(t *testing.T) {
+	var received []TelemetryReport
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report TelemetryReport
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		received = append(received, report)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	svc, now := newTelemetryFixture(t, server.URL)
+	ctx := context.Background()
+	enabled := true
+	settings, err := svc.UpdateSettings(ctx, &enabled, nil)
+	require.NoError(t, err)
+	assert.Len(t, settings.InstallationID, 32)
+
+	*now = time.Date(2024, 5, 8, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.Record(ctx, 100, "search"))
+	*now = time.Date(2024, 5, 9, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.Record(ctx, 100, "download"))
+	*now = time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.Record(ctx, 100, "download"), "today is not reported yet")
+
+	preview, err := svc.Preview(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, TelemetrySchemaVersion, preview.SchemaVersion)
+	assert.Equal(t, settings.InstallationID, preview.InstallationID)
+	assert.Equal(t, "2024-05-08", preview.PeriodStart)
+	assert.Equal(t, "2024-05-09", preview.PeriodEnd)
+	assert.Equal(t, int64(1), preview.Features["search"])
+	assert.Equal(t, int64(1), preview.Features["download"])
+	assert.Len(t, preview.Features, len(TelemetrySchema()))
+
+	// Upstream reporting is a separate opt-in
+	_, err = svc.Report(ctx)
+	assert.ErrorContains(t, err, "disabled")
+	_, err = svc.UpdateSettings(ctx, nil, &enabled)
+	require.NoError(t, err)
+
+	status = http.StatusServiceUnavailable
+	entry, err := svc.Report(ctx)
+	assert.ErrorContains(t, err, "status 503")
+	require.NotNil(t, entry)
+	assert.Equal(t, TelemetryReportFailed, entry.Status)
+
+	status = http.StatusNoContent
+	entry, err = svc.Report(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, TelemetryReportSent, entry.Status)
+	require.Len(t, received, 2)
+	assert.Equal(t, *preview, received[1], "the preview is exactly what is sent")
+
+	// Reported days are not sent again
+	*now = time.Date(2024, 5, 11, 9, 0, 0, 0, time.UTC)
+	preview, err = svc.Preview(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-10", preview.PeriodStart)
+	assert.Equal(t, "2024-05-10", preview.PeriodEnd)
+	assert.Equal(t, int64(1), preview.Features["download"])
+	assert.Equal(t, int64(0), preview.Features["search"])
+
+	reports, err := svc.ListReports(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, TelemetryReportSent, reports[0].Status)
+	assert.Equal(t, received[1], reports[0].Payload)
+	assert.Equal(t, TelemetryReportFailed, reports[1].Status)
+
+	settings, err = svc.GetSettings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-09", settings.ReportedThrough)
+}
@@ -0,0 +1,898 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Storage tiers a policy can move files into.
+const (
+	StorageTierHot  = "hot"
+	StorageTierWarm = "warm"
+	StorageTierCold = "cold"
+)
+
+// Tiering run and move states.
+const (
+	TieringRunRunning    = "running"
+	TieringRunCompleted  = "completed"
+	TieringRunFailed     = "failed"
+	TieringRunUndone     = "undone"
+	TieringRunUndoFailed = "undo_failed"
+
+	TieringMoveMoved  = "moved"
+	TieringMoveFailed = "failed"
+	TieringMoveUndone = "undone"
+)
+
+// TieringPolicy moves files from SourceRoot to TargetRoot once they match
+// every configured criterion. Zero-valued criteria are ignored, so a policy
+// needs at least one of MinAgeDays, UnaccessedDays or MaxAccessCount.
+type TieringPolicy struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	Tier           string    `json:"tier"`
+	SourceRoot     string    `json:"source_root"`
+	TargetRoot     string    `json:"target_root"`
+	TargetPath     string    `json:"target_path"`
+	MinAgeDays     int       `json:"min_age_days"`
+	UnaccessedDays int       `json:"unaccessed_days"`
+	MaxAccessCount *int      `json:"max_access_count,omitempty"`
+	MinSize        int64     `json:"min_size"`
+	FileTypes      []string  `json:"file_types,omitempty"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TieringRun is one execution of a tiering policy.
+type TieringRun struct {
+	ID          int64         `json:"id"`
+	PolicyID    int64         `json:"policy_id"`
+	Status      string        `json:"status"`
+	FilesMoved  int           `json:"files_moved"`
+	BytesMoved  int64         `json:"bytes_moved"`
+	FilesFailed int           `json:"files_failed"`
+	StartedBy   *int          `json:"started_by,omitempty"`
+	StartedAt   time.Time     `json:"started_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	UndoneAt    *time.Time    `json:"undone_at,omitempty"`
+	Moves       []TieringMove `json:"moves,omitempty"`
+}
+
+// TieringMove records one file moved by a run, with enough detail to move
+// it back.
+type TieringMove struct {
+	ID           int64     `json:"id"`
+	RunID        int64     `json:"run_id"`
+	FileID       int64     `json:"file_id"`
+	SourceRoot   string    `json:"source_root"`
+	SourcePath   string    `json:"source_path"`
+	TargetRoot   string    `json:"target_root"`
+	TargetPath   string    `json:"target_path"`
+	Size         int64     `json:"size"`
+	Status       string    `json:"status"`
+	ErrorMessage *string   `json:"error_message,omitempty"`
+	MovedAt      time.Time `json:"moved_at"`
+}
+
+// TieringCandidate is a catalogued file a policy would move.
+type TieringCandidate struct {
+	FileID     int64      `json:"file_id"`
+	Path       string     `json:"path"`
+	TargetPath string     `json:"target_path"`
+	Size       int64      `json:"size"`
+	ModifiedAt time.Time  `json:"modified_at"`
+	AccessedAt *time.Time `json:"accessed_at,omitempty"`
+}
+
+// TieringConfig controls how often enabled policies run and how many files
+// a single run may move.
+type TieringConfig struct {
+	Interval       time.Duration
+	MaxFilesPerRun int
+}
+
+// storageClientProvider builds filesystem clients for storage roots.
+// UniversalScanner satisfies it.
+type storageClientProvider interface {
+	NewClient(root *models.StorageRoot) (filesystem.FileSystemClient, error)
+}
+
+// TieringService moves files between storage roots according to tiering
+// policies, rewriting their catalog entries in place so IDs, metadata and
+// history follow the file. Every run can be undone.
+type TieringService struct {
+	db        *database.DB
+	logger    *zap.Logger
+	config    TieringConfig
+	clients   storageClientProvider
+	lockdowns lockdownStatus
+	mu        sync.Mutex
+	running   map[int64]bool
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	now       func() time.Time
+}
+
+// NewTieringService creates a TieringService that reaches storage roots
+// through clients.
+func NewTieringService(db *database.DB, logger *zap.Logger, clients storageClientProvider, cfg TieringConfig) *TieringService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.MaxFilesPerRun <= 0 {
+		cfg.MaxFilesPerRun = 500
+	}
+	return &TieringService{
+		db:      db,
+		logger:  logger,
+		config:  cfg,
+		clients: clients,
+		running: make(map[int64]bool),
+		now:     time.Now,
+	}
+}
+
+// SetLockdownChecker makes runs skip storage roots in read-only lockdown.
+func (s *TieringService) SetLockdownChecker(checker lockdownStatus) {
+	s.lockdowns = checker
+}
+
+func validateTieringPolicy(p *TieringPolicy) error {
+	if p.Name == "" {
+		return fmt.Errorf("invalid policy: name is required")
+	}
+	switch p.Tier {
+	case StorageTierHot, StorageTierWarm, StorageTierCold:
+	default:
+		return fmt.Errorf("invalid policy: tier must be hot, warm or cold")
+	}
+	if p.SourceRoot == "" || p.TargetRoot == "" {
+		return fmt.Errorf("invalid policy: source and target roots are required")
+	}
+	p.TargetPath = strings.Trim(path.Clean("/"+p.TargetPath), "/")
+	if p.SourceRoot == p.TargetRoot && p.TargetPath == "" {
+		return fmt.Errorf("invalid policy: target must differ from source")
+	}
+	if p.MinAgeDays < 0 || p.UnaccessedDays < 0 || p.MinSize < 0 || (p.MaxAccessCount != nil && *p.MaxAccessCount < 0) {
+		return fmt.Errorf("invalid policy: limits must not be negative")
+	}
+	if p.MinAgeDays == 0 && p.UnaccessedDays == 0 && p.MaxAccessCount == nil {
+		return fmt.Errorf("invalid policy: at least one of min_age_days, unaccessed_days or max_access_count is required")
+	}
+	return nil
+}
+
+func encodeFileTypes(types []string) *string {
+	if len(types) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(types)
+	encoded := string(data)
+	return &encoded
+}
+
+// CreatePolicy stores a new tiering policy.
+func (s *TieringService) CreatePolicy(ctx context.Context, policy *TieringPolicy) error {
+	if err := validateTieringPolicy(policy); err != nil {
+		return err
+	}
+	now := s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO tiering_policies (name, tier, source_root, target_root, target_path, min_age_days, unaccessed_days,
+			max_access_count, min_size, file_types, enabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		policy.Name, policy.Tier, policy.SourceRoot, policy.TargetRoot, policy.TargetPath, policy.MinAgeDays,
+		policy.UnaccessedDays, policy.MaxAccessCount, policy.MinSize, encodeFileTypes(policy.FileTypes), policy.Enabled, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create tiering policy: %w", err)
+	}
+	policy.ID = id
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+	return nil
+}
+
+// UpdatePolicy replaces the settings of an existing policy.
+func (s *TieringService) UpdatePolicy(ctx context.Context, policy *TieringPolicy) error {
+	if err := validateTieringPolicy(policy); err != nil {
+		return err
+	}
+	policy.UpdatedAt = s.now()
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tiering_policies SET name = ?, tier = ?, source_root = ?, target_root = ?, target_path = ?,
+			min_age_days = ?, unaccessed_days = ?, max_access_count = ?, min_size = ?, file_types = ?, enabled = ?, updated_at = ?
+		 WHERE id = ?`,
+		policy.Name, policy.Tier, policy.SourceRoot, policy.TargetRoot, policy.TargetPath, policy.MinAgeDays,
+		policy.UnaccessedDays, policy.MaxAccessCount, policy.MinSize, encodeFileTypes(policy.FileTypes), policy.Enabled,
+		policy.UpdatedAt, policy.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tiering policy: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("tiering policy not found")
+	}
+	return nil
+}
+
+// DeletePolicy removes a policy together with its run history. Files that
+// were moved stay where they are.
+func (s *TieringService) DeletePolicy(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM tiering_policies WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tiering policy: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("tiering policy not found")
+	}
+	return nil
+}
+
+const tieringPolicyColumns = `id, name, tier, source_root, target_root, target_path, min_age_days, unaccessed_days,
+	max_access_count, min_size, file_types, enabled, created_at, updated_at`
+
+func scanTieringPolicy(row interface{ Scan(...interface{}) error }) (*TieringPolicy, error) {
+	var p TieringPolicy
+	var fileTypes sql.NullString
+	err := row.Scan(&p.ID, &p.Name, &p.Tier, &p.SourceRoot, &p.TargetRoot, &p.TargetPath, &p.MinAgeDays,
+		&p.UnaccessedDays, &p.MaxAccessCount, &p.MinSize, &fileTypes, &p.Enabled, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if fileTypes.Valid && fileTypes.String != "" {
+		if err := json.Unmarshal([]byte(fileTypes.String), &p.FileTypes); err != nil {
+			return nil, fmt.Errorf("invalid file types for policy %d: %w", p.ID, err)
+		}
+	}
+	return &p, nil
+}
+
+// GetPolicy returns a tiering policy by ID.
+func (s *TieringService) GetPolicy(ctx context.Context, id int64) (*TieringPolicy, error) {
+	policy, err := scanTieringPolicy(s.db.QueryRowContext(ctx,
+		`SELECT `+tieringPolicyColumns+` FROM tiering_policies WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("tiering policy not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tiering policy: %w", err)
+	}
+	return policy, nil
+}
+
+// ListPolicies returns every tiering policy.
+func (s *TieringService) ListPolicies(ctx context.Context) ([]TieringPolicy, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tieringPolicyColumns+` FROM tiering_policies ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tiering policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []TieringPolicy
+	for rows.Next() {
+		policy, err := scanTieringPolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tiering policy: %w", err)
+		}
+		policies = append(policies, *policy)
+	}
+	return policies, rows.Err()
+}
+
+// RecordAccess notes that a catalogued file was read, feeding the
+// unaccessed_days and max_access_count criteria.
+func (s *TieringService) RecordAccess(ctx context.Context, fileID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE files SET accessed_at = ?, access_count = access_count + 1 WHERE id = ?`, s.now(), fileID)
+	if err != nil {
+		return fmt.Errorf("failed to record file access: %w", err)
+	}
+	return nil
+}
+
+// tieringTargetPath maps a source path to its location on the target root,
+// keeping the catalog's leading-slash convention of the source path.
+func tieringTargetPath(policy *TieringPolicy, sourcePath string) string {
+	target := path.Join("/", policy.TargetPath, sourcePath)
+	if !strings.HasPrefix(sourcePath, "/") {
+		target = strings.TrimPrefix(target, "/")
+	}
+	return target
+}
+
+// Candidates returns the files a policy would move next, least recently
+// used first.
+func (s *TieringService) Candidates(ctx context.Context, policy *TieringPolicy, limit int) ([]TieringCandidate, error) {
+	if limit <= 0 || limit > s.config.MaxFilesPerRun {
+		limit = s.config.MaxFilesPerRun
+	}
+	now := s.now()
+
+	query := `SELECT f.id, f.path, f.size, f.modified_at, f.accessed_at FROM files f
+		JOIN storage_roots sr ON sr.id = f.storage_root_id
+		WHERE sr.name = ? AND f.is_directory = ? AND f.deleted = ?`
+	args := []interface{}{policy.SourceRoot, false, false}
+	if policy.MinAgeDays > 0 {
+		query += ` AND f.modified_at < ?`
+		args = append(args, now.AddDate(0, 0, -policy.MinAgeDays))
+	}
+	if policy.UnaccessedDays > 0 {
+		query += ` AND COALESCE(f.accessed_at, f.modified_at) < ?`
+		args = append(args, now.AddDate(0, 0, -policy.UnaccessedDays))
+	}
+	if policy.MaxAccessCount != nil {
+		query += ` AND f.access_count <= ?`
+		args = append(args, *policy.MaxAccessCount)
+	}
+	if policy.MinSize > 0 {
+		query += ` AND f.size >= ?`
+		args = append(args, policy.MinSize)
+	}
+	if len(policy.FileTypes) > 0 {
+		query += ` AND f.file_type IN (?` + strings.Repeat(", ?", len(policy.FileTypes)-1) + `)`
+		for _, t := range policy.FileTypes {
+			args = append(args, t)
+		}
+	}
+	if policy.SourceRoot == policy.TargetRoot {
+		// Skip files already below the target path
+		query += ` AND f.path NOT LIKE ? AND f.path NOT LIKE ?`
+		args = append(args, policy.TargetPath+"/%", "/"+policy.TargetPath+"/%")
+	}
+	query += ` ORDER BY COALESCE(f.accessed_at, f.modified_at), f.id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tiering candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []TieringCandidate
+	for rows.Next() {
+		var c TieringCandidate
+		if err := rows.Scan(&c.FileID, &c.Path, &c.Size, &c.ModifiedAt, &c.AccessedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tiering candidate: %w", err)
+		}
+		c.TargetPath = tieringTargetPath(policy, c.Path)
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+func (s *TieringService) loadStorageRoot(ctx context.Context, name string) (*models.StorageRoot, error) {
+	return loadStorageRootByName(ctx, s.db, name)
+}
+
+// loadStorageRootByName loads a storage root with its connection settings.
+func loadStorageRootByName(ctx context.Context, db *database.DB, name string) (*models.StorageRoot, error) {
+	var root models.StorageRoot
+	err := db.QueryRowContext(ctx,
+		`SELECT id, name, protocol, host, port, path, username, password, domain, mount_point, options, url
+		 FROM storage_roots WHERE name = ?`, name).Scan(
+		&root.ID, &root.Name, &root.Protocol, &root.Host, &root.Port, &root.Path, &root.Username,
+		&root.Password, &root.Domain, &root.MountPoint, &root.Options, &root.URL)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("storage root %s not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage root %s: %w", name, err)
+	}
+	return &root, nil
+}
+
+// tieringEndpoints holds connected clients for both ends of a policy.
+type tieringEndpoints struct {
+	source, target         *models.StorageRoot
+	sourceFS, targetFS     filesystem.FileSystemClient
+	sourceName, targetName string
+}
+
+func (s *TieringService) connect(ctx context.Context, sourceName, targetName string) (*tieringEndpoints, error) {
+	if s.lockdowns != nil {
+		for _, name := range []string{sourceName, targetName} {
+			if s.lockdowns.IsLocked(name) {
+				return nil, fmt.Errorf("storage root %s is in read-only lockdown", name)
+			}
+		}
+	}
+
+	ep := &tieringEndpoints{sourceName: sourceName, targetName: targetName}
+	var err error
+	if ep.source, err = s.loadStorageRoot(ctx, sourceName); err != nil {
+		return nil, err
+	}
+	if ep.target, err = s.loadStorageRoot(ctx, targetName); err != nil {
+		return nil, err
+	}
+	if ep.sourceFS, err = s.openClient(ctx, ep.source); err != nil {
+		return nil, err
+	}
+	if sourceName == targetName {
+		ep.targetFS = ep.sourceFS
+		return ep, nil
+	}
+	if ep.targetFS, err = s.openClient(ctx, ep.target); err != nil {
+		ep.sourceFS.Disconnect(ctx)
+		return nil, err
+	}
+	return ep, nil
+}
+
+func (s *TieringService) openClient(ctx context.Context, root *models.StorageRoot) (filesystem.FileSystemClient, error) {
+	client, err := s.clients.NewClient(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s: %w", root.Name, err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", root.Name, err)
+	}
+	return client, nil
+}
+
+func (ep *tieringEndpoints) close(ctx context.Context) {
+	ep.sourceFS.Disconnect(ctx)
+	if ep.targetFS != ep.sourceFS {
+		ep.targetFS.Disconnect(ctx)
+	}
+}
+
+// RunPolicy executes a policy and waits for it to finish.
+func (s *TieringService) RunPolicy(ctx context.Context, policyID int64, userID *int) (*TieringRun, error) {
+	policy, run, err := s.beginRun(ctx, policyID, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.execute(ctx, policy, run)
+	return run, nil
+}
+
+// StartPolicy executes a policy in the background and returns its run
+// immediately.
+func (s *TieringService) StartPolicy(ctx context.Context, policyID int64, userID *int) (*TieringRun, error) {
+	policy, run, err := s.beginRun(ctx, policyID, userID)
+	if err != nil {
+		return nil, err
+	}
+	started := *run
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(context.Background(), policy, run)
+	}()
+	return &started, nil
+}
+
+func (s *TieringService) beginRun(ctx context.Context, policyID int64, userID *int) (*TieringPolicy, *TieringRun, error) {
+	policy, err := s.GetPolicy(ctx, policyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	if s.running[policyID] {
+		s.mu.Unlock()
+		return nil, nil, fmt.Errorf("tiering policy %d is already running", policyID)
+	}
+	s.running[policyID] = true
+	s.mu.Unlock()
+
+	run := &TieringRun{PolicyID: policyID, Status: TieringRunRunning, StartedBy: userID, StartedAt: s.now()}
+	run.ID, err = s.db.InsertReturningID(ctx,
+		`INSERT INTO tiering_runs (policy_id, status, started_by, started_at) VALUES (?, ?, ?, ?)`,
+		run.PolicyID, run.Status, run.StartedBy, run.StartedAt)
+	if err != nil {
+		s.finishRunning(policyID)
+		return nil, nil, fmt.Errorf("failed to create tiering run: %w", err)
+	}
+	return policy, run, nil
+}
+
+func (s *TieringService) finishRunning(policyID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, policyID)
+}
+
+func (s *TieringService) execute(ctx context.Context, policy *TieringPolicy, run *TieringRun) {
+	defer s.finishRunning(policy.ID)
+
+	run.Status = TieringRunCompleted
+	if err := s.moveCandidates(ctx, policy, run); err != nil {
+		s.logger.Error("Tiering run failed",
+			zap.Int64("policy_id", policy.ID),
+			zap.Int64("run_id", run.ID),
+			zap.Error(err))
+		run.Status = TieringRunFailed
+	}
+
+	completed := s.now()
+	run.CompletedAt = &completed
+	if err := s.saveRun(ctx, run); err != nil {
+		s.logger.Error("Failed to save tiering run", zap.Int64("run_id", run.ID), zap.Error(err))
+	}
+
+	s.logger.Info("Tiering run finished",
+		zap.String("policy", policy.Name),
+		zap.String("tier", policy.Tier),
+		zap.Int64("run_id", run.ID),
+		zap.String("status", run.Status),
+		zap.Int("files_moved", run.FilesMoved),
+		zap.Int64("bytes_moved", run.BytesMoved),
+		zap.Int("files_failed", run.FilesFailed))
+}
+
+func (s *TieringService) moveCandidates(ctx context.Context, policy *TieringPolicy, run *TieringRun) error {
+	candidates, err := s.Candidates(ctx, policy, 0)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	ep, err := s.connect(ctx, policy.SourceRoot, policy.TargetRoot)
+	if err != nil {
+		return err
+	}
+	defer ep.close(ctx)
+
+	for _, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		move := &TieringMove{
+			RunID:      run.ID,
+			FileID:     c.FileID,
+			SourceRoot: policy.SourceRoot,
+			SourcePath: c.Path,
+			TargetRoot: policy.TargetRoot,
+			TargetPath: c.TargetPath,
+			Size:       c.Size,
+			Status:     TieringMoveMoved,
+		}
+
+		if err := s.transfer(ctx, ep.sourceFS, ep.targetFS, c.Path, c.TargetPath, c.Size); err != nil {
+			move.Status = TieringMoveFailed
+			msg := err.Error()
+			move.ErrorMessage = &msg
+			run.FilesFailed++
+			s.logger.Warn("Failed to move file to new tier",
+				zap.Int64("file_id", c.FileID),
+				zap.String("path", c.Path),
+				zap.Error(err))
+		} else {
+			run.FilesMoved++
+			run.BytesMoved += c.Size
+			if err := s.rewriteCatalog(ctx, c.FileID, ep.target, c.TargetPath, policy.TargetRoot); err != nil {
+				// The data already moved: record it so an undo can bring it
+				// back, then stop before the catalog drifts further
+				msg := err.Error()
+				move.ErrorMessage = &msg
+				s.recordMove(ctx, move)
+				return err
+			}
+		}
+
+		if err := s.recordMove(ctx, move); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transfer copies a file to the target, verifies its size and then removes
+// the source. An existing file at the destination is never overwritten.
+func (s *TieringService) transfer(ctx context.Context, src, dst filesystem.FileSystemClient, srcPath, dstPath string, size int64) error {
+	exists, err := dst.FileExists(ctx, dstPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%s already exists on the target", dstPath)
+	}
+	if dir := path.Dir(dstPath); dir != "." && dir != "/" {
+		// Clients differ on whether existing directories are an error; the
+		// write below reports anything that actually matters
+		_ = dst.CreateDirectory(ctx, dir)
+	}
+
+	reader, err := src.ReadFile(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	err = dst.WriteFile(ctx, dstPath, reader)
+	if closeErr := reader.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		dst.DeleteFile(ctx, dstPath)
+		return err
+	}
+
+	info, err := dst.GetFileInfo(ctx, dstPath)
+	if err != nil {
+		dst.DeleteFile(ctx, dstPath)
+		return err
+	}
+	if info.Size != size {
+		dst.DeleteFile(ctx, dstPath)
+		return fmt.Errorf("size mismatch after copy: expected %d bytes, got %d", size, info.Size)
+	}
+
+	if err := src.DeleteFile(ctx, srcPath); err != nil {
+		dst.DeleteFile(ctx, dstPath)
+		return fmt.Errorf("failed to remove source after copy: %w", err)
+	}
+	return nil
+}
+
+// rewriteCatalog points a file's catalog entry at its new location. The row
+// keeps its ID, so metadata, favourites and media links stay attached.
+func (s *TieringService) rewriteCatalog(ctx context.Context, fileID int64, root *models.StorageRoot, newPath, rootName string) error {
+	parentID, err := ensureDirectoryPathExists(ctx, s.db, root.ID, newPath, s.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create catalog directories for %s: %w", newPath, err)
+	}
+
+	return database.NewTxContext(s.db, database.DefaultTransactionConfig()).RunInTransaction(ctx, func(tx *database.Transaction) error {
+		if _, err := tx.Exec(
+			`UPDATE files SET storage_root_id = ?, path = ?, parent_id = ?, last_scan_at = ? WHERE id = ?`,
+			root.ID, newPath, parentID, s.now(), fileID); err != nil {
+			return fmt.Errorf("failed to rewrite catalog path: %w", err)
+		}
+		if _, err := tx.Exec(
+			`UPDATE file_versions SET storage_root = ?, path = ? WHERE file_id = ?`,
+			rootName, newPath, fileID); err != nil {
+			return fmt.Errorf("failed to rewrite version history path: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *TieringService) recordMove(ctx context.Context, move *TieringMove) error {
+	move.MovedAt = s.now()
+	id, err := s.db.InsertReturningID(ctx,
+		`INSERT INTO tiering_moves (run_id, file_id, source_root, source_path, target_root, target_path, size, status, error_message, moved_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		move.RunID, move.FileID, move.SourceRoot, move.SourcePath, move.TargetRoot, move.TargetPath,
+		move.Size, move.Status, move.ErrorMessage, move.MovedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record tiering move: %w", err)
+	}
+	move.ID = id
+	return nil
+}
+
+func (s *TieringService) saveRun(ctx context.Context, run *TieringRun) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tiering_runs SET status = ?, files_moved = ?, bytes_moved = ?, files_failed = ?, completed_at = ?, undone_at = ?
+		 WHERE id = ?`,
+		run.Status, run.FilesMoved, run.BytesMoved, run.FilesFailed, run.CompletedAt, run.UndoneAt, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tiering run: %w", err)
+	}
+	return nil
+}
+
+// UndoRun moves every file of a completed run back to where it came from
+// and restores its catalog path. Files that fail to move back leave the run
+// in undo_failed so the undo can be retried.
+func (s *TieringService) UndoRun(ctx context.Context, runID int64) (*TieringRun, error) {
+	run, err := s.GetRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	switch run.Status {
+	case TieringRunCompleted, TieringRunFailed, TieringRunUndoFailed:
+	case TieringRunUndone:
+		return nil, fmt.Errorf("tiering run %d has already been undone", runID)
+	default:
+		return nil, fmt.Errorf("tiering run %d is still running", runID)
+	}
+
+	s.mu.Lock()
+	if s.running[run.PolicyID] {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("tiering policy %d is already running", run.PolicyID)
+	}
+	s.running[run.PolicyID] = true
+	s.mu.Unlock()
+	defer s.finishRunning(run.PolicyID)
+
+	endpoints := make(map[string]*tieringEndpoints)
+	defer func() {
+		for _, ep := range endpoints {
+			ep.close(ctx)
+		}
+	}()
+
+	failed := 0
+	// Undo in reverse so the catalog passes back through the same states
+	for i := len(run.Moves) - 1; i >= 0; i-- {
+		move := &run.Moves[i]
+		if move.Status != TieringMoveMoved {
+			continue
+		}
+
+		key := move.TargetRoot + "\x00" + move.SourceRoot
+		ep, ok := endpoints[key]
+		if !ok {
+			if ep, err = s.connect(ctx, move.TargetRoot, move.SourceRoot); err != nil {
+				return nil, err
+			}
+			endpoints[key] = ep
+		}
+
+		err := s.transfer(ctx, ep.sourceFS, ep.targetFS, move.TargetPath, move.SourcePath, move.Size)
+		if err == nil {
+			err = s.rewriteCatalog(ctx, move.FileID, ep.target, move.SourcePath, move.SourceRoot)
+		}
+		if err != nil {
+			failed++
+			s.logger.Warn("Failed to undo tiering move",
+				zap.Int64("move_id", move.ID),
+				zap.String("path", move.TargetPath),
+				zap.Error(err))
+			continue
+		}
+
+		move.Status = TieringMoveUndone
+		if _, err := s.db.ExecContext(ctx, `UPDATE tiering_moves SET status = ? WHERE id = ?`, move.Status, move.ID); err != nil {
+			return nil, fmt.Errorf("failed to update tiering move: %w", err)
+		}
+	}
+
+	run.Status = TieringRunUndone
+	if failed > 0 {
+		run.Status = TieringRunUndoFailed
+	} else {
+		undone := s.now()
+		run.UndoneAt = &undone
+	}
+	if err := s.saveRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+const tieringRunColumns = `id, policy_id, status, files_moved, bytes_moved, files_failed, started_by, started_at, completed_at, undone_at`
+
+func scanTieringRun(row interface{ Scan(...interface{}) error }) (*TieringRun, error) {
+	var run TieringRun
+	err := row.Scan(&run.ID, &run.PolicyID, &run.Status, &run.FilesMoved, &run.BytesMoved, &run.FilesFailed,
+		&run.StartedBy, &run.StartedAt, &run.CompletedAt, &run.UndoneAt)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// GetRun returns a tiering run together with its moves.
+func (s *TieringService) GetRun(ctx context.Context, id int64) (*TieringRun, error) {
+	run, err := scanTieringRun(s.db.QueryRowContext(ctx,
+		`SELECT `+tieringRunColumns+` FROM tiering_runs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("tiering run not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tiering run: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, run_id, file_id, source_root, source_path, target_root, target_path, size, status, error_message, moved_at
+		 FROM tiering_moves WHERE run_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tiering moves: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m TieringMove
+		if err := rows.Scan(&m.ID, &m.RunID, &m.FileID, &m.SourceRoot, &m.SourcePath, &m.TargetRoot, &m.TargetPath,
+			&m.Size, &m.Status, &m.ErrorMessage, &m.MovedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tiering move: %w", err)
+		}
+		run.Moves = append(run.Moves, m)
+	}
+	return run, rows.Err()
+}
+
+// ListRuns returns the runs of a policy, newest first. A policyID of zero
+// lists the runs of every policy.
+func (s *TieringService) ListRuns(ctx context.Context, policyID int64) ([]TieringRun, error) {
+	query := `SELECT ` + tieringRunColumns + ` FROM tiering_runs`
+	var args []interface{}
+	if policyID != 0 {
+		query += ` WHERE policy_id = ?`
+		args = append(args, policyID)
+	}
+	query += ` ORDER BY started_at DESC, id DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tiering runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []TieringRun
+	for rows.Next() {
+		run, err := scanTieringRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tiering run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// RunEnabledPolicies runs every enabled policy once, one after another.
+func (s *TieringService) RunEnabledPolicies(ctx context.Context) {
+	policies, err := s.ListPolicies(ctx)
+	if err != nil {
+		s.logger.Error("Failed to load tiering policies", zap.Error(err))
+		return
+	}
+	for _, policy := range policies {
+		if !policy.Enabled {
+			continue
+		}
+		if _, err := s.RunPolicy(ctx, policy.ID, nil); err != nil {
+			s.logger.Warn("Skipped tiering policy", zap.String("policy", policy.Name), zap.Error(err))
+		}
+	}
+}
+
+// Start runs the enabled policies every Interval until Stop is called.
+func (s *TieringService) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunEnabledPolicies(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for runs in progress to finish.
+func (s *TieringService) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"catalogizer/database"
+	"catalogizer/filesystem"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupTieringTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE storage_roots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			protocol TEXT NOT NULL,
+			host TEXT, port INTEGER, path TEXT, username TEXT, password TEXT,
+			domain TEXT, mount_point TEXT, options TEXT, url TEXT
+		);
+		CREATE TABLE files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			extension TEXT,
+			mime_type TEXT,
+			file_type TEXT,
+			size INTEGER NOT NULL,
+			is_directory BOOLEAN DEFAULT 0,
+			modified_at DATETIME NOT NULL,
+			accessed_at DATETIME,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			deleted BOOLEAN DEFAULT 0,
+			last_scan_at DATETIME,
+			parent_id INTEGER,
+			UNIQUE(storage_root_id, path)
+		);
+		CREATE TABLE file_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage_root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			file_id INTEGER
+		);
+		CREATE TABLE tiering_policies (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			tier TEXT NOT NULL,
+			source_root TEXT NOT NULL,
+			target_root TEXT NOT NULL,
+			target_path TEXT NOT NULL DEFAULT '',
+			min_age_days INTEGER NOT NULL DEFAULT 0,
+			unaccessed_days INTEGER NOT NULL DEFAULT 0,
+			max_access_count INTEGER,
+			min_size INTEGER NOT NULL DEFAULT 0,
+			file_types TEXT,
+			enabled BOOLEAN NOT NULL DEFAULT 1,
+			created_at DATETIME,
+			updated_at DATETIME
+		);
+		CREATE TABLE tiering_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			policy_id INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			files_moved INTEGER NOT NULL DEFAULT 0,
+			bytes_moved INTEGER NOT NULL DEFAULT 0,
+			files_failed INTEGER NOT NULL DEFAULT 0,
+			started_by INTEGER,
+			started_at DATETIME,
+			completed_at DATETIME,
+			undone_at DATETIME
+		);
+		CREATE TABLE tiering_moves (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id INTEGER NOT NULL,
+			file_id INTEGER NOT NULL,
+			source_root TEXT NOT NULL,
+			source_path TEXT NOT NULL,
+			target_root TEXT NOT NULL,
+			target_path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			status TEXT NOT NULL,
+			error_message TEXT,
+			moved_at DATETIME
+		);`)
+	require.NoError(t, err)
+
+	return database.WrapDB(sqlDB, database.DialectSQLite)
+}
+
+// localRootClients serves every storage root from the local directory in
+// its path column.
+type localRootClients struct{}
+
+func (localRootClients) NewClient(root *models.StorageRoot) (filesystem.FileSystemClient, error) {
+	if root.Path == nil {
+		return nil, fmt.Errorf("no path for %s", root.Name)
+	}
+	return filesystem.NewLocalClient(&filesystem.LocalConfig{BasePath: *root.Path}), nil
+}
+
+type tieringFixture struct {
+	db       *database.DB
+	svc      *TieringService
+	hotDir   string
+	coldDir  string
+	oldFile  int64
+	newFile  int64
+	usedFile int64
+}
+
+func newTieringFixture(t *testing.T) *tieringFixture {
+	t.Helper()
+	f := &tieringFixture{db: setupTieringTestDB(t), hotDir: t.TempDir(), coldDir: t.TempDir()}
+	ctx := context.Background()
+
+	_, err := f.db.ExecContext(ctx,
+		`INSERT INTO storage_roots (name, protocol, path) VALUES ('fast-nas', 'local', ?), ('archive-nas', 'local', ?)`,
+		f.hotDir, f.coldDir)
+	require.NoError(t, err)
+
+	now := time.Now()
+	addFile := func(rel string, content string, modified time.Time, accesses int) int64 {
+		full := filepath.Join(f.hotDir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+		id, err := f.db.InsertReturningID(ctx,
+			`INSERT INTO files (storage_root_id, path, name, file_type, size, modified_at, access_count)
+			 VALUES (1, ?, ?, 'video', ?, ?, ?)`,
+			rel, filepath.Base(rel), len(content), modified, accesses)
+		require.NoError(t, err)
+		return id
+	}
+	f.oldFile = addFile("films/1998/old.mkv", "old film", now.AddDate(-3, 0, 0), 0)
+	f.newFile = addFile("films/2024/new.mkv", "new film", now.AddDate(0, -1, 0), 0)
+	f.usedFile = addFile("films/1999/classic.mkv", "classic", now.AddDate(-3, 0, 0), 40)
+
+	_, err = f.db.ExecContext(ctx, `INSERT INTO file_versions (storage_root, path, file_id) VALUES ('fast-nas', 'films/1998/old.mkv', ?)`, f.oldFile)
+	require.NoError(t, err)
+
+	f.svc = NewTieringService(f.db, zap.NewNop(), localRootClients{}, TieringConfig{})
+	return f
+}
+
+func (f *tieringFixture) location(t *testing.T, fileID int64) (string, string) {
+	t.Helper()
+	var root, path string
+	require.NoError(t, f.db.QueryRowContext(context.Background(),
+		`SELECT sr.name, f.path FROM files f JOIN storage_roots sr ON sr.id = f.storage_root_id WHERE f.id = ?`,
+		fileID).Scan(&root, &path))
+	return root, path
+}
+
+func archivePolicy() *TieringPolicy {
+	maxAccesses := 5
+	return &TieringPolicy{
+		Name:           "archive unwatched films",
+		Tier:           StorageTierCold,
+		SourceRoot:     "fast-nas",
+		TargetRoot:     "archive-nas",
+		TargetPath:     "/from-fast/",
+		UnaccessedDays: 730,
+		MaxAccessCount: &maxAccesses,
+		FileTypes:      []string{"video"},
+		Enabled:        true,
+	}
+}
+
+func TestTieringService_PolicyValidation(t *testing.T) {
+	f := newTieringFixture(t)
+	ctx := context.Background()
+
+	invalid := archivePolicy()
+	invalid.Tier = "lukewarm"
+	assert.ErrorContains(t, f.svc.CreatePolicy(ctx, invalid), "invalid policy")
+
+	invalid = archivePolicy()
+	invalid.UnaccessedDays = 0
+	invalid.MaxAccessCount = nil
+	assert.ErrorContains(t, f.svc.CreatePolicy(ctx, invalid), "at least one")
+
+	invalid = archivePolicy()
+	invalid.TargetRoot = invalid.SourceRoot
+	invalid.TargetPath = "/"
+	assert.ErrorContains(t, f.svc.CreatePolicy(ctx, invalid), "differ")
+
+	policy := archivePolicy()
+	require.NoError(t, f.svc.CreatePolicy(ctx, policy))
+	assert.Equal(t, "from-fast", policy.TargetPath)
+
+	loaded, err := f.svc.GetPolicy(ctx, policy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"video"}, loaded.FileTypes)
+	require.NotNil(t, loaded.MaxAccessCount)
+	assert.Equal(t, 5, *loaded.MaxAccessCount)
+
+	loaded.MinSize = 1024
+	require.NoError(t, f.svc.UpdatePolicy(ctx, loaded))
+	policies, err := f.svc.ListPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, int64(1024), policies[0].MinSize)
+
+	require.NoError(t, f.svc.DeletePolicy(ctx, policy.ID))
+	_, err = f.svc.GetPolicy(ctx, policy.ID)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestTieringService_Candidates(t *testing.T) {
+	f := newTieringFixture(t)
+	ctx := context.Background()
+	policy := archivePolicy()
+	require.NoError(t, f.svc.CreatePolicy(ctx, policy))
+
+	candidates, err := f.svc.Candidates(ctx, policy, 0)
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, f.oldFile, candidates[0].FileID)
+	assert.Equal(t, "from-fast/films/1998/old.mkv", candidates[0].TargetPath)
+
+	// A recent access keeps the file on the fast tier
+	require.NoError(t, f.svc.RecordAccess(ctx, f.oldFile))
+	candidates, err = f.svc.Candidates(ctx, policy, 0)
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+}
+
+func TestTieringService_RunAndUndo(t *testing.T) {
+	f := newTieringFixture(t)
+	ctx := context.Background()
+	policy := archivePolicy()
+	require.NoError(t, f.svc.CreatePolicy(ctx, policy))
+
+	userID := 1
+	run, err := f.svc.RunPolicy(ctx, policy.ID, &userID)
+	require.NoError(t, err)
+	assert.Equal(t, TieringRunCompleted, run.Status)
+	assert.Equal(t, 1, run.FilesMoved)
+	assert.Equal(t, int64(len("old film")), run.BytesMoved)
+
+	assert.NoFileExists(t, filepath.Join(f.hotDir, "films", "1998", "old.mkv"))
+	data, err := os.ReadFile(filepath.Join(f.coldDir, "from-fast", "films", "1998", "old.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, "old film", string(data))
+
+	root, path := f.location(t, f.oldFile)
+	assert.Equal(t, "archive-nas", root)
+	assert.Equal(t, "from-fast/films/1998/old.mkv", path)
+
+	var versionRoot string
+	require.NoError(t, f.db.QueryRowContext(ctx, `SELECT storage_root FROM file_versions WHERE file_id = ?`, f.oldFile).Scan(&versionRoot))
+	assert.Equal(t, "archive-nas", versionRoot)
+
+	// Untouched files stay put
+	root, _ = f.location(t, f.newFile)
+	assert.Equal(t, "fast-nas", root)
+
+	loaded, err := f.svc.GetRun(ctx, run.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Moves, 1)
+	assert.Equal(t, TieringMoveMoved, loaded.Moves[0].Status)
+
+	undone, err := f.svc.UndoRun(ctx, run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TieringRunUndone, undone.Status)
+	assert.NotNil(t, undone.UndoneAt)
+
+	assert.FileExists(t, filepath.Join(f.hotDir, "films", "1998", "old.mkv"))
+	assert.NoFileExists(t, filepath.Join(f.coldDir, "from-fast", "films", "1998", "old.mkv"))
+	root, path = f.location(t, f.oldFile)
+	assert.Equal(t, "fast-nas", root)
+	assert.Equal(t, "films/1998/old.mkv", path)
+
+	_, err = f.svc.UndoRun(ctx, run.ID)
+	assert.ErrorContains(t, err, "already been undone")
+
+	runs, err := f.svc.ListRuns(ctx, policy.ID)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
+
+func TestTieringService_NeverOverwritesTarget(t *testing.T) {
+	f := newTieringFixture(t)
+	ctx := context.Background()
+	policy := archivePolicy()
+	require.NoError(t, f.svc.CreatePolicy(ctx, policy))
+
+	existing := filepath.Join(f.coldDir, "from-fast", "films", "1998", "old.mkv")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0755))
+	require.NoError(t, os.WriteFile(existing, []byte("someone else's file"), 0644))
+
+	run, err := f.svc.RunPolicy(ctx, policy.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, run.FilesMoved)
+	assert.Equal(t, 1, run.FilesFailed)
+
+	data, err := os.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "someone else's file", string(data))
+	assert.FileExists(t, filepath.Join(f.hotDir, "films", "1998", "old.mkv"))
+	root, _ := f.location(t, f.oldFile)
+	assert.Equal(t, "fast-nas", root)
+}
+
+type lockedRoots map[string]bool
+
+func (l lockedRoots) IsLocked(storageRoot string) bool { return l[storageRoot] }
+
+func TestTieringService_RespectsLockdown(t *testing.T) {
+	f := newTieringFixture(t)
+	ctx := context.Background()
+	policy := archivePolicy()
+	require.NoError(t, f.svc.CreatePolicy(ctx, policy))
+	f.svc.SetLockdownChecker(lockedRoots{"archive-nas": true})
+
+	run, err := f.svc.RunPolicy(ctx, policy.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, TieringRunFailed, run.Status)
+	assert.FileExists(t, filepath.Join(f.hotDir, "films", "1998", "old.mkv"))
+}
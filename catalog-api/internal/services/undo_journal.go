@@ -0,0 +1,277 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Kinds of undoable operations
+const (
+	UndoKindDelete     = "delete"
+	UndoKindMove       = "move"
+	UndoKindTagRemoval = "tag_removal"
+)
+
+// Undo operation statuses
+const (
+	UndoStatusPending = "pending"
+	UndoStatusUndone  = "undone"
+	UndoStatusExpired = "expired"
+)
+
+// UndoOperation is a destructive action in the journal. Its user can
+// reverse it until ExpiresAt; an undo that fails leaves it pending with
+// the reason in LastError, so it can be tried again.
+type UndoOperation struct {
+	ID         string          `json:"id"`
+	UserID     int             `json:"user_id"`
+	Kind       string          `json:"kind"`
+	Resource   string          `json:"resource"`
+	ResourceID int64           `json:"resource_id"`
+	Summary    string          `json:"summary"`
+	Status     string          `json:"status"`
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ExpiresAt  time.Time       `json:"expires_at"`
+	UndoneAt   *time.Time      `json:"undone_at,omitempty"`
+	Payload    json.RawMessage `json:"-"`
+}
+
+// DecodePayload unmarshals the data recorded to reverse the operation.
+func (op *UndoOperation) DecodePayload(v interface{}) error {
+	if len(op.Payload) == 0 {
+		return fmt.Errorf("undo operation %s has no payload", op.ID)
+	}
+	return json.Unmarshal(op.Payload, v)
+}
+
+// UndoReverser reverses an operation. Its errors say why the operation
+// can no longer be undone, for example because the resource changed since.
+type UndoReverser func(ctx context.Context, op *UndoOperation) error
+
+// undoReverser is a registered reverser and how long after an operation
+// it can still work.
+type undoReverser struct {
+	reverse UndoReverser
+	maxAge  time.Duration
+}
+
+// UndoJournalConfig sets how long operations can be undone.
+type UndoJournalConfig struct {
+	Window time.Duration
+}
+
+// UndoJournal records destructive operations (deletes, moves and tag
+// removals) and reverses them on request. Each operation can be undone
+// once, only by the user who performed it, and only within the window
+// after it; older entries are dropped from the journal.
+type UndoJournal struct {
+	db        *database.DB
+	logger    *zap.Logger
+	config    UndoJournalConfig
+	mu        sync.Mutex
+	reversers map[string]undoReverser
+	now       func() time.Time
+}
+
+// NewUndoJournal creates an UndoJournal. Operations can be undone for 30
+// minutes unless cfg says otherwise.
+func NewUndoJournal(db *database.DB, logger *zap.Logger, cfg UndoJournalConfig) *UndoJournal {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Minute
+	}
+	return &UndoJournal{
+		db:        db,
+		logger:    logger,
+		config:    cfg,
+		reversers: make(map[string]undoReverser),
+		now:       time.Now,
+	}
+}
+
+// Window returns how long after an operation it can be undone.
+func (j *UndoJournal) Window() time.Duration {
+	return j.config.Window
+}
+
+// RegisterReverser makes operations of kind on resource undoable. A
+// positive maxAge shortens the window for operations whose reversal
+// stops working sooner, such as deletes whose rows are purged from the
+// recycle bin.
+func (j *UndoJournal) RegisterReverser(kind, resource string, maxAge time.Duration, reverse UndoReverser) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.reversers[kind+"/"+resource] = undoReverser{reverse: reverse, maxAge: maxAge}
+}
+
+func (j *UndoJournal) reverser(kind, resource string) (undoReverser, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.reversers[kind+"/"+resource]
+	return r, ok
+}
+
+// Record journals an operation userID just performed, with payload as the
+// data its reversal needs, and returns it with its ID and expiry.
+func (j *UndoJournal) Record(ctx context.Context, userID int, kind, resource string, resourceID int64, summary string, payload interface{}) (*UndoOperation, error) {
+	r, ok := j.reverser(kind, resource)
+	if !ok {
+		return nil, fmt.Errorf("invalid undo operation: %s of %s cannot be undone", kind, resource)
+	}
+
+	now := j.now().UTC()
+	window := j.config.Window
+	if r.maxAge > 0 && r.maxAge < window {
+		window = r.maxAge
+	}
+	op := &UndoOperation{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Kind:       kind,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Summary:    summary,
+		Status:     UndoStatusPending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(window),
+	}
+	var encoded interface{}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode undo payload: %w", err)
+		}
+		op.Payload = data
+		encoded = string(data)
+	}
+
+	if _, err := j.db.ExecContext(ctx,
+		`INSERT INTO undo_operations (id, user_id, kind, resource, resource_id, summary, payload, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		op.ID, op.UserID, op.Kind, op.Resource, op.ResourceID, op.Summary, encoded, op.CreatedAt, op.ExpiresAt); err != nil {
+		j.logger.Warn("Failed to record undo operation",
+			zap.String("kind", kind), zap.String("resource", resource), zap.Int64("resource_id", resourceID), zap.Error(err))
+		return nil, fmt.Errorf("failed to record undo operation: %w", err)
+	}
+	if _, err := j.db.ExecContext(ctx,
+		`DELETE FROM undo_operations WHERE expires_at < ?`, now); err != nil {
+		j.logger.Warn("Failed to prune the undo journal", zap.Error(err))
+	}
+	return op, nil
+}
+
+const undoOperationColumns = `id, user_id, kind, resource, resource_id, summary, payload, last_error, created_at, expires_at, undone_at`
+
+func (j *UndoJournal) scanOperation(row shareLinkScanner) (*UndoOperation, error) {
+	op := &UndoOperation{}
+	var payload, lastError sql.NullString
+	var undoneAt sql.NullTime
+	if err := row.Scan(&op.ID, &op.UserID, &op.Kind, &op.Resource, &op.ResourceID, &op.Summary,
+		&payload, &lastError, &op.CreatedAt, &op.ExpiresAt, &undoneAt); err != nil {
+		return nil, err
+	}
+	if payload.Valid {
+		op.Payload = json.RawMessage(payload.String)
+	}
+	op.LastError = lastError.String
+	switch {
+	case undoneAt.Valid:
+		op.UndoneAt = &undoneAt.Time
+		op.Status = UndoStatusUndone
+	case !j.now().Before(op.ExpiresAt):
+		op.Status = UndoStatusExpired
+	default:
+		op.Status = UndoStatusPending
+	}
+	return op, nil
+}
+
+// List returns the operations userID can still undo, most recent first.
+func (j *UndoJournal) List(ctx context.Context, userID int) ([]UndoOperation, error) {
+	rows, err := j.db.QueryContext(ctx,
+		`SELECT `+undoOperationColumns+` FROM undo_operations
+		 WHERE user_id = ? AND undone_at IS NULL AND expires_at > ?
+		 ORDER BY created_at DESC`, userID, j.now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list undo operations: %w", err)
+	}
+	defer rows.Close()
+
+	operations := []UndoOperation{}
+	for rows.Next() {
+		op, err := j.scanOperation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan undo operation: %w", err)
+		}
+		operations = append(operations, *op)
+	}
+	return operations, rows.Err()
+}
+
+// Undo reverses one of userID's operations. Operations of other users
+// are not found.
+func (j *UndoJournal) Undo(ctx context.Context, userID int, id string) (*UndoOperation, error) {
+	op, err := j.scanOperation(j.db.QueryRowContext(ctx,
+		`SELECT `+undoOperationColumns+` FROM undo_operations WHERE id = ? AND user_id = ?`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("undo operation %s not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load undo operation: %w", err)
+	}
+	switch op.Status {
+	case UndoStatusUndone:
+		return nil, fmt.Errorf("undo operation %s has already been undone", id)
+	case UndoStatusExpired:
+		return nil, fmt.Errorf("undo operation %s has expired", id)
+	}
+	r, ok := j.reverser(op.Kind, op.Resource)
+	if !ok {
+		return nil, fmt.Errorf("undo operation %s can no longer be undone: %s of %s is not supported", id, op.Kind, op.Resource)
+	}
+
+	// One undo at a time, so an operation is never reversed twice
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var undone int
+	if err := j.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM undo_operations WHERE id = ? AND undone_at IS NOT NULL`, id).Scan(&undone); err != nil {
+		return nil, fmt.Errorf("failed to load undo operation: %w", err)
+	}
+	if undone > 0 {
+		return nil, fmt.Errorf("undo operation %s has already been undone", id)
+	}
+
+	if err := r.reverse(ctx, op); err != nil {
+		if _, dbErr := j.db.ExecContext(ctx,
+			`UPDATE undo_operations SET last_error = ? WHERE id = ?`, err.Error(), id); dbErr != nil {
+			j.logger.Warn("Failed to record undo failure", zap.String("operation_id", id), zap.Error(dbErr))
+		}
+		return nil, fmt.Errorf("undo operation %s can no longer be undone: %w", id, err)
+	}
+
+	undoneAt := j.now().UTC()
+	if _, err := j.db.ExecContext(ctx,
+		`UPDATE undo_operations SET undone_at = ?, last_error = NULL WHERE id = ?`, undoneAt, id); err != nil {
+		return nil, fmt.Errorf("failed to record undo: %w", err)
+	}
+	op.UndoneAt = &undoneAt
+	op.Status = UndoStatusUndone
+	op.LastError = ""
+	j.logger.Info("Undid operation",
+		zap.String("operation_id", id), zap.String("kind", op.Kind),
+		zap.String("resource", op.Resource), zap.Int64("resource_id", op.ResourceID), zap.Int("user_id", userID))
+	return op, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUndoTestJournal(t *testing.T) *UndoJournal {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE undo_operations (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			resource_id INTEGER NOT NULL DEFAULT 0,
+			summary TEXT NOT NULL DEFAULT '',
+			payload TEXT,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			undone_at DATETIME
+		)`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewUndoJournal(db, nil, UndoJournalConfig{Window: time.Hour})
+}
+
+func TestUndoJournal_RecordListUndo(t *testing.T) {
+	journal := newUndoTestJournal(t)
+	ctx := context.Background()
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	journal.now = func() time.Time { return now }
+
+	var restoredTags []string
+	journal.RegisterReverser(UndoKindTagRemoval, "favorites", 0, func(ctx context.Context, op *UndoOperation) error {
+		return op.DecodePayload(&restoredTags)
+	})
+	var restored []int64
+	journal.RegisterReverser(UndoKindDelete, "media", 10*time.Minute, func(ctx context.Context, op *UndoOperation) error {
+		restored = append(restored, op.ResourceID)
+		return nil
+	})
+
+	_, err := journal.Record(ctx, 7, UndoKindMove, "files", 1, "Moved", nil)
+	assert.ErrorContains(t, err, "invalid undo operation")
+
+	tags, err := journal.Record(ctx, 7, UndoKindTagRemoval, "favorites", 3, "Removed tags", []string{"noir"})
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), tags.ExpiresAt)
+	now = now.Add(time.Minute)
+	media, err := journal.Record(ctx, 7, UndoKindDelete, "media", 9, "Deleted media item 9", nil)
+	require.NoError(t, err)
+	// Deletes are only undoable while their reversal still works
+	assert.Equal(t, now.Add(10*time.Minute), media.ExpiresAt)
+
+	operations, err := journal.List(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, operations, 2)
+	assert.Equal(t, media.ID, operations[0].ID)
+	assert.Equal(t, UndoStatusPending, operations[0].Status)
+	assert.Equal(t, tags.ID, operations[1].ID)
+
+	// Other users cannot see or undo the operations
+	operations, err = journal.List(ctx, 8)
+	require.NoError(t, err)
+	assert.Empty(t, operations)
+	_, err = journal.Undo(ctx, 8, media.ID)
+	assert.ErrorContains(t, err, "not found")
+
+	op, err := journal.Undo(ctx, 7, tags.ID)
+	require.NoError(t, err)
+	assert.Equal(t, UndoStatusUndone, op.Status)
+	require.NotNil(t, op.UndoneAt)
+	assert.Equal(t, []string{"noir"}, restoredTags)
+	_, err = journal.Undo(ctx, 7, tags.ID)
+	assert.ErrorContains(t, err, "already been undone")
+
+	// Past its expiry an operation is gone from the list and cannot be undone
+	now = now.Add(10 * time.Minute)
+	operations, err = journal.List(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, operations)
+	_, err = journal.Undo(ctx, 7, media.ID)
+	assert.ErrorContains(t, err, "has expired")
+	assert.Empty(t, restored)
+
+	_, err = journal.Undo(ctx, 7, "missing")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestUndoJournal_FailedUndoStaysPending(t *testing.T) {
+	journal := newUndoTestJournal(t)
+	ctx := context.Background()
+
+	attempts := 0
+	journal.RegisterReverser(UndoKindMove, "tiering_runs", 0, func(ctx context.Context, op *UndoOperation) error {
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("tiering run %d is still running", op.ResourceID)
+		}
+		return nil
+	})
+
+	recorded, err := journal.Record(ctx, 7, UndoKindMove, "tiering_runs", 4, "Ran tiering policy 2", nil)
+	require.NoError(t, err)
+
+	_, err = journal.Undo(ctx, 7, recorded.ID)
+	assert.ErrorContains(t, err, "can no longer be undone: tiering run 4 is still running")
+	operations, err := journal.List(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, operations, 1)
+	assert.Equal(t, UndoStatusPending, operations[0].Status)
+	assert.Equal(t, "tiering run 4 is still running", operations[0].LastError)
+
+	op, err := journal.Undo(ctx, 7, recorded.ID)
+	require.NoError(t, err)
+	assert.Empty(t, op.LastError)
+	assert.Equal(t, 2, attempts)
+
+	operations, err = journal.List(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, operations)
+}
@@ -5,6 +5,7 @@ import (
 	"catalogizer/filesystem"
 	"catalogizer/models"
 	"context"
+	"encoding/json"
 	"fmt"
 	"mime"
 	"path/filepath"
@@ -33,6 +34,7 @@ type UniversalScanner struct {
 	protocolScanners   map[string]ProtocolScanner
 	activeScansMu      sync.RWMutex
 	activeScans        map[string]*ScanStatus
+	scanListeners      []func(root *models.StorageRoot)
 }
 
 // ScanJob represents a scan operation for any protocol
@@ -118,6 +120,8 @@ func NewUniversalScanner(db *database.DB, logger *zap.Logger, renameTracker *Uni
 	scanner.RegisterProtocolScanner("ftp", NewFTPScanner(logger))
 	scanner.RegisterProtocolScanner("nfs", NewNFSScanner(logger))
 	scanner.RegisterProtocolScanner("webdav", NewWebDAVScanner(logger))
+	scanner.RegisterProtocolScanner("rclone", NewRcloneScanner(db, logger))
+	scanner.RegisterProtocolScanner("sftp", NewSFTPScanner(db, logger))
 
 	return scanner
 }
@@ -127,6 +131,20 @@ func (s *UniversalScanner) SetAggregationService(svc *AggregationService) {
 	s.aggregationService = svc
 }
 
+// OnScanFinished registers fn to run after a scan of a storage root ends
+// and its files have been aggregated. Failed scans are reported too, since
+// they may have changed part of the catalog. Listeners must be registered
+// before Start.
+func (s *UniversalScanner) OnScanFinished(fn func(root *models.StorageRoot)) {
+	s.scanListeners = append(s.scanListeners, fn)
+}
+
+func (s *UniversalScanner) notifyScanFinished(root *models.StorageRoot) {
+	for _, fn := range s.scanListeners {
+		fn(root)
+	}
+}
+
 // RegisterProtocolScanner registers a protocol-specific scanner
 func (s *UniversalScanner) RegisterProtocolScanner(protocol string, scanner ProtocolScanner) {
 	s.protocolScannersMu.Lock()
@@ -246,12 +264,7 @@ func (s *UniversalScanner) processScanJob(job ScanJob, workerID int) {
 	}
 
 	// Create filesystem client
-	client, err := s.clientFactory.CreateClient(&filesystem.StorageConfig{
-		ID:       job.StorageRoot.Name,
-		Name:     job.StorageRoot.Name,
-		Protocol: job.StorageRoot.Protocol,
-		Settings: s.storageRootToSettings(job.StorageRoot),
-	})
+	client, err := s.NewClient(job.StorageRoot)
 	if err != nil {
 		s.logger.Error("Failed to create filesystem client",
 			zap.String("protocol", job.StorageRoot.Protocol),
@@ -278,6 +291,7 @@ func (s *UniversalScanner) processScanJob(job ScanJob, workerID int) {
 			zap.String("job_id", job.ID),
 			zap.Error(err))
 		status.updateStatus("failed")
+		s.notifyScanFinished(job.StorageRoot)
 		return
 	}
 
@@ -299,8 +313,11 @@ func (s *UniversalScanner) processScanJob(job ScanJob, workerID int) {
 					zap.String("job_id", job.ID),
 					zap.Error(err))
 			}
+			s.notifyScanFinished(job.StorageRoot)
 		}()
+		return
 	}
+	s.notifyScanFinished(job.StorageRoot)
 }
 
 // GetActiveScanStatus returns the status of an active scan
@@ -325,6 +342,17 @@ func (s *UniversalScanner) GetAllActiveScanStatuses() map[string]*ScanStatus {
 	return statuses
 }
 
+// NewClient creates an unconnected filesystem client for a storage root,
+// configured the same way as for scanning.
+func (s *UniversalScanner) NewClient(root *models.StorageRoot) (filesystem.FileSystemClient, error) {
+	return s.clientFactory.CreateClient(&filesystem.StorageConfig{
+		ID:       root.Name,
+		Name:     root.Name,
+		Protocol: root.Protocol,
+		Settings: s.storageRootToSettings(root),
+	})
+}
+
 // storageRootToSettings converts StorageRoot to filesystem settings
 func (s *UniversalScanner) storageRootToSettings(root *models.StorageRoot) map[string]interface{} {
 	settings := make(map[string]interface{})
@@ -393,6 +421,49 @@ func (s *UniversalScanner) storageRootToSettings(root *models.StorageRoot) map[s
 		if root.Password != nil {
 			settings["password"] = *root.Password
 		}
+
+	case "sftp":
+		if root.Host != nil {
+			settings["host"] = *root.Host
+		}
+		if root.Port != nil {
+			settings["port"] = *root.Port
+		}
+		if root.Path != nil {
+			settings["path"] = *root.Path
+		}
+		if root.Username != nil {
+			settings["username"] = *root.Username
+		}
+		if root.Password != nil {
+			settings["password"] = *root.Password
+		}
+		// Options carry the pinned host key and private key as a JSON object
+		if root.Options != nil {
+			var keys map[string]string
+			if err := json.Unmarshal([]byte(*root.Options), &keys); err != nil {
+				s.logger.Warn("Ignoring invalid SFTP options",
+					zap.String("storage_root", root.Name),
+					zap.Error(err))
+			}
+			for _, k := range []string{"host_key", "private_key", "private_key_path", "passphrase"} {
+				if v, ok := keys[k]; ok {
+					settings[k] = v
+				}
+			}
+		}
+
+	case "rclone":
+		// Host names a remote from rclone.conf; credentials stay in that file
+		if root.Host != nil {
+			settings["remote"] = *root.Host
+		}
+		if root.Path != nil {
+			settings["path"] = *root.Path
+		}
+		if root.Options != nil {
+			settings["config_file"] = *root.Options
+		}
 	}
 
 	return settings
@@ -1031,3 +1102,153 @@ func (s *WebDAVScanner) SupportsIncrementalScan() bool {
 func (s *WebDAVScanner) GetOptimalBatchSize() int {
 	return 200
 }
+
+// RcloneScanner scans any rclone remote. Every listing spawns an rclone
+// process, so directories are walked sequentially.
+type RcloneScanner struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+func NewRcloneScanner(db *database.DB, logger *zap.Logger) *RcloneScanner {
+	return &RcloneScanner{db: db, logger: logger}
+}
+
+func (s *RcloneScanner) ScanPath(ctx context.Context, client filesystem.FileSystemClient, job ScanJob, status *ScanStatus) error {
+	return s.scanDirectory(ctx, client, job.Path, job, status, 0)
+}
+
+func (s *RcloneScanner) scanDirectory(ctx context.Context, client filesystem.FileSystemClient, path string, job ScanJob, status *ScanStatus, depth int) error {
+	if depth > job.MaxDepth {
+		return nil
+	}
+
+	status.updateCurrentPath(path)
+
+	files, err := client.ListDirectory(ctx, path)
+	if err != nil {
+		status.incrementCounters(0, 0, 0, 0, 1)
+		return fmt.Errorf("failed to list rclone directory %s: %w", path, err)
+	}
+
+	for _, file := range files {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		fullPath := filepath.Join(path, file.Name)
+
+		if err := insertFileRecord(ctx, s.db, fullPath, file, job, status, s.logger); err != nil {
+			s.logger.Error("Failed to insert file record",
+				zap.String("path", fullPath),
+				zap.Error(err))
+			status.incrementCounters(0, 0, 0, 0, 1)
+		}
+
+		if file.IsDir {
+			if err := s.scanDirectory(ctx, client, fullPath, job, status, depth+1); err != nil {
+				s.logger.Error("Failed to scan rclone subdirectory",
+					zap.String("path", fullPath),
+					zap.Error(err))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *RcloneScanner) GetScanStrategy() ScanStrategy {
+	return ScanStrategy{
+		UseRecursiveListing:     false,
+		BatchSize:               500,
+		ParallelDirectories:     false,
+		ChecksumCalculation:     false, // would download every file
+		MetadataExtraction:      true,
+		RealTimeChangeDetection: false,
+	}
+}
+
+func (s *RcloneScanner) SupportsIncrementalScan() bool {
+	return true
+}
+
+func (s *RcloneScanner) GetOptimalBatchSize() int {
+	return 500
+}
+
+// SFTPScanner scans SSH servers over SFTP. Listings share one pooled SSH
+// connection, so directories are walked sequentially.
+type SFTPScanner struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+func NewSFTPScanner(db *database.DB, logger *zap.Logger) *SFTPScanner {
+	return &SFTPScanner{db: db, logger: logger}
+}
+
+func (s *SFTPScanner) ScanPath(ctx context.Context, client filesystem.FileSystemClient, job ScanJob, status *ScanStatus) error {
+	return s.scanDirectory(ctx, client, job.Path, job, status, 0)
+}
+
+func (s *SFTPScanner) scanDirectory(ctx context.Context, client filesystem.FileSystemClient, path string, job ScanJob, status *ScanStatus, depth int) error {
+	if depth > job.MaxDepth {
+		return nil
+	}
+
+	status.updateCurrentPath(path)
+
+	files, err := client.ListDirectory(ctx, path)
+	if err != nil {
+		status.incrementCounters(0, 0, 0, 0, 1)
+		return fmt.Errorf("failed to list SFTP directory %s: %w", path, err)
+	}
+
+	for _, file := range files {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		fullPath := filepath.Join(path, file.Name)
+
+		if err := insertFileRecord(ctx, s.db, fullPath, file, job, status, s.logger); err != nil {
+			s.logger.Error("Failed to insert file record",
+				zap.String("path", fullPath),
+				zap.Error(err))
+			status.incrementCounters(0, 0, 0, 0, 1)
+		}
+
+		if file.IsDir {
+			if err := s.scanDirectory(ctx, client, fullPath, job, status, depth+1); err != nil {
+				s.logger.Error("Failed to scan SFTP subdirectory",
+					zap.String("path", fullPath),
+					zap.Error(err))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SFTPScanner) GetScanStrategy() ScanStrategy {
+	return ScanStrategy{
+		UseRecursiveListing:     false,
+		BatchSize:               500,
+		ParallelDirectories:     false,
+		ChecksumCalculation:     false, // Expensive over network
+		MetadataExtraction:      true,
+		RealTimeChangeDetection: false,
+	}
+}
+
+func (s *SFTPScanner) SupportsIncrementalScan() bool {
+	return true
+}
+
+func (s *SFTPScanner) GetOptimalBatchSize() int {
+	return 500
+}
@@ -0,0 +1,537 @@
+package services
+
+import (
+	"bytes"
+	"catalogizer/database"
+	"catalogizer/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UserSettingsDocument is a user's settings blob, which holds both their
+// preference and setting keys, at a revision. Every change bumps the
+// revision; a client passes the revision it read as the base of its next
+// change.
+type UserSettingsDocument struct {
+	UserID   int                    `json:"user_id"`
+	Revision int64                  `json:"revision"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// SettingsConflictError is returned when a change touches keys that
+// another client changed after the revision the change was based on.
+type SettingsConflictError struct {
+	// Revision is the current revision of the settings
+	Revision int64
+	// Keys are the conflicting keys of the change, as JSON pointers
+	Keys []string
+}
+
+func (e *SettingsConflictError) Error() string {
+	return fmt.Sprintf("settings conflict: %s changed since the base revision", strings.Join(e.Keys, ", "))
+}
+
+// ErrSettingsRevisionExpired is returned when a change is based on a
+// revision too old for the changes made since to be known.
+var ErrSettingsRevisionExpired = errors.New("base revision is no longer available")
+
+// errSettingsRaced is returned by commit when another change landed
+// between reading the settings and writing them.
+var errSettingsRaced = errors.New("settings changed concurrently")
+
+const (
+	// defaultSettingsHistory is the number of revisions kept per user
+	defaultSettingsHistory = 50
+	// settingsWriteAttempts bounds the retries of a change that keeps
+	// losing races against other changes
+	settingsWriteAttempts = 3
+)
+
+// settingsSchema describes the keys of the settings blob, read from the
+// JSON names of models.UserPreferences and models.UserSettings.
+var settingsSchema = buildSettingsSchema(
+	reflect.TypeOf(models.UserPreferences{}),
+	reflect.TypeOf(models.UserSettings{}),
+)
+
+// settingsField is one key of the settings schema. Objects list their
+// own keys.
+type settingsField struct {
+	kind   reflect.Kind
+	fields map[string]*settingsField
+}
+
+// UserSettingsService updates user settings with JSON merge patches
+// (RFC 7396). Changes record the keys they touch, so that changes from
+// different clients compose unless they touch the same keys.
+type UserSettingsService struct {
+	db      *database.DB
+	logger  *zap.Logger
+	history int64
+	now     func() time.Time
+}
+
+// NewUserSettingsService creates a new UserSettingsService.
+func NewUserSettingsService(db *database.DB, logger *zap.Logger) *UserSettingsService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &UserSettingsService{
+		db:      db,
+		logger:  logger,
+		history: defaultSettingsHistory,
+		now:     time.Now,
+	}
+}
+
+// Get returns the settings of a user at their current revision.
+func (s *UserSettingsService) Get(ctx context.Context, userID int) (*UserSettingsDocument, error) {
+	settings, revision, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &UserSettingsDocument{UserID: userID, Revision: revision, Settings: settings}, nil
+}
+
+// Patch applies a JSON merge patch to the settings of a user. With a
+// base revision, the patch is refused when it touches keys changed after
+// that revision; without one it overwrites them.
+func (s *UserSettingsService) Patch(ctx context.Context, userID int, base *int64, patch []byte) (*UserSettingsDocument, error) {
+	p, err := decodeSettingsObject(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings patch: %w", err)
+	}
+	if err := checkSettingsSchema(p, settingsSchema, ""); err != nil {
+		return nil, fmt.Errorf("invalid settings patch: %w", err)
+	}
+	return s.update(ctx, userID, base, false, func(map[string]interface{}) map[string]interface{} {
+		return p
+	})
+}
+
+// Replace sets the whole settings blob of a user. With a base revision,
+// only the keys that differ from that revision count as changed, so a
+// client that rewrites the whole blob does not undo changes other
+// clients made to other keys meanwhile.
+func (s *UserSettingsService) Replace(ctx context.Context, userID int, base *int64, settings []byte) (*UserSettingsDocument, error) {
+	doc, err := decodeSettingsObject(settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	if err := checkSettingsSchema(doc, settingsSchema, ""); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	return s.update(ctx, userID, base, true, func(baseDoc map[string]interface{}) map[string]interface{} {
+		return diffMergePatch(baseDoc, doc)
+	})
+}
+
+// update applies the patch built by makePatch, retrying when another
+// change lands first. makePatch receives the settings at the base
+// revision when needBase is set, the current settings otherwise.
+func (s *UserSettingsService) update(ctx context.Context, userID int, base *int64, needBase bool, makePatch func(map[string]interface{}) map[string]interface{}) (*UserSettingsDocument, error) {
+	for attempt := 0; attempt < settingsWriteAttempts; attempt++ {
+		current, revision, err := s.load(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		var patch map[string]interface{}
+		if base == nil || *base == revision {
+			patch = makePatch(current)
+		} else {
+			if *base < 0 || *base > revision {
+				return nil, fmt.Errorf("invalid base revision %d", *base)
+			}
+			changed, err := s.changedSince(ctx, userID, *base, revision)
+			if err != nil {
+				return nil, err
+			}
+			baseDoc := current
+			if needBase {
+				if baseDoc, err = s.revision(ctx, userID, *base); err != nil {
+					return nil, err
+				}
+			}
+			patch = makePatch(baseDoc)
+			if conflicts := conflictingPaths(mergePatchPaths(patch, ""), changed); len(conflicts) > 0 {
+				return nil, &SettingsConflictError{Revision: revision, Keys: conflicts}
+			}
+		}
+
+		merged := applyMergePatch(current, patch).(map[string]interface{})
+		if err := validateSettings(merged); err != nil {
+			return nil, fmt.Errorf("invalid settings: %w", err)
+		}
+		if reflect.DeepEqual(merged, current) {
+			return &UserSettingsDocument{UserID: userID, Revision: revision, Settings: current}, nil
+		}
+
+		err = s.commit(ctx, userID, revision, current, merged, mergePatchPaths(patch, ""))
+		if errors.Is(err, errSettingsRaced) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &UserSettingsDocument{UserID: userID, Revision: revision + 1, Settings: merged}, nil
+	}
+	return nil, fmt.Errorf("failed to update settings of user %d: %w", userID, errSettingsRaced)
+}
+
+// load reads the current settings and revision of a user. A blob that is
+// not a JSON object is read as empty.
+func (s *UserSettingsService) load(ctx context.Context, userID int) (map[string]interface{}, int64, error) {
+	var raw sql.NullString
+	var revision int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT settings, settings_revision FROM users WHERE id = ? AND deleted_at IS NULL`, userID).
+		Scan(&raw, &revision)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("user %d not found", userID)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	settings := map[string]interface{}{}
+	if strings.TrimSpace(raw.String) != "" {
+		if settings, err = decodeSettingsObject([]byte(raw.String)); err != nil {
+			s.logger.Warn("Ignoring unreadable user settings", zap.Int("user_id", userID), zap.Error(err))
+			settings = map[string]interface{}{}
+		}
+	}
+	return settings, revision, nil
+}
+
+// changedSince returns the keys changed by the revisions after base up to
+// current, or ErrSettingsRevisionExpired when some of them were pruned.
+func (s *UserSettingsService) changedSince(ctx context.Context, userID int, base, current int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT changed_keys FROM user_settings_revisions WHERE user_id = ? AND revision > ? AND revision <= ?`,
+		userID, base, current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var changed []string
+	var count int64
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("failed to load settings revisions: %w", err)
+		}
+		var keys []string
+		if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+			return nil, fmt.Errorf("failed to read settings revision: %w", err)
+		}
+		changed = append(changed, keys...)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load settings revisions: %w", err)
+	}
+	if count != current-base {
+		return nil, ErrSettingsRevisionExpired
+	}
+	return changed, nil
+}
+
+// revision returns the settings of a user as they were at a revision.
+func (s *UserSettingsService) revision(ctx context.Context, userID int, revision int64) (map[string]interface{}, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT settings FROM user_settings_revisions WHERE user_id = ? AND revision = ?`, userID, revision).
+		Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, ErrSettingsRevisionExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings revision: %w", err)
+	}
+	return decodeSettingsObject([]byte(raw))
+}
+
+// commit writes merged as the revision after revision, provided the user
+// is still at revision, and records the keys it changed. The first
+// commit of a user also records the settings they started from, so that
+// whole-blob updates based on revision 0 can be diffed.
+func (s *UserSettingsService) commit(ctx context.Context, userID int, revision int64, current, merged map[string]interface{}, changed []string) error {
+	previous, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	settings, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	keys, err := json.Marshal(changed)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	txc := database.NewTxContext(s.db, database.DefaultTransactionConfig())
+	return txc.RunInTransaction(ctx, func(tx *database.Transaction) error {
+		result, err := tx.Exec(
+			`UPDATE users SET settings = ?, settings_revision = ?, updated_at = ? WHERE id = ? AND settings_revision = ?`,
+			string(settings), revision+1, now, userID, revision)
+		if err != nil {
+			return fmt.Errorf("failed to save settings: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to save settings: %w", err)
+		} else if n == 0 {
+			return errSettingsRaced
+		}
+
+		if revision == 0 {
+			if _, err := tx.Exec(
+				`INSERT INTO user_settings_revisions (user_id, revision, settings, changed_keys, created_at) VALUES (?, 0, ?, '[]', ?)`,
+				userID, string(previous), now); err != nil {
+				return fmt.Errorf("failed to record settings revision: %w", err)
+			}
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO user_settings_revisions (user_id, revision, settings, changed_keys, created_at) VALUES (?, ?, ?, ?, ?)`,
+			userID, revision+1, string(settings), string(keys), now); err != nil {
+			return fmt.Errorf("failed to record settings revision: %w", err)
+		}
+		if _, err := tx.Exec(
+			`DELETE FROM user_settings_revisions WHERE user_id = ? AND revision <= ?`,
+			userID, revision+1-s.history); err != nil {
+			return fmt.Errorf("failed to prune settings revisions: %w", err)
+		}
+		return nil
+	})
+}
+
+// decodeSettingsObject decodes a JSON object, keeping numbers as
+// json.Number so that integers survive a round trip.
+func decodeSettingsObject(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return object, nil
+}
+
+// buildSettingsSchema lists the JSON keys of the given struct types.
+func buildSettingsSchema(types ...reflect.Type) map[string]*settingsField {
+	fields := map[string]*settingsField{}
+	for _, t := range types {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name := strings.Split(sf.Tag.Get("json"), ",")[0]
+			if name == "-" || !sf.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			field := &settingsField{kind: sf.Type.Kind()}
+			if field.kind == reflect.Struct {
+				field.fields = buildSettingsSchema(sf.Type)
+			}
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// checkSettingsSchema checks that every key of value is known and holds a
+// value of its type. Null is accepted anywhere; in a merge patch it
+// resets the key to its default.
+func checkSettingsSchema(value map[string]interface{}, fields map[string]*settingsField, prefix string) error {
+	for key, v := range value {
+		path := prefix + "/" + escapePointer(key)
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %s", path)
+		}
+		if v == nil {
+			continue
+		}
+
+		valid := true
+		switch field.kind {
+		case reflect.Struct:
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be an object", path)
+			}
+			if err := checkSettingsSchema(object, field.fields, path); err != nil {
+				return err
+			}
+		case reflect.Bool:
+			_, valid = v.(bool)
+		case reflect.String:
+			_, valid = v.(string)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			n, ok := v.(json.Number)
+			if valid = ok; ok {
+				_, err := n.Int64()
+				valid = err == nil
+			}
+		case reflect.Float32, reflect.Float64:
+			_, valid = v.(json.Number)
+		case reflect.Slice:
+			items, ok := v.([]interface{})
+			valid = ok
+			for _, item := range items {
+				if _, ok := item.(string); !ok {
+					valid = false
+				}
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%s must be %s", path, settingsKindName(field.kind))
+		}
+	}
+	return nil
+}
+
+// settingsKindName names a schema kind in error messages.
+func settingsKindName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "an array of strings"
+	}
+	return "an object"
+}
+
+// validateSettings checks the values of a settings blob, read over the
+// defaults, against the rules of the preference and setting models.
+func validateSettings(settings map[string]interface{}) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	preferences := models.GetDefaultPreferences()
+	if err := json.Unmarshal(data, &preferences); err != nil {
+		return err
+	}
+	if err := preferences.Validate(); err != nil {
+		return err
+	}
+	userSettings := models.GetDefaultSettings()
+	if err := json.Unmarshal(data, &userSettings); err != nil {
+		return err
+	}
+	return userSettings.Validate()
+}
+
+// applyMergePatch applies a JSON merge patch to target as RFC 7396
+// describes: objects merge key by key, null removes a key, and anything
+// else replaces the target. target is not modified.
+func applyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	merged := map[string]interface{}{}
+	if t, ok := target.(map[string]interface{}); ok {
+		for k, v := range t {
+			merged[k] = v
+		}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = applyMergePatch(merged[k], v)
+		}
+	}
+	return merged
+}
+
+// diffMergePatch returns the merge patch that turns from into to.
+func diffMergePatch(from, to map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k := range from {
+		if v, ok := to[k]; !ok || v == nil {
+			patch[k] = nil
+		}
+	}
+	for k, v := range to {
+		if v == nil {
+			continue
+		}
+		fromObject, fromOK := from[k].(map[string]interface{})
+		toObject, toOK := v.(map[string]interface{})
+		if fromOK && toOK {
+			if sub := diffMergePatch(fromObject, toObject); len(sub) > 0 {
+				patch[k] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(from[k], v) {
+			patch[k] = v
+		}
+	}
+	return patch
+}
+
+// mergePatchPaths returns the keys a merge patch sets or removes, as
+// sorted JSON pointers. A key set to an object counts through its own
+// keys, unless the object is empty.
+func mergePatchPaths(patch map[string]interface{}, prefix string) []string {
+	var paths []string
+	for k, v := range patch {
+		path := prefix + "/" + escapePointer(k)
+		if object, ok := v.(map[string]interface{}); ok && len(object) > 0 {
+			paths = append(paths, mergePatchPaths(object, path)...)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// conflictingPaths returns the paths that equal, contain or lie within
+// one of the changed paths.
+func conflictingPaths(paths, changed []string) []string {
+	var conflicts []string
+	for _, p := range paths {
+		for _, c := range changed {
+			if p == c || strings.HasPrefix(c, p+"/") || strings.HasPrefix(p, c+"/") {
+				conflicts = append(conflicts, p)
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// escapePointer escapes a key for use in a JSON pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
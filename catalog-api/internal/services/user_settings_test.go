@@ -0,0 +1,211 @@
+package services
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUserSettingsService(t *testing.T) *UserSettingsService {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY,
+			settings TEXT DEFAULT '{}',
+			settings_revision INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME,
+			deleted_at DATETIME
+		);
+		INSERT INTO users (id, settings) VALUES (1, '{"theme":"dark","ui":{"grid_size":6}}'), (2, 'not json');
+		INSERT INTO users (id, deleted_at) VALUES (3, CURRENT_TIMESTAMP);
+		CREATE TABLE user_settings_revisions (
+			user_id INTEGER NOT NULL,
+			revision INTEGER NOT NULL,
+			settings TEXT NOT NULL,
+			changed_keys TEXT NOT NULL DEFAULT '[]',
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, revision)
+		);
+	`)
+	require.NoError(t, err)
+	return NewUserSettingsService(database.WrapDB(sqlDB, database.DialectSQLite), nil)
+}
+
+func settingsJSON(t *testing.T, doc *UserSettingsDocument) string {
+	t.Helper()
+	data, err := json.Marshal(doc.Settings)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func revisionPtr(r int64) *int64 { return &r }
+
+func TestApplyMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A.
+	for _, tc := range []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		target, err := decodeSettingsObject([]byte(tc.target))
+		require.NoError(t, err)
+		patch, err := decodeSettingsObject([]byte(tc.patch))
+		require.NoError(t, err)
+
+		merged, err := json.Marshal(applyMergePatch(target, patch))
+		require.NoError(t, err)
+		assert.JSONEq(t, tc.want, string(merged), "%s + %s", tc.target, tc.patch)
+
+		// The target is left as it was, and diffing gives back a patch
+		// with the same effect.
+		original, _ := json.Marshal(target)
+		assert.JSONEq(t, tc.target, string(original))
+		rediffed, _ := json.Marshal(applyMergePatch(target, diffMergePatch(target, applyMergePatch(target, patch).(map[string]interface{}))))
+		assert.JSONEq(t, tc.want, string(rediffed))
+	}
+}
+
+func TestUserSettingsService_PatchesCompose(t *testing.T) {
+	svc := newUserSettingsService(t)
+	ctx := context.Background()
+
+	doc, err := svc.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), doc.Revision)
+
+	// Two devices patch different keys from the same revision.
+	doc, err = svc.Patch(ctx, 1, revisionPtr(0), []byte(`{"theme":"light"}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), doc.Revision)
+	doc, err = svc.Patch(ctx, 1, revisionPtr(0), []byte(`{"ui":{"density_mode":"compact"},"privacy":{"share_usage_data":true}}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), doc.Revision)
+	assert.JSONEq(t,
+		`{"theme":"light","ui":{"grid_size":6,"density_mode":"compact"},"privacy":{"share_usage_data":true}}`,
+		settingsJSON(t, doc))
+
+	// A third touches keys the others changed after its base.
+	_, err = svc.Patch(ctx, 1, revisionPtr(0), []byte(`{"theme":"dark","ui":null,"language":"de"}`))
+	var conflict *SettingsConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(2), conflict.Revision)
+	assert.Equal(t, []string{"/theme", "/ui"}, conflict.Keys)
+
+	// Without a base the patch wins, and a patch that changes nothing
+	// keeps the revision.
+	doc, err = svc.Patch(ctx, 1, nil, []byte(`{"theme":"dark","ui":null}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), doc.Revision)
+	assert.JSONEq(t, `{"theme":"dark","privacy":{"share_usage_data":true}}`, settingsJSON(t, doc))
+	doc, err = svc.Patch(ctx, 1, revisionPtr(3), []byte(`{"theme":"dark"}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), doc.Revision)
+
+	doc, err = svc.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), doc.Revision)
+	assert.JSONEq(t, `{"theme":"dark","privacy":{"share_usage_data":true}}`, settingsJSON(t, doc))
+}
+
+func TestUserSettingsService_ReplaceKeepsOtherChanges(t *testing.T) {
+	svc := newUserSettingsService(t)
+	ctx := context.Background()
+
+	// A phone changes the volume while a laptop edits the blob it read at
+	// revision 0 and writes it back whole.
+	_, err := svc.Patch(ctx, 1, revisionPtr(0), []byte(`{"media_player":{"volume":0.3}}`))
+	require.NoError(t, err)
+	doc, err := svc.Replace(ctx, 1, revisionPtr(0), []byte(`{"theme":"dark","ui":{"grid_size":8},"auto_sync":false}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), doc.Revision)
+	assert.JSONEq(t, `{"theme":"dark","ui":{"grid_size":8},"auto_sync":false,"media_player":{"volume":0.3}}`, settingsJSON(t, doc))
+
+	// A device still at revision 1 conflicts only on the key the laptop
+	// changed too.
+	_, err = svc.Replace(ctx, 1, revisionPtr(1), []byte(`{"theme":"light","ui":{"grid_size":7},"media_player":{"volume":0.3}}`))
+	var conflict *SettingsConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, []string{"/ui/grid_size"}, conflict.Keys)
+
+	// Without a base, the blob replaces everything.
+	doc, err = svc.Replace(ctx, 1, nil, []byte(`{"language":"fr"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"language":"fr"}`, settingsJSON(t, doc))
+}
+
+func TestUserSettingsService_Validation(t *testing.T) {
+	svc := newUserSettingsService(t)
+	ctx := context.Background()
+
+	for patch, msg := range map[string]string{
+		`[1,2]`:                                     "expected a JSON object",
+		`{"colour":"red"}`:                          "unknown setting /colour",
+		`{"ui":{"columns":3}}`:                      "unknown setting /ui/columns",
+		`{"ui":{"grid_size":"big"}}`:                "/ui/grid_size must be an integer",
+		`{"ui":{"grid_size":2.5}}`:                  "/ui/grid_size must be an integer",
+		`{"auto_sync":"yes"}`:                       "/auto_sync must be a boolean",
+		`{"privacy":true}`:                          "/privacy must be an object",
+		`{"security":{"require_password_for":[1]}}`: "must be an array of strings",
+		`{"theme":"pink"}`:                          "theme must be auto, light or dark",
+		`{"timezone":"Mars/Olympus"}`:               "invalid time zone",
+		`{"media_player":{"volume":1.5}}`:           "volume must be between 0 and 1",
+		`{"conversion":{"max_concurrent_jobs":-1}}`: "max_concurrent_jobs",
+	} {
+		_, err := svc.Patch(ctx, 1, nil, []byte(patch))
+		require.Error(t, err, patch)
+		assert.Contains(t, err.Error(), "invalid", patch)
+		assert.Contains(t, err.Error(), msg, patch)
+	}
+
+	doc, err := svc.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), doc.Revision)
+
+	// Unreadable stored settings are read as empty.
+	doc, err = svc.Patch(ctx, 2, nil, []byte(`{"theme":null,"timezone":"Europe/Belgrade"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"timezone":"Europe/Belgrade"}`, settingsJSON(t, doc))
+
+	for _, id := range []int{3, 9} {
+		_, err = svc.Get(ctx, id)
+		assert.ErrorContains(t, err, "not found")
+	}
+	_, err = svc.Patch(ctx, 1, revisionPtr(7), []byte(`{"theme":"light"}`))
+	assert.ErrorContains(t, err, "invalid base revision")
+}
+
+func TestUserSettingsService_ExpiredRevision(t *testing.T) {
+	svc := newUserSettingsService(t)
+	svc.history = 2
+	ctx := context.Background()
+
+	for _, theme := range []string{"light", "dark", "light"} {
+		_, err := svc.Patch(ctx, 1, nil, []byte(`{"theme":"`+theme+`"}`))
+		require.NoError(t, err)
+	}
+
+	_, err := svc.Patch(ctx, 1, revisionPtr(0), []byte(`{"language":"de"}`))
+	assert.True(t, errors.Is(err, ErrSettingsRevisionExpired))
+	_, err = svc.Replace(ctx, 1, revisionPtr(1), []byte(`{}`))
+	assert.True(t, errors.Is(err, ErrSettingsRevisionExpired))
+
+	doc, err := svc.Patch(ctx, 1, revisionPtr(2), []byte(`{"language":"de"}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), doc.Revision)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the GIF decoder for shared images
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermark positions.
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+)
+
+// Media kinds that can be watermarked.
+const (
+	watermarkKindImage = "image"
+	watermarkKindVideo = "video"
+)
+
+var watermarkKinds = map[string]string{
+	".jpg": watermarkKindImage, ".jpeg": watermarkKindImage, ".png": watermarkKindImage, ".gif": watermarkKindImage,
+	".mp4": watermarkKindVideo, ".m4v": watermarkKindVideo, ".mkv": watermarkKindVideo, ".mov": watermarkKindVideo,
+	".avi": watermarkKindVideo, ".webm": watermarkKindVideo, ".wmv": watermarkKindVideo,
+	".mpg": watermarkKindVideo, ".mpeg": watermarkKindVideo,
+}
+
+// watermarkKind reports whether a file name is an image or a video, or ""
+// for files that cannot be watermarked.
+func watermarkKind(name string) string {
+	return watermarkKinds[strings.ToLower(filepath.Ext(name))]
+}
+
+func validWatermarkPosition(position string) bool {
+	switch position {
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter:
+		return true
+	}
+	return false
+}
+
+// Watermarker draws visible text overlays onto images in-process and onto
+// videos with ffmpeg.
+type Watermarker struct {
+	ffmpegBinary string
+	fontFile     string
+}
+
+// NewWatermarker creates a Watermarker using ffmpeg from PATH and its
+// default font.
+func NewWatermarker() *Watermarker {
+	return &Watermarker{ffmpegBinary: "ffmpeg"}
+}
+
+// SetFFmpegBinary overrides the ffmpeg executable.
+func (w *Watermarker) SetFFmpegBinary(binary string) {
+	w.ffmpegBinary = binary
+}
+
+// SetFontFile sets the font ffmpeg draws video watermarks with, for
+// builds without fontconfig.
+func (w *Watermarker) SetFontFile(path string) {
+	w.fontFile = path
+}
+
+// WatermarkImage decodes an image, draws text onto it and encodes the
+// result. JPEGs stay JPEGs; everything else is written as PNG. It returns
+// the extension of the written image.
+func (w *Watermarker) WatermarkImage(src io.Reader, dst io.Writer, text, position string) (string, error) {
+	img, format, err := image.Decode(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	drawWatermarkText(out, text, position)
+
+	if format == "jpeg" {
+		if err := jpeg.Encode(dst, out, &jpeg.Options{Quality: 90}); err != nil {
+			return "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return ".jpg", nil
+	}
+	if err := png.Encode(dst, out); err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	return ".png", nil
+}
+
+// drawWatermarkText renders text with the built-in bitmap face on a
+// translucent box and scales it to about a twentieth of the image height.
+func drawWatermarkText(dst *image.RGBA, text, position string) {
+	face := basicfont.Face7x13
+	const pad = 3
+	label := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, text).Ceil()+2*pad, face.Height+2*pad))
+	draw.Draw(label, label.Bounds(), image.NewUniform(color.NRGBA{A: 110}), image.Point{}, draw.Src)
+	d := &font.Drawer{
+		Dst:  label,
+		Src:  image.NewUniform(color.NRGBA{R: 255, G: 255, B: 255, A: 210}),
+		Face: face,
+		Dot:  fixed.P(pad, pad+face.Ascent),
+	}
+	d.DrawString(text)
+
+	bounds := dst.Bounds()
+	scale := float64(bounds.Dy()) / 20 / float64(label.Bounds().Dy())
+	if maxScale := float64(bounds.Dx()) * 0.9 / float64(label.Bounds().Dx()); scale > maxScale {
+		scale = maxScale
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	width := int(float64(label.Bounds().Dx()) * scale)
+	height := int(float64(label.Bounds().Dy()) * scale)
+	margin := height / 2
+
+	x, y := bounds.Min.X+margin, bounds.Min.Y+margin
+	switch position {
+	case WatermarkTopRight:
+		x = bounds.Max.X - width - margin
+	case WatermarkBottomLeft:
+		y = bounds.Max.Y - height - margin
+	case WatermarkCenter:
+		x = bounds.Min.X + (bounds.Dx()-width)/2
+		y = bounds.Min.Y + (bounds.Dy()-height)/2
+	case WatermarkBottomRight:
+		x = bounds.Max.X - width - margin
+		y = bounds.Max.Y - height - margin
+	}
+	draw.ApproxBiLinear.Scale(dst, image.Rect(x, y, x+width, y+height), label, label.Bounds(), draw.Over, nil)
+}
+
+// ffmpegPosition returns drawtext x and y expressions for a position.
+func ffmpegPosition(position string) (string, string) {
+	const margin = "h/40"
+	switch position {
+	case WatermarkTopRight:
+		return "w-tw-" + margin, margin
+	case WatermarkBottomLeft:
+		return margin, "h-th-" + margin
+	case WatermarkCenter:
+		return "(w-tw)/2", "(h-th)/2"
+	case WatermarkBottomRight:
+		return "w-tw-" + margin, "h-th-" + margin
+	}
+	return margin, margin
+}
+
+// WatermarkVideo re-encodes a video to an MP4 at dstPath with text burned
+// in. The text goes through a file so it needs no filtergraph escaping.
+func (w *Watermarker) WatermarkVideo(ctx context.Context, srcPath, dstPath, text, position string) error {
+	textFile, err := os.CreateTemp("", "watermark-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to write watermark text: %w", err)
+	}
+	defer os.Remove(textFile.Name())
+	_, err = textFile.WriteString(text)
+	if closeErr := textFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write watermark text: %w", err)
+	}
+
+	x, y := ffmpegPosition(position)
+	filter := fmt.Sprintf("drawtext=textfile='%s':fontcolor=white@0.8:fontsize=h/20:box=1:boxcolor=black@0.4:boxborderw=8:x=%s:y=%s",
+		textFile.Name(), x, y)
+	if w.fontFile != "" {
+		filter += fmt.Sprintf(":fontfile='%s'", w.fontFile)
+	}
+
+	cmd := exec.CommandContext(ctx, w.ffmpegBinary, "-y", "-loglevel", "error", "-i", srcPath,
+		"-vf", filter, "-c:v", "libx264", "-preset", "veryfast", "-crf", "20",
+		"-c:a", "aac", "-b:a", "192k", "-movflags", "+faststart", dstPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(dstPath)
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func solidImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 20, G: 120, B: 60, A: 255})
+		}
+	}
+	return img
+}
+
+// changedPixels counts pixels that differ from the solid source colour in r.
+func changedPixels(img image.Image, r image.Rectangle) int {
+	changed := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			if cr>>8 != 20 || cg>>8 != 120 || cb>>8 != 60 {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+func TestWatermarker_ImagePosition(t *testing.T) {
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, solidImage(400, 300)))
+
+	var out bytes.Buffer
+	ext, err := NewWatermarker().WatermarkImage(&src, &out, "alice 2026-10-16 12:00 UTC", WatermarkBottomRight)
+	require.NoError(t, err)
+	assert.Equal(t, ".png", ext)
+
+	img, err := png.Decode(&out)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 400, 300), img.Bounds())
+	assert.Greater(t, changedPixels(img, image.Rect(200, 150, 400, 300)), 0, "the watermark is drawn bottom right")
+	assert.Zero(t, changedPixels(img, image.Rect(0, 0, 200, 150)), "the rest of the image is untouched")
+}
+
+func TestWatermarker_KeepsJPEG(t *testing.T) {
+	var src bytes.Buffer
+	require.NoError(t, jpeg.Encode(&src, solidImage(64, 64), nil))
+
+	var out bytes.Buffer
+	ext, err := NewWatermarker().WatermarkImage(&src, &out, "bob", WatermarkCenter)
+	require.NoError(t, err)
+	assert.Equal(t, ".jpg", ext)
+	_, format, err := image.Decode(&out)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+
+	_, err = NewWatermarker().WatermarkImage(bytes.NewReader([]byte("not an image")), &out, "bob", WatermarkCenter)
+	assert.ErrorContains(t, err, "failed to decode image")
+}
+
+func TestWatermarkKind(t *testing.T) {
+	assert.Equal(t, watermarkKindImage, watermarkKind("Holiday.JPG"))
+	assert.Equal(t, watermarkKindVideo, watermarkKind("film.mkv"))
+	assert.Empty(t, watermarkKind("notes.pdf"))
+}
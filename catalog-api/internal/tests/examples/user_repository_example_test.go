@@ -158,8 +158,8 @@ func TestUserRepositoryExample(t *testing.T) {
 	// Test 5: Delete user
 	t.Run("DeleteUser", func(t *testing.T) {
 		// Setup expectations
-		mock.ExpectExec(`DELETE FROM users WHERE id = \?`).
-			WithArgs(1).
+		mock.ExpectExec(`UPDATE users SET deleted_at = \? WHERE id = \? AND deleted_at IS NULL`).
+			WithArgs(sqlmock.AnyArg(), int64(1)).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 
 		// Execute
@@ -71,7 +71,8 @@ func runTestMigrations(db *sql.DB) error {
 			last_login_at DATETIME,
 			last_login_ip TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
 		)`,
 
 		// Storage roots table
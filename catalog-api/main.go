@@ -13,6 +13,7 @@ import (
 	"catalogizer/internal/middleware"
 	"catalogizer/internal/services"
 	root_middleware "catalogizer/middleware"
+	"catalogizer/models"
 	root_repository "catalogizer/repository"
 	root_services "catalogizer/services"
 	"context"
@@ -32,7 +33,9 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -45,10 +48,10 @@ import (
 	"github.com/gin-gonic/gin"
 	_ "github.com/mutecomm/go-sqlcipher"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Version information injected via ldflags at build time
@@ -131,6 +134,27 @@ func getOrCreateSelfSignedCert() (tls.Certificate, error) {
 	return cert, nil
 }
 
+// serverProtocols returns the protocols an http.Server accepts: HTTP/1.1
+// always, HTTP/2 over TLS and cleartext HTTP/2 (h2c) as configured.
+func serverProtocols(http2, unencryptedHTTP2 bool) *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(http2)
+	protocols.SetUnencryptedHTTP2(unencryptedHTTP2)
+	return protocols
+}
+
+// tcpTLSConfig returns a copy of tlsConfig for the TCP listener. HTTP/3 is
+// negotiated over QUIC only, and offering h2 with HTTP/2 disabled would
+// leave clients speaking a protocol the server does not.
+func tcpTLSConfig(tlsConfig *tls.Config, http2 bool) *tls.Config {
+	config := tlsConfig.Clone()
+	config.NextProtos = slices.DeleteFunc(slices.Clone(config.NextProtos), func(proto string) bool {
+		return proto == "h3" || (proto == "h2" && !http2)
+	})
+	return config
+}
+
 // generateSelfSignedCert creates a self-signed TLS certificate for development.
 func generateSelfSignedCert() (tls.Certificate, []byte, []byte, error) {
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -197,6 +221,7 @@ func generateSelfSignedCert() (tls.Certificate, []byte, []byte, error) {
 func main() {
 	// Parse command line flags
 	testMode := flag.Bool("test-mode", false, "Run in test mode with additional logging")
+	rekeyDatabase := flag.Bool("rekey-database", false, "Re-key the encrypted SQLite database with DATABASE_ENCRYPTION_NEW_KEY and exit")
 	flag.Parse()
 
 	// Initialize logger
@@ -229,6 +254,9 @@ func main() {
 	if host := os.Getenv("HOST"); host != "" {
 		cfg.Server.Host = host // Allow overriding bind address (e.g., 0.0.0.0 for containers)
 	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.Server.TrustedProxies = strings.Split(proxies, ",") // e.g. 10.0.0.0/8,172.16.0.1
+	}
 	if ginMode := os.Getenv("GIN_MODE"); ginMode != "" {
 		gin.SetMode(ginMode)
 	}
@@ -265,6 +293,21 @@ func main() {
 		cfg.Database.SSLMode = "disable"
 	}
 
+	if *rekeyDatabase {
+		if !cfg.Database.Encryption.Enabled {
+			log.Fatal("Database encryption is not enabled")
+		}
+		currentKey, err := database.ResolveEncryptionKey(&cfg.Database.Encryption)
+		if err != nil {
+			log.Fatal("Failed to resolve database key:", err)
+		}
+		if err := database.Rekey(cfg.Database.Path, currentKey, os.Getenv("DATABASE_ENCRYPTION_NEW_KEY")); err != nil {
+			log.Fatal("Failed to re-key database:", err)
+		}
+		log.Printf("Database %s re-keyed; configure the new key before starting the service", cfg.Database.Path)
+		return
+	}
+
 	// Initialize single database connection
 	databaseDB, err := database.NewConnection(&cfg.Database)
 	if err != nil {
@@ -311,6 +354,7 @@ func main() {
 	catalogService.SetDB(databaseDB)
 	smbService := services.NewSMBService(internalCfg, logger)
 	smbDiscoveryService := services.NewSMBDiscoveryService(logger)
+	discoveryService := services.NewDiscoveryService(smbDiscoveryService, logger)
 
 	// Initialize services needed for recommendations
 	mediaRecognitionService := services.NewMediaRecognitionService(databaseDB, logger, nil, nil, "", "", "", "", "", "")
@@ -345,10 +389,107 @@ func main() {
 		log.Println("WARNING: No JWT secret configured. Generated ephemeral secret. Set Auth.JWTSecret in config for persistent sessions across restarts.")
 	}
 	authService := root_services.NewAuthService(userRepo, jwtSecret)
+	if cfg.Auth.WebhookURL != "" {
+		// Delegate logins that fail locally to a customer-provided webhook
+		authService.SetAuthWebhook(root_services.AuthWebhookConfig{
+			URL:           cfg.Auth.WebhookURL,
+			Secret:        cfg.Auth.WebhookSecret,
+			Timeout:       time.Duration(cfg.Auth.WebhookTimeoutMs) * time.Millisecond,
+			CacheTTL:      time.Duration(cfg.Auth.WebhookCacheSeconds) * time.Second,
+			AutoProvision: cfg.Auth.WebhookAutoProvision,
+		})
+	}
+	// Lock accounts after repeated failed logins and list the lockouts in
+	// security audit reports
+	lockoutPolicy := root_services.DefaultLockoutPolicy
+	if cfg.Auth.LockoutAttempts != 0 {
+		lockoutPolicy.Attempts = cfg.Auth.LockoutAttempts
+	}
+	if cfg.Auth.LockoutMinutes > 0 {
+		lockoutPolicy.Duration = time.Duration(cfg.Auth.LockoutMinutes) * time.Minute
+	}
+	if cfg.Auth.LockoutMaxMinutes > 0 {
+		lockoutPolicy.MaxDuration = time.Duration(cfg.Auth.LockoutMaxMinutes) * time.Minute
+	}
+	authService.SetLockoutPolicy(lockoutPolicy)
+	securityIncidentRepo := root_repository.NewSecurityIncidentRepository(databaseDB)
+	authService.SetSecurityIncidents(securityIncidentRepo)
+	// Sign-ins, permission and configuration changes, file deletions and
+	// uses of share credentials go to the append-only audit log
+	auditService := services.NewAuditService(databaseDB, logger)
+	authService.SetAuditRecorder(auditService)
+	// Scoped API keys for scripts and integrations, sent as X-API-Key
+	authService.SetAPIKeys(root_repository.NewAPIKeyRepository(databaseDB))
+	// Password hashing parameters chosen by an administrator
+	if err := authService.SetPasswordHashing(root_repository.NewPasswordHashingRepository(databaseDB)); err != nil {
+		logger.Error("Failed to load password hashing parameters", zap.Error(err))
+	}
+	// Sign-in through external identity providers
+	authService.SetOIDCIdentities(root_repository.NewOIDCIdentityRepository(databaseDB))
+	for _, provider := range cfg.Auth.OIDCProviders {
+		if err := authService.AddOIDCProvider(root_services.OIDCProviderConfig{
+			Name:          provider.Name,
+			Type:          provider.Type,
+			IssuerURL:     provider.IssuerURL,
+			ClientID:      provider.ClientID,
+			ClientSecret:  provider.ClientSecret,
+			RedirectURL:   provider.RedirectURL,
+			Scopes:        provider.Scopes,
+			AutoProvision: provider.AutoProvision,
+			DefaultRoleID: provider.DefaultRoleID,
+		}); err != nil {
+			logger.Fatal("Failed to configure identity provider", zap.Error(err))
+		}
+	}
+	// Sign-in with directory credentials, and a sync disabling accounts
+	// removed from the directory
+	if ldap := cfg.Auth.LDAP; ldap != nil {
+		groupRoles := make([]root_services.LDAPGroupRole, 0, len(ldap.GroupRoles))
+		for _, mapping := range ldap.GroupRoles {
+			groupRoles = append(groupRoles, root_services.LDAPGroupRole{Group: mapping.Group, RoleID: mapping.RoleID})
+		}
+		ldapProvider, err := root_services.NewLDAPAuthProvider(root_services.LDAPConfig{
+			URL:                ldap.URL,
+			StartTLS:           ldap.StartTLS,
+			CACertFile:         ldap.CACertFile,
+			BindDN:             ldap.BindDN,
+			BindPassword:       ldap.BindPassword,
+			BaseDN:             ldap.BaseDN,
+			UserFilter:         ldap.UserFilter,
+			UsernameAttributes: ldap.UsernameAttributes,
+			EmailAttribute:     ldap.EmailAttribute,
+			FirstNameAttribute: ldap.FirstNameAttribute,
+			LastNameAttribute:  ldap.LastNameAttribute,
+			GroupBaseDN:        ldap.GroupBaseDN,
+			GroupFilter:        ldap.GroupFilter,
+			GroupRoles:         groupRoles,
+			DefaultRoleID:      ldap.DefaultRoleID,
+			RequireGroup:       ldap.RequireGroup,
+			AutoProvision:      ldap.AutoProvision,
+			Timeout:            time.Duration(ldap.TimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			logger.Fatal("Failed to configure LDAP authentication", zap.Error(err))
+		}
+		authService.SetLDAP(ldapProvider, root_repository.NewLDAPAccountRepository(databaseDB))
+		authService.StartLDAPSync(time.Duration(ldap.SyncIntervalMinutes) * time.Minute)
+	}
 	conversionService := root_services.NewConversionService(conversionRepo, userRepo, authService)
 	analyticsService := root_services.NewAnalyticsService(analyticsRepo)
 	reportingService := root_services.NewReportingService(analyticsRepo, userRepo)
+	reportingService.SetSecurityIncidents(securityIncidentRepo)
 	configurationService := root_services.NewConfigurationService(configurationRepo, "./config.json")
+	setupService, err := root_services.NewSetupService(configurationService, configurationRepo)
+	if err != nil {
+		logger.Fatal("Failed to read setup state", zap.Error(err))
+	}
+	// Installations configured entirely through the environment skip the
+	// first-run wizard
+	if os.Getenv("SKIP_SETUP") == "true" {
+		if err := setupService.Skip(); err != nil {
+			logger.Fatal("Failed to skip setup", zap.Error(err))
+		}
+	}
 	errorReportingService := root_services.NewErrorReportingService(errorReportingRepo, crashReportingRepo)
 	logManagementService := root_services.NewLogManagementService(logManagementRepo)
 	favoritesService := root_services.NewFavoritesService(favoritesRepo, authService)
@@ -357,12 +498,25 @@ func main() {
 	internalAuthService := auth.NewAuthService(databaseDB, jwtSecret, logger)
 	authMiddleware := auth.NewAuthMiddleware(internalAuthService, logger)
 
+	// Dependency probing: missing tools, services or storage roots put the
+	// server in degraded mode, answering 503 with the reason on the
+	// endpoints that need them, and are re-probed periodically
+	dependencyMonitor := services.NewDependencyMonitor(logger, services.DependencyMonitorConfig{})
+	dependencyMonitor.RegisterCritical("database", services.DependencyKindService, databaseDB.PingContext)
+	dependencyMonitor.Register("ffmpeg", services.DependencyKindBinary, services.BinaryProbe("ffmpeg"))
+
 	// Initialize Redis client for distributed rate limiting
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     os.Getenv("REDIS_ADDR"),
 		Password: os.Getenv("REDIS_PASSWORD"),
 		DB:       0,
 	})
+	if os.Getenv("REDIS_ADDR") != "" {
+		redisProbeClient := redisClient
+		dependencyMonitor.Register("redis", services.DependencyKindService, func(ctx context.Context) error {
+			return redisProbeClient.Ping(ctx).Err()
+		})
+	}
 
 	// Test Redis connection
 	if _, err := redisClient.Ping(context.Background()).Result(); err != nil {
@@ -372,6 +526,27 @@ func main() {
 		log.Println("Redis connected successfully for distributed rate limiting")
 	}
 
+	// Response cache for catalog listings, searches and statistics, kept in
+	// Redis when it is available so every instance shares it. The TTL of
+	// each namespace is set by RESPONSE_CACHE_{CATALOG,SEARCH,STATS}_TTL;
+	// RESPONSE_CACHE_BACKEND=memory keeps it in process
+	responseCacheBackend := services.NewMemoryResponseCacheBackend(0)
+	if redisClient != nil && os.Getenv("RESPONSE_CACHE_BACKEND") != services.ResponseCacheBackendMemory {
+		responseCacheBackend = services.NewRedisResponseCacheBackend(redisClient)
+	}
+	responseCacheConfig := services.ResponseCacheConfig{}
+	if d, err := time.ParseDuration(os.Getenv("RESPONSE_CACHE_CATALOG_TTL")); err == nil {
+		responseCacheConfig.CatalogTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RESPONSE_CACHE_SEARCH_TTL")); err == nil {
+		responseCacheConfig.SearchTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RESPONSE_CACHE_STATS_TTL")); err == nil {
+		responseCacheConfig.StatsTTL = d
+	}
+	responseCache := services.NewResponseCacheService(responseCacheBackend, logger, responseCacheConfig)
+	responseCacheHandler := root_handlers.NewResponseCacheHandler(responseCache, authService)
+
 	// Initialize challenge service
 	challengeService := root_services.NewChallengeService(
 		filepath.Join(".", "data", "challenge_results"),
@@ -393,6 +568,9 @@ func main() {
 		scannerConcurrency = 4 // default
 	}
 	universalScanner := services.NewUniversalScanner(databaseDB, logger, nil, clientFactory, scannerConcurrency)
+	universalScanner.OnScanFinished(func(root *models.StorageRoot) {
+		responseCache.InvalidateCatalog(context.Background())
+	})
 	if err := universalScanner.Start(); err != nil {
 		log.Fatalf("Failed to start universal scanner: %v", err)
 	}
@@ -402,16 +580,172 @@ func main() {
 	aggregationService := services.NewAggregationService(databaseDB, logger, mediaItemRepo, mediaFileRepo, dirAnalysisRepo, extMetaRepo)
 	universalScanner.SetAggregationService(aggregationService)
 
+	// Onboarding: guided tasks for new installations and a demo library of
+	// placeholder media to explore the UI with
+	onboardingService := services.NewOnboardingService(databaseDB, logger, universalScanner, services.OnboardingConfig{
+		DemoLibraryDir: os.Getenv("ONBOARDING_DEMO_DIR"),
+	})
+	onboardingHandler := root_handlers.NewOnboardingHandler(onboardingService, authService)
+
+	// Metadata enrichment: newly aggregated items are matched against TMDB
+	// (when an API key is configured), MusicBrainz and Google Books; covers
+	// are cached where the asset resolver looks for them
+	metadataEnrichmentService := services.NewMetadataEnrichmentService(databaseDB, logger,
+		mediaItemRepo, extMetaRepo, filepath.Join(".", "cache", "cover_art"))
+	// Provider API keys: <PROVIDER>_API_KEYS takes a comma-separated list,
+	// used in turn and rotated on 429s, alongside <PROVIDER>_API_KEY;
+	// <PROVIDER>_DAILY_QUOTA caps each key's requests per UTC day
+	providerKeys := services.NewProviderKeyPool(databaseDB, logger)
+	for provider, prefix := range map[string]string{
+		services.MetadataProviderTMDB:          "TMDB",
+		services.MetadataProviderGoogleBooks:   "GOOGLE_BOOKS",
+		string(services.ProviderOpenSubtitles): "OPENSUBTITLES",
+	} {
+		keys := append(strings.Split(os.Getenv(prefix+"_API_KEYS"), ","), os.Getenv(prefix+"_API_KEY"))
+		quota, _ := strconv.Atoi(os.Getenv(prefix + "_DAILY_QUOTA"))
+		providerKeys.SetKeys(provider, keys, quota)
+	}
+	googleBooks := services.NewGoogleBooksMetadataClient(os.Getenv("GOOGLE_BOOKS_API_URL"), os.Getenv("GOOGLE_BOOKS_API_KEY"), nil)
+	googleBooks.SetKeyPool(providerKeys)
+	metadataProviders := []services.MetadataProviderClient{
+		services.NewMusicBrainzMetadataClient(os.Getenv("MUSICBRAINZ_API_URL"), nil),
+		googleBooks,
+	}
+	if providerKeys.HasKeys(services.MetadataProviderTMDB) {
+		tmdb := services.NewTMDBMetadataClient(os.Getenv("TMDB_API_URL"), "", nil)
+		tmdb.SetKeyPool(providerKeys)
+		metadataProviders = append(metadataProviders, tmdb)
+	}
+	// Provider responses are cached for METADATA_CACHE_TTL (default a week)
+	var metadataCacheTTL time.Duration
+	if d, err := time.ParseDuration(os.Getenv("METADATA_CACHE_TTL")); err == nil {
+		metadataCacheTTL = d
+	}
+	metadataProviderCache := services.NewMetadataProviderCache(databaseDB, logger, metadataCacheTTL)
+	// Imported offline metadata bundles are searched last, unless the
+	// provider order puts "offline" first; being local, they are not cached
+	offlineMetadata := services.NewOfflineMetadataProvider(databaseDB, logger)
+	metadataEnrichmentService.SetProviders(append(metadataProviderCache.WrapAll(metadataProviders), offlineMetadata)...)
+	aggregationService.SetEnricher(metadataEnrichmentService)
+	metadataEnrichmentHandler := root_handlers.NewMetadataEnrichmentHandler(metadataEnrichmentService, authService)
+
+	// Bulk metadata refresh, for when providers or their API keys change
+	metadataRefreshService := services.NewMetadataRefreshService(databaseDB, logger, metadataEnrichmentService, metadataProviderCache)
+	metadataRefreshService.SetKeyPool(providerKeys)
+	metadataRefreshService.Start()
+	metadataRefreshHandler := root_handlers.NewMetadataRefreshHandler(metadataRefreshService, metadataProviderCache, authService)
+	providerKeysHandler := root_handlers.NewProviderKeysHandler(providerKeys, authService)
+	offlineMetadataHandler := root_handlers.NewOfflineMetadataHandler(offlineMetadata, authService)
+
 	// Initialize subtitle service
 	// Use SQL-based cache service for now
 	cacheService := services.NewCacheService(databaseDB, logger)
 	subtitleService := services.NewSubtitleService(databaseDB, logger, cacheService)
+	subtitleService.SetProviderConfig(services.ProviderOpenSubtitles,
+		os.Getenv("OPENSUBTITLES_API_URL"), os.Getenv("OPENSUBTITLES_API_KEY"))
+	subtitleService.SetKeyPool(providerKeys)
+	// Downloaded and uploaded subtitles are written next to their media files
+	subtitleService.SetStorageClients(universalScanner)
+
+	// Lyrics: LRC/text files next to tracks, then LRCLIB; fetched lyrics are
+	// cached per track and language following users' lyrics language lists
+	lyricsService := services.NewLyricsService(databaseDB, logger)
+	lyricsService.SetProviders(services.NewLRCLIBProvider(os.Getenv("LRCLIB_API_URL"), nil))
+	lyricsService.SetStorageClients(universalScanner)
+	lyricsService.SetPreferenceSource(services.NewLocalizationService(databaseDB, logger,
+		services.NewTranslationService(logger), cacheService))
+	lyricsHandler := root_handlers.NewLyricsHandler(lyricsService, authService)
+
+	// Resolve storage roots to SMB/FTP/NFS/WebDAV/local providers by protocol
+	storageProviders := services.NewStorageProviderFactory(databaseDB, universalScanner, logger)
+	// Storage IO of each root runs in priority lanes: browsing and
+	// streaming first, then copies and replication, then scans and
+	// hashing, which are throttled while interactive requests slow down
+	ioScheduling := services.IOSchedulerConfig{}
+	if n, err := strconv.Atoi(os.Getenv("STORAGE_IO_SLOTS")); err == nil {
+		ioScheduling.Slots = n
+	}
+	if ms, err := strconv.Atoi(os.Getenv("STORAGE_IO_LATENCY_TARGET_MS")); err == nil {
+		ioScheduling.LatencyTarget = time.Duration(ms) * time.Millisecond
+	}
+	storageProviders.SetIOScheduling(ioScheduling)
+	// Roots that keep failing are cut off by a circuit breaker: requests
+	// fail fast with 503 and cached listings until a re-probe reaches the
+	// root again, backing off from STORAGE_BREAKER_INITIAL_BACKOFF to
+	// STORAGE_BREAKER_MAX_BACKOFF
+	breakerConfig := services.StorageBreakerConfig{}
+	if n, err := strconv.Atoi(os.Getenv("STORAGE_BREAKER_FAILURE_THRESHOLD")); err == nil {
+		breakerConfig.FailureThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("STORAGE_BREAKER_INITIAL_BACKOFF")); err == nil {
+		breakerConfig.InitialBackoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("STORAGE_BREAKER_MAX_BACKOFF")); err == nil {
+		breakerConfig.MaxBackoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("STORAGE_CONNECT_TIMEOUT")); err == nil {
+		breakerConfig.ConnectTimeout = d
+	}
+	storageBreakers := services.NewStorageBreakers(logger, breakerConfig)
+	storageProviders.SetBreakers(storageBreakers)
+	catalogService.SetStorageProviders(storageProviders)
+	dependencyMonitor.RegisterSource(services.DependencyKindStorage, services.StorageRootProbes(databaseDB, storageProviders))
+	dependencyMonitor.ProbeAll(context.Background())
+	dependencyMonitor.Start()
+	conversionService.SetDependencyChecker(dependencyMonitor)
+	dependencyHandler := root_handlers.NewDependencyHandler(dependencyMonitor, authService)
+	healthHandler := root_handlers.NewHealthHandler(dependencyMonitor)
+	healthHandler.SetStorageBreakers(storageBreakers)
+
+	// Background scanner: walks storage roots on demand or on per-root cron
+	// schedules, keeping file records (and their IDs) in step with storage.
+	// Roots are scanned in parallel, sharing SCANNER_IO_WORKERS storage
+	// operations between them, and catalog rows are committed
+	// SCANNER_WRITE_BATCH_SIZE at a time
+	scannerConfig := services.ScannerConfig{}
+	if n, err := strconv.Atoi(os.Getenv("SCANNER_MAX_CONCURRENT_JOBS")); err == nil {
+		scannerConfig.MaxConcurrentJobs = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SCANNER_IO_WORKERS")); err == nil {
+		scannerConfig.MaxIOWorkers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SCANNER_WRITE_BATCH_SIZE")); err == nil {
+		scannerConfig.WriteBatchSize = n
+	}
+	scannerService := services.NewScannerService(databaseDB, logger, storageProviders, scannerConfig)
+	scannerService.SetDependencyChecker(dependencyMonitor)
+
+	// Real-time push channel at /api/v1/ws: scan progress, conversion job
+	// status (to the job owner) and newly cataloged media
+	eventHub := services.NewEventHub(logger)
+	scannerService.SetEventPublisher(eventHub)
+	conversionService.SetEventPublisher(eventHub)
+	eventSocketHandler := root_handlers.NewEventSocketHandler(eventHub, authService, logger)
+
+	scannerService.Start()
+
+	// Conversion workers: run queued jobs by priority, each user limited
+	// to the MaxConcurrentJobs of their conversion settings
+	conversionWorkerConfig := root_services.ConversionWorkerConfig{}
+	if n, err := strconv.Atoi(os.Getenv("CONVERSION_WORKERS")); err == nil {
+		conversionWorkerConfig.Workers = n
+	}
+	conversionService.StartWorkers(conversionWorkerConfig)
+	scanJobHandler := root_handlers.NewScanJobHandler(scannerService, authService)
+	catalogChangesHandler := root_handlers.NewCatalogChangesHandler(services.NewCatalogDiffService(databaseDB, logger), authService)
 
 	// Initialize handlers
 	catalogHandler := handlers.NewCatalogHandler(catalogService, smbService, logger)
-	downloadHandler := handlers.NewDownloadHandler(catalogService, smbService, cfg.Catalog.TempDir, cfg.Catalog.MaxArchiveSize, cfg.Catalog.DownloadChunkSize, logger)
-	copyHandler := handlers.NewCopyHandler(catalogService, smbService, cfg.Catalog.TempDir, logger)
+	catalogHandler.SetVersionSource(catalogService)
+	catalogHandler.SetPageSource(catalogService)
+	catalogHandler.SetPageLimits(cfg.Catalog.DefaultPageSize, cfg.Catalog.MaxPageSize)
+	catalogHandler.SetExporter(catalogService)
+	downloadHandler := handlers.NewDownloadHandler(catalogService, storageProviders, cfg.Catalog.TempDir, cfg.Catalog.MaxArchiveSize, cfg.Catalog.DownloadChunkSize, logger)
+	downloadHandler.SetStagedArchiveProtocols(cfg.Catalog.StagedArchiveProtocols)
+	copyHandler := handlers.NewCopyHandler(catalogService, storageProviders, cfg.Catalog.TempDir, logger)
 	smbDiscoveryHandler := handlers.NewSMBDiscoveryHandler(smbDiscoveryService, logger)
+	smbDiscoveryHandler.SetAuditRecorder(auditService)
+	storageDiscoveryHandler := handlers.NewDiscoveryHandler(discoveryService, logger)
 	conversionHandler := root_handlers.NewConversionHandler(conversionService, authService)
 	authHandler := root_handlers.NewAuthHandler(authService)
 	androidTVMediaHandler := root_handlers.NewAndroidTVMediaHandler(databaseDB)
@@ -438,6 +772,100 @@ func main() {
 	// WebSocket handler for real-time updates
 	wsHandler := root_handlers.NewWebSocketHandler(logger)
 
+	// Ransomware heuristics: suspicious bursts of renames or high-entropy
+	// rewrites put the affected storage root into read-only lockdown until
+	// an administrator releases it.
+	ransomwareDetector := services.NewRansomwareDetector(databaseDB, logger, services.DefaultRansomwareDetectorConfig())
+	ransomwareDetector.AddNotifier(services.NewLogLockdownNotifier(logger))
+	ransomwareDetector.AddNotifier(services.LockdownNotifierFunc(func(_ context.Context, lockdown *services.ShareLockdown) error {
+		wsHandler.BroadcastToClients(map[string]interface{}{
+			"type":     "share_lockdown",
+			"action":   "locked",
+			"lockdown": lockdown,
+		})
+		return nil
+	}))
+	// Lockdowns also go to the error reporting channels (Slack, email)
+	ransomwareDetector.AddNotifier(services.LockdownNotifierFunc(func(_ context.Context, lockdown *services.ShareLockdown) error {
+		_, err := errorReportingService.ReportAlert(&models.ErrorReportRequest{
+			Level:     models.ErrorLevelFatal,
+			Message:   fmt.Sprintf("Storage root %s placed in read-only lockdown: %s", lockdown.StorageRoot, lockdown.Reason),
+			ErrorCode: "share_lockdown_" + lockdown.TriggerType,
+			Component: "ransomware_detector",
+			Context:   lockdown.Details,
+		})
+		return err
+	}))
+	if webhookURL := os.Getenv("LOCKDOWN_WEBHOOK_URL"); webhookURL != "" {
+		ransomwareDetector.AddNotifier(services.NewWebhookLockdownNotifier(webhookURL))
+	}
+	// Scans pass the moves and rewrites they find to the heuristics
+	scannerService.SetRansomwareDetector(ransomwareDetector)
+	// Anomaly detection: failed logins, API server errors, bytes downloaded
+	// and conversion failures are totalled per window and compared with a
+	// rolling baseline; unusual rises alert administrators
+	anomalyConfig := services.AnomalyDetectorConfig{}
+	if d, err := time.ParseDuration(os.Getenv("ANOMALY_INTERVAL")); err == nil {
+		anomalyConfig.Interval = d
+	}
+	anomalyDetector := services.NewAnomalyDetector(databaseDB, logger, anomalyConfig)
+	anomalyDetector.AddNotifier(services.AnomalyNotifierFunc(func(_ context.Context, alert *services.AnomalyAlert) error {
+		wsHandler.BroadcastToClients(map[string]interface{}{
+			"type":  "anomaly_alert",
+			"alert": alert,
+		})
+		return nil
+	}))
+	if webhookURL := os.Getenv("ANOMALY_WEBHOOK_URL"); webhookURL != "" {
+		anomalyDetector.AddNotifier(services.NewWebhookAnomalyNotifier(webhookURL))
+	}
+	authService.SetMetricRecorder(anomalyDetector)
+	conversionService.SetMetricRecorder(anomalyDetector)
+	anomalyDetector.Start()
+	anomalyHandler := root_handlers.NewAnomalyHandler(anomalyDetector, authService)
+
+	if err := ransomwareDetector.LoadActiveLockdowns(ctx); err != nil {
+		log.Printf("Warning: failed to load active share lockdowns: %v", err)
+	}
+	copyHandler.SetLockdownChecker(ransomwareDetector)
+	copyHandler.SetMaxUploadSize(cfg.Catalog.MaxUploadSize)
+	lockdownHandler := root_handlers.NewLockdownHandler(ransomwareDetector, authService)
+
+	// Permission troubleshooting: evaluate a user's action against roles,
+	// resources and lockdowns without acting as the user
+	permissionSimulator := services.NewPermissionSimulator(databaseDB)
+	permissionSimulator.SetLockdownChecker(ransomwareDetector)
+	permissionSimulatorHandler := root_handlers.NewPermissionSimulatorHandler(permissionSimulator, authService)
+
+	// Opt-in anonymous usage telemetry: counted locally once enabled by an
+	// administrator, per opted-in user, and only reported upstream when an
+	// endpoint is configured and upstream reporting is enabled too
+	telemetryService := services.NewTelemetryService(databaseDB, logger, services.TelemetryConfig{
+		Endpoint: os.Getenv("TELEMETRY_ENDPOINT"),
+	})
+	telemetryService.Start()
+	telemetryHandler := root_handlers.NewTelemetryHandler(telemetryService, authService)
+
+	// Feature flags and A/B experiments; exposures are analytics events
+	featureFlagService := services.NewFeatureFlagService(databaseDB, logger)
+	featureFlagHandler := root_handlers.NewFeatureFlagHandler(featureFlagService, authService)
+
+	// ZFS/Btrfs snapshot browsing and restore for local storage roots
+	snapshotService := services.NewSnapshotService(databaseDB, logger)
+	snapshotService.SetLockdownChecker(ransomwareDetector)
+	catalogHandler.SetSnapshotService(snapshotService)
+	snapshotHandler := root_handlers.NewSnapshotHandler(snapshotService, authService)
+
+	// Resolution of duplicate groups found by content hash
+	duplicateResolver := services.NewDuplicateResolver(databaseDB, storageProviders, logger)
+	duplicateResolver.SetLockdownChecker(ransomwareDetector)
+	duplicateHandler := root_handlers.NewDuplicateHandler(duplicateResolver, authService)
+
+	// Server-side move, rename and delete, with a per-user trash
+	fileOperations := services.NewFileOperations(databaseDB, storageProviders, logger)
+	fileOperations.SetLockdownChecker(ransomwareDetector)
+	fileOperationsHandler := root_handlers.NewFileOperationsHandler(fileOperations, authService)
+
 	// Initialize asset management system
 	assetRepo := root_repository.NewAssetRepository(databaseDB)
 	assetStore, err := asset_store.NewFileStore(filepath.Join(".", "cache", "assets"))
@@ -479,6 +907,7 @@ func main() {
 
 	// Scan handler for storage roots and scan operations
 	scanHandler := root_handlers.NewScanHandler(universalScanner, databaseDB)
+	scanHandler.SetAuditLog(auditService)
 
 	// Create service adapters to bridge interface differences between services and handlers
 	authAdapter := &root_handlers.AuthServiceAdapter{Inner: authService}
@@ -488,9 +917,19 @@ func main() {
 
 	// User management, role, configuration, error reporting, and log management handlers
 	userHandler := root_handlers.NewUserHandler(userRepo, authAdapter)
+	userHandler.SetAuditLog(auditService)
+	userSettingsHandler := root_handlers.NewUserSettingsHandler(services.NewUserSettingsService(databaseDB, logger), authService)
+	passwordHashingHandler := root_handlers.NewPasswordHashingHandler(authService, authService)
 	roleHandler := root_handlers.NewRoleHandler(userRepo, authAdapter)
+	roleHandler.SetAuditLog(auditService)
 	configurationHandler := root_handlers.NewConfigurationHandler(configAdapter, authAdapter)
+	configurationHandler.SetAuditLog(auditService)
+	setupHandler := root_handlers.NewSetupHandler(setupService, authService)
+	systemConfigHandler := root_handlers.NewSystemConfigHandler(configurationService, authService)
+	systemConfigHandler.SetAuditLog(auditService)
+	auditHandler := root_handlers.NewAuditHandler(auditService, authService)
 	errorReportingHandler := root_handlers.NewErrorReportingHandler(errorAdapter, authAdapter)
+	cspReportHandler := root_handlers.NewCSPReportHandler(errorReportingService)
 	logManagementHandler := root_handlers.NewLogManagementHandler(logAdapter, authAdapter)
 	discoveryHandler := func(c *gin.Context) {
 		c.JSON(200, gin.H{"host": cfg.Server.Host, "port": cfg.Server.Port})
@@ -500,37 +939,529 @@ func main() {
 	searchHandler := root_handlers.NewSearchHandler(fileRepository)
 	browseHandler := root_handlers.NewBrowseHandler(fileRepository)
 
-	// Sync handler (remote synchronization via WebDAV, S3, GCS, local)
+	// Full-text search (FTS5 on SQLite) with the structured query language
+	fileSearchService := services.NewFileSearchService(databaseDB, logger)
+	fileSearchHandler := root_handlers.NewFileSearchHandler(fileSearchService, authService)
+
+	// Sync handler (remote synchronization via WebDAV, S3, GCS, SFTP, rclone, local)
 	syncRepo := root_repository.NewSyncRepository(databaseDB)
 	syncService := root_services.NewSyncService(syncRepo, userRepo, authService)
 	syncHandler := root_handlers.NewSyncHandler(syncService, authService)
 
+	// OAuth cloud sync backends are enabled by registering an app with the
+	// provider and setting its client credentials. The redirect URL is the
+	// page that passes the returned code and state to /sync/cloud/callback.
+	cloudRedirectURL := os.Getenv("CLOUD_SYNC_REDIRECT_URL")
+	if id := os.Getenv("DROPBOX_CLIENT_ID"); id != "" {
+		syncService.RegisterCloudProvider(root_services.NewDropboxProvider(root_services.CloudProviderConfig{
+			ClientID: id, ClientSecret: os.Getenv("DROPBOX_CLIENT_SECRET"), RedirectURL: cloudRedirectURL,
+		}))
+	}
+	if id := os.Getenv("GOOGLE_DRIVE_CLIENT_ID"); id != "" {
+		syncService.RegisterCloudProvider(root_services.NewGoogleDriveProvider(root_services.CloudProviderConfig{
+			ClientID: id, ClientSecret: os.Getenv("GOOGLE_DRIVE_CLIENT_SECRET"), RedirectURL: cloudRedirectURL,
+		}))
+	}
+	if id := os.Getenv("ONEDRIVE_CLIENT_ID"); id != "" {
+		syncService.RegisterCloudProvider(root_services.NewOneDriveProvider(root_services.CloudProviderConfig{
+			ClientID: id, ClientSecret: os.Getenv("ONEDRIVE_CLIENT_SECRET"), RedirectURL: cloudRedirectURL,
+		}))
+	}
+
+	// rclone endpoints shell out to rclone; remotes come from its own config
+	// (RCLONE_CONFIG or the per-endpoint "rclone_config" setting).
+	if bin := os.Getenv("RCLONE_BINARY"); bin != "" {
+		syncService.SetRcloneBinary(bin)
+	}
+
+	// Sync schedules are checked every SYNC_SCHEDULER_INTERVAL (default 1m)
+	// and due ones started in the background.
+	syncSchedulerInterval := time.Minute
+	if d, err := time.ParseDuration(os.Getenv("SYNC_SCHEDULER_INTERVAL")); err == nil {
+		syncSchedulerInterval = d
+	}
+	syncService.StartScheduler(syncSchedulerInterval)
+
+	// File version history: uploads and sync keep previous versions of the
+	// files they overwrite, subject to per-share retention policies.
+	// FILE_VERSIONS_DEFAULT_MAX enables versioning for shares without a policy.
+	versionConfig := services.FileVersionConfig{Dir: filepath.Join(".", "data", "versions")}
+	if dir := os.Getenv("FILE_VERSIONS_DIR"); dir != "" {
+		versionConfig.Dir = dir
+	}
+	if n, err := strconv.Atoi(os.Getenv("FILE_VERSIONS_DEFAULT_MAX")); err == nil {
+		versionConfig.DefaultMaxVersions = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("FILE_VERSIONS_DEFAULT_MAX_AGE_DAYS")); err == nil {
+		versionConfig.DefaultMaxAgeDays = n
+	}
+	fileVersionService := services.NewFileVersionService(databaseDB, logger, versionConfig)
+	fileVersionService.SetRemoteStore(smbService)
+	copyHandler.SetVersionService(fileVersionService)
+	syncService.SetVersionService(fileVersionService)
+	fileVersionHandler := root_handlers.NewFileVersionHandler(fileVersionService, authService)
+
+	// Resumable uploads: files sent in chunks, verified against their
+	// SHA-256 and written to storage once complete
+	uploadService := services.NewUploadService(databaseDB, logger, storageProviders, services.UploadConfig{
+		Dir:            filepath.Join(cfg.Catalog.TempDir, "uploads"),
+		MaxOpenPerUser: cfg.Catalog.MaxOpenUploads,
+	})
+	uploadService.SetLockdownChecker(ransomwareDetector)
+	uploadService.SetVersionService(fileVersionService)
+	uploadService.Start()
+	uploadHandler := root_handlers.NewUploadHandler(uploadService, authService, root_handlers.UploadLimits{
+		Default: cfg.Catalog.MaxUploadSize,
+		ByRole:  cfg.Catalog.MaxUploadSizeByRole,
+	})
+
+	// Cold storage: files on cold tiers (tape, archive object storage) stay
+	// catalogued but are recalled on request and staged locally for a while.
+	coldStorageConfig := services.ColdStorageConfig{StagingDir: filepath.Join(".", "data", "recalls")}
+	if dir := os.Getenv("COLD_STORAGE_STAGING_DIR"); dir != "" {
+		coldStorageConfig.StagingDir = dir
+	}
+	if d, err := time.ParseDuration(os.Getenv("COLD_STORAGE_POLL_INTERVAL")); err == nil {
+		coldStorageConfig.PollInterval = d
+	}
+	coldStorageService := services.NewColdStorageService(databaseDB, logger, coldStorageConfig)
+	coldStorageService.AddNotifier(services.NewLogRecallNotifier(logger))
+	coldStorageService.AddNotifier(services.RecallNotifierFunc(func(_ context.Context, job *services.RecallJob) error {
+		wsHandler.BroadcastToClients(map[string]interface{}{
+			"type":   "recall_update",
+			"status": job.Status,
+			"recall": job,
+		})
+		return nil
+	}))
+	downloadHandler.SetColdStorage(coldStorageService)
+	coldStorageService.Start()
+	coldStorageHandler := root_handlers.NewColdStorageHandler(coldStorageService, authService)
+
+	// Storage tiering: policies move old or rarely accessed files between
+	// storage roots (e.g. to an archive NAS) and can be undone per run.
+	tieringConfig := services.TieringConfig{}
+	if d, err := time.ParseDuration(os.Getenv("TIERING_INTERVAL")); err == nil {
+		tieringConfig.Interval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("TIERING_MAX_FILES_PER_RUN")); err == nil {
+		tieringConfig.MaxFilesPerRun = n
+	}
+	tieringService := services.NewTieringService(databaseDB, logger, universalScanner, tieringConfig)
+	tieringService.SetLockdownChecker(ransomwareDetector)
+	downloadHandler.SetAccessRecorder(tieringService)
+	tieringService.Start()
+	tieringHandler := root_handlers.NewTieringHandler(tieringService, authService)
+
+	// Prefetch cache: when a local cache directory is configured, the next
+	// episodes or tracks after each download are copied there from remote
+	// storage roots and served locally, within an LRU-evicted size budget.
+	prefetchConfig := services.PrefetchConfig{CacheDir: os.Getenv("PREFETCH_CACHE_DIR")}
+	if n, err := strconv.ParseInt(os.Getenv("PREFETCH_CACHE_MAX_BYTES"), 10, 64); err == nil {
+		prefetchConfig.MaxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PREFETCH_LOOKAHEAD")); err == nil {
+		prefetchConfig.Lookahead = n
+	}
+	for _, name := range strings.Split(os.Getenv("PREFETCH_ROOTS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			prefetchConfig.Roots = append(prefetchConfig.Roots, name)
+		}
+	}
+	prefetchService := services.NewPrefetchService(databaseDB, logger, universalScanner, prefetchConfig)
+	if prefetchConfig.CacheDir != "" {
+		downloadHandler.SetPrefetchCache(prefetchService)
+		prefetchService.Start()
+	}
+	prefetchHandler := root_handlers.NewPrefetchHandler(prefetchService, authService)
+
+	// Encrypted downloads: users register age or GPG public keys and may ask
+	// for any download or archive to be encrypted to one of them.
+	encryptionService := services.NewDownloadEncryptionService(databaseDB, logger)
+	if binary := os.Getenv("AGE_BINARY"); binary != "" {
+		encryptionService.SetAgeBinary(binary)
+	}
+	if binary := os.Getenv("GPG_BINARY"); binary != "" {
+		encryptionService.SetGPGBinary(binary)
+	}
+	downloadHandler.SetEncryptor(encryptionService)
+	encryptionKeyHandler := root_handlers.NewEncryptionKeyHandler(encryptionService, authService)
+
+	// Media playback: byte-range streaming, plus HLS transcoded by the
+	// conversion service for formats browsers cannot play natively
+	downloadHandler.SetHLSTranscoder(conversionService, filepath.Join(".", "cache", "hls"))
+
+	// Public share links: tokenised links to single files, optionally
+	// watermarked with the sharer's name and a timestamp. Videos are
+	// watermarked once per link with ffmpeg; images can also be stamped on
+	// every download.
+	watermarker := services.NewWatermarker()
+	if binary := os.Getenv("FFMPEG_BINARY"); binary != "" {
+		watermarker.SetFFmpegBinary(binary)
+	}
+	if font := os.Getenv("WATERMARK_FONT_FILE"); font != "" {
+		watermarker.SetFontFile(font)
+	}
+	shareLinkConfig := services.ShareLinkConfig{CacheDir: os.Getenv("SHARE_LINK_CACHE_DIR"), PublicURL: os.Getenv("PUBLIC_URL")}
+	if n, err := strconv.Atoi(os.Getenv("SHARE_LINK_MAX_FAILED_ATTEMPTS")); err == nil {
+		shareLinkConfig.MaxFailedAttempts = n
+	}
+	shareLinkService := services.NewShareLinkService(databaseDB, logger, universalScanner, watermarker, shareLinkConfig)
+	// Links can be emailed to recipients, one tokenised link each, when an
+	// SMTP relay is configured
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpConfig := services.SMTPConfig{
+			Host:     smtpHost,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+		if port, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil {
+			smtpConfig.Port = port
+		}
+		shareLinkService.SetEmailSender(services.NewSMTPEmailSender(smtpConfig))
+	}
+	shareLinkHandler := root_handlers.NewShareLinkHandler(shareLinkService, authService)
+	// Bursts of unknown tokens or wrong passwords make anonymous share
+	// access solve a proof-of-work challenge for a while
+	if n, err := strconv.Atoi(os.Getenv("SHARE_POW_ATTACK_THRESHOLD")); err == nil && n > 0 {
+		guardConfig := services.ShareGuardConfig{AttackThreshold: n}
+		if bits, err := strconv.Atoi(os.Getenv("SHARE_POW_DIFFICULTY")); err == nil {
+			guardConfig.Difficulty = bits
+		}
+		shareGuard, err := services.NewShareAccessGuard(guardConfig)
+		if err != nil {
+			logger.Fatal("Failed to configure share access guard", zap.Error(err))
+		}
+		shareLinkHandler.SetAccessGuard(shareGuard)
+	}
+
+	// Links that open media in the native apps, with their universal
+	// links and QR codes
+	deepLinkingService := services.NewDeepLinkingService(os.Getenv("PUBLIC_URL"), "v1")
+	deepLinkingService.SetEventRepository(root_repository.NewLinkEventRepository(databaseDB))
+	deepLinkHandler := root_handlers.NewDeepLinkHandler(deepLinkingService, authService)
+
+	// Playlists of catalog media items; smart playlists are evaluated
+	// against catalog metadata when read
+	playlistService := services.NewCatalogPlaylistService(databaseDB, logger)
+	playlistHandler := root_handlers.NewPlaylistHandler(playlistService, authService)
+
+	// Export and import of collections and playlists between instances;
+	// items are referenced by file hash and path so they survive re-scans
+	libraryTransferService := services.NewLibraryTransferService(databaseDB, logger, playlistService)
+	libraryTransferHandler := root_handlers.NewLibraryTransferHandler(libraryTransferService, authService)
+
+	// Recycle bin: deleted collections, playlists, users and media items are
+	// soft-deleted, can be restored, and are purged after the retention period
+	recycleBinConfig := services.RecycleBinConfig{}
+	if d, err := time.ParseDuration(os.Getenv("RECYCLE_BIN_RETENTION")); err == nil {
+		recycleBinConfig.Retention = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RECYCLE_BIN_PURGE_INTERVAL")); err == nil {
+		recycleBinConfig.Interval = d
+	}
+	recycleBinService := services.NewRecycleBinService(databaseDB, logger, recycleBinConfig)
+	recycleBinService.Start()
+	recycleBinHandler := root_handlers.NewRecycleBinHandler(recycleBinService, authService)
+
+	// Federation: remote Catalogizer instances registered as read-only
+	// libraries, mirrored on a schedule or proxied live; their streams are
+	// proxied through URLs signed with this key
+	federationConfig := services.FederationConfig{SigningKey: os.Getenv("FEDERATION_SIGNING_KEY")}
+	if federationConfig.SigningKey == "" {
+		federationConfig.SigningKey = jwtSecret
+	}
+	if d, err := time.ParseDuration(os.Getenv("FEDERATION_SYNC_INTERVAL")); err == nil {
+		federationConfig.SyncInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("FEDERATION_STREAM_URL_TTL")); err == nil {
+		federationConfig.StreamURLTTL = d
+	}
+	federationService := services.NewFederationService(databaseDB, logger, federationConfig)
+	federationService.Start()
+	federationHandler := root_handlers.NewFederationHandler(federationService, authService)
+
+	// Replication: rules copying collections or sections of remote
+	// libraries into local storage within their bandwidth schedules
+	var replicationInterval time.Duration
+	if d, err := time.ParseDuration(os.Getenv("REPLICATION_INTERVAL")); err == nil {
+		replicationInterval = d
+	}
+	replicationService := services.NewReplicationService(databaseDB, logger, federationService, storageProviders, replicationInterval)
+	replicationService.Start()
+	replicationHandler := root_handlers.NewReplicationHandler(replicationService, authService)
+
+	// Screeners: per-recipient share links for a campaign, expiring together,
+	// with every play and download logged against the recipient.
+	screenerService := services.NewScreenerService(databaseDB, logger, shareLinkService)
+	screenerHandler := root_handlers.NewScreenerHandler(screenerService, authService)
+
 	// Analytics, reporting, and favorites handlers
 	analyticsHandler := root_handlers.NewAnalyticsHandler(analyticsService, logger)
+	analyticsDashboardHandler := root_handlers.NewAnalyticsDashboardHandler(analyticsService, authService)
+
+	// Analytics retention: events and access logs are rolled up by hour and
+	// purged past the retention period set per table
+	analyticsRetentionConfig := services.AnalyticsRetentionConfig{}
+	if d, err := time.ParseDuration(os.Getenv("ANALYTICS_RETENTION_INTERVAL")); err == nil {
+		analyticsRetentionConfig.Interval = d
+	}
+	analyticsRetentionService := services.NewAnalyticsRetentionService(databaseDB, logger, analyticsRetentionConfig)
+	analyticsRetentionService.Start()
+	analyticsRetentionHandler := root_handlers.NewAnalyticsRetentionHandler(analyticsRetentionService, authService)
+
+	// Catalog maintenance: reindex, analyze, vacuum and WAL checkpoint on a
+	// schedule set to low-usage hours, or on demand
+	maintenanceService := services.NewCatalogMaintenanceService(databaseDB, logger, services.MaintenanceConfig{})
+	maintenanceService.Start()
+	maintenanceHandler := root_handlers.NewMaintenanceHandler(maintenanceService, authService)
+
+	// Database backups: snapshots of the SQLite catalog taken every
+	// BACKUP_INTERVAL and on demand, encrypted with BACKUP_ENCRYPTION_KEY or
+	// the database key, rotated past BACKUP_RETENTION and copied to a
+	// WebDAV sync endpoint when BACKUP_WEBDAV_URL is set
+	backupConfig := services.BackupConfig{
+		Dir:           os.Getenv("BACKUP_DIR"),
+		EncryptionKey: os.Getenv("BACKUP_ENCRYPTION_KEY"),
+		RemoteDir:     os.Getenv("BACKUP_WEBDAV_PATH"),
+	}
+	if backupConfig.Dir == "" {
+		backupConfig.Dir = filepath.Join(filepath.Dir(cfg.Database.Path), "backups")
+	}
+	if dir, err := filepath.Abs(backupConfig.Dir); err == nil {
+		backupConfig.Dir = dir
+	}
+	if d, err := time.ParseDuration(os.Getenv("BACKUP_INTERVAL")); err == nil {
+		backupConfig.Interval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("BACKUP_RETENTION")); err == nil {
+		backupConfig.Retention = n
+	}
+	if webdavURL := os.Getenv("BACKUP_WEBDAV_URL"); webdavURL != "" {
+		backupConfig.Uploader = root_services.NewWebDAVClient(webdavURL, os.Getenv("BACKUP_WEBDAV_USERNAME"), os.Getenv("BACKUP_WEBDAV_PASSWORD"))
+	}
+	backupService := services.NewBackupService(databaseDB, logger, backupConfig)
+	backupService.Start()
+	backupHandler := root_handlers.NewBackupHandler(backupService, authService)
+
+	// Library health: a score per section from missing metadata, unmatched
+	// items, duplicates, corrupt files and low-quality copies, recorded
+	// every LIBRARY_HEALTH_INTERVAL for the trend
+	libraryHealthConfig := services.LibraryHealthConfig{}
+	if d, err := time.ParseDuration(os.Getenv("LIBRARY_HEALTH_INTERVAL")); err == nil {
+		libraryHealthConfig.SnapshotInterval = d
+	}
+	libraryHealthService := services.NewLibraryHealthService(databaseDB, logger, libraryHealthConfig)
+	libraryHealthService.SetEnricher(metadataEnrichmentService)
+	libraryHealthService.Start()
+	libraryHealthHandler := root_handlers.NewLibraryHealthHandler(libraryHealthService, authService)
+
+	// Maintenance runbooks: saved sequences of read-only mode, backups,
+	// vacuums and rescans, run step by step with one call
+	runbookService := services.NewRunbookService(databaseDB, logger, maintenanceService, scannerService, ransomwareDetector)
+	runbookService.Start()
+	runbookHandler := root_handlers.NewRunbookHandler(runbookService, authService)
+	ldapHandler := root_handlers.NewLDAPHandler(authService, authService)
 	reportingHandler := root_handlers.NewReportingHandler(reportingService, logger)
 	favoritesHandler := root_handlers.NewFavoritesHandler(favoritesService, logger)
 
+	// Undo journal: media and playlist deletes, tiering runs and removed
+	// favorites and tags can be undone by the user who performed them for
+	// UNDO_WINDOW; deletes no longer than they stay in the recycle bin
+	undoConfig := services.UndoJournalConfig{}
+	if d, err := time.ParseDuration(os.Getenv("UNDO_WINDOW")); err == nil {
+		undoConfig.Window = d
+	}
+	undoJournal := services.NewUndoJournal(databaseDB, logger, undoConfig)
+	undoJournal.RegisterReverser(services.UndoKindDelete, "media", recycleBinService.Retention(),
+		func(ctx context.Context, op *services.UndoOperation) error {
+			return recycleBinService.Restore(ctx, "media", op.ResourceID)
+		})
+	undoJournal.RegisterReverser(services.UndoKindDelete, "playlists", recycleBinService.Retention(),
+		func(ctx context.Context, op *services.UndoOperation) error {
+			_, err := playlistService.RestorePlaylist(ctx, op.UserID, op.ResourceID)
+			return err
+		})
+	undoJournal.RegisterReverser(services.UndoKindMove, "tiering_runs", 0,
+		func(ctx context.Context, op *services.UndoOperation) error {
+			_, err := tieringService.UndoRun(ctx, op.ResourceID)
+			return err
+		})
+	undoJournal.RegisterReverser(services.UndoKindDelete, "favorites", 0,
+		func(ctx context.Context, op *services.UndoOperation) error {
+			var removed []models.Favorite
+			if err := op.DecodePayload(&removed); err != nil {
+				return err
+			}
+			for _, favorite := range removed {
+				if exists, _ := favoritesService.IsFavorite(op.UserID, favorite.EntityType, favorite.EntityID); exists {
+					continue
+				}
+				favorite.ID = 0
+				if _, err := favoritesService.AddFavorite(op.UserID, &favorite); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	undoJournal.RegisterReverser(services.UndoKindTagRemoval, "favorites", 0,
+		func(ctx context.Context, op *services.UndoOperation) error {
+			var tags []string
+			if err := op.DecodePayload(&tags); err != nil {
+				return err
+			}
+			_, err := favoritesService.RestoreFavoriteTags(op.UserID, int(op.ResourceID), tags)
+			return err
+		})
+	recycleBinHandler.SetUndoJournal(undoJournal)
+	playlistHandler.SetUndoJournal(undoJournal)
+	tieringHandler.SetUndoJournal(undoJournal)
+	favoritesHandler.SetUndoJournal(undoJournal)
+	undoHandler := root_handlers.NewUndoHandler(undoJournal, authService)
+
+	// Speed test: transfers and pings clients time to measure their link
+	// to the server
+	speedTestConfig := root_handlers.SpeedTestConfig{}
+	if n, err := strconv.ParseInt(os.Getenv("SPEEDTEST_DEFAULT_BYTES"), 10, 64); err == nil {
+		speedTestConfig.DefaultSize = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("SPEEDTEST_MAX_BYTES"), 10, 64); err == nil {
+		speedTestConfig.MaxSize = n
+	}
+	speedTestHandler := root_handlers.NewSpeedTestHandler(speedTestConfig)
+
 	// Initialize JWT middleware
 	jwtMiddleware := root_middleware.NewJWTMiddleware(jwtSecret)
+	jwtMiddleware.SetSessionValidator(authService.ValidateSession)
+	apiKeyMiddleware := root_middleware.NewAPIKeyMiddleware(authService.AuthenticateAPIKey)
 
 	// Initialize rate limiters using internal auth middleware
-	authRateLimiter := authMiddleware.RateLimitByUser(5, "1m")      // 5 requests per minute for auth
-	defaultRateLimiter := authMiddleware.RateLimitByUser(100, "1m") // 100 requests per minute default
+	authRateTier := root_handlers.RateLimitTier{Name: "auth", Requests: 5, Window: "1m", Applies: "/api/v1/auth"}
+	defaultRateTier := root_handlers.RateLimitTier{Name: "default", Requests: 100, Window: "1m", Applies: "/api/v1"}
+	authRateLimiter := authMiddleware.RateLimitByUser(authRateTier.Requests, authRateTier.Window)
+	defaultRateLimiter := authMiddleware.RateLimitByUser(defaultRateTier.Requests, defaultRateTier.Window)
+
+	// Capability discovery: what this server supports, for clients to adapt
+	// their UI to
+	capabilitiesHandler := root_handlers.NewCapabilitiesHandler(root_handlers.CapabilitiesConfig{
+		Version:          Version,
+		BuildNumber:      BuildNumber,
+		APIVersions:      []root_handlers.APIVersion{{Version: "v1", Path: "/api/v1", Status: "stable"}},
+		StorageProtocols: clientFactory.SupportedProtocols(),
+		SyncProtocols: []string{
+			models.SyncTypeLocal, models.SyncTypeWebDAV, models.SyncTypeSFTP, models.SyncTypeRclone, models.SyncTypeCloudStorage,
+		},
+		Limits: root_handlers.CapabilityLimits{
+			MaxUploadSize:  cfg.Catalog.MaxUploadSize,
+			MaxArchiveSize: cfg.Catalog.MaxArchiveSize,
+			MaxPageSize:    cfg.Catalog.MaxPageSize,
+			RateLimits:     []root_handlers.RateLimitTier{authRateTier, defaultRateTier},
+		},
+	}, conversionService)
+	for _, feature := range []string{
+		"share_links", "screeners", "file_versions", "snapshots", "cold_storage", "tiering", "prefetch",
+		"download_encryption", "scan_schedules", "subtitles", "feature_flags",
+	} {
+		capabilitiesHandler.SetFeature(feature, true)
+	}
+	capabilitiesHandler.SetFeature("distributed_rate_limiting", redisClient != nil)
+	capabilitiesHandler.SetFeatureCheck("full_text_search", func(ctx context.Context) (bool, string) {
+		return true, fileSearchService.Engine(ctx)
+	})
+	capabilitiesHandler.SetFeatureCheck("cloud_sync", func(context.Context) (bool, string) {
+		providers := syncService.CloudProviderNames()
+		return len(providers) > 0, strings.Join(providers, ",")
+	})
+	capabilitiesHandler.SetFeatureCheck("telemetry", func(ctx context.Context) (bool, string) {
+		settings, err := telemetryService.GetSettings(ctx)
+		return err == nil && settings.Enabled, ""
+	})
+
+	// HTTPS from the saved system configuration (network.https): Let's
+	// Encrypt or file certificates on dual-stack listeners, HSTS and an
+	// optional HTTP-to-HTTPS redirect listener
+	var httpsManager *services.HTTPSManager
+	securityHeaders := root_middleware.DefaultSecurityHeadersConfig()
+	if sysConfig, err := configurationService.GetConfiguration(); err == nil && sysConfig.Network != nil &&
+		sysConfig.Network.HTTPS != nil && sysConfig.Network.HTTPS.Enabled {
+		httpsConfig := sysConfig.Network.HTTPS
+		var fallback *tls.Certificate
+		if cert, err := getOrCreateSelfSignedCert(); err == nil {
+			fallback = &cert
+		}
+		httpsManager, err = services.NewHTTPSManager(httpsConfig, fallback, logger)
+		if err != nil {
+			logger.Fatal("Invalid HTTPS configuration", zap.Error(err))
+		}
+		if hsts := httpsConfig.HSTS; hsts != nil {
+			securityHeaders.EnableHSTS = hsts.Enabled
+			if hsts.MaxAgeSeconds > 0 {
+				securityHeaders.HSTSMaxAge = hsts.MaxAgeSeconds
+			}
+			securityHeaders.HSTSIncludeSubDomains = hsts.IncludeSubdomains
+			securityHeaders.HSTSPreload = hsts.Preload
+		}
+	}
+	// Stored files may be previewed, embedded and loaded by the web app;
+	// the universal link page runs its own redirect script
+	securityHeaders.ReportURI = "/api/v1/csp-report"
+	for _, prefix := range []string{
+		"/api/v1/assets/:id", "/api/v1/shared/", "/api/v1/stream/", "/api/v1/download/",
+		"/api/v1/federation/stream/", "/api/v1/entities/:id/stream", "/api/v1/entities/:id/download", "/api/v1/links/qr",
+	} {
+		securityHeaders.Routes = append(securityHeaders.Routes,
+			root_middleware.SecurityHeadersRoute{PathPrefix: prefix, Headers: root_middleware.ServedContentHeaders()})
+	}
+	securityHeaders.Routes = append(securityHeaders.Routes, root_middleware.SecurityHeadersRoute{
+		PathPrefix: "/link/",
+		Headers:    map[string]string{"Content-Security-Policy": "default-src 'none'; script-src 'unsafe-inline'; frame-ancestors 'none'"},
+	})
+
+	// CORS policies from network.cors: a default policy plus per-route
+	// group policies, reloaded whenever the configuration is saved
+	var corsConfig *models.CORSConfig
+	if sysConfig, err := configurationService.GetConfiguration(); err == nil && sysConfig.Network != nil {
+		corsConfig = sysConfig.Network.CORS
+	}
+	corsPolicies, err := root_middleware.NewCORSPolicies(corsConfig)
+	if err != nil {
+		logger.Warn("Ignoring invalid network.cors configuration, using the built-in CORS policy", zap.Error(err))
+		corsPolicies, _ = root_middleware.NewCORSPolicies(nil)
+	}
+	configurationService.SetCORSReloader(corsPolicies)
 
 	// Setup Gin router
 	router := gin.Default()
 
+	// Client address, scheme and host come from forwarding headers only
+	// when a configured reverse proxy sent them; gin must not read the
+	// headers itself
+	trustedProxies, err := root_middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.Fatal("Invalid trusted_proxies configuration", zap.Error(err))
+	}
+	if err := router.SetTrustedProxies(nil); err != nil {
+		logger.Fatal("Failed to configure trusted proxies", zap.Error(err))
+	}
+
 	// Middleware
-	router.Use(root_middleware.SecurityHeaders())
+	router.Use(root_middleware.ForwardedHeaders(trustedProxies))
+	router.Use(root_middleware.SecurityHeadersWithConfig(securityHeaders))
 	router.Use(root_middleware.ConcurrencyLimiter(100))
 	router.Use(root_middleware.RequestTimeout(60 * time.Second))
-	router.Use(root_middleware.CORS())
+	router.Use(corsPolicies.Handler())
 	router.Use(metrics.GinMiddleware())
 	router.Use(middleware.Logger(logger))
 	router.Use(middleware.ErrorHandler())
 	router.Use(root_middleware.RequestID())
 	router.Use(root_middleware.InputValidation(root_middleware.DefaultInputValidationConfig()))
 	router.Use(middleware.CompressionMiddleware(middleware.DefaultCompressionConfig()))
+	// Until first-run setup completes only the wizard, sign-in and public
+	// endpoints answer; everything else under /api/v1 is 503
+	router.Use(root_middleware.SetupGate(setupService.Completed,
+		"/api/v1/setup", "/api/v1/auth", "/api/v1/capabilities", "/api/v1/shared", "/api/v1/assets", "/api/v1/csp-report"))
+	router.Use(root_middleware.AnomalyTracking(anomalyDetector))
 
 	// Start runtime metrics collector (goroutines, memory)
 	metrics.StartRuntimeCollector(15 * time.Second)
@@ -540,21 +1471,51 @@ func main() {
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
+		status := "healthy"
+		if dependencyMonitor.Degraded() || storageBreakers.Open() {
+			status = "degraded"
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"status":       "healthy",
+			"status":       status,
 			"time":         time.Now().UTC(),
 			"version":      Version,
 			"build_number": BuildNumber,
 			"build_date":   BuildDate,
 		})
 	})
+	router.GET("/health/live", healthHandler.Live)
+	router.GET("/health/ready", healthHandler.Ready)
 
 	// WebSocket endpoint (auth via query parameter, not header)
 	router.GET("/ws", wsHandler.HandleConnection)
 
+	// Authenticated event stream (JWT checked during the handshake)
+	router.GET("/api/v1/ws", eventSocketHandler.Connect)
+
 	// Asset serving (public — no auth needed for serving images)
 	router.GET("/api/v1/assets/:id", root_middleware.StaticCacheHeaders(), assetHandler.ServeAsset)
 
+	// Capability discovery is public so clients can adapt before signing in
+	router.GET("/api/v1/capabilities", defaultRateLimiter, capabilitiesHandler.GetCapabilities)
+
+	// Public share link downloads (the token is the credential)
+	router.GET("/api/v1/shared/:token", defaultRateLimiter, shareLinkHandler.Download)
+	router.POST("/api/v1/shared/:token", defaultRateLimiter, shareLinkHandler.Download)
+
+	// Universal links and their QR codes are opened by anyone they are
+	// shared with
+	router.GET("/link/:action/:mediaID", defaultRateLimiter, deepLinkHandler.Open)
+	router.GET("/api/v1/links/qr", defaultRateLimiter, deepLinkHandler.QRCode)
+
+	// Federated library streams (the signed URL is the credential)
+	router.GET("/api/v1/federation/stream/:remote_id/:item_id", defaultRateLimiter, federationHandler.Stream)
+
+	// Browsers send CSP violation reports without credentials
+	router.POST("/api/v1/csp-report", defaultRateLimiter, cspReportHandler.Report)
+
+	// Setup status is public so clients can start the wizard before signing in
+	router.GET("/api/v1/setup/status", defaultRateLimiter, setupHandler.GetStatus)
+
 	// Authentication routes (no auth required)
 	authGroup := router.Group("/api/v1/auth")
 	authGroup.Use(authRateLimiter) // Apply strict rate limiting to auth endpoints
@@ -569,44 +1530,156 @@ func main() {
 		authGroup.GET("/status", authHandler.GetAuthStatusGin)
 		authGroup.GET("/permissions", jwtMiddleware.RequireAuth(), authHandler.GetPermissionsGin)
 		authGroup.GET("/profile", jwtMiddleware.RequireAuth(), authHandler.GetCurrentUserGin)
+		authGroup.GET("/sessions", jwtMiddleware.RequireAuth(), authHandler.ListSessionsGin)
+		authGroup.DELETE("/sessions", jwtMiddleware.RequireAuth(), authHandler.RevokeOtherSessionsGin)
+		authGroup.DELETE("/sessions/:id", jwtMiddleware.RequireAuth(), authHandler.RevokeSessionGin)
+		authGroup.GET("/apikeys", jwtMiddleware.RequireAuth(), authHandler.ListAPIKeysGin)
+		authGroup.POST("/apikeys", jwtMiddleware.RequireAuth(), authHandler.CreateAPIKeyGin)
+		authGroup.DELETE("/apikeys/:id", jwtMiddleware.RequireAuth(), authHandler.RevokeAPIKeyGin)
+		authGroup.GET("/oidc/providers", authHandler.ListOIDCProvidersGin)
+		authGroup.GET("/oidc/identities", jwtMiddleware.RequireAuth(), authHandler.ListOIDCIdentitiesGin)
+		authGroup.DELETE("/oidc/identities/:id", jwtMiddleware.RequireAuth(), authHandler.UnlinkOIDCIdentityGin)
+		authGroup.GET("/oidc/:provider/login", authHandler.OIDCLoginGin)
+		authGroup.GET("/oidc/:provider/callback", authHandler.OIDCCallbackGin)
+		authGroup.POST("/oidc/:provider/link", jwtMiddleware.RequireAuth(), authHandler.LinkOIDCGin)
 	}
 
 	// API routes
 	api := router.Group("/api/v1")
-	api.Use(jwtMiddleware.RequireAuth()) // Apply auth middleware to all API routes
-	api.Use(defaultRateLimiter)          // Apply general rate limiting to API
+	api.Use(apiKeyMiddleware.Authenticate()) // Accept X-API-Key in place of a JWT
+	api.Use(jwtMiddleware.RequireAuth())     // Apply auth middleware to all API routes
+	api.Use(defaultRateLimiter)              // Apply general rate limiting to API
+	api.Use(telemetryHandler.Track())        // Count feature usage for opted-in users
 	{
 		api.GET("/discovery", discoveryHandler)
+		api.GET("/features", featureFlagHandler.GetAssignments)
+		api.POST("/features/:key/exposures", featureFlagHandler.LogExposure)
 		// Catalog browsing endpoints
-		api.GET("/catalog", catalogHandler.ListRoot)
-		api.GET("/catalog/*path", catalogHandler.ListPath)
-		api.GET("/catalog-info/*path", catalogHandler.GetFileInfo)
+		cacheCatalog := root_handlers.CacheResponses(responseCache, services.ResponseCacheCatalog)
+		invalidateResponses := root_handlers.InvalidateResponses(responseCache)
+		revalidate := root_middleware.CacheControlRevalidate
+		api.GET("/catalog", root_middleware.ConditionalRequests(catalogHandler.RootVersion, revalidate), cacheCatalog, catalogHandler.ListRoot)
+		api.GET("/catalog/*path", catalogHandler.ServeExport, root_middleware.ConditionalRequests(catalogHandler.ListingVersion, revalidate), cacheCatalog, root_middleware.SparseFieldsets("files"), catalogHandler.ListPath)
+		api.GET("/catalog-info/*path", root_middleware.ConditionalRequests(catalogHandler.FileVersion, revalidate), catalogHandler.GetFileInfo)
+		api.GET("/catalog-changes", catalogChangesHandler.GetChanges)
+		api.GET("/snapshots/:root", root_handlers.RequireStorageRoot(dependencyMonitor, "root"), snapshotHandler.ListSnapshots)
+		api.POST("/snapshots/:root/restore", root_handlers.RequireStorageRoot(dependencyMonitor, "root"), snapshotHandler.RestoreFromSnapshot)
 
 		// Search endpoints
-		api.GET("/search", catalogHandler.Search)
-		api.GET("/search/duplicates", catalogHandler.SearchDuplicates)
-		api.GET("/search/files", searchHandler.SearchFiles)
-		api.GET("/search/files/duplicates", searchHandler.SearchDuplicates)
+		cacheSearch := root_handlers.CacheResponses(responseCache, services.ResponseCacheSearch)
+		api.GET("/search", cacheSearch, catalogHandler.Search)
+		api.GET("/search/duplicates", cacheSearch, catalogHandler.SearchDuplicates)
+		api.POST("/search/duplicates/resolve", invalidateResponses, duplicateHandler.ResolveDuplicates)
+		api.GET("/search/files", cacheSearch, searchHandler.SearchFiles)
+		api.GET("/search/files/duplicates", cacheSearch, searchHandler.SearchDuplicates)
 		api.POST("/search/advanced", searchHandler.AdvancedSearch)
+		api.GET("/search/v2", cacheSearch, fileSearchHandler.Search)
+		api.POST("/search/v2/reindex", invalidateResponses, fileSearchHandler.RebuildIndex)
 
 		// Download endpoints
 		api.GET("/download/file/:id", downloadHandler.DownloadFile)
 		api.GET("/download/directory/*path", downloadHandler.DownloadDirectory)
 		api.POST("/download/archive", downloadHandler.DownloadArchive)
 
+		// Streaming endpoints
+		api.GET("/stream/:id", downloadHandler.StreamFile)
+		api.GET("/stream/:id/hls", root_handlers.RequireDependency(dependencyMonitor, "ffmpeg"), downloadHandler.StreamHLSPlaylist)
+		api.GET("/stream/:id/hls/:segment", downloadHandler.StreamHLSSegment)
+
 		// File operations
 		api.POST("/copy/storage", copyHandler.CopyToStorage)
 		api.POST("/copy/local", copyHandler.CopyToLocal)
 		api.POST("/copy/upload", copyHandler.CopyFromLocal)
+		api.POST("/files/move", fileOperationsHandler.MoveFile)
+		api.POST("/files/rename", fileOperationsHandler.RenameFile)
+		api.POST("/files/delete", fileOperationsHandler.DeleteFile)
+		api.GET("/trash", fileOperationsHandler.ListTrash)
+		api.DELETE("/trash", fileOperationsHandler.EmptyTrash)
+		api.POST("/trash/:id/restore", fileOperationsHandler.RestoreTrash)
+		api.DELETE("/trash/:id", fileOperationsHandler.PurgeTrash)
+		api.GET("/share-trash/:root", root_handlers.RequireStorageRoot(dependencyMonitor, "root"), fileOperationsHandler.ListShareTrash)
+		api.POST("/share-trash/:root/restore", root_handlers.RequireStorageRoot(dependencyMonitor, "root"), fileOperationsHandler.RestoreShareTrash)
+
+		// Resumable uploads
+		api.POST("/upload", uploadHandler.CreateUpload)
+		api.GET("/upload/:id", uploadHandler.GetUpload)
+		api.PATCH("/upload/:id", uploadHandler.UploadChunk)
+		api.POST("/upload/:id/complete", uploadHandler.CompleteUpload)
+		api.DELETE("/upload/:id", uploadHandler.AbortUpload)
 
 		// Media browsing endpoints (must be before :id to prevent route conflict)
 		api.GET("/media/search", mediaBrowseHandler.SearchMedia)
 		api.GET("/media/stats", mediaBrowseHandler.GetMediaStats)
 
 		// Media operations
-		api.GET("/media/:id", androidTVMediaHandler.GetMediaByID)
+		api.GET("/media/:id", root_middleware.SparseFieldsets(""), androidTVMediaHandler.GetMediaByID)
 		api.PUT("/media/:id/progress", androidTVMediaHandler.UpdateWatchProgress)
 		api.PUT("/media/:id/favorite", androidTVMediaHandler.UpdateFavoriteStatus)
+		// Play counts, viewers and completion of one item for library owners
+		api.GET("/media/:id/stats", analyticsDashboardHandler.GetMediaUsageStats)
+		api.GET("/media/:id/versions", fileVersionHandler.ListVersions)
+		api.POST("/media/:id/versions/:version_id/restore", fileVersionHandler.RestoreVersion)
+		api.GET("/media/:id/lyrics", lyricsHandler.GetMediaLyrics)
+		api.PUT("/media/:id/lyrics", lyricsHandler.SetMediaLyrics)
+		api.DELETE("/media/:id/lyrics", lyricsHandler.DeleteMediaLyrics)
+
+		// Remote libraries (read-only federation)
+		api.GET("/federation/remotes", federationHandler.ListLibraries)
+		api.GET("/federation/search", federationHandler.Search)
+		api.GET("/federation/remotes/:id/items", federationHandler.BrowseLibrary)
+		api.GET("/federation/remotes/:id/items/:item_id", federationHandler.GetItem)
+		api.GET("/federation/remotes/:id/items/:item_id/stream", federationHandler.GetStreamURL)
+
+		// Cold storage recalls
+		api.POST("/media/:id/recall", coldStorageHandler.RequestRecall)
+		api.GET("/recalls", coldStorageHandler.ListRecalls)
+		api.GET("/recalls/:id", coldStorageHandler.GetRecall)
+
+		// Per-user public keys for encrypted downloads
+		api.GET("/encryption-keys", encryptionKeyHandler.ListKeys)
+		api.POST("/encryption-keys", encryptionKeyHandler.AddKey)
+		api.GET("/encryption-keys/:id", encryptionKeyHandler.GetKey)
+		api.PUT("/encryption-keys/:id/default", encryptionKeyHandler.SetDefaultKey)
+		api.DELETE("/encryption-keys/:id", encryptionKeyHandler.DeleteKey)
+
+		// Public share links
+		api.GET("/share-links", shareLinkHandler.ListLinks)
+		api.POST("/share-links", shareLinkHandler.CreateLink)
+		api.GET("/share-links/:id", shareLinkHandler.GetLink)
+		api.DELETE("/share-links/:id", shareLinkHandler.RevokeLink)
+		api.POST("/share-links/:id/resend", shareLinkHandler.ResendEmail)
+		api.GET("/share-links/:id/stats", shareLinkHandler.GetStats)
+
+		// Deep links into the native apps
+		api.POST("/links/generate", deepLinkHandler.GenerateLinks)
+		api.POST("/links/batch", deepLinkHandler.GenerateBatch)
+		api.POST("/links/smart", deepLinkHandler.GenerateSmartLink)
+		api.POST("/links/validate", deepLinkHandler.ValidateLinks)
+		api.POST("/links/events", deepLinkHandler.TrackEvent)
+		api.GET("/links/analytics/:tracking_id", deepLinkHandler.GetAnalytics)
+
+		// Playlists and smart playlists
+		api.GET("/playlists", playlistHandler.ListPlaylists)
+		api.POST("/playlists", playlistHandler.CreatePlaylist)
+		api.GET("/playlists/:id", playlistHandler.GetPlaylist)
+		api.PUT("/playlists/:id", playlistHandler.UpdatePlaylist)
+		api.DELETE("/playlists/:id", playlistHandler.DeletePlaylist)
+		api.POST("/playlists/:id/restore", playlistHandler.RestorePlaylist)
+		api.POST("/playlists/:id/items", playlistHandler.AddItems)
+		api.PUT("/playlists/:id/items/order", playlistHandler.ReorderItems)
+		api.DELETE("/playlists/:id/items/:item_id", playlistHandler.RemoveItem)
+		api.GET("/playlists/:id/export", playlistHandler.ExportPlaylist)
+
+		// Collection and playlist export/import
+		api.GET("/library/export", libraryTransferHandler.ExportLibrary)
+		api.POST("/library/import", libraryTransferHandler.ImportLibrary)
+
+		// Screener campaigns
+		api.GET("/screeners", screenerHandler.ListCampaigns)
+		api.POST("/screeners", screenerHandler.CreateCampaign)
+		api.GET("/screeners/:id", screenerHandler.GetCampaign)
+		api.POST("/screeners/:id/close", screenerHandler.CloseCampaign)
+		api.GET("/screeners/:id/report", screenerHandler.GetReport)
 
 		// Recommendation endpoints
 		recGroup := api.Group("/recommendations")
@@ -623,6 +1696,7 @@ func main() {
 			subGroup.POST("/download", subtitleHandler.DownloadSubtitle)
 			subGroup.GET("/media/:media_id", subtitleHandler.GetSubtitles)
 			subGroup.GET("/:subtitle_id/verify-sync/:media_id", subtitleHandler.VerifySubtitleSync)
+			subGroup.POST("/:subtitle_id/resync", subtitleHandler.ResyncSubtitle)
 			subGroup.POST("/translate", subtitleHandler.TranslateSubtitle)
 			subGroup.POST("/upload", subtitleHandler.UploadSubtitle)
 			subGroup.GET("/languages", subtitleHandler.GetSupportedLanguages)
@@ -635,12 +1709,14 @@ func main() {
 		api.GET("/storage-roots/:id/status", scanHandler.GetStorageRootStatus)
 
 		// Statistics and sorting
-		api.GET("/stats/directories/by-size", catalogHandler.GetDirectoriesBySize)
-		api.GET("/stats/duplicates/count", catalogHandler.GetDuplicatesCount)
+		cacheStats := root_handlers.CacheResponses(responseCache, services.ResponseCacheStats)
+		api.GET("/stats/directories/by-size", cacheStats, catalogHandler.GetDirectoriesBySize)
+		api.GET("/stats/duplicates/count", cacheStats, catalogHandler.GetDuplicatesCount)
 
 		// Advanced statistics endpoints
 		statsGroup := api.Group("/stats")
 		statsGroup.Use(root_middleware.CacheHeaders(60)) // 1-minute cache for statistics
+		statsGroup.Use(cacheStats)
 		{
 			statsGroup.GET("/overall", statsHandler.GetOverallStats)
 			statsGroup.GET("/smb/:smb_root", statsHandler.GetSmbRootStats)
@@ -663,6 +1739,10 @@ func main() {
 			smbGroup.POST("/browse", smbDiscoveryHandler.BrowseShare)
 		}
 
+		// Network storage discovery endpoints
+		api.POST("/discovery/storage", storageDiscoveryHandler.Discover)
+		api.GET("/discovery/storage", storageDiscoveryHandler.DiscoverGET)
+
 		// Scan endpoints
 		scanGroup := api.Group("/scans")
 		{
@@ -671,12 +1751,32 @@ func main() {
 			scanGroup.GET("/:job_id", scanHandler.GetScanStatus)
 		}
 
+		// Background scanner jobs and schedules (admin)
+		scannerGroup := api.Group("/scan")
+		{
+			scannerGroup.GET("/jobs", scanJobHandler.ListJobs)
+			scannerGroup.POST("/jobs", scanJobHandler.StartJob)
+			scannerGroup.GET("/jobs/:id", scanJobHandler.GetJob)
+			scannerGroup.POST("/jobs/:id/cancel", scanJobHandler.CancelJob)
+			scannerGroup.GET("/schedules", scanJobHandler.ListSchedules)
+			scannerGroup.PUT("/schedules/:root_id", scanJobHandler.SetSchedule)
+			scannerGroup.DELETE("/schedules/:root_id", scanJobHandler.DeleteSchedule)
+			scannerGroup.GET("/hash-limits", scanJobHandler.ListHashRateLimits)
+			scannerGroup.PUT("/hash-limits/:root_id", scanJobHandler.SetHashRateLimit)
+			scannerGroup.DELETE("/hash-limits/:root_id", scanJobHandler.DeleteHashRateLimit)
+			scannerGroup.GET("/traversal-policies", scanJobHandler.ListTraversalPolicies)
+			scannerGroup.PUT("/traversal-policies/:root_id", scanJobHandler.SetTraversalPolicy)
+			scannerGroup.DELETE("/traversal-policies/:root_id", scanJobHandler.DeleteTraversalPolicy)
+			scannerGroup.GET("/type-mismatches", scanJobHandler.ListTypeMismatches)
+		}
+
 		// Conversion endpoints
 		conversionGroup := api.Group("/conversion")
 		{
 			conversionGroup.POST("/jobs", conversionHandler.CreateJob)
 			conversionGroup.GET("/jobs", conversionHandler.ListJobs)
 			conversionGroup.GET("/jobs/:id", conversionHandler.GetJob)
+			conversionGroup.GET("/jobs/:id/progress", conversionHandler.GetJobProgress)
 			conversionGroup.POST("/jobs/:id/cancel", conversionHandler.CancelJob)
 			conversionGroup.GET("/formats", conversionHandler.GetSupportedFormats)
 		}
@@ -686,10 +1786,14 @@ func main() {
 		usersGroup := api.Group("/users")
 		{
 			usersGroup.POST("", wrap(userHandler.CreateUser))
-			usersGroup.GET("", wrap(userHandler.ListUsers))
+			usersGroup.GET("", root_middleware.SparseFieldsets("users"), wrap(userHandler.ListUsers))
 			usersGroup.GET("/:id", wrap(userHandler.GetUser))
 			usersGroup.PUT("/:id", wrap(userHandler.UpdateUser))
 			usersGroup.DELETE("/:id", wrap(userHandler.DeleteUser))
+			usersGroup.GET("/:id/settings", userSettingsHandler.GetSettings)
+			usersGroup.PATCH("/:id/settings", userSettingsHandler.PatchSettings)
+			usersGroup.PUT("/:id/settings", userSettingsHandler.ReplaceSettings)
+			usersGroup.POST("/:id/restore", recycleBinHandler.RestoreResource("users"))
 			usersGroup.POST("/:id/reset-password", wrap(userHandler.ResetPassword))
 			usersGroup.POST("/:id/lock", wrap(userHandler.LockAccount))
 			usersGroup.POST("/:id/unlock", wrap(userHandler.UnlockAccount))
@@ -712,6 +1816,8 @@ func main() {
 			configGroup.GET("", wrap(configurationHandler.GetConfiguration))
 			configGroup.POST("/test", wrap(configurationHandler.TestConfiguration))
 			configGroup.GET("/status", wrap(configurationHandler.GetSystemStatus))
+			configGroup.GET("/cors", configurationHandler.GetCORSConfiguration)
+			configGroup.PUT("/cors", configurationHandler.UpdateCORSConfiguration)
 			configGroup.GET("/wizard/step/:step_id", wrap(configurationHandler.GetWizardStep))
 			configGroup.POST("/wizard/step/:step_id/validate", wrap(configurationHandler.ValidateWizardStep))
 			configGroup.POST("/wizard/step/:step_id/save", wrap(configurationHandler.SaveWizardProgress))
@@ -719,6 +1825,26 @@ func main() {
 			configGroup.POST("/wizard/complete", wrap(configurationHandler.CompleteWizard))
 		}
 
+		// First-run setup wizard (closed once setup completes)
+		setupGroup := api.Group("/setup")
+		{
+			setupGroup.GET("/steps", setupHandler.GetSteps)
+			setupGroup.GET("/progress", setupHandler.GetProgress)
+			setupGroup.POST("/steps/:step_id/validate", setupHandler.ValidateStep)
+			setupGroup.PUT("/steps/:step_id", setupHandler.SaveStep)
+			setupGroup.POST("/complete", setupHandler.Complete)
+		}
+
+		// Onboarding tasks and demo library
+		onboardingGroup := api.Group("/onboarding")
+		{
+			onboardingGroup.GET("", onboardingHandler.GetStatus)
+			onboardingGroup.POST("/tasks/:task/complete", onboardingHandler.CompleteTask)
+			onboardingGroup.POST("/tasks/:task/skip", onboardingHandler.SkipTask)
+			onboardingGroup.POST("/demo-library", onboardingHandler.CreateDemoLibrary)
+			onboardingGroup.DELETE("/demo-library", onboardingHandler.RemoveDemoLibrary)
+		}
+
 		// Error reporting endpoints
 		errorsGroup := api.Group("/errors")
 		{
@@ -757,8 +1883,10 @@ func main() {
 			collectionsGroup.GET("", collectionHandler.ListCollections)
 			collectionsGroup.POST("", collectionHandler.CreateCollection)
 			collectionsGroup.GET("/:id", collectionHandler.GetCollection)
+			collectionsGroup.GET("/:id/items", collectionHandler.GetCollectionItems)
 			collectionsGroup.PUT("/:id", collectionHandler.UpdateCollection)
 			collectionsGroup.DELETE("/:id", collectionHandler.DeleteCollection)
+			collectionsGroup.POST("/:id/restore", recycleBinHandler.RestoreResource("collections"))
 		}
 
 		// Asset management endpoints (authenticated)
@@ -780,14 +1908,21 @@ func main() {
 			entityGroup.GET("/:id", mediaEntityHandler.GetEntity)
 			entityGroup.GET("/:id/children", mediaEntityHandler.GetEntityChildren)
 			entityGroup.GET("/:id/files", mediaEntityHandler.GetEntityFiles)
-			entityGroup.GET("/:id/metadata", mediaEntityHandler.GetEntityMetadata)
+			entityGroup.GET("/:id/metadata", root_middleware.ConditionalRequests(mediaEntityHandler.MetadataVersion, root_middleware.CacheControlRevalidate), mediaEntityHandler.GetEntityMetadata)
 			entityGroup.GET("/:id/duplicates", mediaEntityHandler.GetEntityDuplicates)
 			entityGroup.GET("/:id/stream", mediaEntityHandler.StreamEntity)
 			entityGroup.GET("/:id/download", mediaEntityHandler.DownloadEntity)
 			entityGroup.GET("/:id/install-info", mediaEntityHandler.GetInstallInfo)
 			entityGroup.POST("/:id/metadata/refresh", mediaEntityHandler.RefreshEntityMetadata)
+			entityGroup.GET("/:id/metadata/matches", metadataEnrichmentHandler.FindMatches)
+			entityGroup.POST("/:id/metadata/rematch", metadataEnrichmentHandler.Rematch)
+			entityGroup.POST("/:id/metadata/identify", metadataEnrichmentHandler.Identify)
+			entityGroup.GET("/:id/metadata/sources", metadataEnrichmentHandler.FieldSources)
 			entityGroup.PUT("/:id/user-metadata", mediaEntityHandler.UpdateUserMetadata)
 			entityGroup.POST("/:id/user-metadata", mediaEntityHandler.UpdateUserMetadata)
+			entityGroup.POST("/:id/progress", mediaEntityHandler.RecordProgress)
+			entityGroup.DELETE("/:id", recycleBinHandler.DeleteMedia)
+			entityGroup.POST("/:id/restore", recycleBinHandler.RestoreResource("media"))
 		}
 
 		// Analytics endpoints
@@ -795,7 +1930,11 @@ func main() {
 		{
 			analyticsGroup.POST("/access", analyticsHandler.LogMediaAccess)
 			analyticsGroup.POST("/event", analyticsHandler.LogEvent)
-			analyticsGroup.GET("/user/:user_id", analyticsHandler.GetUserAnalytics)
+			analyticsGroup.POST("/events", analyticsDashboardHandler.TrackEvents)
+			analyticsGroup.GET("/dashboard", analyticsDashboardHandler.GetDashboard)
+			analyticsGroup.GET("/realtime", analyticsDashboardHandler.GetRealtime)
+			analyticsGroup.GET("/timeseries", analyticsDashboardHandler.GetTimeSeries)
+			analyticsGroup.GET("/user/:user_id", analyticsDashboardHandler.GetUserActivity)
 			analyticsGroup.GET("/system", analyticsHandler.GetSystemAnalytics)
 			analyticsGroup.GET("/media/:media_id", analyticsHandler.GetMediaAnalytics)
 			analyticsGroup.POST("/reports", analyticsHandler.CreateReport)
@@ -815,6 +1954,30 @@ func main() {
 			favoritesGroup.POST("", favoritesHandler.AddFavorite)
 			favoritesGroup.DELETE("/:entity_type/:entity_id", favoritesHandler.RemoveFavorite)
 			favoritesGroup.GET("/check/:entity_type/:entity_id", favoritesHandler.CheckFavorite)
+			favoritesGroup.PUT("/:id", favoritesHandler.UpdateFavorite)
+			favoritesGroup.POST("/bulk", favoritesHandler.BulkAddFavorites)
+			favoritesGroup.POST("/bulk/remove", favoritesHandler.BulkRemoveFavorites)
+			favoritesGroup.GET("/statistics", favoritesHandler.GetStatistics)
+			favoritesGroup.GET("/categories", favoritesHandler.ListCategories)
+			favoritesGroup.POST("/categories", favoritesHandler.CreateCategory)
+			favoritesGroup.PUT("/categories/:id", favoritesHandler.UpdateCategory)
+			favoritesGroup.DELETE("/categories/:id", favoritesHandler.DeleteCategory)
+			favoritesGroup.POST("/:id/share", favoritesHandler.ShareFavorite)
+			favoritesGroup.GET("/shared", favoritesHandler.GetSharedFavorites)
+			favoritesGroup.DELETE("/shares/:id", favoritesHandler.RevokeShare)
+		}
+
+		// Undo endpoints: the current user's recent destructive operations
+		api.GET("/undo", undoHandler.ListOperations)
+		api.POST("/undo/:operation_id", undoHandler.Undo)
+
+		// Diagnostics endpoints
+		diagnosticsGroup := api.Group("/diagnostics")
+		{
+			diagnosticsGroup.GET("/speedtest", speedTestHandler.GetInfo)
+			diagnosticsGroup.GET("/speedtest/download", speedTestHandler.Download)
+			diagnosticsGroup.POST("/speedtest/upload", speedTestHandler.Upload)
+			diagnosticsGroup.GET("/speedtest/ping", speedTestHandler.Ping)
 		}
 
 		// Browse endpoints (directory browsing and file info)
@@ -836,13 +1999,140 @@ func main() {
 			syncGroup.PUT("/endpoints/:id", syncHandler.UpdateEndpoint)
 			syncGroup.DELETE("/endpoints/:id", syncHandler.DeleteEndpoint)
 			syncGroup.POST("/endpoints/:id/sync", syncHandler.StartSync)
+			syncGroup.POST("/endpoints/:id/plan", syncHandler.PlanSync)
+			syncGroup.GET("/endpoints/:id/versions", syncHandler.ListFileVersions)
+			syncGroup.POST("/endpoints/:id/versions/:version_id/restore", syncHandler.RestoreFileVersion)
+			syncGroup.POST("/endpoints/:id/cloud/link", syncHandler.LinkCloudAccount)
+			syncGroup.POST("/cloud/callback", syncHandler.CompleteCloudLink)
 			syncGroup.GET("/sessions", syncHandler.GetUserSessions)
 			syncGroup.GET("/sessions/:id", syncHandler.GetSession)
+			syncGroup.GET("/sessions/:id/progress", syncHandler.GetSessionProgress)
+			syncGroup.GET("/sessions/:id/failures", syncHandler.GetSessionFailures)
 			syncGroup.POST("/schedules", syncHandler.ScheduleSync)
+			syncGroup.GET("/schedules", syncHandler.GetSchedules)
+			syncGroup.DELETE("/schedules/:id", syncHandler.DeleteSchedule)
 			syncGroup.GET("/statistics", syncHandler.GetSyncStatistics)
 			syncGroup.POST("/cleanup", syncHandler.CleanupOldSessions)
 		}
 
+		// Admin endpoints
+		adminGroup := api.Group("/admin")
+		{
+			adminGroup.GET("/lockdowns", lockdownHandler.ListLockdowns)
+			adminGroup.GET("/recycle-bin", recycleBinHandler.GetOverview)
+			adminGroup.GET("/analytics/retention", analyticsRetentionHandler.GetRetention)
+			adminGroup.PUT("/analytics/retention/:table", analyticsRetentionHandler.UpdatePolicy)
+			adminGroup.POST("/analytics/retention/run", analyticsRetentionHandler.RunRetention)
+			adminGroup.GET("/maintenance", maintenanceHandler.GetStatus)
+			adminGroup.PUT("/maintenance/schedule", maintenanceHandler.UpdateSchedule)
+			adminGroup.POST("/maintenance/run", maintenanceHandler.StartRun)
+			adminGroup.GET("/maintenance/runs", maintenanceHandler.ListRuns)
+			adminGroup.GET("/maintenance/runs/:id", maintenanceHandler.GetRun)
+			adminGroup.GET("/backups", backupHandler.ListBackups)
+			adminGroup.POST("/backups", backupHandler.CreateBackup)
+			adminGroup.POST("/backups/:name/restore", backupHandler.RestoreBackup)
+			adminGroup.GET("/library-health", libraryHealthHandler.GetLibraryHealth)
+			adminGroup.POST("/library-health/:section/enrich", libraryHealthHandler.EnrichSection)
+			adminGroup.POST("/metadata/refresh", metadataRefreshHandler.StartRefresh)
+			adminGroup.GET("/metadata/refresh", metadataRefreshHandler.ListRefreshes)
+			adminGroup.GET("/metadata/refresh/:id", metadataRefreshHandler.GetRefresh)
+			adminGroup.POST("/metadata/refresh/:id/cancel", metadataRefreshHandler.CancelRefresh)
+			adminGroup.GET("/metadata/cache", metadataRefreshHandler.GetCache)
+			adminGroup.DELETE("/metadata/cache", metadataRefreshHandler.InvalidateCache)
+			adminGroup.GET("/metadata/sources", metadataEnrichmentHandler.GetSourceConfig)
+			adminGroup.PUT("/metadata/sources", metadataEnrichmentHandler.UpdateSourceConfig)
+			adminGroup.GET("/provider-keys", providerKeysHandler.GetStatus)
+			adminGroup.GET("/metadata/offline", offlineMetadataHandler.ListBundles)
+			adminGroup.POST("/metadata/offline", offlineMetadataHandler.ImportBundle)
+			adminGroup.GET("/metadata/offline/imports", offlineMetadataHandler.ListImports)
+			adminGroup.GET("/metadata/offline/:name", offlineMetadataHandler.GetBundle)
+			adminGroup.DELETE("/metadata/offline/:name", offlineMetadataHandler.DeleteBundle)
+			adminGroup.GET("/response-cache", responseCacheHandler.GetMetrics)
+			adminGroup.DELETE("/response-cache", responseCacheHandler.Purge)
+			adminGroup.GET("/runbooks", runbookHandler.ListRunbooks)
+			adminGroup.POST("/runbooks", runbookHandler.CreateRunbook)
+			adminGroup.GET("/runbooks/runs", runbookHandler.ListRuns)
+			adminGroup.GET("/runbooks/runs/:id", runbookHandler.GetRun)
+			adminGroup.POST("/runbooks/runs/:id/abort", runbookHandler.AbortRun)
+			adminGroup.GET("/runbooks/:id", runbookHandler.GetRunbook)
+			adminGroup.PUT("/runbooks/:id", runbookHandler.UpdateRunbook)
+			adminGroup.DELETE("/runbooks/:id", runbookHandler.DeleteRunbook)
+			adminGroup.POST("/runbooks/:id/run", runbookHandler.StartRun)
+			adminGroup.GET("/audit", auditHandler.ListEvents)
+			adminGroup.GET("/audit/export", auditHandler.ExportEvents)
+			adminGroup.GET("/audit/:id", auditHandler.GetEvent)
+			adminGroup.GET("/password-hashing", passwordHashingHandler.GetStatus)
+			adminGroup.PUT("/password-hashing", passwordHashingHandler.UpdateParams)
+			adminGroup.POST("/password-hashing/benchmark", passwordHashingHandler.Benchmark)
+			adminGroup.GET("/ldap/accounts", ldapHandler.ListAccounts)
+			adminGroup.POST("/ldap/sync", ldapHandler.Sync)
+			adminGroup.GET("/anomalies/settings", anomalyHandler.GetSettings)
+			adminGroup.PUT("/anomalies/settings/:metric", anomalyHandler.UpdateSettings)
+			adminGroup.GET("/anomalies/alerts", anomalyHandler.ListAlerts)
+			adminGroup.POST("/anomalies/alerts/:id/acknowledge", anomalyHandler.AcknowledgeAlert)
+			adminGroup.GET("/config", systemConfigHandler.GetConfiguration)
+			adminGroup.POST("/config/test", systemConfigHandler.TestConfiguration)
+			adminGroup.GET("/config/backups", systemConfigHandler.ListBackups)
+			adminGroup.POST("/config/backups", systemConfigHandler.CreateBackup)
+			adminGroup.GET("/config/backups/:id", systemConfigHandler.GetBackup)
+			adminGroup.POST("/config/backups/:id/restore", systemConfigHandler.RestoreBackup)
+			adminGroup.DELETE("/config/backups/:id", systemConfigHandler.DeleteBackup)
+			adminGroup.GET("/config/templates", systemConfigHandler.ListTemplates)
+			adminGroup.POST("/config/templates", systemConfigHandler.CreateTemplate)
+			adminGroup.DELETE("/config/templates/:id", systemConfigHandler.DeleteTemplate)
+			adminGroup.POST("/config/templates/:id/apply", systemConfigHandler.ApplyTemplate)
+			adminGroup.GET("/config/:section", systemConfigHandler.GetSection)
+			adminGroup.PUT("/config/:section", systemConfigHandler.UpdateSection)
+			adminGroup.GET("/recycle-bin/:type", recycleBinHandler.ListDeleted)
+			adminGroup.POST("/recycle-bin/:type/:id/restore", recycleBinHandler.RestoreDeleted)
+			adminGroup.DELETE("/recycle-bin/:type/:id", recycleBinHandler.PurgeDeleted)
+			adminGroup.POST("/lockdowns/:id/release", lockdownHandler.ReleaseLockdown)
+			adminGroup.POST("/permissions/simulate", permissionSimulatorHandler.Simulate)
+			adminGroup.GET("/dependencies", dependencyHandler.GetDependencies)
+			adminGroup.POST("/dependencies/probe", dependencyHandler.ProbeDependencies)
+			adminGroup.GET("/telemetry", telemetryHandler.GetDashboard)
+			adminGroup.PUT("/telemetry", telemetryHandler.UpdateSettings)
+			adminGroup.DELETE("/telemetry/usage", telemetryHandler.PurgeUsage)
+			adminGroup.GET("/telemetry/preview", telemetryHandler.Preview)
+			adminGroup.POST("/telemetry/report", telemetryHandler.SendReport)
+			adminGroup.GET("/telemetry/reports", telemetryHandler.ListReports)
+			adminGroup.GET("/feature-flags", featureFlagHandler.ListFlags)
+			adminGroup.PUT("/feature-flags/:key", featureFlagHandler.SaveFlag)
+			adminGroup.DELETE("/feature-flags/:key", featureFlagHandler.DeleteFlag)
+			adminGroup.GET("/feature-flags/:key/results", featureFlagHandler.GetResults)
+			adminGroup.GET("/version-policies/:root", fileVersionHandler.GetPolicy)
+			adminGroup.PUT("/version-policies/:root", fileVersionHandler.SetPolicy)
+			adminGroup.GET("/cold-tiers", coldStorageHandler.ListTiers)
+			adminGroup.GET("/cold-tiers/:root", coldStorageHandler.GetTier)
+			adminGroup.PUT("/cold-tiers/:root", coldStorageHandler.SetTier)
+			adminGroup.DELETE("/cold-tiers/:root", coldStorageHandler.DeleteTier)
+			adminGroup.GET("/tiering/policies", tieringHandler.ListPolicies)
+			adminGroup.POST("/tiering/policies", tieringHandler.CreatePolicy)
+			adminGroup.GET("/tiering/policies/:id", tieringHandler.GetPolicy)
+			adminGroup.PUT("/tiering/policies/:id", tieringHandler.UpdatePolicy)
+			adminGroup.DELETE("/tiering/policies/:id", tieringHandler.DeletePolicy)
+			adminGroup.GET("/tiering/policies/:id/preview", tieringHandler.PreviewPolicy)
+			adminGroup.POST("/tiering/policies/:id/run", tieringHandler.RunPolicy)
+			adminGroup.GET("/tiering/runs", tieringHandler.ListRuns)
+			adminGroup.GET("/tiering/runs/:id", tieringHandler.GetRun)
+			adminGroup.POST("/tiering/runs/:id/undo", tieringHandler.UndoRun)
+			adminGroup.GET("/federation/remotes", federationHandler.ListRemotes)
+			adminGroup.POST("/federation/remotes", federationHandler.CreateRemote)
+			adminGroup.PUT("/federation/remotes/:id", federationHandler.UpdateRemote)
+			adminGroup.DELETE("/federation/remotes/:id", federationHandler.DeleteRemote)
+			adminGroup.POST("/federation/remotes/:id/sync", federationHandler.SyncRemote)
+			adminGroup.GET("/replication/rules", replicationHandler.ListRules)
+			adminGroup.POST("/replication/rules", replicationHandler.CreateRule)
+			adminGroup.PUT("/replication/rules/:id", replicationHandler.UpdateRule)
+			adminGroup.DELETE("/replication/rules/:id", replicationHandler.DeleteRule)
+			adminGroup.POST("/replication/rules/:id/run", replicationHandler.RunRule)
+			adminGroup.GET("/replication/rules/:id/items", replicationHandler.ListItems)
+			adminGroup.GET("/prefetch/stats", prefetchHandler.GetStats)
+			adminGroup.GET("/prefetch/entries", prefetchHandler.ListEntries)
+			adminGroup.DELETE("/prefetch/entries", prefetchHandler.ClearCache)
+			adminGroup.DELETE("/prefetch/entries/:file_id", prefetchHandler.EvictEntry)
+		}
+
 		// Challenge endpoints
 		challengeGroup := api.Group("/challenges")
 		{
@@ -874,61 +2164,122 @@ func main() {
 
 	logger.Info("Selected HTTP port", zap.Int("port", port))
 
-	// Create HTTP server
+	// Count connections and requests per protocol (HTTP/1.1, h2, h2c, h3)
+	connTracker := metrics.NewConnectionTracker()
+	handler := connTracker.Handler(router)
+
+	// Without HTTPS configured, serve a self-signed certificate (cached
+	// across restarts) on port 8443
+	var tlsConfig *tls.Config
+	httpsPort := 8443
+	if httpsManager != nil {
+		tlsConfig = httpsManager.TLSConfig()
+		httpsPort = httpsManager.Config().Port
+	} else if cert, err := getOrCreateSelfSignedCert(); err != nil {
+		logger.Error("Failed to get TLS certificate for HTTPS", zap.Error(err))
+	} else {
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h3", "h2", "http/1.1"},
+		}
+	}
+
+	if tlsConfig != nil && cfg.Server.EnableHTTP3 {
+		// Advertise HTTP/3 on every response. The router is wrapped
+		// because middleware added after the routes would never run.
+		altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, httpsPort)
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Alt-Svc", altSvc)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	// Create HTTP server, accepting cleartext HTTP/2 (h2c) with prior
+	// knowledge alongside HTTP/1.1 when enabled
 	srv := &http.Server{
 		Addr:         addr,
-		Handler:      router,
+		Handler:      handler,
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout) * time.Second,
+		Protocols:    serverProtocols(false, cfg.Server.EnableH2C),
+		ConnContext:  connTracker.ConnContext,
+		ConnState:    connTracker.ConnState,
 	}
-	// HTTPS server for TLS and HTTP/2 (future HTTP/3)
+	// HTTPS server for TLS and HTTP/2, HTTP/3 server over QUIC
 	var httpsServer *http.Server
 	var http3Server *http3.Server
+	var redirectServer *http.Server
 
-	// Load or generate TLS certificate for HTTP/3 (cached across restarts)
-	cert, err := getOrCreateSelfSignedCert()
-	if err != nil {
-		logger.Error("Failed to get TLS certificate for HTTP/3", zap.Error(err))
-	} else {
-		// Create TLS config with the certificate
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			NextProtos:   []string{"h3", "h2", "http/1.1"},
-		}
-
-		// Start HTTPS server on port 8443 (HTTP/2 with TLS, fallback for HTTP/3)
-		httpsAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, 8443)
+	if tlsConfig != nil {
+		// Start HTTPS server (HTTP/1.1, and HTTP/2 when enabled)
+		httpsAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, httpsPort)
 		httpsServer = &http.Server{
-			Addr:      httpsAddr,
-			Handler:   router,
-			TLSConfig: tlsConfig,
+			Addr:        httpsAddr,
+			Handler:     handler,
+			TLSConfig:   tcpTLSConfig(tlsConfig, cfg.Server.EnableHTTP2),
+			Protocols:   serverProtocols(cfg.Server.EnableHTTP2, false),
+			ConnContext: connTracker.ConnContext,
+			ConnState:   connTracker.ConnState,
+		}
+		listeners, err := services.ListenDualStack(cfg.Server.Host, httpsPort)
+		if err != nil {
+			logger.Error("HTTPS server failed", zap.String("address", httpsAddr), zap.Error(err))
 		}
-		go func() {
-			logger.Info("Starting HTTPS server (HTTP/2 with TLS)", zap.String("address", httpsAddr))
-			if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-				logger.Error("HTTPS server failed", zap.Error(err))
+		for _, listener := range listeners {
+			go func(listener net.Listener) {
+				logger.Info("Starting HTTPS server",
+					zap.String("address", listener.Addr().String()),
+					zap.Bool("http2", cfg.Server.EnableHTTP2))
+				if err := httpsServer.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
+					logger.Error("HTTPS server failed", zap.Error(err))
+				}
+			}(listener)
+		}
+
+		if cfg.Server.EnableHTTP3 {
+			// Start experimental HTTP/3 server on the HTTPS port over UDP
+			http3Server = &http3.Server{
+				Addr:      httpsAddr,
+				Handler:   handler,
+				TLSConfig: tlsConfig,
+				ConnContext: func(ctx context.Context, c *quic.Conn) context.Context {
+					connTracker.TrackConnection(c.Context(), metrics.ProtocolHTTP3)
+					return ctx
+				},
 			}
-		}()
+			go func() {
+				logger.Info("Starting HTTP/3 (QUIC) server", zap.String("address", httpsAddr))
+				if err := http3Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("HTTP/3 server failed", zap.Error(err))
+				}
+			}()
+		}
+	}
 
-		// Add Alt-Svc header to advertise HTTP/3 support
-		router.Use(func(c *gin.Context) {
-			c.Header("Alt-Svc", `h3=":8443"; ma=86400`)
-			c.Next()
-		})
+	if httpsManager != nil {
+		// Issue or renew DNS-01 certificates in the background
+		httpsManager.Start()
 
-		// Start HTTP/3 server on UDP port 8443
-		http3Server = &http3.Server{
-			Addr:      httpsAddr,
-			Handler:   router,
-			TLSConfig: tlsConfig,
-		}
-		go func() {
-			logger.Info("Starting HTTP/3 (QUIC) server", zap.String("address", httpsAddr))
-			if err := http3Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				logger.Error("HTTP/3 server failed", zap.Error(err))
+		if httpsManager.Config().RedirectHTTP {
+			redirectServer = &http.Server{
+				Handler:           httpsManager.RedirectHandler(),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			listeners, err := services.ListenDualStack(cfg.Server.Host, httpsManager.Config().RedirectPort)
+			if err != nil {
+				logger.Error("HTTP redirect server failed", zap.Int("port", httpsManager.Config().RedirectPort), zap.Error(err))
+			}
+			for _, listener := range listeners {
+				go func(listener net.Listener) {
+					logger.Info("Starting HTTP to HTTPS redirect server", zap.String("address", listener.Addr().String()))
+					if err := redirectServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+						logger.Error("HTTP redirect server failed", zap.Error(err))
+					}
+				}(listener)
 			}
-		}()
+		}
 	}
 
 	// Start server in a goroutine
@@ -953,6 +2304,68 @@ func main() {
 	// Stop runtime metrics collector
 	metrics.StopRuntimeCollector()
 
+	// Stop polling cold storage recalls
+	coldStorageService.Stop()
+
+	// Stop the tiering schedule, letting in-flight moves finish
+	tieringService.Stop()
+
+	// Stop purging the recycle bin
+	recycleBinService.Stop()
+
+	// Stop starting scheduled syncs
+	syncService.StopScheduler()
+
+	// Stop syncing accounts with the directory
+	authService.StopLDAPSync()
+
+	// Stop discarding expired uploads
+	uploadService.Stop()
+
+	// Stop rolling up and purging analytics
+	analyticsRetentionService.Stop()
+	anomalyDetector.Stop()
+
+	// Abort a runbook run, leaving read-only mode if it entered it
+	runbookService.Stop()
+
+	// Let a maintenance run finish so the database is not left mid-vacuum
+	maintenanceService.Stop()
+
+	// Let a backup being written finish
+	backupService.Stop()
+
+	// Stop recording library health and cancel enrichment it started
+	libraryHealthService.Stop()
+
+	// Interrupt a metadata refresh; it is marked failed and can be rerun
+	metadataRefreshService.Stop()
+
+	// Cancel replication runs; partly copied files are fetched again
+	replicationService.Stop()
+
+	// Stop mirroring remote libraries
+	federationService.Stop()
+
+	// Stop the scan schedule and cancel scans in progress
+	scannerService.Stop()
+
+	// Interrupt running conversions; they are requeued for the next start
+	conversionService.StopWorkers()
+
+	// Stop periodic telemetry reports
+	telemetryService.Stop()
+
+	// Stop re-probing dependencies and storage roots
+	dependencyMonitor.Stop()
+	storageBreakers.Stop()
+
+	// Stop prefetching, letting the copy in progress finish
+	prefetchService.Stop()
+
+	// Stop rendering watermarked share link copies
+	shareLinkService.Stop()
+
 	// Stop WebSocket handler (closes all client connections, stops cleanup goroutine)
 	wsHandler.Stop()
 
@@ -964,6 +2377,16 @@ func main() {
 		logger.Error("HTTP server shutdown error", zap.Error(err))
 	}
 
+	// Shutdown the HTTP to HTTPS redirect server and certificate renewal
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("HTTP redirect server shutdown error", zap.Error(err))
+		}
+	}
+	if httpsManager != nil {
+		httpsManager.Stop()
+	}
+
 	// Shutdown HTTPS server if started
 	if httpsServer != nil {
 		if err := httpsServer.Shutdown(shutdownCtx); err != nil {
@@ -1007,7 +2430,8 @@ func main() {
 }
 
 // seedDefaultAdmin creates a default admin user if none exists in the database.
-// Uses the same password hashing scheme as services.AuthService (bcrypt(password + salt)).
+// The password is hashed with the default argon2id parameters; the first
+// sign-in rehashes it if an administrator has configured others.
 func seedDefaultAdmin(db *database.DB, username, password string) error {
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE role_id = 1").Scan(&count)
@@ -1018,23 +2442,15 @@ func seedDefaultAdmin(db *database.DB, username, password string) error {
 		return nil // admin already exists
 	}
 
-	// Generate salt
-	saltBytes := make([]byte, 16)
-	if _, err := rand.Read(saltBytes); err != nil {
-		return fmt.Errorf("generate salt: %w", err)
-	}
-	salt := hex.EncodeToString(saltBytes)
-
-	// Hash password with salt (same as services.AuthService.hashPassword)
-	hash, err := bcryptHash([]byte(password + salt))
+	hash, err := root_services.NewPasswordHasher(root_services.DefaultPasswordHashParams).Hash(password)
 	if err != nil {
 		return fmt.Errorf("hash password: %w", err)
 	}
 
 	_, err = db.Exec(
 		`INSERT INTO users (username, email, password_hash, salt, role_id, first_name, last_name, display_name, is_active)
-		 VALUES (?, ?, ?, ?, 1, 'System', 'Administrator', 'Admin', ?)`,
-		username, username+"@catalogizer.local", string(hash), salt, 1,
+		 VALUES (?, ?, ?, '', 1, 'System', 'Administrator', 'Admin', ?)`,
+		username, username+"@catalogizer.local", hash, 1,
 	)
 	if err != nil {
 		return fmt.Errorf("insert admin user: %w", err)
@@ -1043,8 +2459,3 @@ func seedDefaultAdmin(db *database.DB, username, password string) error {
 	log.Printf("Default admin user '%s' created", username)
 	return nil
 }
-
-// bcryptHash wraps bcrypt.GenerateFromPassword.
-func bcryptHash(data []byte) ([]byte, error) {
-	return bcrypt.GenerateFromPassword(data, bcrypt.DefaultCost)
-}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"net/http"
@@ -290,3 +291,23 @@ func (suite *MainTestSuite) TestMiddleware() {
 func TestMainTestSuite(t *testing.T) {
 	suite.Run(t, new(MainTestSuite))
 }
+
+func TestServerProtocols(t *testing.T) {
+	protocols := serverProtocols(true, false)
+	assert.True(t, protocols.HTTP1())
+	assert.True(t, protocols.HTTP2())
+	assert.False(t, protocols.UnencryptedHTTP2())
+
+	protocols = serverProtocols(false, true)
+	assert.True(t, protocols.HTTP1())
+	assert.False(t, protocols.HTTP2())
+	assert.True(t, protocols.UnencryptedHTTP2())
+}
+
+func TestTCPTLSConfig(t *testing.T) {
+	base := &tls.Config{NextProtos: []string{"h3", "h2", "http/1.1", "acme-tls/1"}}
+
+	assert.Equal(t, []string{"h2", "http/1.1", "acme-tls/1"}, tcpTLSConfig(base, true).NextProtos)
+	assert.Equal(t, []string{"http/1.1", "acme-tls/1"}, tcpTLSConfig(base, false).NextProtos)
+	assert.Equal(t, []string{"h3", "h2", "http/1.1", "acme-tls/1"}, base.NextProtos)
+}
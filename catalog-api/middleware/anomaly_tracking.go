@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anomalyRecorder receives the request metrics watched for anomalies.
+type anomalyRecorder interface {
+	Record(metric string, value float64)
+	RecordRequest(status int)
+}
+
+// AnomalyTracking feeds API traffic to anomaly detection: the status of
+// every /api/v1/ request towards the server error rate, and the bytes sent
+// by successful ones towards bytes_downloaded. File downloads and streams
+// make up nearly all of those bytes.
+func AnomalyTracking(recorder anomalyRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if !strings.HasPrefix(c.Request.URL.Path, "/api/v1/") {
+			return
+		}
+		status := c.Writer.Status()
+		recorder.RecordRequest(status)
+		if status < 300 && c.Writer.Size() > 0 {
+			recorder.Record("bytes_downloaded", float64(c.Writer.Size()))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAnomalyRecorder struct {
+	statuses []int
+	totals   map[string]float64
+}
+
+func (f *fakeAnomalyRecorder) Record(metric string, value float64) {
+	f.totals[metric] += value
+}
+
+func (f *fakeAnomalyRecorder) RecordRequest(status int) {
+	f.statuses = append(f.statuses, status)
+}
+
+func TestAnomalyTracking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := &fakeAnomalyRecorder{totals: map[string]float64{}}
+	r := gin.New()
+	r.Use(AnomalyTracking(recorder))
+	body := strings.Repeat("x", 1000)
+	r.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, body) })
+	r.GET("/api/v1/download/file/:id", func(c *gin.Context) {
+		if c.Param("id") == "missing" {
+			c.String(http.StatusNotFound, body)
+			return
+		}
+		c.String(http.StatusOK, body)
+	})
+	r.GET("/api/v1/media", func(c *gin.Context) { c.String(http.StatusInternalServerError, body) })
+
+	for _, path := range []string{"/health", "/api/v1/download/file/1", "/api/v1/download/file/missing", "/api/v1/media"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusNotFound, http.StatusInternalServerError}, recorder.statuses)
+	assert.Equal(t, 1000.0, recorder.totals["bytes_downloaded"])
+}
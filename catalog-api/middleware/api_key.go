@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"catalogizer/models"
+	"catalogizer/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries an API key in place of a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyAuthenticated marks requests authenticated by APIKeyMiddleware,
+// which JWTMiddleware then lets through
+const apiKeyAuthenticated = "api_key_authenticated"
+
+// APIKeyMiddleware authenticates scripts and integrations by API key
+type APIKeyMiddleware struct {
+	authenticate func(key string) (*models.User, error)
+}
+
+// NewAPIKeyMiddleware creates a new API key middleware; authenticate
+// returns the user a key acts for
+func NewAPIKeyMiddleware(authenticate func(key string) (*models.User, error)) *APIKeyMiddleware {
+	return &APIKeyMiddleware{authenticate: authenticate}
+}
+
+// Authenticate returns a middleware that accepts requests with a valid
+// X-API-Key header. Requests without one are passed on unchanged, for
+// JWTMiddleware.RequireAuth to check.
+func (m *APIKeyMiddleware) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		user, err := m.authenticate(key)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "Invalid API key", err)
+			c.Abort()
+			return
+		}
+
+		c.Set("username", user.Username)
+		c.Set("user_id", strconv.Itoa(user.ID))
+		c.Set(apiKeyAuthenticated, true)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAPIKeyRouter() *gin.Engine {
+	keys := NewAPIKeyMiddleware(func(key string) (*models.User, error) {
+		if key != "ctlg_valid" {
+			return nil, errors.New("invalid API key")
+		}
+		return &models.User{ID: 7, Username: "script"}, nil
+	})
+
+	router := gin.New()
+	router.GET("/protected", keys.Authenticate(), setupJWTMiddleware().RequireAuth(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id"), "username": c.GetString("username")})
+	})
+	return router
+}
+
+// TestAPIKeyMiddleware_ValidKey verifies that a valid key stands in for a JWT.
+func TestAPIKeyMiddleware_ValidKey(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set(APIKeyHeader, "ctlg_valid")
+	setupAPIKeyRouter().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "7", body["user_id"])
+	assert.Equal(t, "script", body["username"])
+}
+
+// TestAPIKeyMiddleware_InvalidKey verifies 401 for unknown keys, even
+// alongside a valid JWT.
+func TestAPIKeyMiddleware_InvalidKey(t *testing.T) {
+	token, err := setupJWTMiddleware().GenerateToken("user", "1", 1)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set(APIKeyHeader, "ctlg_revoked")
+	req.Header.Set("Authorization", "Bearer "+token)
+	setupAPIKeyRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid API key")
+}
+
+// TestAPIKeyMiddleware_FallsBackToJWT verifies requests without a key are
+// left to the JWT middleware.
+func TestAPIKeyMiddleware_FallsBackToJWT(t *testing.T) {
+	router := setupAPIKeyRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Authorization header required")
+
+	token, err := setupJWTMiddleware().GenerateToken("user", "1", 1)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
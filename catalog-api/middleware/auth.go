@@ -13,12 +13,14 @@ import (
 
 // JWTMiddleware handles JWT authentication
 type JWTMiddleware struct {
-	secretKey []byte
+	secretKey       []byte
+	validateSession func(sessionID string) error
 }
 
 // Claims represents JWT claims
 type Claims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	SessionID string `json:"session_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -29,9 +31,22 @@ func NewJWTMiddleware(secretKey string) *JWTMiddleware {
 	}
 }
 
-// RequireAuth returns a middleware that requires valid JWT authentication
+// SetSessionValidator makes RequireAuth reject tokens whose session has
+// been revoked, as reported by validate. Tokens carrying no session are not
+// checked.
+func (m *JWTMiddleware) SetSessionValidator(validate func(sessionID string) error) {
+	m.validateSession = validate
+}
+
+// RequireAuth returns a middleware that requires valid JWT authentication,
+// unless an APIKeyMiddleware before it has authenticated the request
 func (m *JWTMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if c.GetBool(apiKeyAuthenticated) {
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			utils.SendErrorResponse(c, http.StatusUnauthorized, "Authorization header required", nil)
@@ -67,9 +82,18 @@ func (m *JWTMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
+		if m.validateSession != nil && claims.SessionID != "" {
+			if err := m.validateSession(claims.SessionID); err != nil {
+				utils.SendErrorResponse(c, http.StatusUnauthorized, "Session is no longer active", err)
+				c.Abort()
+				return
+			}
+		}
+
 		// Set user info in context
 		c.Set("username", claims.Username)
 		c.Set("user_id", claims.Subject)
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
 	}
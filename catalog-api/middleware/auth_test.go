@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -246,6 +247,53 @@ func TestRequireAuth_ValidToken_SetsContext(t *testing.T) {
 	assert.Equal(t, "99", body["user_id"])
 }
 
+// TestRequireAuth_RevokedSession verifies that tokens of revoked sessions are rejected.
+func TestRequireAuth_RevokedSession(t *testing.T) {
+	mw := setupJWTMiddleware()
+	mw.SetSessionValidator(func(sessionID string) error {
+		if sessionID == "7" {
+			return errors.New("session has been revoked")
+		}
+		return nil
+	})
+
+	router := gin.New()
+	router.GET("/protected", mw.RequireAuth(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"session_id": c.GetString("session_id")})
+	})
+
+	sessionToken := func(sessionID string) string {
+		claims := &Claims{
+			Username:  "carol",
+			SessionID: sessionID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "5",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		require.NoError(t, err)
+		return token
+	}
+
+	for sessionID, want := range map[string]int{"7": http.StatusUnauthorized, "8": http.StatusOK} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+sessionToken(sessionID))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, sessionID)
+	}
+
+	// Tokens without a session are not checked
+	token, err := mw.GenerateToken("carol", "5", 1)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
 // TestRequireAuth_ProtectedAndPublicRoutes verifies that protected and public routes coexist correctly.
 func TestRequireAuth_ProtectedAndPublicRoutes(t *testing.T) {
 	mw := setupJWTMiddleware()
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheControlRevalidate lets clients keep a response but makes them ask
+// whether it changed, with If-None-Match or If-Modified-Since, before
+// using it again. It suits responses that differ per user and change
+// without notice, such as catalog listings.
+const CacheControlRevalidate = "private, no-cache"
+
+// Validator reports the version of the resource a request is for without
+// loading it: an opaque tag that changes whenever the resource does, and
+// when it last changed. ok is false when the version cannot be told, and
+// the request is served without validators.
+type Validator func(c *gin.Context) (tag string, modified time.Time, ok bool)
+
+// WeakETag returns a weak entity tag derived from parts.
+func WeakETag(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified sets the ETag, Last-Modified and Cache-Control headers of a
+// response to a GET or HEAD request. When the request's If-None-Match, or
+// failing that its If-Modified-Since, shows the client has this version,
+// it responds 304 Not Modified and returns true. A zero modified time
+// omits Last-Modified.
+func NotModified(c *gin.Context, etag string, modified time.Time, cacheControl string) bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	c.Header("ETag", etag)
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if cacheControl != "" {
+		c.Header("Cache-Control", cacheControl)
+	}
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if !etagListMatches(match, etag) {
+			return false
+		}
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err != nil || modified.IsZero() ||
+		modified.Truncate(time.Second).After(since) {
+		return false
+	}
+	c.AbortWithStatus(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches reports whether an If-None-Match header names etag,
+// comparing weakly as RFC 9110 requires for GET.
+func etagListMatches(header, etag string) bool {
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// ConditionalRequests answers GET requests with 304 Not Modified when the
+// client already has the version the validator reports, before the
+// handler or a response cache does any work. Otherwise the response
+// carries a weak ETag, Last-Modified and cacheControl, which are dropped
+// again if the handler does not respond 200. The ETag also covers the
+// user and the query, so clients never revalidate against another user's
+// listing or page.
+func ConditionalRequests(validator Validator, cacheControl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		tag, modified, ok := validator(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+		etag := WeakETag(tag, fmt.Sprint(userID), c.Request.URL.Path, c.Request.URL.Query().Encode())
+		if NotModified(c, etag, modified, cacheControl) {
+			return
+		}
+		c.Writer = &validatedResponseWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
+
+// validatedResponseWriter removes the validators ConditionalRequests set
+// from responses other than 200, so clients do not revalidate errors.
+type validatedResponseWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *validatedResponseWriter) WriteHeader(code int) {
+	if code != http.StatusOK {
+		for _, header := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+			w.Header().Del(header)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
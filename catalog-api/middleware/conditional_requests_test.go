@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newConditionalRouter serves a listing whose version is version, counting
+// how often its handler runs, and a listing that fails.
+func newConditionalRouter(version *string, modified time.Time, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		c.Next()
+	})
+	validator := func(c *gin.Context) (string, time.Time, bool) {
+		if c.Param("path") == "/unknown" {
+			return "", time.Time{}, false
+		}
+		return *version, modified, true
+	}
+	router.GET("/catalog/*path", ConditionalRequests(validator, CacheControlRevalidate), func(c *gin.Context) {
+		*calls++
+		if c.Param("path") == "/broken" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database locked"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"files": []string{"a.mkv"}})
+	})
+	return router
+}
+
+func conditionalRequest(router *gin.Engine, target, user string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("X-User", user)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestConditionalRequests_IfNoneMatch(t *testing.T) {
+	version, calls := "3-17", 0
+	modified := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	router := newConditionalRouter(&version, modified, &calls)
+
+	w := conditionalRequest(router, "/catalog/movies?limit=10", "1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	etag := w.Header().Get("ETag")
+	if len(etag) < 4 || etag[:3] != `W/"` {
+		t.Fatalf("expected a weak ETag, got %q", etag)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Fri, 16 Oct 2026 10:00:00 GMT" {
+		t.Errorf("unexpected Last-Modified %q", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != CacheControlRevalidate {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+
+	w = conditionalRequest(router, "/catalog/movies?limit=10", "1", map[string]string{"If-None-Match": `"other", ` + etag})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected an empty body, got %q", w.Body.String())
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("expected the ETag on 304 responses")
+	}
+	if calls != 1 {
+		t.Errorf("expected the handler to be skipped, ran %d times", calls)
+	}
+
+	// Another user, another page or a changed listing do not match
+	for _, tc := range []struct{ target, user string }{
+		{"/catalog/movies?limit=10", "2"},
+		{"/catalog/movies?limit=20", "1"},
+	} {
+		w = conditionalRequest(router, tc.target, tc.user, map[string]string{"If-None-Match": etag})
+		if w.Code != http.StatusOK {
+			t.Errorf("%s as user %s: expected status 200, got %d", tc.target, tc.user, w.Code)
+		}
+	}
+	version = "4-18"
+	w = conditionalRequest(router, "/catalog/movies?limit=10", "1", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a full response with a new ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestConditionalRequests_IfModifiedSince(t *testing.T) {
+	version, calls := "3-17", 0
+	modified := time.Date(2026, 10, 16, 10, 0, 0, 500, time.UTC)
+	router := newConditionalRouter(&version, modified, &calls)
+
+	w := conditionalRequest(router, "/catalog/movies", "1", map[string]string{"If-Modified-Since": "Fri, 16 Oct 2026 10:00:00 GMT"})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected status 304, got %d", w.Code)
+	}
+	w = conditionalRequest(router, "/catalog/movies", "1", map[string]string{"If-Modified-Since": "Fri, 16 Oct 2026 09:59:59 GMT"})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	// If-None-Match takes precedence
+	w = conditionalRequest(router, "/catalog/movies", "1", map[string]string{
+		"If-None-Match": `W/"stale"`, "If-Modified-Since": "Fri, 16 Oct 2026 10:00:00 GMT",
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+}
+
+func TestConditionalRequests_WithoutValidators(t *testing.T) {
+	version, calls := "3-17", 0
+	router := newConditionalRouter(&version, time.Time{}, &calls)
+
+	w := conditionalRequest(router, "/catalog/broken", "1", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", w.Code)
+	}
+	for _, header := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+		if got := w.Header().Get(header); got != "" {
+			t.Errorf("expected no %s on errors, got %q", header, got)
+		}
+	}
+
+	w = conditionalRequest(router, "/catalog/unknown", "1", map[string]string{"If-None-Match": "*"})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("expected a full response without ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	w = conditionalRequest(router, "/catalog/movies", "1", map[string]string{"If-Modified-Since": "Fri, 16 Oct 2026 10:00:00 GMT"})
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != "" {
+		t.Errorf("expected no Last-Modified without a modification time, got %d %q", w.Code, w.Header().Get("Last-Modified"))
+	}
+}
@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCORSOrigins = "http://localhost:5173,http://localhost:3000"
+	defaultCORSMethods = "POST, OPTIONS, GET, PUT, DELETE"
+	defaultCORSHeaders = "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With"
+)
+
+var corsMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// corsPolicy is a validated CORS policy with its headers prepared.
+type corsPolicy struct {
+	origins     map[string]bool
+	anyOrigin   bool
+	credentials bool
+	methods     string
+	headers     string
+	maxAge      string
+}
+
+// corsRoute applies a policy to the requests under a path prefix.
+type corsRoute struct {
+	prefix string
+	policy *corsPolicy
+}
+
+type corsPolicySet struct {
+	fallback *corsPolicy
+	routes   []corsRoute // longest prefix first
+}
+
+// CORSPolicies applies network.cors to each request: the route policy
+// with the longest matching path prefix, or the default policy. Reload
+// swaps the policies of a running server.
+type CORSPolicies struct {
+	current atomic.Pointer[corsPolicySet]
+}
+
+// NewCORSPolicies compiles a CORS configuration. A nil configuration is
+// the built-in default policy.
+func NewCORSPolicies(config *models.CORSConfig) (*CORSPolicies, error) {
+	set, err := compileCORSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	p := &CORSPolicies{}
+	p.current.Store(set)
+	return p, nil
+}
+
+// Reload replaces the policies. An invalid configuration leaves the
+// current policies in place.
+func (p *CORSPolicies) Reload(config *models.CORSConfig) error {
+	set, err := compileCORSConfig(config)
+	if err != nil {
+		return err
+	}
+	p.current.Store(set)
+	return nil
+}
+
+// ValidateCORSConfig reports whether a CORS configuration can be applied.
+func ValidateCORSConfig(config *models.CORSConfig) error {
+	_, err := compileCORSConfig(config)
+	return err
+}
+
+// CORS handles Cross-Origin Resource Sharing with the built-in default
+// policy
+func CORS() gin.HandlerFunc {
+	// The built-in policy always compiles
+	policies, _ := NewCORSPolicies(nil)
+	return policies.Handler()
+}
+
+// Handler returns the middleware applying the current policies.
+func (p *CORSPolicies) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.current.Load().match(c.Request.URL.Path).apply(c)
+	}
+}
+
+func (s *corsPolicySet) match(path string) *corsPolicy {
+	for _, route := range s.routes {
+		if path == route.prefix || strings.HasPrefix(path, route.prefix+"/") {
+			return route.policy
+		}
+	}
+	return s.fallback
+}
+
+func (p *corsPolicy) apply(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if origin != "" {
+		switch {
+		case p.anyOrigin:
+			c.Header("Access-Control-Allow-Origin", "*")
+		case p.origins[origin]:
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+			if p.credentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		}
+	}
+	c.Header("Access-Control-Allow-Headers", p.headers)
+	c.Header("Access-Control-Allow-Methods", p.methods)
+
+	if c.Request.Method == http.MethodOptions {
+		if p.maxAge != "" {
+			c.Header("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	c.Next()
+}
+
+func compileCORSConfig(config *models.CORSConfig) (*corsPolicySet, error) {
+	if config == nil {
+		config = &models.CORSConfig{}
+	}
+
+	defaults := models.CORSPolicy{
+		Name:             "default",
+		AllowedOrigins:   config.AllowedOrigins,
+		AllowedMethods:   config.AllowedMethods,
+		AllowedHeaders:   config.AllowedHeaders,
+		AllowCredentials: config.AllowCredentials,
+		MaxAgeSeconds:    config.MaxAgeSeconds,
+	}
+	var builtin []string
+	if len(defaults.AllowedOrigins) == 0 {
+		origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+		if origins == "" {
+			origins = defaultCORSOrigins
+		}
+		builtin = strings.Split(origins, ",")
+		defaults.AllowCredentials = true
+	}
+	fallback, err := compileCORSPolicy(defaults)
+	if err != nil {
+		return nil, err
+	}
+	// The default policy covers login and administration, so it has to
+	// name its origins
+	if fallback.anyOrigin {
+		return nil, fmt.Errorf("cors: the default policy cannot allow any origin; list its origins or move the routes to a policy")
+	}
+	// Built-in origins are matched exactly as they always were
+	for _, origin := range builtin {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			fallback.origins[origin] = true
+		}
+	}
+
+	set := &corsPolicySet{fallback: fallback}
+	names := make(map[string]bool)
+	prefixes := make(map[string]string)
+	for _, policy := range config.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("cors: every policy needs a name")
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("cors: duplicate policy %q", policy.Name)
+		}
+		names[policy.Name] = true
+		if len(policy.AllowedOrigins) == 0 {
+			return nil, fmt.Errorf("cors policy %q: allowed_origins is required", policy.Name)
+		}
+		if len(policy.PathPrefixes) == 0 {
+			return nil, fmt.Errorf("cors policy %q: path_prefixes is required", policy.Name)
+		}
+
+		compiled, err := compileCORSPolicy(policy)
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range policy.PathPrefixes {
+			prefix = strings.TrimRight(strings.TrimSpace(prefix), "/")
+			if !strings.HasPrefix(prefix, "/") {
+				return nil, fmt.Errorf("cors policy %q: path prefix %q must start with / below the root", policy.Name, prefix)
+			}
+			if other, ok := prefixes[prefix]; ok {
+				return nil, fmt.Errorf("cors policy %q: path prefix %s is already used by %q", policy.Name, prefix, other)
+			}
+			prefixes[prefix] = policy.Name
+			set.routes = append(set.routes, corsRoute{prefix: prefix, policy: compiled})
+		}
+	}
+	sort.SliceStable(set.routes, func(i, j int) bool {
+		return len(set.routes[i].prefix) > len(set.routes[j].prefix)
+	})
+	return set, nil
+}
+
+func compileCORSPolicy(policy models.CORSPolicy) (*corsPolicy, error) {
+	compiled := &corsPolicy{
+		origins:     make(map[string]bool),
+		credentials: policy.AllowCredentials,
+		methods:     defaultCORSMethods,
+		headers:     defaultCORSHeaders,
+	}
+
+	for _, origin := range policy.AllowedOrigins {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" {
+			compiled.anyOrigin = true
+			continue
+		}
+		if err := validateCORSOrigin(origin); err != nil {
+			return nil, fmt.Errorf("cors policy %q: %w", policy.Name, err)
+		}
+		compiled.origins[origin] = true
+	}
+	if compiled.anyOrigin && compiled.credentials {
+		return nil, fmt.Errorf("cors policy %q: allow_credentials cannot be combined with the * origin", policy.Name)
+	}
+
+	if len(policy.AllowedMethods) > 0 {
+		methods := make([]string, 0, len(policy.AllowedMethods))
+		for _, method := range policy.AllowedMethods {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if !slices.Contains(corsMethods, method) {
+				return nil, fmt.Errorf("cors policy %q: unsupported method %q", policy.Name, method)
+			}
+			methods = append(methods, method)
+		}
+		compiled.methods = strings.Join(methods, ", ")
+	}
+	if len(policy.AllowedHeaders) > 0 {
+		headers := make([]string, 0, len(policy.AllowedHeaders))
+		for _, header := range policy.AllowedHeaders {
+			header = strings.TrimSpace(header)
+			if header == "" || strings.ContainsAny(header, " ,;:\t") {
+				return nil, fmt.Errorf("cors policy %q: invalid header name %q", policy.Name, header)
+			}
+			headers = append(headers, header)
+		}
+		compiled.headers = strings.Join(headers, ", ")
+	}
+
+	if policy.MaxAgeSeconds < 0 {
+		return nil, fmt.Errorf("cors policy %q: max_age_seconds cannot be negative", policy.Name)
+	}
+	if policy.MaxAgeSeconds > 0 {
+		compiled.maxAge = strconv.Itoa(policy.MaxAgeSeconds)
+	}
+	return compiled, nil
+}
+
+// validateCORSOrigin accepts an origin as browsers send it: a scheme and
+// host with an optional port, and nothing else.
+func validateCORSOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("invalid origin %q: use scheme://host[:port]", origin)
+	}
+	return nil
+}
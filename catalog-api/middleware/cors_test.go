@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"catalogizer/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCORSConfig() *models.CORSConfig {
+	return &models.CORSConfig{
+		AllowedOrigins:   []string{"https://media.example.com"},
+		AllowCredentials: true,
+		Policies: []models.CORSPolicy{
+			{
+				Name:           "public-shares",
+				PathPrefixes:   []string{"/api/v1/shared/"},
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"get", "HEAD", "OPTIONS"},
+				MaxAgeSeconds:  600,
+			},
+			{
+				Name:             "admin",
+				PathPrefixes:     []string{"/api/v1/admin", "/api/v1/configuration"},
+				AllowedOrigins:   []string{"https://admin.example.com"},
+				AllowCredentials: true,
+			},
+		},
+	}
+}
+
+func TestCORSPolicies_Routes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policies, err := NewCORSPolicies(testCORSConfig())
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(policies.Handler())
+	router.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		allowOrigin string
+		credentials string
+		methods     string
+		maxAge      string
+	}{
+		{"default policy", http.MethodGet, "/api/v1/media", "https://media.example.com", "https://media.example.com", "true", defaultCORSMethods, ""},
+		{"default rejects", http.MethodGet, "/api/v1/media", "https://admin.example.com", "", "", defaultCORSMethods, ""},
+		{"public share", http.MethodGet, "/api/v1/shared/abc123", "https://blog.example.org", "*", "", "GET, HEAD, OPTIONS", ""},
+		{"public share preflight", http.MethodOptions, "/api/v1/shared/abc123", "https://blog.example.org", "*", "", "GET, HEAD, OPTIONS", "600"},
+		{"admin", http.MethodPost, "/api/v1/admin/backup", "https://admin.example.com", "https://admin.example.com", "true", defaultCORSMethods, ""},
+		{"admin rejects app origin", http.MethodPost, "/api/v1/configuration/cors", "https://media.example.com", "", "", defaultCORSMethods, ""},
+		{"prefix matches whole segments", http.MethodGet, "/api/v1/administrators", "https://media.example.com", "https://media.example.com", "true", defaultCORSMethods, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.credentials, w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, tt.methods, w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tt.maxAge, w.Header().Get("Access-Control-Max-Age"))
+			if tt.method == http.MethodOptions {
+				assert.Equal(t, http.StatusNoContent, w.Code)
+			}
+		})
+	}
+}
+
+func TestCORSPolicies_Reload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policies, err := NewCORSPolicies(nil)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(policies.Handler())
+	router.GET("/api/v1/shared/:token", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	allowOrigin := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/shared/abc123", nil)
+		req.Header.Set("Origin", "https://blog.example.org")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	assert.Empty(t, allowOrigin())
+
+	require.NoError(t, policies.Reload(testCORSConfig()))
+	assert.Equal(t, "*", allowOrigin())
+
+	// A rejected configuration keeps the running policies
+	assert.Error(t, policies.Reload(&models.CORSConfig{AllowedOrigins: []string{"*"}}))
+	assert.Equal(t, "*", allowOrigin())
+}
+
+func TestValidateCORSConfig(t *testing.T) {
+	policy := func(modify func(*models.CORSPolicy)) *models.CORSConfig {
+		p := models.CORSPolicy{Name: "shares", PathPrefixes: []string{"/api/v1/shared"}, AllowedOrigins: []string{"*"}}
+		modify(&p)
+		return &models.CORSConfig{Policies: []models.CORSPolicy{p}}
+	}
+
+	tests := []struct {
+		name    string
+		config  *models.CORSConfig
+		wantErr string
+	}{
+		{"nil", nil, ""},
+		{"valid", testCORSConfig(), ""},
+		{"wildcard default", &models.CORSConfig{AllowedOrigins: []string{"*"}}, "default policy cannot allow any origin"},
+		{"origin with path", &models.CORSConfig{AllowedOrigins: []string{"https://media.example.com/app"}}, "invalid origin"},
+		{"origin without scheme", &models.CORSConfig{AllowedOrigins: []string{"media.example.com"}}, "invalid origin"},
+		{"wildcard with credentials", policy(func(p *models.CORSPolicy) { p.AllowCredentials = true }), "allow_credentials cannot be combined"},
+		{"unnamed", policy(func(p *models.CORSPolicy) { p.Name = "" }), "needs a name"},
+		{"no prefixes", policy(func(p *models.CORSPolicy) { p.PathPrefixes = nil }), "path_prefixes is required"},
+		{"relative prefix", policy(func(p *models.CORSPolicy) { p.PathPrefixes = []string{"api/v1"} }), "must start with /"},
+		{"root prefix", policy(func(p *models.CORSPolicy) { p.PathPrefixes = []string{"/"} }), "must start with /"},
+		{"no origins", policy(func(p *models.CORSPolicy) { p.AllowedOrigins = nil }), "allowed_origins is required"},
+		{"bad method", policy(func(p *models.CORSPolicy) { p.AllowedMethods = []string{"TRACE"} }), "unsupported method"},
+		{"bad header", policy(func(p *models.CORSPolicy) { p.AllowedHeaders = []string{"X-A, X-B"} }), "invalid header name"},
+		{"negative max age", policy(func(p *models.CORSPolicy) { p.MaxAgeSeconds = -1 }), "cannot be negative"},
+		{"shared prefix", &models.CORSConfig{Policies: []models.CORSPolicy{
+			{Name: "a", PathPrefixes: []string{"/api/v1/shared"}, AllowedOrigins: []string{"*"}},
+			{Name: "b", PathPrefixes: []string{"/api/v1/shared/"}, AllowedOrigins: []string{"*"}},
+		}}, "already used by"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCORSConfig(tt.config)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -266,14 +266,17 @@ func InputValidation(config InputValidationConfig) gin.HandlerFunc {
 			return
 		}
 
-		// Add security headers
-		c.Header("X-Content-Type-Options", "nosniff")
-		c.Header("X-Frame-Options", "DENY")
-		c.Header("X-XSS-Protection", "1; mode=block")
-		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
-		c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self'; connect-src 'self'; frame-ancestors 'none'")
-		c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
-		c.Header("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+		// Add security headers, unless SecurityHeaders already chose them
+		// for this route
+		if _, handled := c.Get(securityHeadersKey); !handled {
+			c.Header("X-Content-Type-Options", "nosniff")
+			c.Header("X-Frame-Options", "DENY")
+			c.Header("X-XSS-Protection", "1; mode=block")
+			c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
+			c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self'; connect-src 'self'; frame-ancestors 'none'")
+			c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+			c.Header("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+		}
 
 		c.Next()
 	}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forwardingHeaders describe the original request when it passes through
+// a reverse proxy.
+var forwardingHeaders = []string{"X-Forwarded-For", "X-Real-IP", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"}
+
+// TrustedProxies is the set of reverse proxies (nginx, traefik, ...) whose
+// forwarding headers are believed. The zero value trusts nothing.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges.
+func ParseTrustedProxies(entries []string) (*TrustedProxies, error) {
+	proxies := &TrustedProxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			proxies.prefixes = append(proxies.prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		proxies.prefixes = append(proxies.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// Trusts reports whether addr belongs to a trusted proxy.
+func (p *TrustedProxies) Trusts(addr netip.Addr) bool {
+	if p == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr walks X-Forwarded-For back from the nearest hop to the first
+// address that is not a trusted proxy, falling back to X-Real-IP.
+func (p *TrustedProxies) clientAddr(header http.Header) (netip.Addr, bool) {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !p.Trusts(client) {
+			return client, true
+		}
+	}
+	if client.IsValid() {
+		return client, true
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+type forwardedContextKey struct{}
+
+// forwardedRequest is what a trusted proxy reported about the original
+// request.
+type forwardedRequest struct {
+	scheme string
+	host   string
+}
+
+// ForwardedHeaders resolves requests that reach the API through a trusted
+// reverse proxy. The client address from X-Forwarded-For or X-Real-IP
+// replaces RemoteAddr, so c.ClientIP, rate limiting and audit logs see the
+// client rather than the proxy, and X-Forwarded-Proto and X-Forwarded-Host
+// are kept for RequestBaseURL. Requests from any other peer have their
+// forwarding headers removed so they cannot be spoofed.
+//
+// Install it before other middleware and keep gin from reading the headers
+// itself with engine.SetTrustedProxies(nil).
+func ForwardedHeaders(proxies *TrustedProxies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := c.Request
+		remote, err := netip.ParseAddrPort(strings.TrimSpace(r.RemoteAddr))
+		if err != nil || !proxies.Trusts(remote.Addr()) {
+			for _, header := range forwardingHeaders {
+				r.Header.Del(header)
+			}
+			c.Next()
+			return
+		}
+
+		if client, ok := proxies.clientAddr(r.Header); ok {
+			r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+		}
+		forwarded := forwardedRequest{host: firstHeaderValue(r.Header, "X-Forwarded-Host")}
+		switch scheme := strings.ToLower(firstHeaderValue(r.Header, "X-Forwarded-Proto")); scheme {
+		case "http", "https":
+			forwarded.scheme = scheme
+		}
+		c.Request = r.WithContext(context.WithValue(r.Context(), forwardedContextKey{}, forwarded))
+		c.Next()
+	}
+}
+
+// firstHeaderValue returns the first entry of a comma separated header,
+// which proxies chaining the header put nearest the client.
+func firstHeaderValue(header http.Header, name string) string {
+	value, _, _ := strings.Cut(header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+// RequestBaseURL returns the scheme and host the client used to reach the
+// API, e.g. https://media.example.com, honouring X-Forwarded-Proto and
+// X-Forwarded-Host accepted by ForwardedHeaders.
+func RequestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if forwarded, ok := r.Context().Value(forwardedContextKey{}).(forwardedRequest); ok {
+		if forwarded.scheme != "" {
+			scheme = forwarded.scheme
+		}
+		if forwarded.host != "" {
+			host = forwarded.host
+		}
+	}
+	return scheme + "://" + host
+}
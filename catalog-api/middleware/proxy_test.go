@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.5 ", "", "fd00::/8"})
+	require.NoError(t, err)
+
+	for addr, want := range map[string]bool{
+		"10.1.2.3":           true,
+		"::ffff:10.1.2.3":    true,
+		"192.168.1.5":        true,
+		"192.168.1.6":        false,
+		"fd12::1":            true,
+		"2001:db8::1":        false,
+		"203.0.113.7":        false,
+		"::ffff:203.0.113.7": false,
+	} {
+		assert.Equal(t, want, proxies.Trusts(netip.MustParseAddr(addr)), addr)
+	}
+
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+
+	var none *TrustedProxies
+	assert.False(t, none.Trusts(netip.MustParseAddr("127.0.0.1")))
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies(nil))
+	router.Use(ForwardedHeaders(proxies))
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"ip":    c.ClientIP(),
+			"base":  RequestBaseURL(c.Request),
+			"proto": c.GetHeader("X-Forwarded-Proto"),
+		})
+	})
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		ip      string
+		base    string
+		proto   string
+	}{
+		{
+			name:   "direct client spoofing headers",
+			remote: "203.0.113.7:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2",
+				"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.com",
+			},
+			ip:   "203.0.113.7",
+			base: "http://api.internal",
+		},
+		{
+			name:   "trusted proxy",
+			remote: "10.0.0.2:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "media.example.com",
+			},
+			ip:    "198.51.100.1",
+			base:  "https://media.example.com",
+			proto: "https",
+		},
+		{
+			name:   "spoofed hop before trusted chain",
+			remote: "10.0.0.2:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.3",
+			},
+			ip:   "198.51.100.1",
+			base: "http://api.internal",
+		},
+		{
+			name:    "x-real-ip",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Real-IP": "2001:db8::1"},
+			ip:      "2001:db8::1",
+			base:    "http://api.internal",
+		},
+		{
+			name:    "no forwarding headers",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-Proto": "ftp"},
+			ip:      "10.0.0.2",
+			base:    "http://api.internal",
+			proto:   "ftp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://api.internal/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.JSONEq(t, `{"ip":"`+tt.ip+`","base":"`+tt.base+`","proto":"`+tt.proto+`"}`, w.Body.String())
+		})
+	}
+}
+
+func TestRequestBaseURL_TLS(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://media.example.com:8443/api", nil)
+	req.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https://media.example.com:8443", RequestBaseURL(req))
+}
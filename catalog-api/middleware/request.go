@@ -2,8 +2,6 @@ package middleware
 
 import (
 	"net/http"
-	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -85,35 +83,3 @@ func RateLimiter(requestsPerMinute int) gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-// CORS handles Cross-Origin Resource Sharing
-func CORS() gin.HandlerFunc {
-	allowedOrigins := os.Getenv("CORS_ALLOWED_ORIGINS")
-	if allowedOrigins == "" {
-		allowedOrigins = "http://localhost:5173,http://localhost:3000"
-	}
-	origins := strings.Split(allowedOrigins, ",")
-	for i := range origins {
-		origins[i] = strings.TrimSpace(origins[i])
-	}
-
-	return func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-		for _, o := range origins {
-			if o == origin && origin != "" {
-				c.Header("Access-Control-Allow-Origin", origin)
-				c.Header("Access-Control-Allow-Credentials", "true")
-				break
-			}
-		}
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	}
-}
@@ -2,10 +2,43 @@ package middleware
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// securityHeadersKey marks requests SecurityHeaders has handled, so
+// InputValidation leaves their headers alone
+const securityHeadersKey = "security_headers"
+
+// ServedContentSecurityPolicy is the CSP of stored files served for
+// preview or embedding. Files are whatever users uploaded: an HTML or SVG
+// file must not run scripts on the API's origin, but may show its own
+// images, media and styles and be framed by the web app.
+const ServedContentSecurityPolicy = "default-src 'none'; img-src 'self' data: blob:; media-src 'self' blob:; style-src 'self' 'unsafe-inline'; font-src 'self' data:; object-src 'self'; frame-ancestors 'self'"
+
+// ServedContentHeaders are the route headers for stored files served for
+// preview or embedding, which the web app frames and loads into img and
+// video elements from its own port.
+func ServedContentHeaders() map[string]string {
+	return map[string]string{
+		"Content-Security-Policy":      ServedContentSecurityPolicy,
+		"X-Frame-Options":              "SAMEORIGIN",
+		"Cross-Origin-Embedder-Policy": "",
+		"Cross-Origin-Resource-Policy": "same-site",
+	}
+}
+
+// SecurityHeadersRoute overrides headers for the routes whose pattern
+// starts with PathPrefix, such as "/api/v1/stream/" or
+// "/api/v1/entities/:id/stream".
+type SecurityHeadersRoute struct {
+	PathPrefix string
+	// Headers replace the default headers; an empty value removes one.
+	Headers map[string]string
+}
+
 // SecurityHeadersConfig holds configuration for security headers
 type SecurityHeadersConfig struct {
 	// EnableContentSecurityPolicy enables CSP header
@@ -20,13 +53,20 @@ type SecurityHeadersConfig struct {
 	HSTSIncludeSubDomains bool
 	// HSTSPreload enables HSTS preload
 	HSTSPreload bool
+	// ReportURI receives CSP violation reports from browsers; it is added
+	// to the default and route policies
+	ReportURI string
+	// Routes override headers per route; the longest matching prefix wins
+	Routes []SecurityHeadersRoute
 }
 
-// DefaultSecurityHeadersConfig returns default secure configuration
+// DefaultSecurityHeadersConfig returns default secure configuration. The
+// API answers with JSON and files rather than pages, so its CSP allows
+// nothing; routes serving pages or stored files override it.
 func DefaultSecurityHeadersConfig() SecurityHeadersConfig {
 	return SecurityHeadersConfig{
 		EnableContentSecurityPolicy: true,
-		ContentSecurityPolicy:       "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self'; connect-src 'self'; media-src 'self'; object-src 'none'; frame-src 'none'; base-uri 'self'; form-action 'self';",
+		ContentSecurityPolicy:       "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
 		EnableHSTS:                  true,
 		HSTSMaxAge:                  31536000, // 1 year
 		HSTSIncludeSubDomains:       true,
@@ -41,7 +81,14 @@ func SecurityHeaders() gin.HandlerFunc {
 
 // SecurityHeadersWithConfig adds security headers with custom configuration.
 func SecurityHeadersWithConfig(config SecurityHeadersConfig) gin.HandlerFunc {
+	routes := append([]SecurityHeadersRoute(nil), config.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+
 	return func(c *gin.Context) {
+		c.Set(securityHeadersKey, true)
+
 		// Basic security headers (always set)
 		c.Header("X-Content-Type-Options", "nosniff")
 		c.Header("X-Frame-Options", "DENY")
@@ -69,6 +116,25 @@ func SecurityHeadersWithConfig(config SecurityHeadersConfig) gin.HandlerFunc {
 			c.Header("Strict-Transport-Security", hstsValue)
 		}
 
+		if pattern := c.FullPath(); pattern != "" {
+			for _, route := range routes {
+				if !strings.HasPrefix(pattern, route.PathPrefix) {
+					continue
+				}
+				for name, value := range route.Headers {
+					if value == "" {
+						c.Writer.Header().Del(name)
+					} else {
+						c.Header(name, value)
+					}
+				}
+				break
+			}
+		}
+		if policy := c.Writer.Header().Get("Content-Security-Policy"); policy != "" && config.ReportURI != "" {
+			c.Header("Content-Security-Policy", strings.TrimSuffix(strings.TrimSpace(policy), ";")+"; report-uri "+config.ReportURI)
+		}
+
 		c.Next()
 	}
 }
@@ -188,3 +188,49 @@ func TestSecurityHeadersWithConfig_HSTSWithForwardedProto(t *testing.T) {
 	assert.Contains(t, hsts, "includeSubDomains")
 	assert.Contains(t, hsts, "preload")
 }
+
+func TestSecurityHeadersWithConfig_RouteOverrides(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultSecurityHeadersConfig()
+	config.ReportURI = "/api/v1/csp-report"
+	config.Routes = []SecurityHeadersRoute{
+		{PathPrefix: "/api/v1/stream/", Headers: ServedContentHeaders()},
+		{PathPrefix: "/api/v1/stream/:id/hls", Headers: map[string]string{"X-Frame-Options": "", "Referrer-Policy": "no-referrer"}},
+	}
+
+	r := gin.New()
+	r.Use(SecurityHeadersWithConfig(config))
+	r.Use(InputValidation(DefaultInputValidationConfig()))
+	for _, path := range []string{"/api/v1/media/:id", "/api/v1/stream/:id", "/api/v1/stream/:id/hls"} {
+		r.GET(path, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	}
+	get := func(path string) http.Header {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header()
+	}
+
+	h := get("/api/v1/media/1")
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'; report-uri /api/v1/csp-report",
+		h.Get("Content-Security-Policy"), "InputValidation keeps the headers SecurityHeaders chose")
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+	assert.Equal(t, "same-origin", h.Get("Cross-Origin-Resource-Policy"))
+
+	h = get("/api/v1/stream/1")
+	assert.Equal(t, ServedContentSecurityPolicy+"; report-uri /api/v1/csp-report", h.Get("Content-Security-Policy"))
+	assert.Equal(t, "SAMEORIGIN", h.Get("X-Frame-Options"))
+	assert.Equal(t, "same-site", h.Get("Cross-Origin-Resource-Policy"))
+	_, coep := h["Cross-Origin-Embedder-Policy"]
+	assert.False(t, coep)
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+
+	// Only the longest matching prefix applies
+	h = get("/api/v1/stream/1/hls")
+	_, frameOptions := h["X-Frame-Options"]
+	assert.False(t, frameOptions)
+	assert.Equal(t, "no-referrer", h.Get("Referrer-Policy"))
+	assert.Contains(t, h.Get("Content-Security-Policy"), "default-src 'none'; frame-ancestors 'none'")
+
+	// Unknown routes get the defaults
+	assert.Equal(t, "DENY", get("/missing").Get("X-Frame-Options"))
+}
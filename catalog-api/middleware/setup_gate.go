@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupGate answers 503 to API requests until the first-run setup has
+// completed. Requests outside /api/v1/, such as health checks and the web
+// UI, and those under one of the open path prefixes, such as the setup and
+// sign-in endpoints, pass through.
+func SetupGate(completed func() bool, open ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !strings.HasPrefix(path, "/api/v1/") || completed() {
+			c.Next()
+			return
+		}
+		for _, prefix := range open {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"success":   false,
+			"error":     "Setup required",
+			"details":   "complete the setup wizard at /api/v1/setup first",
+			"setup_url": "/api/v1/setup",
+		})
+	}
+}
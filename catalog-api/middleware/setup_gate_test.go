@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupGate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var completed atomic.Bool
+	r := gin.New()
+	r.Use(SetupGate(completed.Load, "/api/v1/setup", "/api/v1/auth"))
+	for _, path := range []string{"/health", "/api/v1/setup", "/api/v1/setup/steps", "/api/v1/auth/login", "/api/v1/setupx", "/api/v1/media"} {
+		r.GET(path, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	}
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, status("/health"))
+	assert.Equal(t, http.StatusOK, status("/api/v1/setup"))
+	assert.Equal(t, http.StatusOK, status("/api/v1/setup/steps"))
+	assert.Equal(t, http.StatusOK, status("/api/v1/auth/login"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/api/v1/setupx"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/api/v1/media"))
+
+	completed.Store(true)
+	assert.Equal(t, http.StatusOK, status("/api/v1/media"))
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SparseFieldsets trims JSON responses to the members listed in the
+// ?fields= query parameter (JSON:API style, fields[type]= is accepted too),
+// so constrained clients such as TV and mobile apps only download what they
+// render.
+//
+// collection names the member that holds the list of resources in an
+// envelope response such as {"users": [...], "total_count": 3}; the other
+// envelope members are kept as they are. With an empty collection the
+// response body itself is the resource. Fields may name nested members with
+// dots ("role.name"), and "id" is always kept.
+//
+// Requests without fields, non-GET requests and error or non-JSON
+// responses pass through untouched.
+func SparseFieldsets(collection string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		fields := parseSparseFields(c.Request.URL.Query())
+		if fields == nil {
+			c.Next()
+			return
+		}
+
+		bw := &bufferedResponseWriter{
+			ResponseWriter: c.Writer,
+			body:           &bytes.Buffer{},
+			statusCode:     http.StatusOK,
+		}
+		c.Writer = bw
+
+		c.Next()
+
+		c.Writer = bw.ResponseWriter
+
+		body := bw.body.Bytes()
+		if bw.statusCode < 400 && strings.Contains(bw.Header().Get("Content-Type"), "application/json") {
+			if filtered, ok := filterSparseFields(body, collection, fields); ok {
+				body = filtered
+				bw.Header().Del("Content-Length")
+			}
+		}
+
+		for k, vals := range bw.headers {
+			c.Writer.Header()[k] = vals
+		}
+		c.Writer.WriteHeader(bw.statusCode)
+		c.Writer.Write(body)
+	}
+}
+
+// sparseFieldSet is a tree of requested members. A nil subtree keeps the
+// whole member.
+type sparseFieldSet map[string]sparseFieldSet
+
+// parseSparseFields reads fields= and fields[type]= from the query. It
+// returns nil when no field is requested.
+func parseSparseFields(query map[string][]string) sparseFieldSet {
+	var set sparseFieldSet
+	for key, values := range query {
+		if key != "fields" && !(strings.HasPrefix(key, "fields[") && strings.HasSuffix(key, "]")) {
+			continue
+		}
+		for _, value := range values {
+			for _, field := range strings.Split(value, ",") {
+				field = strings.TrimSpace(field)
+				if field == "" {
+					continue
+				}
+				if set == nil {
+					set = sparseFieldSet{}
+				}
+				set.add(strings.Split(field, "."))
+			}
+		}
+	}
+	return set
+}
+
+func (s sparseFieldSet) add(path []string) {
+	sub, exists := s[path[0]]
+	if len(path) == 1 {
+		s[path[0]] = nil
+		return
+	}
+	if exists && sub == nil {
+		// The whole member is already requested
+		return
+	}
+	if sub == nil {
+		sub = sparseFieldSet{}
+		s[path[0]] = sub
+	}
+	sub.add(path[1:])
+}
+
+// filterSparseFields applies fields to a JSON body. It reports false when
+// the body is not JSON, leaving it to be sent unchanged.
+func filterSparseFields(body []byte, collection string, fields sparseFieldSet) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false
+	}
+
+	if collection == "" {
+		doc = fields.filter(doc)
+	} else if envelope, ok := doc.(map[string]interface{}); ok {
+		if resources, ok := envelope[collection]; ok {
+			envelope[collection] = fields.filter(resources)
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// filter keeps the requested members of an object, or of every object in a
+// list. Other values are returned as they are.
+func (s sparseFieldSet) filter(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(s)+1)
+		if id, ok := v["id"]; ok {
+			out["id"] = id
+		}
+		for name, sub := range s {
+			member, ok := v[name]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				out[name] = member
+			} else {
+				out[name] = sub.filter(member)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = s.filter(item)
+		}
+		return out
+	}
+	return value
+}
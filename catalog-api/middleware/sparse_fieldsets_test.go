@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sparseFieldsetsRouter(collection string, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/resource", SparseFieldsets(collection), handler)
+	return router
+}
+
+func getSparse(t *testing.T, router *gin.Engine, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w, body
+}
+
+func TestSparseFieldsets_Resource(t *testing.T) {
+	router := sparseFieldsetsRouter("", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"id":          7,
+			"title":       "Whiplash",
+			"year":        2014,
+			"description": "A long description",
+			"metadata":    gin.H{"poster": "p.jpg", "cast": []string{"a", "b"}},
+		})
+	})
+
+	_, body := getSparse(t, router, "/resource?fields=title,metadata.poster,missing")
+	assert.Equal(t, map[string]interface{}{
+		"id":       float64(7),
+		"title":    "Whiplash",
+		"metadata": map[string]interface{}{"poster": "p.jpg"},
+	}, body)
+
+	// A whole member wins over one of its parts
+	_, body = getSparse(t, router, "/resource?fields=metadata.poster,metadata")
+	assert.Len(t, body["metadata"], 2)
+
+	_, body = getSparse(t, router, "/resource")
+	assert.Contains(t, body, "description")
+}
+
+func TestSparseFieldsets_Collection(t *testing.T) {
+	router := sparseFieldsetsRouter("users", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"users": []gin.H{
+				{"id": 1, "username": "ana", "email": "ana@example.com", "role": gin.H{"id": 2, "name": "Admin", "permissions": []string{"*"}}},
+				{"id": 2, "username": "bo", "email": "bo@example.com"},
+			},
+			"total_count": 2,
+		})
+	})
+
+	_, body := getSparse(t, router, "/resource?fields[users]=username,role.name")
+	assert.Equal(t, float64(2), body["total_count"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": float64(1), "username": "ana", "role": map[string]interface{}{"id": float64(2), "name": "Admin"}},
+		map[string]interface{}{"id": float64(2), "username": "bo"},
+	}, body["users"])
+}
+
+func TestSparseFieldsets_PassThrough(t *testing.T) {
+	router := sparseFieldsetsRouter("", func(c *gin.Context) {
+		c.Header("X-Custom", "kept")
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found", "details": "missing"})
+	})
+	w, body := getSparse(t, router, "/resource?fields=title")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "kept", w.Header().Get("X-Custom"))
+	assert.Equal(t, "missing", body["details"])
+
+	router = sparseFieldsetsRouter("", func(c *gin.Context) {
+		c.String(http.StatusOK, "plain text")
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resource?fields=title", nil))
+	assert.Equal(t, "plain text", w.Body.String())
+}
+
+func TestSparseFieldsets_LargeNumbersSurvive(t *testing.T) {
+	router := sparseFieldsetsRouter("", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": 1, "file_size": int64(9007199254740993)})
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resource?fields=file_size", nil))
+	assert.Equal(t, `{"file_size":9007199254740993,"id":1}`, w.Body.String())
+}
@@ -48,15 +48,15 @@ type File struct {
 type StorageRoot struct {
 	ID                       int64      `json:"id" db:"id"`
 	Name                     string     `json:"name" db:"name"`
-	Protocol                 string     `json:"protocol" db:"protocol"` // smb, ftp, nfs, webdav, local
-	Host                     *string    `json:"host,omitempty" db:"host"`
+	Protocol                 string     `json:"protocol" db:"protocol"`   // smb, ftp, nfs, webdav, local, rclone, sftp
+	Host                     *string    `json:"host,omitempty" db:"host"` // remote name for rclone
 	Port                     *int       `json:"port,omitempty" db:"port"`
 	Path                     *string    `json:"path,omitempty" db:"path"` // share for SMB, path for FTP/NFS/WebDAV, base_path for local
 	Username                 *string    `json:"username,omitempty" db:"username"`
 	Password                 *string    `json:"password,omitempty" db:"password"`
 	Domain                   *string    `json:"domain,omitempty" db:"domain"`           // SMB specific
 	MountPoint               *string    `json:"mount_point,omitempty" db:"mount_point"` // NFS specific
-	Options                  *string    `json:"options,omitempty" db:"options"`         // NFS/WebDAV specific
+	Options                  *string    `json:"options,omitempty" db:"options"`         // NFS/WebDAV specific, rclone.conf path for rclone, key JSON for SFTP
 	URL                      *string    `json:"url,omitempty" db:"url"`                 // WebDAV specific
 	Enabled                  bool       `json:"enabled" db:"enabled"`
 	MaxDepth                 int        `json:"max_depth" db:"max_depth"`
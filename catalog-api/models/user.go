@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -59,6 +60,41 @@ type User struct {
 	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// LoadTimeZone resolves an IANA time zone name such as "Europe/Belgrade".
+// An empty name is the server's own time zone.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	return loc, nil
+}
+
+// Location returns the time zone times are shown to the user in: their
+// TimeZone, or UTC when they have not set a valid one.
+func (u *User) Location() *time.Location {
+	if u.TimeZone == nil || *u.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := LoadTimeZone(*u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// TimeIn returns t in loc, or nil when t is nil.
+func TimeIn(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.In(loc)
+	return &v
+}
+
 // Role represents a user role with specific permissions
 type Role struct {
 	ID          int         `json:"id" db:"id"`
@@ -163,6 +199,7 @@ type NotificationPrefs struct {
 
 // PrivacyPrefs represents privacy preferences
 type PrivacyPrefs struct {
+	// ShareUsageData opts the user in to anonymous usage telemetry.
 	ShareUsageData      bool `json:"share_usage_data"`
 	LocationTracking    bool `json:"location_tracking"`
 	AnalyticsTracking   bool `json:"analytics_tracking"`
@@ -283,6 +320,94 @@ type UserSession struct {
 	LastActivityAt time.Time  `json:"last_activity_at" db:"last_activity_at"`
 }
 
+// APIKey is a long-lived credential for scripts and integrations. It acts
+// for its owner with at most the permissions in Scopes; only a hash of the
+// key is stored.
+type APIKey struct {
+	ID         int         `json:"id" db:"id"`
+	UserID     int         `json:"user_id" db:"user_id"`
+	Name       string      `json:"name" db:"name"`
+	Prefix     string      `json:"prefix" db:"prefix"`
+	KeyHash    string      `json:"-" db:"key_hash"`
+	Scopes     Permissions `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time  `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+}
+
+// IsExpired reports whether the key has passed its expiry time
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())
+}
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey is a new API key together with its secret, which is only
+// ever returned this once
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// OIDCIdentity links a user to an account at an external identity
+// provider, letting them sign in through it
+type OIDCIdentity struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"subject" db:"subject"`
+	Email       *string    `json:"email,omitempty" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// LDAPAccount links a user to their entry in an LDAP directory. Accounts
+// the directory sync disabled are re-enabled if the entry comes back.
+type LDAPAccount struct {
+	UserID         int        `json:"user_id" db:"user_id"`
+	DN             string     `json:"dn" db:"dn"`
+	Username       string     `json:"username" db:"username"`
+	DisabledBySync bool       `json:"disabled_by_sync" db:"disabled_by_sync"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt    *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+	LastSyncedAt   *time.Time `json:"last_synced_at,omitempty" db:"last_synced_at"`
+}
+
+// Password hash algorithms.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+	// PasswordHashSHA256 marks the SHA-256 hex digests user creation used
+	// to store; they are verified but never made
+	PasswordHashSHA256 = "sha256"
+)
+
+// PasswordHashParams are the algorithm and cost new password hashes are
+// made with. The argon2id fields apply to argon2id, BcryptCost to bcrypt.
+type PasswordHashParams struct {
+	Algorithm   string     `json:"algorithm"`
+	MemoryKiB   uint32     `json:"memory_kib,omitempty"`
+	Iterations  uint32     `json:"iterations,omitempty"`
+	Parallelism uint8      `json:"parallelism,omitempty"`
+	BcryptCost  int        `json:"bcrypt_cost,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	UpdatedBy   *int       `json:"updated_by,omitempty"`
+}
+
+// PasswordHashStatus reports the parameters passwords are hashed with and
+// how far existing hashes have migrated to them. Outdated hashes are
+// rehashed when their users next sign in.
+type PasswordHashStatus struct {
+	Params     PasswordHashParams `json:"params"`
+	Algorithms map[string]int     `json:"algorithms"`
+	Outdated   int                `json:"outdated"`
+}
+
 // DeviceInfo represents information about the user's device
 type DeviceInfo struct {
 	DeviceType      *string `json:"device_type,omitempty"` // mobile, tablet, desktop, tv
@@ -547,7 +672,7 @@ func GetDefaultPreferences() UserPreferences {
 			ErrorNotifications: true,
 		},
 		PrivacySettings: PrivacyPrefs{
-			ShareUsageData:      true,
+			ShareUsageData:      false,
 			LocationTracking:    true,
 			AnalyticsTracking:   true,
 			PersonalizedContent: true,
@@ -596,6 +721,64 @@ func GetDefaultSettings() UserSettings {
 	}
 }
 
+// Validate checks the preference values a client may set. Empty strings
+// and zero numbers are accepted and read as the defaults.
+func (up UserPreferences) Validate() error {
+	if !oneOf(up.Theme, "auto", "light", "dark") {
+		return fmt.Errorf("theme must be auto, light or dark")
+	}
+	if _, err := LoadTimeZone(up.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	if v := up.MediaPlayerSettings.Volume; v < 0 || v > 1 {
+		return fmt.Errorf("media_player.volume must be between 0 and 1")
+	}
+	if !oneOf(up.UISettings.DensityMode, "compact", "comfortable", "spacious") {
+		return fmt.Errorf("ui.density_mode must be compact, comfortable or spacious")
+	}
+	if g := up.UISettings.GridSize; g < 0 || g > 12 {
+		return fmt.Errorf("ui.grid_size must be between 1 and 12")
+	}
+	return nil
+}
+
+// Validate checks the setting values a client may set. Empty strings and
+// zero numbers are accepted and read as the defaults.
+func (us UserSettings) Validate() error {
+	if us.SyncIntervalMinutes < 0 {
+		return fmt.Errorf("sync_interval_minutes must not be negative")
+	}
+	if us.CacheSettings.MaxCacheSize < 0 || us.CacheSettings.CacheTimeout < 0 {
+		return fmt.Errorf("cache sizes and timeouts must not be negative")
+	}
+	if j := us.ConversionSettings.MaxConcurrentJobs; j < 0 || j > 32 {
+		return fmt.Errorf("conversion.max_concurrent_jobs must be between 0 and 32")
+	}
+	if !oneOf(us.BackupSettings.BackupInterval, "daily", "weekly", "monthly") {
+		return fmt.Errorf("backup.backup_interval must be daily, weekly or monthly")
+	}
+	if us.BackupSettings.BackupRetention < 0 {
+		return fmt.Errorf("backup.backup_retention must not be negative")
+	}
+	if us.SecuritySettings.SessionTimeout < 0 {
+		return fmt.Errorf("security.session_timeout must not be negative")
+	}
+	return nil
+}
+
+// oneOf reports whether value is empty or one of allowed.
+func oneOf(value string, allowed ...string) bool {
+	if value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
 // Analytics and Reporting Models
 
 // MediaAccessLog represents a log entry for media access
@@ -642,6 +825,11 @@ type AnalyticsEventRequest struct {
 	EntityID   int                    `json:"entity_id,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	SessionID  string                 `json:"session_id,omitempty"`
+	// EventCategory groups related event types, e.g. "playback"
+	EventCategory string `json:"event_category,omitempty"`
+	// Timestamp is when the event happened on the client, for events
+	// queued while offline; the server time is used when it is unset
+	Timestamp *time.Time `json:"timestamp,omitempty"`
 }
 
 // AnalyticsFilters represents filters for analytics queries
@@ -652,6 +840,23 @@ type AnalyticsFilters struct {
 	EntityTypes []string   `json:"entity_types,omitempty"`
 	Limit       int        `json:"limit,omitempty"`
 	Offset      int        `json:"offset,omitempty"`
+	// Bucket is the timeline granularity: hour, day, week or month
+	Bucket string `json:"bucket,omitempty"`
+}
+
+// Analytics timeline buckets
+const (
+	AnalyticsBucketHour  = "hour"
+	AnalyticsBucketDay   = "day"
+	AnalyticsBucketWeek  = "week"
+	AnalyticsBucketMonth = "month"
+)
+
+// TimeBucketCount is one bucket of an analytics timeline
+type TimeBucketCount struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Count       int       `json:"count"`
+	UniqueUsers int       `json:"unique_users"`
 }
 
 // AnalyticsData represents aggregated analytics data
@@ -664,11 +869,71 @@ type AnalyticsData struct {
 
 // DashboardMetrics represents dashboard metrics
 type DashboardMetrics struct {
-	TotalUsers       int64 `json:"total_users"`
-	ActiveUsers      int64 `json:"active_users"`
-	TotalMediaItems  int64 `json:"total_media_items"`
-	TotalStorageUsed int64 `json:"total_storage_used"`
-	RecentActivity   int64 `json:"recent_activity"`
+	TotalUsers       int64                `json:"total_users"`
+	ActiveUsers      int64                `json:"active_users"`
+	TotalMediaItems  int64                `json:"total_media_items"`
+	TotalStorageUsed int64                `json:"total_storage_used"`
+	RecentActivity   int64                `json:"recent_activity"`
+	StartDate        time.Time            `json:"start_date"`
+	EndDate          time.Time            `json:"end_date"`
+	Bucket           string               `json:"bucket"`
+	EventTimeline    []TimeBucketCount    `json:"event_timeline"`
+	AccessTimeline   []TimeBucketCount    `json:"access_timeline"`
+	EventBreakdown   map[string]int       `json:"event_breakdown"`
+	TopAccessedMedia []MediaAccessCount   `json:"top_accessed_media"`
+	StorageGrowth    []StorageGrowthPoint `json:"storage_growth"`
+	Freshness        AnalyticsFreshness   `json:"freshness"`
+}
+
+// StorageGrowthPoint is the daily snapshot of the files in all storage
+// roots
+type StorageGrowthPoint struct {
+	Date       time.Time `json:"date"`
+	FileCount  int64     `json:"file_count"`
+	TotalBytes int64     `json:"total_bytes"`
+}
+
+// AnalyticsFreshness tells how current dashboard metrics are. Metrics
+// between RollupStart and RollupEnd come from hourly rollups, the rest
+// from raw rows; RolledUpUntil is the end of the last hour rolled up.
+// StorageAsOf is when the storage snapshot behind TotalStorageUsed was
+// taken.
+type AnalyticsFreshness struct {
+	GeneratedAt   time.Time  `json:"generated_at"`
+	RolledUpUntil *time.Time `json:"rolled_up_until,omitempty"`
+	RollupStart   *time.Time `json:"rollup_start,omitempty"`
+	RollupEnd     *time.Time `json:"rollup_end,omitempty"`
+	StorageAsOf   *time.Time `json:"storage_as_of,omitempty"`
+}
+
+// Analytics time-series metrics
+const (
+	AnalyticsMetricEvents        = "events"
+	AnalyticsMetricActiveUsers   = "active_users"
+	AnalyticsMetricMediaAccesses = "media_accesses"
+	AnalyticsMetricStorageBytes  = "storage_bytes"
+	AnalyticsMetricStorageFiles  = "storage_files"
+)
+
+// TimeSeriesPoint is one point of an analytics time series
+type TimeSeriesPoint struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"v"`
+}
+
+// AnalyticsTimeSeries is one metric over time for charting. RawPoints
+// is the number of intervals before downsampling; when it exceeds the
+// requested maximum, Points keeps the most visually significant ones and
+// Downsampled is set.
+type AnalyticsTimeSeries struct {
+	Metric      string             `json:"metric"`
+	StartDate   time.Time          `json:"start_date"`
+	EndDate     time.Time          `json:"end_date"`
+	Interval    string             `json:"interval"`
+	RawPoints   int                `json:"raw_points"`
+	Downsampled bool               `json:"downsampled"`
+	Points      []TimeSeriesPoint  `json:"points"`
+	Freshness   AnalyticsFreshness `json:"freshness"`
 }
 
 // RealtimeMetrics represents realtime metrics
@@ -698,6 +963,7 @@ type UserAnalytics struct {
 	PreferredAccessTimes map[string]int     `json:"preferred_access_times"`
 	DeviceUsage          map[string]int     `json:"device_usage"`
 	LocationAnalysis     map[string]int     `json:"location_analysis"`
+	Activity             []TimeBucketCount  `json:"activity,omitempty"`
 }
 
 // SystemAnalytics represents system-wide analytics
@@ -731,6 +997,37 @@ type MediaAnalytics struct {
 	DevicePreferences   map[string]int         `json:"device_preferences"`
 }
 
+// MediaUsageStats is how one media item was used over a period, for its
+// owners. Plays are play and stream accesses. Completion compares
+// playback time with the item's runtime and is left out when the runtime
+// is unknown. Breakdowns never name viewers: groups with fewer viewers
+// than MinGroupSize are folded into "other".
+type MediaUsageStats struct {
+	MediaID              int       `json:"media_id"`
+	StartDate            time.Time `json:"start_date"`
+	EndDate              time.Time `json:"end_date"`
+	Plays                int       `json:"plays"`
+	UniqueViewers        int       `json:"unique_viewers"`
+	TotalPlaybackSeconds int64     `json:"total_playback_seconds"`
+	// CompletionRate is the share of timed plays that reached the
+	// completion threshold of the runtime; AverageCompletion is the mean
+	// share of the runtime played
+	CompletionRate    *float64          `json:"completion_rate,omitempty"`
+	AverageCompletion *float64          `json:"average_completion,omitempty"`
+	Actions           map[string]int    `json:"actions"`
+	Countries         []MediaUsageGroup `json:"countries"`
+	DeviceTypes       []MediaUsageGroup `json:"device_types"`
+	Platforms         []MediaUsageGroup `json:"platforms"`
+	MinGroupSize      int               `json:"min_group_size"`
+}
+
+// MediaUsageGroup counts the plays and viewers of one breakdown group
+type MediaUsageGroup struct {
+	Name    string `json:"name"`
+	Plays   int    `json:"plays"`
+	Viewers int    `json:"viewers"`
+}
+
 // MediaAccessCount represents media access statistics
 type MediaAccessCount struct {
 	MediaID     int `json:"media_id"`
@@ -990,6 +1287,7 @@ type ActivitySummary struct {
 }
 
 type SecurityIncident struct {
+	ID          int64     `json:"id,omitempty"`
 	Type        string    `json:"type"`
 	Description string    `json:"description"`
 	Severity    string    `json:"severity"`
@@ -1041,6 +1339,8 @@ type ConversionJob struct {
 	Settings       *string        `json:"settings,omitempty" db:"settings"`
 	Priority       int            `json:"priority" db:"priority"`
 	Status         string         `json:"status" db:"status"`
+	Progress       float64        `json:"progress" db:"progress"`
+	TransferRate   float64        `json:"transfer_rate" db:"transfer_rate"`
 	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
 	StartedAt      *time.Time     `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt    *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
@@ -1049,6 +1349,45 @@ type ConversionJob struct {
 	ErrorMessage   *string        `json:"error_message,omitempty" db:"error_message"`
 }
 
+// ConversionProgress is a snapshot of how far a conversion job has got
+type ConversionProgress struct {
+	JobID          int      `json:"job_id"`
+	Status         string   `json:"status"`
+	Percent        float64  `json:"percent"`
+	TransferRate   float64  `json:"transfer_rate"`
+	ElapsedSeconds float64  `json:"elapsed_seconds"`
+	ETASeconds     *float64 `json:"eta_seconds,omitempty"`
+}
+
+// NewConversionProgress reports a job's progress as of now. The ETA
+// assumes the rest of the job runs at the pace it has run so far, and is
+// left out until the job is running and has made progress.
+func NewConversionProgress(job *ConversionJob, now time.Time) *ConversionProgress {
+	progress := &ConversionProgress{
+		JobID:        job.ID,
+		Status:       job.Status,
+		Percent:      job.Progress * 100,
+		TransferRate: job.TransferRate,
+	}
+	if job.StartedAt == nil {
+		return progress
+	}
+	end := now
+	if job.CompletedAt != nil {
+		end = *job.CompletedAt
+	}
+	elapsed := end.Sub(*job.StartedAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	progress.ElapsedSeconds = elapsed
+	if job.Status == ConversionStatusRunning && job.Progress > 0 {
+		eta := elapsed/job.Progress - elapsed
+		progress.ETASeconds = &eta
+	}
+	return progress
+}
+
 // ConversionRequest represents a request to create a conversion job
 type ConversionRequest struct {
 	SourcePath     string     `json:"source_path"`
@@ -1082,6 +1421,14 @@ type SupportedFormats struct {
 	Image    ImageFormats    `json:"image"`
 }
 
+// ConversionTool is an external program conversions shell out to
+type ConversionTool struct {
+	Name        string   `json:"name"`
+	Binary      string   `json:"binary"`
+	Available   bool     `json:"available"`
+	Conversions []string `json:"conversions"`
+}
+
 // VideoFormats represents supported video formats
 type VideoFormats struct {
 	Input  []string `json:"input"`
@@ -1165,18 +1512,153 @@ type SyncSession struct {
 	FailedFiles  int            `json:"failed_files" db:"failed_files"`
 	SkippedFiles int            `json:"skipped_files" db:"skipped_files"`
 	ErrorMessage *string        `json:"error_message,omitempty" db:"error_message"`
-}
-
-// SyncSchedule represents a scheduled sync
+	SkipReasons  map[string]int `json:"skip_reasons,omitempty" db:"skip_reasons"`
+
+	// Options are the endpoint's parsed sync settings for this run.
+	Options *SyncEndpointOptions `json:"-" db:"-"`
+
+	// ConflictResolutions carries per-path choices approved from a dry-run
+	// plan into a bidirectional run. It is not persisted.
+	ConflictResolutions map[string]string `json:"conflict_resolutions,omitempty" db:"-"`
+
+	// FailuresRecorded counts the failures stored for this run, which
+	// stops storing them past a limit.
+	FailuresRecorded int `json:"-" db:"-"`
+}
+
+// SyncFailure is a file a sync session failed to transfer. Path is empty
+// when the failure concerns the run rather than one file.
+type SyncFailure struct {
+	ID         int       `json:"id" db:"id"`
+	SessionID  int       `json:"session_id" db:"session_id"`
+	Path       string    `json:"path,omitempty" db:"path"`
+	Message    string    `json:"message" db:"message"`
+	OccurredAt time.Time `json:"occurred_at" db:"occurred_at"`
+}
+
+// SyncProgress is the live transfer progress of a running sync session as
+// reported by the transfer engine.
+type SyncProgress struct {
+	SessionID        int       `json:"session_id"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	TotalBytes       int64     `json:"total_bytes"`
+	FilesTransferred int       `json:"files_transferred"`
+	TotalFiles       int       `json:"total_files"`
+	Checks           int       `json:"checks"`
+	Errors           int       `json:"errors"`
+	SpeedBytesPerSec float64   `json:"speed_bytes_per_sec"`
+	ETASeconds       *int64    `json:"eta_seconds,omitempty"`
+	CurrentFiles     []string  `json:"current_files,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// SyncEndpointOptions are the filter, bandwidth and scheduling options read
+// from SyncEndpoint.SyncSettings. Type-specific keys (bucket, source_directory,
+// ...) live alongside them in the same JSON object.
+type SyncEndpointOptions struct {
+	IncludePatterns    []string             `json:"include_patterns,omitempty"`
+	ExcludePatterns    []string             `json:"exclude_patterns,omitempty"`
+	MaxFileSize        int64                `json:"max_file_size,omitempty"`        // bytes; 0 means unlimited
+	BandwidthLimitKBps int                  `json:"bandwidth_limit_kbps,omitempty"` // 0 means unlimited
+	ScheduleWindows    []SyncScheduleWindow `json:"schedule_windows,omitempty"`
+}
+
+// SyncCloudCredentials links a cloud storage endpoint to a provider account
+type SyncCloudCredentials struct {
+	EndpointID   int        `json:"endpoint_id" db:"endpoint_id"`
+	Provider     string     `json:"provider" db:"provider"`
+	AccessToken  string     `json:"-" db:"access_token"`
+	RefreshToken string     `json:"-" db:"refresh_token"`
+	TokenExpiry  *time.Time `json:"token_expiry,omitempty" db:"token_expiry"`
+	ChangeCursor string     `json:"-" db:"change_cursor"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CompleteCloudLinkRequest carries the authorization code returned by a
+// cloud provider's OAuth consent screen
+type CompleteCloudLinkRequest struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// SyncScheduleWindow is a daily time range during which scheduled syncs may
+// transfer files. Start and End are read in TimeZone, an IANA name, or in
+// server local time when it is empty. End before Start wraps past midnight.
+type SyncScheduleWindow struct {
+	Days     []string `json:"days,omitempty"` // mon..sun; empty means every day
+	Start    string   `json:"start"`          // HH:MM
+	End      string   `json:"end"`            // HH:MM
+	TimeZone string   `json:"time_zone,omitempty"`
+}
+
+// SyncFileState describes one side of a file in a sync plan
+type SyncFileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// SyncPlanAction is a transfer a bidirectional sync would perform
+type SyncPlanAction struct {
+	Path   string         `json:"path"`
+	Action string         `json:"action"`
+	Reason string         `json:"reason"`
+	Local  *SyncFileState `json:"local,omitempty"`
+	Remote *SyncFileState `json:"remote,omitempty"`
+}
+
+// SyncConflict is a file changed on both sides, with the resolution that
+// will be applied unless the user overrides it
+type SyncConflict struct {
+	Path       string        `json:"path"`
+	Local      SyncFileState `json:"local"`
+	Remote     SyncFileState `json:"remote"`
+	Resolution string        `json:"resolution"`
+}
+
+// SyncPlan is the dry-run result of a bidirectional sync
+type SyncPlan struct {
+	EndpointID  int              `json:"endpoint_id"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	LastSyncAt  *time.Time       `json:"last_sync_at,omitempty"`
+	Uploads     []SyncPlanAction `json:"uploads"`
+	Downloads   []SyncPlanAction `json:"downloads"`
+	Conflicts   []SyncConflict   `json:"conflicts"`
+	Unchanged   int              `json:"unchanged"`
+	Skipped     map[string]int   `json:"skipped,omitempty"`
+}
+
+// StartSyncRequest optionally carries conflict resolutions approved from a plan
+type StartSyncRequest struct {
+	Resolutions map[string]string `json:"resolutions,omitempty"`
+}
+
+// SyncSchedule represents a scheduled sync. Daily, weekly and monthly
+// schedules keep the wall clock time of TimeZone, an IANA name or empty for
+// server local time, across daylight saving changes.
 type SyncSchedule struct {
 	ID         int        `json:"id" db:"id"`
 	EndpointID int        `json:"endpoint_id" db:"endpoint_id"`
 	UserID     int        `json:"user_id" db:"user_id"`
 	Frequency  string     `json:"frequency" db:"frequency"`
+	TimeZone   string     `json:"time_zone" db:"time_zone"`
 	LastRun    *time.Time `json:"last_run,omitempty" db:"last_run"`
 	NextRun    *time.Time `json:"next_run,omitempty" db:"next_run"`
 	IsActive   bool       `json:"is_active" db:"is_active"`
 	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+
+	// LastRunLocal and NextRunLocal repeat LastRun and NextRun in
+	// DisplayTimeZone, the time zone of the user reading the schedule.
+	LastRunLocal    *time.Time `json:"last_run_local,omitempty" db:"-"`
+	NextRunLocal    *time.Time `json:"next_run_local,omitempty" db:"-"`
+	DisplayTimeZone string     `json:"display_time_zone,omitempty" db:"-"`
+}
+
+// Localize puts the schedule's run times in UTC and fills in their
+// representation in loc.
+func (s *SyncSchedule) Localize(loc *time.Location) {
+	s.LastRun, s.NextRun = TimeIn(s.LastRun, time.UTC), TimeIn(s.NextRun, time.UTC)
+	s.LastRunLocal, s.NextRunLocal = TimeIn(s.LastRun, loc), TimeIn(s.NextRun, loc)
+	s.DisplayTimeZone = loc.String()
 }
 
 // SyncStatistics represents sync statistics
@@ -1225,10 +1707,22 @@ const (
 	SyncTypeWebDAV       = "webdav"
 	SyncTypeCloudStorage = "cloud_storage"
 	SyncTypeLocal        = "local"
+	SyncTypeRclone       = "rclone"
+	SyncTypeSFTP         = "sftp"
 	SyncTypeManual       = "manual"
 	SyncTypeScheduled    = "scheduled"
 )
 
+// Cloud Storage Provider Constants. The provider is chosen with the
+// "provider" key of a cloud storage endpoint's sync settings.
+const (
+	CloudProviderS3          = "s3"
+	CloudProviderGCS         = "gcs"
+	CloudProviderDropbox     = "dropbox"
+	CloudProviderGoogleDrive = "google_drive"
+	CloudProviderOneDrive    = "onedrive"
+)
+
 // Sync Direction Constants
 const (
 	SyncDirectionUpload        = "upload"
@@ -1236,6 +1730,32 @@ const (
 	SyncDirectionBidirectional = "bidirectional"
 )
 
+// Sync Conflict Resolution Constants
+const (
+	SyncResolutionKeepLocal  = "keep_local"
+	SyncResolutionKeepRemote = "keep_remote"
+	SyncResolutionNewer      = "newer"
+	SyncResolutionSkip       = "skip"
+)
+
+// Sync Skip Reason Constants
+const (
+	SyncSkipHidden          = "hidden"
+	SyncSkipTemporary       = "temporary"
+	SyncSkipExcluded        = "excluded"
+	SyncSkipNotIncluded     = "not_included"
+	SyncSkipTooLarge        = "too_large"
+	SyncSkipUnchanged       = "unchanged"
+	SyncSkipOutsideWindow   = "outside_window"
+	SyncSkipConflictSkipped = "conflict_skipped"
+)
+
+// Sync Plan Action Constants
+const (
+	SyncActionUpload   = "upload"
+	SyncActionDownload = "download"
+)
+
 // Sync Frequency Constants
 const (
 	SyncFrequencyHourly  = "hourly"
@@ -1579,6 +2099,7 @@ type DatabaseConfig struct {
 	Name     string `json:"name"`
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
+	SSLMode  string `json:"ssl_mode,omitempty"`
 }
 
 // StorageConfig represents storage configuration
@@ -1598,18 +2119,77 @@ type NetworkConfig struct {
 	CORS  *CORSConfig  `json:"cors,omitempty"`
 }
 
-// HTTPSConfig represents HTTPS configuration
+// HTTPSConfig represents HTTPS configuration. The certificate comes from
+// ACME when enabled, otherwise from CertPath and KeyPath, otherwise it is
+// self-signed.
 type HTTPSConfig struct {
 	Enabled  bool   `json:"enabled"`
+	Port     int    `json:"port,omitempty"` // default 443
 	CertPath string `json:"cert_path,omitempty"`
 	KeyPath  string `json:"key_path,omitempty"`
+	// RedirectHTTP starts a plain HTTP listener on RedirectPort that
+	// redirects to HTTPS and answers ACME HTTP-01 challenges
+	RedirectHTTP bool        `json:"redirect_http,omitempty"`
+	RedirectPort int         `json:"redirect_port,omitempty"` // default 80
+	ACME         *ACMEConfig `json:"acme,omitempty"`
+	HSTS         *HSTSConfig `json:"hsts,omitempty"`
 }
 
-// CORSConfig represents CORS configuration
+// ACME challenge types
+const (
+	ACMEChallengeHTTP01 = "http-01"
+	ACMEChallengeDNS01  = "dns-01"
+)
+
+// ACMEConfig represents automatic certificate issuance and renewal
+type ACMEConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Email        string   `json:"email"`
+	Domains      []string `json:"domains"`
+	Challenge    string   `json:"challenge,omitempty"`     // http-01 (default) or dns-01
+	DirectoryURL string   `json:"directory_url,omitempty"` // default Let's Encrypt production
+	CacheDir     string   `json:"cache_dir,omitempty"`
+	// DNSHook is run for dns-01 as `hook present|cleanup <fqdn> <value>`
+	// to create and remove the TXT record
+	DNSHook               string `json:"dns_hook,omitempty"`
+	DNSPropagationSeconds int    `json:"dns_propagation_seconds,omitempty"` // default 60
+	RenewBeforeDays       int    `json:"renew_before_days,omitempty"`       // default 30
+}
+
+// HSTSConfig represents the Strict-Transport-Security header
+type HSTSConfig struct {
+	Enabled           bool `json:"enabled"`
+	MaxAgeSeconds     int  `json:"max_age_seconds,omitempty"` // default one year
+	IncludeSubdomains bool `json:"include_subdomains,omitempty"`
+	Preload           bool `json:"preload,omitempty"`
+}
+
+// CORSConfig represents CORS configuration. The top-level fields are the
+// default policy; Policies override it for the routes under their path
+// prefixes, the longest matching prefix winning.
 type CORSConfig struct {
-	AllowedOrigins []string `json:"allowed_origins"`
-	AllowedMethods []string `json:"allowed_methods,omitempty"`
-	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+	// AllowedOrigins are exact origins such as https://media.example.com.
+	// Empty keeps the built-in origins (CORS_ALLOWED_ORIGINS or the local
+	// development servers)
+	AllowedOrigins   []string     `json:"allowed_origins"`
+	AllowedMethods   []string     `json:"allowed_methods,omitempty"`
+	AllowedHeaders   []string     `json:"allowed_headers,omitempty"`
+	AllowCredentials bool         `json:"allow_credentials,omitempty"`
+	MaxAgeSeconds    int          `json:"max_age_seconds,omitempty"`
+	Policies         []CORSPolicy `json:"policies,omitempty"`
+}
+
+// CORSPolicy represents the CORS policy of a route group. Unlike the
+// default policy it may allow any origin with "*", which never sends
+// credentials
+type CORSPolicy struct {
+	Name             string   `json:"name"`
+	PathPrefixes     []string `json:"path_prefixes"` // e.g. /api/v1/shared
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `json:"allowed_headers,omitempty"`
+	AllowCredentials bool     `json:"allow_credentials,omitempty"`
+	MaxAgeSeconds    int      `json:"max_age_seconds,omitempty"`
 }
 
 // AuthenticationConfig represents authentication configuration
@@ -1677,6 +2257,14 @@ type WizardProgress struct {
 	UpdatedAt   time.Time              `json:"updated_at" db:"updated_at"`
 }
 
+// SetupStatus reports whether the first-run setup has completed and,
+// while it has not, the step to continue from
+type SetupStatus struct {
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CurrentStep string     `json:"current_step,omitempty"`
+}
+
 // WizardStepValidation represents validation results for a wizard step
 type WizardStepValidation struct {
 	StepID   string            `json:"step_id"`
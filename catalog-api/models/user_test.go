@@ -661,3 +661,67 @@ func TestDeviceInfo_DriverValue(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, val)
 }
+
+// TestNewConversionProgress tests percent, elapsed time and ETA of a job
+func TestNewConversionProgress(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-30 * time.Second)
+
+	pending := NewConversionProgress(&ConversionJob{ID: 1, Status: ConversionStatusPending}, now)
+	assert.Equal(t, 0.0, pending.ElapsedSeconds)
+	assert.Nil(t, pending.ETASeconds)
+
+	running := NewConversionProgress(&ConversionJob{
+		ID:           2,
+		Status:       ConversionStatusRunning,
+		Progress:     0.25,
+		TransferRate: 1 << 20,
+		StartedAt:    &started,
+	}, now)
+	assert.Equal(t, 25.0, running.Percent)
+	assert.Equal(t, float64(1<<20), running.TransferRate)
+	assert.Equal(t, 30.0, running.ElapsedSeconds)
+	require.NotNil(t, running.ETASeconds)
+	assert.InDelta(t, 90.0, *running.ETASeconds, 0.001)
+
+	completed := now.Add(-10 * time.Second)
+	done := NewConversionProgress(&ConversionJob{
+		ID:          3,
+		Status:      ConversionStatusCompleted,
+		Progress:    1,
+		StartedAt:   &started,
+		CompletedAt: &completed,
+	}, now)
+	assert.Equal(t, 100.0, done.Percent)
+	assert.Equal(t, 20.0, done.ElapsedSeconds)
+	assert.Nil(t, done.ETASeconds)
+}
+
+func TestUser_Location(t *testing.T) {
+	belgrade, invalid, empty := "Europe/Belgrade", "Europe/Atlantis", ""
+	assert.Equal(t, "Europe/Belgrade", (&User{TimeZone: &belgrade}).Location().String())
+	assert.Equal(t, time.UTC, (&User{TimeZone: &invalid}).Location())
+	assert.Equal(t, time.UTC, (&User{TimeZone: &empty}).Location())
+	assert.Equal(t, time.UTC, (&User{}).Location())
+
+	_, err := LoadTimeZone(invalid)
+	assert.ErrorContains(t, err, "invalid time zone")
+	loc, err := LoadTimeZone("")
+	require.NoError(t, err)
+	assert.Equal(t, time.Local, loc)
+}
+
+func TestSyncSchedule_Localize(t *testing.T) {
+	next := time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC)
+	schedule := &SyncSchedule{NextRun: &next}
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	require.NoError(t, err)
+
+	schedule.Localize(belgrade)
+	assert.Nil(t, schedule.LastRunLocal)
+	require.NotNil(t, schedule.NextRunLocal)
+	// Clocks went forward at 01:00 UTC that night
+	assert.Equal(t, "2026-03-29T03:30:00+02:00", schedule.NextRunLocal.Format(time.RFC3339))
+	assert.Equal(t, "2026-03-29T01:30:00Z", schedule.NextRun.Format(time.RFC3339))
+	assert.Equal(t, "Europe/Belgrade", schedule.DisplayTimeZone)
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"catalogizer/database"
@@ -203,6 +205,44 @@ func (r *AnalyticsRepository) GetUserMediaAccessLogs(userID int, startDate, endD
 	return r.scanMediaAccessLogs(rows)
 }
 
+// GetMediaItemAccessLogs returns the access logs of one media item
+// between startDate and endDate, oldest first.
+func (r *AnalyticsRepository) GetMediaItemAccessLogs(mediaID int, startDate, endDate time.Time) ([]models.MediaAccessLog, error) {
+	query := `
+		SELECT id, user_id, media_id, action, device_info, location, ip_address,
+			   user_agent, playback_duration, access_time
+		FROM media_access_logs
+		WHERE media_id = ? AND access_time BETWEEN ? AND ?
+		ORDER BY access_time ASC
+	`
+
+	rows, err := r.db.Query(query, mediaID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media item access logs: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanMediaAccessLogs(rows)
+}
+
+// GetMediaItemRuntime returns the runtime of a media item in minutes, or
+// nil when it is unknown. Items in the recycle bin are not found.
+func (r *AnalyticsRepository) GetMediaItemRuntime(mediaID int) (*int, error) {
+	var runtime sql.NullInt64
+	err := r.db.QueryRow(`SELECT runtime FROM media_items WHERE id = ? AND deleted_at IS NULL`, mediaID).Scan(&runtime)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("media item %d not found", mediaID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media item runtime: %w", err)
+	}
+	if !runtime.Valid || runtime.Int64 <= 0 {
+		return nil, nil
+	}
+	minutes := int(runtime.Int64)
+	return &minutes, nil
+}
+
 func (r *AnalyticsRepository) GetUserEvents(userID int, startDate, endDate time.Time) ([]models.AnalyticsEvent, error) {
 	query := `
 		SELECT id, user_id, event_type, event_category, data, device_info, location,
@@ -553,3 +593,527 @@ func (r *AnalyticsRepository) scanAnalyticsEvents(rows *sql.Rows) ([]models.Anal
 
 	return events, nil
 }
+
+// LogEvents stores a batch of events in one transaction, so a client's
+// offline queue is either recorded whole or not at all.
+func (r *AnalyticsRepository) LogEvents(events []*models.AnalyticsEvent) error {
+	query := r.db.Dialect().RewritePlaceholders(`
+		INSERT INTO analytics_events (user_id, event_type, event_category, data,
+									 device_info, location, ip_address, user_agent, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, event := range events {
+		var deviceInfoJSON, locationJSON *string
+		if event.DeviceInfo != nil {
+			data, err := json.Marshal(event.DeviceInfo)
+			if err != nil {
+				return fmt.Errorf("failed to marshal device info: %w", err)
+			}
+			deviceInfoStr := string(data)
+			deviceInfoJSON = &deviceInfoStr
+		}
+		if event.Location != nil {
+			data, err := json.Marshal(event.Location)
+			if err != nil {
+				return fmt.Errorf("failed to marshal location: %w", err)
+			}
+			locationStr := string(data)
+			locationJSON = &locationStr
+		}
+
+		if _, err := tx.Exec(query,
+			event.UserID, event.EventType, event.EventCategory, event.Data,
+			deviceInfoJSON, locationJSON, event.IPAddress, event.UserAgent, event.Timestamp); err != nil {
+			return fmt.Errorf("failed to log event: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// analyticsBucketLayout is the text form bucketExpr gives bucket starts.
+const analyticsBucketLayout = "2006-01-02 15:04:05"
+
+// bucketExpr returns SQL truncating column to the start of its hour, day,
+// week (starting Monday) or month, formatted as analyticsBucketLayout.
+func (r *AnalyticsRepository) bucketExpr(column, bucket string) (string, error) {
+	if r.db.Dialect().IsPostgres() {
+		switch bucket {
+		case models.AnalyticsBucketHour, models.AnalyticsBucketDay, models.AnalyticsBucketWeek, models.AnalyticsBucketMonth:
+			return fmt.Sprintf("to_char(date_trunc('%s', %s), 'YYYY-MM-DD HH24:MI:SS')", bucket, column), nil
+		}
+		return "", fmt.Errorf("invalid bucket: %q", bucket)
+	}
+
+	switch bucket {
+	case models.AnalyticsBucketHour:
+		return "strftime('%Y-%m-%d %H:00:00', " + column + ")", nil
+	case models.AnalyticsBucketDay:
+		return "strftime('%Y-%m-%d 00:00:00', " + column + ")", nil
+	case models.AnalyticsBucketWeek:
+		// 'weekday 0' moves forward to Sunday, six days back is Monday
+		return "strftime('%Y-%m-%d 00:00:00', " + column + ", 'weekday 0', '-6 days')", nil
+	case models.AnalyticsBucketMonth:
+		return "strftime('%Y-%m-01 00:00:00', " + column + ")", nil
+	}
+	return "", fmt.Errorf("invalid bucket: %q", bucket)
+}
+
+// GetEventTimeline counts analytics events per bucket between startDate
+// and endDate. userID > 0 limits it to one user and a non-empty
+// eventTypes to those types.
+func (r *AnalyticsRepository) GetEventTimeline(startDate, endDate time.Time, bucket string, userID int, eventTypes []string) ([]models.TimeBucketCount, error) {
+	where := "timestamp BETWEEN ? AND ?"
+	args := []interface{}{startDate, endDate}
+	if userID > 0 {
+		where += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if len(eventTypes) > 0 {
+		placeholders := strings.Repeat("?,", len(eventTypes))
+		where += " AND event_type IN (" + placeholders[:len(placeholders)-1] + ")"
+		for _, eventType := range eventTypes {
+			args = append(args, eventType)
+		}
+	}
+	return r.timeline("analytics_events", "timestamp", bucket, where, args)
+}
+
+// GetAccessTimeline counts media accesses per bucket between startDate
+// and endDate. userID > 0 limits it to one user.
+func (r *AnalyticsRepository) GetAccessTimeline(startDate, endDate time.Time, bucket string, userID int) ([]models.TimeBucketCount, error) {
+	where := "access_time BETWEEN ? AND ?"
+	args := []interface{}{startDate, endDate}
+	if userID > 0 {
+		where += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	return r.timeline("media_access_logs", "access_time", bucket, where, args)
+}
+
+// timeline groups the rows of table matching where by the bucket of
+// timeColumn, counting rows and distinct users per bucket. Empty buckets
+// are left out.
+func (r *AnalyticsRepository) timeline(table, timeColumn, bucket, where string, args []interface{}) ([]models.TimeBucketCount, error) {
+	expr, err := r.bucketExpr(timeColumn, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s as bucket_start, COUNT(*), COUNT(DISTINCT user_id)
+		FROM %s
+		WHERE %s
+		GROUP BY bucket_start
+		ORDER BY bucket_start ASC
+	`, expr, table, where)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s timeline: %w", table, err)
+	}
+	defer rows.Close()
+
+	results := []models.TimeBucketCount{}
+	for rows.Next() {
+		var result models.TimeBucketCount
+		var bucketStr string
+		if err := rows.Scan(&bucketStr, &result.Count, &result.UniqueUsers); err != nil {
+			return nil, fmt.Errorf("failed to scan timeline bucket: %w", err)
+		}
+		result.BucketStart, err = time.Parse(analyticsBucketLayout, bucketStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bucket: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// GetEventTypeCounts returns the number of events of each type between
+// startDate and endDate. userID > 0 limits it to one user.
+func (r *AnalyticsRepository) GetEventTypeCounts(startDate, endDate time.Time, userID int) (map[string]int, error) {
+	query := `
+		SELECT event_type, COUNT(*)
+		FROM analytics_events
+		WHERE timestamp BETWEEN ? AND ?
+	`
+	args := []interface{}{startDate, endDate}
+	if userID > 0 {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	query += " GROUP BY event_type"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event type counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var eventType string
+		var count int
+		if err := rows.Scan(&eventType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan event type count: %w", err)
+		}
+		counts[eventType] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountActiveUsers counts the users who reported an event or accessed
+// media between startDate and endDate.
+func (r *AnalyticsRepository) CountActiveUsers(startDate, endDate time.Time) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT user_id) FROM (
+			SELECT user_id FROM analytics_events
+			WHERE timestamp BETWEEN ? AND ? AND user_id > 0
+			UNION
+			SELECT user_id FROM media_access_logs
+			WHERE access_time BETWEEN ? AND ?
+		) active_users
+	`
+	var count int
+	err := r.db.QueryRow(query, startDate, endDate, startDate, endDate).Scan(&count)
+	return count, err
+}
+
+// CountCurrentStreams counts the distinct user and media pairs with a play
+// or stream access since the given time.
+func (r *AnalyticsRepository) CountCurrentStreams(since time.Time) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT DISTINCT user_id, media_id FROM media_access_logs
+			WHERE access_time >= ? AND action IN ('play', 'stream')
+		) current_streams
+	`
+	var count int
+	err := r.db.QueryRow(query, since).Scan(&count)
+	return count, err
+}
+
+// GetTotalMediaItems counts the media items that are not in the recycle
+// bin.
+func (r *AnalyticsRepository) GetTotalMediaItems() (int64, error) {
+	var count int64
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM media_items WHERE deleted_at IS NULL`).Scan(&count)
+	return count, err
+}
+
+// GetTotalStorageUsed sums the size of every file still present in the
+// storage roots.
+func (r *AnalyticsRepository) GetTotalStorageUsed() (int64, error) {
+	var total int64
+	err := r.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM files WHERE deleted = 0`).Scan(&total)
+	return total, err
+}
+
+// GetRollupWatermark returns the time up to which both analytics_events
+// and media_access_logs have been rolled up into the hourly rollup
+// tables, or nil while either has not been rolled up yet.
+func (r *AnalyticsRepository) GetRollupWatermark() (*time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT rolled_up_until FROM analytics_retention_policies
+		WHERE table_name IN ('analytics_events', 'media_access_logs')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollup watermark: %w", err)
+	}
+	defer rows.Close()
+
+	var watermark *time.Time
+	tables := 0
+	for rows.Next() {
+		var until sql.NullTime
+		if err := rows.Scan(&until); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup watermark: %w", err)
+		}
+		if !until.Valid {
+			return nil, rows.Err()
+		}
+		if watermark == nil || until.Time.Before(*watermark) {
+			t := until.Time
+			watermark = &t
+		}
+		tables++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if tables < 2 {
+		return nil, nil
+	}
+	return watermark, nil
+}
+
+// rawEdges returns the condition selecting the raw rows of a range that
+// the rollups do not cover: [startDate, rollupStart) and
+// [rollupEnd, endDate]. The rollups cover [rollupStart, rollupEnd).
+func rawEdges(column string, startDate, endDate, rollupStart, rollupEnd time.Time) (string, []interface{}) {
+	where := fmt.Sprintf("((%s >= ? AND %s < ?) OR (%s >= ? AND %s <= ?))", column, column, column, column)
+	return where, []interface{}{startDate, rollupStart, rollupEnd, endDate}
+}
+
+// GetEventTimelineWithRollups is GetEventTimeline for all users, reading
+// the hours in [rollupStart, rollupEnd) from the hourly rollups and the
+// rest of the range from analytics_events.
+func (r *AnalyticsRepository) GetEventTimelineWithRollups(startDate, endDate, rollupStart, rollupEnd time.Time, bucket string, eventTypes []string) ([]models.TimeBucketCount, error) {
+	return r.rollupTimeline("analytics_events", "timestamp", "event_type", startDate, endDate, rollupStart, rollupEnd, bucket, eventTypes)
+}
+
+// GetAccessTimelineWithRollups is GetAccessTimeline for all users,
+// reading the hours in [rollupStart, rollupEnd) from the hourly rollups.
+func (r *AnalyticsRepository) GetAccessTimelineWithRollups(startDate, endDate, rollupStart, rollupEnd time.Time, bucket string) ([]models.TimeBucketCount, error) {
+	return r.rollupTimeline("media_access_logs", "access_time", "action", startDate, endDate, rollupStart, rollupEnd, bucket, nil)
+}
+
+// rollupTimeline counts the rows and distinct users of table per bucket,
+// summing analytics_hourly_rollups and analytics_hourly_users over
+// [rollupStart, rollupEnd) and the raw rows elsewhere. A non-empty
+// dimensions limits it to those values of dimensionColumn.
+func (r *AnalyticsRepository) rollupTimeline(table, timeColumn, dimensionColumn string, startDate, endDate, rollupStart, rollupEnd time.Time, bucket string, dimensions []string) ([]models.TimeBucketCount, error) {
+	expr, err := r.bucketExpr("t", bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	rollupWhere := "source_table = ? AND bucket_start >= ? AND bucket_start < ?"
+	rollupArgs := []interface{}{table, rollupStart, rollupEnd}
+	rawWhere, rawArgs := rawEdges(timeColumn, startDate, endDate, rollupStart, rollupEnd)
+	if len(dimensions) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(dimensions)), ", ")
+		rollupWhere += " AND dimension IN (" + placeholders + ")"
+		rawWhere += " AND " + dimensionColumn + " IN (" + placeholders + ")"
+		for _, dimension := range dimensions {
+			rollupArgs = append(rollupArgs, dimension)
+			rawArgs = append(rawArgs, dimension)
+		}
+	}
+	args := append(append([]interface{}{}, rollupArgs...), rawArgs...)
+
+	buckets := make(map[string]*models.TimeBucketCount)
+	var order []string
+	collect := func(query, what string, apply func(*models.TimeBucketCount, int)) error {
+		rows, err := r.db.Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s: %w", table, what, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bucketStr string
+			var value int
+			if err := rows.Scan(&bucketStr, &value); err != nil {
+				return fmt.Errorf("failed to scan timeline bucket: %w", err)
+			}
+			result, ok := buckets[bucketStr]
+			if !ok {
+				start, err := time.Parse(analyticsBucketLayout, bucketStr)
+				if err != nil {
+					return fmt.Errorf("failed to parse bucket: %w", err)
+				}
+				result = &models.TimeBucketCount{BucketStart: start}
+				buckets[bucketStr] = result
+				order = append(order, bucketStr)
+			}
+			apply(result, value)
+		}
+		return rows.Err()
+	}
+
+	countQuery := fmt.Sprintf(`
+		SELECT %s as bucket_start, SUM(c) FROM (
+			SELECT bucket_start AS t, event_count AS c FROM analytics_hourly_rollups WHERE %s
+			UNION ALL
+			SELECT %s AS t, 1 AS c FROM %s WHERE %s
+		) counted
+		GROUP BY bucket_start
+	`, expr, rollupWhere, timeColumn, table, rawWhere)
+	if err := collect(countQuery, "timeline", func(b *models.TimeBucketCount, v int) { b.Count = v }); err != nil {
+		return nil, err
+	}
+
+	userQuery := fmt.Sprintf(`
+		SELECT %s as bucket_start, COUNT(DISTINCT user_id) FROM (
+			SELECT bucket_start AS t, user_id FROM analytics_hourly_users WHERE %s
+			UNION ALL
+			SELECT %s AS t, user_id FROM %s WHERE %s AND user_id > 0
+		) active
+		GROUP BY bucket_start
+	`, expr, rollupWhere, timeColumn, table, rawWhere)
+	if err := collect(userQuery, "timeline users", func(b *models.TimeBucketCount, v int) { b.UniqueUsers = v }); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(order)
+	results := make([]models.TimeBucketCount, 0, len(order))
+	for _, key := range order {
+		results = append(results, *buckets[key])
+	}
+	return results, nil
+}
+
+// GetEventTypeCountsWithRollups is GetEventTypeCounts for all users,
+// reading the hours in [rollupStart, rollupEnd) from the hourly rollups.
+func (r *AnalyticsRepository) GetEventTypeCountsWithRollups(startDate, endDate, rollupStart, rollupEnd time.Time) (map[string]int, error) {
+	rawWhere, rawArgs := rawEdges("timestamp", startDate, endDate, rollupStart, rollupEnd)
+	query := fmt.Sprintf(`
+		SELECT event_type, SUM(c) FROM (
+			SELECT dimension AS event_type, event_count AS c FROM analytics_hourly_rollups
+			WHERE source_table = 'analytics_events' AND bucket_start >= ? AND bucket_start < ?
+			UNION ALL
+			SELECT event_type, 1 AS c FROM analytics_events WHERE %s
+		) counted
+		GROUP BY event_type
+	`, rawWhere)
+	args := append([]interface{}{rollupStart, rollupEnd}, rawArgs...)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event type counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var eventType string
+		var count int
+		if err := rows.Scan(&eventType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan event type count: %w", err)
+		}
+		counts[eventType] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountActiveUsersWithRollups is CountActiveUsers reading the hours in
+// [rollupStart, rollupEnd) from analytics_hourly_users.
+func (r *AnalyticsRepository) CountActiveUsersWithRollups(startDate, endDate, rollupStart, rollupEnd time.Time) (int, error) {
+	eventWhere, eventArgs := rawEdges("timestamp", startDate, endDate, rollupStart, rollupEnd)
+	accessWhere, accessArgs := rawEdges("access_time", startDate, endDate, rollupStart, rollupEnd)
+	query := fmt.Sprintf(`
+		SELECT COUNT(DISTINCT user_id) FROM (
+			SELECT user_id FROM analytics_hourly_users
+			WHERE bucket_start >= ? AND bucket_start < ?
+			UNION
+			SELECT user_id FROM analytics_events WHERE %s AND user_id > 0
+			UNION
+			SELECT user_id FROM media_access_logs WHERE %s
+		) active_users
+	`, eventWhere, accessWhere)
+	args := append([]interface{}{rollupStart, rollupEnd}, eventArgs...)
+	args = append(args, accessArgs...)
+
+	var count int
+	err := r.db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// GetTopAccessedMediaWithRollups is GetTopAccessedMedia reading the hours
+// in [rollupStart, rollupEnd) from analytics_hourly_media.
+func (r *AnalyticsRepository) GetTopAccessedMediaWithRollups(startDate, endDate, rollupStart, rollupEnd time.Time, limit int) ([]models.MediaAccessCount, error) {
+	rawWhere, rawArgs := rawEdges("access_time", startDate, endDate, rollupStart, rollupEnd)
+	query := fmt.Sprintf(`
+		SELECT media_id, SUM(c) as access_count FROM (
+			SELECT media_id, access_count AS c FROM analytics_hourly_media
+			WHERE bucket_start >= ? AND bucket_start < ?
+			UNION ALL
+			SELECT media_id, 1 AS c FROM media_access_logs WHERE %s
+		) counted
+		GROUP BY media_id
+		ORDER BY access_count DESC, media_id ASC
+		LIMIT ?
+	`, rawWhere)
+	args := append([]interface{}{rollupStart, rollupEnd}, rawArgs...)
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top accessed media: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.MediaAccessCount
+	for rows.Next() {
+		var result models.MediaAccessCount
+		if err := rows.Scan(&result.MediaID, &result.AccessCount); err != nil {
+			return nil, fmt.Errorf("failed to scan media access count: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// GetStorageGrowth returns the daily storage snapshots between startDate
+// and endDate, summed over the storage roots.
+func (r *AnalyticsRepository) GetStorageGrowth(startDate, endDate time.Time) ([]models.StorageGrowthPoint, error) {
+	rows, err := r.db.Query(`
+		SELECT day, SUM(file_count), SUM(total_bytes)
+		FROM storage_daily_usage
+		WHERE day >= ? AND day <= ?
+		GROUP BY day
+		ORDER BY day ASC
+	`, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage growth: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.StorageGrowthPoint{}
+	for rows.Next() {
+		var point models.StorageGrowthPoint
+		if err := rows.Scan(&point.Date, &point.FileCount, &point.TotalBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan storage growth: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+// GetLatestStorageUsage returns the total size of the most recent daily
+// storage snapshot and when its oldest root was captured, or a nil time
+// when no snapshot has been taken yet.
+func (r *AnalyticsRepository) GetLatestStorageUsage() (int64, *time.Time, error) {
+	var day time.Time
+	err := r.db.QueryRow(`SELECT day FROM storage_daily_usage ORDER BY day DESC LIMIT 1`).Scan(&day)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get latest storage snapshot: %w", err)
+	}
+
+	rows, err := r.db.Query(`SELECT total_bytes, captured_at FROM storage_daily_usage WHERE day = ?`, day)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get latest storage snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	var total int64
+	var asOf *time.Time
+	for rows.Next() {
+		var bytes int64
+		var captured time.Time
+		if err := rows.Scan(&bytes, &captured); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan storage snapshot: %w", err)
+		}
+		total += bytes
+		if asOf == nil || captured.Before(*asOf) {
+			asOf = &captured
+		}
+	}
+	return total, asOf, rows.Err()
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"math"
 	"testing"
 	"time"
 
@@ -851,3 +852,316 @@ func TestAnalyticsRepository_GetGeographicData_Real(t *testing.T) {
 		assert.Nil(t, locations)
 	})
 }
+
+// ---------------------------------------------------------------------------
+// Timelines and dashboard counts
+// ---------------------------------------------------------------------------
+
+func seedTimelineData(t *testing.T, repo *AnalyticsRepository) time.Time {
+	t.Helper()
+	// Wednesday 4 March 2026
+	base := time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)
+
+	events := []*models.AnalyticsEvent{
+		{UserID: 1, EventType: "play", EventCategory: "playback", Timestamp: base},
+		{UserID: 2, EventType: "play", EventCategory: "playback", Timestamp: base.Add(10 * time.Minute)},
+		{UserID: 1, EventType: "search", EventCategory: "navigation", Timestamp: base.Add(2 * time.Hour)},
+		{UserID: 1, EventType: "play", EventCategory: "playback", Timestamp: base.Add(48 * time.Hour)},
+		{UserID: 2, EventType: "search", EventCategory: "navigation", Timestamp: base.Add(7 * 24 * time.Hour)},
+	}
+	require.NoError(t, repo.LogEvents(events))
+
+	logs := []models.MediaAccessLog{
+		{UserID: 3, MediaID: 10, Action: "play", AccessTime: base.Add(time.Hour)},
+		{UserID: 3, MediaID: 10, Action: "play", AccessTime: base.Add(time.Hour + time.Minute)},
+		{UserID: 1, MediaID: 11, Action: "view", AccessTime: base.Add(time.Hour)},
+	}
+	for _, log := range logs {
+		require.NoError(t, repo.LogMediaAccess(&log))
+	}
+
+	return base
+}
+
+func TestAnalyticsRepository_GetEventTimeline_Real(t *testing.T) {
+	repo := newRealAnalyticsRepo(t)
+	base := seedTimelineData(t, repo)
+	start, end := base.Add(-time.Hour), base.Add(8*24*time.Hour)
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	t.Run("daily buckets", func(t *testing.T) {
+		timeline, err := repo.GetEventTimeline(start, end, models.AnalyticsBucketDay, 0, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []models.TimeBucketCount{
+			{BucketStart: day(4), Count: 3, UniqueUsers: 2},
+			{BucketStart: day(6), Count: 1, UniqueUsers: 1},
+			{BucketStart: day(11), Count: 1, UniqueUsers: 1},
+		}, timeline)
+	})
+
+	t.Run("weeks start on Monday", func(t *testing.T) {
+		timeline, err := repo.GetEventTimeline(start, end, models.AnalyticsBucketWeek, 0, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []models.TimeBucketCount{
+			{BucketStart: day(2), Count: 4, UniqueUsers: 2},
+			{BucketStart: day(9), Count: 1, UniqueUsers: 1},
+		}, timeline)
+	})
+
+	t.Run("monthly buckets", func(t *testing.T) {
+		timeline, err := repo.GetEventTimeline(start, end, models.AnalyticsBucketMonth, 0, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []models.TimeBucketCount{{BucketStart: day(1), Count: 5, UniqueUsers: 2}}, timeline)
+	})
+
+	t.Run("hourly buckets for one user", func(t *testing.T) {
+		timeline, err := repo.GetEventTimeline(start, end, models.AnalyticsBucketHour, 1, nil)
+		require.NoError(t, err)
+		require.Len(t, timeline, 3)
+		assert.Equal(t, time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC), timeline[0].BucketStart)
+		assert.Equal(t, time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC), timeline[1].BucketStart)
+		assert.Equal(t, time.Date(2026, 3, 6, 10, 0, 0, 0, time.UTC), timeline[2].BucketStart)
+	})
+
+	t.Run("filtered by event type", func(t *testing.T) {
+		timeline, err := repo.GetEventTimeline(start, end, models.AnalyticsBucketDay, 0, []string{"search"})
+		require.NoError(t, err)
+		require.Len(t, timeline, 2)
+		assert.Equal(t, day(4), timeline[0].BucketStart)
+		assert.Equal(t, day(11), timeline[1].BucketStart)
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		timeline, err := repo.GetEventTimeline(start.Add(-48*time.Hour), start, models.AnalyticsBucketDay, 0, nil)
+		require.NoError(t, err)
+		assert.Empty(t, timeline)
+	})
+
+	t.Run("unknown bucket", func(t *testing.T) {
+		_, err := repo.GetEventTimeline(start, end, "minute", 0, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid bucket")
+	})
+}
+
+func TestAnalyticsRepository_DashboardCounts_Real(t *testing.T) {
+	repo := newRealAnalyticsRepo(t)
+	base := seedTimelineData(t, repo)
+
+	timeline, err := repo.GetAccessTimeline(base.Add(-time.Hour), base.Add(3*time.Hour), models.AnalyticsBucketHour, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeBucketCount{
+		{BucketStart: time.Date(2026, 3, 4, 11, 0, 0, 0, time.UTC), Count: 3, UniqueUsers: 2},
+	}, timeline)
+
+	counts, err := repo.GetEventTypeCounts(base.Add(-time.Hour), base.Add(8*24*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"play": 3, "search": 2}, counts)
+	counts, err = repo.GetEventTypeCounts(base.Add(-time.Hour), base.Add(8*24*time.Hour), 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"play": 1, "search": 1}, counts)
+
+	active, err := repo.CountActiveUsers(base.Add(-time.Hour), base.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, active)
+
+	streams, err := repo.CountCurrentStreams(base)
+	require.NoError(t, err)
+	assert.Equal(t, 1, streams)
+
+	_, err = repo.db.Exec(`CREATE TABLE media_items (id INTEGER PRIMARY KEY, title TEXT, deleted_at DATETIME)`)
+	require.NoError(t, err)
+	_, err = repo.db.Exec(`INSERT INTO media_items (title, deleted_at) VALUES ('Heat', NULL), ('Alien', NULL), ('Gone', ?)`, base)
+	require.NoError(t, err)
+	items, err := repo.GetTotalMediaItems()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), items)
+
+	_, err = repo.db.Exec(`CREATE TABLE files (id INTEGER PRIMARY KEY, size INTEGER NOT NULL, deleted BOOLEAN DEFAULT 0)`)
+	require.NoError(t, err)
+	used, err := repo.GetTotalStorageUsed()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), used)
+	_, err = repo.db.Exec(`INSERT INTO files (size, deleted) VALUES (100, 0), (50, 0), (999, 1)`)
+	require.NoError(t, err)
+	used, err = repo.GetTotalStorageUsed()
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), used)
+}
+
+func TestAnalyticsRepository_MediaItemStats_Real(t *testing.T) {
+	repo := newRealAnalyticsRepo(t)
+	now := seedAnalyticsData(t, repo)
+
+	logs, err := repo.GetMediaItemAccessLogs(10, now.Add(-24*time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, 2, logs[0].UserID, "oldest first")
+	logs, err = repo.GetMediaItemAccessLogs(10, now.Add(-2*time.Hour), now)
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+
+	_, err = repo.db.Exec(`CREATE TABLE media_items (id INTEGER PRIMARY KEY, runtime INTEGER, deleted_at DATETIME)`)
+	require.NoError(t, err)
+	_, err = repo.db.Exec(`INSERT INTO media_items (id, runtime, deleted_at) VALUES (10, 120, NULL), (11, NULL, NULL), (12, 90, ?)`, now)
+	require.NoError(t, err)
+	runtime, err := repo.GetMediaItemRuntime(10)
+	require.NoError(t, err)
+	require.NotNil(t, runtime)
+	assert.Equal(t, 120, *runtime)
+	runtime, err = repo.GetMediaItemRuntime(11)
+	require.NoError(t, err)
+	assert.Nil(t, runtime)
+	_, err = repo.GetMediaItemRuntime(12)
+	assert.ErrorContains(t, err, "not found", "items in the recycle bin")
+}
+
+func TestAnalyticsRepository_Rollups_Real(t *testing.T) {
+	repo := newRealAnalyticsRepo(t)
+	base := seedTimelineData(t, repo)
+	hour := func(d, h int) time.Time { return time.Date(2026, 3, d, h, 0, 0, 0, time.UTC) }
+
+	for _, stmt := range []string{
+		`CREATE TABLE analytics_retention_policies (table_name TEXT PRIMARY KEY, rolled_up_until DATETIME)`,
+		`CREATE TABLE analytics_hourly_rollups (source_table TEXT, bucket_start DATETIME, dimension TEXT, event_count INTEGER)`,
+		`CREATE TABLE analytics_hourly_users (bucket_start DATETIME, source_table TEXT, dimension TEXT, user_id INTEGER)`,
+		`CREATE TABLE analytics_hourly_media (bucket_start DATETIME, media_id INTEGER, access_count INTEGER)`,
+		`CREATE TABLE storage_daily_usage (day DATETIME, storage_root_id INTEGER, file_count INTEGER, total_bytes INTEGER, captured_at DATETIME)`,
+	} {
+		_, err := repo.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	t.Run("watermark needs both tables", func(t *testing.T) {
+		watermark, err := repo.GetRollupWatermark()
+		require.NoError(t, err)
+		assert.Nil(t, watermark)
+
+		_, err = repo.db.Exec(`INSERT INTO analytics_retention_policies VALUES ('analytics_events', ?)`, hour(4, 14))
+		require.NoError(t, err)
+		watermark, err = repo.GetRollupWatermark()
+		require.NoError(t, err)
+		assert.Nil(t, watermark)
+
+		_, err = repo.db.Exec(`INSERT INTO analytics_retention_policies VALUES ('media_access_logs', ?)`, hour(4, 13))
+		require.NoError(t, err)
+		watermark, err = repo.GetRollupWatermark()
+		require.NoError(t, err)
+		require.NotNil(t, watermark)
+		assert.Equal(t, hour(4, 13), watermark.UTC())
+	})
+
+	// The rollups of 11:00 and 12:00 deliberately disagree with the raw
+	// rows of those hours, so the assertions show which one was read
+	for _, row := range []struct {
+		table, dimension string
+		at               time.Time
+		count            int
+		users            []int
+	}{
+		{"analytics_events", "search", hour(4, 12), 5, []int{1, 4}},
+		{"media_access_logs", "play", hour(4, 11), 4, []int{3}},
+		{"media_access_logs", "view", hour(4, 11), 1, []int{1}},
+	} {
+		_, err := repo.db.Exec(`INSERT INTO analytics_hourly_rollups VALUES (?, ?, ?, ?)`, row.table, row.at, row.dimension, row.count)
+		require.NoError(t, err)
+		for _, user := range row.users {
+			_, err = repo.db.Exec(`INSERT INTO analytics_hourly_users VALUES (?, ?, ?, ?)`, row.at, row.table, row.dimension, user)
+			require.NoError(t, err)
+		}
+	}
+	_, err := repo.db.Exec(`INSERT INTO analytics_hourly_media VALUES (?, 10, 4), (?, 11, 1)`, hour(4, 11), hour(4, 11))
+	require.NoError(t, err)
+
+	start, end := base.Add(-time.Hour), base.Add(8*24*time.Hour)
+	rollupStart, rollupEnd := hour(4, 11), hour(4, 13)
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	timeline, err := repo.GetEventTimelineWithRollups(start, end, rollupStart, rollupEnd, models.AnalyticsBucketDay, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeBucketCount{
+		{BucketStart: day(4), Count: 7, UniqueUsers: 3},
+		{BucketStart: day(6), Count: 1, UniqueUsers: 1},
+		{BucketStart: day(11), Count: 1, UniqueUsers: 1},
+	}, timeline)
+
+	timeline, err = repo.GetEventTimelineWithRollups(start, end, rollupStart, rollupEnd, models.AnalyticsBucketDay, []string{"search"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeBucketCount{
+		{BucketStart: day(4), Count: 5, UniqueUsers: 2},
+		{BucketStart: day(11), Count: 1, UniqueUsers: 1},
+	}, timeline)
+
+	timeline, err = repo.GetAccessTimelineWithRollups(start, base.Add(3*time.Hour), rollupStart, rollupEnd, models.AnalyticsBucketHour)
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeBucketCount{{BucketStart: hour(4, 11), Count: 5, UniqueUsers: 2}}, timeline)
+
+	counts, err := repo.GetEventTypeCountsWithRollups(start, end, rollupStart, rollupEnd)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"play": 3, "search": 6}, counts)
+
+	active, err := repo.CountActiveUsersWithRollups(start, base.Add(3*time.Hour), rollupStart, rollupEnd)
+	require.NoError(t, err)
+	assert.Equal(t, 4, active)
+
+	top, err := repo.GetTopAccessedMediaWithRollups(start, end, rollupStart, rollupEnd, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.MediaAccessCount{{MediaID: 10, AccessCount: 4}, {MediaID: 11, AccessCount: 1}}, top)
+
+	// An empty rollup range reads the raw rows only
+	counts, err = repo.GetEventTypeCountsWithRollups(start, end, start, start)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"play": 3, "search": 2}, counts)
+
+	t.Run("storage snapshots", func(t *testing.T) {
+		used, asOf, err := repo.GetLatestStorageUsage()
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), used)
+		assert.Nil(t, asOf)
+
+		_, err = repo.db.Exec(`INSERT INTO storage_daily_usage VALUES (?, 1, 10, 1000, ?), (?, 2, 1, 50, ?), (?, 1, 12, 1200, ?), (?, 2, 1, 50, ?)`,
+			day(3), hour(3, 1), day(3), hour(3, 1), day(4), hour(4, 1), day(4), hour(4, 0))
+		require.NoError(t, err)
+
+		growth, err := repo.GetStorageGrowth(day(3), day(5))
+		require.NoError(t, err)
+		require.Len(t, growth, 2)
+		assert.Equal(t, day(3), growth[0].Date.UTC())
+		assert.Equal(t, int64(11), growth[0].FileCount)
+		assert.Equal(t, int64(1050), growth[0].TotalBytes)
+		assert.Equal(t, int64(1250), growth[1].TotalBytes)
+
+		used, asOf, err = repo.GetLatestStorageUsage()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1250), used)
+		require.NotNil(t, asOf)
+		assert.Equal(t, hour(4, 0), asOf.UTC())
+	})
+}
+
+func TestAnalyticsRepository_LogEvents_Real(t *testing.T) {
+	repo := newRealAnalyticsRepo(t)
+	now := time.Now().Truncate(time.Second)
+	ip := "10.0.0.5"
+
+	err := repo.LogEvents([]*models.AnalyticsEvent{
+		{UserID: 1, EventType: "play", EventCategory: "playback", IPAddress: &ip, Timestamp: now},
+		{UserID: 1, EventType: "pause", EventCategory: "playback", Timestamp: now},
+	})
+	require.NoError(t, err)
+
+	events, err := repo.GetUserEvents(1, now.Add(-time.Minute), now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	// A failing event rolls back the whole batch
+	err = repo.LogEvents([]*models.AnalyticsEvent{
+		{UserID: 2, EventType: "play", EventCategory: "playback", Timestamp: now},
+		{UserID: 2, EventType: "pause", Timestamp: now, Location: &models.Location{Latitude: math.NaN()}},
+	})
+	require.Error(t, err)
+	events, err = repo.GetUserEvents(2, now.Add(-time.Minute), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
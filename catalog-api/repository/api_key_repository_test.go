@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockAPIKeyRepo(t *testing.T) (*APIKeyRepository, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewAPIKeyRepository(db), mock
+}
+
+var apiKeyTestColumns = []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "created_at"}
+
+func TestAPIKeyRepository_Create(t *testing.T) {
+	repo, mock := newMockAPIKeyRepo(t)
+	key := &models.APIKey{UserID: 3, Name: "backup", Prefix: "ctlg_abcdefgh", KeyHash: "hash",
+		Scopes: models.Permissions{"media.view"}, CreatedAt: time.Now()}
+
+	mock.ExpectExec("INSERT INTO api_keys").
+		WithArgs(3, "backup", "ctlg_abcdefgh", "hash", `["media.view"]`, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+
+	require.NoError(t, repo.Create(key))
+	assert.Equal(t, 5, key.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyRepository_GetByHash(t *testing.T) {
+	repo, mock := newMockAPIKeyRepo(t)
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE key_hash").WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(apiKeyTestColumns).
+			AddRow(5, 3, "backup", "ctlg_abcdefgh", "hash", `["media.view"]`, nil, now, now))
+	key, err := repo.GetByHash("hash")
+	require.NoError(t, err)
+	assert.Equal(t, models.Permissions{"media.view"}, key.Scopes)
+	assert.Nil(t, key.ExpiresAt)
+	require.NotNil(t, key.LastUsedAt)
+
+	mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE key_hash").WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(apiKeyTestColumns))
+	_, err = repo.GetByHash("missing")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyRepository_Delete(t *testing.T) {
+	repo, mock := newMockAPIKeyRepo(t)
+
+	mock.ExpectExec("DELETE FROM api_keys").WithArgs(5, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.Delete(3, 5))
+
+	mock.ExpectExec("DELETE FROM api_keys").WithArgs(5, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.Delete(4, 5), ErrAPIKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -157,6 +157,61 @@ func (r *ConfigurationRepository) IsWizardCompleted(userID int) (bool, error) {
 	return count > 0, nil
 }
 
+// GetSetupCompletion returns when the first-run setup completed, or nil
+// while it has not.
+func (r *ConfigurationRepository) GetSetupCompletion() (*time.Time, error) {
+	var completedAt time.Time
+	err := r.db.QueryRow(`SELECT completed_at FROM setup_state WHERE id = 1`).Scan(&completedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setup state: %w", err)
+	}
+	return &completedAt, nil
+}
+
+// MarkSetupCompleted records that userID completed the first-run setup;
+// 0 stands for setup skipped at startup.
+func (r *ConfigurationRepository) MarkSetupCompleted(userID int) error {
+	now := time.Now()
+	result, err := r.db.Exec(`UPDATE setup_state SET completed_at = ?, completed_by = ? WHERE id = 1`, now, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark setup as completed: %w", err)
+	}
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		return nil
+	}
+
+	query := `INSERT INTO setup_state (id, completed_at, completed_by) VALUES (1, ?, ?)`
+	if _, err := r.db.Exec(query, now, userID); err != nil {
+		return fmt.Errorf("failed to mark setup as completed: %w", err)
+	}
+	return nil
+}
+
+// SaveStorageRoot adds a storage root configured during setup, updating
+// the root of the same name when one exists.
+func (r *ConfigurationRepository) SaveStorageRoot(ctx context.Context, root *models.StorageRoot) error {
+	var id int64
+	err := r.db.QueryRowContext(ctx, "SELECT id FROM storage_roots WHERE name = ?", root.Name).Scan(&id)
+	if err == nil {
+		_, err = r.db.ExecContext(ctx,
+			`UPDATE storage_roots SET protocol = ?, host = ?, port = ?, path = ?, username = ?, password = ?, domain = ?, updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?`,
+			root.Protocol, root.Host, root.Port, root.Path, root.Username, root.Password, root.Domain, id)
+	} else if err == sql.ErrNoRows {
+		_, err = r.db.InsertReturningID(ctx,
+			`INSERT INTO storage_roots (name, protocol, host, port, path, username, password, domain, enabled, max_depth)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			root.Name, root.Protocol, root.Host, root.Port, root.Path, root.Username, root.Password, root.Domain, true, root.MaxDepth)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save storage root: %w", err)
+	}
+	return nil
+}
+
 func (r *ConfigurationRepository) GetConfigurationHistory(limit int) ([]*models.ConfigurationHistory, error) {
 	query := `
 		SELECT id, version, created_at, updated_at
@@ -202,10 +257,10 @@ func (r *ConfigurationRepository) SaveConfigurationHistory(config *models.System
 	return nil
 }
 
-func (r *ConfigurationRepository) CreateConfigurationBackup(name string, config *models.SystemConfiguration) error {
+func (r *ConfigurationRepository) CreateConfigurationBackup(name string, config *models.SystemConfiguration) (*models.ConfigurationBackup, error) {
 	configJSON, err := json.Marshal(config)
 	if err != nil {
-		return fmt.Errorf("failed to marshal configuration: %w", err)
+		return nil, fmt.Errorf("failed to marshal configuration: %w", err)
 	}
 
 	query := `
@@ -213,12 +268,35 @@ func (r *ConfigurationRepository) CreateConfigurationBackup(name string, config
 			name, version, configuration, created_at
 		) VALUES (?, ?, ?, ?)`
 
-	_, err = r.db.Exec(query, name, config.Version, string(configJSON), time.Now())
+	backup := &models.ConfigurationBackup{Name: name, Version: config.Version, CreatedAt: time.Now()}
+	id, err := r.db.InsertReturningID(context.Background(), query, name, config.Version, string(configJSON), backup.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to create configuration backup: %w", err)
+		return nil, fmt.Errorf("failed to create configuration backup: %w", err)
 	}
 
-	return nil
+	backup.ID = int(id)
+	return backup, nil
+}
+
+// GetConfigurationBackup returns a backup with its configuration
+func (r *ConfigurationRepository) GetConfigurationBackup(backupID int) (*models.ConfigurationBackup, error) {
+	query := `
+		SELECT id, name, version, configuration, created_at
+		FROM configuration_backups
+		WHERE id = ?`
+
+	var backup models.ConfigurationBackup
+	var configJSON string
+	err := r.db.QueryRow(query, backupID).Scan(&backup.ID, &backup.Name, &backup.Version, &configJSON, &backup.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration backup: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(configJSON), &backup.Configuration); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration: %w", err)
+	}
+
+	return &backup, nil
 }
 
 func (r *ConfigurationRepository) GetConfigurationBackups() ([]*models.ConfigurationBackup, error) {
@@ -318,6 +396,29 @@ func (r *ConfigurationRepository) GetConfigurationTemplates() ([]*models.Configu
 	return templates, nil
 }
 
+// GetConfigurationTemplate returns a template
+func (r *ConfigurationRepository) GetConfigurationTemplate(templateID int) (*models.ConfigurationTemplate, error) {
+	query := `
+		SELECT id, name, description, category, configuration, created_at
+		FROM configuration_templates
+		WHERE id = ?`
+
+	var template models.ConfigurationTemplate
+	var configJSON string
+	err := r.db.QueryRow(query, templateID).Scan(
+		&template.ID, &template.Name, &template.Description,
+		&template.Category, &configJSON, &template.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration template: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(configJSON), &template.Configuration); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template configuration: %w", err)
+	}
+
+	return &template, nil
+}
+
 func (r *ConfigurationRepository) CreateConfigurationTemplate(template *models.ConfigurationTemplate) error {
 	configJSON, err := json.Marshal(template.Configuration)
 	if err != nil {
@@ -640,8 +640,9 @@ func TestConfigurationRepository_CreateConfigurationBackup_Real(t *testing.T) {
 		UpdatedAt: now,
 	}
 
-	err := repo.CreateConfigurationBackup("my-backup", config)
+	created, err := repo.CreateConfigurationBackup("my-backup", config)
 	require.NoError(t, err)
+	assert.NotZero(t, created.ID)
 
 	// Verify via GetConfigurationBackups
 	backups, err := repo.GetConfigurationBackups()
@@ -665,7 +666,7 @@ func TestConfigurationRepository_RestoreConfigurationBackup_Real(t *testing.T) {
 		UpdatedAt: now,
 	}
 
-	err := repo.CreateConfigurationBackup("restore-test", config)
+	_, err := repo.CreateConfigurationBackup("restore-test", config)
 	require.NoError(t, err)
 
 	backups, err := repo.GetConfigurationBackups()
@@ -699,11 +700,17 @@ func TestConfigurationRepository_GetAndDeleteConfigurationBackups_Real(t *testin
 	now := time.Now().Truncate(time.Second)
 	config := &models.SystemConfiguration{Version: "1.0", CreatedAt: now, UpdatedAt: now}
 
-	err := repo.CreateConfigurationBackup("b1", config)
+	_, err := repo.CreateConfigurationBackup("b1", config)
 	require.NoError(t, err)
-	err = repo.CreateConfigurationBackup("b2", config)
+	b2, err := repo.CreateConfigurationBackup("b2", config)
 	require.NoError(t, err)
 
+	backup, err := repo.GetConfigurationBackup(b2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "b2", backup.Name)
+	require.NotNil(t, backup.Configuration)
+	assert.Equal(t, "1.0", backup.Configuration.Version)
+
 	backups, err := repo.GetConfigurationBackups()
 	require.NoError(t, err)
 	assert.Len(t, backups, 2)
@@ -948,3 +955,35 @@ func TestConfigurationRepository_ConfigurationProfiles_Real(t *testing.T) {
 		assert.Empty(t, profiles)
 	})
 }
+
+// ---------------------------------------------------------------------------
+// Setup completion
+// ---------------------------------------------------------------------------
+
+func TestConfigurationRepository_SetupCompletion_Real(t *testing.T) {
+	repo := newRealConfigRepo(t)
+	_, err := repo.db.Exec(`
+		CREATE TABLE setup_state (
+			id INTEGER PRIMARY KEY,
+			completed_at DATETIME NOT NULL,
+			completed_by INTEGER NOT NULL DEFAULT 0
+		)
+	`)
+	require.NoError(t, err)
+
+	completedAt, err := repo.GetSetupCompletion()
+	require.NoError(t, err)
+	assert.Nil(t, completedAt)
+
+	require.NoError(t, repo.MarkSetupCompleted(0))
+	require.NoError(t, repo.MarkSetupCompleted(7))
+
+	var completedBy, rows int
+	require.NoError(t, repo.db.QueryRow(`SELECT COUNT(*), MAX(completed_by) FROM setup_state`).Scan(&rows, &completedBy))
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, 7, completedBy)
+
+	completedAt, err = repo.GetSetupCompletion()
+	require.NoError(t, err)
+	assert.NotNil(t, completedAt)
+}
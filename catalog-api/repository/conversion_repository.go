@@ -41,7 +41,7 @@ func (r *ConversionRepository) GetJob(jobID int) (*models.ConversionJob, error)
 	query := `
 		SELECT id, user_id, source_path, target_path, source_format, target_format,
 			   conversion_type, quality, settings, priority, status, created_at,
-			   started_at, completed_at, scheduled_for, duration, error_message
+			   started_at, completed_at, scheduled_for, duration, error_message, progress, transfer_rate
 		FROM conversion_jobs
 		WHERE id = ?
 	`
@@ -54,7 +54,7 @@ func (r *ConversionRepository) GetJob(jobID int) (*models.ConversionJob, error)
 	err := r.db.QueryRow(query, jobID).Scan(
 		&job.ID, &job.UserID, &job.SourcePath, &job.TargetPath, &job.SourceFormat, &job.TargetFormat,
 		&job.ConversionType, &job.Quality, &settings, &job.Priority, &job.Status, &job.CreatedAt,
-		&startedAt, &completedAt, &scheduledFor, &durationSeconds, &errorMessage)
+		&startedAt, &completedAt, &scheduledFor, &durationSeconds, &errorMessage, &job.Progress, &job.TransferRate)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -94,7 +94,7 @@ func (r *ConversionRepository) GetJob(jobID int) (*models.ConversionJob, error)
 func (r *ConversionRepository) UpdateJob(job *models.ConversionJob) error {
 	query := `
 		UPDATE conversion_jobs
-		SET status = ?, started_at = ?, completed_at = ?, duration = ?, error_message = ?, updated_at = ?
+		SET status = ?, started_at = ?, completed_at = ?, duration = ?, error_message = ?, progress = ?, transfer_rate = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -118,7 +118,7 @@ func (r *ConversionRepository) UpdateJob(job *models.ConversionJob) error {
 		errorMessage = sql.NullString{String: *job.ErrorMessage, Valid: true}
 	}
 
-	_, err := r.db.Exec(query, job.Status, startedAt, completedAt, durationSeconds, errorMessage, time.Now(), job.ID)
+	_, err := r.db.Exec(query, job.Status, startedAt, completedAt, durationSeconds, errorMessage, job.Progress, job.TransferRate, time.Now(), job.ID)
 	return err
 }
 
@@ -134,7 +134,7 @@ func (r *ConversionRepository) GetUserJobs(userID int, status *string, limit, of
 	query := fmt.Sprintf(`
 		SELECT id, user_id, source_path, target_path, source_format, target_format,
 			   conversion_type, quality, settings, priority, status, created_at,
-			   started_at, completed_at, scheduled_for, duration, error_message
+			   started_at, completed_at, scheduled_for, duration, error_message, progress, transfer_rate
 		FROM conversion_jobs
 		%s
 		ORDER BY created_at DESC
@@ -156,7 +156,7 @@ func (r *ConversionRepository) GetJobsByStatus(status string, limit, offset int)
 	query := `
 		SELECT id, user_id, source_path, target_path, source_format, target_format,
 			   conversion_type, quality, settings, priority, status, created_at,
-			   started_at, completed_at, scheduled_for, duration, error_message
+			   started_at, completed_at, scheduled_for, duration, error_message, progress, transfer_rate
 		FROM conversion_jobs
 		WHERE status = ?
 		ORDER BY priority DESC, created_at ASC
@@ -172,6 +172,73 @@ func (r *ConversionRepository) GetJobsByStatus(status string, limit, offset int)
 	return r.scanJobs(rows)
 }
 
+// GetRunnableJobs returns pending jobs that are due, highest priority
+// first and oldest first within a priority.
+func (r *ConversionRepository) GetRunnableJobs(now time.Time, limit int) ([]models.ConversionJob, error) {
+	query := `
+		SELECT id, user_id, source_path, target_path, source_format, target_format,
+			   conversion_type, quality, settings, priority, status, created_at,
+			   started_at, completed_at, scheduled_for, duration, error_message, progress, transfer_rate
+		FROM conversion_jobs
+		WHERE status = 'pending' AND (scheduled_for IS NULL OR scheduled_for <= ?)
+		ORDER BY priority DESC, created_at ASC, id ASC
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runnable jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanJobs(rows)
+}
+
+// ClaimJob marks a pending job as running. It returns false when the job
+// is no longer pending, because another worker claimed it or it was
+// cancelled.
+func (r *ConversionRepository) ClaimJob(jobID int, startedAt time.Time) (bool, error) {
+	query := `
+		UPDATE conversion_jobs
+		SET status = 'running', started_at = ?, progress = 0, transfer_rate = 0, updated_at = ?
+		WHERE id = ? AND status = 'pending'
+	`
+
+	result, err := r.db.Exec(query, startedAt, time.Now(), jobID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// UpdateProgress records the fraction of a job completed so far and the
+// bytes per second its output is being written at.
+func (r *ConversionRepository) UpdateProgress(jobID int, progress, transferRate float64) error {
+	query := `UPDATE conversion_jobs SET progress = ?, transfer_rate = ?, updated_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, progress, transferRate, time.Now(), jobID)
+	return err
+}
+
+// RequeueRunningJobs returns jobs left running by a previous process to
+// the queue, so they start over.
+func (r *ConversionRepository) RequeueRunningJobs() (int64, error) {
+	query := `
+		UPDATE conversion_jobs
+		SET status = 'pending', started_at = NULL, progress = 0, transfer_rate = 0, updated_at = ?
+		WHERE status = 'running'
+	`
+
+	result, err := r.db.Exec(query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue running jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 func (r *ConversionRepository) GetStatistics(userID *int, startDate, endDate time.Time) (*models.ConversionStatistics, error) {
 	whereClause := "WHERE created_at BETWEEN ? AND ?"
 	args := []interface{}{startDate, endDate}
@@ -362,7 +429,7 @@ func (r *ConversionRepository) scanJobs(rows *sql.Rows) ([]models.ConversionJob,
 		err := rows.Scan(
 			&job.ID, &job.UserID, &job.SourcePath, &job.TargetPath, &job.SourceFormat, &job.TargetFormat,
 			&job.ConversionType, &job.Quality, &settings, &job.Priority, &job.Status, &job.CreatedAt,
-			&startedAt, &completedAt, &scheduledFor, &durationSeconds, &errorMessage)
+			&startedAt, &completedAt, &scheduledFor, &durationSeconds, &errorMessage, &job.Progress, &job.TransferRate)
 
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -23,7 +23,8 @@ func newMockConversionRepo(t *testing.T) (*ConversionRepository, sqlmock.Sqlmock
 var conversionJobColumns = []string{
 	"id", "user_id", "source_path", "target_path", "source_format", "target_format",
 	"conversion_type", "quality", "settings", "priority", "status", "created_at",
-	"started_at", "completed_at", "scheduled_for", "duration", "error_message",
+	"started_at", "completed_at", "scheduled_for", "duration", "error_message", "progress",
+	"transfer_rate",
 }
 
 // ---------------------------------------------------------------------------
@@ -127,7 +128,7 @@ func TestConversionRepository_GetJob(t *testing.T) {
 				rows := sqlmock.NewRows(conversionJobColumns).
 					AddRow(1, 1, "/src.avi", "/tgt.mp4", "avi", "mp4",
 						"video", "high", nil, 1, "completed", now,
-						now, now, nil, int64(120), nil)
+						now, now, nil, int64(120), nil, 1.0, 2048.0)
 				mock.ExpectQuery("SELECT .+ FROM conversion_jobs WHERE id").
 					WithArgs(1).
 					WillReturnRows(rows)
@@ -199,7 +200,7 @@ func TestConversionRepository_UpdateJob(t *testing.T) {
 			},
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectExec("UPDATE conversion_jobs").
-					WithArgs("completed", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+					WithArgs("completed", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
@@ -251,7 +252,7 @@ func TestConversionRepository_GetJobsByStatus(t *testing.T) {
 				rows := sqlmock.NewRows(conversionJobColumns).
 					AddRow(1, 1, "/src.avi", "/tgt.mp4", "avi", "mp4",
 						"video", "high", nil, 1, "pending", now,
-						nil, nil, nil, nil, nil)
+						nil, nil, nil, nil, nil, 0.0, 0.0)
 				mock.ExpectQuery("SELECT .+ FROM conversion_jobs WHERE status").
 					WithArgs("pending", 10, 0).
 					WillReturnRows(rows)
@@ -435,7 +436,7 @@ func TestConversionRepository_GetUserJobs(t *testing.T) {
 		rows := sqlmock.NewRows(conversionJobColumns).
 			AddRow(1, 1, "/src.avi", "/tgt.mp4", "avi", "mp4",
 				"video", "high", nil, 1, "pending", now,
-				nil, nil, nil, nil, nil)
+				nil, nil, nil, nil, nil, 0.0, 0.0)
 		mock.ExpectQuery("SELECT .+ FROM conversion_jobs").
 			WithArgs(1, 10, 0).
 			WillReturnRows(rows)
@@ -452,7 +453,7 @@ func TestConversionRepository_GetUserJobs(t *testing.T) {
 		rows := sqlmock.NewRows(conversionJobColumns).
 			AddRow(1, 1, "/src.avi", "/tgt.mp4", "avi", "mp4",
 				"video", "high", nil, 1, "completed", now,
-				now, now, nil, int64(120), nil)
+				now, now, nil, int64(120), nil, 1.0, 2048.0)
 		mock.ExpectQuery("SELECT .+ FROM conversion_jobs").
 			WithArgs(1, "completed", 10, 0).
 			WillReturnRows(rows)
@@ -463,3 +464,56 @@ func TestConversionRepository_GetUserJobs(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+// ---------------------------------------------------------------------------
+// Worker queue
+// ---------------------------------------------------------------------------
+
+func TestConversionRepository_GetRunnableJobs(t *testing.T) {
+	repo, mock := newMockConversionRepo(t)
+	now := time.Now()
+	rows := sqlmock.NewRows(conversionJobColumns).
+		AddRow(2, 1, "/src.avi", "/tgt.mp4", "avi", "mp4",
+			"video", "high", nil, 5, "pending", now,
+			nil, nil, nil, nil, nil, 0.0, 0.0)
+	mock.ExpectQuery("SELECT .+ FROM conversion_jobs WHERE status = 'pending' .+ ORDER BY priority DESC").
+		WithArgs(now, 10).
+		WillReturnRows(rows)
+
+	jobs, err := repo.GetRunnableJobs(now, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 5, jobs[0].Priority)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConversionRepository_ClaimJob(t *testing.T) {
+	repo, mock := newMockConversionRepo(t)
+	mock.ExpectExec("UPDATE conversion_jobs SET status = 'running'").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE conversion_jobs SET status = 'running'").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	claimed, err := repo.ClaimJob(1, time.Now())
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	// Already claimed or cancelled
+	claimed, err = repo.ClaimJob(2, time.Now())
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConversionRepository_RequeueRunningJobs(t *testing.T) {
+	repo, mock := newMockConversionRepo(t)
+	mock.ExpectExec("UPDATE conversion_jobs SET status = 'pending'").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	count, err := repo.RequeueRunningJobs()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
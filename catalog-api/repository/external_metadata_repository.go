@@ -114,6 +114,21 @@ func (r *ExternalMetadataRepository) Upsert(ctx context.Context, em *models.Exte
 	return err
 }
 
+// Version summarizes a media item's external metadata for conditional
+// requests: how many records it has, the highest record ID and when, as a
+// Unix time, one was last fetched.
+func (r *ExternalMetadataRepository) Version(ctx context.Context, mediaItemID int64) (count, maxID, lastFetched int64, err error) {
+	fetchedExpr := "COALESCE(CAST(strftime('%s', MAX(last_fetched)) AS INTEGER), 0)"
+	if r.db.Dialect().IsPostgres() {
+		fetchedExpr = "COALESCE(EXTRACT(EPOCH FROM MAX(last_fetched))::BIGINT, 0)"
+	}
+	query := `SELECT COUNT(*), COALESCE(MAX(id), 0), ` + fetchedExpr + ` FROM external_metadata WHERE media_item_id = ?`
+	if err = r.db.QueryRowContext(ctx, query, mediaItemID).Scan(&count, &maxID, &lastFetched); err != nil {
+		return 0, 0, 0, fmt.Errorf("get external metadata version: %w", err)
+	}
+	return count, maxID, lastFetched, nil
+}
+
 // Delete removes external metadata by ID.
 func (r *ExternalMetadataRepository) Delete(ctx context.Context, id int64) error {
 	_, err := r.db.ExecContext(ctx, "DELETE FROM external_metadata WHERE id = ?", id)
@@ -183,7 +183,7 @@ func (r *FavoritesRepository) GetUserFavorites(userID int, entityType *string, c
 }
 
 func (r *FavoritesRepository) GetPublicFavorites(entityType *string, category *string, limit, offset int) ([]models.Favorite, error) {
-	whereClause := "WHERE is_public = 1"
+	whereClause := "WHERE is_public = TRUE"
 	args := []interface{}{}
 
 	if entityType != nil {
@@ -341,7 +341,7 @@ func (r *FavoritesRepository) GetSimilarFavorites(userID int, entityType string,
 	query := `
 		SELECT id, user_id, entity_type, entity_id, category, notes, tags, is_public, created_at, updated_at
 		FROM favorites
-		WHERE user_id != ? AND entity_type = ? AND is_public = 1
+		WHERE user_id != ? AND entity_type = ? AND is_public = TRUE
 		ORDER BY created_at DESC
 		LIMIT ?
 	`
@@ -439,6 +439,33 @@ func (r *FavoritesRepository) UpdateFavoriteCategory(category *models.FavoriteCa
 	return err
 }
 
+// RenameFavoritesCategory moves a user's favorites from one category name
+// to another.
+func (r *FavoritesRepository) RenameFavoritesCategory(userID int, oldName, newName string) error {
+	_, err := r.db.Exec(`UPDATE favorites SET category = ? WHERE user_id = ? AND category = ?`, newName, userID, oldName)
+	return err
+}
+
+// GetFavoriteCategoryByName returns a user's category by name, or nil when
+// there is none.
+func (r *FavoritesRepository) GetFavoriteCategoryByName(userID int, name string) (*models.FavoriteCategory, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, name, description, color, icon, is_public, created_at, updated_at
+		FROM favorite_categories
+		WHERE user_id = ? AND name = ?
+	`, userID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+	defer rows.Close()
+
+	categories, err := r.scanFavoriteCategories(rows)
+	if err != nil || len(categories) == 0 {
+		return nil, err
+	}
+	return &categories[0], nil
+}
+
 func (r *FavoritesRepository) DeleteFavoriteCategory(categoryID int) error {
 	query := `DELETE FROM favorite_categories WHERE id = ?`
 	_, err := r.db.Exec(query, categoryID)
@@ -446,7 +473,10 @@ func (r *FavoritesRepository) DeleteFavoriteCategory(categoryID int) error {
 }
 
 func (r *FavoritesRepository) CountFavoritesByCategory(categoryID int) (int, error) {
-	query := `SELECT COUNT(*) FROM favorites WHERE category = (SELECT name FROM favorite_categories WHERE id = ?)`
+	query := `
+		SELECT COUNT(*) FROM favorites f
+		JOIN favorite_categories fc ON f.category = fc.name AND f.user_id = fc.user_id
+		WHERE fc.id = ?`
 	var count int
 	err := r.db.QueryRow(query, categoryID).Scan(&count)
 	return count, err
@@ -513,15 +543,17 @@ func (r *FavoritesRepository) GetFavoriteShareByID(shareID int) (*models.Favorit
 
 func (r *FavoritesRepository) GetSharedFavorites(userID int, limit, offset int) ([]models.Favorite, error) {
 	query := `
-		SELECT f.id, f.user_id, f.entity_type, f.entity_id, f.category, f.notes, f.tags, f.is_public, f.created_at, f.updated_at
+		SELECT DISTINCT f.id, f.user_id, f.entity_type, f.entity_id, f.category, f.notes, f.tags, f.is_public, f.created_at, f.updated_at
 		FROM favorites f
 		INNER JOIN favorite_shares fs ON f.id = fs.favorite_id
-		WHERE JSON_EXTRACT(fs.shared_with, '$') LIKE ? AND fs.is_active = 1
+		WHERE ',' || REPLACE(REPLACE(fs.shared_with, '[', ''), ']', '') || ',' LIKE ? AND fs.is_active = TRUE
 		ORDER BY f.created_at DESC
 		LIMIT ? OFFSET ?
 	`
 
-	userIDPattern := fmt.Sprintf("%%\"%d\"%%", userID)
+	// shared_with is a JSON array of user ids such as [2,15]; matching
+	// ",2," against its bracketless form finds whole ids on both dialects
+	userIDPattern := fmt.Sprintf("%%,%d,%%", userID)
 
 	rows, err := r.db.Query(query, userIDPattern, limit, offset)
 	if err != nil {
@@ -533,7 +565,7 @@ func (r *FavoritesRepository) GetSharedFavorites(userID int, limit, offset int)
 }
 
 func (r *FavoritesRepository) RevokeFavoriteShare(shareID int) error {
-	query := `UPDATE favorite_shares SET is_active = 0 WHERE id = ?`
+	query := `UPDATE favorite_shares SET is_active = FALSE WHERE id = ?`
 	_, err := r.db.Exec(query, shareID)
 	return err
 }
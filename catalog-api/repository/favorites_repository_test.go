@@ -520,7 +520,7 @@ func TestFavoritesRepository_DeleteFavoriteCategory(t *testing.T) {
 
 func TestFavoritesRepository_RevokeFavoriteShare(t *testing.T) {
 	repo, mock := newMockFavoritesRepo(t)
-	mock.ExpectExec("UPDATE favorite_shares SET is_active = 0 WHERE id").
+	mock.ExpectExec("UPDATE favorite_shares SET is_active = FALSE WHERE id").
 		WithArgs(1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
@@ -873,6 +873,39 @@ func TestFavoritesRepository_CountFavoritesByCategory_Real(t *testing.T) {
 	count, err := repo.CountFavoritesByCategory(catID)
 	require.NoError(t, err)
 	assert.Equal(t, 2, count)
+
+	// Another user's category of the same name does not see user 1's favorites
+	otherID, err := repo.CreateFavoriteCategory(&models.FavoriteCategory{UserID: 2, Name: "watch", CreatedAt: now})
+	require.NoError(t, err)
+	count, err = repo.CountFavoritesByCategory(otherID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// ---------------------------------------------------------------------------
+// RenameFavoritesCategory / GetFavoriteCategoryByName
+// ---------------------------------------------------------------------------
+
+func TestFavoritesRepository_RenameFavoritesCategory_Real(t *testing.T) {
+	repo := newRealFavoritesRepo(t)
+	seedFavorites(t, repo)
+
+	_, err := repo.CreateFavoriteCategory(&models.FavoriteCategory{UserID: 1, Name: "watch", CreatedAt: time.Now()})
+	require.NoError(t, err)
+
+	cat, err := repo.GetFavoriteCategoryByName(1, "watch")
+	require.NoError(t, err)
+	require.NotNil(t, cat)
+	assert.Equal(t, "watch", cat.Name)
+
+	cat, err = repo.GetFavoriteCategoryByName(2, "watch")
+	require.NoError(t, err)
+	assert.Nil(t, cat)
+
+	require.NoError(t, repo.RenameFavoritesCategory(1, "watch", "cinema"))
+	favs, err := repo.GetUserFavorites(1, nil, strPtr("cinema"), 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, favs, 2)
 }
 
 // ---------------------------------------------------------------------------
@@ -938,9 +971,40 @@ func TestFavoritesRepository_GetFavoriteShareByID_Real(t *testing.T) {
 }
 
 // ---------------------------------------------------------------------------
-// GetSharedFavorites (uses JSON_EXTRACT, requires sqlmock)
+// GetSharedFavorites
 // ---------------------------------------------------------------------------
 
+func TestFavoritesRepository_GetSharedFavorites_Real(t *testing.T) {
+	repo := newRealFavoritesRepo(t)
+	seedFavorites(t, repo)
+
+	share := func(favoriteID int, with ...int) int {
+		id, err := repo.CreateFavoriteShare(&models.FavoriteShare{
+			FavoriteID: favoriteID, SharedByUser: 1, SharedWith: with,
+			Permissions: models.SharePermissions{CanView: true}, CreatedAt: time.Now(), IsActive: true,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	share(1, 2, 12)
+	share(1, 2)
+	revoked := share(2, 2)
+	require.NoError(t, repo.RevokeFavoriteShare(revoked))
+
+	favs, err := repo.GetSharedFavorites(2, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, favs, 1)
+	assert.Equal(t, 1, favs[0].ID)
+
+	// Ids match whole, so user 1 does not see what was shared with 12
+	favs, err = repo.GetSharedFavorites(1, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, favs)
+	favs, err = repo.GetSharedFavorites(12, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, favs, 1)
+}
+
 func TestFavoritesRepository_GetSharedFavorites_Mock(t *testing.T) {
 	now := time.Now()
 
@@ -9,6 +9,8 @@ import (
 
 	"catalogizer/database"
 	"catalogizer/models"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // FileRepository handles file-related database operations
@@ -427,20 +429,21 @@ func (r *FileRepository) applySearchFilters(baseQuery string, args []interface{}
 		baseQuery += " AND f.deleted = 0"
 	}
 
+	// Names are cataloged in NFC, whatever form a client types them in
 	if filter.Query != "" {
 		baseQuery += " AND (f.name LIKE ? OR f.path LIKE ?)"
-		searchPattern := "%" + filter.Query + "%"
+		searchPattern := "%" + norm.NFC.String(filter.Query) + "%"
 		args = append(args, searchPattern, searchPattern)
 	}
 
 	if filter.Path != "" {
 		baseQuery += " AND f.path LIKE ?"
-		args = append(args, "%"+filter.Path+"%")
+		args = append(args, "%"+norm.NFC.String(filter.Path)+"%")
 	}
 
 	if filter.Name != "" {
 		baseQuery += " AND f.name LIKE ?"
-		args = append(args, "%"+filter.Name+"%")
+		args = append(args, "%"+norm.NFC.String(filter.Name)+"%")
 	}
 
 	if filter.Extension != "" {
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+)
+
+// ErrLDAPAccountNotFound is returned for users not linked to a directory
+// entry
+var ErrLDAPAccountNotFound = errors.New("ldap account not found")
+
+// LDAPAccountRepository stores the links between users and their LDAP
+// directory entries
+type LDAPAccountRepository struct {
+	db *database.DB
+}
+
+// NewLDAPAccountRepository creates a new LDAP account repository
+func NewLDAPAccountRepository(db *database.DB) *LDAPAccountRepository {
+	return &LDAPAccountRepository{db: db}
+}
+
+const ldapAccountColumns = `user_id, dn, username, disabled_by_sync, created_at, last_login_at, last_synced_at`
+
+func scanLDAPAccount(row interface{ Scan(...interface{}) error }) (*models.LDAPAccount, error) {
+	var account models.LDAPAccount
+	var lastLoginAt, lastSyncedAt sql.NullTime
+	if err := row.Scan(&account.UserID, &account.DN, &account.Username, &account.DisabledBySync,
+		&account.CreatedAt, &lastLoginAt, &lastSyncedAt); err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		account.LastLoginAt = &lastLoginAt.Time
+	}
+	if lastSyncedAt.Valid {
+		account.LastSyncedAt = &lastSyncedAt.Time
+	}
+	return &account, nil
+}
+
+// RecordLogin links a user to a directory entry, or updates the link, and
+// records a sign-in through it
+func (r *LDAPAccountRepository) RecordLogin(userID int, dn, username string, at time.Time) error {
+	result, err := r.db.Exec(
+		`UPDATE ldap_accounts SET dn = ?, username = ?, disabled_by_sync = ?, last_login_at = ? WHERE user_id = ?`,
+		dn, username, false, at, userID)
+	if err != nil {
+		return fmt.Errorf("failed to save ldap account: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = r.db.Exec(
+		`INSERT INTO ldap_accounts (user_id, dn, username, disabled_by_sync, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, dn, username, false, at, at)
+	if err != nil {
+		return fmt.Errorf("failed to save ldap account: %w", err)
+	}
+	return nil
+}
+
+// GetByUsername returns the account linked to a directory username
+func (r *LDAPAccountRepository) GetByUsername(username string) (*models.LDAPAccount, error) {
+	account, err := scanLDAPAccount(r.db.QueryRow(
+		`SELECT `+ldapAccountColumns+` FROM ldap_accounts WHERE username = ?`, username))
+	if err == sql.ErrNoRows {
+		return nil, ErrLDAPAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ldap account: %w", err)
+	}
+	return account, nil
+}
+
+// List returns every user linked to a directory entry
+func (r *LDAPAccountRepository) List() ([]models.LDAPAccount, error) {
+	rows, err := r.db.Query(`SELECT ` + ldapAccountColumns + ` FROM ldap_accounts ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ldap accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.LDAPAccount{}
+	for rows.Next() {
+		account, err := scanLDAPAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ldap account: %w", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	return accounts, rows.Err()
+}
+
+// MarkSynced records a directory sync of an account and whether the sync
+// has it disabled
+func (r *LDAPAccountRepository) MarkSynced(userID int, dn string, disabledBySync bool, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE ldap_accounts SET dn = ?, disabled_by_sync = ?, last_synced_at = ? WHERE user_id = ?`,
+		dn, disabledBySync, at, userID)
+	return err
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"catalogizer/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LinkEvent is one click on a universal link, or an app open, store
+// fallback or error reported for it. UserID is zero for anonymous
+// visitors.
+type LinkEvent struct {
+	ID           int64                  `json:"id"`
+	TrackingID   string                 `json:"tracking_id"`
+	EventType    string                 `json:"event_type"`
+	Platform     string                 `json:"platform"`
+	UserID       int64                  `json:"user_id,omitempty"`
+	UserAgent    string                 `json:"user_agent,omitempty"`
+	IPAddress    string                 `json:"ip_address,omitempty"`
+	Success      bool                   `json:"success"`
+	AppOpened    bool                   `json:"app_opened"`
+	FallbackUsed bool                   `json:"fallback_used"`
+	ErrorMessage string                 `json:"error_message,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	OccurredAt   time.Time              `json:"occurred_at"`
+}
+
+// LinkEventSummary aggregates the events of one tracking ID. Unique
+// clicks count signed-in users once each and anonymous visitors once per
+// address and browser. Opens are events that opened the app; fallbacks
+// are visitors sent to an app store or the web app instead.
+type LinkEventSummary struct {
+	TotalClicks       int            `json:"total_clicks"`
+	UniqueClicks      int            `json:"unique_clicks"`
+	Opens             int            `json:"opens"`
+	Fallbacks         int            `json:"fallbacks"`
+	Errors            int            `json:"errors"`
+	PlatformBreakdown map[string]int `json:"platform_breakdown"`
+	FirstClickAt      *time.Time     `json:"first_click_at,omitempty"`
+	LastClickAt       *time.Time     `json:"last_click_at,omitempty"`
+}
+
+// LinkEventRepository stores deep link events. Old events are purged by
+// the analytics retention policy of link_events.
+type LinkEventRepository struct {
+	db *database.DB
+}
+
+// NewLinkEventRepository creates a new link event repository.
+func NewLinkEventRepository(db *database.DB) *LinkEventRepository {
+	return &LinkEventRepository{db: db}
+}
+
+// Insert stores an event and sets its ID.
+func (r *LinkEventRepository) Insert(ctx context.Context, event *LinkEvent) error {
+	var metadata, userID interface{}
+	if len(event.Metadata) > 0 {
+		encoded, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode link event metadata: %w", err)
+		}
+		metadata = string(encoded)
+	}
+	if event.UserID > 0 {
+		userID = event.UserID
+	}
+
+	id, err := r.db.InsertReturningID(ctx,
+		`INSERT INTO link_events (tracking_id, event_type, platform, user_id, user_agent, ip_address,
+		     success, app_opened, fallback_used, error_message, metadata, occurred_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.TrackingID, event.EventType, event.Platform, userID, event.UserAgent, event.IPAddress,
+		event.Success, event.AppOpened, event.FallbackUsed, event.ErrorMessage, metadata, event.OccurredAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert link event: %w", err)
+	}
+	event.ID = id
+	return nil
+}
+
+// Summarize aggregates the stored events of a tracking ID.
+func (r *LinkEventRepository) Summarize(ctx context.Context, trackingID string) (*LinkEventSummary, error) {
+	summary := &LinkEventSummary{PlatformBreakdown: make(map[string]int)}
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT
+		     COALESCE(SUM(CASE WHEN event_type = 'click' THEN 1 ELSE 0 END), 0),
+		     COUNT(DISTINCT CASE WHEN event_type = 'click'
+		         THEN COALESCE(CAST(user_id AS TEXT), COALESCE(ip_address, '') || '|' || COALESCE(user_agent, '')) END),
+		     COALESCE(SUM(CASE WHEN event_type = 'open' OR app_opened THEN 1 ELSE 0 END), 0),
+		     COALESCE(SUM(CASE WHEN event_type = 'fallback' OR fallback_used THEN 1 ELSE 0 END), 0),
+		     COALESCE(SUM(CASE WHEN event_type = 'error' THEN 1 ELSE 0 END), 0)
+		 FROM link_events WHERE tracking_id = ?`, trackingID).Scan(
+		&summary.TotalClicks, &summary.UniqueClicks, &summary.Opens, &summary.Fallbacks, &summary.Errors); err != nil {
+		return nil, fmt.Errorf("failed to summarize link events: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT platform, COUNT(*) FROM link_events WHERE tracking_id = ? AND event_type = 'click' GROUP BY platform`,
+		trackingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count link clicks by platform: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var platform string
+		var count int
+		if err := rows.Scan(&platform, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan link clicks by platform: %w", err)
+		}
+		summary.PlatformBreakdown[platform] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count link clicks by platform: %w", err)
+	}
+
+	if summary.FirstClickAt, err = r.clickTime(ctx, trackingID, "ASC"); err != nil {
+		return nil, err
+	}
+	if summary.LastClickAt, err = r.clickTime(ctx, trackingID, "DESC"); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// clickTime returns the time of the first or last click on a tracking ID.
+// The column is read directly rather than through MIN or MAX, which lose
+// its type in SQLite.
+func (r *LinkEventRepository) clickTime(ctx context.Context, trackingID, order string) (*time.Time, error) {
+	var at time.Time
+	err := r.db.QueryRowContext(ctx,
+		`SELECT occurred_at FROM link_events WHERE tracking_id = ? AND event_type = 'click'
+		 ORDER BY occurred_at `+order+` LIMIT 1`, trackingID).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read link click times: %w", err)
+	}
+	return &at, nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"catalogizer/database"
+
+	_ "github.com/mutecomm/go-sqlcipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRealLinkEventRepo(t *testing.T) *LinkEventRepository {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE link_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tracking_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			platform TEXT NOT NULL DEFAULT '',
+			user_id INTEGER,
+			user_agent TEXT,
+			ip_address TEXT,
+			success BOOLEAN NOT NULL DEFAULT FALSE,
+			app_opened BOOLEAN NOT NULL DEFAULT FALSE,
+			fallback_used BOOLEAN NOT NULL DEFAULT FALSE,
+			error_message TEXT,
+			metadata TEXT,
+			occurred_at DATETIME NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	return NewLinkEventRepository(database.WrapDB(sqlDB, database.DialectSQLite))
+}
+
+func TestLinkEventRepository_InsertAndSummarize(t *testing.T) {
+	repo := newRealLinkEventRepo(t)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	events := []*LinkEvent{
+		{TrackingID: "t1", EventType: "click", Platform: "android", IPAddress: "10.0.0.1", UserAgent: "a", OccurredAt: start.Add(time.Hour)},
+		{TrackingID: "t1", EventType: "click", Platform: "android", IPAddress: "10.0.0.1", UserAgent: "a", OccurredAt: start},
+		{TrackingID: "t1", EventType: "click", Platform: "web", UserID: 5, IPAddress: "10.0.0.2", OccurredAt: start.Add(2 * time.Hour)},
+		{TrackingID: "t1", EventType: "open", Platform: "android", AppOpened: true, OccurredAt: start.Add(time.Hour)},
+		{TrackingID: "t1", EventType: "error", Platform: "ios", ErrorMessage: "no app", Metadata: map[string]interface{}{"code": 3}, OccurredAt: start},
+		{TrackingID: "t2", EventType: "click", Platform: "ios", OccurredAt: start},
+	}
+	for _, event := range events {
+		require.NoError(t, repo.Insert(ctx, event))
+		assert.NotZero(t, event.ID)
+	}
+
+	summary, err := repo.Summarize(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.TotalClicks)
+	assert.Equal(t, 2, summary.UniqueClicks)
+	assert.Equal(t, 1, summary.Opens)
+	assert.Equal(t, 0, summary.Fallbacks)
+	assert.Equal(t, 1, summary.Errors)
+	assert.Equal(t, map[string]int{"android": 2, "web": 1}, summary.PlatformBreakdown)
+	require.NotNil(t, summary.FirstClickAt)
+	require.NotNil(t, summary.LastClickAt)
+	assert.True(t, start.Equal(*summary.FirstClickAt))
+	assert.True(t, start.Add(2*time.Hour).Equal(*summary.LastClickAt))
+
+	empty, err := repo.Summarize(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Zero(t, empty.TotalClicks)
+	assert.Empty(t, empty.PlatformBreakdown)
+	assert.Nil(t, empty.FirstClickAt)
+}
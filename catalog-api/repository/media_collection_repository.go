@@ -58,12 +58,12 @@ func (r *MediaCollectionRepository) Create(ctx context.Context, coll *models.Med
 
 	query := `INSERT INTO media_collections (
 		name, collection_type, description, total_items,
-		external_ids, cover_url, created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		external_ids, cover_url, created_at, updated_at, user_id
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	id, err := r.db.InsertReturningID(ctx, query,
 		coll.Name, coll.CollectionType, coll.Description, coll.TotalItems,
-		externalIDsJSON, coll.CoverURL, coll.CreatedAt, coll.UpdatedAt,
+		externalIDsJSON, coll.CoverURL, coll.CreatedAt, coll.UpdatedAt, coll.UserID,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create media collection: %w", err)
@@ -76,8 +76,8 @@ func (r *MediaCollectionRepository) Create(ctx context.Context, coll *models.Med
 // GetByID retrieves a media collection by its ID.
 func (r *MediaCollectionRepository) GetByID(ctx context.Context, id int64) (*models.MediaCollection, error) {
 	query := `SELECT id, name, collection_type, description, total_items,
-		external_ids, cover_url, created_at, updated_at
-		FROM media_collections WHERE id = ?`
+		external_ids, cover_url, created_at, updated_at, user_id
+		FROM media_collections WHERE id = ? AND deleted_at IS NULL`
 
 	row := r.db.QueryRowContext(ctx, query, id)
 	coll, err := r.scanCollection(row)
@@ -90,18 +90,18 @@ func (r *MediaCollectionRepository) GetByID(ctx context.Context, id int64) (*mod
 	return coll, nil
 }
 
-// List returns all media collections with optional pagination.
+// List returns all live media collections with optional pagination.
 func (r *MediaCollectionRepository) List(ctx context.Context, limit, offset int) ([]*models.MediaCollection, int, error) {
 	// Count total
 	var total int
-	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM media_collections").Scan(&total)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM media_collections WHERE deleted_at IS NULL").Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count media collections: %w", err)
 	}
 
 	query := `SELECT id, name, collection_type, description, total_items,
-		external_ids, cover_url, created_at, updated_at
-		FROM media_collections ORDER BY id LIMIT ? OFFSET ?`
+		external_ids, cover_url, created_at, updated_at, user_id
+		FROM media_collections WHERE deleted_at IS NULL ORDER BY id LIMIT ? OFFSET ?`
 
 	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
@@ -133,7 +133,7 @@ func (r *MediaCollectionRepository) Update(ctx context.Context, coll *models.Med
 	query := `UPDATE media_collections SET
 		name = ?, collection_type = ?, description = ?, total_items = ?,
 		external_ids = ?, cover_url = ?, updated_at = ?
-		WHERE id = ?`
+		WHERE id = ? AND deleted_at IS NULL`
 
 	result, err := r.db.ExecContext(ctx, query,
 		coll.Name, coll.CollectionType, coll.Description, coll.TotalItems,
@@ -149,19 +149,56 @@ func (r *MediaCollectionRepository) Update(ctx context.Context, coll *models.Med
 	return nil
 }
 
-// Delete removes a media collection by ID.
+// Delete soft-deletes a media collection by ID. It stays in the recycle
+// bin until it is restored or purged.
 func (r *MediaCollectionRepository) Delete(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx, "DELETE FROM media_collections WHERE id = ?", id)
+	deleted, err := r.db.SoftDelete(ctx, "media_collections", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete media collection: %w", err)
 	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
+	if !deleted {
 		return fmt.Errorf("media collection not found")
 	}
 	return nil
 }
 
+// ListItemIDs returns the IDs of a collection's live media items in
+// collection order, with the total count.
+func (r *MediaCollectionRepository) ListItemIDs(ctx context.Context, collectionID int64, limit, offset int) ([]int64, int, error) {
+	if _, err := r.GetByID(ctx, collectionID); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM media_collection_items mci
+		 JOIN media_items mi ON mi.id = mci.media_item_id
+		 WHERE mci.collection_id = ? AND mi.deleted_at IS NULL`, collectionID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count collection items: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT mci.media_item_id FROM media_collection_items mci
+		 JOIN media_items mi ON mi.id = mci.media_item_id
+		 WHERE mci.collection_id = ? AND mi.deleted_at IS NULL
+		 ORDER BY mci.id LIMIT ? OFFSET ?`, collectionID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list collection items: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan collection item: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, total, rows.Err()
+}
+
 // scanCollection scans a database row into a MediaCollection struct.
 func (r *MediaCollectionRepository) scanCollection(row interface{ Scan(...interface{}) error }) (*models.MediaCollection, error) {
 	var (
@@ -172,9 +209,10 @@ func (r *MediaCollectionRepository) scanCollection(row interface{ Scan(...interf
 		externalIDsJSON      string
 		coverURL             *string
 		createdAt, updatedAt time.Time
+		userID               *int64
 	)
 	err := row.Scan(&id, &name, &collType, &description, &totalItems,
-		&externalIDsJSON, &coverURL, &createdAt, &updatedAt)
+		&externalIDsJSON, &coverURL, &createdAt, &updatedAt, &userID)
 	if err != nil {
 		return nil, err
 	}
@@ -192,6 +230,7 @@ func (r *MediaCollectionRepository) scanCollection(row interface{ Scan(...interf
 		TotalItems:     totalItems,
 		ExternalIDs:    externalIDs,
 		CoverURL:       coverURL,
+		UserID:         userID,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
 	}
@@ -26,7 +26,7 @@ func newMockCollRepo(t *testing.T) (*MediaCollectionRepository, sqlmock.Sqlmock)
 // collCols is the standard column set for media_collections queries.
 var collCols = []string{
 	"id", "name", "collection_type", "description", "total_items",
-	"external_ids", "cover_url", "created_at", "updated_at",
+	"external_ids", "cover_url", "created_at", "updated_at", "user_id",
 }
 
 func sampleCollRow(now time.Time) []driver.Value {
@@ -34,14 +34,14 @@ func sampleCollRow(now time.Time) []driver.Value {
 	coverURL := "https://example.com/cover.jpg"
 	return []driver.Value{
 		int64(1), "Test Collection", "playlist", &desc, 10,
-		`{"imdb":"tt123","tmdb":"456"}`, &coverURL, now, now,
+		`{"imdb":"tt123","tmdb":"456"}`, &coverURL, now, now, nil,
 	}
 }
 
 func sampleCollRowMinimal(id int64, name string, now time.Time) []driver.Value {
 	return []driver.Value{
 		id, name, "series", nil, 0,
-		`null`, nil, now, now,
+		`null`, nil, now, now, nil,
 	}
 }
 
@@ -269,7 +269,7 @@ func TestMediaCollectionRepo_GetByID(t *testing.T) {
 					WithArgs(int64(3)).
 					WillReturnRows(sqlmock.NewRows(collCols).
 						AddRow(int64(3), "Empty ExtIDs", "playlist", nil, 0,
-							`{}`, nil, now, now))
+							`{}`, nil, now, now, nil))
 			},
 			check: func(t *testing.T, coll *models.MediaCollection) {
 				assert.Equal(t, int64(3), coll.ID)
@@ -307,7 +307,7 @@ func TestMediaCollectionRepo_GetByID(t *testing.T) {
 					WithArgs(int64(4)).
 					WillReturnRows(sqlmock.NewRows(collCols).
 						AddRow(int64(4), "Bad JSON", "playlist", nil, 0,
-							`{invalid json}`, nil, now, now))
+							`{invalid json}`, nil, now, now, nil))
 			},
 			wantErr: true,
 			errMsg:  "failed to unmarshal external_ids",
@@ -360,7 +360,7 @@ func TestMediaCollectionRepo_List(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery("SELECT COUNT").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-				mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+				mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 					WithArgs(10, 0).
 					WillReturnRows(sqlmock.NewRows(collCols).
 						AddRow(sampleCollRow(now)...))
@@ -378,7 +378,7 @@ func TestMediaCollectionRepo_List(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery("SELECT COUNT").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
-				mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+				mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 					WithArgs(10, 0).
 					WillReturnRows(sqlmock.NewRows(collCols).
 						AddRow(sampleCollRow(now)...).
@@ -400,7 +400,7 @@ func TestMediaCollectionRepo_List(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery("SELECT COUNT").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-				mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+				mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 					WithArgs(10, 0).
 					WillReturnRows(sqlmock.NewRows(collCols))
 			},
@@ -414,7 +414,7 @@ func TestMediaCollectionRepo_List(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery("SELECT COUNT").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(15))
-				mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+				mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 					WithArgs(5, 10).
 					WillReturnRows(sqlmock.NewRows(collCols).
 						AddRow(sampleCollRowMinimal(11, "Page2-1", now)...))
@@ -429,7 +429,7 @@ func TestMediaCollectionRepo_List(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery("SELECT COUNT").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(50))
-				mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+				mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 					WithArgs(2, 0).
 					WillReturnRows(sqlmock.NewRows(collCols).
 						AddRow(sampleCollRowMinimal(1, "First", now)...).
@@ -629,8 +629,8 @@ func TestMediaCollectionRepo_Delete(t *testing.T) {
 			name: "success",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_collections WHERE id").
-					WithArgs(int64(1)).
+				mock.ExpectExec("UPDATE media_collections SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
@@ -638,8 +638,8 @@ func TestMediaCollectionRepo_Delete(t *testing.T) {
 			name: "not found",
 			id:   999,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_collections WHERE id").
-					WithArgs(int64(999)).
+				mock.ExpectExec("UPDATE media_collections SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(999)).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			wantErr: true,
@@ -649,8 +649,8 @@ func TestMediaCollectionRepo_Delete(t *testing.T) {
 			name: "database error",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_collections WHERE id").
-					WithArgs(int64(1)).
+				mock.ExpectExec("UPDATE media_collections SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnError(sql.ErrConnDone)
 			},
 			wantErr: true,
@@ -725,7 +725,7 @@ func TestMediaCollectionRepo_ScanCollection_ExternalIDsVariants(t *testing.T) {
 				WithArgs(int64(1)).
 				WillReturnRows(sqlmock.NewRows(collCols).
 					AddRow(int64(1), "Test", "playlist", nil, 0,
-						tt.externalIDsVal, nil, now, now))
+						tt.externalIDsVal, nil, now, now, nil))
 
 			coll, err := repo.GetByID(context.Background(), 1)
 			require.NoError(t, err)
@@ -808,11 +808,11 @@ func TestMediaCollectionRepo_List_SkipsBadRows(t *testing.T) {
 	// The List implementation skips rows that fail to scan (continue on error).
 	mock.ExpectQuery("SELECT COUNT").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
-	mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+	mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 		WithArgs(10, 0).
 		WillReturnRows(sqlmock.NewRows(collCols).
-			AddRow(int64(1), "Good", "playlist", nil, 0, `null`, nil, now, now).
-			AddRow(int64(2), "Also Good", "series", nil, 5, `{"k":"v"}`, nil, now, now))
+			AddRow(int64(1), "Good", "playlist", nil, 0, `null`, nil, now, now, nil).
+			AddRow(int64(2), "Also Good", "series", nil, 5, `{"k":"v"}`, nil, now, now, nil))
 
 	colls, total, err := repo.List(context.Background(), 10, 0)
 	require.NoError(t, err)
@@ -959,8 +959,8 @@ func TestMediaCollectionRepo_DeleteThenGet(t *testing.T) {
 	repo, mock := newMockCollRepo(t)
 
 	// Delete succeeds
-	mock.ExpectExec("DELETE FROM media_collections WHERE id").
-		WithArgs(int64(5)).
+	mock.ExpectExec("UPDATE media_collections SET deleted_at").
+		WithArgs(sqlmock.AnyArg(), int64(5)).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 	// Subsequent GetByID returns not found
 	mock.ExpectQuery("SELECT .+ FROM media_collections WHERE id").
@@ -976,6 +976,38 @@ func TestMediaCollectionRepo_DeleteThenGet(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// ---------------------------------------------------------------------------
+// ListItemIDs
+// ---------------------------------------------------------------------------
+
+func TestMediaCollectionRepo_ListItemIDs(t *testing.T) {
+	now := time.Now()
+	repo, mock := newMockCollRepo(t)
+
+	mock.ExpectQuery("SELECT .+ FROM media_collections WHERE id").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(collCols).AddRow(sampleCollRow(now)...))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM media_collection_items").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT mci.media_item_id FROM media_collection_items").
+		WithArgs(int64(1), 2, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"media_item_id"}).AddRow(int64(7)).AddRow(int64(4)))
+
+	ids, total, err := repo.ListItemIDs(context.Background(), 1, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []int64{7, 4}, ids)
+
+	mock.ExpectQuery("SELECT .+ FROM media_collections WHERE id").
+		WithArgs(int64(9)).
+		WillReturnError(sql.ErrNoRows)
+	_, _, err = repo.ListItemIDs(context.Background(), 9, 2, 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "media collection not found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // ---------------------------------------------------------------------------
 // List with zero limit
 // ---------------------------------------------------------------------------
@@ -986,7 +1018,7 @@ func TestMediaCollectionRepo_List_ZeroLimit(t *testing.T) {
 
 	mock.ExpectQuery("SELECT COUNT").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
-	mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+	mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 		WithArgs(0, 0).
 		WillReturnRows(sqlmock.NewRows(collCols).
 			AddRow(sampleCollRowMinimal(1, "Item", now)...))
@@ -1077,7 +1109,7 @@ func TestMediaCollectionRepo_GetByID_AllFieldsRoundTrip(t *testing.T) {
 		WithArgs(int64(77)).
 		WillReturnRows(sqlmock.NewRows(collCols).
 			AddRow(int64(77), "Full Collection", "franchise", &desc, 42,
-				`{"imdb":"tt555","tmdb":"888"}`, &coverURL, created, updated))
+				`{"imdb":"tt555","tmdb":"888"}`, &coverURL, created, updated, nil))
 
 	coll, err := repo.GetByID(context.Background(), 77)
 	require.NoError(t, err)
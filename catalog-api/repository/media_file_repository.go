@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"catalogizer/database"
@@ -18,6 +19,25 @@ type MediaFileRecord struct {
 	Language    *string
 	IsPrimary   bool
 	CreatedAt   time.Time
+	Edition     *string
+	MediaFileLayout
+}
+
+// MediaEdition is one edition of a title in one resolution, such as the
+// extended cut in 2160p. Either may be empty when files do not name it.
+type MediaEdition struct {
+	Edition string
+	Quality string
+}
+
+// MediaFileLayout describes how a file maps onto its media item. A file
+// that is one of several parts of an item, such as CD2 of a movie, has a
+// PartNumber; a file holding several episodes is linked to each of them,
+// and SegmentIndex tells which of its SegmentCount episodes the item is.
+type MediaFileLayout struct {
+	PartNumber   *int
+	SegmentIndex *int
+	SegmentCount *int
 }
 
 // DuplicateFileGroup represents a file linked to multiple media items
@@ -65,18 +85,129 @@ func (r *MediaFileRepository) UnlinkFile(ctx context.Context, mediaItemID, fileI
 	return nil
 }
 
-// GetFilesByItem retrieves all media_file records for a given media item
+// GetFilesByItem retrieves all media_file records for a given media item,
+// parts in order
 func (r *MediaFileRepository) GetFilesByItem(ctx context.Context, mediaItemID int64) ([]MediaFileRecord, error) {
 	query := `
-		SELECT id, media_item_id, file_id, quality_info, language, is_primary, created_at
+		SELECT id, media_item_id, file_id, quality_info, language, is_primary, created_at,
+			edition, part_number, segment_index, segment_count
 		FROM media_files
 		WHERE media_item_id = ?
-		ORDER BY is_primary DESC, created_at ASC`
+		ORDER BY COALESCE(part_number, 0) ASC, is_primary DESC, created_at ASC`
 
 	rows, err := r.db.QueryContext(ctx, query, mediaItemID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get files for media item: %w", err)
 	}
+	return scanMediaFileRecords(rows)
+}
+
+// GetLinksByFile retrieves all media_file records for a given file, one
+// per media item it is linked to
+func (r *MediaFileRepository) GetLinksByFile(ctx context.Context, fileID int64) ([]MediaFileRecord, error) {
+	query := `
+		SELECT id, media_item_id, file_id, quality_info, language, is_primary, created_at,
+			edition, part_number, segment_index, segment_count
+		FROM media_files
+		WHERE file_id = ?
+		ORDER BY COALESCE(segment_index, 0) ASC, created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media item links for file: %w", err)
+	}
+	return scanMediaFileRecords(rows)
+}
+
+// SetLayout records how a linked file maps onto its media item
+func (r *MediaFileRepository) SetLayout(ctx context.Context, mediaItemID, fileID int64, layout MediaFileLayout) error {
+	query := `UPDATE media_files SET part_number = ?, segment_index = ?, segment_count = ?
+		WHERE media_item_id = ? AND file_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query,
+		layout.PartNumber, layout.SegmentIndex, layout.SegmentCount, mediaItemID, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to set media file layout: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// SetEdition records which edition of its title a linked file is and its
+// resolution; either may be nil when not known
+func (r *MediaFileRepository) SetEdition(ctx context.Context, mediaItemID, fileID int64, edition, qualityInfo *string) error {
+	query := `UPDATE media_files SET edition = ?, quality_info = ? WHERE media_item_id = ? AND file_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, edition, qualityInfo, mediaItemID, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to set media file edition: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetEditionsByItems returns the distinct editions and resolutions of the
+// files linked to each of the given media items, for items with any
+func (r *MediaFileRepository) GetEditionsByItems(ctx context.Context, mediaItemIDs []int64) (map[int64][]MediaEdition, error) {
+	editions := make(map[int64][]MediaEdition)
+	if len(mediaItemIDs) == 0 {
+		return editions, nil
+	}
+
+	placeholders := make([]string, len(mediaItemIDs))
+	args := make([]interface{}, len(mediaItemIDs))
+	for i, id := range mediaItemIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	query := `
+		SELECT DISTINCT media_item_id, COALESCE(edition, ''), COALESCE(quality_info, '')
+		FROM media_files
+		WHERE media_item_id IN (` + strings.Join(placeholders, ", ") + `)
+			AND (edition IS NOT NULL OR quality_info IS NOT NULL)
+		ORDER BY media_item_id, 2, 3`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media item editions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var itemID int64
+		var e MediaEdition
+		if err := rows.Scan(&itemID, &e.Edition, &e.Quality); err != nil {
+			return nil, fmt.Errorf("failed to scan media item edition: %w", err)
+		}
+		editions[itemID] = append(editions[itemID], e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating media item edition rows: %w", err)
+	}
+
+	return editions, nil
+}
+
+func scanMediaFileRecords(rows *sql.Rows) ([]MediaFileRecord, error) {
 	defer rows.Close()
 
 	var records []MediaFileRecord
@@ -85,6 +216,7 @@ func (r *MediaFileRepository) GetFilesByItem(ctx context.Context, mediaItemID in
 		err := rows.Scan(
 			&rec.ID, &rec.MediaItemID, &rec.FileID,
 			&rec.QualityInfo, &rec.Language, &rec.IsPrimary, &rec.CreatedAt,
+			&rec.Edition, &rec.PartNumber, &rec.SegmentIndex, &rec.SegmentCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan media file record: %w", err)
@@ -92,7 +224,7 @@ func (r *MediaFileRepository) GetFilesByItem(ctx context.Context, mediaItemID in
 		records = append(records, rec)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating media file rows: %w", err)
 	}
 
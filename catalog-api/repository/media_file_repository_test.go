@@ -25,11 +25,12 @@ func newMockMediaFileRepo(t *testing.T) (*MediaFileRepository, sqlmock.Sqlmock)
 // mediaFileColumns is the standard column set for media_files queries.
 var mediaFileColumns = []string{
 	"id", "media_item_id", "file_id", "quality_info", "language", "is_primary", "created_at",
+	"edition", "part_number", "segment_index", "segment_count",
 }
 
 func sampleMediaFileRow(now time.Time) []driver.Value {
 	return []driver.Value{
-		int64(1), int64(10), int64(100), nil, nil, true, now,
+		int64(1), int64(10), int64(100), nil, nil, true, now, nil, nil, nil, nil,
 	}
 }
 
@@ -391,3 +392,81 @@ func TestMediaFileRepository_SetPrimary(t *testing.T) {
 		})
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Layout
+// ---------------------------------------------------------------------------
+
+func TestMediaFileRepository_SetLayout(t *testing.T) {
+	repo, mock := newMockMediaFileRepo(t)
+	part := 2
+	mock.ExpectExec("UPDATE media_files SET part_number").
+		WithArgs(&part, nil, nil, int64(10), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE media_files SET part_number").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.SetLayout(context.Background(), 10, 100, MediaFileLayout{PartNumber: &part}))
+	err := repo.SetLayout(context.Background(), 10, 999, MediaFileLayout{PartNumber: &part})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaFileRepository_GetLinksByFile(t *testing.T) {
+	repo, mock := newMockMediaFileRepo(t)
+	now := time.Now()
+	row1 := sampleMediaFileRow(now)
+	row1[9], row1[10] = int64(1), int64(2)
+	row2 := sampleMediaFileRow(now)
+	row2[1] = int64(11)
+	row2[9], row2[10] = int64(2), int64(2)
+	mock.ExpectQuery("SELECT .+ FROM media_files").
+		WithArgs(int64(100)).
+		WillReturnRows(sqlmock.NewRows(mediaFileColumns).AddRow(row1...).AddRow(row2...))
+
+	links, err := repo.GetLinksByFile(context.Background(), 100)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, int64(11), links[1].MediaItemID)
+	require.NotNil(t, links[1].SegmentIndex)
+	assert.Equal(t, 2, *links[1].SegmentIndex)
+	assert.Equal(t, 2, *links[1].SegmentCount)
+	assert.Nil(t, links[1].PartNumber)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ---------------------------------------------------------------------------
+// Editions
+// ---------------------------------------------------------------------------
+
+func TestMediaFileRepository_SetEdition(t *testing.T) {
+	repo, mock := newMockMediaFileRepo(t)
+	edition, quality := "Extended", "2160p"
+	mock.ExpectExec("UPDATE media_files SET edition").
+		WithArgs(&edition, &quality, int64(10), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE media_files SET edition").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.SetEdition(context.Background(), 10, 100, &edition, &quality))
+	assert.ErrorIs(t, repo.SetEdition(context.Background(), 10, 999, &edition, nil), sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaFileRepository_GetEditionsByItems(t *testing.T) {
+	repo, mock := newMockMediaFileRepo(t)
+	mock.ExpectQuery("SELECT DISTINCT media_item_id").
+		WithArgs(int64(10), int64(11)).
+		WillReturnRows(sqlmock.NewRows([]string{"media_item_id", "edition", "quality_info"}).
+			AddRow(int64(10), "", "1080p").
+			AddRow(int64(10), "Extended", "2160p"))
+
+	editions, err := repo.GetEditionsByItems(context.Background(), []int64{10, 11})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64][]MediaEdition{10: {{Quality: "1080p"}, {Edition: "Extended", Quality: "2160p"}}}, editions)
+
+	editions, err = repo.GetEditionsByItems(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, editions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
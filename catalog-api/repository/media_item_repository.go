@@ -70,7 +70,7 @@ func (r *MediaItemRepository) GetByID(ctx context.Context, id int64) (*models.Me
 		genre, director, cast_crew, rating, runtime, language, country,
 		status, parent_id, season_number, episode_number, track_number,
 		first_detected, last_updated
-	FROM media_items WHERE id = ?`
+	FROM media_items WHERE id = ? AND deleted_at IS NULL`
 
 	item, err := r.scanItem(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
@@ -82,7 +82,9 @@ func (r *MediaItemRepository) GetByID(ctx context.Context, id int64) (*models.Me
 	return item, nil
 }
 
-// GetByTitle retrieves a media item by title and media type ID.
+// GetByTitle retrieves a media item by title and media type ID. Soft-deleted
+// items are included so that rescans reuse them instead of recreating what
+// was deleted.
 func (r *MediaItemRepository) GetByTitle(ctx context.Context, title string, mediaTypeID int64) (*models.MediaItem, error) {
 	query := `SELECT id, media_type_id, title, original_title, year, description,
 		genre, director, cast_crew, rating, runtime, language, country,
@@ -102,7 +104,7 @@ func (r *MediaItemRepository) GetByTitle(ctx context.Context, title string, medi
 
 // GetByType retrieves media items by type with pagination. Returns items and total count.
 func (r *MediaItemRepository) GetByType(ctx context.Context, mediaTypeID int64, limit, offset int) ([]*models.MediaItem, int64, error) {
-	countQuery := `SELECT COUNT(*) FROM media_items WHERE media_type_id = ?`
+	countQuery := `SELECT COUNT(*) FROM media_items WHERE media_type_id = ? AND deleted_at IS NULL`
 	var total int64
 	if err := r.db.QueryRowContext(ctx, countQuery, mediaTypeID).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("failed to count media items by type: %w", err)
@@ -112,7 +114,7 @@ func (r *MediaItemRepository) GetByType(ctx context.Context, mediaTypeID int64,
 		genre, director, cast_crew, rating, runtime, language, country,
 		status, parent_id, season_number, episode_number, track_number,
 		first_detected, last_updated
-	FROM media_items WHERE media_type_id = ?
+	FROM media_items WHERE media_type_id = ? AND deleted_at IS NULL
 	ORDER BY title ASC LIMIT ? OFFSET ?`
 
 	items, err := r.queryItems(ctx, query, mediaTypeID, limit, offset)
@@ -128,7 +130,7 @@ func (r *MediaItemRepository) GetChildren(ctx context.Context, parentID int64) (
 		genre, director, cast_crew, rating, runtime, language, country,
 		status, parent_id, season_number, episode_number, track_number,
 		first_detected, last_updated
-	FROM media_items WHERE parent_id = ?
+	FROM media_items WHERE parent_id = ? AND deleted_at IS NULL
 	ORDER BY season_number ASC, episode_number ASC, track_number ASC, title ASC`
 
 	return r.queryItems(ctx, query, parentID)
@@ -136,7 +138,7 @@ func (r *MediaItemRepository) GetChildren(ctx context.Context, parentID int64) (
 
 // Search performs a full-text LIKE search with optional type filter. Returns items and total count.
 func (r *MediaItemRepository) Search(ctx context.Context, query string, mediaTypes []int64, limit, offset int) ([]*models.MediaItem, int64, error) {
-	baseWhere := `WHERE (title LIKE ? OR original_title LIKE ? OR description LIKE ?)`
+	baseWhere := `WHERE (title LIKE ? OR original_title LIKE ? OR description LIKE ?) AND deleted_at IS NULL`
 	searchPattern := "%" + query + "%"
 	args := []interface{}{searchPattern, searchPattern, searchPattern}
 
@@ -214,12 +216,16 @@ func (r *MediaItemRepository) Update(ctx context.Context, item *models.MediaItem
 	return nil
 }
 
-// Delete removes a media item by ID.
+// Delete soft-deletes a media item by ID. It stays in the recycle bin until
+// it is restored or purged.
 func (r *MediaItemRepository) Delete(ctx context.Context, id int64) error {
-	_, err := r.db.ExecContext(ctx, "DELETE FROM media_items WHERE id = ?", id)
+	deleted, err := r.db.SoftDelete(ctx, "media_items", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete media item: %w", err)
 	}
+	if !deleted {
+		return fmt.Errorf("media item not found")
+	}
 	return nil
 }
 
@@ -229,7 +235,7 @@ func (r *MediaItemRepository) GetDuplicates(ctx context.Context, title string, m
 		genre, director, cast_crew, rating, runtime, language, country,
 		status, parent_id, season_number, episode_number, track_number,
 		first_detected, last_updated
-	FROM media_items WHERE title = ? AND media_type_id = ?`
+	FROM media_items WHERE title = ? AND media_type_id = ? AND deleted_at IS NULL`
 
 	args := []interface{}{title, mediaTypeID}
 
@@ -246,7 +252,7 @@ func (r *MediaItemRepository) GetDuplicates(ctx context.Context, title string, m
 // Count returns the total number of media items.
 func (r *MediaItemRepository) Count(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM media_items").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM media_items WHERE deleted_at IS NULL").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count media items: %w", err)
 	}
@@ -257,6 +263,7 @@ func (r *MediaItemRepository) Count(ctx context.Context) (int64, error) {
 func (r *MediaItemRepository) ListDuplicateGroups(ctx context.Context, limit, offset int) ([]DuplicateGroup, int64, error) {
 	countQuery := `SELECT COUNT(*) FROM (
 		SELECT title, media_type_id FROM media_items
+		WHERE deleted_at IS NULL
 		GROUP BY title, media_type_id HAVING COUNT(*) > 1
 	) sub`
 	var total int64
@@ -267,6 +274,7 @@ func (r *MediaItemRepository) ListDuplicateGroups(ctx context.Context, limit, of
 	query := `SELECT mi.title, mi.media_type_id, mt.name, COUNT(*) as cnt
 		FROM media_items mi
 		JOIN media_types mt ON mt.id = mi.media_type_id
+		WHERE mi.deleted_at IS NULL
 		GROUP BY mi.title, mi.media_type_id, mt.name
 		HAVING COUNT(*) > 1
 		ORDER BY cnt DESC
@@ -301,7 +309,7 @@ type DuplicateGroup struct {
 func (r *MediaItemRepository) CountByType(ctx context.Context) (map[string]int64, error) {
 	query := `SELECT mt.name, COUNT(mi.id)
 		FROM media_types mt
-		LEFT JOIN media_items mi ON mi.media_type_id = mt.id
+		LEFT JOIN media_items mi ON mi.media_type_id = mt.id AND mi.deleted_at IS NULL
 		GROUP BY mt.name
 		ORDER BY mt.name`
 
@@ -330,7 +338,7 @@ func (r *MediaItemRepository) CountByType(ctx context.Context) (map[string]int64
 
 // GetByParent retrieves child media items for a parent with pagination. Returns items and total count.
 func (r *MediaItemRepository) GetByParent(ctx context.Context, parentID int64, limit, offset int) ([]*models.MediaItem, int64, error) {
-	countQuery := `SELECT COUNT(*) FROM media_items WHERE parent_id = ?`
+	countQuery := `SELECT COUNT(*) FROM media_items WHERE parent_id = ? AND deleted_at IS NULL`
 	var total int64
 	if err := r.db.QueryRowContext(ctx, countQuery, parentID).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("failed to count children: %w", err)
@@ -340,7 +348,7 @@ func (r *MediaItemRepository) GetByParent(ctx context.Context, parentID int64, l
 		genre, director, cast_crew, rating, runtime, language, country,
 		status, parent_id, season_number, episode_number, track_number,
 		first_detected, last_updated
-	FROM media_items WHERE parent_id = ?
+	FROM media_items WHERE parent_id = ? AND deleted_at IS NULL
 	ORDER BY season_number ASC, episode_number ASC, track_number ASC, title ASC
 	LIMIT ? OFFSET ?`
 
@@ -372,8 +372,8 @@ func TestMediaItemRepository_Delete(t *testing.T) {
 			name: "success",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_items WHERE id").
-					WithArgs(int64(1)).
+				mock.ExpectExec("UPDATE media_items SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
@@ -381,8 +381,8 @@ func TestMediaItemRepository_Delete(t *testing.T) {
 			name: "database error",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_items WHERE id").
-					WithArgs(int64(1)).
+				mock.ExpectExec("UPDATE media_items SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnError(sql.ErrConnDone)
 			},
 			wantErr: true,
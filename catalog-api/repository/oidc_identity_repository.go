@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+)
+
+// ErrOIDCIdentityNotFound is returned when a linked identity does not exist
+var ErrOIDCIdentityNotFound = errors.New("identity not found")
+
+// OIDCIdentityRepository stores the links between users and their
+// accounts at external identity providers
+type OIDCIdentityRepository struct {
+	db *database.DB
+}
+
+// NewOIDCIdentityRepository creates a new OIDC identity repository
+func NewOIDCIdentityRepository(db *database.DB) *OIDCIdentityRepository {
+	return &OIDCIdentityRepository{db: db}
+}
+
+const oidcIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanOIDCIdentity(row interface{ Scan(...interface{}) error }) (*models.OIDCIdentity, error) {
+	var identity models.OIDCIdentity
+	var email sql.NullString
+	var lastLoginAt sql.NullTime
+	if err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &email,
+		&identity.CreatedAt, &lastLoginAt); err != nil {
+		return nil, err
+	}
+	if email.Valid {
+		identity.Email = &email.String
+	}
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return &identity, nil
+}
+
+// Create stores a new identity link and sets its ID
+func (r *OIDCIdentityRepository) Create(identity *models.OIDCIdentity) error {
+	id, err := r.db.InsertReturningID(context.Background(),
+		`INSERT INTO oidc_identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+	identity.ID = int(id)
+	return nil
+}
+
+// GetBySubject returns the identity a provider knows by subject
+func (r *OIDCIdentityRepository) GetBySubject(provider, subject string) (*models.OIDCIdentity, error) {
+	identity, err := scanOIDCIdentity(r.db.QueryRow(
+		`SELECT `+oidcIdentityColumns+` FROM oidc_identities WHERE provider = ? AND subject = ?`, provider, subject))
+	if err == sql.ErrNoRows {
+		return nil, ErrOIDCIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	return identity, nil
+}
+
+// ListByUser returns the identities linked to a user
+func (r *OIDCIdentityRepository) ListByUser(userID int) ([]models.OIDCIdentity, error) {
+	rows, err := r.db.Query(`SELECT `+oidcIdentityColumns+` FROM oidc_identities WHERE user_id = ? ORDER BY provider, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []models.OIDCIdentity{}
+	for rows.Next() {
+		identity, err := scanOIDCIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, *identity)
+	}
+	return identities, rows.Err()
+}
+
+// Delete unlinks one of a user's identities
+func (r *OIDCIdentityRepository) Delete(userID, identityID int) error {
+	result, err := r.db.Exec(`DELETE FROM oidc_identities WHERE id = ? AND user_id = ?`, identityID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrOIDCIdentityNotFound
+	}
+	return nil
+}
+
+// TouchLastLogin records a sign-in through an identity and the email the
+// provider reported for it
+func (r *OIDCIdentityRepository) TouchLastLogin(identityID int, email *string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE oidc_identities SET email = ?, last_login_at = ? WHERE id = ?`, email, at, identityID)
+	return err
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockOIDCIdentityRepo(t *testing.T) (*OIDCIdentityRepository, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewOIDCIdentityRepository(db), mock
+}
+
+var oidcIdentityTestColumns = []string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}
+
+func TestOIDCIdentityRepository_Create(t *testing.T) {
+	repo, mock := newMockOIDCIdentityRepo(t)
+	email := "jo@example.com"
+	identity := &models.OIDCIdentity{UserID: 3, Provider: "google", Subject: "1234", Email: &email, CreatedAt: time.Now()}
+
+	mock.ExpectExec("INSERT INTO oidc_identities").
+		WithArgs(3, "google", "1234", &email, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	require.NoError(t, repo.Create(identity))
+	assert.Equal(t, 7, identity.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCIdentityRepository_GetBySubject(t *testing.T) {
+	repo, mock := newMockOIDCIdentityRepo(t)
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM oidc_identities WHERE provider = (.+) AND subject").WithArgs("google", "1234").
+		WillReturnRows(sqlmock.NewRows(oidcIdentityTestColumns).
+			AddRow(7, 3, "google", "1234", "jo@example.com", now, nil))
+	identity, err := repo.GetBySubject("google", "1234")
+	require.NoError(t, err)
+	assert.Equal(t, 3, identity.UserID)
+	require.NotNil(t, identity.Email)
+	assert.Nil(t, identity.LastLoginAt)
+
+	mock.ExpectQuery("SELECT (.+) FROM oidc_identities WHERE provider = (.+) AND subject").WithArgs("github", "1234").
+		WillReturnRows(sqlmock.NewRows(oidcIdentityTestColumns))
+	_, err = repo.GetBySubject("github", "1234")
+	assert.ErrorIs(t, err, ErrOIDCIdentityNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCIdentityRepository_Delete(t *testing.T) {
+	repo, mock := newMockOIDCIdentityRepo(t)
+
+	mock.ExpectExec("DELETE FROM oidc_identities").WithArgs(7, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.Delete(3, 7))
+
+	mock.ExpectExec("DELETE FROM oidc_identities").WithArgs(7, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.Delete(4, 7), ErrOIDCIdentityNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+)
+
+// PasswordHashingRepository stores the password hash parameters chosen by
+// an administrator, in the single row of password_hashing
+type PasswordHashingRepository struct {
+	db *database.DB
+}
+
+// NewPasswordHashingRepository creates a new password hashing repository
+func NewPasswordHashingRepository(db *database.DB) *PasswordHashingRepository {
+	return &PasswordHashingRepository{db: db}
+}
+
+// GetParams returns the saved parameters, or nil when none were saved
+func (r *PasswordHashingRepository) GetParams() (*models.PasswordHashParams, error) {
+	var params models.PasswordHashParams
+	var memory, iterations, parallelism int64
+	var updatedAt sql.NullTime
+	var updatedBy sql.NullInt64
+	err := r.db.QueryRow(
+		`SELECT algorithm, memory_kib, iterations, parallelism, bcrypt_cost, updated_at, updated_by FROM password_hashing WHERE id = 1`).
+		Scan(&params.Algorithm, &memory, &iterations, &parallelism, &params.BcryptCost, &updatedAt, &updatedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password hashing parameters: %w", err)
+	}
+	params.MemoryKiB, params.Iterations, params.Parallelism = uint32(memory), uint32(iterations), uint8(parallelism)
+	if updatedAt.Valid {
+		params.UpdatedAt = &updatedAt.Time
+	}
+	if updatedBy.Valid {
+		id := int(updatedBy.Int64)
+		params.UpdatedBy = &id
+	}
+	return &params, nil
+}
+
+// SaveParams replaces the saved parameters
+func (r *PasswordHashingRepository) SaveParams(params models.PasswordHashParams, updatedBy int, at time.Time) error {
+	result, err := r.db.Exec(
+		`UPDATE password_hashing SET algorithm = ?, memory_kib = ?, iterations = ?, parallelism = ?, bcrypt_cost = ?, updated_at = ?, updated_by = ? WHERE id = 1`,
+		params.Algorithm, params.MemoryKiB, params.Iterations, params.Parallelism, params.BcryptCost, at, updatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to save password hashing parameters: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = r.db.Exec(
+		`INSERT INTO password_hashing (id, algorithm, memory_kib, iterations, parallelism, bcrypt_cost, updated_at, updated_by) VALUES (1, ?, ?, ?, ?, ?, ?, ?)`,
+		params.Algorithm, params.MemoryKiB, params.Iterations, params.Parallelism, params.BcryptCost, at, updatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to save password hashing parameters: %w", err)
+	}
+	return nil
+}
+
+// ListPasswordHashes returns the password hash of every user that is not
+// deleted
+func (r *PasswordHashingRepository) ListPasswordHashes() ([]string, error) {
+	rows, err := r.db.Query(`SELECT password_hash FROM users WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to list password hashes: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
@@ -901,7 +901,7 @@ func newMockMediaCollectionRepo(t *testing.T) (*MediaCollectionRepository, sqlmo
 
 var collectionColumns = []string{
 	"id", "name", "collection_type", "description", "total_items",
-	"external_ids", "cover_url", "created_at", "updated_at",
+	"external_ids", "cover_url", "created_at", "updated_at", "user_id",
 }
 
 // ---------------------------------------------------------------------------
@@ -983,7 +983,7 @@ func TestMediaCollectionRepository_GetByID(t *testing.T) {
 					WithArgs(int64(1)).
 					WillReturnRows(sqlmock.NewRows(collectionColumns).
 						AddRow(int64(1), "My Collection", "playlist", "A desc", 10,
-							`{"imdb":"tt123"}`, nil, now, now))
+							`{"imdb":"tt123"}`, nil, now, now, nil))
 			},
 			check: func(t *testing.T, coll *mediamodels.MediaCollection) {
 				assert.Equal(t, int64(1), coll.ID)
@@ -1105,8 +1105,8 @@ func TestMediaCollectionRepository_Delete(t *testing.T) {
 			name: "success",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_collections WHERE id").
-					WithArgs(int64(1)).
+				mock.ExpectExec("UPDATE media_collections SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
@@ -1114,8 +1114,8 @@ func TestMediaCollectionRepository_Delete(t *testing.T) {
 			name: "not found",
 			id:   999,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_collections WHERE id").
-					WithArgs(int64(999)).
+				mock.ExpectExec("UPDATE media_collections SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(999)).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			wantErr: true,
@@ -1125,8 +1125,8 @@ func TestMediaCollectionRepository_Delete(t *testing.T) {
 			name: "database error",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM media_collections WHERE id").
-					WithArgs(int64(1)).
+				mock.ExpectExec("UPDATE media_collections SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnError(sql.ErrConnDone)
 			},
 			wantErr: true,
@@ -1175,11 +1175,11 @@ func TestMediaCollectionRepository_List(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery("SELECT COUNT").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-				mock.ExpectQuery("SELECT .+ FROM media_collections ORDER BY").
+				mock.ExpectQuery("SELECT .+ FROM media_collections WHERE deleted_at IS NULL ORDER BY").
 					WithArgs(10, 0).
 					WillReturnRows(sqlmock.NewRows(collectionColumns).
 						AddRow(int64(1), "Coll1", "playlist", nil, 5,
-							`null`, nil, now, now))
+							`null`, nil, now, now, nil))
 			},
 			wantCount: 1,
 			wantTotal: 1,
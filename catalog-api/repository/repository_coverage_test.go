@@ -195,6 +195,7 @@ var syncSessionColumnsCov = []string{
 	"id", "endpoint_id", "user_id", "status", "sync_type",
 	"started_at", "completed_at", "duration", "total_files",
 	"synced_files", "failed_files", "skipped_files", "error_message",
+	"skip_reasons",
 }
 
 func TestSyncRepository_UpdateSession(t *testing.T) {
@@ -304,9 +305,9 @@ func TestSyncRepository_GetUserSessions(t *testing.T) {
 					WithArgs(1, 10, 0).
 					WillReturnRows(sqlmock.NewRows(syncSessionColumnsCov).
 						AddRow(1, 10, 1, "completed", "full", now, now, int64(300),
-							100, 95, 3, 2, nil).
+							100, 95, 3, 2, nil, nil).
 						AddRow(2, 10, 1, "failed", "incremental", now, nil, nil,
-							50, 10, 40, 0, "connection lost"))
+							50, 10, 40, 0, "connection lost", nil))
 			},
 			wantCount: 2,
 		},
@@ -1974,8 +1975,8 @@ func TestMediaCollectionRepository_Update_DBError(t *testing.T) {
 func TestMediaCollectionRepository_Delete_NotFound(t *testing.T) {
 	repo, mock := newMockMediaCollectionRepo2(t)
 
-	mock.ExpectExec("DELETE FROM media_collections WHERE id").
-		WithArgs(int64(999)).
+	mock.ExpectExec("UPDATE media_collections SET deleted_at").
+		WithArgs(sqlmock.AnyArg(), int64(999)).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	err := repo.Delete(context.Background(), 999)
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+)
+
+// SecurityIncidentRepository stores the incidents listed in security
+// audit reports
+type SecurityIncidentRepository struct {
+	db *database.DB
+}
+
+// NewSecurityIncidentRepository creates a new security incident repository
+func NewSecurityIncidentRepository(db *database.DB) *SecurityIncidentRepository {
+	return &SecurityIncidentRepository{db: db}
+}
+
+// Create records an incident
+func (r *SecurityIncidentRepository) Create(incident *models.SecurityIncident) error {
+	id, err := r.db.InsertReturningID(context.Background(),
+		`INSERT INTO security_incidents (type, description, severity, user_id, ip_address, occurred_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		incident.Type, incident.Description, incident.Severity, incident.UserID, incident.IPAddress, incident.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to record security incident: %w", err)
+	}
+	incident.ID = id
+	return nil
+}
+
+// ListBetween returns the incidents that occurred in [start, end], oldest
+// first
+func (r *SecurityIncidentRepository) ListBetween(start, end time.Time) ([]models.SecurityIncident, error) {
+	rows, err := r.db.Query(`
+		SELECT id, type, description, severity, user_id, ip_address, occurred_at
+		FROM security_incidents
+		WHERE occurred_at >= ? AND occurred_at <= ?
+		ORDER BY occurred_at, id`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get security incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents := []models.SecurityIncident{}
+	for rows.Next() {
+		var incident models.SecurityIncident
+		if err := rows.Scan(&incident.ID, &incident.Type, &incident.Description, &incident.Severity,
+			&incident.UserID, &incident.IPAddress, &incident.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan security incident: %w", err)
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockSecurityIncidentRepo(t *testing.T) (*SecurityIncidentRepository, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewSecurityIncidentRepository(db), mock
+}
+
+func TestSecurityIncidentRepository_Create(t *testing.T) {
+	repo, mock := newMockSecurityIncidentRepo(t)
+	userID := 7
+	ip := "10.0.0.1"
+	incident := &models.SecurityIncident{
+		Type:        "account_locked",
+		Description: "locked",
+		Severity:    "medium",
+		UserID:      &userID,
+		IPAddress:   &ip,
+		Timestamp:   time.Now(),
+	}
+
+	mock.ExpectExec("INSERT INTO security_incidents").
+		WithArgs("account_locked", "locked", "medium", &userID, &ip, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+
+	require.NoError(t, repo.Create(incident))
+	assert.Equal(t, int64(12), incident.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSecurityIncidentRepository_ListBetween(t *testing.T) {
+	repo, mock := newMockSecurityIncidentRepo(t)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "type", "description", "severity", "user_id", "ip_address", "occurred_at"}).
+		AddRow(1, "account_locked", "locked", "medium", 7, "10.0.0.1", now).
+		AddRow(2, "account_locked", "locked again", "high", nil, nil, now)
+	mock.ExpectQuery("SELECT (.+) FROM security_incidents").WillReturnRows(rows)
+
+	incidents, err := repo.ListBetween(now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, incidents, 2)
+	assert.Equal(t, 7, *incidents[0].UserID)
+	assert.Equal(t, "10.0.0.1", *incidents[0].IPAddress)
+	assert.Nil(t, incidents[1].UserID)
+	assert.Equal(t, "high", incidents[1].Severity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
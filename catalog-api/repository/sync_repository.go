@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -94,6 +95,16 @@ func (r *SyncRepository) UpdateEndpoint(endpoint *models.SyncEndpoint) error {
 	return err
 }
 
+// UpdateEndpointLastSync records when the endpoint last synced
+// successfully, leaving its other settings as they are.
+func (r *SyncRepository) UpdateEndpointLastSync(endpointID int, lastSyncAt time.Time) error {
+	if _, err := r.db.Exec(`UPDATE sync_endpoints SET last_sync_at = ? WHERE id = ?`,
+		lastSyncAt, endpointID); err != nil {
+		return fmt.Errorf("failed to update sync endpoint: %w", err)
+	}
+	return nil
+}
+
 func (r *SyncRepository) DeleteEndpoint(endpointID int) error {
 	query := `DELETE FROM sync_endpoints WHERE id = ?`
 	_, err := r.db.Exec(query, endpointID)
@@ -139,7 +150,8 @@ func (r *SyncRepository) CreateSession(session *models.SyncSession) (int, error)
 func (r *SyncRepository) GetSession(sessionID int) (*models.SyncSession, error) {
 	query := `
 		SELECT id, endpoint_id, user_id, status, sync_type, started_at, completed_at,
-			   duration, total_files, synced_files, failed_files, skipped_files, error_message
+			   duration, total_files, synced_files, failed_files, skipped_files, error_message,
+			   skip_reasons
 		FROM sync_sessions
 		WHERE id = ?
 	`
@@ -148,11 +160,13 @@ func (r *SyncRepository) GetSession(sessionID int) (*models.SyncSession, error)
 	var completedAt sql.NullTime
 	var durationSeconds sql.NullInt64
 	var errorMessage sql.NullString
+	var skipReasons sql.NullString
 
 	err := r.db.QueryRow(query, sessionID).Scan(
 		&session.ID, &session.EndpointID, &session.UserID, &session.Status, &session.SyncType,
 		&session.StartedAt, &completedAt, &durationSeconds, &session.TotalFiles,
-		&session.SyncedFiles, &session.FailedFiles, &session.SkippedFiles, &errorMessage)
+		&session.SyncedFiles, &session.FailedFiles, &session.SkippedFiles, &errorMessage,
+		&skipReasons)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -174,6 +188,8 @@ func (r *SyncRepository) GetSession(sessionID int) (*models.SyncSession, error)
 		session.ErrorMessage = &errorMessage.String
 	}
 
+	session.SkipReasons = decodeSkipReasons(skipReasons)
+
 	return session, nil
 }
 
@@ -181,7 +197,7 @@ func (r *SyncRepository) UpdateSession(session *models.SyncSession) error {
 	query := `
 		UPDATE sync_sessions
 		SET status = ?, completed_at = ?, duration = ?, total_files = ?, synced_files = ?,
-			failed_files = ?, skipped_files = ?, error_message = ?, updated_at = ?
+			failed_files = ?, skipped_files = ?, error_message = ?, skip_reasons = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -201,9 +217,18 @@ func (r *SyncRepository) UpdateSession(session *models.SyncSession) error {
 		errorMessage = sql.NullString{String: *session.ErrorMessage, Valid: true}
 	}
 
+	var skipReasons sql.NullString
+	if len(session.SkipReasons) > 0 {
+		encoded, err := json.Marshal(session.SkipReasons)
+		if err != nil {
+			return fmt.Errorf("failed to encode skip reasons: %w", err)
+		}
+		skipReasons = sql.NullString{String: string(encoded), Valid: true}
+	}
+
 	_, err := r.db.Exec(query,
 		session.Status, completedAt, durationSeconds, session.TotalFiles, session.SyncedFiles,
-		session.FailedFiles, session.SkippedFiles, errorMessage, time.Now(), session.ID)
+		session.FailedFiles, session.SkippedFiles, errorMessage, skipReasons, time.Now(), session.ID)
 
 	return err
 }
@@ -211,7 +236,8 @@ func (r *SyncRepository) UpdateSession(session *models.SyncSession) error {
 func (r *SyncRepository) GetUserSessions(userID int, limit, offset int) ([]models.SyncSession, error) {
 	query := `
 		SELECT id, endpoint_id, user_id, status, sync_type, started_at, completed_at,
-			   duration, total_files, synced_files, failed_files, skipped_files, error_message
+			   duration, total_files, synced_files, failed_files, skipped_files, error_message,
+			   skip_reasons
 		FROM sync_sessions
 		WHERE user_id = ?
 		ORDER BY started_at DESC
@@ -227,14 +253,51 @@ func (r *SyncRepository) GetUserSessions(userID int, limit, offset int) ([]model
 	return r.scanSessions(rows)
 }
 
+// AddSessionFailure stores a file a sync session failed to transfer.
+func (r *SyncRepository) AddSessionFailure(failure *models.SyncFailure) error {
+	id, err := r.db.InsertReturningID(context.Background(),
+		`INSERT INTO sync_session_failures (session_id, path, message, occurred_at) VALUES (?, ?, ?, ?)`,
+		failure.SessionID, failure.Path, failure.Message, failure.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to record sync failure: %w", err)
+	}
+	failure.ID = int(id)
+	return nil
+}
+
+// GetSessionFailures returns the failures of a sync session in the order
+// they happened.
+func (r *SyncRepository) GetSessionFailures(sessionID int, limit, offset int) ([]models.SyncFailure, error) {
+	rows, err := r.db.Query(`
+		SELECT id, session_id, path, message, occurred_at
+		FROM sync_session_failures
+		WHERE session_id = ?
+		ORDER BY id
+		LIMIT ? OFFSET ?`, sessionID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := []models.SyncFailure{}
+	for rows.Next() {
+		var failure models.SyncFailure
+		if err := rows.Scan(&failure.ID, &failure.SessionID, &failure.Path, &failure.Message, &failure.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sync failure: %w", err)
+		}
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
 func (r *SyncRepository) CreateSchedule(schedule *models.SyncSchedule) (int, error) {
 	query := `
-		INSERT INTO sync_schedules (endpoint_id, user_id, frequency, is_active, created_at)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO sync_schedules (endpoint_id, user_id, frequency, time_zone, next_run, is_active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
 	id, err := r.db.InsertReturningID(context.Background(), query,
-		schedule.EndpointID, schedule.UserID, schedule.Frequency, schedule.IsActive, schedule.CreatedAt)
+		schedule.EndpointID, schedule.UserID, schedule.Frequency, schedule.TimeZone, schedule.NextRun, schedule.IsActive, schedule.CreatedAt)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to create sync schedule: %w", err)
@@ -245,7 +308,7 @@ func (r *SyncRepository) CreateSchedule(schedule *models.SyncSchedule) (int, err
 
 func (r *SyncRepository) GetActiveSchedules() ([]models.SyncSchedule, error) {
 	query := `
-		SELECT id, endpoint_id, user_id, frequency, last_run, next_run, is_active, created_at
+		SELECT id, endpoint_id, user_id, frequency, time_zone, last_run, next_run, is_active, created_at
 		FROM sync_schedules
 		WHERE is_active = 1
 		ORDER BY next_run ASC
@@ -260,6 +323,60 @@ func (r *SyncRepository) GetActiveSchedules() ([]models.SyncSchedule, error) {
 	return r.scanSchedules(rows)
 }
 
+// GetSchedule returns a sync schedule by ID.
+func (r *SyncRepository) GetSchedule(scheduleID int) (*models.SyncSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT id, endpoint_id, user_id, frequency, time_zone, last_run, next_run, is_active, created_at
+		FROM sync_schedules
+		WHERE id = ?`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync schedule: %w", err)
+	}
+	defer rows.Close()
+
+	schedules, err := r.scanSchedules(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("sync schedule not found")
+	}
+	return &schedules[0], nil
+}
+
+// GetUserSchedules returns a user's sync schedules, next due first.
+func (r *SyncRepository) GetUserSchedules(userID int) ([]models.SyncSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT id, endpoint_id, user_id, frequency, time_zone, last_run, next_run, is_active, created_at
+		FROM sync_schedules
+		WHERE user_id = ?
+		ORDER BY next_run ASC, id ASC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user schedules: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanSchedules(rows)
+}
+
+// UpdateScheduleRun records when a schedule last ran and when it is due
+// next.
+func (r *SyncRepository) UpdateScheduleRun(scheduleID int, lastRun, nextRun time.Time) error {
+	if _, err := r.db.Exec(`UPDATE sync_schedules SET last_run = ?, next_run = ? WHERE id = ?`,
+		lastRun, nextRun, scheduleID); err != nil {
+		return fmt.Errorf("failed to update sync schedule: %w", err)
+	}
+	return nil
+}
+
+// DeleteSchedule removes a sync schedule.
+func (r *SyncRepository) DeleteSchedule(scheduleID int) error {
+	if _, err := r.db.Exec(`DELETE FROM sync_schedules WHERE id = ?`, scheduleID); err != nil {
+		return fmt.Errorf("failed to delete sync schedule: %w", err)
+	}
+	return nil
+}
+
 func (r *SyncRepository) GetStatistics(userID *int, startDate, endDate time.Time) (*models.SyncStatistics, error) {
 	whereClause := "WHERE started_at BETWEEN ? AND ?"
 	args := []interface{}{startDate, endDate}
@@ -385,10 +502,80 @@ func (r *SyncRepository) CleanupSessions(olderThan time.Time) error {
 		WHERE completed_at < ? AND status IN ('completed', 'failed', 'cancelled')
 	`
 
-	_, err := r.db.Exec(query, olderThan)
+	if _, err := r.db.Exec(query, olderThan); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(`DELETE FROM sync_session_failures WHERE session_id NOT IN (SELECT id FROM sync_sessions)`)
 	return err
 }
 
+// GetCloudCredentials returns the OAuth link for a cloud storage endpoint.
+func (r *SyncRepository) GetCloudCredentials(endpointID int) (*models.SyncCloudCredentials, error) {
+	query := `
+		SELECT endpoint_id, provider, access_token, refresh_token, token_expiry, change_cursor, updated_at
+		FROM sync_cloud_credentials
+		WHERE endpoint_id = ?
+	`
+
+	creds := &models.SyncCloudCredentials{}
+	var refreshToken, changeCursor sql.NullString
+	var tokenExpiry sql.NullTime
+
+	err := r.db.QueryRow(query, endpointID).Scan(
+		&creds.EndpointID, &creds.Provider, &creds.AccessToken, &refreshToken,
+		&tokenExpiry, &changeCursor, &creds.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("cloud credentials not found")
+		}
+		return nil, fmt.Errorf("failed to get cloud credentials: %w", err)
+	}
+
+	creds.RefreshToken = refreshToken.String
+	creds.ChangeCursor = changeCursor.String
+	if tokenExpiry.Valid {
+		creds.TokenExpiry = &tokenExpiry.Time
+	}
+
+	return creds, nil
+}
+
+// SaveCloudCredentials creates or replaces the OAuth link for an endpoint.
+func (r *SyncRepository) SaveCloudCredentials(creds *models.SyncCloudCredentials) error {
+	var tokenExpiry sql.NullTime
+	if creds.TokenExpiry != nil {
+		tokenExpiry = sql.NullTime{Time: *creds.TokenExpiry, Valid: true}
+	}
+
+	creds.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`
+		UPDATE sync_cloud_credentials
+		SET provider = ?, access_token = ?, refresh_token = ?, token_expiry = ?, change_cursor = ?, updated_at = ?
+		WHERE endpoint_id = ?`,
+		creds.Provider, creds.AccessToken, creds.RefreshToken,
+		tokenExpiry, creds.ChangeCursor, creds.UpdatedAt, creds.EndpointID)
+	if err != nil {
+		return fmt.Errorf("failed to save cloud credentials: %w", err)
+	}
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO sync_cloud_credentials
+			(endpoint_id, provider, access_token, refresh_token, token_expiry, change_cursor, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = r.db.Exec(query,
+		creds.EndpointID, creds.Provider, creds.AccessToken, creds.RefreshToken,
+		tokenExpiry, creds.ChangeCursor, creds.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save cloud credentials: %w", err)
+	}
+
+	return nil
+}
+
 func (r *SyncRepository) GetEndpointsByType(syncType string) ([]models.SyncEndpoint, error) {
 	query := `
 		SELECT id, user_id, name, type, url, username, password, sync_direction,
@@ -447,11 +634,13 @@ func (r *SyncRepository) scanSessions(rows *sql.Rows) ([]models.SyncSession, err
 		var completedAt sql.NullTime
 		var durationSeconds sql.NullInt64
 		var errorMessage sql.NullString
+		var skipReasons sql.NullString
 
 		err := rows.Scan(
 			&session.ID, &session.EndpointID, &session.UserID, &session.Status, &session.SyncType,
 			&session.StartedAt, &completedAt, &durationSeconds, &session.TotalFiles,
-			&session.SyncedFiles, &session.FailedFiles, &session.SkippedFiles, &errorMessage)
+			&session.SyncedFiles, &session.FailedFiles, &session.SkippedFiles, &errorMessage,
+			&skipReasons)
 
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
@@ -470,12 +659,27 @@ func (r *SyncRepository) scanSessions(rows *sql.Rows) ([]models.SyncSession, err
 			session.ErrorMessage = &errorMessage.String
 		}
 
+		session.SkipReasons = decodeSkipReasons(skipReasons)
+
 		sessions = append(sessions, session)
 	}
 
 	return sessions, nil
 }
 
+// decodeSkipReasons parses the stored per-reason skip counts. Malformed
+// values are ignored rather than failing the whole read.
+func decodeSkipReasons(value sql.NullString) map[string]int {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var reasons map[string]int
+	if err := json.Unmarshal([]byte(value.String), &reasons); err != nil {
+		return nil
+	}
+	return reasons
+}
+
 func (r *SyncRepository) scanSchedules(rows *sql.Rows) ([]models.SyncSchedule, error) {
 	var schedules []models.SyncSchedule
 
@@ -484,7 +688,7 @@ func (r *SyncRepository) scanSchedules(rows *sql.Rows) ([]models.SyncSchedule, e
 		var lastRun, nextRun sql.NullTime
 
 		err := rows.Scan(
-			&schedule.ID, &schedule.EndpointID, &schedule.UserID, &schedule.Frequency,
+			&schedule.ID, &schedule.EndpointID, &schedule.UserID, &schedule.Frequency, &schedule.TimeZone,
 			&lastRun, &nextRun, &schedule.IsActive, &schedule.CreatedAt)
 
 		if err != nil {
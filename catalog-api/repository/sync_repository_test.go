@@ -28,6 +28,7 @@ var syncEndpointColumns = []string{
 var syncSessionColumns = []string{
 	"id", "endpoint_id", "user_id", "status", "sync_type", "started_at", "completed_at",
 	"duration", "total_files", "synced_files", "failed_files", "skipped_files", "error_message",
+	"skip_reasons",
 }
 
 // ---------------------------------------------------------------------------
@@ -335,7 +336,7 @@ func TestSyncRepository_GetSession(t *testing.T) {
 			setup: func(mock sqlmock.Sqlmock) {
 				rows := sqlmock.NewRows(syncSessionColumns).
 					AddRow(1, 1, 1, "completed", "full", now, now,
-						int64(120), 100, 95, 3, 2, nil)
+						int64(120), 100, 95, 3, 2, nil, `{"hidden":2}`)
 				mock.ExpectQuery("SELECT .+ FROM sync_sessions WHERE id").
 					WithArgs(1).
 					WillReturnRows(rows)
@@ -345,6 +346,7 @@ func TestSyncRepository_GetSession(t *testing.T) {
 				assert.Equal(t, "completed", session.Status)
 				assert.Equal(t, 100, session.TotalFiles)
 				assert.NotNil(t, session.Duration)
+				assert.Equal(t, map[string]int{"hidden": 2}, session.SkipReasons)
 			},
 		},
 		{
@@ -386,13 +388,14 @@ func TestSyncRepository_CreateSchedule(t *testing.T) {
 
 	repo, mock := newMockSyncRepo(t)
 	mock.ExpectExec("INSERT INTO sync_schedules").
-		WithArgs(1, 1, "daily", true, now).
+		WithArgs(1, 1, "daily", "Europe/Belgrade", sqlmock.AnyArg(), true, now).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	id, err := repo.CreateSchedule(&models.SyncSchedule{
 		EndpointID: 1,
 		UserID:     1,
 		Frequency:  "daily",
+		TimeZone:   "Europe/Belgrade",
 		IsActive:   true,
 		CreatedAt:  now,
 	})
@@ -409,8 +412,8 @@ func TestSyncRepository_GetActiveSchedules(t *testing.T) {
 	now := time.Now()
 
 	repo, mock := newMockSyncRepo(t)
-	rows := sqlmock.NewRows([]string{"id", "endpoint_id", "user_id", "frequency", "last_run", "next_run", "is_active", "created_at"}).
-		AddRow(1, 1, 1, "daily", nil, now.Add(24*time.Hour), true, now)
+	rows := sqlmock.NewRows([]string{"id", "endpoint_id", "user_id", "frequency", "time_zone", "last_run", "next_run", "is_active", "created_at"}).
+		AddRow(1, 1, 1, "daily", "", nil, now.Add(24*time.Hour), true, now)
 	mock.ExpectQuery("SELECT .+ FROM sync_schedules WHERE is_active = 1").
 		WillReturnRows(rows)
 
@@ -439,6 +442,8 @@ func TestSyncRepository_CleanupSessions(t *testing.T) {
 				mock.ExpectExec("DELETE FROM sync_sessions").
 					WithArgs(olderThan).
 					WillReturnResult(sqlmock.NewResult(0, 5))
+				mock.ExpectExec("DELETE FROM sync_session_failures").
+					WillReturnResult(sqlmock.NewResult(0, 2))
 			},
 		},
 		{
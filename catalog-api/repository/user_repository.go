@@ -46,7 +46,7 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 			   display_name, avatar_url, time_zone, language, is_active, is_locked,
 			   locked_until, failed_login_attempts, last_login_at, last_login_ip,
 			   created_at, updated_at, settings
-		FROM users WHERE id = ?
+		FROM users WHERE id = ? AND deleted_at IS NULL
 	`
 
 	user := &models.User{}
@@ -80,7 +80,7 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 			   display_name, avatar_url, time_zone, language, is_active, is_locked,
 			   locked_until, failed_login_attempts, last_login_at, last_login_ip,
 			   created_at, updated_at, settings
-		FROM users WHERE username = ?
+		FROM users WHERE username = ? AND deleted_at IS NULL
 	`
 
 	user := &models.User{}
@@ -111,7 +111,7 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 			   display_name, avatar_url, time_zone, language, is_active, is_locked,
 			   locked_until, failed_login_attempts, last_login_at, last_login_ip,
 			   created_at, updated_at, settings
-		FROM users WHERE email = ?
+		FROM users WHERE email = ? AND deleted_at IS NULL
 	`
 
 	user := &models.User{}
@@ -142,7 +142,7 @@ func (r *UserRepository) GetByUsernameOrEmail(usernameOrEmail string) (*models.U
 			   display_name, avatar_url, time_zone, language, is_active, is_locked,
 			   locked_until, failed_login_attempts, last_login_at, last_login_ip,
 			   created_at, updated_at, settings
-		FROM users WHERE username = ? OR email = ?
+		FROM users WHERE (username = ? OR email = ?) AND deleted_at IS NULL
 	`
 
 	user := &models.User{}
@@ -196,10 +196,23 @@ func (r *UserRepository) UpdateLastLogin(userID int, ipAddress string) error {
 	return err
 }
 
-func (r *UserRepository) IncrementFailedLoginAttempts(userID int) error {
-	query := `UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ?`
-	_, err := r.db.Exec(query, userID)
-	return err
+// IncrementFailedLoginAttempts counts a failed login of the user and
+// returns how many there have been in a row, this one included.
+func (r *UserRepository) IncrementFailedLoginAttempts(userID int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ?`, userID); err != nil {
+		return 0, fmt.Errorf("failed to count failed login: %w", err)
+	}
+	var attempts int
+	if err := tx.QueryRow(`SELECT failed_login_attempts FROM users WHERE id = ?`, userID).Scan(&attempts); err != nil {
+		return 0, fmt.Errorf("failed to read failed logins: %w", err)
+	}
+	return attempts, tx.Commit()
 }
 
 func (r *UserRepository) ResetFailedLoginAttempts(userID int) error {
@@ -220,12 +233,33 @@ func (r *UserRepository) UnlockAccount(userID int) error {
 	return err
 }
 
-func (r *UserRepository) Delete(id int) error {
-	query := `DELETE FROM users WHERE id = ?`
-	_, err := r.db.Exec(query, id)
+// SetActive enables or disables a user's account
+func (r *UserRepository) SetActive(userID int, active bool) error {
+	query := `UPDATE users SET is_active = ?, updated_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, active, time.Now(), userID)
+	return err
+}
+
+// SetRole changes a user's role
+func (r *UserRepository) SetRole(userID, roleID int) error {
+	query := `UPDATE users SET role_id = ?, updated_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, roleID, time.Now(), userID)
 	return err
 }
 
+// Delete soft-deletes a user. The account stays in the recycle bin until it
+// is restored or purged, and cannot sign in meanwhile.
+func (r *UserRepository) Delete(id int) error {
+	deleted, err := r.db.SoftDelete(context.Background(), "users", int64(id))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
 func (r *UserRepository) List(limit, offset int) ([]models.User, error) {
 	query := `
 		SELECT id, username, email, password_hash, salt, role_id, first_name, last_name,
@@ -233,6 +267,7 @@ func (r *UserRepository) List(limit, offset int) ([]models.User, error) {
 			   locked_until, failed_login_attempts, last_login_at, last_login_ip,
 			   created_at, updated_at, settings
 		FROM users
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -271,7 +306,7 @@ func (r *UserRepository) List(limit, offset int) ([]models.User, error) {
 }
 
 func (r *UserRepository) Count() (int, error) {
-	query := `SELECT COUNT(*) FROM users`
+	query := `SELECT COUNT(*) FROM users WHERE deleted_at IS NULL`
 	var count int
 	err := r.db.QueryRow(query).Scan(&count)
 	return count, err
@@ -305,6 +340,9 @@ func (r *UserRepository) GetRole(roleID int) (*models.Role, error) {
 	return role, nil
 }
 
+// ErrSessionNotFound is returned by GetSession for unknown sessions
+var ErrSessionNotFound = errors.New("session not found")
+
 func (r *UserRepository) CreateSession(session *models.UserSession) (int, error) {
 	query := `
 		INSERT INTO user_sessions (user_id, session_token, refresh_token, device_info,
@@ -346,7 +384,7 @@ func (r *UserRepository) GetSession(sessionID string) (*models.UserSession, erro
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("session not found")
+			return nil, ErrSessionNotFound
 		}
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
@@ -416,6 +454,17 @@ func (r *UserRepository) DeactivateAllUserSessions(userID int) error {
 	return err
 }
 
+// DeactivateOtherUserSessions ends all active sessions of a user except
+// keepSessionID, returning how many were ended
+func (r *UserRepository) DeactivateOtherUserSessions(userID, keepSessionID int) (int64, error) {
+	query := `UPDATE user_sessions SET is_active = 0 WHERE user_id = ? AND id <> ? AND is_active = 1`
+	result, err := r.db.Exec(query, userID, keepSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deactivate sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 func (r *UserRepository) GetActiveUserSessions(userID int) ([]models.UserSession, error) {
 	query := `
 		SELECT id, user_id, session_token, refresh_token, device_info, ip_address,
@@ -319,17 +319,27 @@ func TestUserRepository_Delete(t *testing.T) {
 			name: "success",
 			id:   1,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM users WHERE id").
-					WithArgs(1).
+				mock.ExpectExec("UPDATE users SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(1)).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
+		{
+			name: "already deleted",
+			id:   2,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
 		{
 			name: "database error",
 			id:   999,
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM users WHERE id").
-					WithArgs(999).
+				mock.ExpectExec("UPDATE users SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), int64(999)).
 					WillReturnError(sql.ErrConnDone)
 			},
 			wantErr: true,
@@ -539,12 +549,18 @@ func TestUserRepository_LockUnlockAccount(t *testing.T) {
 func TestUserRepository_FailedLoginAttempts(t *testing.T) {
 	t.Run("increment", func(t *testing.T) {
 		repo, mock := newMockUserRepo(t)
+		mock.ExpectBegin()
 		mock.ExpectExec("UPDATE users SET failed_login_attempts = failed_login_attempts").
 			WithArgs(1).
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT failed_login_attempts FROM users").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login_attempts"}).AddRow(3))
+		mock.ExpectCommit()
 
-		err := repo.IncrementFailedLoginAttempts(1)
+		attempts, err := repo.IncrementFailedLoginAttempts(1)
 		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -634,7 +650,7 @@ func TestUserRepository_GetByUsernameOrEmail(t *testing.T) {
 			name:            "success with username",
 			usernameOrEmail: "testuser",
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT .+ FROM users WHERE username = \\? OR email = \\?").
+				mock.ExpectQuery("SELECT .+ FROM users WHERE \\(username = \\? OR email = \\?\\)").
 					WithArgs("testuser", "testuser").
 					WillReturnRows(sampleUserRow(now))
 			},
@@ -647,7 +663,7 @@ func TestUserRepository_GetByUsernameOrEmail(t *testing.T) {
 			name:            "success with email",
 			usernameOrEmail: "test@example.com",
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT .+ FROM users WHERE username = \\? OR email = \\?").
+				mock.ExpectQuery("SELECT .+ FROM users WHERE \\(username = \\? OR email = \\?\\)").
 					WithArgs("test@example.com", "test@example.com").
 					WillReturnRows(sampleUserRow(now))
 			},
@@ -660,7 +676,7 @@ func TestUserRepository_GetByUsernameOrEmail(t *testing.T) {
 			name:            "not found",
 			usernameOrEmail: "nonexistent",
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT .+ FROM users WHERE username = \\? OR email = \\?").
+				mock.ExpectQuery("SELECT .+ FROM users WHERE \\(username = \\? OR email = \\?\\)").
 					WithArgs("nonexistent", "nonexistent").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -670,7 +686,7 @@ func TestUserRepository_GetByUsernameOrEmail(t *testing.T) {
 			name:            "database error",
 			usernameOrEmail: "testuser",
 			setup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT .+ FROM users WHERE username = \\? OR email = \\?").
+				mock.ExpectQuery("SELECT .+ FROM users WHERE \\(username = \\? OR email = \\?\\)").
 					WithArgs("testuser", "testuser").
 					WillReturnError(sql.ErrConnDone)
 			},
@@ -840,3 +856,30 @@ func TestUserRepository_GetRole(t *testing.T) {
 		})
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Sessions
+// ---------------------------------------------------------------------------
+
+func TestUserRepository_GetSession_NotFound(t *testing.T) {
+	repo, mock := newMockUserRepo(t)
+	mock.ExpectQuery("SELECT .+ FROM user_sessions WHERE id = \\?").
+		WithArgs("9").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err := repo.GetSession("9")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_DeactivateOtherUserSessions(t *testing.T) {
+	repo, mock := newMockUserRepo(t)
+	mock.ExpectExec("UPDATE user_sessions SET is_active = 0 WHERE user_id = \\? AND id <> \\?").
+		WithArgs(1, 4).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	revoked, err := repo.DeactivateOtherUserSessions(1, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), revoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,6 +3,12 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"catalogizer/models"
@@ -585,16 +591,623 @@ func (s *AnalyticsService) GetAnalytics(userID int, filters *models.AnalyticsFil
 	return &models.AnalyticsData{}, nil
 }
 
-// GetDashboardMetrics gets dashboard metrics
-func (s *AnalyticsService) GetDashboardMetrics(userID int) (*models.DashboardMetrics, error) {
-	// This is a simplified implementation
-	return &models.DashboardMetrics{}, nil
+// Analytics dashboard defaults and limits
+const (
+	// MaxAnalyticsBatch is the most events one TrackEvents call accepts
+	MaxAnalyticsBatch = 500
+	// defaultDashboardRange is the period shown when no dates are given
+	defaultDashboardRange = 30 * 24 * time.Hour
+	// realtimeWindow is how far back realtime metrics look
+	realtimeWindow = 5 * time.Minute
+	// defaultTimeSeriesPoints and maxTimeSeriesPoints bound the points a
+	// time series returns
+	defaultTimeSeriesPoints = 500
+	maxTimeSeriesPoints     = 5000
+	// maxTimeSeriesIntervals is the most intervals a time series reads
+	// before downsampling, ten years of hours
+	maxTimeSeriesIntervals = 10 * 366 * 24
+	// mediaUsageMinGroupSize is the fewest viewers a media usage
+	// breakdown group needs to be reported on its own
+	mediaUsageMinGroupSize = 5
+	// mediaCompletionThreshold is the share of the runtime a play must
+	// reach to count as completed, leaving room for end credits
+	mediaCompletionThreshold = 0.9
+)
+
+// TrackEvents records a batch of client events for userID in one
+// transaction. Events without a timestamp, or with one in the future, are
+// stamped with the server time.
+func (s *AnalyticsService) TrackEvents(userID int, requests []models.AnalyticsEventRequest, ipAddress, userAgent string) error {
+	if len(requests) == 0 {
+		return fmt.Errorf("invalid batch: no events")
+	}
+	if len(requests) > MaxAnalyticsBatch {
+		return fmt.Errorf("invalid batch: at most %d events are accepted", MaxAnalyticsBatch)
+	}
+
+	now := time.Now()
+	events := make([]*models.AnalyticsEvent, 0, len(requests))
+	for i := range requests {
+		request := &requests[i]
+		if strings.TrimSpace(request.EventType) == "" {
+			return fmt.Errorf("invalid event %d: event_type is required", i)
+		}
+
+		timestamp := now
+		if request.Timestamp != nil && !request.Timestamp.IsZero() && request.Timestamp.Before(now) {
+			timestamp = *request.Timestamp
+		}
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event %d: %w", i, err)
+		}
+
+		event := &models.AnalyticsEvent{
+			UserID:        userID,
+			EventType:     request.EventType,
+			EventCategory: request.EventCategory,
+			Data:          string(data),
+			Timestamp:     timestamp,
+		}
+		if ipAddress != "" {
+			event.IPAddress = &ipAddress
+		}
+		if userAgent != "" {
+			event.UserAgent = &userAgent
+		}
+		events = append(events, event)
+	}
+
+	return s.analyticsRepo.LogEvents(events)
 }
 
-// GetRealtimeMetrics gets realtime metrics
-func (s *AnalyticsService) GetRealtimeMetrics(userID int) (*models.RealtimeMetrics, error) {
-	// This is a simplified implementation
-	return &models.RealtimeMetrics{}, nil
+// resolveAnalyticsRange returns the period and bucket the filters ask
+// for. It defaults to the last 30 days, in hourly buckets for periods of
+// two days or less and daily buckets otherwise.
+func resolveAnalyticsRange(filters *models.AnalyticsFilters, now time.Time) (time.Time, time.Time, string, error) {
+	if filters == nil {
+		filters = &models.AnalyticsFilters{}
+	}
+
+	endDate := now
+	if filters.EndDate != nil {
+		endDate = *filters.EndDate
+	}
+	startDate := endDate.Add(-defaultDashboardRange)
+	if filters.StartDate != nil {
+		startDate = *filters.StartDate
+	}
+	if !startDate.Before(endDate) {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("invalid date range: start_date must be before end_date")
+	}
+
+	bucket := filters.Bucket
+	switch bucket {
+	case "":
+		bucket = models.AnalyticsBucketDay
+		if endDate.Sub(startDate) <= 48*time.Hour {
+			bucket = models.AnalyticsBucketHour
+		}
+	case models.AnalyticsBucketHour, models.AnalyticsBucketDay, models.AnalyticsBucketWeek, models.AnalyticsBucketMonth:
+	default:
+		return time.Time{}, time.Time{}, "", fmt.Errorf("invalid bucket %q: use hour, day, week or month", bucket)
+	}
+
+	return startDate, endDate, bucket, nil
+}
+
+// GetDashboardMetrics returns library totals together with event and
+// media access timelines for the period the filters select. EventTypes
+// narrows the event timeline. RecentActivity counts the events of the last
+// 24 hours. Whole hours the analytics retention job has already rolled up
+// are read from the hourly rollups rather than the raw rows; Freshness
+// reports which hours those were.
+func (s *AnalyticsService) GetDashboardMetrics(filters *models.AnalyticsFilters) (*models.DashboardMetrics, error) {
+	now := time.Now()
+	startDate, endDate, bucket, err := resolveAnalyticsRange(filters, now)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := &models.DashboardMetrics{
+		StartDate:        startDate,
+		EndDate:          endDate,
+		Bucket:           bucket,
+		EventTimeline:    []models.TimeBucketCount{},
+		AccessTimeline:   []models.TimeBucketCount{},
+		EventBreakdown:   map[string]int{},
+		TopAccessedMedia: []models.MediaAccessCount{},
+		StorageGrowth:    []models.StorageGrowthPoint{},
+		Freshness:        models.AnalyticsFreshness{GeneratedAt: now},
+	}
+	if s.analyticsRepo == nil {
+		return metrics, nil
+	}
+
+	rollupStart, rollupEnd, err := s.rollupRange(startDate, endDate, &metrics.Freshness)
+	if err != nil {
+		return nil, err
+	}
+
+	totalUsers, err := s.analyticsRepo.GetTotalUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	activeUsers, err := s.analyticsRepo.CountActiveUsersWithRollups(startDate, endDate, rollupStart, rollupEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active users: %w", err)
+	}
+	recentActivity, err := s.analyticsRepo.GetTotalEvents(now.Add(-24*time.Hour), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recent events: %w", err)
+	}
+	metrics.TotalUsers = int64(totalUsers)
+	metrics.ActiveUsers = int64(activeUsers)
+	metrics.RecentActivity = int64(recentActivity)
+
+	if metrics.TotalMediaItems, err = s.analyticsRepo.GetTotalMediaItems(); err != nil {
+		return nil, fmt.Errorf("failed to count media items: %w", err)
+	}
+	// The daily snapshot spares summing the files table; before the first
+	// snapshot the files are summed directly
+	if metrics.TotalStorageUsed, metrics.Freshness.StorageAsOf, err = s.analyticsRepo.GetLatestStorageUsage(); err != nil {
+		return nil, fmt.Errorf("failed to read storage usage: %w", err)
+	}
+	if metrics.Freshness.StorageAsOf == nil {
+		if metrics.TotalStorageUsed, err = s.analyticsRepo.GetTotalStorageUsed(); err != nil {
+			return nil, fmt.Errorf("failed to sum storage used: %w", err)
+		}
+	}
+	if metrics.StorageGrowth, err = s.analyticsRepo.GetStorageGrowth(startDate.Truncate(24*time.Hour), endDate); err != nil {
+		return nil, err
+	}
+
+	var eventTypes []string
+	if filters != nil {
+		eventTypes = filters.EventTypes
+	}
+	if metrics.EventTimeline, err = s.analyticsRepo.GetEventTimelineWithRollups(startDate, endDate, rollupStart, rollupEnd, bucket, eventTypes); err != nil {
+		return nil, err
+	}
+	if metrics.AccessTimeline, err = s.analyticsRepo.GetAccessTimelineWithRollups(startDate, endDate, rollupStart, rollupEnd, bucket); err != nil {
+		return nil, err
+	}
+	if metrics.EventBreakdown, err = s.analyticsRepo.GetEventTypeCountsWithRollups(startDate, endDate, rollupStart, rollupEnd); err != nil {
+		return nil, err
+	}
+	topMedia, err := s.analyticsRepo.GetTopAccessedMediaWithRollups(startDate, endDate, rollupStart, rollupEnd, 10)
+	if err != nil {
+		return nil, err
+	}
+	if topMedia != nil {
+		metrics.TopAccessedMedia = topMedia
+	}
+
+	return metrics, nil
+}
+
+// dashboardRollupRange returns the whole hours of [startDate, endDate)
+// the hourly rollups cover, up to watermark. The dashboard reads those
+// hours from the rollups and the rest from the raw rows; an empty range,
+// start equal to end, means everything is read raw.
+func dashboardRollupRange(startDate, endDate time.Time, watermark *time.Time) (time.Time, time.Time) {
+	if watermark == nil {
+		return startDate, startDate
+	}
+	rollupStart := startDate.Truncate(time.Hour)
+	if rollupStart.Before(startDate) {
+		rollupStart = rollupStart.Add(time.Hour)
+	}
+	rollupEnd := endDate.Truncate(time.Hour)
+	if watermark.Before(rollupEnd) {
+		rollupEnd = *watermark
+	}
+	if !rollupStart.Before(rollupEnd) {
+		return startDate, startDate
+	}
+	return rollupStart, rollupEnd
+}
+
+// rollupRange reads how far the hourly rollups go and returns the hours
+// of [startDate, endDate) to read from them, recording both in freshness.
+func (s *AnalyticsService) rollupRange(startDate, endDate time.Time, freshness *models.AnalyticsFreshness) (time.Time, time.Time, error) {
+	watermark, err := s.analyticsRepo.GetRollupWatermark()
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to read rollup progress: %w", err)
+	}
+	rollupStart, rollupEnd := dashboardRollupRange(startDate, endDate, watermark)
+	freshness.RolledUpUntil = watermark
+	if rollupStart.Before(rollupEnd) {
+		freshness.RollupStart = &rollupStart
+		freshness.RollupEnd = &rollupEnd
+	}
+	return rollupStart, rollupEnd, nil
+}
+
+// GetTimeSeries returns one metric per interval over the period the
+// filters select, for charts; Bucket is the interval and EventTypes
+// narrows the events and active_users metrics. Intervals without activity
+// count zero. Storage metrics take the last daily snapshot of each
+// interval and skip intervals without one. Series longer than maxPoints
+// (0 means defaultTimeSeriesPoints) are downsampled with
+// largest-triangle-three-buckets, which keeps the peaks and dips that
+// averaging would flatten.
+func (s *AnalyticsService) GetTimeSeries(metric string, filters *models.AnalyticsFilters, maxPoints int) (*models.AnalyticsTimeSeries, error) {
+	if maxPoints == 0 {
+		maxPoints = defaultTimeSeriesPoints
+	}
+	if maxPoints < 3 || maxPoints > maxTimeSeriesPoints {
+		return nil, fmt.Errorf("invalid max_points %d: use 3 to %d", maxPoints, maxTimeSeriesPoints)
+	}
+	now := time.Now()
+	startDate, endDate, interval, err := resolveAnalyticsRange(filters, now)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &models.AnalyticsTimeSeries{
+		Metric:    metric,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Interval:  interval,
+		Freshness: models.AnalyticsFreshness{GeneratedAt: now},
+	}
+	points := []models.TimeSeriesPoint{}
+	switch metric {
+	case models.AnalyticsMetricEvents, models.AnalyticsMetricActiveUsers, models.AnalyticsMetricMediaAccesses:
+		starts, err := intervalStarts(startDate, endDate, interval)
+		if err != nil {
+			return nil, err
+		}
+		buckets := make(map[int64]models.TimeBucketCount)
+		if s.analyticsRepo != nil {
+			rollupStart, rollupEnd, err := s.rollupRange(startDate, endDate, &series.Freshness)
+			if err != nil {
+				return nil, err
+			}
+			var timeline []models.TimeBucketCount
+			if metric == models.AnalyticsMetricMediaAccesses {
+				timeline, err = s.analyticsRepo.GetAccessTimelineWithRollups(startDate, endDate, rollupStart, rollupEnd, interval)
+			} else {
+				var eventTypes []string
+				if filters != nil {
+					eventTypes = filters.EventTypes
+				}
+				timeline, err = s.analyticsRepo.GetEventTimelineWithRollups(startDate, endDate, rollupStart, rollupEnd, interval, eventTypes)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, bucket := range timeline {
+				buckets[bucket.BucketStart.Unix()] = bucket
+			}
+		}
+		for _, start := range starts {
+			bucket := buckets[start.Unix()]
+			value := bucket.Count
+			if metric == models.AnalyticsMetricActiveUsers {
+				value = bucket.UniqueUsers
+			}
+			points = append(points, models.TimeSeriesPoint{Time: start, Value: float64(value)})
+		}
+
+	case models.AnalyticsMetricStorageBytes, models.AnalyticsMetricStorageFiles:
+		if s.analyticsRepo == nil {
+			break
+		}
+		growth, err := s.analyticsRepo.GetStorageGrowth(startDate.Truncate(24*time.Hour), endDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range growth {
+			value := float64(snapshot.TotalBytes)
+			if metric == models.AnalyticsMetricStorageFiles {
+				value = float64(snapshot.FileCount)
+			}
+			start := intervalStart(snapshot.Date, interval)
+			if n := len(points); n > 0 && points[n-1].Time.Equal(start) {
+				points[n-1].Value = value
+				continue
+			}
+			points = append(points, models.TimeSeriesPoint{Time: start, Value: value})
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid metric %q: use events, active_users, media_accesses, storage_bytes or storage_files", metric)
+	}
+
+	series.RawPoints = len(points)
+	if len(points) > maxPoints {
+		points = downsampleLTTB(points, maxPoints)
+		series.Downsampled = true
+	}
+	series.Points = points
+	return series, nil
+}
+
+// intervalStart truncates t, in UTC like the timeline queries, to the
+// start of its hour, day, week (starting Monday) or month.
+func intervalStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case models.AnalyticsBucketHour:
+		return t.Truncate(time.Hour)
+	case models.AnalyticsBucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case models.AnalyticsBucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// intervalStarts lists the starts of the intervals overlapping
+// [startDate, endDate), refusing more than maxTimeSeriesIntervals.
+func intervalStarts(startDate, endDate time.Time, interval string) ([]time.Time, error) {
+	var starts []time.Time
+	for t := intervalStart(startDate, interval); t.Before(endDate); {
+		if len(starts) == maxTimeSeriesIntervals {
+			return nil, fmt.Errorf("invalid interval %q: the period spans more than %d intervals", interval, maxTimeSeriesIntervals)
+		}
+		starts = append(starts, t)
+		switch interval {
+		case models.AnalyticsBucketHour:
+			t = t.Add(time.Hour)
+		case models.AnalyticsBucketWeek:
+			t = t.AddDate(0, 0, 7)
+		case models.AnalyticsBucketMonth:
+			t = t.AddDate(0, 1, 0)
+		default:
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return starts, nil
+}
+
+// downsampleLTTB reduces points to threshold points with the
+// largest-triangle-three-buckets algorithm. The first and last points are
+// kept; the points in between are split into threshold-2 buckets and from
+// each the point forming the largest triangle with the point kept before
+// it and the average of the next bucket is kept.
+func downsampleLTTB(points []models.TimeSeriesPoint, threshold int) []models.TimeSeriesPoint {
+	if threshold < 3 || threshold >= len(points) {
+		return points
+	}
+	origin := points[0].Time
+	x := func(i int) float64 { return points[i].Time.Sub(origin).Seconds() }
+
+	sampled := make([]models.TimeSeriesPoint, 0, threshold)
+	sampled = append(sampled, points[0])
+	every := float64(len(points)-2) / float64(threshold-2)
+	kept := 0
+	for i := 0; i < threshold-2; i++ {
+		nextStart := int(float64(i+1)*every) + 1
+		nextEnd := int(float64(i+2)*every) + 1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += x(j)
+			avgY += points[j].Value
+		}
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		keptX, keptY := x(kept), points[kept].Value
+		best, bestArea := -1, -1.0
+		for j := int(float64(i)*every) + 1; j < nextStart; j++ {
+			area := math.Abs((keptX-avgX)*(points[j].Value-keptY) - (keptX-x(j))*(avgY-keptY))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		sampled = append(sampled, points[best])
+		kept = best
+	}
+	return append(sampled, points[len(points)-1])
+}
+
+// GetRealtimeMetrics returns the activity of the last five minutes and the
+// host's load average per CPU.
+func (s *AnalyticsService) GetRealtimeMetrics() (*models.RealtimeMetrics, error) {
+	metrics := &models.RealtimeMetrics{SystemLoad: systemLoad()}
+	if s.analyticsRepo == nil {
+		return metrics, nil
+	}
+
+	now := time.Now()
+	since := now.Add(-realtimeWindow)
+	var err error
+	if metrics.ActiveUsers, err = s.analyticsRepo.CountActiveUsers(since, now); err != nil {
+		return nil, fmt.Errorf("failed to count active users: %w", err)
+	}
+	if metrics.CurrentStreams, err = s.analyticsRepo.CountCurrentStreams(since); err != nil {
+		return nil, fmt.Errorf("failed to count current streams: %w", err)
+	}
+	if metrics.RecentEvents, err = s.analyticsRepo.GetTotalEvents(since, now); err != nil {
+		return nil, fmt.Errorf("failed to count recent events: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// GetUserActivity returns a user's analytics for the period the filters
+// select, with their events per bucket in Activity.
+func (s *AnalyticsService) GetUserActivity(userID int, filters *models.AnalyticsFilters) (*models.UserAnalytics, error) {
+	startDate, endDate, bucket, err := resolveAnalyticsRange(filters, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	analytics, err := s.GetUserAnalytics(userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if analytics.Activity, err = s.analyticsRepo.GetEventTimeline(startDate, endDate, bucket, userID, nil); err != nil {
+		return nil, err
+	}
+
+	return analytics, nil
+}
+
+// GetMediaUsageStats returns how a media item was played over the period the
+// filters select, by default the last 30 days. It reads the raw access
+// logs, so hours older than their retention no longer count.
+func (s *AnalyticsService) GetMediaUsageStats(mediaID int, filters *models.AnalyticsFilters) (*models.MediaUsageStats, error) {
+	startDate, endDate, _, err := resolveAnalyticsRange(filters, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.MediaUsageStats{
+		MediaID:      mediaID,
+		StartDate:    startDate,
+		EndDate:      endDate,
+		Actions:      map[string]int{},
+		Countries:    []models.MediaUsageGroup{},
+		DeviceTypes:  []models.MediaUsageGroup{},
+		Platforms:    []models.MediaUsageGroup{},
+		MinGroupSize: mediaUsageMinGroupSize,
+	}
+	if s.analyticsRepo == nil {
+		return stats, nil
+	}
+
+	runtimeMinutes, err := s.analyticsRepo.GetMediaItemRuntime(mediaID)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.analyticsRepo.GetMediaItemAccessLogs(mediaID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	summarizeMediaUsage(stats, logs, runtimeMinutes)
+	return stats, nil
+}
+
+// summarizeMediaUsage adds up access logs into stats. runtimeMinutes is
+// nil when the runtime is unknown.
+func summarizeMediaUsage(stats *models.MediaUsageStats, logs []models.MediaAccessLog, runtimeMinutes *int) {
+	viewers := make(map[int]bool)
+	countries, deviceTypes, platforms := mediaUsageBreakdown{}, mediaUsageBreakdown{}, mediaUsageBreakdown{}
+	var timed, completed int
+	var completionSum float64
+
+	for _, log := range logs {
+		stats.Actions[log.Action]++
+		if log.Action != "play" && log.Action != "stream" {
+			continue
+		}
+		stats.Plays++
+		viewers[log.UserID] = true
+
+		country, deviceType, platform := "", "", ""
+		if log.Location != nil && log.Location.Country != nil {
+			country = strings.ToUpper(*log.Location.Country)
+		}
+		if log.DeviceInfo != nil {
+			if log.DeviceInfo.DeviceType != nil {
+				deviceType = strings.ToLower(*log.DeviceInfo.DeviceType)
+			}
+			if log.DeviceInfo.Platform != nil {
+				platform = strings.ToLower(*log.DeviceInfo.Platform)
+			}
+		}
+		countries.add(country, log.UserID)
+		deviceTypes.add(deviceType, log.UserID)
+		platforms.add(platform, log.UserID)
+
+		if log.PlaybackDuration == nil || *log.PlaybackDuration <= 0 {
+			continue
+		}
+		stats.TotalPlaybackSeconds += int64(log.PlaybackDuration.Seconds())
+		if runtimeMinutes != nil {
+			share := math.Min(1, log.PlaybackDuration.Seconds()/float64(*runtimeMinutes*60))
+			timed++
+			completionSum += share
+			if share >= mediaCompletionThreshold {
+				completed++
+			}
+		}
+	}
+
+	stats.UniqueViewers = len(viewers)
+	if timed > 0 {
+		rate := float64(completed) / float64(timed)
+		average := completionSum / float64(timed)
+		stats.CompletionRate, stats.AverageCompletion = &rate, &average
+	}
+	stats.Countries = countries.groups(stats.MinGroupSize)
+	stats.DeviceTypes = deviceTypes.groups(stats.MinGroupSize)
+	stats.Platforms = platforms.groups(stats.MinGroupSize)
+}
+
+// mediaUsageBreakdown tallies the plays and distinct viewers of each
+// group of one breakdown.
+type mediaUsageBreakdown map[string]*mediaUsageTally
+
+type mediaUsageTally struct {
+	plays   int
+	viewers map[int]bool
+}
+
+func (b mediaUsageBreakdown) add(group string, userID int) {
+	if group == "" {
+		group = "unknown"
+	}
+	tally, ok := b[group]
+	if !ok {
+		tally = &mediaUsageTally{viewers: make(map[int]bool)}
+		b[group] = tally
+	}
+	tally.plays++
+	tally.viewers[userID] = true
+}
+
+// groups returns the groups, most played first, with those of fewer than
+// minViewers viewers folded into a trailing "other" group.
+func (b mediaUsageBreakdown) groups(minViewers int) []models.MediaUsageGroup {
+	groups := []models.MediaUsageGroup{}
+	other := &mediaUsageTally{viewers: make(map[int]bool)}
+	for name, tally := range b {
+		if len(tally.viewers) < minViewers || name == "other" {
+			other.plays += tally.plays
+			for userID := range tally.viewers {
+				other.viewers[userID] = true
+			}
+			continue
+		}
+		groups = append(groups, models.MediaUsageGroup{Name: name, Plays: tally.plays, Viewers: len(tally.viewers)})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Plays != groups[j].Plays {
+			return groups[i].Plays > groups[j].Plays
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	if other.plays > 0 {
+		groups = append(groups, models.MediaUsageGroup{Name: "other", Plays: other.plays, Viewers: len(other.viewers)})
+	}
+	return groups
+}
+
+// systemLoad returns the one-minute load average divided by the number of
+// CPUs, or 0 where /proc/loadavg is unavailable.
+func systemLoad() float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return load / float64(runtime.NumCPU())
 }
 
 // GenerateReport generates an analytics report
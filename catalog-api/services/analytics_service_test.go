@@ -1030,21 +1030,34 @@ func TestAnalyticsService_GetAnalytics(t *testing.T) {
 
 func TestAnalyticsService_GetDashboardMetrics(t *testing.T) {
 	svc := newTestAnalyticsService()
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
 
 	tests := []struct {
-		name   string
-		userID int
+		name       string
+		filters    *models.AnalyticsFilters
+		wantBucket string
+		wantErr    bool
 	}{
-		{name: "user 1", userID: 1},
-		{name: "user 0", userID: 0},
-		{name: "large user ID", userID: 999999},
+		{name: "nil filters", filters: nil, wantBucket: models.AnalyticsBucketDay},
+		{name: "short range uses hours", filters: &models.AnalyticsFilters{StartDate: &start, EndDate: &end}, wantBucket: models.AnalyticsBucketHour},
+		{name: "explicit bucket", filters: &models.AnalyticsFilters{Bucket: models.AnalyticsBucketWeek}, wantBucket: models.AnalyticsBucketWeek},
+		{name: "unknown bucket", filters: &models.AnalyticsFilters{Bucket: "minute"}, wantErr: true},
+		{name: "reversed range", filters: &models.AnalyticsFilters{StartDate: &end, EndDate: &start}, wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			metrics, err := svc.GetDashboardMetrics(tt.userID)
+			metrics, err := svc.GetDashboardMetrics(tt.filters)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid")
+				return
+			}
 			assert.NoError(t, err)
 			assert.NotNil(t, metrics)
+			assert.Equal(t, tt.wantBucket, metrics.Bucket)
+			assert.NotNil(t, metrics.EventTimeline)
 		})
 	}
 }
@@ -1052,21 +1065,10 @@ func TestAnalyticsService_GetDashboardMetrics(t *testing.T) {
 func TestAnalyticsService_GetRealtimeMetrics(t *testing.T) {
 	svc := newTestAnalyticsService()
 
-	tests := []struct {
-		name   string
-		userID int
-	}{
-		{name: "user 1", userID: 1},
-		{name: "user 0", userID: 0},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			metrics, err := svc.GetRealtimeMetrics(tt.userID)
-			assert.NoError(t, err)
-			assert.NotNil(t, metrics)
-		})
-	}
+	metrics, err := svc.GetRealtimeMetrics()
+	assert.NoError(t, err)
+	assert.NotNil(t, metrics)
+	assert.GreaterOrEqual(t, metrics.SystemLoad, 0.0)
 }
 
 func TestAnalyticsService_GenerateReport(t *testing.T) {
@@ -1286,4 +1288,117 @@ func TestAnalyticsService_ExtractDateRange_AllBranches(t *testing.T) {
 	}
 }
 
+func TestAnalyticsService_GetTimeSeries(t *testing.T) {
+	svc := newTestAnalyticsService()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	filters := &models.AnalyticsFilters{StartDate: &start, EndDate: &end}
+
+	series, err := svc.GetTimeSeries(models.AnalyticsMetricEvents, filters, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AnalyticsBucketDay, series.Interval)
+	assert.Equal(t, 365, series.RawPoints)
+	assert.False(t, series.Downsampled)
+	assert.Equal(t, start, series.Points[0].Time)
+
+	filters.Bucket = models.AnalyticsBucketHour
+	series, err = svc.GetTimeSeries(models.AnalyticsMetricActiveUsers, filters, 300)
+	assert.NoError(t, err)
+	assert.Equal(t, 365*24, series.RawPoints)
+	assert.True(t, series.Downsampled)
+	assert.Len(t, series.Points, 300)
 
+	filters.Bucket = models.AnalyticsBucketWeek
+	series, err = svc.GetTimeSeries(models.AnalyticsMetricMediaAccesses, filters, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC), series.Points[0].Time, "weeks start on Monday")
+
+	_, err = svc.GetTimeSeries("bandwidth", filters, 0)
+	assert.ErrorContains(t, err, "invalid metric")
+	_, err = svc.GetTimeSeries(models.AnalyticsMetricEvents, filters, 2)
+	assert.ErrorContains(t, err, "invalid max_points")
+	longAgo := start.AddDate(-20, 0, 0)
+	filters.StartDate, filters.Bucket = &longAgo, models.AnalyticsBucketHour
+	_, err = svc.GetTimeSeries(models.AnalyticsMetricEvents, filters, 0)
+	assert.ErrorContains(t, err, "invalid interval")
+}
+
+func TestDownsampleLTTB(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]models.TimeSeriesPoint, 1000)
+	for i := range points {
+		points[i] = models.TimeSeriesPoint{Time: start.Add(time.Duration(i) * time.Hour), Value: 10}
+	}
+	points[437].Value = 500
+
+	sampled := downsampleLTTB(points, 50)
+	assert.Len(t, sampled, 50)
+	assert.Equal(t, points[0], sampled[0])
+	assert.Equal(t, points[999], sampled[49])
+	assert.Contains(t, sampled, points[437], "a spike survives downsampling")
+	for i := 1; i < len(sampled); i++ {
+		assert.True(t, sampled[i].Time.After(sampled[i-1].Time))
+	}
+
+	assert.Equal(t, points[:10], downsampleLTTB(points[:10], 50))
+}
+
+func TestSummarizeMediaUsage(t *testing.T) {
+	str := func(s string) *string { return &s }
+	minutes := func(m int) *time.Duration { d := time.Duration(m) * time.Minute; return &d }
+	var logs []models.MediaAccessLog
+	// Six viewers in Germany on TVs, each playing the whole film
+	for userID := 1; userID <= 6; userID++ {
+		logs = append(logs, models.MediaAccessLog{
+			UserID: userID, Action: "play", PlaybackDuration: minutes(100),
+			Location:   &models.Location{Country: str("de")},
+			DeviceInfo: &models.DeviceInfo{DeviceType: str("TV"), Platform: str("android")},
+		})
+	}
+	// One viewer in France watching half of it twice, and a download
+	for i := 0; i < 2; i++ {
+		logs = append(logs, models.MediaAccessLog{
+			UserID: 7, Action: "stream", PlaybackDuration: minutes(50),
+			Location:   &models.Location{Country: str("FR")},
+			DeviceInfo: &models.DeviceInfo{DeviceType: str("mobile"), Platform: str("ios")},
+		})
+	}
+	logs = append(logs, models.MediaAccessLog{UserID: 8, Action: "download"})
+
+	stats := &models.MediaUsageStats{Actions: map[string]int{}, MinGroupSize: 5}
+	runtime := 100
+	summarizeMediaUsage(stats, logs, &runtime)
+
+	assert.Equal(t, 8, stats.Plays)
+	assert.Equal(t, 7, stats.UniqueViewers)
+	assert.Equal(t, map[string]int{"play": 6, "stream": 2, "download": 1}, stats.Actions)
+	assert.Equal(t, int64(700*60), stats.TotalPlaybackSeconds)
+	if assert.NotNil(t, stats.CompletionRate) {
+		assert.InDelta(t, 0.75, *stats.CompletionRate, 1e-9)
+		assert.InDelta(t, 0.875, *stats.AverageCompletion, 1e-9)
+	}
+	// The lone French viewer is folded into "other"
+	assert.Equal(t, []models.MediaUsageGroup{{Name: "DE", Plays: 6, Viewers: 6}, {Name: "other", Plays: 2, Viewers: 1}}, stats.Countries)
+	assert.Equal(t, []models.MediaUsageGroup{{Name: "tv", Plays: 6, Viewers: 6}, {Name: "other", Plays: 2, Viewers: 1}}, stats.DeviceTypes)
+	assert.Equal(t, "android", stats.Platforms[0].Name)
+
+	// Without a runtime completion is unknown
+	stats = &models.MediaUsageStats{Actions: map[string]int{}, MinGroupSize: 5}
+	summarizeMediaUsage(stats, logs, nil)
+	assert.Nil(t, stats.CompletionRate)
+	assert.Nil(t, stats.AverageCompletion)
+	assert.Equal(t, int64(700*60), stats.TotalPlaybackSeconds)
+}
+
+func TestAnalyticsService_GetMediaUsageStats(t *testing.T) {
+	svc := newTestAnalyticsService()
+	stats, err := svc.GetMediaUsageStats(7, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, stats.MediaID)
+	assert.Equal(t, 5, stats.MinGroupSize)
+	assert.NotNil(t, stats.Countries)
+	assert.Equal(t, defaultDashboardRange, stats.EndDate.Sub(stats.StartDate))
+
+	_, err = svc.GetMediaUsageStats(7, &models.AnalyticsFilters{Bucket: "minute"})
+	assert.ErrorContains(t, err, "invalid")
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+)
+
+// APIKeyPrefix starts every API key, telling keys apart from JWTs
+const APIKeyPrefix = "ctlg_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear so users can
+// recognise it
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+// ErrAPIKeyNotFound is returned when an API key does not exist or belongs
+// to another user
+var ErrAPIKeyNotFound = repository.ErrAPIKeyNotFound
+
+// ErrInvalidAPIKey is returned for unknown, expired or unusable API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrInvalidAPIKeyRequest is returned for API keys that cannot be created
+// as requested
+var ErrInvalidAPIKeyRequest = errors.New("invalid API key request")
+
+// IsAPIKey reports whether a credential is an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// SetAPIKeys enables API key authentication
+func (s *AuthService) SetAPIKeys(apiKeys *repository.APIKeyRepository) {
+	s.apiKeys = apiKeys
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey creates an API key acting for a user with the requested
+// scopes, each of which the user's role must grant. The key itself is
+// returned only here.
+func (s *AuthService) CreateAPIKey(userID int, req models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	if s.apiKeys == nil {
+		return nil, errors.New("API keys are not enabled")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidAPIKeyRequest)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyRequest)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyRequest)
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	role, err := s.userRepo.GetRole(user.RoleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user role: %w", err)
+	}
+	scopes := models.Permissions{}
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !role.Permissions.HasPermission(scope) {
+			return nil, fmt.Errorf("%w: scope %q is not granted to your role", ErrInvalidAPIKeyRequest, scope)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyDisplayLength],
+		KeyHash:   hashAPIKey(key),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.apiKeys.Create(&apiKey); err != nil {
+		return nil, err
+	}
+	return &models.CreatedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+// ListAPIKeys returns a user's API keys, without their secrets
+func (s *AuthService) ListAPIKeys(userID int) ([]models.APIKey, error) {
+	if s.apiKeys == nil {
+		return []models.APIKey{}, nil
+	}
+	return s.apiKeys.ListByUser(userID)
+}
+
+// RevokeAPIKey deletes one of a user's API keys
+func (s *AuthService) RevokeAPIKey(userID, keyID int) error {
+	if s.apiKeys == nil {
+		return ErrAPIKeyNotFound
+	}
+	return s.apiKeys.Delete(userID, keyID)
+}
+
+// AuthenticateAPIKey returns the user an API key acts for. The user's
+// role is narrowed to the key's scopes, so permission checks against it
+// see only what both grant.
+func (s *AuthService) AuthenticateAPIKey(key string) (*models.User, error) {
+	if s.apiKeys == nil || !IsAPIKey(key) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := s.apiKeys.GetByHash(hashAPIKey(key))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if apiKey.IsExpired() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(apiKey.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.CanLogin() {
+		return nil, ErrInvalidAPIKey
+	}
+	role, err := s.userRepo.GetRole(user.RoleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user role: %w", err)
+	}
+	scoped := *role
+	scoped.Permissions = models.Permissions{}
+	for _, scope := range apiKey.Scopes {
+		if role.Permissions.HasPermission(scope) {
+			scoped.Permissions = append(scoped.Permissions, scope)
+		}
+	}
+	user.Role = &scoped
+
+	if err := s.apiKeys.TouchLastUsed(apiKey.ID, time.Now()); err != nil {
+		fmt.Printf("Failed to record API key use: %v\n", err)
+	}
+	return user, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAPIKeyTestService(t *testing.T) (*AuthService, *repository.APIKeyRepository) {
+	t.Helper()
+	db := setupTestDB(t)
+	apiKeys := repository.NewAPIKeyRepository(db)
+	service := NewAuthService(repository.NewUserRepository(db), "test-secret-key-12345")
+	service.SetAPIKeys(apiKeys)
+	return service, apiKeys
+}
+
+func TestAuthService_APIKeys(t *testing.T) {
+	service, apiKeys := newAPIKeyTestService(t)
+
+	// User 1 has the "user" role: read and write
+	created, err := service.CreateAPIKey(1, models.CreateAPIKeyRequest{Name: " backup script ", Scopes: []string{"read"}})
+	require.NoError(t, err)
+	assert.True(t, IsAPIKey(created.Key))
+	assert.Equal(t, "backup script", created.Name)
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.NotContains(t, created.KeyHash, created.Key)
+
+	stored, err := apiKeys.GetByHash(hashAPIKey(created.Key))
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, stored.ID)
+
+	user, err := service.GetCurrentUser(created.Key)
+	require.NoError(t, err)
+	assert.Equal(t, 1, user.ID)
+	assert.True(t, user.HasPermission("read"))
+	assert.False(t, user.HasPermission("write"))
+
+	keys, err := service.ListAPIKeys(1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+	assert.Equal(t, models.Permissions{"read"}, keys[0].Scopes)
+
+	// Another user cannot revoke it
+	assert.ErrorIs(t, service.RevokeAPIKey(2, created.ID), ErrAPIKeyNotFound)
+	require.NoError(t, service.RevokeAPIKey(1, created.ID))
+	_, err = service.GetCurrentUser(created.Key)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestAuthService_CreateAPIKey_Validation(t *testing.T) {
+	service, _ := newAPIKeyTestService(t)
+	past := time.Now().Add(-time.Hour)
+
+	for name, req := range map[string]models.CreateAPIKeyRequest{
+		"no name":         {Scopes: []string{"read"}},
+		"no scopes":       {Name: "script"},
+		"beyond role":     {Name: "script", Scopes: []string{"read", "admin"}},
+		"already expired": {Name: "script", Scopes: []string{"read"}, ExpiresAt: &past},
+	} {
+		_, err := service.CreateAPIKey(1, req)
+		assert.ErrorIs(t, err, ErrInvalidAPIKeyRequest, name)
+	}
+}
+
+func TestAuthService_AuthenticateAPIKey_Rejects(t *testing.T) {
+	service, _ := newAPIKeyTestService(t)
+
+	expiring := time.Now().Add(50 * time.Millisecond)
+	created, err := service.CreateAPIKey(1, models.CreateAPIKeyRequest{Name: "short", Scopes: []string{"read"}, ExpiresAt: &expiring})
+	require.NoError(t, err)
+	_, err = service.AuthenticateAPIKey(created.Key)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = service.AuthenticateAPIKey(created.Key)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	_, err = service.AuthenticateAPIKey(APIKeyPrefix + "unknown")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = service.AuthenticateAPIKey("not-a-key")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// Keys stop working for deactivated users
+	active, err := service.CreateAPIKey(1, models.CreateAPIKeyRequest{Name: "long", Scopes: []string{"read"}})
+	require.NoError(t, err)
+	user, err := service.userRepo.GetByID(1)
+	require.NoError(t, err)
+	user.IsActive = false
+	require.NoError(t, service.userRepo.Update(user))
+	_, err = service.AuthenticateAPIKey(active.Key)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Default attributes and filters of the LDAP backend. They cover both
+// OpenLDAP style directories and Active Directory.
+const (
+	defaultLDAPUserFilter  = "(&(objectClass=person)(|(uid={username})(sAMAccountName={username})(mail={username})))"
+	defaultLDAPGroupFilter = "(|(member={dn})(uniqueMember={dn})(memberUid={username}))"
+)
+
+var (
+	// ErrLDAPUserNotFound is returned when the directory has no entry for
+	// a username
+	ErrLDAPUserNotFound = errors.New("user not found in directory")
+	// ErrLDAPInvalidCredentials is returned when the directory rejects a
+	// password
+	ErrLDAPInvalidCredentials = errors.New("invalid directory credentials")
+	// ErrLDAPNotPermitted is returned for directory users in none of the
+	// groups allowed to sign in
+	ErrLDAPNotPermitted = errors.New("directory user is not in a permitted group")
+	// ErrLDAPUnavailable is returned when the directory cannot be reached
+	// or queried
+	ErrLDAPUnavailable = errors.New("directory is unavailable")
+	// ErrLDAPNotConfigured is returned by directory operations when no
+	// directory is configured
+	ErrLDAPNotConfigured = errors.New("ldap authentication is not configured")
+)
+
+// LDAPGroupRole gives the members of a directory group a role. Group is
+// matched against the group's DN or its name, ignoring case.
+type LDAPGroupRole struct {
+	Group  string
+	RoleID int
+}
+
+// LDAPConfig configures authentication against an LDAP directory or
+// Active Directory.
+type LDAPConfig struct {
+	// URL is ldap://host[:port] or ldaps://host[:port]
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS before binding
+	StartTLS bool
+	// CACertFile is a PEM file of certificates to trust instead of the
+	// system's
+	CACertFile string
+	// BindDN and BindPassword are the service account users are looked up
+	// with. Without them lookups bind anonymously.
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users and groups are searched
+	BaseDN string
+	// UserFilter finds a user's entry; {username} is replaced by the
+	// escaped username
+	UserFilter string
+	// UsernameAttributes name the attributes holding the account name, in
+	// order of preference. Defaults to uid, then sAMAccountName.
+	UsernameAttributes []string
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	// GroupBaseDN, when set, is searched with GroupFilter for the groups
+	// of a user, with {dn} and {username} replaced. Otherwise the groups
+	// come from the user's memberOf attribute.
+	GroupBaseDN string
+	GroupFilter string
+	// GroupRoles maps groups to roles; the first one the user is in
+	// applies, DefaultRoleID when none does
+	GroupRoles    []LDAPGroupRole
+	DefaultRoleID int
+	// RequireGroup only lets members of a group in GroupRoles sign in
+	RequireGroup bool
+	// AutoProvision creates accounts for directory users signing in for
+	// the first time. Without it only existing accounts are linked.
+	AutoProvision bool
+	// Timeout bounds each directory operation. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// LDAPUser is a user's directory entry
+type LDAPUser struct {
+	DN        string
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string
+	// RoleID is the role the user's groups map to, 0 when none does and
+	// there is no default
+	RoleID int
+}
+
+// LDAPAuthProvider checks credentials against an LDAP directory and looks
+// up users' entries and groups
+type LDAPAuthProvider struct {
+	config    LDAPConfig
+	tlsConfig *tls.Config
+}
+
+// NewLDAPAuthProvider validates the configuration and creates a provider.
+// No connection is made until the first lookup.
+func NewLDAPAuthProvider(config LDAPConfig) (*LDAPAuthProvider, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ldap url %q: expected ldap://host or ldaps://host", config.URL)
+	}
+	if config.BaseDN == "" {
+		return nil, errors.New("invalid ldap configuration: base_dn is required")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = defaultLDAPUserFilter
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = defaultLDAPGroupFilter
+	}
+	if len(config.UsernameAttributes) == 0 {
+		config.UsernameAttributes = []string{"uid", "sAMAccountName"}
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.FirstNameAttribute == "" {
+		config.FirstNameAttribute = "givenName"
+	}
+	if config.LastNameAttribute == "" {
+		config.LastNameAttribute = "sn"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	p := &LDAPAuthProvider{config: config, tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
+	// Catch filter typos at startup rather than at the first sign-in
+	if _, err := ldap.CompileFilter(p.userFilter("x")); err != nil {
+		return nil, err
+	}
+	if _, err := ldap.CompileFilter(p.groupFilter("cn=x", "x")); err != nil {
+		return nil, err
+	}
+	if config.CACertFile != "" {
+		pem, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ldap CA certificates: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CACertFile)
+		}
+		p.tlsConfig.RootCAs = pool
+	}
+	return p, nil
+}
+
+func (p *LDAPAuthProvider) userFilter(username string) string {
+	return strings.ReplaceAll(p.config.UserFilter, "{username}", ldap.EscapeFilter(username))
+}
+
+func (p *LDAPAuthProvider) groupFilter(dn, username string) string {
+	filter := strings.ReplaceAll(p.config.GroupFilter, "{dn}", ldap.EscapeFilter(dn))
+	return strings.ReplaceAll(filter, "{username}", ldap.EscapeFilter(username))
+}
+
+// connect opens a connection bound as the service account
+func (p *LDAPAuthProvider) connect(ctx context.Context) (*ldapConn, error) {
+	conn, err := dialLDAP(ctx, p.config.URL, p.config.StartTLS, p.tlsConfig, p.config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	if p.config.BindDN != "" {
+		if err := conn.bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			conn.close()
+			return nil, fmt.Errorf("%w: service account bind failed: %v", ErrLDAPUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// Authenticate checks a username and password against the directory and
+// returns the user's entry
+func (p *LDAPAuthProvider) Authenticate(ctx context.Context, username, password string) (*LDAPUser, error) {
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	// Groups are read with the service account, which may see more than
+	// the user
+	user, err := p.lookup(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.bind(user.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	if p.config.RequireGroup && !p.inMappedGroup(user.Groups) {
+		return nil, ErrLDAPNotPermitted
+	}
+	return user, nil
+}
+
+// lookup finds a user's entry and groups
+func (p *LDAPAuthProvider) lookup(conn *ldapConn, username string) (*LDAPUser, error) {
+	attrs := append([]string{p.config.EmailAttribute, p.config.FirstNameAttribute, p.config.LastNameAttribute, "memberOf"},
+		p.config.UsernameAttributes...)
+	entries, err := conn.search(p.config.BaseDN, p.userFilter(username), attrs, 2)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, fmt.Errorf("%w: base DN %s does not exist", ErrLDAPUnavailable, p.config.BaseDN)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	if len(entries) == 0 {
+		return nil, ErrLDAPUserNotFound
+	}
+	if len(entries) > 1 {
+		// An ambiguous filter must not let one user sign in as another
+		return nil, fmt.Errorf("%w: %d entries match %q", ErrLDAPUnavailable, len(entries), username)
+	}
+
+	entry := entries[0]
+	user := &LDAPUser{
+		DN:        entry.DN,
+		Email:     entry.GetEqualFoldAttributeValue(p.config.EmailAttribute),
+		FirstName: entry.GetEqualFoldAttributeValue(p.config.FirstNameAttribute),
+		LastName:  entry.GetEqualFoldAttributeValue(p.config.LastNameAttribute),
+		Groups:    entry.GetEqualFoldAttributeValues("memberOf"),
+	}
+	for _, attr := range p.config.UsernameAttributes {
+		if user.Username = entry.GetEqualFoldAttributeValue(attr); user.Username != "" {
+			break
+		}
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+
+	if p.config.GroupBaseDN != "" {
+		groups, err := conn.search(p.config.GroupBaseDN, p.groupFilter(user.DN, user.Username), []string{"cn"}, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: group lookup failed: %v", ErrLDAPUnavailable, err)
+		}
+		for _, group := range groups {
+			user.Groups = append(user.Groups, group.DN)
+		}
+	}
+	user.RoleID = p.roleFor(user.Groups)
+	return user, nil
+}
+
+// groupMatches reports whether a group DN is the configured group, given
+// by DN or by the value of its first RDN
+func groupMatches(dn, group string) bool {
+	if strings.EqualFold(dn, group) {
+		return true
+	}
+	rdn, _, _ := strings.Cut(dn, ",")
+	_, name, ok := strings.Cut(rdn, "=")
+	return ok && strings.EqualFold(name, group)
+}
+
+func (p *LDAPAuthProvider) mappedRole(groups []string) (int, bool) {
+	for _, mapping := range p.config.GroupRoles {
+		for _, dn := range groups {
+			if groupMatches(dn, mapping.Group) {
+				return mapping.RoleID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (p *LDAPAuthProvider) inMappedGroup(groups []string) bool {
+	_, ok := p.mappedRole(groups)
+	return ok
+}
+
+func (p *LDAPAuthProvider) roleFor(groups []string) int {
+	if role, ok := p.mappedRole(groups); ok {
+		return role
+	}
+	return p.config.DefaultRoleID
+}
+
+// SetLDAP enables sign-in with directory credentials. The directory is
+// asked before the local password, and logins it does not settle, such as
+// for users it does not know or while it is unreachable, go on to the
+// local password.
+func (s *AuthService) SetLDAP(provider *LDAPAuthProvider, accounts *repository.LDAPAccountRepository) {
+	s.ldap = provider
+	s.ldapAccounts = accounts
+}
+
+// loginViaLDAP checks credentials against the directory and returns the
+// linked account, linking or provisioning one on the first sign-in. The
+// account's role follows the user's groups.
+func (s *AuthService) loginViaLDAP(req models.LoginRequest) (*models.User, error) {
+	entry, err := s.ldap.Authenticate(context.Background(), req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	if account, err := s.ldapAccounts.GetByUsername(entry.Username); err == nil {
+		user, err = s.userRepo.GetByID(account.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		// Back in the directory: undo the sync's disabling at once
+		if account.DisabledBySync && !user.IsActive {
+			if err := s.userRepo.SetActive(user.ID, true); err != nil {
+				return nil, fmt.Errorf("failed to enable user: %w", err)
+			}
+			user.IsActive = true
+		}
+	} else if !errors.Is(err, repository.ErrLDAPAccountNotFound) {
+		return nil, err
+	} else if existing, err := s.userRepo.GetByUsername(entry.Username); err == nil {
+		user = existing
+	} else if !s.ldap.config.AutoProvision {
+		return nil, ErrLDAPUserNotFound
+	} else {
+		user = &models.User{Username: entry.Username, Email: entry.Email, RoleID: entry.RoleID}
+		if entry.FirstName != "" {
+			user.FirstName = &entry.FirstName
+		}
+		if entry.LastName != "" {
+			user.LastName = &entry.LastName
+		}
+		if user, err = s.createExternalUser(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if entry.RoleID != 0 && entry.RoleID != user.RoleID {
+		if err := s.userRepo.SetRole(user.ID, entry.RoleID); err != nil {
+			return nil, fmt.Errorf("failed to update role: %w", err)
+		}
+		user.RoleID = entry.RoleID
+	}
+	if err := s.ldapAccounts.RecordLogin(user.ID, entry.DN, entry.Username, time.Now()); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LDAPSyncResult is what a directory sync changed
+type LDAPSyncResult struct {
+	Checked   int `json:"checked"`
+	Disabled  int `json:"disabled"`
+	Reenabled int `json:"reenabled"`
+	// RolesChanged counts accounts whose role followed a change of groups
+	RolesChanged int `json:"roles_changed"`
+}
+
+// ListLDAPAccounts returns the accounts linked to directory entries
+func (s *AuthService) ListLDAPAccounts() ([]models.LDAPAccount, error) {
+	if s.ldapAccounts == nil {
+		return []models.LDAPAccount{}, nil
+	}
+	return s.ldapAccounts.List()
+}
+
+// SyncLDAP checks every linked account against the directory. Accounts
+// whose entry is gone, or that left every permitted group, are disabled
+// and signed out; accounts disabled this way are enabled again once the
+// entry is back. Roles follow the users' groups. Any directory error
+// stops the sync before it changes another account, so an outage cannot
+// disable everyone.
+func (s *AuthService) SyncLDAP(ctx context.Context) (*LDAPSyncResult, error) {
+	if s.ldap == nil {
+		return nil, ErrLDAPNotConfigured
+	}
+	accounts, err := s.ldapAccounts.List()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.ldap.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	result := &LDAPSyncResult{}
+	for _, account := range accounts {
+		entry, err := s.ldap.lookup(conn, account.Username)
+		if err != nil && !errors.Is(err, ErrLDAPUserNotFound) {
+			return result, err
+		}
+		user, uerr := s.userRepo.GetByID(account.UserID)
+		if uerr != nil {
+			return result, fmt.Errorf("failed to get user %d: %w", account.UserID, uerr)
+		}
+		result.Checked++
+
+		dn := account.DN
+		removed := entry == nil || (s.ldap.config.RequireGroup && !s.ldap.inMappedGroup(entry.Groups))
+		disabledBySync := account.DisabledBySync
+		switch {
+		case removed && user.IsActive:
+			if err := s.userRepo.SetActive(user.ID, false); err != nil {
+				return result, fmt.Errorf("failed to disable user %d: %w", user.ID, err)
+			}
+			if err := s.userRepo.DeactivateAllUserSessions(user.ID); err != nil {
+				return result, fmt.Errorf("failed to sign out user %d: %w", user.ID, err)
+			}
+			disabledBySync = true
+			result.Disabled++
+		case !removed && account.DisabledBySync:
+			// Accounts an administrator disabled stay disabled
+			if !user.IsActive {
+				if err := s.userRepo.SetActive(user.ID, true); err != nil {
+					return result, fmt.Errorf("failed to enable user %d: %w", user.ID, err)
+				}
+				result.Reenabled++
+			}
+			disabledBySync = false
+		}
+		if entry != nil {
+			dn = entry.DN
+			if !removed && entry.RoleID != 0 && entry.RoleID != user.RoleID {
+				if err := s.userRepo.SetRole(user.ID, entry.RoleID); err != nil {
+					return result, fmt.Errorf("failed to update role of user %d: %w", user.ID, err)
+				}
+				result.RolesChanged++
+			}
+		}
+		if err := s.ldapAccounts.MarkSynced(user.ID, dn, disabledBySync, time.Now()); err != nil {
+			return result, fmt.Errorf("failed to record sync of user %d: %w", user.ID, err)
+		}
+	}
+	return result, nil
+}
+
+// StartLDAPSync syncs linked accounts with the directory on the given
+// interval until StopLDAPSync is called
+func (s *AuthService) StartLDAPSync(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	s.ldapSyncMu.Lock()
+	if s.ldapSyncStop != nil || s.ldap == nil {
+		s.ldapSyncMu.Unlock()
+		return
+	}
+	s.ldapSyncStop = make(chan struct{})
+	stop := s.ldapSyncStop
+	s.ldapSyncMu.Unlock()
+
+	s.ldapSyncWG.Add(1)
+	go func() {
+		defer s.ldapSyncWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				result, err := s.SyncLDAP(context.Background())
+				if err != nil {
+					fmt.Printf("Failed to sync directory accounts: %v\n", err)
+				} else if result.Disabled > 0 || result.Reenabled > 0 {
+					fmt.Printf("Directory sync disabled %d and re-enabled %d accounts\n", result.Disabled, result.Reenabled)
+				}
+			}
+		}
+	}()
+}
+
+// StopLDAPSync stops the directory sync and waits for a sync in progress
+func (s *AuthService) StopLDAPSync() {
+	s.ldapSyncMu.Lock()
+	stop := s.ldapSyncStop
+	s.ldapSyncStop = nil
+	s.ldapSyncMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.ldapSyncWG.Wait()
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLDAPServiceDN = "cn=catalogizer,ou=services,dc=example,dc=org"
+
+// testLDAPEntry is an entry of the test directory. Entries with a
+// password can bind.
+type testLDAPEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+// testLDAPServer is a directory answering simple binds and searches with
+// equality, presence, and, or and not filters
+type testLDAPServer struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	entries map[string]testLDAPEntry
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testLDAPServer{listener: listener, entries: map[string]testLDAPEntry{
+		testLDAPServiceDN: {password: "service-secret"},
+	}}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) put(dn, password string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[dn] = testLDAPEntry{password: password, attributes: attributes}
+}
+
+func (s *testLDAPServer) remove(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, dn)
+}
+
+func ldapTestResult(tag ber.Tag, code uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return result
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		reply := func(op *ber.Packet) {
+			envelope := ber.NewSequence("")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msg.Children[0].Value, ""))
+			envelope.AppendChild(op)
+			conn.Write(envelope.Bytes())
+		}
+
+		switch op := msg.Children[1]; op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			s.mu.Lock()
+			entry, ok := s.entries[dn]
+			s.mu.Unlock()
+			code := uint16(ldap.LDAPResultSuccess)
+			if !ok || entry.password == "" || entry.password != password {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			reply(ldapTestResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Data.String())
+			s.mu.Lock()
+			for dn, entry := range s.entries {
+				if strings.HasSuffix(strings.ToLower(dn), base) && testLDAPMatch(op.Children[6], entry.attributes) {
+					result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+					result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+					attrs := ber.NewSequence("")
+					for name, values := range entry.attributes {
+						attr := ber.NewSequence("")
+						attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+						set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+						for _, value := range values {
+							set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+						}
+						attr.AppendChild(set)
+						attrs.AppendChild(attr)
+					}
+					result.AppendChild(attrs)
+					reply(result)
+				}
+			}
+			s.mu.Unlock()
+			reply(ldapTestResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func testLDAPMatch(filter *ber.Packet, attributes map[string][]string) bool {
+	entry := ldap.Entry{}
+	for name, values := range attributes {
+		entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{Name: name, Values: values})
+	}
+	switch filter.Tag {
+	case ldap.FilterAnd, ldap.FilterOr:
+		or := filter.Tag == ldap.FilterOr
+		for _, child := range filter.Children {
+			if testLDAPMatch(child, attributes) == or {
+				return or
+			}
+		}
+		return !or
+	case ldap.FilterNot:
+		return !testLDAPMatch(filter.Children[0], attributes)
+	case ldap.FilterEqualityMatch:
+		for _, value := range entry.GetEqualFoldAttributeValues(filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+	case ldap.FilterPresent:
+		return len(entry.GetEqualFoldAttributeValues(filter.Data.String())) > 0
+	}
+	return false
+}
+
+// newLDAPTestService creates an auth service backed by a directory holding
+// alice, a member of the admins group, and bob, in no group
+func newLDAPTestService(t *testing.T, config LDAPConfig) (*AuthService, *testLDAPServer, *repository.UserRepository) {
+	t.Helper()
+	server := newTestLDAPServer(t)
+	server.put("uid=alice,ou=people,dc=example,dc=org", "alice-secret", map[string][]string{
+		"objectClass": {"person"}, "uid": {"alice"}, "mail": {"alice@example.org"}, "givenName": {"Alice"},
+		"memberOf": {"cn=catalog-admins,ou=groups,dc=example,dc=org"},
+	})
+	server.put("uid=bob,ou=people,dc=example,dc=org", "bob-secret", map[string][]string{
+		"objectClass": {"person"}, "uid": {"bob"}, "mail": {"bob@example.org"},
+	})
+
+	config.URL = server.url()
+	config.BindDN = testLDAPServiceDN
+	config.BindPassword = "service-secret"
+	config.BaseDN = "ou=people,dc=example,dc=org"
+	config.GroupRoles = []LDAPGroupRole{{Group: "catalog-admins", RoleID: 2}}
+	config.Timeout = 2 * time.Second
+	provider, err := NewLDAPAuthProvider(config)
+	require.NoError(t, err)
+
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	service := NewAuthService(userRepo, "test-secret-key-12345")
+	service.SetLDAP(provider, repository.NewLDAPAccountRepository(db))
+	return service, server, userRepo
+}
+
+func ldapLogin(service *AuthService, username, password string) (*AuthResult, error) {
+	return service.Login(models.LoginRequest{Username: username, Password: password}, "127.0.0.1", "test")
+}
+
+func TestLDAPFilters(t *testing.T) {
+	for _, filter := range []string{defaultLDAPUserFilter, defaultLDAPGroupFilter} {
+		_, err := ldap.CompileFilter(strings.NewReplacer("{username}", "x", "{dn}", "cn=x").Replace(filter))
+		assert.NoError(t, err, filter)
+	}
+
+	// Escaped input stays a single equality match
+	packet, err := ldap.CompileFilter("(uid=" + ldap.EscapeFilter("*)(uid=*") + ")")
+	require.NoError(t, err)
+	assert.Equal(t, ber.Tag(ldap.FilterEqualityMatch), packet.Tag)
+	assert.Equal(t, "*)(uid=*", packet.Children[1].Data.String())
+
+	_, err = NewLDAPAuthProvider(LDAPConfig{URL: "http://ldap.example.org", BaseDN: "dc=example,dc=org"})
+	assert.Error(t, err)
+	_, err = NewLDAPAuthProvider(LDAPConfig{URL: "ldap://ldap.example.org", BaseDN: "dc=example,dc=org", UserFilter: "(uid={username}"})
+	assert.Error(t, err)
+}
+
+func TestAuthService_LDAPLogin(t *testing.T) {
+	service, server, userRepo := newLDAPTestService(t, LDAPConfig{AutoProvision: true, DefaultRoleID: 1})
+
+	// First sign-in provisions an account with the role of alice's group
+	result, err := ldapLogin(service, "alice", "alice-secret")
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.SessionToken)
+	assert.Equal(t, "alice", result.User.Username)
+	assert.Equal(t, "alice@example.org", result.User.Email)
+	assert.Equal(t, 2, result.User.RoleID)
+
+	again, err := ldapLogin(service, "alice@example.org", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, result.User.ID, again.User.ID)
+
+	_, err = ldapLogin(service, "alice", "wrong")
+	assert.EqualError(t, err, "invalid credentials")
+
+	// Users in no mapped group get the default role
+	bob, err := ldapLogin(service, "bob", "bob-secret")
+	require.NoError(t, err)
+	assert.Equal(t, 1, bob.User.RoleID)
+
+	// A local account with the directory username is linked, and its role
+	// follows the groups
+	server.put("uid=testuser,ou=people,dc=example,dc=org", "directory-secret", map[string][]string{
+		"objectClass": {"person"}, "uid": {"testuser"}, "memberOf": {"cn=catalog-admins,ou=groups,dc=example,dc=org"},
+	})
+	linked, err := ldapLogin(service, "testuser", "directory-secret")
+	require.NoError(t, err)
+	assert.Equal(t, 1, linked.User.ID)
+	user, err := userRepo.GetByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, user.RoleID)
+
+	accounts, err := service.ListLDAPAccounts()
+	require.NoError(t, err)
+	assert.Len(t, accounts, 3)
+
+	// Only members of a mapped group may sign in when a group is required
+	strict, _, _ := newLDAPTestService(t, LDAPConfig{AutoProvision: true, RequireGroup: true})
+	_, err = ldapLogin(strict, "bob", "bob-secret")
+	assert.Error(t, err)
+	_, err = ldapLogin(strict, "alice", "alice-secret")
+	assert.NoError(t, err)
+
+	// Without provisioning unknown directory users cannot sign in
+	linkOnly, _, _ := newLDAPTestService(t, LDAPConfig{})
+	_, err = ldapLogin(linkOnly, "alice", "alice-secret")
+	assert.EqualError(t, err, "invalid credentials")
+}
+
+func TestAuthService_LDAPLogin_DirectoryDown(t *testing.T) {
+	service, server, userRepo := newLDAPTestService(t, LDAPConfig{AutoProvision: true})
+	server.listener.Close()
+
+	// Local passwords keep working while the directory is unreachable
+	hash, salt, err := service.HashPasswordForUser("local-secret")
+	require.NoError(t, err)
+	require.NoError(t, userRepo.UpdatePassword(1, hash, salt))
+	_, err = ldapLogin(service, "testuser", "local-secret")
+	require.NoError(t, err)
+	_, err = ldapLogin(service, "alice", "alice-secret")
+	assert.EqualError(t, err, "invalid credentials")
+
+	_, err = service.SyncLDAP(t.Context())
+	assert.ErrorIs(t, err, ErrLDAPUnavailable)
+}
+
+func TestAuthService_SyncLDAP(t *testing.T) {
+	service, server, userRepo := newLDAPTestService(t, LDAPConfig{AutoProvision: true, DefaultRoleID: 1})
+	alice, err := ldapLogin(service, "alice", "alice-secret")
+	require.NoError(t, err)
+	bob, err := ldapLogin(service, "bob", "bob-secret")
+	require.NoError(t, err)
+
+	result, err := service.SyncLDAP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, &LDAPSyncResult{Checked: 2}, result)
+
+	// Removed from the directory: disabled and signed out
+	server.remove("uid=alice,ou=people,dc=example,dc=org")
+	result, err = service.SyncLDAP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Disabled)
+	user, err := userRepo.GetByID(alice.User.ID)
+	require.NoError(t, err)
+	assert.False(t, user.IsActive)
+	sessions, err := userRepo.GetActiveUserSessions(alice.User.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// Back in the directory, out of the admins group: enabled again with
+	// the default role
+	server.put("uid=alice,ou=people,dc=example,dc=org", "alice-secret", map[string][]string{
+		"objectClass": {"person"}, "uid": {"alice"},
+	})
+	result, err = service.SyncLDAP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Reenabled)
+	assert.Equal(t, 1, result.RolesChanged)
+	user, err = userRepo.GetByID(alice.User.ID)
+	require.NoError(t, err)
+	assert.True(t, user.IsActive)
+	assert.Equal(t, 1, user.RoleID)
+
+	// Accounts an administrator disabled are left alone
+	require.NoError(t, userRepo.SetActive(bob.User.ID, false))
+	result, err = service.SyncLDAP(t.Context())
+	require.NoError(t, err)
+	assert.Zero(t, result.Reenabled)
+	user, err = userRepo.GetByID(bob.User.ID)
+	require.NoError(t, err)
+	assert.False(t, user.IsActive)
+
+	accounts, err := service.ListLDAPAccounts()
+	require.NoError(t, err)
+	for _, account := range accounts {
+		assert.False(t, account.DisabledBySync)
+		assert.NotNil(t, account.LastSyncedAt)
+	}
+}
@@ -0,0 +1,748 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Identity provider types
+const (
+	OIDCProviderGoogle  = "google"
+	OIDCProviderGitHub  = "github"
+	OIDCProviderGeneric = "oidc"
+)
+
+// OIDCLoginTTL is how long a user has to complete a sign-in at the
+// provider
+const OIDCLoginTTL = 10 * time.Minute
+
+// oidcMaxResponseSize bounds how much of a provider response is read
+const oidcMaxResponseSize = 1 << 20
+
+var (
+	// ErrOIDCProviderNotFound is returned for providers that are not configured
+	ErrOIDCProviderNotFound = errors.New("identity provider is not configured")
+	// ErrOIDCInvalidState is returned for callbacks that match no sign-in
+	// started here, or one that has expired
+	ErrOIDCInvalidState = errors.New("sign-in request is invalid or has expired")
+	// ErrOIDCProviderFailed is returned when the provider rejects the
+	// sign-in or its answer cannot be verified
+	ErrOIDCProviderFailed = errors.New("identity provider sign-in failed")
+	// ErrOIDCAccountNotLinked is returned for identities linked to no
+	// account when the provider does not provision accounts
+	ErrOIDCAccountNotLinked = errors.New("no account is linked to this identity")
+	// ErrOIDCAccountExists is returned instead of provisioning an account
+	// whose email a local account already has
+	ErrOIDCAccountExists = errors.New("an account with this email already exists; sign in and link the provider to it")
+	// ErrOIDCIdentityLinked is returned when linking an identity that
+	// another account already uses
+	ErrOIDCIdentityLinked = errors.New("identity is already linked to another account")
+	// ErrOIDCLinkSession is returned when a link request is completed by
+	// anyone but the signed-in user who started it
+	ErrOIDCLinkSession = errors.New("link requests must be completed by the user who started them")
+	// ErrOIDCIdentityNotFound is returned when a linked identity does not
+	// exist or belongs to another user
+	ErrOIDCIdentityNotFound = repository.ErrOIDCIdentityNotFound
+)
+
+// OIDCProviderConfig configures sign-in through an external identity
+// provider.
+type OIDCProviderConfig struct {
+	// Name identifies the provider in URLs and linked identities
+	Name string
+	// Type is OIDCProviderGoogle, OIDCProviderGitHub or OIDCProviderGeneric.
+	// Defaults to Name when that is one of them.
+	Type string
+	// IssuerURL is the issuer of a generic OpenID Connect provider. For
+	// GitHub it is the address of a GitHub Enterprise Server.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to. It must pass
+	// the code and state it receives on to the callback endpoint.
+	RedirectURL string
+	// Scopes replaces the default scopes of the provider type
+	Scopes []string
+	// AutoProvision creates an account with DefaultRoleID for identities
+	// not linked to one yet
+	AutoProvision bool
+	DefaultRoleID int
+}
+
+// OIDCCallbackResult is the outcome of a provider callback: a session for
+// a sign-in, or the identity a link request linked
+type OIDCCallbackResult struct {
+	*AuthResult
+	Linked *models.OIDCIdentity `json:"linked_identity,omitempty"`
+}
+
+// oidcPendingLogin is a sign-in sent to a provider and not back yet
+type oidcPendingLogin struct {
+	provider     string
+	nonce        string
+	codeVerifier string
+	// linkUserID is the user linking the identity, 0 for a sign-in
+	linkUserID int
+	expiresAt  time.Time
+}
+
+// oidcUserInfo is what a provider reports about the signed-in user
+type oidcUserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	FirstName     string
+	LastName      string
+}
+
+// oidcProvider talks to one configured identity provider
+type oidcProvider struct {
+	config OIDCProviderConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+}
+
+// oidcDiscovery is the part of an OpenID Provider's metadata used here
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// SetOIDCIdentities enables sign-in through identity providers, storing
+// which provider accounts are linked to which users
+func (s *AuthService) SetOIDCIdentities(identities *repository.OIDCIdentityRepository) {
+	s.oidcIdentities = identities
+}
+
+// AddOIDCProvider makes an identity provider available for sign-in
+func (s *AuthService) AddOIDCProvider(config OIDCProviderConfig) error {
+	config.Name = strings.TrimSpace(config.Name)
+	if config.Type == "" {
+		config.Type = config.Name
+	}
+	if config.Name == "" || strings.ContainsAny(config.Name, "/?#") {
+		return fmt.Errorf("identity provider name %q is invalid", config.Name)
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return fmt.Errorf("identity provider %s needs a client ID and redirect URL", config.Name)
+	}
+	switch config.Type {
+	case OIDCProviderGoogle:
+		if config.IssuerURL == "" {
+			config.IssuerURL = "https://accounts.google.com"
+		}
+	case OIDCProviderGitHub:
+	case OIDCProviderGeneric:
+		if config.IssuerURL == "" {
+			return fmt.Errorf("identity provider %s needs an issuer URL", config.Name)
+		}
+	default:
+		return fmt.Errorf("identity provider %s has unknown type %q", config.Name, config.Type)
+	}
+
+	s.oidcMu.Lock()
+	defer s.oidcMu.Unlock()
+	if s.oidcProviders == nil {
+		s.oidcProviders = make(map[string]*oidcProvider)
+		s.oidcLogins = make(map[string]oidcPendingLogin)
+	}
+	s.oidcProviders[config.Name] = &oidcProvider{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+	return nil
+}
+
+// OIDCProviders lists the configured identity providers by name
+func (s *AuthService) OIDCProviders() []string {
+	s.oidcMu.Lock()
+	defer s.oidcMu.Unlock()
+	names := make([]string, 0, len(s.oidcProviders))
+	for name := range s.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *AuthService) oidcProvider(name string) (*oidcProvider, error) {
+	s.oidcMu.Lock()
+	defer s.oidcMu.Unlock()
+	provider, ok := s.oidcProviders[name]
+	if !ok || s.oidcIdentities == nil {
+		return nil, ErrOIDCProviderNotFound
+	}
+	return provider, nil
+}
+
+// BeginOIDCLogin starts a sign-in through a provider and returns the
+// provider's authorization URL and the sign-in's state. With a linkUserID
+// the identity the user signs in with is linked to that user instead.
+// The state comes back with the provider's callback; callers keep it in
+// the browser that started the sign-in and check the two match, so a
+// callback cannot be replayed in someone else's browser.
+func (s *AuthService) BeginOIDCLogin(ctx context.Context, providerName string, linkUserID int) (string, string, error) {
+	provider, err := s.oidcProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomURLToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLToken()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err := provider.authCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrOIDCProviderFailed, err)
+	}
+
+	s.oidcMu.Lock()
+	defer s.oidcMu.Unlock()
+	now := time.Now()
+	for key, pending := range s.oidcLogins {
+		if now.After(pending.expiresAt) {
+			delete(s.oidcLogins, key)
+		}
+	}
+	s.oidcLogins[state] = oidcPendingLogin{
+		provider:     providerName,
+		nonce:        nonce,
+		codeVerifier: verifier,
+		linkUserID:   linkUserID,
+		expiresAt:    now.Add(OIDCLoginTTL),
+	}
+	return authURL, state, nil
+}
+
+// CompleteOIDCLogin finishes a sign-in with the code and state the
+// provider sent back. A known identity signs in as the user it is linked
+// to; an unknown one gets a new account when the provider provisions
+// accounts. Existing local accounts are never matched by email: their
+// owners link the provider after signing in. sessionUserID is the user
+// signed in on the callback request, 0 for none; a link request is only
+// completed by the user who started it.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, providerName, state, code string, sessionUserID int, ipAddress, userAgent string) (*OIDCCallbackResult, error) {
+	provider, err := s.oidcProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	s.oidcMu.Lock()
+	pending, ok := s.oidcLogins[state]
+	delete(s.oidcLogins, state)
+	s.oidcMu.Unlock()
+	if !ok || pending.provider != providerName || time.Now().After(pending.expiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+	if pending.linkUserID != 0 && pending.linkUserID != sessionUserID {
+		return nil, ErrOIDCLinkSession
+	}
+
+	info, err := provider.signIn(ctx, code, pending)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCProviderFailed, err)
+	}
+	var email *string
+	if info.Email != "" && info.EmailVerified {
+		email = &info.Email
+	}
+
+	identity, err := s.oidcIdentities.GetBySubject(providerName, info.Subject)
+	if err != nil && !errors.Is(err, repository.ErrOIDCIdentityNotFound) {
+		return nil, err
+	}
+
+	if pending.linkUserID != 0 {
+		if identity != nil {
+			if identity.UserID != pending.linkUserID {
+				return nil, ErrOIDCIdentityLinked
+			}
+			return &OIDCCallbackResult{Linked: identity}, nil
+		}
+		identity = &models.OIDCIdentity{UserID: pending.linkUserID, Provider: providerName, Subject: info.Subject,
+			Email: email, CreatedAt: time.Now()}
+		if err := s.oidcIdentities.Create(identity); err != nil {
+			return nil, err
+		}
+		return &OIDCCallbackResult{Linked: identity}, nil
+	}
+
+	var user *models.User
+	if identity != nil {
+		user, err = s.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+	} else {
+		if !provider.config.AutoProvision {
+			return nil, ErrOIDCAccountNotLinked
+		}
+		user, err = s.provisionOIDCUser(provider.config, info, email)
+		if err != nil {
+			return nil, err
+		}
+		identity = &models.OIDCIdentity{UserID: user.ID, Provider: providerName, Subject: info.Subject,
+			Email: email, CreatedAt: time.Now()}
+		if err := s.oidcIdentities.Create(identity); err != nil {
+			return nil, err
+		}
+	}
+	if !user.CanLogin() {
+		if user.IsLocked {
+			return nil, errors.New("account is temporarily locked")
+		}
+		return nil, errors.New("account is disabled")
+	}
+
+	if err := s.oidcIdentities.TouchLastLogin(identity.ID, email, time.Now()); err != nil {
+		fmt.Printf("Failed to record identity sign-in: %v\n", err)
+	}
+	result, err := s.issueSession(user, models.DeviceInfo{}, ipAddress, userAgent, false)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCCallbackResult{AuthResult: result}, nil
+}
+
+// ListOIDCIdentities returns the identities linked to a user
+func (s *AuthService) ListOIDCIdentities(userID int) ([]models.OIDCIdentity, error) {
+	if s.oidcIdentities == nil {
+		return []models.OIDCIdentity{}, nil
+	}
+	return s.oidcIdentities.ListByUser(userID)
+}
+
+// UnlinkOIDCIdentity removes one of a user's linked identities
+func (s *AuthService) UnlinkOIDCIdentity(userID, identityID int) error {
+	if s.oidcIdentities == nil {
+		return ErrOIDCIdentityNotFound
+	}
+	return s.oidcIdentities.Delete(userID, identityID)
+}
+
+// oidcUsernameChars are the characters kept from a provider's username
+var oidcUsernameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// provisionOIDCUser creates an account for an identity that has none. The
+// username comes from the provider, numbered when it is taken; a verified
+// email that a local account already has is refused rather than merged.
+func (s *AuthService) provisionOIDCUser(config OIDCProviderConfig, info *oidcUserInfo, email *string) (*models.User, error) {
+	if email != nil {
+		if _, err := s.userRepo.GetByEmail(*email); err == nil {
+			return nil, ErrOIDCAccountExists
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+	}
+
+	base := info.Username
+	if base == "" && email != nil {
+		base = strings.SplitN(*email, "@", 2)[0]
+	}
+	base = strings.Trim(oidcUsernameChars.ReplaceAllString(base, ""), ".-")
+	if base == "" {
+		base = config.Name + "-" + info.Subject
+	}
+	username := ""
+	for i := 1; i <= 100 && username == ""; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = base + strconv.Itoa(i)
+		}
+		if _, err := s.userRepo.GetByUsername(candidate); errors.Is(err, sql.ErrNoRows) {
+			username = candidate
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+	}
+	if username == "" {
+		return nil, fmt.Errorf("failed to provision user: no free username for %s", base)
+	}
+
+	user := &models.User{Username: username, RoleID: config.DefaultRoleID}
+	if email != nil {
+		user.Email = *email
+	}
+	if info.FirstName != "" {
+		user.FirstName = &info.FirstName
+	}
+	if info.LastName != "" {
+		user.LastName = &info.LastName
+	}
+	return s.createExternalUser(user)
+}
+
+func randomURLToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate sign-in state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (p *oidcProvider) scopes(defaults ...string) string {
+	if len(p.config.Scopes) > 0 {
+		return strings.Join(p.config.Scopes, " ")
+	}
+	return strings.Join(defaults, " ")
+}
+
+// githubURLs returns the web and API addresses of GitHub or of a GitHub
+// Enterprise Server
+func (p *oidcProvider) githubURLs() (string, string) {
+	if p.config.IssuerURL == "" {
+		return "https://github.com", "https://api.github.com"
+	}
+	base := strings.TrimRight(p.config.IssuerURL, "/")
+	return base, base + "/api/v3"
+}
+
+// authCodeURL returns the authorization URL of an authorization code flow
+// protected by PKCE
+func (p *oidcProvider) authCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("state", state)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	if p.config.Type == OIDCProviderGitHub {
+		web, _ := p.githubURLs()
+		params.Set("scope", p.scopes("read:user", "user:email"))
+		return web + "/login/oauth/authorize?" + params.Encode(), nil
+	}
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params.Set("scope", p.scopes("openid", "email", "profile"))
+	params.Set("nonce", nonce)
+	return discovery.AuthorizationEndpoint + "?" + params.Encode(), nil
+}
+
+// signIn exchanges the callback's code and returns who signed in
+func (p *oidcProvider) signIn(ctx context.Context, code string, pending oidcPendingLogin) (*oidcUserInfo, error) {
+	tokenURL := ""
+	if p.config.Type == OIDCProviderGitHub {
+		web, _ := p.githubURLs()
+		tokenURL = web + "/login/oauth/access_token"
+	} else {
+		discovery, err := p.discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tokenURL = discovery.TokenEndpoint
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+	form.Set("code_verifier", pending.codeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tokens oidcTokenResponse
+	if err := p.do(req, &tokens); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("token exchange failed: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+
+	if p.config.Type == OIDCProviderGitHub {
+		if tokens.AccessToken == "" {
+			return nil, errors.New("token response has no access token")
+		}
+		return p.githubUser(ctx, tokens.AccessToken)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, pending.nonce)
+}
+
+// do sends a request and decodes its JSON response
+func (p *oidcProvider) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (p *oidcProvider) get(ctx context.Context, rawURL, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return p.do(req, out)
+}
+
+// discover fetches and caches the provider's OpenID configuration
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	issuer := strings.TrimRight(p.config.IssuerURL, "/")
+	var discovery oidcDiscovery
+	if err := p.get(ctx, issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", issuer, err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document of %s names issuer %s", issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is incomplete", issuer)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// oidcIDTokenClaims are the claims read from an ID token
+type oidcIDTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     oidcBool `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	GivenName         string   `json:"given_name"`
+	FamilyName        string   `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// oidcBool accepts booleans some providers send as strings
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseBool(strings.Trim(string(data), `"`))
+	*b = oidcBool(v && err == nil)
+	return nil
+}
+
+// verifyIDToken checks an ID token's signature against the provider's
+// published keys, its issuer, audience, expiry and nonce
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawToken, nonce string) (*oidcUserInfo, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var claims oidcIDTokenClaims
+	_, err = jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, discovery.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+	return &oidcUserInfo{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Username:      claims.PreferredUsername,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}, nil
+}
+
+// publicKey returns the signing key with the given ID, fetching the
+// provider's key set again when it is unknown so rotated keys are picked
+// up
+func (p *oidcProvider) publicKey(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.get(ctx, jwksURI, "", &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	for _, raw := range set.Keys {
+		if id, key, err := parseJSONWebKey(raw); err == nil {
+			p.keys[id] = key
+		}
+	}
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *oidcProvider) lookupKey(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// parseJSONWebKey reads an RSA or EC signing key of a JWK set
+func parseJSONWebKey(raw json.RawMessage) (string, crypto.PublicKey, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("key %s is not a signing key", jwk.Kid)
+	}
+	number := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("key %s is malformed", jwk.Kid)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := number(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := number(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return "", nil, fmt.Errorf("key %s is malformed", jwk.Kid)
+		}
+		return jwk.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return "", nil, fmt.Errorf("key %s uses unsupported curve %s", jwk.Kid, jwk.Crv)
+		}
+		x, err := number(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := number(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.Kid, &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return "", nil, fmt.Errorf("key %s has unsupported type %s", jwk.Kid, jwk.Kty)
+}
+
+// githubUser reads the signed-in GitHub user. GitHub is not an OpenID
+// provider: the user ID is the subject and the primary verified address
+// the email.
+func (p *oidcProvider) githubUser(ctx context.Context, accessToken string) (*oidcUserInfo, error) {
+	_, api := p.githubURLs()
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := p.get(ctx, api+"/user", accessToken, &user); err != nil {
+		return nil, fmt.Errorf("failed to get GitHub user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, errors.New("GitHub user has no ID")
+	}
+	info := &oidcUserInfo{Subject: strconv.FormatInt(user.ID, 10), Username: user.Login}
+	if first, last, ok := strings.Cut(strings.TrimSpace(user.Name), " "); ok {
+		info.FirstName, info.LastName = first, strings.TrimSpace(last)
+	} else {
+		info.FirstName = first
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(ctx, api+"/user/emails", accessToken, &emails); err != nil {
+		return nil, fmt.Errorf("failed to get GitHub emails: %w", err)
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			info.Email, info.EmailVerified = e.Email, true
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"catalogizer/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOIDCClientID = "catalogizer-test"
+
+// testOIDCProvider is an identity provider serving discovery, keys and a
+// token endpoint, plus the GitHub user API. Codes are handed out with
+// issue and can be exchanged once with the matching PKCE verifier.
+type testOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testOIDCGrant
+	next  int
+}
+
+type testOIDCGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &testOIDCProvider{key: key, codes: make(map[string]testOIDCGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": "test-key",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	token := func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		p.mu.Lock()
+		grant, ok := p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+		p.mu.Unlock()
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge ||
+			r.PostForm.Get("client_id") != testOIDCClientID {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+		idToken.Header["kid"] = "test-key"
+		signed, err := idToken.SignedString(key)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access-" + grant.claims["sub"].(string), "id_token": signed})
+	}
+	mux.HandleFunc("/token", token)
+	mux.HandleFunc("/login/oauth/access_token", token)
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-4242" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 4242, "login": "octo-cat", "name": "Octo Cat"})
+	})
+	mux.HandleFunc("/api/v3/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "old@github.example", "primary": false, "verified": true},
+			{"email": "octo@github.example", "primary": true, "verified": true},
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// issue approves the sign-in an authorization URL started and returns
+// the callback's state and code. The ID token carries the given claims
+// with the request's nonce unless claims sets one.
+func (p *testOIDCProvider) issue(t *testing.T, authURL string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	full := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   testOIDCClientID,
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next++
+	code := "code-" + strconv.Itoa(p.next)
+	p.codes[code] = testOIDCGrant{challenge: query.Get("code_challenge"), claims: full}
+	return query.Get("state"), code
+}
+
+func newOIDCTestService(t *testing.T, provider *testOIDCProvider, autoProvision bool) *AuthService {
+	t.Helper()
+	db := setupTestDB(t)
+	service := NewAuthService(repository.NewUserRepository(db), "test-secret-key-12345")
+	service.SetOIDCIdentities(repository.NewOIDCIdentityRepository(db))
+	require.NoError(t, service.AddOIDCProvider(OIDCProviderConfig{
+		Name:          "corp",
+		Type:          OIDCProviderGeneric,
+		IssuerURL:     provider.server.URL,
+		ClientID:      testOIDCClientID,
+		ClientSecret:  "client-secret",
+		RedirectURL:   "https://catalogizer.example/auth/callback",
+		AutoProvision: autoProvision,
+		DefaultRoleID: 1,
+	}))
+	return service
+}
+
+// signInOIDC runs a whole sign-in through the test provider
+func signInOIDC(t *testing.T, service *AuthService, provider *testOIDCProvider, linkUserID int, claims jwt.MapClaims) (*OIDCCallbackResult, error) {
+	t.Helper()
+	authURL, _, err := service.BeginOIDCLogin(context.Background(), "corp", linkUserID)
+	require.NoError(t, err)
+	state, code := provider.issue(t, authURL, claims)
+	return service.CompleteOIDCLogin(context.Background(), "corp", state, code, linkUserID, "127.0.0.1", "test")
+}
+
+func TestAuthService_OIDCLogin_ProvisionsUser(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := newOIDCTestService(t, provider, true)
+
+	claims := jwt.MapClaims{"sub": "s-1", "email": "alice@corp.example", "email_verified": "true",
+		"preferred_username": "alice smith", "given_name": "Alice"}
+	result, err := signInOIDC(t, service, provider, 0, claims)
+	require.NoError(t, err)
+	require.NotNil(t, result.AuthResult)
+	assert.NotEmpty(t, result.SessionToken)
+	assert.Equal(t, "alicesmith", result.User.Username)
+	assert.Equal(t, "alice@corp.example", result.User.Email)
+	assert.Equal(t, 1, result.User.RoleID)
+
+	// The identity is linked to the new account and signs in as it again
+	again, err := signInOIDC(t, service, provider, 0, claims)
+	require.NoError(t, err)
+	assert.Equal(t, result.User.ID, again.User.ID)
+
+	identities, err := service.ListOIDCIdentities(result.User.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "s-1", identities[0].Subject)
+	assert.NotNil(t, identities[0].LastLoginAt)
+
+	// Taken usernames are numbered
+	other, err := signInOIDC(t, service, provider, 0, jwt.MapClaims{"sub": "s-2", "preferred_username": "alicesmith"})
+	require.NoError(t, err)
+	assert.Equal(t, "alicesmith2", other.User.Username)
+}
+
+func TestAuthService_OIDCLogin_Refusals(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := newOIDCTestService(t, provider, true)
+
+	// A verified email of an existing account is not merged into it
+	_, err := signInOIDC(t, service, provider, 0, jwt.MapClaims{"sub": "s-1", "email": "test@example.com", "email_verified": true})
+	assert.ErrorIs(t, err, ErrOIDCAccountExists)
+
+	_, err = signInOIDC(t, service, provider, 0, jwt.MapClaims{"sub": "s-1", "nonce": "replayed"})
+	assert.ErrorIs(t, err, ErrOIDCProviderFailed)
+
+	_, err = signInOIDC(t, service, provider, 0, jwt.MapClaims{"sub": "s-1", "aud": "another-client"})
+	assert.ErrorIs(t, err, ErrOIDCProviderFailed)
+
+	_, err = signInOIDC(t, service, provider, 0, jwt.MapClaims{"sub": "s-1", "exp": time.Now().Add(-time.Minute).Unix()})
+	assert.ErrorIs(t, err, ErrOIDCProviderFailed)
+
+	// States are single use and bound to their provider
+	authURL, begun, err := service.BeginOIDCLogin(context.Background(), "corp", 0)
+	require.NoError(t, err)
+	state, code := provider.issue(t, authURL, jwt.MapClaims{"sub": "s-1"})
+	assert.Equal(t, begun, state)
+	_, err = service.CompleteOIDCLogin(context.Background(), "corp", state, code, 0, "", "")
+	require.NoError(t, err)
+	_, err = service.CompleteOIDCLogin(context.Background(), "corp", state, code, 0, "", "")
+	assert.ErrorIs(t, err, ErrOIDCInvalidState)
+	_, err = service.CompleteOIDCLogin(context.Background(), "corp", "unknown", code, 0, "", "")
+	assert.ErrorIs(t, err, ErrOIDCInvalidState)
+
+	_, _, err = service.BeginOIDCLogin(context.Background(), "missing", 0)
+	assert.ErrorIs(t, err, ErrOIDCProviderNotFound)
+
+	strict := newOIDCTestService(t, provider, false)
+	_, err = signInOIDC(t, strict, provider, 0, jwt.MapClaims{"sub": "s-1"})
+	assert.ErrorIs(t, err, ErrOIDCAccountNotLinked)
+}
+
+func TestAuthService_OIDCLinking(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := newOIDCTestService(t, provider, false)
+	claims := jwt.MapClaims{"sub": "s-1", "email": "test@example.com", "email_verified": true}
+
+	result, err := signInOIDC(t, service, provider, 1, claims)
+	require.NoError(t, err)
+	assert.Nil(t, result.AuthResult)
+	require.NotNil(t, result.Linked)
+	assert.Equal(t, 1, result.Linked.UserID)
+
+	// The local account now signs in through the provider
+	login, err := signInOIDC(t, service, provider, 0, claims)
+	require.NoError(t, err)
+	assert.Equal(t, 1, login.User.ID)
+
+	_, err = signInOIDC(t, service, provider, 2, claims)
+	assert.ErrorIs(t, err, ErrOIDCIdentityLinked)
+
+	// Only the user who started a link request completes it
+	other := jwt.MapClaims{"sub": "s-2"}
+	for _, sessionUserID := range []int{0, 2} {
+		authURL, _, err := service.BeginOIDCLogin(context.Background(), "corp", 1)
+		require.NoError(t, err)
+		state, code := provider.issue(t, authURL, other)
+		_, err = service.CompleteOIDCLogin(context.Background(), "corp", state, code, sessionUserID, "", "")
+		assert.ErrorIs(t, err, ErrOIDCLinkSession)
+	}
+	identities, err := service.ListOIDCIdentities(1)
+	require.NoError(t, err)
+	assert.Len(t, identities, 1)
+
+	assert.ErrorIs(t, service.UnlinkOIDCIdentity(2, result.Linked.ID), ErrOIDCIdentityNotFound)
+	require.NoError(t, service.UnlinkOIDCIdentity(1, result.Linked.ID))
+	_, err = signInOIDC(t, service, provider, 0, claims)
+	assert.ErrorIs(t, err, ErrOIDCAccountNotLinked)
+}
+
+func TestAuthService_OIDCLogin_GitHub(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	db := setupTestDB(t)
+	service := NewAuthService(repository.NewUserRepository(db), "test-secret-key-12345")
+	service.SetOIDCIdentities(repository.NewOIDCIdentityRepository(db))
+	require.NoError(t, service.AddOIDCProvider(OIDCProviderConfig{
+		Name:          "github",
+		IssuerURL:     provider.server.URL,
+		ClientID:      testOIDCClientID,
+		RedirectURL:   "https://catalogizer.example/auth/callback",
+		AutoProvision: true,
+		DefaultRoleID: 1,
+	}))
+	assert.Equal(t, []string{"github"}, service.OIDCProviders())
+
+	authURL, _, err := service.BeginOIDCLogin(context.Background(), "github", 0)
+	require.NoError(t, err)
+	assert.Contains(t, authURL, provider.server.URL+"/login/oauth/authorize?")
+	state, code := provider.issue(t, authURL, jwt.MapClaims{"sub": "4242"})
+
+	result, err := service.CompleteOIDCLogin(context.Background(), "github", state, code, 0, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "octo-cat", result.User.Username)
+	assert.Equal(t, "octo@github.example", result.User.Email)
+	require.NotNil(t, result.User.LastName)
+	assert.Equal(t, "Cat", *result.User.LastName)
+}
+
+func TestAuthService_AddOIDCProvider_Validation(t *testing.T) {
+	service := NewAuthService(nil, "test-secret-key-12345")
+	valid := OIDCProviderConfig{Name: "google", ClientID: "id", RedirectURL: "https://catalogizer.example/cb"}
+	require.NoError(t, service.AddOIDCProvider(valid))
+	assert.Equal(t, "https://accounts.google.com", service.oidcProviders["google"].config.IssuerURL)
+
+	for name, config := range map[string]OIDCProviderConfig{
+		"no name":      {ClientID: "id", RedirectURL: "https://catalogizer.example/cb", Type: OIDCProviderGoogle},
+		"bad name":     {Name: "a/b", ClientID: "id", RedirectURL: "https://catalogizer.example/cb", Type: OIDCProviderGoogle},
+		"no client":    {Name: "google", RedirectURL: "https://catalogizer.example/cb"},
+		"no issuer":    {Name: "corp", Type: OIDCProviderGeneric, ClientID: "id", RedirectURL: "https://catalogizer.example/cb"},
+		"unknown type": {Name: "corp", ClientID: "id", RedirectURL: "https://catalogizer.example/cb"},
+	} {
+		assert.Error(t, service.AddOIDCProvider(config), name)
+	}
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+)
+
+// DefaultPasswordHashParams hash passwords with argon2id using 19 MiB, two
+// passes and one lane, the minimum OWASP recommends. The benchmark
+// endpoint finds stronger settings the host can afford.
+var DefaultPasswordHashParams = models.PasswordHashParams{
+	Algorithm:   models.PasswordHashArgon2id,
+	MemoryKiB:   19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+}
+
+// ErrPasswordBenchmarkRunning is returned when a benchmark is started
+// while another is running
+var ErrPasswordBenchmarkRunning = errors.New("a password hashing benchmark is already running")
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	// defaultBcryptCost applies to bcrypt parameters without a cost
+	defaultBcryptCost = bcrypt.DefaultCost
+)
+
+// PasswordScheme hashes and verifies the passwords of one algorithm. Its
+// hashes are PHC strings, $id$params$salt$hash, or for bcrypt the modular
+// crypt format the PHC format grew out of.
+type PasswordScheme interface {
+	// Hash hashes password with params
+	Hash(password string, params models.PasswordHashParams) (string, error)
+	// Verify reports whether password matches encoded
+	Verify(password, encoded string) (bool, error)
+	// Current reports whether encoded was made with params
+	Current(encoded string, params models.PasswordHashParams) bool
+}
+
+// PasswordHasher makes password hashes with the configured algorithm and
+// verifies hashes of every registered algorithm, telling callers which
+// ones to rehash.
+type PasswordHasher struct {
+	mu      sync.RWMutex
+	params  models.PasswordHashParams
+	schemes map[string]PasswordScheme
+}
+
+// defaultPasswordHasher serves AuthService values not built with
+// NewAuthService
+var defaultPasswordHasher = NewPasswordHasher(DefaultPasswordHashParams)
+
+// NewPasswordHasher creates a hasher making hashes with params, which
+// verifies argon2id, bcrypt and legacy SHA-256 hashes.
+func NewPasswordHasher(params models.PasswordHashParams) *PasswordHasher {
+	return &PasswordHasher{
+		params: params,
+		schemes: map[string]PasswordScheme{
+			models.PasswordHashArgon2id: argon2idScheme{},
+			models.PasswordHashBcrypt:   bcryptScheme{},
+			models.PasswordHashSHA256:   sha256Scheme{},
+		},
+	}
+}
+
+// Register adds or replaces the scheme of an algorithm, named by the id
+// its PHC strings start with.
+func (h *PasswordHasher) Register(algorithm string, scheme PasswordScheme) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.schemes[algorithm] = scheme
+}
+
+// Params returns the parameters new hashes are made with.
+func (h *PasswordHasher) Params() models.PasswordHashParams {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.params
+}
+
+// SetParams changes the parameters new hashes are made with. Existing
+// hashes made otherwise become outdated.
+func (h *PasswordHasher) SetParams(params models.PasswordHashParams) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.schemes[params.Algorithm]; !ok {
+		return fmt.Errorf("invalid password hash parameters: unknown algorithm %q", params.Algorithm)
+	}
+	if err := validatePasswordHashParams(params); err != nil {
+		return err
+	}
+	h.params = params
+	return nil
+}
+
+// Hash hashes a password with the current parameters.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	h.mu.RLock()
+	params, scheme := h.params, h.schemes[h.params.Algorithm]
+	h.mu.RUnlock()
+	if scheme == nil {
+		return "", fmt.Errorf("unknown password hash algorithm %q", params.Algorithm)
+	}
+	return scheme.Hash(password, params)
+}
+
+// Verify reports whether password matches encoded and, when it does,
+// whether encoded should be replaced by a hash with the current
+// parameters.
+func (h *PasswordHasher) Verify(password, encoded string) (ok, rehash bool) {
+	algorithm := PasswordHashAlgorithm(encoded)
+	h.mu.RLock()
+	params, scheme := h.params, h.schemes[algorithm]
+	h.mu.RUnlock()
+	if scheme == nil {
+		return false, false
+	}
+	ok, err := scheme.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false
+	}
+	return true, algorithm != params.Algorithm || !scheme.Current(encoded, params)
+}
+
+// Outdated reports whether encoded was made with other parameters than
+// the current ones.
+func (h *PasswordHasher) Outdated(encoded string) bool {
+	algorithm := PasswordHashAlgorithm(encoded)
+	h.mu.RLock()
+	params, scheme := h.params, h.schemes[algorithm]
+	h.mu.RUnlock()
+	return scheme == nil || algorithm != params.Algorithm || !scheme.Current(encoded, params)
+}
+
+// PasswordHashAlgorithm names the algorithm of a stored hash: the id of a
+// PHC string, bcrypt for $2a$, $2b$ and $2y$ hashes, and sha256 for bare
+// SHA-256 hex digests.
+func PasswordHashAlgorithm(encoded string) string {
+	if !strings.HasPrefix(encoded, "$") {
+		if len(encoded) == sha256.Size*2 {
+			if _, err := hex.DecodeString(encoded); err == nil {
+				return models.PasswordHashSHA256
+			}
+		}
+		return ""
+	}
+	id := strings.SplitN(encoded[1:], "$", 2)[0]
+	switch id {
+	case "2a", "2b", "2y":
+		return models.PasswordHashBcrypt
+	}
+	return id
+}
+
+// validatePasswordHashParams checks that params are strong enough to be
+// worth using and cheap enough not to exhaust the host.
+func validatePasswordHashParams(params models.PasswordHashParams) error {
+	switch params.Algorithm {
+	case models.PasswordHashArgon2id:
+		if params.MemoryKiB < 8*1024 || params.MemoryKiB > 4*1024*1024 {
+			return fmt.Errorf("invalid password hash parameters: memory_kib must be between 8192 and 4194304")
+		}
+		if params.Iterations < 1 || params.Iterations > 20 {
+			return fmt.Errorf("invalid password hash parameters: iterations must be between 1 and 20")
+		}
+		if params.Parallelism < 1 || params.Parallelism > 64 {
+			return fmt.Errorf("invalid password hash parameters: parallelism must be between 1 and 64")
+		}
+	case models.PasswordHashBcrypt:
+		if params.BcryptCost != 0 && (params.BcryptCost < 10 || params.BcryptCost > 16) {
+			return fmt.Errorf("invalid password hash parameters: bcrypt_cost must be between 10 and 16")
+		}
+	case models.PasswordHashSHA256:
+		return fmt.Errorf("invalid password hash parameters: sha256 hashes can only be verified")
+	}
+	return nil
+}
+
+// argon2idScheme makes PHC strings of the form
+// $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<hash>.
+type argon2idScheme struct{}
+
+type argon2idHash struct {
+	memory, iterations uint32
+	parallelism        uint8
+	salt, key          []byte
+}
+
+func (argon2idScheme) Hash(password string, params models.PasswordHashParams) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.MemoryKiB, params.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.MemoryKiB, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (argon2idScheme) Verify(password, encoded string) (bool, error) {
+	h, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (argon2idScheme) Current(encoded string, params models.PasswordHashParams) bool {
+	h, err := parseArgon2id(encoded)
+	return err == nil && h.memory == params.MemoryKiB && h.iterations == params.Iterations &&
+		h.parallelism == params.Parallelism && len(h.key) == argon2KeyLength
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != models.PasswordHashArgon2id {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version")
+	}
+	var h argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.parallelism); err != nil {
+		return nil, fmt.Errorf("malformed argon2id parameters")
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt")
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+	return &h, nil
+}
+
+// bcryptScheme verifies and makes bcrypt hashes.
+type bcryptScheme struct{}
+
+func (bcryptScheme) Hash(password string, params models.PasswordHashParams) (string, error) {
+	cost := params.BcryptCost
+	if cost == 0 {
+		cost = defaultBcryptCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	return string(hash), err
+}
+
+func (bcryptScheme) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (bcryptScheme) Current(encoded string, params models.PasswordHashParams) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	want := params.BcryptCost
+	if want == 0 {
+		want = defaultBcryptCost
+	}
+	return err == nil && cost == want
+}
+
+// sha256Scheme verifies the SHA-256 hex digests user creation used to
+// store. They are never made and always outdated.
+type sha256Scheme struct{}
+
+func (sha256Scheme) Hash(string, models.PasswordHashParams) (string, error) {
+	return "", fmt.Errorf("sha256 password hashes can only be verified")
+}
+
+func (sha256Scheme) Verify(password, encoded string) (bool, error) {
+	sum := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(encoded))) == 1, nil
+}
+
+func (sha256Scheme) Current(string, models.PasswordHashParams) bool {
+	return false
+}
+
+// PasswordHashTrial is the time one set of argon2id parameters took to
+// hash a password on this host.
+type PasswordHashTrial struct {
+	Params     models.PasswordHashParams `json:"params"`
+	DurationMs float64                   `json:"duration_ms"`
+}
+
+// PasswordHashBenchmark lists argon2id trials of growing cost. The
+// recommended parameters are the costliest that hashed within the target
+// time.
+type PasswordHashBenchmark struct {
+	TargetMs    int64                      `json:"target_ms"`
+	CPUs        int                        `json:"cpus"`
+	Trials      []PasswordHashTrial        `json:"trials"`
+	Recommended *models.PasswordHashParams `json:"recommended,omitempty"`
+}
+
+// passwordBenchmarkMemory are the argon2id memory sizes tried, in KiB
+var passwordBenchmarkMemory = []uint32{19 * 1024, 46 * 1024, 64 * 1024, 128 * 1024, 256 * 1024}
+
+// passwordBenchmarkMu keeps benchmarks from running concurrently and
+// skewing each other
+var passwordBenchmarkMu sync.Mutex
+
+// BenchmarkPasswordHashing times argon2id on this host. For each memory
+// size it raises the passes until a hash takes longer than target.
+func BenchmarkPasswordHashing(ctx context.Context, target time.Duration) (*PasswordHashBenchmark, error) {
+	if !passwordBenchmarkMu.TryLock() {
+		return nil, ErrPasswordBenchmarkRunning
+	}
+	defer passwordBenchmarkMu.Unlock()
+
+	parallelism := runtime.NumCPU()
+	if parallelism > 4 {
+		parallelism = 4
+	}
+	result := &PasswordHashBenchmark{TargetMs: target.Milliseconds(), CPUs: runtime.NumCPU(), Trials: []PasswordHashTrial{}}
+	var best uint64
+	for _, memory := range passwordBenchmarkMemory {
+		for iterations := uint32(1); iterations <= 10; iterations++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			params := models.PasswordHashParams{
+				Algorithm:   models.PasswordHashArgon2id,
+				MemoryKiB:   memory,
+				Iterations:  iterations,
+				Parallelism: uint8(parallelism),
+			}
+			start := time.Now()
+			argon2.IDKey([]byte("benchmark password"), make([]byte, argon2SaltLength), iterations, memory, uint8(parallelism), argon2KeyLength)
+			elapsed := time.Since(start)
+			result.Trials = append(result.Trials, PasswordHashTrial{Params: params, DurationMs: float64(elapsed.Microseconds()) / 1000})
+			if elapsed > target {
+				break
+			}
+			if cost := uint64(memory) * uint64(iterations); cost > best {
+				best = cost
+				recommended := params
+				result.Recommended = &recommended
+			}
+		}
+	}
+	return result, nil
+}
+
+// SetPasswordHashing applies the password hash parameters saved in the
+// repository, and saves the ones administrators choose from now on.
+func (s *AuthService) SetPasswordHashing(store *repository.PasswordHashingRepository) error {
+	s.passwordStore = store
+	params, err := store.GetParams()
+	if err != nil || params == nil {
+		return err
+	}
+	return s.passwordHasher().SetParams(*params)
+}
+
+// passwordHasher returns the hasher of the service, or the default hasher
+// for services not built with NewAuthService.
+func (s *AuthService) passwordHasher() *PasswordHasher {
+	if s == nil || s.passwords == nil {
+		return defaultPasswordHasher
+	}
+	return s.passwords
+}
+
+// PasswordHashStatus returns the current parameters and counts the
+// hashes of each algorithm, and how many are outdated.
+func (s *AuthService) PasswordHashStatus() (*models.PasswordHashStatus, error) {
+	hasher := s.passwordHasher()
+	status := &models.PasswordHashStatus{Params: hasher.Params(), Algorithms: map[string]int{}}
+	if s.passwordStore == nil {
+		return status, nil
+	}
+	if saved, err := s.passwordStore.GetParams(); err != nil {
+		return nil, err
+	} else if saved != nil {
+		status.Params.UpdatedAt, status.Params.UpdatedBy = saved.UpdatedAt, saved.UpdatedBy
+	}
+	hashes, err := s.passwordStore.ListPasswordHashes()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		algorithm := PasswordHashAlgorithm(hash)
+		if algorithm == "" {
+			algorithm = "unknown"
+		}
+		status.Algorithms[algorithm]++
+		if hasher.Outdated(hash) {
+			status.Outdated++
+		}
+	}
+	return status, nil
+}
+
+// UpdatePasswordHashParams changes the parameters new password hashes are
+// made with and saves them. Existing hashes are rehashed as their users
+// sign in.
+func (s *AuthService) UpdatePasswordHashParams(params models.PasswordHashParams, userID int) (*models.PasswordHashParams, error) {
+	if s.passwords == nil || s.passwordStore == nil {
+		return nil, fmt.Errorf("password hashing is not configurable")
+	}
+	params.UpdatedAt, params.UpdatedBy = nil, nil
+	if params.Algorithm == models.PasswordHashBcrypt && params.BcryptCost == 0 {
+		params.BcryptCost = defaultBcryptCost
+	}
+	previous := s.passwords.Params()
+	if err := s.passwords.SetParams(params); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.passwordStore.SaveParams(params, userID, now); err != nil {
+		s.passwords.SetParams(previous)
+		return nil, err
+	}
+	params.UpdatedAt, params.UpdatedBy = &now, &userID
+	return &params, nil
+}
+
+// rehashPassword replaces a user's outdated password hash after they
+// signed in with password. Failures only delay the migration to the next
+// sign-in.
+func (s *AuthService) rehashPassword(user *models.User, password string) {
+	hash, err := s.passwordHasher().Hash(password)
+	if err != nil {
+		return
+	}
+	if err := s.userRepo.UpdatePassword(user.ID, hash, ""); err != nil {
+		return
+	}
+	user.PasswordHash, user.Salt = hash, ""
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher_Argon2id(t *testing.T) {
+	hasher := NewPasswordHasher(DefaultPasswordHashParams)
+
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), hash)
+	assert.Len(t, strings.Split(hash, "$"), 6)
+	assert.Equal(t, models.PasswordHashArgon2id, PasswordHashAlgorithm(hash))
+
+	ok, rehash := hasher.Verify("correct horse", hash)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	ok, _ = hasher.Verify("wrong horse", hash)
+	assert.False(t, ok)
+
+	// Raising the cost outdates existing hashes, which still verify.
+	stronger := DefaultPasswordHashParams
+	stronger.Iterations = 3
+	require.NoError(t, hasher.SetParams(stronger))
+	ok, rehash = hasher.Verify("correct horse", hash)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	assert.True(t, hasher.Outdated(hash))
+
+	for _, malformed := range []string{"$argon2id$v=19$m=1$abc$def", "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=19456,t=2,p=1$!!$aGFzaA"} {
+		ok, _ := hasher.Verify("correct horse", malformed)
+		assert.False(t, ok, malformed)
+	}
+}
+
+func TestPasswordHasher_LegacyHashes(t *testing.T) {
+	hasher := NewPasswordHasher(DefaultPasswordHashParams)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("secret"))
+	sha256Hash := hex.EncodeToString(sum[:])
+
+	for hash, algorithm := range map[string]string{string(bcryptHash): models.PasswordHashBcrypt, sha256Hash: models.PasswordHashSHA256} {
+		assert.Equal(t, algorithm, PasswordHashAlgorithm(hash))
+		ok, rehash := hasher.Verify("secret", hash)
+		assert.True(t, ok, algorithm)
+		assert.True(t, rehash, algorithm)
+		ok, _ = hasher.Verify("Secret", hash)
+		assert.False(t, ok, algorithm)
+	}
+
+	assert.Equal(t, "", PasswordHashAlgorithm("plaintext"))
+	assert.Equal(t, "scrypt", PasswordHashAlgorithm("$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA"))
+	ok, _ := hasher.Verify("secret", "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA")
+	assert.False(t, ok, "unregistered algorithms never verify")
+}
+
+func TestPasswordHasher_Params(t *testing.T) {
+	hasher := NewPasswordHasher(DefaultPasswordHashParams)
+	for _, params := range []models.PasswordHashParams{
+		{Algorithm: "md5"},
+		{Algorithm: models.PasswordHashSHA256},
+		{Algorithm: models.PasswordHashArgon2id, MemoryKiB: 1024, Iterations: 2, Parallelism: 1},
+		{Algorithm: models.PasswordHashArgon2id, MemoryKiB: 65536, Iterations: 0, Parallelism: 1},
+		{Algorithm: models.PasswordHashArgon2id, MemoryKiB: 65536, Iterations: 2},
+		{Algorithm: models.PasswordHashBcrypt, BcryptCost: 4},
+	} {
+		assert.ErrorContains(t, hasher.SetParams(params), "invalid password hash parameters", params)
+	}
+	assert.Equal(t, DefaultPasswordHashParams, hasher.Params())
+
+	require.NoError(t, hasher.SetParams(models.PasswordHashParams{Algorithm: models.PasswordHashBcrypt}))
+	hash, err := hasher.Hash("secret")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(hash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+	ok, rehash := hasher.Verify("secret", hash)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestBenchmarkPasswordHashing(t *testing.T) {
+	memory := passwordBenchmarkMemory
+	passwordBenchmarkMemory = []uint32{8 * 1024, 16 * 1024}
+	t.Cleanup(func() { passwordBenchmarkMemory = memory })
+
+	result, err := BenchmarkPasswordHashing(context.Background(), time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, result.Trials, 20)
+	require.NotNil(t, result.Recommended)
+	assert.Equal(t, uint32(16*1024), result.Recommended.MemoryKiB)
+	assert.Equal(t, uint32(10), result.Recommended.Iterations)
+
+	// Trials stop at the first that takes too long.
+	result, err = BenchmarkPasswordHashing(context.Background(), time.Nanosecond)
+	require.NoError(t, err)
+	assert.Len(t, result.Trials, 2)
+	assert.Nil(t, result.Recommended)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = BenchmarkPasswordHashing(ctx, time.Hour)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAuthService_Login_RehashesLegacyPasswords(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	authService := NewAuthService(userRepo, "test-secret-key-12345")
+
+	// testuser has the old bcrypt(password + salt) hash, testuser2 the
+	// SHA-256 digest user creation stored.
+	legacy, err := bcrypt.GenerateFromPassword([]byte("Password1!"+"abcd"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.UpdatePassword(1, string(legacy), "abcd"))
+	sum := sha256.Sum256([]byte("Password2!" + "efgh"))
+	require.NoError(t, userRepo.UpdatePassword(2, hex.EncodeToString(sum[:]), "efgh"))
+
+	for id, creds := range map[int][2]string{1: {"testuser", "Password1!"}, 2: {"testuser2", "Password2!"}} {
+		_, err := authService.Login(models.LoginRequest{Username: creds[0], Password: creds[1]}, "127.0.0.1", "TestAgent/1.0")
+		require.NoError(t, err, creds[0])
+
+		user, err := userRepo.GetByID(id)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(user.PasswordHash, "$argon2id$"), user.PasswordHash)
+		assert.Empty(t, user.Salt)
+
+		// The migrated hash keeps working.
+		_, err = authService.Login(models.LoginRequest{Username: creds[0], Password: creds[1]}, "127.0.0.1", "TestAgent/1.0")
+		require.NoError(t, err, creds[0])
+	}
+}
+
+func TestAuthService_PasswordHashParams(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	store := repository.NewPasswordHashingRepository(db)
+	authService := NewAuthService(userRepo, "test-secret-key-12345")
+	require.NoError(t, authService.SetPasswordHashing(store))
+
+	setupAuthUser(t, userRepo, "testuser", "Password1!")
+	legacy, err := bcrypt.GenerateFromPassword([]byte("Password2!"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.UpdatePassword(2, string(legacy), ""))
+
+	status, err := authService.PasswordHashStatus()
+	require.NoError(t, err)
+	assert.Equal(t, models.PasswordHashArgon2id, status.Params.Algorithm)
+	assert.Equal(t, map[string]int{models.PasswordHashArgon2id: 1, models.PasswordHashBcrypt: 1}, status.Algorithms)
+	assert.Equal(t, 1, status.Outdated)
+
+	_, err = authService.UpdatePasswordHashParams(models.PasswordHashParams{Algorithm: models.PasswordHashArgon2id, MemoryKiB: 64}, 1)
+	assert.ErrorContains(t, err, "invalid password hash parameters")
+
+	stronger := models.PasswordHashParams{Algorithm: models.PasswordHashArgon2id, MemoryKiB: 32 * 1024, Iterations: 3, Parallelism: 2}
+	saved, err := authService.UpdatePasswordHashParams(stronger, 1)
+	require.NoError(t, err)
+	require.NotNil(t, saved.UpdatedBy)
+	assert.Equal(t, 1, *saved.UpdatedBy)
+
+	status, err = authService.PasswordHashStatus()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(32*1024), status.Params.MemoryKiB)
+	assert.NotNil(t, status.Params.UpdatedAt)
+	assert.Equal(t, 2, status.Outdated)
+
+	// New hashes use the saved parameters, in this service and in the
+	// next one to load them.
+	restarted := NewAuthService(userRepo, "test-secret-key-12345")
+	require.NoError(t, restarted.SetPasswordHashing(store))
+	hash, _, err := restarted.HashPasswordForUser("Password3!")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=32768,t=3,p=2$"), hash)
+}
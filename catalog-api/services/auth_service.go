@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
@@ -9,11 +10,13 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 
+	internal_services "catalogizer/internal/services"
 	"catalogizer/models"
 	"catalogizer/repository"
 )
@@ -24,6 +27,59 @@ type AuthService struct {
 	jwtSecret  []byte
 	jwtExpiry  time.Duration
 	refreshExp time.Duration
+
+	authWebhook *AuthWebhookVerifier
+	metrics     internal_services.MetricRecorder
+	audit       internal_services.AuditRecorder
+	lockout     LockoutPolicy
+	incidents   *repository.SecurityIncidentRepository
+	apiKeys     *repository.APIKeyRepository
+
+	oidcIdentities *repository.OIDCIdentityRepository
+	oidcMu         sync.Mutex
+	oidcProviders  map[string]*oidcProvider
+	oidcLogins     map[string]oidcPendingLogin
+
+	ldap         *LDAPAuthProvider
+	ldapAccounts *repository.LDAPAccountRepository
+	ldapSyncMu   sync.Mutex
+	ldapSyncStop chan struct{}
+	ldapSyncWG   sync.WaitGroup
+
+	passwords     *PasswordHasher
+	passwordStore *repository.PasswordHashingRepository
+}
+
+// LockoutPolicy decides when repeated failed logins lock an account.
+// Attempts consecutive failures lock it, and so does every failure after
+// that once the lock has ended: for Duration at first, and twice as long
+// for each further Attempts failures, up to MaxDuration. Locks end by
+// themselves; a successful login or an administrator's unlock resets the
+// count.
+type LockoutPolicy struct {
+	Attempts    int // 0 disables lockout
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// DefaultLockoutPolicy locks an account for 15 minutes after 5 failed
+// logins, for at most a day
+var DefaultLockoutPolicy = LockoutPolicy{Attempts: 5, Duration: 15 * time.Minute, MaxDuration: 24 * time.Hour}
+
+// lockDuration returns how long an account is locked after failures
+// consecutive failed logins, or 0 when they do not lock it
+func (p LockoutPolicy) lockDuration(failures int) time.Duration {
+	if p.Attempts <= 0 || failures < p.Attempts {
+		return 0
+	}
+	d := p.Duration
+	for i := 1; i < failures/p.Attempts && (p.MaxDuration <= 0 || d < p.MaxDuration); i++ {
+		d *= 2
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
 }
 
 // NewAuthService creates a new authentication service
@@ -33,9 +89,39 @@ func NewAuthService(userRepo *repository.UserRepository, jwtSecret string) *Auth
 		jwtSecret:  []byte(jwtSecret),
 		jwtExpiry:  24 * time.Hour,     // 24 hours
 		refreshExp: 7 * 24 * time.Hour, // 7 days
+		lockout:    DefaultLockoutPolicy,
+		passwords:  NewPasswordHasher(DefaultPasswordHashParams),
 	}
 }
 
+// SetAuthWebhook delegates credential checks that fail locally to an
+// external webhook, enabling custom SSO systems. Local passwords are
+// checked first so local administrators keep access if the webhook is down.
+func (s *AuthService) SetAuthWebhook(config AuthWebhookConfig) {
+	s.authWebhook = NewAuthWebhookVerifier(config)
+}
+
+// SetLockoutPolicy replaces DefaultLockoutPolicy
+func (s *AuthService) SetLockoutPolicy(policy LockoutPolicy) {
+	s.lockout = policy
+}
+
+// SetSecurityIncidents records account lockouts as security incidents
+func (s *AuthService) SetSecurityIncidents(incidents *repository.SecurityIncidentRepository) {
+	s.incidents = incidents
+}
+
+// SetMetricRecorder counts rejected logins towards anomaly detection
+func (s *AuthService) SetMetricRecorder(metrics internal_services.MetricRecorder) {
+	s.metrics = metrics
+}
+
+// SetAuditRecorder records sign-ins, rejected sign-ins and sign-outs in
+// the audit log
+func (s *AuthService) SetAuditRecorder(audit internal_services.AuditRecorder) {
+	s.audit = audit
+}
+
 // JWTClaims represents the claims in our JWT tokens
 type JWTClaims struct {
 	UserID    int    `json:"user_id"`
@@ -45,6 +131,14 @@ type JWTClaims struct {
 	jwt.RegisteredClaims
 }
 
+// ErrSessionNotFound is returned when a session does not exist or belongs
+// to another user
+var ErrSessionNotFound = repository.ErrSessionNotFound
+
+// ErrSessionRevoked is returned for tokens whose session has been revoked
+// or has expired
+var ErrSessionRevoked = errors.New("session has been revoked")
+
 // AuthResult represents the result of authentication
 type AuthResult struct {
 	User         *models.User `json:"user"`
@@ -55,35 +149,111 @@ type AuthResult struct {
 
 // Login authenticates a user and creates a session
 func (s *AuthService) Login(req models.LoginRequest, ipAddress string, userAgent string) (*AuthResult, error) {
+	result, err := s.login(req, ipAddress, userAgent)
+	if err != nil && s.metrics != nil && isLoginRejection(err) {
+		s.metrics.Record(internal_services.AnomalyMetricFailedLogins, 1)
+	}
+	if s.audit != nil {
+		entry := internal_services.AuditEntry{IPAddress: ipAddress, UserAgent: userAgent}
+		switch {
+		case err == nil:
+			entry.UserID, entry.Action = result.User.ID, internal_services.AuditEventLoginSuccess
+		case isLoginRejection(err):
+			entry.Action = internal_services.AuditEventLoginFailed
+			entry.Details = map[string]interface{}{"username": req.Username, "reason": err.Error()}
+			if user, lookupErr := s.userRepo.GetByUsernameOrEmail(req.Username); lookupErr == nil {
+				entry.UserID = user.ID
+			}
+		}
+		if entry.Action != "" {
+			s.audit.Record(context.Background(), entry)
+		}
+	}
+	return result, err
+}
+
+// isLoginRejection reports whether a login failed because of the
+// credentials or the account rather than an internal error
+func isLoginRejection(err error) bool {
+	switch err.Error() {
+	case "invalid credentials", "account is disabled", "account is temporarily locked":
+		return true
+	}
+	return false
+}
+
+func (s *AuthService) login(req models.LoginRequest, ipAddress string, userAgent string) (*AuthResult, error) {
+	// The directory settles logins of the users it knows; the rest go on
+	// to the local password
+	if s.ldap != nil {
+		if user, err := s.loginViaLDAP(req); err == nil {
+			if !user.CanLogin() {
+				if user.IsLocked {
+					return nil, errors.New("account is temporarily locked")
+				}
+				return nil, errors.New("account is disabled")
+			}
+			s.userRepo.ResetFailedLoginAttempts(user.ID)
+			return s.issueSession(user, req.DeviceInfo, ipAddress, userAgent, req.RememberMe)
+		}
+	}
+
 	// Find user by username or email
 	user, err := s.userRepo.GetByUsernameOrEmail(req.Username)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if s.authWebhook == nil {
 			return nil, errors.New("invalid credentials")
 		}
-		return nil, fmt.Errorf("failed to get user: %w", err)
-	}
-
-	// Check if user can login
-	if !user.CanLogin() {
-		if user.IsLocked {
-			return nil, errors.New("account is temporarily locked")
+		// Unknown locally: the webhook may know the user
+		user, err = s.loginViaWebhook(req, ipAddress, userAgent, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !user.CanLogin() {
+			return nil, errors.New("account is disabled")
+		}
+	} else {
+		// Check if user can login
+		if !user.CanLogin() {
+			if user.IsLocked {
+				return nil, errors.New("account is temporarily locked")
+			}
+			return nil, errors.New("account is disabled")
 		}
-		return nil, errors.New("account is disabled")
-	}
 
-	// Verify password
-	if !s.verifyPassword(req.Password, user.Salt, user.PasswordHash) {
-		// Increment failed login attempts
-		s.userRepo.IncrementFailedLoginAttempts(user.ID)
-		return nil, errors.New("invalid credentials")
+		// Verify password, falling back to the auth webhook when configured
+		ok, rehash := s.checkPassword(req.Password, user.Salt, user.PasswordHash)
+		if ok && rehash {
+			s.rehashPassword(user, req.Password)
+		}
+		if !ok {
+			if s.authWebhook == nil {
+				s.recordFailedLogin(user, ipAddress)
+				return nil, errors.New("invalid credentials")
+			}
+			if _, err := s.loginViaWebhook(req, ipAddress, userAgent, user); err != nil {
+				if !errors.Is(err, ErrAuthWebhookUnavailable) {
+					s.recordFailedLogin(user, ipAddress)
+				}
+				return nil, err
+			}
+		}
 	}
 
 	// Reset failed login attempts on successful login
 	s.userRepo.ResetFailedLoginAttempts(user.ID)
 
+	return s.issueSession(user, req.DeviceInfo, ipAddress, userAgent, req.RememberMe)
+}
+
+// issueSession signs in an authenticated user, creating a session with
+// its tokens
+func (s *AuthService) issueSession(user *models.User, deviceInfo models.DeviceInfo, ipAddress, userAgent string, rememberMe bool) (*AuthResult, error) {
 	// Create session
-	session, err := s.createSession(user, req.DeviceInfo, ipAddress, userAgent, req.RememberMe)
+	session, err := s.createSession(user, deviceInfo, ipAddress, userAgent, rememberMe)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
@@ -124,6 +294,99 @@ func (s *AuthService) Login(req models.LoginRequest, ipAddress string, userAgent
 	}, nil
 }
 
+// loginViaWebhook checks credentials against the auth webhook. For a known
+// local user the webhook must accept the same account; for an unknown one
+// the account is provisioned when AutoProvision is enabled.
+func (s *AuthService) loginViaWebhook(req models.LoginRequest, ipAddress, userAgent string, user *models.User) (*models.User, error) {
+	resp, err := s.authWebhook.Verify(context.Background(), AuthWebhookRequest{
+		Username:  req.Username,
+		Password:  req.Password,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Allowed {
+		return nil, errors.New("invalid credentials")
+	}
+
+	username := resp.Username
+	if username == "" {
+		username = req.Username
+	}
+	if user != nil {
+		if !strings.EqualFold(username, user.Username) && !strings.EqualFold(username, user.Email) {
+			return nil, errors.New("invalid credentials")
+		}
+		return user, nil
+	}
+
+	// The webhook may canonicalise the name to an existing account
+	if existing, err := s.userRepo.GetByUsernameOrEmail(username); err == nil {
+		return existing, nil
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !s.authWebhook.config.AutoProvision {
+		return nil, errors.New("invalid credentials")
+	}
+	return s.provisionWebhookUser(username, resp)
+}
+
+// provisionWebhookUser creates a local account for a user accepted by the
+// auth webhook.
+func (s *AuthService) provisionWebhookUser(username string, resp *AuthWebhookResponse) (*models.User, error) {
+	roleID := resp.RoleID
+	if roleID == 0 {
+		roleID = s.authWebhook.config.DefaultRoleID
+	}
+
+	user := &models.User{
+		Username: username,
+		Email:    resp.Email,
+		RoleID:   roleID,
+	}
+	if resp.FirstName != "" {
+		user.FirstName = &resp.FirstName
+	}
+	if resp.LastName != "" {
+		user.LastName = &resp.LastName
+	}
+	return s.createExternalUser(user)
+}
+
+// createExternalUser creates an active local account for a user who signs
+// in elsewhere. The account gets a random local password, so it can only
+// sign in the way it was provisioned until an administrator resets it.
+// Missing emails and roles get placeholders and the default user role.
+func (s *AuthService) createExternalUser(user *models.User) (*models.User, error) {
+	// 16 bytes keep the password and salt within bcrypt's 72 byte limit
+	randomPassword, err := s.GenerateSecureToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+	user.PasswordHash, user.Salt, err = s.HashPasswordForUser(randomPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+	if user.RoleID == 0 {
+		user.RoleID = 2 // Default user role
+	}
+	if user.Email == "" {
+		user.Email = user.Username + "@external.local"
+	}
+	user.Settings = "{}"
+	user.IsActive = true
+
+	id, err := s.userRepo.Create(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+	user.ID = id
+	return user, nil
+}
+
 // RefreshToken refreshes an authentication token
 func (s *AuthService) RefreshToken(refreshToken string) (*AuthResult, error) {
 	// Find session by refresh token
@@ -195,12 +458,43 @@ func (s *AuthService) Logout(sessionToken string) error {
 	}
 
 	sessionID, _ := strconv.Atoi(claims.SessionID)
-	return s.userRepo.DeactivateSession(sessionID)
+	if err := s.userRepo.DeactivateSession(sessionID); err != nil {
+		return err
+	}
+	s.ForgetExternalLogins(claims.Username)
+	s.recordLogout(claims.UserID, map[string]interface{}{"session_id": sessionID})
+	return nil
 }
 
 // LogoutAll terminates all sessions for a user
 func (s *AuthService) LogoutAll(userID int) error {
-	return s.userRepo.DeactivateAllUserSessions(userID)
+	if err := s.userRepo.DeactivateAllUserSessions(userID); err != nil {
+		return err
+	}
+	if user, err := s.userRepo.GetByID(userID); err == nil {
+		s.ForgetExternalLogins(user.Username)
+	}
+	s.recordLogout(userID, map[string]interface{}{"all_sessions": true})
+	return nil
+}
+
+// ForgetExternalLogins drops the logins of username the auth webhook
+// accepted, so the account's next login is checked by the webhook again.
+func (s *AuthService) ForgetExternalLogins(username string) {
+	if s.authWebhook != nil {
+		s.authWebhook.Forget(username)
+	}
+}
+
+// recordLogout records a sign-out in the audit log, when there is one
+func (s *AuthService) recordLogout(userID int, details map[string]interface{}) {
+	if s.audit != nil {
+		s.audit.Record(context.Background(), internal_services.AuditEntry{
+			UserID:  userID,
+			Action:  internal_services.AuditEventLogout,
+			Details: details,
+		})
+	}
 }
 
 // ValidateToken validates a JWT token and returns the claims
@@ -208,8 +502,12 @@ func (s *AuthService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	return s.validateToken(tokenString)
 }
 
-// GetCurrentUser gets the current user from a JWT token
+// GetCurrentUser gets the current user from a JWT token or an API key
 func (s *AuthService) GetCurrentUser(tokenString string) (*models.User, error) {
+	if IsAPIKey(tokenString) {
+		return s.AuthenticateAPIKey(tokenString)
+	}
+
 	claims, err := s.validateToken(tokenString)
 	if err != nil {
 		return nil, err
@@ -257,19 +555,14 @@ func (s *AuthService) ChangePassword(userID int, currentPassword, newPassword st
 		return errors.New("current password is incorrect")
 	}
 
-	// Generate new salt and hash
-	salt, err := s.generateSalt()
-	if err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
-	}
-
-	passwordHash, err := s.hashPassword(newPassword, salt)
+	// Hash with the current parameters; the salt is part of the hash
+	passwordHash, err := s.hashPassword(newPassword, "")
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	// Update password
-	err = s.userRepo.UpdatePassword(userID, passwordHash, salt)
+	err = s.userRepo.UpdatePassword(userID, passwordHash, "")
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
@@ -281,19 +574,14 @@ func (s *AuthService) ChangePassword(userID int, currentPassword, newPassword st
 
 // ResetPassword resets a user's password (admin function)
 func (s *AuthService) ResetPassword(userID int, newPassword string) error {
-	// Generate new salt and hash
-	salt, err := s.generateSalt()
-	if err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
-	}
-
-	passwordHash, err := s.hashPassword(newPassword, salt)
+	// Hash with the current parameters; the salt is part of the hash
+	passwordHash, err := s.hashPassword(newPassword, "")
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	// Update password
-	err = s.userRepo.UpdatePassword(userID, passwordHash, salt)
+	err = s.userRepo.UpdatePassword(userID, passwordHash, "")
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
@@ -317,6 +605,20 @@ func (s *AuthService) CheckPermission(userID int, permission string) (bool, erro
 	return role.Permissions.HasPermission(permission), nil
 }
 
+// UserHasPermission checks if a signed-in user has a specific permission.
+// A user signed in with an API key carries a role narrowed to the key's
+// scopes, which must grant the permission too.
+func (s *AuthService) UserHasPermission(user *models.User, permission string) (bool, error) {
+	allowed, err := s.CheckPermission(user.ID, permission)
+	if err != nil || !allowed {
+		return allowed, err
+	}
+	if user.Role != nil && !user.Role.Permissions.HasPermission(permission) {
+		return false, nil
+	}
+	return true, nil
+}
+
 // Private helper methods
 
 func (s *AuthService) createSession(user *models.User, deviceInfo models.DeviceInfo, ipAddress, userAgent string, rememberMe bool) (*models.UserSession, error) {
@@ -331,6 +633,12 @@ func (s *AuthService) createSession(user *models.User, deviceInfo models.DeviceI
 		expiry = time.Now().Add(s.refreshExp)
 	}
 
+	// Clients that do not describe themselves are identified by user agent,
+	// so their sessions can still be told apart
+	if deviceInfo == (models.DeviceInfo{}) {
+		deviceInfo = deviceInfoFromUserAgent(userAgent)
+	}
+
 	session := &models.UserSession{
 		UserID:         user.ID,
 		SessionToken:   sessionToken,
@@ -352,6 +660,49 @@ func (s *AuthService) createSession(user *models.User, deviceInfo models.DeviceI
 	return session, nil
 }
 
+// deviceInfoFromUserAgent guesses the platform and device type of a
+// client from its user agent
+func deviceInfoFromUserAgent(userAgent string) models.DeviceInfo {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return models.DeviceInfo{}
+	}
+
+	var platform, deviceType string
+	switch {
+	case strings.Contains(ua, "android"):
+		platform, deviceType = "android", "mobile"
+		if !strings.Contains(ua, "mobile") {
+			deviceType = "tablet"
+		}
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		platform, deviceType = "ios", "mobile"
+	case strings.Contains(ua, "ipad"):
+		platform, deviceType = "ios", "tablet"
+	case strings.Contains(ua, "windows"):
+		platform, deviceType = "windows", "desktop"
+	case strings.Contains(ua, "mac os"), strings.Contains(ua, "macintosh"):
+		platform, deviceType = "macos", "desktop"
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		platform, deviceType = "linux", "desktop"
+	}
+	for _, tv := range []string{"smart-tv", "smarttv", "googletv", "android tv", "appletv", "tizen", "webos", "roku"} {
+		if strings.Contains(ua, tv) {
+			deviceType = "tv"
+			break
+		}
+	}
+
+	var info models.DeviceInfo
+	if platform != "" {
+		info.Platform = &platform
+	}
+	if deviceType != "" {
+		info.DeviceType = &deviceType
+	}
+	return info
+}
+
 func (s *AuthService) generateJWT(user *models.User, sessionID int) (string, error) {
 	now := time.Now()
 	claims := JWTClaims{
@@ -407,34 +758,24 @@ func (s *AuthService) generateRefreshToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func (s *AuthService) generateSalt() (string, error) {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(bytes), nil
-}
-
+// hashPassword hashes a password with the current parameters. New hashes
+// carry their own salt and pass an empty salt; older ones were made over
+// the password followed by the user's salt column.
 func (s *AuthService) hashPassword(password, salt string) (string, error) {
-	// Combine password and salt
-	combined := password + salt
-
-	// Use bcrypt for additional security
-	hash, err := bcrypt.GenerateFromPassword([]byte(combined), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-
-	return string(hash), nil
+	return s.passwordHasher().Hash(password + salt)
 }
 
 func (s *AuthService) verifyPassword(password, salt, hash string) bool {
-	// Combine password and salt
-	combined := password + salt
+	ok, _ := s.checkPassword(password, salt, hash)
+	return ok
+}
 
-	// Compare with bcrypt
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(combined))
-	return err == nil
+// checkPassword verifies a password against a stored hash and reports
+// whether the hash should be replaced: it uses other parameters than the
+// current ones or a separate salt.
+func (s *AuthService) checkPassword(password, salt, hash string) (ok, rehash bool) {
+	ok, rehash = s.passwordHasher().Verify(password+salt, hash)
+	return ok, ok && (rehash || salt != "")
 }
 
 // Session management methods
@@ -449,6 +790,40 @@ func (s *AuthService) DeactivateSession(sessionID int) error {
 	return s.userRepo.DeactivateSession(sessionID)
 }
 
+// ValidateSession checks that the session a token was issued for is still
+// active, so revoked sessions are rejected before their token expires
+func (s *AuthService) ValidateSession(sessionID string) error {
+	session, err := s.userRepo.GetSession(sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if !session.IsActive || session.ExpiresAt.Before(time.Now()) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// RevokeSession ends one of a user's sessions
+func (s *AuthService) RevokeSession(userID, sessionID int) error {
+	session, err := s.userRepo.GetSession(strconv.Itoa(sessionID))
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || !session.IsActive {
+		return ErrSessionNotFound
+	}
+	return s.userRepo.DeactivateSession(sessionID)
+}
+
+// RevokeOtherSessions ends all of a user's sessions except the current
+// one, returning how many were ended
+func (s *AuthService) RevokeOtherSessions(userID, currentSessionID int) (int64, error) {
+	return s.userRepo.DeactivateOtherUserSessions(userID, currentSessionID)
+}
+
 // CleanupExpiredSessions removes expired sessions from the database
 func (s *AuthService) CleanupExpiredSessions() error {
 	return s.userRepo.CleanupExpiredSessions()
@@ -476,21 +851,15 @@ func (s *AuthService) HashData(data string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// HashPasswordForUser hashes a password with a generated salt (public method for registration)
+// HashPasswordForUser hashes a password for a new user (public method for
+// registration). The salt is embedded in the hash, so the returned salt,
+// kept for the users.salt column, is empty.
 func (s *AuthService) HashPasswordForUser(password string) (passwordHash string, saltStr string, err error) {
-	// Generate salt
-	saltStr, err = s.generateSalt()
-	if err != nil {
-		return "", "", err
-	}
-
-	// Hash password with salt
-	hash, err := s.hashPassword(password, saltStr)
+	hash, err := s.hashPassword(password, "")
 	if err != nil {
 		return "", "", err
 	}
-
-	return hash, saltStr, nil
+	return hash, "", nil
 }
 
 // ValidatePassword checks if a password meets security requirements
@@ -531,25 +900,68 @@ func (s *AuthService) LockAccount(userID int, lockUntil time.Time) error {
 	return s.userRepo.LockAccount(userID, lockUntil)
 }
 
-// UnlockAccount unlocks a user account
+// UnlockAccount unlocks a user account and clears its failed logins, so
+// the next lock starts again from the shortest duration
 func (s *AuthService) UnlockAccount(userID int) error {
-	return s.userRepo.UnlockAccount(userID)
+	if err := s.userRepo.UnlockAccount(userID); err != nil {
+		return err
+	}
+	return s.userRepo.ResetFailedLoginAttempts(userID)
 }
 
-// CheckAccountLockout checks if an account should be locked due to failed attempts
+// CheckAccountLockout locks an account whose failed logins call for it
+// under the lockout policy
 func (s *AuthService) CheckAccountLockout(userID int) error {
 	user, err := s.userRepo.GetByID(userID)
 	if err != nil {
 		return err
 	}
 
-	// Lock account if too many failed attempts
-	maxAttempts := 5 // This should be configurable
-	if user.FailedLoginAttempts >= maxAttempts {
-		lockDuration := 30 * time.Minute // This should be configurable
-		lockUntil := time.Now().Add(lockDuration)
-		return s.LockAccount(userID, lockUntil)
+	if d := s.lockout.lockDuration(user.FailedLoginAttempts); d > 0 && !user.IsAccountLocked() {
+		return s.LockAccount(userID, time.Now().Add(d))
 	}
-
 	return nil
 }
+
+// recordFailedLogin counts a failed login of user, locking the account
+// when the lockout policy says so
+func (s *AuthService) recordFailedLogin(user *models.User, ipAddress string) {
+	// The count is read back from the database: concurrent failed logins
+	// of the account each see their own increment
+	failures, err := s.userRepo.IncrementFailedLoginAttempts(user.ID)
+	if err != nil {
+		fmt.Printf("Failed to record failed login for user %d: %v\n", user.ID, err)
+		return
+	}
+	d := s.lockout.lockDuration(failures)
+	if d == 0 {
+		return
+	}
+
+	lockedUntil := time.Now().Add(d)
+	if err := s.userRepo.LockAccount(user.ID, lockedUntil); err != nil {
+		fmt.Printf("Failed to lock account of user %d: %v\n", user.ID, err)
+		return
+	}
+	if s.incidents == nil {
+		return
+	}
+
+	severity := "medium"
+	if failures >= 3*s.lockout.Attempts {
+		severity = "high"
+	}
+	userID := user.ID
+	incident := &models.SecurityIncident{
+		Type: "account_locked",
+		Description: fmt.Sprintf("Account %s locked for %s after %d failed logins",
+			user.Username, d, failures),
+		Severity:  severity,
+		UserID:    &userID,
+		IPAddress: &ipAddress,
+		Timestamp: time.Now(),
+	}
+	if err := s.incidents.Create(incident); err != nil {
+		fmt.Printf("Failed to record lockout of user %d: %v\n", user.ID, err)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	_ "github.com/mutecomm/go-sqlcipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSessionTestService creates an AuthService over an in-memory SQLite
+// database holding only the user_sessions table
+func newSessionTestService(t *testing.T) (*AuthService, *repository.UserRepository) {
+	t.Helper()
+	rawDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { rawDB.Close() })
+
+	_, err = rawDB.Exec(`
+	CREATE TABLE user_sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		session_token TEXT NOT NULL UNIQUE,
+		refresh_token TEXT,
+		device_info TEXT,
+		ip_address TEXT,
+		user_agent TEXT,
+		is_active INTEGER DEFAULT 1,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_activity_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	require.NoError(t, err)
+
+	repo := repository.NewUserRepository(database.WrapDB(rawDB, database.DialectSQLite))
+	return NewAuthService(repo, "test-secret"), repo
+}
+
+func TestAuthService_RevokeSessions(t *testing.T) {
+	service, repo := newSessionTestService(t)
+
+	newSession := func(userID int, userAgent string) int {
+		session, err := service.createSession(&models.User{ID: userID}, models.DeviceInfo{}, "10.0.0.1", userAgent, false)
+		require.NoError(t, err)
+		return session.ID
+	}
+	laptop := newSession(1, "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	phone := newSession(1, "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile")
+	tablet := newSession(1, "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)")
+	other := newSession(2, "curl/8.0")
+
+	sessions, err := service.GetActiveSessions(1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+	platforms := map[int]string{}
+	for _, session := range sessions {
+		require.NotNil(t, session.DeviceInfo.Platform)
+		platforms[session.ID] = *session.DeviceInfo.Platform
+	}
+	assert.Equal(t, map[int]string{laptop: "windows", phone: "android", tablet: "ios"}, platforms)
+
+	// Sessions of other users cannot be revoked
+	assert.ErrorIs(t, service.RevokeSession(1, other), ErrSessionNotFound)
+	assert.ErrorIs(t, service.RevokeSession(1, 999), ErrSessionNotFound)
+	assert.NoError(t, service.ValidateSession(strconv.Itoa(other)))
+
+	require.NoError(t, service.RevokeSession(1, phone))
+	assert.ErrorIs(t, service.ValidateSession(strconv.Itoa(phone)), ErrSessionRevoked)
+	assert.ErrorIs(t, service.RevokeSession(1, phone), ErrSessionNotFound)
+
+	revoked, err := service.RevokeOtherSessions(1, laptop)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	assert.ErrorIs(t, service.ValidateSession(strconv.Itoa(tablet)), ErrSessionRevoked)
+	assert.NoError(t, service.ValidateSession(strconv.Itoa(laptop)))
+	assert.ErrorIs(t, service.ValidateSession("999"), ErrSessionRevoked)
+
+	// Expired sessions are rejected too
+	require.NoError(t, repo.UpdateSessionTokensAndExpiry(laptop, "token", "refresh", time.Now().Add(-time.Minute)))
+	assert.ErrorIs(t, service.ValidateSession(strconv.Itoa(laptop)), ErrSessionRevoked)
+}
+
+func TestDeviceInfoFromUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent  string
+		platform   string
+		deviceType string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "ios", "mobile"},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700)", "android", "tablet"},
+		{"Mozilla/5.0 (Linux; Android 12; AFTKA) Android TV", "android", "tv"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)", "macos", "desktop"},
+		{"Mozilla/5.0 (X11; Linux x86_64)", "linux", "desktop"},
+	}
+	for _, tt := range tests {
+		info := deviceInfoFromUserAgent(tt.userAgent)
+		require.NotNil(t, info.Platform, tt.userAgent)
+		assert.Equal(t, tt.platform, *info.Platform, tt.userAgent)
+		assert.Equal(t, tt.deviceType, *info.DeviceType, tt.userAgent)
+	}
+
+	assert.Equal(t, models.DeviceInfo{}, deviceInfoFromUserAgent(""))
+	assert.Nil(t, deviceInfoFromUserAgent("curl/8.0").Platform)
+}
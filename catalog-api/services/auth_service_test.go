@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	internal_services "catalogizer/internal/services"
 	"catalogizer/models"
+	"catalogizer/repository"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -178,17 +181,16 @@ func TestAuthService_HashPasswordForUser(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			hash, salt, err := svc.HashPasswordForUser(tt.password)
 			require.NoError(t, err)
-			assert.NotEmpty(t, hash)
-			assert.NotEmpty(t, salt)
+			assert.True(t, strings.HasPrefix(hash, "$argon2id$"), hash)
+			assert.Empty(t, salt, "the salt is embedded in the hash")
 
-			// Verify the generated hash and salt work
+			// Verify the generated hash works
 			valid := svc.verifyPassword(tt.password, salt, hash)
 			assert.True(t, valid)
 
-			// Each call should generate a different salt
-			hash2, salt2, err := svc.HashPasswordForUser(tt.password)
+			// Each call should embed a different salt
+			hash2, _, err := svc.HashPasswordForUser(tt.password)
 			require.NoError(t, err)
-			assert.NotEqual(t, salt, salt2, "salts should be different")
 			assert.NotEqual(t, hash, hash2, "hashes should be different due to different salts")
 		})
 	}
@@ -523,18 +525,6 @@ func TestAuthService_GenerateRefreshToken(t *testing.T) {
 	assert.NotEqual(t, token, token2)
 }
 
-func TestAuthService_GenerateSalt(t *testing.T) {
-	svc := &AuthService{}
-
-	salt, err := svc.generateSalt()
-	require.NoError(t, err)
-	assert.Len(t, salt, 32) // 16 bytes = 32 hex char
-
-	salt2, err := svc.generateSalt()
-	require.NoError(t, err)
-	assert.NotEqual(t, salt, salt2)
-}
-
 func TestNewAuthService(t *testing.T) {
 	svc := NewAuthService(nil, "test-secret")
 	assert.NotNil(t, svc)
@@ -544,3 +534,39 @@ func TestNewAuthService_WithEmptySecret(t *testing.T) {
 	svc := NewAuthService(nil, "")
 	assert.NotNil(t, svc)
 }
+
+type recordedAudit []internal_services.AuditEntry
+
+func (r *recordedAudit) Record(ctx context.Context, entry internal_services.AuditEntry) {
+	*r = append(*r, entry)
+}
+
+func TestAuthService_AuditRecorder(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	authService := NewAuthService(userRepo, "test-secret-key-12345")
+	audit := &recordedAudit{}
+	authService.SetAuditRecorder(audit)
+	setupAuthUser(t, userRepo, "testuser", "Password1!")
+
+	result, err := authService.Login(models.LoginRequest{Username: "testuser", Password: "Password1!"}, "10.0.0.5", "TestAgent/1.0")
+	require.NoError(t, err)
+	_, err = authService.Login(models.LoginRequest{Username: "testuser", Password: "wrong"}, "10.0.0.6", "TestAgent/1.0")
+	require.Error(t, err)
+	_, err = authService.Login(models.LoginRequest{Username: "nobody", Password: "wrong"}, "10.0.0.7", "TestAgent/1.0")
+	require.Error(t, err)
+	require.NoError(t, authService.Logout(result.SessionToken))
+	require.NoError(t, authService.LogoutAll(1))
+
+	require.Len(t, *audit, 5)
+	entries := *audit
+	assert.Equal(t, internal_services.AuditEntry{UserID: 1, Action: internal_services.AuditEventLoginSuccess, IPAddress: "10.0.0.5", UserAgent: "TestAgent/1.0"}, entries[0])
+	assert.Equal(t, internal_services.AuditEventLoginFailed, entries[1].Action)
+	assert.Equal(t, 1, entries[1].UserID)
+	assert.Equal(t, "invalid credentials", entries[1].Details["reason"])
+	assert.Equal(t, 0, entries[2].UserID, "unknown usernames have no user")
+	assert.Equal(t, "nobody", entries[2].Details["username"])
+	assert.Equal(t, internal_services.AuditEventLogout, entries[3].Action)
+	assert.Equal(t, 1, entries[3].UserID)
+	assert.Equal(t, true, entries[4].Details["all_sessions"])
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers carried by auth webhook requests and responses. The request
+// signature covers "<timestamp>.<nonce>.<body>"; the response signature
+// covers "<nonce>.<body>" so a response cannot be replayed for another
+// login attempt.
+const (
+	AuthWebhookSignatureHeader = "X-Catalogizer-Signature"
+	AuthWebhookTimestampHeader = "X-Catalogizer-Timestamp"
+	AuthWebhookNonceHeader     = "X-Catalogizer-Nonce"
+)
+
+// authWebhookMaxResponseSize bounds how much of a webhook response is read.
+const authWebhookMaxResponseSize = 64 * 1024
+
+// ErrAuthWebhookUnavailable is returned when the webhook cannot give a
+// trustworthy answer: it timed out, failed, or sent an unsigned response.
+var ErrAuthWebhookUnavailable = errors.New("external authentication is unavailable")
+
+// AuthWebhookConfig configures delegation of credential checks to a
+// customer-provided HTTP endpoint.
+type AuthWebhookConfig struct {
+	URL    string
+	Secret string
+	// Timeout bounds the whole webhook round trip. Defaults to 3 seconds.
+	Timeout time.Duration
+	// CacheTTL is how long an accepted login is remembered, so repeated
+	// logins do not hit the webhook. Zero disables caching.
+	CacheTTL time.Duration
+	// AutoProvision creates a local account for users the webhook accepts
+	// but that do not exist yet, with DefaultRoleID unless the webhook
+	// names a role.
+	AutoProvision bool
+	DefaultRoleID int
+}
+
+// AuthWebhookRequest is the JSON body posted to the webhook.
+type AuthWebhookRequest struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// AuthWebhookResponse is the JSON body the webhook answers with. Username,
+// when set, is the canonical account name; the profile fields are used
+// when provisioning a new account.
+type AuthWebhookResponse struct {
+	Allowed   bool   `json:"allowed"`
+	Reason    string `json:"reason,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Email     string `json:"email,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	RoleID    int    `json:"role_id,omitempty"`
+}
+
+type authWebhookCacheEntry struct {
+	response  AuthWebhookResponse
+	expiresAt time.Time
+}
+
+// AuthWebhookVerifier asks the configured webhook whether a set of
+// credentials is valid.
+type AuthWebhookVerifier struct {
+	config AuthWebhookConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]authWebhookCacheEntry
+}
+
+// NewAuthWebhookVerifier creates a verifier for the given webhook.
+func NewAuthWebhookVerifier(config AuthWebhookConfig) *AuthWebhookVerifier {
+	if config.Timeout <= 0 {
+		config.Timeout = 3 * time.Second
+	}
+	return &AuthWebhookVerifier{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// Redirects would send the credentials somewhere unconfigured
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now:   time.Now,
+		cache: make(map[string]authWebhookCacheEntry),
+	}
+}
+
+// Verify posts the credentials to the webhook and returns its verdict.
+// Accepted logins are cached for CacheTTL; denials are never cached so a
+// corrected password works immediately.
+func (v *AuthWebhookVerifier) Verify(ctx context.Context, req AuthWebhookRequest) (*AuthWebhookResponse, error) {
+	key := v.cacheKey(req.Username, req.Password)
+	if resp, ok := v.cached(key); ok {
+		return resp, nil
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook request: %w", err)
+	}
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(v.now().Unix(), 10)
+
+	ctx, cancel := context.WithTimeout(ctx, v.config.Timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, v.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(AuthWebhookTimestampHeader, timestamp)
+	httpReq.Header.Set(AuthWebhookNonceHeader, nonce)
+	httpReq.Header.Set(AuthWebhookSignatureHeader, v.sign(timestamp, nonce, string(body)))
+
+	httpResp, err := v.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthWebhookUnavailable, err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(httpResp.Body, authWebhookMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthWebhookUnavailable, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: webhook returned status %d", ErrAuthWebhookUnavailable, httpResp.StatusCode)
+	}
+	expected := v.sign(nonce, string(respBody))
+	if !hmac.Equal([]byte(httpResp.Header.Get(AuthWebhookSignatureHeader)), []byte(expected)) {
+		return nil, fmt.Errorf("%w: invalid response signature", ErrAuthWebhookUnavailable)
+	}
+
+	var resp AuthWebhookResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("%w: invalid response body: %v", ErrAuthWebhookUnavailable, err)
+	}
+
+	if resp.Allowed && v.config.CacheTTL > 0 {
+		v.mu.Lock()
+		v.cache[key] = authWebhookCacheEntry{response: resp, expiresAt: v.now().Add(v.config.CacheTTL)}
+		v.mu.Unlock()
+	}
+	return &resp, nil
+}
+
+// Forget drops cached verdicts for a username, e.g. after the account is
+// disabled locally.
+func (v *AuthWebhookVerifier) Forget(username string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for key, entry := range v.cache {
+		if entry.response.Username == username || strings.HasPrefix(key, username+":") {
+			delete(v.cache, key)
+		}
+	}
+}
+
+func (v *AuthWebhookVerifier) cached(key string) (*AuthWebhookResponse, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	entry, ok := v.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if v.now().After(entry.expiresAt) {
+		delete(v.cache, key)
+		return nil, false
+	}
+	resp := entry.response
+	return &resp, true
+}
+
+// cacheKey identifies a username/password pair without keeping the
+// password: the username prefix allows Forget, the keyed hash of the
+// password cannot be reversed without the webhook secret.
+func (v *AuthWebhookVerifier) cacheKey(username, password string) string {
+	mac := hmac.New(sha256.New, []byte(v.config.Secret))
+	mac.Write([]byte(username + "\x00" + password))
+	return username + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (v *AuthWebhookVerifier) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(v.config.Secret))
+	for i, part := range parts {
+		if i > 0 {
+			mac.Write([]byte("."))
+		}
+		mac.Write([]byte(part))
+	}
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "webhook-test-secret"
+
+func testWebhookSign(parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	for i, part := range parts {
+		if i > 0 {
+			mac.Write([]byte("."))
+		}
+		mac.Write([]byte(part))
+	}
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newTestAuthWebhook serves a webhook accepting "alice"/"secret" and
+// counting calls. When signResponses is false responses are unsigned.
+func newTestAuthWebhook(t *testing.T, signResponses bool) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		nonce := r.Header.Get(AuthWebhookNonceHeader)
+		expected := testWebhookSign(r.Header.Get(AuthWebhookTimestampHeader), nonce, string(body))
+		if r.Header.Get(AuthWebhookSignatureHeader) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req AuthWebhookRequest
+		require.NoError(t, json.Unmarshal(body, &req))
+		resp := AuthWebhookResponse{Allowed: req.Username == "alice" && req.Password == "secret"}
+		if resp.Allowed {
+			resp.Username = "alice"
+			resp.Email = "alice@example.com"
+		} else {
+			resp.Reason = "bad password"
+		}
+		out, _ := json.Marshal(resp)
+		if signResponses {
+			w.Header().Set(AuthWebhookSignatureHeader, testWebhookSign(nonce, string(out)))
+		}
+		w.Write(out)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestAuthWebhookVerifier_Verify(t *testing.T) {
+	server, calls := newTestAuthWebhook(t, true)
+	verifier := NewAuthWebhookVerifier(AuthWebhookConfig{URL: server.URL, Secret: testWebhookSecret, CacheTTL: time.Minute})
+
+	resp, err := verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, "alice@example.com", resp.Email)
+
+	// Accepted logins are served from the cache
+	_, err = verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// Denials always reach the webhook
+	for i := 0; i < 2; i++ {
+		resp, err = verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "wrong"})
+		require.NoError(t, err)
+		assert.False(t, resp.Allowed)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+
+	verifier.Forget("alice")
+	_, err = verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+}
+
+func TestAuthWebhookVerifier_CacheExpiry(t *testing.T) {
+	server, calls := newTestAuthWebhook(t, true)
+	verifier := NewAuthWebhookVerifier(AuthWebhookConfig{URL: server.URL, Secret: testWebhookSecret, CacheTTL: time.Minute})
+	now := time.Now()
+	verifier.now = func() time.Time { return now }
+
+	_, err := verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestAuthWebhookVerifier_RejectsUntrustedResponses(t *testing.T) {
+	server, _ := newTestAuthWebhook(t, false)
+	verifier := NewAuthWebhookVerifier(AuthWebhookConfig{URL: server.URL, Secret: testWebhookSecret})
+	_, err := verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	assert.ErrorIs(t, err, ErrAuthWebhookUnavailable)
+
+	// A verifier with the wrong secret is refused by the webhook
+	server, _ = newTestAuthWebhook(t, true)
+	verifier = NewAuthWebhookVerifier(AuthWebhookConfig{URL: server.URL, Secret: "another-secret"})
+	_, err = verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	assert.ErrorIs(t, err, ErrAuthWebhookUnavailable)
+}
+
+func TestAuthWebhookVerifier_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	verifier := NewAuthWebhookVerifier(AuthWebhookConfig{URL: server.URL, Secret: testWebhookSecret, Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	_, err := verifier.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+	assert.ErrorIs(t, err, ErrAuthWebhookUnavailable)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestAuthService_LogoutForgetsWebhookLogins(t *testing.T) {
+	server, calls := newTestAuthWebhook(t, true)
+	service, _ := newSessionTestService(t)
+	service.SetAuthWebhook(AuthWebhookConfig{URL: server.URL, Secret: testWebhookSecret, CacheTTL: time.Minute})
+	verify := func() {
+		_, err := service.authWebhook.Verify(context.Background(), AuthWebhookRequest{Username: "alice", Password: "secret"})
+		require.NoError(t, err)
+	}
+
+	alice := &models.User{ID: 1, Username: "alice"}
+	session, err := service.createSession(alice, models.DeviceInfo{}, "10.0.0.1", "", false)
+	require.NoError(t, err)
+	token, err := service.generateJWT(alice, session.ID)
+	require.NoError(t, err)
+
+	verify()
+	verify()
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// After signing out, the next login is checked by the webhook again
+	require.NoError(t, service.Logout(token))
+	verify()
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
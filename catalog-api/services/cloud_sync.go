@@ -0,0 +1,680 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+)
+
+// CloudSyncProvider is an OAuth-linked cloud storage backend used by
+// cloud_storage sync endpoints. Paths are slash-separated and relative to the
+// endpoint's remote path.
+type CloudSyncProvider interface {
+	Name() string
+	AuthCodeURL(state string) string
+	Exchange(ctx context.Context, code string) (*CloudToken, error)
+	Refresh(ctx context.Context, refreshToken string) (*CloudToken, error)
+	// Changes returns the files changed under root since cursor together
+	// with the cursor for the next call. An empty cursor lists everything.
+	Changes(ctx context.Context, accessToken, root, cursor string) ([]CloudChange, string, error)
+	Download(ctx context.Context, accessToken, root string, change CloudChange) (io.ReadCloser, error)
+	// Upload writes content to relPath, keeping modTime where the provider
+	// allows clients to set it. content is rewound before each attempt.
+	Upload(ctx context.Context, accessToken, root, relPath string, content io.ReadSeeker, size int64, modTime time.Time) error
+}
+
+// CloudToken is an OAuth token pair issued by a provider
+type CloudToken struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// CloudChange is one entry of a provider's change feed
+type CloudChange struct {
+	ID      string
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Deleted bool
+}
+
+// CloudProviderConfig holds the OAuth application registered with a provider
+type CloudProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+var errCloudUnauthorized = errors.New("cloud provider rejected the access token")
+
+// cloudAPIError is a non-retryable error response from a provider API
+type cloudAPIError struct {
+	provider string
+	status   int
+	body     string
+}
+
+func (e *cloudAPIError) Error() string {
+	return fmt.Sprintf("%s API error (HTTP %d): %s", e.provider, e.status, e.body)
+}
+
+// cloudAPI performs provider HTTP calls, retrying with backoff while the
+// provider reports rate limiting.
+type cloudAPI struct {
+	provider   string
+	client     *http.Client
+	maxRetries int
+	// rateLimited decides whether a failed response is a throttling signal;
+	// providers differ in how they report it.
+	rateLimited func(status int, body []byte) bool
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+func newCloudAPI(provider string, rateLimited func(status int, body []byte) bool) *cloudAPI {
+	return &cloudAPI{
+		provider:    provider,
+		client:      &http.Client{},
+		maxRetries:  5,
+		rateLimited: rateLimited,
+		sleep:       sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// do sends the request built by newReq, rebuilding it for each retry. On
+// success the caller owns the response body.
+func (a *cloudAPI) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := a.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("%s request failed: %w", a.provider, err)
+		}
+		if resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("%w: %s", errCloudUnauthorized, strings.TrimSpace(string(body)))
+		}
+		if !a.rateLimited(resp.StatusCode, body) || attempt >= a.maxRetries {
+			return nil, &cloudAPIError{provider: a.provider, status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+		}
+
+		if err := a.sleep(ctx, retryDelay(resp.Header.Get("Retry-After"), attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay honours a Retry-After header in seconds and otherwise backs off
+// exponentially from one second, capped at a minute.
+func retryDelay(retryAfter string, attempt int) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	delay := time.Second << attempt
+	if delay > time.Minute || delay <= 0 {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// oauthEndpoints describes a provider's authorization server
+type oauthEndpoints struct {
+	authURL    string
+	tokenURL   string
+	scopes     []string
+	authParams url.Values
+}
+
+func (e oauthEndpoints) authCodeURL(cfg CloudProviderConfig, state string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", cfg.ClientID)
+	params.Set("redirect_uri", cfg.RedirectURL)
+	params.Set("state", state)
+	if len(e.scopes) > 0 {
+		params.Set("scope", strings.Join(e.scopes, " "))
+	}
+	for key, values := range e.authParams {
+		for _, v := range values {
+			params.Add(key, v)
+		}
+	}
+	return e.authURL + "?" + params.Encode()
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (e oauthEndpoints) token(ctx context.Context, api *cloudAPI, cfg CloudProviderConfig, form url.Values) (*CloudToken, error) {
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", cfg.ClientSecret)
+
+	resp, err := api.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, e.tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tr oauthTokenResponse
+	if err := decodeJSON(resp.Body, &tr); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token")
+	}
+
+	token := &CloudToken{AccessToken: tr.AccessToken, RefreshToken: tr.RefreshToken}
+	if tr.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+func (e oauthEndpoints) exchange(ctx context.Context, api *cloudAPI, cfg CloudProviderConfig, code string) (*CloudToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	return e.token(ctx, api, cfg, form)
+}
+
+func (e oauthEndpoints) refresh(ctx context.Context, api *cloudAPI, cfg CloudProviderConfig, refreshToken string) (*CloudToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return e.token(ctx, api, cfg, form)
+}
+
+// cloudTokenSource hands out a valid access token for an endpoint, refreshing
+// and persisting it when it is about to expire or the provider rejects it.
+type cloudTokenSource struct {
+	provider CloudSyncProvider
+	creds    *models.SyncCloudCredentials
+	save     func(*models.SyncCloudCredentials) error
+	now      func() time.Time
+}
+
+func (t *cloudTokenSource) accessToken(ctx context.Context) (string, error) {
+	if t.creds.TokenExpiry != nil && t.now().Add(time.Minute).After(*t.creds.TokenExpiry) {
+		if err := t.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+	return t.creds.AccessToken, nil
+}
+
+func (t *cloudTokenSource) refresh(ctx context.Context) error {
+	if t.creds.RefreshToken == "" {
+		return fmt.Errorf("%s access token expired and no refresh token is available; link the account again", t.provider.Name())
+	}
+	token, err := t.provider.Refresh(ctx, t.creds.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to refresh %s token: %w", t.provider.Name(), err)
+	}
+
+	t.creds.AccessToken = token.AccessToken
+	// Providers may rotate the refresh token or omit it to keep the old one
+	if token.RefreshToken != "" {
+		t.creds.RefreshToken = token.RefreshToken
+	}
+	t.creds.TokenExpiry = nil
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		t.creds.TokenExpiry = &expiry
+	}
+	return t.save(t.creds)
+}
+
+// call runs fn with an access token, refreshing once if it is rejected.
+func (t *cloudTokenSource) call(ctx context.Context, fn func(accessToken string) error) error {
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(token)
+	if !errors.Is(err, errCloudUnauthorized) || t.creds.RefreshToken == "" {
+		return err
+	}
+	if err := t.refresh(ctx); err != nil {
+		return err
+	}
+	return fn(t.creds.AccessToken)
+}
+
+// cloudLinkState tracks an OAuth consent flow started for an endpoint
+type cloudLinkState struct {
+	endpointID int
+	userID     int
+	provider   string
+	expiresAt  time.Time
+}
+
+const cloudLinkTTL = 10 * time.Minute
+
+// RegisterCloudProvider makes an OAuth cloud backend available to
+// cloud_storage endpoints whose settings name it as their provider.
+func (s *SyncService) RegisterCloudProvider(provider CloudSyncProvider) {
+	s.cloudMu.Lock()
+	defer s.cloudMu.Unlock()
+	s.cloudProviders[provider.Name()] = provider
+}
+
+// CloudProviderNames lists the registered cloud sync providers by name.
+func (s *SyncService) CloudProviderNames() []string {
+	s.cloudMu.Lock()
+	defer s.cloudMu.Unlock()
+	names := make([]string, 0, len(s.cloudProviders))
+	for name := range s.cloudProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *SyncService) cloudProvider(name string) (CloudSyncProvider, bool) {
+	s.cloudMu.Lock()
+	defer s.cloudMu.Unlock()
+	provider, ok := s.cloudProviders[name]
+	return provider, ok
+}
+
+// cloudProviderName returns the provider configured for a cloud storage
+// endpoint, falling back to the endpoint type for older endpoints.
+func cloudProviderName(endpoint *models.SyncEndpoint) (string, error) {
+	syncConfig := make(map[string]interface{})
+	if endpoint.SyncSettings != nil {
+		if err := decodeJSON(strings.NewReader(*endpoint.SyncSettings), &syncConfig); err != nil {
+			return "", fmt.Errorf("failed to parse cloud storage config: %w", err)
+		}
+	}
+	if provider, ok := syncConfig["provider"].(string); ok && provider != "" {
+		return provider, nil
+	}
+	return endpoint.Type, nil
+}
+
+// BeginCloudLink starts linking an endpoint to a cloud account and returns
+// the provider's consent URL. The user is sent back to the configured
+// redirect URL with a code and state to pass to CompleteCloudLink.
+func (s *SyncService) BeginCloudLink(endpointID int, user *models.User) (string, error) {
+	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
+	if err != nil {
+		return "", err
+	}
+
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
+		if err != nil || !hasPermission {
+			return "", fmt.Errorf("unauthorized to link this endpoint")
+		}
+	}
+
+	if endpoint.Type != models.SyncTypeCloudStorage {
+		return "", fmt.Errorf("account linking is only supported for cloud storage endpoints")
+	}
+	name, err := cloudProviderName(endpoint)
+	if err != nil {
+		return "", err
+	}
+	provider, ok := s.cloudProvider(name)
+	if !ok {
+		return "", fmt.Errorf("cloud provider %s is not configured", name)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate link state: %w", err)
+	}
+	state := hex.EncodeToString(buf)
+
+	s.cloudMu.Lock()
+	now := time.Now()
+	for key, pending := range s.cloudLinks {
+		if now.After(pending.expiresAt) {
+			delete(s.cloudLinks, key)
+		}
+	}
+	s.cloudLinks[state] = cloudLinkState{
+		endpointID: endpoint.ID,
+		userID:     user.ID,
+		provider:   name,
+		expiresAt:  now.Add(cloudLinkTTL),
+	}
+	s.cloudMu.Unlock()
+
+	return provider.AuthCodeURL(state), nil
+}
+
+// CompleteCloudLink exchanges the authorization code for tokens and stores
+// them against the endpoint. Relinking resets the change cursor.
+func (s *SyncService) CompleteCloudLink(userID int, state, code string) (*models.SyncCloudCredentials, error) {
+	s.cloudMu.Lock()
+	pending, ok := s.cloudLinks[state]
+	delete(s.cloudLinks, state)
+	s.cloudMu.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, fmt.Errorf("invalid or expired link state")
+	}
+	if pending.userID != userID {
+		return nil, fmt.Errorf("unauthorized to complete this link")
+	}
+
+	provider, ok := s.cloudProvider(pending.provider)
+	if !ok {
+		return nil, fmt.Errorf("cloud provider %s is not configured", pending.provider)
+	}
+
+	token, err := provider.Exchange(context.Background(), code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	creds := &models.SyncCloudCredentials{
+		EndpointID:   pending.endpointID,
+		Provider:     pending.provider,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+	}
+	if !token.Expiry.IsZero() {
+		creds.TokenExpiry = &token.Expiry
+	}
+	if err := s.syncRepo.SaveCloudCredentials(creds); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// performProviderSync syncs an endpoint with an OAuth cloud provider. Remote
+// changes are fetched from the provider's change feed starting at the stored
+// cursor; local changes are files modified since the last successful sync.
+func (s *SyncService) performProviderSync(ctx context.Context, session *models.SyncSession, endpoint *models.SyncEndpoint, provider CloudSyncProvider) error {
+	creds, err := s.syncRepo.GetCloudCredentials(endpoint.ID)
+	if err != nil {
+		return fmt.Errorf("endpoint is not linked to %s: %w", provider.Name(), err)
+	}
+	if creds.Provider != provider.Name() {
+		return fmt.Errorf("endpoint is linked to %s, not %s; link the account again", creds.Provider, provider.Name())
+	}
+
+	tokens := &cloudTokenSource{
+		provider: provider,
+		creds:    creds,
+		save:     s.syncRepo.SaveCloudCredentials,
+		now:      time.Now,
+	}
+
+	// Remote state seen in this run, used to avoid uploading files that
+	// match what the provider already has.
+	remote := make(map[string]CloudChange)
+	if endpoint.SyncDirection != models.SyncDirectionUpload {
+		var changes []CloudChange
+		var cursor string
+		err := tokens.call(ctx, func(accessToken string) error {
+			var err error
+			changes, cursor, err = provider.Changes(ctx, accessToken, endpoint.RemotePath, creds.ChangeCursor)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s changes: %w", provider.Name(), err)
+		}
+
+		session.TotalFiles += len(changes)
+		s.syncRepo.UpdateSession(session)
+
+		for _, change := range changes {
+			remote[change.Path] = change
+			s.applyCloudChange(ctx, session, endpoint, provider, tokens, change)
+			s.syncRepo.UpdateSession(session)
+		}
+
+		// Only advance the cursor once every change was looked at, so a
+		// crashed run is replayed rather than silently skipped.
+		creds.ChangeCursor = cursor
+		if err := s.syncRepo.SaveCloudCredentials(creds); err != nil {
+			return err
+		}
+	}
+
+	if endpoint.SyncDirection != models.SyncDirectionDownload {
+		if err := s.uploadCloudChanges(ctx, session, endpoint, provider, tokens, remote); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyCloudChange mirrors one remote change locally.
+func (s *SyncService) applyCloudChange(ctx context.Context, session *models.SyncSession, endpoint *models.SyncEndpoint,
+	provider CloudSyncProvider, tokens *cloudTokenSource, change CloudChange) {
+	if change.Path == "" || s.skipFile(session, change.Path, change.Size) {
+		return
+	}
+
+	localPath, err := syncLocalPath(endpoint.LocalPath, change.Path)
+	if err != nil {
+		session.FailedFiles++
+		s.logSyncError(session, change.Path, fmt.Sprintf("Refusing remote path %s: %v", change.Path, err))
+		return
+	}
+
+	if change.Deleted {
+		// Bidirectional endpoints keep local copies of remotely deleted
+		// files; they are uploaded again if edited locally.
+		if endpoint.SyncDirection == models.SyncDirectionDownload {
+			if _, err := os.Stat(localPath); err == nil {
+				s.preserveVersion(session, change.Path, localPath)
+				if err := os.Remove(localPath); err != nil {
+					session.FailedFiles++
+					s.logSyncError(session, change.Path, fmt.Sprintf("Failed to remove %s: %v", localPath, err))
+					return
+				}
+				session.SyncedFiles++
+			}
+		}
+		return
+	}
+
+	if localInfo, err := os.Stat(localPath); err == nil {
+		localMod := localInfo.ModTime().Truncate(time.Second)
+		if !change.ModTime.After(localMod) {
+			recordSkip(session, models.SyncSkipUnchanged)
+			return
+		}
+		// Local edits since the last sync that are newer than the remote
+		// copy win; the upload pass sends them.
+		if endpoint.LastSyncAt != nil && localInfo.ModTime().After(*endpoint.LastSyncAt) && localMod.After(change.ModTime) {
+			return
+		}
+		s.preserveVersion(session, change.Path, localPath)
+	}
+
+	if s.windowClosed(session) {
+		recordSkip(session, models.SyncSkipOutsideWindow)
+		return
+	}
+
+	err = tokens.call(ctx, func(accessToken string) error {
+		body, err := provider.Download(ctx, accessToken, endpoint.RemotePath, change)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		return writeFileAtomic(localPath, newThrottledReader(body, bandwidthLimit(session.Options)), change.ModTime)
+	})
+	if err != nil {
+		session.FailedFiles++
+		s.logSyncError(session, change.Path, fmt.Sprintf("Failed to download %s: %v", change.Path, err))
+		return
+	}
+
+	session.SyncedFiles++
+	s.updateSyncProgress(session, fmt.Sprintf("Downloaded: %s", change.Path))
+}
+
+// uploadCloudChanges sends local files changed since the last sync that are
+// newer than the remote copy seen in this run, if any.
+func (s *SyncService) uploadCloudChanges(ctx context.Context, session *models.SyncSession, endpoint *models.SyncEndpoint,
+	provider CloudSyncProvider, tokens *cloudTokenSource, remote map[string]CloudChange) error {
+	return filepath.Walk(endpoint.LocalPath, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(endpoint.LocalPath, localPath)
+		if err != nil {
+			return err
+		}
+		relPath := filepath.ToSlash(rel)
+
+		session.TotalFiles++
+		if s.skipFile(session, relPath, info.Size()) {
+			return nil
+		}
+		rc, seen := remote[relPath]
+		if seen && !rc.Deleted && !info.ModTime().Truncate(time.Second).After(rc.ModTime) {
+			recordSkip(session, models.SyncSkipUnchanged)
+			return nil
+		}
+		if !seen && endpoint.LastSyncAt != nil && !info.ModTime().After(*endpoint.LastSyncAt) {
+			recordSkip(session, models.SyncSkipUnchanged)
+			return nil
+		}
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			return nil
+		}
+
+		err = tokens.call(ctx, func(accessToken string) error {
+			file, err := os.Open(localPath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			content := &throttledReadSeeker{rs: file, bytesPerSec: bandwidthLimit(session.Options)}
+			return provider.Upload(ctx, accessToken, endpoint.RemotePath, relPath, content, info.Size(), info.ModTime())
+		})
+		if err != nil {
+			session.FailedFiles++
+			s.logSyncError(session, relPath, fmt.Sprintf("Failed to upload %s: %v", relPath, err))
+		} else {
+			session.SyncedFiles++
+			s.updateSyncProgress(session, fmt.Sprintf("Uploaded: %s", relPath))
+		}
+
+		s.syncRepo.UpdateSession(session)
+		return nil
+	})
+}
+
+// syncLocalPath joins a provider-relative path onto the endpoint's local
+// path, rejecting paths that would escape it.
+func syncLocalPath(root, relPath string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash("/" + relPath))
+	target := filepath.Join(root, cleaned)
+	if target == filepath.Clean(root) {
+		return "", fmt.Errorf("path resolves to the sync root")
+	}
+	return target, nil
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// writeFileAtomic writes r to a temporary file next to target and renames it
+// into place so readers never see a partial download.
+func writeFileAtomic(target string, r io.Reader, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".sync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(tmp.Name(), time.Now(), modTime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// throttledReadSeeker applies a bandwidth cap to a seekable body; seeking
+// restarts the pacing so retried uploads are throttled too.
+type throttledReadSeeker struct {
+	rs          io.ReadSeeker
+	bytesPerSec int64
+	r           io.Reader
+}
+
+func (t *throttledReadSeeker) Read(p []byte) (int, error) {
+	if t.r == nil {
+		t.r = newThrottledReader(t.rs, t.bytesPerSec)
+	}
+	return t.r.Read(p)
+}
+
+func (t *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	n, err := t.rs.Seek(offset, whence)
+	t.r = newThrottledReader(t.rs, t.bytesPerSec)
+	return n, err
+}
@@ -0,0 +1,850 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"catalogizer/models"
+)
+
+// cloudRemotePath joins a provider-relative path onto the endpoint's remote
+// path, producing an absolute slash-separated path ("" for the drive root).
+func cloudRemotePath(root, relPath string) string {
+	joined := path.Join("/", root, relPath)
+	if joined == "/" {
+		return ""
+	}
+	return joined
+}
+
+// cloudRelativePath strips root from an absolute remote path, reporting
+// false when the path lies outside root.
+func cloudRelativePath(root, fullPath string) (string, bool) {
+	root = strings.ToLower(cloudRemotePath(root, ""))
+	if root == "" {
+		return strings.TrimPrefix(fullPath, "/"), true
+	}
+	if len(fullPath) <= len(root)+1 || strings.ToLower(fullPath[:len(root)]) != root || fullPath[len(root)] != '/' {
+		return "", false
+	}
+	return fullPath[len(root)+1:], true
+}
+
+func newJSONRequest(method, target string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// contentRequest builds a request whose body is content rewound to offset
+// and limited to size bytes, so it can be rebuilt for each retry.
+func contentRequest(method, target string, content io.ReadSeeker, offset, size int64) (*http.Request, error) {
+	if _, err := content.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, target, io.NopCloser(io.LimitReader(content, size)))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return req, nil
+}
+
+// ---------------------------------------------------------------------------
+// Dropbox
+// ---------------------------------------------------------------------------
+
+// DropboxProvider syncs with Dropbox using the v2 HTTP API. The endpoint's
+// remote path is a folder path such as "/Media"; empty means the app root.
+type DropboxProvider struct {
+	cfg        CloudProviderConfig
+	api        *cloudAPI
+	oauth      oauthEndpoints
+	apiURL     string
+	contentURL string
+}
+
+// NewDropboxProvider creates a Dropbox backend for the given OAuth app.
+func NewDropboxProvider(cfg CloudProviderConfig) *DropboxProvider {
+	return &DropboxProvider{
+		cfg: cfg,
+		api: newCloudAPI(models.CloudProviderDropbox, func(status int, body []byte) bool {
+			return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+		}),
+		oauth: oauthEndpoints{
+			authURL:    "https://www.dropbox.com/oauth2/authorize",
+			tokenURL:   "https://api.dropboxapi.com/oauth2/token",
+			authParams: url.Values{"token_access_type": {"offline"}},
+		},
+		apiURL:     "https://api.dropboxapi.com/2",
+		contentURL: "https://content.dropboxapi.com/2",
+	}
+}
+
+func (p *DropboxProvider) Name() string { return models.CloudProviderDropbox }
+
+func (p *DropboxProvider) AuthCodeURL(state string) string {
+	return p.oauth.authCodeURL(p.cfg, state)
+}
+
+func (p *DropboxProvider) Exchange(ctx context.Context, code string) (*CloudToken, error) {
+	return p.oauth.exchange(ctx, p.api, p.cfg, code)
+}
+
+func (p *DropboxProvider) Refresh(ctx context.Context, refreshToken string) (*CloudToken, error) {
+	return p.oauth.refresh(ctx, p.api, p.cfg, refreshToken)
+}
+
+type dropboxEntry struct {
+	Tag            string    `json:".tag"`
+	ID             string    `json:"id"`
+	PathDisplay    string    `json:"path_display"`
+	Size           int64     `json:"size"`
+	ClientModified time.Time `json:"client_modified"`
+}
+
+type dropboxListResult struct {
+	Entries []dropboxEntry `json:"entries"`
+	Cursor  string         `json:"cursor"`
+	HasMore bool           `json:"has_more"`
+}
+
+func (p *DropboxProvider) rpc(ctx context.Context, accessToken, endpoint string, args, out interface{}) error {
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := newJSONRequest(http.MethodPost, p.apiURL+endpoint, args)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeJSON(resp.Body, out)
+}
+
+func (p *DropboxProvider) Changes(ctx context.Context, accessToken, root, cursor string) ([]CloudChange, string, error) {
+	var changes []CloudChange
+	var result dropboxListResult
+
+	var err error
+	if cursor == "" {
+		err = p.rpc(ctx, accessToken, "/files/list_folder", map[string]interface{}{
+			"path":      cloudRemotePath(root, ""),
+			"recursive": true,
+		}, &result)
+	} else {
+		err = p.rpc(ctx, accessToken, "/files/list_folder/continue", map[string]string{"cursor": cursor}, &result)
+	}
+
+	for {
+		if err != nil {
+			return nil, "", err
+		}
+		for _, entry := range result.Entries {
+			if entry.Tag == "folder" {
+				continue
+			}
+			rel, ok := cloudRelativePath(root, entry.PathDisplay)
+			if !ok {
+				continue
+			}
+			changes = append(changes, CloudChange{
+				ID:      entry.ID,
+				Path:    rel,
+				Size:    entry.Size,
+				ModTime: entry.ClientModified,
+				Deleted: entry.Tag == "deleted",
+			})
+		}
+		if !result.HasMore {
+			return changes, result.Cursor, nil
+		}
+		next := result.Cursor
+		result = dropboxListResult{}
+		err = p.rpc(ctx, accessToken, "/files/list_folder/continue", map[string]string{"cursor": next}, &result)
+	}
+}
+
+func (p *DropboxProvider) Download(ctx context.Context, accessToken, root string, change CloudChange) (io.ReadCloser, error) {
+	target := change.ID
+	if target == "" {
+		target = cloudRemotePath(root, change.Path)
+	}
+	arg, err := dropboxAPIArg(map[string]string{"path": target})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, p.contentURL+"/files/download", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Dropbox-API-Arg", arg)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Upload uses single-request uploads, which Dropbox accepts up to 150 MB.
+func (p *DropboxProvider) Upload(ctx context.Context, accessToken, root, relPath string, content io.ReadSeeker, size int64, modTime time.Time) error {
+	arg, err := dropboxAPIArg(map[string]interface{}{
+		"path":            cloudRemotePath(root, relPath),
+		"mode":            "overwrite",
+		"mute":            true,
+		"client_modified": modTime.UTC().Format("2006-01-02T15:04:05Z"),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := contentRequest(http.MethodPost, p.contentURL+"/files/upload", content, 0, size)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Dropbox-API-Arg", arg)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// dropboxAPIArg encodes v for the Dropbox-API-Arg header, which must be
+// ASCII; other characters are sent as JSON \u escapes.
+func dropboxAPIArg(v interface{}) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, r := range string(encoded) {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		if r >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&b, "\\u%04x\\u%04x", r1, r2)
+		} else {
+			fmt.Fprintf(&b, "\\u%04x", r)
+		}
+	}
+	return b.String(), nil
+}
+
+// ---------------------------------------------------------------------------
+// Google Drive
+// ---------------------------------------------------------------------------
+
+// GoogleDriveProvider syncs with Google Drive using the v3 API. Drive is
+// addressed by IDs rather than paths, so the endpoint's remote path is the
+// ID of the synced folder; empty means the root of My Drive.
+type GoogleDriveProvider struct {
+	cfg       CloudProviderConfig
+	api       *cloudAPI
+	oauth     oauthEndpoints
+	apiURL    string
+	uploadURL string
+}
+
+// NewGoogleDriveProvider creates a Google Drive backend for the given OAuth app.
+func NewGoogleDriveProvider(cfg CloudProviderConfig) *GoogleDriveProvider {
+	return &GoogleDriveProvider{
+		cfg: cfg,
+		api: newCloudAPI(models.CloudProviderGoogleDrive, func(status int, body []byte) bool {
+			// Drive reports quota exhaustion as 403 with a rateLimitExceeded
+			// reason and asks clients to back off on transient 5xx responses.
+			switch status {
+			case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+				http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				return true
+			case http.StatusForbidden:
+				return bytes.Contains(body, []byte("rateLimitExceeded")) || bytes.Contains(body, []byte("userRateLimitExceeded"))
+			}
+			return false
+		}),
+		oauth: oauthEndpoints{
+			authURL:    "https://accounts.google.com/o/oauth2/v2/auth",
+			tokenURL:   "https://oauth2.googleapis.com/token",
+			scopes:     []string{"https://www.googleapis.com/auth/drive"},
+			authParams: url.Values{"access_type": {"offline"}, "prompt": {"consent"}},
+		},
+		apiURL:    "https://www.googleapis.com/drive/v3",
+		uploadURL: "https://www.googleapis.com/upload/drive/v3",
+	}
+}
+
+func (p *GoogleDriveProvider) Name() string { return models.CloudProviderGoogleDrive }
+
+func (p *GoogleDriveProvider) AuthCodeURL(state string) string {
+	return p.oauth.authCodeURL(p.cfg, state)
+}
+
+func (p *GoogleDriveProvider) Exchange(ctx context.Context, code string) (*CloudToken, error) {
+	return p.oauth.exchange(ctx, p.api, p.cfg, code)
+}
+
+func (p *GoogleDriveProvider) Refresh(ctx context.Context, refreshToken string) (*CloudToken, error) {
+	return p.oauth.refresh(ctx, p.api, p.cfg, refreshToken)
+}
+
+const driveFolderMimeType = "application/vnd.google-apps.folder"
+
+type driveFile struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	MimeType     string    `json:"mimeType"`
+	Size         int64     `json:"size,string"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+	Parents      []string  `json:"parents"`
+	Trashed      bool      `json:"trashed"`
+}
+
+// downloadable reports whether the file has binary content; native Google
+// Docs formats can only be exported, not downloaded.
+func (f driveFile) downloadable() bool {
+	return !strings.HasPrefix(f.MimeType, "application/vnd.google-apps.")
+}
+
+func (p *GoogleDriveProvider) call(ctx context.Context, accessToken, method, target string, body, out interface{}) error {
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := newJSONRequest(method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return decodeJSON(resp.Body, out)
+}
+
+func (p *GoogleDriveProvider) rootID(ctx context.Context, accessToken, root string) (string, error) {
+	if root == "" {
+		root = "root"
+	}
+	var f driveFile
+	if err := p.call(ctx, accessToken, http.MethodGet, p.apiURL+"/files/"+url.PathEscape(root)+"?fields=id", nil, &f); err != nil {
+		return "", err
+	}
+	return f.ID, nil
+}
+
+// driveQuote escapes a value for use inside a Drive query string literal.
+func driveQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func (p *GoogleDriveProvider) listChildren(ctx context.Context, accessToken, query string) ([]driveFile, error) {
+	var files []driveFile
+	pageToken := ""
+	for {
+		params := url.Values{}
+		params.Set("q", query)
+		params.Set("fields", "nextPageToken,files(id,name,mimeType,size,modifiedTime,parents)")
+		params.Set("pageSize", "1000")
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+		var page struct {
+			NextPageToken string      `json:"nextPageToken"`
+			Files         []driveFile `json:"files"`
+		}
+		if err := p.call(ctx, accessToken, http.MethodGet, p.apiURL+"/files?"+params.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// drivePathResolver maps file IDs to paths relative to the synced folder by
+// walking parent links, caching folders along the way.
+type drivePathResolver struct {
+	p           *GoogleDriveProvider
+	accessToken string
+	rootID      string
+	folders     map[string]driveFile
+}
+
+func (r *drivePathResolver) path(ctx context.Context, f driveFile) (string, bool, error) {
+	parts := []string{f.Name}
+	parents := f.Parents
+	for depth := 0; depth < 64; depth++ {
+		if len(parents) == 0 {
+			return "", false, nil
+		}
+		parentID := parents[0]
+		if parentID == r.rootID {
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+			return strings.Join(parts, "/"), true, nil
+		}
+		parent, ok := r.folders[parentID]
+		if !ok {
+			if err := r.p.call(ctx, r.accessToken, http.MethodGet,
+				r.p.apiURL+"/files/"+url.PathEscape(parentID)+"?fields=id,name,parents", nil, &parent); err != nil {
+				return "", false, err
+			}
+			r.folders[parentID] = parent
+		}
+		parts = append(parts, parent.Name)
+		parents = parent.Parents
+	}
+	return "", false, nil
+}
+
+func (p *GoogleDriveProvider) Changes(ctx context.Context, accessToken, root, cursor string) ([]CloudChange, string, error) {
+	rootID, err := p.rootID(ctx, accessToken, root)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cursor == "" {
+		// Take the change token before listing so nothing modified during
+		// the listing is missed by the next run.
+		var start struct {
+			StartPageToken string `json:"startPageToken"`
+		}
+		if err := p.call(ctx, accessToken, http.MethodGet, p.apiURL+"/changes/startPageToken", nil, &start); err != nil {
+			return nil, "", err
+		}
+		changes, err := p.listTree(ctx, accessToken, rootID)
+		return changes, start.StartPageToken, err
+	}
+
+	resolver := &drivePathResolver{p: p, accessToken: accessToken, rootID: rootID, folders: make(map[string]driveFile)}
+	var changes []CloudChange
+	pageToken := cursor
+	for {
+		params := url.Values{}
+		params.Set("pageToken", pageToken)
+		params.Set("includeRemoved", "true")
+		params.Set("fields", "nextPageToken,newStartPageToken,changes(fileId,removed,file(id,name,mimeType,size,modifiedTime,parents,trashed))")
+		var page struct {
+			NextPageToken     string `json:"nextPageToken"`
+			NewStartPageToken string `json:"newStartPageToken"`
+			Changes           []struct {
+				FileID  string     `json:"fileId"`
+				Removed bool       `json:"removed"`
+				File    *driveFile `json:"file"`
+			} `json:"changes"`
+		}
+		if err := p.call(ctx, accessToken, http.MethodGet, p.apiURL+"/changes?"+params.Encode(), nil, &page); err != nil {
+			return nil, "", err
+		}
+
+		for _, c := range page.Changes {
+			// Permanently removed files carry no metadata to place them
+			if c.Removed || c.File == nil || c.File.MimeType == driveFolderMimeType || !c.File.downloadable() {
+				continue
+			}
+			rel, inside, err := resolver.path(ctx, *c.File)
+			if err != nil {
+				return nil, "", err
+			}
+			if !inside {
+				continue
+			}
+			changes = append(changes, CloudChange{
+				ID:      c.File.ID,
+				Path:    rel,
+				Size:    c.File.Size,
+				ModTime: c.File.ModifiedTime,
+				Deleted: c.File.Trashed,
+			})
+		}
+
+		if page.NewStartPageToken != "" {
+			return changes, page.NewStartPageToken, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (p *GoogleDriveProvider) listTree(ctx context.Context, accessToken, rootID string) ([]CloudChange, error) {
+	type folder struct{ id, path string }
+	queue := []folder{{id: rootID}}
+	var changes []CloudChange
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		children, err := p.listChildren(ctx, accessToken, driveQuote(current.id)+" in parents and trashed = false")
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			childPath := path.Join(current.path, child.Name)
+			if child.MimeType == driveFolderMimeType {
+				queue = append(queue, folder{id: child.ID, path: childPath})
+				continue
+			}
+			if !child.downloadable() {
+				continue
+			}
+			changes = append(changes, CloudChange{
+				ID:      child.ID,
+				Path:    childPath,
+				Size:    child.Size,
+				ModTime: child.ModifiedTime,
+			})
+		}
+	}
+	return changes, nil
+}
+
+func (p *GoogleDriveProvider) Download(ctx context.Context, accessToken, root string, change CloudChange) (io.ReadCloser, error) {
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, p.apiURL+"/files/"+url.PathEscape(change.ID)+"?alt=media", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// findChild returns the non-trashed child of parentID with the given name.
+func (p *GoogleDriveProvider) findChild(ctx context.Context, accessToken, parentID, name string) (*driveFile, error) {
+	files, err := p.listChildren(ctx, accessToken,
+		"name = "+driveQuote(name)+" and "+driveQuote(parentID)+" in parents and trashed = false")
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (p *GoogleDriveProvider) Upload(ctx context.Context, accessToken, root, relPath string, content io.ReadSeeker, size int64, modTime time.Time) error {
+	parentID, err := p.rootID(ctx, accessToken, root)
+	if err != nil {
+		return err
+	}
+
+	segments := strings.Split(strings.Trim(relPath, "/"), "/")
+	for _, dir := range segments[:len(segments)-1] {
+		existing, err := p.findChild(ctx, accessToken, parentID, dir)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			existing = &driveFile{}
+			err = p.call(ctx, accessToken, http.MethodPost, p.apiURL+"/files?fields=id", map[string]interface{}{
+				"name":     dir,
+				"mimeType": driveFolderMimeType,
+				"parents":  []string{parentID},
+			}, existing)
+			if err != nil {
+				return err
+			}
+		}
+		parentID = existing.ID
+	}
+
+	name := segments[len(segments)-1]
+	file, err := p.findChild(ctx, accessToken, parentID, name)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		file = &driveFile{}
+		err = p.call(ctx, accessToken, http.MethodPost, p.apiURL+"/files?fields=id", map[string]interface{}{
+			"name":    name,
+			"parents": []string{parentID},
+		}, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := contentRequest(http.MethodPatch, p.uploadURL+"/files/"+url.PathEscape(file.ID)+"?uploadType=media", content, 0, size)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// Uploading content bumps modifiedTime, so restore the local one
+	return p.call(ctx, accessToken, http.MethodPatch, p.apiURL+"/files/"+url.PathEscape(file.ID)+"?fields=id",
+		map[string]string{"modifiedTime": modTime.UTC().Format(time.RFC3339)}, nil)
+}
+
+// ---------------------------------------------------------------------------
+// OneDrive
+// ---------------------------------------------------------------------------
+
+// oneDriveChunkSize is the upload session chunk size; Graph requires a
+// multiple of 320 KiB.
+const oneDriveChunkSize = 32 * 320 * 1024
+
+// OneDriveProvider syncs with OneDrive through Microsoft Graph. The
+// endpoint's remote path is a folder path such as "/Media".
+type OneDriveProvider struct {
+	cfg      CloudProviderConfig
+	api      *cloudAPI
+	oauth    oauthEndpoints
+	graphURL string
+}
+
+// NewOneDriveProvider creates a OneDrive backend for the given OAuth app.
+func NewOneDriveProvider(cfg CloudProviderConfig) *OneDriveProvider {
+	return &OneDriveProvider{
+		cfg: cfg,
+		api: newCloudAPI(models.CloudProviderOneDrive, func(status int, body []byte) bool {
+			// Graph throttles with 429 and, for storage, 503 and 509
+			return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == 509
+		}),
+		oauth: oauthEndpoints{
+			authURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+			tokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+			scopes:   []string{"Files.ReadWrite", "offline_access"},
+		},
+		graphURL: "https://graph.microsoft.com/v1.0",
+	}
+}
+
+func (p *OneDriveProvider) Name() string { return models.CloudProviderOneDrive }
+
+func (p *OneDriveProvider) AuthCodeURL(state string) string {
+	return p.oauth.authCodeURL(p.cfg, state)
+}
+
+func (p *OneDriveProvider) Exchange(ctx context.Context, code string) (*CloudToken, error) {
+	return p.oauth.exchange(ctx, p.api, p.cfg, code)
+}
+
+func (p *OneDriveProvider) Refresh(ctx context.Context, refreshToken string) (*CloudToken, error) {
+	return p.oauth.refresh(ctx, p.api, p.cfg, refreshToken)
+}
+
+// itemURL addresses a drive item by path, e.g. /me/drive/root:/a/b.txt:
+func (p *OneDriveProvider) itemURL(fullPath string) string {
+	if fullPath == "" {
+		return p.graphURL + "/me/drive/root"
+	}
+	segments := strings.Split(strings.TrimPrefix(fullPath, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return p.graphURL + "/me/drive/root:/" + strings.Join(segments, "/") + ":"
+}
+
+type oneDriveItem struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Size            int64     `json:"size"`
+	Deleted         *struct{} `json:"deleted"`
+	File            *struct{} `json:"file"`
+	ParentReference struct {
+		Path string `json:"path"`
+	} `json:"parentReference"`
+	FileSystemInfo struct {
+		LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+	} `json:"fileSystemInfo"`
+}
+
+func (p *OneDriveProvider) call(ctx context.Context, accessToken, method, target string, body, out interface{}) error {
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := newJSONRequest(method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return decodeJSON(resp.Body, out)
+}
+
+// Changes follows the Graph delta feed; the cursor is the delta link.
+func (p *OneDriveProvider) Changes(ctx context.Context, accessToken, root, cursor string) ([]CloudChange, string, error) {
+	next := p.itemURL(cloudRemotePath(root, "")) + "/delta"
+	if cursor != "" {
+		// The cursor is sent with the access token, so only follow links
+		// back to Graph.
+		if !strings.HasPrefix(cursor, p.graphURL+"/") {
+			return nil, "", fmt.Errorf("invalid OneDrive delta link")
+		}
+		next = cursor
+	}
+
+	var changes []CloudChange
+	for {
+		var page struct {
+			Value     []oneDriveItem `json:"value"`
+			NextLink  string         `json:"@odata.nextLink"`
+			DeltaLink string         `json:"@odata.deltaLink"`
+		}
+		if err := p.call(ctx, accessToken, http.MethodGet, next, nil, &page); err != nil {
+			return nil, "", err
+		}
+
+		for _, item := range page.Value {
+			if item.File == nil && item.Deleted == nil {
+				continue
+			}
+			// Deleted items usually omit their parent path; without it they
+			// cannot be mapped to a local file.
+			parent, ok := strings.CutPrefix(item.ParentReference.Path, "/drive/root:")
+			if !ok {
+				continue
+			}
+			rel, inside := cloudRelativePath(root, path.Join("/", parent, item.Name))
+			if !inside {
+				continue
+			}
+			changes = append(changes, CloudChange{
+				ID:      item.ID,
+				Path:    rel,
+				Size:    item.Size,
+				ModTime: item.FileSystemInfo.LastModifiedDateTime,
+				Deleted: item.Deleted != nil,
+			})
+		}
+
+		if page.NextLink == "" {
+			return changes, page.DeltaLink, nil
+		}
+		next = page.NextLink
+	}
+}
+
+func (p *OneDriveProvider) Download(ctx context.Context, accessToken, root string, change CloudChange) (io.ReadCloser, error) {
+	resp, err := p.api.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, p.graphURL+"/me/drive/items/"+url.PathEscape(change.ID)+"/content", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Upload sends content through an upload session, which also lets the
+// local modification time be kept. Empty files use a simple upload since
+// sessions require at least one byte.
+func (p *OneDriveProvider) Upload(ctx context.Context, accessToken, root, relPath string, content io.ReadSeeker, size int64, modTime time.Time) error {
+	item := p.itemURL(cloudRemotePath(root, relPath))
+
+	if size == 0 {
+		resp, err := p.api.do(ctx, func() (*http.Request, error) {
+			req, err := contentRequest(http.MethodPut, item+"/content", content, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			return req, nil
+		})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	var uploadSession struct {
+		UploadURL string `json:"uploadUrl"`
+	}
+	err := p.call(ctx, accessToken, http.MethodPost, item+"/createUploadSession", map[string]interface{}{
+		"item": map[string]interface{}{
+			"@microsoft.graph.conflictBehavior": "replace",
+			"fileSystemInfo": map[string]string{
+				"lastModifiedDateTime": modTime.UTC().Format(time.RFC3339),
+			},
+		},
+	}, &uploadSession)
+	if err != nil {
+		return err
+	}
+
+	for offset := int64(0); offset < size; offset += oneDriveChunkSize {
+		n := size - offset
+		if n > oneDriveChunkSize {
+			n = oneDriveChunkSize
+		}
+		start := offset
+		// The upload URL is pre-authorized and must not carry the token
+		resp, err := p.api.do(ctx, func() (*http.Request, error) {
+			req, err := contentRequest(http.MethodPut, uploadSession.UploadURL, content, start, n)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+n-1, size))
+			return req, nil
+		})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
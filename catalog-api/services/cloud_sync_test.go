@@ -0,0 +1,354 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudAPI_BacksOffWhileRateLimited(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if calls < 3 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	api := newCloudAPI("test", func(status int, body []byte) bool { return status == http.StatusTooManyRequests })
+	var waits []time.Duration
+	api.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	resp, err := api.do(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, server.URL, nil)
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{7 * time.Second, 7 * time.Second}, waits)
+
+	// Other errors are returned without retrying
+	calls = 0
+	_, err = api.do(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	})
+	var apiErr *cloudAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.status)
+	assert.Equal(t, 1, calls)
+
+	// Retries are bounded
+	api.maxRetries = 0
+	calls = 0
+	_, err = api.do(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, server.URL, nil)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 3*time.Second, retryDelay("3", 0))
+	assert.Equal(t, time.Second, retryDelay("", 0))
+	assert.Equal(t, 8*time.Second, retryDelay("", 3))
+	assert.Equal(t, time.Minute, retryDelay("", 10))
+}
+
+func TestGoogleDriveRateLimitClassification(t *testing.T) {
+	p := NewGoogleDriveProvider(CloudProviderConfig{})
+	assert.True(t, p.api.rateLimited(http.StatusForbidden, []byte(`{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`)))
+	assert.False(t, p.api.rateLimited(http.StatusForbidden, []byte(`{"error":{"errors":[{"reason":"insufficientPermissions"}]}}`)))
+	assert.True(t, p.api.rateLimited(http.StatusServiceUnavailable, nil))
+}
+
+func TestDropboxProvider_ChangesAndUpload(t *testing.T) {
+	var uploadArg string
+	var uploaded []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2/files/list_folder", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+		var args map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&args))
+		assert.Equal(t, "/Media", args["path"])
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"entries": []map[string]interface{}{
+				{".tag": "folder", "path_display": "/Media/Films"},
+				{".tag": "file", "id": "id:1", "path_display": "/Media/Films/a.mkv", "size": 10, "client_modified": "2026-01-02T03:04:05Z"},
+			},
+			"cursor":   "c1",
+			"has_more": true,
+		})
+	})
+	mux.HandleFunc("/2/files/list_folder/continue", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"entries": []map[string]interface{}{
+				{".tag": "deleted", "path_display": "/media/old.txt"},
+				{".tag": "file", "id": "id:2", "path_display": "/Elsewhere/b.txt", "size": 1},
+			},
+			"cursor":   "c2",
+			"has_more": false,
+		})
+	})
+	mux.HandleFunc("/2/files/upload", func(w http.ResponseWriter, r *http.Request) {
+		uploadArg = r.Header.Get("Dropbox-API-Arg")
+		uploaded, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := NewDropboxProvider(CloudProviderConfig{ClientID: "app"})
+	p.apiURL = server.URL + "/2"
+	p.contentURL = server.URL + "/2"
+
+	changes, cursor, err := p.Changes(context.Background(), "tok", "/Media", "")
+	require.NoError(t, err)
+	assert.Equal(t, "c2", cursor)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "Films/a.mkv", changes[0].Path)
+	assert.Equal(t, int64(10), changes[0].Size)
+	assert.Equal(t, "old.txt", changes[1].Path)
+	assert.True(t, changes[1].Deleted)
+
+	modTime := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	err = p.Upload(context.Background(), "tok", "/Media", "Música/ß.txt", bytes.NewReader([]byte("hello")), 5, modTime)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(uploaded))
+	assert.NotContains(t, uploadArg, "ß")
+	var arg map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(uploadArg), &arg))
+	assert.Equal(t, "/Media/Música/ß.txt", arg["path"])
+	assert.Equal(t, "2026-03-04T05:06:07Z", arg["client_modified"])
+
+	authURL, err := url.Parse(p.AuthCodeURL("xyz"))
+	require.NoError(t, err)
+	assert.Equal(t, "offline", authURL.Query().Get("token_access_type"))
+	assert.Equal(t, "xyz", authURL.Query().Get("state"))
+}
+
+func TestSyncLocalPath(t *testing.T) {
+	root := t.TempDir()
+	target, err := syncLocalPath(root, "../../etc/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "etc", "passwd"), target)
+
+	_, err = syncLocalPath(root, "..")
+	assert.Error(t, err)
+}
+
+func TestCloudRelativePath(t *testing.T) {
+	rel, ok := cloudRelativePath("/Media", "/media/Films/a.mkv")
+	assert.True(t, ok)
+	assert.Equal(t, "Films/a.mkv", rel)
+
+	_, ok = cloudRelativePath("/Media", "/MediaArchive/a.mkv")
+	assert.False(t, ok)
+
+	rel, ok = cloudRelativePath("", "/a.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "a.txt", rel)
+}
+
+// fakeCloudProvider keeps remote files in memory keyed by relative path.
+type fakeCloudProvider struct {
+	files     map[string][]byte
+	modTimes  map[string]time.Time
+	changes   []CloudChange
+	refreshed int
+	validTok  string
+}
+
+func (f *fakeCloudProvider) Name() string { return "fake" }
+func (f *fakeCloudProvider) AuthCodeURL(state string) string {
+	return "https://auth.example/?state=" + state
+}
+
+func (f *fakeCloudProvider) Exchange(ctx context.Context, code string) (*CloudToken, error) {
+	if code != "good" {
+		return nil, fmt.Errorf("bad code")
+	}
+	return &CloudToken{AccessToken: "tok", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func (f *fakeCloudProvider) Refresh(ctx context.Context, refreshToken string) (*CloudToken, error) {
+	f.refreshed++
+	f.validTok = fmt.Sprintf("tok-%d", f.refreshed)
+	return &CloudToken{AccessToken: f.validTok, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func (f *fakeCloudProvider) check(token string) error {
+	if token != f.validTok {
+		return errCloudUnauthorized
+	}
+	return nil
+}
+
+func (f *fakeCloudProvider) Changes(ctx context.Context, accessToken, root, cursor string) ([]CloudChange, string, error) {
+	if err := f.check(accessToken); err != nil {
+		return nil, "", err
+	}
+	return f.changes, cursor + "+", nil
+}
+
+func (f *fakeCloudProvider) Download(ctx context.Context, accessToken, root string, change CloudChange) (io.ReadCloser, error) {
+	if err := f.check(accessToken); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(f.files[change.Path])), nil
+}
+
+func (f *fakeCloudProvider) Upload(ctx context.Context, accessToken, root, relPath string, content io.ReadSeeker, size int64, modTime time.Time) error {
+	if err := f.check(accessToken); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f.files[relPath] = data
+	f.modTimes[relPath] = modTime
+	return nil
+}
+
+func TestSyncService_ProviderSync(t *testing.T) {
+	db, cleanup := newSyncTestDB(t)
+	defer cleanup()
+	repo := repository.NewSyncRepository(db)
+	service := NewSyncService(repo, nil, nil)
+
+	provider := &fakeCloudProvider{
+		files:    map[string][]byte{"docs/remote.txt": []byte("from cloud")},
+		modTimes: map[string]time.Time{},
+		validTok: "fresh",
+	}
+	service.RegisterCloudProvider(provider)
+
+	localDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "local.txt"), []byte("from disk"), 0644))
+	remoteMod := time.Now().Add(-time.Hour).Truncate(time.Second)
+	provider.changes = []CloudChange{
+		{ID: "r1", Path: "docs/remote.txt", Size: 10, ModTime: remoteMod},
+	}
+
+	settings := `{"provider":"fake"}`
+	endpoint := &models.SyncEndpoint{
+		UserID: 1, Name: "cloud", Type: models.SyncTypeCloudStorage, URL: "fake://",
+		SyncDirection: models.SyncDirectionBidirectional, LocalPath: localDir,
+		SyncSettings: &settings, Status: models.SyncStatusActive,
+		CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	id, err := repo.CreateEndpoint(endpoint)
+	require.NoError(t, err)
+	endpoint.ID = id
+
+	session := &models.SyncSession{EndpointID: id, UserID: 1}
+	err = service.performCloudSync(session, endpoint)
+	assert.ErrorContains(t, err, "not linked")
+
+	// An expired token is refreshed before use and the new one persisted
+	expired := time.Now().Add(-time.Minute)
+	require.NoError(t, repo.SaveCloudCredentials(&models.SyncCloudCredentials{
+		EndpointID: id, Provider: "fake", AccessToken: "stale", RefreshToken: "refresh", TokenExpiry: &expired,
+	}))
+
+	require.NoError(t, service.performCloudSync(session, endpoint))
+	assert.Equal(t, 1, provider.refreshed)
+
+	content, err := os.ReadFile(filepath.Join(localDir, "docs", "remote.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "from cloud", string(content))
+	info, err := os.Stat(filepath.Join(localDir, "docs", "remote.txt"))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(remoteMod))
+
+	assert.Equal(t, "from disk", string(provider.files["local.txt"]))
+	_, reuploaded := provider.modTimes["docs/remote.txt"]
+	assert.False(t, reuploaded, "downloaded files must not be uploaded back")
+	assert.Equal(t, 2, session.SyncedFiles)
+	assert.Equal(t, 0, session.FailedFiles)
+
+	creds, err := repo.GetCloudCredentials(id)
+	require.NoError(t, err)
+	assert.Equal(t, "+", creds.ChangeCursor)
+	assert.Equal(t, "tok-1", creds.AccessToken)
+	assert.Equal(t, "refresh", creds.RefreshToken)
+
+	// A token revoked mid-life is refreshed once on rejection
+	provider.validTok = "rotated"
+	provider.changes = nil
+	require.NoError(t, service.performCloudSync(&models.SyncSession{EndpointID: id, UserID: 1}, endpoint))
+	assert.Equal(t, 2, provider.refreshed)
+	creds, err = repo.GetCloudCredentials(id)
+	require.NoError(t, err)
+	assert.Equal(t, "++", creds.ChangeCursor)
+}
+
+func TestSyncService_CloudLinkFlow(t *testing.T) {
+	db, cleanup := newSyncTestDB(t)
+	defer cleanup()
+	repo := repository.NewSyncRepository(db)
+	service := NewSyncService(repo, nil, nil)
+	service.RegisterCloudProvider(&fakeCloudProvider{})
+
+	settings := `{"provider":"fake"}`
+	id, err := repo.CreateEndpoint(&models.SyncEndpoint{
+		UserID: 1, Name: "cloud", Type: models.SyncTypeCloudStorage, URL: "fake://",
+		SyncDirection: models.SyncDirectionDownload, LocalPath: t.TempDir(),
+		SyncSettings: &settings, Status: models.SyncStatusActive,
+		CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+
+	authURL, err := service.BeginCloudLink(id, &models.User{ID: 1})
+	require.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	state := parsed.Query().Get("state")
+	require.NotEmpty(t, state)
+
+	_, err = service.CompleteCloudLink(2, state, "good")
+	assert.ErrorContains(t, err, "unauthorized")
+
+	// The state is single-use
+	_, err = service.CompleteCloudLink(1, state, "good")
+	assert.ErrorContains(t, err, "invalid or expired")
+
+	authURL, err = service.BeginCloudLink(id, &models.User{ID: 1})
+	require.NoError(t, err)
+	parsed, _ = url.Parse(authURL)
+	creds, err := service.CompleteCloudLink(1, parsed.Query().Get("state"), "good")
+	require.NoError(t, err)
+	assert.Equal(t, id, creds.EndpointID)
+
+	stored, err := repo.GetCloudCredentials(id)
+	require.NoError(t, err)
+	assert.Equal(t, "tok", stored.AccessToken)
+	assert.Equal(t, "refresh", stored.RefreshToken)
+	assert.NotNil(t, stored.TokenExpiry)
+}
@@ -1,15 +1,24 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"catalogizer/filesystem"
+	internal_services "catalogizer/internal/services"
+	"catalogizer/middleware"
 	"catalogizer/models"
 	"catalogizer/repository"
 
@@ -23,6 +32,12 @@ type ConfigurationService struct {
 	config      *models.SystemConfiguration
 	wizardSteps []*models.WizardStep
 	validators  map[string]ConfigValidator
+	corsReload  CORSReloader
+}
+
+// CORSReloader applies saved CORS policies to the running server
+type CORSReloader interface {
+	Reload(config *models.CORSConfig) error
 }
 
 type ConfigValidator interface {
@@ -34,6 +49,16 @@ type NetworkValidator struct{}
 type PathValidator struct{}
 type EmailValidator struct{}
 
+// SMBValidator checks that an SMB share can be mounted with the given
+// credentials
+type SMBValidator struct{}
+
+// SMTPValidator checks that an SMTP relay accepts the given credentials
+type SMTPValidator struct{}
+
+// connectionTestTimeout bounds each connectivity check the wizard runs
+const connectionTestTimeout = 10 * time.Second
+
 func NewConfigurationService(configRepo *repository.ConfigurationRepository, configPath string) *ConfigurationService {
 	service := &ConfigurationService{
 		configRepo: configRepo,
@@ -46,6 +71,8 @@ func NewConfigurationService(configRepo *repository.ConfigurationRepository, con
 	service.validators["network"] = &NetworkValidator{}
 	service.validators["path"] = &PathValidator{}
 	service.validators["email"] = &EmailValidator{}
+	service.validators["smb"] = &SMBValidator{}
+	service.validators["smtp"] = &SMTPValidator{}
 
 	// Initialize wizard steps
 	service.initializeWizardSteps()
@@ -83,7 +110,7 @@ func (s *ConfigurationService) initializeWizardSteps() {
 					Label:        "Database Type",
 					Type:         "select",
 					Required:     true,
-					Options:      []string{"sqlite", "mysql", "postgresql"},
+					Options:      []string{"sqlite", "postgresql"},
 					DefaultValue: "sqlite",
 				},
 				{
@@ -92,15 +119,15 @@ func (s *ConfigurationService) initializeWizardSteps() {
 					Type:         "text",
 					Required:     false,
 					DefaultValue: "localhost",
-					ShowWhen:     map[string]interface{}{"database_type": []string{"mysql", "postgresql"}},
+					ShowWhen:     map[string]interface{}{"database_type": []string{"postgresql"}},
 				},
 				{
 					Name:         "database_port",
 					Label:        "Database Port",
 					Type:         "number",
 					Required:     false,
-					DefaultValue: 3306,
-					ShowWhen:     map[string]interface{}{"database_type": []string{"mysql", "postgresql"}},
+					DefaultValue: 5432,
+					ShowWhen:     map[string]interface{}{"database_type": []string{"postgresql"}},
 				},
 				{
 					Name:         "database_name",
@@ -114,14 +141,23 @@ func (s *ConfigurationService) initializeWizardSteps() {
 					Label:    "Database Username",
 					Type:     "text",
 					Required: false,
-					ShowWhen: map[string]interface{}{"database_type": []string{"mysql", "postgresql"}},
+					ShowWhen: map[string]interface{}{"database_type": []string{"postgresql"}},
 				},
 				{
 					Name:     "database_password",
 					Label:    "Database Password",
 					Type:     "password",
 					Required: false,
-					ShowWhen: map[string]interface{}{"database_type": []string{"mysql", "postgresql"}},
+					ShowWhen: map[string]interface{}{"database_type": []string{"postgresql"}},
+				},
+				{
+					Name:         "database_ssl_mode",
+					Label:        "SSL Mode",
+					Type:         "select",
+					Required:     false,
+					Options:      []string{"disable", "require", "verify-ca", "verify-full"},
+					DefaultValue: "disable",
+					ShowWhen:     map[string]interface{}{"database_type": []string{"postgresql"}},
 				},
 			},
 			Validation: map[string]interface{}{
@@ -176,13 +212,64 @@ func (s *ConfigurationService) initializeWizardSteps() {
 				},
 			},
 		},
+		{
+			ID:          "media_source",
+			Name:        "Media Source",
+			Description: "Add an SMB share to catalog",
+			Type:        models.WizardStepTypeForm,
+			Required:    false,
+			Order:       4,
+			Fields: []*models.WizardField{
+				{
+					Name:     "smb_host",
+					Label:    "SMB Host",
+					Type:     "text",
+					Required: false,
+				},
+				{
+					Name:         "smb_port",
+					Label:        "SMB Port",
+					Type:         "number",
+					Required:     false,
+					DefaultValue: 445,
+				},
+				{
+					Name:     "smb_share",
+					Label:    "Share Name",
+					Type:     "text",
+					Required: false,
+				},
+				{
+					Name:     "smb_username",
+					Label:    "Username",
+					Type:     "text",
+					Required: false,
+				},
+				{
+					Name:     "smb_password",
+					Label:    "Password",
+					Type:     "password",
+					Required: false,
+				},
+				{
+					Name:         "smb_domain",
+					Label:        "Domain",
+					Type:         "text",
+					Required:     false,
+					DefaultValue: "WORKGROUP",
+				},
+			},
+			Validation: map[string]interface{}{
+				"validator": "smb",
+			},
+		},
 		{
 			ID:          "network",
 			Name:        "Network Configuration",
 			Description: "Configure network and API settings",
 			Type:        models.WizardStepTypeForm,
 			Required:    true,
-			Order:       4,
+			Order:       5,
 			Fields: []*models.WizardField{
 				{
 					Name:         "server_host",
@@ -222,11 +309,10 @@ func (s *ConfigurationService) initializeWizardSteps() {
 					ShowWhen: map[string]interface{}{"enable_https": true},
 				},
 				{
-					Name:         "cors_origins",
-					Label:        "CORS Allowed Origins",
-					Type:         "text",
-					Required:     false,
-					DefaultValue: "*",
+					Name:     "cors_origins",
+					Label:    "CORS Allowed Origins",
+					Type:     "text",
+					Required: false,
 				},
 			},
 		},
@@ -236,7 +322,7 @@ func (s *ConfigurationService) initializeWizardSteps() {
 			Description: "Configure authentication and security settings",
 			Type:        models.WizardStepTypeForm,
 			Required:    true,
-			Order:       5,
+			Order:       6,
 			Fields: []*models.WizardField{
 				{
 					Name:     "jwt_secret",
@@ -281,7 +367,7 @@ func (s *ConfigurationService) initializeWizardSteps() {
 			Description: "Enable and configure advanced features",
 			Type:        models.WizardStepTypeForm,
 			Required:    false,
-			Order:       6,
+			Order:       7,
 			Fields: []*models.WizardField{
 				{
 					Name:         "enable_media_conversion",
@@ -319,7 +405,7 @@ func (s *ConfigurationService) initializeWizardSteps() {
 			Description: "Configure integrations with external services",
 			Type:        models.WizardStepTypeForm,
 			Required:    false,
-			Order:       7,
+			Order:       8,
 			Fields: []*models.WizardField{
 				{
 					Name:     "smtp_host",
@@ -360,6 +446,9 @@ func (s *ConfigurationService) initializeWizardSteps() {
 					DefaultValue: true,
 				},
 			},
+			Validation: map[string]interface{}{
+				"validator": "smtp",
+			},
 		},
 		{
 			ID:          "summary",
@@ -367,7 +456,7 @@ func (s *ConfigurationService) initializeWizardSteps() {
 			Description: "Review your configuration before applying",
 			Type:        models.WizardStepTypeSummary,
 			Required:    true,
-			Order:       8,
+			Order:       9,
 		},
 		{
 			ID:          "complete",
@@ -375,7 +464,7 @@ func (s *ConfigurationService) initializeWizardSteps() {
 			Description: "Configuration has been applied successfully",
 			Type:        models.WizardStepTypeComplete,
 			Required:    true,
-			Order:       9,
+			Order:       10,
 		},
 	}
 
@@ -513,9 +602,55 @@ func (s *ConfigurationService) SaveConfiguration(config *models.SystemConfigurat
 	}
 
 	s.config = config
+	if s.corsReload != nil && config.Network != nil {
+		if err := s.corsReload.Reload(config.Network.CORS); err != nil {
+			return fmt.Errorf("configuration saved but CORS policies were not applied: %w", err)
+		}
+	}
 	return nil
 }
 
+// SetCORSReloader makes saved configurations apply their CORS policies to
+// the running server
+func (s *ConfigurationService) SetCORSReloader(reloader CORSReloader) {
+	s.corsReload = reloader
+}
+
+// GetCORSConfiguration returns the saved CORS policies
+func (s *ConfigurationService) GetCORSConfiguration() (*models.CORSConfig, error) {
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	if config.Network == nil || config.Network.CORS == nil {
+		return &models.CORSConfig{}, nil
+	}
+	return config.Network.CORS, nil
+}
+
+// UpdateCORSConfiguration replaces the CORS policies and applies them
+// without a restart
+func (s *ConfigurationService) UpdateCORSConfiguration(cors *models.CORSConfig) (*models.SystemConfiguration, error) {
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *config
+	network := models.NetworkConfig{}
+	if config.Network != nil {
+		network = *config.Network
+	}
+	network.CORS = cors
+	updated.Network = &network
+	updated.UpdatedAt = time.Now()
+
+	if err := s.SaveConfiguration(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
 func (s *ConfigurationService) UpdateConfiguration(updates map[string]interface{}) (*models.SystemConfiguration, error) {
 	config, err := s.GetConfiguration()
 	if err != nil {
@@ -566,6 +701,253 @@ func (s *ConfigurationService) ImportConfiguration(data []byte) (*models.SystemC
 	return &config, nil
 }
 
+// configurationSections are the sections of the system configuration
+// that can be read and replaced one at a time
+var configurationSections = []string{"database", "storage", "network", "authentication", "external_services"}
+
+// GetMaskedConfiguration returns the live configuration with secrets
+// masked
+func (s *ConfigurationService) GetMaskedConfiguration() (*models.SystemConfiguration, error) {
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	return maskConfiguration(config), nil
+}
+
+// GetConfigurationSection returns a section of the live configuration
+// with secrets masked
+func (s *ConfigurationService) GetConfigurationSection(section string) (interface{}, error) {
+	config, err := s.GetMaskedConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	switch section {
+	case "database":
+		return config.Database, nil
+	case "storage":
+		return config.Storage, nil
+	case "network":
+		return config.Network, nil
+	case "authentication":
+		return config.Authentication, nil
+	case "external_services":
+		return config.ExternalServices, nil
+	}
+	return nil, fmt.Errorf("invalid configuration section %q, expected one of %s", section, strings.Join(configurationSections, ", "))
+}
+
+// UpdateConfigurationSection replaces a section of the live configuration
+// with the JSON in data. Masked secrets keep their saved value. The
+// result must pass validation before it is saved.
+func (s *ConfigurationService) UpdateConfigurationSection(section string, data []byte) (*models.SystemConfiguration, error) {
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	updated := cloneConfiguration(config)
+	var target interface{}
+	switch section {
+	case "database":
+		updated.Database = &models.DatabaseConfig{}
+		target = updated.Database
+	case "storage":
+		updated.Storage = &models.StorageConfig{}
+		target = updated.Storage
+	case "network":
+		updated.Network = &models.NetworkConfig{}
+		target = updated.Network
+	case "authentication":
+		updated.Authentication = &models.AuthenticationConfig{}
+		target = updated.Authentication
+	case "external_services":
+		updated.ExternalServices = &models.ExternalServicesConfig{}
+		target = updated.ExternalServices
+	default:
+		return nil, fmt.Errorf("invalid configuration section %q, expected one of %s", section, strings.Join(configurationSections, ", "))
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return nil, fmt.Errorf("invalid configuration section %s: %w", section, err)
+	}
+
+	unmaskConfiguration(updated, config)
+	updated.UpdatedAt = time.Now()
+	if err := s.SaveConfiguration(updated); err != nil {
+		return nil, err
+	}
+	return maskConfiguration(updated), nil
+}
+
+// CreateBackup saves a named copy of the live configuration
+func (s *ConfigurationService) CreateBackup(name string) (*models.ConfigurationBackup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("invalid backup name: must be 1 to 100 characters")
+	}
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	return s.configRepo.CreateConfigurationBackup(name, config)
+}
+
+// ListBackups returns the backups, newest first, without their
+// configurations
+func (s *ConfigurationService) ListBackups() ([]*models.ConfigurationBackup, error) {
+	backups, err := s.configRepo.GetConfigurationBackups()
+	if err != nil {
+		return nil, err
+	}
+	if backups == nil {
+		backups = []*models.ConfigurationBackup{}
+	}
+	return backups, nil
+}
+
+// GetBackup returns a backup with its configuration's secrets masked
+func (s *ConfigurationService) GetBackup(backupID int) (*models.ConfigurationBackup, error) {
+	backup, err := s.backup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	backup.Configuration = maskConfiguration(backup.Configuration)
+	return backup, nil
+}
+
+// RestoreBackup makes a backup the live configuration. The configuration
+// it replaces is backed up first.
+func (s *ConfigurationService) RestoreBackup(backupID int) (*models.SystemConfiguration, error) {
+	backup, err := s.backup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.CreateBackup("Before restoring " + backup.Name); err != nil {
+		return nil, err
+	}
+
+	config := backup.Configuration
+	config.UpdatedAt = time.Now()
+	if err := s.SaveConfiguration(config); err != nil {
+		return nil, err
+	}
+	return maskConfiguration(config), nil
+}
+
+// DeleteBackup deletes a backup
+func (s *ConfigurationService) DeleteBackup(backupID int) error {
+	if _, err := s.backup(backupID); err != nil {
+		return err
+	}
+	return s.configRepo.DeleteConfigurationBackup(backupID)
+}
+
+// backup returns a backup, or an error saying it was not found
+func (s *ConfigurationService) backup(backupID int) (*models.ConfigurationBackup, error) {
+	backup, err := s.configRepo.GetConfigurationBackup(backupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("configuration backup %d not found", backupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if backup.Configuration == nil {
+		return nil, fmt.Errorf("configuration backup %d is empty", backupID)
+	}
+	return backup, nil
+}
+
+// ListTemplates returns the templates by category and name, with
+// secrets masked
+func (s *ConfigurationService) ListTemplates() ([]*models.ConfigurationTemplate, error) {
+	templates, err := s.configRepo.GetConfigurationTemplates()
+	if err != nil {
+		return nil, err
+	}
+	if templates == nil {
+		templates = []*models.ConfigurationTemplate{}
+	}
+	for _, template := range templates {
+		if template.Configuration != nil {
+			template.Configuration = maskConfiguration(template.Configuration)
+		}
+	}
+	return templates, nil
+}
+
+// CreateTemplate saves a template. Its configuration only needs the
+// sections it sets.
+func (s *ConfigurationService) CreateTemplate(template *models.ConfigurationTemplate) (*models.ConfigurationTemplate, error) {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" || len(template.Name) > 100 {
+		return nil, fmt.Errorf("invalid template name: must be 1 to 100 characters")
+	}
+	switch template.Category {
+	case "", models.ConfigCategoryEnvironment, models.ConfigCategoryPerformance,
+		models.ConfigCategorySecurity, models.ConfigCategoryDevelopment:
+	default:
+		return nil, fmt.Errorf("invalid template category: %s", template.Category)
+	}
+	if template.Configuration == nil {
+		return nil, fmt.Errorf("invalid template: configuration is required")
+	}
+
+	template.CreatedAt = time.Now()
+	if err := s.configRepo.CreateConfigurationTemplate(template); err != nil {
+		return nil, err
+	}
+	template.Configuration = maskConfiguration(template.Configuration)
+	return template, nil
+}
+
+// DeleteTemplate deletes a template
+func (s *ConfigurationService) DeleteTemplate(templateID int) error {
+	if _, err := s.template(templateID); err != nil {
+		return err
+	}
+	return s.configRepo.DeleteConfigurationTemplate(templateID)
+}
+
+// ApplyTemplate replaces the sections of the live configuration that a
+// template sets. The configuration it replaces is backed up first.
+func (s *ConfigurationService) ApplyTemplate(templateID int) (*models.SystemConfiguration, error) {
+	template, err := s.template(templateID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.CreateBackup("Before applying " + template.Name); err != nil {
+		return nil, err
+	}
+
+	updated := overlayConfiguration(config, template.Configuration)
+	updated.UpdatedAt = time.Now()
+	if err := s.SaveConfiguration(updated); err != nil {
+		return nil, err
+	}
+	return maskConfiguration(updated), nil
+}
+
+// template returns a template, or an error saying it was not found
+func (s *ConfigurationService) template(templateID int) (*models.ConfigurationTemplate, error) {
+	template, err := s.configRepo.GetConfigurationTemplate(templateID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("configuration template %d not found", templateID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if template.Configuration == nil {
+		return nil, fmt.Errorf("configuration template %d is empty", templateID)
+	}
+	return template, nil
+}
+
 func (s *ConfigurationService) GetConfigurationSchema() (*models.ConfigurationSchema, error) {
 	return &models.ConfigurationSchema{
 		Version: "3.0.0",
@@ -604,6 +986,23 @@ func (s *ConfigurationService) GetConfigurationSchema() (*models.ConfigurationSc
 	}, nil
 }
 
+// TestConfigurationSections tests the live configuration with the
+// sections config sets in place of the live ones, without saving them.
+// Masked secrets keep their saved value; a nil config tests the live
+// configuration as it is.
+func (s *ConfigurationService) TestConfigurationSections(config *models.SystemConfiguration) (*models.ConfigurationTest, error) {
+	live, err := s.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		live = overlayConfiguration(live, config)
+	}
+	return s.TestConfiguration(live)
+}
+
+// TestConfiguration checks each subsystem of a configuration, connecting
+// to the database and SMTP relay it names
 func (s *ConfigurationService) TestConfiguration(config *models.SystemConfiguration) (*models.ConfigurationTest, error) {
 	test := &models.ConfigurationTest{
 		TestedAt: time.Now(),
@@ -623,13 +1022,13 @@ func (s *ConfigurationService) TestConfiguration(config *models.SystemConfigurat
 	test.Results["external_services"] = s.testExternalServices(config)
 
 	// Calculate overall status
-	test.OverallStatus = "passed"
+	test.OverallStatus = models.TestStatusPassed
 	for _, result := range test.Results {
-		if result.Status == "failed" {
-			test.OverallStatus = "failed"
+		if result.Status == models.TestStatusFailed {
+			test.OverallStatus = models.TestStatusFailed
 			break
-		} else if result.Status == "warning" && test.OverallStatus == "passed" {
-			test.OverallStatus = "warning"
+		} else if result.Status == models.TestStatusWarning && test.OverallStatus == models.TestStatusPassed {
+			test.OverallStatus = models.TestStatusWarning
 		}
 	}
 
@@ -708,7 +1107,14 @@ func (s *ConfigurationService) createDefaultConfiguration() *models.SystemConfig
 			Host: "0.0.0.0",
 			Port: 8080,
 			CORS: &models.CORSConfig{
-				AllowedOrigins: []string{"*"},
+				// Public share links are fetched from anywhere; every other
+				// route keeps the built-in origins until the wizard sets them
+				Policies: []models.CORSPolicy{{
+					Name:           "public-shares",
+					PathPrefixes:   []string{"/api/v1/shared"},
+					AllowedOrigins: []string{"*"},
+					AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+				}},
 			},
 		},
 		Authentication: &models.AuthenticationConfig{
@@ -750,6 +1156,10 @@ func (s *ConfigurationService) generateConfiguration(wizardData map[string]inter
 			if s, ok := value.(string); ok {
 				config.Database.Password = s
 			}
+		case "database_ssl_mode":
+			if s, ok := value.(string); ok {
+				config.Database.SSLMode = s
+			}
 		case "media_directory":
 			if s, ok := value.(string); ok {
 				config.Storage.MediaDirectory = s
@@ -762,6 +1172,14 @@ func (s *ConfigurationService) generateConfiguration(wizardData map[string]inter
 			if s, ok := value.(string); ok {
 				config.Storage.TempDirectory = s
 			}
+		case "max_file_size":
+			if mb, ok := value.(float64); ok {
+				config.Storage.MaxFileSize = int64(mb) * 1024 * 1024
+			}
+		case "storage_quota":
+			if gb, ok := value.(float64); ok {
+				config.Storage.StorageQuota = int64(gb) * 1024 * 1024 * 1024
+			}
 		case "server_host":
 			if s, ok := value.(string); ok {
 				config.Network.Host = s
@@ -770,12 +1188,73 @@ func (s *ConfigurationService) generateConfiguration(wizardData map[string]inter
 			if port, ok := value.(float64); ok {
 				config.Network.Port = int(port)
 			}
+		case "cors_origins":
+			if origins, ok := value.(string); ok && origins != "" {
+				config.Network.CORS.AllowedOrigins = nil
+				for _, origin := range strings.Split(origins, ",") {
+					if origin = strings.TrimSpace(origin); origin != "" {
+						config.Network.CORS.AllowedOrigins = append(config.Network.CORS.AllowedOrigins, origin)
+					}
+				}
+				config.Network.CORS.AllowCredentials = true
+			}
 		case "enable_https":
 			if b, ok := value.(bool); ok {
-				config.Network.HTTPS = &models.HTTPSConfig{
-					Enabled: b,
+				s.httpsConfig(config).Enabled = b
+			}
+		case "https_redirect_http":
+			if b, ok := value.(bool); ok {
+				s.httpsConfig(config).RedirectHTTP = b
+			}
+		case "acme_email":
+			if email, ok := value.(string); ok && email != "" {
+				s.acmeConfig(config).Email = email
+			}
+		case "acme_domains":
+			if domains, ok := value.(string); ok && domains != "" {
+				acme := s.acmeConfig(config)
+				for _, domain := range strings.Split(domains, ",") {
+					if domain = strings.TrimSpace(domain); domain != "" {
+						acme.Domains = append(acme.Domains, domain)
+					}
 				}
 			}
+		case "session_timeout":
+			if hours, ok := value.(float64); ok && hours > 0 {
+				config.Authentication.SessionTimeout = time.Duration(hours * float64(time.Hour))
+			}
+		case "enable_registration":
+			if b, ok := value.(bool); ok {
+				config.Authentication.EnableRegistration = b
+			}
+		case "require_email_verification":
+			if b, ok := value.(bool); ok {
+				config.Authentication.RequireEmailVerification = b
+			}
+		case "smtp_host":
+			if host, ok := value.(string); ok && host != "" {
+				s.smtpConfig(config).Host = host
+			}
+		case "smtp_port":
+			if port, ok := value.(float64); ok {
+				s.smtpConfig(config).Port = int(port)
+			}
+		case "smtp_username":
+			if username, ok := value.(string); ok && username != "" {
+				s.smtpConfig(config).Username = username
+			}
+		case "smtp_password":
+			if password, ok := value.(string); ok && password != "" {
+				s.smtpConfig(config).Password = password
+			}
+		case "slack_webhook_url":
+			if webhook, ok := value.(string); ok && webhook != "" {
+				s.externalServicesConfig(config).Slack = &models.SlackConfig{WebhookURL: webhook}
+			}
+		case "enable_analytics":
+			if b, ok := value.(bool); ok {
+				s.externalServicesConfig(config).Analytics = b
+			}
 		}
 	}
 
@@ -783,6 +1262,44 @@ func (s *ConfigurationService) generateConfiguration(wizardData map[string]inter
 	return config
 }
 
+// httpsConfig returns the configuration's HTTPS settings, adding them
+// when missing
+func (s *ConfigurationService) httpsConfig(config *models.SystemConfiguration) *models.HTTPSConfig {
+	if config.Network.HTTPS == nil {
+		config.Network.HTTPS = &models.HTTPSConfig{}
+	}
+	return config.Network.HTTPS
+}
+
+// externalServicesConfig returns the configuration's external services,
+// adding them when missing
+func (s *ConfigurationService) externalServicesConfig(config *models.SystemConfiguration) *models.ExternalServicesConfig {
+	if config.ExternalServices == nil {
+		config.ExternalServices = &models.ExternalServicesConfig{}
+	}
+	return config.ExternalServices
+}
+
+// smtpConfig returns the configuration's SMTP relay, adding it with the
+// submission port when missing
+func (s *ConfigurationService) smtpConfig(config *models.SystemConfiguration) *models.SMTPConfig {
+	external := s.externalServicesConfig(config)
+	if external.SMTP == nil {
+		external.SMTP = &models.SMTPConfig{Port: 587}
+	}
+	return external.SMTP
+}
+
+// acmeConfig returns the configuration's ACME settings, enabling ACME
+// with the HTTP-01 challenge when missing
+func (s *ConfigurationService) acmeConfig(config *models.SystemConfiguration) *models.ACMEConfig {
+	https := s.httpsConfig(config)
+	if https.ACME == nil {
+		https.ACME = &models.ACMEConfig{Enabled: true, Challenge: models.ACMEChallengeHTTP01}
+	}
+	return https.ACME
+}
+
 func (s *ConfigurationService) validateConfiguration(config *models.SystemConfiguration) error {
 	// Basic validation
 	if config.Database == nil {
@@ -811,10 +1328,49 @@ func (s *ConfigurationService) validateConfiguration(config *models.SystemConfig
 	if config.Network.Port <= 0 || config.Network.Port > 65535 {
 		return fmt.Errorf("invalid network port: %d", config.Network.Port)
 	}
+	if https := config.Network.HTTPS; https != nil && https.Enabled {
+		if err := s.validateHTTPSConfiguration(https); err != nil {
+			return err
+		}
+	}
+	if err := middleware.ValidateCORSConfig(config.Network.CORS); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+func (s *ConfigurationService) validateHTTPSConfiguration(https *models.HTTPSConfig) error {
+	if https.Port < 0 || https.Port > 65535 {
+		return fmt.Errorf("invalid https port: %d", https.Port)
+	}
+	if https.RedirectPort < 0 || https.RedirectPort > 65535 {
+		return fmt.Errorf("invalid https redirect port: %d", https.RedirectPort)
+	}
+
+	acme := https.ACME
+	if acme == nil || !acme.Enabled {
+		// Without a certificate pair the server generates a self-signed one
+		if (https.CertPath == "") != (https.KeyPath == "") {
+			return fmt.Errorf("cert_path and key_path must be set together")
+		}
+		return nil
+	}
+	if len(acme.Domains) == 0 {
+		return fmt.Errorf("acme requires at least one domain")
+	}
+	switch acme.Challenge {
+	case "", models.ACMEChallengeHTTP01:
+	case models.ACMEChallengeDNS01:
+		if acme.DNSHook == "" {
+			return fmt.Errorf("the dns-01 challenge requires dns_hook")
+		}
+	default:
+		return fmt.Errorf("unknown acme challenge: %s", acme.Challenge)
+	}
+	return nil
+}
+
 func (s *ConfigurationService) isEmptyValue(value interface{}) bool {
 	if value == nil {
 		return true
@@ -867,6 +1423,9 @@ func (s *ConfigurationService) getNetworkFields() []*models.ConfigField {
 		{Name: "host", Label: "Host", Type: "text", Required: true},
 		{Name: "port", Label: "Port", Type: "number", Required: true},
 		{Name: "enable_https", Label: "Enable HTTPS", Type: "checkbox", Required: false},
+		{Name: "https_redirect_http", Label: "Redirect HTTP to HTTPS", Type: "checkbox", Required: false},
+		{Name: "acme_email", Label: "Let's Encrypt Email", Type: "text", Required: false},
+		{Name: "acme_domains", Label: "Let's Encrypt Domains (comma separated)", Type: "text", Required: false},
 	}
 }
 
@@ -887,14 +1446,37 @@ func (s *ConfigurationService) getFeatureFields() []*models.ConfigField {
 }
 
 func (s *ConfigurationService) testDatabaseConnection(config *models.SystemConfiguration) *models.TestResult {
-	// Simplified test implementation
+	if config.Database == nil {
+		return &models.TestResult{Status: models.TestStatusFailed, Message: "Database configuration is missing"}
+	}
+
+	err := (&DatabaseValidator{}).Validate(map[string]interface{}{
+		"database_type":     config.Database.Type,
+		"database_host":     config.Database.Host,
+		"database_port":     config.Database.Port,
+		"database_name":     config.Database.Name,
+		"database_username": config.Database.Username,
+		"database_password": config.Database.Password,
+		"database_ssl_mode": config.Database.SSLMode,
+	})
+	if err != nil {
+		return &models.TestResult{
+			Status:  models.TestStatusFailed,
+			Message: "Database connection test failed",
+			Details: err.Error(),
+		}
+	}
 	return &models.TestResult{
-		Status:  "passed",
+		Status:  models.TestStatusPassed,
 		Message: "Database connection test passed",
 	}
 }
 
 func (s *ConfigurationService) testStoragePaths(config *models.SystemConfiguration) *models.TestResult {
+	if config.Storage == nil {
+		return &models.TestResult{Status: models.TestStatusFailed, Message: "Storage configuration is missing"}
+	}
+
 	// Test if storage directories are accessible
 	paths := []string{
 		config.Storage.MediaDirectory,
@@ -905,46 +1487,213 @@ func (s *ConfigurationService) testStoragePaths(config *models.SystemConfigurati
 	for _, path := range paths {
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			return &models.TestResult{
-				Status:  "warning",
+				Status:  models.TestStatusWarning,
 				Message: fmt.Sprintf("Directory does not exist: %s", path),
 			}
 		}
 	}
 
 	return &models.TestResult{
-		Status:  "passed",
+		Status:  models.TestStatusPassed,
 		Message: "All storage paths are accessible",
 	}
 }
 
 func (s *ConfigurationService) testNetworkConfiguration(config *models.SystemConfiguration) *models.TestResult {
+	if config.Network == nil {
+		return &models.TestResult{Status: models.TestStatusFailed, Message: "Network configuration is missing"}
+	}
+
 	// Simplified network test
 	if config.Network.Port < 1024 && os.Getuid() != 0 {
 		return &models.TestResult{
-			Status:  "warning",
+			Status:  models.TestStatusWarning,
 			Message: "Port below 1024 requires root privileges",
 		}
 	}
 
+	if https := config.Network.HTTPS; https != nil && https.Enabled && (https.ACME == nil || !https.ACME.Enabled) {
+		for _, path := range []string{https.CertPath, https.KeyPath} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				return &models.TestResult{
+					Status:  models.TestStatusFailed,
+					Message: fmt.Sprintf("HTTPS certificate file is not readable: %s", path),
+					Details: err.Error(),
+				}
+			}
+		}
+	}
+
 	return &models.TestResult{
-		Status:  "passed",
+		Status:  models.TestStatusPassed,
 		Message: "Network configuration is valid",
 	}
 }
 
 func (s *ConfigurationService) testExternalServices(config *models.SystemConfiguration) *models.TestResult {
-	// Test external service connections
+	external := config.ExternalServices
+	if external == nil || (external.SMTP == nil && external.Slack == nil) {
+		return &models.TestResult{
+			Status:  models.TestStatusPassed,
+			Message: "No external services are configured",
+		}
+	}
+
+	if smtp := external.SMTP; smtp != nil && smtp.Host != "" {
+		err := (&SMTPValidator{}).Validate(map[string]interface{}{
+			"smtp_host":     smtp.Host,
+			"smtp_port":     smtp.Port,
+			"smtp_username": smtp.Username,
+			"smtp_password": smtp.Password,
+		})
+		if err != nil {
+			return &models.TestResult{
+				Status:  models.TestStatusFailed,
+				Message: "SMTP relay test failed",
+				Details: err.Error(),
+			}
+		}
+	}
+	// Posting to the Slack webhook would send a message, so only its URL
+	// is checked
+	if slack := external.Slack; slack != nil && slack.WebhookURL != "" {
+		if u, err := url.Parse(slack.WebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return &models.TestResult{
+				Status:  models.TestStatusFailed,
+				Message: "Slack webhook URL must be an https URL",
+			}
+		}
+	}
+
 	return &models.TestResult{
-		Status:  "passed",
+		Status:  models.TestStatusPassed,
 		Message: "External services test passed",
 	}
 }
 
+// cloneConfiguration returns a deep copy of a configuration
+func cloneConfiguration(config *models.SystemConfiguration) *models.SystemConfiguration {
+	data, _ := json.Marshal(config)
+	var clone models.SystemConfiguration
+	json.Unmarshal(data, &clone)
+	return &clone
+}
+
+// overlayConfiguration returns a copy of base with the sections that
+// overlay sets replaced. Masked secrets in overlay keep base's value.
+func overlayConfiguration(base, overlay *models.SystemConfiguration) *models.SystemConfiguration {
+	merged := cloneConfiguration(base)
+	sections := cloneConfiguration(overlay)
+	if sections.Database != nil {
+		merged.Database = sections.Database
+	}
+	if sections.Storage != nil {
+		merged.Storage = sections.Storage
+	}
+	if sections.Network != nil {
+		merged.Network = sections.Network
+	}
+	if sections.Authentication != nil {
+		merged.Authentication = sections.Authentication
+	}
+	if sections.ExternalServices != nil {
+		merged.ExternalServices = sections.ExternalServices
+	}
+	unmaskConfiguration(merged, base)
+	return merged
+}
+
+// configurationSecrets returns the secrets a configuration sets, by name
+func configurationSecrets(config *models.SystemConfiguration) map[string]*string {
+	secrets := make(map[string]*string)
+	if config.Database != nil {
+		secrets["database.password"] = &config.Database.Password
+	}
+	if config.Authentication != nil {
+		secrets["authentication.jwt_secret"] = &config.Authentication.JWTSecret
+	}
+	if config.ExternalServices != nil && config.ExternalServices.SMTP != nil {
+		secrets["external_services.smtp.password"] = &config.ExternalServices.SMTP.Password
+	}
+	return secrets
+}
+
+// maskConfiguration returns a copy of a configuration with non-empty
+// secrets masked
+func maskConfiguration(config *models.SystemConfiguration) *models.SystemConfiguration {
+	masked := cloneConfiguration(config)
+	for _, secret := range configurationSecrets(masked) {
+		if *secret != "" {
+			*secret = setupSecretMask
+		}
+	}
+	return masked
+}
+
+// unmaskConfiguration replaces masked secrets in config with those of
+// saved, clearing those saved does not have
+func unmaskConfiguration(config, saved *models.SystemConfiguration) {
+	savedSecrets := configurationSecrets(saved)
+	for name, secret := range configurationSecrets(config) {
+		if *secret != setupSecretMask {
+			continue
+		}
+		*secret = ""
+		if value, ok := savedSecrets[name]; ok {
+			*secret = *value
+		}
+	}
+}
+
 // Validator implementations
 
+// Validate checks that the database of a database step can be used: that
+// the directory of a SQLite file is writable, or that the PostgreSQL
+// server accepts the credentials. Values other than step answers pass.
 func (v *DatabaseValidator) Validate(value interface{}) error {
-	// Database validation logic
-	return nil
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	switch dbType := wizardString(data, "database_type"); dbType {
+	case "", "sqlite":
+		dir := filepath.Dir(wizardString(data, "database_name"))
+		probe, err := os.CreateTemp(dir, ".catalogizer-setup-*")
+		if err != nil {
+			return fmt.Errorf("database directory %s is not writable: %w", dir, err)
+		}
+		probe.Close()
+		return os.Remove(probe.Name())
+	case "postgresql", "postgres":
+		dsn := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(wizardString(data, "database_username"), wizardString(data, "database_password")),
+			Host:   net.JoinHostPort(wizardString(data, "database_host"), strconv.Itoa(wizardInt(data, "database_port", 5432))),
+			Path:   wizardString(data, "database_name"),
+		}
+		sslMode := wizardString(data, "database_ssl_mode")
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn.RawQuery = url.Values{"sslmode": {sslMode}}.Encode()
+		db, err := sql.Open("postgres", dsn.String())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("cannot connect to PostgreSQL at %s: %w", dsn.Host, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported database type: %s", dbType)
+	}
 }
 
 func (v *NetworkValidator) Validate(value interface{}) error {
@@ -971,3 +1720,72 @@ func (v *EmailValidator) Validate(value interface{}) error {
 	}
 	return nil
 }
+
+// Validate mounts the SMB share of a media source step and lists its
+// root. A step without an SMB host passes.
+func (v *SMBValidator) Validate(value interface{}) error {
+	data, ok := value.(map[string]interface{})
+	if !ok || wizardString(data, "smb_host") == "" {
+		return nil
+	}
+	if wizardString(data, "smb_share") == "" {
+		return fmt.Errorf("share name is required")
+	}
+
+	domain := wizardString(data, "smb_domain")
+	if domain == "" {
+		domain = "WORKGROUP"
+	}
+	client := filesystem.NewSmbClient(&filesystem.SmbConfig{
+		Host:     wizardString(data, "smb_host"),
+		Port:     wizardInt(data, "smb_port", 445),
+		Share:    wizardString(data, "smb_share"),
+		Username: wizardString(data, "smb_username"),
+		Password: wizardString(data, "smb_password"),
+		Domain:   domain,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	return client.TestConnection(ctx)
+}
+
+// Validate connects and signs in to the SMTP relay of an external
+// services step without sending mail. A step without an SMTP host passes.
+func (v *SMTPValidator) Validate(value interface{}) error {
+	data, ok := value.(map[string]interface{})
+	if !ok || wizardString(data, "smtp_host") == "" {
+		return nil
+	}
+
+	sender := internal_services.NewSMTPEmailSender(internal_services.SMTPConfig{
+		Host:     wizardString(data, "smtp_host"),
+		Port:     wizardInt(data, "smtp_port", 587),
+		Username: wizardString(data, "smtp_username"),
+		Password: wizardString(data, "smtp_password"),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	return sender.Verify(ctx)
+}
+
+// wizardString returns a text answer, or "" when missing
+func wizardString(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return strings.TrimSpace(value)
+}
+
+// wizardInt returns a number answer, which JSON decodes as float64, or
+// def when missing
+func wizardInt(data map[string]interface{}, key string, def int) int {
+	switch value := data[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+	return def
+}
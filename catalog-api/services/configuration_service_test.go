@@ -3,9 +3,11 @@ package services
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"catalogizer/models"
+	"catalogizer/repository"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -155,7 +157,9 @@ func TestConfigurationService_CreateDefaultConfiguration(t *testing.T) {
 	assert.Equal(t, "0.0.0.0", config.Network.Host)
 	assert.Equal(t, 8080, config.Network.Port)
 	require.NotNil(t, config.Network.CORS)
-	assert.Equal(t, []string{"*"}, config.Network.CORS.AllowedOrigins)
+	assert.Empty(t, config.Network.CORS.AllowedOrigins)
+	require.Len(t, config.Network.CORS.Policies, 1)
+	assert.Equal(t, []string{"*"}, config.Network.CORS.Policies[0].AllowedOrigins)
 
 	// Authentication defaults
 	require.NotNil(t, config.Authentication)
@@ -275,6 +279,59 @@ func TestConfigurationService_ValidateConfiguration(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "https with self-signed certificate",
+			config: &models.SystemConfiguration{
+				Database: &models.DatabaseConfig{Type: "sqlite"},
+				Storage:  &models.StorageConfig{MediaDirectory: "/media"},
+				Network:  &models.NetworkConfig{Port: 8080, HTTPS: &models.HTTPSConfig{Enabled: true}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "https with half a certificate pair",
+			config: &models.SystemConfiguration{
+				Database: &models.DatabaseConfig{Type: "sqlite"},
+				Storage:  &models.StorageConfig{MediaDirectory: "/media"},
+				Network:  &models.NetworkConfig{Port: 8080, HTTPS: &models.HTTPSConfig{Enabled: true, KeyPath: "/tls/key.pem"}},
+			},
+			wantErr: true,
+			errMsg:  "cert_path and key_path must be set together",
+		},
+		{
+			name: "acme without domains",
+			config: &models.SystemConfiguration{
+				Database: &models.DatabaseConfig{Type: "sqlite"},
+				Storage:  &models.StorageConfig{MediaDirectory: "/media"},
+				Network: &models.NetworkConfig{Port: 8080, HTTPS: &models.HTTPSConfig{
+					Enabled: true, ACME: &models.ACMEConfig{Enabled: true},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "acme requires at least one domain",
+		},
+		{
+			name: "acme dns-01 without hook",
+			config: &models.SystemConfiguration{
+				Database: &models.DatabaseConfig{Type: "sqlite"},
+				Storage:  &models.StorageConfig{MediaDirectory: "/media"},
+				Network: &models.NetworkConfig{Port: 8080, HTTPS: &models.HTTPSConfig{
+					Enabled: true, ACME: &models.ACMEConfig{Enabled: true, Domains: []string{"example.com"}, Challenge: models.ACMEChallengeDNS01},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "the dns-01 challenge requires dns_hook",
+		},
+		{
+			name: "cors wildcard default",
+			config: &models.SystemConfiguration{
+				Database: &models.DatabaseConfig{Type: "sqlite"},
+				Storage:  &models.StorageConfig{MediaDirectory: "/media"},
+				Network:  &models.NetworkConfig{Port: 8080, CORS: &models.CORSConfig{AllowedOrigins: []string{"*"}}},
+			},
+			wantErr: true,
+			errMsg:  "cors: the default policy cannot allow any origin; list its origins or move the routes to a policy",
+		},
 	}
 
 	for _, tt := range tests {
@@ -292,6 +349,136 @@ func TestConfigurationService_ValidateConfiguration(t *testing.T) {
 	}
 }
 
+type recordingCORSReloader struct {
+	configs []*models.CORSConfig
+}
+
+func (r *recordingCORSReloader) Reload(config *models.CORSConfig) error {
+	r.configs = append(r.configs, config)
+	return nil
+}
+
+func TestConfigurationService_UpdateCORSConfiguration(t *testing.T) {
+	db := setupTestDB(t)
+	_, err := db.Exec(`CREATE TABLE system_configuration (
+		id INTEGER PRIMARY KEY, version TEXT, configuration TEXT, created_at DATETIME, updated_at DATETIME)`)
+	require.NoError(t, err)
+
+	svc := &ConfigurationService{
+		configRepo: repository.NewConfigurationRepository(db),
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+	}
+	svc.config = svc.createDefaultConfiguration()
+	reloader := &recordingCORSReloader{}
+	svc.SetCORSReloader(reloader)
+
+	cors := &models.CORSConfig{
+		AllowedOrigins:   []string{"https://media.example.com"},
+		AllowCredentials: true,
+		Policies: []models.CORSPolicy{{
+			Name:           "admin",
+			PathPrefixes:   []string{"/api/v1/admin"},
+			AllowedOrigins: []string{"https://admin.example.com"},
+		}},
+	}
+	config, err := svc.UpdateCORSConfiguration(cors)
+	require.NoError(t, err)
+	assert.Equal(t, cors, config.Network.CORS)
+	assert.Equal(t, 8080, config.Network.Port)
+	assert.Equal(t, []*models.CORSConfig{cors}, reloader.configs)
+
+	saved, err := svc.GetCORSConfiguration()
+	require.NoError(t, err)
+	assert.Equal(t, cors, saved)
+
+	// Invalid policies are neither saved nor applied
+	_, err = svc.UpdateCORSConfiguration(&models.CORSConfig{AllowedOrigins: []string{"*"}})
+	require.Error(t, err)
+	assert.Len(t, reloader.configs, 1)
+	saved, err = svc.GetCORSConfiguration()
+	require.NoError(t, err)
+	assert.Equal(t, cors, saved)
+}
+
+func TestConfigurationService_SectionsBackupsAndTemplates(t *testing.T) {
+	db := setupTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE system_configuration (
+			id INTEGER PRIMARY KEY, version TEXT, configuration TEXT, created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE configuration_backups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, version TEXT NOT NULL, configuration TEXT NOT NULL, created_at DATETIME NOT NULL)`,
+		`CREATE TABLE configuration_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, description TEXT NOT NULL, category TEXT NOT NULL,
+			configuration TEXT NOT NULL, created_at DATETIME NOT NULL)`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	svc := &ConfigurationService{
+		configRepo: repository.NewConfigurationRepository(db),
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+	}
+	svc.config = svc.createDefaultConfiguration()
+	svc.config.Authentication.JWTSecret = "s3cret"
+
+	// Secrets are masked and a masked secret sent back keeps its value
+	section, err := svc.GetConfigurationSection("authentication")
+	require.NoError(t, err)
+	assert.Equal(t, setupSecretMask, section.(*models.AuthenticationConfig).JWTSecret)
+	assert.Equal(t, "s3cret", svc.config.Authentication.JWTSecret)
+
+	updated, err := svc.UpdateConfigurationSection("authentication",
+		[]byte(`{"jwt_secret":"********","session_timeout":3600000000000,"enable_registration":false}`))
+	require.NoError(t, err)
+	assert.Equal(t, setupSecretMask, updated.Authentication.JWTSecret)
+	assert.Equal(t, "s3cret", svc.config.Authentication.JWTSecret)
+	assert.False(t, svc.config.Authentication.EnableRegistration)
+
+	_, err = svc.UpdateConfigurationSection("network", []byte(`{"host":"0.0.0.0","port":70000}`))
+	assert.ErrorContains(t, err, "validation failed")
+	_, err = svc.UpdateConfigurationSection("network", []byte(`{"host":"0.0.0.0","prot":8080}`))
+	assert.ErrorContains(t, err, "invalid configuration section network")
+	_, err = svc.GetConfigurationSection("plugins")
+	assert.ErrorContains(t, err, "invalid configuration section")
+	assert.Equal(t, 8080, svc.config.Network.Port)
+
+	// Restoring a backup backs up the configuration it replaces
+	backup, err := svc.CreateBackup("before port change")
+	require.NoError(t, err)
+	_, err = svc.UpdateConfigurationSection("network", []byte(`{"host":"0.0.0.0","port":9090}`))
+	require.NoError(t, err)
+	restored, err := svc.RestoreBackup(backup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 8080, restored.Network.Port)
+	assert.Equal(t, 8080, svc.config.Network.Port)
+	backups, err := svc.ListBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	_, err = svc.RestoreBackup(99)
+	assert.ErrorContains(t, err, "not found")
+	_, err = svc.CreateBackup("  ")
+	assert.ErrorContains(t, err, "invalid backup name")
+
+	// Templates replace only the sections they set
+	template, err := svc.CreateTemplate(&models.ConfigurationTemplate{
+		Name:          "Large files",
+		Category:      models.ConfigCategoryPerformance,
+		Configuration: &models.SystemConfiguration{Storage: &models.StorageConfig{MediaDirectory: "/srv/media", MaxFileSize: 1 << 40}},
+	})
+	require.NoError(t, err)
+	applied, err := svc.ApplyTemplate(template.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/media", applied.Storage.MediaDirectory)
+	assert.Equal(t, 8080, applied.Network.Port)
+	assert.Equal(t, "s3cret", svc.config.Authentication.JWTSecret)
+	_, err = svc.CreateTemplate(&models.ConfigurationTemplate{Name: "x", Category: "Other", Configuration: &models.SystemConfiguration{}})
+	assert.ErrorContains(t, err, "invalid template category")
+
+	require.NoError(t, svc.DeleteTemplate(template.ID))
+	assert.ErrorContains(t, svc.DeleteTemplate(template.ID), "not found")
+}
+
 func TestConfigurationService_GenerateConfiguration(t *testing.T) {
 	svc := &ConfigurationService{}
 
@@ -357,6 +544,17 @@ func TestConfigurationService_GenerateConfiguration(t *testing.T) {
 				assert.Equal(t, 9090, config.Network.Port)
 			},
 		},
+		{
+			name: "cors origins",
+			wizardData: map[string]interface{}{
+				"cors_origins": "https://media.example.com, https://app.example.com",
+			},
+			checks: func(t *testing.T, config *models.SystemConfiguration) {
+				assert.Equal(t, []string{"https://media.example.com", "https://app.example.com"}, config.Network.CORS.AllowedOrigins)
+				assert.True(t, config.Network.CORS.AllowCredentials)
+				assert.Len(t, config.Network.CORS.Policies, 1)
+			},
+		},
 		{
 			name: "enable HTTPS",
 			wizardData: map[string]interface{}{
@@ -367,6 +565,25 @@ func TestConfigurationService_GenerateConfiguration(t *testing.T) {
 				assert.True(t, config.Network.HTTPS.Enabled)
 			},
 		},
+		{
+			name: "let's encrypt",
+			wizardData: map[string]interface{}{
+				"enable_https":        true,
+				"https_redirect_http": true,
+				"acme_email":          "admin@example.com",
+				"acme_domains":        "media.example.com, www.example.com",
+			},
+			checks: func(t *testing.T, config *models.SystemConfiguration) {
+				require.NotNil(t, config.Network.HTTPS)
+				assert.True(t, config.Network.HTTPS.Enabled)
+				assert.True(t, config.Network.HTTPS.RedirectHTTP)
+				require.NotNil(t, config.Network.HTTPS.ACME)
+				assert.True(t, config.Network.HTTPS.ACME.Enabled)
+				assert.Equal(t, models.ACMEChallengeHTTP01, config.Network.HTTPS.ACME.Challenge)
+				assert.Equal(t, "admin@example.com", config.Network.HTTPS.ACME.Email)
+				assert.Equal(t, []string{"media.example.com", "www.example.com"}, config.Network.HTTPS.ACME.Domains)
+			},
+		},
 		{
 			name: "database username and password",
 			wizardData: map[string]interface{}{
@@ -705,12 +922,20 @@ func TestEmailValidator_Validate(t *testing.T) {
 func TestDatabaseValidator_Validate(t *testing.T) {
 	validator := &DatabaseValidator{}
 
-	// DatabaseValidator currently always returns nil
+	// Values other than step answers pass
 	err := validator.Validate("anything")
 	assert.NoError(t, err)
 
 	err = validator.Validate(nil)
 	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	err = validator.Validate(map[string]interface{}{"database_type": "sqlite", "database_name": filepath.Join(dir, "catalog.db")})
+	assert.NoError(t, err)
+	err = validator.Validate(map[string]interface{}{"database_type": "sqlite", "database_name": filepath.Join(dir, "missing", "catalog.db")})
+	assert.Error(t, err)
+	err = validator.Validate(map[string]interface{}{"database_type": "mysql", "database_name": "catalog"})
+	assert.ErrorContains(t, err, "unsupported database type")
 }
 
 func TestNetworkValidator_Validate(t *testing.T) {
@@ -10,9 +10,11 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"catalogizer/internal/auth"
+	internal_services "catalogizer/internal/services"
 	"catalogizer/models"
 	"catalogizer/repository"
 
@@ -27,21 +29,88 @@ type ConversionService struct {
 	userRepo       *repository.UserRepository
 	authService    *AuthService
 	sem            *semaphore.Weighted // Limits concurrent conversion processes
+	lookPath       func(file string) (string, error)
+	converter      func(ctx context.Context, job *models.ConversionJob) error
+	deps           dependencyChecker
+	events         internal_services.EventPublisher
+	metrics        internal_services.MetricRecorder
+
+	workersMu sync.Mutex
+	workers   *conversionWorkers
+}
+
+// dependencyChecker reports why a dependency is unavailable
+type dependencyChecker interface {
+	Check(name string) error
 }
 
 func NewConversionService(conversionRepo *repository.ConversionRepository, userRepo *repository.UserRepository, authService *AuthService) *ConversionService {
-	return &ConversionService{
+	s := &ConversionService{
 		conversionRepo: conversionRepo,
 		userRepo:       userRepo,
 		authService:    authService,
 		sem:            semaphore.NewWeighted(3), // Max 3 concurrent conversions
+		lookPath:       exec.LookPath,
 	}
+	s.converter = s.convert
+	return s
+}
+
+// SetDependencyChecker makes CreateConversionJob refuse video and audio
+// conversions while ffmpeg is unavailable
+func (s *ConversionService) SetDependencyChecker(deps dependencyChecker) {
+	s.deps = deps
+}
+
+// SetEventPublisher pushes job status changes to the job owner's
+// real-time clients
+func (s *ConversionService) SetEventPublisher(events internal_services.EventPublisher) {
+	s.events = events
+}
+
+// SetMetricRecorder counts failed jobs towards anomaly detection
+func (s *ConversionService) SetMetricRecorder(metrics internal_services.MetricRecorder) {
+	s.metrics = metrics
+}
+
+// publishJobStatus notifies real-time clients of a job's current status
+func (s *ConversionService) publishJobStatus(job *models.ConversionJob) {
+	if s.events == nil {
+		return
+	}
+	userID := job.UserID
+	s.events.Publish(internal_services.HubEvent{
+		Type:    internal_services.EventConversionStatus,
+		Channel: internal_services.EventChannelConversion,
+		UserID:  &userID,
+		Data:    job,
+	})
+}
+
+// publishJobProgress notifies real-time clients of a running job's
+// progress, transfer rate and ETA
+func (s *ConversionService) publishJobProgress(job *models.ConversionJob) {
+	if s.events == nil {
+		return
+	}
+	userID := job.UserID
+	s.events.Publish(internal_services.HubEvent{
+		Type:    internal_services.EventConversionProgress,
+		Channel: internal_services.EventChannelConversion,
+		UserID:  &userID,
+		Data:    models.NewConversionProgress(job, time.Now()),
+	})
 }
 
 func (s *ConversionService) CreateConversionJob(userID int, request *models.ConversionRequest) (*models.ConversionJob, error) {
 	if !s.validateConversionRequest(request) {
 		return nil, fmt.Errorf("invalid conversion request")
 	}
+	if s.deps != nil && (request.ConversionType == models.ConversionTypeVideo || request.ConversionType == models.ConversionTypeAudio) {
+		if err := s.deps.Check("ffmpeg"); err != nil {
+			return nil, err
+		}
+	}
 
 	job := &models.ConversionJob{
 		UserID:         userID,
@@ -64,9 +133,13 @@ func (s *ConversionService) CreateConversionJob(userID int, request *models.Conv
 	}
 
 	job.ID = id
+	s.publishJobStatus(job)
+	s.wakeWorkers()
 	return job, nil
 }
 
+// StartConversion runs a pending job. While the worker pool is running
+// the job is left to it, so it waits for its turn by priority.
 func (s *ConversionService) StartConversion(jobID int) error {
 	job, err := s.conversionRepo.GetJob(jobID)
 	if err != nil {
@@ -76,6 +149,10 @@ func (s *ConversionService) StartConversion(jobID int) error {
 	if job.Status != models.ConversionStatusPending {
 		return fmt.Errorf("job is not in pending status")
 	}
+	if s.activeWorkers() != nil {
+		s.wakeWorkers()
+		return nil
+	}
 
 	job.Status = models.ConversionStatusRunning
 	job.StartedAt = &time.Time{}
@@ -85,41 +162,39 @@ func (s *ConversionService) StartConversion(jobID int) error {
 	if err != nil {
 		return fmt.Errorf("failed to update job status: %w", err)
 	}
+	s.publishJobStatus(job)
 
-	go s.processConversion(job)
+	go s.processConversion(context.Background(), job)
 
 	return nil
 }
 
-func (s *ConversionService) processConversion(job *models.ConversionJob) {
+func (s *ConversionService) processConversion(ctx context.Context, job *models.ConversionJob) {
 	// Limit concurrent conversion processes (ffmpeg, LibreOffice, etc.)
-	if err := s.sem.Acquire(context.Background(), 1); err != nil {
+	if err := s.sem.Acquire(ctx, 1); err != nil {
+		if ctx.Err() != nil {
+			s.handleConversionInterrupted(ctx, job)
+			return
+		}
 		s.handleConversionError(job, fmt.Errorf("failed to acquire conversion semaphore: %w", err))
 		return
 	}
 	defer s.sem.Release(1)
 
-	var err error
-
 	defer func() {
 		if r := recover(); r != nil {
 			s.handleConversionError(job, fmt.Errorf("conversion panic: %v", r))
 		}
 	}()
 
-	switch job.ConversionType {
-	case models.ConversionTypeVideo:
-		err = s.convertVideo(job)
-	case models.ConversionTypeAudio:
-		err = s.convertAudio(job)
-	case models.ConversionTypeDocument:
-		err = s.convertDocument(job)
-	case models.ConversionTypeImage:
-		err = s.convertImage(job)
-	default:
-		err = fmt.Errorf("unsupported conversion type: %s", job.ConversionType)
-	}
+	err := s.converter(ctx, job)
 
+	// A cancelled job stays cancelled even if the converter finished
+	// before noticing
+	if context.Cause(ctx) == errConversionCancelled || (err != nil && ctx.Err() != nil) {
+		s.handleConversionInterrupted(ctx, job)
+		return
+	}
 	if err != nil {
 		s.handleConversionError(job, err)
 		return
@@ -128,14 +203,26 @@ func (s *ConversionService) processConversion(job *models.ConversionJob) {
 	s.handleConversionSuccess(job)
 }
 
-func (s *ConversionService) convertVideo(job *models.ConversionJob) error {
-	args := s.buildFFmpegVideoArgs(job)
+// convert runs the tool for the job's conversion type
+func (s *ConversionService) convert(ctx context.Context, job *models.ConversionJob) error {
+	switch job.ConversionType {
+	case models.ConversionTypeVideo:
+		return s.convertVideo(ctx, job)
+	case models.ConversionTypeAudio:
+		return s.convertAudio(ctx, job)
+	case models.ConversionTypeDocument:
+		return s.convertDocument(ctx, job)
+	case models.ConversionTypeImage:
+		return s.convertImage(ctx, job)
+	default:
+		return fmt.Errorf("unsupported conversion type: %s", job.ConversionType)
+	}
+}
 
-	cmd := exec.Command("ffmpeg", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func (s *ConversionService) convertVideo(ctx context.Context, job *models.ConversionJob) error {
+	args := s.buildFFmpegVideoArgs(job)
 
-	err := cmd.Run()
+	err := s.runFFmpeg(ctx, job, args)
 	if err != nil {
 		return fmt.Errorf("ffmpeg video conversion failed: %w", err)
 	}
@@ -143,14 +230,10 @@ func (s *ConversionService) convertVideo(job *models.ConversionJob) error {
 	return nil
 }
 
-func (s *ConversionService) convertAudio(job *models.ConversionJob) error {
+func (s *ConversionService) convertAudio(ctx context.Context, job *models.ConversionJob) error {
 	args := s.buildFFmpegAudioArgs(job)
 
-	cmd := exec.Command("ffmpeg", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
+	err := s.runFFmpeg(ctx, job, args)
 	if err != nil {
 		return fmt.Errorf("ffmpeg audio conversion failed: %w", err)
 	}
@@ -158,18 +241,18 @@ func (s *ConversionService) convertAudio(job *models.ConversionJob) error {
 	return nil
 }
 
-func (s *ConversionService) convertDocument(job *models.ConversionJob) error {
+func (s *ConversionService) convertDocument(ctx context.Context, job *models.ConversionJob) error {
 	switch {
 	case s.isEbookConversion(job):
-		return s.convertEbook(job)
+		return s.convertEbook(ctx, job)
 	case s.isPDFConversion(job):
-		return s.convertPDF(job)
+		return s.convertPDF(ctx, job)
 	default:
 		return fmt.Errorf("unsupported document conversion")
 	}
 }
 
-func (s *ConversionService) convertEbook(job *models.ConversionJob) error {
+func (s *ConversionService) convertEbook(ctx context.Context, job *models.ConversionJob) error {
 	args := []string{
 		job.SourcePath,
 		job.TargetPath,
@@ -187,7 +270,7 @@ func (s *ConversionService) convertEbook(job *models.ConversionJob) error {
 		}
 	}
 
-	cmd := exec.Command("ebook-convert", args...)
+	cmd := exec.CommandContext(ctx, "ebook-convert", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -199,25 +282,25 @@ func (s *ConversionService) convertEbook(job *models.ConversionJob) error {
 	return nil
 }
 
-func (s *ConversionService) convertPDF(job *models.ConversionJob) error {
+func (s *ConversionService) convertPDF(ctx context.Context, job *models.ConversionJob) error {
 	// Determine target format and use appropriate conversion method
 	ext := strings.ToLower(filepath.Ext(job.TargetPath))
 	targetFormat := strings.TrimPrefix(ext, ".")
 
 	switch targetFormat {
 	case "jpg", "jpeg", "png", "bmp", "tiff", "gif":
-		return s.convertPDFToImage(job, targetFormat)
+		return s.convertPDFToImage(ctx, job, targetFormat)
 	case "txt", "text":
 		return s.convertPDFToText(job)
 	case "html":
-		return s.convertPDFToHTML(job)
+		return s.convertPDFToHTML(ctx, job)
 	default:
 		return fmt.Errorf("unsupported PDF conversion target format: %s", targetFormat)
 	}
 }
 
 // convertPDFToImage converts PDF pages to images using go-fitz library
-func (s *ConversionService) convertPDFToImage(job *models.ConversionJob, format string) error {
+func (s *ConversionService) convertPDFToImage(ctx context.Context, job *models.ConversionJob, format string) error {
 	doc, err := fitz.New(job.SourcePath)
 	if err != nil {
 		return fmt.Errorf("failed to open PDF: %w", err)
@@ -289,7 +372,7 @@ func (s *ConversionService) convertPDFToImage(job *models.ConversionJob, format
 			err = png.Encode(file, img)
 		default:
 			// For other formats, use ImageMagick as fallback
-			return s.convertPDFWithImageMagick(job, format)
+			return s.convertPDFWithImageMagick(ctx, job, format)
 		}
 
 		if err != nil {
@@ -384,7 +467,7 @@ func (s *ConversionService) convertPDFToText(job *models.ConversionJob) error {
 }
 
 // convertPDFToHTML converts PDF to HTML using external tools
-func (s *ConversionService) convertPDFToHTML(job *models.ConversionJob) error {
+func (s *ConversionService) convertPDFToHTML(ctx context.Context, job *models.ConversionJob) error {
 	// Try pandoc first for HTML conversion
 	args := []string{
 		"-f", "pdf",
@@ -393,7 +476,7 @@ func (s *ConversionService) convertPDFToHTML(job *models.ConversionJob) error {
 		job.SourcePath,
 	}
 
-	cmd := exec.Command("pandoc", args...)
+	cmd := exec.CommandContext(ctx, "pandoc", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -410,7 +493,7 @@ func (s *ConversionService) convertPDFToHTML(job *models.ConversionJob) error {
 		job.SourcePath,
 	}
 
-	cmd = exec.Command("libreoffice", args...)
+	cmd = exec.CommandContext(ctx, "libreoffice", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -470,7 +553,7 @@ func (s *ConversionService) convertPDFToHTML(job *models.ConversionJob) error {
 }
 
 // convertPDFWithImageMagick converts PDF to image formats not directly supported by go-fitz
-func (s *ConversionService) convertPDFWithImageMagick(job *models.ConversionJob, format string) error {
+func (s *ConversionService) convertPDFWithImageMagick(ctx context.Context, job *models.ConversionJob, format string) error {
 	args := []string{
 		"-density", "150", // DPI
 		job.SourcePath,
@@ -491,7 +574,7 @@ func (s *ConversionService) convertPDFWithImageMagick(job *models.ConversionJob,
 
 	args = append(args, job.TargetPath)
 
-	cmd := exec.Command("convert", args...)
+	cmd := exec.CommandContext(ctx, "convert", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -503,10 +586,10 @@ func (s *ConversionService) convertPDFWithImageMagick(job *models.ConversionJob,
 	return nil
 }
 
-func (s *ConversionService) convertImage(job *models.ConversionJob) error {
+func (s *ConversionService) convertImage(ctx context.Context, job *models.ConversionJob) error {
 	args := s.buildImageMagickArgs(job)
 
-	cmd := exec.Command("convert", args...)
+	cmd := exec.CommandContext(ctx, "convert", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -591,6 +674,49 @@ func (s *ConversionService) buildFFmpegAudioArgs(job *models.ConversionJob) []st
 	return args
 }
 
+// HLSPlaylistName is the playlist TranscodeHLS writes next to its segments
+const HLSPlaylistName = "index.m3u8"
+
+// TranscodeHLS transcodes a media file into H.264/AAC HLS segments in
+// outputDir, for players that cannot decode the source format. It writes
+// an event playlist that grows as segments finish, so playback can start
+// before transcoding does; baseURL prefixes the segment URIs in it.
+func (s *ConversionService) TranscodeHLS(ctx context.Context, sourcePath, outputDir, baseURL string) error {
+	if s.deps != nil {
+		if err := s.deps.Check("ffmpeg"); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create HLS output directory: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", s.buildHLSArgs(sourcePath, outputDir, baseURL)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg HLS transcoding failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ConversionService) buildHLSArgs(sourcePath, outputDir, baseURL string) []string {
+	return []string{
+		"-i", sourcePath,
+		"-y",
+		"-map", "0:v:0?", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "160k", "-ac", "2",
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "event",
+		"-hls_base_url", baseURL,
+		"-hls_segment_filename", filepath.Join(outputDir, "segment_%05d.ts"),
+		filepath.Join(outputDir, HLSPlaylistName),
+	}
+}
+
 func (s *ConversionService) buildImageMagickArgs(job *models.ConversionJob) []string {
 	args := []string{job.SourcePath}
 
@@ -615,6 +741,7 @@ func (s *ConversionService) buildImageMagickArgs(job *models.ConversionJob) []st
 
 func (s *ConversionService) handleConversionSuccess(job *models.ConversionJob) {
 	job.Status = models.ConversionStatusCompleted
+	job.Progress = 1
 	job.CompletedAt = &time.Time{}
 	*job.CompletedAt = time.Now()
 
@@ -627,6 +754,7 @@ func (s *ConversionService) handleConversionSuccess(job *models.ConversionJob) {
 	if err != nil {
 		fmt.Printf("Failed to update completed job %d: %v\n", job.ID, err)
 	}
+	s.publishJobStatus(job)
 
 	s.notifyUser(job, "Conversion completed successfully")
 }
@@ -647,6 +775,10 @@ func (s *ConversionService) handleConversionError(job *models.ConversionJob, con
 	if err != nil {
 		fmt.Printf("Failed to update failed job %d: %v\n", job.ID, err)
 	}
+	s.publishJobStatus(job)
+	if s.metrics != nil {
+		s.metrics.Record(internal_services.AnomalyMetricConversionFailures, 1)
+	}
 
 	s.notifyUser(job, fmt.Sprintf("Conversion failed: %s", conversionError.Error()))
 }
@@ -660,14 +792,14 @@ func (s *ConversionService) GetUserJobs(userID int, status *string, limit, offse
 	return s.conversionRepo.GetUserJobs(userID, status, limit, offset)
 }
 
-func (s *ConversionService) GetJob(jobID int, userID int) (*models.ConversionJob, error) {
+func (s *ConversionService) GetJob(jobID int, user *models.User) (*models.ConversionJob, error) {
 	job, err := s.conversionRepo.GetJob(jobID)
 	if err != nil {
 		return nil, err
 	}
 
-	if job.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, auth.PermissionViewMedia)
+	if job.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, auth.PermissionViewMedia)
 		if err != nil || !hasPermission {
 			return nil, fmt.Errorf("unauthorized to view this job")
 		}
@@ -676,14 +808,14 @@ func (s *ConversionService) GetJob(jobID int, userID int) (*models.ConversionJob
 	return job, nil
 }
 
-func (s *ConversionService) CancelJob(jobID int, userID int) error {
+func (s *ConversionService) CancelJob(jobID int, user *models.User) error {
 	job, err := s.conversionRepo.GetJob(jobID)
 	if err != nil {
 		return err
 	}
 
-	if job.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, auth.PermissionManageUsers)
+	if job.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, auth.PermissionManageUsers)
 		if err != nil || !hasPermission {
 			return fmt.Errorf("unauthorized to cancel this job")
 		}
@@ -697,17 +829,22 @@ func (s *ConversionService) CancelJob(jobID int, userID int) error {
 	job.CompletedAt = &time.Time{}
 	*job.CompletedAt = time.Now()
 
-	return s.conversionRepo.UpdateJob(job)
+	if err := s.conversionRepo.UpdateJob(job); err != nil {
+		return err
+	}
+	s.cancelRunning(jobID)
+	s.publishJobStatus(job)
+	return nil
 }
 
-func (s *ConversionService) RetryJob(jobID int, userID int) error {
+func (s *ConversionService) RetryJob(jobID int, user *models.User) error {
 	job, err := s.conversionRepo.GetJob(jobID)
 	if err != nil {
 		return err
 	}
 
-	if job.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, auth.PermissionManageUsers)
+	if job.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, auth.PermissionManageUsers)
 		if err != nil || !hasPermission {
 			return fmt.Errorf("unauthorized to retry this job")
 		}
@@ -722,6 +859,8 @@ func (s *ConversionService) RetryJob(jobID int, userID int) error {
 	job.CompletedAt = nil
 	job.Duration = nil
 	job.ErrorMessage = nil
+	job.Progress = 0
+	job.TransferRate = 0
 
 	err = s.conversionRepo.UpdateJob(job)
 	if err != nil {
@@ -760,6 +899,56 @@ func (s *ConversionService) GetSupportedFormats() *models.SupportedFormats {
 	}
 }
 
+// conversionTools lists the programs conversions depend on
+var conversionTools = []models.ConversionTool{
+	{Name: "FFmpeg", Binary: "ffmpeg", Conversions: []string{models.ConversionTypeVideo, models.ConversionTypeAudio}},
+	{Name: "ImageMagick", Binary: "convert", Conversions: []string{models.ConversionTypeImage, "pdf_to_image"}},
+	{Name: "Calibre", Binary: "ebook-convert", Conversions: []string{"ebook"}},
+	{Name: "Pandoc", Binary: "pandoc", Conversions: []string{"pdf_to_html"}},
+	{Name: "LibreOffice", Binary: "libreoffice", Conversions: []string{"pdf_to_html"}},
+}
+
+// ProbeTools reports which conversion programs are installed
+func (s *ConversionService) ProbeTools() []models.ConversionTool {
+	tools := make([]models.ConversionTool, len(conversionTools))
+	for i, tool := range conversionTools {
+		_, err := s.lookPath(tool.Binary)
+		tool.Available = err == nil
+		tools[i] = tool
+	}
+	return tools
+}
+
+// AvailableFormats returns the supported formats that the installed
+// programs can actually convert. PDF to text and images is built in.
+func (s *ConversionService) AvailableFormats() *models.SupportedFormats {
+	installed := make(map[string]bool)
+	for _, tool := range s.ProbeTools() {
+		installed[tool.Binary] = tool.Available
+	}
+	supported := s.GetSupportedFormats()
+	available := &models.SupportedFormats{
+		Video:    models.VideoFormats{Input: []string{}, Output: []string{}},
+		Audio:    models.AudioFormats{Input: []string{}, Output: []string{}},
+		Document: models.DocumentFormats{Input: []string{"pdf"}, Output: []string{"txt"}},
+		Image:    models.ImageFormats{Input: []string{}, Output: []string{}},
+	}
+	if installed["ffmpeg"] {
+		available.Video = supported.Video
+		available.Audio = supported.Audio
+	}
+	if installed["convert"] {
+		available.Image = supported.Image
+	}
+	switch {
+	case installed["ebook-convert"]:
+		available.Document = supported.Document
+	case installed["pandoc"] || installed["libreoffice"]:
+		available.Document.Output = append(available.Document.Output, "html")
+	}
+	return available
+}
+
 func (s *ConversionService) validateConversionRequest(request *models.ConversionRequest) bool {
 	if request.SourcePath == "" || request.TargetPath == "" {
 		return false
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,6 +34,40 @@ func TestConversionService_GetSupportedFormats(t *testing.T) {
 	assert.Greater(t, len(formats.Image.Input), 0)
 }
 
+func TestConversionService_AvailableFormats(t *testing.T) {
+	service := NewConversionService(nil, nil, nil)
+	installed := map[string]bool{}
+	service.lookPath = func(file string) (string, error) {
+		if installed[file] {
+			return "/usr/bin/" + file, nil
+		}
+		return "", fmt.Errorf("%s not found", file)
+	}
+
+	// Only the built-in PDF conversions without any tools
+	formats := service.AvailableFormats()
+	assert.Empty(t, formats.Video.Output)
+	assert.Empty(t, formats.Audio.Output)
+	assert.Empty(t, formats.Image.Output)
+	assert.Equal(t, []string{"pdf"}, formats.Document.Input)
+	assert.Equal(t, []string{"txt"}, formats.Document.Output)
+	for _, tool := range service.ProbeTools() {
+		assert.False(t, tool.Available, tool.Binary)
+	}
+
+	installed["ffmpeg"] = true
+	installed["pandoc"] = true
+	formats = service.AvailableFormats()
+	assert.Equal(t, service.GetSupportedFormats().Video, formats.Video)
+	assert.Equal(t, service.GetSupportedFormats().Audio, formats.Audio)
+	assert.Empty(t, formats.Image.Output)
+	assert.Equal(t, []string{"txt", "html"}, formats.Document.Output)
+
+	installed["convert"] = true
+	installed["ebook-convert"] = true
+	assert.Equal(t, service.GetSupportedFormats(), service.AvailableFormats())
+}
+
 func TestConversionService_ValidateConversionRequest(t *testing.T) {
 	service := NewConversionService(nil, nil, nil)
 
@@ -641,6 +677,20 @@ func TestConversionService_BuildImageMagickArgs(t *testing.T) {
 	}
 }
 
+func TestConversionService_BuildHLSArgs(t *testing.T) {
+	service := NewConversionService(nil, nil, nil)
+
+	args := service.buildHLSArgs("/media/film.mkv", "/cache/hls/7", "hls/")
+	joined := strings.Join(args, " ")
+	assert.Equal(t, []string{"-i", "/media/film.mkv"}, args[:2])
+	assert.Contains(t, joined, "-c:v libx264")
+	assert.Contains(t, joined, "-c:a aac")
+	assert.Contains(t, joined, "-hls_playlist_type event")
+	assert.Contains(t, joined, "-hls_base_url hls/")
+	assert.Contains(t, joined, "-hls_segment_filename /cache/hls/7/segment_%05d.ts")
+	assert.Equal(t, "/cache/hls/7/"+HLSPlaylistName, args[len(args)-1])
+}
+
 func TestConversionService_IsEbookConversion(t *testing.T) {
 	service := NewConversionService(nil, nil, nil)
 
@@ -710,7 +760,7 @@ func TestConversionService_ConvertDocument_EbookRoute(t *testing.T) {
 		TargetFormat: "mobi",
 	}
 
-	err := service.convertDocument(job)
+	err := service.convertDocument(context.Background(), job)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "ebook conversion failed")
 }
@@ -728,7 +778,7 @@ func TestConversionService_ConvertDocument_PDFRoute(t *testing.T) {
 		TargetFormat: "jpg",
 	}
 
-	err := service.convertDocument(job)
+	err := service.convertDocument(context.Background(), job)
 	assert.Error(t, err)
 	// This goes to convertPDFToImage which uses go-fitz, and will fail opening nonexistent file
 	assert.Contains(t, err.Error(), "failed to open PDF")
@@ -746,7 +796,7 @@ func TestConversionService_ConvertDocument_UnsupportedRoute(t *testing.T) {
 		TargetFormat: "odt",
 	}
 
-	err := service.convertDocument(job)
+	err := service.convertDocument(context.Background(), job)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unsupported document conversion")
 }
@@ -767,7 +817,7 @@ func TestConversionService_ConvertPDF_UnsupportedTarget(t *testing.T) {
 		TargetFormat: "xyz",
 	}
 
-	err := service.convertPDF(job)
+	err := service.convertPDF(context.Background(), job)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unsupported PDF conversion target format")
 }
@@ -782,7 +832,7 @@ func TestConversionService_ConvertPDF_TextRoute(t *testing.T) {
 		TargetFormat: "txt",
 	}
 
-	err := service.convertPDF(job)
+	err := service.convertPDF(context.Background(), job)
 	assert.Error(t, err)
 	// Goes through convertPDFToText which opens file
 	assert.Contains(t, err.Error(), "failed to open PDF")
@@ -798,7 +848,7 @@ func TestConversionService_ConvertPDF_HTMLRoute(t *testing.T) {
 		TargetFormat: "html",
 	}
 
-	err := service.convertPDF(job)
+	err := service.convertPDF(context.Background(), job)
 	// convertPDFToHTML tries pandoc, then libreoffice, then text fallback.
 	// All will fail but it may return an error from the text conversion fallback.
 	assert.Error(t, err)
@@ -824,7 +874,7 @@ func TestConversionService_ProcessConversion_VideoDispatch(t *testing.T) {
 	// tries to use conversionRepo (nil), it will panic, but processConversion
 	// has a recover() that also calls handleConversionError, creating a double panic.
 	// We test this through direct convertVideo call instead.
-	err := service.convertVideo(job)
+	err := service.convertVideo(context.Background(), job)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "ffmpeg video conversion failed")
 }
@@ -840,7 +890,7 @@ func TestConversionService_ProcessConversion_AudioDispatch(t *testing.T) {
 		Quality:        "medium",
 	}
 
-	err := service.convertAudio(job)
+	err := service.convertAudio(context.Background(), job)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "ffmpeg audio conversion failed")
 }
@@ -854,7 +904,7 @@ func TestConversionService_ProcessConversion_ImageDispatch(t *testing.T) {
 		TargetPath:     "/nonexistent/image.jpg",
 	}
 
-	err := service.convertImage(job)
+	err := service.convertImage(context.Background(), job)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "imagemagick conversion failed")
 }
@@ -870,7 +920,7 @@ func TestConversionService_ProcessConversion_DocumentDispatch(t *testing.T) {
 		TargetFormat:   "mobi",
 	}
 
-	err := service.convertDocument(job)
+	err := service.convertDocument(context.Background(), job)
 	assert.Error(t, err)
 }
 
@@ -913,7 +963,7 @@ func TestConversionService_ConvertEbook_WithSettings(t *testing.T) {
 				Settings:     tt.settings,
 			}
 
-			err := service.convertEbook(job)
+			err := service.convertEbook(context.Background(), job)
 			// All fail because ebook-convert is not installed
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "ebook conversion failed")
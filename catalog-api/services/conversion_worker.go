@@ -0,0 +1,427 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogizer/models"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ConversionWorkerConfig configures the conversion worker pool
+type ConversionWorkerConfig struct {
+	// Workers is the number of jobs run at once across all users
+	Workers int
+	// PollInterval is how often the queue is checked for scheduled jobs
+	// that became due; new and cancelled jobs wake the pool immediately
+	PollInterval time.Duration
+}
+
+// defaultUserConversionJobs applies when a user's settings do not set
+// MaxConcurrentJobs
+const defaultUserConversionJobs = 3
+
+// conversionProgressInterval is the minimum time between persisted
+// progress updates of one job
+const conversionProgressInterval = 2 * time.Second
+
+var (
+	errConversionCancelled = errors.New("conversion cancelled")
+	errConversionShutdown  = errors.New("conversion workers stopped")
+)
+
+// conversionWorkers is the state of a running worker pool
+type conversionWorkers struct {
+	config ConversionWorkerConfig
+	wake   chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[int]*runningConversion
+	stopped bool
+}
+
+// runningConversion is a job a worker is processing
+type runningConversion struct {
+	userID int
+	cancel context.CancelCauseFunc
+}
+
+// StartWorkers starts the worker pool, which runs pending jobs highest
+// priority first while keeping each user within the MaxConcurrentJobs of
+// their conversion settings. Jobs left running by a previous process are
+// queued again first.
+func (s *ConversionService) StartWorkers(config ConversionWorkerConfig) {
+	if config.Workers <= 0 {
+		config.Workers = 3
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+
+	s.workersMu.Lock()
+	if s.workers != nil {
+		s.workersMu.Unlock()
+		return
+	}
+	// Jobs run through processConversion, whose semaphore must let
+	// every worker run
+	s.sem = semaphore.NewWeighted(int64(config.Workers))
+	w := &conversionWorkers{
+		config:  config,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		running: make(map[int]*runningConversion),
+	}
+	s.workers = w
+	s.workersMu.Unlock()
+
+	if n, err := s.conversionRepo.RequeueRunningJobs(); err != nil {
+		fmt.Printf("Failed to requeue interrupted conversion jobs: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Requeued %d interrupted conversion jobs\n", n)
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(config.PollInterval)
+		defer ticker.Stop()
+		for {
+			s.dispatch(w)
+			select {
+			case <-w.stop:
+				return
+			case <-w.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopWorkers stops taking jobs, interrupts the running ones and waits
+// for them to exit. Interrupted jobs go back to the queue.
+func (s *ConversionService) StopWorkers() {
+	s.workersMu.Lock()
+	w := s.workers
+	s.workers = nil
+	s.workersMu.Unlock()
+	if w == nil {
+		return
+	}
+
+	close(w.stop)
+	w.mu.Lock()
+	w.stopped = true
+	for _, run := range w.running {
+		run.cancel(errConversionShutdown)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+// activeWorkers returns the running worker pool, or nil
+func (s *ConversionService) activeWorkers() *conversionWorkers {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+	return s.workers
+}
+
+// wakeWorkers makes the pool check the queue now
+func (s *ConversionService) wakeWorkers() {
+	if w := s.activeWorkers(); w != nil {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// cancelRunning interrupts a job a worker is processing. It reports
+// whether the job was running.
+func (s *ConversionService) cancelRunning(jobID int) bool {
+	w := s.activeWorkers()
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	run, ok := w.running[jobID]
+	if ok {
+		run.cancel(errConversionCancelled)
+	}
+	return ok
+}
+
+// dispatch claims as many runnable jobs as there are free workers,
+// skipping users already at their concurrency limit
+func (s *ConversionService) dispatch(w *conversionWorkers) {
+	w.mu.Lock()
+	free := w.config.Workers - len(w.running)
+	perUser := make(map[int]int)
+	for _, run := range w.running {
+		perUser[run.userID]++
+	}
+	w.mu.Unlock()
+	if free <= 0 {
+		return
+	}
+
+	jobs, err := s.conversionRepo.GetRunnableJobs(time.Now(), 100)
+	if err != nil {
+		fmt.Printf("Failed to read conversion queue: %v\n", err)
+		return
+	}
+
+	limits := make(map[int]int)
+	for i := range jobs {
+		if free == 0 {
+			return
+		}
+		job := jobs[i]
+		limit, ok := limits[job.UserID]
+		if !ok {
+			limit = s.userJobLimit(job.UserID)
+			limits[job.UserID] = limit
+		}
+		if perUser[job.UserID] >= limit {
+			continue
+		}
+
+		startedAt := time.Now()
+		claimed, err := s.conversionRepo.ClaimJob(job.ID, startedAt)
+		if err != nil {
+			fmt.Printf("Failed to claim conversion job %d: %v\n", job.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		job.Status = models.ConversionStatusRunning
+		job.StartedAt = &startedAt
+		job.Progress = 0
+		job.TransferRate = 0
+
+		perUser[job.UserID]++
+		free--
+		s.runJob(w, &job)
+	}
+}
+
+// runJob processes a claimed job on its own goroutine
+func (s *ConversionService) runJob(w *conversionWorkers, job *models.ConversionJob) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	w.mu.Lock()
+	w.running[job.ID] = &runningConversion{userID: job.UserID, cancel: cancel}
+	if w.stopped {
+		// Claimed while stopping; it goes straight back to the queue
+		cancel(errConversionShutdown)
+	}
+	w.mu.Unlock()
+	s.publishJobStatus(job)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() {
+			cancel(nil)
+			w.mu.Lock()
+			delete(w.running, job.ID)
+			w.mu.Unlock()
+			select {
+			case w.wake <- struct{}{}:
+			default:
+			}
+		}()
+		s.processConversion(ctx, job)
+	}()
+}
+
+// userJobLimit returns how many of a user's jobs may run at once
+func (s *ConversionService) userJobLimit(userID int) int {
+	if s.userRepo == nil {
+		return defaultUserConversionJobs
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil || user.Settings == "" {
+		return defaultUserConversionJobs
+	}
+	settings := models.GetDefaultSettings()
+	if err := json.Unmarshal([]byte(user.Settings), &settings); err != nil {
+		return defaultUserConversionJobs
+	}
+	if settings.ConversionSettings.MaxConcurrentJobs <= 0 {
+		return defaultUserConversionJobs
+	}
+	return settings.ConversionSettings.MaxConcurrentJobs
+}
+
+// handleConversionInterrupted records a job whose context was cancelled:
+// a cancelled job keeps the status CancelJob gave it, and a job stopped
+// by shutdown returns to the queue.
+func (s *ConversionService) handleConversionInterrupted(ctx context.Context, job *models.ConversionJob) {
+	if context.Cause(ctx) == errConversionCancelled {
+		s.notifyUser(job, "Conversion cancelled")
+		return
+	}
+
+	job.Status = models.ConversionStatusPending
+	job.StartedAt = nil
+	job.Progress = 0
+	job.TransferRate = 0
+	if err := s.conversionRepo.UpdateJob(job); err != nil {
+		fmt.Printf("Failed to requeue interrupted job %d: %v\n", job.ID, err)
+	}
+	s.publishJobStatus(job)
+}
+
+// reportProgress persists and publishes a job's progress and the bytes
+// per second its output is written at, at most every
+// conversionProgressInterval
+func (s *ConversionService) reportProgress(job *models.ConversionJob, progress, transferRate float64, last *time.Time) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	now := time.Now()
+	if now.Sub(*last) < conversionProgressInterval {
+		return
+	}
+	*last = now
+
+	job.Progress = progress
+	job.TransferRate = transferRate
+	if s.conversionRepo != nil {
+		if err := s.conversionRepo.UpdateProgress(job.ID, progress, transferRate); err != nil {
+			fmt.Printf("Failed to update progress of job %d: %v\n", job.ID, err)
+		}
+	}
+	s.publishJobProgress(job)
+}
+
+// runFFmpeg runs ffmpeg with progress reporting. ffmpeg writes blocks of
+// key=value progress to stdout, each ended by a progress= line; the input
+// duration it logs to stderr turns the position into a fraction.
+func (s *ConversionService) runFFmpeg(ctx context.Context, job *models.ConversionJob, args []string) error {
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	start := time.Now()
+
+	var mu sync.Mutex
+	var total time.Duration
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(io.TeeReader(stderr, os.Stderr))
+		for scanner.Scan() {
+			if d, ok := parseFFmpegDuration(scanner.Text()); ok {
+				mu.Lock()
+				if total == 0 {
+					total = d
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	var last time.Time
+	var position time.Duration
+	var written int64
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := parseFFmpegProgress(line); ok {
+			position = p
+			continue
+		}
+		if n, ok := parseFFmpegTotalSize(line); ok {
+			written = n
+			continue
+		}
+		if !strings.HasPrefix(line, "progress=") {
+			continue
+		}
+		mu.Lock()
+		d := total
+		mu.Unlock()
+		if d > 0 {
+			var rate float64
+			if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+				rate = float64(written) / elapsed
+			}
+			s.reportProgress(job, float64(position)/float64(d), rate, &last)
+		}
+	}
+	<-done
+
+	return cmd.Wait()
+}
+
+var ffmpegDurationPattern = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// parseFFmpegDuration reads the input duration from an ffmpeg log line
+func parseFFmpegDuration(line string) (time.Duration, bool) {
+	m := ffmpegDurationPattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)), true
+}
+
+// parseFFmpegProgress reads the output position from an ffmpeg -progress
+// line. out_time_ms is in microseconds despite its name.
+func parseFFmpegProgress(line string) (time.Duration, bool) {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok || (key != "out_time_us" && key != "out_time_ms") {
+		return 0, false
+	}
+	us, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || us < 0 {
+		return 0, false
+	}
+	return time.Duration(us) * time.Microsecond, true
+}
+
+// parseFFmpegTotalSize reads the bytes written so far from an ffmpeg
+// -progress line
+func parseFFmpegTotalSize(line string) (int64, bool) {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok || key != "total_size" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWorkerTestService(t *testing.T) (*ConversionService, *repository.ConversionRepository) {
+	t.Helper()
+	db := setupTestDB(t)
+	_, err := db.Exec(`INSERT INTO users (id, username, email, password_hash, salt, settings) VALUES
+		(1, 'alice', 'alice@example.com', 'hash', 'salt', '{"conversion":{"max_concurrent_jobs":1}}'),
+		(2, 'bob', 'bob@example.com', 'hash', 'salt', '{}')`)
+	require.NoError(t, err)
+
+	conversionRepo := repository.NewConversionRepository(db)
+	return NewConversionService(conversionRepo, repository.NewUserRepository(db), nil), conversionRepo
+}
+
+func createWorkerTestJob(t *testing.T, repo *repository.ConversionRepository, userID, priority int) int {
+	t.Helper()
+	id, err := repo.CreateJob(&models.ConversionJob{
+		UserID:         userID,
+		SourcePath:     "/media/in.avi",
+		TargetPath:     "/media/out.mp4",
+		SourceFormat:   "avi",
+		TargetFormat:   "mp4",
+		ConversionType: models.ConversionTypeVideo,
+		Quality:        "medium",
+		Priority:       priority,
+		Status:         models.ConversionStatusPending,
+		CreatedAt:      time.Now(),
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func waitForJobStatus(t *testing.T, repo *repository.ConversionRepository, jobID int, status string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		job, err := repo.GetJob(jobID)
+		return err == nil && job.Status == status
+	}, 5*time.Second, 10*time.Millisecond, "job %d never reached %s", jobID, status)
+}
+
+func TestConversionWorkers_PrioritiesLimitsAndCancel(t *testing.T) {
+	service, repo := newWorkerTestService(t)
+
+	service.converter = func(ctx context.Context, job *models.ConversionJob) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	aliceLow := createWorkerTestJob(t, repo, 1, 1)
+	aliceHigh := createWorkerTestJob(t, repo, 1, 10)
+	bob := createWorkerTestJob(t, repo, 2, 0)
+
+	service.StartWorkers(ConversionWorkerConfig{Workers: 3, PollInterval: time.Hour})
+	defer service.StopWorkers()
+
+	// Alice may run one job at a time, so her low priority job waits
+	// even though a worker is free
+	waitForJobStatus(t, repo, aliceHigh, models.ConversionStatusRunning)
+	waitForJobStatus(t, repo, bob, models.ConversionStatusRunning)
+	job, err := repo.GetJob(aliceLow)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConversionStatusPending, job.Status)
+
+	// Cancelling mid-run stops the conversion and frees Alice's slot
+	require.NoError(t, service.CancelJob(aliceHigh, &models.User{ID: 1}))
+	waitForJobStatus(t, repo, aliceLow, models.ConversionStatusRunning)
+	job, err = repo.GetJob(aliceHigh)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConversionStatusCancelled, job.Status)
+
+	// Stopping requeues the jobs still running
+	service.StopWorkers()
+	for _, id := range []int{aliceLow, bob} {
+		job, err := repo.GetJob(id)
+		require.NoError(t, err)
+		assert.Equal(t, models.ConversionStatusPending, job.Status)
+		assert.Nil(t, job.StartedAt)
+	}
+}
+
+func TestConversionWorkers_RecordsOutcome(t *testing.T) {
+	service, repo := newWorkerTestService(t)
+	service.converter = func(ctx context.Context, job *models.ConversionJob) error {
+		if job.Priority > 0 {
+			return assert.AnError
+		}
+		return nil
+	}
+
+	ok := createWorkerTestJob(t, repo, 2, 0)
+	failed := createWorkerTestJob(t, repo, 2, 1)
+
+	service.StartWorkers(ConversionWorkerConfig{PollInterval: time.Hour})
+	defer service.StopWorkers()
+
+	waitForJobStatus(t, repo, ok, models.ConversionStatusCompleted)
+	waitForJobStatus(t, repo, failed, models.ConversionStatusFailed)
+	job, err := repo.GetJob(ok)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, job.Progress)
+}
+
+func TestConversionService_ReportProgress(t *testing.T) {
+	service, repo := newWorkerTestService(t)
+	id := createWorkerTestJob(t, repo, 2, 0)
+	job, err := repo.GetJob(id)
+	require.NoError(t, err)
+
+	var last time.Time
+	service.reportProgress(job, 0.5, 4096, &last)
+	// Updates within conversionProgressInterval are dropped
+	service.reportProgress(job, 0.75, 8192, &last)
+
+	stored, err := repo.GetJob(id)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, stored.Progress)
+	assert.Equal(t, 4096.0, stored.TransferRate)
+}
+
+func TestParseFFmpegProgress(t *testing.T) {
+	d, ok := parseFFmpegDuration("  Duration: 01:02:03.50, start: 0.000000, bitrate: 1205 kb/s")
+	require.True(t, ok)
+	assert.Equal(t, time.Hour+2*time.Minute+3500*time.Millisecond, d)
+	_, ok = parseFFmpegDuration("Stream #0:0: Video: h264")
+	assert.False(t, ok)
+
+	position, ok := parseFFmpegProgress("out_time_us=1500000")
+	require.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, position)
+	_, ok = parseFFmpegProgress("out_time_us=N/A")
+	assert.False(t, ok)
+	_, ok = parseFFmpegProgress("progress=continue")
+	assert.False(t, ok)
+
+	size, ok := parseFFmpegTotalSize("total_size=1048576")
+	require.True(t, ok)
+	assert.Equal(t, int64(1048576), size)
+	_, ok = parseFFmpegTotalSize("total_size=N/A")
+	assert.False(t, ok)
+}
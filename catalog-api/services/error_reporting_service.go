@@ -74,6 +74,23 @@ func (s *ErrorReportingService) ReportError(userID int, errorReport *models.Erro
 		}
 	}
 
+	return s.fileErrorReport(userID, errorReport, s.config.AutoReporting)
+}
+
+// ReportAlert files a report raised by the server itself, such as a
+// security alert, and always sends it to the Slack and email channels.
+// Unlike ReportError it is not rate limited, so a flood of reports from
+// clients cannot hold an alert back.
+func (s *ErrorReportingService) ReportAlert(alert *models.ErrorReportRequest) (*models.ErrorReport, error) {
+	if !s.enabled {
+		return nil, fmt.Errorf("error reporting is disabled")
+	}
+	return s.fileErrorReport(0, alert, true)
+}
+
+// fileErrorReport saves a report and passes it on to the notification
+// channels when notify is set, and to external services.
+func (s *ErrorReportingService) fileErrorReport(userID int, errorReport *models.ErrorReportRequest, notify bool) (*models.ErrorReport, error) {
 	// Create error report
 	report := &models.ErrorReport{
 		UserID:     userID,
@@ -108,7 +125,7 @@ func (s *ErrorReportingService) ReportError(userID int, errorReport *models.Erro
 	}
 
 	// Send notifications asynchronously
-	if s.config.AutoReporting {
+	if notify {
 		go s.sendNotifications(report)
 	}
 
@@ -28,6 +28,9 @@ func (s *FavoritesService) AddFavorite(userID int, favorite *models.Favorite) (*
 	if s.favoritesRepo == nil {
 		return nil, fmt.Errorf("favorites repository not configured")
 	}
+	if favorite.EntityType == "" || favorite.EntityID <= 0 {
+		return nil, fmt.Errorf("invalid favorite: entity_type and entity_id are required")
+	}
 	existing, err := s.favoritesRepo.GetFavorite(userID, favorite.EntityType, favorite.EntityID)
 	if err == nil && existing != nil {
 		return existing, fmt.Errorf("item already in favorites")
@@ -53,6 +56,9 @@ func (s *FavoritesService) RemoveFavorite(userID int, entityType string, entityI
 	if err != nil {
 		return fmt.Errorf("favorite not found: %w", err)
 	}
+	if favorite == nil {
+		return fmt.Errorf("favorite not found")
+	}
 
 	if favorite.UserID != userID {
 		return fmt.Errorf("unauthorized to remove this favorite")
@@ -126,6 +132,33 @@ func (s *FavoritesService) UpdateFavorite(userID int, favoriteID int, updates *m
 	return favorite, nil
 }
 
+// GetFavorite returns one of the user's favorites by its ID.
+func (s *FavoritesService) GetFavorite(userID int, favoriteID int) (*models.Favorite, error) {
+	if s.favoritesRepo == nil {
+		return nil, fmt.Errorf("favorites repository not configured")
+	}
+	favorite, err := s.favoritesRepo.GetFavoriteByID(favoriteID)
+	if err != nil || favorite == nil || favorite.UserID != userID {
+		return nil, fmt.Errorf("favorite not found")
+	}
+	return favorite, nil
+}
+
+// RestoreFavoriteTags adds removed tags back to one of the user's
+// favorites, keeping the tags it was given since.
+func (s *FavoritesService) RestoreFavoriteTags(userID int, favoriteID int, tags []string) (*models.Favorite, error) {
+	favorite, err := s.GetFavorite(userID, favoriteID)
+	if err != nil {
+		return nil, err
+	}
+	var merged []string
+	if favorite.Tags != nil {
+		merged = append(merged, *favorite.Tags...)
+	}
+	merged = s.removeDuplicateStrings(append(merged, tags...))
+	return s.UpdateFavorite(userID, favoriteID, &models.UpdateFavoriteRequest{Tags: &merged})
+}
+
 func (s *FavoritesService) GetFavoriteCategories(userID int, entityType *string) ([]models.FavoriteCategory, error) {
 	if s.favoritesRepo == nil {
 		return nil, fmt.Errorf("favorites repository not configured")
@@ -137,6 +170,18 @@ func (s *FavoritesService) CreateFavoriteCategory(userID int, category *models.F
 	if s.favoritesRepo == nil {
 		return nil, fmt.Errorf("favorites repository not configured")
 	}
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return nil, fmt.Errorf("invalid category: name is required")
+	}
+	existing, err := s.favoritesRepo.GetFavoriteCategoryByName(userID, category.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check category name: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("category already exists")
+	}
+
 	category.UserID = userID
 	category.CreatedAt = time.Now()
 
@@ -162,8 +207,18 @@ func (s *FavoritesService) UpdateFavoriteCategory(userID int, categoryID int, up
 		return nil, fmt.Errorf("unauthorized to update this category")
 	}
 
-	if updates.Name != "" {
-		category.Name = updates.Name
+	// Favorites refer to their category by name, so a rename carries them
+	// along.
+	oldName := category.Name
+	if name := strings.TrimSpace(updates.Name); name != "" && name != oldName {
+		existing, err := s.favoritesRepo.GetFavoriteCategoryByName(userID, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check category name: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("category already exists")
+		}
+		category.Name = name
 	}
 
 	if updates.Description != nil {
@@ -189,6 +244,11 @@ func (s *FavoritesService) UpdateFavoriteCategory(userID int, categoryID int, up
 	if err != nil {
 		return nil, fmt.Errorf("failed to update category: %w", err)
 	}
+	if category.Name != oldName {
+		if err := s.favoritesRepo.RenameFavoritesCategory(userID, oldName, category.Name); err != nil {
+			return nil, fmt.Errorf("failed to rename category on favorites: %w", err)
+		}
+	}
 
 	return category, nil
 }
@@ -323,6 +383,15 @@ func (s *FavoritesService) ShareFavorite(userID int, favoriteID int, shareWith [
 		return nil, fmt.Errorf("unauthorized to share this favorite")
 	}
 
+	if len(shareWith) == 0 {
+		return nil, fmt.Errorf("invalid share: no users given")
+	}
+	for _, id := range shareWith {
+		if id <= 0 || id == userID {
+			return nil, fmt.Errorf("invalid share: cannot share with user %d", id)
+		}
+	}
+
 	share := &models.FavoriteShare{
 		FavoriteID:   favoriteID,
 		SharedByUser: userID,
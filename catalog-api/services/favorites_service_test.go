@@ -1,12 +1,16 @@
 package services
 
 import (
+	"database/sql"
 	"testing"
 	"time"
 
+	"catalogizer/database"
 	"catalogizer/models"
+	"catalogizer/repository"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewFavoritesService(t *testing.T) {
@@ -534,3 +538,138 @@ func TestFavoritesService_ExportFavoritesToCSV_WithAllFields(t *testing.T) {
 	assert.Contains(t, string(data), "action")
 	assert.Contains(t, string(data), "Great movie")
 }
+
+// ---------------------------------------------------------------------------
+// Repository-backed tests
+// ---------------------------------------------------------------------------
+
+func newFavoritesTestService(t *testing.T) *FavoritesService {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	_, err = sqlDB.Exec(`
+		CREATE TABLE favorites (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			entity_type TEXT NOT NULL,
+			entity_id INTEGER NOT NULL,
+			category TEXT, notes TEXT, tags TEXT,
+			is_public BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME,
+			UNIQUE(user_id, entity_type, entity_id)
+		);
+		CREATE TABLE favorite_categories (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT, color TEXT, icon TEXT, entity_type TEXT,
+			is_public BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME
+		);
+		CREATE TABLE favorite_shares (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			favorite_id INTEGER NOT NULL,
+			shared_by_user INTEGER NOT NULL,
+			shared_with TEXT NOT NULL,
+			permissions TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE
+		)`)
+	require.NoError(t, err)
+
+	db := database.WrapDB(sqlDB, database.DialectSQLite)
+	return NewFavoritesService(repository.NewFavoritesRepository(db), nil)
+}
+
+func TestFavoritesService_AddAndRemove(t *testing.T) {
+	service := newFavoritesTestService(t)
+
+	fav, err := service.AddFavorite(1, &models.Favorite{EntityType: "movie", EntityID: 10})
+	require.NoError(t, err)
+	assert.NotZero(t, fav.ID)
+
+	_, err = service.AddFavorite(1, &models.Favorite{EntityType: "movie", EntityID: 10})
+	assert.ErrorContains(t, err, "already in favorites")
+	_, err = service.AddFavorite(1, &models.Favorite{EntityType: "movie"})
+	assert.ErrorContains(t, err, "invalid favorite")
+
+	added, err := service.BulkAddFavorites(1, []models.BulkFavoriteRequest{
+		{EntityType: "movie", EntityID: 10},
+		{EntityType: "music", EntityID: 20},
+	})
+	require.NoError(t, err)
+	assert.Len(t, added, 1)
+
+	require.NoError(t, service.RemoveFavorite(1, "movie", 10))
+	assert.ErrorContains(t, service.RemoveFavorite(1, "movie", 10), "favorite not found")
+
+	stats, err := service.GetFavoriteStatistics(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.TotalFavorites)
+	assert.Equal(t, map[string]int{"music": 1}, stats.FavoritesByEntityType)
+}
+
+func TestFavoritesService_CategoryRename(t *testing.T) {
+	service := newFavoritesTestService(t)
+
+	cat, err := service.CreateFavoriteCategory(1, &models.FavoriteCategory{Name: " watch "})
+	require.NoError(t, err)
+	assert.Equal(t, "watch", cat.Name)
+	_, err = service.CreateFavoriteCategory(1, &models.FavoriteCategory{Name: "watch"})
+	assert.ErrorContains(t, err, "category already exists")
+	_, err = service.CreateFavoriteCategory(1, &models.FavoriteCategory{Name: "later"})
+	require.NoError(t, err)
+
+	category := "watch"
+	_, err = service.AddFavorite(1, &models.Favorite{EntityType: "movie", EntityID: 10, Category: &category})
+	require.NoError(t, err)
+
+	_, err = service.UpdateFavoriteCategory(1, cat.ID, &models.UpdateFavoriteCategoryRequest{Name: "later"})
+	assert.ErrorContains(t, err, "category already exists")
+	_, err = service.UpdateFavoriteCategory(2, cat.ID, &models.UpdateFavoriteCategoryRequest{Name: "cinema"})
+	assert.ErrorContains(t, err, "unauthorized")
+
+	cat, err = service.UpdateFavoriteCategory(1, cat.ID, &models.UpdateFavoriteCategoryRequest{Name: "cinema"})
+	require.NoError(t, err)
+	assert.Equal(t, "cinema", cat.Name)
+
+	renamed := "cinema"
+	favs, err := service.GetUserFavorites(1, nil, &renamed, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, favs, 1)
+
+	assert.ErrorContains(t, service.DeleteFavoriteCategory(1, cat.ID), "cannot delete category")
+}
+
+func TestFavoritesService_Sharing(t *testing.T) {
+	service := newFavoritesTestService(t)
+
+	fav, err := service.AddFavorite(1, &models.Favorite{EntityType: "movie", EntityID: 10})
+	require.NoError(t, err)
+
+	_, err = service.ShareFavorite(1, fav.ID, nil, models.SharePermissions{CanView: true})
+	assert.ErrorContains(t, err, "invalid share")
+	_, err = service.ShareFavorite(1, fav.ID, []int{1}, models.SharePermissions{CanView: true})
+	assert.ErrorContains(t, err, "invalid share")
+	_, err = service.ShareFavorite(2, fav.ID, []int{3}, models.SharePermissions{CanView: true})
+	assert.ErrorContains(t, err, "unauthorized")
+
+	share, err := service.ShareFavorite(1, fav.ID, []int{2, 3}, models.SharePermissions{CanView: true})
+	require.NoError(t, err)
+
+	shared, err := service.GetSharedFavorites(3, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, shared, 1)
+	assert.Equal(t, fav.ID, shared[0].ID)
+
+	assert.ErrorContains(t, service.RevokeFavoriteShare(2, share.ID), "unauthorized")
+	require.NoError(t, service.RevokeFavoriteShare(1, share.ID))
+	shared, err = service.GetSharedFavorites(3, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, shared)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// This file holds the LDAP operations the directory backend needs:
+// simple binds, StartTLS, subtree searches and unbinds. The protocol
+// itself is go-ldap's.
+
+// ldapConn is a connection to an LDAP server. Each operation is bounded
+// by the connection's timeout.
+type ldapConn struct {
+	conn    *ldap.Conn
+	timeout time.Duration
+}
+
+// dialLDAP connects to an ldap:// or ldaps:// URL, upgrading ldap://
+// connections with StartTLS when startTLS is set
+func dialLDAP(ctx context.Context, rawURL string, startTLS bool, tlsConfig *tls.Config, timeout time.Duration) (*ldapConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap url: %w", err)
+	}
+	host, port := u.Hostname(), u.Port()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+
+	// go-ldap's dialers take no context, so the connection is opened here
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	default:
+		return nil, fmt.Errorf("invalid ldap url: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ldapConn{conn: ldap.NewConn(conn, u.Scheme == "ldaps"), timeout: timeout}
+	c.conn.SetTimeout(timeout)
+	c.conn.Start()
+	if startTLS && u.Scheme == "ldap" {
+		if err := c.conn.StartTLS(tlsConfig); err != nil {
+			c.conn.Close()
+			return nil, fmt.Errorf("ldap: StartTLS failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// bind authenticates the connection with a simple bind. An empty password
+// is refused: servers treat it as an unauthenticated bind, which succeeds
+// without checking anything.
+func (c *ldapConn) bind(dn, password string) error {
+	return c.conn.Bind(dn, password)
+}
+
+// search runs a subtree search under baseDN, returning at most sizeLimit
+// entries with the given attributes. Referrals are not followed.
+func (c *ldapConn) search(baseDN, filter string, attributes []string, sizeLimit int) ([]*ldap.Entry, error) {
+	result, err := c.conn.Search(ldap.NewSearchRequest(baseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, sizeLimit, int(c.timeout/time.Second), false,
+		filter, attributes, nil))
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// close unbinds and closes the connection
+func (c *ldapConn) close() error {
+	if err := c.conn.Unbind(); err != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
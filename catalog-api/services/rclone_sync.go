@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+)
+
+// rcloneStatsInterval is how often rclone reports transfer statistics.
+const rcloneStatsInterval = "1s"
+
+// rcloneWindowCheckInterval is how often a scheduled rclone run checks
+// whether its schedule window has closed.
+var rcloneWindowCheckInterval = 30 * time.Second
+
+// rcloneLogLine is one line of rclone's --use-json-log output. Periodic
+// statistics carry a "stats" object; per-file events carry "object".
+type rcloneLogLine struct {
+	Level  string       `json:"level"`
+	Msg    string       `json:"msg"`
+	Object string       `json:"object"`
+	Stats  *rcloneStats `json:"stats"`
+}
+
+type rcloneStats struct {
+	Bytes          int64   `json:"bytes"`
+	TotalBytes     int64   `json:"totalBytes"`
+	Transfers      int     `json:"transfers"`
+	TotalTransfers int     `json:"totalTransfers"`
+	Checks         int     `json:"checks"`
+	Errors         int     `json:"errors"`
+	Speed          float64 `json:"speed"`
+	ETA            *int64  `json:"eta"`
+	Transferring   []struct {
+		Name string `json:"name"`
+	} `json:"transferring"`
+}
+
+// SetRcloneBinary overrides the rclone executable used by rclone endpoints.
+func (s *SyncService) SetRcloneBinary(binary string) {
+	s.rcloneBinary = binary
+}
+
+func (s *SyncService) rcloneCommand(ctx context.Context, args ...string) *exec.Cmd {
+	binary := s.rcloneBinary
+	if binary == "" {
+		binary = "rclone"
+	}
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// rcloneRemote returns the "remote:path" target of an rclone endpoint. The
+// endpoint URL names the remote (optionally with a base path) and RemotePath
+// is appended to it.
+func rcloneRemote(endpoint *models.SyncEndpoint) (string, error) {
+	if !strings.Contains(endpoint.URL, ":") {
+		return "", fmt.Errorf("rclone endpoint URL must be a remote such as \"gdrive:\" or \"gdrive:backups\"")
+	}
+	target := endpoint.URL
+	if rel := strings.Trim(endpoint.RemotePath, "/"); rel != "" {
+		if !strings.HasSuffix(target, ":") && !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+		target += rel
+	}
+	return target, nil
+}
+
+// rcloneFilterArgs translates the endpoint's sync options into rclone
+// filter, size and bandwidth flags so rclone skips the same files the
+// built-in engines do.
+func rcloneFilterArgs(opts *models.SyncEndpointOptions) []string {
+	args := []string{
+		"--filter", "- .*",
+		"--filter", "- .*/**",
+		"--filter", "- *.tmp",
+		"--filter", "- *.temp",
+	}
+	if opts == nil {
+		return args
+	}
+	for _, p := range opts.ExcludePatterns {
+		args = append(args, "--filter", "- "+p)
+	}
+	if len(opts.IncludePatterns) > 0 {
+		for _, p := range opts.IncludePatterns {
+			args = append(args, "--filter", "+ "+p)
+		}
+		args = append(args, "--filter", "- **")
+	}
+	if opts.MaxFileSize > 0 {
+		args = append(args, "--max-size", fmt.Sprintf("%dB", opts.MaxFileSize))
+	}
+	if opts.BandwidthLimitKBps > 0 {
+		args = append(args, "--bwlimit", fmt.Sprintf("%dK", opts.BandwidthLimitKBps))
+	}
+	return args
+}
+
+// rcloneSyncArgs builds the rclone command line for an endpoint. Upload and
+// download use "copy", or "sync" when sync_mode is "mirror" so extraneous
+// destination files are deleted; bidirectional endpoints use "bisync",
+// which needs --resync on its first run.
+func rcloneSyncArgs(session *models.SyncSession, endpoint *models.SyncEndpoint) ([]string, error) {
+	remote, err := rcloneRemote(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]interface{})
+	if endpoint.SyncSettings != nil {
+		if err := json.Unmarshal([]byte(*endpoint.SyncSettings), &settings); err != nil {
+			return nil, fmt.Errorf("failed to parse rclone sync config: %w", err)
+		}
+	}
+	command := "copy"
+	if mode, _ := settings["sync_mode"].(string); mode == "mirror" {
+		command = "sync"
+	}
+
+	var args []string
+	switch endpoint.SyncDirection {
+	case models.SyncDirectionUpload:
+		args = []string{command, endpoint.LocalPath, remote}
+	case models.SyncDirectionDownload:
+		args = []string{command, remote, endpoint.LocalPath}
+	case models.SyncDirectionBidirectional:
+		args = []string{"bisync", endpoint.LocalPath, remote}
+		if endpoint.LastSyncAt == nil {
+			args = append(args, "--resync")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sync direction: %s", endpoint.SyncDirection)
+	}
+
+	if configFile, _ := settings["rclone_config"].(string); configFile != "" {
+		args = append(args, "--config", configFile)
+	}
+	args = append(args, rcloneFilterArgs(session.Options)...)
+	args = append(args,
+		"--use-json-log",
+		"--verbose",
+		"--stats", rcloneStatsInterval,
+		"--stats-log-level", "NOTICE",
+	)
+	return args, nil
+}
+
+// performRcloneSync runs rclone for the endpoint, publishing its periodic
+// statistics as the session's live progress.
+func (s *SyncService) performRcloneSync(session *models.SyncSession, endpoint *models.SyncEndpoint) error {
+	args, err := rcloneSyncArgs(session, endpoint)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := s.rcloneCommand(ctx, args...)
+	// Interrupt rather than kill so rclone can finish in-flight transfers
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 30 * time.Second
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start rclone: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start rclone: %w", err)
+	}
+
+	s.setProgress(&models.SyncProgress{SessionID: session.ID, UpdatedAt: time.Now()})
+	defer s.clearProgress(session.ID)
+
+	windowClosed := make(chan struct{})
+	if session.SyncType == models.SyncTypeScheduled {
+		go func() {
+			ticker := time.NewTicker(rcloneWindowCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if s.windowClosed(session) {
+						close(windowClosed)
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	last, lastError := s.consumeRcloneLog(session, stderr)
+	waitErr := cmd.Wait()
+
+	if last != nil {
+		session.TotalFiles = last.TotalTransfers
+		session.SyncedFiles = last.Transfers
+		session.FailedFiles = last.Errors
+	}
+
+	select {
+	case <-windowClosed:
+		if last != nil && last.TotalTransfers > last.Transfers {
+			for i := last.Transfers; i < last.TotalTransfers; i++ {
+				recordSkip(session, models.SyncSkipOutsideWindow)
+			}
+			session.TotalFiles = last.Transfers
+		}
+		return nil
+	default:
+	}
+
+	if waitErr != nil {
+		if lastError != "" {
+			return fmt.Errorf("rclone %s failed: %s", args[0], lastError)
+		}
+		return fmt.Errorf("rclone %s failed: %w", args[0], waitErr)
+	}
+	return nil
+}
+
+// consumeRcloneLog reads rclone's JSON log until EOF, updating live
+// progress from stats lines and logging per-file errors. It returns the
+// last statistics seen and the last error message.
+func (s *SyncService) consumeRcloneLog(session *models.SyncSession, r io.Reader) (*rcloneStats, string) {
+	var last *rcloneStats
+	var lastError string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line, ok := parseRcloneLogLine(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if line.Stats != nil {
+			last = line.Stats
+			s.setProgress(line.Stats.progress(session.ID))
+			continue
+		}
+		if line.Level == "error" || line.Level == "critical" {
+			lastError = line.Msg
+			if line.Object != "" {
+				lastError = line.Object + ": " + line.Msg
+			}
+			s.logSyncError(session, line.Object, lastError)
+		}
+	}
+	return last, lastError
+}
+
+// parseRcloneLogLine decodes one JSON log line. Non-JSON output (such as
+// panics or messages printed before logging is configured) is ignored.
+func parseRcloneLogLine(data []byte) (*rcloneLogLine, bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil, false
+	}
+	var line rcloneLogLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, false
+	}
+	return &line, true
+}
+
+func (st *rcloneStats) progress(sessionID int) *models.SyncProgress {
+	p := &models.SyncProgress{
+		SessionID:        sessionID,
+		BytesTransferred: st.Bytes,
+		TotalBytes:       st.TotalBytes,
+		FilesTransferred: st.Transfers,
+		TotalFiles:       st.TotalTransfers,
+		Checks:           st.Checks,
+		Errors:           st.Errors,
+		SpeedBytesPerSec: st.Speed,
+		ETASeconds:       st.ETA,
+		UpdatedAt:        time.Now(),
+	}
+	for _, t := range st.Transferring {
+		p.CurrentFiles = append(p.CurrentFiles, t.Name)
+	}
+	return p
+}
+
+func (s *SyncService) testRcloneConnection(endpoint *models.SyncEndpoint) error {
+	remote, err := rcloneRemote(endpoint)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out, err := s.rcloneCommand(ctx, "lsjson", "--max-depth", "1", "--dirs-only", remote).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rclone remote %s is not reachable: %w: %s", remote, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s *SyncService) setProgress(p *models.SyncProgress) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	s.progress[p.SessionID] = p
+}
+
+func (s *SyncService) clearProgress(sessionID int) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	delete(s.progress, sessionID)
+}
+
+// GetSessionProgress returns the live transfer progress of a session. Once
+// the transfer engine has finished, progress is derived from the session's
+// recorded counters.
+func (s *SyncService) GetSessionProgress(sessionID int, user *models.User) (*models.SyncProgress, error) {
+	session, err := s.GetSession(sessionID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	s.progressMu.Lock()
+	live, ok := s.progress[sessionID]
+	s.progressMu.Unlock()
+	if ok {
+		progress := *live
+		return &progress, nil
+	}
+
+	progress := &models.SyncProgress{
+		SessionID:        session.ID,
+		FilesTransferred: session.SyncedFiles,
+		TotalFiles:       session.TotalFiles,
+		Errors:           session.FailedFiles,
+		UpdatedAt:        session.StartedAt,
+	}
+	if session.CompletedAt != nil {
+		progress.UpdatedAt = *session.CompletedAt
+	}
+	return progress, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRcloneRemote(t *testing.T) {
+	target, err := rcloneRemote(&models.SyncEndpoint{URL: "gdrive:", RemotePath: "/media/"})
+	require.NoError(t, err)
+	assert.Equal(t, "gdrive:media", target)
+
+	target, err = rcloneRemote(&models.SyncEndpoint{URL: "b2:bucket", RemotePath: "photos"})
+	require.NoError(t, err)
+	assert.Equal(t, "b2:bucket/photos", target)
+
+	_, err = rcloneRemote(&models.SyncEndpoint{URL: "gdrive"})
+	assert.Error(t, err)
+}
+
+func TestRcloneSyncArgs(t *testing.T) {
+	settings := `{"sync_mode":"mirror","rclone_config":"/etc/rclone.conf"}`
+	endpoint := &models.SyncEndpoint{
+		URL: "remote:backup", LocalPath: "/data", SyncDirection: models.SyncDirectionUpload, SyncSettings: &settings,
+	}
+	session := &models.SyncSession{Options: &models.SyncEndpointOptions{
+		IncludePatterns:    []string{"*.mkv"},
+		ExcludePatterns:    []string{"*sample*"},
+		MaxFileSize:        1024,
+		BandwidthLimitKBps: 256,
+	}}
+
+	args, err := rcloneSyncArgs(session, endpoint)
+	require.NoError(t, err)
+	joined := strings.Join(args, " ")
+	assert.Equal(t, []string{"sync", "/data", "remote:backup"}, args[:3])
+	assert.Contains(t, joined, "--config /etc/rclone.conf")
+	assert.Contains(t, joined, "--filter - *sample* --filter + *.mkv --filter - **")
+	assert.Contains(t, joined, "--max-size 1024B")
+	assert.Contains(t, joined, "--bwlimit 256K")
+	assert.Contains(t, joined, "--use-json-log")
+
+	endpoint.SyncSettings = nil
+	endpoint.SyncDirection = models.SyncDirectionDownload
+	args, err = rcloneSyncArgs(&models.SyncSession{}, endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"copy", "remote:backup", "/data"}, args[:3])
+
+	endpoint.SyncDirection = models.SyncDirectionBidirectional
+	args, err = rcloneSyncArgs(&models.SyncSession{}, endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bisync", "/data", "remote:backup", "--resync"}, args[:4])
+
+	now := time.Now()
+	endpoint.LastSyncAt = &now
+	args, err = rcloneSyncArgs(&models.SyncSession{}, endpoint)
+	require.NoError(t, err)
+	assert.NotContains(t, args, "--resync")
+}
+
+func TestParseRcloneLogLine(t *testing.T) {
+	line, ok := parseRcloneLogLine([]byte(`{"level":"notice","msg":"stats","stats":{"bytes":512,"totalBytes":2048,"transfers":1,"totalTransfers":4,"errors":0,"speed":256.5,"eta":6,"transferring":[{"name":"a.mkv"}]}}`))
+	require.True(t, ok)
+	require.NotNil(t, line.Stats)
+
+	p := line.Stats.progress(7)
+	assert.Equal(t, 7, p.SessionID)
+	assert.Equal(t, int64(512), p.BytesTransferred)
+	assert.Equal(t, int64(2048), p.TotalBytes)
+	assert.Equal(t, 4, p.TotalFiles)
+	assert.Equal(t, []string{"a.mkv"}, p.CurrentFiles)
+	require.NotNil(t, p.ETASeconds)
+	assert.Equal(t, int64(6), *p.ETASeconds)
+
+	line, ok = parseRcloneLogLine([]byte(`{"level":"error","msg":"Failed to copy: permission denied","object":"b.mkv"}`))
+	require.True(t, ok)
+	assert.Equal(t, "b.mkv", line.Object)
+
+	_, ok = parseRcloneLogLine([]byte("2026/10/16 NOTICE: plain text"))
+	assert.False(t, ok)
+}
+
+func TestSyncService_PerformRcloneSync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake rclone script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "rclone")
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+echo '{"level":"info","msg":"Copied (new)","object":"a.mkv"}' >&2
+echo '{"level":"error","msg":"Failed to copy: quota exceeded","object":"b.mkv"}' >&2
+echo '{"level":"notice","msg":"stats","stats":{"bytes":100,"totalBytes":200,"transfers":1,"totalTransfers":2,"errors":1}}' >&2
+exit ${RCLONE_FAKE_EXIT:-0}
+`
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+
+	service := NewSyncService(nil, nil, nil)
+	service.SetRcloneBinary(binary)
+	endpoint := &models.SyncEndpoint{URL: "remote:", LocalPath: dir, SyncDirection: models.SyncDirectionUpload}
+
+	session := &models.SyncSession{ID: 3, SyncType: models.SyncTypeManual}
+	require.NoError(t, service.performRcloneSync(session, endpoint))
+	assert.Equal(t, 2, session.TotalFiles)
+	assert.Equal(t, 1, session.SyncedFiles)
+	assert.Equal(t, 1, session.FailedFiles)
+	assert.Empty(t, service.progress)
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "copy "+dir+" remote:")
+
+	t.Setenv("RCLONE_FAKE_EXIT", "1")
+	err = service.performRcloneSync(&models.SyncSession{ID: 4}, endpoint)
+	assert.ErrorContains(t, err, "b.mkv: Failed to copy: quota exceeded")
+}
@@ -3,8 +3,11 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -48,6 +51,46 @@ func TestErrorReportingService_ReportError_Integration(t *testing.T) {
 	assert.NotNil(t, report.SystemInfo)
 }
 
+func TestErrorReportingService_ReportAlert_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	// The migrated error_reports has no foreign key, for reports from no user
+	_, err := db.Exec("PRAGMA foreign_keys = OFF")
+	require.NoError(t, err)
+	service := NewErrorReportingService(repository.NewErrorReportingRepository(db), repository.NewCrashReportingRepository(db))
+	slack := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&message)
+		slack <- message.Text
+	}))
+	defer server.Close()
+	service.config.SlackWebhookURL = server.URL
+	service.config.EmailNotifications = false
+	service.config.AutoReporting = false
+	service.config.MaxErrorsPerHour = 1
+
+	_, err = service.ReportError(0, &models.ErrorReportRequest{Level: "warning", Message: "CSP violation", ErrorCode: "csp_violation"})
+	require.NoError(t, err)
+	_, err = service.ReportError(0, &models.ErrorReportRequest{Level: "warning", Message: "CSP violation", ErrorCode: "csp_violation"})
+	require.Error(t, err)
+
+	// Alerts are neither rate limited nor held back by auto reporting
+	report, err := service.ReportAlert(&models.ErrorReportRequest{
+		Level: models.ErrorLevelFatal, Message: "Storage root nas locked down",
+		ErrorCode: "share_lockdown", Component: "ransomware_detector",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.UserID)
+	select {
+	case text := <-slack:
+		assert.Contains(t, text, "nas locked down")
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert was not sent to Slack")
+	}
+}
+
 func TestErrorReportingService_ReportError_WithSensitiveDataFiltering(t *testing.T) {
 	db := setupTestDB(t)
 	errorRepo := repository.NewErrorReportingRepository(db)
@@ -1072,7 +1115,7 @@ func TestConversionService_GetJob_NotFound(t *testing.T) {
 	conversionRepo := repository.NewConversionRepository(db)
 	service := NewConversionService(conversionRepo, nil, nil)
 
-	_, err := service.GetJob(999, 1)
+	_, err := service.GetJob(999, &models.User{ID: 1})
 	assert.Error(t, err)
 }
 
@@ -1095,7 +1138,7 @@ func TestSyncService_GetEndpoint_NotFound(t *testing.T) {
 	syncRepo := repository.NewSyncRepository(db)
 	service := NewSyncService(syncRepo, nil, nil)
 
-	_, err := service.GetEndpoint(999, 1)
+	_, err := service.GetEndpoint(999, &models.User{ID: 1})
 	assert.Error(t, err)
 }
 
@@ -1637,7 +1680,7 @@ func TestConversionService_CreateAndGetJob_Integration(t *testing.T) {
 	require.NoError(t, err)
 
 	// Get it back (no authService means nil check will fail for other users)
-	job, err := service.GetJob(created.ID, 1)
+	job, err := service.GetJob(created.ID, &models.User{ID: 1})
 	require.NoError(t, err)
 	require.NotNil(t, job)
 	assert.Equal(t, created.ID, job.ID)
@@ -2289,6 +2332,91 @@ func TestAuthService_CheckAccountLockout_Integration(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestAuthService_Lockout_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	incidents := repository.NewSecurityIncidentRepository(db)
+	authService := NewAuthService(userRepo, "test-secret-key-12345")
+	authService.SetLockoutPolicy(LockoutPolicy{Attempts: 3, Duration: time.Minute, MaxDuration: time.Hour})
+	authService.SetSecurityIncidents(incidents)
+
+	user := setupAuthUser(t, userRepo, "testuser", "Password1!")
+	wrong := models.LoginRequest{Username: "testuser", Password: "Wrong1!"}
+	right := models.LoginRequest{Username: "testuser", Password: "Password1!"}
+
+	for i := 0; i < 3; i++ {
+		_, err := authService.Login(wrong, "10.0.0.9", "TestAgent/1.0")
+		assert.EqualError(t, err, "invalid credentials")
+	}
+
+	// Locked even with the right password
+	_, err := authService.Login(right, "10.0.0.9", "TestAgent/1.0")
+	assert.EqualError(t, err, "account is temporarily locked")
+
+	locked, err := userRepo.GetByID(user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, locked.LockedUntil)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *locked.LockedUntil, 5*time.Second)
+
+	recorded, err := incidents.ListBetween(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "account_locked", recorded[0].Type)
+	assert.Equal(t, user.ID, *recorded[0].UserID)
+	assert.Equal(t, "10.0.0.9", *recorded[0].IPAddress)
+
+	// An administrator's unlock clears the failed logins
+	require.NoError(t, authService.UnlockAccount(user.ID))
+	unlocked, err := userRepo.GetByID(user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, unlocked.FailedLoginAttempts)
+	_, err = authService.Login(right, "10.0.0.9", "TestAgent/1.0")
+	assert.NoError(t, err)
+}
+
+func TestAuthService_Lockout_ConcurrentAttempts_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	authService := NewAuthService(userRepo, "test-secret-key-12345")
+	authService.SetLockoutPolicy(LockoutPolicy{Attempts: 5, Duration: time.Minute, MaxDuration: time.Hour})
+
+	user := setupAuthUser(t, userRepo, "testuser", "Password1!")
+	wrong := models.LoginRequest{Username: "testuser", Password: "Wrong1!"}
+
+	// The attempts all read the account before any of them is counted
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			authService.Login(wrong, "10.0.0.9", "TestAgent/1.0")
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	locked, err := userRepo.GetByID(user.ID)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, locked.FailedLoginAttempts, 5)
+	assert.True(t, locked.IsAccountLocked(), "the threshold is reached whichever attempts raced")
+	_, err = authService.Login(models.LoginRequest{Username: "testuser", Password: "Password1!"}, "10.0.0.9", "TestAgent/1.0")
+	assert.EqualError(t, err, "account is temporarily locked")
+}
+
+func TestLockoutPolicy_LockDuration(t *testing.T) {
+	policy := LockoutPolicy{Attempts: 5, Duration: 15 * time.Minute, MaxDuration: time.Hour}
+
+	assert.Zero(t, policy.lockDuration(4))
+	assert.Equal(t, 15*time.Minute, policy.lockDuration(5))
+	assert.Equal(t, 15*time.Minute, policy.lockDuration(6), "failures past the threshold lock again")
+	assert.Equal(t, 30*time.Minute, policy.lockDuration(10))
+	assert.Equal(t, time.Hour, policy.lockDuration(15))
+	assert.Equal(t, time.Hour, policy.lockDuration(50))
+	assert.Zero(t, LockoutPolicy{}.lockDuration(5))
+}
+
 func TestAuthService_RefreshToken_Integration(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repository.NewUserRepository(db)
@@ -2433,7 +2561,7 @@ func TestConversionService_CancelJob_Integration(t *testing.T) {
 	require.NoError(t, err)
 
 	// Cancel the job (owner cancels)
-	err = service.CancelJob(job.ID, 1)
+	err = service.CancelJob(job.ID, &models.User{ID: 1})
 	require.NoError(t, err)
 
 	// Verify status changed
@@ -2468,11 +2596,11 @@ func TestConversionService_CancelJob_AlreadyCompleted(t *testing.T) {
 	require.NoError(t, err)
 
 	// Cancel it first
-	err = service.CancelJob(job.ID, 1)
+	err = service.CancelJob(job.ID, &models.User{ID: 1})
 	require.NoError(t, err)
 
 	// Trying to cancel again should fail (status is cancelled, not pending/running)
-	err = service.CancelJob(job.ID, 1)
+	err = service.CancelJob(job.ID, &models.User{ID: 1})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "cannot cancel job")
 }
@@ -2639,7 +2767,7 @@ func TestSyncService_GetSession_NotFound(t *testing.T) {
 	authService := NewAuthService(userRepo, "test-secret-key")
 	service := NewSyncService(syncRepo, userRepo, authService)
 
-	_, err := service.GetSession(99999, 1)
+	_, err := service.GetSession(99999, &models.User{ID: 1})
 	assert.Error(t, err)
 }
 
@@ -2976,7 +3104,7 @@ func TestConversionService_StartConversion_NotPending(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	err = service.CancelJob(job.ID, 1)
+	err = service.CancelJob(job.ID, &models.User{ID: 1})
 	require.NoError(t, err)
 
 	err = service.StartConversion(job.ID)
@@ -3003,7 +3131,7 @@ func TestConversionService_RetryJob_Integration(t *testing.T) {
 	require.NoError(t, err)
 
 	// Can only retry failed jobs - trying pending should fail
-	err = service.RetryJob(job.ID, 1)
+	err = service.RetryJob(job.ID, &models.User{ID: 1})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "only retry failed")
 }
@@ -3059,7 +3187,7 @@ func TestConversionService_GetJob_OwnJob(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	retrieved, err := service.GetJob(job.ID, 1)
+	retrieved, err := service.GetJob(job.ID, &models.User{ID: 1})
 	require.NoError(t, err)
 	assert.Equal(t, job.ID, retrieved.ID)
 }
@@ -3082,7 +3210,7 @@ func TestConversionService_GetJob_Unauthorized(t *testing.T) {
 	require.NoError(t, err)
 
 	// User 2 trying to access user 1's job
-	_, err = service.GetJob(job.ID, 2)
+	_, err = service.GetJob(job.ID, &models.User{ID: 2})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unauthorized")
 }
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"catalogizer/models"
+	"catalogizer/repository"
+)
+
+// setupProgressUserID keys the setup wizard's progress, which every
+// administrator shares
+const setupProgressUserID = 0
+
+// setupSecretMask replaces password answers in progress responses; sending
+// it back keeps the saved value
+const setupSecretMask = "********"
+
+// errSetupCompleted is returned once setup has completed
+var errSetupCompleted = errors.New("setup already completed")
+
+// SetupService runs the first-run installer on top of the configuration
+// wizard. It keeps the answers given so far, turns them into the system
+// configuration once every step passes validation and records that setup
+// completed; until then SetupGate keeps the rest of the API closed.
+type SetupService struct {
+	config    *ConfigurationService
+	repo      *repository.ConfigurationRepository
+	mu        sync.Mutex
+	completed atomic.Bool
+}
+
+// NewSetupService creates a SetupService, reading whether setup has
+// already completed.
+func NewSetupService(config *ConfigurationService, repo *repository.ConfigurationRepository) (*SetupService, error) {
+	s := &SetupService{config: config, repo: repo}
+	completedAt, err := repo.GetSetupCompletion()
+	if err != nil {
+		return nil, err
+	}
+	s.completed.Store(completedAt != nil)
+	return s, nil
+}
+
+// Completed reports whether setup has completed
+func (s *SetupService) Completed() bool {
+	return s.completed.Load()
+}
+
+// Skip marks setup as completed without running the wizard, for
+// installations configured through the environment
+func (s *SetupService) Skip() error {
+	if s.Completed() {
+		return nil
+	}
+	if err := s.repo.MarkSetupCompleted(0); err != nil {
+		return err
+	}
+	s.completed.Store(true)
+	return nil
+}
+
+// Status reports whether setup has completed and which step comes next
+func (s *SetupService) Status() (*models.SetupStatus, error) {
+	completedAt, err := s.repo.GetSetupCompletion()
+	if err != nil {
+		return nil, err
+	}
+	status := &models.SetupStatus{Completed: completedAt != nil, CompletedAt: completedAt}
+	if !status.Completed {
+		progress, err := s.progress()
+		if err != nil {
+			return nil, err
+		}
+		status.CurrentStep = progress.CurrentStep
+	}
+	return status, nil
+}
+
+// Steps returns the wizard steps in order
+func (s *SetupService) Steps() ([]*models.WizardStep, error) {
+	return s.config.GetWizardSteps()
+}
+
+// Progress returns the answers given so far, with passwords masked
+func (s *SetupService) Progress() (*models.WizardProgress, error) {
+	progress, err := s.progress()
+	if err != nil {
+		return nil, err
+	}
+	masked := *progress
+	masked.StepData = s.maskSecrets(progress.StepData)
+	masked.AllData = s.maskSecrets(progress.AllData)
+	return &masked, nil
+}
+
+// ValidateStep checks a step's answers, including connectivity tests for
+// the database, SMB share and SMTP relay, without saving them
+func (s *SetupService) ValidateStep(stepID string, data map[string]interface{}) (*models.WizardStepValidation, error) {
+	if s.Completed() {
+		return nil, errSetupCompleted
+	}
+	progress, err := s.progress()
+	if err != nil {
+		return nil, err
+	}
+	return s.config.ValidateWizardStep(stepID, s.unmaskSecrets(data, progress.AllData))
+}
+
+// SaveStep validates a step's answers and, when they pass, adds them to
+// the saved progress and moves on to the next step. Invalid answers are
+// not saved; the validation says why.
+func (s *SetupService) SaveStep(stepID string, data map[string]interface{}) (*models.WizardStepValidation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Completed() {
+		return nil, errSetupCompleted
+	}
+
+	progress, err := s.progress()
+	if err != nil {
+		return nil, err
+	}
+	data = s.unmaskSecrets(data, progress.AllData)
+	validation, err := s.config.ValidateWizardStep(stepID, data)
+	if err != nil || !validation.Valid {
+		return validation, err
+	}
+
+	for key, value := range data {
+		progress.AllData[key] = value
+	}
+	progress.StepData = data
+	progress.CurrentStep = s.nextStep(stepID)
+	progress.UpdatedAt = time.Now()
+	if err := s.repo.SaveWizardProgress(progress); err != nil {
+		return nil, err
+	}
+	return validation, nil
+}
+
+// Complete validates every step against the saved answers, saves the
+// configuration they describe, adds the SMB media source when one was
+// given and closes setup. userID is the administrator completing it.
+func (s *SetupService) Complete(ctx context.Context, userID int) (*models.SystemConfiguration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Completed() {
+		return nil, errSetupCompleted
+	}
+
+	progress, err := s.progress()
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.config.GetWizardSteps()
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		if step.Type != models.WizardStepTypeForm {
+			continue
+		}
+		validation, err := s.config.ValidateWizardStep(step.ID, progress.AllData)
+		if err != nil {
+			return nil, err
+		}
+		if !validation.Valid {
+			return nil, fmt.Errorf("invalid setup: step %s: %s", step.ID, validationSummary(validation))
+		}
+	}
+
+	config := s.config.generateConfiguration(progress.AllData)
+	if err := s.config.SaveConfiguration(config); err != nil {
+		return nil, err
+	}
+	if host := wizardString(progress.AllData, "smb_host"); host != "" {
+		share := wizardString(progress.AllData, "smb_share")
+		port := wizardInt(progress.AllData, "smb_port", 445)
+		root := &models.StorageRoot{
+			Name:     host + "/" + share,
+			Protocol: "smb",
+			Host:     &host,
+			Port:     &port,
+			Path:     &share,
+			MaxDepth: 10,
+		}
+		if username := wizardString(progress.AllData, "smb_username"); username != "" {
+			root.Username = &username
+			password, _ := progress.AllData["smb_password"].(string)
+			root.Password = &password
+		}
+		if domain := wizardString(progress.AllData, "smb_domain"); domain != "" {
+			root.Domain = &domain
+		}
+		if err := s.repo.SaveStorageRoot(ctx, root); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.MarkSetupCompleted(userID); err != nil {
+		return nil, err
+	}
+	s.completed.Store(true)
+	s.repo.DeleteWizardProgress(setupProgressUserID)
+	return config, nil
+}
+
+// progress returns the saved progress, or a fresh one at the first step
+func (s *SetupService) progress() (*models.WizardProgress, error) {
+	progress, err := s.repo.GetWizardProgress(setupProgressUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		steps, err := s.config.GetWizardSteps()
+		if err != nil {
+			return nil, err
+		}
+		progress = &models.WizardProgress{UserID: setupProgressUserID}
+		if len(steps) > 0 {
+			progress.CurrentStep = steps[0].ID
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if progress.StepData == nil {
+		progress.StepData = map[string]interface{}{}
+	}
+	if progress.AllData == nil {
+		progress.AllData = map[string]interface{}{}
+	}
+	return progress, nil
+}
+
+// nextStep returns the step after stepID, or stepID when it is the last
+func (s *SetupService) nextStep(stepID string) string {
+	steps, _ := s.config.GetWizardSteps()
+	for i, step := range steps {
+		if step.ID == stepID && i+1 < len(steps) {
+			return steps[i+1].ID
+		}
+	}
+	return stepID
+}
+
+// secretFields returns the names of the wizard's password fields
+func (s *SetupService) secretFields() map[string]bool {
+	secrets := make(map[string]bool)
+	steps, _ := s.config.GetWizardSteps()
+	for _, step := range steps {
+		for _, field := range step.Fields {
+			if field.Type == "password" {
+				secrets[field.Name] = true
+			}
+		}
+	}
+	return secrets
+}
+
+// maskSecrets returns a copy of data with non-empty passwords masked
+func (s *SetupService) maskSecrets(data map[string]interface{}) map[string]interface{} {
+	secrets := s.secretFields()
+	masked := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if text, ok := value.(string); ok && secrets[key] && text != "" {
+			value = setupSecretMask
+		}
+		masked[key] = value
+	}
+	return masked
+}
+
+// unmaskSecrets returns a copy of data with masked passwords replaced by
+// the saved ones
+func (s *SetupService) unmaskSecrets(data, saved map[string]interface{}) map[string]interface{} {
+	secrets := s.secretFields()
+	unmasked := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if value == setupSecretMask && secrets[key] {
+			value = saved[key]
+		}
+		unmasked[key] = value
+	}
+	return unmasked
+}
+
+// validationSummary joins a failed validation's errors in field order
+func validationSummary(validation *models.WizardStepValidation) string {
+	fields := make([]string, 0, len(validation.Errors))
+	for field := range validation.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, validation.Errors[field])
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"catalogizer/database"
+	"catalogizer/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSetupService(t *testing.T) (*SetupService, *repository.ConfigurationRepository) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, stmt := range []string{
+		`CREATE TABLE system_configuration (id INTEGER PRIMARY KEY DEFAULT 1, version TEXT NOT NULL, configuration TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE wizard_progress (user_id INTEGER PRIMARY KEY, current_step TEXT NOT NULL, step_data TEXT, all_data TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE setup_state (id INTEGER PRIMARY KEY, completed_at DATETIME NOT NULL, completed_by INTEGER NOT NULL DEFAULT 0)`,
+	} {
+		_, err := sqlDB.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	repo := repository.NewConfigurationRepository(database.WrapDB(sqlDB, database.DialectSQLite))
+	config := NewConfigurationService(repo, filepath.Join(t.TempDir(), "config.json"))
+	svc, err := NewSetupService(config, repo)
+	require.NoError(t, err)
+	return svc, repo
+}
+
+func TestSetupService_Wizard(t *testing.T) {
+	svc, repo := newTestSetupService(t)
+	dir := t.TempDir()
+
+	status, err := svc.Status()
+	require.NoError(t, err)
+	assert.False(t, status.Completed)
+	assert.Equal(t, "welcome", status.CurrentStep)
+
+	validation, err := svc.SaveStep("database", map[string]interface{}{
+		"database_type": "sqlite",
+		"database_name": filepath.Join(dir, "catalogizer.db"),
+	})
+	require.NoError(t, err)
+	assert.True(t, validation.Valid)
+	status, err = svc.Status()
+	require.NoError(t, err)
+	assert.Equal(t, "storage", status.CurrentStep)
+
+	// The database directory must exist and be writable
+	validation, err = svc.ValidateStep("database", map[string]interface{}{
+		"database_type": "sqlite",
+		"database_name": filepath.Join(dir, "missing", "catalogizer.db"),
+	})
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+	assert.Contains(t, validation.Errors["_general"], "not writable")
+
+	// Invalid answers are not saved
+	validation, err = svc.SaveStep("authentication", map[string]interface{}{
+		"jwt_secret": "s3cret", "session_timeout": float64(12), "admin_email": "not-an-email",
+	})
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+	progress, err := svc.Progress()
+	require.NoError(t, err)
+	assert.NotContains(t, progress.AllData, "admin_email")
+
+	_, err = svc.SaveStep("authentication", map[string]interface{}{
+		"jwt_secret": "s3cret", "session_timeout": float64(12), "admin_email": "admin@example.com",
+	})
+	require.NoError(t, err)
+	progress, err = svc.Progress()
+	require.NoError(t, err)
+	assert.Equal(t, setupSecretMask, progress.AllData["jwt_secret"])
+
+	// Sending the mask back keeps the saved secret
+	_, err = svc.SaveStep("authentication", map[string]interface{}{
+		"jwt_secret": setupSecretMask, "session_timeout": float64(12), "admin_email": "admin@example.com",
+	})
+	require.NoError(t, err)
+	saved, err := repo.GetWizardProgress(setupProgressUserID)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", saved.AllData["jwt_secret"])
+
+	_, err = svc.Complete(context.Background(), 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid setup: step storage")
+	assert.False(t, svc.Completed())
+
+	_, err = svc.SaveStep("storage", map[string]interface{}{
+		"media_directory":     filepath.Join(dir, "media"),
+		"thumbnail_directory": filepath.Join(dir, "thumbnails"),
+		"temp_directory":      filepath.Join(dir, "tmp"),
+		"max_file_size":       float64(500),
+	})
+	require.NoError(t, err)
+	_, err = svc.SaveStep("network", map[string]interface{}{"server_host": "0.0.0.0", "server_port": float64(9090)})
+	require.NoError(t, err)
+
+	config, err := svc.Complete(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "catalogizer.db"), config.Database.Name)
+	assert.Equal(t, 9090, config.Network.Port)
+	assert.Equal(t, int64(500*1024*1024), config.Storage.MaxFileSize)
+	assert.Equal(t, 12*time.Hour, config.Authentication.SessionTimeout)
+	assert.True(t, svc.Completed())
+
+	status, err = svc.Status()
+	require.NoError(t, err)
+	assert.True(t, status.Completed)
+	require.NotNil(t, status.CompletedAt)
+	_, err = repo.GetWizardProgress(setupProgressUserID)
+	assert.Error(t, err, "progress is cleared once setup completes")
+
+	_, err = svc.SaveStep("network", map[string]interface{}{"server_host": "0.0.0.0", "server_port": float64(80)})
+	assert.ErrorIs(t, err, errSetupCompleted)
+	_, err = svc.Complete(context.Background(), 1)
+	assert.ErrorIs(t, err, errSetupCompleted)
+
+	// A restarted server remembers that setup completed
+	again, err := NewSetupService(svc.config, repo)
+	require.NoError(t, err)
+	assert.True(t, again.Completed())
+}
+
+func TestSetupService_Skip(t *testing.T) {
+	svc, repo := newTestSetupService(t)
+	require.NoError(t, svc.Skip())
+	assert.True(t, svc.Completed())
+
+	completedAt, err := repo.GetSetupCompletion()
+	require.NoError(t, err)
+	assert.NotNil(t, completedAt)
+}
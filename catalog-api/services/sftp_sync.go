@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"catalogizer/filesystem"
+	"catalogizer/models"
+)
+
+// sftpConfigFromEndpoint builds the client configuration for an SFTP
+// endpoint. The URL gives the server ("sftp://host:port"), RemotePath the
+// base directory, and the sync settings carry the pinned "host_key" plus an
+// optional "private_key", "private_key_path" and "passphrase".
+func sftpConfigFromEndpoint(endpoint *models.SyncEndpoint) (*filesystem.SFTPConfig, error) {
+	raw := endpoint.URL
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		u, err = url.Parse("sftp://" + raw)
+	}
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SFTP URL: %s", raw)
+	}
+
+	port := 22
+	if p := u.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SFTP port: %s", p)
+		}
+	}
+
+	var settings struct {
+		HostKey        string `json:"host_key"`
+		PrivateKey     string `json:"private_key"`
+		PrivateKeyPath string `json:"private_key_path"`
+		Passphrase     string `json:"passphrase"`
+	}
+	if endpoint.SyncSettings != nil {
+		if err := json.Unmarshal([]byte(*endpoint.SyncSettings), &settings); err != nil {
+			return nil, fmt.Errorf("failed to parse SFTP sync config: %w", err)
+		}
+	}
+	if settings.HostKey == "" {
+		return nil, fmt.Errorf("host_key is required for SFTP endpoints")
+	}
+
+	return &filesystem.SFTPConfig{
+		Host:           u.Hostname(),
+		Port:           port,
+		Username:       endpoint.Username,
+		Password:       endpoint.Password,
+		PrivateKey:     settings.PrivateKey,
+		PrivateKeyPath: settings.PrivateKeyPath,
+		Passphrase:     settings.Passphrase,
+		HostKey:        settings.HostKey,
+		Path:           endpoint.RemotePath,
+	}, nil
+}
+
+func (s *SyncService) connectSFTP(ctx context.Context, endpoint *models.SyncEndpoint) (*filesystem.SFTPClient, error) {
+	config, err := sftpConfigFromEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	client := filesystem.NewSFTPClient(config)
+	if err := client.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", net.JoinHostPort(config.Host, strconv.Itoa(config.Port)), err)
+	}
+	return client, nil
+}
+
+func (s *SyncService) testSFTPConnection(endpoint *models.SyncEndpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := s.connectSFTP(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	return client.TestConnection(ctx)
+}
+
+// performSFTPSync transfers files over SFTP. Interrupted transfers leave a
+// partial file behind that the next run resumes instead of starting over.
+// Bidirectional runs upload then download, so the newer copy wins.
+func (s *SyncService) performSFTPSync(session *models.SyncSession, endpoint *models.SyncEndpoint) error {
+	ctx := context.Background()
+	client, err := s.connectSFTP(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	switch endpoint.SyncDirection {
+	case models.SyncDirectionUpload:
+		return s.uploadToSFTP(ctx, session, endpoint, client)
+	case models.SyncDirectionDownload:
+		return s.downloadFromSFTP(ctx, session, endpoint, client)
+	case models.SyncDirectionBidirectional:
+		if err := s.uploadToSFTP(ctx, session, endpoint, client); err != nil {
+			return err
+		}
+		return s.downloadFromSFTP(ctx, session, endpoint, client)
+	default:
+		return fmt.Errorf("unsupported sync direction: %s", endpoint.SyncDirection)
+	}
+}
+
+func (s *SyncService) uploadToSFTP(ctx context.Context, session *models.SyncSession, endpoint *models.SyncEndpoint, client *filesystem.SFTPClient) error {
+	localFiles, err := s.scanLocalFiles(endpoint.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to scan local files: %w", err)
+	}
+
+	session.TotalFiles += len(localFiles)
+	s.syncRepo.UpdateSession(session)
+
+	for _, localFile := range localFiles {
+		relativePath, err := filepath.Rel(endpoint.LocalPath, localFile)
+		if err != nil {
+			continue
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		localInfo, err := os.Stat(localFile)
+		if err != nil {
+			continue
+		}
+
+		if s.skipFile(session, relativePath, localInfo.Size()) {
+			continue
+		}
+
+		if remote, err := client.GetFileInfo(ctx, relativePath); err == nil {
+			if remote.Size == localInfo.Size() && !localInfo.ModTime().After(remote.ModTime) {
+				recordSkip(session, models.SyncSkipUnchanged)
+				continue
+			}
+		}
+
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			continue
+		}
+
+		if err := s.uploadSFTPFile(ctx, session, client, localFile, relativePath, localInfo); err != nil {
+			session.FailedFiles++
+			s.logSyncError(session, relativePath, fmt.Sprintf("Failed to upload %s: %v", localFile, err))
+		} else {
+			session.SyncedFiles++
+		}
+
+		s.syncRepo.UpdateSession(session)
+	}
+
+	return nil
+}
+
+// uploadSFTPFile continues from whatever part of the file already reached
+// the server.
+func (s *SyncService) uploadSFTPFile(ctx context.Context, session *models.SyncSession, client *filesystem.SFTPClient, localFile, relativePath string, info os.FileInfo) error {
+	offset, err := client.PartSize(ctx, relativePath)
+	if err != nil {
+		return err
+	}
+	if offset > info.Size() {
+		offset = 0
+	}
+
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := client.WritePart(ctx, relativePath, offset, newThrottledReader(file, bandwidthLimit(session.Options))); err != nil {
+		return err
+	}
+	return client.CommitPart(ctx, relativePath, info.ModTime())
+}
+
+func (s *SyncService) downloadFromSFTP(ctx context.Context, session *models.SyncSession, endpoint *models.SyncEndpoint, client *filesystem.SFTPClient) error {
+	remoteFiles, err := listSFTPTree(ctx, client, "")
+	if err != nil {
+		return fmt.Errorf("failed to list remote files: %w", err)
+	}
+
+	session.TotalFiles += len(remoteFiles)
+	s.syncRepo.UpdateSession(session)
+
+	for _, remoteFile := range remoteFiles {
+		if s.skipFile(session, remoteFile.Path, remoteFile.Size) {
+			continue
+		}
+
+		localPath, err := syncLocalPath(endpoint.LocalPath, remoteFile.Path)
+		if err != nil {
+			continue
+		}
+
+		localInfo, err := os.Stat(localPath)
+		exists := err == nil
+		if exists && localInfo.Size() == remoteFile.Size && !remoteFile.ModTime.After(localInfo.ModTime()) {
+			recordSkip(session, models.SyncSkipUnchanged)
+			continue
+		}
+
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			continue
+		}
+
+		if exists {
+			s.preserveVersion(session, remoteFile.Path, localPath)
+		}
+
+		if err := s.downloadSFTPFile(ctx, session, client, remoteFile, localPath); err != nil {
+			session.FailedFiles++
+			s.logSyncError(session, remoteFile.Path, fmt.Sprintf("Failed to download %s: %v", remoteFile.Path, err))
+		} else {
+			session.SyncedFiles++
+		}
+
+		s.syncRepo.UpdateSession(session)
+	}
+
+	return nil
+}
+
+// downloadSFTPFile appends to a hidden partial file next to localPath and
+// renames it into place once the whole file has arrived.
+func (s *SyncService) downloadSFTPFile(ctx context.Context, session *models.SyncSession, client *filesystem.SFTPClient, remoteFile *filesystem.FileInfo, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	partPath := filepath.Join(filepath.Dir(localPath), "."+filepath.Base(localPath)+".part")
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil && info.Size() <= remoteFile.Size {
+		offset = info.Size()
+	}
+
+	part, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := part.Truncate(offset); err != nil {
+		part.Close()
+		return err
+	}
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		part.Close()
+		return err
+	}
+
+	remote, err := client.OpenAt(ctx, remoteFile.Path, offset)
+	if err != nil {
+		part.Close()
+		return err
+	}
+	_, err = io.Copy(part, newThrottledReader(remote, bandwidthLimit(session.Options)))
+	remote.Close()
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(partPath, time.Now(), remoteFile.ModTime); err != nil {
+		return err
+	}
+	return os.Rename(partPath, localPath)
+}
+
+// listSFTPTree returns every file below dir with paths relative to the
+// endpoint's remote path.
+func listSFTPTree(ctx context.Context, client *filesystem.SFTPClient, dir string) ([]*filesystem.FileInfo, error) {
+	entries, err := client.ListDirectory(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*filesystem.FileInfo
+	for _, entry := range entries {
+		entry.Path = path.Join(dir, entry.Name)
+		if entry.IsDir {
+			children, err := listSFTPTree(ctx, client, entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, children...)
+			continue
+		}
+		files = append(files, entry)
+	}
+	return files, nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+
+	"catalogizer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSFTPConfigFromEndpoint(t *testing.T) {
+	settings := `{"host_key":"SHA256:abc","private_key_path":"/keys/id_ed25519"}`
+	endpoint := &models.SyncEndpoint{
+		URL: "sftp://nas.local:2222", Username: "media", Password: "pw", RemotePath: "/srv/media", SyncSettings: &settings,
+	}
+
+	config, err := sftpConfigFromEndpoint(endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, "nas.local", config.Host)
+	assert.Equal(t, 2222, config.Port)
+	assert.Equal(t, "media", config.Username)
+	assert.Equal(t, "SHA256:abc", config.HostKey)
+	assert.Equal(t, "/keys/id_ed25519", config.PrivateKeyPath)
+	assert.Equal(t, "/srv/media", config.Path)
+
+	endpoint.URL = "nas.local"
+	config, err = sftpConfigFromEndpoint(endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, "nas.local", config.Host)
+	assert.Equal(t, 22, config.Port)
+
+	endpoint.SyncSettings = nil
+	_, err = sftpConfigFromEndpoint(endpoint)
+	assert.ErrorContains(t, err, "host_key is required")
+
+	endpoint.URL = "sftp://"
+	_, err = sftpConfigFromEndpoint(endpoint)
+	assert.ErrorContains(t, err, "invalid SFTP URL")
+}
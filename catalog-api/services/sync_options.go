@@ -0,0 +1,245 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"catalogizer/models"
+)
+
+var syncWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseSyncEndpointOptions reads the filter, bandwidth and schedule options
+// from an endpoint's sync settings JSON. Missing settings yield zero options.
+func ParseSyncEndpointOptions(settings *string) (*models.SyncEndpointOptions, error) {
+	opts := &models.SyncEndpointOptions{}
+	if settings == nil || strings.TrimSpace(*settings) == "" {
+		return opts, nil
+	}
+	if err := json.Unmarshal([]byte(*settings), opts); err != nil {
+		return nil, fmt.Errorf("invalid sync settings: %w", err)
+	}
+	return opts, nil
+}
+
+// validateSyncEndpointOptions checks the options are usable by the sync engine.
+func validateSyncEndpointOptions(opts *models.SyncEndpointOptions) error {
+	for _, patterns := range [][]string{opts.IncludePatterns, opts.ExcludePatterns} {
+		for _, p := range patterns {
+			if p == "" {
+				return fmt.Errorf("invalid sync settings: empty glob pattern")
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid sync settings: bad glob pattern %q", p)
+			}
+		}
+	}
+	if opts.MaxFileSize < 0 {
+		return fmt.Errorf("invalid sync settings: max_file_size must not be negative")
+	}
+	if opts.BandwidthLimitKBps < 0 {
+		return fmt.Errorf("invalid sync settings: bandwidth_limit_kbps must not be negative")
+	}
+	for _, w := range opts.ScheduleWindows {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("invalid sync settings: schedule window start: %w", err)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("invalid sync settings: schedule window end: %w", err)
+		}
+		if _, err := models.LoadTimeZone(w.TimeZone); err != nil {
+			return fmt.Errorf("invalid sync settings: schedule window: %w", err)
+		}
+		for _, d := range w.Days {
+			if _, ok := syncWeekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("invalid sync settings: unknown day %q", d)
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inSyncScheduleWindow reports whether t falls inside one of the windows,
+// each read on the wall clock of its own time zone. No windows means
+// syncing is always allowed.
+func inSyncScheduleWindow(opts *models.SyncEndpointOptions, t time.Time) bool {
+	if opts == nil || len(opts.ScheduleWindows) == 0 {
+		return true
+	}
+
+	for _, w := range opts.ScheduleWindows {
+		start, err1 := parseClock(w.Start)
+		end, err2 := parseClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		local := t
+		if w.TimeZone != "" {
+			loc, err := models.LoadTimeZone(w.TimeZone)
+			if err != nil {
+				continue
+			}
+			local = t.In(loc)
+		}
+		minute := local.Hour()*60 + local.Minute()
+
+		// For windows wrapping midnight, the part after midnight belongs to
+		// the window that started the previous day.
+		day := local.Weekday()
+		var inside bool
+		switch {
+		case start <= end:
+			inside = minute >= start && minute < end
+		case minute >= start:
+			inside = true
+		case minute < end:
+			inside = true
+			day = (day + 6) % 7
+		}
+		if inside && windowAppliesOn(w, day) {
+			return true
+		}
+	}
+	return false
+}
+
+func windowAppliesOn(w models.SyncScheduleWindow, day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if syncWeekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSkipReason returns why a file should not be synced, or "" to sync it.
+// relPath is slash-separated and relative to the sync root; patterns match
+// either the full relative path or the file name.
+func syncSkipReason(relPath string, size int64, opts *models.SyncEndpointOptions) string {
+	name := path.Base(relPath)
+	if strings.HasPrefix(name, ".") {
+		return models.SyncSkipHidden
+	}
+	if strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".temp") {
+		return models.SyncSkipTemporary
+	}
+	if opts == nil {
+		return ""
+	}
+	if matchesAnySyncPattern(relPath, name, opts.ExcludePatterns) {
+		return models.SyncSkipExcluded
+	}
+	if len(opts.IncludePatterns) > 0 && !matchesAnySyncPattern(relPath, name, opts.IncludePatterns) {
+		return models.SyncSkipNotIncluded
+	}
+	if opts.MaxFileSize > 0 && size > opts.MaxFileSize {
+		return models.SyncSkipTooLarge
+	}
+	return ""
+}
+
+func matchesAnySyncPattern(relPath, name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, relPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSkip counts a skipped file against the session and its reason.
+func recordSkip(session *models.SyncSession, reason string) {
+	session.SkippedFiles++
+	if session.SkipReasons == nil {
+		session.SkipReasons = make(map[string]int)
+	}
+	session.SkipReasons[reason]++
+}
+
+// skipFile applies the session's filters to a file, recording the skip when
+// it is filtered out.
+func (s *SyncService) skipFile(session *models.SyncSession, relPath string, size int64) bool {
+	reason := syncSkipReason(relPath, size, session.Options)
+	if reason == "" {
+		return false
+	}
+	recordSkip(session, reason)
+	return true
+}
+
+// windowClosed reports whether a scheduled session has run past its schedule
+// windows and should stop starting new transfers. Manual runs ignore windows.
+func (s *SyncService) windowClosed(session *models.SyncSession) bool {
+	return session.SyncType == models.SyncTypeScheduled && !inSyncScheduleWindow(session.Options, time.Now())
+}
+
+// bandwidthLimit returns the session's bandwidth cap in bytes per second.
+func bandwidthLimit(opts *models.SyncEndpointOptions) int64 {
+	if opts == nil {
+		return 0
+	}
+	return int64(opts.BandwidthLimitKBps) * 1024
+}
+
+// throttledReader paces reads so the average rate stays at or below
+// bytesPerSec.
+type throttledReader struct {
+	r           io.Reader
+	bytesPerSec int64
+	start       time.Time
+	read        int64
+}
+
+// newThrottledReader wraps r with a rate limit; a limit of zero returns r unchanged.
+func newThrottledReader(r io.Reader, bytesPerSec int64) io.Reader {
+	if bytesPerSec <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, bytesPerSec: bytesPerSec}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	// Keep individual reads to roughly a tenth of a second's worth of data
+	// so pacing stays smooth.
+	if chunk := t.bytesPerSec / 10; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	expected := time.Duration(float64(t.read) / float64(t.bytesPerSec) * float64(time.Second))
+	if elapsed := time.Since(t.start); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+	return n, err
+}
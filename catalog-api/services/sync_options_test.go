@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyncEndpointOptions(t *testing.T) {
+	opts, err := ParseSyncEndpointOptions(nil)
+	require.NoError(t, err)
+	assert.Empty(t, opts.IncludePatterns)
+
+	settings := `{"source_directory":"/a","include_patterns":["*.mkv"],"max_file_size":1024,"bandwidth_limit_kbps":512,
+		"schedule_windows":[{"days":["sat","sun"],"start":"22:00","end":"06:00"}]}`
+	opts, err = ParseSyncEndpointOptions(&settings)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.mkv"}, opts.IncludePatterns)
+	assert.Equal(t, int64(1024), opts.MaxFileSize)
+	assert.Equal(t, int64(512*1024), bandwidthLimit(opts))
+	require.Len(t, opts.ScheduleWindows, 1)
+
+	bad := `not json`
+	_, err = ParseSyncEndpointOptions(&bad)
+	assert.ErrorContains(t, err, "invalid sync settings")
+}
+
+func TestValidateSyncEndpointOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    models.SyncEndpointOptions
+		wantErr bool
+	}{
+		{"empty", models.SyncEndpointOptions{}, false},
+		{"valid", models.SyncEndpointOptions{
+			ExcludePatterns: []string{"*.part", "cache/*"},
+			ScheduleWindows: []models.SyncScheduleWindow{{Days: []string{"Mon"}, Start: "01:00", End: "05:30"}},
+		}, false},
+		{"bad glob", models.SyncEndpointOptions{IncludePatterns: []string{"[abc"}}, true},
+		{"empty glob", models.SyncEndpointOptions{ExcludePatterns: []string{""}}, true},
+		{"negative size", models.SyncEndpointOptions{MaxFileSize: -1}, true},
+		{"negative bandwidth", models.SyncEndpointOptions{BandwidthLimitKBps: -5}, true},
+		{"bad clock", models.SyncEndpointOptions{ScheduleWindows: []models.SyncScheduleWindow{{Start: "25:00", End: "06:00"}}}, true},
+		{"bad day", models.SyncEndpointOptions{ScheduleWindows: []models.SyncScheduleWindow{{Days: []string{"funday"}, Start: "01:00", End: "02:00"}}}, true},
+		{"bad time zone", models.SyncEndpointOptions{ScheduleWindows: []models.SyncScheduleWindow{{Start: "01:00", End: "02:00", TimeZone: "Moon/Base"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSyncEndpointOptions(&tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSyncSkipReason(t *testing.T) {
+	opts := &models.SyncEndpointOptions{
+		IncludePatterns: []string{"*.mkv", "docs/*"},
+		ExcludePatterns: []string{"*sample*"},
+		MaxFileSize:     100,
+	}
+
+	assert.Equal(t, models.SyncSkipHidden, syncSkipReason("movies/.DS_Store", 1, opts))
+	assert.Equal(t, models.SyncSkipTemporary, syncSkipReason("movies/film.tmp", 1, opts))
+	assert.Equal(t, models.SyncSkipExcluded, syncSkipReason("movies/sample.mkv", 1, opts))
+	assert.Equal(t, models.SyncSkipNotIncluded, syncSkipReason("movies/film.avi", 1, opts))
+	assert.Equal(t, models.SyncSkipTooLarge, syncSkipReason("movies/film.mkv", 101, opts))
+	assert.Equal(t, "", syncSkipReason("movies/film.mkv", 100, opts))
+	assert.Equal(t, "", syncSkipReason("docs/readme.txt", 10, opts))
+	assert.Equal(t, "", syncSkipReason("anything.avi", 1<<30, nil))
+}
+
+func TestInSyncScheduleWindow(t *testing.T) {
+	// 2026-10-17 is a Saturday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	assert.True(t, inSyncScheduleWindow(nil, at(17, 12, 0)))
+
+	overnight := &models.SyncEndpointOptions{ScheduleWindows: []models.SyncScheduleWindow{
+		{Days: []string{"sat"}, Start: "22:00", End: "06:00"},
+	}}
+	assert.False(t, inSyncScheduleWindow(overnight, at(17, 21, 59)))
+	assert.True(t, inSyncScheduleWindow(overnight, at(17, 22, 0)))
+	// Sunday morning still belongs to Saturday's window
+	assert.True(t, inSyncScheduleWindow(overnight, at(18, 5, 59)))
+	assert.False(t, inSyncScheduleWindow(overnight, at(18, 6, 0)))
+	assert.False(t, inSyncScheduleWindow(overnight, at(18, 23, 0)))
+
+	daily := &models.SyncEndpointOptions{ScheduleWindows: []models.SyncScheduleWindow{
+		{Start: "01:00", End: "03:00"},
+	}}
+	assert.True(t, inSyncScheduleWindow(daily, at(20, 2, 30)))
+	assert.False(t, inSyncScheduleWindow(daily, at(20, 3, 0)))
+
+	// 01:00-03:00 in Tokyo is 16:00-18:00 UTC the day before
+	tokyo := &models.SyncEndpointOptions{ScheduleWindows: []models.SyncScheduleWindow{
+		{Days: []string{"sun"}, Start: "01:00", End: "03:00", TimeZone: "Asia/Tokyo"},
+	}}
+	assert.True(t, inSyncScheduleWindow(tokyo, at(17, 16, 30)))
+	assert.False(t, inSyncScheduleWindow(tokyo, at(18, 1, 30)))
+}
+
+func TestThrottledReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2000)
+
+	r := newThrottledReader(bytes.NewReader(data), 0)
+	_, isThrottled := r.(*throttledReader)
+	assert.False(t, isThrottled)
+
+	start := time.Now()
+	out, err := io.ReadAll(newThrottledReader(bytes.NewReader(data), 10000))
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+	// 2000 bytes at 10000 B/s takes at least ~200ms
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestSyncService_MirrorSyncRecordsSkipReasons(t *testing.T) {
+	service := NewSyncService(nil, nil, nil)
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "keep.mkv"), []byte("video"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "notes.txt"), []byte("text"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, ".hidden"), []byte("h"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "big.mkv"), bytes.Repeat([]byte("b"), 64), 0644))
+
+	session := &models.SyncSession{ID: 1, UserID: 1, Options: &models.SyncEndpointOptions{
+		IncludePatterns: []string{"*.mkv"},
+		MaxFileSize:     32,
+	}}
+	require.NoError(t, service.performMirrorSync(srcDir, dstDir, session))
+
+	assert.FileExists(t, filepath.Join(dstDir, "keep.mkv"))
+	assert.NoFileExists(t, filepath.Join(dstDir, "notes.txt"))
+	assert.NoFileExists(t, filepath.Join(dstDir, "big.mkv"))
+	assert.Equal(t, 3, session.SkippedFiles)
+	assert.Equal(t, map[string]int{
+		models.SyncSkipHidden:      1,
+		models.SyncSkipNotIncluded: 1,
+		models.SyncSkipTooLarge:    1,
+	}, session.SkipReasons)
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"catalogizer/models"
+)
+
+// modTimeTolerance absorbs timestamp precision differences between
+// filesystems and WebDAV servers when deciding whether two files match.
+const modTimeTolerance = 2 * time.Second
+
+// bidirectionalTarget abstracts the two sides of a bidirectional sync so the
+// same planner and executor serve WebDAV and local endpoints. "Local" is the
+// endpoint's local path (or source directory); "remote" is the other side.
+type bidirectionalTarget struct {
+	listLocal  func() (map[string]models.SyncFileState, error)
+	listRemote func() (map[string]models.SyncFileState, error)
+	upload     func(relPath string) error
+	download   func(relPath string) error
+	// localPath and remotePath return the on-disk path of a file when that
+	// side is local, or "" otherwise. Used to preserve overwritten versions.
+	localPath  func(relPath string) string
+	remotePath func(relPath string) string
+}
+
+// PlanSync computes, without transferring anything, the actions a
+// bidirectional sync of the endpoint would take: uploads, downloads and
+// conflicts with both sides' metadata.
+func (s *SyncService) PlanSync(endpointID int, user *models.User) (*models.SyncPlan, error) {
+	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
+		if err != nil || !hasPermission {
+			return nil, fmt.Errorf("unauthorized to sync this endpoint")
+		}
+	}
+
+	target, err := s.bidirectionalTargetFor(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := ParseSyncEndpointOptions(endpoint.SyncSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.buildSyncPlan(endpoint.ID, target, endpoint.LastSyncAt, opts)
+}
+
+// bidirectionalTargetFor builds the target for endpoints that sync in both
+// directions.
+func (s *SyncService) bidirectionalTargetFor(endpoint *models.SyncEndpoint) (*bidirectionalTarget, error) {
+	switch endpoint.Type {
+	case models.SyncTypeWebDAV:
+		if endpoint.SyncDirection != models.SyncDirectionBidirectional {
+			return nil, fmt.Errorf("dry-run is only supported for bidirectional endpoints")
+		}
+		client, err := s.getWebDAVClient(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get WebDAV client: %w", err)
+		}
+		return s.webDAVTarget(endpoint, client), nil
+	case models.SyncTypeLocal:
+		syncConfig := make(map[string]interface{})
+		if endpoint.SyncSettings != nil {
+			if err := json.Unmarshal([]byte(*endpoint.SyncSettings), &syncConfig); err != nil {
+				return nil, fmt.Errorf("failed to parse local sync config: %w", err)
+			}
+		}
+		if mode, _ := syncConfig["sync_mode"].(string); mode != "bidirectional" {
+			return nil, fmt.Errorf("dry-run is only supported for bidirectional endpoints")
+		}
+		sourceDir, ok := syncConfig["source_directory"].(string)
+		if !ok {
+			sourceDir = endpoint.LocalPath
+		}
+		destDir, ok := syncConfig["destination_directory"].(string)
+		if !ok || sourceDir == "" {
+			return nil, fmt.Errorf("source and destination directories must be specified")
+		}
+		opts, err := ParseSyncEndpointOptions(endpoint.SyncSettings)
+		if err != nil {
+			return nil, err
+		}
+		return s.localDirTarget(sourceDir, destDir, bandwidthLimit(opts)), nil
+	default:
+		return nil, fmt.Errorf("dry-run is not supported for sync type: %s", endpoint.Type)
+	}
+}
+
+func (s *SyncService) webDAVTarget(endpoint *models.SyncEndpoint, client *WebDAVClient) *bidirectionalTarget {
+	return &bidirectionalTarget{
+		listLocal: func() (map[string]models.SyncFileState, error) {
+			return s.listLocalTree(endpoint.LocalPath)
+		},
+		listRemote: func() (map[string]models.SyncFileState, error) {
+			files, err := client.ListFiles(endpoint.RemotePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list remote files: %w", err)
+			}
+			tree := make(map[string]models.SyncFileState)
+			for _, file := range files {
+				if file.IsDir {
+					continue
+				}
+				rel, err := filepath.Rel(endpoint.RemotePath, file.Path)
+				if err != nil {
+					continue
+				}
+				tree[filepath.ToSlash(rel)] = models.SyncFileState{Size: file.Size, ModTime: file.ModTime}
+			}
+			return tree, nil
+		},
+		upload: func(relPath string) error {
+			remote := filepath.ToSlash(filepath.Join(endpoint.RemotePath, relPath))
+			return client.UploadFile(filepath.Join(endpoint.LocalPath, filepath.FromSlash(relPath)), remote)
+		},
+		download: func(relPath string) error {
+			local := filepath.Join(endpoint.LocalPath, filepath.FromSlash(relPath))
+			if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+				return err
+			}
+			return client.DownloadFile(filepath.ToSlash(filepath.Join(endpoint.RemotePath, relPath)), local)
+		},
+		localPath: func(relPath string) string {
+			return filepath.Join(endpoint.LocalPath, filepath.FromSlash(relPath))
+		},
+		remotePath: func(string) string { return "" },
+	}
+}
+
+func (s *SyncService) localDirTarget(sourceDir, destDir string, bytesPerSec int64) *bidirectionalTarget {
+	copyBetween := func(fromDir, toDir, relPath string) error {
+		src := filepath.Join(fromDir, filepath.FromSlash(relPath))
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(toDir, filepath.FromSlash(relPath))
+		if err := s.copyFileLimited(src, dst, info.Mode(), bytesPerSec); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, time.Now(), info.ModTime())
+	}
+
+	return &bidirectionalTarget{
+		listLocal:  func() (map[string]models.SyncFileState, error) { return s.listLocalTree(sourceDir) },
+		listRemote: func() (map[string]models.SyncFileState, error) { return s.listLocalTree(destDir) },
+		upload:     func(relPath string) error { return copyBetween(sourceDir, destDir, relPath) },
+		download:   func(relPath string) error { return copyBetween(destDir, sourceDir, relPath) },
+		localPath: func(relPath string) string {
+			return filepath.Join(sourceDir, filepath.FromSlash(relPath))
+		},
+		remotePath: func(relPath string) string {
+			return filepath.Join(destDir, filepath.FromSlash(relPath))
+		},
+	}
+}
+
+// listLocalTree returns the files under root keyed by slash-separated
+// relative path.
+func (s *SyncService) listLocalTree(root string) (map[string]models.SyncFileState, error) {
+	tree := make(map[string]models.SyncFileState)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		tree[filepath.ToSlash(rel)] = models.SyncFileState{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return tree, nil
+}
+
+// buildSyncPlan compares both sides. A file present on one side only is
+// transferred to the other. A file present on both sides that differs is
+// transferred in the direction of the only side that changed since the last
+// sync; when both changed, or there is no previous sync to compare against,
+// it is reported as a conflict resolved by default in favour of the newer copy.
+// Files filtered out by the endpoint options are counted per reason.
+func (s *SyncService) buildSyncPlan(endpointID int, target *bidirectionalTarget, lastSyncAt *time.Time, opts *models.SyncEndpointOptions) (*models.SyncPlan, error) {
+	local, err := target.listLocal()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := target.listRemote()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &models.SyncPlan{
+		EndpointID:  endpointID,
+		GeneratedAt: time.Now(),
+		LastSyncAt:  lastSyncAt,
+		Uploads:     []models.SyncPlanAction{},
+		Downloads:   []models.SyncPlanAction{},
+		Conflicts:   []models.SyncConflict{},
+		Skipped:     make(map[string]int),
+	}
+
+	paths := make(map[string]struct{}, len(local)+len(remote))
+	for p := range local {
+		paths[p] = struct{}{}
+	}
+	for p := range remote {
+		paths[p] = struct{}{}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		l, hasLocal := local[path]
+		r, hasRemote := remote[path]
+
+		size := l.Size
+		if !hasLocal {
+			size = r.Size
+		}
+		if reason := syncSkipReason(path, size, opts); reason != "" {
+			plan.Skipped[reason]++
+			continue
+		}
+
+		switch {
+		case hasLocal && !hasRemote:
+			plan.Uploads = append(plan.Uploads, models.SyncPlanAction{
+				Path: path, Action: models.SyncActionUpload, Reason: "missing_remote", Local: &l,
+			})
+		case hasRemote && !hasLocal:
+			plan.Downloads = append(plan.Downloads, models.SyncPlanAction{
+				Path: path, Action: models.SyncActionDownload, Reason: "missing_local", Remote: &r,
+			})
+		case sameSyncFile(l, r):
+			plan.Unchanged++
+		default:
+			localChanged := lastSyncAt == nil || l.ModTime.After(*lastSyncAt)
+			remoteChanged := lastSyncAt == nil || r.ModTime.After(*lastSyncAt)
+			switch {
+			case localChanged && !remoteChanged:
+				plan.Uploads = append(plan.Uploads, models.SyncPlanAction{
+					Path: path, Action: models.SyncActionUpload, Reason: "modified_local", Local: &l, Remote: &r,
+				})
+			case remoteChanged && !localChanged:
+				plan.Downloads = append(plan.Downloads, models.SyncPlanAction{
+					Path: path, Action: models.SyncActionDownload, Reason: "modified_remote", Local: &l, Remote: &r,
+				})
+			default:
+				plan.Conflicts = append(plan.Conflicts, models.SyncConflict{
+					Path: path, Local: l, Remote: r, Resolution: models.SyncResolutionNewer,
+				})
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+func sameSyncFile(a, b models.SyncFileState) bool {
+	if a.Size != b.Size {
+		return false
+	}
+	diff := a.ModTime.Sub(b.ModTime)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= modTimeTolerance
+}
+
+// conflictAction maps a conflict and its resolution to the transfer to
+// perform, or "" to leave both sides untouched.
+func conflictAction(conflict models.SyncConflict, resolution string) (string, error) {
+	switch resolution {
+	case "", models.SyncResolutionNewer:
+		if conflict.Local.ModTime.After(conflict.Remote.ModTime) {
+			return models.SyncActionUpload, nil
+		}
+		if conflict.Remote.ModTime.After(conflict.Local.ModTime) {
+			return models.SyncActionDownload, nil
+		}
+		return "", nil
+	case models.SyncResolutionKeepLocal:
+		return models.SyncActionUpload, nil
+	case models.SyncResolutionKeepRemote:
+		return models.SyncActionDownload, nil
+	case models.SyncResolutionSkip:
+		return "", nil
+	default:
+		return "", fmt.Errorf("invalid conflict resolution %q for %s", resolution, conflict.Path)
+	}
+}
+
+// performPlannedSync plans a bidirectional sync and executes it, applying
+// any conflict resolutions carried by the session.
+func (s *SyncService) performPlannedSync(session *models.SyncSession, target *bidirectionalTarget, lastSyncAt *time.Time) error {
+	plan, err := s.buildSyncPlan(session.EndpointID, target, lastSyncAt, session.Options)
+	if err != nil {
+		return err
+	}
+
+	session.TotalFiles += len(plan.Uploads) + len(plan.Downloads) + len(plan.Conflicts)
+	for i := 0; i < plan.Unchanged; i++ {
+		recordSkip(session, models.SyncSkipUnchanged)
+	}
+	for reason, count := range plan.Skipped {
+		for i := 0; i < count; i++ {
+			recordSkip(session, reason)
+		}
+	}
+
+	transfer := func(path, action string) {
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			return
+		}
+
+		var err error
+		if action == models.SyncActionUpload {
+			if dst := target.remotePath(path); dst != "" {
+				s.preserveVersion(session, path, dst)
+			}
+			err = target.upload(path)
+		} else {
+			if dst := target.localPath(path); dst != "" {
+				s.preserveVersion(session, path, dst)
+			}
+			err = target.download(path)
+		}
+		if err != nil {
+			session.FailedFiles++
+			s.logSyncError(session, path, fmt.Sprintf("Failed to %s %s: %v", action, path, err))
+			return
+		}
+		session.SyncedFiles++
+		s.updateSyncProgress(session, fmt.Sprintf("Synced (%s): %s", action, path))
+	}
+
+	for _, a := range plan.Uploads {
+		transfer(a.Path, a.Action)
+	}
+	for _, a := range plan.Downloads {
+		transfer(a.Path, a.Action)
+	}
+	for _, c := range plan.Conflicts {
+		action, err := conflictAction(c, session.ConflictResolutions[c.Path])
+		if err != nil {
+			session.FailedFiles++
+			s.logSyncError(session, c.Path, err.Error())
+			continue
+		}
+		if action == "" {
+			recordSkip(session, models.SyncSkipConflictSkipped)
+			continue
+		}
+		transfer(c.Path, action)
+	}
+
+	return nil
+}
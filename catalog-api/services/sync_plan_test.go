@@ -0,0 +1,110 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"catalogizer/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSyncFile(t *testing.T, dir, name, content string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestSyncService_BuildSyncPlan(t *testing.T) {
+	service := NewSyncService(nil, nil, nil)
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	lastSync := time.Now().Add(-time.Hour)
+	before := lastSync.Add(-time.Hour)
+	after := lastSync.Add(30 * time.Minute)
+
+	writeSyncFile(t, srcDir, "only_local.txt", "a", after)
+	writeSyncFile(t, dstDir, "sub/only_remote.txt", "b", after)
+	writeSyncFile(t, srcDir, "same.txt", "same", before)
+	writeSyncFile(t, dstDir, "same.txt", "same", before)
+	writeSyncFile(t, srcDir, "local_edit.txt", "edited", after)
+	writeSyncFile(t, dstDir, "local_edit.txt", "old", before)
+	writeSyncFile(t, srcDir, "both.txt", "local version", after)
+	writeSyncFile(t, dstDir, "both.txt", "remote", after.Add(time.Minute))
+
+	plan, err := service.buildSyncPlan(7, service.localDirTarget(srcDir, dstDir, 0), &lastSync, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, plan.EndpointID)
+	assert.Equal(t, 1, plan.Unchanged)
+
+	require.Len(t, plan.Uploads, 2)
+	assert.Equal(t, "local_edit.txt", plan.Uploads[0].Path)
+	assert.Equal(t, "modified_local", plan.Uploads[0].Reason)
+	assert.Equal(t, "only_local.txt", plan.Uploads[1].Path)
+	assert.Equal(t, "missing_remote", plan.Uploads[1].Reason)
+
+	require.Len(t, plan.Downloads, 1)
+	assert.Equal(t, "sub/only_remote.txt", plan.Downloads[0].Path)
+
+	require.Len(t, plan.Conflicts, 1)
+	conflict := plan.Conflicts[0]
+	assert.Equal(t, "both.txt", conflict.Path)
+	assert.Equal(t, int64(len("local version")), conflict.Local.Size)
+	assert.Equal(t, int64(len("remote")), conflict.Remote.Size)
+	assert.Equal(t, models.SyncResolutionNewer, conflict.Resolution)
+
+	// A dry-run must not touch either side
+	_, err = os.Stat(filepath.Join(dstDir, "only_local.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSyncService_PerformPlannedSyncAppliesResolutions(t *testing.T) {
+	service := NewSyncService(nil, nil, nil)
+	modTime := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		resolution    string
+		expectedLocal string
+		expectedDest  string
+	}{
+		{"", "remote wins", "remote wins"},
+		{models.SyncResolutionKeepLocal, "local", "local"},
+		{models.SyncResolutionKeepRemote, "remote wins", "remote wins"},
+		{models.SyncResolutionSkip, "local", "remote wins"},
+	}
+
+	for _, tt := range tests {
+		t.Run("resolution="+tt.resolution, func(t *testing.T) {
+			srcDir := t.TempDir()
+			dstDir := t.TempDir()
+			writeSyncFile(t, srcDir, "doc.txt", "local", modTime)
+			writeSyncFile(t, dstDir, "doc.txt", "remote wins", modTime.Add(10*time.Second))
+
+			session := &models.SyncSession{ID: 1, UserID: 1}
+			if tt.resolution != "" {
+				session.ConflictResolutions = map[string]string{"doc.txt": tt.resolution}
+			}
+
+			require.NoError(t, service.performBidirectionalSync(srcDir, dstDir, nil, session))
+
+			local, err := os.ReadFile(filepath.Join(srcDir, "doc.txt"))
+			require.NoError(t, err)
+			dest, err := os.ReadFile(filepath.Join(dstDir, "doc.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLocal, string(local))
+			assert.Equal(t, tt.expectedDest, string(dest))
+		})
+	}
+}
+
+func TestConflictAction_RejectsUnknownResolution(t *testing.T) {
+	_, err := conflictAction(models.SyncConflict{Path: "x"}, "bogus")
+	assert.Error(t, err)
+}
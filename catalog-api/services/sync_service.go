@@ -5,13 +5,16 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	internal_services "catalogizer/internal/services"
 	"catalogizer/models"
 	"catalogizer/repository"
 
@@ -27,6 +30,34 @@ type SyncService struct {
 	userRepo      *repository.UserRepository
 	authService   *AuthService
 	webdavClients map[int]*WebDAVClient
+	versions      syncVersioner
+
+	cloudMu        sync.Mutex
+	cloudProviders map[string]CloudSyncProvider
+	cloudLinks     map[string]cloudLinkState
+
+	rcloneBinary string
+	progressMu   sync.Mutex
+	progress     map[int]*models.SyncProgress
+
+	runningMu sync.Mutex
+	running   map[int]bool // endpoints with a sync in progress
+
+	schedulerMu   sync.Mutex
+	schedulerStop chan struct{}
+	schedulerWG   sync.WaitGroup
+}
+
+// maxSyncSessionFailures is how many failures are stored per session;
+// later ones are only counted.
+const maxSyncSessionFailures = 1000
+
+// syncVersioner preserves a destination file before sync overwrites it,
+// and lists and restores the versions kept.
+type syncVersioner interface {
+	CaptureLocal(ctx context.Context, storageRoot, path, absPath, origin string, userID *int) (*internal_services.FileVersion, error)
+	ListPathVersions(ctx context.Context, storageRoot, path string) ([]internal_services.FileVersion, error)
+	RestoreShareVersion(ctx context.Context, storageRoot string, versionID int64, userID int) (*internal_services.FileVersion, error)
 }
 
 func NewSyncService(syncRepo *repository.SyncRepository, userRepo *repository.UserRepository, authService *AuthService) *SyncService {
@@ -35,7 +66,67 @@ func NewSyncService(syncRepo *repository.SyncRepository, userRepo *repository.Us
 		userRepo:      userRepo,
 		authService:   authService,
 		webdavClients: make(map[int]*WebDAVClient),
+
+		cloudProviders: make(map[string]CloudSyncProvider),
+		cloudLinks:     make(map[string]cloudLinkState),
+		progress:       make(map[int]*models.SyncProgress),
+		running:        make(map[int]bool),
+	}
+}
+
+// SetVersionService keeps previous versions of local files overwritten by
+// sync. Versions are grouped per endpoint under the share name "sync:<id>"
+// and found through ListFileVersions.
+func (s *SyncService) SetVersionService(versions syncVersioner) {
+	s.versions = versions
+}
+
+// preserveVersion captures destPath before it is overwritten. Failures are
+// logged to the session but do not abort the sync.
+func (s *SyncService) preserveVersion(session *models.SyncSession, relPath, destPath string) {
+	if s.versions == nil {
+		return
+	}
+	userID := session.UserID
+	if _, err := s.versions.CaptureLocal(context.Background(), syncVersionRoot(session.EndpointID), filepath.ToSlash(relPath), destPath, internal_services.VersionOriginSync, &userID); err != nil {
+		s.logSyncError(session, relPath, fmt.Sprintf("Failed to preserve previous version of %s: %v", relPath, err))
+	}
+}
+
+// syncVersionRoot is the share name an endpoint's versions are kept under.
+func syncVersionRoot(endpointID int) string {
+	return fmt.Sprintf("sync:%d", endpointID)
+}
+
+// ListFileVersions returns the versions sync kept of a file at path,
+// relative to the endpoint's destination, newest first.
+func (s *SyncService) ListFileVersions(endpointID int, user *models.User, path string) ([]internal_services.FileVersion, error) {
+	if s.versions == nil {
+		return nil, fmt.Errorf("file versioning not configured")
+	}
+	if _, err := s.GetEndpoint(endpointID, user); err != nil {
+		return nil, err
 	}
+	return s.versions.ListPathVersions(context.Background(), syncVersionRoot(endpointID), filepath.ToSlash(filepath.Clean(path)))
+}
+
+// RestoreFileVersion writes a version sync kept back over the endpoint's
+// copy of the file. What it replaces is kept as a version too.
+func (s *SyncService) RestoreFileVersion(endpointID int, user *models.User, versionID int64) (*internal_services.FileVersion, error) {
+	if s.versions == nil {
+		return nil, fmt.Errorf("file versioning not configured")
+	}
+	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
+		if err != nil || !hasPermission {
+			return nil, fmt.Errorf("unauthorized to restore files of this endpoint")
+		}
+	}
+	return s.versions.RestoreShareVersion(context.Background(), syncVersionRoot(endpointID), versionID, user.ID)
 }
 
 func (s *SyncService) CreateSyncEndpoint(userID int, endpoint *models.SyncEndpoint) (*models.SyncEndpoint, error) {
@@ -68,14 +159,14 @@ func (s *SyncService) GetUserEndpoints(userID int) ([]models.SyncEndpoint, error
 	return s.syncRepo.GetUserEndpoints(userID)
 }
 
-func (s *SyncService) GetEndpoint(endpointID int, userID int) (*models.SyncEndpoint, error) {
+func (s *SyncService) GetEndpoint(endpointID int, user *models.User) (*models.SyncEndpoint, error) {
 	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
 	if err != nil {
 		return nil, err
 	}
 
-	if endpoint.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, models.PermissionViewShares)
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionViewShares)
 		if err != nil || !hasPermission {
 			return nil, fmt.Errorf("unauthorized to view this endpoint")
 		}
@@ -84,14 +175,14 @@ func (s *SyncService) GetEndpoint(endpointID int, userID int) (*models.SyncEndpo
 	return endpoint, nil
 }
 
-func (s *SyncService) UpdateEndpoint(endpointID int, userID int, updates *models.UpdateSyncEndpointRequest) (*models.SyncEndpoint, error) {
+func (s *SyncService) UpdateEndpoint(endpointID int, user *models.User, updates *models.UpdateSyncEndpointRequest) (*models.SyncEndpoint, error) {
 	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
 	if err != nil {
 		return nil, err
 	}
 
-	if endpoint.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, models.PermissionEditShares)
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
 		if err != nil || !hasPermission {
 			return nil, fmt.Errorf("unauthorized to update this endpoint")
 		}
@@ -155,14 +246,14 @@ func (s *SyncService) UpdateEndpoint(endpointID int, userID int, updates *models
 	return endpoint, nil
 }
 
-func (s *SyncService) DeleteEndpoint(endpointID int, userID int) error {
+func (s *SyncService) DeleteEndpoint(endpointID int, user *models.User) error {
 	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
 	if err != nil {
 		return err
 	}
 
-	if endpoint.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, models.PermissionDeleteShares)
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionDeleteShares)
 		if err != nil || !hasPermission {
 			return fmt.Errorf("unauthorized to delete this endpoint")
 		}
@@ -171,14 +262,31 @@ func (s *SyncService) DeleteEndpoint(endpointID int, userID int) error {
 	return s.syncRepo.DeleteEndpoint(endpointID)
 }
 
-func (s *SyncService) StartSync(endpointID int, userID int) (*models.SyncSession, error) {
+func (s *SyncService) StartSync(endpointID int, user *models.User) (*models.SyncSession, error) {
+	return s.StartSyncWithResolutions(endpointID, user, nil)
+}
+
+// StartSyncWithResolutions starts a sync applying per-path conflict
+// resolutions (as approved from PlanSync) to bidirectional runs.
+func (s *SyncService) StartSyncWithResolutions(endpointID int, user *models.User, resolutions map[string]string) (*models.SyncSession, error) {
+	return s.startSync(endpointID, user, models.SyncTypeManual, resolutions)
+}
+
+// errOutsideSyncWindow is returned when a scheduled sync is due but the
+// endpoint's schedule windows do not allow transfers right now.
+var errOutsideSyncWindow = errors.New("outside sync schedule window")
+
+// errSyncRunning is returned when the endpoint is already being synced.
+var errSyncRunning = errors.New("sync already running for this endpoint")
+
+func (s *SyncService) startSync(endpointID int, user *models.User, syncType string, resolutions map[string]string) (*models.SyncSession, error) {
 	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
 	if err != nil {
 		return nil, err
 	}
 
-	if endpoint.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, models.PermissionEditShares)
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
 		if err != nil || !hasPermission {
 			return nil, fmt.Errorf("unauthorized to sync this endpoint")
 		}
@@ -188,16 +296,37 @@ func (s *SyncService) StartSync(endpointID int, userID int) (*models.SyncSession
 		return nil, fmt.Errorf("endpoint is not active")
 	}
 
+	opts, err := ParseSyncEndpointOptions(endpoint.SyncSettings)
+	if err != nil {
+		return nil, err
+	}
+	if syncType == models.SyncTypeScheduled && !inSyncScheduleWindow(opts, time.Now()) {
+		return nil, errOutsideSyncWindow
+	}
+
+	// Two runs against the same endpoint would overwrite each other's files
+	s.runningMu.Lock()
+	if s.running[endpointID] {
+		s.runningMu.Unlock()
+		return nil, errSyncRunning
+	}
+	s.running[endpointID] = true
+	s.runningMu.Unlock()
+
 	session := &models.SyncSession{
 		EndpointID: endpointID,
-		UserID:     userID,
+		UserID:     user.ID,
 		Status:     models.SyncSessionStatusRunning,
 		StartedAt:  time.Now(),
-		SyncType:   models.SyncTypeManual,
+		SyncType:   syncType,
+
+		Options:             opts,
+		ConflictResolutions: resolutions,
 	}
 
 	sessionID, err := s.syncRepo.CreateSession(session)
 	if err != nil {
+		s.finishEndpointSync(endpointID)
 		return nil, fmt.Errorf("failed to create sync session: %w", err)
 	}
 
@@ -211,7 +340,15 @@ func (s *SyncService) StartSync(endpointID int, userID int) (*models.SyncSession
 	return &returnCopy, nil
 }
 
+// finishEndpointSync allows the endpoint to be synced again.
+func (s *SyncService) finishEndpointSync(endpointID int) {
+	s.runningMu.Lock()
+	delete(s.running, endpointID)
+	s.runningMu.Unlock()
+}
+
 func (s *SyncService) performSync(session *models.SyncSession, endpoint *models.SyncEndpoint) {
+	defer s.finishEndpointSync(endpoint.ID)
 	defer func() {
 		if r := recover(); r != nil {
 			s.handleSyncError(session, fmt.Errorf("sync panic: %v", r))
@@ -227,6 +364,10 @@ func (s *SyncService) performSync(session *models.SyncSession, endpoint *models.
 		err = s.performCloudSync(session, endpoint)
 	case models.SyncTypeLocal:
 		err = s.performLocalSync(session, endpoint)
+	case models.SyncTypeRclone:
+		err = s.performRcloneSync(session, endpoint)
+	case models.SyncTypeSFTP:
+		err = s.performSFTPSync(session, endpoint)
 	default:
 		err = fmt.Errorf("unsupported sync type: %s", endpoint.Type)
 	}
@@ -236,6 +377,16 @@ func (s *SyncService) performSync(session *models.SyncSession, endpoint *models.
 		return
 	}
 
+	// Bidirectional planning detects conflicts relative to the last
+	// successful sync, so record it. Only that column is written: the
+	// endpoint may have been edited while the sync ran.
+	now := time.Now()
+	if err := s.syncRepo.UpdateEndpointLastSync(endpoint.ID, now); err != nil {
+		s.handleSyncError(session, fmt.Errorf("failed to record sync time: %w", err))
+		return
+	}
+	endpoint.LastSyncAt = &now
+
 	s.handleSyncSuccess(session)
 }
 
@@ -251,10 +402,7 @@ func (s *SyncService) performWebDAVSync(session *models.SyncSession, endpoint *m
 	case models.SyncDirectionDownload:
 		return s.downloadFromWebDAV(session, endpoint, client)
 	case models.SyncDirectionBidirectional:
-		if err := s.uploadToWebDAV(session, endpoint, client); err != nil {
-			return err
-		}
-		return s.downloadFromWebDAV(session, endpoint, client)
+		return s.performPlannedSync(session, s.webDAVTarget(endpoint, client), endpoint.LastSyncAt)
 	default:
 		return fmt.Errorf("unsupported sync direction: %s", endpoint.SyncDirection)
 	}
@@ -278,27 +426,32 @@ func (s *SyncService) uploadToWebDAV(session *models.SyncSession, endpoint *mode
 		remotePath := filepath.Join(endpoint.RemotePath, relativePath)
 		remotePath = filepath.ToSlash(remotePath)
 
-		if s.shouldSkipFile(localFile, endpoint) {
+		localInfo, err := os.Stat(localFile)
+		if err != nil {
+			continue
+		}
+
+		if s.skipFile(session, filepath.ToSlash(relativePath), localInfo.Size()) {
 			continue
 		}
 
 		remoteModTime, err := client.GetModTime(remotePath)
 		if err == nil {
-			localInfo, err := os.Stat(localFile)
-			if err != nil {
-				continue
-			}
-
 			if !localInfo.ModTime().After(remoteModTime) {
-				session.SkippedFiles++
+				recordSkip(session, models.SyncSkipUnchanged)
 				continue
 			}
 		}
 
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			continue
+		}
+
 		err = client.UploadFile(localFile, remotePath)
 		if err != nil {
 			session.FailedFiles++
-			s.logSyncError(session, fmt.Sprintf("Failed to upload %s: %v", localFile, err))
+			s.logSyncError(session, filepath.ToSlash(relativePath), fmt.Sprintf("Failed to upload %s: %v", localFile, err))
 		} else {
 			session.SyncedFiles++
 		}
@@ -326,28 +479,34 @@ func (s *SyncService) downloadFromWebDAV(session *models.SyncSession, endpoint *
 
 		localPath := filepath.Join(endpoint.LocalPath, relativePath)
 
-		if s.shouldSkipRemoteFile(remoteFile, endpoint) {
+		if remoteFile.IsDir || s.skipFile(session, filepath.ToSlash(relativePath), remoteFile.Size) {
 			continue
 		}
 
 		localInfo, err := os.Stat(localPath)
 		if err == nil {
 			if !remoteFile.ModTime.After(localInfo.ModTime()) {
-				session.SkippedFiles++
+				recordSkip(session, models.SyncSkipUnchanged)
 				continue
 			}
 		}
 
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			continue
+		}
+
 		err = os.MkdirAll(filepath.Dir(localPath), 0755)
 		if err != nil {
 			session.FailedFiles++
+			s.logSyncError(session, filepath.ToSlash(relativePath), fmt.Sprintf("Failed to create directory for %s: %v", localPath, err))
 			continue
 		}
 
 		err = client.DownloadFile(remoteFile.Path, localPath)
 		if err != nil {
 			session.FailedFiles++
-			s.logSyncError(session, fmt.Sprintf("Failed to download %s: %v", remoteFile.Path, err))
+			s.logSyncError(session, filepath.ToSlash(relativePath), fmt.Sprintf("Failed to download %s: %v", remoteFile.Path, err))
 		} else {
 			session.SyncedFiles++
 		}
@@ -361,14 +520,22 @@ func (s *SyncService) downloadFromWebDAV(session *models.SyncSession, endpoint *
 func (s *SyncService) performCloudSync(session *models.SyncSession, endpoint *models.SyncEndpoint) error {
 	ctx := context.Background()
 
-	switch endpoint.Type {
-	case "s3":
+	providerName, err := cloudProviderName(endpoint)
+	if err != nil {
+		return err
+	}
+
+	switch providerName {
+	case models.CloudProviderS3:
 		return s.performS3Sync(ctx, session, endpoint)
-	case "google_drive":
+	case models.CloudProviderGCS:
 		return s.performGoogleCloudStorageSync(ctx, session, endpoint)
-	default:
-		return fmt.Errorf("unsupported cloud storage type: %s", endpoint.Type)
 	}
+
+	if provider, ok := s.cloudProvider(providerName); ok {
+		return s.performProviderSync(ctx, session, endpoint, provider)
+	}
+	return fmt.Errorf("unsupported cloud storage type: %s", providerName)
 }
 
 // performS3Sync syncs files with Amazon S3
@@ -632,7 +799,7 @@ func (s *SyncService) performLocalSync(session *models.SyncSession, endpoint *mo
 	case "incremental":
 		err = s.performIncrementalSync(sourceDir, destDir, session)
 	case "bidirectional":
-		err = s.performBidirectionalSync(sourceDir, destDir, session)
+		err = s.performBidirectionalSync(sourceDir, destDir, endpoint.LastSyncAt, session)
 	default:
 		return fmt.Errorf("unsupported sync mode: %s", syncMode)
 	}
@@ -671,24 +838,37 @@ func (s *SyncService) performMirrorSync(sourceDir, destDir string, session *mode
 		}
 
 		// Handle files
+		if s.skipFile(session, filepath.ToSlash(relPath), info.Size()) {
+			return nil
+		}
+
 		// Check if file needs to be copied
 		destInfo, err := os.Stat(destPath)
 		if err == nil {
 			// Compare modification times
 			if !info.ModTime().After(destInfo.ModTime()) {
 				// Source is not newer, skip
+				recordSkip(session, models.SyncSkipUnchanged)
 				return nil
 			}
 
 			// Compare file sizes
 			if info.Size() == destInfo.Size() && info.ModTime().Equal(destInfo.ModTime()) {
 				// Files are identical, skip
+				recordSkip(session, models.SyncSkipUnchanged)
 				return nil
 			}
+
+			s.preserveVersion(session, relPath, destPath)
+		}
+
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			return nil
 		}
 
 		// Copy file
-		if err := s.copyFile(sourcePath, destPath, info.Mode()); err != nil {
+		if err := s.copyFileLimited(sourcePath, destPath, info.Mode(), bandwidthLimit(session.Options)); err != nil {
 			return fmt.Errorf("failed to copy file %s to %s: %w", sourcePath, destPath, err)
 		}
 
@@ -733,18 +913,30 @@ func (s *SyncService) performIncrementalSync(sourceDir, destDir string, session
 		// Build destination path
 		destPath := filepath.Join(destDir, relPath)
 
+		if s.skipFile(session, filepath.ToSlash(relPath), info.Size()) {
+			return nil
+		}
+
 		// Check if destination exists
 		destInfo, err := os.Stat(destPath)
 		if err == nil {
 			// File exists, check if source is newer
 			if !info.ModTime().After(destInfo.ModTime()) {
 				// Source is not newer, skip
+				recordSkip(session, models.SyncSkipUnchanged)
 				return nil
 			}
+
+			s.preserveVersion(session, relPath, destPath)
+		}
+
+		if s.windowClosed(session) {
+			recordSkip(session, models.SyncSkipOutsideWindow)
+			return nil
 		}
 
 		// Copy file
-		if err := s.copyFile(sourcePath, destPath, info.Mode()); err != nil {
+		if err := s.copyFileLimited(sourcePath, destPath, info.Mode(), bandwidthLimit(session.Options)); err != nil {
 			return fmt.Errorf("failed to copy file %s to %s: %w", sourcePath, destPath, err)
 		}
 
@@ -757,24 +949,19 @@ func (s *SyncService) performIncrementalSync(sourceDir, destDir string, session
 	return err
 }
 
-// performBidirectionalSync syncs in both directions
-func (s *SyncService) performBidirectionalSync(sourceDir, destDir string, session *models.SyncSession) error {
-	// For bidirectional sync, we perform incremental sync in both directions
-	// First sync source to destination
-	if err := s.performIncrementalSync(sourceDir, destDir, session); err != nil {
-		return fmt.Errorf("source to destination sync failed: %w", err)
-	}
-
-	// Then sync destination to source
-	if err := s.performIncrementalSync(destDir, sourceDir, session); err != nil {
-		return fmt.Errorf("destination to source sync failed: %w", err)
-	}
-
-	return nil
+// performBidirectionalSync syncs in both directions, resolving files changed
+// on both sides according to the session's conflict resolutions
+func (s *SyncService) performBidirectionalSync(sourceDir, destDir string, lastSyncAt *time.Time, session *models.SyncSession) error {
+	return s.performPlannedSync(session, s.localDirTarget(sourceDir, destDir, bandwidthLimit(session.Options)), lastSyncAt)
 }
 
 // copyFile copies a file with proper permissions
 func (s *SyncService) copyFile(src, dst string, mode os.FileMode) error {
+	return s.copyFileLimited(src, dst, mode, 0)
+}
+
+// copyFileLimited copies a file, capping throughput at bytesPerSec (0 for unlimited)
+func (s *SyncService) copyFileLimited(src, dst string, mode os.FileMode, bytesPerSec int64) error {
 	// Ensure destination directory exists
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
@@ -795,7 +982,7 @@ func (s *SyncService) copyFile(src, dst string, mode os.FileMode) error {
 	defer destFile.Close()
 
 	// Copy file content
-	_, err = io.Copy(destFile, sourceFile)
+	_, err = io.Copy(destFile, newThrottledReader(sourceFile, bytesPerSec))
 	return err
 }
 
@@ -877,9 +1064,18 @@ func (s *SyncService) updateSyncProgress(session *models.SyncSession, message st
 	fmt.Printf("Sync progress for session %d: %s\n", session.ID, message)
 }
 
-func (s *SyncService) logSyncError(session *models.SyncSession, message string) {
-	// In a full implementation, this would log to a sync error log
+// logSyncError records a failure of the session, for the file at path
+// relative to the endpoint root or, when path is empty, for the run.
+func (s *SyncService) logSyncError(session *models.SyncSession, path, message string) {
 	fmt.Printf("Sync error for session %d: %s\n", session.ID, message)
+	if s.syncRepo == nil || session.ID == 0 || session.FailuresRecorded >= maxSyncSessionFailures {
+		return
+	}
+	session.FailuresRecorded++
+	failure := &models.SyncFailure{SessionID: session.ID, Path: path, Message: message, OccurredAt: time.Now()}
+	if err := s.syncRepo.AddSessionFailure(failure); err != nil {
+		fmt.Printf("Failed to record sync error for session %d: %v\n", session.ID, err)
+	}
 }
 
 func (s *SyncService) notifyUser(session *models.SyncSession, message string) {
@@ -891,14 +1087,14 @@ func (s *SyncService) GetUserSessions(userID int, limit, offset int) ([]models.S
 	return s.syncRepo.GetUserSessions(userID, limit, offset)
 }
 
-func (s *SyncService) GetSession(sessionID int, userID int) (*models.SyncSession, error) {
+func (s *SyncService) GetSession(sessionID int, user *models.User) (*models.SyncSession, error) {
 	session, err := s.syncRepo.GetSession(sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	if session.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, models.PermissionViewShares)
+	if session.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionViewShares)
 		if err != nil || !hasPermission {
 			return nil, fmt.Errorf("unauthorized to view this session")
 		}
@@ -907,23 +1103,42 @@ func (s *SyncService) GetSession(sessionID int, userID int) (*models.SyncSession
 	return session, nil
 }
 
-func (s *SyncService) ScheduleSync(endpointID int, userID int, schedule *models.SyncSchedule) (*models.SyncSchedule, error) {
+// GetSessionFailures returns the files a session failed to sync, subject
+// to the same access rules as GetSession.
+func (s *SyncService) GetSessionFailures(sessionID int, user *models.User, limit, offset int) ([]models.SyncFailure, error) {
+	if _, err := s.GetSession(sessionID, user); err != nil {
+		return nil, err
+	}
+	return s.syncRepo.GetSessionFailures(sessionID, limit, offset)
+}
+
+func (s *SyncService) ScheduleSync(endpointID int, user *models.User, schedule *models.SyncSchedule) (*models.SyncSchedule, error) {
+	if _, ok := nextScheduleRun(schedule.Frequency, time.Now(), time.UTC); !ok {
+		return nil, fmt.Errorf("invalid frequency: %q", schedule.Frequency)
+	}
+	if _, err := models.LoadTimeZone(schedule.TimeZone); err != nil {
+		return nil, err
+	}
+
 	endpoint, err := s.syncRepo.GetEndpoint(endpointID)
 	if err != nil {
 		return nil, err
 	}
 
-	if endpoint.UserID != userID {
-		hasPermission, err := s.authService.CheckPermission(userID, models.PermissionEditShares)
+	if endpoint.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
 		if err != nil || !hasPermission {
 			return nil, fmt.Errorf("unauthorized to schedule sync for this endpoint")
 		}
 	}
 
 	schedule.EndpointID = endpointID
-	schedule.UserID = userID
+	schedule.UserID = user.ID
 	schedule.CreatedAt = time.Now()
 	schedule.IsActive = true
+	// The first run happens on the scheduler's next check
+	nextRun := schedule.CreatedAt
+	schedule.NextRun = &nextRun
 
 	id, err := s.syncRepo.CreateSchedule(schedule)
 	if err != nil {
@@ -938,6 +1153,40 @@ func (s *SyncService) GetSyncStatistics(userID *int, startDate, endDate time.Tim
 	return s.syncRepo.GetStatistics(userID, startDate, endDate)
 }
 
+// GetUserSchedules returns the user's sync schedules.
+func (s *SyncService) GetUserSchedules(userID int) ([]models.SyncSchedule, error) {
+	schedules, err := s.syncRepo.GetUserSchedules(userID)
+	if err != nil {
+		return nil, err
+	}
+	if schedules == nil {
+		schedules = []models.SyncSchedule{}
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule removes one of the user's sync schedules. Users holding
+// the edit-shares permission can remove anyone's.
+func (s *SyncService) DeleteSchedule(scheduleID int, user *models.User) error {
+	schedule, err := s.syncRepo.GetSchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+
+	if schedule.UserID != user.ID {
+		hasPermission, err := s.authService.UserHasPermission(user, models.PermissionEditShares)
+		if err != nil || !hasPermission {
+			return fmt.Errorf("unauthorized to delete this schedule")
+		}
+	}
+
+	return s.syncRepo.DeleteSchedule(scheduleID)
+}
+
+// ProcessScheduledSyncs starts the syncs whose schedules are due. A
+// schedule whose sync cannot start counts as run, except when it is
+// outside the endpoint's sync windows or a sync of the endpoint is still
+// running; those are tried again on the next check.
 func (s *SyncService) ProcessScheduledSyncs() error {
 	schedules, err := s.syncRepo.GetActiveSchedules()
 	if err != nil {
@@ -945,32 +1194,116 @@ func (s *SyncService) ProcessScheduledSyncs() error {
 	}
 
 	for _, schedule := range schedules {
-		if s.shouldRunSchedule(&schedule) {
-			_, err := s.StartSync(schedule.EndpointID, schedule.UserID)
-			if err != nil {
-				fmt.Printf("Failed to start scheduled sync for endpoint %d: %v\n", schedule.EndpointID, err)
-			}
+		if !s.shouldRunSchedule(&schedule) {
+			continue
+		}
+		_, err := s.startSync(schedule.EndpointID, &models.User{ID: schedule.UserID}, models.SyncTypeScheduled, nil)
+		if errors.Is(err, errOutsideSyncWindow) || errors.Is(err, errSyncRunning) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Failed to start scheduled sync for endpoint %d: %v\n", schedule.EndpointID, err)
+		}
+
+		now := time.Now()
+		nextRun, _ := nextScheduleRun(schedule.Frequency, now, scheduleLocation(&schedule))
+		if err := s.syncRepo.UpdateScheduleRun(schedule.ID, now, nextRun); err != nil {
+			fmt.Printf("Failed to update sync schedule %d: %v\n", schedule.ID, err)
 		}
 	}
 
 	return nil
 }
 
-func (s *SyncService) shouldRunSchedule(schedule *models.SyncSchedule) bool {
-	now := time.Now()
+// StartScheduler checks for due sync schedules every interval (one
+// minute if not positive) until StopScheduler is called.
+func (s *SyncService) StartScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
 
-	switch schedule.Frequency {
+	s.schedulerMu.Lock()
+	if s.schedulerStop != nil {
+		s.schedulerMu.Unlock()
+		return
+	}
+	s.schedulerStop = make(chan struct{})
+	stop := s.schedulerStop
+	s.schedulerMu.Unlock()
+
+	s.schedulerWG.Add(1)
+	go func() {
+		defer s.schedulerWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := s.ProcessScheduledSyncs(); err != nil {
+					fmt.Printf("Failed to process sync schedules: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// StopScheduler stops checking schedules. Syncs already started keep
+// running.
+func (s *SyncService) StopScheduler() {
+	s.schedulerMu.Lock()
+	stop := s.schedulerStop
+	s.schedulerStop = nil
+	s.schedulerMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	s.schedulerWG.Wait()
+}
+
+// nextScheduleRun returns when a schedule of the given frequency that ran
+// at from is due again, and false for an unknown frequency. Daily, weekly
+// and monthly schedules come back at the same wall clock time in loc, so
+// a day that gains or loses an hour to daylight saving does not shift
+// them.
+func nextScheduleRun(frequency string, from time.Time, loc *time.Location) (time.Time, bool) {
+	local := from.In(loc)
+	var next time.Time
+	switch frequency {
 	case models.SyncFrequencyHourly:
-		return schedule.LastRun == nil || schedule.LastRun.Add(time.Hour).Before(now)
+		next = from.Add(time.Hour)
 	case models.SyncFrequencyDaily:
-		return schedule.LastRun == nil || schedule.LastRun.Add(24*time.Hour).Before(now)
+		next = local.AddDate(0, 0, 1)
 	case models.SyncFrequencyWeekly:
-		return schedule.LastRun == nil || schedule.LastRun.Add(7*24*time.Hour).Before(now)
+		next = local.AddDate(0, 0, 7)
 	case models.SyncFrequencyMonthly:
-		return schedule.LastRun == nil || schedule.LastRun.AddDate(0, 1, 0).Before(now)
+		next = local.AddDate(0, 1, 0)
 	default:
-		return false
+		return time.Time{}, false
+	}
+	return next.In(from.Location()), true
+}
+
+// scheduleLocation returns the time zone a sync schedule runs in. One
+// saved with a zone the server no longer knows falls back to server local
+// time.
+func scheduleLocation(schedule *models.SyncSchedule) *time.Location {
+	loc, err := models.LoadTimeZone(schedule.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+func (s *SyncService) shouldRunSchedule(schedule *models.SyncSchedule) bool {
+	if schedule.LastRun == nil {
+		_, known := nextScheduleRun(schedule.Frequency, time.Now(), time.UTC)
+		return known
 	}
+	next, ok := nextScheduleRun(schedule.Frequency, *schedule.LastRun, scheduleLocation(schedule))
+	return ok && next.Before(time.Now())
 }
 
 func (s *SyncService) validateSyncEndpoint(endpoint *models.SyncEndpoint) error {
@@ -994,7 +1327,7 @@ func (s *SyncService) validateSyncEndpoint(endpoint *models.SyncEndpoint) error
 		return fmt.Errorf("local path is required")
 	}
 
-	validTypes := []string{models.SyncTypeWebDAV, models.SyncTypeCloudStorage, models.SyncTypeLocal}
+	validTypes := []string{models.SyncTypeWebDAV, models.SyncTypeCloudStorage, models.SyncTypeLocal, models.SyncTypeRclone, models.SyncTypeSFTP}
 	if !s.isValidType(endpoint.Type, validTypes) {
 		return fmt.Errorf("invalid sync type: %s", endpoint.Type)
 	}
@@ -1004,7 +1337,11 @@ func (s *SyncService) validateSyncEndpoint(endpoint *models.SyncEndpoint) error
 		return fmt.Errorf("invalid sync direction: %s", endpoint.SyncDirection)
 	}
 
-	return nil
+	opts, err := ParseSyncEndpointOptions(endpoint.SyncSettings)
+	if err != nil {
+		return err
+	}
+	return validateSyncEndpointOptions(opts)
 }
 
 func (s *SyncService) isValidType(value string, validValues []string) bool {
@@ -1024,18 +1361,26 @@ func (s *SyncService) testConnection(endpoint *models.SyncEndpoint) error {
 			return err
 		}
 		return client.TestConnection()
+	case models.SyncTypeRclone:
+		return s.testRcloneConnection(endpoint)
+	case models.SyncTypeSFTP:
+		return s.testSFTPConnection(endpoint)
 	default:
 		return nil // Skip test for other types for now
 	}
 }
 
 func (s *SyncService) getWebDAVClient(endpoint *models.SyncEndpoint) (*WebDAVClient, error) {
-	if client, exists := s.webdavClients[endpoint.ID]; exists {
-		return client, nil
+	client, exists := s.webdavClients[endpoint.ID]
+	if !exists {
+		client = NewWebDAVClient(endpoint.URL, endpoint.Username, endpoint.Password)
+		s.webdavClients[endpoint.ID] = client
 	}
 
-	client := NewWebDAVClient(endpoint.URL, endpoint.Username, endpoint.Password)
-	s.webdavClients[endpoint.ID] = client
+	// Settings may have changed since the client was cached
+	if opts, err := ParseSyncEndpointOptions(endpoint.SyncSettings); err == nil {
+		client.SetBandwidthLimit(bandwidthLimit(opts))
+	}
 
 	return client, nil
 }
@@ -1058,41 +1403,37 @@ func (s *SyncService) scanLocalFiles(path string) ([]string, error) {
 	return files, err
 }
 
+// shouldSkipFile reports whether a local file is excluded by the endpoint's
+// filters. Paths are matched relative to the endpoint's local path.
 func (s *SyncService) shouldSkipFile(filePath string, endpoint *models.SyncEndpoint) bool {
-	fileName := filepath.Base(filePath)
-
-	// Skip hidden files
-	if strings.HasPrefix(fileName, ".") {
-		return true
+	relPath := filePath
+	if endpoint.LocalPath != "" {
+		if rel, err := filepath.Rel(endpoint.LocalPath, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+			relPath = rel
+		}
 	}
 
-	// Skip temporary files
-	if strings.HasSuffix(fileName, ".tmp") || strings.HasSuffix(fileName, ".temp") {
-		return true
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
 	}
 
-	// Check file size limits if configured
-	if endpoint.SyncSettings != nil {
-		// This would parse JSON settings and check file size limits
-	}
-
-	return false
+	opts, _ := ParseSyncEndpointOptions(endpoint.SyncSettings)
+	return syncSkipReason(filepath.ToSlash(relPath), size, opts) != ""
 }
 
+// shouldSkipRemoteFile reports whether a remote file is excluded by the
+// endpoint's filters.
 func (s *SyncService) shouldSkipRemoteFile(file *WebDAVFile, endpoint *models.SyncEndpoint) bool {
-	fileName := filepath.Base(file.Path)
-
-	// Skip hidden files
-	if strings.HasPrefix(fileName, ".") {
-		return true
-	}
-
-	// Skip temporary files
-	if strings.HasSuffix(fileName, ".tmp") || strings.HasSuffix(fileName, ".temp") {
-		return true
+	relPath := file.Path
+	if endpoint.RemotePath != "" {
+		if rel, err := filepath.Rel(endpoint.RemotePath, file.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			relPath = rel
+		}
 	}
 
-	return false
+	opts, _ := ParseSyncEndpointOptions(endpoint.SyncSettings)
+	return syncSkipReason(filepath.ToSlash(relPath), file.Size, opts) != ""
 }
 
 func (s *SyncService) calculateChecksum(filePath string) (string, error) {
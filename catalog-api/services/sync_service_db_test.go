@@ -2,12 +2,14 @@ package services
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"catalogizer/database"
+	internal_services "catalogizer/internal/services"
 	"catalogizer/models"
 	"catalogizer/repository"
 
@@ -59,6 +61,7 @@ func newSyncTestDB(t *testing.T) (*database.DB, func()) {
 		failed_files INTEGER DEFAULT 0,
 		skipped_files INTEGER DEFAULT 0,
 		error_message TEXT,
+		skip_reasons TEXT,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (endpoint_id) REFERENCES sync_endpoints(id)
 	);
@@ -68,12 +71,31 @@ func newSyncTestDB(t *testing.T) (*database.DB, func()) {
 		endpoint_id INTEGER NOT NULL,
 		user_id INTEGER NOT NULL,
 		frequency TEXT NOT NULL,
+		time_zone TEXT NOT NULL DEFAULT '',
 		last_run DATETIME,
 		next_run DATETIME,
 		is_active BOOLEAN DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (endpoint_id) REFERENCES sync_endpoints(id)
 	);
+
+	CREATE TABLE IF NOT EXISTS sync_session_failures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		path TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL,
+		occurred_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_cloud_credentials (
+		endpoint_id INTEGER PRIMARY KEY,
+		provider TEXT NOT NULL,
+		access_token TEXT NOT NULL,
+		refresh_token TEXT,
+		token_expiry DATETIME,
+		change_cursor TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 	_, err = rawDB.Exec(schema)
 	require.NoError(t, err)
@@ -740,7 +762,7 @@ func TestSyncService_UpdateEndpoint(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("owner can update own endpoint", func(t *testing.T) {
-		updated, err := service.UpdateEndpoint(id, 1, &models.UpdateSyncEndpointRequest{
+		updated, err := service.UpdateEndpoint(id, &models.User{ID: 1}, &models.UpdateSyncEndpointRequest{
 			Name: "Updated Name",
 			URL:  "file:///tmp/new-sync",
 		})
@@ -751,7 +773,7 @@ func TestSyncService_UpdateEndpoint(t *testing.T) {
 
 	t.Run("update with multiple fields", func(t *testing.T) {
 		isActive := true
-		updated, err := service.UpdateEndpoint(id, 1, &models.UpdateSyncEndpointRequest{
+		updated, err := service.UpdateEndpoint(id, &models.User{ID: 1}, &models.UpdateSyncEndpointRequest{
 			Username:      "newuser",
 			Password:      "newpass",
 			SyncDirection: models.SyncDirectionDownload,
@@ -765,7 +787,7 @@ func TestSyncService_UpdateEndpoint(t *testing.T) {
 	})
 
 	t.Run("nonexistent endpoint returns error", func(t *testing.T) {
-		_, err := service.UpdateEndpoint(9999, 1, &models.UpdateSyncEndpointRequest{
+		_, err := service.UpdateEndpoint(9999, &models.User{ID: 1}, &models.UpdateSyncEndpointRequest{
 			Name: "Ghost",
 		})
 		assert.Error(t, err)
@@ -773,7 +795,7 @@ func TestSyncService_UpdateEndpoint(t *testing.T) {
 
 	t.Run("set inactive via IsActive pointer", func(t *testing.T) {
 		isActive := false
-		updated, err := service.UpdateEndpoint(id, 1, &models.UpdateSyncEndpointRequest{
+		updated, err := service.UpdateEndpoint(id, &models.User{ID: 1}, &models.UpdateSyncEndpointRequest{
 			IsActive: &isActive,
 		})
 		require.NoError(t, err)
@@ -782,7 +804,7 @@ func TestSyncService_UpdateEndpoint(t *testing.T) {
 
 	t.Run("set sync settings", func(t *testing.T) {
 		settings := `{"key":"value"}`
-		updated, err := service.UpdateEndpoint(id, 1, &models.UpdateSyncEndpointRequest{
+		updated, err := service.UpdateEndpoint(id, &models.User{ID: 1}, &models.UpdateSyncEndpointRequest{
 			SyncSettings: &settings,
 		})
 		require.NoError(t, err)
@@ -814,13 +836,13 @@ func TestSyncService_GetSession(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("owner can view own session", func(t *testing.T) {
-		got, err := service.GetSession(id, 1)
+		got, err := service.GetSession(id, &models.User{ID: 1})
 		require.NoError(t, err)
 		assert.Equal(t, id, got.ID)
 	})
 
 	t.Run("nonexistent session returns error", func(t *testing.T) {
-		_, err := service.GetSession(9999, 1)
+		_, err := service.GetSession(9999, &models.User{ID: 1})
 		assert.Error(t, err)
 	})
 }
@@ -853,7 +875,7 @@ func TestSyncService_ScheduleSync(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("owner can schedule sync", func(t *testing.T) {
-		schedule, err := service.ScheduleSync(epID, 1, &models.SyncSchedule{
+		schedule, err := service.ScheduleSync(epID, &models.User{ID: 1}, &models.SyncSchedule{
 			Frequency: models.SyncFrequencyDaily,
 		})
 		require.NoError(t, err)
@@ -865,11 +887,83 @@ func TestSyncService_ScheduleSync(t *testing.T) {
 	})
 
 	t.Run("nonexistent endpoint returns error", func(t *testing.T) {
-		_, err := service.ScheduleSync(9999, 1, &models.SyncSchedule{
+		_, err := service.ScheduleSync(9999, &models.User{ID: 1}, &models.SyncSchedule{
 			Frequency: models.SyncFrequencyWeekly,
 		})
 		assert.Error(t, err)
 	})
+
+	t.Run("unknown time zone is rejected", func(t *testing.T) {
+		_, err := service.ScheduleSync(epID, &models.User{ID: 1}, &models.SyncSchedule{
+			Frequency: models.SyncFrequencyDaily,
+			TimeZone:  "Mars/Olympus_Mons",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid time zone")
+	})
+
+	t.Run("unknown frequency is rejected", func(t *testing.T) {
+		_, err := service.ScheduleSync(epID, &models.User{ID: 1}, &models.SyncSchedule{Frequency: "fortnightly"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid frequency")
+	})
+
+	t.Run("schedules are listed and deleted by their owner", func(t *testing.T) {
+		schedules, err := service.GetUserSchedules(1)
+		require.NoError(t, err)
+		require.Len(t, schedules, 1)
+		require.NotNil(t, schedules[0].NextRun)
+
+		none, err := service.GetUserSchedules(2)
+		require.NoError(t, err)
+		assert.Empty(t, none)
+
+		require.NoError(t, service.DeleteSchedule(schedules[0].ID, &models.User{ID: 1}))
+		err = service.DeleteSchedule(schedules[0].ID, &models.User{ID: 1})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
+
+func TestNextScheduleRun(t *testing.T) {
+	from := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	next, ok := nextScheduleRun(models.SyncFrequencyHourly, from, time.UTC)
+	require.True(t, ok)
+	assert.Equal(t, from.Add(time.Hour), next)
+
+	next, ok = nextScheduleRun(models.SyncFrequencyWeekly, from, time.UTC)
+	require.True(t, ok)
+	assert.Equal(t, from.AddDate(0, 0, 7), next)
+
+	next, ok = nextScheduleRun(models.SyncFrequencyMonthly, from, time.UTC)
+	require.True(t, ok)
+	assert.Equal(t, from.AddDate(0, 1, 0), next)
+
+	_, ok = nextScheduleRun("never", from, time.UTC)
+	assert.False(t, ok)
+}
+
+func TestNextScheduleRun_DaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Clocks go forward on 2026-03-08: a daily 09:00 run stays at 09:00
+	// local time, 23 hours after the previous one
+	from := time.Date(2026, 3, 7, 9, 0, 0, 0, loc).UTC()
+	next, ok := nextScheduleRun(models.SyncFrequencyDaily, from, loc)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2026, 3, 8, 9, 0, 0, 0, loc), next.In(loc))
+	assert.Equal(t, 23*time.Hour, next.Sub(from))
+	assert.Equal(t, time.UTC, next.Location())
+
+	// and back on 2026-11-01, a day of 25 hours
+	from = time.Date(2026, 10, 31, 9, 0, 0, 0, loc)
+	next, _ = nextScheduleRun(models.SyncFrequencyDaily, from, loc)
+	assert.Equal(t, 25*time.Hour, next.Sub(from))
+
+	next, _ = nextScheduleRun(models.SyncFrequencyHourly, from, loc)
+	assert.Equal(t, time.Hour, next.Sub(from))
 }
 
 // ---------------------------------------------------------------------------
@@ -899,13 +993,13 @@ func TestSyncService_GetEndpoint(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("owner can get own endpoint", func(t *testing.T) {
-		got, err := service.GetEndpoint(epID, 1)
+		got, err := service.GetEndpoint(epID, &models.User{ID: 1})
 		require.NoError(t, err)
 		assert.Equal(t, "Get Test", got.Name)
 	})
 
 	t.Run("nonexistent endpoint returns error", func(t *testing.T) {
-		_, err := service.GetEndpoint(9999, 1)
+		_, err := service.GetEndpoint(9999, &models.User{ID: 1})
 		assert.Error(t, err)
 	})
 }
@@ -919,11 +1013,51 @@ func TestSyncService_LogSyncError(t *testing.T) {
 	session := &models.SyncSession{ID: 42, UserID: 1}
 
 	// These are simple fmt.Printf wrappers — just verify they don't panic
-	service.logSyncError(session, "test error message")
+	service.logSyncError(session, "a.txt", "test error message")
 	service.updateSyncProgress(session, "50% complete")
 	service.notifyUser(session, "sync completed")
 }
 
+func TestSyncService_SessionFailures(t *testing.T) {
+	db, cleanup := newSyncTestDB(t)
+	defer cleanup()
+
+	repo := repository.NewSyncRepository(db)
+	service := NewSyncService(repo, nil, nil)
+
+	sessionID, err := repo.CreateSession(&models.SyncSession{
+		EndpointID: 1,
+		UserID:     1,
+		Status:     models.SyncSessionStatusRunning,
+		SyncType:   models.SyncTypeManual,
+		StartedAt:  time.Now(),
+	})
+	require.NoError(t, err)
+	session := &models.SyncSession{ID: sessionID, UserID: 1}
+
+	service.logSyncError(session, "docs/a.txt", "permission denied")
+	service.logSyncError(session, "", "connection reset")
+
+	failures, err := service.GetSessionFailures(sessionID, &models.User{ID: 1}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "docs/a.txt", failures[0].Path)
+	assert.Equal(t, "permission denied", failures[0].Message)
+	assert.Equal(t, "", failures[1].Path)
+
+	failures, err = service.GetSessionFailures(sessionID, &models.User{ID: 1}, 10, 1)
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	assert.Equal(t, "connection reset", failures[0].Message)
+
+	// Recording stops at the cap
+	session.FailuresRecorded = maxSyncSessionFailures
+	service.logSyncError(session, "b.txt", "ignored")
+	failures, err = service.GetSessionFailures(sessionID, &models.User{ID: 1}, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, failures, 2)
+}
+
 // ---------------------------------------------------------------------------
 // SyncService — GetSyncStatistics
 // ---------------------------------------------------------------------------
@@ -956,3 +1090,129 @@ func TestSyncService_GetUserSessions(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, sessions)
 }
+
+func TestSyncService_FileVersions(t *testing.T) {
+	db, cleanup := newSyncTestDB(t)
+	defer cleanup()
+	db.SetMaxOpenConns(1)
+	_, err := db.Exec(`
+	CREATE TABLE storage_roots (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE);
+	CREATE TABLE files (id INTEGER PRIMARY KEY AUTOINCREMENT, storage_root_id INTEGER NOT NULL, path TEXT NOT NULL);
+	CREATE TABLE file_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		storage_root TEXT NOT NULL,
+		path TEXT NOT NULL,
+		file_id INTEGER,
+		version_number INTEGER NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		sha256 TEXT,
+		stored_path TEXT NOT NULL,
+		origin TEXT NOT NULL,
+		local_path TEXT,
+		created_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE file_version_policies (
+		storage_root TEXT PRIMARY KEY,
+		max_versions INTEGER NOT NULL DEFAULT 0,
+		max_age_days INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`)
+	require.NoError(t, err)
+
+	repo := repository.NewSyncRepository(db)
+	svc := NewSyncService(repo, nil, nil)
+	svc.SetVersionService(internal_services.NewFileVersionService(db, nil,
+		internal_services.FileVersionConfig{Dir: t.TempDir(), DefaultMaxVersions: 5}))
+
+	srcDir, destDir := t.TempDir(), t.TempDir()
+	settings := fmt.Sprintf(`{"destination_directory": %q, "sync_mode": "incremental"}`, destDir)
+	endpoint := &models.SyncEndpoint{
+		UserID: 1, Name: "docs", Type: models.SyncTypeLocal, URL: "file://" + srcDir,
+		SyncDirection: models.SyncDirectionUpload, LocalPath: srcDir, SyncSettings: &settings,
+		Status: models.SyncStatusActive, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	endpoint.ID, err = repo.CreateEndpoint(endpoint)
+	require.NoError(t, err)
+
+	// Sync a file, then overwrite it with a newer one
+	src := filepath.Join(srcDir, "notes", "report.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(src), 0755))
+	require.NoError(t, os.WriteFile(src, []byte("first draft"), 0644))
+	session := &models.SyncSession{EndpointID: endpoint.ID, UserID: 1}
+	require.NoError(t, svc.performLocalSync(session, endpoint))
+	require.NoError(t, os.WriteFile(src, []byte("second draft"), 0644))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(src, later, later))
+	require.NoError(t, svc.performLocalSync(session, endpoint))
+	dest := filepath.Join(destDir, "notes", "report.txt")
+	content, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "second draft", string(content))
+
+	versions, err := svc.ListFileVersions(endpoint.ID, &models.User{ID: 1}, "notes/report.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, internal_services.VersionOriginSync, versions[0].Origin)
+	assert.Equal(t, int64(len("first draft")), versions[0].Size)
+
+	restored, err := svc.RestoreFileVersion(endpoint.ID, &models.User{ID: 1}, versions[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, versions[0].ID, restored.ID)
+	content, err = os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "first draft", string(content))
+
+	// The restore kept what it replaced
+	versions, err = svc.ListFileVersions(endpoint.ID, &models.User{ID: 1}, "notes/report.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, internal_services.VersionOriginRestore, versions[0].Origin)
+
+	_, err = svc.RestoreFileVersion(endpoint.ID, &models.User{ID: 1}, 999)
+	assert.ErrorContains(t, err, "version not found")
+	_, err = svc.ListFileVersions(999, &models.User{ID: 1}, "notes/report.txt")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestSyncService_PerformSync_KeepsConcurrentEndpointEdits(t *testing.T) {
+	db, cleanup := newSyncTestDB(t)
+	defer cleanup()
+
+	repo := repository.NewSyncRepository(db)
+	svc := NewSyncService(repo, nil, nil)
+
+	srcDir, destDir := t.TempDir(), t.TempDir()
+	settings := fmt.Sprintf(`{"destination_directory": %q}`, destDir)
+	endpoint := &models.SyncEndpoint{
+		UserID: 1, Name: "docs", Type: models.SyncTypeLocal, URL: "file://" + srcDir,
+		SyncDirection: models.SyncDirectionUpload, LocalPath: srcDir, SyncSettings: &settings,
+		Status: models.SyncStatusActive, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	var err error
+	endpoint.ID, err = repo.CreateEndpoint(endpoint)
+	require.NoError(t, err)
+	session := &models.SyncSession{EndpointID: endpoint.ID, UserID: 1, StartedAt: time.Now()}
+	session.ID, err = repo.CreateSession(session)
+	require.NoError(t, err)
+
+	// The endpoint is edited while the sync holds its old copy
+	_, err = svc.UpdateEndpoint(endpoint.ID, &models.User{ID: 1}, &models.UpdateSyncEndpointRequest{Name: "renamed"})
+	require.NoError(t, err)
+
+	svc.performSync(session, endpoint)
+	assert.Equal(t, models.SyncSessionStatusCompleted, session.Status)
+
+	stored, err := repo.GetEndpoint(endpoint.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", stored.Name)
+	assert.NotNil(t, stored.LastSyncAt)
+
+	// A sync whose time cannot be recorded fails
+	_, err = db.Exec(`DROP TABLE sync_endpoints`)
+	require.NoError(t, err)
+	svc.performSync(session, endpoint)
+	assert.Equal(t, models.SyncSessionStatusFailed, session.Status)
+	require.NotNil(t, session.ErrorMessage)
+	assert.Contains(t, *session.ErrorMessage, "failed to record sync time")
+}
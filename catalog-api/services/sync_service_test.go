@@ -672,7 +672,7 @@ func TestSyncService_PerformBidirectionalSync(t *testing.T) {
 		require.NoError(t, os.WriteFile(filepath.Join(srcDir, "from_src.txt"), []byte("from source"), 0644))
 		require.NoError(t, os.WriteFile(filepath.Join(dstDir, "from_dst.txt"), []byte("from destination"), 0644))
 
-		err := service.performBidirectionalSync(srcDir, dstDir, session)
+		err := service.performBidirectionalSync(srcDir, dstDir, nil, session)
 		assert.NoError(t, err)
 
 		// Source file should be in destination
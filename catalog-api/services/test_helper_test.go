@@ -45,7 +45,8 @@ func setupTestDB(t *testing.T) *database.DB {
 			last_login_at DATETIME,
 			last_login_ip TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
 		)`,
 		`CREATE TABLE IF NOT EXISTS favorites (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -172,14 +173,23 @@ func setupTestDB(t *testing.T) *database.DB {
 			failed_files INTEGER DEFAULT 0,
 			skipped_files INTEGER DEFAULT 0,
 			error_message TEXT,
+			skip_reasons TEXT,
 			FOREIGN KEY (endpoint_id) REFERENCES sync_endpoints(id),
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS sync_session_failures (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL,
+			occurred_at DATETIME NOT NULL
+		)`,
 		`CREATE TABLE IF NOT EXISTS sync_schedules (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			endpoint_id INTEGER NOT NULL,
 			user_id INTEGER NOT NULL,
 			frequency TEXT NOT NULL,
+			time_zone TEXT NOT NULL DEFAULT '',
 			last_run DATETIME,
 			next_run DATETIME,
 			is_active BOOLEAN DEFAULT 1,
@@ -206,6 +216,8 @@ func setupTestDB(t *testing.T) *database.DB {
 			scheduled_for DATETIME,
 			duration INTEGER,
 			error_message TEXT,
+			progress REAL NOT NULL DEFAULT 0,
+			transfer_rate REAL NOT NULL DEFAULT 0,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 		`CREATE TABLE IF NOT EXISTS log_collections (
@@ -311,6 +323,47 @@ func setupTestDB(t *testing.T) *database.DB {
 			last_activity_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS security_incidents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			description TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			user_id INTEGER,
+			ip_address TEXT,
+			occurred_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS oidc_identities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT,
+			created_at DATETIME NOT NULL,
+			last_login_at DATETIME,
+			UNIQUE(provider, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS ldap_accounts (
+			user_id INTEGER PRIMARY KEY,
+			dn TEXT NOT NULL,
+			username TEXT NOT NULL UNIQUE,
+			disabled_by_sync BOOLEAN NOT NULL,
+			created_at DATETIME NOT NULL,
+			last_login_at DATETIME,
+			last_synced_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
 		`CREATE TABLE IF NOT EXISTS system_configuration (
 			id INTEGER PRIMARY KEY,
 			version TEXT NOT NULL,
@@ -355,6 +408,16 @@ func setupTestDB(t *testing.T) *database.DB {
 			tags TEXT DEFAULT '[]',
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS password_hashing (
+			id INTEGER PRIMARY KEY,
+			algorithm TEXT NOT NULL,
+			memory_kib INTEGER NOT NULL DEFAULT 0,
+			iterations INTEGER NOT NULL DEFAULT 0,
+			parallelism INTEGER NOT NULL DEFAULT 0,
+			bcrypt_cost INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL,
+			updated_by INTEGER
+		)`,
 		`INSERT OR IGNORE INTO users (id, username, email, password_hash, salt, is_active) VALUES (1, 'testuser', 'test@example.com', '', '', 1)`,
 		`INSERT OR IGNORE INTO users (id, username, email, password_hash, salt, is_active) VALUES (2, 'testuser2', 'test2@example.com', '', '', 1)`,
 	}
@@ -16,6 +16,9 @@ type WebDAVClient struct {
 	baseURL  string
 	username string
 	password string
+
+	// bytesPerSec caps transfer throughput; zero means unlimited
+	bytesPerSec int64
 }
 
 type WebDAVFile struct {
@@ -36,6 +39,12 @@ func NewWebDAVClient(url, username, password string) *WebDAVClient {
 	}
 }
 
+// SetBandwidthLimit caps upload and download throughput in bytes per second.
+// Zero removes the limit.
+func (c *WebDAVClient) SetBandwidthLimit(bytesPerSec int64) {
+	c.bytesPerSec = bytesPerSec
+}
+
 func (c *WebDAVClient) TestConnection() error {
 	_, err := c.client.ReadDir("/")
 	if err != nil {
@@ -87,7 +96,7 @@ func (c *WebDAVClient) UploadFile(localPath, remotePath string) error {
 	defer localFile.Close()
 
 	// Upload to WebDAV
-	err = c.client.WriteStream(remotePath, localFile, 0644)
+	err = c.client.WriteStream(remotePath, newThrottledReader(localFile, c.bytesPerSec), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -117,7 +126,7 @@ func (c *WebDAVClient) DownloadFile(remotePath, localPath string) error {
 	defer localFile.Close()
 
 	// Copy data
-	_, err = io.Copy(localFile, reader)
+	_, err = io.Copy(localFile, newThrottledReader(reader, c.bytesPerSec))
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
@@ -193,11 +193,16 @@ func TestAnalyticsService_GetDashboardMetrics(t *testing.T) {
 	user := CreateTestUser(t, suite.DB.DB, 1)
 
 	t.Run("Get dashboard metrics", func(t *testing.T) {
-		metrics, err := suite.AnalyticsService.GetDashboardMetrics(user.ID)
+		err := suite.AnalyticsService.TrackEvent(user.ID, &models.AnalyticsEventRequest{EventType: "page_view"})
+		AssertNoError(t, err, "Should track event")
+
+		metrics, err := suite.AnalyticsService.GetDashboardMetrics(nil)
 
 		AssertNoError(t, err, "Should not error")
 		AssertNotNil(t, metrics, "Metrics should not be nil")
-		// Stub implementation returns zero values
+		AssertEqual(t, int64(1), metrics.TotalUsers, "Should count the test user")
+		AssertEqual(t, int64(1), metrics.ActiveUsers, "Should count the user as active")
+		AssertEqual(t, 1, metrics.EventBreakdown["page_view"], "Should break down events by type")
 	})
 }
 
@@ -209,11 +214,15 @@ func TestAnalyticsService_GetRealtimeMetrics(t *testing.T) {
 	user := CreateTestUser(t, suite.DB.DB, 1)
 
 	t.Run("Get realtime metrics", func(t *testing.T) {
-		metrics, err := suite.AnalyticsService.GetRealtimeMetrics(user.ID)
+		err := suite.AnalyticsService.TrackEvent(user.ID, &models.AnalyticsEventRequest{EventType: "page_view"})
+		AssertNoError(t, err, "Should track event")
+
+		metrics, err := suite.AnalyticsService.GetRealtimeMetrics()
 
 		AssertNoError(t, err, "Should not error")
 		AssertNotNil(t, metrics, "Metrics should not be nil")
-		// Stub implementation returns zero values
+		AssertEqual(t, 1, metrics.ActiveUsers, "Should count the user as active")
+		AssertEqual(t, 1, metrics.RecentEvents, "Should count the recent event")
 	})
 }
 
@@ -28,8 +28,8 @@ func (m *MockConversionService) CreateConversionJob(userID int, request *models.
 	return nil, args.Error(1)
 }
 
-func (m *MockConversionService) GetJob(userID, jobID int) (*models.ConversionJob, error) {
-	args := m.Called(userID, jobID)
+func (m *MockConversionService) GetJob(jobID int, user *models.User) (*models.ConversionJob, error) {
+	args := m.Called(jobID, user.ID)
 	if job := args.Get(0); job != nil {
 		return job.(*models.ConversionJob), nil
 	}
@@ -41,8 +41,8 @@ func (m *MockConversionService) GetUserJobs(userID int, status *string, limit, o
 	return args.Get(0).([]models.ConversionJob), args.Error(1)
 }
 
-func (m *MockConversionService) CancelJob(userID, jobID int) error {
-	args := m.Called(userID, jobID)
+func (m *MockConversionService) CancelJob(jobID int, user *models.User) error {
+	args := m.Called(jobID, user.ID)
 	return args.Error(0)
 }
 
@@ -111,7 +111,7 @@ func TestConversionIntegration(t *testing.T) {
 	assert.Equal(t, models.ConversionTypeDocument, job.ConversionType)
 
 	// Test 2: Get job by ID
-	retrievedJob, err := conversionService.GetJob(job.ID, userID)
+	retrievedJob, err := conversionService.GetJob(job.ID, &models.User{ID: userID})
 	require.NoError(t, err)
 	assert.Equal(t, job.ID, retrievedJob.ID)
 	assert.Equal(t, job.SourcePath, retrievedJob.SourcePath)
@@ -132,11 +132,11 @@ func TestConversionIntegration(t *testing.T) {
 	assert.NotEmpty(t, formats.Document.Input)
 
 	// Test 5: Cancel job
-	err = conversionService.CancelJob(job.ID, userID)
+	err = conversionService.CancelJob(job.ID, &models.User{ID: userID})
 	require.NoError(t, err)
 
 	// Verify job is cancelled
-	cancelledJob, err := conversionService.GetJob(job.ID, userID)
+	cancelledJob, err := conversionService.GetJob(job.ID, &models.User{ID: userID})
 	require.NoError(t, err)
 	assert.Equal(t, models.ConversionStatusCancelled, cancelledJob.Status)
 }
@@ -167,7 +167,8 @@ func createConversionSchema(db *sql.DB) error {
 			last_login_at DATETIME,
 			last_login_ip TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
 		)`,
 		`CREATE TABLE IF NOT EXISTS roles (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -190,6 +191,7 @@ func createConversionSchema(db *sql.DB) error {
 			settings TEXT,
 			status TEXT NOT NULL,
 			progress INTEGER DEFAULT 0,
+			transfer_rate REAL DEFAULT 0,
 			error_message TEXT,
 			priority INTEGER DEFAULT 1,
 			scheduled_for DATETIME,
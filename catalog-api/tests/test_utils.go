@@ -318,7 +318,8 @@ func createTestTables(db *sql.DB) error {
 			last_login_at DATETIME,
 			last_login_ip TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME
 		)`,
 
 		// Media items table
@@ -331,9 +332,18 @@ func createTestTables(db *sql.DB) error {
 			size INTEGER,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 
+		// Files table, as far as storage totals need it
+		`CREATE TABLE IF NOT EXISTS files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			deleted BOOLEAN DEFAULT 0
+		)`,
+
 		// Analytics events table
 		`CREATE TABLE IF NOT EXISTS analytics_events (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -351,6 +361,63 @@ func createTestTables(db *sql.DB) error {
 			location TEXT
 		)`,
 
+		// Media access logs table
+		`CREATE TABLE IF NOT EXISTS media_access_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			media_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			device_info TEXT,
+			location TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			playback_duration INTEGER,
+			access_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Analytics rollups, as far as the dashboard reads them
+		`CREATE TABLE IF NOT EXISTS analytics_retention_policies (
+			table_name TEXT PRIMARY KEY,
+			raw_retention_days INTEGER NOT NULL DEFAULT 90,
+			rollup_retention_months INTEGER NOT NULL DEFAULT 24,
+			rolled_up_until DATETIME,
+			last_run_at DATETIME,
+			last_run_error TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS analytics_hourly_rollups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source_table TEXT NOT NULL,
+			bucket_start DATETIME NOT NULL,
+			dimension TEXT NOT NULL,
+			event_count INTEGER NOT NULL DEFAULT 0,
+			user_count INTEGER NOT NULL DEFAULT 0,
+			total_duration INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(source_table, bucket_start, dimension)
+		)`,
+		`CREATE TABLE IF NOT EXISTS analytics_hourly_users (
+			bucket_start DATETIME NOT NULL,
+			source_table TEXT NOT NULL,
+			dimension TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			PRIMARY KEY (bucket_start, source_table, dimension, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS analytics_hourly_media (
+			bucket_start DATETIME NOT NULL,
+			media_id INTEGER NOT NULL,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			total_duration INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (bucket_start, media_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS storage_daily_usage (
+			day DATETIME NOT NULL,
+			storage_root_id INTEGER NOT NULL,
+			file_count INTEGER NOT NULL DEFAULT 0,
+			total_bytes INTEGER NOT NULL DEFAULT 0,
+			captured_at DATETIME NOT NULL,
+			PRIMARY KEY (day, storage_root_id)
+		)`,
+
 		// Favorites table
 		`CREATE TABLE IF NOT EXISTS favorites (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -372,6 +439,7 @@ func createTestTables(db *sql.DB) error {
 			target_format TEXT NOT NULL,
 			status TEXT NOT NULL DEFAULT 'pending',
 			progress INTEGER DEFAULT 0,
+			transfer_rate REAL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			started_at DATETIME,
 			completed_at DATETIME,